@@ -0,0 +1,30 @@
+use std::process::Command;
+use std::time::{SystemTime, UNIX_EPOCH};
+
+/// Stamp the binary with the git SHA and build time for /debug/buildinfo.
+/// Docker builds have no .git, so GIT_SHA may be passed in as a build arg.
+fn main() {
+    let sha = std::env::var("GIT_SHA")
+        .ok()
+        .filter(|s| !s.is_empty())
+        .or_else(|| {
+            Command::new("git")
+                .args(["rev-parse", "HEAD"])
+                .output()
+                .ok()
+                .filter(|o| o.status.success())
+                .and_then(|o| String::from_utf8(o.stdout).ok())
+                .map(|s| s.trim().to_string())
+        })
+        .unwrap_or_else(|| "unknown".to_string());
+
+    let built_at = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.as_secs())
+        .unwrap_or_default();
+
+    println!("cargo:rustc-env=BUILD_GIT_SHA={}", sha);
+    println!("cargo:rustc-env=BUILD_TIMESTAMP={}", built_at);
+    println!("cargo:rerun-if-env-changed=GIT_SHA");
+    println!("cargo:rerun-if-changed=../.git/HEAD");
+}
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS trg_battle_reports_search_text ON battle_reports;
+DROP FUNCTION IF EXISTS battle_reports_search_text();
+
+DROP INDEX IF EXISTS idx_battle_reports_search;
+ALTER TABLE battle_reports DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE battle_reports DROP COLUMN IF EXISTS search_text;
+
+DROP INDEX IF EXISTS idx_messages_search;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_vector;
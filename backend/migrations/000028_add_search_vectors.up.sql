@@ -0,0 +1,51 @@
+-- Full-text search over messages and battle reports
+-- Vectors are built with the 'simple' configuration so mixed Thai/English
+-- content is tokenized without language-specific stemming.
+
+-- Messages: subject ranks above body
+ALTER TABLE messages ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(subject, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(body, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_messages_search ON messages USING GIN (search_vector);
+
+-- Battle reports: searchable by village names, player names, mission and outcome
+ALTER TABLE battle_reports ADD COLUMN search_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE battle_reports ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', search_text)) STORED;
+
+CREATE INDEX idx_battle_reports_search ON battle_reports USING GIN (search_vector);
+
+-- Fill search_text from the villages and players involved when a report is written
+CREATE OR REPLACE FUNCTION battle_reports_search_text() RETURNS TRIGGER AS $$
+BEGIN
+    SELECT concat_ws(' ',
+        av.name, au.display_name,
+        dv.name, du.display_name,
+        NEW.mission::text, NEW.winner)
+    INTO NEW.search_text
+    FROM villages av
+    JOIN users au ON au.id = NEW.attacker_player_id
+    LEFT JOIN villages dv ON dv.id = NEW.defender_village_id
+    LEFT JOIN users du ON du.id = NEW.defender_player_id
+    WHERE av.id = NEW.attacker_village_id;
+
+    NEW.search_text := coalesce(NEW.search_text, '');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_battle_reports_search_text
+    BEFORE INSERT ON battle_reports
+    FOR EACH ROW EXECUTE FUNCTION battle_reports_search_text();
+
+-- Backfill existing reports
+UPDATE battle_reports br
+SET search_text = concat_ws(' ',
+        (SELECT name FROM villages WHERE id = br.attacker_village_id),
+        (SELECT display_name FROM users WHERE id = br.attacker_player_id),
+        (SELECT name FROM villages WHERE id = br.defender_village_id),
+        (SELECT display_name FROM users WHERE id = br.defender_player_id),
+        br.mission::text, br.winner);
@@ -0,0 +1,57 @@
+DROP INDEX IF EXISTS idx_scout_reports_occurred;
+
+-- Collapse battle_reports back into a single unpartitioned table
+DROP TRIGGER IF EXISTS trg_battle_reports_search_text ON battle_reports;
+ALTER TABLE battle_reports RENAME TO battle_reports_partitioned;
+DROP INDEX IF EXISTS idx_battle_reports_attacker;
+DROP INDEX IF EXISTS idx_battle_reports_defender;
+DROP INDEX IF EXISTS idx_battle_reports_id;
+DROP INDEX IF EXISTS idx_battle_reports_search;
+
+CREATE TABLE battle_reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    attacker_player_id UUID NOT NULL REFERENCES users(id),
+    defender_player_id UUID REFERENCES users(id),
+    attacker_village_id UUID NOT NULL REFERENCES villages(id),
+    defender_village_id UUID REFERENCES villages(id),
+    mission mission_type NOT NULL,
+    attacker_troops JSONB NOT NULL DEFAULT '{}',
+    defender_troops JSONB NOT NULL DEFAULT '{}',
+    attacker_losses JSONB NOT NULL DEFAULT '{}',
+    defender_losses JSONB NOT NULL DEFAULT '{}',
+    resources_stolen JSONB NOT NULL DEFAULT '{}',
+    winner VARCHAR(20) NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    read_by_attacker BOOLEAN DEFAULT FALSE,
+    read_by_defender BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    search_text TEXT NOT NULL DEFAULT '',
+    search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', search_text)) STORED
+);
+
+INSERT INTO battle_reports (
+    id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
+    mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
+    resources_stolen, winner, occurred_at, read_by_attacker, read_by_defender, created_at,
+    search_text
+)
+SELECT
+    id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
+    mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
+    resources_stolen, winner, occurred_at, read_by_attacker, read_by_defender, created_at,
+    search_text
+FROM battle_reports_partitioned;
+
+DROP TABLE battle_reports_partitioned CASCADE;
+DROP FUNCTION IF EXISTS create_battle_reports_partition(TIMESTAMPTZ);
+
+CREATE INDEX idx_battle_reports_attacker ON battle_reports(attacker_player_id);
+CREATE INDEX idx_battle_reports_defender ON battle_reports(defender_player_id);
+CREATE INDEX idx_battle_reports_search ON battle_reports USING GIN (search_vector);
+
+CREATE TRIGGER trg_battle_reports_search_text
+    BEFORE INSERT ON battle_reports
+    FOR EACH ROW EXECUTE FUNCTION battle_reports_search_text();
+
+DROP TABLE IF EXISTS report_archives;
+DROP TABLE IF EXISTS world_settings;
@@ -0,0 +1,116 @@
+-- Report retention, archiving and monthly partitioning of battle_reports
+
+-- Per-world settings editable by admins (one row per setting key)
+CREATE TABLE world_settings (
+    key VARCHAR(100) PRIMARY KEY,
+    value JSONB NOT NULL DEFAULT '{}',
+    updated_by UUID REFERENCES users(id),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO world_settings (key, value) VALUES
+    ('report_retention', '{
+        "unread_raid_days": 14,
+        "scout_report_days": 30,
+        "archive_after_days": 90,
+        "archive_enabled": false
+    }');
+
+-- Objects written by the archive job
+CREATE TABLE report_archives (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    object_key TEXT NOT NULL,
+    report_count INTEGER NOT NULL,
+    oldest_occurred_at TIMESTAMPTZ NOT NULL,
+    newest_occurred_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_report_archives_created ON report_archives(created_at DESC);
+
+-- Rebuild battle_reports as a table partitioned by month of occurred_at
+DROP TRIGGER IF EXISTS trg_battle_reports_search_text ON battle_reports;
+ALTER TABLE battle_reports RENAME TO battle_reports_old;
+ALTER INDEX idx_battle_reports_attacker RENAME TO idx_battle_reports_old_attacker;
+ALTER INDEX idx_battle_reports_defender RENAME TO idx_battle_reports_old_defender;
+ALTER INDEX idx_battle_reports_search RENAME TO idx_battle_reports_old_search;
+
+CREATE TABLE battle_reports (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    attacker_player_id UUID NOT NULL REFERENCES users(id),
+    defender_player_id UUID REFERENCES users(id),
+    attacker_village_id UUID NOT NULL REFERENCES villages(id),
+    defender_village_id UUID REFERENCES villages(id),
+    mission mission_type NOT NULL,
+    attacker_troops JSONB NOT NULL DEFAULT '{}',
+    defender_troops JSONB NOT NULL DEFAULT '{}',
+    attacker_losses JSONB NOT NULL DEFAULT '{}',
+    defender_losses JSONB NOT NULL DEFAULT '{}',
+    resources_stolen JSONB NOT NULL DEFAULT '{}',
+    winner VARCHAR(20) NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    read_by_attacker BOOLEAN DEFAULT FALSE,
+    read_by_defender BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    search_text TEXT NOT NULL DEFAULT '',
+    search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', search_text)) STORED,
+    PRIMARY KEY (id, occurred_at)
+) PARTITION BY RANGE (occurred_at);
+
+-- Catches rows outside any monthly partition so inserts never fail
+CREATE TABLE battle_reports_default PARTITION OF battle_reports DEFAULT;
+
+CREATE INDEX idx_battle_reports_attacker ON battle_reports(attacker_player_id, occurred_at DESC);
+CREATE INDEX idx_battle_reports_defender ON battle_reports(defender_player_id, occurred_at DESC);
+CREATE INDEX idx_battle_reports_id ON battle_reports(id);
+CREATE INDEX idx_battle_reports_search ON battle_reports USING GIN (search_vector);
+
+-- Create the monthly partition containing the given timestamp (no-op if it exists)
+CREATE OR REPLACE FUNCTION create_battle_reports_partition(ts TIMESTAMPTZ) RETURNS TEXT AS $$
+DECLARE
+    month_start DATE := date_trunc('month', ts AT TIME ZONE 'UTC')::date;
+    month_end DATE := (date_trunc('month', ts AT TIME ZONE 'UTC') + INTERVAL '1 month')::date;
+    partition_name TEXT := 'battle_reports_' || to_char(month_start, 'YYYY_MM');
+BEGIN
+    IF to_regclass(partition_name) IS NULL THEN
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF battle_reports FOR VALUES FROM (%L) TO (%L)',
+            partition_name,
+            month_start::timestamp AT TIME ZONE 'UTC',
+            month_end::timestamp AT TIME ZONE 'UTC'
+        );
+    END IF;
+    RETURN partition_name;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Partitions for every month that already has reports, plus the current and next month
+SELECT create_battle_reports_partition(m)
+FROM (
+    SELECT DISTINCT date_trunc('month', occurred_at) AS m FROM battle_reports_old
+    UNION
+    SELECT date_trunc('month', NOW())
+    UNION
+    SELECT date_trunc('month', NOW() + INTERVAL '1 month')
+) months;
+
+INSERT INTO battle_reports (
+    id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
+    mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
+    resources_stolen, winner, occurred_at, read_by_attacker, read_by_defender, created_at,
+    search_text
+)
+SELECT
+    id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
+    mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
+    resources_stolen, winner, occurred_at, read_by_attacker, read_by_defender, created_at,
+    search_text
+FROM battle_reports_old;
+
+DROP TABLE battle_reports_old;
+
+CREATE TRIGGER trg_battle_reports_search_text
+    BEFORE INSERT ON battle_reports
+    FOR EACH ROW EXECUTE FUNCTION battle_reports_search_text();
+
+CREATE INDEX idx_scout_reports_occurred ON scout_reports(occurred_at);
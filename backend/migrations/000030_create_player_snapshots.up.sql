@@ -0,0 +1,12 @@
+-- Point-in-time copies of a player's state, taken by admins for support cases
+CREATE TABLE player_snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    taken_by UUID REFERENCES users(id),
+    reason TEXT,
+    data JSONB NOT NULL, -- villages, buildings, troops, troop_queue, armies, heroes, hero_items, hero_adventures
+    restored_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_player_snapshots_user ON player_snapshots(user_id, created_at DESC);
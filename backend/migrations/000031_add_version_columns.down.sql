@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS trg_heroes_version ON heroes;
+DROP TRIGGER IF EXISTS trg_troop_queue_version ON troop_queue;
+DROP TRIGGER IF EXISTS trg_buildings_version ON buildings;
+DROP TRIGGER IF EXISTS trg_villages_version ON villages;
+
+ALTER TABLE heroes DROP COLUMN IF EXISTS version;
+ALTER TABLE troop_queue DROP COLUMN IF EXISTS version;
+ALTER TABLE buildings DROP COLUMN IF EXISTS version;
+ALTER TABLE villages DROP COLUMN IF EXISTS version;
+
+DROP FUNCTION IF EXISTS bump_version();
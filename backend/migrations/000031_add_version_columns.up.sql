@@ -0,0 +1,23 @@
+-- Optimistic concurrency: every update bumps version, and commands that act on
+-- what they read use compare-and-swap (WHERE version = $expected)
+
+CREATE OR REPLACE FUNCTION bump_version() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE villages ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE buildings ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE troop_queue ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE heroes ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+CREATE TRIGGER trg_villages_version BEFORE UPDATE ON villages
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER trg_buildings_version BEFORE UPDATE ON buildings
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER trg_troop_queue_version BEFORE UPDATE ON troop_queue
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER trg_heroes_version BEFORE UPDATE ON heroes
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
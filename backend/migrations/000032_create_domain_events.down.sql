@@ -0,0 +1,16 @@
+DROP TRIGGER IF EXISTS trg_heroes_domain_event ON heroes;
+DROP TRIGGER IF EXISTS trg_messages_domain_event ON messages;
+DROP TRIGGER IF EXISTS trg_armies_domain_event ON armies;
+DROP TRIGGER IF EXISTS trg_troop_queue_domain_event ON troop_queue;
+DROP TRIGGER IF EXISTS trg_troops_domain_event ON troops;
+DROP TRIGGER IF EXISTS trg_buildings_domain_event ON buildings;
+DROP TRIGGER IF EXISTS trg_villages_domain_event ON villages;
+
+DROP FUNCTION IF EXISTS heroes_domain_event();
+DROP FUNCTION IF EXISTS messages_domain_event();
+DROP FUNCTION IF EXISTS armies_domain_event();
+DROP FUNCTION IF EXISTS village_child_domain_event();
+DROP FUNCTION IF EXISTS villages_domain_event();
+DROP FUNCTION IF EXISTS emit_domain_event(UUID, TEXT, UUID, UUID, TEXT);
+
+DROP TABLE IF EXISTS domain_events;
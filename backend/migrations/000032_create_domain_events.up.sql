@@ -0,0 +1,157 @@
+-- Domain event stream: one row per change to an entity a player can see.
+-- Written by triggers so every code path (handlers, background jobs, admin
+-- restores) is captured. Clients resync from an event id cursor.
+CREATE TABLE domain_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,            -- player the change is visible to
+    entity_type VARCHAR(32) NOT NULL, -- village, building, troop, troop_queue, army, message, hero
+    entity_id UUID NOT NULL,
+    village_id UUID,                  -- parent village for village-scoped entities
+    action VARCHAR(16) NOT NULL,      -- upsert, delete
+    tx_id xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_domain_events_user ON domain_events(user_id, id);
+CREATE INDEX idx_domain_events_created ON domain_events(created_at);
+
+CREATE OR REPLACE FUNCTION emit_domain_event(
+    p_user_id UUID, p_entity_type TEXT, p_entity_id UUID, p_village_id UUID, p_action TEXT
+) RETURNS VOID AS $$
+BEGIN
+    IF p_user_id IS NOT NULL THEN
+        INSERT INTO domain_events (user_id, entity_type, entity_id, village_id, action)
+        VALUES (p_user_id, p_entity_type, p_entity_id, p_village_id, p_action);
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Villages: on conquest the old owner sees a delete and the new owner
+-- receives the village together with everything in it
+CREATE OR REPLACE FUNCTION villages_domain_event() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM emit_domain_event(OLD.user_id, 'village', OLD.id, OLD.id, 'delete');
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP = 'UPDATE' AND OLD.user_id IS DISTINCT FROM NEW.user_id THEN
+        PERFORM emit_domain_event(OLD.user_id, 'village', OLD.id, OLD.id, 'delete');
+        INSERT INTO domain_events (user_id, entity_type, entity_id, village_id, action)
+        SELECT NEW.user_id, 'building', id, village_id, 'upsert' FROM buildings WHERE village_id = NEW.id
+        UNION ALL
+        SELECT NEW.user_id, 'troop', id, village_id, 'upsert' FROM troops WHERE village_id = NEW.id
+        UNION ALL
+        SELECT NEW.user_id, 'troop_queue', id, village_id, 'upsert' FROM troop_queue WHERE village_id = NEW.id;
+    END IF;
+
+    PERFORM emit_domain_event(NEW.user_id, 'village', NEW.id, NEW.id, 'upsert');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Buildings, troops and the training queue belong to the village owner.
+-- TG_ARGV[0] is the entity type.
+CREATE OR REPLACE FUNCTION village_child_domain_event() RETURNS TRIGGER AS $$
+DECLARE
+    r RECORD;
+    owner_id UUID;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        r := OLD;
+    ELSE
+        r := NEW;
+    END IF;
+
+    -- NULL when the village itself is being deleted; its delete event covers this row
+    SELECT user_id INTO owner_id FROM villages WHERE id = r.village_id;
+    PERFORM emit_domain_event(
+        owner_id, TG_ARGV[0], r.id, r.village_id,
+        CASE WHEN TG_OP = 'DELETE' THEN 'delete' ELSE 'upsert' END
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Armies are visible to the sender and to the owner of the target village
+CREATE OR REPLACE FUNCTION armies_domain_event() RETURNS TRIGGER AS $$
+DECLARE
+    r RECORD;
+    v_action TEXT;
+    target_owner UUID;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        r := OLD;
+        v_action := 'delete';
+    ELSE
+        r := NEW;
+        v_action := 'upsert';
+    END IF;
+
+    PERFORM emit_domain_event(r.player_id, 'army', r.id, r.from_village_id, v_action);
+
+    SELECT user_id INTO target_owner FROM villages WHERE id = r.to_village_id;
+    IF target_owner IS DISTINCT FROM r.player_id THEN
+        PERFORM emit_domain_event(target_owner, 'army', r.id, r.to_village_id, v_action);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Private messages go to sender and recipient (a per-user soft delete is a
+-- delete for that user); alliance messages go to every member
+CREATE OR REPLACE FUNCTION messages_domain_event() RETURNS TRIGGER AS $$
+DECLARE
+    r RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        r := OLD;
+    ELSE
+        r := NEW;
+    END IF;
+
+    IF r.message_type = 'private' THEN
+        PERFORM emit_domain_event(
+            r.sender_id, 'message', r.id, NULL,
+            CASE WHEN TG_OP = 'DELETE' OR r.sender_deleted THEN 'delete' ELSE 'upsert' END
+        );
+        PERFORM emit_domain_event(
+            r.recipient_id, 'message', r.id, NULL,
+            CASE WHEN TG_OP = 'DELETE' OR r.recipient_deleted THEN 'delete' ELSE 'upsert' END
+        );
+    ELSE
+        INSERT INTO domain_events (user_id, entity_type, entity_id, action)
+        SELECT m.user_id, 'message', r.id,
+               CASE WHEN TG_OP = 'DELETE' THEN 'delete' ELSE 'upsert' END
+        FROM alliance_members m
+        WHERE m.alliance_id = r.alliance_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION heroes_domain_event() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM emit_domain_event(OLD.user_id, 'hero', OLD.id, OLD.home_village_id, 'delete');
+    ELSE
+        PERFORM emit_domain_event(NEW.user_id, 'hero', NEW.id, NEW.home_village_id, 'upsert');
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_villages_domain_event AFTER INSERT OR UPDATE OR DELETE ON villages
+    FOR EACH ROW EXECUTE FUNCTION villages_domain_event();
+CREATE TRIGGER trg_buildings_domain_event AFTER INSERT OR UPDATE OR DELETE ON buildings
+    FOR EACH ROW EXECUTE FUNCTION village_child_domain_event('building');
+CREATE TRIGGER trg_troops_domain_event AFTER INSERT OR UPDATE OR DELETE ON troops
+    FOR EACH ROW EXECUTE FUNCTION village_child_domain_event('troop');
+CREATE TRIGGER trg_troop_queue_domain_event AFTER INSERT OR UPDATE OR DELETE ON troop_queue
+    FOR EACH ROW EXECUTE FUNCTION village_child_domain_event('troop_queue');
+CREATE TRIGGER trg_armies_domain_event AFTER INSERT OR UPDATE OR DELETE ON armies
+    FOR EACH ROW EXECUTE FUNCTION armies_domain_event();
+CREATE TRIGGER trg_messages_domain_event AFTER INSERT OR UPDATE OR DELETE ON messages
+    FOR EACH ROW EXECUTE FUNCTION messages_domain_event();
+CREATE TRIGGER trg_heroes_domain_event AFTER INSERT OR UPDATE OR DELETE ON heroes
+    FOR EACH ROW EXECUTE FUNCTION heroes_domain_event();
@@ -0,0 +1,17 @@
+-- Gameplay commands submitted through the command API. Doubles as the
+-- per-player action log: command_id dedups client retries, and the stored
+-- type + payload can be replayed to reproduce a bug.
+CREATE TABLE player_commands (
+    command_id UUID PRIMARY KEY,            -- chosen by the client
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    command_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, succeeded, rejected
+    result JSONB,
+    error_status INT,                       -- HTTP status of a rejected command
+    error_message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_player_commands_user ON player_commands(user_id, created_at DESC);
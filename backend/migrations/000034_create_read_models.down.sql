@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS trg_alliances_domain_event ON alliances;
+DROP TRIGGER IF EXISTS trg_alliance_members_domain_event ON alliance_members;
+DROP FUNCTION IF EXISTS alliances_domain_event();
+DROP FUNCTION IF EXISTS alliance_members_domain_event();
+
+DROP TABLE IF EXISTS projection_checkpoints;
+DROP TABLE IF EXISTS world_rankings;
+DROP TABLE IF EXISTS alliance_stats;
+DROP TABLE IF EXISTS player_stats;
@@ -0,0 +1,75 @@
+-- Denormalized read models maintained by the projection worker from the
+-- domain event stream, so ranking and profile endpoints never aggregate
+-- over villages/troops/alliance_members on the request path
+
+CREATE TABLE player_stats (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    display_name VARCHAR(255),
+    alliance_id UUID,
+    alliance_tag VARCHAR(4),
+    village_count INT NOT NULL DEFAULT 0,
+    population INT NOT NULL DEFAULT 0,
+    culture_points INT NOT NULL DEFAULT 0,
+    troop_count BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_player_stats_population ON player_stats(population DESC, user_id);
+CREATE INDEX idx_player_stats_alliance ON player_stats(alliance_id);
+
+CREATE TABLE alliance_stats (
+    alliance_id UUID PRIMARY KEY REFERENCES alliances(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    tag VARCHAR(4) NOT NULL,
+    member_count INT NOT NULL DEFAULT 0,
+    village_count INT NOT NULL DEFAULT 0,
+    total_population BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_alliance_stats_population ON alliance_stats(total_population DESC, alliance_id);
+
+-- World top-10s, rewritten after every projection pass that touched stats
+CREATE TABLE world_rankings (
+    category VARCHAR(50) NOT NULL, -- top_population, top_villages, top_culture, top_alliances, ...
+    rank INT NOT NULL,
+    entity_id UUID NOT NULL,
+    name VARCHAR(255),
+    value BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (category, rank)
+);
+
+-- Last domain event each projection has applied
+CREATE TABLE projection_checkpoints (
+    name VARCHAR(50) PRIMARY KEY,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Alliance membership and alliance renames feed the stream too
+CREATE OR REPLACE FUNCTION alliance_members_domain_event() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM emit_domain_event(OLD.user_id, 'alliance_member', OLD.alliance_id, NULL, 'delete');
+    ELSE
+        PERFORM emit_domain_event(NEW.user_id, 'alliance_member', NEW.alliance_id, NULL, 'upsert');
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION alliances_domain_event() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO domain_events (user_id, entity_type, entity_id, action)
+    SELECT m.user_id, 'alliance', NEW.id, 'upsert'
+    FROM alliance_members m
+    WHERE m.alliance_id = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_alliance_members_domain_event AFTER INSERT OR UPDATE OR DELETE ON alliance_members
+    FOR EACH ROW EXECUTE FUNCTION alliance_members_domain_event();
+CREATE TRIGGER trg_alliances_domain_event AFTER UPDATE OF name, tag ON alliances
+    FOR EACH ROW EXECUTE FUNCTION alliances_domain_event();
@@ -0,0 +1,20 @@
+-- Watermarks for world-wide periodic jobs (loyalty regeneration, ...).
+-- Each job's villages are split into shards by id range; a shard's
+-- watermark is the time of the last tick applied to it, so ticks missed
+-- during downtime are caught up from there.
+CREATE TABLE tick_shards (
+    job VARCHAR(50) NOT NULL,
+    shard INT NOT NULL,
+    shard_count INT NOT NULL,
+    watermark TIMESTAMPTZ NOT NULL,
+    -- Lease held by the worker currently processing the shard
+    locked_by UUID,
+    locked_until TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    ticks_applied BIGINT NOT NULL DEFAULT 0,
+    ticks_skipped BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (job, shard)
+);
+
+CREATE INDEX idx_tick_shards_due ON tick_shards(job, watermark);
@@ -0,0 +1,19 @@
+-- Mutating API calls, kept for dispute resolution. Payloads are stored
+-- with tokens, passwords and similar fields already redacted.
+CREATE TABLE api_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID,
+    firebase_uid VARCHAR(128),
+    method VARCHAR(10) NOT NULL,
+    route VARCHAR(255) NOT NULL, -- path with ids replaced by {id}
+    path VARCHAR(1024) NOT NULL,
+    status INT NOT NULL,
+    payload JSONB,
+    duration_ms INT NOT NULL,
+    client_ip VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_audit_log_user ON api_audit_log(user_id, created_at DESC);
+CREATE INDEX idx_api_audit_log_route ON api_audit_log(route, created_at DESC);
+CREATE INDEX idx_api_audit_log_created ON api_audit_log(created_at);
@@ -0,0 +1,9 @@
+-- Every game-data catalog the server has published, keyed by content hash,
+-- so clients pinned to an older version can still fetch it
+CREATE TABLE gamedata_catalogs (
+    version VARCHAR(64) PRIMARY KEY,
+    data JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_gamedata_catalogs_created ON gamedata_catalogs(created_at DESC);
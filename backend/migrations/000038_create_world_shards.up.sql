@@ -0,0 +1,13 @@
+-- Directory of worlds that live outside the primary database. A world
+-- without a row stays on the primary. host/port/database default to the
+-- primary's; schema_name puts the world in its own schema instead of (or
+-- as well as) its own database.
+CREATE TABLE world_shards (
+    world_id VARCHAR(50) PRIMARY KEY,
+    host VARCHAR(255),
+    port INT,
+    database_name VARCHAR(63),
+    schema_name VARCHAR(63),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
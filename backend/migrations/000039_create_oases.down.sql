@@ -0,0 +1,7 @@
+ALTER TABLE armies DROP COLUMN IF EXISTS hero_id;
+
+DROP TABLE IF EXISTS oases;
+DROP TYPE IF EXISTS oasis_type;
+
+-- Note: Cannot remove enum values in PostgreSQL without recreating the type;
+-- 'hero_mansion' stays in building_type
@@ -0,0 +1,31 @@
+-- Oases: tiles held by nature troops that a village can occupy, with its
+-- hero, for a production bonus. Occupation slots come from the hero mansion.
+ALTER TYPE building_type ADD VALUE 'hero_mansion';
+
+CREATE TYPE oasis_type AS ENUM (
+    'wood', 'wood_crop',
+    'clay', 'clay_crop',
+    'iron', 'iron_crop',
+    'crop', 'crop_high'
+);
+
+CREATE TABLE oases (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    x INT NOT NULL,
+    y INT NOT NULL,
+    oasis_type oasis_type NOT NULL,
+    owner_village_id UUID REFERENCES villages(id) ON DELETE SET NULL,
+    conquered_at TIMESTAMPTZ,
+    -- {nature_troop: count}; only unoccupied oases regrow
+    animals JSONB NOT NULL DEFAULT '{}',
+    last_regrowth_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (x, y)
+);
+
+CREATE INDEX idx_oases_owner ON oases(owner_village_id) WHERE owner_village_id IS NOT NULL;
+CREATE INDEX idx_oases_regrowth ON oases(last_regrowth_at) WHERE owner_village_id IS NULL;
+
+-- The hero leading an army, if any; needed to occupy an oasis
+ALTER TABLE armies ADD COLUMN hero_id UUID REFERENCES heroes(id) ON DELETE SET NULL;
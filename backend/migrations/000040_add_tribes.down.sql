@@ -0,0 +1,5 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_tribe_playable;
+ALTER TABLE users DROP COLUMN IF EXISTS tribe;
+
+-- Note: Cannot remove enum values in PostgreSQL without recreating the type;
+-- 'elephant_trough', 'brewery' and 'trapper' stay in building_type
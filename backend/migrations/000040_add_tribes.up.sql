@@ -0,0 +1,9 @@
+-- Players belong to a tribe, picked when they register. Accounts from
+-- before tribes play as Phasuttha, whose roster they could already train.
+ALTER TABLE users ADD COLUMN tribe tribe_type NOT NULL DEFAULT 'phasuttha';
+ALTER TABLE users ADD CONSTRAINT users_tribe_playable CHECK (tribe <> 'special');
+
+-- Tribe-only buildings
+ALTER TYPE building_type ADD VALUE 'elephant_trough';
+ALTER TYPE building_type ADD VALUE 'brewery';
+ALTER TYPE building_type ADD VALUE 'trapper';
@@ -0,0 +1,2 @@
+-- Note: Cannot remove enum values in PostgreSQL without recreating the type;
+-- 'tournament_square' stays in building_type
@@ -0,0 +1,2 @@
+-- Tournament square: speeds up troops on long marches
+ALTER TYPE building_type ADD VALUE 'tournament_square';
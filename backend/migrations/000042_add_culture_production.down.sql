@@ -0,0 +1,2 @@
+ALTER TABLE villages DROP COLUMN IF EXISTS culture_updated_at;
+ALTER TABLE villages DROP COLUMN IF EXISTS culture_per_day;
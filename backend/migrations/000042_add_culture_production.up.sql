@@ -0,0 +1,4 @@
+-- Culture points a village produces per day, recalculated from its
+-- buildings alongside population, and when they were last paid out
+ALTER TABLE villages ADD COLUMN culture_per_day INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE villages ADD COLUMN culture_updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_inactive_since;
+ALTER TABLE users DROP COLUMN IF EXISTS decayed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS inactive_since;
@@ -0,0 +1,7 @@
+-- Gray zone: players who stopped logging in. The inactivity job sets
+-- inactive_since and paces the daily decay with decayed_at; logging in
+-- clears both.
+ALTER TABLE users ADD COLUMN inactive_since TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN decayed_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_inactive_since ON users(inactive_since) WHERE inactive_since IS NOT NULL;
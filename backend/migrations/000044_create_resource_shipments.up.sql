@@ -0,0 +1,25 @@
+-- Resources sent by merchants from one village's market to another village.
+-- Doubles as the ledger the anti-pushing limits are checked against.
+CREATE TABLE resource_shipments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    receiver_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    to_village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    wood INT NOT NULL DEFAULT 0,
+    clay INT NOT NULL DEFAULT 0,
+    iron INT NOT NULL DEFAULT 0,
+    crop INT NOT NULL DEFAULT 0,
+    merchants INT NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL,
+    arrives_at TIMESTAMPTZ NOT NULL,
+    -- Merchants are busy until they are back home
+    returns_at TIMESTAMPTZ NOT NULL,
+    delivered BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_resource_shipments_arrival ON resource_shipments(arrives_at) WHERE NOT delivered;
+CREATE INDEX idx_resource_shipments_from ON resource_shipments(from_village_id, returns_at);
+CREATE INDEX idx_resource_shipments_to ON resource_shipments(to_village_id, arrives_at);
+CREATE INDEX idx_resource_shipments_pair ON resource_shipments(sender_id, receiver_id, sent_at);
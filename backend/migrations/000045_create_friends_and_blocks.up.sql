@@ -0,0 +1,30 @@
+-- Friend requests and friendships. A row is written by the requester and
+-- becomes a friendship once the other player accepts.
+CREATE TYPE friendship_status AS ENUM ('pending', 'accepted');
+
+CREATE TABLE friendships (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    requester_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    addressee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status friendship_status NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMPTZ,
+    CHECK (requester_id <> addressee_id)
+);
+
+-- One row per pair, whichever way round it was requested
+CREATE UNIQUE INDEX idx_friendships_pair
+    ON friendships (LEAST(requester_id, addressee_id), GREATEST(requester_id, addressee_id));
+CREATE INDEX idx_friendships_addressee ON friendships(addressee_id, status);
+CREATE INDEX idx_friendships_requester ON friendships(requester_id, status, created_at);
+
+-- Players a player doesn't want to hear from
+CREATE TABLE user_blocks (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, blocked_id),
+    CHECK (user_id <> blocked_id)
+);
+
+CREATE INDEX idx_user_blocks_blocked ON user_blocks(blocked_id);
@@ -0,0 +1,20 @@
+-- Private notes on villages and players. A note can be shared with the
+-- author's alliance, for members holding at least `min_role`.
+CREATE TYPE note_target AS ENUM ('village', 'player');
+
+CREATE TABLE notes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    author_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_type note_target NOT NULL,
+    target_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    alliance_id UUID REFERENCES alliances(id) ON DELETE CASCADE,
+    min_role alliance_role,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((alliance_id IS NULL) = (min_role IS NULL))
+);
+
+CREATE INDEX idx_notes_author ON notes(author_id, target_type, target_id);
+CREATE INDEX idx_notes_alliance ON notes(alliance_id, target_type, target_id)
+    WHERE alliance_id IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_activity;
+DROP TYPE IF EXISTS activity_kind;
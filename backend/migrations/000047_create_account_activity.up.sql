@@ -0,0 +1,18 @@
+-- What happened on an account, shown to its owner so they can spot a
+-- compromise: logins, armies sent and gold spent, with where they came from.
+CREATE TYPE activity_kind AS ENUM ('login', 'army_sent', 'gold_spent');
+
+CREATE TABLE account_activity (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Who acted, when it wasn't the owner
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    kind activity_kind NOT NULL,
+    client_ip VARCHAR(64),
+    device VARCHAR(255), -- User-Agent
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_account_activity_user ON account_activity(user_id, created_at DESC);
+CREATE INDEX idx_account_activity_created ON account_activity(created_at);
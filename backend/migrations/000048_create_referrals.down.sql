@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS referrals;
+DROP TYPE IF EXISTS referral_status;
+DROP TABLE IF EXISTS referral_codes;
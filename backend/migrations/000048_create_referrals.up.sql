@@ -0,0 +1,26 @@
+-- Referral codes, one per player, created on first use
+CREATE TABLE referral_codes (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    code VARCHAR(16) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- active: earning milestone rewards; completed: all paid;
+-- rejected: looked like a multi-account, never paid
+CREATE TYPE referral_status AS ENUM ('active', 'completed', 'rejected');
+
+CREATE TABLE referrals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    referrer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    referee_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    status referral_status NOT NULL DEFAULT 'active',
+    -- Milestones already paid out
+    milestones_reached INT NOT NULL DEFAULT 0,
+    gold_earned INT NOT NULL DEFAULT 0,
+    rejected_reason VARCHAR(100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_referrals_referrer ON referrals(referrer_id, created_at DESC);
+CREATE INDEX idx_referrals_active ON referrals(status) WHERE status = 'active';
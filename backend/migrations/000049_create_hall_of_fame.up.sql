@@ -0,0 +1,24 @@
+-- Final results of ended worlds. Lives on the primary database and is keyed
+-- by the Firebase account, so one career spans every world.
+CREATE TABLE hall_of_fame (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    world_id VARCHAR(50) NOT NULL,
+    firebase_uid VARCHAR(128) NOT NULL,
+    display_name VARCHAR(255),
+    tribe tribe_type NOT NULL,
+    final_rank INT NOT NULL,
+    population INT NOT NULL,
+    village_count INT NOT NULL,
+    culture_points INT NOT NULL,
+    alliance_name VARCHAR(50),
+    alliance_tag VARCHAR(4),
+    alliance_rank INT,
+    -- [{ "category": "top_population", "rank": 1 }, ...]
+    medals JSONB NOT NULL DEFAULT '[]',
+    ended_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (world_id, firebase_uid)
+);
+
+CREATE INDEX idx_hall_of_fame_account ON hall_of_fame(firebase_uid, ended_at DESC);
+CREATE INDEX idx_hall_of_fame_world ON hall_of_fame(world_id, final_rank);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS world_weekly_combat;
+DROP TABLE IF EXISTS world_daily_stats;
+DROP FUNCTION IF EXISTS troop_total(JSONB);
@@ -0,0 +1,28 @@
+-- Troops in a troops/losses map: {"unit": count, ...}
+CREATE FUNCTION troop_total(troops JSONB) RETURNS BIGINT
+LANGUAGE SQL IMMUTABLE AS $$
+    SELECT COALESCE(SUM(value::BIGINT), 0) FROM jsonb_each_text(troops)
+$$;
+
+-- World statistics kept by the stats projection worker. Aggregated per day
+-- so the history outlives battle report retention.
+CREATE TABLE world_daily_stats (
+    day DATE PRIMARY KEY,
+    total_players INT NOT NULL DEFAULT 0,
+    active_players INT NOT NULL DEFAULT 0,
+    battles INT NOT NULL DEFAULT 0,
+    troops_killed BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Troops each player killed in a week, attacking and defending
+CREATE TABLE world_weekly_combat (
+    week_start DATE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attack_kills BIGINT NOT NULL DEFAULT 0,
+    defense_kills BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (week_start, user_id)
+);
+
+CREATE INDEX idx_world_weekly_combat_attack ON world_weekly_combat(week_start, attack_kills DESC);
+CREATE INDEX idx_world_weekly_combat_defense ON world_weekly_combat(week_start, defense_kills DESC);
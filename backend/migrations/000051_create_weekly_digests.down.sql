@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_preferences;
+DROP TABLE IF EXISTS weekly_population;
+DROP TABLE IF EXISTS weekly_digests;
@@ -0,0 +1,23 @@
+-- Weekly world newspaper: biggest climbers, biggest battles, new alliances
+CREATE TABLE weekly_digests (
+    week_start DATE PRIMARY KEY,
+    content JSONB NOT NULL,
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Set once the digest was mailed to opted-in players
+    emailed_at TIMESTAMPTZ
+);
+
+-- Each player's population at the end of a week, the baseline for climbers
+CREATE TABLE weekly_population (
+    week_start DATE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    population INT NOT NULL,
+    PRIMARY KEY (week_start, user_id)
+);
+
+-- Email the player has asked for; everything is off by default
+CREATE TABLE email_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    weekly_digest BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
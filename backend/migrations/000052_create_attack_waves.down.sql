@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS attack_wave_sends;
+DROP TABLE IF EXISTS attack_waves;
+DROP TYPE IF EXISTS wave_send_status;
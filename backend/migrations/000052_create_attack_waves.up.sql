@@ -0,0 +1,32 @@
+-- Attack waves: several armies timed to land on one target together. Each
+-- send leaves its village at send_at; the scheduler sends it server-side.
+CREATE TYPE wave_send_status AS ENUM ('planned', 'sent', 'failed', 'cancelled');
+
+CREATE TABLE attack_waves (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    player_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_x INT NOT NULL,
+    to_y INT NOT NULL,
+    arrive_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_attack_waves_player ON attack_waves(player_id, arrive_at DESC);
+
+CREATE TABLE attack_wave_sends (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    wave_id UUID NOT NULL REFERENCES attack_waves(id) ON DELETE CASCADE,
+    from_village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    mission mission_type NOT NULL,
+    troops JSONB NOT NULL,
+    hero_id UUID,
+    send_at TIMESTAMPTZ NOT NULL,
+    status wave_send_status NOT NULL DEFAULT 'planned',
+    army_id UUID,
+    -- Why the send failed, e.g. the troops were no longer home
+    error TEXT,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_attack_wave_sends_wave ON attack_wave_sends(wave_id, send_at);
+CREATE INDEX idx_attack_wave_sends_due ON attack_wave_sends(send_at) WHERE status = 'planned';
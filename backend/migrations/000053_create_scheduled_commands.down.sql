@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS scheduled_commands;
+DROP TYPE IF EXISTS scheduled_command_status;
@@ -0,0 +1,20 @@
+-- Gameplay commands the player asked the server to run later. At
+-- execute_at the command goes through the normal command path under
+-- command_id, so its outcome lands in player_commands like any other.
+CREATE TYPE scheduled_command_status AS ENUM ('pending', 'executed', 'failed', 'cancelled');
+
+CREATE TABLE scheduled_commands (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    command_id UUID NOT NULL UNIQUE,
+    command_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    execute_at TIMESTAMPTZ NOT NULL,
+    status scheduled_command_status NOT NULL DEFAULT 'pending',
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    executed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_scheduled_commands_user ON scheduled_commands(user_id, execute_at DESC);
+CREATE INDEX idx_scheduled_commands_due ON scheduled_commands(execute_at) WHERE status = 'pending';
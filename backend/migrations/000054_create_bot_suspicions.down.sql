@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS bot_suspicions;
+DROP TYPE IF EXISTS bot_review_status;
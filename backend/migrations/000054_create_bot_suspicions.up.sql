@@ -0,0 +1,21 @@
+-- Players whose command timing looks scripted, scored by the bot detection
+-- job from player_commands. Rows stay until an admin reviews them.
+CREATE TYPE bot_review_status AS ENUM ('pending', 'cleared', 'confirmed');
+
+CREATE TABLE bot_suspicions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    score INT NOT NULL,                     -- 0-100
+    timing_entropy DOUBLE PRECISION NOT NULL, -- bits, over gaps between commands
+    active_hours INT NOT NULL,              -- hours of the last day with commands
+    peak_per_minute INT NOT NULL,
+    commands_analyzed INT NOT NULL,
+    challenge_required BOOLEAN NOT NULL DEFAULT FALSE,
+    status bot_review_status NOT NULL DEFAULT 'pending',
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ,
+    review_note TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_bot_suspicions_queue ON bot_suspicions(status, score DESC);
@@ -0,0 +1,4 @@
+ALTER TABLE account_activity DROP COLUMN IF EXISTS ip_category;
+DROP TABLE IF EXISTS ip_lookups;
+DROP TABLE IF EXISTS ip_ranges;
+DROP TYPE IF EXISTS ip_category;
@@ -0,0 +1,22 @@
+-- What kind of network an address belongs to. Local ranges are maintained
+-- by admins (datacenter lists, Tor exits, ...); answers from the optional
+-- external provider are cached per address.
+CREATE TYPE ip_category AS ENUM ('datacenter', 'vpn', 'proxy', 'tor');
+
+CREATE TABLE ip_ranges (
+    id BIGSERIAL PRIMARY KEY,
+    cidr CIDR NOT NULL UNIQUE,
+    category ip_category NOT NULL,
+    source VARCHAR(100) NOT NULL DEFAULT 'manual',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_ip_ranges_cidr ON ip_ranges USING gist (cidr inet_ops);
+
+CREATE TABLE ip_lookups (
+    ip INET PRIMARY KEY,
+    category ip_category,                   -- NULL: the provider found nothing
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE account_activity ADD COLUMN ip_category ip_category;
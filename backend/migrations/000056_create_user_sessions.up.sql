@@ -0,0 +1,16 @@
+-- Signed-in devices. A session is one sign-in: every token refreshed from
+-- it carries the same session_key (a hash of the uid and sign-in time), so
+-- revoking the row logs that device out.
+CREATE TABLE user_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_key VARCHAR(64) NOT NULL UNIQUE,
+    device VARCHAR(255),                    -- User-Agent
+    client_ip VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions(user_id, last_seen_at DESC);
+CREATE INDEX idx_user_sessions_idle ON user_sessions(last_seen_at) WHERE revoked_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_tokens;
+DROP TYPE IF EXISTS account_token_purpose;
@@ -0,0 +1,21 @@
+-- Single-use tokens mailed for email changes and account recovery. Only a
+-- hash of each token is stored.
+CREATE TYPE account_token_purpose AS ENUM ('email_change', 'recovery');
+
+CREATE TABLE account_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose account_token_purpose NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    -- The address the token was mailed to, and the one the account gets
+    email VARCHAR(255) NOT NULL,
+    -- The account's address when the token was created
+    previous_email VARCHAR(255),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_account_tokens_user ON account_tokens(user_id, purpose, created_at DESC);
+CREATE INDEX idx_account_tokens_previous_email ON account_tokens(LOWER(previous_email), used_at)
+    WHERE purpose = 'email_change';
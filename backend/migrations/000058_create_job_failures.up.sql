@@ -0,0 +1,21 @@
+-- Failures of individual queue items (army arrivals, ...). An item that
+-- keeps failing is quarantined: skipped by its job until an admin retries
+-- it, so one poison item can't wedge world processing.
+CREATE TABLE job_failures (
+    id BIGSERIAL PRIMARY KEY,
+    job VARCHAR(50) NOT NULL,
+    item_id UUID NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    -- The item as it was on the last failed attempt
+    payload JSONB,
+    last_error TEXT NOT NULL,
+    panicked BOOLEAN NOT NULL DEFAULT FALSE,
+    retry_at TIMESTAMPTZ NOT NULL,
+    quarantined_at TIMESTAMPTZ,
+    first_failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (job, item_id)
+);
+
+CREATE INDEX idx_job_failures_quarantined ON job_failures(quarantined_at DESC)
+    WHERE quarantined_at IS NOT NULL;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS attack_warnings;
+
+ALTER TABLE email_preferences
+    DROP COLUMN IF EXISTS attack_warned_at,
+    DROP COLUMN IF EXISTS attack_quiet_minutes,
+    DROP COLUMN IF EXISTS attack_warning;
@@ -0,0 +1,13 @@
+-- Opt-in email warnings about attacks heading for an offline player,
+-- batched into at most one email per quiet period
+ALTER TABLE email_preferences
+    ADD COLUMN attack_warning BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN attack_quiet_minutes INTEGER NOT NULL DEFAULT 60,
+    ADD COLUMN attack_warned_at TIMESTAMPTZ;
+
+-- Incoming armies already mentioned in a warning
+CREATE TABLE attack_warnings (
+    army_id UUID PRIMARY KEY REFERENCES armies(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    warned_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS economy_ledger;
+DROP TYPE IF EXISTS ledger_kind;
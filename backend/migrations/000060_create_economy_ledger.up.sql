@@ -0,0 +1,53 @@
+-- Every transfer of resources between players: merchant shipments and
+-- plunder. Backs the player's trade history and the admin flow reports.
+CREATE TYPE ledger_kind AS ENUM ('shipment', 'plunder');
+
+CREATE TABLE economy_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    kind ledger_kind NOT NULL,
+    -- Whoever lost the resources: the sender, or the plundered defender
+    from_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    to_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    -- Villages change hands and get destroyed, so no foreign keys
+    from_village_id UUID NOT NULL,
+    to_village_id UUID NOT NULL,
+    wood INT NOT NULL DEFAULT 0,
+    clay INT NOT NULL DEFAULT 0,
+    iron INT NOT NULL DEFAULT 0,
+    crop INT NOT NULL DEFAULT 0,
+    -- The shipment or battle report behind the entry
+    source_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_economy_ledger_from ON economy_ledger(from_user_id, created_at DESC);
+CREATE INDEX idx_economy_ledger_to ON economy_ledger(to_user_id, created_at DESC);
+CREATE INDEX idx_economy_ledger_created ON economy_ledger(created_at);
+
+-- Carry over the history we already have
+INSERT INTO economy_ledger (
+    kind, from_user_id, to_user_id, from_village_id, to_village_id,
+    wood, clay, iron, crop, source_id, created_at
+)
+SELECT 'shipment', sender_id, receiver_id, from_village_id, to_village_id,
+       wood, clay, iron, crop, id, sent_at
+FROM resource_shipments;
+
+INSERT INTO economy_ledger (
+    kind, from_user_id, to_user_id, from_village_id, to_village_id,
+    wood, clay, iron, crop, source_id, created_at
+)
+SELECT 'plunder', defender_player_id, attacker_player_id,
+       defender_village_id, attacker_village_id,
+       COALESCE((resources_stolen->>'wood')::INT, 0),
+       COALESCE((resources_stolen->>'clay')::INT, 0),
+       COALESCE((resources_stolen->>'iron')::INT, 0),
+       COALESCE((resources_stolen->>'crop')::INT, 0),
+       id, occurred_at
+FROM battle_reports
+WHERE defender_player_id IS NOT NULL
+  AND defender_village_id IS NOT NULL
+  AND COALESCE((resources_stolen->>'wood')::INT, 0)
+    + COALESCE((resources_stolen->>'clay')::INT, 0)
+    + COALESCE((resources_stolen->>'iron')::INT, 0)
+    + COALESCE((resources_stolen->>'crop')::INT, 0) > 0;
@@ -0,0 +1,20 @@
+-- Build orders waiting for a free build slot. They are paid for when
+-- queued and start on their own, oldest first, when a slot frees up.
+CREATE TABLE building_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    -- NULL for a new building, which is placed when the order starts
+    building_id UUID REFERENCES buildings(id) ON DELETE CASCADE,
+    slot INT NOT NULL,
+    building_type building_type NOT NULL,
+    target_level INT NOT NULL,
+    -- What was paid, refunded if the order is cancelled
+    wood INT NOT NULL,
+    clay INT NOT NULL,
+    iron INT NOT NULL,
+    crop INT NOT NULL,
+    time_seconds INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_building_queue_village ON building_queue(village_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS research_queue;
+DROP TABLE IF EXISTS village_research;
@@ -0,0 +1,26 @@
+-- Units a village has researched in its academy, and the research in
+-- progress (one per village at a time)
+CREATE TABLE village_research (
+    village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    troop_type troop_type NOT NULL,
+    researched_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (village_id, troop_type)
+);
+
+CREATE TABLE research_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    village_id UUID NOT NULL UNIQUE REFERENCES villages(id) ON DELETE CASCADE,
+    troop_type troop_type NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_research_queue_ends_at ON research_queue(ends_at);
+
+-- Villages keep training what they already have or are training
+INSERT INTO village_research (village_id, troop_type)
+SELECT village_id, troop_type FROM troops WHERE count > 0
+UNION
+SELECT village_id, troop_type FROM troop_queue
+ON CONFLICT DO NOTHING;
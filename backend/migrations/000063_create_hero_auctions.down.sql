@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS hero_auction_bids;
+DROP TABLE IF EXISTS hero_auctions;
+DROP TYPE IF EXISTS auction_status;
+DROP TYPE IF EXISTS auction_currency;
+ALTER TABLE users DROP COLUMN IF EXISTS silver_balance;
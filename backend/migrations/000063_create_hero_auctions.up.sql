@@ -0,0 +1,43 @@
+-- Silver: earned on adventures and by selling items, spent at the auction
+ALTER TABLE users ADD COLUMN IF NOT EXISTS silver_balance INTEGER NOT NULL DEFAULT 0;
+
+CREATE TYPE auction_currency AS ENUM ('silver', 'gold');
+CREATE TYPE auction_status AS ENUM ('open', 'sold', 'expired', 'cancelled');
+
+-- Hero items up for auction. The item leaves the seller's inventory while
+-- listed, and the leading bid is held from the bidder's balance until
+-- they are outbid or the auction closes.
+CREATE TABLE hero_auctions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Where the item goes back to if nobody buys it
+    seller_hero_id UUID REFERENCES heroes(id) ON DELETE SET NULL,
+    item_definition_id UUID NOT NULL REFERENCES item_definitions(id),
+    quantity INT NOT NULL,
+    currency auction_currency NOT NULL,
+    starting_bid INT NOT NULL,
+    current_bid INT,
+    bidder_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    -- Where the item goes if the bidder wins
+    bidder_hero_id UUID REFERENCES heroes(id) ON DELETE SET NULL,
+    bid_count INT NOT NULL DEFAULT 0,
+    ends_at TIMESTAMPTZ NOT NULL,
+    status auction_status NOT NULL DEFAULT 'open',
+    closed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX idx_hero_auctions_open ON hero_auctions(ends_at) WHERE status = 'open';
+CREATE INDEX idx_hero_auctions_seller ON hero_auctions(seller_id, created_at DESC);
+CREATE INDEX idx_hero_auctions_bidder ON hero_auctions(bidder_id) WHERE status = 'open';
+
+CREATE TABLE hero_auction_bids (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    auction_id UUID NOT NULL REFERENCES hero_auctions(id) ON DELETE CASCADE,
+    bidder_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_hero_auction_bids_auction ON hero_auction_bids(auction_id, created_at);
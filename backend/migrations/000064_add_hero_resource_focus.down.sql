@@ -0,0 +1,4 @@
+ALTER TABLE heroes DROP COLUMN IF EXISTS attributes_reset_at;
+ALTER TABLE heroes DROP COLUMN IF EXISTS resource_focus_changed_at;
+ALTER TABLE heroes DROP COLUMN IF EXISTS resource_focus;
+DROP TYPE IF EXISTS hero_resource_focus;
@@ -0,0 +1,9 @@
+-- Where a hero's resource points go: spread over all four resources, or
+-- concentrated on one of them
+CREATE TYPE hero_resource_focus AS ENUM ('all', 'wood', 'clay', 'iron', 'crop');
+
+ALTER TABLE heroes ADD COLUMN IF NOT EXISTS resource_focus hero_resource_focus NOT NULL DEFAULT 'all';
+
+-- Cooldowns for switching the focus and for taking assigned points back
+ALTER TABLE heroes ADD COLUMN IF NOT EXISTS resource_focus_changed_at TIMESTAMPTZ;
+ALTER TABLE heroes ADD COLUMN IF NOT EXISTS attributes_reset_at TIMESTAMPTZ;
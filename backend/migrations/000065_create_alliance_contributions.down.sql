@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS alliance_awards;
+DROP TABLE IF EXISTS alliance_contributions;
+DROP TYPE IF EXISTS alliance_award_category;
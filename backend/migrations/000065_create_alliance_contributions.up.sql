@@ -0,0 +1,32 @@
+CREATE TYPE alliance_award_category AS ENUM ('defender', 'donor', 'attacker', 'mvp');
+
+-- What each member did for their alliance, one row per member per week
+-- (weeks start Monday 00:00 UTC)
+CREATE TABLE alliance_contributions (
+    alliance_id UUID NOT NULL REFERENCES alliances(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    week_start DATE NOT NULL,
+    -- Upkeep of attackers killed by this member's troops defending allied villages
+    defense_points BIGINT NOT NULL DEFAULT 0,
+    -- Resources shipped to other members
+    resources_donated BIGINT NOT NULL DEFAULT 0,
+    -- Attacks on alliances this one has declared war on, and the upkeep they killed
+    war_attacks INT NOT NULL DEFAULT 0,
+    war_points BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (alliance_id, week_start, user_id)
+);
+
+-- One winner per category per alliance per week
+CREATE TABLE alliance_awards (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    alliance_id UUID NOT NULL REFERENCES alliances(id) ON DELETE CASCADE,
+    week_start DATE NOT NULL,
+    category alliance_award_category NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (alliance_id, week_start, category)
+);
+
+CREATE INDEX idx_alliance_awards_week ON alliance_awards(week_start);
@@ -0,0 +1,3 @@
+ALTER TABLE alliance_invitations DROP COLUMN IF EXISTS merge_id;
+DROP TABLE IF EXISTS alliance_merges;
+DROP TYPE IF EXISTS alliance_merge_status;
@@ -0,0 +1,27 @@
+CREATE TYPE alliance_merge_status AS ENUM ('pending', 'accepted', 'rejected', 'cancelled', 'completed');
+
+-- One alliance inviting another to join it wholesale. Once the invited
+-- alliance's leader accepts, every member gets an invitation of their own
+-- and moves over when they confirm; the last one out closes the old
+-- alliance.
+CREATE TABLE alliance_merges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- The alliance members move into
+    alliance_id UUID NOT NULL REFERENCES alliances(id) ON DELETE CASCADE,
+    -- The alliance being merged in; gone once the merge completes
+    merging_alliance_id UUID REFERENCES alliances(id) ON DELETE SET NULL,
+    merging_alliance_tag VARCHAR(4) NOT NULL,
+    proposed_by UUID NOT NULL REFERENCES users(id),
+    status alliance_merge_status NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_alliance_merges_alliance ON alliance_merges(alliance_id);
+CREATE INDEX idx_alliance_merges_merging ON alliance_merges(merging_alliance_id);
+
+-- Invitations sent to each member of the merging alliance
+ALTER TABLE alliance_invitations
+    ADD COLUMN IF NOT EXISTS merge_id UUID REFERENCES alliance_merges(id) ON DELETE SET NULL;
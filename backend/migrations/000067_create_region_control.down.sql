@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS region_victory;
+DROP TABLE IF EXISTS alliance_victory_points;
+DROP TABLE IF EXISTS region_control;
@@ -0,0 +1,30 @@
+-- Region control victory: who holds each region of the map and since when
+CREATE TABLE region_control (
+    region_id INT PRIMARY KEY,
+    alliance_id UUID REFERENCES alliances(id) ON DELETE SET NULL,
+    held_since TIMESTAMPTZ,
+    -- Held past the hold time; earns points and its bonus applies
+    scoring BOOLEAN NOT NULL DEFAULT FALSE,
+    evaluated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_region_control_alliance ON region_control(alliance_id);
+
+CREATE TABLE alliance_victory_points (
+    alliance_id UUID PRIMARY KEY REFERENCES alliances(id) ON DELETE CASCADE,
+    points BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_alliance_victory_points_points ON alliance_victory_points(points DESC);
+
+-- The world's winner. A single row, kept after the alliance is gone.
+CREATE TABLE region_victory (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    alliance_id UUID REFERENCES alliances(id) ON DELETE SET NULL,
+    alliance_name VARCHAR(50) NOT NULL,
+    alliance_tag VARCHAR(4) NOT NULL,
+    points BIGINT NOT NULL,
+    won_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
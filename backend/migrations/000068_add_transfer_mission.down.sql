@@ -0,0 +1,4 @@
+-- Transfers still on the way go back to where they came from
+UPDATE armies SET is_returning = TRUE, returns_at = arrives_at WHERE mission = 'transfer';
+
+-- Note: Cannot remove enum values in PostgreSQL without recreating the type
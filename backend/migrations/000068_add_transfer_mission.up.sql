@@ -0,0 +1,2 @@
+-- Troops moving for good to another of the owner's villages
+ALTER TYPE mission_type ADD VALUE 'transfer';
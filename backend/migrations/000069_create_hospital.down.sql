@@ -0,0 +1,6 @@
+ALTER TABLE battle_reports DROP COLUMN IF EXISTS defender_wounded;
+DROP TABLE IF EXISTS healing_queue;
+DROP TABLE IF EXISTS wounded_troops;
+
+-- Note: Cannot remove enum values in PostgreSQL without recreating the type;
+-- 'hospital' stays in building_type
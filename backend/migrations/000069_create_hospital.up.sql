@@ -0,0 +1,27 @@
+-- Hospital: part of a village's defensive losses are wounded instead of
+-- killed and can be healed back into service
+ALTER TYPE building_type ADD VALUE 'hospital';
+
+CREATE TABLE wounded_troops (
+    village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    troop_type troop_type NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0 CHECK (count >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (village_id, troop_type)
+);
+
+CREATE TABLE healing_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    troop_type troop_type NOT NULL,
+    count INTEGER NOT NULL CHECK (count > 0),
+    started_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_healing_queue_village_id ON healing_queue(village_id);
+CREATE INDEX idx_healing_queue_ends_at ON healing_queue(ends_at);
+
+-- Defender troops taken to the hospital, per battle
+ALTER TABLE battle_reports ADD COLUMN defender_wounded JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,8 @@
+-- Resource field distribution of a village's tile (wood, clay, iron,
+-- crop). Existing villages were all founded with the standard layout.
+CREATE TYPE field_type AS ENUM (
+    '4446', '4437', '4347', '3447', '3456', '3546',
+    '4356', '4536', '5346', '5436', '3339', '11115'
+);
+
+ALTER TABLE villages ADD COLUMN field_type field_type NOT NULL DEFAULT '4446';
@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS idx_notes_deleted_at;
+DROP INDEX IF EXISTS idx_scout_reports_deleted_at;
+DROP INDEX IF EXISTS idx_battle_reports_deleted_at;
+DROP INDEX IF EXISTS idx_messages_deleted_at;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE scout_reports
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS deleted_by_defender,
+    DROP COLUMN IF EXISTS deleted_by_attacker;
+
+ALTER TABLE battle_reports
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS deleted_by_defender,
+    DROP COLUMN IF EXISTS deleted_by_attacker;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,27 @@
+-- Soft delete: player deletions only hide rows, which support can restore
+-- until the purge job removes them after the retention period.
+-- Rows seen by two players are hidden per side and count as deleted once
+-- every side has deleted them.
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMPTZ;
+
+UPDATE messages SET deleted_at = NOW()
+WHERE message_type = 'private' AND sender_deleted AND recipient_deleted;
+
+ALTER TABLE battle_reports
+    ADD COLUMN deleted_by_attacker BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN deleted_by_defender BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+ALTER TABLE scout_reports
+    ADD COLUMN deleted_by_attacker BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN deleted_by_defender BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+ALTER TABLE notes ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_messages_deleted_at ON messages(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_battle_reports_deleted_at ON battle_reports(deleted_at)
+    WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_scout_reports_deleted_at ON scout_reports(deleted_at)
+    WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_notes_deleted_at ON notes(deleted_at) WHERE deleted_at IS NOT NULL;
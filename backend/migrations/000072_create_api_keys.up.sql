@@ -0,0 +1,13 @@
+-- Keys for community tools reading the GraphQL API. Only a hash of the key
+-- is kept; the key itself is shown once when it is created.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    -- First characters of the key, so admins can tell keys apart
+    key_prefix VARCHAR(12) NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
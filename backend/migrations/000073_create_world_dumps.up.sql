@@ -0,0 +1,12 @@
+-- Daily exports of public world data (every village with its coordinates,
+-- owner and alliance) for community tools, in the map.sql tradition
+CREATE TABLE world_dumps (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    format VARCHAR(8) NOT NULL,
+    object_key TEXT NOT NULL,
+    village_count INTEGER NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_world_dumps_format_created ON world_dumps(format, created_at DESC);
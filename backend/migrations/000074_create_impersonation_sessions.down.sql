@@ -0,0 +1,4 @@
+-- Enum values can't be dropped; 'impersonated' stays on activity_kind
+DELETE FROM account_activity WHERE kind = 'impersonated';
+ALTER TABLE api_audit_log DROP COLUMN IF EXISTS impersonator_id;
+DROP TABLE IF EXISTS impersonation_sessions;
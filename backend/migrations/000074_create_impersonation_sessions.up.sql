@@ -0,0 +1,22 @@
+-- Support staff acting as a player. The token is only kept as a hash and
+-- shown once when the session starts; write access is opt-in per session.
+CREATE TABLE impersonation_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    admin_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    player_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    allow_write BOOLEAN NOT NULL DEFAULT FALSE,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_impersonation_sessions_player ON impersonation_sessions(player_id, created_at DESC);
+
+-- Requests made while impersonating are audited under the player, with
+-- the staff member who made them
+ALTER TABLE api_audit_log ADD COLUMN impersonator_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Shown to the player in their activity log
+ALTER TYPE activity_kind ADD VALUE IF NOT EXISTS 'impersonated';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS data_migration_changes;
+DROP TABLE IF EXISTS data_migration_runs;
+DROP TYPE IF EXISTS data_migration_status;
@@ -0,0 +1,38 @@
+-- Balance changes that rewrite live state (storage capacities after a
+-- formula change, culture production...). A run walks the rows in id
+-- order in batches and keeps every row's old and new values, so a dry run
+-- can be reviewed and an applied run rolled back.
+CREATE TYPE data_migration_status AS ENUM ('running', 'completed', 'failed', 'rolled_back');
+
+CREATE TABLE data_migration_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    migration VARCHAR(100) NOT NULL,
+    dry_run BOOLEAN NOT NULL,
+    status data_migration_status NOT NULL DEFAULT 'running',
+    batch_size INT NOT NULL,
+    -- Last row id handled; the run continues after it
+    cursor UUID,
+    processed BIGINT NOT NULL DEFAULT 0,
+    changed BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ,
+    rolled_back_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_data_migration_runs_started ON data_migration_runs(started_at DESC);
+
+-- Only one run of a migration at a time
+CREATE UNIQUE INDEX idx_data_migration_runs_running
+    ON data_migration_runs(migration) WHERE status = 'running';
+
+CREATE TABLE data_migration_changes (
+    run_id UUID NOT NULL REFERENCES data_migration_runs(id) ON DELETE CASCADE,
+    table_name VARCHAR(100) NOT NULL,
+    row_id UUID NOT NULL,
+    -- Only the columns the migration touches
+    before JSONB NOT NULL,
+    after JSONB NOT NULL,
+    PRIMARY KEY (run_id, table_name, row_id)
+);
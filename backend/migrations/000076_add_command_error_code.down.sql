@@ -0,0 +1 @@
+ALTER TABLE player_commands DROP COLUMN IF EXISTS error_code;
@@ -0,0 +1,2 @@
+-- Gameplay error code of a rejected command, so a retry gets the same one
+ALTER TABLE player_commands ADD COLUMN error_code TEXT;
@@ -0,0 +1,3 @@
+ALTER TABLE weekly_digests DROP COLUMN IF EXISTS discord_posted_at;
+ALTER TABLE email_preferences DROP COLUMN IF EXISTS locale;
+DROP TABLE IF EXISTS message_templates;
@@ -0,0 +1,21 @@
+-- Edited copies of the built-in email, Discord and system message templates.
+-- Versions are never changed: each edit adds one, the highest is in use and
+-- going back republishes an old one. A template without rows uses the text
+-- shipped with the server.
+CREATE TABLE message_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    locale VARCHAR(8) NOT NULL,
+    version INT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (name, locale, version)
+);
+
+-- Language of the player's emails
+ALTER TABLE email_preferences ADD COLUMN locale VARCHAR(8) NOT NULL DEFAULT 'en';
+
+-- The digest is also posted to Discord, once
+ALTER TABLE weekly_digests ADD COLUMN discord_posted_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS alliance_operation_signups;
+DROP TABLE IF EXISTS alliance_operation_targets;
+DROP TABLE IF EXISTS alliance_operations;
+DROP TYPE IF EXISTS alliance_operation_status;
+DROP TYPE IF EXISTS alliance_operation_kind;
@@ -0,0 +1,48 @@
+CREATE TYPE alliance_operation_kind AS ENUM ('attack', 'defense');
+CREATE TYPE alliance_operation_status AS ENUM ('open', 'cancelled');
+
+-- Operations posted by alliance leadership: targets to hit or hold and the
+-- window armies should land in. Members sign up their waves against a
+-- target; only the alliance can see the board.
+CREATE TABLE alliance_operations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    alliance_id UUID NOT NULL REFERENCES alliances(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    kind alliance_operation_kind NOT NULL,
+    notes TEXT,
+    landing_from TIMESTAMPTZ NOT NULL,
+    landing_until TIMESTAMPTZ NOT NULL,
+    status alliance_operation_status NOT NULL DEFAULT 'open',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (landing_until > landing_from)
+);
+
+CREATE INDEX idx_alliance_operations_alliance
+    ON alliance_operations(alliance_id, landing_from DESC);
+
+CREATE TABLE alliance_operation_targets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    operation_id UUID NOT NULL REFERENCES alliance_operations(id) ON DELETE CASCADE,
+    x INT NOT NULL,
+    y INT NOT NULL,
+    note VARCHAR(200),
+    UNIQUE (operation_id, x, y)
+);
+
+-- A member's wave against one target. wave_id links the sends the server
+-- makes for it; without one the member sends by hand.
+CREATE TABLE alliance_operation_signups (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    operation_id UUID NOT NULL REFERENCES alliance_operations(id) ON DELETE CASCADE,
+    target_id UUID NOT NULL REFERENCES alliance_operation_targets(id) ON DELETE CASCADE,
+    player_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wave_id UUID REFERENCES attack_waves(id) ON DELETE SET NULL,
+    troops JSONB NOT NULL,
+    armies INT NOT NULL,
+    lands_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_alliance_operation_signups_operation
+    ON alliance_operation_signups(operation_id, lands_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS defense_pledges;
+DROP TABLE IF EXISTS defense_calls;
+DROP TYPE IF EXISTS defense_call_status;
@@ -0,0 +1,37 @@
+CREATE TYPE defense_call_status AS ENUM ('open', 'cancelled');
+
+-- A member under attack asking the alliance, and its allies, to reinforce
+-- a village before the deadline
+CREATE TABLE defense_calls (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    alliance_id UUID NOT NULL REFERENCES alliances(id) ON DELETE CASCADE,
+    player_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    deadline TIMESTAMPTZ NOT NULL,
+    note VARCHAR(500),
+    status defense_call_status NOT NULL DEFAULT 'open',
+    -- Players told about the call when it was posted
+    notified INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_defense_calls_alliance ON defense_calls(alliance_id, deadline DESC);
+CREATE INDEX idx_defense_calls_village ON defense_calls(village_id) WHERE status = 'open';
+
+-- Troops a defender promised. army_id is set once they are sent; it is
+-- not a foreign key because reinforcements merge into stacks already
+-- standing at the village and the arriving army row goes away.
+CREATE TABLE defense_pledges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    call_id UUID NOT NULL REFERENCES defense_calls(id) ON DELETE CASCADE,
+    player_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_village_id UUID NOT NULL REFERENCES villages(id) ON DELETE CASCADE,
+    troops JSONB NOT NULL,
+    army_id UUID,
+    lands_at TIMESTAMPTZ,
+    arrived_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_defense_pledges_call ON defense_pledges(call_id);
+CREATE INDEX idx_defense_pledges_army ON defense_pledges(army_id) WHERE army_id IS NOT NULL;
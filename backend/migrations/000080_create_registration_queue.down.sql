@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS pre_registrations;
+DROP TABLE IF EXISTS registration_waves;
+DROP TABLE IF EXISTS registration_groups;
+DROP TYPE IF EXISTS registration_wave_status;
+DROP TYPE IF EXISTS pre_registration_status;
+DROP TYPE IF EXISTS spawn_quadrant;
@@ -0,0 +1,50 @@
+CREATE TYPE spawn_quadrant AS ENUM ('north_east', 'north_west', 'south_east', 'south_west');
+CREATE TYPE pre_registration_status AS ENUM ('queued', 'invited', 'joined', 'expired');
+CREATE TYPE registration_wave_status AS ENUM ('scheduled', 'released', 'cancelled');
+
+-- Players (usually an alliance) registering together. They start in the
+-- same quadrant and `slots` places there are held for them until they
+-- are invited.
+CREATE TABLE registration_groups (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(50) NOT NULL,
+    tag VARCHAR(8) NOT NULL,
+    code VARCHAR(8) NOT NULL UNIQUE,
+    leader_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    quadrant spawn_quadrant NOT NULL,
+    slots INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A batch of invites sent out from the queue at a set time
+CREATE TABLE registration_waves (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    size INT NOT NULL,
+    status registration_wave_status NOT NULL DEFAULT 'scheduled',
+    invited INT NOT NULL DEFAULT 0,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_registration_waves_due ON registration_waves(scheduled_at)
+    WHERE status = 'scheduled';
+
+-- A player's place in the queue, and the invite once a wave reaches them
+CREATE TABLE pre_registrations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    quadrant spawn_quadrant,
+    group_id UUID REFERENCES registration_groups(id) ON DELETE SET NULL,
+    status pre_registration_status NOT NULL DEFAULT 'queued',
+    wave_id UUID REFERENCES registration_waves(id) ON DELETE SET NULL,
+    invited_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    joined_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_pre_registrations_queue ON pre_registrations(status, created_at);
+CREATE INDEX idx_pre_registrations_group ON pre_registrations(group_id)
+    WHERE group_id IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Search highlights are HTML: ts_headline wraps matches in <mark>. Escaping
+-- the text first leaves those marks the only markup a result can carry.
+CREATE OR REPLACE FUNCTION html_escape(input TEXT) RETURNS TEXT AS $$
+    SELECT replace(replace(replace(replace(replace(input,
+        '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')
+$$ LANGUAGE sql IMMUTABLE STRICT;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_domain_events_assign_id ON domain_events;
+DROP FUNCTION IF EXISTS domain_events_assign_id();
+
+ALTER TABLE domain_events ALTER COLUMN id SET DEFAULT nextval('domain_events_id_seq');
@@ -0,0 +1,30 @@
+-- Event ids are handed out before commit, so a reader must not move past
+-- an id whose transaction may still commit. Each transaction writing
+-- events holds a shared advisory lock keyed by the last id handed out
+-- before its first one, taken before that id is drawn; readers stop short
+-- of the lowest key held (see DomainEventRepository::safe_head). Keys are
+-- offset by 2^40 to stay clear of the hashtext() locks used elsewhere.
+CREATE OR REPLACE FUNCTION domain_events_assign_id() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.id IS NOT NULL THEN
+        RETURN NEW;
+    END IF;
+
+    IF current_setting('domain_events.reserved', true) IS DISTINCT FROM '1' THEN
+        PERFORM pg_advisory_xact_lock_shared(
+            1099511627776 + coalesce(pg_sequence_last_value('domain_events_id_seq'), 0)
+        );
+        PERFORM set_config('domain_events.reserved', '1', true);
+    END IF;
+
+    NEW.id := nextval('domain_events_id_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- The id is drawn by the trigger, after the lock; a column default would
+-- draw it first
+ALTER TABLE domain_events ALTER COLUMN id DROP DEFAULT;
+
+CREATE TRIGGER trg_domain_events_assign_id BEFORE INSERT ON domain_events
+    FOR EACH ROW EXECUTE FUNCTION domain_events_assign_id();
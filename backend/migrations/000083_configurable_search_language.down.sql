@@ -0,0 +1,23 @@
+DROP TRIGGER IF EXISTS trg_battle_reports_search_vector ON battle_reports;
+DROP FUNCTION IF EXISTS battle_reports_search_vector();
+DROP TRIGGER IF EXISTS trg_messages_search_vector ON messages;
+DROP FUNCTION IF EXISTS messages_search_vector();
+
+-- Back to vectors generated with 'simple'
+DROP INDEX IF EXISTS idx_battle_reports_search;
+ALTER TABLE battle_reports DROP COLUMN search_vector;
+ALTER TABLE battle_reports ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', search_text)) STORED;
+CREATE INDEX idx_battle_reports_search ON battle_reports USING GIN (search_vector);
+
+DROP INDEX IF EXISTS idx_messages_search;
+ALTER TABLE messages DROP COLUMN search_vector;
+ALTER TABLE messages ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(subject, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(body, '')), 'B')
+    ) STORED;
+CREATE INDEX idx_messages_search ON messages USING GIN (search_vector);
+
+DROP FUNCTION IF EXISTS search_language();
+DROP TABLE IF EXISTS search_settings;
@@ -0,0 +1,44 @@
+-- The text search configuration is a deployment setting (SEARCH_LANGUAGE).
+-- The server stores it here at startup and the vectors are built with what
+-- is stored, so they are kept by triggers instead of generated columns.
+CREATE TABLE search_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    language REGCONFIG NOT NULL DEFAULT 'simple',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO search_settings DEFAULT VALUES;
+
+CREATE OR REPLACE FUNCTION search_language() RETURNS REGCONFIG AS $$
+    SELECT coalesce((SELECT language FROM search_settings), 'simple'::regconfig)
+$$ LANGUAGE sql STABLE;
+
+ALTER TABLE messages ALTER COLUMN search_vector DROP EXPRESSION;
+ALTER TABLE battle_reports ALTER COLUMN search_vector DROP EXPRESSION;
+
+-- Messages: subject ranks above body
+CREATE OR REPLACE FUNCTION messages_search_vector() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector(search_language(), coalesce(NEW.subject, '')), 'A') ||
+        setweight(to_tsvector(search_language(), coalesce(NEW.body, '')), 'B');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_messages_search_vector
+    BEFORE INSERT OR UPDATE OF subject, body ON messages
+    FOR EACH ROW EXECUTE FUNCTION messages_search_vector();
+
+-- Fires after trg_battle_reports_search_text (same-event triggers run in
+-- name order), so the text is already filled in
+CREATE OR REPLACE FUNCTION battle_reports_search_vector() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := to_tsvector(search_language(), NEW.search_text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_battle_reports_search_vector
+    BEFORE INSERT OR UPDATE OF search_text ON battle_reports
+    FOR EACH ROW EXECUTE FUNCTION battle_reports_search_vector();
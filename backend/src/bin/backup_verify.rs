@@ -0,0 +1,368 @@
+//! Backup verification. Restores the latest Postgres backup into a scratch
+//! database, runs the game-state invariants against it and reports drift
+//! from the live database, so ops know the backups actually restore.
+//!
+//!     cargo run --release --bin backup_verify -- --backup-dir /var/backups/game \
+//!         --admin-url postgres://postgres@db/postgres --live-url $DATABASE_URL
+//!
+//! Custom-format dumps (`.dump`) go through pg_restore, plain ones (`.sql`,
+//! `.sql.gz`) through psql, so both must be on the PATH. Exits non-zero when
+//! the restore fails or an invariant is broken.
+
+use anyhow::{bail, Context, Result};
+use sqlx::postgres::{PgConnectOptions, PgPoolOptions};
+use sqlx::{ConnectOptions, PgPool};
+use std::path::{Path, PathBuf};
+use std::process::{Command, Stdio};
+use std::str::FromStr;
+use std::time::{Instant, SystemTime};
+
+/// Consistency rules shared with the server
+#[allow(dead_code)]
+#[path = "../db/invariants.rs"]
+mod invariants;
+
+use invariants::{count_sql, INVARIANTS};
+
+const USAGE: &str = "\
+Usage: backup_verify --admin-url URL (--backup FILE | --backup-dir DIR) [options]
+
+  --admin-url URL    Postgres server to restore on; must be allowed to create databases
+  --backup FILE      Backup to verify
+  --backup-dir DIR   Verify the newest .dump, .sql or .sql.gz file in DIR (default BACKUP_DIR)
+  --live-url URL     Live database to compare row counts with
+  --keep             Leave the scratch database behind for inspection";
+
+/// Tables whose row counts are compared with the live database
+const DRIFT_TABLES: &[&str] = &[
+    "users",
+    "villages",
+    "buildings",
+    "troops",
+    "armies",
+    "resource_shipments",
+    "alliances",
+    "economy_ledger",
+    "transactions",
+];
+
+/// Offending rows printed per broken invariant
+const SAMPLE_SIZE: usize = 5;
+
+struct Options {
+    admin_url: String,
+    backup: Option<PathBuf>,
+    backup_dir: Option<PathBuf>,
+    live_url: Option<String>,
+    keep: bool,
+}
+
+impl Options {
+    fn parse() -> Result<Self> {
+        let mut options = Self {
+            admin_url: String::new(),
+            backup: None,
+            backup_dir: std::env::var("BACKUP_DIR").ok().map(PathBuf::from),
+            live_url: None,
+            keep: false,
+        };
+
+        let mut args = std::env::args().skip(1);
+        while let Some(flag) = args.next() {
+            match flag.as_str() {
+                "--help" | "-h" => {
+                    println!("{}", USAGE);
+                    std::process::exit(0);
+                }
+                "--keep" => {
+                    options.keep = true;
+                    continue;
+                }
+                _ => {}
+            }
+            let value = args
+                .next()
+                .with_context(|| format!("{} needs a value\n\n{}", flag, USAGE))?;
+
+            match flag.as_str() {
+                "--admin-url" => options.admin_url = value,
+                "--backup" => options.backup = Some(PathBuf::from(value)),
+                "--backup-dir" => options.backup_dir = Some(PathBuf::from(value)),
+                "--live-url" => options.live_url = Some(value),
+                _ => bail!("Unknown option {}\n\n{}", flag, USAGE),
+            }
+        }
+
+        if options.admin_url.is_empty() {
+            bail!("--admin-url is required\n\n{}", USAGE);
+        }
+        if options.backup.is_none() && options.backup_dir.is_none() {
+            bail!("--backup or --backup-dir is required\n\n{}", USAGE);
+        }
+        Ok(options)
+    }
+}
+
+// ==================== Restore ====================
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum BackupFormat {
+    Custom,
+    Plain,
+    PlainGzip,
+}
+
+impl BackupFormat {
+    fn of(path: &Path) -> Option<Self> {
+        let name = path.file_name()?.to_str()?;
+        if name.ends_with(".dump") {
+            Some(Self::Custom)
+        } else if name.ends_with(".sql.gz") {
+            Some(Self::PlainGzip)
+        } else if name.ends_with(".sql") {
+            Some(Self::Plain)
+        } else {
+            None
+        }
+    }
+}
+
+/// The most recently written backup in `dir`
+fn latest_backup(dir: &Path) -> Result<PathBuf> {
+    let mut latest: Option<(SystemTime, PathBuf)> = None;
+    for entry in std::fs::read_dir(dir).with_context(|| format!("Failed to read {:?}", dir))? {
+        let path = entry?.path();
+        if BackupFormat::of(&path).is_none() {
+            continue;
+        }
+        let modified = std::fs::metadata(&path)?.modified()?;
+        if latest
+            .as_ref()
+            .map_or(true, |(newest, _)| modified > *newest)
+        {
+            latest = Some((modified, path));
+        }
+    }
+
+    latest
+        .map(|(_, path)| path)
+        .with_context(|| format!("No backups in {:?}", dir))
+}
+
+fn restore(backup: &Path, database_url: &str) -> Result<()> {
+    let format =
+        BackupFormat::of(backup).with_context(|| format!("Unknown backup format: {:?}", backup))?;
+
+    let status = match format {
+        BackupFormat::Custom => Command::new("pg_restore")
+            .args([
+                "--no-owner",
+                "--no-privileges",
+                "--exit-on-error",
+                "--dbname",
+            ])
+            .arg(database_url)
+            .arg(backup)
+            .status()
+            .context("Failed to run pg_restore")?,
+        BackupFormat::Plain => Command::new("psql")
+            .args(["--quiet", "--set", "ON_ERROR_STOP=1", "--dbname"])
+            .arg(database_url)
+            .arg("--file")
+            .arg(backup)
+            .stdout(Stdio::null())
+            .status()
+            .context("Failed to run psql")?,
+        BackupFormat::PlainGzip => {
+            let mut gunzip = Command::new("gunzip")
+                .arg("--stdout")
+                .arg(backup)
+                .stdout(Stdio::piped())
+                .spawn()
+                .context("Failed to run gunzip")?;
+            let status = Command::new("psql")
+                .args(["--quiet", "--set", "ON_ERROR_STOP=1", "--dbname"])
+                .arg(database_url)
+                .stdin(gunzip.stdout.take().context("gunzip has no output")?)
+                .stdout(Stdio::null())
+                .status()
+                .context("Failed to run psql")?;
+            if !gunzip.wait()?.success() {
+                bail!("gunzip failed on {:?}", backup);
+            }
+            status
+        }
+    };
+
+    if !status.success() {
+        bail!("Restore of {:?} failed ({})", backup, status);
+    }
+    Ok(())
+}
+
+// ==================== Checks ====================
+
+/// Run every invariant; returns how many are broken
+async fn check_invariants(pool: &PgPool) -> Result<usize> {
+    let mut broken = 0;
+    println!("\nInvariants:");
+    for invariant in INVARIANTS {
+        let (count, sample): (i64, Vec<String>) =
+            sqlx::query_as(&count_sql(invariant, SAMPLE_SIZE))
+                .fetch_one(pool)
+                .await
+                .with_context(|| format!("Invariant {} failed to run", invariant.name))?;
+
+        if count == 0 {
+            println!("  ok    {}", invariant.name);
+            continue;
+        }
+        broken += 1;
+        println!(
+            "  FAIL  {}: {} ({} rows, e.g. {})",
+            invariant.name,
+            invariant.description,
+            count,
+            sample.join(", ")
+        );
+    }
+
+    Ok(broken)
+}
+
+async fn row_count(pool: &PgPool, table: &str) -> Result<i64> {
+    let (count,): (i64,) = sqlx::query_as(&format!("SELECT COUNT(*) FROM {}", table))
+        .fetch_one(pool)
+        .await
+        .with_context(|| format!("Failed to count {}", table))?;
+    Ok(count)
+}
+
+/// Row counts of the restored database next to the live one. A backup is
+/// always somewhat behind; large gaps point at a stale or partial dump.
+async fn report_drift(restored: &PgPool, live: Option<&PgPool>) -> Result<()> {
+    println!("\nRow counts:");
+    println!(
+        "  {:<20} {:>12} {:>12} {:>8}",
+        "table", "backup", "live", "drift"
+    );
+    for table in DRIFT_TABLES {
+        let backup = row_count(restored, table).await?;
+        match live {
+            Some(live) => {
+                let current = row_count(live, table).await?;
+                let drift = if current == 0 {
+                    0.0
+                } else {
+                    (backup - current) as f64 * 100.0 / current as f64
+                };
+                println!(
+                    "  {:<20} {:>12} {:>12} {:>7.1}%",
+                    table, backup, current, drift
+                );
+            }
+            None => println!("  {:<20} {:>12} {:>12} {:>8}", table, backup, "-", "-"),
+        }
+    }
+
+    let (last_activity,): (Option<chrono::DateTime<chrono::Utc>>,) =
+        sqlx::query_as("SELECT MAX(updated_at) FROM villages")
+            .fetch_one(restored)
+            .await?;
+    if let Some(last_activity) = last_activity {
+        println!(
+            "\nNewest village change in the backup: {} ({} ago)",
+            last_activity,
+            humanize(chrono::Utc::now() - last_activity)
+        );
+    }
+
+    Ok(())
+}
+
+fn humanize(age: chrono::Duration) -> String {
+    if age.num_hours() >= 48 {
+        format!("{}d", age.num_days())
+    } else if age.num_minutes() >= 120 {
+        format!("{}h", age.num_hours())
+    } else {
+        format!("{}m", age.num_minutes())
+    }
+}
+
+// ==================== Main ====================
+
+async fn verify(options: &Options, backup: &Path, scratch_url: &str) -> Result<usize> {
+    let started = Instant::now();
+    restore(backup, scratch_url)?;
+    println!("Restored in {:.1}s", started.elapsed().as_secs_f64());
+
+    let restored = PgPoolOptions::new()
+        .max_connections(2)
+        .connect(scratch_url)
+        .await
+        .context("Failed to connect to the restored database")?;
+    let live = match &options.live_url {
+        Some(url) => Some(
+            PgPoolOptions::new()
+                .max_connections(1)
+                .connect(url)
+                .await
+                .context("Failed to connect to the live database")?,
+        ),
+        None => None,
+    };
+
+    let broken = check_invariants(&restored).await?;
+    report_drift(&restored, live.as_ref()).await?;
+
+    restored.close().await;
+    Ok(broken)
+}
+
+#[tokio::main]
+async fn main() -> Result<()> {
+    let options = Options::parse()?;
+
+    let backup = match (&options.backup, &options.backup_dir) {
+        (Some(backup), _) => backup.clone(),
+        (None, Some(dir)) => latest_backup(dir)?,
+        (None, None) => unreachable!("checked when parsing options"),
+    };
+    let admin_options =
+        PgConnectOptions::from_str(&options.admin_url).context("Invalid --admin-url")?;
+    let admin = PgPoolOptions::new()
+        .max_connections(1)
+        .connect_with(admin_options.clone())
+        .await
+        .context("Failed to connect with --admin-url")?;
+
+    let scratch = format!(
+        "backup_verify_{}",
+        chrono::Utc::now().format("%Y%m%d%H%M%S")
+    );
+    sqlx::query(&format!("CREATE DATABASE {}", scratch))
+        .execute(&admin)
+        .await
+        .context("Failed to create the scratch database")?;
+    let scratch_url = admin_options.database(&scratch).to_url_lossy().to_string();
+
+    println!("Verifying {:?} in scratch database {}", backup, scratch);
+    let result = verify(&options, &backup, &scratch_url).await;
+
+    if options.keep {
+        println!("\nKept scratch database {}", scratch);
+    } else if let Err(e) = sqlx::query(&format!("DROP DATABASE IF EXISTS {} WITH (FORCE)", scratch))
+        .execute(&admin)
+        .await
+    {
+        eprintln!("Failed to drop scratch database {}: {}", scratch, e);
+    }
+
+    let broken = result?;
+    if broken > 0 {
+        bail!("{} invariant(s) broken in {:?}", broken, backup);
+    }
+    println!("\nBackup {:?} restored and passed every check", backup);
+    Ok(())
+}
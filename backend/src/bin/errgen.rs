@@ -0,0 +1,123 @@
+//! Exports the error-code catalog in src/error/codes.rs for clients: as
+//! JSON in schemas/error-codes.json and as TypeScript for the frontend.
+//!
+//!     cargo run --bin errgen            # rewrite both files
+//!     cargo run --bin errgen -- --check # fail if either is out of date (CI)
+
+use anyhow::{bail, Context, Result};
+use serde::Serialize;
+use std::fmt::Write as _;
+use std::path::PathBuf;
+
+/// The catalog shared with the server
+#[path = "../error/codes.rs"]
+mod codes;
+
+use codes::ErrorCode;
+
+const USAGE: &str = "\
+Usage: errgen [options]
+
+  --json FILE   JSON output (default schemas/error-codes.json)
+  --out FILE    TypeScript output (default ../frontend/src/lib/api/error-codes.gen.ts)
+  --check       Don't write; exit non-zero if an output would change";
+
+#[derive(Serialize)]
+struct Entry {
+    code: &'static str,
+    status: u16,
+    message: &'static str,
+    gameplay: bool,
+}
+
+fn main() -> Result<()> {
+    let mut json_path = PathBuf::from("schemas/error-codes.json");
+    let mut ts_path = PathBuf::from("../frontend/src/lib/api/error-codes.gen.ts");
+    let mut check = false;
+
+    let mut args = std::env::args().skip(1);
+    while let Some(arg) = args.next() {
+        match arg.as_str() {
+            "--help" | "-h" => {
+                println!("{}", USAGE);
+                return Ok(());
+            }
+            "--check" => check = true,
+            "--json" | "--out" => {
+                let value = args
+                    .next()
+                    .with_context(|| format!("{} needs a value\n\n{}", arg, USAGE))?;
+                match arg.as_str() {
+                    "--json" => json_path = PathBuf::from(value),
+                    _ => ts_path = PathBuf::from(value),
+                }
+            }
+            other => bail!("Unknown option {}\n\n{}", other, USAGE),
+        }
+    }
+
+    let entries: Vec<Entry> = ErrorCode::ALL
+        .iter()
+        .map(|code| Entry {
+            code: code.as_str(),
+            status: code.status(),
+            message: code.message(),
+            gameplay: code.is_gameplay(),
+        })
+        .collect();
+    let outputs = [
+        (json_path, generate_json(&entries)?),
+        (ts_path, generate_ts(&entries)?),
+    ];
+
+    if check {
+        let mut stale = false;
+        for (path, generated) in &outputs {
+            let current = std::fs::read_to_string(path).unwrap_or_default();
+            if current != *generated {
+                eprintln!("{} is out of date", path.display());
+                stale = true;
+            }
+        }
+        if stale {
+            bail!("Error codes changed; run `cargo run --bin errgen`");
+        }
+        println!("Error code exports are up to date");
+        return Ok(());
+    }
+
+    for (path, generated) in &outputs {
+        std::fs::write(path, generated)
+            .with_context(|| format!("Failed to write {}", path.display()))?;
+        println!("Wrote {}", path.display());
+    }
+    Ok(())
+}
+
+fn generate_json(entries: &[Entry]) -> Result<String> {
+    let mut json = serde_json::to_string_pretty(entries)?;
+    json.push('\n');
+    Ok(json)
+}
+
+fn generate_ts(entries: &[Entry]) -> Result<String> {
+    let mut ts = String::new();
+    ts.push_str(
+        "// Code generated by `cargo run --bin errgen` from backend/src/error/codes.rs. DO NOT EDIT.\n\n",
+    );
+    ts.push_str("/** Sent as `error.error_code` in every API error response */\n");
+    ts.push_str("export const ERROR_CODES = {\n");
+    for entry in entries {
+        writeln!(
+            ts,
+            "    {}: {{ status: {}, message: {}, gameplay: {} }},",
+            entry.code,
+            entry.status,
+            serde_json::to_string(entry.message)?,
+            entry.gameplay
+        )?;
+    }
+    ts.push_str("} as const;\n\n");
+    ts.push_str("export type ErrorCode = keyof typeof ERROR_CODES;\n");
+    Ok(ts)
+}
@@ -0,0 +1,619 @@
+//! Capacity-planning load generator. Ramps up simulated players against a
+//! running server, has each one loop over a weighted mix of map reads, build
+//! orders, raids and chat, and reports latency per request type.
+//!
+//!     cargo run --release --bin loadgen -- --target https://staging.example.com \
+//!         --players 500 --ramp 120 --duration 600
+//!
+//! Players sign in through `POST /api/auth/dev-token`, so the target must run
+//! with AUTH_PROVIDER=dev unless `--tokens` names a file of bearer tokens (one
+//! per line). Never point it at production.
+
+use anyhow::{bail, Context, Result};
+use rand::seq::SliceRandom;
+use rand::Rng;
+use reqwest::{Client, RequestBuilder, StatusCode};
+use serde::de::DeserializeOwned;
+use serde_json::json;
+use std::collections::{BTreeMap, HashMap};
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex, RwLock};
+use std::time::{Duration, Instant};
+use uuid::Uuid;
+
+/// Request and response types shared with the server
+#[allow(dead_code)]
+#[path = "../models"]
+mod models {
+    pub mod army;
+    pub mod building;
+    pub mod gamedata;
+    pub mod hero;
+    pub mod message;
+    pub mod troop;
+    pub mod user;
+    pub mod village;
+}
+
+use models::army::{CarriedResources, MissionType, SendArmyRequest};
+use models::building::BuildingResponse;
+use models::message::SendMessageRequest;
+use models::troop::TroopResponse;
+use models::user::UserResponse;
+use models::village::VillageResponse;
+
+const USAGE: &str = "\
+Usage: loadgen [options]
+
+  --target URL       Server to load (default http://localhost:8080)
+  --players N        Simulated players (default 50)
+  --ramp SECS        Time over which players join (default 30)
+  --duration SECS    How long to hold full load after the ramp (default 120)
+  --think-ms MS      Mean pause between a player's actions (default 2000)
+  --mix SPEC         Action weights (default map=50,build=25,raid=10,chat=15)
+  --tokens FILE      Bearer tokens, one per line, instead of dev tokens
+  --report-secs SECS Progress line interval (default 10)";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Action {
+    Map,
+    Build,
+    Raid,
+    Chat,
+}
+
+impl Action {
+    fn parse(name: &str) -> Option<Self> {
+        match name {
+            "map" => Some(Self::Map),
+            "build" => Some(Self::Build),
+            "raid" => Some(Self::Raid),
+            "chat" => Some(Self::Chat),
+            _ => None,
+        }
+    }
+}
+
+struct Options {
+    target: String,
+    players: usize,
+    ramp: Duration,
+    duration: Duration,
+    think: Duration,
+    mix: Vec<(Action, u32)>,
+    tokens: Option<String>,
+    report_every: Duration,
+}
+
+impl Options {
+    fn parse() -> Result<Self> {
+        let mut options = Self {
+            target: "http://localhost:8080".to_string(),
+            players: 50,
+            ramp: Duration::from_secs(30),
+            duration: Duration::from_secs(120),
+            think: Duration::from_millis(2000),
+            mix: parse_mix("map=50,build=25,raid=10,chat=15")?,
+            tokens: None,
+            report_every: Duration::from_secs(10),
+        };
+
+        let mut args = std::env::args().skip(1);
+        while let Some(flag) = args.next() {
+            if flag == "--help" || flag == "-h" {
+                println!("{}", USAGE);
+                std::process::exit(0);
+            }
+            let value = args
+                .next()
+                .with_context(|| format!("{} needs a value\n\n{}", flag, USAGE))?;
+            let number = || {
+                value
+                    .parse::<u64>()
+                    .with_context(|| format!("Invalid {}: {}", flag, value))
+            };
+
+            match flag.as_str() {
+                "--target" => options.target = value.trim_end_matches('/').to_string(),
+                "--players" => options.players = number()? as usize,
+                "--ramp" => options.ramp = Duration::from_secs(number()?),
+                "--duration" => options.duration = Duration::from_secs(number()?),
+                "--think-ms" => options.think = Duration::from_millis(number()?),
+                "--mix" => options.mix = parse_mix(&value)?,
+                "--tokens" => options.tokens = Some(value),
+                "--report-secs" => options.report_every = Duration::from_secs(number()?.max(1)),
+                _ => bail!("Unknown option {}\n\n{}", flag, USAGE),
+            }
+        }
+
+        if options.players == 0 {
+            bail!("--players must be at least 1");
+        }
+        Ok(options)
+    }
+}
+
+/// `map=50,build=25,...`; actions left out never run
+fn parse_mix(spec: &str) -> Result<Vec<(Action, u32)>> {
+    let mut mix = Vec::new();
+    for part in spec.split(',').map(str::trim).filter(|p| !p.is_empty()) {
+        let (name, weight) = part
+            .split_once('=')
+            .with_context(|| format!("Mix entry {} must be action=weight", part))?;
+        let action = Action::parse(name.trim())
+            .with_context(|| format!("Unknown action {} (map, build, raid, chat)", name))?;
+        let weight = weight
+            .trim()
+            .parse()
+            .with_context(|| format!("Invalid weight for {}", name))?;
+        mix.push((action, weight));
+    }
+
+    if mix.iter().all(|(_, weight)| *weight == 0) {
+        bail!("--mix needs at least one positive weight");
+    }
+    Ok(mix)
+}
+
+// ==================== Stats ====================
+
+enum Outcome {
+    Ok,
+    /// 4xx: the game said no (not enough resources, queue full, ...)
+    Rejected,
+    /// 5xx, timeouts and connection errors
+    Failed,
+}
+
+#[derive(Default)]
+struct Stats {
+    latencies: Vec<Duration>,
+    rejected: u64,
+    failed: u64,
+}
+
+#[derive(Clone, Default)]
+struct Recorder {
+    by_request: Arc<Mutex<BTreeMap<&'static str, Stats>>>,
+}
+
+impl Recorder {
+    fn record(&self, label: &'static str, latency: Duration, outcome: Outcome) {
+        let mut by_request = self.by_request.lock().unwrap();
+        let stats = by_request.entry(label).or_default();
+        stats.latencies.push(latency);
+        match outcome {
+            Outcome::Ok => {}
+            Outcome::Rejected => stats.rejected += 1,
+            Outcome::Failed => stats.failed += 1,
+        }
+    }
+
+    fn totals(&self) -> (usize, u64) {
+        let by_request = self.by_request.lock().unwrap();
+        let requests = by_request.values().map(|s| s.latencies.len()).sum();
+        let failed = by_request.values().map(|s| s.failed).sum();
+        (requests, failed)
+    }
+
+    fn print_report(&self, elapsed: Duration) {
+        let mut by_request = self.by_request.lock().unwrap();
+        let requests: usize = by_request.values().map(|s| s.latencies.len()).sum();
+
+        println!();
+        println!(
+            "{:<12} {:>8} {:>8} {:>8} {:>9} {:>9} {:>9} {:>9}",
+            "request", "count", "4xx", "failed", "p50 ms", "p95 ms", "p99 ms", "max ms"
+        );
+        for (label, stats) in by_request.iter_mut() {
+            stats.latencies.sort();
+            println!(
+                "{:<12} {:>8} {:>8} {:>8} {:>9} {:>9} {:>9} {:>9}",
+                label,
+                stats.latencies.len(),
+                stats.rejected,
+                stats.failed,
+                percentile(&stats.latencies, 50.0),
+                percentile(&stats.latencies, 95.0),
+                percentile(&stats.latencies, 99.0),
+                percentile(&stats.latencies, 100.0),
+            );
+        }
+        println!(
+            "\n{} requests in {:.0}s ({:.1} req/s)",
+            requests,
+            elapsed.as_secs_f64(),
+            requests as f64 / elapsed.as_secs_f64().max(1.0)
+        );
+    }
+}
+
+/// Latency at percentile `p` of sorted samples, in milliseconds
+fn percentile(sorted: &[Duration], p: f64) -> u128 {
+    if sorted.is_empty() {
+        return 0;
+    }
+    let index = ((p / 100.0) * (sorted.len() - 1) as f64).round() as usize;
+    sorted[index].as_millis()
+}
+
+// ==================== Players ====================
+
+/// Non-2xx answer, returned as the error of `Session::call`
+#[derive(Debug, thiserror::Error)]
+#[error("HTTP {0}")]
+struct HttpStatus(StatusCode);
+
+/// An authenticated connection to the target
+struct Session {
+    client: Client,
+    target: String,
+    token: String,
+    recorder: Recorder,
+}
+
+impl Session {
+    fn get(&self, path: &str) -> RequestBuilder {
+        self.client.get(format!("{}{}", self.target, path))
+    }
+
+    fn post(&self, path: &str) -> RequestBuilder {
+        self.client.post(format!("{}{}", self.target, path))
+    }
+
+    /// Send a request, recording its latency and outcome under `label`
+    async fn call<T: DeserializeOwned>(
+        &self,
+        label: &'static str,
+        request: RequestBuilder,
+    ) -> Result<T> {
+        let started = Instant::now();
+        let result = request.bearer_auth(&self.token).send().await;
+        let latency = started.elapsed();
+
+        let response = match result {
+            Ok(response) => response,
+            Err(e) => {
+                self.recorder.record(label, latency, Outcome::Failed);
+                return Err(e.into());
+            }
+        };
+
+        let status = response.status();
+        if status.is_success() {
+            self.recorder.record(label, latency, Outcome::Ok);
+            return Ok(response.json().await?);
+        }
+
+        let outcome = if status.is_client_error() {
+            Outcome::Rejected
+        } else {
+            Outcome::Failed
+        };
+        self.recorder.record(label, latency, outcome);
+        Err(HttpStatus(status).into())
+    }
+}
+
+/// User ids of players that finished signing up, for chat recipients
+type Directory = Arc<RwLock<Vec<Uuid>>>;
+
+struct Player {
+    session: Session,
+    user_id: Uuid,
+    village: VillageResponse,
+}
+
+impl Player {
+    /// Sign in, register and make sure the player has a village
+    async fn join(shared: &Shared, index: usize, token: Option<String>) -> Result<Self> {
+        let mut session = Session {
+            client: shared.client.clone(),
+            target: shared.options.target.clone(),
+            token: token.clone().unwrap_or_default(),
+            recorder: shared.recorder.clone(),
+        };
+
+        if token.is_none() {
+            let uid = format!("loadgen-{}", index);
+            let response: serde_json::Value = session
+                .call(
+                    "sign_in",
+                    session
+                        .post("/api/auth/dev-token")
+                        .json(&json!({ "uid": uid, "name": uid })),
+                )
+                .await?;
+            session.token = response["token"]
+                .as_str()
+                .context("dev-token returned no token; is AUTH_PROVIDER=dev?")?
+                .to_string();
+        }
+
+        #[derive(serde::Deserialize)]
+        struct SyncResponse {
+            user: UserResponse,
+        }
+        let synced: SyncResponse = session
+            .call(
+                "sync",
+                session
+                    .post("/api/auth/sync")
+                    .json(&json!({ "display_name": format!("Loadgen {}", index) })),
+            )
+            .await?;
+
+        let villages: Vec<VillageResponse> = session
+            .call("villages", session.get("/api/villages"))
+            .await?;
+        let village = match villages.into_iter().next() {
+            Some(village) => village,
+            None => Self::settle(&session, index).await?,
+        };
+
+        Ok(Self {
+            session,
+            user_id: synced.user.id,
+            village,
+        })
+    }
+
+    /// Found a first village wherever the server places it
+    async fn settle(session: &Session, index: usize) -> Result<VillageResponse> {
+        for _ in 0..10 {
+            let body = json!({ "name": format!("Loadgen {}", index) });
+            match session
+                .call("settle", session.post("/api/villages").json(&body))
+                .await
+            {
+                Ok(village) => return Ok(village),
+                // Another player got the tile first; place again
+                Err(e)
+                    if e.downcast_ref::<HttpStatus>()
+                        .is_some_and(|s| s.0 == StatusCode::CONFLICT) => {}
+                Err(e) => return Err(e),
+            }
+        }
+        bail!("No free tile found for player {}", index)
+    }
+
+    async fn run(&self, action: Action, directory: &Directory) {
+        // Rejections and failures are already counted; keep the player going
+        let _ = match action {
+            Action::Map => self.read_map().await,
+            Action::Build => self.order_build().await,
+            Action::Raid => self.send_raid().await,
+            Action::Chat => self.chat(directory).await,
+        };
+    }
+
+    async fn read_map(&self) -> Result<()> {
+        let path = format!("/api/map?x={}&y={}&range=7", self.village.x, self.village.y);
+        let _: serde_json::Value = self.session.call("map", self.session.get(&path)).await?;
+        Ok(())
+    }
+
+    async fn order_build(&self) -> Result<()> {
+        let path = format!("/api/villages/{}/buildings", self.village.id);
+        let buildings: Vec<BuildingResponse> = self
+            .session
+            .call("buildings", self.session.get(&path))
+            .await?;
+
+        let Some(slot) = buildings
+            .iter()
+            .filter(|b| !b.is_upgrading)
+            .map(|b| b.slot)
+            .collect::<Vec<_>>()
+            .choose(&mut rand::thread_rng())
+            .copied()
+        else {
+            return Ok(());
+        };
+
+        let path = format!("{}/{}/upgrade", path, slot);
+        let _: serde_json::Value = self
+            .session
+            .call("upgrade", self.session.post(&path))
+            .await?;
+        Ok(())
+    }
+
+    async fn send_raid(&self) -> Result<()> {
+        let path = format!("/api/villages/{}/troops", self.village.id);
+        let troops: Vec<TroopResponse> =
+            self.session.call("troops", self.session.get(&path)).await?;
+
+        let troops: HashMap<_, _> = troops
+            .into_iter()
+            .filter(|t| t.in_village > 1)
+            .map(|t| (t.troop_type, t.in_village / 2))
+            .collect();
+        if troops.is_empty() {
+            return Ok(());
+        }
+
+        let (dx, dy) = {
+            let mut rng = rand::thread_rng();
+            (rng.gen_range(-10..=10), rng.gen_range(-10..=10))
+        };
+        let request = SendArmyRequest {
+            to_x: self.village.x + dx,
+            to_y: self.village.y + dy,
+            mission: MissionType::Raid,
+            troops,
+            resources: CarriedResources::default(),
+            hero_id: None,
+        };
+        let path = format!("/api/villages/{}/armies", self.village.id);
+        let _: serde_json::Value = self
+            .session
+            .call("raid", self.session.post(&path).json(&request))
+            .await?;
+        Ok(())
+    }
+
+    async fn chat(&self, directory: &Directory) -> Result<()> {
+        let recipient = {
+            let players = directory.read().unwrap();
+            players
+                .iter()
+                .filter(|id| **id != self.user_id)
+                .collect::<Vec<_>>()
+                .choose(&mut rand::thread_rng())
+                .map(|id| **id)
+        };
+        let Some(recipient_id) = recipient else {
+            return Ok(());
+        };
+
+        let request = SendMessageRequest {
+            recipient_id,
+            subject: "Trade?".to_string(),
+            body: "Have clay, need iron. 1:1 at the marketplace?".to_string(),
+        };
+        let _: serde_json::Value = self
+            .session
+            .call("message", self.session.post("/api/messages").json(&request))
+            .await?;
+        Ok(())
+    }
+}
+
+fn pick(mix: &[(Action, u32)]) -> Action {
+    let total: u32 = mix.iter().map(|(_, weight)| weight).sum();
+    let mut roll = rand::thread_rng().gen_range(0..total);
+    for (action, weight) in mix {
+        if roll < *weight {
+            return *action;
+        }
+        roll -= weight;
+    }
+    mix[0].0
+}
+
+/// What every simulated player shares
+struct Shared {
+    options: Options,
+    client: Client,
+    recorder: Recorder,
+    directory: Directory,
+    /// Players that joined and are still acting
+    active: AtomicUsize,
+    deadline: Instant,
+}
+
+/// One simulated player: join, then act until the deadline
+async fn simulate(shared: Arc<Shared>, index: usize, token: Option<String>) {
+    let player = match Player::join(&shared, index, token).await {
+        Ok(player) => player,
+        Err(e) => {
+            eprintln!("player {} could not join: {:#}", index, e);
+            return;
+        }
+    };
+    shared.directory.write().unwrap().push(player.user_id);
+    shared.active.fetch_add(1, Ordering::Relaxed);
+
+    while Instant::now() < shared.deadline {
+        let action = pick(&shared.options.mix);
+        player.run(action, &shared.directory).await;
+
+        let think = shared
+            .options
+            .think
+            .mul_f64(rand::thread_rng().gen_range(0.5..1.5));
+        tokio::time::sleep(think).await;
+    }
+
+    shared.active.fetch_sub(1, Ordering::Relaxed);
+}
+
+#[tokio::main]
+async fn main() -> Result<()> {
+    let options = Options::parse()?;
+
+    let tokens: Vec<String> = match &options.tokens {
+        Some(path) => std::fs::read_to_string(path)
+            .with_context(|| format!("Failed to read {}", path))?
+            .lines()
+            .map(str::trim)
+            .filter(|line| !line.is_empty())
+            .map(str::to_string)
+            .collect(),
+        None => Vec::new(),
+    };
+    if options.tokens.is_some() && tokens.is_empty() {
+        bail!("Token file has no tokens");
+    }
+
+    let client = Client::builder()
+        .timeout(Duration::from_secs(30))
+        .pool_max_idle_per_host(options.players)
+        .build()?;
+
+    println!(
+        "Loading {} with {} players (ramp {}s, hold {}s)",
+        options.target,
+        options.players,
+        options.ramp.as_secs(),
+        options.duration.as_secs()
+    );
+
+    let started = Instant::now();
+    let shared = Arc::new(Shared {
+        deadline: started + options.ramp + options.duration,
+        options,
+        client,
+        recorder: Recorder::default(),
+        directory: Directory::default(),
+        active: AtomicUsize::new(0),
+    });
+
+    let players_total = shared.options.players;
+    let mut players = Vec::with_capacity(players_total);
+    for index in 0..players_total {
+        let join_at = started
+            + shared
+                .options
+                .ramp
+                .mul_f64(index as f64 / players_total as f64);
+        let token = (!tokens.is_empty()).then(|| tokens[index % tokens.len()].clone());
+        let shared = shared.clone();
+        players.push(tokio::spawn(async move {
+            tokio::time::sleep_until(join_at.into()).await;
+            simulate(shared, index, token).await;
+        }));
+    }
+
+    let progress = {
+        let shared = shared.clone();
+        tokio::spawn(async move {
+            let every = shared.options.report_every;
+            let mut ticker = tokio::time::interval(every);
+            ticker.tick().await;
+            let mut last = 0;
+            loop {
+                ticker.tick().await;
+                let (requests, failed) = shared.recorder.totals();
+                println!(
+                    "[{:>4}s] players {:>5}  requests {:>8}  ({:.1} req/s)  failed {}",
+                    started.elapsed().as_secs(),
+                    shared.active.load(Ordering::Relaxed),
+                    requests,
+                    (requests - last) as f64 / every.as_secs_f64(),
+                    failed
+                );
+                last = requests;
+            }
+        })
+    };
+
+    for player in players {
+        let _ = player.await;
+    }
+    progress.abort();
+
+    shared.recorder.print_report(started.elapsed());
+    Ok(())
+}
@@ -0,0 +1,688 @@
+//! Offline balance simulator for game designers. Runs combat and economy
+//! scenarios through the same formulas and game data the server uses and
+//! writes CSV summaries, so unit stats and costs can be tuned before they
+//! reach a live world.
+//!
+//!     cargo run --release --bin simulate -- scenarios/example.yaml \
+//!         --gamedata ../my-tuning --out results
+//!
+//! See scenarios/example.yaml for the scenario format.
+
+use anyhow::{bail, Context, Result};
+use rand::rngs::StdRng;
+use rand::{Rng, SeedableRng};
+use serde::de::DeserializeOwned;
+use serde::Deserialize;
+use std::collections::HashMap;
+use std::fmt::Write as _;
+use std::path::{Path, PathBuf};
+
+/// Game data types and formulas shared with the server
+#[allow(dead_code)]
+#[path = "../models"]
+mod models {
+    pub mod army;
+    pub mod building;
+    pub mod gamedata;
+    pub mod hero;
+    pub mod troop;
+}
+
+#[allow(dead_code)]
+#[path = "../services/combat.rs"]
+mod combat;
+
+use models::army::{ArmyTroops, MissionType};
+use models::building::BuildingType;
+use models::gamedata::{
+    self, BuildingsFile, GameDefinitions, TribesFile, UnitDefinition, UnitsFile,
+};
+use models::troop::TroopType;
+
+const USAGE: &str = "\
+Usage: simulate SCENARIO_FILE... [options]
+
+  --out DIR        Where to write the CSV files (default simulation-results)
+  --gamedata DIR   buildings/units/tribes files to use instead of the built-in ones
+  --seed N         Random seed, for repeatable runs (default 1)";
+
+// ==================== Scenarios ====================
+
+#[derive(Debug, Default, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct ScenarioFile {
+    #[serde(default)]
+    combat: Vec<CombatScenario>,
+    #[serde(default)]
+    economy: Vec<EconomyScenario>,
+}
+
+/// Many battles between armies drawn from the given unit counts
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct CombatScenario {
+    name: String,
+    #[serde(default = "default_runs")]
+    runs: u32,
+    #[serde(default = "default_mission")]
+    mission: MissionType,
+    attacker: HashMap<TroopType, UnitCount>,
+    defender: HashMap<TroopType, UnitCount>,
+}
+
+/// A fixed count, or `[min, max]` to draw from on every run
+#[derive(Debug, Clone, Copy, Deserialize)]
+#[serde(untagged)]
+enum UnitCount {
+    Fixed(i32),
+    Range([i32; 2]),
+}
+
+impl UnitCount {
+    fn draw(&self, rng: &mut StdRng) -> i32 {
+        match *self {
+            UnitCount::Fixed(count) => count,
+            UnitCount::Range([min, max]) => rng.gen_range(min..=max),
+        }
+    }
+}
+
+/// A new village following a build order for a number of hours
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct EconomyScenario {
+    name: String,
+    hours: u32,
+    /// Upgrades that may run at once
+    #[serde(default = "default_queue_slots")]
+    queue_slots: usize,
+    /// Each step upgrades the lowest-level building of that type, or
+    /// builds it when the village has none
+    build_order: Vec<BuildingType>,
+}
+
+fn default_runs() -> u32 {
+    1000
+}
+
+fn default_mission() -> MissionType {
+    MissionType::Attack
+}
+
+fn default_queue_slots() -> usize {
+    1
+}
+
+// ==================== Combat ====================
+
+#[derive(Default)]
+struct CombatSummary {
+    runs: u32,
+    attacker_wins: u32,
+    attacker_units: f64,
+    defender_units: f64,
+    attacker_loss_ratio: f64,
+    defender_loss_ratio: f64,
+    attacker_loss_value: f64,
+    defender_loss_value: f64,
+}
+
+fn run_combat(
+    scenario: &CombatScenario,
+    units: &[UnitDefinition],
+    rng: &mut StdRng,
+) -> CombatSummary {
+    let mut summary = CombatSummary {
+        runs: scenario.runs,
+        ..Default::default()
+    };
+
+    for _ in 0..scenario.runs {
+        let attacker = draw_army(&scenario.attacker, rng);
+        let defender = draw_army(&scenario.defender, rng);
+        let battle = combat::calculate_battle(
+            &attacker,
+            &defender,
+            units,
+            scenario.mission,
+            combat::BattleBonus::default(),
+        );
+
+        if battle.attacker_wins {
+            summary.attacker_wins += 1;
+        }
+        let (attacker_total, defender_total) = (count(&attacker), count(&defender));
+        summary.attacker_units += attacker_total as f64;
+        summary.defender_units += defender_total as f64;
+        summary.attacker_loss_ratio += ratio(count(&battle.attacker_losses), attacker_total);
+        summary.defender_loss_ratio += ratio(count(&battle.defender_losses), defender_total);
+        summary.attacker_loss_value += value(&battle.attacker_losses, units);
+        summary.defender_loss_value += value(&battle.defender_losses, units);
+    }
+
+    summary
+}
+
+fn draw_army(counts: &HashMap<TroopType, UnitCount>, rng: &mut StdRng) -> ArmyTroops {
+    counts
+        .iter()
+        .map(|(troop_type, count)| (*troop_type, count.draw(rng).max(0)))
+        .filter(|(_, count)| *count > 0)
+        .collect()
+}
+
+fn count(troops: &ArmyTroops) -> i32 {
+    troops.values().sum()
+}
+
+fn ratio(part: i32, whole: i32) -> f64 {
+    if whole > 0 {
+        part as f64 / whole as f64
+    } else {
+        0.0
+    }
+}
+
+/// Training cost of the troops, all four resources summed
+fn value(troops: &ArmyTroops, units: &[UnitDefinition]) -> f64 {
+    troops
+        .iter()
+        .filter_map(|(troop_type, count)| {
+            units.iter().find(|u| u.troop_type == *troop_type).map(|u| {
+                let cost = &u.cost;
+                (cost.wood + cost.clay + cost.iron + cost.crop) as f64 * *count as f64
+            })
+        })
+        .sum()
+}
+
+// ==================== Economy ====================
+
+/// Starting resources and storage of a new village (see the villages table)
+const START_RESOURCES: f64 = 500.0;
+const BASE_STORAGE: i32 = 800;
+/// Every village produces this much of each resource without fields
+const BASE_PRODUCTION: i32 = 3;
+
+struct SimBuilding {
+    building_type: BuildingType,
+    level: i32,
+    /// Minutes until the running upgrade finishes
+    upgrading: Option<u32>,
+}
+
+/// Village state, following VillageService, BuildingService and
+/// ResourceService
+struct SimVillage {
+    buildings: Vec<SimBuilding>,
+    /// wood, clay, iron, crop
+    resources: [f64; 4],
+}
+
+impl SimVillage {
+    fn new() -> Self {
+        let mut buildings = vec![
+            SimBuilding::new(BuildingType::MainBuilding, 1),
+            SimBuilding::new(BuildingType::RallyPoint, 1),
+        ];
+        for (building_type, fields) in [
+            (BuildingType::Woodcutter, 4),
+            (BuildingType::ClayPit, 4),
+            (BuildingType::IronMine, 4),
+            (BuildingType::CropField, 6),
+        ] {
+            for _ in 0..fields {
+                buildings.push(SimBuilding::new(building_type.clone(), 0));
+            }
+        }
+
+        Self {
+            buildings,
+            resources: [START_RESOURCES; 4],
+        }
+    }
+
+    /// wood, clay, iron and net crop per hour
+    fn production(&self) -> [i32; 4] {
+        let mut production = [BASE_PRODUCTION; 4];
+        for building in self.buildings.iter().filter(|b| b.level > 0) {
+            let index = match building.building_type {
+                BuildingType::Woodcutter => 0,
+                BuildingType::ClayPit => 1,
+                BuildingType::IronMine => 2,
+                BuildingType::CropField => 3,
+                _ => continue,
+            };
+            production[index] += building.building_type.production_per_hour(building.level);
+        }
+        production[3] -= self.population();
+        production
+    }
+
+    fn population(&self) -> i32 {
+        self.buildings
+            .iter()
+            .map(|b| b.building_type.population_at_level(b.level))
+            .sum()
+    }
+
+    fn capacity(&self, storage: BuildingType) -> i32 {
+        BASE_STORAGE
+            + self
+                .buildings
+                .iter()
+                .filter(|b| b.building_type == storage)
+                .map(|b| b.building_type.storage_capacity(b.level))
+                .sum::<i32>()
+    }
+
+    fn level(&self, building_type: &BuildingType) -> i32 {
+        self.buildings
+            .iter()
+            .filter(|b| b.building_type == *building_type)
+            .map(|b| b.level)
+            .max()
+            .unwrap_or(0)
+    }
+
+    fn upgrading(&self) -> usize {
+        self.buildings
+            .iter()
+            .filter(|b| b.upgrading.is_some())
+            .count()
+    }
+
+    /// Advance one minute: accrue resources and finish upgrades
+    fn tick(&mut self) {
+        let production = self.production();
+        let capacities = [
+            self.capacity(BuildingType::Warehouse),
+            self.capacity(BuildingType::Warehouse),
+            self.capacity(BuildingType::Warehouse),
+            self.capacity(BuildingType::Granary),
+        ];
+        for i in 0..4 {
+            self.resources[i] =
+                (self.resources[i] + production[i] as f64 / 60.0).clamp(0.0, capacities[i] as f64);
+        }
+
+        for building in &mut self.buildings {
+            if let Some(minutes) = building.upgrading {
+                if minutes <= 1 {
+                    building.level += 1;
+                    building.upgrading = None;
+                } else {
+                    building.upgrading = Some(minutes - 1);
+                }
+            }
+        }
+    }
+
+    /// Try to start the next step of the build order
+    fn start(&mut self, building_type: &BuildingType) -> StepOutcome {
+        // A step picks the lowest-level idle building of its type
+        let index = self
+            .buildings
+            .iter()
+            .enumerate()
+            .filter(|(_, b)| b.building_type == *building_type && b.upgrading.is_none())
+            .min_by_key(|(_, b)| b.level)
+            .map(|(i, _)| i);
+        let exists = self
+            .buildings
+            .iter()
+            .any(|b| b.building_type == *building_type);
+
+        let next_level = match index {
+            Some(i) => self.buildings[i].level + 1,
+            None if exists => return StepOutcome::Wait,
+            None => {
+                let met = building_type
+                    .prerequisites()
+                    .iter()
+                    .all(|p| self.level(&p.building_type) >= p.min_level);
+                if !met {
+                    return StepOutcome::Blocked;
+                }
+                1
+            }
+        };
+        if next_level > building_type.max_level() {
+            return StepOutcome::Skip;
+        }
+
+        let cost = building_type.cost_at_level(next_level);
+        let needed = [cost.wood, cost.clay, cost.iron, cost.crop];
+        let capacities = [
+            self.capacity(BuildingType::Warehouse),
+            self.capacity(BuildingType::Warehouse),
+            self.capacity(BuildingType::Warehouse),
+            self.capacity(BuildingType::Granary),
+        ];
+        if needed.iter().zip(capacities).any(|(n, c)| *n > c) {
+            return StepOutcome::Blocked;
+        }
+        if needed
+            .iter()
+            .zip(self.resources)
+            .any(|(n, have)| (*n as f64) > have)
+        {
+            return StepOutcome::Wait;
+        }
+
+        for (resource, n) in self.resources.iter_mut().zip(needed) {
+            *resource -= n as f64;
+        }
+        let minutes = ((cost.time_seconds.max(60) + 59) / 60) as u32;
+        let building = match index {
+            Some(i) => &mut self.buildings[i],
+            None => {
+                self.buildings
+                    .push(SimBuilding::new(building_type.clone(), 0));
+                self.buildings.last_mut().unwrap()
+            }
+        };
+        building.upgrading = Some(minutes);
+
+        StepOutcome::Started
+    }
+}
+
+impl SimBuilding {
+    fn new(building_type: BuildingType, level: i32) -> Self {
+        Self {
+            building_type,
+            level,
+            upgrading: None,
+        }
+    }
+}
+
+enum StepOutcome {
+    Started,
+    /// Not enough resources or no free building yet
+    Wait,
+    /// Prerequisites unmet or storage too small; dropped when nothing is
+    /// running that could change that
+    Blocked,
+    /// Already at max level
+    Skip,
+}
+
+struct EconomySummary {
+    steps_started: usize,
+    steps_skipped: usize,
+    /// Hour the last step was started, when the whole order got through
+    finished_hour: Option<f64>,
+    production: [i32; 4],
+    population: i32,
+    warehouse: i32,
+    granary: i32,
+}
+
+fn run_economy(scenario: &EconomyScenario, curve: &mut String) -> EconomySummary {
+    let mut village = SimVillage::new();
+    let mut steps = scenario.build_order.iter().peekable();
+    let (mut started, mut skipped) = (0, 0);
+    let mut finished_hour = None;
+
+    for minute in 0..scenario.hours * 60 {
+        while let Some(step) = steps.peek() {
+            if village.upgrading() >= scenario.queue_slots.max(1) {
+                break;
+            }
+            match village.start(step) {
+                StepOutcome::Started => started += 1,
+                StepOutcome::Skip => skipped += 1,
+                StepOutcome::Blocked if village.upgrading() == 0 => skipped += 1,
+                StepOutcome::Blocked | StepOutcome::Wait => break,
+            }
+            steps.next();
+            if steps.peek().is_none() {
+                finished_hour = Some(minute as f64 / 60.0);
+            }
+        }
+
+        village.tick();
+
+        if (minute + 1) % 60 == 0 {
+            let production = village.production();
+            let _ = writeln!(
+                curve,
+                "{},{},{:.0},{:.0},{:.0},{:.0},{},{},{},{},{},{}",
+                csv_field(&scenario.name),
+                (minute + 1) / 60,
+                village.resources[0],
+                village.resources[1],
+                village.resources[2],
+                village.resources[3],
+                production[0],
+                production[1],
+                production[2],
+                production[3],
+                village.population(),
+                started
+            );
+        }
+    }
+
+    EconomySummary {
+        steps_started: started,
+        steps_skipped: skipped,
+        finished_hour,
+        production: village.production(),
+        population: village.population(),
+        warehouse: village.capacity(BuildingType::Warehouse),
+        granary: village.capacity(BuildingType::Granary),
+    }
+}
+
+// ==================== Files ====================
+
+fn read_file<T: DeserializeOwned>(path: &Path) -> Result<T> {
+    let content = std::fs::read_to_string(path)
+        .with_context(|| format!("Failed to read {}", path.display()))?;
+    serde_yaml::from_str(&content).with_context(|| format!("Failed to parse {}", path.display()))
+}
+
+/// Replace the built-in definitions with the files in `dir`. The server
+/// validates definitions when it loads them; run it once against the same
+/// directory before trusting results.
+fn load_gamedata(dir: &Path) -> Result<()> {
+    let find = |name: &str| {
+        ["yaml", "yml", "json"]
+            .iter()
+            .map(|ext| dir.join(format!("{}.{}", name, ext)))
+            .find(|path| path.is_file())
+    };
+
+    let current = gamedata::definitions();
+    let buildings = match find("buildings") {
+        Some(path) => read_file::<BuildingsFile>(&path)?
+            .buildings
+            .into_iter()
+            .map(|b| (b.building_type.clone(), b))
+            .collect(),
+        None => current.buildings.clone(),
+    };
+    let units = match find("units") {
+        Some(path) => read_file::<UnitsFile>(&path)?.units,
+        None => current.units.clone(),
+    };
+    let tribes = match find("tribes") {
+        Some(path) => read_file::<TribesFile>(&path)?.tribes,
+        None => current.tribes.clone(),
+    };
+
+    gamedata::install(GameDefinitions {
+        buildings,
+        units,
+        tribes,
+    });
+    Ok(())
+}
+
+fn csv_field(value: &str) -> String {
+    if value.contains([',', '"', '\n']) {
+        format!("\"{}\"", value.replace('"', "\"\""))
+    } else {
+        value.to_string()
+    }
+}
+
+fn write_csv(dir: &Path, name: &str, header: &str, rows: &str) -> Result<()> {
+    let path = dir.join(name);
+    std::fs::write(&path, format!("{}\n{}", header, rows))
+        .with_context(|| format!("Failed to write {}", path.display()))?;
+    println!("Wrote {}", path.display());
+    Ok(())
+}
+
+// ==================== Main ====================
+
+fn main() -> Result<()> {
+    let mut files = Vec::new();
+    let mut out = PathBuf::from("simulation-results");
+    let mut gamedata_dir = None;
+    let mut seed = 1;
+
+    let mut args = std::env::args().skip(1);
+    while let Some(arg) = args.next() {
+        match arg.as_str() {
+            "--help" | "-h" => {
+                println!("{}", USAGE);
+                return Ok(());
+            }
+            "--out" | "--gamedata" | "--seed" => {
+                let value = args
+                    .next()
+                    .with_context(|| format!("{} needs a value\n\n{}", arg, USAGE))?;
+                match arg.as_str() {
+                    "--out" => out = PathBuf::from(value),
+                    "--gamedata" => gamedata_dir = Some(PathBuf::from(value)),
+                    _ => seed = value.parse().context("Invalid --seed")?,
+                }
+            }
+            flag if flag.starts_with("--") => bail!("Unknown option {}\n\n{}", flag, USAGE),
+            _ => files.push(PathBuf::from(arg)),
+        }
+    }
+    if files.is_empty() {
+        bail!("No scenario files given\n\n{}", USAGE);
+    }
+
+    if let Some(dir) = &gamedata_dir {
+        load_gamedata(dir)?;
+    }
+    let units = gamedata::definitions().units.clone();
+
+    let mut scenarios = ScenarioFile::default();
+    for file in &files {
+        let parsed: ScenarioFile = read_file(file)?;
+        scenarios.combat.extend(parsed.combat);
+        scenarios.economy.extend(parsed.economy);
+    }
+
+    for scenario in &scenarios.combat {
+        if !matches!(
+            scenario.mission,
+            MissionType::Raid | MissionType::Attack | MissionType::Conquer
+        ) {
+            bail!(
+                "Combat scenario {}: mission must be raid, attack or conquer",
+                scenario.name
+            );
+        }
+        for (troop_type, count) in scenario.attacker.iter().chain(&scenario.defender) {
+            if !units.iter().any(|u| u.troop_type == *troop_type) {
+                bail!(
+                    "Combat scenario {}: no unit definition for {:?}",
+                    scenario.name,
+                    troop_type
+                );
+            }
+            if let UnitCount::Range([min, max]) = count {
+                if min > max {
+                    bail!(
+                        "Combat scenario {}: {:?} range is empty",
+                        scenario.name,
+                        troop_type
+                    );
+                }
+            }
+        }
+    }
+
+    std::fs::create_dir_all(&out).with_context(|| format!("Failed to create {}", out.display()))?;
+    let mut rng = StdRng::seed_from_u64(seed);
+
+    if !scenarios.combat.is_empty() {
+        let mut rows = String::new();
+        for scenario in &scenarios.combat {
+            let s = run_combat(scenario, &units, &mut rng);
+            let runs = s.runs.max(1) as f64;
+            let _ = writeln!(
+                rows,
+                "{},{:?},{},{:.3},{:.1},{:.1},{:.3},{:.3},{:.0},{:.0}",
+                csv_field(&scenario.name),
+                scenario.mission,
+                s.runs,
+                s.attacker_wins as f64 / runs,
+                s.attacker_units / runs,
+                s.defender_units / runs,
+                s.attacker_loss_ratio / runs,
+                s.defender_loss_ratio / runs,
+                s.attacker_loss_value / runs,
+                s.defender_loss_value / runs,
+            );
+        }
+        write_csv(
+            &out,
+            "combat.csv",
+            "scenario,mission,runs,attacker_win_rate,avg_attacker_units,avg_defender_units,\
+             avg_attacker_loss_ratio,avg_defender_loss_ratio,avg_attacker_loss_value,avg_defender_loss_value",
+            &rows,
+        )?;
+    }
+
+    if !scenarios.economy.is_empty() {
+        let (mut rows, mut curve) = (String::new(), String::new());
+        for scenario in &scenarios.economy {
+            let s = run_economy(scenario, &mut curve);
+            let _ = writeln!(
+                rows,
+                "{},{},{},{},{},{},{},{},{},{},{},{}",
+                csv_field(&scenario.name),
+                scenario.hours,
+                s.steps_started,
+                s.steps_skipped,
+                s.finished_hour
+                    .map(|h| format!("{:.1}", h))
+                    .unwrap_or_default(),
+                s.production[0],
+                s.production[1],
+                s.production[2],
+                s.production[3],
+                s.population,
+                s.warehouse,
+                s.granary,
+            );
+        }
+        write_csv(
+            &out,
+            "economy.csv",
+            "scenario,hours,steps_started,steps_skipped,build_order_done_hour,\
+             wood_per_hour,clay_per_hour,iron_per_hour,net_crop_per_hour,population,warehouse,granary",
+            &rows,
+        )?;
+        write_csv(
+            &out,
+            "economy_curve.csv",
+            "scenario,hour,wood,clay,iron,crop,wood_per_hour,clay_per_hour,iron_per_hour,\
+             net_crop_per_hour,population,steps_started",
+            &curve,
+        )?;
+    }
+
+    Ok(())
+}
@@ -0,0 +1,184 @@
+//! Generates the frontend's TypeScript types for the WebSocket protocol from
+//! schemas/ws-protocol.json, so both sides build against one contract.
+//!
+//!     cargo run --bin wsgen            # rewrite the generated file
+//!     cargo run --bin wsgen -- --check # fail if it is out of date (CI)
+
+use anyhow::{bail, Context, Result};
+use serde_json::{Map, Value};
+use std::fmt::Write as _;
+use std::path::PathBuf;
+
+const USAGE: &str = "\
+Usage: wsgen [options]
+
+  --schema FILE   Protocol schema (default schemas/ws-protocol.json)
+  --out FILE      TypeScript output (default ../frontend/src/lib/api/ws-protocol.gen.ts)
+  --check         Don't write; exit non-zero if the output would change";
+
+fn main() -> Result<()> {
+    let mut schema_path = PathBuf::from("schemas/ws-protocol.json");
+    let mut out = PathBuf::from("../frontend/src/lib/api/ws-protocol.gen.ts");
+    let mut check = false;
+
+    let mut args = std::env::args().skip(1);
+    while let Some(arg) = args.next() {
+        match arg.as_str() {
+            "--help" | "-h" => {
+                println!("{}", USAGE);
+                return Ok(());
+            }
+            "--check" => check = true,
+            "--schema" | "--out" => {
+                let value = args
+                    .next()
+                    .with_context(|| format!("{} needs a value\n\n{}", arg, USAGE))?;
+                match arg.as_str() {
+                    "--schema" => schema_path = PathBuf::from(value),
+                    _ => out = PathBuf::from(value),
+                }
+            }
+            other => bail!("Unknown option {}\n\n{}", other, USAGE),
+        }
+    }
+
+    let text = std::fs::read_to_string(&schema_path)
+        .with_context(|| format!("Failed to read {}", schema_path.display()))?;
+    let schema: Value = serde_json::from_str(&text)
+        .with_context(|| format!("Failed to parse {}", schema_path.display()))?;
+    let generated = generate(&schema)?;
+
+    if check {
+        let current = std::fs::read_to_string(&out).unwrap_or_default();
+        if current != generated {
+            bail!(
+                "{} is out of date; run `cargo run --bin wsgen`",
+                out.display()
+            );
+        }
+        println!("{} is up to date", out.display());
+        return Ok(());
+    }
+
+    std::fs::write(&out, generated)
+        .with_context(|| format!("Failed to write {}", out.display()))?;
+    println!("Wrote {}", out.display());
+    Ok(())
+}
+
+fn generate(schema: &Value) -> Result<String> {
+    let version = schema["x-version"]
+        .as_u64()
+        .context("Schema needs x-version")?;
+    let min_version = schema["x-min-version"]
+        .as_u64()
+        .context("Schema needs x-min-version")?;
+    let defs = schema["$defs"].as_object().context("Schema needs $defs")?;
+
+    let mut ts = String::new();
+    ts.push_str(
+        "// Code generated by `cargo run --bin wsgen` from backend/schemas/ws-protocol.json. DO NOT EDIT.\n\n",
+    );
+    writeln!(ts, "export const WS_PROTOCOL_VERSION = {};", version)?;
+    writeln!(
+        ts,
+        "export const WS_MIN_PROTOCOL_VERSION = {};",
+        min_version
+    )?;
+
+    for (name, def) in defs {
+        ts.push('\n');
+        write_definition(&mut ts, name, def)?;
+    }
+
+    for (section, name) in [
+        ("x-server-messages", "ServerMessages"),
+        ("x-client-messages", "ClientMessages"),
+    ] {
+        let messages = schema[section]
+            .as_object()
+            .with_context(|| format!("Schema needs {}", section))?;
+        writeln!(ts, "\n/** Payload type by message type */")?;
+        writeln!(ts, "export interface {} {{", name)?;
+        for (message_type, payload) in messages {
+            writeln!(ts, "    {}: {};", message_type, ts_type(payload)?)?;
+        }
+        ts.push_str("}\n");
+    }
+
+    ts.push_str("\nexport type ServerMessageType = keyof ServerMessages;\n");
+    ts.push_str("export type ClientMessageType = keyof ClientMessages;\n");
+    Ok(ts)
+}
+
+fn write_definition(ts: &mut String, name: &str, def: &Value) -> Result<()> {
+    if let Some(description) = def["description"].as_str() {
+        writeln!(ts, "/** {} */", description)?;
+    }
+
+    let properties = match def["properties"].as_object() {
+        Some(properties) if !properties.is_empty() => properties,
+        _ => {
+            writeln!(ts, "export type {} = {};", name, ts_type(def)?)?;
+            return Ok(());
+        }
+    };
+
+    writeln!(ts, "export interface {} {{", name)?;
+    for (field, field_schema, required) in ordered_properties(def, properties) {
+        if let Some(description) = field_schema["description"].as_str() {
+            writeln!(ts, "    /** {} */", description)?;
+        }
+        let optional = if required { "" } else { "?" };
+        writeln!(ts, "    {}{}: {};", field, optional, ts_type(field_schema)?)?;
+    }
+    ts.push_str("}\n");
+    Ok(())
+}
+
+/// Required fields in the order the schema lists them, then the rest
+fn ordered_properties<'a>(
+    def: &'a Value,
+    properties: &'a Map<String, Value>,
+) -> Vec<(&'a str, &'a Value, bool)> {
+    let required: Vec<&str> = def["required"]
+        .as_array()
+        .map(|r| r.iter().filter_map(Value::as_str).collect())
+        .unwrap_or_default();
+
+    let mut fields: Vec<_> = required
+        .iter()
+        .filter_map(|name| properties.get_key_value(*name))
+        .map(|(name, schema)| (name.as_str(), schema, true))
+        .collect();
+    fields.extend(
+        properties
+            .iter()
+            .filter(|(name, _)| !required.contains(&name.as_str()))
+            .map(|(name, schema)| (name.as_str(), schema, false)),
+    );
+    fields
+}
+
+fn ts_type(schema: &Value) -> Result<String> {
+    if let Some(reference) = schema["$ref"].as_str() {
+        let name = reference
+            .strip_prefix("#/$defs/")
+            .with_context(|| format!("Unsupported $ref {}", reference))?;
+        return Ok(name.to_string());
+    }
+
+    let ts = match schema["type"].as_str() {
+        None => "unknown".to_string(),
+        Some("string") => "string".to_string(),
+        Some("integer") | Some("number") => "number".to_string(),
+        Some("boolean") => "boolean".to_string(),
+        Some("array") => format!("{}[]", ts_type(&schema["items"])?),
+        Some("object") => match schema["properties"].as_object() {
+            Some(properties) if properties.is_empty() => "Record<string, never>".to_string(),
+            _ => "Record<string, unknown>".to_string(),
+        },
+        Some(other) => bail!("Unsupported schema type {}", other),
+    };
+    Ok(ts)
+}
@@ -1,5 +1,26 @@
-use anyhow::{Context, Result};
-use std::env;
+use anyhow::{bail, Context, Result};
+use std::path::Path;
+
+mod secrets;
+mod source;
+
+pub use secrets::{gcp_access_token, SecretStore};
+pub use source::ConfigSource;
+
+/// Development-only secrets; production refuses to start with these
+const DEFAULT_JWT_SECRET: &str = "dev-secret-change-in-production";
+const DEFAULT_DB_PASSWORD: &str = "postgres";
+
+const ENVIRONMENTS: &[&str] = &["development", "test", "staging", "production"];
+const REDIS_MODES: &[&str] = &["single", "sentinel", "cluster"];
+const AUTH_PROVIDERS: &[&str] = &["firebase", "dev"];
+const CAPTCHA_PROVIDERS: &[&str] = &["recaptcha", "hcaptcha"];
+/// Text search configurations built into every supported Postgres release
+const SEARCH_LANGUAGES: &[&str] = &[
+    "simple", "arabic", "danish", "dutch", "english", "finnish", "french", "german", "greek",
+    "hungarian", "indonesian", "irish", "italian", "lithuanian", "nepali", "norwegian",
+    "portuguese", "romanian", "russian", "spanish", "swedish", "tamil", "turkish",
+];
 
 #[derive(Debug, Clone)]
 pub struct Config {
@@ -8,17 +29,256 @@ pub struct Config {
     pub redis: RedisConfig,
     pub jwt: JwtConfig,
     pub firebase: FirebaseConfig,
+    pub search: SearchConfig,
+    pub archive: ArchiveConfig,
+    pub sync: SyncConfig,
+    pub tick: TickConfig,
+    pub startup: StartupConfig,
+    pub sentry: SentryConfig,
+    pub telemetry: TelemetryConfig,
+    pub audit: AuditConfig,
+    pub security: SecurityConfig,
+    pub gamedata: GameDataConfig,
+    pub stripe: StripeConfig,
+    pub email: EmailConfig,
+    pub discord: DiscordConfig,
+    pub captcha: CaptchaConfig,
+    pub ip_intel: IpIntelConfig,
+    pub secrets: SecretsConfig,
+    pub tls: TlsConfig,
+    pub limits: LimitsConfig,
+}
+
+#[derive(Debug, Clone)]
+pub struct ArchiveConfig {
+    /// Where archived reports are written: `file:///path` or an
+    /// S3/GCS-compatible bucket URL. Archiving is skipped when unset.
+    pub storage_url: Option<String>,
+    /// Bearer token sent with uploads to an HTTP(S) bucket
+    pub storage_token: Option<String>,
 }
 
 #[derive(Debug, Clone)]
 pub struct FirebaseConfig {
+    /// firebase, or dev for local development without Firebase credentials
+    pub auth_provider: String,
     pub project_id: String,
 }
 
+#[derive(Debug, Clone)]
+pub struct SearchConfig {
+    /// Text search configuration the search_vector columns are built with
+    /// and queries and highlights are parsed with. Stored in the database
+    /// at startup; changing it rebuilds the vectors.
+    pub language: String,
+}
+
+#[derive(Debug, Clone)]
+pub struct SyncConfig {
+    /// Domain events older than this are pruned; clients that have been
+    /// offline longer must do a full refetch
+    pub event_retention_hours: i64,
+    /// How long a dropped WebSocket client may reconnect and have missed
+    /// events replayed; 0 turns resume off
+    pub ws_resume_window_secs: u64,
+    /// Events kept per player for replay
+    pub ws_replay_limit: usize,
+}
+
+#[derive(Debug, Clone)]
+pub struct TickConfig {
+    /// Number of village id ranges each periodic job is split into; shards
+    /// are claimed independently so several instances share the work
+    pub shard_count: i32,
+    /// Most ticks a shard catches up in one pass after downtime; older
+    /// missed ticks are dropped
+    pub max_catchup_ticks: i64,
+}
+
+#[derive(Debug, Clone)]
+pub struct StartupConfig {
+    /// How long to keep retrying Postgres/Redis at boot before giving up
+    pub timeout_secs: u64,
+    pub initial_backoff_ms: u64,
+    pub max_backoff_ms: u64,
+}
+
+#[derive(Debug, Clone)]
+pub struct SentryConfig {
+    /// Sentry/GlitchTip DSN; error reporting is off when unset
+    pub dsn: Option<String>,
+    /// Fraction of error events sent (0.0 - 1.0)
+    pub sample_rate: f32,
+    /// Fraction of requests traced for performance (0.0 - 1.0)
+    pub traces_sample_rate: f32,
+}
+
+#[derive(Debug, Clone)]
+pub struct TelemetryConfig {
+    /// OTLP collector (gRPC) traces are exported to; tracing export is off
+    /// when unset
+    pub otlp_endpoint: Option<String>,
+    /// service.name reported with every span
+    pub service_name: String,
+    /// Fraction of new traces kept (0.0 - 1.0); spans within a kept trace
+    /// are always kept
+    pub sample_ratio: f64,
+}
+
+#[derive(Debug, Clone)]
+pub struct AuditConfig {
+    /// Record mutating API calls to api_audit_log
+    pub enabled: bool,
+    /// Bodies larger than this are stored as a size marker only
+    pub max_payload_bytes: usize,
+    pub retention_days: i64,
+}
+
+#[derive(Debug, Clone)]
+pub struct SecurityConfig {
+    /// Origins the browser client may call from; `*` only outside production
+    pub allowed_origins: Vec<String>,
+    pub cors_max_age_secs: u64,
+    /// Strict-Transport-Security max-age; 0 disables the header
+    pub hsts_max_age_secs: u64,
+}
+
+#[derive(Debug, Clone)]
+pub struct GameDataConfig {
+    /// Directory with buildings.yaml/units.yaml (or .json) overriding the
+    /// definitions compiled into the server
+    pub dir: Option<String>,
+    /// Watch `dir` and apply edits without a restart (development only)
+    pub hot_reload: bool,
+}
+
+#[derive(Debug, Clone)]
+pub struct StripeConfig {
+    pub secret_key: Option<String>,
+    pub webhook_secret: Option<String>,
+}
+
+/// Outgoing email through an HTTP email API. Nothing is sent when unset.
+#[derive(Debug, Clone)]
+pub struct EmailConfig {
+    /// Endpoint taking `{from, to, subject, text}` as JSON
+    pub api_url: Option<String>,
+    /// Bearer token for the endpoint
+    pub api_key: Option<String>,
+    pub from: String,
+    /// Frontend base URL for links in emails
+    pub app_url: String,
+}
+
+/// Posts to a Discord channel through a webhook. Nothing is posted when unset.
+#[derive(Debug, Clone)]
+pub struct DiscordConfig {
+    /// Webhook the weekly digest is posted to
+    pub digest_webhook_url: Option<String>,
+}
+
+/// Captcha challenges on suspicious or burst-prone flows. Off when no
+/// provider is set, e.g. in development.
+#[derive(Debug, Clone)]
+pub struct CaptchaConfig {
+    /// recaptcha or hcaptcha
+    pub provider: Option<String>,
+    pub secret_key: Option<String>,
+    /// Keys of trusted API clients (load tests, partner tools); requests
+    /// carrying one in `X-Api-Key` are never challenged
+    pub bypass_keys: Vec<String>,
+    /// New accounts from one address within an hour before registering
+    /// needs a captcha
+    pub registrations_per_ip_hour: i64,
+    /// Armies one player may send within 10 minutes before further sends
+    /// need a captcha
+    pub sends_per_10_min: i64,
+}
+
+impl CaptchaConfig {
+    pub fn enabled(&self) -> bool {
+        self.provider.is_some()
+    }
+}
+
+/// External IP intelligence API consulted for addresses the local lists
+/// don't cover. Only the local lists are used when unset.
+#[derive(Debug, Clone)]
+pub struct IpIntelConfig {
+    /// Base URL; lookups call `GET {api_url}/{ip}`
+    pub api_url: Option<String>,
+    /// Bearer token for the API
+    pub api_key: Option<String>,
+}
+
+/// Where `gcp-sm://` and `vault://` secret references are resolved
+#[derive(Debug, Clone)]
+pub struct SecretsConfig {
+    /// Only needed outside GCP; on GCP the metadata server provides a token
+    pub gcp_access_token: Option<String>,
+    pub vault_addr: Option<String>,
+    pub vault_token: Option<String>,
+    /// How often managed secrets are re-fetched to pick up rotations
+    pub refresh_secs: u64,
+}
+
+/// Native HTTPS for deployments without a TLS-terminating load balancer.
+/// Off unless a certificate pair or ACME domains are configured.
+#[derive(Debug, Clone)]
+pub struct TlsConfig {
+    pub cert_path: Option<String>,
+    pub key_path: Option<String>,
+    /// Domains to obtain Let's Encrypt certificates for (TLS-ALPN-01)
+    pub acme_domains: Vec<String>,
+    pub acme_email: Option<String>,
+    /// Where ACME account keys and certificates are kept across restarts
+    pub acme_cache_dir: Option<String>,
+    /// Use the Let's Encrypt production directory instead of staging
+    pub acme_production: bool,
+    pub https_port: u16,
+    /// Answer plain HTTP on SERVER_PORT with a redirect to HTTPS
+    pub redirect_http: bool,
+}
+
+impl TlsConfig {
+    pub fn enabled(&self) -> bool {
+        self.cert_path.is_some() || !self.acme_domains.is_empty()
+    }
+}
+
+/// Bounds on what one request may cost, so slow clients and oversized
+/// bodies can't tie up the workers serving gameplay
+#[derive(Debug, Clone)]
+pub struct LimitsConfig {
+    /// Gameplay and account API
+    pub api: RouteLimits,
+    /// Admin API and /debug, whose imports and scans run longer
+    pub admin: RouteLimits,
+    /// Time a client gets to send a request's headers. Also closes idle
+    /// keep-alive connections, since the wait for the next request counts.
+    pub header_read_timeout_secs: u64,
+    /// Size of all headers of a request together
+    pub max_header_bytes: usize,
+    pub max_headers: usize,
+}
+
+#[derive(Debug, Clone, Copy)]
+pub struct RouteLimits {
+    /// Handlers still running after this answer 503
+    pub timeout_secs: u64,
+    pub max_body_bytes: usize,
+}
+
 #[derive(Debug, Clone)]
 pub struct ServerConfig {
     pub port: u16,
     pub environment: String,
+    /// Bearer token Prometheus must send to scrape /metrics; the endpoint
+    /// is disabled when unset
+    pub metrics_token: Option<String>,
+    /// Admins may shift the game clock forward (see services::clock); test
+    /// worlds only
+    pub time_warp: bool,
 }
 
 #[derive(Debug, Clone)]
@@ -29,11 +289,33 @@ pub struct DatabaseConfig {
     pub password: String,
     pub database: String,
     pub max_connections: u32,
+    /// Statements slower than this are logged as slow queries
+    pub slow_query_ms: u64,
+    /// Read replicas as `host` or `host:port`; same credentials as the primary
+    pub replica_hosts: Vec<String>,
+    /// Replicas further behind than this are skipped until they catch up
+    pub replica_max_lag_ms: u64,
+    /// Pool size of each world shard (see db::shard)
+    pub shard_max_connections: u32,
+    /// Migrations applied to world shards
+    pub migrations_dir: String,
+    /// Migrate every world shard at startup
+    pub migrate_shards_on_start: bool,
 }
 
 #[derive(Debug, Clone)]
 pub struct RedisConfig {
+    /// single, sentinel or cluster
+    pub mode: String,
+    /// The node to use in single mode
     pub url: String,
+    /// Sentinel addresses (`redis://host:26379`) in sentinel mode
+    pub sentinels: Vec<String>,
+    pub sentinel_master: Option<String>,
+    /// Password of the nodes the sentinels point at
+    pub password: Option<String>,
+    /// Seed node addresses in cluster mode
+    pub cluster_nodes: Vec<String>,
 }
 
 #[derive(Debug, Clone)]
@@ -43,52 +325,605 @@ pub struct JwtConfig {
 }
 
 impl Config {
-    pub fn from_env() -> Result<Self> {
+    /// Load from environment variables, then the optional `CONFIG_FILE`,
+    /// then built-in defaults. Secret settings may be `gcp-sm://` or
+    /// `vault://` references, which are resolved before validation.
+    pub async fn load() -> Result<(Self, SecretStore)> {
+        let mut config = Self::read()?;
+        let secrets = SecretStore::new(&config.secrets);
+
+        config.jwt.secret = secrets.resolve("JWT_SECRET", &config.jwt.secret).await?;
+        config.database.password = secrets
+            .resolve("DB_PASSWORD", &config.database.password)
+            .await?;
+        for (name, field) in [
+            ("METRICS_TOKEN", &mut config.server.metrics_token),
+            ("ARCHIVE_STORAGE_TOKEN", &mut config.archive.storage_token),
+            ("SENTRY_DSN", &mut config.sentry.dsn),
+            ("STRIPE_SECRET_KEY", &mut config.stripe.secret_key),
+            ("STRIPE_WEBHOOK_SECRET", &mut config.stripe.webhook_secret),
+            ("EMAIL_API_KEY", &mut config.email.api_key),
+            ("DISCORD_DIGEST_WEBHOOK_URL", &mut config.discord.digest_webhook_url),
+            ("CAPTCHA_SECRET_KEY", &mut config.captcha.secret_key),
+            ("IP_INTEL_API_KEY", &mut config.ip_intel.api_key),
+        ] {
+            if let Some(value) = field.as_deref() {
+                *field = Some(secrets.resolve(name, value).await?);
+            }
+        }
+
+        config.validate()?;
+        Ok((config, secrets))
+    }
+
+    fn read() -> Result<Self> {
+        let source = ConfigSource::load()?;
+        let environment =
+            source.var("ENVIRONMENT").unwrap_or_else(|_| "development".to_string());
+        let is_production = environment == "production";
+
         Ok(Self {
             server: ServerConfig {
-                port: env::var("SERVER_PORT")
+                port: source.var("SERVER_PORT")
                     .unwrap_or_else(|_| "8080".to_string())
                     .parse()
                     .context("Invalid SERVER_PORT")?,
-                environment: env::var("ENVIRONMENT").unwrap_or_else(|_| "development".to_string()),
+                environment,
+                metrics_token: source.var("METRICS_TOKEN").ok().filter(|t| !t.is_empty()),
+                time_warp: source.var("TIME_WARP_ENABLED")
+                    .map(|v| v == "true" || v == "1")
+                    .unwrap_or(false),
             },
             database: DatabaseConfig {
-                host: env::var("DB_HOST").unwrap_or_else(|_| "localhost".to_string()),
-                port: env::var("DB_PORT")
+                host: source.var("DB_HOST").unwrap_or_else(|_| "localhost".to_string()),
+                port: source.var("DB_PORT")
                     .unwrap_or_else(|_| "5432".to_string())
                     .parse()
                     .context("Invalid DB_PORT")?,
-                user: env::var("DB_USER").unwrap_or_else(|_| "postgres".to_string()),
-                password: env::var("DB_PASSWORD").unwrap_or_else(|_| "postgres".to_string()),
-                database: env::var("DB_NAME").unwrap_or_else(|_| "travillian".to_string()),
-                max_connections: env::var("DB_MAX_CONNECTIONS")
+                user: source.var("DB_USER").unwrap_or_else(|_| "postgres".to_string()),
+                password: source.var("DB_PASSWORD")
+                    .unwrap_or_else(|_| DEFAULT_DB_PASSWORD.to_string()),
+                database: source.var("DB_NAME").unwrap_or_else(|_| "travillian".to_string()),
+                max_connections: source.var("DB_MAX_CONNECTIONS")
                     .unwrap_or_else(|_| "10".to_string())
                     .parse()
                     .context("Invalid DB_MAX_CONNECTIONS")?,
+                slow_query_ms: source.var("DB_SLOW_QUERY_MS")
+                    .unwrap_or_else(|_| "250".to_string())
+                    .parse()
+                    .context("Invalid DB_SLOW_QUERY_MS")?,
+                replica_hosts: source.var("DB_REPLICA_HOSTS")
+                    .unwrap_or_default()
+                    .split(',')
+                    .map(|h| h.trim().to_string())
+                    .filter(|h| !h.is_empty())
+                    .collect(),
+                replica_max_lag_ms: source.var("DB_REPLICA_MAX_LAG_MS")
+                    .unwrap_or_else(|_| "5000".to_string())
+                    .parse()
+                    .context("Invalid DB_REPLICA_MAX_LAG_MS")?,
+                shard_max_connections: source.var("DB_SHARD_MAX_CONNECTIONS")
+                    .unwrap_or_else(|_| "5".to_string())
+                    .parse()
+                    .context("Invalid DB_SHARD_MAX_CONNECTIONS")?,
+                migrations_dir: source.var("DB_MIGRATIONS_DIR")
+                    .unwrap_or_else(|_| "migrations".to_string()),
+                migrate_shards_on_start: source.var("DB_MIGRATE_SHARDS_ON_START")
+                    .map(|v| v == "true" || v == "1")
+                    .unwrap_or(false),
             },
             redis: RedisConfig {
-                url: env::var("REDIS_URL").unwrap_or_else(|_| "redis://localhost:6379".to_string()),
+                mode: source.var("REDIS_MODE").unwrap_or_else(|_| "single".to_string()),
+                url: source.var("REDIS_URL").unwrap_or_else(|_| "redis://localhost:6379".to_string()),
+                sentinels: source.var("REDIS_SENTINELS")
+                    .unwrap_or_default()
+                    .split(',')
+                    .map(|s| s.trim().to_string())
+                    .filter(|s| !s.is_empty())
+                    .collect(),
+                sentinel_master: source.var("REDIS_SENTINEL_MASTER").ok().filter(|m| !m.is_empty()),
+                password: source.var("REDIS_PASSWORD").ok().filter(|p| !p.is_empty()),
+                cluster_nodes: source.var("REDIS_CLUSTER_NODES")
+                    .unwrap_or_default()
+                    .split(',')
+                    .map(|n| n.trim().to_string())
+                    .filter(|n| !n.is_empty())
+                    .collect(),
             },
             jwt: JwtConfig {
-                secret: env::var("JWT_SECRET").unwrap_or_else(|_| "dev-secret-change-in-production".to_string()),
-                expiration_hours: env::var("JWT_EXPIRATION_HOURS")
+                secret: source.var("JWT_SECRET").unwrap_or_else(|_| DEFAULT_JWT_SECRET.to_string()),
+                expiration_hours: source.var("JWT_EXPIRATION_HOURS")
                     .unwrap_or_else(|_| "24".to_string())
                     .parse()
                     .context("Invalid JWT_EXPIRATION_HOURS")?,
             },
             firebase: FirebaseConfig {
-                project_id: env::var("FIREBASE_PROJECT_ID")
-                    .context("FIREBASE_PROJECT_ID is required")?,
+                auth_provider: source.var("AUTH_PROVIDER").unwrap_or_else(|_| "firebase".to_string()),
+                project_id: source.var("FIREBASE_PROJECT_ID").unwrap_or_default(),
+            },
+            search: SearchConfig {
+                language: source.var("SEARCH_LANGUAGE").unwrap_or_else(|_| "simple".to_string()),
+            },
+            archive: ArchiveConfig {
+                storage_url: source.var("ARCHIVE_STORAGE_URL").ok(),
+                storage_token: source.var("ARCHIVE_STORAGE_TOKEN").ok(),
+            },
+            sync: SyncConfig {
+                event_retention_hours: source.var("SYNC_EVENT_RETENTION_HOURS")
+                    .unwrap_or_else(|_| "168".to_string())
+                    .parse()
+                    .context("Invalid SYNC_EVENT_RETENTION_HOURS")?,
+                ws_resume_window_secs: source.var("SYNC_WS_RESUME_SECS")
+                    .unwrap_or_else(|_| "120".to_string())
+                    .parse()
+                    .context("Invalid SYNC_WS_RESUME_SECS")?,
+                ws_replay_limit: source.var("SYNC_WS_REPLAY_LIMIT")
+                    .unwrap_or_else(|_| "200".to_string())
+                    .parse()
+                    .context("Invalid SYNC_WS_REPLAY_LIMIT")?,
+            },
+            tick: TickConfig {
+                shard_count: source.var("TICK_SHARD_COUNT")
+                    .unwrap_or_else(|_| "8".to_string())
+                    .parse::<i32>()
+                    .context("Invalid TICK_SHARD_COUNT")?
+                    .max(1),
+                max_catchup_ticks: source.var("TICK_MAX_CATCHUP")
+                    .unwrap_or_else(|_| "168".to_string())
+                    .parse()
+                    .context("Invalid TICK_MAX_CATCHUP")?,
+            },
+            startup: StartupConfig {
+                timeout_secs: source.var("STARTUP_TIMEOUT_SECS")
+                    .unwrap_or_else(|_| "60".to_string())
+                    .parse()
+                    .context("Invalid STARTUP_TIMEOUT_SECS")?,
+                initial_backoff_ms: source.var("STARTUP_INITIAL_BACKOFF_MS")
+                    .unwrap_or_else(|_| "500".to_string())
+                    .parse()
+                    .context("Invalid STARTUP_INITIAL_BACKOFF_MS")?,
+                max_backoff_ms: source.var("STARTUP_MAX_BACKOFF_MS")
+                    .unwrap_or_else(|_| "10000".to_string())
+                    .parse()
+                    .context("Invalid STARTUP_MAX_BACKOFF_MS")?,
+            },
+            sentry: SentryConfig {
+                dsn: source.var("SENTRY_DSN").ok().filter(|d| !d.is_empty()),
+                sample_rate: source.var("SENTRY_SAMPLE_RATE")
+                    .unwrap_or_else(|_| "1.0".to_string())
+                    .parse()
+                    .context("Invalid SENTRY_SAMPLE_RATE")?,
+                traces_sample_rate: source.var("SENTRY_TRACES_SAMPLE_RATE")
+                    .unwrap_or_else(|_| "0.0".to_string())
+                    .parse()
+                    .context("Invalid SENTRY_TRACES_SAMPLE_RATE")?,
+            },
+            telemetry: TelemetryConfig {
+                otlp_endpoint: source.var("OTEL_EXPORTER_OTLP_ENDPOINT").ok().filter(|e| !e.is_empty()),
+                service_name: source.var("OTEL_SERVICE_NAME")
+                    .unwrap_or_else(|_| "travillian-backend".to_string()),
+                sample_ratio: source.var("OTEL_TRACES_SAMPLE_RATIO")
+                    .unwrap_or_else(|_| "1.0".to_string())
+                    .parse()
+                    .context("Invalid OTEL_TRACES_SAMPLE_RATIO")?,
+            },
+            audit: AuditConfig {
+                enabled: source.var("AUDIT_LOG_ENABLED")
+                    .map(|v| v == "true" || v == "1")
+                    .unwrap_or(false),
+                max_payload_bytes: source.var("AUDIT_LOG_MAX_PAYLOAD_BYTES")
+                    .unwrap_or_else(|_| "16384".to_string())
+                    .parse()
+                    .context("Invalid AUDIT_LOG_MAX_PAYLOAD_BYTES")?,
+                retention_days: source.var("AUDIT_LOG_RETENTION_DAYS")
+                    .unwrap_or_else(|_| "90".to_string())
+                    .parse()
+                    .context("Invalid AUDIT_LOG_RETENTION_DAYS")?,
+            },
+            security: SecurityConfig {
+                allowed_origins: source.var("CORS_ALLOWED_ORIGINS")
+                    .unwrap_or_else(|_| {
+                        if is_production {
+                            String::new()
+                        } else {
+                            "http://localhost:5173".to_string()
+                        }
+                    })
+                    .split(',')
+                    .map(|o| o.trim().trim_end_matches('/').to_string())
+                    .filter(|o| !o.is_empty())
+                    .collect(),
+                cors_max_age_secs: source.var("CORS_MAX_AGE_SECS")
+                    .unwrap_or_else(|_| "3600".to_string())
+                    .parse()
+                    .context("Invalid CORS_MAX_AGE_SECS")?,
+                hsts_max_age_secs: source.var("HSTS_MAX_AGE_SECS")
+                    .unwrap_or_else(|_| if is_production { "31536000" } else { "0" }.to_string())
+                    .parse()
+                    .context("Invalid HSTS_MAX_AGE_SECS")?,
+            },
+            gamedata: GameDataConfig {
+                dir: source.var("GAMEDATA_DIR").ok().filter(|d| !d.is_empty()),
+                hot_reload: !is_production
+                    && source.var("GAMEDATA_HOT_RELOAD")
+                        .map(|v| v == "true" || v == "1")
+                        .unwrap_or(true),
+            },
+            stripe: StripeConfig {
+                secret_key: source.var("STRIPE_SECRET_KEY").ok().filter(|k| !k.is_empty()),
+                webhook_secret: source.var("STRIPE_WEBHOOK_SECRET").ok().filter(|k| !k.is_empty()),
+            },
+            email: EmailConfig {
+                api_url: source.var("EMAIL_API_URL").ok().filter(|u| !u.is_empty()),
+                api_key: source.var("EMAIL_API_KEY").ok().filter(|k| !k.is_empty()),
+                from: source.var("EMAIL_FROM")
+                    .unwrap_or_else(|_| "Travillian <noreply@travillian.local>".to_string()),
+                app_url: source.var("EMAIL_APP_URL")
+                    .unwrap_or_else(|_| "http://localhost:5173".to_string()),
+            },
+            discord: DiscordConfig {
+                digest_webhook_url: source
+                    .var("DISCORD_DIGEST_WEBHOOK_URL")
+                    .ok()
+                    .filter(|u| !u.is_empty()),
+            },
+            captcha: CaptchaConfig {
+                provider: source.var("CAPTCHA_PROVIDER").ok().filter(|p| !p.is_empty()),
+                secret_key: source.var("CAPTCHA_SECRET_KEY").ok().filter(|k| !k.is_empty()),
+                bypass_keys: source.var("CAPTCHA_BYPASS_KEYS")
+                    .unwrap_or_default()
+                    .split(',')
+                    .map(|k| k.trim().to_string())
+                    .filter(|k| !k.is_empty())
+                    .collect(),
+                registrations_per_ip_hour: source.var("CAPTCHA_REGISTRATIONS_PER_IP_HOUR")
+                    .unwrap_or_else(|_| "3".to_string())
+                    .parse()
+                    .context("Invalid CAPTCHA_REGISTRATIONS_PER_IP_HOUR")?,
+                sends_per_10_min: source.var("CAPTCHA_SENDS_PER_10_MIN")
+                    .unwrap_or_else(|_| "40".to_string())
+                    .parse()
+                    .context("Invalid CAPTCHA_SENDS_PER_10_MIN")?,
+            },
+            ip_intel: IpIntelConfig {
+                api_url: source.var("IP_INTEL_API_URL").ok().filter(|u| !u.is_empty()),
+                api_key: source.var("IP_INTEL_API_KEY").ok().filter(|k| !k.is_empty()),
+            },
+            secrets: SecretsConfig {
+                gcp_access_token: source.var("GCP_ACCESS_TOKEN").ok().filter(|t| !t.is_empty()),
+                vault_addr: source.var("VAULT_ADDR").ok().filter(|a| !a.is_empty()),
+                vault_token: source.var("VAULT_TOKEN").ok().filter(|t| !t.is_empty()),
+                refresh_secs: source.var("SECRETS_REFRESH_SECS")
+                    .unwrap_or_else(|_| "300".to_string())
+                    .parse()
+                    .context("Invalid SECRETS_REFRESH_SECS")?,
+            },
+            tls: TlsConfig {
+                cert_path: source.var("TLS_CERT_PATH").ok().filter(|p| !p.is_empty()),
+                key_path: source.var("TLS_KEY_PATH").ok().filter(|p| !p.is_empty()),
+                acme_domains: source.var("ACME_DOMAINS")
+                    .unwrap_or_default()
+                    .split(',')
+                    .map(|d| d.trim().to_string())
+                    .filter(|d| !d.is_empty())
+                    .collect(),
+                acme_email: source.var("ACME_EMAIL").ok().filter(|e| !e.is_empty()),
+                acme_cache_dir: source.var("ACME_CACHE_DIR").ok().filter(|d| !d.is_empty()),
+                acme_production: source.var("ACME_PRODUCTION")
+                    .map(|v| v == "true" || v == "1")
+                    .unwrap_or(false),
+                https_port: source.var("TLS_HTTPS_PORT")
+                    .unwrap_or_else(|_| "8443".to_string())
+                    .parse()
+                    .context("Invalid TLS_HTTPS_PORT")?,
+                redirect_http: source.var("TLS_REDIRECT_HTTP")
+                    .map(|v| v == "true" || v == "1")
+                    .unwrap_or(true),
+            },
+            limits: LimitsConfig {
+                api: RouteLimits {
+                    timeout_secs: source.var("REQUEST_TIMEOUT_SECS")
+                        .unwrap_or_else(|_| "15".to_string())
+                        .parse()
+                        .context("Invalid REQUEST_TIMEOUT_SECS")?,
+                    max_body_bytes: source.var("MAX_BODY_BYTES")
+                        .unwrap_or_else(|_| "65536".to_string())
+                        .parse()
+                        .context("Invalid MAX_BODY_BYTES")?,
+                },
+                admin: RouteLimits {
+                    timeout_secs: source.var("ADMIN_REQUEST_TIMEOUT_SECS")
+                        .unwrap_or_else(|_| "120".to_string())
+                        .parse()
+                        .context("Invalid ADMIN_REQUEST_TIMEOUT_SECS")?,
+                    max_body_bytes: source.var("ADMIN_MAX_BODY_BYTES")
+                        .unwrap_or_else(|_| "10485760".to_string())
+                        .parse()
+                        .context("Invalid ADMIN_MAX_BODY_BYTES")?,
+                },
+                header_read_timeout_secs: source.var("HTTP_HEADER_READ_TIMEOUT_SECS")
+                    .unwrap_or_else(|_| "10".to_string())
+                    .parse()
+                    .context("Invalid HTTP_HEADER_READ_TIMEOUT_SECS")?,
+                max_header_bytes: source.var("HTTP_MAX_HEADER_BYTES")
+                    .unwrap_or_else(|_| "16384".to_string())
+                    .parse()
+                    .context("Invalid HTTP_MAX_HEADER_BYTES")?,
+                max_headers: source.var("HTTP_MAX_HEADERS")
+                    .unwrap_or_else(|_| "64".to_string())
+                    .parse()
+                    .context("Invalid HTTP_MAX_HEADERS")?,
             },
         })
     }
-}
 
-impl DatabaseConfig {
-    pub fn connection_string(&self) -> String {
-        format!(
-            "postgres://{}:{}@{}:{}/{}",
-            self.user, self.password, self.host, self.port, self.database
-        )
+    /// Check the loaded values before anything connects, reporting every
+    /// problem at once. Production additionally rejects development secrets.
+    pub fn validate(&self) -> Result<()> {
+        let mut errors = Vec::new();
+        let is_production = self.server.environment == "production";
+
+        if !ENVIRONMENTS.contains(&self.server.environment.as_str()) {
+            errors.push(format!(
+                "ENVIRONMENT must be one of {}",
+                ENVIRONMENTS.join(", ")
+            ));
+        }
+        if self.server.port == 0 {
+            errors.push("SERVER_PORT must not be 0".to_string());
+        }
+        if self.server.time_warp && is_production {
+            errors.push("TIME_WARP_ENABLED is not allowed in production".to_string());
+        }
+
+        for (name, value) in [
+            ("DB_HOST", &self.database.host),
+            ("DB_USER", &self.database.user),
+            ("DB_NAME", &self.database.database),
+        ] {
+            if value.trim().is_empty() {
+                errors.push(format!("{} must not be empty", name));
+            }
+        }
+        match self.firebase.auth_provider.as_str() {
+            "firebase" => {
+                if self.firebase.project_id.trim().is_empty() {
+                    errors.push("FIREBASE_PROJECT_ID is required".to_string());
+                }
+            }
+            "dev" => {
+                if self.server.environment != "development" {
+                    errors.push("AUTH_PROVIDER=dev is only allowed in development".to_string());
+                }
+            }
+            _ => errors.push(format!(
+                "AUTH_PROVIDER must be one of {}",
+                AUTH_PROVIDERS.join(", ")
+            )),
+        }
+        if !SEARCH_LANGUAGES.contains(&self.search.language.as_str()) {
+            errors.push(format!(
+                "SEARCH_LANGUAGE must be one of {}",
+                SEARCH_LANGUAGES.join(", ")
+            ));
+        }
+        if self.database.max_connections == 0 {
+            errors.push("DB_MAX_CONNECTIONS must be at least 1".to_string());
+        }
+        if self.database.shard_max_connections == 0 {
+            errors.push("DB_SHARD_MAX_CONNECTIONS must be at least 1".to_string());
+        }
+        if self.database.migrate_shards_on_start && !Path::new(&self.database.migrations_dir).is_dir() {
+            errors.push(format!(
+                "DB_MIGRATIONS_DIR {} is not a directory",
+                self.database.migrations_dir
+            ));
+        }
+        for host in &self.database.replica_hosts {
+            if let Some((_, port)) = host.rsplit_once(':') {
+                if port.parse::<u16>().is_err() {
+                    errors.push(format!("DB_REPLICA_HOSTS entry {} has an invalid port", host));
+                }
+            }
+        }
+        let redis = &self.redis;
+        let is_redis_url = |url: &String| url.starts_with("redis://") || url.starts_with("rediss://");
+        match redis.mode.as_str() {
+            "single" => {
+                if !is_redis_url(&redis.url) {
+                    errors.push("REDIS_URL must start with redis:// or rediss://".to_string());
+                }
+            }
+            "sentinel" => {
+                if redis.sentinels.is_empty() || redis.sentinel_master.is_none() {
+                    errors.push(
+                        "REDIS_MODE=sentinel needs REDIS_SENTINELS and REDIS_SENTINEL_MASTER".to_string(),
+                    );
+                }
+                if !redis.sentinels.iter().all(is_redis_url) {
+                    errors.push("REDIS_SENTINELS entries must start with redis:// or rediss://".to_string());
+                }
+            }
+            "cluster" => {
+                if redis.cluster_nodes.is_empty() {
+                    errors.push("REDIS_MODE=cluster needs REDIS_CLUSTER_NODES".to_string());
+                }
+                if !redis.cluster_nodes.iter().all(is_redis_url) {
+                    errors.push("REDIS_CLUSTER_NODES entries must start with redis:// or rediss://".to_string());
+                }
+            }
+            _ => errors.push(format!("REDIS_MODE must be one of {}", REDIS_MODES.join(", "))),
+        }
+
+        if self.jwt.secret.trim().is_empty() {
+            errors.push("JWT_SECRET must not be empty".to_string());
+        }
+        if !(1..=720).contains(&self.jwt.expiration_hours) {
+            errors.push("JWT_EXPIRATION_HOURS must be between 1 and 720".to_string());
+        }
+
+        if let Some(url) = &self.archive.storage_url {
+            if !url.is_empty()
+                && !["file://", "http://", "https://"]
+                    .iter()
+                    .any(|scheme| url.starts_with(scheme))
+            {
+                errors.push(
+                    "ARCHIVE_STORAGE_URL must start with file://, http:// or https://".to_string(),
+                );
+            }
+        }
+
+        if self.sync.event_retention_hours <= 0 {
+            errors.push("SYNC_EVENT_RETENTION_HOURS must be positive".to_string());
+        }
+        if self.sync.ws_resume_window_secs > 0 && self.sync.ws_replay_limit == 0 {
+            errors.push("SYNC_WS_REPLAY_LIMIT must be positive when resume is on".to_string());
+        }
+        if self.tick.max_catchup_ticks < 0 {
+            errors.push("TICK_MAX_CATCHUP must not be negative".to_string());
+        }
+        if self.startup.timeout_secs == 0 {
+            errors.push("STARTUP_TIMEOUT_SECS must be positive".to_string());
+        }
+        if self.startup.initial_backoff_ms == 0
+            || self.startup.initial_backoff_ms > self.startup.max_backoff_ms
+        {
+            errors.push(
+                "STARTUP_INITIAL_BACKOFF_MS must be positive and not above STARTUP_MAX_BACKOFF_MS"
+                    .to_string(),
+            );
+        }
+
+        for (name, rate) in [
+            ("SENTRY_SAMPLE_RATE", self.sentry.sample_rate),
+            ("SENTRY_TRACES_SAMPLE_RATE", self.sentry.traces_sample_rate),
+        ] {
+            if !(0.0..=1.0).contains(&rate) {
+                errors.push(format!("{} must be between 0.0 and 1.0", name));
+            }
+        }
+        if !(0.0..=1.0).contains(&self.telemetry.sample_ratio) {
+            errors.push("OTEL_TRACES_SAMPLE_RATIO must be between 0.0 and 1.0".to_string());
+        }
+        if let Some(endpoint) = &self.telemetry.otlp_endpoint {
+            if !endpoint.starts_with("http://") && !endpoint.starts_with("https://") {
+                errors.push("OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL".to_string());
+            }
+        }
+        if self.telemetry.service_name.trim().is_empty() {
+            errors.push("OTEL_SERVICE_NAME must not be empty".to_string());
+        }
+
+        if self.audit.max_payload_bytes == 0 {
+            errors.push("AUDIT_LOG_MAX_PAYLOAD_BYTES must be positive".to_string());
+        }
+        if self.audit.retention_days <= 0 {
+            errors.push("AUDIT_LOG_RETENTION_DAYS must be positive".to_string());
+        }
+
+        for origin in &self.security.allowed_origins {
+            if origin != "*" && !origin.starts_with("http://") && !origin.starts_with("https://") {
+                errors.push(format!(
+                    "CORS_ALLOWED_ORIGINS entry {} must start with http:// or https://",
+                    origin
+                ));
+            }
+        }
+
+        if let Some(provider) = &self.captcha.provider {
+            if !CAPTCHA_PROVIDERS.contains(&provider.as_str()) {
+                errors.push(format!(
+                    "CAPTCHA_PROVIDER must be one of {}",
+                    CAPTCHA_PROVIDERS.join(", ")
+                ));
+            }
+            if self.captcha.secret_key.is_none() {
+                errors.push("CAPTCHA_SECRET_KEY is required when CAPTCHA_PROVIDER is set".to_string());
+            }
+        }
+        if self.captcha.registrations_per_ip_hour < 1 || self.captcha.sends_per_10_min < 1 {
+            errors.push(
+                "CAPTCHA_REGISTRATIONS_PER_IP_HOUR and CAPTCHA_SENDS_PER_10_MIN must be positive"
+                    .to_string(),
+            );
+        }
+
+        if let Some(url) = &self.ip_intel.api_url {
+            if !url.starts_with("http://") && !url.starts_with("https://") {
+                errors.push("IP_INTEL_API_URL must start with http:// or https://".to_string());
+            }
+        }
+
+        if self.secrets.refresh_secs == 0 {
+            errors.push("SECRETS_REFRESH_SECS must be positive".to_string());
+        }
+
+        let tls = &self.tls;
+        if tls.cert_path.is_some() != tls.key_path.is_some() {
+            errors.push("TLS_CERT_PATH and TLS_KEY_PATH must be set together".to_string());
+        }
+        if tls.cert_path.is_some() && !tls.acme_domains.is_empty() {
+            errors.push("Use either TLS_CERT_PATH/TLS_KEY_PATH or ACME_DOMAINS, not both".to_string());
+        }
+        for path in [&tls.cert_path, &tls.key_path].into_iter().flatten() {
+            if !Path::new(path).is_file() {
+                errors.push(format!("TLS file {} does not exist", path));
+            }
+        }
+        if tls.enabled() && tls.https_port == self.server.port {
+            errors.push("TLS_HTTPS_PORT must differ from SERVER_PORT".to_string());
+        }
+        if !tls.acme_domains.is_empty() && tls.acme_cache_dir.is_none() && is_production {
+            errors.push(
+                "ACME_CACHE_DIR is required in production to avoid Let's Encrypt rate limits"
+                    .to_string(),
+            );
+        }
+
+        let limits = &self.limits;
+        for (name, value) in [
+            ("REQUEST_TIMEOUT_SECS", limits.api.timeout_secs),
+            ("ADMIN_REQUEST_TIMEOUT_SECS", limits.admin.timeout_secs),
+            ("HTTP_HEADER_READ_TIMEOUT_SECS", limits.header_read_timeout_secs),
+            ("MAX_BODY_BYTES", limits.api.max_body_bytes as u64),
+            ("ADMIN_MAX_BODY_BYTES", limits.admin.max_body_bytes as u64),
+            ("HTTP_MAX_HEADERS", limits.max_headers as u64),
+        ] {
+            if value == 0 {
+                errors.push(format!("{} must be positive", name));
+            }
+        }
+        // hyper's read buffer, which bounds the headers, can't be smaller
+        if limits.max_header_bytes < 8192 {
+            errors.push("HTTP_MAX_HEADER_BYTES must be at least 8192".to_string());
+        }
+
+        if let Some(dir) = &self.gamedata.dir {
+            if !Path::new(dir).is_dir() {
+                errors.push(format!("GAMEDATA_DIR {} is not a directory", dir));
+            }
+        }
+
+        if is_production {
+            if self.jwt.secret == DEFAULT_JWT_SECRET || self.jwt.secret.len() < 32 {
+                errors.push(
+                    "JWT_SECRET must be set to a random value of at least 32 characters in production"
+                        .to_string(),
+                );
+            }
+            if self.database.password == DEFAULT_DB_PASSWORD {
+                errors.push("DB_PASSWORD must be set in production".to_string());
+            }
+            if self.security.allowed_origins.iter().any(|o| o == "*") {
+                errors.push("CORS_ALLOWED_ORIGINS must not contain * in production".to_string());
+            }
+        }
+
+        if !errors.is_empty() {
+            bail!("Invalid configuration:\n  {}", errors.join("\n  "));
+        }
+
+        Ok(())
     }
 }
@@ -0,0 +1,299 @@
+use anyhow::{anyhow, bail, Context, Result};
+use async_trait::async_trait;
+use base64::Engine;
+use reqwest::Client;
+use serde_json::Value;
+use std::collections::HashMap;
+use std::sync::{Arc, Mutex, RwLock};
+use std::time::Duration;
+
+use super::SecretsConfig;
+
+/// Resolves a secret reference (`gcp-sm://...`, `vault://...`) to its value
+#[async_trait]
+pub trait SecretProvider: Send + Sync {
+    /// URL scheme this provider handles, without `://`
+    fn scheme(&self) -> &'static str;
+
+    /// Fetch the current value; `path` is the reference without the scheme
+    async fn fetch(&self, path: &str) -> Result<String>;
+}
+
+/// GCP Secret Manager: `gcp-sm://projects/<project>/secrets/<name>[/versions/<version>]`.
+/// Authenticates as the instance's service account via the metadata server,
+/// or with `GCP_ACCESS_TOKEN` when running elsewhere.
+pub struct GcpSecretManager {
+    client: Client,
+    access_token: Option<String>,
+}
+
+impl GcpSecretManager {
+    pub fn new(client: Client, access_token: Option<String>) -> Self {
+        Self {
+            client,
+            access_token,
+        }
+    }
+
+    async fn token(&self) -> Result<String> {
+        gcp_access_token(&self.client, self.access_token.as_deref()).await
+    }
+}
+
+/// OAuth token for Google APIs: the configured one, or the instance service
+/// account's from the metadata server
+pub async fn gcp_access_token(client: &Client, configured: Option<&str>) -> Result<String> {
+    if let Some(token) = configured {
+        return Ok(token.to_string());
+    }
+
+    let response: Value = client
+        .get("http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token")
+        .header("Metadata-Flavor", "Google")
+        .send()
+        .await
+        .context("GCP metadata server unreachable")?
+        .error_for_status()?
+        .json()
+        .await?;
+
+    response["access_token"]
+        .as_str()
+        .map(str::to_string)
+        .ok_or_else(|| anyhow!("GCP metadata server returned no access token"))
+}
+
+#[async_trait]
+impl SecretProvider for GcpSecretManager {
+    fn scheme(&self) -> &'static str {
+        "gcp-sm"
+    }
+
+    async fn fetch(&self, path: &str) -> Result<String> {
+        let name = if path.contains("/versions/") {
+            path.to_string()
+        } else {
+            format!("{}/versions/latest", path)
+        };
+
+        let response: Value = self
+            .client
+            .get(format!(
+                "https://secretmanager.googleapis.com/v1/{}:access",
+                name
+            ))
+            .bearer_auth(self.token().await?)
+            .send()
+            .await?
+            .error_for_status()?
+            .json()
+            .await?;
+
+        let data = response["payload"]["data"]
+            .as_str()
+            .ok_or_else(|| anyhow!("Secret {} has no payload", name))?;
+        let bytes = base64::engine::general_purpose::STANDARD.decode(data)?;
+
+        Ok(String::from_utf8(bytes)?.trim_end().to_string())
+    }
+}
+
+/// HashiCorp Vault KV (v1 or v2): `vault://<mount>/<path>#<key>`
+pub struct VaultProvider {
+    client: Client,
+    addr: String,
+    token: String,
+}
+
+impl VaultProvider {
+    pub fn new(client: Client, addr: String, token: String) -> Self {
+        Self {
+            client,
+            addr: addr.trim_end_matches('/').to_string(),
+            token,
+        }
+    }
+}
+
+#[async_trait]
+impl SecretProvider for VaultProvider {
+    fn scheme(&self) -> &'static str {
+        "vault"
+    }
+
+    async fn fetch(&self, path: &str) -> Result<String> {
+        let (path, key) = path
+            .split_once('#')
+            .ok_or_else(|| anyhow!("Vault reference {} needs a #key", path))?;
+
+        let response: Value = self
+            .client
+            .get(format!("{}/v1/{}", self.addr, path))
+            .header("X-Vault-Token", &self.token)
+            .send()
+            .await?
+            .error_for_status()?
+            .json()
+            .await?;
+
+        // KV v2 nests the secret under data.data
+        let data = &response["data"];
+        let value = data["data"][key].as_str().or_else(|| data[key].as_str());
+
+        value
+            .map(str::to_string)
+            .ok_or_else(|| anyhow!("Vault secret {} has no key {}", path, key))
+    }
+}
+
+type RotationHook = Box<dyn Fn(&str) + Send + Sync>;
+
+struct ManagedSecret {
+    reference: String,
+    value: String,
+}
+
+struct Inner {
+    providers: Vec<Box<dyn SecretProvider>>,
+    /// Settings resolved from a provider, by setting name
+    secrets: RwLock<HashMap<&'static str, ManagedSecret>>,
+    hooks: Mutex<Vec<(&'static str, RotationHook)>>,
+}
+
+/// Secret-valued settings. A setting whose value is a provider reference is
+/// fetched at startup and re-fetched by `refresh`; plain values pass through.
+#[derive(Clone)]
+pub struct SecretStore {
+    inner: Arc<Inner>,
+}
+
+impl SecretStore {
+    pub fn new(config: &SecretsConfig) -> Self {
+        let client = Client::builder()
+            .timeout(Duration::from_secs(10))
+            .build()
+            .unwrap_or_default();
+
+        let mut providers: Vec<Box<dyn SecretProvider>> = vec![Box::new(GcpSecretManager::new(
+            client.clone(),
+            config.gcp_access_token.clone(),
+        ))];
+        if let (Some(addr), Some(token)) = (&config.vault_addr, &config.vault_token) {
+            providers.push(Box::new(VaultProvider::new(
+                client,
+                addr.clone(),
+                token.clone(),
+            )));
+        }
+
+        Self {
+            inner: Arc::new(Inner {
+                providers,
+                secrets: RwLock::new(HashMap::new()),
+                hooks: Mutex::new(Vec::new()),
+            }),
+        }
+    }
+
+    /// The value for a setting: fetched from its provider when `value` is a
+    /// reference, otherwise `value` itself
+    pub async fn resolve(&self, name: &'static str, value: &str) -> Result<String> {
+        let Some((provider, path)) = self.provider_for(value)? else {
+            return Ok(value.to_string());
+        };
+
+        let secret = provider
+            .fetch(path)
+            .await
+            .with_context(|| format!("Failed to resolve {} from {}", name, value))?;
+
+        self.inner.secrets.write().unwrap().insert(
+            name,
+            ManagedSecret {
+                reference: value.to_string(),
+                value: secret.clone(),
+            },
+        );
+
+        Ok(secret)
+    }
+
+    /// Current value of a managed setting, reflecting rotations
+    pub fn get(&self, name: &str) -> Option<String> {
+        self.inner
+            .secrets
+            .read()
+            .unwrap()
+            .get(name)
+            .map(|s| s.value.clone())
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.inner.secrets.read().unwrap().is_empty()
+    }
+
+    /// Run `hook` with the new value whenever `name` rotates
+    pub fn on_rotate(&self, name: &'static str, hook: impl Fn(&str) + Send + Sync + 'static) {
+        self.inner
+            .hooks
+            .lock()
+            .unwrap()
+            .push((name, Box::new(hook)));
+    }
+
+    /// Re-fetch every managed secret and fire rotation hooks for the ones
+    /// that changed. Returns the names of the rotated settings.
+    pub async fn refresh(&self) -> Result<Vec<&'static str>> {
+        let references: Vec<(&'static str, String)> = self
+            .inner
+            .secrets
+            .read()
+            .unwrap()
+            .iter()
+            .map(|(name, s)| (*name, s.reference.clone()))
+            .collect();
+
+        let mut rotated = Vec::new();
+        for (name, reference) in references {
+            let Some((provider, path)) = self.provider_for(&reference)? else {
+                continue;
+            };
+            let value = provider
+                .fetch(path)
+                .await
+                .with_context(|| format!("Failed to refresh {}", name))?;
+
+            let mut secrets = self.inner.secrets.write().unwrap();
+            let Some(secret) = secrets.get_mut(name) else {
+                continue;
+            };
+            if secret.value != value {
+                secret.value = value.clone();
+                rotated.push((name, value));
+            }
+        }
+
+        let hooks = self.inner.hooks.lock().unwrap();
+        for (name, value) in &rotated {
+            for (_, hook) in hooks.iter().filter(|(hook_name, _)| hook_name == name) {
+                hook(value);
+            }
+        }
+
+        Ok(rotated.into_iter().map(|(name, _)| name).collect())
+    }
+
+    fn provider_for<'a>(&self, value: &'a str) -> Result<Option<(&dyn SecretProvider, &'a str)>> {
+        let Some((scheme, path)) = value.split_once("://") else {
+            return Ok(None);
+        };
+        if !["gcp-sm", "vault"].contains(&scheme) {
+            return Ok(None);
+        }
+
+        match self.inner.providers.iter().find(|p| p.scheme() == scheme) {
+            Some(provider) => Ok(Some((provider.as_ref(), path))),
+            None => bail!("{}:// secrets need VAULT_ADDR and VAULT_TOKEN", scheme),
+        }
+    }
+}
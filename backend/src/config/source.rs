@@ -0,0 +1,277 @@
+use anyhow::{bail, Context, Result};
+use serde_yaml::Value;
+use std::collections::HashMap;
+use std::env::{self, VarError};
+
+/// Every setting, by environment variable and its path in the config file
+const BINDINGS: &[(&str, &str)] = &[
+    ("ENVIRONMENT", "server.environment"),
+    ("SERVER_PORT", "server.port"),
+    ("METRICS_TOKEN", "server.metrics_token"),
+    ("TIME_WARP_ENABLED", "server.time_warp"),
+    ("DB_HOST", "database.host"),
+    ("DB_PORT", "database.port"),
+    ("DB_USER", "database.user"),
+    ("DB_PASSWORD", "database.password"),
+    ("DB_NAME", "database.name"),
+    ("DB_MAX_CONNECTIONS", "database.max_connections"),
+    ("DB_SLOW_QUERY_MS", "database.slow_query_ms"),
+    ("DB_REPLICA_HOSTS", "database.replica_hosts"),
+    ("DB_REPLICA_MAX_LAG_MS", "database.replica_max_lag_ms"),
+    ("DB_SHARD_MAX_CONNECTIONS", "database.shard_max_connections"),
+    ("DB_MIGRATIONS_DIR", "database.migrations_dir"),
+    ("DB_MIGRATE_SHARDS_ON_START", "database.migrate_shards_on_start"),
+    ("REDIS_MODE", "redis.mode"),
+    ("REDIS_URL", "redis.url"),
+    ("REDIS_SENTINELS", "redis.sentinels"),
+    ("REDIS_SENTINEL_MASTER", "redis.sentinel_master"),
+    ("REDIS_PASSWORD", "redis.password"),
+    ("REDIS_CLUSTER_NODES", "redis.cluster_nodes"),
+    ("JWT_SECRET", "jwt.secret"),
+    ("JWT_EXPIRATION_HOURS", "jwt.expiration_hours"),
+    ("AUTH_PROVIDER", "firebase.auth_provider"),
+    ("FIREBASE_PROJECT_ID", "firebase.project_id"),
+    ("SEARCH_LANGUAGE", "search.language"),
+    ("ARCHIVE_STORAGE_URL", "archive.storage_url"),
+    ("ARCHIVE_STORAGE_TOKEN", "archive.storage_token"),
+    ("SYNC_EVENT_RETENTION_HOURS", "sync.event_retention_hours"),
+    ("SYNC_WS_RESUME_SECS", "sync.ws_resume_window_secs"),
+    ("SYNC_WS_REPLAY_LIMIT", "sync.ws_replay_limit"),
+    ("TICK_SHARD_COUNT", "tick.shard_count"),
+    ("TICK_MAX_CATCHUP", "tick.max_catchup"),
+    ("STARTUP_TIMEOUT_SECS", "startup.timeout_secs"),
+    ("STARTUP_INITIAL_BACKOFF_MS", "startup.initial_backoff_ms"),
+    ("STARTUP_MAX_BACKOFF_MS", "startup.max_backoff_ms"),
+    ("SENTRY_DSN", "sentry.dsn"),
+    ("SENTRY_SAMPLE_RATE", "sentry.sample_rate"),
+    ("SENTRY_TRACES_SAMPLE_RATE", "sentry.traces_sample_rate"),
+    ("OTEL_EXPORTER_OTLP_ENDPOINT", "telemetry.otlp_endpoint"),
+    ("OTEL_SERVICE_NAME", "telemetry.service_name"),
+    ("OTEL_TRACES_SAMPLE_RATIO", "telemetry.sample_ratio"),
+    ("AUDIT_LOG_ENABLED", "audit.enabled"),
+    ("AUDIT_LOG_MAX_PAYLOAD_BYTES", "audit.max_payload_bytes"),
+    ("AUDIT_LOG_RETENTION_DAYS", "audit.retention_days"),
+    ("CORS_ALLOWED_ORIGINS", "security.allowed_origins"),
+    ("CORS_MAX_AGE_SECS", "security.cors_max_age_secs"),
+    ("HSTS_MAX_AGE_SECS", "security.hsts_max_age_secs"),
+    ("GAMEDATA_DIR", "gamedata.dir"),
+    ("GAMEDATA_HOT_RELOAD", "gamedata.hot_reload"),
+    ("STRIPE_SECRET_KEY", "stripe.secret_key"),
+    ("STRIPE_WEBHOOK_SECRET", "stripe.webhook_secret"),
+    ("EMAIL_API_URL", "email.api_url"),
+    ("EMAIL_API_KEY", "email.api_key"),
+    ("EMAIL_FROM", "email.from"),
+    ("EMAIL_APP_URL", "email.app_url"),
+    ("DISCORD_DIGEST_WEBHOOK_URL", "discord.digest_webhook_url"),
+    ("CAPTCHA_PROVIDER", "captcha.provider"),
+    ("CAPTCHA_SECRET_KEY", "captcha.secret_key"),
+    ("CAPTCHA_BYPASS_KEYS", "captcha.bypass_keys"),
+    ("CAPTCHA_REGISTRATIONS_PER_IP_HOUR", "captcha.registrations_per_ip_hour"),
+    ("CAPTCHA_SENDS_PER_10_MIN", "captcha.sends_per_10_min"),
+    ("IP_INTEL_API_URL", "ip_intel.api_url"),
+    ("IP_INTEL_API_KEY", "ip_intel.api_key"),
+    ("GCP_ACCESS_TOKEN", "secrets.gcp_access_token"),
+    ("VAULT_ADDR", "secrets.vault_addr"),
+    ("VAULT_TOKEN", "secrets.vault_token"),
+    ("SECRETS_REFRESH_SECS", "secrets.refresh_secs"),
+    ("TLS_CERT_PATH", "tls.cert_path"),
+    ("TLS_KEY_PATH", "tls.key_path"),
+    ("TLS_HTTPS_PORT", "tls.https_port"),
+    ("TLS_REDIRECT_HTTP", "tls.redirect_http"),
+    ("ACME_DOMAINS", "tls.acme_domains"),
+    ("ACME_EMAIL", "tls.acme_email"),
+    ("ACME_CACHE_DIR", "tls.acme_cache_dir"),
+    ("ACME_PRODUCTION", "tls.acme_production"),
+    ("REQUEST_TIMEOUT_SECS", "limits.api.timeout_secs"),
+    ("MAX_BODY_BYTES", "limits.api.max_body_bytes"),
+    ("ADMIN_REQUEST_TIMEOUT_SECS", "limits.admin.timeout_secs"),
+    ("ADMIN_MAX_BODY_BYTES", "limits.admin.max_body_bytes"),
+    ("HTTP_HEADER_READ_TIMEOUT_SECS", "limits.header_read_timeout_secs"),
+    ("HTTP_MAX_HEADER_BYTES", "limits.max_header_bytes"),
+    ("HTTP_MAX_HEADERS", "limits.max_headers"),
+];
+
+/// Looks settings up in the environment first, then in the optional YAML
+/// file named by `CONFIG_FILE`. Defaults stay with the caller, so the
+/// precedence is env > file > default.
+pub struct ConfigSource {
+    file: HashMap<String, String>,
+}
+
+impl ConfigSource {
+    pub fn load() -> Result<Self> {
+        let Some(path) = env::var("CONFIG_FILE").ok().filter(|p| !p.is_empty()) else {
+            return Ok(Self {
+                file: HashMap::new(),
+            });
+        };
+
+        let content = std::fs::read_to_string(&path)
+            .with_context(|| format!("Failed to read config file {}", path))?;
+        Self::from_yaml(&content).with_context(|| format!("Invalid config file {}", path))
+    }
+
+    fn from_yaml(content: &str) -> Result<Self> {
+        let root: Value = serde_yaml::from_str(content)?;
+        let mut file = HashMap::new();
+        flatten(&root, String::new(), &mut file)?;
+
+        let mut unknown: Vec<&str> = file
+            .keys()
+            .filter(|key| !BINDINGS.iter().any(|(_, path)| path == key))
+            .map(String::as_str)
+            .collect();
+        if !unknown.is_empty() {
+            unknown.sort();
+            bail!("Unknown keys: {}", unknown.join(", "));
+        }
+
+        Ok(Self { file })
+    }
+
+    /// Same contract as `env::var`, falling back to the config file
+    pub fn var(&self, name: &str) -> Result<String, VarError> {
+        match env::var(name) {
+            Err(VarError::NotPresent) => {}
+            other => return other,
+        }
+
+        BINDINGS
+            .iter()
+            .find(|(env_name, _)| *env_name == name)
+            .and_then(|(_, path)| self.file.get(*path))
+            .cloned()
+            .ok_or(VarError::NotPresent)
+    }
+}
+
+/// Turn nested mappings into dotted paths; lists become comma separated
+/// like their env var form
+fn flatten(value: &Value, path: String, out: &mut HashMap<String, String>) -> Result<()> {
+    match value {
+        Value::Null => {}
+        Value::Mapping(map) => {
+            for (key, value) in map {
+                let key = key.as_str().context("Config keys must be strings")?;
+                let child = if path.is_empty() {
+                    key.to_string()
+                } else {
+                    format!("{}.{}", path, key)
+                };
+                flatten(value, child, out)?;
+            }
+        }
+        Value::Sequence(items) => {
+            let values = items
+                .iter()
+                .map(scalar)
+                .collect::<Option<Vec<_>>>()
+                .with_context(|| format!("{} must be a list of plain values", path))?;
+            out.insert(path, values.join(","));
+        }
+        other => {
+            let value = scalar(other).with_context(|| format!("{} must be a plain value", path))?;
+            out.insert(path, value);
+        }
+    }
+
+    Ok(())
+}
+
+fn scalar(value: &Value) -> Option<String> {
+    match value {
+        Value::String(s) => Some(s.clone()),
+        Value::Number(n) => Some(n.to_string()),
+        Value::Bool(b) => Some(b.to_string()),
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::Mutex;
+
+    /// The environment is shared by every test in the process
+    static ENV: Mutex<()> = Mutex::new(());
+
+    const FILE: &str = "
+database:
+  slow_query_ms: 400
+redis:
+  sentinels:
+    - redis://a:26379
+    - redis://b:26379
+";
+
+    #[test]
+    fn env_beats_file() {
+        let _env = ENV.lock().unwrap();
+        env::set_var("DB_SLOW_QUERY_MS", "900");
+        let source = ConfigSource::from_yaml(FILE).unwrap();
+
+        let value = source.var("DB_SLOW_QUERY_MS");
+
+        env::remove_var("DB_SLOW_QUERY_MS");
+        assert_eq!(value.unwrap(), "900");
+    }
+
+    #[test]
+    fn an_empty_env_var_still_beats_file() {
+        let _env = ENV.lock().unwrap();
+        env::set_var("DB_SLOW_QUERY_MS", "");
+        let source = ConfigSource::from_yaml(FILE).unwrap();
+
+        let value = source.var("DB_SLOW_QUERY_MS");
+
+        env::remove_var("DB_SLOW_QUERY_MS");
+        assert_eq!(value.unwrap(), "");
+    }
+
+    #[test]
+    fn file_beats_default() {
+        let _env = ENV.lock().unwrap();
+        env::remove_var("DB_SLOW_QUERY_MS");
+        let source = ConfigSource::from_yaml(FILE).unwrap();
+
+        let value = source
+            .var("DB_SLOW_QUERY_MS")
+            .unwrap_or_else(|_| "250".to_string());
+
+        assert_eq!(value, "400");
+    }
+
+    #[test]
+    fn default_applies_when_neither_sets_it() {
+        let _env = ENV.lock().unwrap();
+        env::remove_var("DB_SLOW_QUERY_MS");
+        let source = ConfigSource::from_yaml("database:\n  host: db\n").unwrap();
+
+        assert_eq!(source.var("DB_SLOW_QUERY_MS"), Err(VarError::NotPresent));
+        let value = source
+            .var("DB_SLOW_QUERY_MS")
+            .unwrap_or_else(|_| "250".to_string());
+        assert_eq!(value, "250");
+    }
+
+    #[test]
+    fn file_lists_read_like_their_env_form() {
+        let _env = ENV.lock().unwrap();
+        env::remove_var("REDIS_SENTINELS");
+        let source = ConfigSource::from_yaml(FILE).unwrap();
+
+        assert_eq!(
+            source.var("REDIS_SENTINELS").unwrap(),
+            "redis://a:26379,redis://b:26379"
+        );
+    }
+
+    #[test]
+    fn unknown_file_keys_are_rejected() {
+        let error = ConfigSource::from_yaml("database:\n  hots: db\n")
+            .err()
+            .expect("a misspelt key is an error");
+
+        assert!(error.to_string().contains("database.hots"));
+    }
+}
@@ -0,0 +1,119 @@
+//! Consistency rules across tables, as queries returning one row per
+//! violation. Kept free of other crate modules so the backup-verify tool can
+//! check a restored database with the same rules.
+
+/// A rule the game state must hold. `sql` selects the offending rows as a
+/// single text column (`subject`), empty when the rule holds. `fix`, where
+/// there is a safe one, repairs every offending row.
+#[derive(Debug, Clone, Copy)]
+pub struct Invariant {
+    pub name: &'static str,
+    pub description: &'static str,
+    pub sql: &'static str,
+    pub fix: Option<&'static str>,
+}
+
+pub const INVARIANTS: &[Invariant] = &[
+    Invariant {
+        name: "negative_resources",
+        description: "Villages holding a negative amount of a resource",
+        sql: r#"
+            SELECT id::text AS subject FROM villages
+            WHERE wood < 0 OR clay < 0 OR iron < 0 OR crop < 0
+        "#,
+        fix: Some(
+            r#"
+            UPDATE villages
+            SET wood = GREATEST(wood, 0), clay = GREATEST(clay, 0),
+                iron = GREATEST(iron, 0), crop = GREATEST(crop, 0)
+            WHERE wood < 0 OR clay < 0 OR iron < 0 OR crop < 0
+            "#,
+        ),
+    },
+    Invariant {
+        name: "negative_troops",
+        description: "Troop rows with a negative count, or more at home than exist",
+        sql: r#"
+            SELECT id::text AS subject FROM troops
+            WHERE count < 0 OR in_village < 0 OR in_village > count
+        "#,
+        fix: Some(
+            r#"
+            UPDATE troops
+            SET count = GREATEST(count, 0),
+                in_village = LEAST(GREATEST(in_village, 0), GREATEST(count, 0))
+            WHERE count < 0 OR in_village < 0 OR in_village > count
+            "#,
+        ),
+    },
+    Invariant {
+        name: "movement_missing_village",
+        description: "Armies leaving from or heading to a village that no longer exists",
+        sql: r#"
+            SELECT a.id::text AS subject FROM armies a
+            WHERE NOT EXISTS (SELECT 1 FROM villages v WHERE v.id = a.from_village_id)
+               OR (a.to_village_id IS NOT NULL
+                   AND NOT EXISTS (SELECT 1 FROM villages v WHERE v.id = a.to_village_id))
+        "#,
+        fix: None,
+    },
+    Invariant {
+        name: "stationed_missing_owner",
+        description: "Stationed troops whose owner no longer exists",
+        sql: r#"
+            SELECT a.id::text AS subject FROM armies a
+            WHERE a.is_stationed = TRUE
+              AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = a.player_id)
+        "#,
+        fix: None,
+    },
+    Invariant {
+        name: "shipment_missing_village",
+        description: "Undelivered shipments between villages that no longer exist",
+        sql: r#"
+            SELECT s.id::text AS subject FROM resource_shipments s
+            WHERE NOT s.delivered
+              AND (NOT EXISTS (SELECT 1 FROM villages v WHERE v.id = s.from_village_id)
+                   OR NOT EXISTS (SELECT 1 FROM villages v WHERE v.id = s.to_village_id))
+        "#,
+        fix: None,
+    },
+    Invariant {
+        name: "ledger_negative_amount",
+        description: "Economy ledger entries moving a negative amount",
+        sql: r#"
+            SELECT id::text AS subject FROM economy_ledger
+            WHERE wood < 0 OR clay < 0 OR iron < 0 OR crop < 0
+        "#,
+        fix: None,
+    },
+    Invariant {
+        name: "ledger_shipment_mismatch",
+        description: "Shipment ledger entries that disagree with the shipment they record",
+        sql: r#"
+            SELECT l.id::text AS subject FROM economy_ledger l
+            JOIN resource_shipments s ON s.id = l.source_id
+            WHERE l.kind = 'shipment'
+              AND (l.wood, l.clay, l.iron, l.crop) <> (s.wood, s.clay, s.iron, s.crop)
+        "#,
+        fix: None,
+    },
+    Invariant {
+        name: "negative_balance",
+        description: "Players with a negative gold or silver balance",
+        sql: r#"
+            SELECT id::text AS subject FROM users
+            WHERE gold_balance < 0 OR silver_balance < 0
+        "#,
+        fix: None,
+    },
+];
+
+/// Count of violations and a few of the offending rows
+pub fn count_sql(invariant: &Invariant, sample: usize) -> String {
+    format!(
+        "SELECT COUNT(*), COALESCE((array_agg(subject))[1:{sample}], '{{}}') \
+         FROM ({sql}) violations",
+        sql = invariant.sql
+    )
+}
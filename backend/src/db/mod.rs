@@ -1,2 +1,7 @@
+pub mod invariants;
 pub mod postgres;
+pub mod query_metrics;
 pub mod redis;
+pub mod replica;
+pub mod retry;
+pub mod shard;
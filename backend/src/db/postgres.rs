@@ -1,14 +1,22 @@
 use anyhow::Result;
-use sqlx::postgres::PgPoolOptions;
-use sqlx::PgPool;
+use log::LevelFilter;
+use sqlx::postgres::{PgConnectOptions, PgPoolOptions};
+use sqlx::{ConnectOptions, PgPool};
+use std::time::Duration;
 use tracing::info;
 
 use crate::config::DatabaseConfig;
+use crate::db::query_metrics;
 
 pub async fn create_pool(config: &DatabaseConfig) -> Result<PgPool> {
+    // Every statement emits a debug event on `sqlx::query`; QueryMetricsLayer
+    // turns them into histograms and slow-query warnings
+    query_metrics::set_slow_query_threshold_ms(config.slow_query_ms);
+    let options = connect_options(config, &config.host, config.port);
+
     let pool = PgPoolOptions::new()
         .max_connections(config.max_connections)
-        .connect(&config.connection_string())
+        .connect_with(options)
         .await?;
 
     // Test connection
@@ -20,3 +28,40 @@ pub async fn create_pool(config: &DatabaseConfig) -> Result<PgPool> {
 
     Ok(pool)
 }
+
+/// Pool for a read replica (`host` or `host:port`). Connects lazily so a
+/// replica that is down doesn't hold up startup; reads fall back to the
+/// primary until it answers.
+pub fn create_replica_pool(config: &DatabaseConfig, host: &str) -> Result<PgPool> {
+    let (host, port) = match host.rsplit_once(':') {
+        Some((host, port)) => (host, port.parse()?),
+        None => (host, config.port),
+    };
+
+    let pool = PgPoolOptions::new()
+        .max_connections(config.max_connections)
+        .acquire_timeout(Duration::from_secs(5))
+        .connect_lazy_with(connect_options(config, host, port));
+
+    Ok(pool)
+}
+
+/// Built field by field so a password fetched from a secret manager needs no
+/// URL escaping
+pub fn connect_options(config: &DatabaseConfig, host: &str, port: u16) -> PgConnectOptions {
+    PgConnectOptions::new()
+        .host(host)
+        .port(port)
+        .username(&config.user)
+        .password(&config.password)
+        .database(&config.database)
+        .log_statements(LevelFilter::Debug)
+        .log_slow_statements(LevelFilter::Debug, Duration::from_millis(config.slow_query_ms))
+}
+
+/// Use a rotated password for new connections; open ones keep working
+pub fn set_password(pool: &PgPool, password: &str) {
+    let options = (*pool.connect_options()).clone().password(password);
+    pool.set_connect_options(options);
+    info!("PostgreSQL password rotated");
+}
@@ -0,0 +1,262 @@
+use std::collections::HashMap;
+use std::fmt::Write;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::{LazyLock, Mutex};
+use std::time::Duration;
+use tracing::field::{Field, Visit};
+use tracing::{warn, Event, Subscriber};
+use tracing_subscriber::layer::{Context, Layer};
+use tracing_subscriber::registry::LookupSpan;
+
+use crate::telemetry::{self, QuerySpan};
+
+/// Statements slower than this are logged; set from DB_SLOW_QUERY_MS
+static SLOW_QUERY_THRESHOLD_MS: AtomicU64 = AtomicU64::new(250);
+
+/// Histogram bucket upper bounds, in seconds
+const BUCKETS: &[f64] = &[
+    0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0,
+];
+
+/// Cap on distinct query labels; further queries are counted as "other"
+const MAX_QUERY_LABELS: usize = 500;
+
+static HISTOGRAMS: LazyLock<Mutex<HashMap<String, Histogram>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+#[derive(Debug, Default, Clone)]
+struct Histogram {
+    counts: [u64; BUCKETS.len()],
+    count: u64,
+    sum: f64,
+}
+
+impl Histogram {
+    fn observe(&mut self, secs: f64) {
+        for (i, bound) in BUCKETS.iter().enumerate() {
+            if secs <= *bound {
+                self.counts[i] += 1;
+            }
+        }
+        self.count += 1;
+        self.sum += secs;
+    }
+}
+
+pub fn set_slow_query_threshold_ms(ms: u64) {
+    SLOW_QUERY_THRESHOLD_MS.store(ms, Ordering::Relaxed);
+}
+
+/// Receives sqlx's per-statement events (target `sqlx::query`), records a
+/// duration histogram per query and logs slow statements with literals
+/// redacted. The warning is emitted inside the caller's span, so it lands
+/// in the trace of the request or job that ran the query; with trace export
+/// on, every statement is also exported as a span of its own.
+pub struct QueryMetricsLayer;
+
+impl<S> Layer<S> for QueryMetricsLayer
+where
+    S: Subscriber + for<'a> LookupSpan<'a>,
+{
+    fn on_event(&self, event: &Event<'_>, ctx: Context<'_, S>) {
+        if event.metadata().target() != "sqlx::query" {
+            return;
+        }
+
+        let mut fields = QueryFields::default();
+        event.record(&mut fields);
+        let Some(elapsed_secs) = fields.elapsed_secs else {
+            return;
+        };
+
+        let name = query_name(fields.statement.as_deref().unwrap_or(&fields.summary));
+        {
+            let mut histograms = HISTOGRAMS.lock().unwrap();
+            let key = if histograms.contains_key(&name) || histograms.len() < MAX_QUERY_LABELS {
+                name.clone()
+            } else {
+                "other".to_string()
+            };
+            histograms.entry(key).or_default().observe(elapsed_secs);
+        }
+
+        let elapsed_ms = (elapsed_secs * 1000.0) as u64;
+        let slow = elapsed_ms >= SLOW_QUERY_THRESHOLD_MS.load(Ordering::Relaxed);
+        let statement = redact_sql(fields.statement.as_deref().unwrap_or(&fields.summary));
+        if slow {
+            warn!(
+                target: "slow_query",
+                query = %name,
+                elapsed_ms,
+                rows_returned = fields.rows_returned,
+                rows_affected = fields.rows_affected,
+                statement = %statement,
+                "Slow query"
+            );
+        }
+
+        telemetry::record_query(
+            &ctx,
+            QuerySpan {
+                name: &name,
+                statement: &statement,
+                elapsed: Duration::from_secs_f64(elapsed_secs),
+                rows_returned: fields.rows_returned,
+                rows_affected: fields.rows_affected,
+                slow,
+            },
+        );
+    }
+}
+
+#[derive(Default)]
+struct QueryFields {
+    summary: String,
+    statement: Option<String>,
+    elapsed_secs: Option<f64>,
+    rows_returned: u64,
+    rows_affected: u64,
+}
+
+impl Visit for QueryFields {
+    fn record_f64(&mut self, field: &Field, value: f64) {
+        if field.name() == "elapsed_secs" {
+            self.elapsed_secs = Some(value);
+        }
+    }
+
+    fn record_u64(&mut self, field: &Field, value: u64) {
+        match field.name() {
+            "rows_returned" => self.rows_returned = value,
+            "rows_affected" => self.rows_affected = value,
+            _ => {}
+        }
+    }
+
+    fn record_str(&mut self, field: &Field, value: &str) {
+        match field.name() {
+            "summary" => self.summary = value.to_string(),
+            "db.statement" if !value.trim().is_empty() => {
+                self.statement = Some(value.trim().to_string())
+            }
+            _ => {}
+        }
+    }
+
+    fn record_debug(&mut self, field: &Field, value: &dyn std::fmt::Debug) {
+        if field.name() == "summary" {
+            self.summary = format!("{:?}", value).trim_matches('"').to_string();
+        }
+    }
+}
+
+/// Short stable label for a statement: the verb and the first table it
+/// touches, e.g. "SELECT villages" or "UPDATE tick_shards"
+pub fn query_name(sql: &str) -> String {
+    let words: Vec<String> = sql
+        .split_whitespace()
+        .map(|w| {
+            w.trim_matches(|c: char| c == '(' || c == ')' || c == ',')
+                .to_lowercase()
+        })
+        .collect();
+
+    let verb = match words.iter().find(|w| {
+        matches!(
+            w.as_str(),
+            "select" | "insert" | "update" | "delete" | "with" | "create" | "drop" | "alter"
+        )
+    }) {
+        Some(v) => v.to_uppercase(),
+        None => return words.first().map(|w| w.to_uppercase()).unwrap_or_default(),
+    };
+
+    let table = words
+        .windows(2)
+        .find(|w| matches!(w[0].as_str(), "from" | "into" | "update" | "table"))
+        .map(|w| w[1].clone());
+
+    match table {
+        Some(table) => format!("{} {}", verb, table),
+        None => verb,
+    }
+}
+
+/// Replace string and numeric literals with `?`. Bound parameters never
+/// appear in the SQL text, but some statements inline values with format!.
+pub fn redact_sql(sql: &str) -> String {
+    let mut out = String::with_capacity(sql.len());
+    let mut chars = sql.chars().peekable();
+    let mut prev = ' ';
+
+    while let Some(c) = chars.next() {
+        if c == '\'' {
+            // Skip to the closing quote ('' is an escaped quote)
+            while let Some(n) = chars.next() {
+                if n == '\'' {
+                    if chars.peek() == Some(&'\'') {
+                        chars.next();
+                        continue;
+                    }
+                    break;
+                }
+            }
+            out.push('?');
+            prev = '?';
+        } else if c.is_ascii_digit() && !(prev.is_alphanumeric() || prev == '_' || prev == '$') {
+            while chars
+                .peek()
+                .is_some_and(|n| n.is_ascii_digit() || *n == '.')
+            {
+                chars.next();
+            }
+            out.push('?');
+            prev = '?';
+        } else {
+            out.push(c);
+            prev = c;
+        }
+    }
+
+    out.split_whitespace().collect::<Vec<_>>().join(" ")
+}
+
+/// Prometheus text exposition of the query duration histograms
+pub fn render_prometheus() -> String {
+    let histograms = HISTOGRAMS.lock().unwrap().clone();
+    let mut names: Vec<&String> = histograms.keys().collect();
+    names.sort();
+
+    let mut out = String::new();
+    out.push_str("# HELP db_query_duration_seconds Duration of database statements by query.\n");
+    out.push_str("# TYPE db_query_duration_seconds histogram\n");
+
+    for name in names {
+        let h = &histograms[name];
+        let label = name.replace('\\', "\\\\").replace('"', "\\\"");
+        for (bound, count) in BUCKETS.iter().zip(h.counts.iter()) {
+            let _ = writeln!(
+                out,
+                "db_query_duration_seconds_bucket{{query=\"{}\",le=\"{}\"}} {}",
+                label, bound, count
+            );
+        }
+        let _ = writeln!(
+            out,
+            "db_query_duration_seconds_bucket{{query=\"{}\",le=\"+Inf\"}} {}",
+            label, h.count
+        );
+        let _ = writeln!(
+            out,
+            "db_query_duration_seconds_sum{{query=\"{}\"}} {}",
+            label, h.sum
+        );
+        let _ = writeln!(
+            out,
+            "db_query_duration_seconds_count{{query=\"{}\"}} {}",
+            label, h.count
+        );
+    }
+
+    out
+}
@@ -1,15 +1,178 @@
-use anyhow::Result;
-use redis::aio::ConnectionManager;
-use redis::Client;
-use tracing::info;
+use anyhow::{Context, Result};
+use redis::aio::{ConnectionLike, ConnectionManager, MultiplexedConnection};
+use redis::cluster::ClusterClient;
+use redis::cluster_async::ClusterConnection;
+use redis::sentinel::{SentinelClient, SentinelNodeConnectionInfo, SentinelServerType};
+use redis::{
+    Client, Cmd, ErrorKind, Pipeline, RedisConnectionInfo, RedisError, RedisFuture, Value,
+};
+use std::sync::{Arc, RwLock};
+use tokio::sync::Mutex;
+use tracing::{info, warn};
 
 use crate::config::RedisConfig;
 
-pub async fn create_pool(config: &RedisConfig) -> Result<ConnectionManager> {
-    let client = Client::open(config.url.as_str())?;
-    let manager = ConnectionManager::new(client).await?;
+/// One client interface over a single node, a Sentinel-managed master or a
+/// cluster. Cheap to clone; every variant reconnects on its own.
+#[derive(Clone)]
+pub enum RedisConnection {
+    Single(ConnectionManager),
+    Sentinel(SentinelConnection),
+    Cluster(ClusterConnection),
+}
+
+pub async fn create_pool(config: &RedisConfig) -> Result<RedisConnection> {
+    let connection = match config.mode.as_str() {
+        "sentinel" => {
+            let master = config
+                .sentinel_master
+                .clone()
+                .context("REDIS_SENTINEL_MASTER is required in sentinel mode")?;
+            let connection = SentinelConnection::connect(config, master).await?;
+            info!("Redis connected via {} sentinels", config.sentinels.len());
+            RedisConnection::Sentinel(connection)
+        }
+        "cluster" => {
+            let client = ClusterClient::new(config.cluster_nodes.clone())?;
+            let connection = client.get_async_connection().await?;
+            info!(
+                "Redis cluster connection created from {} seed nodes",
+                config.cluster_nodes.len()
+            );
+            RedisConnection::Cluster(connection)
+        }
+        _ => {
+            let client = Client::open(config.url.as_str())?;
+            let manager = ConnectionManager::new(client).await?;
+            info!("Redis connection manager created");
+            RedisConnection::Single(manager)
+        }
+    };
+
+    Ok(connection)
+}
+
+impl ConnectionLike for RedisConnection {
+    fn req_packed_command<'a>(&'a mut self, cmd: &'a Cmd) -> RedisFuture<'a, Value> {
+        match self {
+            Self::Single(conn) => conn.req_packed_command(cmd),
+            Self::Sentinel(conn) => conn.req_packed_command(cmd),
+            Self::Cluster(conn) => conn.req_packed_command(cmd),
+        }
+    }
 
-    info!("Redis connection manager created");
+    fn req_packed_commands<'a>(
+        &'a mut self,
+        cmd: &'a Pipeline,
+        offset: usize,
+        count: usize,
+    ) -> RedisFuture<'a, Vec<Value>> {
+        match self {
+            Self::Single(conn) => conn.req_packed_commands(cmd, offset, count),
+            Self::Sentinel(conn) => conn.req_packed_commands(cmd, offset, count),
+            Self::Cluster(conn) => conn.req_packed_commands(cmd, offset, count),
+        }
+    }
+
+    fn get_db(&self) -> i64 {
+        match self {
+            Self::Single(conn) => conn.get_db(),
+            Self::Sentinel(conn) => conn.get_db(),
+            Self::Cluster(conn) => conn.get_db(),
+        }
+    }
+}
+
+// ==================== Sentinel ====================
+
+/// Connection to the master a set of sentinels currently reports. When the
+/// master goes away or is demoted the failing command returns its error and
+/// the next one runs against the newly promoted master.
+#[derive(Clone)]
+pub struct SentinelConnection {
+    client: Arc<Mutex<SentinelClient>>,
+    connection: Arc<RwLock<MultiplexedConnection>>,
+}
+
+impl SentinelConnection {
+    async fn connect(config: &RedisConfig, master: String) -> Result<Self> {
+        let node_info = SentinelNodeConnectionInfo {
+            tls_mode: None,
+            redis_connection_info: Some(RedisConnectionInfo {
+                password: config.password.clone(),
+                ..Default::default()
+            }),
+        };
+        let mut client = SentinelClient::build(
+            config.sentinels.clone(),
+            master,
+            Some(node_info),
+            SentinelServerType::Master,
+        )?;
+        let connection = client.get_async_connection().await?;
+
+        Ok(Self {
+            client: Arc::new(Mutex::new(client)),
+            connection: Arc::new(RwLock::new(connection)),
+        })
+    }
+
+    fn current(&self) -> MultiplexedConnection {
+        self.connection.read().unwrap().clone()
+    }
+
+    /// Ask the sentinels for the master again and switch to it
+    async fn failover(&self, cause: &RedisError) {
+        warn!("Redis master unavailable ({}), asking sentinels", cause);
+
+        let mut client = self.client.lock().await;
+        match client.get_async_connection().await {
+            Ok(connection) => {
+                *self.connection.write().unwrap() = connection;
+                info!("Redis reconnected to the current master");
+            }
+            Err(e) => warn!("Redis sentinel lookup failed: {}", e),
+        }
+    }
+
+    fn req_packed_command<'a>(&'a mut self, cmd: &'a Cmd) -> RedisFuture<'a, Value> {
+        Box::pin(async move {
+            let result = self.current().req_packed_command(cmd).await;
+            if let Err(e) = &result {
+                if needs_failover(e) {
+                    self.failover(e).await;
+                }
+            }
+            result
+        })
+    }
+
+    fn req_packed_commands<'a>(
+        &'a mut self,
+        cmd: &'a Pipeline,
+        offset: usize,
+        count: usize,
+    ) -> RedisFuture<'a, Vec<Value>> {
+        Box::pin(async move {
+            let result = self.current().req_packed_commands(cmd, offset, count).await;
+            if let Err(e) = &result {
+                if needs_failover(e) {
+                    self.failover(e).await;
+                }
+            }
+            result
+        })
+    }
+
+    fn get_db(&self) -> i64 {
+        self.current().get_db()
+    }
+}
 
-    Ok(manager)
+/// Errors meaning we are no longer talking to a writable master
+fn needs_failover(e: &RedisError) -> bool {
+    e.is_io_error()
+        || e.is_connection_dropped()
+        || e.is_connection_refusal()
+        || e.kind() == ErrorKind::ReadOnly
 }
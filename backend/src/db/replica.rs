@@ -0,0 +1,113 @@
+use sqlx::PgPool;
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use std::sync::Arc;
+use tracing::{info, warn};
+
+/// Lag recorded for a replica that couldn't be reached
+const UNREACHABLE: u64 = u64::MAX;
+
+struct Replica {
+    host: String,
+    pool: PgPool,
+    /// Replication lag from the last check, in milliseconds
+    lag_ms: AtomicU64,
+}
+
+struct Inner {
+    primary: PgPool,
+    replicas: Vec<Replica>,
+    max_lag_ms: u64,
+    next: AtomicUsize,
+}
+
+/// Routes reads that tolerate slightly stale data (map, rankings, search,
+/// report lists) to read replicas. Anything that feeds a write must keep
+/// using the primary.
+#[derive(Clone)]
+pub struct ReadPool {
+    inner: Arc<Inner>,
+}
+
+impl ReadPool {
+    pub fn new(primary: PgPool, replicas: Vec<(String, PgPool)>, max_lag_ms: u64) -> Self {
+        Self {
+            inner: Arc::new(Inner {
+                primary,
+                replicas: replicas
+                    .into_iter()
+                    .map(|(host, pool)| Replica {
+                        host,
+                        pool,
+                        // Unused until the first lag check finds it healthy
+                        lag_ms: AtomicU64::new(UNREACHABLE),
+                    })
+                    .collect(),
+                max_lag_ms,
+                next: AtomicUsize::new(0),
+            }),
+        }
+    }
+
+    /// A replica within the allowed lag, round robin, or the primary when
+    /// none is
+    pub fn reader(&self) -> &PgPool {
+        let inner = &*self.inner;
+        let count = inner.replicas.len();
+        if count == 0 {
+            return &inner.primary;
+        }
+
+        let start = inner.next.fetch_add(1, Ordering::Relaxed);
+        (0..count)
+            .map(|i| &inner.replicas[(start + i) % count])
+            .find(|r| r.lag_ms.load(Ordering::Relaxed) <= inner.max_lag_ms)
+            .map_or(&inner.primary, |r| &r.pool)
+    }
+
+    pub fn has_replicas(&self) -> bool {
+        !self.inner.replicas.is_empty()
+    }
+
+    /// Every replica pool, e.g. to apply a rotated password
+    pub fn replica_pools(&self) -> impl Iterator<Item = &PgPool> {
+        self.inner.replicas.iter().map(|r| &r.pool)
+    }
+
+    /// Measure each replica's lag. A replica that has replayed everything it
+    /// received counts as current even if the primary has been idle.
+    pub async fn check_lag(&self) {
+        for replica in &self.inner.replicas {
+            let lag: Result<Option<f64>, sqlx::Error> = sqlx::query_scalar(
+                r#"
+                SELECT CASE
+                    WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+                    ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) * 1000
+                END::float8
+                "#,
+            )
+            .fetch_one(&replica.pool)
+            .await;
+
+            let lag_ms = match lag {
+                Ok(Some(ms)) => ms.max(0.0) as u64,
+                // Not in recovery: pointed at a primary, nothing to lag behind
+                Ok(None) => 0,
+                Err(e) => {
+                    warn!("Read replica {} unreachable: {}", replica.host, e);
+                    UNREACHABLE
+                }
+            };
+
+            let previous = replica.lag_ms.swap(lag_ms, Ordering::Relaxed);
+            let max = self.inner.max_lag_ms;
+            if previous <= max && lag_ms > max && lag_ms != UNREACHABLE {
+                warn!(
+                    "Read replica {} is {}ms behind, reading from primary",
+                    replica.host, lag_ms
+                );
+            } else if previous > max && lag_ms <= max {
+                info!("Read replica {} back in rotation", replica.host);
+            }
+        }
+    }
+}
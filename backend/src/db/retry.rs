@@ -0,0 +1,67 @@
+use anyhow::{anyhow, Result};
+use std::future::Future;
+use std::time::Duration;
+use tokio::time::{sleep, Instant};
+use tracing::{info, warn};
+
+use crate::config::StartupConfig;
+
+/// Keep calling `connect` with exponential backoff until it succeeds or the
+/// startup timeout passes. Lets the server come up before its dependencies
+/// in docker-compose/k8s instead of crash-looping.
+pub async fn with_retry<T, F, Fut>(
+    dependency: &str,
+    config: &StartupConfig,
+    mut connect: F,
+) -> Result<T>
+where
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T>>,
+{
+    let started = Instant::now();
+    let deadline = started + Duration::from_secs(config.timeout_secs);
+    let max_backoff = Duration::from_millis(config.max_backoff_ms);
+    let mut backoff = Duration::from_millis(config.initial_backoff_ms);
+    let mut attempt = 1;
+
+    loop {
+        match connect().await {
+            Ok(value) => {
+                if attempt > 1 {
+                    info!(
+                        "{} is ready after {} attempts ({:.1}s)",
+                        dependency,
+                        attempt,
+                        started.elapsed().as_secs_f64()
+                    );
+                }
+                return Ok(value);
+            }
+            Err(e) => {
+                let now = Instant::now();
+                if now >= deadline {
+                    return Err(anyhow!(
+                        "{} still unavailable after {}s ({} attempts): {:#}",
+                        dependency,
+                        config.timeout_secs,
+                        attempt,
+                        e
+                    ));
+                }
+
+                let wait = backoff.min(deadline - now);
+                warn!(
+                    "Waiting for {} (attempt {}, retrying in {}ms): {:#}",
+                    dependency,
+                    attempt,
+                    wait.as_millis(),
+                    e
+                );
+
+                sleep(wait).await;
+                backoff = (backoff * 2).min(max_backoff);
+                attempt += 1;
+            }
+        }
+    }
+}
@@ -0,0 +1,222 @@
+use anyhow::{bail, Context, Result};
+use sqlx::migrate::Migrator;
+use sqlx::postgres::PgPoolOptions;
+use sqlx::PgPool;
+use std::collections::HashMap;
+use std::path::Path;
+use std::sync::{Arc, RwLock};
+use tracing::info;
+
+use crate::config::DatabaseConfig;
+use crate::db::postgres;
+use crate::models::world_shard::WorldShard;
+
+/// Connection target of a shard; worlds sharing one share a pool
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+struct ShardKey {
+    host: String,
+    port: u16,
+    database: String,
+    schema: Option<String>,
+}
+
+struct Inner {
+    primary: PgPool,
+    config: DatabaseConfig,
+    /// Current password, for pools opened after a rotation
+    password: RwLock<String>,
+    /// world_shards as of the last refresh
+    directory: RwLock<HashMap<String, WorldShard>>,
+    /// One pool per shard, opened on first use
+    pools: RwLock<HashMap<ShardKey, PgPool>>,
+}
+
+/// Maps world ids to the database (and schema) holding the world. The
+/// directory lives in `world_shards` on the primary; worlds not listed
+/// there stay on the primary.
+///
+/// Only world-scoped reads resolve through here so far: the hall of fame
+/// (final standings) and the ops metrics. Gameplay handlers, repositories
+/// and background jobs all use the primary pool in `AppState::db`, and no
+/// gameplay table carries a world id, so every world that is actually
+/// played runs on the primary and shares its connections. Moving play onto
+/// a shard would need requests to name their world, the per-world jobs to
+/// run against each shard, and account state kept on the primary (gold,
+/// purchases, sessions) to stay out of the world's transactions.
+#[derive(Clone)]
+pub struct ShardResolver {
+    inner: Arc<Inner>,
+}
+
+impl ShardResolver {
+    pub fn new(primary: PgPool, config: DatabaseConfig) -> Self {
+        Self {
+            inner: Arc::new(Inner {
+                primary,
+                password: RwLock::new(config.password.clone()),
+                config,
+                directory: RwLock::new(HashMap::new()),
+                pools: RwLock::new(HashMap::new()),
+            }),
+        }
+    }
+
+    /// Replace the directory with the current world_shards rows. Returns
+    /// whether it changed.
+    pub fn set_directory(&self, shards: Vec<WorldShard>) -> bool {
+        let directory: HashMap<String, WorldShard> = shards
+            .into_iter()
+            .map(|shard| (shard.world_id.clone(), shard))
+            .collect();
+
+        let mut current = self.inner.directory.write().unwrap();
+        if *current == directory {
+            return false;
+        }
+        *current = directory;
+        true
+    }
+
+    /// Pool for a world's data: its shard's, or the primary for worlds not
+    /// in the directory
+    pub fn pool_for(&self, world_id: &str) -> Result<PgPool> {
+        let Some(shard) = self.inner.directory.read().unwrap().get(world_id).cloned() else {
+            return Ok(self.inner.primary.clone());
+        };
+        let key = self.key(&shard)?;
+
+        if let Some(pool) = self.inner.pools.read().unwrap().get(&key) {
+            return Ok(pool.clone());
+        }
+
+        let mut pools = self.inner.pools.write().unwrap();
+        let pool = pools.entry(key.clone()).or_insert_with(|| {
+            let mut options = postgres::connect_options(&self.inner.config, &key.host, key.port)
+                .password(&self.inner.password.read().unwrap())
+                .database(&key.database);
+            if let Some(schema) = &key.schema {
+                options = options.options([("search_path", schema.as_str())]);
+            }
+            info!(
+                "Opening shard pool {}:{}/{} for world {}",
+                key.host, key.port, key.database, world_id
+            );
+
+            PgPoolOptions::new()
+                .max_connections(self.inner.config.shard_max_connections)
+                .connect_lazy_with(options)
+        });
+
+        Ok(pool.clone())
+    }
+
+    /// Bring a world's shard up to the latest migration, creating its
+    /// schema first if it has one. Returns the number of applied migrations.
+    pub async fn migrate(&self, world_id: &str) -> Result<usize> {
+        let shard = self.inner.directory.read().unwrap().get(world_id).cloned();
+        let Some(shard) = shard else {
+            bail!(
+                "World {} is not sharded; the primary is migrated separately",
+                world_id
+            );
+        };
+        let pool = self.pool_for(world_id)?;
+
+        if let Some(schema) = &shard.schema_name {
+            // The name is validated in key(); identifiers can't be bound
+            sqlx::query(&format!("CREATE SCHEMA IF NOT EXISTS \"{}\"", schema))
+                .execute(&pool)
+                .await?;
+        }
+
+        let migrator = Migrator::new(Path::new(&self.inner.config.migrations_dir))
+            .await
+            .context("Failed to read migrations")?;
+        migrator
+            .run(&pool)
+            .await
+            .with_context(|| format!("Failed to migrate world {}", world_id))?;
+
+        let applied = self.applied_migrations(&pool).await?;
+        info!(
+            "World {} migrated ({} migrations applied)",
+            world_id, applied
+        );
+
+        Ok(applied)
+    }
+
+    /// Migrations recorded on a world's shard
+    pub async fn migration_count(&self, world_id: &str) -> Result<usize> {
+        let pool = self.pool_for(world_id)?;
+        self.applied_migrations(&pool).await
+    }
+
+    pub fn sharded_worlds(&self) -> Vec<String> {
+        let mut worlds: Vec<String> = self
+            .inner
+            .directory
+            .read()
+            .unwrap()
+            .keys()
+            .cloned()
+            .collect();
+        worlds.sort();
+        worlds
+    }
+
+    /// Use a rotated password for shard connections
+    pub fn set_password(&self, password: &str) {
+        *self.inner.password.write().unwrap() = password.to_string();
+        for pool in self.inner.pools.read().unwrap().values() {
+            postgres::set_password(pool, password);
+        }
+    }
+
+    async fn applied_migrations(&self, pool: &PgPool) -> Result<usize> {
+        let count: Option<i64> =
+            sqlx::query_scalar("SELECT COUNT(*) FROM _sqlx_migrations WHERE success")
+                .fetch_one(pool)
+                .await
+                .ok();
+
+        Ok(count.unwrap_or(0) as usize)
+    }
+
+    fn key(&self, shard: &WorldShard) -> Result<ShardKey> {
+        let config = &self.inner.config;
+        if let Some(schema) = &shard.schema_name {
+            if !is_identifier(schema) {
+                bail!(
+                    "Invalid schema name {} for world {}",
+                    schema,
+                    shard.world_id
+                );
+            }
+        }
+
+        Ok(ShardKey {
+            host: shard.host.clone().unwrap_or_else(|| config.host.clone()),
+            port: match shard.port {
+                Some(port) => u16::try_from(port)
+                    .with_context(|| format!("Invalid port for world {}", shard.world_id))?,
+                None => config.port,
+            },
+            database: shard
+                .database_name
+                .clone()
+                .unwrap_or_else(|| config.database.clone()),
+            schema: shard.schema_name.clone(),
+        })
+    }
+}
+
+/// Lowercase Postgres identifier, safe to interpolate into DDL
+pub fn is_identifier(name: &str) -> bool {
+    !name.is_empty()
+        && name.len() <= 63
+        && name.starts_with(|c: char| c.is_ascii_lowercase() || c == '_')
+        && name
+            .chars()
+            .all(|c| c.is_ascii_lowercase() || c.is_ascii_digit() || c == '_')
+}
@@ -0,0 +1,346 @@
+//! Canonical error codes returned to clients in `error.error_code`. Clients
+//! branch on these rather than on message text. Kept free of other crate
+//! modules so `errgen` can export the catalog for the frontend; run
+//! `cargo run --bin errgen` after changing it.
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum ErrorCode {
+    // Generic, one per error kind, and request limits
+    Unauthorized,
+    Forbidden,
+    NotFound,
+    BadRequest,
+    Conflict,
+    VersionConflict,
+    Validation,
+    CaptchaRequired,
+    RateLimited,
+    Timeout,
+    ServiceUnavailable,
+    Internal,
+    TooManyInFlight,
+
+    // Gameplay
+    InsufficientResources,
+    InsufficientGold,
+    InsufficientSilver,
+    QueueFull,
+    SlotOccupied,
+    MaxLevel,
+    MissingPrerequisites,
+    NoTroops,
+    OwnVillage,
+    TargetProtected,
+    HeroUnavailable,
+    NotInAlliance,
+    AlreadyInAlliance,
+    AuctionEnded,
+    WorldPaused,
+    RegistrationClosed,
+    CapitalOnly,
+    CannotDemolish,
+    CannotCancel,
+    UnsupportedMission,
+    ChiefRequired,
+    ChiefCannotLeave,
+    InsufficientTroops,
+    TargetNotVillage,
+    SameVillage,
+    NotOwnVillage,
+    NotStationed,
+    InsufficientMerchants,
+    NoHeroSlots,
+    WrongTribe,
+    InsufficientPoints,
+    NoChange,
+    LevelTooLow,
+    WrongItemType,
+    ItemEquipped,
+    AdventureUnavailable,
+    HeroNotDead,
+    ReviveNotReady,
+    TagTaken,
+    InvitationPending,
+    InvitationClosed,
+    LeaderCannotLeave,
+    SelfTarget,
+    MergeClosed,
+    AllianceFull,
+}
+
+impl ErrorCode {
+    pub const ALL: [ErrorCode; 58] = [
+        ErrorCode::Unauthorized,
+        ErrorCode::Forbidden,
+        ErrorCode::NotFound,
+        ErrorCode::BadRequest,
+        ErrorCode::Conflict,
+        ErrorCode::VersionConflict,
+        ErrorCode::Validation,
+        ErrorCode::CaptchaRequired,
+        ErrorCode::RateLimited,
+        ErrorCode::Timeout,
+        ErrorCode::ServiceUnavailable,
+        ErrorCode::Internal,
+        ErrorCode::TooManyInFlight,
+        ErrorCode::InsufficientResources,
+        ErrorCode::InsufficientGold,
+        ErrorCode::InsufficientSilver,
+        ErrorCode::QueueFull,
+        ErrorCode::SlotOccupied,
+        ErrorCode::MaxLevel,
+        ErrorCode::MissingPrerequisites,
+        ErrorCode::NoTroops,
+        ErrorCode::OwnVillage,
+        ErrorCode::TargetProtected,
+        ErrorCode::HeroUnavailable,
+        ErrorCode::NotInAlliance,
+        ErrorCode::AlreadyInAlliance,
+        ErrorCode::AuctionEnded,
+        ErrorCode::WorldPaused,
+        ErrorCode::RegistrationClosed,
+        ErrorCode::CapitalOnly,
+        ErrorCode::CannotDemolish,
+        ErrorCode::CannotCancel,
+        ErrorCode::UnsupportedMission,
+        ErrorCode::ChiefRequired,
+        ErrorCode::ChiefCannotLeave,
+        ErrorCode::InsufficientTroops,
+        ErrorCode::TargetNotVillage,
+        ErrorCode::SameVillage,
+        ErrorCode::NotOwnVillage,
+        ErrorCode::NotStationed,
+        ErrorCode::InsufficientMerchants,
+        ErrorCode::NoHeroSlots,
+        ErrorCode::WrongTribe,
+        ErrorCode::InsufficientPoints,
+        ErrorCode::NoChange,
+        ErrorCode::LevelTooLow,
+        ErrorCode::WrongItemType,
+        ErrorCode::ItemEquipped,
+        ErrorCode::AdventureUnavailable,
+        ErrorCode::HeroNotDead,
+        ErrorCode::ReviveNotReady,
+        ErrorCode::TagTaken,
+        ErrorCode::InvitationPending,
+        ErrorCode::InvitationClosed,
+        ErrorCode::LeaderCannotLeave,
+        ErrorCode::SelfTarget,
+        ErrorCode::MergeClosed,
+        ErrorCode::AllianceFull,
+    ];
+
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            ErrorCode::Unauthorized => "ERR_UNAUTHORIZED",
+            ErrorCode::Forbidden => "ERR_FORBIDDEN",
+            ErrorCode::NotFound => "ERR_NOT_FOUND",
+            ErrorCode::BadRequest => "ERR_BAD_REQUEST",
+            ErrorCode::Conflict => "ERR_CONFLICT",
+            ErrorCode::VersionConflict => "ERR_VERSION_CONFLICT",
+            ErrorCode::Validation => "ERR_VALIDATION",
+            ErrorCode::CaptchaRequired => "ERR_CAPTCHA_REQUIRED",
+            ErrorCode::RateLimited => "ERR_RATE_LIMITED",
+            ErrorCode::Timeout => "ERR_TIMEOUT",
+            ErrorCode::ServiceUnavailable => "ERR_SERVICE_UNAVAILABLE",
+            ErrorCode::Internal => "ERR_INTERNAL",
+            ErrorCode::TooManyInFlight => "ERR_TOO_MANY_IN_FLIGHT",
+            ErrorCode::InsufficientResources => "ERR_INSUFFICIENT_RESOURCES",
+            ErrorCode::InsufficientGold => "ERR_INSUFFICIENT_GOLD",
+            ErrorCode::InsufficientSilver => "ERR_INSUFFICIENT_SILVER",
+            ErrorCode::QueueFull => "ERR_QUEUE_FULL",
+            ErrorCode::SlotOccupied => "ERR_SLOT_OCCUPIED",
+            ErrorCode::MaxLevel => "ERR_MAX_LEVEL",
+            ErrorCode::MissingPrerequisites => "ERR_MISSING_PREREQUISITES",
+            ErrorCode::NoTroops => "ERR_NO_TROOPS",
+            ErrorCode::OwnVillage => "ERR_OWN_VILLAGE",
+            ErrorCode::TargetProtected => "ERR_TARGET_PROTECTED",
+            ErrorCode::HeroUnavailable => "ERR_HERO_UNAVAILABLE",
+            ErrorCode::NotInAlliance => "ERR_NOT_IN_ALLIANCE",
+            ErrorCode::AlreadyInAlliance => "ERR_ALREADY_IN_ALLIANCE",
+            ErrorCode::AuctionEnded => "ERR_AUCTION_ENDED",
+            ErrorCode::WorldPaused => "ERR_WORLD_PAUSED",
+            ErrorCode::RegistrationClosed => "ERR_REGISTRATION_CLOSED",
+            ErrorCode::CapitalOnly => "ERR_CAPITAL_ONLY",
+            ErrorCode::CannotDemolish => "ERR_CANNOT_DEMOLISH",
+            ErrorCode::CannotCancel => "ERR_CANNOT_CANCEL",
+            ErrorCode::UnsupportedMission => "ERR_UNSUPPORTED_MISSION",
+            ErrorCode::ChiefRequired => "ERR_CHIEF_REQUIRED",
+            ErrorCode::ChiefCannotLeave => "ERR_CHIEF_CANNOT_LEAVE",
+            ErrorCode::InsufficientTroops => "ERR_INSUFFICIENT_TROOPS",
+            ErrorCode::TargetNotVillage => "ERR_TARGET_NOT_VILLAGE",
+            ErrorCode::SameVillage => "ERR_SAME_VILLAGE",
+            ErrorCode::NotOwnVillage => "ERR_NOT_OWN_VILLAGE",
+            ErrorCode::NotStationed => "ERR_NOT_STATIONED",
+            ErrorCode::InsufficientMerchants => "ERR_INSUFFICIENT_MERCHANTS",
+            ErrorCode::NoHeroSlots => "ERR_NO_HERO_SLOTS",
+            ErrorCode::WrongTribe => "ERR_WRONG_TRIBE",
+            ErrorCode::InsufficientPoints => "ERR_INSUFFICIENT_POINTS",
+            ErrorCode::NoChange => "ERR_NO_CHANGE",
+            ErrorCode::LevelTooLow => "ERR_LEVEL_TOO_LOW",
+            ErrorCode::WrongItemType => "ERR_WRONG_ITEM_TYPE",
+            ErrorCode::ItemEquipped => "ERR_ITEM_EQUIPPED",
+            ErrorCode::AdventureUnavailable => "ERR_ADVENTURE_UNAVAILABLE",
+            ErrorCode::HeroNotDead => "ERR_HERO_NOT_DEAD",
+            ErrorCode::ReviveNotReady => "ERR_REVIVE_NOT_READY",
+            ErrorCode::TagTaken => "ERR_TAG_TAKEN",
+            ErrorCode::InvitationPending => "ERR_INVITATION_PENDING",
+            ErrorCode::InvitationClosed => "ERR_INVITATION_CLOSED",
+            ErrorCode::LeaderCannotLeave => "ERR_LEADER_CANNOT_LEAVE",
+            ErrorCode::SelfTarget => "ERR_SELF_TARGET",
+            ErrorCode::MergeClosed => "ERR_MERGE_CLOSED",
+            ErrorCode::AllianceFull => "ERR_ALLIANCE_FULL",
+        }
+    }
+
+    pub fn from_name(name: &str) -> Option<Self> {
+        Self::ALL.into_iter().find(|c| c.as_str() == name)
+    }
+
+    /// Whether the code names a gameplay rule rather than an error kind
+    pub fn is_gameplay(&self) -> bool {
+        !matches!(
+            self,
+            ErrorCode::Unauthorized
+                | ErrorCode::Forbidden
+                | ErrorCode::NotFound
+                | ErrorCode::BadRequest
+                | ErrorCode::Conflict
+                | ErrorCode::VersionConflict
+                | ErrorCode::Validation
+                | ErrorCode::CaptchaRequired
+                | ErrorCode::RateLimited
+                | ErrorCode::Timeout
+                | ErrorCode::ServiceUnavailable
+                | ErrorCode::Internal
+                | ErrorCode::TooManyInFlight
+        )
+    }
+
+    /// HTTP status the code is sent with
+    pub fn status(&self) -> u16 {
+        match self {
+            ErrorCode::Unauthorized => 401,
+            ErrorCode::Forbidden | ErrorCode::CaptchaRequired | ErrorCode::RegistrationClosed => {
+                403
+            }
+            ErrorCode::NotFound => 404,
+            ErrorCode::Conflict
+            | ErrorCode::VersionConflict
+            | ErrorCode::QueueFull
+            | ErrorCode::SlotOccupied
+            | ErrorCode::CannotCancel
+            | ErrorCode::AdventureUnavailable
+            | ErrorCode::TagTaken
+            | ErrorCode::InvitationPending
+            | ErrorCode::InvitationClosed
+            | ErrorCode::MergeClosed
+            | ErrorCode::AllianceFull => 409,
+            ErrorCode::Validation => 422,
+            ErrorCode::RateLimited | ErrorCode::TooManyInFlight => 429,
+            ErrorCode::Internal => 500,
+            ErrorCode::Timeout | ErrorCode::ServiceUnavailable | ErrorCode::WorldPaused => 503,
+            ErrorCode::BadRequest
+            | ErrorCode::InsufficientResources
+            | ErrorCode::InsufficientGold
+            | ErrorCode::InsufficientSilver
+            | ErrorCode::MaxLevel
+            | ErrorCode::MissingPrerequisites
+            | ErrorCode::NoTroops
+            | ErrorCode::OwnVillage
+            | ErrorCode::TargetProtected
+            | ErrorCode::HeroUnavailable
+            | ErrorCode::NotInAlliance
+            | ErrorCode::AlreadyInAlliance
+            | ErrorCode::AuctionEnded
+            | ErrorCode::CapitalOnly
+            | ErrorCode::CannotDemolish
+            | ErrorCode::UnsupportedMission
+            | ErrorCode::ChiefRequired
+            | ErrorCode::ChiefCannotLeave
+            | ErrorCode::InsufficientTroops
+            | ErrorCode::TargetNotVillage
+            | ErrorCode::SameVillage
+            | ErrorCode::NotOwnVillage
+            | ErrorCode::NotStationed
+            | ErrorCode::InsufficientMerchants
+            | ErrorCode::NoHeroSlots
+            | ErrorCode::WrongTribe
+            | ErrorCode::InsufficientPoints
+            | ErrorCode::NoChange
+            | ErrorCode::LevelTooLow
+            | ErrorCode::WrongItemType
+            | ErrorCode::ItemEquipped
+            | ErrorCode::HeroNotDead
+            | ErrorCode::ReviveNotReady
+            | ErrorCode::LeaderCannotLeave
+            | ErrorCode::SelfTarget => 400,
+        }
+    }
+
+    /// Message sent when the error doesn't carry a more specific one
+    pub fn message(&self) -> &'static str {
+        match self {
+            ErrorCode::Unauthorized => "Authentication required",
+            ErrorCode::Forbidden => "Access denied",
+            ErrorCode::NotFound => "Not found",
+            ErrorCode::BadRequest => "Bad request",
+            ErrorCode::Conflict => "Conflict",
+            ErrorCode::VersionConflict => "The data changed; reload and try again",
+            ErrorCode::Validation => "Validation error",
+            ErrorCode::CaptchaRequired => "A captcha is required",
+            ErrorCode::RateLimited => "Too many requests",
+            ErrorCode::Timeout => "The request timed out",
+            ErrorCode::ServiceUnavailable => "Service unavailable",
+            ErrorCode::Internal => "Internal server error",
+            ErrorCode::TooManyInFlight => {
+                "Too many requests at once, wait for the previous ones to finish"
+            }
+            ErrorCode::InsufficientResources => "Not enough resources",
+            ErrorCode::InsufficientGold => "Insufficient gold",
+            ErrorCode::InsufficientSilver => "Insufficient silver",
+            ErrorCode::QueueFull => "All build slots are busy",
+            ErrorCode::SlotOccupied => "Slot already occupied",
+            ErrorCode::MaxLevel => "Building is at max level",
+            ErrorCode::MissingPrerequisites => "Missing prerequisites",
+            ErrorCode::NoTroops => "Must send at least one troop",
+            ErrorCode::OwnVillage => "Cannot attack your own village",
+            ErrorCode::TargetProtected => "The target is protected",
+            ErrorCode::HeroUnavailable => "Hero is not available",
+            ErrorCode::NotInAlliance => "You are not in an alliance",
+            ErrorCode::AlreadyInAlliance => "You are already in an alliance",
+            ErrorCode::AuctionEnded => "The auction has ended",
+            ErrorCode::WorldPaused => "The world is paused for maintenance",
+            ErrorCode::RegistrationClosed => "Registration is currently closed",
+            ErrorCode::CapitalOnly => "Only possible in the capital",
+            ErrorCode::CannotDemolish => "This building cannot be demolished",
+            ErrorCode::CannotCancel => "It can no longer be cancelled",
+            ErrorCode::UnsupportedMission => "That mission is not possible here",
+            ErrorCode::ChiefRequired => "A chief unit is required",
+            ErrorCode::ChiefCannotLeave => "Chiefs can't leave the village that trained them",
+            ErrorCode::InsufficientTroops => "Not enough troops",
+            ErrorCode::TargetNotVillage => "The target is not a village",
+            ErrorCode::SameVillage => "The source and destination are the same village",
+            ErrorCode::NotOwnVillage => "Only possible with your own villages",
+            ErrorCode::NotStationed => "The troops are not stationed",
+            ErrorCode::InsufficientMerchants => "Not enough merchants",
+            ErrorCode::NoHeroSlots => "No hero slots available",
+            ErrorCode::WrongTribe => "Not possible for your tribe",
+            ErrorCode::InsufficientPoints => "Not enough points",
+            ErrorCode::NoChange => "Nothing would change",
+            ErrorCode::LevelTooLow => "Hero level too low",
+            ErrorCode::WrongItemType => "Not possible with this item",
+            ErrorCode::ItemEquipped => "The item is equipped",
+            ErrorCode::AdventureUnavailable => "The adventure is no longer available",
+            ErrorCode::HeroNotDead => "Hero is not dead",
+            ErrorCode::ReviveNotReady => "Hero cannot be revived yet",
+            ErrorCode::TagTaken => "This tag is already taken",
+            ErrorCode::InvitationPending => "An invitation is already pending",
+            ErrorCode::InvitationClosed => "The invitation is no longer open",
+            ErrorCode::LeaderCannotLeave => "The leader cannot leave the alliance",
+            ErrorCode::SelfTarget => "Not possible with yourself",
+            ErrorCode::MergeClosed => "This merge is no longer open",
+            ErrorCode::AllianceFull => "The alliance is full",
+        }
+    }
+}
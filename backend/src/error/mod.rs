@@ -6,6 +6,11 @@ use axum::{
 use serde_json::json;
 use thiserror::Error;
 
+pub mod codes;
+pub mod reporting;
+
+pub use codes::ErrorCode;
+
 #[derive(Error, Debug)]
 pub enum AppError {
     #[error("Authentication required")]
@@ -23,6 +28,27 @@ pub enum AppError {
     #[error("{0}")]
     Conflict(String),
 
+    /// The entity changed since the client (or this request) read it; safe to re-read and retry
+    #[error("{0}")]
+    VersionConflict(String),
+
+    /// A third-party dependency is down or its circuit breaker is open
+    #[error("{0}")]
+    ServiceUnavailable(String),
+
+    /// The request needs a solved captcha in `X-Captcha-Token`
+    #[error("{0}")]
+    CaptchaRequired(String),
+
+    /// The handler ran past its route group's time limit. It may still have
+    /// taken effect, so it isn't marked retryable.
+    #[error("{0}")]
+    Timeout(String),
+
+    /// The caller exceeded a rate limit; retry after a short wait
+    #[error("{0}")]
+    TooManyRequests(String),
+
     #[error("Internal server error")]
     InternalError(#[from] anyhow::Error),
 
@@ -31,29 +57,118 @@ pub enum AppError {
 
     #[error("Validation error: {0}")]
     ValidationError(String),
+
+    /// A gameplay rule refused the action; the code tells the client which
+    #[error("{1}")]
+    Game(ErrorCode, String),
+}
+
+impl From<ErrorCode> for AppError {
+    fn from(code: ErrorCode) -> Self {
+        AppError::Game(code, code.message().to_string())
+    }
+}
+
+impl AppError {
+    pub fn status_code(&self) -> StatusCode {
+        match self {
+            AppError::Unauthorized => StatusCode::UNAUTHORIZED,
+            AppError::Forbidden(_) | AppError::CaptchaRequired(_) => StatusCode::FORBIDDEN,
+            AppError::NotFound(_) => StatusCode::NOT_FOUND,
+            AppError::BadRequest(_) => StatusCode::BAD_REQUEST,
+            AppError::Conflict(_) | AppError::VersionConflict(_) => StatusCode::CONFLICT,
+            AppError::ValidationError(_) => StatusCode::UNPROCESSABLE_ENTITY,
+            AppError::ServiceUnavailable(_) | AppError::Timeout(_) => {
+                StatusCode::SERVICE_UNAVAILABLE
+            }
+            AppError::TooManyRequests(_) => StatusCode::TOO_MANY_REQUESTS,
+            AppError::InternalError(_) | AppError::DatabaseError(_) => {
+                StatusCode::INTERNAL_SERVER_ERROR
+            }
+            AppError::Game(code, _) => {
+                StatusCode::from_u16(code.status()).unwrap_or(StatusCode::BAD_REQUEST)
+            }
+        }
+    }
+
+    /// Code sent to the client; errors without a gameplay code get the
+    /// generic one for their kind
+    pub fn error_code(&self) -> ErrorCode {
+        match self {
+            AppError::Unauthorized => ErrorCode::Unauthorized,
+            AppError::Forbidden(_) => ErrorCode::Forbidden,
+            AppError::NotFound(_) => ErrorCode::NotFound,
+            AppError::BadRequest(_) => ErrorCode::BadRequest,
+            AppError::Conflict(_) => ErrorCode::Conflict,
+            AppError::VersionConflict(_) => ErrorCode::VersionConflict,
+            AppError::ServiceUnavailable(_) => ErrorCode::ServiceUnavailable,
+            AppError::CaptchaRequired(_) => ErrorCode::CaptchaRequired,
+            AppError::Timeout(_) => ErrorCode::Timeout,
+            AppError::TooManyRequests(_) => ErrorCode::RateLimited,
+            AppError::InternalError(_) | AppError::DatabaseError(_) => ErrorCode::Internal,
+            AppError::ValidationError(_) => ErrorCode::Validation,
+            AppError::Game(code, _) => *code,
+        }
+    }
+
+    /// Whether the same request may succeed if sent again unchanged
+    pub fn is_retryable(&self) -> bool {
+        matches!(
+            self,
+            AppError::VersionConflict(_)
+                | AppError::ServiceUnavailable(_)
+                | AppError::TooManyRequests(_)
+                | AppError::InternalError(_)
+                | AppError::DatabaseError(_)
+                | AppError::Game(ErrorCode::WorldPaused | ErrorCode::TooManyInFlight, _)
+        )
+    }
 }
 
 impl IntoResponse for AppError {
     fn into_response(self) -> Response {
-        let (status, message) = match &self {
-            AppError::Unauthorized => (StatusCode::UNAUTHORIZED, self.to_string()),
-            AppError::Forbidden(msg) => (StatusCode::FORBIDDEN, msg.clone()),
-            AppError::NotFound(msg) => (StatusCode::NOT_FOUND, msg.clone()),
-            AppError::BadRequest(msg) => (StatusCode::BAD_REQUEST, msg.clone()),
-            AppError::Conflict(msg) => (StatusCode::CONFLICT, msg.clone()),
-            AppError::ValidationError(msg) => (StatusCode::UNPROCESSABLE_ENTITY, msg.clone()),
+        let status = self.status_code();
+        let message = match &self {
             AppError::InternalError(_) | AppError::DatabaseError(_) => {
                 tracing::error!("Internal error: {:?}", self);
-                (StatusCode::INTERNAL_SERVER_ERROR, "Internal server error".to_string())
+                "Internal server error".to_string()
             }
+            AppError::ValidationError(msg) => msg.clone(),
+            _ => self.to_string(),
         };
 
-        let body = Json(json!({
+        let mut body = json!({
             "error": {
                 "message": message,
-                "code": status.as_u16()
+                "code": status.as_u16(),
+                "error_code": self.error_code().as_str()
             }
-        }));
+        });
+        if matches!(self, AppError::VersionConflict(_)) {
+            body["error"]["reason"] = json!("version_conflict");
+            body["error"]["retryable"] = json!(true);
+        }
+        if matches!(
+            self,
+            AppError::ServiceUnavailable(_) | AppError::Game(ErrorCode::WorldPaused, _)
+        ) {
+            body["error"]["reason"] = json!("service_unavailable");
+            body["error"]["retryable"] = json!(true);
+        }
+        if matches!(self, AppError::CaptchaRequired(_)) {
+            body["error"]["reason"] = json!("captcha_required");
+        }
+        if matches!(self, AppError::Timeout(_)) {
+            body["error"]["reason"] = json!("timeout");
+        }
+        if matches!(
+            self,
+            AppError::TooManyRequests(_) | AppError::Game(ErrorCode::TooManyInFlight, _)
+        ) {
+            body["error"]["reason"] = json!("rate_limited");
+            body["error"]["retryable"] = json!(true);
+        }
+        let body = Json(body);
 
         (status, body).into_response()
     }
@@ -0,0 +1,58 @@
+use sentry::ClientInitGuard;
+use std::borrow::Cow;
+
+use crate::config::Config;
+
+/// Start the Sentry (or GlitchTip) client when SENTRY_DSN is set. Panics are
+/// reported by the panic integration; `error!` events by the tracing layer.
+/// Keep the guard alive for the life of the process so queued events flush.
+pub fn init(config: &Config) -> Option<ClientInitGuard> {
+    let dsn = config.sentry.dsn.as_deref()?;
+
+    let guard = sentry::init((
+        dsn,
+        sentry::ClientOptions {
+            release: Some(Cow::Owned(format!(
+                "{}@{}",
+                env!("CARGO_PKG_VERSION"),
+                env!("BUILD_GIT_SHA")
+            ))),
+            environment: Some(Cow::Owned(config.server.environment.clone())),
+            sample_rate: config.sentry.sample_rate,
+            traces_sample_rate: config.sentry.traces_sample_rate,
+            attach_stacktrace: true,
+            send_default_pii: false,
+            ..Default::default()
+        },
+    ));
+
+    Some(guard)
+}
+
+/// Tag events from the current hub with the authenticated player
+pub fn set_player(firebase_uid: &str, email: Option<&str>) {
+    sentry::configure_scope(|scope| {
+        scope.set_user(Some(sentry::User {
+            id: Some(firebase_uid.to_string()),
+            email: email.map(str::to_string),
+            ..Default::default()
+        }));
+    });
+}
+
+/// Run a background job on its own hub tagged with the job name, so its
+/// errors and panics are attributed to it. Each run is a `job` span, so its
+/// duration and queries are exported as one trace.
+pub async fn run_job<F>(name: &'static str, job: F) -> F::Output
+where
+    F: std::future::Future,
+{
+    use sentry::SentryFutureExt;
+    use tracing::Instrument;
+
+    let hub = sentry::Hub::new_from_top(sentry::Hub::current());
+    hub.configure_scope(|scope| scope.set_tag("job", name));
+    job.instrument(tracing::info_span!("job", otel.name = name, job = name))
+        .bind_hub(hub)
+        .await
+}
@@ -0,0 +1,271 @@
+//! Read-only GraphQL API over public world data, for community map and
+//! statistics tools. Reads the same projections as the REST rankings and
+//! never exposes anything a player couldn't see on the map or in rankings.
+
+use std::sync::LazyLock;
+
+use async_graphql::{
+    ComplexObject, Context, EmptyMutation, EmptySubscription, Object, Result, Schema, SimpleObject,
+};
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::models::projection::{AllianceStats, PlayerStats};
+use crate::models::village::{FieldType, Village as VillageRecord, VillageMapInfo};
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::projection_repo::ProjectionRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::projection_service::ProjectionService;
+
+pub type WorldSchema = Schema<QueryRoot, EmptyMutation, EmptySubscription>;
+
+/// Upper bound on a query's cost; list fields count once per item they may return
+const MAX_COMPLEXITY: usize = 1000;
+const MAX_DEPTH: usize = 6;
+/// Largest page of players or alliances
+const MAX_PAGE: i64 = 100;
+/// Largest map query, in tiles from the center
+const MAX_MAP_RANGE: i32 = 15;
+/// Cost multiplier for nested lists (a player's villages, an alliance's members)
+const NESTED_LIST_COST: usize = 20;
+
+static SCHEMA: LazyLock<WorldSchema> = LazyLock::new(|| {
+    Schema::build(QueryRoot, EmptyMutation, EmptySubscription)
+        .limit_complexity(MAX_COMPLEXITY)
+        .limit_depth(MAX_DEPTH)
+        .finish()
+});
+
+/// The schema; requests carry the pool to read from as data
+pub fn schema() -> &'static WorldSchema {
+    &SCHEMA
+}
+
+fn pool<'a>(ctx: &Context<'a>) -> &'a PgPool {
+    ctx.data_unchecked::<PgPool>()
+}
+
+// ==================== Types ====================
+
+#[derive(SimpleObject)]
+#[graphql(complex)]
+pub struct Player {
+    pub id: Uuid,
+    pub name: Option<String>,
+    pub alliance_tag: Option<String>,
+    pub village_count: i32,
+    pub population: i32,
+    pub culture_points: i32,
+    /// Population rank; only set in the players ranking
+    pub rank: Option<i64>,
+    pub updated_at: DateTime<Utc>,
+    #[graphql(skip)]
+    pub alliance_id: Option<Uuid>,
+}
+
+impl Player {
+    fn new(stats: PlayerStats, rank: Option<i64>) -> Self {
+        Self {
+            id: stats.user_id,
+            name: stats.display_name,
+            alliance_tag: stats.alliance_tag,
+            village_count: stats.village_count,
+            population: stats.population,
+            culture_points: stats.culture_points,
+            rank,
+            updated_at: stats.updated_at,
+            alliance_id: stats.alliance_id,
+        }
+    }
+}
+
+#[ComplexObject]
+impl Player {
+    async fn alliance(&self, ctx: &Context<'_>) -> Result<Option<Alliance>> {
+        let Some(alliance_id) = self.alliance_id else {
+            return Ok(None);
+        };
+        let stats = ProjectionRepository::find_alliance_stats(pool(ctx), alliance_id).await?;
+        Ok(stats.map(|s| Alliance::new(s, None)))
+    }
+
+    #[graphql(complexity = "NESTED_LIST_COST * child_complexity")]
+    async fn villages(&self, ctx: &Context<'_>) -> Result<Vec<Village>> {
+        let villages = VillageRepository::find_by_user_id(pool(ctx), self.id).await?;
+        Ok(villages.into_iter().map(Village::from).collect())
+    }
+}
+
+#[derive(SimpleObject)]
+#[graphql(complex)]
+pub struct Alliance {
+    pub id: Uuid,
+    pub name: String,
+    pub tag: String,
+    pub member_count: i32,
+    pub village_count: i32,
+    pub population: i64,
+    /// Population rank; only set in the alliances ranking
+    pub rank: Option<i64>,
+    pub updated_at: DateTime<Utc>,
+}
+
+impl Alliance {
+    fn new(stats: AllianceStats, rank: Option<i64>) -> Self {
+        Self {
+            id: stats.alliance_id,
+            name: stats.name,
+            tag: stats.tag,
+            member_count: stats.member_count,
+            village_count: stats.village_count,
+            population: stats.total_population,
+            rank,
+            updated_at: stats.updated_at,
+        }
+    }
+}
+
+#[ComplexObject]
+impl Alliance {
+    async fn description(&self, ctx: &Context<'_>) -> Result<Option<String>> {
+        let alliance = AllianceRepository::find_by_id(pool(ctx), self.id).await?;
+        Ok(alliance.and_then(|a| a.description))
+    }
+
+    #[graphql(complexity = "NESTED_LIST_COST * child_complexity")]
+    async fn members(&self, ctx: &Context<'_>) -> Result<Vec<Player>> {
+        let members = ProjectionRepository::find_alliance_member_stats(pool(ctx), self.id).await?;
+        Ok(members.into_iter().map(|s| Player::new(s, None)).collect())
+    }
+}
+
+#[derive(SimpleObject)]
+#[graphql(complex)]
+pub struct Village {
+    pub id: Uuid,
+    pub name: String,
+    pub x: i32,
+    pub y: i32,
+    pub population: i32,
+    #[graphql(skip)]
+    pub owner_id: Uuid,
+    #[graphql(skip)]
+    pub field_type: FieldType,
+}
+
+impl From<VillageRecord> for Village {
+    fn from(v: VillageRecord) -> Self {
+        Self {
+            id: v.id,
+            name: v.name,
+            x: v.x,
+            y: v.y,
+            population: v.population,
+            owner_id: v.user_id,
+            field_type: v.field_type,
+        }
+    }
+}
+
+impl From<VillageMapInfo> for Village {
+    fn from(v: VillageMapInfo) -> Self {
+        Self {
+            id: v.id,
+            name: v.name,
+            x: v.x,
+            y: v.y,
+            population: v.population,
+            owner_id: v.user_id,
+            field_type: v.field_type,
+        }
+    }
+}
+
+/// Resource fields of a village's tile
+#[derive(SimpleObject)]
+pub struct Fields {
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+}
+
+#[ComplexObject]
+impl Village {
+    async fn fields(&self) -> Fields {
+        let (wood, clay, iron, crop) = self.field_type.counts();
+        Fields {
+            wood,
+            clay,
+            iron,
+            crop,
+        }
+    }
+
+    async fn owner(&self, ctx: &Context<'_>) -> Result<Option<Player>> {
+        let stats = ProjectionService::player_stats(pool(ctx), self.owner_id).await?;
+        Ok(stats.map(|s| Player::new(s, None)))
+    }
+}
+
+// ==================== Queries ====================
+
+pub struct QueryRoot;
+
+#[Object]
+impl QueryRoot {
+    async fn player(&self, ctx: &Context<'_>, id: Uuid) -> Result<Option<Player>> {
+        let stats = ProjectionService::player_stats(pool(ctx), id).await?;
+        Ok(stats.map(|s| Player::new(s, None)))
+    }
+
+    /// Players ranked by population
+    #[graphql(complexity = "limit.clamp(1, MAX_PAGE) as usize * child_complexity")]
+    async fn players(
+        &self,
+        ctx: &Context<'_>,
+        #[graphql(default = 50)] limit: i64,
+        #[graphql(default = 0)] offset: i64,
+    ) -> Result<Vec<Player>> {
+        let players = ProjectionService::player_rankings(pool(ctx), limit, offset).await?;
+        Ok(players
+            .into_iter()
+            .map(|p| Player::new(p.stats, Some(p.rank)))
+            .collect())
+    }
+
+    async fn alliance(&self, ctx: &Context<'_>, id: Uuid) -> Result<Option<Alliance>> {
+        let stats = ProjectionRepository::find_alliance_stats(pool(ctx), id).await?;
+        Ok(stats.map(|s| Alliance::new(s, None)))
+    }
+
+    /// Alliances ranked by total population
+    #[graphql(complexity = "limit.clamp(1, MAX_PAGE) as usize * child_complexity")]
+    async fn alliances(
+        &self,
+        ctx: &Context<'_>,
+        #[graphql(default = 50)] limit: i64,
+        #[graphql(default = 0)] offset: i64,
+    ) -> Result<Vec<Alliance>> {
+        let alliances = ProjectionService::alliance_rankings(pool(ctx), limit, offset).await?;
+        Ok(alliances
+            .into_iter()
+            .map(|a| Alliance::new(a.stats, Some(a.rank)))
+            .collect())
+    }
+
+    /// Villages within `range` tiles of (x, y)
+    #[graphql(complexity = "NESTED_LIST_COST * child_complexity")]
+    async fn map(
+        &self,
+        ctx: &Context<'_>,
+        x: i32,
+        y: i32,
+        #[graphql(default = 7)] range: i32,
+    ) -> Result<Vec<Village>> {
+        let range = range.clamp(1, MAX_MAP_RANGE);
+        let villages = VillageRepository::find_in_range(pool(ctx), x, y, range).await?;
+        Ok(villages.into_iter().map(Village::from).collect())
+    }
+}
@@ -0,0 +1,26 @@
+use axum::{
+    extract::{Query, State},
+    Extension, Json,
+};
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::activity::{ActivityEntry, ActivityQuery};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::activity_service::ActivityService;
+use crate::AppState;
+
+/// GET /api/activity - The player's own logins, army sends and gold spends,
+/// and any support staff access to the account
+pub async fn list_activity(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<ActivityQuery>,
+) -> AppResult<Json<Vec<ActivityEntry>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let entries = ActivityService::list(&state.db, db_user.id, &query).await?;
+    Ok(Json(entries))
+}
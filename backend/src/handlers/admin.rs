@@ -0,0 +1,1128 @@
+use axum::{
+    extract::{Path, Query, State},
+    Extension, Json,
+};
+use serde::Deserialize;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::account::{
+    AuthUserRecord, CreateTestUserRequest, LookupAuthUsersRequest, SetClaimsRequest,
+    SetDisabledRequest,
+};
+use crate::models::api_key::{ApiKey, CreateApiKeyRequest, CreatedApiKey};
+use crate::models::audit::{AuditLogEntry, AuditLogQuery};
+use crate::models::bot_detection::{
+    BotReviewQuery, BotReviewStatus, BotScanResult, BotSuspicion, ReviewBotSuspicionRequest,
+};
+use crate::models::command::{PlayerCommand, ReplayActionsRequest, ReplayedCommand};
+use crate::models::data_migration::{
+    DataMigrationChange, DataMigrationChangesQuery, DataMigrationInfo,
+    DataMigrationRollbackResult, DataMigrationRun, StartDataMigrationRequest,
+    DEFAULT_CHANGES_LIMIT,
+};
+use crate::models::digest::{GenerateDigestRequest, WeeklyDigest};
+use crate::models::economy::{EconomyFlow, EconomyFlowQuery, LedgerEntry, TradeHistoryQuery};
+use crate::models::hall_of_fame::FinishWorldResult;
+use crate::models::impersonation::{
+    ImpersonationQuery, ImpersonationSession, StartImpersonationRequest, StartedImpersonation,
+};
+use crate::models::invariant::InvariantReport;
+use crate::models::job_failure::{JobFailure, JobFailureQuery};
+use crate::models::ip_reputation::{
+    ImportIpRangesRequest, ImportIpRangesResult, IpCheckResult, IpRange, IpRangeQuery,
+    IpReputationSettings, UpdateIpReputationRequest,
+};
+use crate::models::oasis::{SeedOasesRequest, SeedOasesResult};
+use crate::models::ops_metrics::{CatchUpResult, OpsMetrics};
+use crate::models::projection::ProjectionRunResult;
+use crate::models::region::RegionRunResult;
+use crate::models::registration::{
+    CreateRegistrationWaveRequest, RegistrationOverview, RegistrationWave,
+};
+use crate::models::snapshot::{
+    CreateSnapshotRequest, PlayerSnapshot, RestoreResult, RestoreSnapshotRequest, SnapshotSummary,
+};
+use crate::models::soft_delete::{DeletedItems, DeletedKind};
+use crate::models::template::{
+    MessageTemplate, PreviewTemplateRequest, PublishTemplateRequest, RenderedTemplate,
+    RevertTemplateRequest, TemplateDetails, TemplateInfo,
+};
+use crate::models::tick::TickShard;
+use crate::models::world_setting::{
+    AdvanceClockRequest, AntiPushingSettings, ClockStatus, InactivityRunResult,
+    InactivitySettings, InvariantSettings, PauseWorldRequest, PurgeRunResult, PushingPair,
+    RegionControlSettings, RegistrationSettings,
+    ReportArchive, ReportRetentionSettings, RetentionRunResult, RuntimeSettings,
+    SoftDeleteSettings,
+    UpdateAntiPushingRequest, UpdateInactivityRequest, UpdateInvariantSettingsRequest,
+    UpdateRegionControlRequest, UpdateRegistrationRequest,
+    UpdateReportRetentionRequest, UpdateSoftDeleteRequest, UpdateWorldTimelineRequest,
+    WorldTimelineSettings,
+};
+use crate::models::world_dump::WorldDumpRunResult;
+use crate::models::world_shard::{UpsertWorldShardRequest, WorldShardResponse};
+use crate::models::world_stats::WorldStatsRunResult;
+use crate::models::user::UserResponse;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::api_key_service::ApiKeyService;
+use crate::services::archive_store::ArchiveStore;
+use crate::services::audit_service::AuditService;
+use crate::services::clock::ClockService;
+use crate::services::anti_pushing_service::AntiPushingService;
+use crate::services::bot_detection_service::BotDetectionService;
+use crate::services::command_service::CommandService;
+use crate::services::data_migration_service::DataMigrationService;
+use crate::services::digest_service::DigestService;
+use crate::services::economy_service::EconomyService;
+use crate::services::hall_of_fame_service::HallOfFameService;
+use crate::services::impersonation_service::ImpersonationService;
+use crate::services::inactivity_service::InactivityService;
+use crate::services::invariant_service::InvariantService;
+use crate::services::ip_reputation_service::IpReputationService;
+use crate::services::job_failure_service::JobFailureService;
+use crate::services::lag_watchdog_service::LagWatchdogService;
+use crate::services::oasis_service::OasisService;
+use crate::services::ops_metrics_service::OpsMetricsService;
+use crate::services::projection_service::ProjectionService;
+use crate::services::region_service::RegionService;
+use crate::services::registration_service::RegistrationService;
+use crate::services::report_retention_service::ReportRetentionService;
+use crate::services::runtime_config_service::RuntimeConfigService;
+use crate::services::shard_service::ShardService;
+use crate::services::snapshot_service::SnapshotService;
+use crate::services::soft_delete_service::SoftDeleteService;
+use crate::services::template_service::TemplateService;
+use crate::services::tick_service::TickService;
+use crate::services::user_admin_service::UserAdminService;
+use crate::services::world_dump_service::WorldDumpService;
+use crate::services::world_stats_service::WorldStatsService;
+use crate::services::world_status_service::WorldStatusService;
+use crate::AppState;
+
+#[derive(Debug, Deserialize)]
+pub struct PaginationQuery {
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_limit() -> i64 {
+    20
+}
+
+// ==================== Report Retention ====================
+
+/// GET /api/admin/reports/retention - Get the report retention policy
+pub async fn get_report_retention(
+    State(state): State<AppState>,
+) -> AppResult<Json<ReportRetentionSettings>> {
+    let settings = ReportRetentionService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/reports/retention - Update the report retention policy
+pub async fn update_report_retention(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateReportRetentionRequest>,
+) -> AppResult<Json<ReportRetentionSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = ReportRetentionService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+/// POST /api/admin/reports/retention/run - Run retention and archiving now
+pub async fn run_report_retention(
+    State(state): State<AppState>,
+) -> AppResult<Json<RetentionRunResult>> {
+    let store = ArchiveStore::from_config(&state.config.archive)?;
+    let result = ReportRetentionService::run(&state.db, store.as_ref()).await?;
+    Ok(Json(result))
+}
+
+// ==================== Inactivity ====================
+
+/// GET /api/admin/inactivity - Get the gray-zone policy
+pub async fn get_inactivity(
+    State(state): State<AppState>,
+) -> AppResult<Json<InactivitySettings>> {
+    let settings = InactivityService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/inactivity - Update the gray-zone policy
+pub async fn update_inactivity(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateInactivityRequest>,
+) -> AppResult<Json<InactivitySettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = InactivityService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+/// POST /api/admin/inactivity/run - Flag, decay and abandon now
+pub async fn run_inactivity(
+    State(state): State<AppState>,
+) -> AppResult<Json<InactivityRunResult>> {
+    let result = InactivityService::run(&state.db).await?;
+    Ok(Json(result))
+}
+
+// ==================== Anti-pushing ====================
+
+/// GET /api/admin/anti-pushing - Get the resource transfer limits
+pub async fn get_anti_pushing(
+    State(state): State<AppState>,
+) -> AppResult<Json<AntiPushingSettings>> {
+    let settings = AntiPushingService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/anti-pushing - Update the resource transfer limits
+pub async fn update_anti_pushing(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateAntiPushingRequest>,
+) -> AppResult<Json<AntiPushingSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = AntiPushingService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+/// GET /api/admin/anti-pushing/report - Player pairs near or over the limit
+pub async fn anti_pushing_report(
+    State(state): State<AppState>,
+) -> AppResult<Json<Vec<PushingPair>>> {
+    let pairs = AntiPushingService::report(&state.db).await?;
+    Ok(Json(pairs))
+}
+
+/// GET /api/admin/reports/archives - List archive objects
+pub async fn list_report_archives(
+    State(state): State<AppState>,
+    Query(query): Query<PaginationQuery>,
+) -> AppResult<Json<Vec<ReportArchive>>> {
+    let archives =
+        ReportRetentionService::list_archives(&state.db, query.limit, query.offset).await?;
+    Ok(Json(archives))
+}
+
+// ==================== Region Control ====================
+
+/// GET /api/admin/region-control - Get the region control victory settings
+pub async fn get_region_control(
+    State(state): State<AppState>,
+) -> AppResult<Json<RegionControlSettings>> {
+    let settings = RegionService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/region-control - Turn region control on or off and tune it
+pub async fn update_region_control(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateRegionControlRequest>,
+) -> AppResult<Json<RegionControlSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = RegionService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+/// POST /api/admin/region-control/run - Evaluate region control now
+pub async fn run_region_control(
+    State(state): State<AppState>,
+) -> AppResult<Json<RegionRunResult>> {
+    let result = RegionService::run(&state.db).await?;
+    Ok(Json(result))
+}
+
+// ==================== World Timeline ====================
+
+/// GET /api/admin/world-timeline - Get the world start and endgame release days
+pub async fn get_world_timeline(
+    State(state): State<AppState>,
+) -> AppResult<Json<WorldTimelineSettings>> {
+    let settings = WorldStatusService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/world-timeline - Move the world start or the release days
+pub async fn update_world_timeline(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateWorldTimelineRequest>,
+) -> AppResult<Json<WorldTimelineSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = WorldStatusService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+// ==================== Registration ====================
+
+/// GET /api/admin/registration - Get the launch settings: gating, quadrant caps, invites
+pub async fn get_registration(
+    State(state): State<AppState>,
+) -> AppResult<Json<RegistrationSettings>> {
+    let settings = RegistrationService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/registration - Gate the world, cap quadrants or tune invites
+pub async fn update_registration(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateRegistrationRequest>,
+) -> AppResult<Json<RegistrationSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = RegistrationService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+/// GET /api/admin/registration/overview - Queue, quadrant room, waves and groups
+pub async fn registration_overview(
+    State(state): State<AppState>,
+) -> AppResult<Json<RegistrationOverview>> {
+    let overview = RegistrationService::overview(&state.db).await?;
+    Ok(Json(overview))
+}
+
+/// POST /api/admin/registration/waves - Schedule an invite wave
+pub async fn schedule_registration_wave(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<CreateRegistrationWaveRequest>,
+) -> AppResult<Json<RegistrationWave>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let wave = RegistrationService::schedule_wave(&state.db, db_user.id, request).await?;
+    Ok(Json(wave))
+}
+
+/// POST /api/admin/registration/waves/{id}/release - Send a scheduled wave's invites now
+pub async fn release_registration_wave(
+    State(state): State<AppState>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<RegistrationWave>> {
+    let wave = RegistrationService::release_wave(&state.db, id).await?;
+    Ok(Json(wave))
+}
+
+/// DELETE /api/admin/registration/waves/{id} - Call off a scheduled wave
+pub async fn cancel_registration_wave(
+    State(state): State<AppState>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<RegistrationWave>> {
+    let wave = RegistrationService::cancel_wave(&state.db, id).await?;
+    Ok(Json(wave))
+}
+
+// ==================== Economy Ledger ====================
+
+/// GET /api/admin/economy/flows - Resources moved between accounts, largest net flow first
+pub async fn list_economy_flows(
+    State(state): State<AppState>,
+    Query(query): Query<EconomyFlowQuery>,
+) -> AppResult<Json<Vec<EconomyFlow>>> {
+    let flows = EconomyService::flows(&state.db, &query).await?;
+    Ok(Json(flows))
+}
+
+/// GET /api/admin/players/{user_id}/ledger - A player's transfers in and out
+pub async fn list_player_ledger(
+    State(state): State<AppState>,
+    Path(user_id): Path<Uuid>,
+    Query(query): Query<TradeHistoryQuery>,
+) -> AppResult<Json<Vec<LedgerEntry>>> {
+    let entries = EconomyService::history(&state.db, user_id, &query).await?;
+    Ok(Json(entries))
+}
+
+// ==================== Player Snapshots ====================
+
+/// POST /api/admin/players/{user_id}/snapshots - Snapshot a player's state
+pub async fn create_player_snapshot(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(user_id): Path<Uuid>,
+    Json(request): Json<CreateSnapshotRequest>,
+) -> AppResult<Json<SnapshotSummary>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let summary =
+        SnapshotService::create_snapshot(&state.db, db_user.id, user_id, request.reason).await?;
+    Ok(Json(summary))
+}
+
+/// GET /api/admin/players/{user_id}/snapshots - List a player's snapshots
+pub async fn list_player_snapshots(
+    State(state): State<AppState>,
+    Path(user_id): Path<Uuid>,
+) -> AppResult<Json<Vec<SnapshotSummary>>> {
+    let snapshots = SnapshotService::list_snapshots(&state.db, user_id).await?;
+    Ok(Json(snapshots))
+}
+
+/// GET /api/admin/snapshots/{id} - Download a snapshot document
+pub async fn get_snapshot(
+    State(state): State<AppState>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<PlayerSnapshot>> {
+    let snapshot = SnapshotService::get_snapshot(&state.db, id).await?;
+    Ok(Json(snapshot))
+}
+
+/// POST /api/admin/players/{user_id}/restore - Restore a player from a snapshot
+pub async fn restore_player_snapshot(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(user_id): Path<Uuid>,
+    Json(request): Json<RestoreSnapshotRequest>,
+) -> AppResult<Json<RestoreResult>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let result = SnapshotService::restore(&state.db, db_user.id, user_id, request).await?;
+    Ok(Json(result))
+}
+
+// ==================== API Keys ====================
+
+/// GET /api/admin/api-keys - Keys issued for the GraphQL read API
+pub async fn list_api_keys(State(state): State<AppState>) -> AppResult<Json<Vec<ApiKey>>> {
+    let keys = ApiKeyService::list(&state.db).await?;
+    Ok(Json(keys))
+}
+
+/// POST /api/admin/api-keys - Issue a key; it is only shown in this response
+pub async fn create_api_key(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<CreateApiKeyRequest>,
+) -> AppResult<Json<CreatedApiKey>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let created = ApiKeyService::create(&state.db, db_user.id, request).await?;
+    Ok(Json(created))
+}
+
+/// DELETE /api/admin/api-keys/{id} - Revoke a key
+pub async fn revoke_api_key(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<serde_json::Value>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    ApiKeyService::revoke(&state.db, db_user.id, id).await?;
+    Ok(Json(serde_json::json!({ "success": true })))
+}
+
+// ==================== Ops Metrics ====================
+
+/// GET /api/admin/ops-metrics - Queue backlogs, job failures, connections
+/// and cache hit ratio for every world
+pub async fn get_ops_metrics(State(state): State<AppState>) -> AppResult<Json<OpsMetrics>> {
+    let metrics = OpsMetricsService::all(&state).await?;
+    Ok(Json(metrics))
+}
+
+/// GET /api/admin/ops-metrics/{world_id} - The same for one world
+pub async fn get_world_ops_metrics(
+    State(state): State<AppState>,
+    Path(world_id): Path<String>,
+) -> AppResult<Json<OpsMetrics>> {
+    let metrics = OpsMetricsService::for_world(&state, &world_id).await?;
+    Ok(Json(metrics))
+}
+
+/// POST /api/admin/catch-up - Resolve every overdue queue item
+/// now, in the order they fell due
+pub async fn run_catch_up(State(state): State<AppState>) -> AppResult<Json<CatchUpResult>> {
+    let result = LagWatchdogService::catch_up(&state.db).await?;
+    Ok(Json(result))
+}
+
+// ==================== Impersonation ====================
+
+/// POST /api/admin/players/{user_id}/impersonate - Start acting as a player;
+/// the token is only shown in this response
+pub async fn start_impersonation(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(user_id): Path<Uuid>,
+    Json(request): Json<StartImpersonationRequest>,
+) -> AppResult<Json<StartedImpersonation>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let started = ImpersonationService::start(&state.db, db_user.id, user_id, request).await?;
+    Ok(Json(started))
+}
+
+/// GET /api/admin/impersonations - Impersonation sessions, newest first
+pub async fn list_impersonations(
+    State(state): State<AppState>,
+    Query(query): Query<ImpersonationQuery>,
+) -> AppResult<Json<Vec<ImpersonationSession>>> {
+    let sessions = ImpersonationService::list(&state.db, &query).await?;
+    Ok(Json(sessions))
+}
+
+/// DELETE /api/admin/impersonations/{id} - End a session; its token stops working
+pub async fn end_impersonation(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<ImpersonationSession>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let session = ImpersonationService::end(&state.db, db_user.id, id).await?;
+    Ok(Json(session))
+}
+
+// ==================== Soft Delete ====================
+
+/// GET /api/admin/soft-delete - How long deleted rows stay restorable
+pub async fn get_soft_delete(
+    State(state): State<AppState>,
+) -> AppResult<Json<SoftDeleteSettings>> {
+    let settings = SoftDeleteService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/soft-delete - Update the retention of deleted rows
+pub async fn update_soft_delete(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateSoftDeleteRequest>,
+) -> AppResult<Json<SoftDeleteSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = SoftDeleteService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+/// POST /api/admin/soft-delete/run - Purge deleted rows past retention now
+pub async fn run_soft_delete_purge(
+    State(state): State<AppState>,
+) -> AppResult<Json<PurgeRunResult>> {
+    let result = SoftDeleteService::purge(&state.db).await?;
+    Ok(Json(result))
+}
+
+/// GET /api/admin/players/{user_id}/deleted - Messages, reports and notes a player deleted
+pub async fn list_player_deleted(
+    State(state): State<AppState>,
+    Path(user_id): Path<Uuid>,
+) -> AppResult<Json<DeletedItems>> {
+    let items = SoftDeleteService::list_deleted(&state.db, user_id).await?;
+    Ok(Json(items))
+}
+
+/// POST /api/admin/deleted/{kind}/{id}/restore - Restore a deleted row for a support case
+pub async fn restore_deleted(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path((kind, id)): Path<(DeletedKind, Uuid)>,
+) -> AppResult<Json<serde_json::Value>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    SoftDeleteService::restore(&state.db, db_user.id, kind, id).await?;
+    Ok(Json(serde_json::json!({ "success": true })))
+}
+
+// ==================== Action Log ====================
+
+/// GET /api/admin/players/{user_id}/actions - A player's submitted commands, newest first
+pub async fn list_player_actions(
+    State(state): State<AppState>,
+    Path(user_id): Path<Uuid>,
+    Query(query): Query<PaginationQuery>,
+) -> AppResult<Json<Vec<PlayerCommand>>> {
+    let actions =
+        CommandService::list_actions(&state.db, user_id, query.limit, query.offset).await?;
+    Ok(Json(actions))
+}
+
+/// POST /api/admin/players/{user_id}/actions/replay - Re-run a player's commands (non-production)
+pub async fn replay_player_actions(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(user_id): Path<Uuid>,
+    Json(request): Json<ReplayActionsRequest>,
+) -> AppResult<Json<Vec<ReplayedCommand>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let replayed = CommandService::replay(
+        &state.db,
+        &state.config.server.environment,
+        db_user.id,
+        user_id,
+        request,
+    )
+    .await?;
+    Ok(Json(replayed))
+}
+
+// ==================== Read Models ====================
+
+/// POST /api/admin/projections/rebuild - Recompute player, alliance and world stats from scratch
+pub async fn rebuild_projections(
+    State(state): State<AppState>,
+) -> AppResult<Json<ProjectionRunResult>> {
+    let result = ProjectionService::rebuild(&state.db).await?;
+    Ok(Json(result))
+}
+
+// ==================== World Ticks ====================
+
+/// GET /api/admin/ticks - Shard watermarks and leases of the periodic world jobs
+pub async fn list_tick_shards(State(state): State<AppState>) -> AppResult<Json<Vec<TickShard>>> {
+    let shards = TickService::list_shards(&state.db).await?;
+    Ok(Json(shards))
+}
+
+// ==================== Job Failures ====================
+
+/// GET /api/admin/job-failures - Queue items that failed, filterable by job and quarantine
+pub async fn list_job_failures(
+    State(state): State<AppState>,
+    Query(query): Query<JobFailureQuery>,
+) -> AppResult<Json<Vec<JobFailure>>> {
+    let failures = JobFailureService::list(&state.db, query).await?;
+    Ok(Json(failures))
+}
+
+/// POST /api/admin/job-failures/{id}/retry - Release an item for its job's next run
+pub async fn retry_job_failure(
+    State(state): State<AppState>,
+    Path(id): Path<i64>,
+) -> AppResult<Json<JobFailure>> {
+    let failure = JobFailureService::retry(&state.db, id).await?;
+    Ok(Json(failure))
+}
+
+// ==================== Audit Log ====================
+
+/// GET /api/admin/audit - Search recorded API calls by player, route, method and time
+pub async fn search_audit_log(
+    State(state): State<AppState>,
+    Query(query): Query<AuditLogQuery>,
+) -> AppResult<Json<Vec<AuditLogEntry>>> {
+    let entries = AuditService::search(&state.db, &query).await?;
+    Ok(Json(entries))
+}
+
+// ==================== Runtime Config ====================
+
+/// GET /api/admin/runtime-config - Get the runtime-tunable settings
+pub async fn get_runtime_config(
+    State(state): State<AppState>,
+) -> AppResult<Json<RuntimeSettings>> {
+    let settings = RuntimeConfigService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/runtime-config - Replace the runtime-tunable settings
+pub async fn update_runtime_config(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<RuntimeSettings>,
+) -> AppResult<Json<RuntimeSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings =
+        RuntimeConfigService::update_settings(&state.db, &state.config, db_user.id, request)
+            .await?;
+    Ok(Json(settings))
+}
+
+// ==================== Data Migrations ====================
+
+/// GET /api/admin/data-migrations - Balance retrofits that can be run
+pub async fn list_data_migrations() -> Json<Vec<DataMigrationInfo>> {
+    Json(DataMigrationService::available())
+}
+
+/// POST /api/admin/data-migrations/{name}/runs - Start a run (a dry run unless `dry_run` is false)
+pub async fn start_data_migration(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(name): Path<String>,
+    Json(request): Json<StartDataMigrationRequest>,
+) -> AppResult<Json<DataMigrationRun>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let run = DataMigrationService::start(&state.db, db_user.id, &name, request).await?;
+    Ok(Json(run))
+}
+
+/// GET /api/admin/data-migration-runs - Recent runs with their progress
+pub async fn list_data_migration_runs(
+    State(state): State<AppState>,
+) -> AppResult<Json<Vec<DataMigrationRun>>> {
+    let runs = DataMigrationService::list_runs(&state.db).await?;
+    Ok(Json(runs))
+}
+
+/// GET /api/admin/data-migration-runs/{id} - A run's progress
+pub async fn get_data_migration_run(
+    State(state): State<AppState>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<DataMigrationRun>> {
+    let run = DataMigrationService::get_run(&state.db, id).await?;
+    Ok(Json(run))
+}
+
+/// GET /api/admin/data-migration-runs/{id}/changes - Rows a run changed, or would change
+pub async fn list_data_migration_changes(
+    State(state): State<AppState>,
+    Path(id): Path<Uuid>,
+    Query(query): Query<DataMigrationChangesQuery>,
+) -> AppResult<Json<Vec<DataMigrationChange>>> {
+    let limit = query.limit.unwrap_or(DEFAULT_CHANGES_LIMIT).clamp(1, 1000);
+    let changes = DataMigrationService::changes(&state.db, id, limit).await?;
+    Ok(Json(changes))
+}
+
+/// POST /api/admin/data-migration-runs/{id}/resume - Continue a failed run
+pub async fn resume_data_migration_run(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<DataMigrationRun>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let run = DataMigrationService::resume(&state.db, db_user.id, id).await?;
+    Ok(Json(run))
+}
+
+/// POST /api/admin/data-migration-runs/{id}/rollback - Restore the values a run replaced
+pub async fn rollback_data_migration_run(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<DataMigrationRollbackResult>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let result = DataMigrationService::rollback(&state.db, db_user.id, id).await?;
+    Ok(Json(result))
+}
+
+// ==================== Invariants ====================
+
+/// GET /api/admin/invariants - Result of the last invariant check, if any
+pub async fn get_invariant_report() -> AppResult<Json<Option<InvariantReport>>> {
+    Ok(Json(InvariantService::last_report()))
+}
+
+/// POST /api/admin/invariants/check - Check invariants now
+pub async fn run_invariant_check(
+    State(state): State<AppState>,
+) -> AppResult<Json<InvariantReport>> {
+    let report = InvariantService::check(&state.db).await?;
+    Ok(Json(report))
+}
+
+/// GET /api/admin/invariants/settings - Drift types repaired automatically
+pub async fn get_invariant_settings(
+    State(state): State<AppState>,
+) -> AppResult<Json<InvariantSettings>> {
+    let settings = InvariantService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/invariants/settings - Update the auto-fix whitelist
+pub async fn update_invariant_settings(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateInvariantSettingsRequest>,
+) -> AppResult<Json<InvariantSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = InvariantService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+// ==================== Message Templates ====================
+
+/// GET /api/admin/templates - Email, Discord and system message templates
+pub async fn list_templates(State(state): State<AppState>) -> AppResult<Json<Vec<TemplateInfo>>> {
+    let templates = TemplateService::list(&state.db).await?;
+    Ok(Json(templates))
+}
+
+/// GET /api/admin/templates/{name} - Built-in text, sample context and edited versions
+pub async fn get_template(
+    State(state): State<AppState>,
+    Path(name): Path<String>,
+) -> AppResult<Json<TemplateDetails>> {
+    let template = TemplateService::get(&state.db, &name).await?;
+    Ok(Json(template))
+}
+
+/// POST /api/admin/templates/{name}/versions - Publish an edited text in one locale
+pub async fn publish_template(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(name): Path<String>,
+    Json(request): Json<PublishTemplateRequest>,
+) -> AppResult<Json<MessageTemplate>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let template = TemplateService::publish(&state.db, db_user.id, &name, request).await?;
+    Ok(Json(template))
+}
+
+/// POST /api/admin/templates/{name}/revert - Publish an earlier version again
+pub async fn revert_template(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(name): Path<String>,
+    Json(request): Json<RevertTemplateRequest>,
+) -> AppResult<Json<MessageTemplate>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let template = TemplateService::revert(&state.db, db_user.id, &name, request).await?;
+    Ok(Json(template))
+}
+
+/// POST /api/admin/templates/{name}/preview - Render a draft (non-production)
+pub async fn preview_template(
+    State(state): State<AppState>,
+    Path(name): Path<String>,
+    Json(request): Json<PreviewTemplateRequest>,
+) -> AppResult<Json<RenderedTemplate>> {
+    let rendered =
+        TemplateService::preview(&state.db, &state.config.server.environment, &name, request)
+            .await?;
+    Ok(Json(rendered))
+}
+
+// ==================== Game Clock ====================
+
+/// GET /api/admin/clock - Current game time and how far it runs ahead
+pub async fn get_clock(State(state): State<AppState>) -> AppResult<Json<ClockStatus>> {
+    Ok(Json(ClockService::status(&state.config)))
+}
+
+/// POST /api/admin/clock/advance - Fast-forward the game clock (TIME_WARP_ENABLED worlds only)
+pub async fn advance_clock(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<AdvanceClockRequest>,
+) -> AppResult<Json<ClockStatus>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let status =
+        ClockService::advance(&state.db, &state.config, db_user.id, request.seconds).await?;
+    Ok(Json(status))
+}
+
+/// POST /api/admin/clock/pause - Freeze the world for emergency maintenance
+pub async fn pause_world(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<PauseWorldRequest>,
+) -> AppResult<Json<ClockStatus>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let status =
+        ClockService::pause(&state.db, &state.config, db_user.id, request.reason).await?;
+    Ok(Json(status))
+}
+
+/// POST /api/admin/clock/resume - Unfreeze the world, pushing running timers back by the downtime
+pub async fn resume_world(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<ClockStatus>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let status = ClockService::resume(&state.db, &state.config, db_user.id).await?;
+    Ok(Json(status))
+}
+
+// ==================== World Shards ====================
+
+/// GET /api/admin/shards - Worlds living outside the primary database
+pub async fn list_world_shards(
+    State(state): State<AppState>,
+) -> AppResult<Json<Vec<WorldShardResponse>>> {
+    let shards = ShardService::list(&state.db, &state.shards).await?;
+    Ok(Json(shards))
+}
+
+/// PUT /api/admin/shards/{world_id} - Assign a world to a shard and migrate it
+pub async fn upsert_world_shard(
+    State(state): State<AppState>,
+    Path(world_id): Path<String>,
+    Json(request): Json<UpsertWorldShardRequest>,
+) -> AppResult<Json<WorldShardResponse>> {
+    let shard = ShardService::register(&state.db, &state.shards, &world_id, request).await?;
+    Ok(Json(shard))
+}
+
+/// POST /api/admin/shards/{world_id}/migrate - Apply pending migrations to a world's shard
+pub async fn migrate_world_shard(
+    State(state): State<AppState>,
+    Path(world_id): Path<String>,
+) -> AppResult<Json<WorldShardResponse>> {
+    let shard = ShardService::migrate(&state.db, &state.shards, &world_id).await?;
+    Ok(Json(shard))
+}
+
+/// POST /api/admin/shards/{world_id}/finish - Record an ended world's final standings
+/// and medals in the hall of fame. Safe to repeat; results are overwritten.
+pub async fn finish_world(
+    State(state): State<AppState>,
+    Path(world_id): Path<String>,
+) -> AppResult<Json<FinishWorldResult>> {
+    let result = HallOfFameService::finish_world(&state.db, &state.shards, &world_id).await?;
+    Ok(Json(result))
+}
+
+/// POST /api/admin/world-stats/refresh - Recompute today's world statistics now
+pub async fn refresh_world_stats(
+    State(state): State<AppState>,
+) -> AppResult<Json<WorldStatsRunResult>> {
+    let result = WorldStatsService::refresh(&state.db).await?;
+    Ok(Json(result))
+}
+
+/// POST /api/admin/world-dumps/run - Write the public world dumps now
+pub async fn run_world_dump(
+    State(state): State<AppState>,
+) -> AppResult<Json<WorldDumpRunResult>> {
+    let store = ArchiveStore::from_config(&state.config.archive)?
+        .ok_or_else(|| AppError::BadRequest("Archive storage is not configured".into()))?;
+    let result = WorldDumpService::run(&state.db, &store).await?;
+    Ok(Json(result))
+}
+
+/// POST /api/admin/digests/generate - (Re)generate a weekly digest without mailing it
+pub async fn generate_digest(
+    State(state): State<AppState>,
+    Json(request): Json<GenerateDigestRequest>,
+) -> AppResult<Json<WeeklyDigest>> {
+    let week_start = match request.week_start {
+        Some(week_start) => week_start,
+        None => DigestService::last_full_week(),
+    };
+    let digest = DigestService::generate(&state.db, week_start).await?;
+    Ok(Json(digest))
+}
+
+// ==================== Oases ====================
+
+/// POST /api/admin/oases/seed - Scatter oases over free tiles
+pub async fn seed_oases(
+    State(state): State<AppState>,
+    Json(request): Json<SeedOasesRequest>,
+) -> AppResult<Json<SeedOasesResult>> {
+    let result = OasisService::seed(&state.db, request).await?;
+    Ok(Json(result))
+}
+
+// ==================== Bot Detection ====================
+
+/// GET /api/admin/bot-review - Suspected bots, highest score first
+pub async fn list_bot_suspicions(
+    State(state): State<AppState>,
+    Query(query): Query<BotReviewQuery>,
+) -> AppResult<Json<Vec<BotSuspicion>>> {
+    let suspicions = BotDetectionService::review_queue(&state.db, query).await?;
+    Ok(Json(suspicions))
+}
+
+/// PUT /api/admin/bot-review/{user_id} - Clear or confirm a suspected bot
+pub async fn review_bot_suspicion(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(user_id): Path<Uuid>,
+    Json(request): Json<ReviewBotSuspicionRequest>,
+) -> AppResult<Json<BotSuspicion>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let suspicion = BotDetectionService::review(&state.db, db_user.id, user_id, request).await?;
+
+    // A confirmed bot is banned where accounts can be disabled
+    if suspicion.status == BotReviewStatus::Confirmed && state.user_admin.is_some() {
+        UserAdminService::set_disabled(&state, user_id, true).await?;
+    }
+
+    Ok(Json(suspicion))
+}
+
+/// POST /api/admin/bot-review/scan - Score active players now
+pub async fn scan_for_bots(State(state): State<AppState>) -> AppResult<Json<BotScanResult>> {
+    let result = BotDetectionService::scan(&state.db).await?;
+    Ok(Json(result))
+}
+
+// ==================== IP Reputation ====================
+
+/// GET /api/admin/ip-reputation - Get the step-up policy for risky networks
+pub async fn get_ip_reputation(
+    State(state): State<AppState>,
+) -> AppResult<Json<IpReputationSettings>> {
+    let settings = IpReputationService::get_settings(&state.db).await?;
+    Ok(Json(settings))
+}
+
+/// PUT /api/admin/ip-reputation - Update the step-up policy
+pub async fn update_ip_reputation(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<UpdateIpReputationRequest>,
+) -> AppResult<Json<IpReputationSettings>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let settings = IpReputationService::update_settings(&state.db, db_user.id, request).await?;
+    Ok(Json(settings))
+}
+
+/// GET /api/admin/ip-ranges - Local datacenter/VPN/proxy/Tor lists
+pub async fn list_ip_ranges(
+    State(state): State<AppState>,
+    Query(query): Query<IpRangeQuery>,
+) -> AppResult<Json<Vec<IpRange>>> {
+    let ranges = IpReputationService::list_ranges(&state.db, query).await?;
+    Ok(Json(ranges))
+}
+
+/// POST /api/admin/ip-ranges - Add ranges to the local lists
+pub async fn import_ip_ranges(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<ImportIpRangesRequest>,
+) -> AppResult<Json<ImportIpRangesResult>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let result = IpReputationService::import_ranges(&state.db, db_user.id, request).await?;
+    Ok(Json(result))
+}
+
+/// DELETE /api/admin/ip-ranges/{id} - Remove a range from the local lists
+pub async fn delete_ip_range(
+    State(state): State<AppState>,
+    Path(id): Path<i64>,
+) -> AppResult<Json<serde_json::Value>> {
+    IpReputationService::delete_range(&state.db, id).await?;
+    Ok(Json(serde_json::json!({ "success": true })))
+}
+
+/// GET /api/admin/ip-check/{ip} - How an address is classified
+pub async fn check_ip(
+    State(state): State<AppState>,
+    Path(ip): Path<String>,
+) -> AppResult<Json<IpCheckResult>> {
+    let result = IpReputationService::check(&state.db, state.ip_intel.as_ref(), &ip).await?;
+    Ok(Json(result))
+}
+
+// ==================== Sign-in Accounts ====================
+
+/// POST /api/admin/auth-users - Create a sign-in account and player for a test world
+pub async fn create_test_user(
+    State(state): State<AppState>,
+    Json(request): Json<CreateTestUserRequest>,
+) -> AppResult<Json<UserResponse>> {
+    let user = UserAdminService::create_test_user(&state, request).await?;
+    Ok(Json(user.into()))
+}
+
+/// POST /api/admin/auth-users/lookup - Sign-in accounts by Firebase UID
+pub async fn lookup_auth_users(
+    State(state): State<AppState>,
+    Json(request): Json<LookupAuthUsersRequest>,
+) -> AppResult<Json<Vec<AuthUserRecord>>> {
+    let users = UserAdminService::lookup(&state, &request.uids).await?;
+    Ok(Json(users))
+}
+
+/// PUT /api/admin/players/{user_id}/disabled - Ban or unban a player
+pub async fn set_player_disabled(
+    State(state): State<AppState>,
+    Path(user_id): Path<Uuid>,
+    Json(request): Json<SetDisabledRequest>,
+) -> AppResult<Json<serde_json::Value>> {
+    UserAdminService::set_disabled(&state, user_id, request.disabled).await?;
+    Ok(Json(serde_json::json!({ "success": true })))
+}
+
+/// PUT /api/admin/players/{user_id}/claims - Replace a player's custom claims
+pub async fn set_player_claims(
+    State(state): State<AppState>,
+    Path(user_id): Path<Uuid>,
+    Json(request): Json<SetClaimsRequest>,
+) -> AppResult<Json<serde_json::Value>> {
+    UserAdminService::set_claims(&state, user_id, request.claims).await?;
+    Ok(Json(serde_json::json!({ "success": true })))
+}
@@ -8,12 +8,20 @@ use uuid::Uuid;
 use crate::error::AppResult;
 use crate::middleware::auth::AuthenticatedUser;
 use crate::models::alliance::{
-    AllianceDiplomacy, AllianceInvitation, AllianceListItem, AllianceMemberResponse,
-    AllianceResponse, CreateAllianceRequest, InvitePlayerRequest, RespondInvitationRequest,
-    SetDiplomacyRequest, UpdateAllianceRequest, UpdateMemberRoleRequest,
+    AllianceAward, AllianceDiplomacy, AllianceInvitation, AllianceListItem,
+    AllianceMemberResponse, AllianceMerge, AllianceResponse, AllianceStatsQuery,
+    AllianceStatsResponse, CreateAllianceRequest, InvitePlayerRequest, ProposeMergeRequest,
+    RespondInvitationRequest, RespondMergeRequest, SetDiplomacyRequest, UpdateAllianceRequest,
+    UpdateMemberRoleRequest,
+};
+use crate::models::operation::{
+    AllianceOperation, CreateOperationRequest, ListOperationsQuery, OperationBoard,
+    OperationSignupRequest, OperationSignupResult,
 };
 use crate::repositories::user_repo::UserRepository;
 use crate::services::alliance_service::AllianceService;
+use crate::services::alliance_stats_service::AllianceStatsService;
+use crate::services::operation_service::OperationService;
 use crate::AppState;
 
 #[derive(Debug, Deserialize)]
@@ -252,3 +260,185 @@ pub async fn set_diplomacy(
     .await?;
     Ok(Json(diplomacy))
 }
+
+// ==================== Merges ====================
+
+/// GET /api/alliances/:id/merges - Merges the alliance is part of
+pub async fn list_merges(
+    State(state): State<AppState>,
+    Path(alliance_id): Path<Uuid>,
+) -> AppResult<Json<Vec<AllianceMerge>>> {
+    let merges = AllianceService::list_merges(&state.db, alliance_id).await?;
+    Ok(Json(merges))
+}
+
+/// POST /api/alliances/:id/merges - Invite another alliance to merge into this one
+pub async fn propose_merge(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(alliance_id): Path<Uuid>,
+    Json(request): Json<ProposeMergeRequest>,
+) -> AppResult<Json<AllianceMerge>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let merge = AllianceService::propose_merge(
+        &state.db,
+        db_user.id,
+        alliance_id,
+        request.target_alliance_id,
+    )
+    .await?;
+    Ok(Json(merge))
+}
+
+/// POST /api/alliances/merges/:merge_id/respond - Accept or decline a merge
+pub async fn respond_merge(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(merge_id): Path<Uuid>,
+    Json(request): Json<RespondMergeRequest>,
+) -> AppResult<Json<AllianceMerge>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let merge =
+        AllianceService::respond_merge(&state.db, db_user.id, merge_id, request.accept).await?;
+    Ok(Json(merge))
+}
+
+/// DELETE /api/alliances/merges/:merge_id - Call off a merge
+pub async fn cancel_merge(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(merge_id): Path<Uuid>,
+) -> AppResult<Json<()>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    AllianceService::cancel_merge(&state.db, db_user.id, merge_id).await?;
+    Ok(Json(()))
+}
+
+// ==================== Stats ====================
+
+/// GET /api/alliances/:id/stats - Member contributions for a week
+pub async fn get_stats(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(alliance_id): Path<Uuid>,
+    Query(query): Query<AllianceStatsQuery>,
+) -> AppResult<Json<AllianceStatsResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let stats = AllianceStatsService::stats(&state.db, db_user.id, alliance_id, query).await?;
+    Ok(Json(stats))
+}
+
+/// GET /api/alliances/:id/awards - Weekly awards, newest first
+pub async fn list_awards(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(alliance_id): Path<Uuid>,
+) -> AppResult<Json<Vec<AllianceAward>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let awards = AllianceStatsService::awards(&state.db, db_user.id, alliance_id).await?;
+    Ok(Json(awards))
+}
+
+// ==================== Operations ====================
+
+/// GET /api/alliances/:id/operations - Open operations, or all with ?all=true
+pub async fn list_operations(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(alliance_id): Path<Uuid>,
+    Query(query): Query<ListOperationsQuery>,
+) -> AppResult<Json<Vec<AllianceOperation>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let operations = OperationService::list(&state.db, db_user.id, alliance_id, query).await?;
+    Ok(Json(operations))
+}
+
+/// POST /api/alliances/:id/operations - Post an operation (leader/officer)
+pub async fn create_operation(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(alliance_id): Path<Uuid>,
+    Json(request): Json<CreateOperationRequest>,
+) -> AppResult<Json<OperationBoard>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let board = OperationService::create(&state.db, db_user.id, alliance_id, request).await?;
+    Ok(Json(board))
+}
+
+/// GET /api/alliances/operations/:operation_id - Targets, sign-ups and committed troops
+pub async fn get_operation(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(operation_id): Path<Uuid>,
+) -> AppResult<Json<OperationBoard>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let board = OperationService::board(&state.db, db_user.id, operation_id).await?;
+    Ok(Json(board))
+}
+
+/// DELETE /api/alliances/operations/:operation_id - Call an operation off (leader/officer)
+pub async fn cancel_operation(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(operation_id): Path<Uuid>,
+) -> AppResult<Json<OperationBoard>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let board = OperationService::cancel(&state.db, db_user.id, operation_id).await?;
+    Ok(Json(board))
+}
+
+/// POST /api/alliances/operations/:operation_id/signups - Sign a wave up against a target
+pub async fn sign_up_operation(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(operation_id): Path<Uuid>,
+    Json(request): Json<OperationSignupRequest>,
+) -> AppResult<Json<OperationSignupResult>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    let result = OperationService::sign_up(&state.db, db_user.id, operation_id, request).await?;
+    Ok(Json(result))
+}
+
+/// DELETE /api/alliances/operations/:operation_id/signups/:signup_id - Withdraw a wave
+pub async fn withdraw_operation_signup(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path((operation_id, signup_id)): Path<(Uuid, Uuid)>,
+) -> AppResult<Json<()>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or_else(|| crate::error::AppError::Unauthorized)?;
+
+    OperationService::withdraw(&state.db, db_user.id, operation_id, signup_id).await?;
+    Ok(Json(()))
+}
@@ -1,5 +1,6 @@
 use axum::{
-    extract::{Path, State},
+    extract::{Path, Query, State},
+    http::HeaderMap,
     Extension, Json,
 };
 use tracing::info;
@@ -7,10 +8,16 @@ use uuid::Uuid;
 
 use crate::error::{AppError, AppResult};
 use crate::middleware::AuthenticatedUser;
-use crate::models::army::{ArmyResponse, BattleReportResponse, ScoutReportResponse, SendArmyRequest};
+use crate::models::activity::ActivityKind;
+use crate::models::army::{
+    ArmyPlanResponse, ArmyResponse, BattleReportResponse, MergeStationedResponse, PlanArmyRequest,
+    PrepareArmyResponse, RallyPointQuery, RallyPointResponse, ScoutReportResponse,
+    SendArmyRequest, TransferTroopsRequest,
+};
 use crate::repositories::army_repo::ArmyRepository;
 use crate::repositories::user_repo::UserRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::activity_service::ActivityService;
 use crate::services::army_service::ArmyService;
 use crate::AppState;
 
@@ -19,6 +26,7 @@ pub async fn send_army(
     State(state): State<AppState>,
     Extension(auth_user): Extension<AuthenticatedUser>,
     Path(village_id): Path<Uuid>,
+    headers: HeaderMap,
     Json(body): Json<SendArmyRequest>,
 ) -> AppResult<Json<ArmyResponse>> {
     let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
@@ -40,6 +48,61 @@ pub async fn send_army(
         village_id, response.to_x, response.to_y
     );
 
+    ActivityService::record_own(
+        &state.db,
+        user.id,
+        ActivityKind::ArmySent,
+        ActivityService::origin(&headers),
+        serde_json::json!({
+            "army_id": response.id,
+            "from_village_id": village_id,
+            "mission": response.mission,
+            "to_x": response.to_x,
+            "to_y": response.to_y,
+            "troops": response.troops,
+        }),
+    );
+
+    Ok(Json(response))
+}
+
+// POST /api/villages/:village_id/armies/plan - Travel time and arrival of a march
+pub async fn plan_army(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+    Json(body): Json<PlanArmyRequest>,
+) -> AppResult<Json<ArmyPlanResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let response = ArmyService::plan_army(&state.db, village_id, body).await?;
+
+    Ok(Json(response))
+}
+
+// POST /api/villages/:village_id/armies/prepare - Check a march and preview it before sending
+pub async fn prepare_army(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+    Json(body): Json<SendArmyRequest>,
+) -> AppResult<Json<PrepareArmyResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = ArmyService::prepare_army(&state.db, user.id, village_id, body).await?;
+
     Ok(Json(response))
 }
 
@@ -98,7 +161,7 @@ pub async fn list_reports(
         .await?
         .ok_or(AppError::Unauthorized)?;
 
-    let reports = ArmyService::get_reports(&state.db, user.id).await?;
+    let reports = ArmyService::get_reports(state.read_db.reader(), user.id).await?;
 
     let responses: Vec<BattleReportResponse> = reports
         .into_iter()
@@ -125,13 +188,21 @@ pub async fn get_report(
         .await?
         .ok_or_else(|| AppError::NotFound("Report not found".to_string()))?;
 
-    // Check if user is involved in this battle
+    // Check if user is involved in this battle and still has the report
     let is_attacker = report.attacker_player_id == user.id;
     let is_defender = report.defender_player_id == Some(user.id);
 
     if !is_attacker && !is_defender {
         return Err(AppError::Forbidden("Access denied".into()));
     }
+    let deleted = if is_attacker {
+        report.deleted_by_attacker
+    } else {
+        report.deleted_by_defender
+    };
+    if deleted {
+        return Err(AppError::NotFound("Report not found".to_string()));
+    }
 
     Ok(Json(report.to_response(is_attacker)))
 }
@@ -153,6 +224,23 @@ pub async fn mark_report_read(
     })))
 }
 
+// DELETE /api/reports/:report_id - Delete report from own report list
+pub async fn delete_report(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(report_id): Path<Uuid>,
+) -> AppResult<Json<serde_json::Value>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    ArmyService::delete_report(&state.db, report_id, user.id).await?;
+
+    Ok(Json(serde_json::json!({
+        "message": "Report deleted"
+    })))
+}
+
 // GET /api/reports/unread-count - Get unread report count (battle + scout)
 pub async fn get_unread_count(
     State(state): State<AppState>,
@@ -180,7 +268,7 @@ pub async fn list_scout_reports(
         .await?
         .ok_or(AppError::Unauthorized)?;
 
-    let reports = ArmyService::get_scout_reports(&state.db, user.id).await?;
+    let reports = ArmyService::get_scout_reports(state.read_db.reader(), user.id).await?;
 
     let responses: Vec<ScoutReportResponse> = reports
         .into_iter()
@@ -207,13 +295,21 @@ pub async fn get_scout_report(
         .await?
         .ok_or_else(|| AppError::NotFound("Scout report not found".to_string()))?;
 
-    // Check if user is involved
+    // Check if user is involved and still has the report
     let is_attacker = report.attacker_player_id == user.id;
     let is_defender = report.defender_player_id == Some(user.id);
 
     if !is_attacker && !is_defender {
         return Err(AppError::Forbidden("Access denied".into()));
     }
+    let deleted = if is_attacker {
+        report.deleted_by_attacker
+    } else {
+        report.deleted_by_defender
+    };
+    if deleted {
+        return Err(AppError::NotFound("Scout report not found".to_string()));
+    }
 
     Ok(Json(report.to_response(is_attacker)))
 }
@@ -235,6 +331,23 @@ pub async fn mark_scout_report_read(
     })))
 }
 
+// DELETE /api/scout-reports/:report_id - Delete scout report from own report list
+pub async fn delete_scout_report(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(report_id): Path<Uuid>,
+) -> AppResult<Json<serde_json::Value>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    ArmyService::delete_scout_report(&state.db, report_id, user.id).await?;
+
+    Ok(Json(serde_json::json!({
+        "message": "Scout report deleted"
+    })))
+}
+
 // ==================== Support/Stationed Troops ====================
 
 // GET /api/villages/:village_id/stationed - Get troops stationed at a village
@@ -275,7 +388,8 @@ pub async fn list_support_sent(
     Ok(Json(armies))
 }
 
-// POST /api/armies/:army_id/recall - Recall stationed support troops
+// POST /api/armies/:army_id/recall - Recall stationed support troops (owner),
+// or send them home (host village)
 pub async fn recall_support(
     State(state): State<AppState>,
     Extension(auth_user): Extension<AuthenticatedUser>,
@@ -291,3 +405,78 @@ pub async fn recall_support(
 
     Ok(Json(response))
 }
+
+// POST /api/armies/:army_id/merge - Make support stationed in an own village
+// part of that village's troops
+pub async fn merge_stationed(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(army_id): Path<Uuid>,
+) -> AppResult<Json<MergeStationedResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = ArmyService::merge_stationed(&state.db, army_id, user.id).await?;
+
+    Ok(Json(response))
+}
+
+// ==================== Troop Transfers ====================
+
+// POST /api/villages/:village_id/troops/transfer - Move troops for good to another own village
+pub async fn transfer_troops(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+    Json(body): Json<TransferTroopsRequest>,
+) -> AppResult<Json<ArmyResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = ArmyService::transfer_troops(&state.db, user.id, village_id, body).await?;
+
+    Ok(Json(response))
+}
+
+// ==================== Rally Point ====================
+
+// GET /api/villages/:village_id/rally-point - All movements involving a village
+pub async fn get_rally_point(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+    Query(query): Query<RallyPointQuery>,
+) -> AppResult<Json<RallyPointResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let response = ArmyService::get_rally_point(&state.db, village_id, &query).await?;
+
+    Ok(Json(response))
+}
+
+// POST /api/armies/:army_id/cancel - Turn back a just-sent army
+pub async fn cancel_army(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(army_id): Path<Uuid>,
+) -> AppResult<Json<ArmyResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = ArmyService::cancel_army(&state.db, army_id, user.id).await?;
+
+    Ok(Json(response))
+}
@@ -0,0 +1,85 @@
+use axum::{
+    extract::{Path, Query, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::auction::{
+    AuctionQuery, AuctionResponse, CreateAuctionRequest, MyAuctionsResponse, PlaceBidRequest,
+};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::auction_service::AuctionService;
+use crate::AppState;
+
+/// GET /api/auctions - Open auctions, ending soonest first
+pub async fn list_auctions(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<AuctionQuery>,
+) -> AppResult<Json<Vec<AuctionResponse>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let auctions = AuctionService::list(&state.db, db_user.id, &query).await?;
+    Ok(Json(auctions))
+}
+
+/// GET /api/auctions/mine - Own listings, leading bids and balances
+pub async fn my_auctions(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<MyAuctionsResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = AuctionService::mine(&state.db, db_user.id).await?;
+    Ok(Json(response))
+}
+
+/// POST /api/auctions - List a hero item
+pub async fn create_auction(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<CreateAuctionRequest>,
+) -> AppResult<Json<AuctionResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let auction = AuctionService::create(&state.db, db_user.id, request).await?;
+    Ok(Json(auction))
+}
+
+/// POST /api/auctions/{id}/bids - Bid on an auction
+pub async fn place_bid(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(auction_id): Path<Uuid>,
+    Json(request): Json<PlaceBidRequest>,
+) -> AppResult<Json<AuctionResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let auction =
+        AuctionService::bid(&state.db, &state.ws, db_user.id, auction_id, request).await?;
+    Ok(Json(auction))
+}
+
+/// DELETE /api/auctions/{id} - Withdraw an auction nobody has bid on
+pub async fn cancel_auction(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(auction_id): Path<Uuid>,
+) -> AppResult<Json<AuctionResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let auction = AuctionService::cancel(&state.db, db_user.id, auction_id).await?;
+    Ok(Json(auction))
+}
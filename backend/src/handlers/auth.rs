@@ -1,11 +1,33 @@
-use axum::{extract::State, Extension, Json};
+use axum::{
+    extract::{Path, State},
+    http::HeaderMap,
+    Extension, Json,
+};
 use serde::{Deserialize, Serialize};
 use tracing::info;
+use uuid::Uuid;
 
-use crate::error::AppResult;
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::middleware::dev_auth::DevAuth;
 use crate::middleware::AuthenticatedUser;
-use crate::models::user::{CreateUser, UserResponse};
+use crate::models::account::{
+    ConfirmTokenRequest, EmailChangeResponse, RequestEmailChangeRequest, RequestRecoveryRequest,
+};
+use crate::models::activity::ActivityKind;
+use crate::models::ip_reputation::IpCategory;
+use crate::models::session::SessionResponse;
+use crate::models::template::LOCALES;
+use crate::models::troop::TribeType;
+use crate::models::user::{
+    CreateUser, EmailPreferences, UpdateEmailPreferencesRequest, UserResponse,
+    MAX_ATTACK_QUIET_MINUTES, MIN_ATTACK_QUIET_MINUTES,
+};
 use crate::repositories::user_repo::UserRepository;
+use crate::services::account_service::AccountService;
+use crate::services::activity_service::ActivityService;
+use crate::services::referral_service::ReferralService;
+use crate::services::runtime_config_service;
+use crate::services::session_service::SessionService;
 use crate::AppState;
 
 #[derive(Debug, Serialize)]
@@ -45,6 +67,10 @@ pub async fn me(
 #[derive(Debug, Deserialize)]
 pub struct SyncUserRequest {
     pub display_name: Option<String>,
+    /// Tribe to register with; ignored for existing users
+    pub tribe: Option<TribeType>,
+    /// Referral code from the link the player registered through
+    pub referral_code: Option<String>,
 }
 
 #[derive(Debug, Serialize)]
@@ -57,6 +83,8 @@ pub struct SyncUserResponse {
 pub async fn sync_user(
     State(state): State<AppState>,
     Extension(auth_user): Extension<AuthenticatedUser>,
+    ip_category: Option<Extension<IpCategory>>,
+    headers: HeaderMap,
     Json(body): Json<SyncUserRequest>,
 ) -> AppResult<Json<SyncUserResponse>> {
     // Check if user exists
@@ -64,6 +92,15 @@ pub async fn sync_user(
         UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid).await?;
     let is_new = existing_user.is_none();
 
+    if is_new && !runtime_config_service::current().features.registration {
+        return Err(ErrorCode::RegistrationClosed.into());
+    }
+
+    let tribe = body.tribe.unwrap_or(TribeType::Phasuttha);
+    if !tribe.is_playable() {
+        return Err(AppError::BadRequest("Not a playable tribe".into()));
+    }
+
     // Upsert user
     let create_user = CreateUser {
         firebase_uid: auth_user.firebase_uid.clone(),
@@ -71,26 +108,76 @@ pub async fn sync_user(
         display_name: body.display_name.or(auth_user.name),
         photo_url: auth_user.picture,
         provider: auth_user.provider.unwrap_or_else(|| "unknown".to_string()),
+        tribe,
     };
 
     let user = UserRepository::upsert(&state.db, create_user).await?;
 
+    let mut origin = ActivityService::origin(&headers);
+    // Classified by the login middleware
+    origin.ip_category = ip_category.map(|Extension(category)| category);
+
     if is_new {
         info!("New user registered: {}", user.firebase_uid);
+        if let Some(code) = &body.referral_code {
+            ReferralService::attribute(&state.db, user.id, code, origin.client_ip.as_deref())
+                .await?;
+        }
     } else {
         info!("User synced: {}", user.firebase_uid);
     }
 
+    // The client syncs once per sign-in, so this is the login record
+    ActivityService::record_own(
+        &state.db,
+        user.id,
+        ActivityKind::Login,
+        origin,
+        serde_json::json!({ "provider": user.provider, "is_new": is_new }),
+    );
+
     Ok(Json(SyncUserResponse {
         user: user.into(),
         is_new,
     }))
 }
 
-// DELETE /api/auth/logout - Logout (optional: invalidate session in Redis)
+#[derive(Debug, Deserialize)]
+pub struct ChangeTribeRequest {
+    pub tribe: TribeType,
+}
+
+// PUT /api/auth/tribe - Pick a different tribe, until the first village is founded
+pub async fn change_tribe(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Json(body): Json<ChangeTribeRequest>,
+) -> AppResult<Json<UserResponse>> {
+    if !body.tribe.is_playable() {
+        return Err(AppError::BadRequest("Not a playable tribe".into()));
+    }
+
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let updated = UserRepository::set_tribe_before_settling(&state.db, user.id, body.tribe)
+        .await?
+        .ok_or_else(|| {
+            AppError::Conflict("Tribe can't be changed after founding a village".into())
+        })?;
+
+    info!("User {} switched to tribe {:?}", updated.id, updated.tribe);
+
+    Ok(Json(updated.into()))
+}
+
+// DELETE /api/auth/logout - Logout, revoking this device's session
 pub async fn logout(
+    State(state): State<AppState>,
     Extension(auth_user): Extension<AuthenticatedUser>,
 ) -> AppResult<Json<serde_json::Value>> {
+    SessionService::logout(&state.db, &auth_user).await?;
     info!("User logged out: {}", auth_user.firebase_uid);
 
     Ok(Json(serde_json::json!({
@@ -98,6 +185,37 @@ pub async fn logout(
     })))
 }
 
+// GET /api/auth/sessions - Devices signed in to the account
+pub async fn list_sessions(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<Vec<SessionResponse>>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let sessions =
+        SessionService::list(&state.db, user.id, auth_user.session_id.as_deref()).await?;
+
+    Ok(Json(sessions))
+}
+
+// DELETE /api/auth/sessions/:id - Log a device out
+pub async fn revoke_session(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<SessionResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let session =
+        SessionService::revoke(&state.db, user.id, id, auth_user.session_id.as_deref()).await?;
+
+    Ok(Json(session))
+}
+
 #[derive(Debug, Deserialize)]
 pub struct UpdateProfileRequest {
     pub display_name: Option<String>,
@@ -125,6 +243,54 @@ pub async fn update_profile(
     Ok(Json(user.into()))
 }
 
+// GET /api/auth/email-preferences - Which emails the player gets
+pub async fn get_email_preferences(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<EmailPreferences>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let preferences = UserRepository::get_email_preferences(&state.db, user.id).await?;
+
+    Ok(Json(preferences))
+}
+
+// PUT /api/auth/email-preferences - Opt in or out of emails
+pub async fn update_email_preferences(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Json(body): Json<UpdateEmailPreferencesRequest>,
+) -> AppResult<Json<EmailPreferences>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    if let Some(minutes) = body.attack_quiet_minutes {
+        if !(MIN_ATTACK_QUIET_MINUTES..=MAX_ATTACK_QUIET_MINUTES).contains(&minutes) {
+            return Err(AppError::ValidationError(format!(
+                "Quiet period must be between {} and {} minutes",
+                MIN_ATTACK_QUIET_MINUTES, MAX_ATTACK_QUIET_MINUTES
+            )));
+        }
+    }
+    if let Some(locale) = body.locale.as_deref() {
+        if !LOCALES.contains(&locale) {
+            return Err(AppError::ValidationError(format!(
+                "locale must be one of {}",
+                LOCALES.join(", ")
+            )));
+        }
+    }
+
+    let preferences = UserRepository::update_email_preferences(&state.db, user.id, &body).await?;
+
+    info!("Email preferences updated: {}", auth_user.firebase_uid);
+
+    Ok(Json(preferences))
+}
+
 // DELETE /api/auth/account - Soft delete user account
 pub async fn delete_account(
     State(state): State<AppState>,
@@ -138,3 +304,81 @@ pub async fn delete_account(
         "message": "Account deleted successfully"
     })))
 }
+
+// POST /api/auth/email-change - Mail a confirmation link to a new address
+pub async fn request_email_change(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Json(body): Json<RequestEmailChangeRequest>,
+) -> AppResult<Json<serde_json::Value>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    AccountService::request_email_change(&state, &user, &body.new_email).await?;
+
+    Ok(Json(serde_json::json!({ "success": true })))
+}
+
+// POST /api/auth/email-change/confirm - Apply an email change from the mailed link
+pub async fn confirm_email_change(
+    State(state): State<AppState>,
+    Json(body): Json<ConfirmTokenRequest>,
+) -> AppResult<Json<EmailChangeResponse>> {
+    let response = AccountService::confirm_email_change(&state, &body.token).await?;
+
+    Ok(Json(response))
+}
+
+// POST /api/auth/recovery - Mail a recovery link, if the address belongs to an account
+pub async fn request_recovery(
+    State(state): State<AppState>,
+    Json(body): Json<RequestRecoveryRequest>,
+) -> AppResult<Json<serde_json::Value>> {
+    AccountService::request_recovery(&state, &body.email).await?;
+
+    Ok(Json(serde_json::json!({ "success": true })))
+}
+
+// POST /api/auth/recovery/confirm - Restore the email and sign out every device
+pub async fn confirm_recovery(
+    State(state): State<AppState>,
+    Json(body): Json<ConfirmTokenRequest>,
+) -> AppResult<Json<EmailChangeResponse>> {
+    let response = AccountService::confirm_recovery(&state, &body.token).await?;
+
+    Ok(Json(response))
+}
+
+#[derive(Debug, Deserialize)]
+pub struct DevTokenRequest {
+    pub uid: String,
+    pub email: Option<String>,
+    pub name: Option<String>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct DevTokenResponse {
+    pub token: String,
+}
+
+// POST /api/auth/dev-token - Sign a local token for any uid (AUTH_PROVIDER=dev only)
+pub async fn dev_token(
+    State(state): State<AppState>,
+    Json(body): Json<DevTokenRequest>,
+) -> AppResult<Json<DevTokenResponse>> {
+    if state.config.firebase.auth_provider != "dev" {
+        return Err(AppError::NotFound("Not found".to_string()));
+    }
+    if body.uid.trim().is_empty() {
+        return Err(AppError::BadRequest("uid is required".to_string()));
+    }
+
+    let token = DevAuth::new(&state.config.jwt.secret).issue_token(
+        body.uid.trim(),
+        body.email,
+        body.name,
+    )?;
+
+    Ok(Json(DevTokenResponse { token }))
+}
@@ -0,0 +1,23 @@
+use axum::{extract::State, Extension, Json};
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::bootstrap::BootstrapResponse;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::bootstrap_service::BootstrapService;
+use crate::AppState;
+
+/// GET /api/v1/bootstrap - Account, villages, unread counts, movements and
+/// world status in one round trip, for client startup
+pub async fn bootstrap(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<BootstrapResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = BootstrapService::load(&state.db, db_user).await?;
+
+    Ok(Json(response))
+}
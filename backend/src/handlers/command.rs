@@ -0,0 +1,83 @@
+use axum::{
+    extract::{Path, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::command::{
+    CommandEnvelope, CommandResponse, PlayerCommand, ScheduleCommandRequest, ScheduledCommand,
+};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::command_service::CommandService;
+use crate::AppState;
+
+/// POST /api/v1/commands - Submit a gameplay command (idempotent by command_id)
+pub async fn submit_command(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(envelope): Json<CommandEnvelope>,
+) -> AppResult<Json<CommandResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = CommandService::execute(&state.db, db_user.id, envelope).await?;
+    Ok(Json(response))
+}
+
+/// GET /api/v1/commands/{id} - Get the outcome of a submitted command
+pub async fn get_command(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(command_id): Path<Uuid>,
+) -> AppResult<Json<PlayerCommand>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let command = CommandService::get_command(&state.db, db_user.id, command_id).await?;
+    Ok(Json(command))
+}
+
+/// GET /api/v1/commands/scheduled - Commands the player scheduled
+pub async fn list_scheduled(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<Vec<ScheduledCommand>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let scheduled = CommandService::list_scheduled(&state.db, db_user.id).await?;
+    Ok(Json(scheduled))
+}
+
+/// POST /api/v1/commands/scheduled - Schedule a gameplay command for later
+pub async fn schedule_command(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<ScheduleCommandRequest>,
+) -> AppResult<Json<ScheduledCommand>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let scheduled = CommandService::schedule(&state.db, db_user.id, request).await?;
+    Ok(Json(scheduled))
+}
+
+/// DELETE /api/v1/commands/scheduled/{id} - Cancel a pending scheduled command
+pub async fn cancel_scheduled(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<ScheduledCommand>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let scheduled = CommandService::cancel_scheduled(&state.db, db_user.id, id).await?;
+    Ok(Json(scheduled))
+}
@@ -0,0 +1,64 @@
+use axum::{
+    extract::State,
+    http::{header, HeaderMap},
+    response::IntoResponse,
+    Json,
+};
+
+use crate::db::query_metrics;
+use crate::error::{AppError, AppResult};
+use crate::middleware::{backpressure, concurrency};
+use crate::models::diagnostics::{BuildInfo, DiagnosticsDump, RuntimeVars};
+use crate::services::diagnostics_service::DiagnosticsService;
+use crate::services::invariant_service::InvariantService;
+use crate::services::lag_watchdog_service::LagWatchdogService;
+use crate::AppState;
+
+/// GET /debug/buildinfo - Git SHA, build time and uptime of this instance
+pub async fn build_info(State(state): State<AppState>) -> Json<BuildInfo> {
+    Json(DiagnosticsService::build_info(&state))
+}
+
+/// GET /debug/vars - Runtime, memory, pool, websocket and breaker counters
+pub async fn vars(State(state): State<AppState>) -> Json<RuntimeVars> {
+    Json(DiagnosticsService::runtime_vars(&state).await)
+}
+
+/// POST /debug/dump - Capture a diagnostics snapshot (also written to the log)
+pub async fn dump(State(state): State<AppState>) -> AppResult<Json<DiagnosticsDump>> {
+    let dump = DiagnosticsService::dump(&state).await?;
+    Ok(Json(dump))
+}
+
+/// GET /metrics - Prometheus scrape endpoint, guarded by METRICS_TOKEN
+pub async fn metrics(
+    State(state): State<AppState>,
+    headers: HeaderMap,
+) -> AppResult<impl IntoResponse> {
+    let expected = state
+        .config
+        .server
+        .metrics_token
+        .as_deref()
+        .ok_or_else(|| AppError::NotFound("Metrics are disabled".into()))?;
+
+    let token = headers
+        .get(header::AUTHORIZATION)
+        .and_then(|h| h.to_str().ok())
+        .and_then(|h| h.strip_prefix("Bearer "));
+    if token != Some(expected) {
+        return Err(AppError::Unauthorized);
+    }
+
+    Ok((
+        [(header::CONTENT_TYPE, "text/plain; version=0.0.4")],
+        format!(
+            "{}{}{}{}{}",
+            query_metrics::render_prometheus(),
+            LagWatchdogService::render_prometheus(),
+            backpressure::render_prometheus(),
+            concurrency::render_prometheus(),
+            InvariantService::render_prometheus()
+        ),
+    ))
+}
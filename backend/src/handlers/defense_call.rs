@@ -0,0 +1,138 @@
+use axum::{
+    extract::{Path, State},
+    http::HeaderMap,
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::AuthenticatedUser;
+use crate::models::defense_call::{
+    CreateDefenseCallRequest, DefenseCall, DefenseCallResponse, PledgeDefenseRequest,
+};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::activity_service::ActivityService;
+use crate::services::defense_call_service::DefenseCallService;
+use crate::AppState;
+
+// POST /api/defense-calls - Ask the alliance and its allies to reinforce a
+// village; whoever can land troops in time is told
+pub async fn create_call(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Json(body): Json<CreateDefenseCallRequest>,
+) -> AppResult<Json<DefenseCallResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let call = DefenseCallService::create(&state.db, &state.ws, user.id, body).await?;
+
+    Ok(Json(call))
+}
+
+// GET /api/defense-calls - Open calls the player can answer
+pub async fn list_calls(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<Vec<DefenseCall>>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let calls = DefenseCallService::list(&state.db, user.id).await?;
+
+    Ok(Json(calls))
+}
+
+// GET /api/defense-calls/:id - Pledged vs arrived troops, and who can still help
+pub async fn get_call(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<DefenseCallResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let call = DefenseCallService::get(&state.db, user.id, id).await?;
+
+    Ok(Json(call))
+}
+
+// DELETE /api/defense-calls/:id - Call it off (caller, leader or officer)
+pub async fn cancel_call(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<DefenseCallResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let call = DefenseCallService::cancel(&state.db, user.id, id).await?;
+
+    Ok(Json(call))
+}
+
+// POST /api/defense-calls/:id/pledges - Promise troops, sending them now
+// unless `send_later`
+pub async fn pledge(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+    headers: HeaderMap,
+    Json(body): Json<PledgeDefenseRequest>,
+) -> AppResult<Json<DefenseCallResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let call = DefenseCallService::pledge(
+        &state.db,
+        user.id,
+        id,
+        body,
+        ActivityService::origin(&headers),
+    )
+    .await?;
+
+    Ok(Json(call))
+}
+
+// POST /api/defense-calls/pledges/:pledge_id/send - Send the troops of a pledge
+pub async fn send_pledge(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(pledge_id): Path<Uuid>,
+    headers: HeaderMap,
+) -> AppResult<Json<DefenseCallResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let call = DefenseCallService::send_pledge(
+        &state.db,
+        user.id,
+        pledge_id,
+        ActivityService::origin(&headers),
+    )
+    .await?;
+
+    Ok(Json(call))
+}
+
+// DELETE /api/defense-calls/pledges/:pledge_id - Take back a pledge not yet sent
+pub async fn withdraw_pledge(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(pledge_id): Path<Uuid>,
+) -> AppResult<Json<()>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    DefenseCallService::withdraw(&state.db, user.id, pledge_id).await?;
+
+    Ok(Json(()))
+}
@@ -0,0 +1,25 @@
+use axum::{
+    extract::{Path, State},
+    Json,
+};
+use chrono::NaiveDate;
+
+use crate::error::AppResult;
+use crate::models::digest::WeeklyDigest;
+use crate::services::digest_service::DigestService;
+use crate::AppState;
+
+/// GET /api/digests/latest - The most recent weekly digest
+pub async fn get_latest_digest(State(state): State<AppState>) -> AppResult<Json<WeeklyDigest>> {
+    let digest = DigestService::latest(state.read_db.reader()).await?;
+    Ok(Json(digest))
+}
+
+/// GET /api/digests/{week_start} - The digest of the week starting on that Monday
+pub async fn get_digest(
+    State(state): State<AppState>,
+    Path(week_start): Path<NaiveDate>,
+) -> AppResult<Json<WeeklyDigest>> {
+    let digest = DigestService::get(state.read_db.reader(), week_start).await?;
+    Ok(Json(digest))
+}
@@ -0,0 +1,25 @@
+use axum::{
+    extract::{Query, State},
+    Extension, Json,
+};
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::economy::{LedgerEntry, TradeHistoryQuery};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::economy_service::EconomyService;
+use crate::AppState;
+
+/// GET /api/economy/history - Resources the player sent, received, plundered or lost
+pub async fn list_trade_history(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<TradeHistoryQuery>,
+) -> AppResult<Json<Vec<LedgerEntry>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let entries = EconomyService::history(&state.db, db_user.id, &query).await?;
+    Ok(Json(entries))
+}
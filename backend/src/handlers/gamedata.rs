@@ -0,0 +1,61 @@
+use axum::{
+    extract::{Query, State},
+    http::{header, HeaderMap, HeaderValue, StatusCode},
+    response::{IntoResponse, Response},
+    Json,
+};
+
+use crate::error::AppResult;
+use crate::models::gamedata::{GameDataQuery, GameDataVersion};
+use crate::services::gamedata_service::GameDataService;
+use crate::AppState;
+
+/// GET /api/v1/gamedata?version=<v> - Unit, building, tribe and item catalog.
+/// Pinned versions never change and are cacheable forever; the unpinned
+/// form revalidates by ETag.
+pub async fn get_gamedata(
+    State(state): State<AppState>,
+    headers: HeaderMap,
+    Query(query): Query<GameDataQuery>,
+) -> AppResult<Response> {
+    let pinned = query.version.is_some();
+    let catalog = GameDataService::get(&state.db, query.version.as_deref()).await?;
+
+    let etag = format!("\"{}\"", catalog.version);
+    let cache_control = if pinned {
+        "public, max-age=31536000, immutable"
+    } else {
+        "public, max-age=300"
+    };
+
+    let not_modified = headers
+        .get(header::IF_NONE_MATCH)
+        .and_then(|h| h.to_str().ok())
+        .is_some_and(|v| {
+            v.split(',')
+                .any(|t| t.trim().trim_start_matches("W/") == etag)
+        });
+
+    let mut response = if not_modified {
+        StatusCode::NOT_MODIFIED.into_response()
+    } else {
+        Json(catalog.data).into_response()
+    };
+
+    let response_headers = response.headers_mut();
+    response_headers.insert(
+        header::CACHE_CONTROL,
+        HeaderValue::from_static(cache_control),
+    );
+    if let Ok(value) = HeaderValue::from_str(&etag) {
+        response_headers.insert(header::ETAG, value);
+    }
+
+    Ok(response)
+}
+
+/// GET /api/v1/gamedata/versions - Published catalog versions, newest first
+pub async fn list_versions(State(state): State<AppState>) -> AppResult<Json<Vec<GameDataVersion>>> {
+    let versions = GameDataService::list_versions(&state.db).await?;
+    Ok(Json(versions))
+}
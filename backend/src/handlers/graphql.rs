@@ -0,0 +1,20 @@
+use async_graphql_axum::{GraphQLRequest, GraphQLResponse};
+use axum::extract::State;
+
+use crate::graphql;
+use crate::AppState;
+
+/// POST /api/graphql - Read-only query over public world data (needs X-Api-Key)
+pub async fn execute(State(state): State<AppState>, request: GraphQLRequest) -> GraphQLResponse {
+    // Rankings and the map tolerate replication lag
+    let pool = state.read_db.reader().clone();
+    graphql::schema()
+        .execute(request.into_inner().data(pool))
+        .await
+        .into()
+}
+
+/// GET /api/graphql/schema - The schema in SDL, for tool authors
+pub async fn schema() -> String {
+    graphql::schema().sdl()
+}
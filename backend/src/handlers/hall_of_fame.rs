@@ -0,0 +1,30 @@
+use axum::{
+    extract::{Path, Query, State},
+    Extension, Json,
+};
+
+use crate::error::AppResult;
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::hall_of_fame::{CareerResponse, HallOfFameEntry, HallOfFameQuery};
+use crate::services::hall_of_fame_service::HallOfFameService;
+use crate::AppState;
+
+/// GET /api/hall-of-fame/me - The player's results in every world they finished.
+/// Keyed by the Firebase account, so it works from the lobby before joining a world.
+pub async fn get_my_career(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<CareerResponse>> {
+    let career = HallOfFameService::career(&state.db, &user.firebase_uid).await?;
+    Ok(Json(career))
+}
+
+/// GET /api/hall-of-fame/worlds/{world_id} - Final standings of an ended world
+pub async fn get_world(
+    State(state): State<AppState>,
+    Path(world_id): Path<String>,
+    Query(query): Query<HallOfFameQuery>,
+) -> AppResult<Json<Vec<HallOfFameEntry>>> {
+    let entries = HallOfFameService::world(&state.db, &world_id, query.limit, query.offset).await?;
+    Ok(Json(entries))
+}
@@ -10,7 +10,8 @@ use crate::models::hero::{
     AssignAttributesRequest, AvailableAdventureResponse, ChangeHomeVillageRequest,
     CreateHeroRequest, EquipItemRequest, HeroAdventureResponse, HeroItemResponse, HeroListResponse,
     HeroResponse, HeroSlotPurchaseResponse, InventoryResponse, ItemSlot, ReviveHeroRequest,
-    ReviveInfoResponse, StartAdventureRequest, UnequipItemRequest, UseItemRequest,
+    ReviveInfoResponse, SetResourceFocusRequest, StartAdventureRequest, UnequipItemRequest,
+    UseItemRequest,
 };
 use crate::repositories::user_repo::UserRepository;
 use crate::services::hero_service::HeroService;
@@ -90,6 +91,35 @@ pub async fn assign_attributes(
     Ok(Json(hero))
 }
 
+/// PUT /api/heroes/{id}/resource-focus - Choose which resources the hero produces
+pub async fn set_resource_focus(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(hero_id): Path<Uuid>,
+    Json(request): Json<SetResourceFocusRequest>,
+) -> AppResult<Json<HeroResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let hero = HeroService::set_resource_focus(&state.db, db_user.id, hero_id, request).await?;
+    Ok(Json(hero))
+}
+
+/// POST /api/heroes/{id}/attributes/reset - Take back all assigned points
+pub async fn reset_attributes(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(hero_id): Path<Uuid>,
+) -> AppResult<Json<HeroResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let hero = HeroService::reset_attributes(&state.db, db_user.id, hero_id).await?;
+    Ok(Json(hero))
+}
+
 // ==================== Hero Slots ====================
 
 /// POST /api/heroes/slots/buy - Buy additional hero slot
@@ -0,0 +1,60 @@
+use axum::{
+    extract::{Path, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::AuthenticatedUser;
+use crate::models::hospital::{HealRequest, HealingQueueEntry, HospitalResponse};
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::hospital_service::HospitalService;
+use crate::AppState;
+
+// GET /api/villages/:village_id/hospital - Wounded troops, heal costs and healing in progress
+pub async fn get_hospital(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+) -> AppResult<Json<HospitalResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let response = HospitalService::get_hospital(&state.db, &village).await?;
+
+    Ok(Json(response))
+}
+
+// POST /api/villages/:village_id/hospital/heal - Pay to heal wounded troops
+pub async fn heal_troops(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+    Json(req): Json<HealRequest>,
+) -> AppResult<Json<HealingQueueEntry>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let entry = HospitalService::heal(&state.db, &village, req.troop_type, req.count).await?;
+
+    Ok(Json(entry))
+}
@@ -0,0 +1,62 @@
+use axum::{
+    extract::{Path, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::AuthenticatedUser;
+use crate::models::market::{MarketResponse, ResourceShipment, SendResourcesRequest};
+use crate::models::village::Village;
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::market_service::MarketService;
+use crate::AppState;
+
+/// The village, if it belongs to the authenticated player
+async fn owned_village(
+    state: &AppState,
+    auth_user: &AuthenticatedUser,
+    village_id: Uuid,
+) -> AppResult<Village> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    Ok(village)
+}
+
+// GET /api/villages/:village_id/market - Merchants and shipments
+pub async fn get_market(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+) -> AppResult<Json<MarketResponse>> {
+    let village = owned_village(&state, &auth_user, village_id).await?;
+
+    let response = MarketService::get_market(&state.db, &village).await?;
+
+    Ok(Json(response))
+}
+
+// POST /api/villages/:village_id/market/send - Send resources to another village
+pub async fn send_resources(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+    Json(request): Json<SendResourcesRequest>,
+) -> AppResult<Json<ResourceShipment>> {
+    let village = owned_village(&state, &auth_user, village_id).await?;
+
+    let shipment = MarketService::send(&state.db, &village, request).await?;
+
+    Ok(Json(shipment))
+}
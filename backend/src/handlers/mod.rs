@@ -1,21 +1,54 @@
+mod activity;
+mod admin;
 mod alliance;
 mod army;
+mod auction;
 mod auth;
+mod bootstrap;
 mod building;
+mod command;
+pub mod debug;
+mod defense_call;
+mod digest;
+mod economy;
+mod gamedata;
+mod graphql;
+mod hall_of_fame;
 mod hero;
+mod hospital;
+mod market;
 mod message;
+mod note;
+mod oasis;
+mod ranking;
+mod referral;
+mod region;
+mod registration;
+mod research;
+mod search;
 mod shop;
+mod social;
+pub mod sse;
+mod sync;
 mod troop;
 mod village;
+mod wave;
+mod world;
 pub mod ws;
 
 use axum::{middleware, routing::{delete, get, post, put}, Router};
 
-use crate::middleware::auth_middleware;
+use crate::middleware::{
+    admin_middleware, api_key_middleware, auth_middleware, backpressure_middleware,
+    captcha_middleware, etag_middleware, login_captcha_middleware, with_limits,
+    world_pause_middleware,
+};
 use crate::AppState;
 
 pub fn routes(state: AppState) -> Router<AppState> {
-    Router::new()
+    let limits = state.config.limits.clone();
+
+    let api = Router::new()
         .nest("/auth", auth_routes(state.clone()))
         .nest("/villages", village_routes(state.clone()))
         .nest("/map", map_routes(state.clone()))
@@ -23,30 +56,121 @@ pub fn routes(state: AppState) -> Router<AppState> {
         .nest("/reports", report_routes(state.clone()))
         .nest("/scout-reports", scout_report_routes(state.clone()))
         .nest("/armies", army_routes(state.clone()))
+        .nest("/waves", wave_routes(state.clone()))
+        .nest("/defense-calls", defense_call_routes(state.clone()))
+        .nest("/oases", oasis_routes(state.clone()))
         .nest("/support-sent", support_routes(state.clone()))
         .nest("/alliances", alliance_routes(state.clone()))
         .nest("/messages", message_routes(state.clone()))
         .nest("/conversations", conversation_routes(state.clone()))
         .nest("/alliance-messages", alliance_message_routes(state.clone()))
+        .nest("/social", social_routes(state.clone()))
+        .nest("/notes", note_routes(state.clone()))
+        .nest("/activity", activity_routes(state.clone()))
+        .nest("/referrals", referral_routes(state.clone()))
+        .nest("/hall-of-fame", hall_of_fame_routes(state.clone()))
+        .nest("/digests", digest_routes(state.clone()))
+        .nest("/economy", economy_routes(state.clone()))
         .nest("/shop", shop_routes(state.clone()))
         .nest("/heroes", hero_routes(state.clone()))
+        .nest("/auctions", auction_routes(state.clone()))
+        .nest("/search", search_routes(state.clone()))
+        .nest("/rankings", ranking_routes(state.clone()))
+        .nest("/regions", region_routes(state.clone()))
+        .nest("/registration", registration_routes(state.clone()))
+        .nest("/world", world_routes())
+        .nest("/graphql", graphql_routes(state.clone()))
+        .nest("/v1", v1_routes(state.clone()))
         // Public routes (no auth required)
-        .merge(public_routes())
+        .merge(public_routes());
+
+    // Admin routes are nested after the gameplay limits are applied, so
+    // only their own (longer) limits wrap them and they are never shed or
+    // paused
+    with_limits(api, limits.api)
+        .layer(middleware::from_fn(world_pause_middleware))
+        .layer(middleware::from_fn(backpressure_middleware))
+        .nest("/admin", with_limits(admin_routes(state), limits.admin))
+}
+
+/// Admin-only diagnostics, mounted at /debug outside /api
+pub fn debug_routes(state: AppState) -> Router<AppState> {
+    let limits = state.config.limits.admin;
+
+    let routes = Router::new()
+        .route("/buildinfo", get(debug::build_info))
+        .route("/vars", get(debug::vars))
+        .route("/dump", post(debug::dump))
+        .route_layer(middleware::from_fn_with_state(state.clone(), admin_middleware))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware));
+    with_limits(routes, limits)
+}
+
+fn v1_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/bootstrap", get(bootstrap::bootstrap))
+        .route("/sync", get(sync::sync))
+        .route(
+            "/commands",
+            post(command::submit_command)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        .route("/commands/{id}", get(command::get_command))
+        .route("/commands/scheduled", get(command::list_scheduled))
+        .route(
+            "/commands/scheduled",
+            post(command::schedule_command)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        .route("/commands/scheduled/{id}", delete(command::cancel_scheduled))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+        // Public: added after the auth route_layer so it isn't wrapped by it
+        .route("/gamedata", get(gamedata::get_gamedata))
+        .route("/gamedata/versions", get(gamedata::list_versions))
+        .route("/time", get(world::get_time))
+}
+
+/// Community tools authenticate with an API key rather than a player login
+fn graphql_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", post(graphql::execute))
+        .route_layer(middleware::from_fn_with_state(state, api_key_middleware))
+        // Public: added after the key route_layer so it isn't wrapped by it
+        .route("/schema", get(graphql::schema))
 }
 
 fn public_routes() -> Router<AppState> {
     Router::new()
         .route("/troops/definitions", get(troop::get_definitions))
+        .route_layer(middleware::from_fn(etag_middleware))
 }
 
 fn auth_routes(state: AppState) -> Router<AppState> {
     Router::new()
         .route("/me", get(auth::me))
-        .route("/sync", post(auth::sync_user))
+        .route(
+            "/sync",
+            post(auth::sync_user).route_layer(middleware::from_fn_with_state(
+                state.clone(),
+                login_captcha_middleware,
+            )),
+        )
         .route("/profile", put(auth::update_profile))
+        .route("/email-preferences", get(auth::get_email_preferences))
+        .route("/email-preferences", put(auth::update_email_preferences))
+        .route("/tribe", put(auth::change_tribe))
         .route("/account", delete(auth::delete_account))
         .route("/logout", delete(auth::logout))
+        .route("/sessions", get(auth::list_sessions))
+        .route("/sessions/{id}", delete(auth::revoke_session))
+        .route("/email-change", post(auth::request_email_change))
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+        // Added after the auth layer so they stay unauthenticated; the
+        // mailed token is the proof
+        .route("/dev-token", post(auth::dev_token))
+        .route("/email-change/confirm", post(auth::confirm_email_change))
+        .route("/recovery", post(auth::request_recovery))
+        .route("/recovery/confirm", post(auth::confirm_recovery))
 }
 
 fn village_routes(state: AppState) -> Router<AppState> {
@@ -55,28 +179,57 @@ fn village_routes(state: AppState) -> Router<AppState> {
         .route("/", post(village::create_village))
         .route("/{id}", get(village::get_village))
         .route("/{id}", put(village::update_village))
+        .route("/{id}/capital", post(village::set_capital))
         // Building routes nested under village
         .route("/{village_id}/buildings", get(building::list_buildings))
         .route("/{village_id}/buildings/queue", get(building::get_build_queue))
         .route("/{village_id}/buildings/{slot}", post(building::build))
         .route("/{village_id}/buildings/{slot}/upgrade", post(building::upgrade))
         .route("/{village_id}/buildings/{slot}", delete(building::demolish))
+        .route("/{village_id}/build-queue", get(building::get_build_slots))
+        .route("/{village_id}/build-queue/{order_id}", delete(building::cancel_build_order))
         // Troop routes nested under village
         .route("/{village_id}/troops", get(troop::list_troops))
         .route("/{village_id}/troops/queue", get(troop::get_training_queue))
         .route("/{village_id}/troops/train", post(troop::train_troops))
         .route("/{village_id}/troops/queue/{queue_id}", delete(troop::cancel_training))
+        .route("/{village_id}/troops/transfer", post(army::transfer_troops))
+        // Academy research
+        .route("/{village_id}/research", get(research::get_academy))
+        .route("/{village_id}/research", post(research::start_research))
+        // Hospital
+        .route("/{village_id}/hospital", get(hospital::get_hospital))
+        .route("/{village_id}/hospital/heal", post(hospital::heal_troops))
         // Army routes nested under village
-        .route("/{village_id}/armies", post(army::send_army))
+        .route(
+            "/{village_id}/armies",
+            post(army::send_army)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        .route("/{village_id}/armies/plan", post(army::plan_army))
+        .route("/{village_id}/armies/prepare", post(army::prepare_army))
         .route("/{village_id}/armies/outgoing", get(army::list_outgoing))
         .route("/{village_id}/armies/incoming", get(army::list_incoming))
         .route("/{village_id}/stationed", get(army::list_stationed))
+        .route("/{village_id}/rally-point", get(army::get_rally_point))
+        // Merchants
+        .route("/{village_id}/market", get(market::get_market))
+        .route(
+            "/{village_id}/market/send",
+            post(market::send_resources)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        // Oases held by the village
+        .route("/{village_id}/oases", get(oasis::list_village_oases))
+        .route("/{village_id}/oases/{oasis_id}", delete(oasis::abandon_oasis))
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
 
 fn map_routes(state: AppState) -> Router<AppState> {
     Router::new()
         .route("/", get(village::get_map))
+        .route("/croppers", get(village::find_croppers))
+        .route_layer(middleware::from_fn(etag_middleware))
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
 
@@ -91,6 +244,7 @@ fn report_routes(state: AppState) -> Router<AppState> {
         .route("/", get(army::list_reports))
         .route("/unread-count", get(army::get_unread_count))
         .route("/{report_id}", get(army::get_report))
+        .route("/{report_id}", delete(army::delete_report))
         .route("/{report_id}/read", post(army::mark_report_read))
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
@@ -99,6 +253,7 @@ fn scout_report_routes(state: AppState) -> Router<AppState> {
     Router::new()
         .route("/", get(army::list_scout_reports))
         .route("/{report_id}", get(army::get_scout_report))
+        .route("/{report_id}", delete(army::delete_scout_report))
         .route("/{report_id}/read", post(army::mark_scout_report_read))
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
@@ -106,6 +261,46 @@ fn scout_report_routes(state: AppState) -> Router<AppState> {
 fn army_routes(state: AppState) -> Router<AppState> {
     Router::new()
         .route("/{army_id}/recall", post(army::recall_support))
+        .route("/{army_id}/cancel", post(army::cancel_army))
+        .route("/{army_id}/merge", post(army::merge_stationed))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn wave_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(wave::list_waves))
+        .route(
+            "/",
+            post(wave::plan_wave)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        .route("/{id}", delete(wave::cancel_wave))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn defense_call_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", post(defense_call::create_call))
+        .route("/", get(defense_call::list_calls))
+        .route("/{id}", get(defense_call::get_call))
+        .route("/{id}", delete(defense_call::cancel_call))
+        .route(
+            "/{id}/pledges",
+            post(defense_call::pledge)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        .route(
+            "/pledges/{pledge_id}/send",
+            post(defense_call::send_pledge)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        .route("/pledges/{pledge_id}", delete(defense_call::withdraw_pledge))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn oasis_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/{id}", get(oasis::get_oasis))
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
 
@@ -136,6 +331,28 @@ fn alliance_routes(state: AppState) -> Router<AppState> {
         // Diplomacy
         .route("/{id}/diplomacy", get(alliance::list_diplomacy))
         .route("/{id}/diplomacy", post(alliance::set_diplomacy))
+        // Merges
+        .route("/{id}/merges", get(alliance::list_merges))
+        .route("/{id}/merges", post(alliance::propose_merge))
+        .route("/merges/{merge_id}/respond", post(alliance::respond_merge))
+        .route("/merges/{merge_id}", delete(alliance::cancel_merge))
+        // Weekly stats
+        .route("/{id}/stats", get(alliance::get_stats))
+        .route("/{id}/awards", get(alliance::list_awards))
+        // Operations
+        .route("/{id}/operations", get(alliance::list_operations))
+        .route("/{id}/operations", post(alliance::create_operation))
+        .route("/operations/{operation_id}", get(alliance::get_operation))
+        .route("/operations/{operation_id}", delete(alliance::cancel_operation))
+        .route(
+            "/operations/{operation_id}/signups",
+            post(alliance::sign_up_operation)
+                .route_layer(middleware::from_fn_with_state(state.clone(), captcha_middleware)),
+        )
+        .route(
+            "/operations/{operation_id}/signups/{signup_id}",
+            delete(alliance::withdraw_operation_signup),
+        )
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
 
@@ -167,6 +384,59 @@ fn alliance_message_routes(state: AppState) -> Router<AppState> {
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
 
+fn social_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(social::get_panel))
+        .route("/friends", post(social::request_friend))
+        .route("/friends/{user_id}/accept", post(social::accept_friend))
+        .route("/friends/{user_id}", delete(social::remove_friend))
+        .route("/blocks", post(social::block_player))
+        .route("/blocks/{user_id}", delete(social::unblock_player))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn note_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(note::list_notes))
+        .route("/", post(note::create_note))
+        .route("/{id}", put(note::update_note))
+        .route("/{id}", delete(note::delete_note))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn activity_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(activity::list_activity))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn referral_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(referral::get_referral_stats))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn hall_of_fame_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/me", get(hall_of_fame::get_my_career))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+        // Added after the auth layer so it stays public
+        .route("/worlds/{world_id}", get(hall_of_fame::get_world))
+}
+
+fn digest_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/latest", get(digest::get_latest_digest))
+        .route("/{week_start}", get(digest::get_digest))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn economy_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/history", get(economy::list_trade_history))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
 fn shop_routes(state: AppState) -> Router<AppState> {
     Router::new()
         // Public routes
@@ -181,6 +451,7 @@ fn shop_routes(state: AppState) -> Router<AppState> {
         .route("/transactions", get(shop::get_transactions))
         // Gold features
         .route("/features/finish-now", post(shop::use_finish_now))
+        .route("/features/finish-now/cost", get(shop::get_finish_now_cost))
         .route("/features/npc-merchant", post(shop::use_npc_merchant))
         .route("/features/production-bonus", post(shop::use_production_bonus))
         .route("/features/book-of-wisdom", post(shop::use_book_of_wisdom))
@@ -195,6 +466,8 @@ fn hero_routes(state: AppState) -> Router<AppState> {
         .route("/{id}", get(hero::get_hero))
         .route("/{id}/home", put(hero::change_home_village))
         .route("/{id}/attributes", put(hero::assign_attributes))
+        .route("/{id}/attributes/reset", post(hero::reset_attributes))
+        .route("/{id}/resource-focus", put(hero::set_resource_focus))
         // Hero Slots
         .route("/slots/buy", post(hero::buy_hero_slot))
         // Inventory
@@ -212,3 +485,184 @@ fn hero_routes(state: AppState) -> Router<AppState> {
         .route("/{id}/revive", post(hero::revive_hero))
         .route_layer(middleware::from_fn_with_state(state, auth_middleware))
 }
+
+fn auction_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(auction::list_auctions))
+        .route("/", post(auction::create_auction))
+        .route("/mine", get(auction::my_auctions))
+        .route("/{id}", delete(auction::cancel_auction))
+        .route("/{id}/bids", post(auction::place_bid))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn search_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/messages", get(search::search_messages))
+        .route("/reports", get(search::search_reports))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn ranking_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/players", get(ranking::list_player_rankings))
+        .route("/players/{user_id}", get(ranking::get_player_stats))
+        .route("/alliances", get(ranking::list_alliance_rankings))
+        .route("/top", get(ranking::get_world_rankings))
+        .route("/stats", get(ranking::get_world_stats))
+        .route_layer(middleware::from_fn(etag_middleware))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn region_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(region::list_regions))
+        .route("/leaderboard", get(region::get_leaderboard))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+// Public so the lobby can show a world's progress before joining, and so
+// anyone can fetch the world dumps
+fn registration_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        .route("/", get(registration::get_status))
+        .route("/", post(registration::pre_register))
+        .route("/", delete(registration::leave))
+        .route("/groups", post(registration::create_group))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
+
+fn world_routes() -> Router<AppState> {
+    Router::new()
+        .route("/status", get(world::get_world_status))
+        .route("/dumps", get(world::list_dumps))
+        .route("/dumps/{id}/download", get(world::download_dump))
+}
+
+fn admin_routes(state: AppState) -> Router<AppState> {
+    Router::new()
+        // Report retention
+        .route("/reports/retention", get(admin::get_report_retention))
+        .route("/reports/retention", put(admin::update_report_retention))
+        .route("/reports/retention/run", post(admin::run_report_retention))
+        .route("/reports/archives", get(admin::list_report_archives))
+        // Gray zone
+        .route("/inactivity", get(admin::get_inactivity))
+        .route("/inactivity", put(admin::update_inactivity))
+        .route("/inactivity/run", post(admin::run_inactivity))
+        // Anti-pushing
+        .route("/anti-pushing", get(admin::get_anti_pushing))
+        .route("/anti-pushing", put(admin::update_anti_pushing))
+        .route("/anti-pushing/report", get(admin::anti_pushing_report))
+        // Region control
+        .route("/region-control", get(admin::get_region_control))
+        .route("/region-control", put(admin::update_region_control))
+        .route("/region-control/run", post(admin::run_region_control))
+        // World timeline
+        .route("/world-timeline", get(admin::get_world_timeline))
+        .route("/world-timeline", put(admin::update_world_timeline))
+        // Registration
+        .route("/registration", get(admin::get_registration))
+        .route("/registration", put(admin::update_registration))
+        .route("/registration/overview", get(admin::registration_overview))
+        .route("/registration/waves", post(admin::schedule_registration_wave))
+        .route("/registration/waves/{id}", delete(admin::cancel_registration_wave))
+        .route("/registration/waves/{id}/release", post(admin::release_registration_wave))
+        // Economy ledger
+        .route("/economy/flows", get(admin::list_economy_flows))
+        .route("/players/{user_id}/ledger", get(admin::list_player_ledger))
+        // Player snapshots
+        .route("/players/{user_id}/snapshots", post(admin::create_player_snapshot))
+        .route("/players/{user_id}/snapshots", get(admin::list_player_snapshots))
+        .route("/players/{user_id}/restore", post(admin::restore_player_snapshot))
+        .route("/snapshots/{id}", get(admin::get_snapshot))
+        // API keys for the GraphQL read API
+        .route("/api-keys", get(admin::list_api_keys))
+        .route("/api-keys", post(admin::create_api_key))
+        .route("/api-keys/{id}", delete(admin::revoke_api_key))
+        // Live-ops health
+        .route("/ops-metrics", get(admin::get_ops_metrics))
+        .route("/ops-metrics/{world_id}", get(admin::get_world_ops_metrics))
+        .route("/catch-up", post(admin::run_catch_up))
+        // Impersonation
+        .route("/players/{user_id}/impersonate", post(admin::start_impersonation))
+        .route("/impersonations", get(admin::list_impersonations))
+        .route("/impersonations/{id}", delete(admin::end_impersonation))
+        // Soft delete
+        .route("/soft-delete", get(admin::get_soft_delete))
+        .route("/soft-delete", put(admin::update_soft_delete))
+        .route("/soft-delete/run", post(admin::run_soft_delete_purge))
+        .route("/players/{user_id}/deleted", get(admin::list_player_deleted))
+        .route("/deleted/{kind}/{id}/restore", post(admin::restore_deleted))
+        // Action log
+        .route("/players/{user_id}/actions", get(admin::list_player_actions))
+        .route("/players/{user_id}/actions/replay", post(admin::replay_player_actions))
+        // Read models
+        .route("/projections/rebuild", post(admin::rebuild_projections))
+        // World ticks
+        .route("/ticks", get(admin::list_tick_shards))
+        // Failed queue items
+        .route("/job-failures", get(admin::list_job_failures))
+        .route("/job-failures/{id}/retry", post(admin::retry_job_failure))
+        // Audit log
+        .route("/audit", get(admin::search_audit_log))
+        // Runtime config
+        .route("/runtime-config", get(admin::get_runtime_config))
+        .route("/runtime-config", put(admin::update_runtime_config))
+        // Data migrations
+        .route("/data-migrations", get(admin::list_data_migrations))
+        .route("/data-migrations/{name}/runs", post(admin::start_data_migration))
+        .route("/data-migration-runs", get(admin::list_data_migration_runs))
+        .route("/data-migration-runs/{id}", get(admin::get_data_migration_run))
+        .route("/data-migration-runs/{id}/changes", get(admin::list_data_migration_changes))
+        .route("/data-migration-runs/{id}/resume", post(admin::resume_data_migration_run))
+        .route("/data-migration-runs/{id}/rollback", post(admin::rollback_data_migration_run))
+        // Invariants
+        .route("/invariants", get(admin::get_invariant_report))
+        .route("/invariants/check", post(admin::run_invariant_check))
+        .route("/invariants/settings", get(admin::get_invariant_settings))
+        .route("/invariants/settings", put(admin::update_invariant_settings))
+        // Message templates
+        .route("/templates", get(admin::list_templates))
+        .route("/templates/{name}", get(admin::get_template))
+        .route("/templates/{name}/versions", post(admin::publish_template))
+        .route("/templates/{name}/revert", post(admin::revert_template))
+        .route("/templates/{name}/preview", post(admin::preview_template))
+        // Game clock
+        .route("/clock", get(admin::get_clock))
+        .route("/clock/advance", post(admin::advance_clock))
+        .route("/clock/pause", post(admin::pause_world))
+        .route("/clock/resume", post(admin::resume_world))
+        // World shards
+        .route("/shards", get(admin::list_world_shards))
+        .route("/shards/{world_id}", put(admin::upsert_world_shard))
+        .route("/shards/{world_id}/migrate", post(admin::migrate_world_shard))
+        .route("/shards/{world_id}/finish", post(admin::finish_world))
+        // World statistics
+        .route("/world-stats/refresh", post(admin::refresh_world_stats))
+        // Public world dumps
+        .route("/world-dumps/run", post(admin::run_world_dump))
+        // Weekly digest
+        .route("/digests/generate", post(admin::generate_digest))
+        // Oases
+        .route("/oases/seed", post(admin::seed_oases))
+        // Bot detection
+        .route("/bot-review", get(admin::list_bot_suspicions))
+        .route("/bot-review/scan", post(admin::scan_for_bots))
+        .route("/bot-review/{user_id}", put(admin::review_bot_suspicion))
+        // IP reputation
+        .route("/ip-reputation", get(admin::get_ip_reputation))
+        .route("/ip-reputation", put(admin::update_ip_reputation))
+        .route("/ip-ranges", get(admin::list_ip_ranges))
+        .route("/ip-ranges", post(admin::import_ip_ranges))
+        .route("/ip-ranges/{id}", delete(admin::delete_ip_range))
+        .route("/ip-check/{ip}", get(admin::check_ip))
+        // Sign-in accounts
+        .route("/auth-users", post(admin::create_test_user))
+        .route("/auth-users/lookup", post(admin::lookup_auth_users))
+        .route("/players/{user_id}/disabled", put(admin::set_player_disabled))
+        .route("/players/{user_id}/claims", put(admin::set_player_claims))
+        // Admin check runs after auth (route layers wrap outward)
+        .route_layer(middleware::from_fn_with_state(state.clone(), admin_middleware))
+        .route_layer(middleware::from_fn_with_state(state, auth_middleware))
+}
@@ -0,0 +1,69 @@
+use axum::{
+    extract::{Path, Query, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::note::{CreateNoteRequest, NoteQuery, NoteResponse, UpdateNoteRequest};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::note_service::NoteService;
+use crate::AppState;
+
+/// GET /api/notes - Notes on a village or player, or all readable notes
+pub async fn list_notes(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<NoteQuery>,
+) -> AppResult<Json<Vec<NoteResponse>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let notes = NoteService::list(&state.db, db_user.id, query).await?;
+    Ok(Json(notes))
+}
+
+/// POST /api/notes - Write a note, optionally shared with the alliance
+pub async fn create_note(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<CreateNoteRequest>,
+) -> AppResult<Json<NoteResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let note = NoteService::create(&state.db, db_user.id, request).await?;
+    Ok(Json(note))
+}
+
+/// PUT /api/notes/:id - Edit a note or change who it is shared with
+pub async fn update_note(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(note_id): Path<Uuid>,
+    Json(request): Json<UpdateNoteRequest>,
+) -> AppResult<Json<NoteResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let note = NoteService::update(&state.db, db_user.id, note_id, request).await?;
+    Ok(Json(note))
+}
+
+/// DELETE /api/notes/:id - Delete a note
+pub async fn delete_note(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(note_id): Path<Uuid>,
+) -> AppResult<Json<()>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    NoteService::delete(&state.db, db_user.id, note_id).await?;
+    Ok(Json(()))
+}
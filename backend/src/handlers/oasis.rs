@@ -0,0 +1,69 @@
+use axum::{
+    extract::{Path, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::AuthenticatedUser;
+use crate::models::oasis::{OasisResponse, VillageOasesResponse};
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::oasis_service::OasisService;
+use crate::AppState;
+
+// GET /api/oases/:id - Oasis details, including its animals
+pub async fn get_oasis(
+    State(state): State<AppState>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<OasisResponse>> {
+    let oasis = OasisService::get_oasis(&state.db, id).await?;
+
+    Ok(Json(oasis))
+}
+
+// GET /api/villages/:village_id/oases - Oases held by a village and their bonus
+pub async fn list_village_oases(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+) -> AppResult<Json<VillageOasesResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let response = OasisService::get_village_oases(&state.db, village_id).await?;
+
+    Ok(Json(response))
+}
+
+// DELETE /api/villages/:village_id/oases/:oasis_id - Abandon an oasis
+pub async fn abandon_oasis(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path((village_id, oasis_id)): Path<(Uuid, Uuid)>,
+) -> AppResult<Json<OasisResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let response = OasisService::abandon(&state.db, village_id, oasis_id).await?;
+
+    Ok(Json(response))
+}
@@ -0,0 +1,83 @@
+use axum::{
+    extract::{Path, Query, State},
+    Extension, Json,
+};
+use std::collections::BTreeMap;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::note::NoteTarget;
+use crate::models::projection::{
+    PlayerProfile, RankedAlliance, RankedPlayer, RankingQuery, WorldRanking,
+};
+use crate::models::world_stats::{WorldStatsQuery, WorldStatsResponse};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::note_service::NoteService;
+use crate::services::projection_service::ProjectionService;
+use crate::services::world_stats_service::WorldStatsService;
+use crate::AppState;
+
+/// GET /api/rankings/players - Players ranked by population
+pub async fn list_player_rankings(
+    State(state): State<AppState>,
+    Query(query): Query<RankingQuery>,
+) -> AppResult<Json<Vec<RankedPlayer>>> {
+    let players =
+        ProjectionService::player_rankings(state.read_db.reader(), query.limit, query.offset)
+            .await?;
+    Ok(Json(players))
+}
+
+/// GET /api/rankings/alliances - Alliances ranked by total population
+pub async fn list_alliance_rankings(
+    State(state): State<AppState>,
+    Query(query): Query<RankingQuery>,
+) -> AppResult<Json<Vec<RankedAlliance>>> {
+    let alliances =
+        ProjectionService::alliance_rankings(state.read_db.reader(), query.limit, query.offset)
+            .await?;
+    Ok(Json(alliances))
+}
+
+/// GET /api/rankings/top - World top-10s by category
+pub async fn get_world_rankings(
+    State(state): State<AppState>,
+) -> AppResult<Json<BTreeMap<String, Vec<WorldRanking>>>> {
+    let rankings = CacheService::get_or_load(CacheKey::TopRankings, || {
+        ProjectionService::world_rankings(state.read_db.reader())
+    })
+    .await?;
+    Ok(Json(rankings))
+}
+
+/// GET /api/rankings/players/{user_id} - One player's statistics
+pub async fn get_player_stats(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(user_id): Path<Uuid>,
+) -> AppResult<Json<PlayerProfile>> {
+    let stats = ProjectionService::player_stats(state.read_db.reader(), user_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Player not found".into()))?;
+
+    let viewer = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+    let viewer = NoteService::viewer(&state.db, viewer.id).await?;
+    let notes =
+        NoteService::for_targets(&state.db, &viewer, NoteTarget::Player, &[user_id]).await?;
+
+    Ok(Json(PlayerProfile { stats, notes }))
+}
+
+/// GET /api/rankings/stats - World statistics: active players over time, tribes,
+/// troops killed per day and the week's top attackers and defenders
+pub async fn get_world_stats(
+    State(state): State<AppState>,
+    Query(query): Query<WorldStatsQuery>,
+) -> AppResult<Json<WorldStatsResponse>> {
+    let stats = WorldStatsService::overview(state.read_db.reader(), query.days).await?;
+    Ok(Json(stats))
+}
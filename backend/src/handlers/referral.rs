@@ -0,0 +1,21 @@
+use axum::{extract::State, Extension, Json};
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::referral::ReferralStatsResponse;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::referral_service::ReferralService;
+use crate::AppState;
+
+/// GET /api/referrals - The player's referral code, link and the players it brought in
+pub async fn get_referral_stats(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<ReferralStatsResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let stats = ReferralService::stats(&state.db, db_user.id).await?;
+    Ok(Json(stats))
+}
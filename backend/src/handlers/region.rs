@@ -0,0 +1,18 @@
+use axum::{extract::State, Json};
+
+use crate::error::AppResult;
+use crate::models::region::{RegionLeaderboard, RegionOverview};
+use crate::services::region_service::RegionService;
+use crate::AppState;
+
+/// GET /api/regions - Every region of the map and who holds it
+pub async fn list_regions(State(state): State<AppState>) -> AppResult<Json<RegionOverview>> {
+    let overview = RegionService::overview(&state.db).await?;
+    Ok(Json(overview))
+}
+
+/// GET /api/regions/leaderboard - Alliances by victory points, and the winner once there is one
+pub async fn get_leaderboard(State(state): State<AppState>) -> AppResult<Json<RegionLeaderboard>> {
+    let leaderboard = RegionService::leaderboard(&state.db).await?;
+    Ok(Json(leaderboard))
+}
@@ -0,0 +1,71 @@
+use axum::{extract::State, Extension, Json};
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::AuthenticatedUser;
+use crate::models::registration::{
+    CreateRegistrationGroupRequest, PreRegisterRequest, RegistrationStatus,
+};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::registration_service::RegistrationService;
+use crate::AppState;
+
+// GET /api/registration - Queue length, quadrant room, the next invite wave
+// and the player's own place in line
+pub async fn get_status(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<RegistrationStatus>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let status = RegistrationService::status(&state.db, user.id).await?;
+
+    Ok(Json(status))
+}
+
+// POST /api/registration - Pre-register, alone or with a group's code
+pub async fn pre_register(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Json(body): Json<PreRegisterRequest>,
+) -> AppResult<Json<RegistrationStatus>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let status = RegistrationService::pre_register(&state.db, user.id, body).await?;
+
+    Ok(Json(status))
+}
+
+// DELETE /api/registration - Leave the queue; a leader leaving disbands
+// their group
+pub async fn leave(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<()>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    RegistrationService::leave(&state.db, user.id).await?;
+
+    Ok(Json(()))
+}
+
+// POST /api/registration/groups - Register as a group, holding places for
+// its members in one quadrant
+pub async fn create_group(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Json(body): Json<CreateRegistrationGroupRequest>,
+) -> AppResult<Json<RegistrationStatus>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let status = RegistrationService::create_group(&state.db, user.id, body).await?;
+
+    Ok(Json(status))
+}
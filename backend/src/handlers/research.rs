@@ -0,0 +1,60 @@
+use axum::{
+    extract::{Path, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::AuthenticatedUser;
+use crate::models::research::{AcademyResponse, ResearchQueueEntry, StartResearchRequest};
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::research_service::ResearchService;
+use crate::AppState;
+
+// GET /api/villages/:village_id/research - Researched units, research in progress and what's left
+pub async fn get_academy(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+) -> AppResult<Json<AcademyResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let response = ResearchService::get_academy(&state.db, &village).await?;
+
+    Ok(Json(response))
+}
+
+// POST /api/villages/:village_id/research - Start researching a unit
+pub async fn start_research(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+    Json(req): Json<StartResearchRequest>,
+) -> AppResult<Json<ResearchQueueEntry>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let entry = ResearchService::start(&state.db, &village, req.troop_type).await?;
+
+    Ok(Json(entry))
+}
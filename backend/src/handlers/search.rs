@@ -0,0 +1,55 @@
+use axum::{
+    extract::{Query, State},
+    Extension, Json,
+};
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::search::{
+    MessageSearchQuery, MessageSearchResult, ReportSearchQuery, ReportSearchResult,
+};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::search_service::SearchService;
+use crate::AppState;
+
+/// GET /api/search/messages - Search own and alliance messages
+pub async fn search_messages(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<MessageSearchQuery>,
+) -> AppResult<Json<Vec<MessageSearchResult>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let results = SearchService::search_messages(
+        state.read_db.reader(),
+        &state.config.search.language,
+        db_user.id,
+        query,
+    )
+    .await?;
+
+    Ok(Json(results))
+}
+
+/// GET /api/search/reports - Search own battle reports
+pub async fn search_reports(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<ReportSearchQuery>,
+) -> AppResult<Json<Vec<ReportSearchResult>>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let results = SearchService::search_reports(
+        state.read_db.reader(),
+        &state.config.search.language,
+        db_user.id,
+        query,
+    )
+    .await?;
+
+    Ok(Json(results))
+}
@@ -10,11 +10,12 @@ use uuid::Uuid;
 use crate::error::{AppError, AppResult};
 use crate::middleware::auth::AuthenticatedUser;
 use crate::models::shop::{
-    BuySubscriptionRequest, CheckoutResponse, GoldBalanceResponse, GoldPackage,
+    BuySubscriptionRequest, CheckoutResponse, FinishNowQuote, GoldBalanceResponse, GoldPackage,
     PurchaseGoldRequest, SubscriptionPrice, TransactionResponse, UseBookOfWisdomRequest,
     UseFeatureResponse, UseFinishNowRequest, UseNpcMerchantRequest, UseProductionBonusRequest,
 };
 use crate::repositories::user_repo::UserRepository;
+use crate::services::runtime_config_service;
 use crate::services::shop_service::ShopService;
 use crate::AppState;
 
@@ -61,20 +62,34 @@ pub async fn create_checkout(
         .await?
         .ok_or(AppError::Unauthorized)?;
 
-    // Get Stripe client from config
-    let stripe_secret = std::env::var("STRIPE_SECRET_KEY")
-        .map_err(|_| AppError::InternalError(anyhow::anyhow!("Stripe not configured")))?;
+    if !runtime_config_service::current().features.shop {
+        return Err(AppError::ServiceUnavailable(
+            "The shop is temporarily unavailable".into(),
+        ));
+    }
+
+    // Get Stripe client from config; a managed key may have been rotated since startup
+    let stripe_secret = state
+        .secrets
+        .get("STRIPE_SECRET_KEY")
+        .or_else(|| state.config.stripe.secret_key.clone())
+        .ok_or_else(|| AppError::InternalError(anyhow::anyhow!("Stripe not configured")))?;
     let stripe_client = stripe_rust::Client::new(stripe_secret);
 
-    let checkout = ShopService::create_checkout(
-        &state.db,
-        &stripe_client,
-        db_user.id,
-        request.package_id,
-        &request.success_url,
-        &request.cancel_url,
-    )
-    .await?;
+    // Fails fast while Stripe is down; gameplay and gold spending are unaffected
+    let checkout = state
+        .stripe_breaker
+        .call(|| {
+            ShopService::create_checkout(
+                &state.db,
+                &stripe_client,
+                db_user.id,
+                request.package_id,
+                &request.success_url,
+                &request.cancel_url,
+            )
+        })
+        .await?;
 
     Ok(Json(checkout))
 }
@@ -90,8 +105,11 @@ pub async fn stripe_webhook(
         .and_then(|v| v.to_str().ok())
         .ok_or_else(|| AppError::BadRequest("Missing Stripe signature".into()))?;
 
-    let webhook_secret = std::env::var("STRIPE_WEBHOOK_SECRET")
-        .map_err(|_| AppError::InternalError(anyhow::anyhow!("Webhook secret not configured")))?;
+    let webhook_secret = state
+        .secrets
+        .get("STRIPE_WEBHOOK_SECRET")
+        .or_else(|| state.config.stripe.webhook_secret.clone())
+        .ok_or_else(|| AppError::InternalError(anyhow::anyhow!("Webhook secret not configured")))?;
 
     let payload = std::str::from_utf8(&body)
         .map_err(|_| AppError::BadRequest("Invalid payload".into()))?;
@@ -128,6 +146,22 @@ pub async fn buy_subscription(
 
 // ==================== Gold Features ====================
 
+/// GET /api/shop/features/finish-now/cost - Price of finishing building/training now
+pub async fn get_finish_now_cost(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<UseFinishNowRequest>,
+) -> AppResult<Json<FinishNowQuote>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let quote =
+        ShopService::finish_now_quote(&state.db, db_user.id, query.target_type, query.target_id)
+            .await?;
+    Ok(Json(quote))
+}
+
 /// POST /api/shop/features/finish-now - Finish building/training instantly
 pub async fn use_finish_now(
     State(state): State<AppState>,
@@ -141,7 +175,7 @@ pub async fn use_finish_now(
     let result = ShopService::use_finish_now(
         &state.db,
         db_user.id,
-        &request.target_type,
+        request.target_type,
         request.target_id,
     )
     .await?;
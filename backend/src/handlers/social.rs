@@ -0,0 +1,95 @@
+use axum::{
+    extract::{Path, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::social::{Friendship, SocialPanelResponse, SocialTargetRequest};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::social_service::SocialService;
+use crate::AppState;
+
+/// GET /api/social - Friends, pending requests and blocked players
+pub async fn get_panel(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<SocialPanelResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let panel = SocialService::get_panel(&state.db, db_user.id).await?;
+    Ok(Json(panel))
+}
+
+/// POST /api/social/friends - Send a friend request
+pub async fn request_friend(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<SocialTargetRequest>,
+) -> AppResult<Json<Friendship>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let friendship = SocialService::request_friend(&state.db, db_user.id, request.user_id).await?;
+    Ok(Json(friendship))
+}
+
+/// POST /api/social/friends/:user_id/accept - Accept a friend request
+pub async fn accept_friend(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(requester_id): Path<Uuid>,
+) -> AppResult<Json<Friendship>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let friendship = SocialService::accept_friend(&state.db, db_user.id, requester_id).await?;
+    Ok(Json(friendship))
+}
+
+/// DELETE /api/social/friends/:user_id - Remove a friend, or cancel or decline a request
+pub async fn remove_friend(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(other_id): Path<Uuid>,
+) -> AppResult<Json<()>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    SocialService::remove_friend(&state.db, db_user.id, other_id).await?;
+    Ok(Json(()))
+}
+
+/// POST /api/social/blocks - Block a player
+pub async fn block_player(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Json(request): Json<SocialTargetRequest>,
+) -> AppResult<Json<()>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    SocialService::block(&state.db, db_user.id, request.user_id).await?;
+    Ok(Json(()))
+}
+
+/// DELETE /api/social/blocks/:user_id - Unblock a player
+pub async fn unblock_player(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Path(blocked_id): Path<Uuid>,
+) -> AppResult<Json<()>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    SocialService::unblock(&state.db, db_user.id, blocked_id).await?;
+    Ok(Json(()))
+}
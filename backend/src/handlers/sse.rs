@@ -0,0 +1,78 @@
+use axum::{
+    extract::{Query, State},
+    http::HeaderMap,
+    response::sse::{Event, KeepAlive, Sse},
+};
+use futures_util::stream::{self, Stream};
+use serde::Deserialize;
+use std::convert::Infallible;
+use tracing::{error, warn};
+
+use crate::error::AppError;
+use crate::handlers::ws::authenticate_ws;
+use crate::services::ws_protocol;
+use crate::services::ws_service::QueuedEvent;
+use crate::AppState;
+
+#[derive(Debug, Deserialize)]
+pub struct SseQuery {
+    token: Option<String>,
+    /// Id of the last event seen, for clients managing their own reconnects
+    resume: Option<String>,
+}
+
+/// GET /sse - The /ws event stream over Server-Sent Events, for networks
+/// that block WebSockets. Read-only: commands go through the REST API.
+pub async fn sse_handler(
+    headers: HeaderMap,
+    Query(query): Query<SseQuery>,
+    State(state): State<AppState>,
+) -> Result<Sse<impl Stream<Item = Result<Event, Infallible>>>, AppError> {
+    let user_id = authenticate_ws(query.token.as_deref(), &state)
+        .await
+        .map_err(|e| {
+            warn!("SSE auth failed: {}", e);
+            AppError::Unauthorized
+        })?;
+
+    // EventSource sends the last id it saw when it reconnects by itself
+    let resume = headers
+        .get("last-event-id")
+        .and_then(|v| v.to_str().ok())
+        .map(str::to_string)
+        .or(query.resume);
+
+    let subscription = state
+        .ws
+        .subscribe(user_id, ws_protocol::CURRENT_VERSION, resume)
+        .await;
+
+    let events = stream::unfold(subscription, |mut subscription| async move {
+        loop {
+            let queued = subscription.next().await?;
+            if let Some(event) = to_sse_event(&queued) {
+                return Some((Ok(event), subscription));
+            }
+        }
+    });
+
+    Ok(Sse::new(events).keep_alive(KeepAlive::default()))
+}
+
+fn to_sse_event(queued: &QueuedEvent) -> Option<Event> {
+    let (message_type, payload) = match ws_protocol::split(&queued.event) {
+        Ok(split) => split,
+        Err(e) => {
+            error!("Failed to serialize WsEvent: {}", e);
+            return None;
+        }
+    };
+
+    let event = Event::default()
+        .event(message_type)
+        .data(payload.to_string());
+    Some(match &queued.id {
+        Some(id) => event.id(id),
+        None => event,
+    })
+}
@@ -0,0 +1,26 @@
+use axum::{
+    extract::{Query, State},
+    Extension, Json,
+};
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::domain_event::{SyncQuery, SyncResponse};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::sync_service::SyncService;
+use crate::AppState;
+
+/// GET /api/v1/sync?since=<cursor> - Changes to the player's entities since the cursor
+pub async fn sync(
+    State(state): State<AppState>,
+    Extension(user): Extension<AuthenticatedUser>,
+    Query(query): Query<SyncQuery>,
+) -> AppResult<Json<SyncResponse>> {
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = SyncService::sync(&state.db, db_user.id, query).await?;
+
+    Ok(Json(response))
+}
@@ -8,11 +8,21 @@ use uuid::Uuid;
 
 use crate::error::{AppError, AppResult};
 use crate::middleware::AuthenticatedUser;
-use crate::models::village::{CreateVillage, ProductionRates, UpdateVillage, VillageResponse};
+use crate::models::note::{NoteResponse, NoteTarget};
+use crate::models::oasis::OasisType;
+use crate::models::village::{
+    culture_points_for_village, CreateVillage, CropperTile, FieldType, ProductionRates, Quadrant,
+    UpdateVillage, VillageResponse,
+};
+use crate::repositories::oasis_repo::OasisRepository;
 use crate::repositories::user_repo::UserRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::note_service::NoteService;
+use crate::services::registration_service::RegistrationService;
 use crate::services::resource_service::ResourceService;
 use crate::services::village_service::VillageService;
+use crate::services::village_stats_service::VillageStatsService;
 use crate::AppState;
 
 // GET /api/villages - List current user's villages
@@ -61,6 +71,7 @@ pub async fn get_village(
         crop_per_hour: production.crop_per_hour,
         crop_consumption: production.crop_consumption,
         net_crop_per_hour: production.net_crop_per_hour,
+        breakdown: production.breakdown,
     };
 
     let response: VillageResponse = village.into();
@@ -70,11 +81,14 @@ pub async fn get_village(
 #[derive(Debug, Deserialize)]
 pub struct CreateVillageRequest {
     pub name: String,
-    pub x: i32,
-    pub y: i32,
+    /// Required when settling; the first village is placed by the server
+    pub x: Option<i32>,
+    pub y: Option<i32>,
+    /// Where the first village should go; anywhere when absent
+    pub quadrant: Option<Quadrant>,
 }
 
-// POST /api/villages - Create new village (for settling)
+// POST /api/villages - Create the first village, or a new one when settling
 pub async fn create_village(
     State(state): State<AppState>,
     Extension(auth_user): Extension<AuthenticatedUser>,
@@ -84,25 +98,52 @@ pub async fn create_village(
         .await?
         .ok_or(AppError::Unauthorized)?;
 
-    // Check if coordinates are available
-    if !VillageRepository::is_coordinate_available(&state.db, body.x, body.y).await? {
-        return Err(AppError::Conflict("Coordinates already occupied".to_string()));
-    }
-
     // Check if this is the first village (capital)
     let village_count = VillageRepository::count_by_user_id(&state.db, user.id).await?;
     let is_capital = village_count == 0;
 
-    let create_village = CreateVillage {
-        user_id: user.id,
-        name: body.name,
-        x: body.x,
-        y: body.y,
-        is_capital,
-    };
+    // The first village goes where the placement service puts it, once the
+    // player is let in and the quadrant has room
+    let (village, buildings) = if is_capital {
+        RegistrationService::found_capital(&state.db, user.id, body.name, body.quadrant).await?
+    } else {
+        let (x, y) = match (body.x, body.y) {
+            (Some(x), Some(y)) => (x, y),
+            _ => {
+                return Err(AppError::BadRequest(
+                    "Coordinates are required to settle a new village".into(),
+                ))
+            }
+        };
+
+        // Check if coordinates are available
+        if !VillageRepository::is_coordinate_available(&state.db, x, y).await? {
+            return Err(AppError::Conflict("Coordinates already occupied".to_string()));
+        }
 
-    // Create village with initial buildings
-    let (village, buildings) = VillageService::create_village_with_buildings(&state.db, create_village).await?;
+        // Further villages need culture points
+        let (allowed, culture_points) =
+            VillageStatsService::expansion_slots(&state.db, user.id).await?;
+        if village_count >= allowed {
+            return Err(AppError::BadRequest(format!(
+                "Not enough culture points for another village ({} needed, {} earned)",
+                culture_points_for_village(village_count + 1),
+                culture_points
+            )));
+        }
+
+        let create_village = CreateVillage {
+            user_id: user.id,
+            name: body.name,
+            x,
+            y,
+            is_capital,
+            field_type: FieldType::at(x, y),
+        };
+
+        // Create village with initial buildings
+        VillageService::create_village_with_buildings(&state.db, create_village).await?
+    };
 
     info!(
         "Village created: {} at ({}, {}) for user {} with {} initial buildings",
@@ -137,7 +178,30 @@ pub async fn update_village(
     }
 
     let update = UpdateVillage { name: body.name };
-    let updated = VillageRepository::update(&state.db, village_id, update).await?;
+    let updated = VillageRepository::update(&state.db, village_id, village.version, update).await?;
+
+    Ok(Json(updated.into()))
+}
+
+// POST /api/villages/:id/capital - Make the village the player's capital
+pub async fn set_capital(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(village_id): Path<Uuid>,
+) -> AppResult<Json<VillageResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let village = VillageRepository::find_by_id(&state.db, village_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+    if village.user_id != user.id {
+        return Err(AppError::Forbidden("Access denied".into()));
+    }
+
+    let updated = VillageService::set_capital(&state.db, &village).await?;
 
     Ok(Json(updated.into()))
 }
@@ -160,7 +224,10 @@ fn default_range() -> i32 {
 pub struct MapTileResponse {
     pub x: i32,
     pub y: i32,
+    /// Resource fields of the tile; none on an oasis
+    pub field_type: Option<FieldType>,
     pub village: Option<MapVillageInfo>,
+    pub oasis: Option<MapOasisInfo>,
 }
 
 #[derive(Debug, Serialize)]
@@ -170,6 +237,16 @@ pub struct MapVillageInfo {
     pub player_name: Option<String>,
     pub population: i32,
     pub is_own: bool,
+    /// Readable notes on the village and on its owner
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub notes: Vec<NoteResponse>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct MapOasisInfo {
+    pub id: Uuid,
+    pub oasis_type: OasisType,
+    pub occupied: bool,
 }
 
 // GET /api/map - Get map tiles around coordinates
@@ -185,7 +262,26 @@ pub async fn get_map(
     // Limit range to prevent abuse
     let range = query.range.min(15).max(1);
 
-    let villages = VillageRepository::find_in_range(&state.db, query.x, query.y, range).await?;
+    let area = CacheKey::MapArea {
+        x: query.x,
+        y: query.y,
+        range,
+    };
+    let villages = CacheService::get_or_load(area, || {
+        VillageRepository::find_in_range(state.read_db.reader(), query.x, query.y, range)
+    })
+    .await?;
+    let oases =
+        OasisRepository::find_in_range(state.read_db.reader(), query.x, query.y, range).await?;
+
+    let viewer = NoteService::viewer(&state.db, user.id).await?;
+    let village_ids: Vec<Uuid> = villages.iter().map(|v| v.id).collect();
+    let owner_ids: Vec<Uuid> = villages.iter().map(|v| v.user_id).collect();
+    let mut notes =
+        NoteService::for_targets(&state.db, &viewer, NoteTarget::Village, &village_ids).await?;
+    notes.extend(
+        NoteService::for_targets(&state.db, &viewer, NoteTarget::Player, &owner_ids).await?,
+    );
 
     // Generate tiles for the range
     let mut tiles = Vec::new();
@@ -195,16 +291,35 @@ pub async fn get_map(
             let y = query.y + dy;
 
             let village = villages.iter().find(|v| v.x == x && v.y == y);
+            let oasis = oases.iter().find(|o| o.x == x && o.y == y);
+
+            // A village keeps the fields it was founded with
+            let field_type = match (village, oasis) {
+                (Some(v), _) => Some(v.field_type),
+                (None, Some(_)) => None,
+                (None, None) => Some(FieldType::at(x, y)),
+            };
 
             tiles.push(MapTileResponse {
                 x,
                 y,
+                field_type,
                 village: village.map(|v| MapVillageInfo {
                     id: v.id,
                     name: v.name.clone(),
                     player_name: v.player_name.clone(),
                     population: v.population,
                     is_own: v.user_id == user.id,
+                    notes: notes
+                        .iter()
+                        .filter(|n| n.target_id == v.id || n.target_id == v.user_id)
+                        .cloned()
+                        .collect(),
+                }),
+                oasis: oasis.map(|o| MapOasisInfo {
+                    id: o.id,
+                    oasis_type: o.oasis_type,
+                    occupied: o.owner_village_id.is_some(),
                 }),
             });
         }
@@ -212,3 +327,27 @@ pub async fn get_map(
 
     Ok(Json(tiles))
 }
+
+#[derive(Debug, Deserialize)]
+pub struct CropperQuery {
+    pub x: i32,
+    pub y: i32,
+    #[serde(default = "default_cropper_range")]
+    pub range: i32,
+}
+
+fn default_cropper_range() -> i32 {
+    15
+}
+
+// GET /api/map/croppers - Free 9- and 15-cropper tiles around coordinates
+pub async fn find_croppers(
+    State(state): State<AppState>,
+    Query(query): Query<CropperQuery>,
+) -> AppResult<Json<Vec<CropperTile>>> {
+    let croppers =
+        VillageService::find_croppers(state.read_db.reader(), query.x, query.y, query.range)
+            .await?;
+
+    Ok(Json(croppers))
+}
@@ -0,0 +1,57 @@
+use axum::{
+    extract::{Path, State},
+    Extension, Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::AuthenticatedUser;
+use crate::models::wave::{PlanWaveRequest, WavePlanResponse, WaveResponse};
+use crate::repositories::user_repo::UserRepository;
+use crate::services::wave_service::WaveService;
+use crate::AppState;
+
+// POST /api/waves - Work out send times for armies to land together; with
+// `schedule` the server sends each army at its time
+pub async fn plan_wave(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Json(body): Json<PlanWaveRequest>,
+) -> AppResult<Json<WavePlanResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let response = WaveService::plan(&state.db, user.id, body).await?;
+
+    Ok(Json(response))
+}
+
+// GET /api/waves - The player's scheduled waves and how their sends went
+pub async fn list_waves(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+) -> AppResult<Json<Vec<WaveResponse>>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let waves = WaveService::list(&state.db, user.id).await?;
+
+    Ok(Json(waves))
+}
+
+// DELETE /api/waves/:id - Cancel the sends of a wave that haven't left yet
+pub async fn cancel_wave(
+    State(state): State<AppState>,
+    Extension(auth_user): Extension<AuthenticatedUser>,
+    Path(id): Path<Uuid>,
+) -> AppResult<Json<WaveResponse>> {
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let wave = WaveService::cancel(&state.db, user.id, id).await?;
+
+    Ok(Json(wave))
+}
@@ -0,0 +1,68 @@
+use axum::{
+    extract::{Path, Query, State},
+    http::header,
+    response::IntoResponse,
+    Json,
+};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::world_dump::{DumpDownloadQuery, WorldDumpLink};
+use crate::models::world_status::{TimeSyncQuery, WorldStatusResponse};
+use crate::services::archive_store::ArchiveStore;
+use crate::services::clock::{self, ClockService};
+use crate::services::world_dump_service::WorldDumpService;
+use crate::services::world_status_service::WorldStatusService;
+use crate::AppState;
+
+/// GET /api/world/status - Days elapsed, endgame milestones with countdowns,
+/// and the victory standings
+pub async fn get_world_status(
+    State(state): State<AppState>,
+) -> AppResult<Json<WorldStatusResponse>> {
+    let status = WorldStatusService::status(&state.db).await?;
+    Ok(Json(status))
+}
+
+/// GET /api/v1/time - Game time with round-trip hints, so client countdowns
+/// don't depend on the device clock
+pub async fn get_time(Query(query): Query<TimeSyncQuery>) -> impl IntoResponse {
+    let received = clock::now();
+    let sync = ClockService::time_sync(query.client_time, received);
+    ([(header::CACHE_CONTROL, "no-store")], Json(sync))
+}
+
+/// GET /api/world/dumps - Recent public world dumps with signed download links
+pub async fn list_dumps(State(state): State<AppState>) -> AppResult<Json<Vec<WorldDumpLink>>> {
+    let links = WorldDumpService::links(&state.db, &state.config.jwt.secret).await?;
+    Ok(Json(links))
+}
+
+/// GET /api/world/dumps/{id}/download - The gzipped dump behind a signed link
+pub async fn download_dump(
+    State(state): State<AppState>,
+    Path(id): Path<Uuid>,
+    Query(query): Query<DumpDownloadQuery>,
+) -> AppResult<impl IntoResponse> {
+    let store = ArchiveStore::from_config(&state.config.archive)?
+        .ok_or_else(|| AppError::NotFound("World dumps are not enabled".into()))?;
+    let (dump, body) =
+        WorldDumpService::download(&state.db, &store, &state.config.jwt.secret, id, &query)
+            .await?;
+
+    let filename = format!(
+        "map-{}.{}.gz",
+        dump.created_at.format("%Y-%m-%d"),
+        dump.format
+    );
+    Ok((
+        [
+            (header::CONTENT_TYPE, "application/gzip".to_string()),
+            (
+                header::CONTENT_DISPOSITION,
+                format!("attachment; filename=\"{}\"", filename),
+            ),
+        ],
+        body,
+    ))
+}
@@ -1,23 +1,31 @@
 use axum::{
     extract::{
-        ws::{Message, WebSocket, WebSocketUpgrade},
+        ws::{close_code, CloseFrame, Message, WebSocket, WebSocketUpgrade},
         Query, State,
     },
     response::Response,
 };
 use futures_util::{SinkExt, StreamExt};
 use serde::Deserialize;
+use tokio::sync::mpsc;
 use tracing::{debug, error, info, warn};
 use uuid::Uuid;
 
-use crate::middleware::auth::FirebaseAuth;
+use crate::models::activity::RequestOrigin;
 use crate::repositories::user_repo::UserRepository;
-use crate::services::ws_service::{WsEvent, WsManager};
+use crate::services::clock::{self, ClockService};
+use crate::services::session_service::SessionService;
+use crate::services::ws_protocol::{self, ClientMessage};
+use crate::services::ws_service::{QueuedEvent, WsEvent, WsManager};
 use crate::AppState;
 
 #[derive(Debug, Deserialize)]
 pub struct WsQuery {
     token: Option<String>,
+    /// Highest protocol version the client speaks; absent means v1
+    v: Option<u32>,
+    /// Id of the last event the client saw before it lost the connection
+    resume: Option<String>,
 }
 
 /// WebSocket upgrade handler
@@ -27,7 +35,7 @@ pub async fn ws_handler(
     State(state): State<AppState>,
 ) -> Response {
     // Authenticate user from token
-    let user_id = match authenticate_ws(&query, &state).await {
+    let user_id = match authenticate_ws(query.token.as_deref(), &state).await {
         Ok(id) => id,
         Err(e) => {
             warn!("WebSocket auth failed: {}", e);
@@ -38,26 +46,44 @@ pub async fn ws_handler(
         }
     };
 
+    let version = match ws_protocol::negotiate(query.v) {
+        Ok(v) => v,
+        Err(reason) => {
+            warn!("WebSocket version rejected for user {}: {}", user_id, reason);
+            return ws.on_upgrade(|mut socket| async move {
+                let _ = socket
+                    .send(Message::Close(Some(CloseFrame {
+                        code: close_code::PROTOCOL,
+                        reason: reason.into(),
+                    })))
+                    .await;
+            });
+        }
+    };
+
     let ws_manager = state.ws.clone();
-    ws.on_upgrade(move |socket| handle_socket(socket, user_id, ws_manager))
+    ws.on_upgrade(move |socket| {
+        handle_socket(socket, user_id, version, query.resume, ws_manager)
+    })
 }
 
-/// Authenticate WebSocket connection using Firebase token
-async fn authenticate_ws(query: &WsQuery, state: &AppState) -> Result<Uuid, String> {
-    let token = query
-        .token
-        .as_ref()
-        .ok_or_else(|| "Missing token".to_string())?;
+/// Authenticate a WebSocket (or SSE) connection using Firebase token, which
+/// browsers can only pass in the query string
+pub(crate) async fn authenticate_ws(token: Option<&str>, state: &AppState) -> Result<Uuid, String> {
+    let token = token.ok_or_else(|| "Missing token".to_string())?;
 
-    let firebase_auth = FirebaseAuth::new(state.config.firebase.project_id.clone());
-
-    let claims = firebase_auth
+    let auth_user = state
+        .auth
         .verify_token(token)
         .await
         .map_err(|e| format!("Invalid token: {:?}", e))?;
 
+    SessionService::track(&state.db, &auth_user, &RequestOrigin::default())
+        .await
+        .map_err(|e| format!("Session rejected: {:?}", e))?;
+
     // Get user from database
-    let user = UserRepository::find_by_firebase_uid(&state.db, &claims.sub)
+    let user = UserRepository::find_by_firebase_uid(&state.db, &auth_user.firebase_uid)
         .await
         .map_err(|e| format!("Database error: {:?}", e))?
         .ok_or_else(|| "User not found".to_string())?;
@@ -66,22 +92,41 @@ async fn authenticate_ws(query: &WsQuery, state: &AppState) -> Result<Uuid, Stri
 }
 
 /// Handle WebSocket connection
-async fn handle_socket(socket: WebSocket, user_id: Uuid, ws_manager: WsManager) {
+async fn handle_socket(
+    socket: WebSocket,
+    user_id: Uuid,
+    version: u32,
+    resume: Option<String>,
+    ws_manager: WsManager,
+) {
     let (mut sender, mut receiver) = socket.split();
 
-    // Register this connection
-    let mut rx = ws_manager.register(user_id).await;
+    let mut subscription = ws_manager.subscribe(user_id, version, resume).await;
+    // Answers to this connection's own messages (pongs)
+    let (reply_tx, mut reply_rx) = mpsc::unbounded_channel::<WsEvent>();
 
-    // Send connected event
-    let connected_event = WsEvent::Connected { user_id };
-    if let Ok(json) = serde_json::to_string(&connected_event) {
-        let _ = sender.send(Message::Text(json)).await;
-    }
-
-    // Spawn task to forward messages from manager to WebSocket
+    // Spawn task to frame events for this connection's protocol version
+    // and forward them: connected, then anything replayed, then live events
     let send_task = tokio::spawn(async move {
-        while let Some(msg) = rx.recv().await {
-            if sender.send(msg).await.is_err() {
+        let mut seq = 0u64;
+
+        loop {
+            let queued = tokio::select! {
+                queued = subscription.next() => match queued {
+                    Some(queued) => queued,
+                    None => break,
+                },
+                Some(event) = reply_rx.recv() => QueuedEvent { id: None, event },
+            };
+            let json = match ws_protocol::encode(&queued, version, seq + 1) {
+                Ok(json) => json,
+                Err(e) => {
+                    error!("Failed to serialize WsEvent: {}", e);
+                    continue;
+                }
+            };
+            seq += 1;
+            if sender.send(Message::Text(json)).await.is_err() {
                 break;
             }
         }
@@ -94,10 +139,15 @@ async fn handle_socket(socket: WebSocket, user_id: Uuid, ws_manager: WsManager)
                 Ok(Message::Text(text)) => {
                     debug!("Received from user {}: {}", user_id, text);
                     // Handle client messages if needed (e.g., ping, subscribe to specific events)
-                    if let Ok(msg) = serde_json::from_str::<ClientMessage>(&text) {
+                    if let Ok(msg) = ws_protocol::decode(&text, version) {
                         match msg {
-                            ClientMessage::Ping => {
+                            ClientMessage::Ping { client_time } => {
                                 debug!("Ping from user {}", user_id);
+                                let received = clock::now();
+                                let _ = reply_tx.send(WsEvent::Pong(ClockService::time_sync(
+                                    client_time,
+                                    received,
+                                )));
                             }
                             ClientMessage::Subscribe { event_type } => {
                                 debug!("User {} subscribed to {}", user_id, event_type);
@@ -134,11 +184,3 @@ async fn handle_socket(socket: WebSocket, user_id: Uuid, ws_manager: WsManager)
 
     info!("WebSocket connection closed: user_id={}", user_id);
 }
-
-/// Client message types
-#[derive(Debug, serde::Deserialize)]
-#[serde(tag = "type", rename_all = "snake_case")]
-enum ClientMessage {
-    Ping,
-    Subscribe { event_type: String },
-}
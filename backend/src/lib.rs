@@ -0,0 +1,47 @@
+//! Game server library: everything but the process entry point, so
+//! integration tests under tests/ can drive the same services and
+//! repositories the server runs.
+
+pub mod config;
+pub mod db;
+pub mod error;
+pub mod graphql;
+pub mod handlers;
+pub mod middleware;
+pub mod models;
+pub mod repositories;
+pub mod server;
+pub mod services;
+pub mod telemetry;
+pub mod testing;
+
+use std::sync::Arc;
+
+use services::ws_service::WsManager;
+
+#[derive(Clone)]
+pub struct AppState {
+    pub db: sqlx::PgPool,
+    /// Replica-routed pool for heavy reads that tolerate replication lag
+    pub read_db: db::replica::ReadPool,
+    /// Per-world databases for world-scoped reads (hall of fame, ops
+    /// metrics); gameplay always uses `db`
+    pub shards: db::shard::ShardResolver,
+    pub redis: db::redis::RedisConnection,
+    pub config: config::Config,
+    /// Current values of secrets managed by a secret manager
+    pub secrets: config::SecretStore,
+    pub ws: WsManager,
+    /// Firebase, or the dev provider when AUTH_PROVIDER=dev
+    pub auth: Arc<dyn middleware::auth::AuthProvider>,
+    /// Guards calls to the Stripe API
+    pub stripe_breaker: services::circuit_breaker::CircuitBreaker,
+    /// None when captchas are off
+    pub captcha: Option<services::captcha::CaptchaVerifier>,
+    /// None when no IP intelligence provider is configured
+    pub ip_intel: Option<services::ip_intel::IpIntelClient>,
+    /// None when email isn't configured
+    pub mailer: Option<services::mailer::Mailer>,
+    /// None unless players sign in with Firebase
+    pub user_admin: Option<Arc<dyn services::firebase_admin::UserAdmin>>,
+}
@@ -1,85 +1,260 @@
-mod config;
-mod db;
-mod error;
-mod handlers;
-mod middleware;
-mod models;
-mod repositories;
-mod services;
-
-use axum::{routing::get, Router};
-use std::net::SocketAddr;
-use tower_http::cors::CorsLayer;
+use axum::{
+    extract::{MatchedPath, Request},
+    http::StatusCode,
+    response::{IntoResponse, Response},
+    routing::get,
+    Json, Router,
+};
+use sentry::integrations::tower::{NewSentryLayer, SentryHttpLayer};
+use std::any::Any;
+use std::sync::Arc;
+use std::time::Duration;
+use tower_http::catch_panic::CatchPanicLayer;
+use tower_http::compression::CompressionLayer;
 use tower_http::trace::TraceLayer;
-use tracing::info;
+use tracing::{info, warn, Span};
+use tracing_subscriber::filter::{self, LevelFilter, Targets};
+use tracing_subscriber::layer::SubscriberExt;
+use tracing_subscriber::reload;
+use tracing_subscriber::util::SubscriberInitExt;
+use tracing_subscriber::Layer;
 
-use services::ws_service::WsManager;
+use backend::services::ws_service::WsManager;
+use backend::{config, db, error, handlers, middleware, server, services, AppState};
 
 #[tokio::main]
 async fn main() -> anyhow::Result<()> {
-    // Initialize tracing
-    tracing_subscriber::fmt()
-        .with_env_filter(
-            tracing_subscriber::EnvFilter::try_from_default_env()
-                .unwrap_or_else(|_| "backend=debug,tower_http=debug".into()),
-        )
-        .init();
-
     // Load environment variables
     dotenvy::dotenv().ok();
 
-    // Load configuration
-    let config = config::Config::from_env()?;
+    // Load configuration, resolving secrets from GCP Secret Manager / Vault
+    let (config, secrets) = config::Config::load().await?;
+
+    // Error reporting first, so startup failures are captured too
+    let _sentry = error::reporting::init(&config);
+
+    // Initialize tracing. Query metrics get sqlx's statement events
+    // regardless of the log filter; request, job and query spans are
+    // exported over OTLP when an endpoint is configured.
+    let log_filter = std::env::var("RUST_LOG")
+        .unwrap_or_else(|_| "backend=debug,tower_http=debug,slow_query=warn".to_string());
+    let (filter_layer, filter_handle) =
+        reload::Layer::new(tracing_subscriber::EnvFilter::new(&log_filter));
+    let (otel_layer, _telemetry) = match backend::telemetry::init(&config)? {
+        Some((layer, guard)) => (Some(layer), Some(guard)),
+        None => (None, None),
+    };
+    tracing_subscriber::registry()
+        .with(tracing_subscriber::fmt::layer().with_filter(filter_layer))
+        .with(
+            // Spans pass the filter too, so a query span can find its parent
+            db::query_metrics::QueryMetricsLayer.with_filter(filter::filter_fn(|meta| {
+                meta.is_span() || meta.target() == "sqlx::query"
+            })),
+        )
+        .with(sentry::integrations::tracing::layer())
+        .with(otel_layer.map(|layer| {
+            layer.with_filter(
+                Targets::new()
+                    .with_target("backend", LevelFilter::INFO)
+                    .with_target("tower_http", LevelFilter::INFO),
+            )
+        }))
+        .init();
+
+    // Admins can swap the log filter at runtime (see runtime_config_service)
+    services::runtime_config_service::set_log_reloader(log_filter, move |directives| {
+        filter_handle.reload(tracing_subscriber::EnvFilter::try_new(directives)?)?;
+        Ok(())
+    });
 
     info!("Tusk & Horn Server Starting...");
+    std::sync::LazyLock::force(&services::diagnostics_service::STARTED_AT);
 
-    // Initialize database connections
-    let db_pool = db::postgres::create_pool(&config.database).await?;
-    let redis_pool = db::redis::create_pool(&config.redis).await?;
+    // Refuse to start on broken balance data rather than fail mid-game
+    services::gamedata_loader::GameDataLoader::load(&config.gamedata)?;
+    services::template_service::TemplateService::verify_builtin()?;
+
+    // Initialize database connections, waiting for them to come up
+    let (db_pool, redis_pool) = tokio::try_join!(
+        db::retry::with_retry("PostgreSQL", &config.startup, || {
+            db::postgres::create_pool(&config.database)
+        }),
+        db::retry::with_retry("Redis", &config.startup, || {
+            db::redis::create_pool(&config.redis)
+        }),
+    )?;
 
     info!("Database connections established");
 
+    services::cache_service::install(redis_pool.clone());
+
+    services::gamedata_loader::GameDataLoader::sync_units(&db_pool).await?;
+    services::search_service::SearchService::apply_language(&db_pool, &config.search.language)
+        .await?;
+
+    let replicas = config
+        .database
+        .replica_hosts
+        .iter()
+        .map(|host| {
+            let pool = db::postgres::create_replica_pool(&config.database, host)?;
+            Ok((host.clone(), pool))
+        })
+        .collect::<anyhow::Result<Vec<_>>>()?;
+    let read_db = db::replica::ReadPool::new(
+        db_pool.clone(),
+        replicas,
+        config.database.replica_max_lag_ms,
+    );
+
+    let shards = db::shard::ShardResolver::new(db_pool.clone(), config.database.clone());
+    services::shard_service::ShardService::refresh(&db_pool, &shards).await?;
+    if config.database.migrate_shards_on_start {
+        let failed = services::shard_service::ShardService::migrate_all(&shards).await;
+        if failed > 0 {
+            anyhow::bail!("{} world shards failed to migrate", failed);
+        }
+    }
+
+    // Rotated database passwords apply to new pool connections
+    let pool = db_pool.clone();
+    let read_pool = read_db.clone();
+    let shard_pools = shards.clone();
+    secrets.on_rotate("DB_PASSWORD", move |password| {
+        db::postgres::set_password(&pool, password);
+        for replica in read_pool.replica_pools() {
+            db::postgres::set_password(replica, password);
+        }
+        shard_pools.set_password(password);
+    });
+
+    let provider = config.firebase.auth_provider.as_str();
+    let auth: Arc<dyn middleware::auth::AuthProvider> = match provider {
+        "dev" => {
+            warn!("Dev auth enabled: X-Dev-User headers and locally signed tokens are accepted");
+            Arc::new(middleware::dev_auth::DevAuth::new(&config.jwt.secret))
+        }
+        _ => Arc::new(middleware::auth::FirebaseAuth::new(
+            config.firebase.project_id.clone(),
+        )),
+    };
+
     // Create WebSocket manager
-    let ws_manager = WsManager::new();
+    let ws_manager = WsManager::new().with_replay(services::ws_replay::ReplayBuffer::new(
+        redis_pool.clone(),
+        &config.sync,
+    ));
 
     // Create app state
     let state = AppState {
         db: db_pool.clone(),
+        read_db: read_db.clone(),
+        shards: shards.clone(),
         redis: redis_pool,
         config: config.clone(),
+        secrets: secrets.clone(),
         ws: ws_manager.clone(),
+        auth,
+        stripe_breaker: services::circuit_breaker::CircuitBreaker::new(
+            "stripe",
+            5,
+            std::time::Duration::from_secs(60),
+        ),
+        captcha: services::captcha::CaptchaVerifier::from_config(&config.captcha),
+        ip_intel: services::ip_intel::IpIntelClient::from_config(&config.ip_intel),
+        mailer: services::mailer::Mailer::from_config(&config.email),
+        user_admin: services::firebase_admin::FirebaseAdmin::from_config(&config)
+            .map(|admin| Arc::new(admin) as Arc<dyn services::firebase_admin::UserAdmin>),
     };
 
     // Start background jobs with WebSocket manager for broadcasting
-    services::background_jobs::start_background_jobs(db_pool, ws_manager).await;
+    services::background_jobs::start_background_jobs(
+        db_pool,
+        read_db,
+        shards,
+        ws_manager,
+        config.clone(),
+        secrets,
+    )
+    .await;
 
     // Build router
     let app = Router::new()
         .route("/health", get(health_check))
+        .route("/metrics", get(handlers::debug::metrics))
         .route("/ws", get(handlers::ws::ws_handler))
-        .nest("/api", handlers::routes(state.clone()))
-        .layer(TraceLayer::new_for_http())
-        .layer(CorsLayer::permissive())
+        .route("/sse", get(handlers::sse::sse_handler))
+        .nest(
+            "/api",
+            handlers::routes(state.clone()).layer(axum::middleware::from_fn_with_state(
+                state.clone(),
+                middleware::audit_middleware,
+            )),
+        )
+        .nest("/debug", handlers::debug_routes(state.clone()))
+        .layer(CompressionLayer::new().gzip(true).br(true))
+        .layer(
+            TraceLayer::new_for_http()
+                .make_span_with(request_span)
+                .on_response(record_response),
+        )
+        // A panicking handler becomes a 500 instead of a dropped connection;
+        // the panic itself is reported to Sentry with the request's scope
+        .layer(CatchPanicLayer::custom(handle_panic))
+        .layer(SentryHttpLayer::with_transaction())
+        .layer(NewSentryLayer::<Request>::new_from_top())
+        .layer(axum::middleware::from_fn_with_state(
+            state.clone(),
+            middleware::security_headers_middleware,
+        ))
+        .layer(middleware::cors_layer(&config.security, &config.server.environment))
         .with_state(state);
 
     // Start server
-    let addr = SocketAddr::from(([0, 0, 0, 0], config.server.port));
-    info!("Server listening on {}", addr);
-
-    let listener = tokio::net::TcpListener::bind(addr).await?;
-    axum::serve(listener, app).await?;
+    server::serve(app, &config.server, &config.tls, &config.limits).await?;
 
     Ok(())
 }
 
+/// One span per request, named after the matched route so traces group by
+/// endpoint rather than by path
+fn request_span(request: &Request) -> Span {
+    let route = request
+        .extensions()
+        .get::<MatchedPath>()
+        .map(|path| path.as_str().to_string())
+        .unwrap_or_else(|| request.uri().path().to_string());
+    tracing::info_span!(
+        "request",
+        otel.name = %format!("{} {}", request.method(), route),
+        otel.kind = "server",
+        http.request.method = %request.method(),
+        http.route = %route,
+        http.response.status_code = tracing::field::Empty,
+    )
+}
+
+fn record_response(response: &Response, latency: Duration, span: &Span) {
+    let status = response.status().as_u16();
+    span.record("http.response.status_code", status);
+    info!(
+        status,
+        latency_ms = latency.as_millis() as u64,
+        "Finished request"
+    );
+}
+
 async fn health_check() -> &'static str {
     "OK"
 }
 
-#[derive(Clone)]
-pub struct AppState {
-    pub db: sqlx::PgPool,
-    pub redis: redis::aio::ConnectionManager,
-    pub config: config::Config,
-    pub ws: WsManager,
+fn handle_panic(_err: Box<dyn Any + Send + 'static>) -> Response {
+    let body = Json(serde_json::json!({
+        "error": {
+            "message": "Internal server error",
+            "code": 500
+        }
+    }));
+    (StatusCode::INTERNAL_SERVER_ERROR, body).into_response()
 }
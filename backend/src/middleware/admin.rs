@@ -0,0 +1,34 @@
+use axum::{
+    extract::{Request, State},
+    middleware::Next,
+    response::Response,
+};
+
+use crate::error::AppError;
+use crate::middleware::auth::AuthenticatedUser;
+use crate::repositories::user_repo::UserRepository;
+use crate::AppState;
+
+/// Requires `users.role = 'admin'`. Must run after `auth_middleware`
+/// (add it as the inner `route_layer`).
+pub async fn admin_middleware(
+    State(state): State<AppState>,
+    request: Request,
+    next: Next,
+) -> Result<Response, AppError> {
+    let user = request
+        .extensions()
+        .get::<AuthenticatedUser>()
+        .ok_or(AppError::Unauthorized)?;
+
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let role = UserRepository::get_role(&state.db, db_user.id).await?;
+    if role.as_deref() != Some("admin") {
+        return Err(AppError::Forbidden("Admin access required".into()));
+    }
+
+    Ok(next.run(request).await)
+}
@@ -0,0 +1,35 @@
+use axum::{
+    extract::{Request, State},
+    middleware::Next,
+    response::Response,
+};
+
+use crate::error::AppError;
+use crate::middleware::rate_limit;
+use crate::services::api_key_service::ApiKeyService;
+use crate::AppState;
+
+pub const API_KEY_HEADER: &str = "X-Api-Key";
+
+/// Requires a valid, unrevoked key in `X-Api-Key`, for the community read
+/// API. Each key gets the per-minute request budget a player has.
+pub async fn api_key_middleware(
+    State(state): State<AppState>,
+    mut request: Request,
+    next: Next,
+) -> Result<Response, AppError> {
+    let key = request
+        .headers()
+        .get(API_KEY_HEADER)
+        .and_then(|h| h.to_str().ok())
+        .ok_or(AppError::Unauthorized)?;
+
+    let api_key = ApiKeyService::authenticate(&state.db, key)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    rate_limit::check_player(&format!("api-key:{}", api_key.id))?;
+    request.extensions_mut().insert(api_key);
+
+    Ok(next.run(request).await)
+}
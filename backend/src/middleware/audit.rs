@@ -0,0 +1,73 @@
+use axum::{
+    body::Body,
+    extract::{Request, State},
+    http::{Method, StatusCode},
+    middleware::Next,
+    response::{IntoResponse, Response},
+};
+use std::time::Instant;
+
+use crate::middleware::auth::{AuthenticatedUser, IMPERSONATION_HEADER};
+use crate::models::audit::NewAuditLogEntry;
+use crate::services::activity_service::ActivityService;
+use crate::services::audit_service::AuditService;
+use crate::AppState;
+
+/// Largest body buffered for auditing (matches axum's default body limit)
+const MAX_BUFFERED_BODY: usize = 2 * 1024 * 1024;
+
+/// Records mutating API calls when AUDIT_LOG_ENABLED is set, and every
+/// impersonated call regardless. Runs outside the route groups, so the
+/// player is read back from the response, where `auth_middleware` leaves it.
+pub async fn audit_middleware(
+    State(state): State<AppState>,
+    request: Request,
+    next: Next,
+) -> Response {
+    let audit = &state.config.audit;
+    let mutating = matches!(
+        *request.method(),
+        Method::POST | Method::PUT | Method::PATCH | Method::DELETE
+    );
+    let impersonated = request.headers().contains_key(IMPERSONATION_HEADER);
+    if !impersonated && (!audit.enabled || !mutating) {
+        return next.run(request).await;
+    }
+
+    let started = Instant::now();
+    let method = request.method().to_string();
+    let path = request.uri().path().to_string();
+    let client_ip = ActivityService::origin(request.headers()).client_ip;
+
+    let (parts, body) = request.into_parts();
+    let bytes = match axum::body::to_bytes(body, MAX_BUFFERED_BODY).await {
+        Ok(bytes) => bytes,
+        Err(_) => return StatusCode::PAYLOAD_TOO_LARGE.into_response(),
+    };
+    let payload = AuditService::sanitize_payload(&bytes, audit.max_payload_bytes);
+
+    let response = next
+        .run(Request::from_parts(parts, Body::from(bytes)))
+        .await;
+
+    let user = response.extensions().get::<AuthenticatedUser>();
+    let firebase_uid = user.map(|u| u.firebase_uid.clone());
+    let impersonator_id = user.and_then(|u| u.impersonation).map(|i| i.admin_id);
+
+    AuditService::record(
+        &state.db,
+        NewAuditLogEntry {
+            firebase_uid,
+            method,
+            route: AuditService::normalize_route(&path),
+            path,
+            status: response.status().as_u16() as i32,
+            payload,
+            duration_ms: started.elapsed().as_millis() as i32,
+            client_ip,
+            impersonator_id,
+        },
+    );
+
+    response
+}
@@ -1,28 +1,69 @@
+use async_trait::async_trait;
 use axum::{
-    extract::{Request, State},
+    extract::{OriginalUri, Request, State},
+    http::{HeaderMap, Method},
     middleware::Next,
     response::Response,
 };
 use jsonwebtoken::{decode, decode_header, DecodingKey, Validation};
 use reqwest::Client;
 use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
 use std::collections::HashMap;
 use std::sync::Arc;
+use std::time::Duration;
 use tokio::sync::RwLock;
-use tracing::{debug, error};
+use tracing::{debug, error, info, warn};
 
+use crate::error::reporting;
 use crate::error::AppError;
+use crate::middleware::{concurrency, rate_limit};
+use crate::models::impersonation::{Impersonation, CURRENT_IMPERSONATION};
+use crate::services::activity_service::ActivityService;
+use crate::services::circuit_breaker::CircuitBreaker;
+use crate::services::impersonation_service::ImpersonationService;
+use crate::services::session_service::SessionService;
 use crate::AppState;
 
 // Firebase public keys cache
 static FIREBASE_KEYS_URL: &str =
     "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com";
 
+/// Upper bound on remembered tokens; expired ones are evicted past this
+const VERIFIED_TOKEN_CACHE_SIZE: usize = 10_000;
+
+/// Token from an admin impersonation session, sent in place of the bearer token
+pub const IMPERSONATION_HEADER: &str = "x-impersonation-token";
+
+/// Turns a request's credentials into a player identity. Firebase in real
+/// deployments; `DevAuth` for local development without Firebase.
+#[async_trait]
+pub trait AuthProvider: Send + Sync {
+    /// Verify a bearer token
+    async fn verify_token(&self, token: &str) -> Result<AuthenticatedUser, AppError>;
+
+    /// Identity carried by request headers alone, checked before the token
+    fn header_user(&self, _headers: &HeaderMap) -> Option<AuthenticatedUser> {
+        None
+    }
+
+    /// Breaker guarding the provider's remote calls, if any
+    fn breaker(&self) -> Option<&CircuitBreaker> {
+        None
+    }
+}
+
+/// Shared across requests (lives in AppState) so the key and token caches
+/// survive between calls
 #[derive(Clone)]
 pub struct FirebaseAuth {
     project_id: String,
     http_client: Client,
     keys_cache: Arc<RwLock<HashMap<String, DecodingKey>>>,
+    /// Claims of tokens that verified successfully, keyed by token hash.
+    /// Used when Google's key endpoint is unreachable.
+    verified_cache: Arc<RwLock<HashMap<String, FirebaseClaims>>>,
+    breaker: CircuitBreaker,
 }
 
 impl std::fmt::Debug for FirebaseAuth {
@@ -58,8 +99,13 @@ impl FirebaseAuth {
     pub fn new(project_id: String) -> Self {
         Self {
             project_id,
-            http_client: Client::new(),
+            http_client: Client::builder()
+                .timeout(Duration::from_secs(5))
+                .build()
+                .unwrap_or_default(),
             keys_cache: Arc::new(RwLock::new(HashMap::new())),
+            verified_cache: Arc::new(RwLock::new(HashMap::new())),
+            breaker: CircuitBreaker::new("firebase", 5, Duration::from_secs(30)),
         }
     }
 
@@ -69,14 +115,15 @@ impl FirebaseAuth {
             .get(FIREBASE_KEYS_URL)
             .send()
             .await
+            .and_then(|r| r.error_for_status())
             .map_err(|e| {
                 error!("Failed to fetch Firebase public keys: {}", e);
-                AppError::InternalError(anyhow::anyhow!("Failed to fetch Firebase keys"))
+                AppError::ServiceUnavailable("Authentication provider unavailable".into())
             })?;
 
         let keys: HashMap<String, String> = response.json().await.map_err(|e| {
             error!("Failed to parse Firebase public keys: {}", e);
-            AppError::InternalError(anyhow::anyhow!("Failed to parse Firebase keys"))
+            AppError::ServiceUnavailable("Authentication provider unavailable".into())
         })?;
 
         Ok(keys)
@@ -92,7 +139,7 @@ impl FirebaseAuth {
         }
 
         // Fetch new keys
-        let keys = self.fetch_public_keys().await?;
+        let keys = self.breaker.call(|| self.fetch_public_keys()).await?;
 
         // Update cache
         let mut cache = self.keys_cache.write().await;
@@ -108,7 +155,7 @@ impl FirebaseAuth {
             .ok_or_else(|| AppError::Unauthorized)
     }
 
-    pub async fn verify_token(&self, token: &str) -> Result<FirebaseClaims, AppError> {
+    pub async fn verify_claims(&self, token: &str) -> Result<FirebaseClaims, AppError> {
         // Decode header to get kid
         let header = decode_header(token).map_err(|e| {
             debug!("Failed to decode token header: {}", e);
@@ -117,8 +164,21 @@ impl FirebaseAuth {
 
         let kid = header.kid.ok_or(AppError::Unauthorized)?;
 
-        // Get decoding key
-        let decoding_key = self.get_decoding_key(&kid).await?;
+        // Get decoding key; if Google can't be reached, accept tokens we
+        // already verified until they expire
+        let decoding_key = match self.get_decoding_key(&kid).await {
+            Ok(key) => key,
+            Err(e @ AppError::ServiceUnavailable(_)) => {
+                return match self.cached_claims(token).await {
+                    Some(claims) => {
+                        warn!("Firebase keys unavailable, using cached verification");
+                        Ok(claims)
+                    }
+                    None => Err(e),
+                };
+            }
+            Err(e) => return Err(e),
+        };
 
         // Set up validation
         let mut validation = Validation::new(jsonwebtoken::Algorithm::RS256);
@@ -134,8 +194,51 @@ impl FirebaseAuth {
             AppError::Unauthorized
         })?;
 
+        self.remember(token, &token_data.claims).await;
+
         Ok(token_data.claims)
     }
+
+    async fn cached_claims(&self, token: &str) -> Option<FirebaseClaims> {
+        let cache = self.verified_cache.read().await;
+        cache
+            .get(&token_hash(token))
+            .filter(|claims| claims.exp > chrono::Utc::now().timestamp())
+            .cloned()
+    }
+
+    async fn remember(&self, token: &str, claims: &FirebaseClaims) {
+        let mut cache = self.verified_cache.write().await;
+        if cache.len() >= VERIFIED_TOKEN_CACHE_SIZE {
+            let now = chrono::Utc::now().timestamp();
+            cache.retain(|_, c| c.exp > now);
+            if cache.len() >= VERIFIED_TOKEN_CACHE_SIZE {
+                cache.clear();
+            }
+        }
+        cache.insert(token_hash(token), claims.clone());
+    }
+}
+
+#[async_trait]
+impl AuthProvider for FirebaseAuth {
+    async fn verify_token(&self, token: &str) -> Result<AuthenticatedUser, AppError> {
+        Ok(self.verify_claims(token).await?.into())
+    }
+
+    fn breaker(&self) -> Option<&CircuitBreaker> {
+        Some(&self.breaker)
+    }
+}
+
+fn token_hash(token: &str) -> String {
+    hex::encode(Sha256::digest(token.as_bytes()))
+}
+
+/// Key of a sign-in: tokens refreshed from it share the uid and sign-in
+/// time, so they map to the same session
+pub fn session_key(uid: &str, signed_in_at: i64) -> String {
+    token_hash(&format!("{}:{}", uid, signed_in_at))
 }
 
 // Extension to store authenticated user info in request
@@ -146,6 +249,11 @@ pub struct AuthenticatedUser {
     pub name: Option<String>,
     pub picture: Option<String>,
     pub provider: Option<String>,
+    /// Identifies the sign-in the token came from (see `session_key`);
+    /// None for identities without a token
+    pub session_id: Option<String>,
+    /// Set when support staff are acting as this player
+    pub impersonation: Option<Impersonation>,
 }
 
 impl From<FirebaseClaims> for AuthenticatedUser {
@@ -156,11 +264,13 @@ impl From<FirebaseClaims> for AuthenticatedUser {
             .and_then(|f| f.sign_in_provider.clone());
 
         Self {
+            session_id: Some(session_key(&claims.sub, claims.auth_time)),
             firebase_uid: claims.sub,
             email: claims.email,
             name: claims.name,
             picture: claims.picture,
             provider,
+            impersonation: None,
         }
     }
 }
@@ -170,21 +280,102 @@ pub async fn auth_middleware(
     mut request: Request,
     next: Next,
 ) -> Result<Response, AppError> {
-    let auth_header = request
+    let impersonation_token = request
         .headers()
-        .get("Authorization")
+        .get(IMPERSONATION_HEADER)
         .and_then(|h| h.to_str().ok())
-        .ok_or(AppError::Unauthorized)?;
+        .map(str::to_string);
 
-    let token = auth_header
-        .strip_prefix("Bearer ")
-        .ok_or(AppError::Unauthorized)?;
+    let user = match (impersonation_token, state.auth.header_user(request.headers())) {
+        (Some(token), _) => impersonated_user(&state, &token).await?,
+        (None, Some(user)) => user,
+        (None, None) => {
+            let auth_header = request
+                .headers()
+                .get("Authorization")
+                .and_then(|h| h.to_str().ok())
+                .ok_or(AppError::Unauthorized)?;
+
+            let token = auth_header
+                .strip_prefix("Bearer ")
+                .ok_or(AppError::Unauthorized)?;
+
+            state.auth.verify_token(token).await?
+        }
+    };
+
+    // Nested routers see their own part of the path; checks need all of it
+    let method = request.method().clone();
+    let path = request
+        .extensions()
+        .get::<OriginalUri>()
+        .map(|uri| uri.path().to_string())
+        .unwrap_or_else(|| request.uri().path().to_string());
+    let mutating = !matches!(method, Method::GET | Method::HEAD | Method::OPTIONS);
+
+    reporting::set_player(&user.firebase_uid, user.email.as_deref());
+    let _slot = match &user.impersonation {
+        Some(impersonation) => {
+            ImpersonationService::check_allowed(impersonation, &path, mutating)?;
+            info!(
+                "Impersonated request {} {} as {} by {} (session {})",
+                method,
+                path,
+                user.firebase_uid,
+                impersonation.admin_id,
+                impersonation.session_id
+            );
+            // Staff don't spend the player's request budget
+            let key = format!("impersonation:{}", impersonation.session_id);
+            rate_limit::check_player(&key)?;
+            concurrency::player_slot(&key, mutating)?
+        }
+        None => {
+            rate_limit::check_player(&user.firebase_uid)?;
+            let slot = concurrency::player_slot(&user.firebase_uid, mutating)?;
+            SessionService::track(&state.db, &user, &ActivityService::origin(request.headers()))
+                .await?;
+            slot
+        }
+    };
+    request.extensions_mut().insert(user.clone());
 
-    let firebase_auth = FirebaseAuth::new(state.config.firebase.project_id.clone());
-    let claims = firebase_auth.verify_token(token).await?;
+    // Exposed on the response for outer middleware (audit log)
+    let mut response = match user.impersonation {
+        Some(impersonation) => {
+            CURRENT_IMPERSONATION
+                .scope(impersonation, next.run(request))
+                .await
+        }
+        None => next.run(request).await,
+    };
+    if let Some(impersonation) = user.impersonation.filter(|_| mutating) {
+        ImpersonationService::record_write(
+            &state.db,
+            &impersonation,
+            method.as_str(),
+            &path,
+            response.status().as_u16(),
+        );
+    }
+    response.extensions_mut().insert(user);
 
-    let user: AuthenticatedUser = claims.into();
-    request.extensions_mut().insert(user);
+    Ok(response)
+}
+
+/// The player an impersonation token stands for
+async fn impersonated_user(state: &AppState, token: &str) -> Result<AuthenticatedUser, AppError> {
+    let (player, impersonation) = ImpersonationService::authenticate(&state.db, token)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
 
-    Ok(next.run(request).await)
+    Ok(AuthenticatedUser {
+        firebase_uid: player.firebase_uid,
+        email: player.email,
+        name: player.display_name,
+        picture: player.photo_url,
+        provider: Some("impersonation".to_string()),
+        session_id: None,
+        impersonation: Some(impersonation),
+    })
 }
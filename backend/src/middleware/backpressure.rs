@@ -0,0 +1,107 @@
+use axum::{
+    extract::{OriginalUri, Request},
+    middleware::Next,
+    response::{IntoResponse, Response},
+};
+use std::fmt::Write;
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use tracing::warn;
+
+use crate::error::AppError;
+use crate::services::lag_watchdog_service::LagWatchdogService;
+use crate::services::runtime_config_service;
+
+/// Gameplay API requests running on this instance
+static IN_FLIGHT: AtomicUsize = AtomicUsize::new(0);
+
+static SHED_TOTAL: AtomicU64 = AtomicU64::new(0);
+
+/// Read-heavy endpoints refused first when the instance is overloaded.
+/// Everything else (sending armies, building, training, trading) keeps
+/// going, and movements are resolved by background jobs this never touches.
+const SHEDDABLE_PATHS: &[&str] = &[
+    "/api/map",
+    "/api/search",
+    "/api/rankings",
+    "/api/hall-of-fame",
+    "/api/regions",
+    "/api/world",
+    "/api/economy",
+    "/api/digests",
+    "/api/activity",
+    "/api/graphql",
+];
+
+/// Counts a request in flight until dropped
+struct InFlight;
+
+impl InFlight {
+    fn enter() -> (Self, usize) {
+        let count = IN_FLIGHT.fetch_add(1, Ordering::Relaxed) + 1;
+        (Self, count)
+    }
+}
+
+impl Drop for InFlight {
+    fn drop(&mut self) {
+        IN_FLIGHT.fetch_sub(1, Ordering::Relaxed);
+    }
+}
+
+/// Count gameplay requests in flight and shed non-critical ones with 503
+/// while the instance is past `shed_in_flight`, or while army movements run
+/// late when `shed_on_movement_lag` is set
+pub async fn backpressure_middleware(request: Request, next: Next) -> Response {
+    let (_in_flight, count) = InFlight::enter();
+
+    let path = request
+        .extensions()
+        .get::<OriginalUri>()
+        .map(|uri| uri.path().to_string())
+        .unwrap_or_else(|| request.uri().path().to_string());
+
+    if is_sheddable(&path) {
+        let settings = runtime_config_service::current();
+        let overloaded = settings.shed_in_flight > 0 && count > settings.shed_in_flight as usize;
+        let lagging = settings.shed_on_movement_lag && LagWatchdogService::movement_lagging();
+        if overloaded || lagging {
+            SHED_TOTAL.fetch_add(1, Ordering::Relaxed);
+            warn!(
+                "Shedding {} ({} in flight, movements lagging: {})",
+                path, count, lagging
+            );
+            return AppError::ServiceUnavailable("The server is busy, try again shortly".into())
+                .into_response();
+        }
+    }
+
+    next.run(request).await
+}
+
+fn is_sheddable(path: &str) -> bool {
+    SHEDDABLE_PATHS.iter().any(|prefix| {
+        path.strip_prefix(prefix)
+            .is_some_and(|rest| rest.is_empty() || rest.starts_with('/'))
+    })
+}
+
+/// Prometheus text exposition of the in-flight gauge and shed counters
+pub fn render_prometheus() -> String {
+    let mut out = String::new();
+    out.push_str("# HELP api_requests_in_flight Gameplay API requests running on this instance.\n");
+    out.push_str("# TYPE api_requests_in_flight gauge\n");
+    let _ = writeln!(
+        out,
+        "api_requests_in_flight {}",
+        IN_FLIGHT.load(Ordering::Relaxed)
+    );
+    out.push_str("# HELP api_requests_shed_total Non-critical requests refused under load.\n");
+    out.push_str("# TYPE api_requests_shed_total counter\n");
+    let _ = writeln!(
+        out,
+        "api_requests_shed_total {}",
+        SHED_TOTAL.load(Ordering::Relaxed)
+    );
+
+    out
+}
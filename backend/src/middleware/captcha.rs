@@ -0,0 +1,158 @@
+use axum::{
+    extract::{Request, State},
+    http::HeaderMap,
+    middleware::Next,
+    response::Response,
+};
+use chrono::Duration;
+use tracing::{info, warn};
+
+use crate::error::AppError;
+use crate::middleware::api_key::API_KEY_HEADER;
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::activity::ActivityKind;
+use crate::repositories::activity_repo::ActivityRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::activity_service::ActivityService;
+use crate::services::bot_detection_service::BotDetectionService;
+use crate::services::captcha::CaptchaVerifier;
+use crate::services::clock;
+use crate::services::ip_reputation_service::IpReputationService;
+use crate::AppState;
+
+/// Header carrying the token the captcha widget produced
+pub const TOKEN_HEADER: &str = "x-captcha-token";
+
+/// Challenge players on sensitive gameplay routes when the bot detector
+/// flagged them or they are sending armies in bulk. Must run after
+/// `auth_middleware`; a no-op when captchas are off.
+pub async fn captcha_middleware(
+    State(state): State<AppState>,
+    request: Request,
+    next: Next,
+) -> Result<Response, AppError> {
+    let Some(verifier) = &state.captcha else {
+        return Ok(next.run(request).await);
+    };
+    if bypassed(&state, request.headers()) {
+        return Ok(next.run(request).await);
+    }
+
+    let user = request
+        .extensions()
+        .get::<AuthenticatedUser>()
+        .ok_or(AppError::Unauthorized)?;
+    let db_user = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .ok_or(AppError::Unauthorized)?;
+
+    let flagged = BotDetectionService::challenge_required(&state.db, db_user.id).await?;
+    let bulk_sending = !flagged
+        && ActivityRepository::count_since(
+            &state.db,
+            db_user.id,
+            ActivityKind::ArmySent,
+            clock::now() - Duration::minutes(10),
+        )
+        .await?
+            >= state.config.captcha.sends_per_10_min;
+
+    if flagged || bulk_sending {
+        verify(verifier, request.headers()).await?;
+        if flagged {
+            BotDetectionService::pass_challenge(&state.db, db_user.id).await?;
+            info!("Player {} passed the bot challenge", db_user.id);
+        }
+    }
+
+    Ok(next.run(request).await)
+}
+
+/// Classify the login address (handed to the handler as an `IpCategory`
+/// extension) and challenge risky logins: new registrations from an
+/// address that registered several accounts within the last hour, and
+/// logins from networks the world's IP reputation policy steps up. Must run
+/// after `auth_middleware`.
+pub async fn login_captcha_middleware(
+    State(state): State<AppState>,
+    mut request: Request,
+    next: Next,
+) -> Result<Response, AppError> {
+    let client_ip = ActivityService::origin(request.headers()).client_ip;
+    let category = match &client_ip {
+        Some(ip) => IpReputationService::classify(&state.db, state.ip_intel.as_ref(), ip).await?,
+        None => None,
+    };
+    if let Some(category) = category {
+        request.extensions_mut().insert(category);
+    }
+
+    let Some(verifier) = &state.captcha else {
+        return Ok(next.run(request).await);
+    };
+    if bypassed(&state, request.headers()) {
+        return Ok(next.run(request).await);
+    }
+
+    let user = request
+        .extensions()
+        .get::<AuthenticatedUser>()
+        .ok_or(AppError::Unauthorized)?;
+    let registered = UserRepository::find_by_firebase_uid(&state.db, &user.firebase_uid)
+        .await?
+        .is_some();
+
+    if IpReputationService::needs_step_up(&state.db, category).await? {
+        info!(
+            "Step-up check for login of {} from {:?} address",
+            user.firebase_uid, category
+        );
+        verify(verifier, request.headers()).await?;
+    } else if !registered {
+        if let Some(ip) = &client_ip {
+            let recent = ActivityRepository::count_new_accounts_from(
+                &state.db,
+                ip,
+                clock::now() - Duration::hours(1),
+            )
+            .await?;
+            if recent >= state.config.captcha.registrations_per_ip_hour {
+                info!("Registration burst from {}: {} new accounts", ip, recent);
+                verify(verifier, request.headers()).await?;
+            }
+        }
+    }
+
+    Ok(next.run(request).await)
+}
+
+fn bypassed(state: &AppState, headers: &HeaderMap) -> bool {
+    headers
+        .get(API_KEY_HEADER)
+        .and_then(|h| h.to_str().ok())
+        .is_some_and(|key| state.config.captcha.bypass_keys.iter().any(|k| k == key))
+}
+
+async fn verify(verifier: &CaptchaVerifier, headers: &HeaderMap) -> Result<(), AppError> {
+    let token = headers
+        .get(TOKEN_HEADER)
+        .and_then(|h| h.to_str().ok())
+        .filter(|t| !t.is_empty())
+        .ok_or_else(|| AppError::CaptchaRequired("Please complete the captcha".into()))?;
+    let remote_ip = ActivityService::origin(headers).client_ip;
+
+    let passed = verifier
+        .verify(token, remote_ip.as_deref())
+        .await
+        .map_err(|e| {
+            warn!("Captcha verification failed: {:?}", e);
+            AppError::ServiceUnavailable("Captcha verification is unavailable".into())
+        })?;
+    if !passed {
+        return Err(AppError::CaptchaRequired(
+            "Captcha verification failed, please try again".into(),
+        ));
+    }
+
+    Ok(())
+}
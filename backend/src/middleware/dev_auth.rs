@@ -0,0 +1,110 @@
+use async_trait::async_trait;
+use axum::http::HeaderMap;
+use jsonwebtoken::{decode, encode, Algorithm, DecodingKey, EncodingKey, Header, Validation};
+use serde::{Deserialize, Serialize};
+use tracing::debug;
+
+use crate::error::AppError;
+use crate::middleware::auth::{session_key, AuthProvider, AuthenticatedUser};
+
+/// Header naming the player to act as, e.g. `X-Dev-User: alice`
+pub const DEV_USER_HEADER: &str = "x-dev-user";
+/// Optional email for the `X-Dev-User` identity
+pub const DEV_EMAIL_HEADER: &str = "x-dev-email";
+
+const DEV_ISSUER: &str = "tusk-horn-dev";
+const DEV_TOKEN_HOURS: i64 = 24;
+
+#[derive(Debug, Serialize, Deserialize)]
+struct DevClaims {
+    sub: String,
+    email: Option<String>,
+    name: Option<String>,
+    iss: String,
+    /// Issue time; tokens from before it was added have none
+    #[serde(default)]
+    iat: i64,
+    exp: i64,
+}
+
+/// Development stand-in for Firebase: accepts tokens signed with the local
+/// JWT secret, or just an `X-Dev-User` header. Only enabled when
+/// ENVIRONMENT=development (see Config::validate).
+pub struct DevAuth {
+    encoding_key: EncodingKey,
+    decoding_key: DecodingKey,
+}
+
+impl DevAuth {
+    pub fn new(secret: &str) -> Self {
+        Self {
+            encoding_key: EncodingKey::from_secret(secret.as_bytes()),
+            decoding_key: DecodingKey::from_secret(secret.as_bytes()),
+        }
+    }
+
+    /// Sign a token for `uid`, valid for 24 hours
+    pub fn issue_token(
+        &self,
+        uid: &str,
+        email: Option<String>,
+        name: Option<String>,
+    ) -> Result<String, AppError> {
+        let claims = DevClaims {
+            sub: uid.to_string(),
+            email,
+            name,
+            iss: DEV_ISSUER.to_string(),
+            iat: chrono::Utc::now().timestamp(),
+            exp: (chrono::Utc::now() + chrono::Duration::hours(DEV_TOKEN_HOURS)).timestamp(),
+        };
+
+        encode(&Header::new(Algorithm::HS256), &claims, &self.encoding_key)
+            .map_err(|e| AppError::InternalError(e.into()))
+    }
+}
+
+#[async_trait]
+impl AuthProvider for DevAuth {
+    async fn verify_token(&self, token: &str) -> Result<AuthenticatedUser, AppError> {
+        let mut validation = Validation::new(Algorithm::HS256);
+        validation.set_issuer(&[DEV_ISSUER]);
+
+        let data = decode::<DevClaims>(token, &self.decoding_key, &validation).map_err(|e| {
+            debug!("Dev token validation failed: {}", e);
+            AppError::Unauthorized
+        })?;
+
+        Ok(AuthenticatedUser {
+            session_id: Some(session_key(&data.claims.sub, data.claims.iat)),
+            firebase_uid: data.claims.sub,
+            email: data.claims.email,
+            name: data.claims.name,
+            picture: None,
+            provider: Some("dev".to_string()),
+            impersonation: None,
+        })
+    }
+
+    fn header_user(&self, headers: &HeaderMap) -> Option<AuthenticatedUser> {
+        let uid = headers
+            .get(DEV_USER_HEADER)
+            .and_then(|h| h.to_str().ok())
+            .map(str::trim)
+            .filter(|uid| !uid.is_empty())?;
+        let email = headers
+            .get(DEV_EMAIL_HEADER)
+            .and_then(|h| h.to_str().ok())
+            .map(str::to_string);
+
+        Some(AuthenticatedUser {
+            firebase_uid: uid.to_string(),
+            email,
+            name: Some(uid.to_string()),
+            picture: None,
+            provider: Some("dev".to_string()),
+            session_id: None,
+            impersonation: None,
+        })
+    }
+}
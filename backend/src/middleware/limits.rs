@@ -0,0 +1,42 @@
+use axum::{
+    extract::{DefaultBodyLimit, Request, State},
+    middleware::{self, Next},
+    response::{IntoResponse, Response},
+    Router,
+};
+use std::time::Duration;
+use tracing::warn;
+
+use crate::config::RouteLimits;
+use crate::error::AppError;
+
+/// Apply a route group's limits: larger bodies are refused with 413 by the
+/// extractors, and handlers still running at the deadline are dropped
+pub fn with_limits<S>(router: Router<S>, limits: RouteLimits) -> Router<S>
+where
+    S: Clone + Send + Sync + 'static,
+{
+    router
+        .layer(middleware::from_fn_with_state(
+            Duration::from_secs(limits.timeout_secs),
+            timeout_middleware,
+        ))
+        .layer(DefaultBodyLimit::max(limits.max_body_bytes))
+}
+
+async fn timeout_middleware(
+    State(timeout): State<Duration>,
+    request: Request,
+    next: Next,
+) -> Response {
+    let method = request.method().clone();
+    let path = request.uri().path().to_string();
+
+    match tokio::time::timeout(timeout, next.run(request)).await {
+        Ok(response) => response,
+        Err(_) => {
+            warn!("{} {} timed out after {:?}", method, path, timeout);
+            AppError::Timeout("The request took too long".into()).into_response()
+        }
+    }
+}
@@ -1,3 +1,24 @@
+pub mod admin;
+pub mod api_key;
+pub mod audit;
 pub mod auth;
+pub mod backpressure;
+pub mod captcha;
+pub mod concurrency;
+pub mod dev_auth;
+pub mod etag;
+pub mod limits;
+pub mod pause;
+pub mod rate_limit;
+pub mod security;
 
+pub use admin::admin_middleware;
+pub use api_key::api_key_middleware;
+pub use audit::audit_middleware;
 pub use auth::{auth_middleware, AuthenticatedUser};
+pub use backpressure::backpressure_middleware;
+pub use captcha::{captcha_middleware, login_captcha_middleware};
+pub use etag::etag_middleware;
+pub use limits::with_limits;
+pub use pause::world_pause_middleware;
+pub use security::{cors_layer, security_headers_middleware};
@@ -0,0 +1,31 @@
+use axum::{
+    extract::{OriginalUri, Request},
+    http::Method,
+    middleware::Next,
+    response::{IntoResponse, Response},
+};
+
+use crate::error::{AppError, ErrorCode};
+use crate::services::clock;
+
+/// Refuse gameplay changes with 503 while the world is paused. Reads keep
+/// working so players can see where things stood, and signing in still
+/// works.
+pub async fn world_pause_middleware(request: Request, next: Next) -> Response {
+    let mutating = !matches!(
+        *request.method(),
+        Method::GET | Method::HEAD | Method::OPTIONS
+    );
+    if mutating && clock::is_paused() {
+        let path = request
+            .extensions()
+            .get::<OriginalUri>()
+            .map(|uri| uri.path().to_string())
+            .unwrap_or_else(|| request.uri().path().to_string());
+        if !path.starts_with("/api/auth") {
+            return AppError::from(ErrorCode::WorldPaused).into_response();
+        }
+    }
+
+    next.run(request).await
+}
@@ -0,0 +1,46 @@
+use chrono::Utc;
+use std::collections::HashMap;
+use std::sync::{LazyLock, Mutex};
+
+use crate::error::{AppError, AppResult};
+use crate::services::runtime_config_service;
+
+/// Request counts per player for the current minute
+static WINDOWS: LazyLock<Mutex<HashMap<String, (i64, u32)>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Windows kept before stale ones are swept
+const MAX_TRACKED_PLAYERS: usize = 100_000;
+
+/// Count a request against the player's per-minute budget
+/// (`player_requests_per_minute` in the runtime config). Limits are per
+/// instance, so the effective cluster-wide limit scales with replicas.
+pub fn check_player(firebase_uid: &str) -> AppResult<()> {
+    let limit = runtime_config_service::current().player_requests_per_minute;
+    if limit == 0 {
+        return Ok(());
+    }
+
+    let minute = Utc::now().timestamp() / 60;
+    let mut windows = WINDOWS.lock().unwrap();
+    if windows.len() >= MAX_TRACKED_PLAYERS {
+        windows.retain(|_, (window, _)| *window == minute);
+    }
+
+    let (window, count) = windows
+        .entry(firebase_uid.to_string())
+        .or_insert((minute, 0));
+    if *window != minute {
+        *window = minute;
+        *count = 0;
+    }
+    *count += 1;
+
+    if *count > limit {
+        return Err(AppError::TooManyRequests(
+            "Too many requests, please slow down".into(),
+        ));
+    }
+
+    Ok(())
+}
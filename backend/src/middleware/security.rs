@@ -0,0 +1,108 @@
+use axum::{
+    extract::{Request, State},
+    http::{header, HeaderName, HeaderValue, Method},
+    middleware::Next,
+    response::Response,
+};
+use std::time::Duration;
+use tower_http::cors::{AllowOrigin, CorsLayer};
+use tracing::warn;
+
+use crate::config::SecurityConfig;
+use crate::middleware::auth::IMPERSONATION_HEADER;
+use crate::middleware::captcha::TOKEN_HEADER;
+use crate::middleware::dev_auth::{DEV_EMAIL_HEADER, DEV_USER_HEADER};
+use crate::AppState;
+
+/// CORS for the browser client. `*` is honoured outside production only;
+/// in production every allowed origin must be listed explicitly.
+pub fn cors_layer(config: &SecurityConfig, environment: &str) -> CorsLayer {
+    let mut headers = vec![
+        header::AUTHORIZATION,
+        header::CONTENT_TYPE,
+        header::ACCEPT,
+        header::IF_NONE_MATCH,
+        HeaderName::from_static(IMPERSONATION_HEADER),
+        HeaderName::from_static(TOKEN_HEADER),
+    ];
+    // The dev auth provider only exists in development
+    if environment == "development" {
+        headers.push(HeaderName::from_static(DEV_USER_HEADER));
+        headers.push(HeaderName::from_static(DEV_EMAIL_HEADER));
+    }
+
+    let layer = CorsLayer::new()
+        .allow_methods([
+            Method::GET,
+            Method::POST,
+            Method::PUT,
+            Method::PATCH,
+            Method::DELETE,
+            Method::OPTIONS,
+        ])
+        .allow_headers(headers)
+        .expose_headers([header::ETAG])
+        .max_age(Duration::from_secs(config.cors_max_age_secs));
+
+    if config.allowed_origins.iter().any(|o| o == "*") {
+        if environment == "production" {
+            warn!("CORS_ALLOWED_ORIGINS=* is ignored in production");
+        } else {
+            return layer.allow_origin(AllowOrigin::any());
+        }
+    }
+
+    let origins: Vec<HeaderValue> = config
+        .allowed_origins
+        .iter()
+        .filter(|o| o.as_str() != "*")
+        .filter_map(|o| match HeaderValue::from_str(o) {
+            Ok(v) => Some(v),
+            Err(_) => {
+                warn!("Ignoring invalid CORS origin {:?}", o);
+                None
+            }
+        })
+        .collect();
+
+    layer.allow_origin(AllowOrigin::list(origins))
+}
+
+/// Security headers on every response unless a handler already set them
+pub async fn security_headers_middleware(
+    State(state): State<AppState>,
+    request: Request,
+    next: Next,
+) -> Response {
+    let mut response = next.run(request).await;
+    let headers = response.headers_mut();
+
+    headers
+        .entry(header::X_CONTENT_TYPE_OPTIONS)
+        .or_insert(HeaderValue::from_static("nosniff"));
+    headers
+        .entry(header::X_FRAME_OPTIONS)
+        .or_insert(HeaderValue::from_static("DENY"));
+    headers
+        .entry(header::REFERRER_POLICY)
+        .or_insert(HeaderValue::from_static("no-referrer"));
+    headers
+        .entry(header::CONTENT_SECURITY_POLICY)
+        .or_insert(HeaderValue::from_static(
+            "default-src 'none'; frame-ancestors 'none'",
+        ));
+
+    // Only meaningful behind TLS; a plain-http dev server must not send it
+    let hsts_max_age = state.config.security.hsts_max_age_secs;
+    if hsts_max_age > 0 {
+        if let Ok(value) =
+            HeaderValue::from_str(&format!("max-age={}; includeSubDomains", hsts_max_age))
+        {
+            headers
+                .entry(header::STRICT_TRANSPORT_SECURITY)
+                .or_insert(value);
+        }
+    }
+
+    response
+}
@@ -0,0 +1,142 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use crate::models::troop::TribeType;
+
+// ==================== Rules ====================
+
+/// Minimum time between two email changes of an account
+pub const EMAIL_CHANGE_COOLDOWN_DAYS: i64 = 7;
+
+/// How long a link mailed to confirm a new address stays valid
+pub const EMAIL_TOKEN_TTL_MINUTES: i64 = 60;
+
+/// How long the old address can undo an email change
+pub const REVERT_TOKEN_TTL_DAYS: i64 = 7;
+
+/// Minimum time between two mails of the same kind to an account
+pub const MAIL_COOLDOWN_MINUTES: i64 = 15;
+
+/// Addresses replaced this recently can still recover the account
+pub const RECOVERY_LOOKBACK_DAYS: i64 = 30;
+
+/// UIDs per admin lookup request
+pub const MAX_LOOKUP_UIDS: usize = 1000;
+
+/// Firebase's limit on the serialized custom claims of an account
+pub const MAX_CLAIMS_BYTES: usize = 1000;
+
+/// Claim names Firebase reserves for the token itself
+pub const RESERVED_CLAIMS: [&str; 15] = [
+    "acr",
+    "amr",
+    "at_hash",
+    "aud",
+    "auth_time",
+    "azp",
+    "cnf",
+    "c_hash",
+    "exp",
+    "firebase",
+    "iat",
+    "iss",
+    "nbf",
+    "nonce",
+    "sub",
+];
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "account_token_purpose", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum AccountTokenPurpose {
+    /// Confirms a new address; mailed to that address
+    EmailChange,
+    /// Puts `email` back on the account and logs every device out
+    Recovery,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, FromRow)]
+pub struct AccountToken {
+    pub id: Uuid,
+    pub user_id: Uuid,
+    pub purpose: AccountTokenPurpose,
+    pub token_hash: String,
+    pub email: String,
+    pub previous_email: Option<String>,
+    pub expires_at: DateTime<Utc>,
+    pub used_at: Option<DateTime<Utc>>,
+    pub created_at: DateTime<Utc>,
+}
+
+/// A sign-in account as the identity provider sees it
+#[derive(Debug, Clone, Serialize)]
+pub struct AuthUserRecord {
+    pub uid: String,
+    pub email: Option<String>,
+    pub display_name: Option<String>,
+    pub disabled: bool,
+    pub custom_claims: serde_json::Map<String, serde_json::Value>,
+    pub created_at: Option<DateTime<Utc>>,
+    pub last_login_at: Option<DateTime<Utc>>,
+}
+
+#[derive(Debug, Clone)]
+pub struct NewAuthUser {
+    pub email: String,
+    pub password: String,
+    pub display_name: Option<String>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct RequestEmailChangeRequest {
+    pub new_email: String,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct RequestRecoveryRequest {
+    pub email: String,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct ConfirmTokenRequest {
+    pub token: String,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct EmailChangeResponse {
+    pub email: String,
+}
+
+/// Admin: a sign-in account plus player for test worlds
+#[derive(Debug, Clone, Deserialize)]
+pub struct CreateTestUserRequest {
+    pub email: String,
+    pub password: String,
+    pub display_name: Option<String>,
+    /// Defaults to Phasuttha
+    pub tribe: Option<TribeType>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct SetDisabledRequest {
+    pub disabled: bool,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct SetClaimsRequest {
+    /// Replaces all custom claims; an empty object clears them
+    pub claims: serde_json::Map<String, serde_json::Value>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct LookupAuthUsersRequest {
+    pub uids: Vec<String>,
+}
@@ -0,0 +1,75 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::ip_reputation::IpCategory;
+
+/// Activity older than this is dropped
+pub const ACTIVITY_RETENTION_DAYS: i64 = 180;
+
+/// Longest User-Agent kept
+pub const MAX_DEVICE_LENGTH: usize = 255;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "activity_kind", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum ActivityKind {
+    Login,
+    ArmySent,
+    GoldSpent,
+    /// Support staff acting as the player; `actor_id` is the staff member
+    Impersonated,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ActivityEntry {
+    pub id: i64,
+    pub user_id: Uuid,
+    /// Who acted, when it wasn't the owner
+    pub actor_id: Option<Uuid>,
+    pub kind: ActivityKind,
+    pub client_ip: Option<String>,
+    /// Set on logins from a datacenter, VPN, proxy or Tor address
+    pub ip_category: Option<IpCategory>,
+    pub device: Option<String>,
+    pub details: serde_json::Value,
+    pub created_at: DateTime<Utc>,
+}
+
+/// Where a request came from, read from its headers
+#[derive(Debug, Clone, Default)]
+pub struct RequestOrigin {
+    pub client_ip: Option<String>,
+    /// Only looked up for logins
+    pub ip_category: Option<IpCategory>,
+    pub device: Option<String>,
+}
+
+#[derive(Debug, Clone)]
+pub struct NewActivity {
+    pub user_id: Uuid,
+    pub actor_id: Option<Uuid>,
+    pub kind: ActivityKind,
+    pub origin: RequestOrigin,
+    pub details: serde_json::Value,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct ActivityQuery {
+    pub kind: Option<ActivityKind>,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_limit() -> i64 {
+    50
+}
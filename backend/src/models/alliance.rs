@@ -1,8 +1,35 @@
-use chrono::{DateTime, Utc};
+use chrono::{DateTime, Datelike, Duration, NaiveDate, Utc};
 use serde::{Deserialize, Serialize};
 use sqlx::FromRow;
 use uuid::Uuid;
 
+// ==================== Rules ====================
+
+/// Embassy level the founder needs somewhere to found an alliance
+pub const EMBASSY_LEVEL_TO_FOUND: i32 = 3;
+
+/// Each level of the leader's best embassy makes room for this many members
+pub const MEMBERS_PER_EMBASSY_LEVEL: i32 = 3;
+
+/// How long a merge proposal, and the member invitations it sends out,
+/// stay open
+pub const MERGE_EXPIRY_DAYS: i64 = 7;
+
+/// Members the alliance can hold with its leader's best embassy, never
+/// more than the alliance's hard cap
+pub fn member_capacity(embassy_level: i32, max_members: i32) -> i32 {
+    (embassy_level * MEMBERS_PER_EMBASSY_LEVEL).min(max_members)
+}
+
+/// Resources a member has to ship to alliance mates to match one defense
+/// or war point in the MVP score
+pub const RESOURCES_PER_MVP_POINT: i64 = 100;
+
+/// Monday of the week `date` falls in. Contributions are counted per week.
+pub fn week_start(date: NaiveDate) -> NaiveDate {
+    date - Duration::days(date.weekday().num_days_from_monday() as i64)
+}
+
 // ==================== Enums ====================
 
 #[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, sqlx::Type)]
@@ -34,6 +61,36 @@ pub enum DiplomacyStatus {
     Enemy,
 }
 
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, sqlx::Type)]
+#[sqlx(type_name = "alliance_award_category", rename_all = "lowercase")]
+#[serde(rename_all = "lowercase")]
+pub enum AwardCategory {
+    Defender,
+    Donor,
+    Attacker,
+    Mvp,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, sqlx::Type)]
+#[sqlx(type_name = "alliance_merge_status", rename_all = "lowercase")]
+#[serde(rename_all = "lowercase")]
+pub enum MergeStatus {
+    Pending,
+    Accepted,
+    Rejected,
+    Cancelled,
+    Completed,
+}
+
+impl AwardCategory {
+    pub const ALL: [AwardCategory; 4] = [
+        AwardCategory::Defender,
+        AwardCategory::Donor,
+        AwardCategory::Attacker,
+        AwardCategory::Mvp,
+    ];
+}
+
 // ==================== Database Models ====================
 
 #[derive(Debug, Clone, FromRow)]
@@ -69,6 +126,8 @@ pub struct AllianceInvitation {
     pub created_at: DateTime<Utc>,
     pub expires_at: DateTime<Utc>,
     pub responded_at: Option<DateTime<Utc>>,
+    /// Set when the invitation is part of an alliance merge
+    pub merge_id: Option<Uuid>,
 }
 
 #[derive(Debug, Clone, Serialize, FromRow)]
@@ -82,6 +141,66 @@ pub struct AllianceDiplomacy {
     pub updated_at: DateTime<Utc>,
 }
 
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct AllianceMerge {
+    pub id: Uuid,
+    pub alliance_id: Uuid,
+    pub merging_alliance_id: Option<Uuid>,
+    pub merging_alliance_tag: String,
+    pub proposed_by: Uuid,
+    pub status: MergeStatus,
+    pub created_at: DateTime<Utc>,
+    pub expires_at: DateTime<Utc>,
+    pub responded_at: Option<DateTime<Utc>>,
+    pub completed_at: Option<DateTime<Utc>>,
+}
+
+impl AllianceMerge {
+    /// Still waiting on the merging alliance's leader or its members
+    pub fn is_open(&self, now: DateTime<Utc>) -> bool {
+        matches!(self.status, MergeStatus::Pending | MergeStatus::Accepted) && self.expires_at > now
+    }
+}
+
+/// A member's contributions over one week
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct MemberContribution {
+    pub user_id: Uuid,
+    pub player_name: String,
+    pub defense_points: i64,
+    pub resources_donated: i64,
+    pub war_attacks: i32,
+    pub war_points: i64,
+}
+
+impl MemberContribution {
+    pub fn mvp_score(&self) -> i64 {
+        self.defense_points + self.war_points + self.resources_donated / RESOURCES_PER_MVP_POINT
+    }
+
+    /// What the member is ranked on for an award
+    pub fn score(&self, category: AwardCategory) -> i64 {
+        match category {
+            AwardCategory::Defender => self.defense_points,
+            AwardCategory::Donor => self.resources_donated,
+            AwardCategory::Attacker => self.war_points,
+            AwardCategory::Mvp => self.mvp_score(),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct AllianceAward {
+    pub id: Uuid,
+    pub alliance_id: Uuid,
+    pub week_start: NaiveDate,
+    pub category: AwardCategory,
+    pub user_id: Uuid,
+    pub player_name: String,
+    pub score: i64,
+    pub created_at: DateTime<Utc>,
+}
+
 // ==================== Request DTOs ====================
 
 #[derive(Debug, Deserialize)]
@@ -119,6 +238,23 @@ pub struct SetDiplomacyRequest {
     pub status: DiplomacyStatus,
 }
 
+#[derive(Debug, Deserialize)]
+pub struct ProposeMergeRequest {
+    /// The alliance invited to merge into this one
+    pub target_alliance_id: Uuid,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct RespondMergeRequest {
+    pub accept: bool,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct AllianceStatsQuery {
+    /// Any day in the week to show; defaults to the current week
+    pub week: Option<NaiveDate>,
+}
+
 // ==================== Response DTOs ====================
 
 #[derive(Debug, Clone, Serialize)]
@@ -176,6 +312,16 @@ pub struct AllianceListItem {
     pub total_population: i64,
 }
 
+#[derive(Debug, Clone, Serialize)]
+pub struct AllianceStatsResponse {
+    pub alliance_id: Uuid,
+    pub week_start: NaiveDate,
+    /// Members with anything to show for the week, best MVP score first
+    pub contributions: Vec<MemberContribution>,
+    /// Awards given for the week, once it is over
+    pub awards: Vec<AllianceAward>,
+}
+
 impl From<Alliance> for AllianceResponse {
     fn from(a: Alliance) -> Self {
         Self {
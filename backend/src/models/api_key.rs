@@ -0,0 +1,36 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ApiKey {
+    pub id: Uuid,
+    pub name: String,
+    /// First characters of the key, so admins can tell keys apart
+    pub key_prefix: String,
+    pub created_by: Option<Uuid>,
+    pub created_at: DateTime<Utc>,
+    pub last_used_at: Option<DateTime<Utc>>,
+    pub revoked_at: Option<DateTime<Utc>>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct CreateApiKeyRequest {
+    /// Who the key is for, e.g. the tool's name
+    pub name: String,
+}
+
+// ==================== Response DTOs ====================
+
+/// A new key; `key` is only ever shown here
+#[derive(Debug, Serialize)]
+pub struct CreatedApiKey {
+    pub key: String,
+    #[serde(flatten)]
+    pub api_key: ApiKey,
+}
@@ -16,6 +16,7 @@ pub enum MissionType {
     Support,  // Send troops to defend
     Scout,    // Reconnaissance mission
     Settle,   // Found new village with settlers
+    Transfer, // Move troops for good to another own village
 }
 
 impl MissionType {
@@ -28,11 +29,15 @@ impl MissionType {
     }
 
     pub fn returns(&self) -> bool {
-        // Settle missions don't return
-        !matches!(self, MissionType::Settle)
+        // Settle missions and transfers don't return
+        !matches!(self, MissionType::Settle | MissionType::Transfer)
     }
 }
 
+/// Fields an army marches at its own speed before the home village's
+/// tournament square speeds it up
+pub const TOURNAMENT_SQUARE_DISTANCE: f64 = 20.0;
+
 /// Troops in an army (serialized as JSON in database)
 pub type ArmyTroops = HashMap<TroopType, i32>;
 
@@ -74,6 +79,27 @@ pub struct Army {
     pub is_stationed: bool,
     pub battle_report_id: Option<Uuid>,
     pub created_at: DateTime<Utc>,
+    /// Hero leading the army, if any
+    pub hero_id: Option<Uuid>,
+}
+
+impl Army {
+    /// Order in which movements landing together are resolved: arrival
+    /// time, then launch time, then id, so the outcome never depends on
+    /// which worker picked the batch up
+    pub fn resolution_order(&self) -> (DateTime<Utc>, DateTime<Utc>, Uuid) {
+        (self.arrives_at, self.departed_at, self.id)
+    }
+
+    /// Whether this fresh read is still the arrival `seen` was taken for.
+    /// Resolving an arrival stations the army, turns it home (which moves
+    /// `arrives_at`) or deletes it, so a movement another worker resolved
+    /// in between fails at least one of these.
+    pub fn still_due(&self, seen: &Army) -> bool {
+        self.arrives_at == seen.arrives_at
+            && self.is_returning == seen.is_returning
+            && !self.is_stationed
+    }
 }
 
 /// Battle report record
@@ -89,11 +115,19 @@ pub struct BattleReport {
     pub defender_troops: sqlx::types::Json<ArmyTroops>,
     pub attacker_losses: sqlx::types::Json<ArmyTroops>,
     pub defender_losses: sqlx::types::Json<ArmyTroops>,
+    /// Part of the defender's losses taken to the village's hospital
+    #[serde(default)]
+    pub defender_wounded: sqlx::types::Json<ArmyTroops>,
     pub resources_stolen: sqlx::types::Json<CarriedResources>,
     pub winner: String, // "attacker", "defender", "draw"
     pub occurred_at: DateTime<Utc>,
     pub read_by_attacker: bool,
     pub read_by_defender: bool,
+    /// Hidden from that side's reports; restorable until purged
+    #[serde(default)]
+    pub deleted_by_attacker: bool,
+    #[serde(default)]
+    pub deleted_by_defender: bool,
     pub created_at: DateTime<Utc>,
 }
 
@@ -115,12 +149,17 @@ pub struct ScoutReport {
     pub occurred_at: DateTime<Utc>,
     pub read_by_attacker: bool,
     pub read_by_defender: bool,
+    /// Hidden from that side's reports; restorable until purged
+    #[serde(default)]
+    pub deleted_by_attacker: bool,
+    #[serde(default)]
+    pub deleted_by_defender: bool,
     pub created_at: DateTime<Utc>,
 }
 
 // Request/Response DTOs
 
-#[derive(Debug, Clone, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct SendArmyRequest {
     pub to_x: i32,
     pub to_y: i32,
@@ -128,6 +167,90 @@ pub struct SendArmyRequest {
     pub troops: HashMap<TroopType, i32>,
     #[serde(default)]
     pub resources: CarriedResources,
+    /// Hero to lead a raid or attack; required to occupy an oasis
+    #[serde(default)]
+    pub hero_id: Option<Uuid>,
+}
+
+/// Work out a march without sending anything
+#[derive(Debug, Clone, Deserialize)]
+pub struct PlanArmyRequest {
+    pub to_x: i32,
+    pub to_y: i32,
+    pub mission: MissionType,
+    pub troops: HashMap<TroopType, i32>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct ArmyPlanResponse {
+    pub distance: f64,
+    /// Fields per hour of the slowest unit
+    pub slowest_speed: i32,
+    pub tournament_square_level: i32,
+    /// Applied beyond `boost_after_distance` fields
+    pub speed_bonus_percent: i32,
+    pub boost_after_distance: f64,
+    pub travel_seconds: i64,
+    /// If sent now
+    pub arrives_at: DateTime<Utc>,
+    pub returns_at: Option<DateTime<Utc>>,
+}
+
+/// Something a player may not mean to do, shown before they confirm a
+/// hostile march
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ArmyWarning {
+    /// The target is in the sender's own alliance
+    OwnAlliance,
+    /// The sender's alliance has a non-aggression pact with the target's
+    NonAggressionPact,
+    /// The sender's alliance is allied with the target's
+    Confederation,
+}
+
+impl ArmyWarning {
+    pub fn message(&self) -> &'static str {
+        match self {
+            ArmyWarning::OwnAlliance => "The target is a member of your alliance",
+            ArmyWarning::NonAggressionPact => {
+                "Your alliance has a non-aggression pact with the target's alliance"
+            }
+            ArmyWarning::Confederation => "Your alliance is allied with the target's alliance",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct ArmyWarningResponse {
+    pub code: ArmyWarning,
+    pub message: &'static str,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct PreparedTarget {
+    pub village_id: Uuid,
+    pub village_name: String,
+    pub player_id: Uuid,
+    pub player_name: Option<String>,
+    pub alliance_tag: Option<String>,
+}
+
+/// What sending a march would do, checked against the same rules as
+/// sending it. Errors come back exactly as the send would return them.
+#[derive(Debug, Clone, Serialize)]
+pub struct PrepareArmyResponse {
+    pub mission: MissionType,
+    pub distance: f64,
+    pub travel_seconds: i64,
+    /// If sent now
+    pub arrives_at: DateTime<Utc>,
+    pub returns_at: Option<DateTime<Utc>>,
+    /// Resources the troops can bring back
+    pub carry_capacity: i32,
+    /// None when the tile has no village
+    pub target: Option<PreparedTarget>,
+    pub warnings: Vec<ArmyWarningResponse>,
 }
 
 #[derive(Debug, Clone, Serialize)]
@@ -146,6 +269,7 @@ pub struct ArmyResponse {
     pub returns_at: Option<DateTime<Utc>>,
     pub is_returning: bool,
     pub is_stationed: bool,
+    pub hero_id: Option<Uuid>,
 }
 
 impl From<Army> for ArmyResponse {
@@ -165,10 +289,67 @@ impl From<Army> for ArmyResponse {
             returns_at: a.returns_at,
             is_returning: a.is_returning,
             is_stationed: a.is_stationed,
+            hero_id: a.hero_id,
         }
     }
 }
 
+// ==================== Rally Point ====================
+
+/// How long after departure an attack or reinforcement may still be called off
+pub const CANCEL_GRACE_SECS: i64 = 90;
+
+/// A movement as seen from one village's rally point
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum MovementDirection {
+    /// On its way here
+    Incoming,
+    /// Sent from here, not yet arrived
+    Outgoing,
+    /// Coming back home
+    Returning,
+    /// Reinforcements from others standing in this village
+    StationedHere,
+    /// This village's troops reinforcing another
+    StationedElsewhere,
+}
+
+#[derive(Debug, Clone, Default, Deserialize)]
+pub struct RallyPointQuery {
+    pub direction: Option<MovementDirection>,
+    pub mission: Option<MissionType>,
+    /// Only hostile (true) or only peaceful (false) movements
+    pub hostile: Option<bool>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RallyPointMovement {
+    pub direction: MovementDirection,
+    #[serde(flatten)]
+    pub army: ArmyResponse,
+    /// Set while the owner can still cancel it
+    pub cancellable_until: Option<DateTime<Utc>>,
+}
+
+/// Movement counts before filters, for the rally point tabs
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct RallyPointCounts {
+    pub incoming: i64,
+    pub incoming_hostile: i64,
+    pub outgoing: i64,
+    pub returning: i64,
+    pub stationed_here: i64,
+    pub stationed_elsewhere: i64,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RallyPointResponse {
+    pub village_id: Uuid,
+    pub counts: RallyPointCounts,
+    pub movements: Vec<RallyPointMovement>,
+}
+
 #[derive(Debug, Clone, Serialize)]
 pub struct BattleReportResponse {
     pub id: Uuid,
@@ -181,6 +362,7 @@ pub struct BattleReportResponse {
     pub defender_troops: ArmyTroops,
     pub attacker_losses: ArmyTroops,
     pub defender_losses: ArmyTroops,
+    pub defender_wounded: ArmyTroops,
     pub resources_stolen: CarriedResources,
     pub winner: String,
     pub occurred_at: DateTime<Utc>,
@@ -200,6 +382,7 @@ impl BattleReport {
             defender_troops: self.defender_troops.0.clone(),
             attacker_losses: self.attacker_losses.0.clone(),
             defender_losses: self.defender_losses.0.clone(),
+            defender_wounded: self.defender_wounded.0.clone(),
             resources_stolen: self.resources_stolen.0.clone(),
             winner: self.winner.clone(),
             occurred_at: self.occurred_at,
@@ -246,3 +429,25 @@ impl ScoutReport {
         }
     }
 }
+
+// ==================== Troop Transfers ====================
+
+/// Share of the training cost paid to move troops to another village for good
+pub const TRANSFER_COST_PERCENT: i32 = 10;
+
+/// Move troops for good to another of the player's villages. They march
+/// there like a reinforcement and join its garrison on arrival.
+#[derive(Debug, Clone, Deserialize)]
+pub struct TransferTroopsRequest {
+    pub to_village_id: Uuid,
+    pub troops: HashMap<TroopType, i32>,
+}
+
+/// A reinforcement standing in one of the player's own villages, turned
+/// into that village's own troops
+#[derive(Debug, Clone, Serialize)]
+pub struct MergeStationedResponse {
+    pub village_id: Uuid,
+    pub troops: ArmyTroops,
+    pub cost: CarriedResources,
+}
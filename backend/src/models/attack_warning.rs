@@ -0,0 +1,38 @@
+use chrono::{DateTime, Utc};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use crate::models::army::MissionType;
+
+// ==================== Rules ====================
+
+/// Players without a session seen this recently count as offline
+pub const OFFLINE_MINUTES: i64 = 10;
+
+/// How often incoming attacks are checked for warnings
+pub const ATTACK_WARNING_INTERVAL_SECS: u64 = 300;
+
+// ==================== Database Models ====================
+
+/// An offline, opted-in player with attacks they haven't been warned about
+#[derive(Debug, Clone, FromRow)]
+pub struct AttackWarningRecipient {
+    pub user_id: Uuid,
+    pub email: String,
+    pub display_name: Option<String>,
+    pub locale: String,
+}
+
+/// A hostile army on its way to one of the player's villages
+#[derive(Debug, Clone, FromRow)]
+pub struct IncomingAttack {
+    pub army_id: Uuid,
+    pub mission: MissionType,
+    pub arrives_at: DateTime<Utc>,
+    pub attacker_name: Option<String>,
+    pub from_x: i32,
+    pub from_y: i32,
+    pub village_name: String,
+    pub village_x: i32,
+    pub village_y: i32,
+}
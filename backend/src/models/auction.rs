@@ -0,0 +1,145 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::hero::{ItemDefinitionResponse, ItemRarity, ItemSlot};
+
+// ==================== Rules ====================
+
+/// How long an auction may run, in hours
+pub const MIN_AUCTION_HOURS: i64 = 1;
+pub const MAX_AUCTION_HOURS: i64 = 72;
+
+/// A bid in the last few minutes pushes the end back to this long after
+/// the bid, so nobody wins by bidding in the final second
+pub const SNIPE_WINDOW_SECS: i64 = 300;
+
+/// Each bid must beat the leading one by at least this share
+pub const MIN_RAISE_PERCENT: i32 = 5;
+
+/// Auctions closed per job run
+pub const CLOSE_BATCH: i64 = 100;
+
+/// Lowest bid the auction accepts next
+pub fn min_next_bid(starting_bid: i32, current_bid: Option<i32>) -> i32 {
+    match current_bid {
+        Some(bid) => bid + (bid * MIN_RAISE_PERCENT / 100).max(1),
+        None => starting_bid,
+    }
+}
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "auction_currency", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum AuctionCurrency {
+    Silver,
+    Gold,
+}
+
+impl AuctionCurrency {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            AuctionCurrency::Silver => "silver",
+            AuctionCurrency::Gold => "gold",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "auction_status", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum AuctionStatus {
+    Open,
+    /// Closed with a winning bid
+    Sold,
+    /// Closed without bids; the item went back to the seller
+    Expired,
+    /// Withdrawn by the seller before anyone bid
+    Cancelled,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct HeroAuction {
+    pub id: Uuid,
+    pub seller_id: Uuid,
+    pub seller_hero_id: Option<Uuid>,
+    pub item_definition_id: Uuid,
+    pub quantity: i32,
+    pub currency: AuctionCurrency,
+    pub starting_bid: i32,
+    pub current_bid: Option<i32>,
+    pub bidder_id: Option<Uuid>,
+    pub bidder_hero_id: Option<Uuid>,
+    pub bid_count: i32,
+    pub ends_at: DateTime<Utc>,
+    pub status: AuctionStatus,
+    pub closed_at: Option<DateTime<Utc>>,
+    pub created_at: DateTime<Utc>,
+    pub version: i32,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct CreateAuctionRequest {
+    /// Hero whose inventory holds the item
+    pub hero_id: Uuid,
+    pub item_id: Uuid,
+    /// Part of a stack; omitted = the whole stack
+    pub quantity: Option<i32>,
+    pub currency: AuctionCurrency,
+    pub starting_bid: i32,
+    pub duration_hours: i64,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct PlaceBidRequest {
+    /// Hero that receives the item if the bid wins
+    pub hero_id: Uuid,
+    pub amount: i32,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct AuctionQuery {
+    pub slot: Option<ItemSlot>,
+    pub rarity: Option<ItemRarity>,
+    pub currency: Option<AuctionCurrency>,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+}
+
+fn default_limit() -> i64 {
+    50
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct AuctionResponse {
+    pub id: Uuid,
+    pub item: ItemDefinitionResponse,
+    pub quantity: i32,
+    pub currency: AuctionCurrency,
+    pub starting_bid: i32,
+    pub current_bid: Option<i32>,
+    /// Lowest bid accepted next
+    pub min_bid: i32,
+    pub bid_count: i32,
+    pub ends_at: DateTime<Utc>,
+    pub status: AuctionStatus,
+    pub is_seller: bool,
+    pub is_leading: bool,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct MyAuctionsResponse {
+    pub silver_balance: i32,
+    pub gold_balance: i32,
+    /// The player's recent listings
+    pub selling: Vec<AuctionResponse>,
+    /// Open auctions the player is leading
+    pub leading: Vec<AuctionResponse>,
+}
@@ -0,0 +1,79 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+/// Object keys whose values are never stored (matched case-insensitively
+/// as substrings, so `access_token` and `newPassword` are caught too)
+pub const REDACTED_KEYS: &[&str] = &[
+    "token",
+    "password",
+    "secret",
+    "authorization",
+    "signature",
+    "api_key",
+    "apikey",
+    "card",
+    "cvc",
+    "cookie",
+];
+
+pub const REDACTED_VALUE: &str = "[REDACTED]";
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct AuditLogEntry {
+    pub id: i64,
+    pub user_id: Option<Uuid>,
+    pub firebase_uid: Option<String>,
+    pub method: String,
+    pub route: String,
+    pub path: String,
+    pub status: i32,
+    pub payload: Option<serde_json::Value>,
+    pub duration_ms: i32,
+    pub client_ip: Option<String>,
+    /// Staff member who made the call while impersonating the player
+    pub impersonator_id: Option<Uuid>,
+    pub created_at: DateTime<Utc>,
+}
+
+/// Captured by the audit middleware, written off the request path
+#[derive(Debug, Clone)]
+pub struct NewAuditLogEntry {
+    pub firebase_uid: Option<String>,
+    pub method: String,
+    pub route: String,
+    pub path: String,
+    pub status: i32,
+    pub payload: Option<serde_json::Value>,
+    pub duration_ms: i32,
+    pub client_ip: Option<String>,
+    pub impersonator_id: Option<Uuid>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct AuditLogQuery {
+    pub user_id: Option<Uuid>,
+    pub route: Option<String>,
+    pub method: Option<String>,
+    /// Only failed calls (status >= 400)
+    #[serde(default)]
+    pub failed_only: bool,
+    /// Only calls made while impersonating
+    #[serde(default)]
+    pub impersonated_only: bool,
+    pub from: Option<DateTime<Utc>>,
+    pub to: Option<DateTime<Utc>>,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_limit() -> i64 {
+    50
+}
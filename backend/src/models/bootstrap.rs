@@ -0,0 +1,35 @@
+use serde::Serialize;
+
+use super::army::ArmyResponse;
+use super::user::{EmailPreferences, UserResponse};
+use super::village::VillageResponse;
+use super::world_setting::FeatureToggles;
+use super::world_status::WorldStatusResponse;
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct UnreadCounts {
+    pub messages: i64,
+    pub alliance_messages: i64,
+    /// Battle and scout reports
+    pub reports: i64,
+}
+
+/// Everything the client needs on startup, in one response
+#[derive(Debug, Clone, Serialize)]
+pub struct BootstrapResponse {
+    pub user: UserResponse,
+    pub email_preferences: EmailPreferences,
+    pub features: FeatureToggles,
+    pub villages: Vec<VillageResponse>,
+    pub unread: UnreadCounts,
+    /// The player's own armies, moving or stationed
+    pub outgoing: Vec<ArmyResponse>,
+    /// Other players' armies on their way to the player's villages
+    pub incoming: Vec<ArmyResponse>,
+    /// World timeline and milestones
+    pub world: WorldStatusResponse,
+    /// Pass to /api/v1/sync to get changes made after this response
+    pub sync_cursor: i64,
+}
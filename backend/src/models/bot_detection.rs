@@ -0,0 +1,128 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Rules ====================
+
+/// Commands of the last this-many hours are analyzed
+pub const ANALYSIS_WINDOW_HOURS: i64 = 24;
+
+/// Fewer commands than this say too little to score
+pub const MIN_COMMANDS: usize = 30;
+
+/// Gaps between commands are bucketed to whole seconds up to this cap
+pub const MAX_GAP_SECS: i64 = 600;
+
+/// Entropy, in bits, below which the rhythm of commands looks machine-made
+pub const LOW_ENTROPY_BITS: f64 = 2.5;
+
+/// Active in this many of the last 24 hours is hard to do by hand
+pub const SLEEPLESS_HOURS: i32 = 20;
+
+/// Commands in one minute no player can click through
+pub const IMPOSSIBLE_PER_MINUTE: i32 = 60;
+
+/// Players scoring at least this land in the review queue
+pub const REVIEW_SCORE: i32 = 50;
+
+/// Players scoring at least this must pass a challenge until cleared
+pub const CHALLENGE_SCORE: i32 = 70;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "bot_review_status", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum BotReviewStatus {
+    Pending,
+    /// Reviewed and found human; no more challenges
+    Cleared,
+    Confirmed,
+}
+
+// ==================== Suspicion ====================
+
+/// What the detector measured for one player
+#[derive(Debug, Clone, Copy, Serialize)]
+pub struct BotSignals {
+    pub timing_entropy: f64,
+    pub active_hours: i32,
+    pub peak_per_minute: i32,
+    pub commands_analyzed: i32,
+}
+
+impl BotSignals {
+    /// 0-100: up to 40 for a regular rhythm, 30 for round-the-clock play
+    /// and 30 for click rates beyond human reach
+    pub fn score(&self) -> i32 {
+        let rhythm = if self.timing_entropy < LOW_ENTROPY_BITS {
+            40.0 * (1.0 - self.timing_entropy / LOW_ENTROPY_BITS)
+        } else {
+            0.0
+        };
+        let sleepless = match self.active_hours {
+            h if h >= SLEEPLESS_HOURS => 30,
+            h if h >= SLEEPLESS_HOURS - 4 => (h - (SLEEPLESS_HOURS - 4)) * 30 / 4,
+            _ => 0,
+        };
+        let clicks = match self.peak_per_minute {
+            n if n >= IMPOSSIBLE_PER_MINUTE => 30,
+            n if n >= IMPOSSIBLE_PER_MINUTE / 2 => {
+                (n - IMPOSSIBLE_PER_MINUTE / 2) * 30 / (IMPOSSIBLE_PER_MINUTE / 2)
+            }
+            _ => 0,
+        };
+        (rhythm.round() as i32 + sleepless + clicks).min(100)
+    }
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct BotSuspicion {
+    pub user_id: Uuid,
+    pub score: i32,
+    pub timing_entropy: f64,
+    pub active_hours: i32,
+    pub peak_per_minute: i32,
+    pub commands_analyzed: i32,
+    pub challenge_required: bool,
+    pub status: BotReviewStatus,
+    pub reviewed_by: Option<Uuid>,
+    pub reviewed_at: Option<DateTime<Utc>>,
+    pub review_note: Option<String>,
+    pub created_at: DateTime<Utc>,
+    pub updated_at: DateTime<Utc>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct BotReviewQuery {
+    #[serde(default = "default_review_status")]
+    pub status: BotReviewStatus,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_review_status() -> BotReviewStatus {
+    BotReviewStatus::Pending
+}
+
+fn default_limit() -> i64 {
+    50
+}
+
+/// Admin verdict on a suspected bot
+#[derive(Debug, Clone, Deserialize)]
+pub struct ReviewBotSuspicionRequest {
+    pub status: BotReviewStatus,
+    pub note: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct BotScanResult {
+    pub players_scanned: i32,
+    pub flagged: i32,
+}
@@ -3,7 +3,9 @@ use serde::{Deserialize, Serialize};
 use sqlx::FromRow;
 use uuid::Uuid;
 
-#[derive(Debug, Clone, Serialize, Deserialize, sqlx::Type, PartialEq)]
+use super::gamedata::definitions;
+
+#[derive(Debug, Clone, Serialize, Deserialize, sqlx::Type, PartialEq, Eq, Hash)]
 #[sqlx(type_name = "building_type", rename_all = "snake_case")]
 #[serde(rename_all = "snake_case")]
 pub enum BuildingType {
@@ -25,6 +27,13 @@ pub enum BuildingType {
     Treasury,
     TradeOffice,
     Wall,
+    HeroMansion,
+    TournamentSquare,
+    Hospital,
+    // Tribe buildings
+    ElephantTrough,
+    Brewery,
+    Trapper,
     // Resource fields
     Woodcutter,
     ClayPit,
@@ -40,6 +49,36 @@ pub struct BuildingPrerequisite {
 }
 
 impl BuildingType {
+    pub const ALL: &'static [BuildingType] = &[
+        BuildingType::MainBuilding,
+        BuildingType::Warehouse,
+        BuildingType::Granary,
+        BuildingType::Barracks,
+        BuildingType::Stable,
+        BuildingType::Workshop,
+        BuildingType::Academy,
+        BuildingType::Smithy,
+        BuildingType::RallyPoint,
+        BuildingType::Market,
+        BuildingType::Embassy,
+        BuildingType::TownHall,
+        BuildingType::Residence,
+        BuildingType::Palace,
+        BuildingType::Treasury,
+        BuildingType::TradeOffice,
+        BuildingType::Wall,
+        BuildingType::HeroMansion,
+        BuildingType::TournamentSquare,
+        BuildingType::Hospital,
+        BuildingType::ElephantTrough,
+        BuildingType::Brewery,
+        BuildingType::Trapper,
+        BuildingType::Woodcutter,
+        BuildingType::ClayPit,
+        BuildingType::IronMine,
+        BuildingType::CropField,
+    ];
+
     pub fn is_resource_field(&self) -> bool {
         matches!(
             self,
@@ -51,87 +90,12 @@ impl BuildingType {
     }
 
     pub fn max_level(&self) -> i32 {
-        match self {
-            BuildingType::Wall => 20,
-            BuildingType::Palace | BuildingType::Residence => 20,
-            _ if self.is_resource_field() => 20,
-            _ => 20,
-        }
+        definitions().building(self).max_level
     }
 
-    /// Get prerequisites for building this type
-    /// Based on Travian building requirements
+    /// Get prerequisites for building this type, from gamedata/buildings.yaml
     pub fn prerequisites(&self) -> Vec<BuildingPrerequisite> {
-        match self {
-            // Basic buildings - no prerequisites
-            BuildingType::MainBuilding => vec![],
-            BuildingType::RallyPoint => vec![],
-            BuildingType::Warehouse => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 1 },
-            ],
-            BuildingType::Granary => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 1 },
-            ],
-            BuildingType::Wall => vec![],
-
-            // Military buildings
-            BuildingType::Barracks => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 3 },
-                BuildingPrerequisite { building_type: BuildingType::RallyPoint, min_level: 1 },
-            ],
-            BuildingType::Stable => vec![
-                BuildingPrerequisite { building_type: BuildingType::Smithy, min_level: 3 },
-                BuildingPrerequisite { building_type: BuildingType::Academy, min_level: 5 },
-            ],
-            BuildingType::Workshop => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 5 },
-                BuildingPrerequisite { building_type: BuildingType::Academy, min_level: 10 },
-            ],
-            BuildingType::Smithy => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 3 },
-                BuildingPrerequisite { building_type: BuildingType::Barracks, min_level: 1 },
-            ],
-            BuildingType::Academy => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 3 },
-                BuildingPrerequisite { building_type: BuildingType::Barracks, min_level: 3 },
-            ],
-
-            // Economic buildings
-            BuildingType::Market => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 1 },
-                BuildingPrerequisite { building_type: BuildingType::Warehouse, min_level: 1 },
-                BuildingPrerequisite { building_type: BuildingType::Granary, min_level: 1 },
-            ],
-            BuildingType::TradeOffice => vec![
-                BuildingPrerequisite { building_type: BuildingType::Stable, min_level: 10 },
-                BuildingPrerequisite { building_type: BuildingType::Market, min_level: 20 },
-            ],
-
-            // Government buildings
-            BuildingType::Embassy => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 1 },
-            ],
-            BuildingType::TownHall => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 10 },
-                BuildingPrerequisite { building_type: BuildingType::Academy, min_level: 10 },
-            ],
-            BuildingType::Residence => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 5 },
-            ],
-            BuildingType::Palace => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 5 },
-                BuildingPrerequisite { building_type: BuildingType::Embassy, min_level: 1 },
-            ],
-            BuildingType::Treasury => vec![
-                BuildingPrerequisite { building_type: BuildingType::MainBuilding, min_level: 10 },
-            ],
-
-            // Resource fields - no prerequisites
-            BuildingType::Woodcutter => vec![],
-            BuildingType::ClayPit => vec![],
-            BuildingType::IronMine => vec![],
-            BuildingType::CropField => vec![],
-        }
+        definitions().building(self).prerequisites.clone()
     }
 
     /// Population consumed by this building at given level
@@ -140,42 +104,21 @@ impl BuildingType {
             return 0;
         }
 
-        let base = match self {
-            // Resource fields - low population
-            BuildingType::Woodcutter => 2,
-            BuildingType::ClayPit => 2,
-            BuildingType::IronMine => 3,
-            BuildingType::CropField => 0, // Crop fields don't consume pop
-
-            // Basic buildings
-            BuildingType::MainBuilding => 2,
-            BuildingType::Warehouse => 1,
-            BuildingType::Granary => 1,
-            BuildingType::RallyPoint => 1,
-            BuildingType::Wall => 0,
-
-            // Military buildings - higher population
-            BuildingType::Barracks => 4,
-            BuildingType::Stable => 5,
-            BuildingType::Workshop => 6,
-            BuildingType::Smithy => 4,
-            BuildingType::Academy => 4,
-
-            // Economic buildings
-            BuildingType::Market => 4,
-            BuildingType::TradeOffice => 6,
-
-            // Government buildings
-            BuildingType::Embassy => 3,
-            BuildingType::TownHall => 4,
-            BuildingType::Residence => 1,
-            BuildingType::Palace => 1,
-            BuildingType::Treasury => 4,
-        };
+        let base = definitions().building(self).population;
 
         // Population increases slightly with level
         base + (level - 1) / 5
     }
+
+    /// Culture points per day produced by this building at given level
+    pub fn culture_points_at_level(&self, level: i32) -> i32 {
+        if level == 0 {
+            return 0;
+        }
+
+        let base = definitions().building(self).culture_points;
+        (base as f64 * 1.2_f64.powi(level - 1)).round() as i32
+    }
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
@@ -189,6 +132,7 @@ pub struct Building {
     pub upgrade_ends_at: Option<DateTime<Utc>>,
     pub created_at: DateTime<Utc>,
     pub updated_at: DateTime<Utc>,
+    pub version: i32,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -206,6 +150,7 @@ pub struct BuildingResponse {
     pub level: i32,
     pub is_upgrading: bool,
     pub upgrade_ends_at: Option<DateTime<Utc>>,
+    pub version: i32,
 }
 
 impl From<Building> for BuildingResponse {
@@ -217,10 +162,37 @@ impl From<Building> for BuildingResponse {
             level: b.level,
             is_upgrading: b.is_upgrading,
             upgrade_ends_at: b.upgrade_ends_at,
+            version: b.version,
         }
     }
 }
 
+#[derive(Debug, Clone, Deserialize)]
+pub struct BuildRequest {
+    pub building_type: BuildingType,
+}
+
+/// An order that started goes in `building`; one that had to wait for a
+/// build slot goes in `waiting` and has no building yet
+#[derive(Debug, Serialize)]
+pub struct BuildResponse {
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub building: Option<BuildingResponse>,
+    pub cost: BuildingCost,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub waiting: Option<BuildOrder>,
+}
+
+/// `building` is as it is now; the upgrade is in `waiting` if it had to
+/// wait for a build slot
+#[derive(Debug, Serialize)]
+pub struct UpgradeResponse {
+    pub building: BuildingResponse,
+    pub cost: BuildingCost,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub waiting: Option<BuildOrder>,
+}
+
 // Building costs and production rates
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct BuildingCost {
@@ -233,87 +205,7 @@ pub struct BuildingCost {
 
 impl BuildingType {
     pub fn base_cost(&self) -> BuildingCost {
-        match self {
-            BuildingType::MainBuilding => BuildingCost {
-                wood: 70,
-                clay: 40,
-                iron: 60,
-                crop: 20,
-                time_seconds: 300,
-            },
-            BuildingType::Warehouse => BuildingCost {
-                wood: 130,
-                clay: 160,
-                iron: 90,
-                crop: 40,
-                time_seconds: 400,
-            },
-            BuildingType::Granary => BuildingCost {
-                wood: 80,
-                clay: 100,
-                iron: 70,
-                crop: 20,
-                time_seconds: 350,
-            },
-            BuildingType::Barracks => BuildingCost {
-                wood: 210,
-                clay: 140,
-                iron: 260,
-                crop: 120,
-                time_seconds: 600,
-            },
-            BuildingType::RallyPoint => BuildingCost {
-                wood: 110,
-                clay: 160,
-                iron: 90,
-                crop: 70,
-                time_seconds: 250,
-            },
-            BuildingType::Market => BuildingCost {
-                wood: 80,
-                clay: 70,
-                iron: 120,
-                crop: 70,
-                time_seconds: 400,
-            },
-            // Resource fields
-            BuildingType::Woodcutter => BuildingCost {
-                wood: 40,
-                clay: 100,
-                iron: 50,
-                crop: 60,
-                time_seconds: 260,
-            },
-            BuildingType::ClayPit => BuildingCost {
-                wood: 80,
-                clay: 40,
-                iron: 80,
-                crop: 50,
-                time_seconds: 220,
-            },
-            BuildingType::IronMine => BuildingCost {
-                wood: 100,
-                clay: 80,
-                iron: 30,
-                crop: 60,
-                time_seconds: 450,
-            },
-            BuildingType::CropField => BuildingCost {
-                wood: 70,
-                clay: 90,
-                iron: 70,
-                crop: 20,
-                time_seconds: 150,
-            },
-            // Default for others
-            _ => BuildingCost {
-                wood: 100,
-                clay: 100,
-                iron: 100,
-                crop: 50,
-                time_seconds: 300,
-            },
-        }
+        definitions().building(self).cost.clone()
     }
 
     pub fn cost_at_level(&self, level: i32) -> BuildingCost {
@@ -337,6 +229,34 @@ impl BuildingType {
         (base as f64 * (1.63_f64).powi(level - 1) * 1.0034_f64.powi((level - 1) * (level - 1))) as i32
     }
 
+    /// Effect, in percent, of a tribe building at given level: crop upkeep
+    /// saved (elephant trough), attack from the village (brewery) or
+    /// defense of the village (trapper)
+    pub fn tribe_bonus_percent(&self, level: i32) -> i32 {
+        match self {
+            BuildingType::ElephantTrough | BuildingType::Brewery | BuildingType::Trapper => level,
+            _ => 0,
+        }
+    }
+
+    /// Troop speed bonus, in percent, a tournament square at given level
+    /// gives on the stretch of a march beyond `TOURNAMENT_SQUARE_DISTANCE`
+    pub fn speed_bonus_percent(&self, level: i32) -> i32 {
+        match self {
+            BuildingType::TournamentSquare => level * 20,
+            _ => 0,
+        }
+    }
+
+    /// Share, in percent, of a village's own defensive losses a hospital
+    /// at given level takes in as wounded rather than dead
+    pub fn wounded_percent(&self, level: i32) -> i32 {
+        match self {
+            BuildingType::Hospital => level * 2,
+            _ => 0,
+        }
+    }
+
     /// Storage capacity for Warehouse/Granary at given level
     /// Based on Travian formula: base * 1.2^level
     pub fn storage_capacity(&self, level: i32) -> i32 {
@@ -351,3 +271,57 @@ impl BuildingType {
         (base as f64 * (1.2_f64).powi(level)) as i32
     }
 }
+
+// Build slots
+
+/// Orders that may wait for a build slot with a premium subscription
+pub const PREMIUM_WAITING_SLOTS: i64 = 1;
+
+/// What a build slot is for. Tribes with a split build queue have one
+/// slot for fields and one for village buildings; everyone else has one
+/// shared slot.
+#[derive(Debug, Clone, Copy, Serialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum BuildSlot {
+    Any,
+    Fields,
+    Buildings,
+}
+
+impl BuildSlot {
+    pub fn for_building(split: bool, building_type: &BuildingType) -> Self {
+        match (split, building_type.is_resource_field()) {
+            (false, _) => BuildSlot::Any,
+            (true, true) => BuildSlot::Fields,
+            (true, false) => BuildSlot::Buildings,
+        }
+    }
+}
+
+/// A paid build order waiting for its slot to free up
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct BuildOrder {
+    pub id: Uuid,
+    pub village_id: Uuid,
+    /// None for a new building
+    pub building_id: Option<Uuid>,
+    pub slot: i32,
+    pub building_type: BuildingType,
+    pub target_level: i32,
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+    pub time_seconds: i32,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct BuildSlotsResponse {
+    /// Slots builds run in at the same time
+    pub slots: Vec<BuildSlot>,
+    /// Orders that may wait; more with a premium subscription
+    pub waiting_slots: i64,
+    pub active: Vec<BuildingResponse>,
+    pub waiting: Vec<BuildOrder>,
+}
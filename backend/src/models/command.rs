@@ -0,0 +1,177 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::army::SendArmyRequest;
+use super::building::BuildingType;
+use super::hero::AssignAttributesRequest;
+use super::troop::TroopType;
+
+pub const STATUS_PENDING: &str = "pending";
+pub const STATUS_SUCCEEDED: &str = "succeeded";
+pub const STATUS_REJECTED: &str = "rejected";
+
+// ==================== Scheduling Limits ====================
+
+/// Scheduled commands a player may have waiting at once
+pub const MAX_SCHEDULED_COMMANDS: i64 = 5;
+
+/// Furthest ahead a command may be scheduled
+pub const MAX_SCHEDULE_AHEAD_HOURS: i64 = 24;
+
+/// Scheduled commands a player may create per day, cancelled ones included
+pub const MAX_SCHEDULED_PER_DAY: i64 = 50;
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "scheduled_command_status", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum ScheduledCommandStatus {
+    Pending,
+    Executed,
+    Failed,
+    Cancelled,
+}
+
+// ==================== Database Models ====================
+
+/// A submitted command; the per-player action log
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct PlayerCommand {
+    pub command_id: Uuid,
+    pub user_id: Uuid,
+    pub command_type: String,
+    pub payload: serde_json::Value,
+    pub status: String,
+    pub result: Option<serde_json::Value>,
+    pub error_status: Option<i32>,
+    pub error_message: Option<String>,
+    pub error_code: Option<String>,
+    pub created_at: DateTime<Utc>,
+    pub completed_at: Option<DateTime<Utc>>,
+}
+
+/// A command waiting for, or run at, its scheduled time
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ScheduledCommand {
+    pub id: Uuid,
+    pub user_id: Uuid,
+    /// Id the command runs under; look up its outcome like any command
+    pub command_id: Uuid,
+    pub command_type: String,
+    pub payload: serde_json::Value,
+    pub execute_at: DateTime<Utc>,
+    pub status: ScheduledCommandStatus,
+    pub error: Option<String>,
+    pub created_at: DateTime<Utc>,
+    pub executed_at: Option<DateTime<Utc>>,
+}
+
+// ==================== Commands ====================
+
+/// `{"command_id": "...", "type": "build", "payload": {...}}`
+#[derive(Debug, Clone, Deserialize)]
+pub struct CommandEnvelope {
+    /// Client-generated; resubmitting the same id returns the original outcome
+    pub command_id: Uuid,
+    #[serde(rename = "type")]
+    pub command_type: String,
+    #[serde(default)]
+    pub payload: serde_json::Value,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+#[serde(tag = "type", content = "payload", rename_all = "snake_case")]
+pub enum GameCommand {
+    RenameVillage {
+        village_id: Uuid,
+        name: String,
+    },
+    Build {
+        village_id: Uuid,
+        slot: i32,
+        building_type: BuildingType,
+    },
+    UpgradeBuilding {
+        village_id: Uuid,
+        slot: i32,
+    },
+    DemolishBuilding {
+        village_id: Uuid,
+        slot: i32,
+    },
+    TrainTroops {
+        village_id: Uuid,
+        troop_type: TroopType,
+        count: i32,
+    },
+    CancelTraining {
+        village_id: Uuid,
+        queue_id: Uuid,
+    },
+    SendArmy {
+        village_id: Uuid,
+        #[serde(flatten)]
+        request: SendArmyRequest,
+    },
+    RecallSupport {
+        army_id: Uuid,
+    },
+    ChangeHeroHome {
+        hero_id: Uuid,
+        village_id: Uuid,
+    },
+    AssignHeroAttributes {
+        hero_id: Uuid,
+        #[serde(flatten)]
+        request: AssignAttributesRequest,
+    },
+}
+
+impl GameCommand {
+    pub fn parse(envelope: &CommandEnvelope) -> Result<Self, serde_json::Error> {
+        serde_json::from_value(serde_json::json!({
+            "type": envelope.command_type,
+            "payload": envelope.payload,
+        }))
+    }
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct ReplayActionsRequest {
+    /// Only replay commands submitted at or after this time
+    pub since: Option<DateTime<Utc>>,
+    pub until: Option<DateTime<Utc>>,
+    /// Player to replay onto; defaults to the player the log belongs to
+    pub target_user_id: Option<Uuid>,
+}
+
+/// Run a command later, e.g. start a building at 03:00
+#[derive(Debug, Deserialize)]
+pub struct ScheduleCommandRequest {
+    #[serde(flatten)]
+    pub command: CommandEnvelope,
+    pub execute_at: DateTime<Utc>,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct CommandResponse {
+    pub command_id: Uuid,
+    pub status: String,
+    pub result: Option<serde_json::Value>,
+    /// True when this is a resubmission and the stored outcome was returned
+    pub duplicate: bool,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct ReplayedCommand {
+    pub original_command_id: Uuid,
+    pub command_id: Uuid,
+    pub command_type: String,
+    pub succeeded: bool,
+    pub error: Option<String>,
+}
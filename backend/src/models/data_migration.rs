@@ -0,0 +1,156 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Constants ====================
+
+pub const DEFAULT_BATCH_SIZE: i32 = 500;
+pub const MAX_BATCH_SIZE: i32 = 5000;
+
+/// Changes returned when reviewing a run
+pub const DEFAULT_CHANGES_LIMIT: i64 = 100;
+
+// ==================== Enums ====================
+
+/// A balance retrofit that rewrites stored values after a formula change.
+/// Each one walks a table in id order and recomputes some of its columns.
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum DataMigration {
+    /// Warehouse and granary capacity from the storage buildings
+    StorageCapacity,
+    /// Population and culture per day from the buildings. Culture produced
+    /// since the last accrual is paid at the new rate.
+    CultureProduction,
+}
+
+impl DataMigration {
+    pub const ALL: [DataMigration; 2] = [
+        DataMigration::StorageCapacity,
+        DataMigration::CultureProduction,
+    ];
+
+    pub fn name(&self) -> &'static str {
+        match self {
+            DataMigration::StorageCapacity => "storage_capacity",
+            DataMigration::CultureProduction => "culture_production",
+        }
+    }
+
+    pub fn from_name(name: &str) -> Option<Self> {
+        Self::ALL.into_iter().find(|m| m.name() == name)
+    }
+
+    pub fn description(&self) -> &'static str {
+        match self {
+            DataMigration::StorageCapacity => {
+                "Recompute warehouse and granary capacity of every village"
+            }
+            DataMigration::CultureProduction => {
+                "Recompute population and culture per day of every village"
+            }
+        }
+    }
+
+    pub fn table(&self) -> &'static str {
+        match self {
+            DataMigration::StorageCapacity | DataMigration::CultureProduction => "villages",
+        }
+    }
+
+    /// Columns the migration rewrites, and the only ones a rollback restores
+    pub fn columns(&self) -> &'static [&'static str] {
+        match self {
+            DataMigration::StorageCapacity => &["warehouse_capacity", "granary_capacity"],
+            DataMigration::CultureProduction => &["population", "culture_per_day"],
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "data_migration_status", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum DataMigrationStatus {
+    Running,
+    Completed,
+    /// Stopped on an error; can be resumed from its cursor
+    Failed,
+    RolledBack,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct DataMigrationRun {
+    pub id: Uuid,
+    pub migration: String,
+    pub dry_run: bool,
+    pub status: DataMigrationStatus,
+    pub batch_size: i32,
+    /// Last row handled
+    pub cursor: Option<Uuid>,
+    pub processed: i64,
+    pub changed: i64,
+    pub error: Option<String>,
+    pub started_by: Option<Uuid>,
+    pub started_at: DateTime<Utc>,
+    pub finished_at: Option<DateTime<Utc>>,
+    pub rolled_back_at: Option<DateTime<Utc>>,
+}
+
+/// Old and new values of one row; planned on a dry run, applied otherwise
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct DataMigrationChange {
+    pub table_name: String,
+    pub row_id: Uuid,
+    pub before: serde_json::Value,
+    pub after: serde_json::Value,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct StartDataMigrationRequest {
+    /// Record what would change without writing it; on unless turned off
+    #[serde(default = "default_dry_run")]
+    pub dry_run: bool,
+    pub batch_size: Option<i32>,
+}
+
+fn default_dry_run() -> bool {
+    true
+}
+
+#[derive(Debug, Deserialize)]
+pub struct DataMigrationChangesQuery {
+    pub limit: Option<i64>,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct DataMigrationInfo {
+    pub name: &'static str,
+    pub description: &'static str,
+    pub table: &'static str,
+    pub columns: &'static [&'static str],
+}
+
+impl From<DataMigration> for DataMigrationInfo {
+    fn from(migration: DataMigration) -> Self {
+        Self {
+            name: migration.name(),
+            description: migration.description(),
+            table: migration.table(),
+            columns: migration.columns(),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct DataMigrationRollbackResult {
+    pub restored: u64,
+    /// Rows changed again since the run, left as they are
+    pub skipped: u64,
+}
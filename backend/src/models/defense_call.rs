@@ -0,0 +1,140 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+use super::army::ArmyTroops;
+use super::troop::TroopType;
+
+// ==================== Limits ====================
+
+/// Furthest ahead a call's deadline may be
+pub const MAX_CALL_AHEAD_HOURS: i64 = 48;
+
+/// Calls a player may have open at once
+pub const MAX_OPEN_CALLS_PER_PLAYER: i64 = 5;
+
+/// Villages suggested per call, most defense first
+pub const MAX_DEFENDER_MATCHES: usize = 50;
+
+pub const MAX_CALL_NOTE_LEN: usize = 500;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "defense_call_status", rename_all = "lowercase")]
+#[serde(rename_all = "lowercase")]
+pub enum DefenseCallStatus {
+    Open,
+    Cancelled,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct DefenseCall {
+    pub id: Uuid,
+    pub alliance_id: Uuid,
+    pub player_id: Uuid,
+    pub player_name: String,
+    pub village_id: Uuid,
+    pub village_name: String,
+    pub x: i32,
+    pub y: i32,
+    /// Reinforcements have to land by then
+    pub deadline: DateTime<Utc>,
+    pub note: Option<String>,
+    pub status: DefenseCallStatus,
+    /// Players told about the call when it was posted
+    pub notified: i32,
+    pub created_at: DateTime<Utc>,
+}
+
+impl DefenseCall {
+    /// Still taking pledges: not cancelled and the deadline not yet passed
+    pub fn is_open(&self, now: DateTime<Utc>) -> bool {
+        self.status == DefenseCallStatus::Open && self.deadline > now
+    }
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct DefensePledge {
+    pub id: Uuid,
+    pub call_id: Uuid,
+    pub player_id: Uuid,
+    pub player_name: String,
+    pub from_village_id: Uuid,
+    pub troops: sqlx::types::Json<ArmyTroops>,
+    /// The reinforcement, once sent
+    pub army_id: Option<Uuid>,
+    pub lands_at: Option<DateTime<Utc>>,
+    pub arrived_at: Option<DateTime<Utc>>,
+    pub created_at: DateTime<Utc>,
+}
+
+/// One troop type at home in a village that could answer a call
+#[derive(Debug, Clone, FromRow)]
+pub struct DefenderTroops {
+    pub village_id: Uuid,
+    pub player_id: Uuid,
+    pub player_name: String,
+    pub village_name: String,
+    pub x: i32,
+    pub y: i32,
+    pub tournament_square_level: i32,
+    pub troop_type: TroopType,
+    pub in_village: i32,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct CreateDefenseCallRequest {
+    pub village_id: Uuid,
+    /// When reinforcements must land; the first incoming attack if omitted
+    pub deadline: Option<DateTime<Utc>>,
+    pub note: Option<String>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct PledgeDefenseRequest {
+    pub from_village_id: Uuid,
+    pub troops: HashMap<TroopType, i32>,
+    /// Promise the troops now and send them later; sent at once otherwise
+    #[serde(default)]
+    pub send_later: bool,
+}
+
+// ==================== Response DTOs ====================
+
+/// A village that can land troops before the deadline
+#[derive(Debug, Clone, Serialize)]
+pub struct DefenderMatch {
+    pub player_id: Uuid,
+    pub player_name: String,
+    pub village_id: Uuid,
+    pub village_name: String,
+    pub x: i32,
+    pub y: i32,
+    pub distance: f64,
+    /// Troops at home fast enough to make it if sent now
+    pub troops: ArmyTroops,
+    pub defense_infantry: i64,
+    pub defense_cavalry: i64,
+    /// When the slowest of them would land if sent now
+    pub arrives_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct DefenseCallResponse {
+    #[serde(flatten)]
+    pub call: DefenseCall,
+    /// Troops promised, sent or not
+    pub pledged: HashMap<TroopType, i64>,
+    /// Troops that reached the village
+    pub arrived: HashMap<TroopType, i64>,
+    pub pledges: Vec<DefensePledge>,
+    /// Villages that could still help, while the call is open
+    pub matches: Vec<DefenderMatch>,
+}
@@ -0,0 +1,82 @@
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use sqlx::FromRow;
+
+use crate::services::circuit_breaker::BreakerState;
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct BuildInfo {
+    pub version: &'static str,
+    pub git_sha: &'static str,
+    pub built_at: Option<DateTime<Utc>>,
+    pub environment: String,
+    pub started_at: DateTime<Utc>,
+    pub uptime_secs: i64,
+}
+
+/// Live process counters, in the spirit of Go's expvar
+#[derive(Debug, Clone, Serialize)]
+pub struct RuntimeVars {
+    pub uptime_secs: i64,
+    pub runtime: RuntimeStats,
+    pub memory: MemoryStats,
+    pub db_pool: PoolStats,
+    pub websocket: WebSocketStats,
+    pub breakers: Vec<BreakerStatus>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RuntimeStats {
+    pub workers: usize,
+    pub alive_tasks: usize,
+    pub global_queue_depth: usize,
+}
+
+/// From /proc/self/status; empty on platforms without procfs
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct MemoryStats {
+    pub rss_bytes: Option<u64>,
+    pub peak_rss_bytes: Option<u64>,
+    pub virtual_bytes: Option<u64>,
+    pub threads: Option<u64>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct PoolStats {
+    pub size: u32,
+    pub idle: usize,
+    pub max_connections: u32,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct WebSocketStats {
+    pub connected_users: usize,
+    pub connections: usize,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct BreakerStatus {
+    pub name: &'static str,
+    pub state: BreakerState,
+}
+
+/// Database sessions of this server at the time of a dump
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct DbActivity {
+    pub pid: i32,
+    pub state: Option<String>,
+    pub wait_event_type: Option<String>,
+    pub wait_event: Option<String>,
+    pub query_start: Option<DateTime<Utc>>,
+    pub query: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct DiagnosticsDump {
+    pub taken_at: DateTime<Utc>,
+    pub build: BuildInfo,
+    pub vars: RuntimeVars,
+    pub db_activity: Vec<DbActivity>,
+}
@@ -0,0 +1,74 @@
+use chrono::{DateTime, NaiveDate, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+/// Entries per digest section
+pub const DIGEST_SECTION_SIZE: i64 = 10;
+
+// ==================== Digest Content ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct DigestClimber {
+    pub user_id: Uuid,
+    pub display_name: Option<String>,
+    pub population: i32,
+    /// Population gained over the week
+    pub gained: i32,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct DigestBattle {
+    pub report_id: Uuid,
+    pub attacker_id: Uuid,
+    pub attacker_name: Option<String>,
+    pub defender_id: Option<Uuid>,
+    pub defender_name: Option<String>,
+    /// Troops lost on both sides
+    pub troops_lost: i64,
+    pub winner: String,
+    pub occurred_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct DigestAlliance {
+    pub alliance_id: Uuid,
+    pub name: String,
+    pub tag: String,
+    pub member_count: i64,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct DigestContent {
+    pub climbers: Vec<DigestClimber>,
+    pub battles: Vec<DigestBattle>,
+    pub alliances: Vec<DigestAlliance>,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct WeeklyDigest {
+    /// Monday the digest's week began
+    pub week_start: NaiveDate,
+    pub content: sqlx::types::Json<DigestContent>,
+    pub generated_at: DateTime<Utc>,
+    pub emailed_at: Option<DateTime<Utc>>,
+}
+
+#[derive(Debug, Clone, FromRow)]
+pub struct DigestRecipient {
+    pub user_id: Uuid,
+    pub email: String,
+    pub display_name: Option<String>,
+    pub locale: String,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct GenerateDigestRequest {
+    /// Monday of the week to (re)generate; the last full week if omitted
+    pub week_start: Option<NaiveDate>,
+}
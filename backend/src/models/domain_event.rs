@@ -0,0 +1,83 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Entity Types ====================
+
+pub const ENTITY_VILLAGE: &str = "village";
+pub const ENTITY_BUILDING: &str = "building";
+pub const ENTITY_TROOP: &str = "troop";
+pub const ENTITY_TROOP_QUEUE: &str = "troop_queue";
+pub const ENTITY_ARMY: &str = "army";
+pub const ENTITY_MESSAGE: &str = "message";
+pub const ENTITY_HERO: &str = "hero";
+pub const ENTITY_ALLIANCE_MEMBER: &str = "alliance_member";
+pub const ENTITY_ALLIANCE: &str = "alliance";
+
+/// Entity types served by the sync endpoint; the rest only feed projections
+pub const SYNC_ENTITY_TYPES: &[&str] = &[
+    ENTITY_VILLAGE,
+    ENTITY_BUILDING,
+    ENTITY_TROOP,
+    ENTITY_TROOP_QUEUE,
+    ENTITY_ARMY,
+    ENTITY_MESSAGE,
+    ENTITY_HERO,
+];
+
+pub const ACTION_UPSERT: &str = "upsert";
+pub const ACTION_DELETE: &str = "delete";
+
+// ==================== Database Models ====================
+
+/// One change to an entity visible to `user_id`, written by the
+/// `*_domain_event` triggers
+#[derive(Debug, Clone, FromRow)]
+pub struct DomainEvent {
+    pub id: i64,
+    pub user_id: Uuid,
+    pub entity_type: String,
+    pub entity_id: Uuid,
+    pub village_id: Option<Uuid>,
+    pub action: String,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct SyncQuery {
+    /// Cursor from the previous sync; omit on first connect
+    pub since: Option<i64>,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+}
+
+fn default_limit() -> i64 {
+    500
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct SyncChange {
+    pub entity_type: String,
+    pub entity_id: Uuid,
+    pub village_id: Option<Uuid>,
+    /// `upsert` or `delete`
+    pub action: String,
+    /// Current state in the same shape as the entity's REST endpoint; `None` for deletes
+    pub data: Option<serde_json::Value>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct SyncResponse {
+    /// Pass as `since` on the next sync
+    pub cursor: i64,
+    pub changes: Vec<SyncChange>,
+    /// More changes are waiting; sync again immediately with the new cursor
+    pub has_more: bool,
+    /// The cursor is missing or too old; refetch everything, then sync from `cursor`
+    pub reset_required: bool,
+}
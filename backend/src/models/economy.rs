@@ -0,0 +1,124 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::army::CarriedResources;
+
+// ==================== Rules ====================
+
+/// Default window of the admin flow report
+pub const DEFAULT_FLOW_HOURS: i64 = 168;
+
+/// Longest window the admin flow report covers
+pub const MAX_FLOW_HOURS: i64 = 24 * 90;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "ledger_kind", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum LedgerKind {
+    /// Sent by merchants from one village to another
+    Shipment,
+    /// Taken from a defender's village by a winning attack or raid
+    Plunder,
+}
+
+/// Which side of a transfer the player was on
+#[derive(Debug, Clone, Copy, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum LedgerDirection {
+    Incoming,
+    Outgoing,
+}
+
+// ==================== Database Models ====================
+
+/// One transfer of resources from one player to another
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct LedgerEntry {
+    pub id: i64,
+    pub kind: LedgerKind,
+    pub from_user_id: Option<Uuid>,
+    pub from_name: Option<String>,
+    pub to_user_id: Option<Uuid>,
+    pub to_name: Option<String>,
+    pub from_village_id: Uuid,
+    pub to_village_id: Uuid,
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+    /// The shipment or battle report behind the entry
+    pub source_id: Option<Uuid>,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone)]
+pub struct NewLedgerEntry {
+    pub kind: LedgerKind,
+    pub from_user_id: Uuid,
+    pub to_user_id: Uuid,
+    pub from_village_id: Uuid,
+    pub to_village_id: Uuid,
+    pub resources: CarriedResources,
+    pub source_id: Uuid,
+}
+
+/// Resources that moved from one account to another within a window
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct EconomyFlow {
+    pub from_user_id: Uuid,
+    pub from_name: Option<String>,
+    pub to_user_id: Uuid,
+    pub to_name: Option<String>,
+    pub transfers: i64,
+    pub wood: i64,
+    pub clay: i64,
+    pub iron: i64,
+    pub crop: i64,
+    pub total: i64,
+    /// Moved back the other way in the same window
+    pub returned: i64,
+    pub net: i64,
+    pub first_at: DateTime<Utc>,
+    pub last_at: DateTime<Utc>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct TradeHistoryQuery {
+    pub kind: Option<LedgerKind>,
+    pub direction: Option<LedgerDirection>,
+    /// Only transfers with this other player
+    pub counterpart_id: Option<Uuid>,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+/// Admin: aggregate flows between accounts, largest first
+#[derive(Debug, Deserialize)]
+pub struct EconomyFlowQuery {
+    /// Only flows in or out of this player
+    pub user_id: Option<Uuid>,
+    pub kind: Option<LedgerKind>,
+    #[serde(default = "default_flow_hours")]
+    pub hours: i64,
+    /// Smallest total worth listing
+    #[serde(default)]
+    pub min_total: i64,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+}
+
+fn default_limit() -> i64 {
+    50
+}
+
+fn default_flow_hours() -> i64 {
+    DEFAULT_FLOW_HOURS
+}
@@ -0,0 +1,248 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use std::collections::HashMap;
+use std::sync::{Arc, LazyLock, RwLock};
+
+use super::building::{BuildingCost, BuildingPrerequisite, BuildingType};
+use super::hero::ItemDefinitionResponse;
+use super::troop::{TribeType, TroopDefinitionResponse, TroopType};
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct GameDataVersion {
+    pub version: String,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Definitions ====================
+
+/// Definitions compiled into the server; `GAMEDATA_DIR` overrides them at startup
+pub const EMBEDDED_BUILDINGS: &str = include_str!("../../gamedata/buildings.yaml");
+pub const EMBEDDED_UNITS: &str = include_str!("../../gamedata/units.yaml");
+pub const EMBEDDED_TRIBES: &str = include_str!("../../gamedata/tribes.yaml");
+
+#[derive(Debug, Clone, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct BuildingsFile {
+    pub buildings: Vec<BuildingDefinition>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct UnitsFile {
+    pub units: Vec<UnitDefinition>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct TribesFile {
+    pub tribes: Vec<TribeDefinition>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct BuildingDefinition {
+    pub building_type: BuildingType,
+    pub max_level: i32,
+    /// Population used at level 1
+    pub population: i32,
+    /// Culture points per day at level 1
+    #[serde(default)]
+    pub culture_points: i32,
+    /// Level 1 cost
+    pub cost: BuildingCost,
+    #[serde(default)]
+    pub prerequisites: Vec<BuildingPrerequisite>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct UnitDefinition {
+    pub troop_type: TroopType,
+    pub tribe: TribeType,
+    pub name: String,
+    pub description: Option<String>,
+    pub attack: i32,
+    pub defense_infantry: i32,
+    pub defense_cavalry: i32,
+    pub speed: i32,
+    pub carry_capacity: i32,
+    pub crop_consumption: i32,
+    pub training_time_seconds: i32,
+    pub cost: UnitCost,
+    pub requires: BuildingPrerequisite,
+    /// Academy research needed before training; None = trainable at once
+    #[serde(default)]
+    pub research: Option<UnitResearch>,
+    #[serde(default)]
+    pub loyalty_reduction: i32,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct UnitResearch {
+    pub cost: UnitCost,
+    pub time_seconds: i32,
+    /// Buildings needed to start the research, the academy among them
+    pub requires: Vec<BuildingPrerequisite>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct UnitCost {
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct TribeDefinition {
+    pub tribe: TribeType,
+    pub name: String,
+    pub description: Option<String>,
+    /// Resources one merchant carries
+    pub merchant_capacity: i32,
+    /// Fields and village buildings get a build slot each
+    #[serde(default)]
+    pub split_build_queue: bool,
+    /// Buildings only this tribe may construct
+    #[serde(default)]
+    pub buildings: Vec<BuildingType>,
+    #[serde(default)]
+    pub bonus: TribeBonus,
+}
+
+/// Tribe-wide modifiers, in percent
+#[derive(Debug, Clone, Copy, Default, Serialize, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct TribeBonus {
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+    pub attack: i32,
+    pub defense: i32,
+}
+
+/// Validated building, unit and tribe definitions the engine runs on
+#[derive(Debug, Clone)]
+pub struct GameDefinitions {
+    pub buildings: HashMap<BuildingType, BuildingDefinition>,
+    pub units: Vec<UnitDefinition>,
+    pub tribes: Vec<TribeDefinition>,
+}
+
+impl GameDefinitions {
+    pub fn building(&self, building_type: &BuildingType) -> &BuildingDefinition {
+        self.buildings
+            .get(building_type)
+            .expect("validated game data defines every building type")
+    }
+
+    pub fn unit(&self, troop_type: TroopType) -> Option<&UnitDefinition> {
+        self.units.iter().find(|u| u.troop_type == troop_type)
+    }
+
+    /// None for Special, which no player belongs to
+    pub fn tribe(&self, tribe: TribeType) -> Option<&TribeDefinition> {
+        self.tribes.iter().find(|t| t.tribe == tribe)
+    }
+
+    /// The tribe a building is reserved for, if any
+    pub fn building_tribe(&self, building_type: &BuildingType) -> Option<TribeType> {
+        self.tribes
+            .iter()
+            .find(|t| t.buildings.contains(building_type))
+            .map(|t| t.tribe)
+    }
+}
+
+static DEFINITIONS: LazyLock<RwLock<Arc<GameDefinitions>>> = LazyLock::new(|| {
+    let buildings: BuildingsFile =
+        serde_yaml::from_str(EMBEDDED_BUILDINGS).expect("embedded buildings.yaml is valid");
+    let units: UnitsFile =
+        serde_yaml::from_str(EMBEDDED_UNITS).expect("embedded units.yaml is valid");
+    let tribes: TribesFile =
+        serde_yaml::from_str(EMBEDDED_TRIBES).expect("embedded tribes.yaml is valid");
+
+    RwLock::new(Arc::new(GameDefinitions {
+        buildings: buildings
+            .buildings
+            .into_iter()
+            .map(|b| (b.building_type.clone(), b))
+            .collect(),
+        units: units.units,
+        tribes: tribes.tribes,
+    }))
+});
+
+/// The definitions currently in effect
+pub fn definitions() -> Arc<GameDefinitions> {
+    DEFINITIONS.read().unwrap().clone()
+}
+
+/// Swap in a new set of definitions. Callers must validate them first.
+pub fn install(definitions: GameDefinitions) {
+    *DEFINITIONS.write().unwrap() = Arc::new(definitions);
+}
+
+// ==================== Catalog ====================
+
+/// Everything the client needs to show costs and stats, generated from the
+/// same definitions the engine uses. `version` is a hash of the content.
+#[derive(Debug, Clone, Serialize)]
+pub struct GameDataCatalog {
+    pub version: String,
+    pub buildings: Vec<BuildingCatalogEntry>,
+    pub units: Vec<TroopDefinitionResponse>,
+    pub tribes: Vec<TribeCatalogEntry>,
+    pub items: Vec<ItemDefinitionResponse>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct BuildingCatalogEntry {
+    pub building_type: BuildingType,
+    pub max_level: i32,
+    pub is_resource_field: bool,
+    /// Only this tribe may build it
+    pub tribe: Option<TribeType>,
+    pub prerequisites: Vec<BuildingPrerequisite>,
+    pub levels: Vec<BuildingLevelData>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct BuildingLevelData {
+    pub level: i32,
+    pub cost: BuildingCost,
+    /// Total population of the building at this level
+    pub population: i32,
+    pub culture_points: i32,
+    pub production_per_hour: i32,
+    pub storage_capacity: i32,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct TribeCatalogEntry {
+    pub tribe: TribeType,
+    /// Display name; None for Special
+    pub name: Option<String>,
+    pub description: Option<String>,
+    pub playable: bool,
+    pub units: Vec<TroopType>,
+    pub buildings: Vec<BuildingType>,
+    pub merchant_capacity: Option<i32>,
+    pub split_build_queue: bool,
+    pub bonus: TribeBonus,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct GameDataQuery {
+    /// Pin a published version; omitted = current
+    pub version: Option<String>,
+}
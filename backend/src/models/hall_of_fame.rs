@@ -0,0 +1,87 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::troop::TribeType;
+
+/// Top-N places in a world ranking that earn a medal
+pub const MEDAL_PLACES: i32 = 3;
+
+/// Ranking categories whose medals go to every member of the alliance
+pub const ALLIANCE_MEDAL_CATEGORIES: [&str; 2] = ["top_alliances", "top_alliance_members"];
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Medal {
+    /// World ranking category, e.g. `top_population`
+    pub category: String,
+    pub rank: i32,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct HallOfFameEntry {
+    pub world_id: String,
+    #[serde(skip_serializing)]
+    pub firebase_uid: String,
+    pub display_name: Option<String>,
+    pub tribe: TribeType,
+    pub final_rank: i32,
+    pub population: i32,
+    pub village_count: i32,
+    pub culture_points: i32,
+    pub alliance_name: Option<String>,
+    pub alliance_tag: Option<String>,
+    pub alliance_rank: Option<i32>,
+    pub medals: sqlx::types::Json<Vec<Medal>>,
+    pub ended_at: DateTime<Utc>,
+}
+
+/// A player's standing in a world's data when it ends
+#[derive(Debug, Clone, FromRow)]
+pub struct FinalStanding {
+    pub user_id: Uuid,
+    pub firebase_uid: String,
+    pub display_name: Option<String>,
+    pub tribe: TribeType,
+    pub final_rank: i32,
+    pub population: i32,
+    pub village_count: i32,
+    pub culture_points: i32,
+    pub alliance_id: Option<Uuid>,
+    pub alliance_name: Option<String>,
+    pub alliance_tag: Option<String>,
+    pub alliance_rank: Option<i32>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct HallOfFameQuery {
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_limit() -> i64 {
+    100
+}
+
+/// A player's results across every world they finished
+#[derive(Debug, Clone, Serialize)]
+pub struct CareerResponse {
+    pub worlds_played: usize,
+    pub best_rank: Option<i32>,
+    pub medal_count: usize,
+    /// Newest world first
+    pub worlds: Vec<HallOfFameEntry>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct FinishWorldResult {
+    pub world_id: String,
+    pub players_recorded: usize,
+    pub medals_awarded: usize,
+}
@@ -6,6 +6,19 @@ use uuid::Uuid;
 
 use super::troop::TribeType;
 
+// ==================== Rules ====================
+
+/// Hourly production from each resource point, spread over all four
+/// resources or put into a single one
+pub const PRODUCTION_PER_POINT_ALL: i32 = 6;
+pub const PRODUCTION_PER_POINT_SINGLE: i32 = 20;
+
+/// How often the resource focus can be switched
+pub const FOCUS_COOLDOWN_HOURS: i64 = 1;
+
+/// How often assigned points can be taken back and spent again
+pub const ATTRIBUTE_RESET_COOLDOWN_HOURS: i64 = 24;
+
 // ==================== Enums ====================
 
 #[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq)]
@@ -54,6 +67,17 @@ pub enum AdventureDifficulty {
     Long,
 }
 
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "hero_resource_focus", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum ResourceFocus {
+    All,
+    Wood,
+    Clay,
+    Iron,
+    Crop,
+}
+
 // ==================== Database Models ====================
 
 #[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
@@ -90,6 +114,7 @@ pub struct Hero {
     pub off_bonus: i32,
     pub def_bonus: i32,
     pub resources_bonus: i32,
+    pub resource_focus: ResourceFocus,
 
     // Base stats
     pub base_attack: i32,
@@ -100,8 +125,13 @@ pub struct Hero {
     pub last_health_update: DateTime<Utc>,
     pub died_at: Option<DateTime<Utc>>,
     pub revive_at: Option<DateTime<Utc>>,
+    pub resource_focus_changed_at: Option<DateTime<Utc>>,
+    pub attributes_reset_at: Option<DateTime<Utc>>,
     pub created_at: DateTime<Utc>,
     pub updated_at: DateTime<Utc>,
+
+    // Optimistic concurrency, bumped on every update
+    pub version: i32,
 }
 
 impl Hero {
@@ -135,6 +165,39 @@ impl Hero {
         self.status == HeroStatus::Dead || self.health <= 0
     }
 
+    /// Resources the hero adds to its home village each hour. A dead hero
+    /// produces nothing.
+    pub fn resource_production(&self) -> HeroProduction {
+        if self.is_dead() {
+            return HeroProduction::default();
+        }
+
+        let points = self.resources_bonus;
+        let single = points * PRODUCTION_PER_POINT_SINGLE;
+        match self.resource_focus {
+            ResourceFocus::All => {
+                let each = points * PRODUCTION_PER_POINT_ALL;
+                HeroProduction { wood: each, clay: each, iron: each, crop: each }
+            }
+            ResourceFocus::Wood => HeroProduction { wood: single, ..Default::default() },
+            ResourceFocus::Clay => HeroProduction { clay: single, ..Default::default() },
+            ResourceFocus::Iron => HeroProduction { iron: single, ..Default::default() },
+            ResourceFocus::Crop => HeroProduction { crop: single, ..Default::default() },
+        }
+    }
+
+    /// When the resource focus can next be switched, if not yet
+    pub fn focus_available_at(&self) -> Option<DateTime<Utc>> {
+        self.resource_focus_changed_at
+            .map(|at| at + chrono::Duration::hours(FOCUS_COOLDOWN_HOURS))
+    }
+
+    /// When assigned points can next be taken back, if not yet
+    pub fn reset_available_at(&self) -> Option<DateTime<Utc>> {
+        self.attributes_reset_at
+            .map(|at| at + chrono::Duration::hours(ATTRIBUTE_RESET_COOLDOWN_HOURS))
+    }
+
     /// Calculate experience needed for level
     pub fn exp_for_level(level: i32) -> i32 {
         // Exponential growth: 100 * 1.5^(level-1)
@@ -142,6 +205,24 @@ impl Hero {
     }
 }
 
+/// Flat hourly resources from a hero's resource points
+#[derive(Debug, Clone, Copy, Default, Serialize, Deserialize)]
+pub struct HeroProduction {
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+}
+
+impl HeroProduction {
+    pub fn add(&mut self, other: HeroProduction) {
+        self.wood += other.wood;
+        self.clay += other.clay;
+        self.iron += other.iron;
+        self.crop += other.crop;
+    }
+}
+
 #[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
 pub struct ItemDefinition {
     pub id: Uuid,
@@ -327,6 +408,20 @@ pub struct HeroSlotPrice {
     pub gold_cost: i32,
 }
 
+/// What a finished adventure pays out and costs the hero, rolled when it
+/// completes
+#[derive(Debug, Clone, PartialEq)]
+pub struct AdventureRewards {
+    pub experience: i32,
+    pub silver: i32,
+    pub health_damage: i32,
+    pub resources: serde_json::Value,
+    /// Rarity of the item found, if one was
+    pub item_rarity: Option<ItemRarity>,
+    /// Picks which item of that rarity
+    pub item_index_seed: usize,
+}
+
 // ==================== Request DTOs ====================
 
 #[derive(Debug, Clone, Deserialize)]
@@ -344,6 +439,11 @@ pub struct AssignAttributesRequest {
     pub resources_bonus: i32,
 }
 
+#[derive(Debug, Clone, Deserialize)]
+pub struct SetResourceFocusRequest {
+    pub focus: ResourceFocus,
+}
+
 #[derive(Debug, Clone, Deserialize)]
 pub struct ChangeHomeVillageRequest {
     pub village_id: Uuid,
@@ -407,6 +507,7 @@ pub struct HeroResponse {
     pub off_bonus: i32,
     pub def_bonus: i32,
     pub resources_bonus: i32,
+    pub resource_focus: ResourceFocus,
 
     // Calculated stats
     pub total_attack: i32,
@@ -414,10 +515,15 @@ pub struct HeroResponse {
     pub off_bonus_percent: f64,
     pub def_bonus_percent: f64,
     pub base_speed: Decimal,
+    pub resource_production: HeroProduction,
 
     // Timestamps
     pub died_at: Option<DateTime<Utc>>,
     pub revive_at: Option<DateTime<Utc>>,
+    pub focus_available_at: Option<DateTime<Utc>>,
+    pub reset_available_at: Option<DateTime<Utc>>,
+
+    pub version: i32,
 }
 
 impl From<Hero> for HeroResponse {
@@ -440,13 +546,18 @@ impl From<Hero> for HeroResponse {
             off_bonus: h.off_bonus,
             def_bonus: h.def_bonus,
             resources_bonus: h.resources_bonus,
+            resource_focus: h.resource_focus,
             total_attack: h.total_attack(),
             total_defense: h.total_defense(),
             off_bonus_percent: h.off_bonus_percent(),
             def_bonus_percent: h.def_bonus_percent(),
             base_speed: h.base_speed,
+            resource_production: h.resource_production(),
             died_at: h.died_at,
             revive_at: h.revive_at,
+            focus_available_at: h.focus_available_at(),
+            reset_available_at: h.reset_available_at(),
+            version: h.version,
         }
     }
 }
@@ -0,0 +1,64 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::gamedata::UnitCost;
+use super::troop::TroopType;
+
+// ==================== Rules ====================
+
+/// Healing a unit costs this share, in percent, of its training cost
+pub const HEAL_COST_PERCENT: i32 = 50;
+
+/// Healing a unit takes this share, in percent, of its training time
+pub const HEAL_TIME_PERCENT: i32 = 50;
+
+// ==================== Database Models ====================
+
+/// Troops of a village lying wounded in its hospital
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct WoundedTroop {
+    pub village_id: Uuid,
+    pub troop_type: TroopType,
+    pub count: i32,
+    pub updated_at: DateTime<Utc>,
+}
+
+/// Wounded troops being healed; they rejoin the village at `ends_at`
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct HealingQueueEntry {
+    pub id: Uuid,
+    pub village_id: Uuid,
+    pub troop_type: TroopType,
+    pub count: i32,
+    pub started_at: DateTime<Utc>,
+    pub ends_at: DateTime<Utc>,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct HealRequest {
+    pub troop_type: TroopType,
+    pub count: i32,
+}
+
+/// Wounded troops of one type and what healing one of them takes
+#[derive(Debug, Clone, Serialize)]
+pub struct WoundedResponse {
+    pub troop_type: TroopType,
+    pub count: i32,
+    pub heal_cost: UnitCost,
+    pub heal_time_seconds: i32,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct HospitalResponse {
+    pub level: i32,
+    /// Share of the village's own defensive losses taken in as wounded
+    pub wounded_percent: i32,
+    pub wounded: Vec<WoundedResponse>,
+    pub queue: Vec<HealingQueueEntry>,
+}
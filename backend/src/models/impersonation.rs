@@ -0,0 +1,87 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Constants ====================
+
+/// How long a session lasts when the request doesn't say
+pub const DEFAULT_IMPERSONATION_MINUTES: i64 = 30;
+pub const MAX_IMPERSONATION_MINUTES: i64 = 240;
+
+/// Never reachable while impersonating, even with write access: the
+/// account itself, payments and gold, the admin API and the debug
+/// endpoints. Gold spent anywhere else is refused where it is deducted.
+pub const IMPERSONATION_BLOCKED_PATHS: &[&str] = &[
+    "/api/auth",
+    "/api/shop",
+    "/api/auctions",
+    "/api/admin",
+    "/debug",
+];
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ImpersonationSession {
+    pub id: Uuid,
+    pub admin_id: Option<Uuid>,
+    pub player_id: Uuid,
+    /// Without it the session is read-only
+    pub allow_write: bool,
+    pub reason: String,
+    pub created_at: DateTime<Utc>,
+    pub expires_at: DateTime<Utc>,
+    pub ended_at: Option<DateTime<Utc>>,
+}
+
+/// Carried on the player identity of an impersonated request
+#[derive(Debug, Clone, Copy)]
+pub struct Impersonation {
+    pub session_id: Uuid,
+    pub admin_id: Uuid,
+    pub player_id: Uuid,
+    pub allow_write: bool,
+}
+
+tokio::task_local! {
+    /// The session an impersonated request runs under, set by the auth
+    /// middleware for the length of the request
+    pub static CURRENT_IMPERSONATION: Impersonation;
+}
+
+impl Impersonation {
+    /// The session the current request runs under, if it is impersonated
+    pub fn current() -> Option<Self> {
+        CURRENT_IMPERSONATION.try_with(|impersonation| *impersonation).ok()
+    }
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct StartImpersonationRequest {
+    /// Shown to the player, e.g. the support ticket
+    pub reason: String,
+    #[serde(default)]
+    pub allow_write: bool,
+    pub minutes: Option<i64>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct ImpersonationQuery {
+    pub player_id: Option<Uuid>,
+    #[serde(default)]
+    pub active_only: bool,
+}
+
+// ==================== Response DTOs ====================
+
+/// A new session; `token` is only ever shown here. Send it as
+/// `X-Impersonation-Token` in place of the bearer token.
+#[derive(Debug, Serialize)]
+pub struct StartedImpersonation {
+    pub token: String,
+    #[serde(flatten)]
+    pub session: ImpersonationSession,
+}
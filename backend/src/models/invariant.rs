@@ -0,0 +1,42 @@
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+
+// ==================== Constants ====================
+
+/// Stored population that disagrees with the village's buildings. Checked
+/// in code rather than SQL, as the per-level values live in the game data.
+pub const POPULATION_MISMATCH: &str = "population_mismatch";
+
+/// Offending rows kept per broken invariant
+pub const SAMPLE_SIZE: usize = 10;
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct InvariantResult {
+    pub name: &'static str,
+    pub description: &'static str,
+    pub violations: i64,
+    /// A few of the offending rows
+    pub sample: Vec<String>,
+    /// Whether the checker knows how to repair it
+    pub fixable: bool,
+    /// Rows repaired by this check
+    pub fixed: u64,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct InvariantReport {
+    pub checked_at: DateTime<Utc>,
+    pub duration_ms: u64,
+    pub results: Vec<InvariantResult>,
+}
+
+impl InvariantReport {
+    /// Invariants with violations left after any repairs
+    pub fn broken(&self) -> impl Iterator<Item = &InvariantResult> {
+        self.results
+            .iter()
+            .filter(|r| r.violations > 0 && r.fixed < r.violations as u64)
+    }
+}
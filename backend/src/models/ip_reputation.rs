@@ -0,0 +1,109 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+
+// ==================== Rules ====================
+
+/// Provider answers are trusted for this long before asking again
+pub const LOOKUP_TTL_DAYS: i64 = 7;
+
+/// Most ranges accepted in one import
+pub const MAX_IMPORT_RANGES: usize = 10_000;
+
+// ==================== Enums ====================
+
+/// Networks that hide who is behind an address. Residential and mobile
+/// addresses have no category.
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "ip_category", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum IpCategory {
+    Datacenter,
+    Vpn,
+    Proxy,
+    Tor,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct IpRange {
+    pub id: i64,
+    pub cidr: String,
+    pub category: IpCategory,
+    /// Where the range came from, e.g. `manual` or the list it was imported from
+    pub source: String,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Settings ====================
+
+/// Setting key for the IP reputation policy
+pub const IP_REPUTATION_KEY: &str = "ip_reputation";
+
+/// How this world treats logins from anonymizing networks (stored under
+/// `ip_reputation`)
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct IpReputationSettings {
+    /// Logins from these networks must pass a captcha (when captchas are
+    /// configured)
+    pub step_up_categories: Vec<IpCategory>,
+}
+
+impl Default for IpReputationSettings {
+    fn default() -> Self {
+        Self {
+            step_up_categories: vec![IpCategory::Tor],
+        }
+    }
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateIpReputationRequest {
+    pub step_up_categories: Option<Vec<IpCategory>>,
+}
+
+/// Admin: add ranges to the local lists, e.g. a published Tor exit list
+#[derive(Debug, Deserialize)]
+pub struct ImportIpRangesRequest {
+    /// CIDR blocks or single addresses
+    pub ranges: Vec<String>,
+    pub category: IpCategory,
+    #[serde(default = "default_source")]
+    pub source: String,
+}
+
+fn default_source() -> String {
+    "manual".to_string()
+}
+
+#[derive(Debug, Deserialize)]
+pub struct IpRangeQuery {
+    pub category: Option<IpCategory>,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_limit() -> i64 {
+    100
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct ImportIpRangesResult {
+    pub imported: u64,
+    /// Entries that aren't valid addresses or CIDR blocks
+    pub invalid: Vec<String>,
+}
+
+/// Admin: what the server knows about one address
+#[derive(Debug, Clone, Serialize)]
+pub struct IpCheckResult {
+    pub ip: String,
+    pub category: Option<IpCategory>,
+    pub step_up: bool,
+}
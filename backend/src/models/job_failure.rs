@@ -0,0 +1,52 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Rules ====================
+
+/// Failed attempts before an item is quarantined
+pub const MAX_ATTEMPTS: i32 = 5;
+
+/// Delay before the first retry; doubled per further failure
+pub const RETRY_BASE_SECS: i64 = 10;
+
+/// Longest delay between retries
+pub const RETRY_MAX_SECS: i64 = 3600;
+
+/// Jobs whose items are guarded
+pub const ARMY_ARRIVAL_JOB: &str = "army_arrival";
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct JobFailure {
+    pub id: i64,
+    pub job: String,
+    pub item_id: Uuid,
+    pub attempts: i32,
+    pub payload: Option<serde_json::Value>,
+    pub last_error: String,
+    pub panicked: bool,
+    pub retry_at: DateTime<Utc>,
+    pub quarantined_at: Option<DateTime<Utc>>,
+    pub first_failed_at: DateTime<Utc>,
+    pub last_failed_at: DateTime<Utc>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct JobFailureQuery {
+    pub job: Option<String>,
+    /// Only quarantined items (true) or only ones still retrying (false)
+    pub quarantined: Option<bool>,
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_limit() -> i64 {
+    50
+}
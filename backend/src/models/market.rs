@@ -0,0 +1,77 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Rules ====================
+
+/// Fields per hour a merchant travels
+pub const MERCHANT_SPEED: f64 = 16.0;
+
+/// Resources a merchant carries when the tribe doesn't say
+pub const DEFAULT_MERCHANT_CAPACITY: i32 = 500;
+
+/// Merchants a village has for its market level
+pub fn merchants_for_level(market_level: i32) -> i32 {
+    market_level.max(0)
+}
+
+// ==================== Shipment ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct ResourceShipment {
+    pub id: Uuid,
+    pub sender_id: Uuid,
+    pub receiver_id: Uuid,
+    pub from_village_id: Uuid,
+    pub to_village_id: Uuid,
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+    pub merchants: i32,
+    pub sent_at: DateTime<Utc>,
+    pub arrives_at: DateTime<Utc>,
+    pub returns_at: DateTime<Utc>,
+    pub delivered: bool,
+    pub created_at: DateTime<Utc>,
+}
+
+impl ResourceShipment {
+    pub fn total(&self) -> i32 {
+        self.wood + self.clay + self.iron + self.crop
+    }
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct SendResourcesRequest {
+    pub to_village_id: Uuid,
+    #[serde(default)]
+    pub wood: i32,
+    #[serde(default)]
+    pub clay: i32,
+    #[serde(default)]
+    pub iron: i32,
+    #[serde(default)]
+    pub crop: i32,
+}
+
+impl SendResourcesRequest {
+    pub fn total(&self) -> i32 {
+        self.wood + self.clay + self.iron + self.crop
+    }
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct MarketResponse {
+    /// From the market level
+    pub merchants: i32,
+    /// Out delivering or on their way back
+    pub merchants_busy: i32,
+    /// Resources one merchant carries
+    pub merchant_capacity: i32,
+    pub outgoing: Vec<ResourceShipment>,
+    pub incoming: Vec<ResourceShipment>,
+}
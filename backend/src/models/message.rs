@@ -53,7 +53,7 @@ pub struct Conversation {
 
 // ==================== Request DTOs ====================
 
-#[derive(Debug, Deserialize)]
+#[derive(Debug, Serialize, Deserialize)]
 pub struct SendMessageRequest {
     pub recipient_id: Uuid,
     pub subject: String,
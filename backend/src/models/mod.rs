@@ -1,9 +1,54 @@
+pub mod account;
+pub mod activity;
 pub mod alliance;
+pub mod api_key;
 pub mod army;
+pub mod attack_warning;
+pub mod auction;
+pub mod audit;
+pub mod bot_detection;
+pub mod bootstrap;
 pub mod building;
+pub mod command;
+pub mod data_migration;
+pub mod defense_call;
+pub mod diagnostics;
+pub mod digest;
+pub mod domain_event;
+pub mod economy;
+pub mod gamedata;
+pub mod hall_of_fame;
 pub mod hero;
+pub mod hospital;
+pub mod impersonation;
+pub mod invariant;
+pub mod ip_reputation;
+pub mod job_failure;
+pub mod market;
 pub mod message;
+pub mod note;
+pub mod oasis;
+pub mod operation;
+pub mod ops_metrics;
+pub mod projection;
+pub mod referral;
+pub mod region;
+pub mod registration;
+pub mod research;
+pub mod search;
+pub mod session;
 pub mod shop;
+pub mod social;
+pub mod snapshot;
+pub mod soft_delete;
+pub mod template;
+pub mod tick;
 pub mod troop;
 pub mod user;
 pub mod village;
+pub mod wave;
+pub mod world_dump;
+pub mod world_setting;
+pub mod world_shard;
+pub mod world_stats;
+pub mod world_status;
@@ -0,0 +1,89 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::alliance::AllianceRole;
+
+// ==================== Limits ====================
+
+pub const MAX_NOTE_LENGTH: usize = 1000;
+
+/// Notes one player may write
+pub const MAX_NOTES_PER_PLAYER: i64 = 2000;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "note_target", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum NoteTarget {
+    Village,
+    Player,
+}
+
+/// Sharing levels a member with `role` can see
+pub fn visible_levels(role: AllianceRole) -> Vec<String> {
+    let levels: &[&str] = match role {
+        AllianceRole::Leader => &["leader", "officer", "member"],
+        AllianceRole::Officer => &["officer", "member"],
+        AllianceRole::Member => &["member"],
+    };
+    levels.iter().map(|r| r.to_string()).collect()
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct Note {
+    pub id: Uuid,
+    pub author_id: Uuid,
+    pub target_type: NoteTarget,
+    pub target_id: Uuid,
+    pub body: String,
+    pub alliance_id: Option<Uuid>,
+    pub min_role: Option<AllianceRole>,
+    pub created_at: DateTime<Utc>,
+    pub updated_at: DateTime<Utc>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct NoteResponse {
+    pub id: Uuid,
+    pub author_id: Uuid,
+    pub author_name: Option<String>,
+    pub target_type: NoteTarget,
+    pub target_id: Uuid,
+    pub body: String,
+    /// Set when shared with the alliance: the lowest role that can see it
+    pub min_role: Option<AllianceRole>,
+    pub created_at: DateTime<Utc>,
+    pub updated_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct CreateNoteRequest {
+    pub target_type: NoteTarget,
+    pub target_id: Uuid,
+    pub body: String,
+    /// Share with the alliance, for members with at least this role
+    pub share_with: Option<AllianceRole>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct UpdateNoteRequest {
+    pub body: Option<String>,
+    /// Share with the alliance, for members with at least this role
+    pub share_with: Option<AllianceRole>,
+    /// Stop sharing; takes precedence over `share_with`
+    #[serde(default)]
+    pub unshare: bool,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct NoteQuery {
+    pub target_type: Option<NoteTarget>,
+    pub target_id: Option<Uuid>,
+}
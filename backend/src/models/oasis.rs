@@ -0,0 +1,245 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+// ==================== Rules ====================
+
+/// How far (in tiles, each axis) an oasis may be from the village taking it
+pub const OCCUPY_RANGE: i32 = 3;
+
+/// Game time between two regrowth ticks of an unoccupied oasis
+pub const REGROWTH_INTERVAL_SECS: i64 = 3600;
+
+/// Share of an oasis's full garrison that regrows per interval
+pub const REGROWTH_PERCENT: i32 = 10;
+
+/// Oases a village can hold for its hero mansion level
+pub fn oasis_slots(hero_mansion_level: i32) -> i32 {
+    match hero_mansion_level {
+        20.. => 3,
+        15.. => 2,
+        10.. => 1,
+        _ => 0,
+    }
+}
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "oasis_type", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum OasisType {
+    Wood,
+    WoodCrop,
+    Clay,
+    ClayCrop,
+    Iron,
+    IronCrop,
+    Crop,
+    CropHigh,
+}
+
+impl OasisType {
+    pub const ALL: [OasisType; 8] = [
+        OasisType::Wood,
+        OasisType::WoodCrop,
+        OasisType::Clay,
+        OasisType::ClayCrop,
+        OasisType::Iron,
+        OasisType::IronCrop,
+        OasisType::Crop,
+        OasisType::CropHigh,
+    ];
+
+    /// Production bonus, in percent, for the village holding it
+    pub fn bonus(&self) -> OasisBonus {
+        let (wood, clay, iron, crop) = match self {
+            OasisType::Wood => (25, 0, 0, 0),
+            OasisType::WoodCrop => (25, 0, 0, 25),
+            OasisType::Clay => (0, 25, 0, 0),
+            OasisType::ClayCrop => (0, 25, 0, 25),
+            OasisType::Iron => (0, 0, 25, 0),
+            OasisType::IronCrop => (0, 0, 25, 25),
+            OasisType::Crop => (0, 0, 0, 25),
+            OasisType::CropHigh => (0, 0, 0, 50),
+        };
+        OasisBonus {
+            wood,
+            clay,
+            iron,
+            crop,
+        }
+    }
+
+    /// Animals living in the oasis when it is fully grown
+    pub fn full_garrison(&self) -> HashMap<NatureTroop, i32> {
+        let garrison: &[(NatureTroop, i32)] = match self {
+            OasisType::Wood | OasisType::WoodCrop => &[
+                (NatureTroop::WildBoar, 20),
+                (NatureTroop::Wolf, 15),
+                (NatureTroop::Bear, 6),
+            ],
+            OasisType::Clay | OasisType::ClayCrop => &[
+                (NatureTroop::Rat, 25),
+                (NatureTroop::Spider, 20),
+                (NatureTroop::WildBoar, 12),
+            ],
+            OasisType::Iron | OasisType::IronCrop => &[
+                (NatureTroop::Rat, 20),
+                (NatureTroop::Bat, 15),
+                (NatureTroop::Snake, 12),
+            ],
+            OasisType::Crop => &[
+                (NatureTroop::Rat, 20),
+                (NatureTroop::Snake, 15),
+                (NatureTroop::Crocodile, 4),
+            ],
+            OasisType::CropHigh => &[
+                (NatureTroop::Crocodile, 8),
+                (NatureTroop::Tiger, 8),
+                (NatureTroop::Elephant, 4),
+            ],
+        };
+        garrison.iter().copied().collect()
+    }
+}
+
+/// Wild animals guarding unoccupied oases. They only ever defend.
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq, Hash)]
+#[serde(rename_all = "snake_case")]
+pub enum NatureTroop {
+    Rat,
+    Spider,
+    Snake,
+    Bat,
+    WildBoar,
+    Wolf,
+    Bear,
+    Crocodile,
+    Tiger,
+    Elephant,
+}
+
+impl NatureTroop {
+    pub const ALL: [NatureTroop; 10] = [
+        NatureTroop::Rat,
+        NatureTroop::Spider,
+        NatureTroop::Snake,
+        NatureTroop::Bat,
+        NatureTroop::WildBoar,
+        NatureTroop::Wolf,
+        NatureTroop::Bear,
+        NatureTroop::Crocodile,
+        NatureTroop::Tiger,
+        NatureTroop::Elephant,
+    ];
+
+    /// (attack, defense vs infantry, defense vs cavalry)
+    pub fn stats(&self) -> (i32, i32, i32) {
+        match self {
+            NatureTroop::Rat => (10, 25, 20),
+            NatureTroop::Spider => (20, 35, 40),
+            NatureTroop::Snake => (60, 40, 60),
+            NatureTroop::Bat => (80, 66, 50),
+            NatureTroop::WildBoar => (50, 70, 33),
+            NatureTroop::Wolf => (100, 80, 70),
+            NatureTroop::Bear => (250, 140, 200),
+            NatureTroop::Crocodile => (450, 380, 240),
+            NatureTroop::Tiger => (200, 170, 250),
+            NatureTroop::Elephant => (600, 440, 520),
+        }
+    }
+}
+
+pub type NatureTroops = HashMap<NatureTroop, i32>;
+
+// ==================== Oasis ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct Oasis {
+    pub id: Uuid,
+    pub x: i32,
+    pub y: i32,
+    pub oasis_type: OasisType,
+    pub owner_village_id: Option<Uuid>,
+    pub conquered_at: Option<DateTime<Utc>>,
+    pub animals: sqlx::types::Json<NatureTroops>,
+    pub last_regrowth_at: DateTime<Utc>,
+    pub created_at: DateTime<Utc>,
+    pub updated_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Copy, Default, Serialize, Deserialize)]
+pub struct OasisBonus {
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+}
+
+impl OasisBonus {
+    pub fn add(&mut self, other: OasisBonus) {
+        self.wood += other.wood;
+        self.clay += other.clay;
+        self.iron += other.iron;
+        self.crop += other.crop;
+    }
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct OasisResponse {
+    pub id: Uuid,
+    pub x: i32,
+    pub y: i32,
+    pub oasis_type: OasisType,
+    pub bonus: OasisBonus,
+    pub owner_village_id: Option<Uuid>,
+    pub conquered_at: Option<DateTime<Utc>>,
+    pub animals: NatureTroops,
+}
+
+impl From<Oasis> for OasisResponse {
+    fn from(o: Oasis) -> Self {
+        Self {
+            id: o.id,
+            x: o.x,
+            y: o.y,
+            oasis_type: o.oasis_type,
+            bonus: o.oasis_type.bonus(),
+            owner_village_id: o.owner_village_id,
+            conquered_at: o.conquered_at,
+            animals: o.animals.0,
+        }
+    }
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct VillageOasesResponse {
+    /// From the hero mansion level
+    pub slots: i32,
+    pub oases: Vec<OasisResponse>,
+    /// Combined bonus applied to the village's production
+    pub bonus: OasisBonus,
+}
+
+/// Admin: scatter unoccupied oases over the free tiles around the origin
+#[derive(Debug, Clone, Deserialize)]
+pub struct SeedOasesRequest {
+    pub radius: i32,
+    /// Chance, in percent, that a free tile becomes an oasis
+    #[serde(default = "default_density")]
+    pub density: i32,
+}
+
+fn default_density() -> i32 {
+    8
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct SeedOasesResult {
+    pub created: i32,
+}
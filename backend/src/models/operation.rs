@@ -0,0 +1,171 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+use super::troop::TroopType;
+use super::wave::{WavePlanResponse, WaveSendRequest, WaveSendStatus};
+
+// ==================== Limits ====================
+
+/// Operations an alliance may have open at once
+pub const MAX_OPEN_OPERATIONS: i64 = 10;
+
+/// Targets one operation may list
+pub const MAX_OPERATION_TARGETS: usize = 20;
+
+/// Waves one member may sign up to a single operation
+pub const MAX_SIGNUPS_PER_MEMBER: i64 = 5;
+
+/// Furthest ahead an operation's landing window may start
+pub const MAX_OPERATION_AHEAD_DAYS: i64 = 7;
+
+/// Longest landing window
+pub const MAX_LANDING_WINDOW_HOURS: i64 = 12;
+
+pub const MAX_OPERATION_NAME_LEN: usize = 100;
+pub const MAX_OPERATION_NOTES_LEN: usize = 2000;
+pub const MAX_TARGET_NOTE_LEN: usize = 200;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "alliance_operation_kind", rename_all = "lowercase")]
+#[serde(rename_all = "lowercase")]
+pub enum OperationKind {
+    /// Hit the targets; members send hostile missions
+    Attack,
+    /// Hold the targets; members send support
+    Defense,
+}
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "alliance_operation_status", rename_all = "lowercase")]
+#[serde(rename_all = "lowercase")]
+pub enum OperationStatus {
+    Open,
+    Cancelled,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct AllianceOperation {
+    pub id: Uuid,
+    pub alliance_id: Uuid,
+    pub created_by: Option<Uuid>,
+    pub name: String,
+    pub kind: OperationKind,
+    pub notes: Option<String>,
+    pub landing_from: DateTime<Utc>,
+    pub landing_until: DateTime<Utc>,
+    pub status: OperationStatus,
+    pub created_at: DateTime<Utc>,
+}
+
+impl AllianceOperation {
+    /// Still taking sign-ups: not cancelled and the window not yet over
+    pub fn is_open(&self, now: DateTime<Utc>) -> bool {
+        self.status == OperationStatus::Open && self.landing_until > now
+    }
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct OperationTarget {
+    pub id: Uuid,
+    pub operation_id: Uuid,
+    pub x: i32,
+    pub y: i32,
+    pub note: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct OperationSignup {
+    pub id: Uuid,
+    pub operation_id: Uuid,
+    pub target_id: Uuid,
+    pub player_id: Uuid,
+    pub player_name: String,
+    pub wave_id: Option<Uuid>,
+    /// Troops across every army of the wave
+    pub troops: sqlx::types::Json<HashMap<TroopType, i32>>,
+    pub armies: i32,
+    pub lands_at: DateTime<Utc>,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct OperationTargetRequest {
+    pub x: i32,
+    pub y: i32,
+    pub note: Option<String>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct CreateOperationRequest {
+    pub name: String,
+    pub kind: OperationKind,
+    pub notes: Option<String>,
+    pub landing_from: DateTime<Utc>,
+    pub landing_until: DateTime<Utc>,
+    pub targets: Vec<OperationTargetRequest>,
+}
+
+/// Sign a wave up against one target. It is planned with the movement
+/// planner, so the same rules apply.
+#[derive(Debug, Clone, Deserialize)]
+pub struct OperationSignupRequest {
+    pub target_id: Uuid,
+    /// When the wave should land; the start of the window if omitted
+    pub arrive_at: Option<DateTime<Utc>>,
+    pub sends: Vec<WaveSendRequest>,
+    /// Have the server send each army at its send time
+    #[serde(default)]
+    pub schedule: bool,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct ListOperationsQuery {
+    /// Include cancelled operations and those whose window is over
+    #[serde(default)]
+    pub all: bool,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct OperationSignupResponse {
+    #[serde(flatten)]
+    pub signup: OperationSignup,
+    /// How the scheduled sends went; `None` when the member sends by hand
+    pub wave_status: Option<WaveSendStatus>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct OperationTargetBoard {
+    #[serde(flatten)]
+    pub target: OperationTarget,
+    /// Troops committed by sign-ups that haven't been called off
+    pub committed: HashMap<TroopType, i64>,
+    pub armies: i32,
+    /// Earliest landing first
+    pub signups: Vec<OperationSignupResponse>,
+}
+
+/// Everything the alliance sees of an operation
+#[derive(Debug, Clone, Serialize)]
+pub struct OperationBoard {
+    #[serde(flatten)]
+    pub operation: AllianceOperation,
+    pub targets: Vec<OperationTargetBoard>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct OperationSignupResult {
+    pub signup: OperationSignupResponse,
+    /// Send times worked out by the movement planner
+    pub plan: WavePlanResponse,
+}
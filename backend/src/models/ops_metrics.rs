@@ -0,0 +1,106 @@
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use sqlx::FromRow;
+
+use super::diagnostics::WebSocketStats;
+
+// ==================== Constants ====================
+
+/// A queue whose oldest due item has waited longer than this is late:
+/// an alert is raised and a catch-up pass runs
+pub const LAG_THRESHOLD_SECS: i64 = 60;
+
+/// Queues the catch-up pass resolves; the others are only alerted on
+pub const CATCH_UP_QUEUES: &[&str] = &[
+    "army_movements",
+    "building_upgrades",
+    "troop_training",
+    "research",
+    "healing",
+    "market_deliveries",
+];
+
+// ==================== Response DTOs ====================
+
+/// Work items of one queue. `due` items are past their scheduled time but
+/// not processed yet; a few seconds of lag is normal between job runs.
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct QueueBacklog {
+    pub queue: String,
+    pub pending: i64,
+    pub due: i64,
+    /// How long the oldest due item has been waiting
+    pub lag_secs: Option<i64>,
+}
+
+/// Open entries in `job_failures`, by job
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct JobFailureSummary {
+    pub job: String,
+    /// Waiting for a retry
+    pub retrying: i64,
+    pub quarantined: i64,
+    pub failed_last_hour: i64,
+}
+
+/// Items this instance ran through a job since it started
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct JobThroughput {
+    pub job: String,
+    pub processed: u64,
+    pub failed: u64,
+    /// Share of items that failed, 0 to 1
+    pub failure_rate: f64,
+}
+
+/// Cache reads of this instance since it started
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct CacheStats {
+    pub hits: u64,
+    pub misses: u64,
+    /// Reads that fell back to the database because Redis failed
+    pub errors: u64,
+    /// None before the first read
+    pub hit_ratio: Option<f64>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct WorldOpsMetrics {
+    pub world_id: String,
+    pub queues: Vec<QueueBacklog>,
+    pub job_failures: Vec<JobFailureSummary>,
+    /// How far the slowest tick shard's watermark trails the clock
+    pub tick_lag_secs: Option<i64>,
+    /// Set when the world's database couldn't be read; the rest is empty
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct OpsMetrics {
+    pub taken_at: DateTime<Utc>,
+    pub worlds: Vec<WorldOpsMetrics>,
+    pub jobs: Vec<JobThroughput>,
+    pub websocket: WebSocketStats,
+    pub cache: CacheStats,
+}
+
+/// Items resolved by a catch-up pass, by queue
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct CatchUpResult {
+    pub army_movements: i32,
+    pub building_upgrades: i32,
+    pub troop_training: i32,
+    pub research: i32,
+    pub healing: i32,
+    pub market_deliveries: i32,
+    /// Left for the regular jobs to retry
+    pub failed: i32,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct LagCheckResult {
+    /// Queues past `LAG_THRESHOLD_SECS`
+    pub lagging: Vec<QueueBacklog>,
+    pub catch_up: Option<CatchUpResult>,
+}
@@ -0,0 +1,103 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::note::NoteResponse;
+
+/// Checkpoint name of the stats projection
+pub const STATS_PROJECTION: &str = "stats";
+
+/// Checkpoint name of the cache invalidation consumer
+pub const CACHE_PROJECTION: &str = "cache_invalidation";
+
+pub const RANKING_CATEGORIES: &[&str] = &[
+    "top_population",
+    "top_villages",
+    "top_culture",
+    "top_troops",
+    "top_alliances",
+    "top_alliance_members",
+];
+
+// ==================== Read Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct PlayerStats {
+    pub user_id: Uuid,
+    pub display_name: Option<String>,
+    pub alliance_id: Option<Uuid>,
+    pub alliance_tag: Option<String>,
+    pub village_count: i32,
+    pub population: i32,
+    pub culture_points: i32,
+    pub troop_count: i64,
+    pub updated_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct AllianceStats {
+    pub alliance_id: Uuid,
+    pub name: String,
+    pub tag: String,
+    pub member_count: i32,
+    pub village_count: i32,
+    pub total_population: i64,
+    pub updated_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct WorldRanking {
+    pub category: String,
+    pub rank: i32,
+    pub entity_id: Uuid,
+    pub name: Option<String>,
+    pub value: i64,
+    pub updated_at: DateTime<Utc>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct RankingQuery {
+    #[serde(default = "default_limit")]
+    pub limit: i64,
+    #[serde(default)]
+    pub offset: i64,
+}
+
+fn default_limit() -> i64 {
+    50
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RankedPlayer {
+    pub rank: i64,
+    #[serde(flatten)]
+    pub stats: PlayerStats,
+}
+
+/// A player's profile, with the notes the viewer may read about them
+#[derive(Debug, Clone, Serialize)]
+pub struct PlayerProfile {
+    #[serde(flatten)]
+    pub stats: PlayerStats,
+    pub notes: Vec<NoteResponse>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RankedAlliance {
+    pub rank: i64,
+    #[serde(flatten)]
+    pub stats: AllianceStats,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct ProjectionRunResult {
+    pub events_applied: usize,
+    pub players_refreshed: u64,
+    pub alliances_refreshed: u64,
+    pub last_event_id: i64,
+}
@@ -0,0 +1,103 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Rules ====================
+
+/// Length of a generated referral code
+pub const REFERRAL_CODE_LENGTH: usize = 8;
+
+/// Players one referrer may bring in per day; more are rejected
+pub const MAX_REFERRALS_PER_DAY: i64 = 10;
+
+/// A milestone the referee's population must reach, and the gold it pays
+#[derive(Debug, Clone, Copy, Serialize)]
+pub struct ReferralMilestone {
+    pub population: i32,
+    pub referrer_gold: i32,
+    pub referee_gold: i32,
+}
+
+/// Milestones in order; each pays once
+pub const REFERRAL_MILESTONES: [ReferralMilestone; 3] = [
+    ReferralMilestone {
+        population: 100,
+        referrer_gold: 10,
+        referee_gold: 10,
+    },
+    ReferralMilestone {
+        population: 500,
+        referrer_gold: 25,
+        referee_gold: 15,
+    },
+    ReferralMilestone {
+        population: 2000,
+        referrer_gold: 50,
+        referee_gold: 25,
+    },
+];
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "referral_status", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum ReferralStatus {
+    Active,
+    Completed,
+    Rejected,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct Referral {
+    pub id: Uuid,
+    pub referrer_id: Uuid,
+    pub referee_id: Uuid,
+    pub status: ReferralStatus,
+    pub milestones_reached: i32,
+    pub gold_earned: i32,
+    pub rejected_reason: Option<String>,
+    pub created_at: DateTime<Utc>,
+    pub updated_at: DateTime<Utc>,
+}
+
+/// An active referral with the referee's current population
+#[derive(Debug, Clone, FromRow)]
+pub struct ReferralProgress {
+    pub id: Uuid,
+    pub referrer_id: Uuid,
+    pub referee_id: Uuid,
+    pub milestones_reached: i32,
+    pub population: i32,
+}
+
+// ==================== Response DTOs ====================
+
+/// A player brought in, as their referrer sees them
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ReferralEntry {
+    pub referee_id: Uuid,
+    pub display_name: Option<String>,
+    pub status: ReferralStatus,
+    pub milestones_reached: i32,
+    pub gold_earned: i32,
+    pub population: i32,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct ReferralStatsResponse {
+    pub code: String,
+    /// Landing page path carrying the code; the client prefixes its origin
+    pub link: String,
+    pub invited: i64,
+    pub active: i64,
+    pub completed: i64,
+    pub rejected: i64,
+    pub gold_earned: i64,
+    pub milestones: Vec<ReferralMilestone>,
+    pub referrals: Vec<ReferralEntry>,
+}
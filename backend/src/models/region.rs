@@ -0,0 +1,110 @@
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::village::WORLD_RADIUS;
+
+// ==================== Rules ====================
+
+/// Tiles along each axis of the map
+const MAP_SPAN: i32 = WORLD_RADIUS * 2 + 1;
+
+/// Region a tile belongs to. Regions are numbered row by row from the
+/// south-west corner.
+pub fn region_of(x: i32, y: i32, per_axis: i32) -> i32 {
+    let col = (x + WORLD_RADIUS) * per_axis / MAP_SPAN;
+    let row = (y + WORLD_RADIUS) * per_axis / MAP_SPAN;
+    row * per_axis + col
+}
+
+/// Inclusive coordinate range (min_x, max_x, min_y, max_y) of a region
+pub fn region_bounds(region_id: i32, per_axis: i32) -> (i32, i32, i32, i32) {
+    let (row, col) = (region_id / per_axis, region_id % per_axis);
+    let first = |i: i32| (i * MAP_SPAN + per_axis - 1) / per_axis - WORLD_RADIUS;
+    (
+        first(col),
+        first(col + 1) - 1,
+        first(row),
+        first(row + 1) - 1,
+    )
+}
+
+// ==================== Database Models ====================
+
+/// Who holds a region. `scoring` is set once control has lasted the hold
+/// time; from then on the region earns points and its bonus applies.
+#[derive(Debug, Clone, FromRow)]
+pub struct RegionControl {
+    pub region_id: i32,
+    pub alliance_id: Option<Uuid>,
+    pub held_since: Option<DateTime<Utc>>,
+    pub scoring: bool,
+    pub evaluated_at: DateTime<Utc>,
+}
+
+/// Population one alliance (or the unaligned, as None) has in a region
+#[derive(Debug, Clone, FromRow)]
+pub struct RegionPopulation {
+    pub region_id: i32,
+    pub alliance_id: Option<Uuid>,
+    pub population: i64,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct VictoryStanding {
+    pub alliance_id: Uuid,
+    pub alliance_name: String,
+    pub alliance_tag: String,
+    pub points: i64,
+    pub regions_held: i64,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct RegionWinner {
+    pub alliance_id: Option<Uuid>,
+    pub alliance_name: String,
+    pub alliance_tag: String,
+    pub points: i64,
+    pub won_at: DateTime<Utc>,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RegionResponse {
+    pub region_id: i32,
+    pub min_x: i32,
+    pub max_x: i32,
+    pub min_y: i32,
+    pub max_y: i32,
+    pub alliance_id: Option<Uuid>,
+    pub held_since: Option<DateTime<Utc>>,
+    pub scoring: bool,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RegionOverview {
+    pub enabled: bool,
+    pub regions_per_axis: i32,
+    pub hold_hours: i32,
+    pub victory_points: i64,
+    pub production_bonus_percent: i32,
+    pub regions: Vec<RegionResponse>,
+    pub winner: Option<RegionWinner>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RegionLeaderboard {
+    pub victory_points: i64,
+    pub standings: Vec<VictoryStanding>,
+    pub winner: Option<RegionWinner>,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct RegionRunResult {
+    pub regions_evaluated: usize,
+    pub control_changes: usize,
+    pub points_awarded: i64,
+    pub winner: Option<Uuid>,
+}
@@ -0,0 +1,223 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::village::Quadrant;
+use super::world_setting::RegistrationSettings;
+
+// ==================== Limits ====================
+
+/// Most invites one wave may send
+pub const MAX_WAVE_SIZE: i32 = 10_000;
+
+/// Longest an invite may be kept open
+pub const MAX_INVITE_HOURS: i32 = 720;
+
+/// Length of the code players use to register with a group
+pub const GROUP_CODE_LENGTH: usize = 8;
+
+pub const MAX_GROUP_NAME_LEN: usize = 50;
+pub const MAX_GROUP_TAG_LEN: usize = 8;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq, Hash)]
+#[sqlx(type_name = "pre_registration_status", rename_all = "lowercase")]
+#[serde(rename_all = "lowercase")]
+pub enum PreRegistrationStatus {
+    /// Waiting for an invite wave
+    Queued,
+    /// May found a first village until the invite expires
+    Invited,
+    Joined,
+    /// The invite ran out unused
+    Expired,
+}
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "registration_wave_status", rename_all = "lowercase")]
+#[serde(rename_all = "lowercase")]
+pub enum RegistrationWaveStatus {
+    Scheduled,
+    Released,
+    Cancelled,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct PreRegistration {
+    pub id: Uuid,
+    pub user_id: Uuid,
+    /// Where the player starts; a group's members start where the group does
+    pub quadrant: Option<Quadrant>,
+    pub group_id: Option<Uuid>,
+    pub status: PreRegistrationStatus,
+    pub wave_id: Option<Uuid>,
+    pub invited_at: Option<DateTime<Utc>>,
+    pub expires_at: Option<DateTime<Utc>>,
+    pub joined_at: Option<DateTime<Utc>>,
+    pub created_at: DateTime<Utc>,
+}
+
+impl PreRegistration {
+    /// Holding an invite that hasn't run out
+    pub fn is_invited(&self, now: DateTime<Utc>) -> bool {
+        self.status == PreRegistrationStatus::Invited
+            && self.expires_at.is_some_and(|expires_at| expires_at > now)
+    }
+}
+
+/// Players registering together, usually an alliance
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct RegistrationGroup {
+    pub id: Uuid,
+    pub name: String,
+    pub tag: String,
+    /// Shared with the players who should register with the group
+    pub code: String,
+    pub leader_id: Uuid,
+    pub quadrant: Quadrant,
+    /// Places held in the quadrant until members are invited
+    pub slots: i32,
+    /// Players pre-registered with the group
+    pub members: i64,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct RegistrationWave {
+    pub id: Uuid,
+    pub scheduled_at: DateTime<Utc>,
+    /// Invites to send; a group is invited whole, so a wave may overshoot
+    pub size: i32,
+    pub status: RegistrationWaveStatus,
+    pub invited: i32,
+    pub created_by: Option<Uuid>,
+    pub released_at: Option<DateTime<Utc>>,
+    pub created_at: DateTime<Utc>,
+}
+
+/// Places a group still holds: its slots less the members invited or
+/// already playing
+#[derive(Debug, Clone, FromRow)]
+pub struct GroupReservation {
+    pub group_id: Uuid,
+    pub quadrant: Quadrant,
+    pub held: i64,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default)]
+pub struct PreRegisterRequest {
+    /// Where to start; ignored when registering with a group
+    pub quadrant: Option<Quadrant>,
+    /// Code of the group to register with
+    pub group_code: Option<String>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct CreateRegistrationGroupRequest {
+    pub name: String,
+    pub tag: String,
+    pub quadrant: Quadrant,
+    /// Places to hold for the group, the leader's included
+    pub slots: i32,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct CreateRegistrationWaveRequest {
+    /// Now if omitted
+    pub scheduled_at: Option<DateTime<Utc>>,
+    pub size: i32,
+}
+
+// ==================== Response DTOs ====================
+
+/// How full a spawn quadrant is
+#[derive(Debug, Clone, Serialize)]
+pub struct QuadrantAvailability {
+    pub quadrant: Quadrant,
+    /// `None` when the quadrant has no cap
+    pub cap: Option<i64>,
+    /// Players already playing there
+    pub joined: i64,
+    /// Invites out that haven't been used or run out
+    pub invited: i64,
+    /// Places groups still hold there
+    pub reserved: i64,
+    /// Places left for anyone else; `None` when uncapped
+    pub free: Option<i64>,
+}
+
+impl QuadrantAvailability {
+    pub fn new(
+        quadrant: Quadrant,
+        cap: Option<i64>,
+        joined: i64,
+        invited: i64,
+        reserved: i64,
+    ) -> Self {
+        let mut availability = Self {
+            quadrant,
+            cap,
+            joined,
+            invited,
+            reserved,
+            free: None,
+        };
+        availability.free = availability.room();
+        availability
+    }
+
+    /// Count `count` new invites, `from_reserved` of them out of places a
+    /// group held
+    pub fn admit(&mut self, count: i64, from_reserved: i64) {
+        self.invited += count;
+        self.reserved = (self.reserved - from_reserved).max(0);
+        self.free = self.room();
+    }
+
+    fn room(&self) -> Option<i64> {
+        self.cap
+            .map(|cap| (cap - self.joined - self.invited - self.reserved).max(0))
+    }
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct PreRegistrationResponse {
+    #[serde(flatten)]
+    pub registration: PreRegistration,
+    /// Place in the queue while waiting, 1 being next
+    pub position: Option<i64>,
+    pub group: Option<RegistrationGroup>,
+}
+
+/// What the lobby shows a player before they join the world
+#[derive(Debug, Clone, Serialize)]
+pub struct RegistrationStatus {
+    /// Joining needs an invite
+    pub gated: bool,
+    /// Players waiting for an invite
+    pub queued: i64,
+    pub next_wave_at: Option<DateTime<Utc>>,
+    pub quadrants: Vec<QuadrantAvailability>,
+    /// The player's own pre-registration, if any
+    pub registration: Option<PreRegistrationResponse>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RegistrationOverview {
+    pub settings: RegistrationSettings,
+    pub quadrants: Vec<QuadrantAvailability>,
+    pub queued: i64,
+    pub invited: i64,
+    pub joined: i64,
+    pub expired: i64,
+    /// Latest first
+    pub waves: Vec<RegistrationWave>,
+    pub groups: Vec<RegistrationGroup>,
+}
@@ -0,0 +1,48 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::building::BuildingPrerequisite;
+use super::gamedata::UnitCost;
+use super::troop::TroopType;
+
+// ==================== Database Models ====================
+
+/// Research running in a village's academy
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ResearchQueueEntry {
+    pub id: Uuid,
+    pub village_id: Uuid,
+    pub troop_type: TroopType,
+    pub started_at: DateTime<Utc>,
+    pub ends_at: DateTime<Utc>,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct StartResearchRequest {
+    pub troop_type: TroopType,
+}
+
+/// A unit the village's tribe could research
+#[derive(Debug, Clone, Serialize)]
+pub struct ResearchOption {
+    pub troop_type: TroopType,
+    pub cost: UnitCost,
+    pub time_seconds: i32,
+    pub requires: Vec<BuildingPrerequisite>,
+    /// Requirements the village doesn't meet yet
+    pub missing: Vec<BuildingPrerequisite>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct AcademyResponse {
+    /// Units the village may train, researched or needing no research
+    pub researched: Vec<TroopType>,
+    pub in_progress: Option<ResearchQueueEntry>,
+    /// Units still to research
+    pub available: Vec<ResearchOption>,
+}
@@ -0,0 +1,65 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::army::MissionType;
+use super::message::MessageType;
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct MessageSearchQuery {
+    pub q: String,
+    pub sender_id: Option<Uuid>,
+    pub from: Option<DateTime<Utc>>,
+    pub to: Option<DateTime<Utc>>,
+    #[serde(default = "default_limit")]
+    pub limit: i32,
+    #[serde(default)]
+    pub offset: i32,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct ReportSearchQuery {
+    pub q: String,
+    pub from: Option<DateTime<Utc>>,
+    pub to: Option<DateTime<Utc>>,
+    #[serde(default = "default_limit")]
+    pub limit: i32,
+    #[serde(default)]
+    pub offset: i32,
+}
+
+fn default_limit() -> i32 {
+    20
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct MessageSearchResult {
+    pub id: Uuid,
+    pub message_type: MessageType,
+    pub sender_id: Uuid,
+    pub sender_name: String,
+    pub subject: String,
+    /// Matching fragments of the body, with matches wrapped in <mark> tags
+    pub headline: String,
+    pub rank: f32,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ReportSearchResult {
+    pub id: Uuid,
+    pub attacker_player_id: Uuid,
+    pub defender_player_id: Option<Uuid>,
+    pub mission: MissionType,
+    pub winner: String,
+    /// Matching village/player names, with matches wrapped in <mark> tags
+    pub headline: String,
+    pub rank: f32,
+    pub occurred_at: DateTime<Utc>,
+    pub is_read: bool,
+}
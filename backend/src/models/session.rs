@@ -0,0 +1,59 @@
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Rules ====================
+
+/// Sessions unused for this long are logged out
+pub const SESSION_IDLE_DAYS: i64 = 14;
+
+/// Revoked and expired sessions are kept this long for the device list
+pub const REVOKED_RETENTION_DAYS: i64 = 30;
+
+/// A session is re-checked against the database at most this often per
+/// instance, so a remote logout takes effect within this time
+pub const SESSION_CHECK_SECS: u64 = 60;
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, FromRow)]
+pub struct UserSession {
+    pub id: Uuid,
+    pub user_id: Uuid,
+    pub session_key: String,
+    pub device: Option<String>,
+    pub client_ip: Option<String>,
+    pub created_at: DateTime<Utc>,
+    pub last_seen_at: DateTime<Utc>,
+    pub revoked_at: Option<DateTime<Utc>>,
+}
+
+// ==================== Response DTOs ====================
+
+/// One signed-in device, as shown to its owner
+#[derive(Debug, Clone, Serialize)]
+pub struct SessionResponse {
+    pub id: Uuid,
+    pub device: Option<String>,
+    pub client_ip: Option<String>,
+    pub created_at: DateTime<Utc>,
+    pub last_seen_at: DateTime<Utc>,
+    pub revoked_at: Option<DateTime<Utc>>,
+    /// The session making this request
+    pub current: bool,
+}
+
+impl SessionResponse {
+    pub fn new(session: UserSession, current_key: Option<&str>) -> Self {
+        Self {
+            current: current_key == Some(session.session_key.as_str()),
+            id: session.id,
+            device: session.device,
+            client_ip: session.client_ip,
+            created_at: session.created_at,
+            last_seen_at: session.last_seen_at,
+            revoked_at: session.revoked_at,
+        }
+    }
+}
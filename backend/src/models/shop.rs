@@ -47,6 +47,42 @@ pub enum GoldFeature {
     HeroSlot,
 }
 
+/// What "Finish Now" can complete
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum FinishTarget {
+    Building,
+    TroopQueue,
+    Research,
+}
+
+impl FinishTarget {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            FinishTarget::Building => "building",
+            FinishTarget::TroopQueue => "troop_queue",
+            FinishTarget::Research => "research",
+        }
+    }
+}
+
+// ==================== Finish Now ====================
+
+/// Jobs with this little time left finish for free
+pub const FREE_FINISH_SECONDS: i64 = 300;
+
+/// Remaining time one gold pays for
+pub const FINISH_SECONDS_PER_GOLD: i64 = 300;
+
+/// Gold to finish a job with `remaining_seconds` left, each started
+/// period counting in full
+pub fn finish_now_cost(remaining_seconds: i64) -> i32 {
+    if remaining_seconds <= FREE_FINISH_SECONDS {
+        return 0;
+    }
+    ((remaining_seconds + FINISH_SECONDS_PER_GOLD - 1) / FINISH_SECONDS_PER_GOLD) as i32
+}
+
 // ==================== Database Models ====================
 
 #[derive(Debug, Clone, Serialize, FromRow)]
@@ -143,7 +179,7 @@ pub struct BuySubscriptionRequest {
 
 #[derive(Debug, Deserialize)]
 pub struct UseFinishNowRequest {
-    pub target_type: String, // "building" or "troop_queue"
+    pub target_type: FinishTarget,
     pub target_id: Uuid,
 }
 
@@ -199,6 +235,17 @@ pub struct FeatureCostResponse {
     pub description: Option<String>,
 }
 
+/// Price of finishing a job now. The remaining time always comes from
+/// the server's clock, never from the client.
+#[derive(Debug, Clone, Serialize)]
+pub struct FinishNowQuote {
+    pub target_type: FinishTarget,
+    pub target_id: Uuid,
+    pub remaining_seconds: i64,
+    pub gold_cost: i32,
+    pub free: bool,
+}
+
 #[derive(Debug, Clone, Serialize)]
 pub struct UseFeatureResponse {
     pub success: bool,
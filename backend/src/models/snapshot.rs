@@ -0,0 +1,109 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+/// Bump when the snapshot layout changes incompatibly, which includes a
+/// migration adding a NOT NULL column to a table the snapshot carries or a
+/// new table of player state: rows from an older snapshot would come back
+/// with NULLs or without that state.
+///
+/// 2: building_queue, village_research, research_queue, wounded_troops and
+/// healing_queue; culture, field type and hero resource focus columns.
+pub const SNAPSHOT_FORMAT_VERSION: i32 = 2;
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, FromRow)]
+pub struct PlayerSnapshotRecord {
+    pub id: Uuid,
+    pub user_id: Uuid,
+    pub taken_by: Option<Uuid>,
+    pub reason: Option<String>,
+    pub data: sqlx::types::Json<PlayerSnapshot>,
+    pub restored_at: Option<DateTime<Utc>>,
+    pub created_at: DateTime<Utc>,
+}
+
+/// Full state of one player. Rows are kept as raw JSON (`to_jsonb(row)`) so
+/// every column round-trips without mirroring each table in Rust.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct PlayerSnapshot {
+    pub format_version: i32,
+    pub user_id: Uuid,
+    pub taken_at: DateTime<Utc>,
+    pub villages: Vec<serde_json::Value>,
+    pub buildings: Vec<serde_json::Value>,
+    pub troops: Vec<serde_json::Value>,
+    pub troop_queue: Vec<serde_json::Value>,
+    pub armies: Vec<serde_json::Value>,
+    pub heroes: Vec<serde_json::Value>,
+    pub hero_items: Vec<serde_json::Value>,
+    pub hero_adventures: Vec<serde_json::Value>,
+    // Missing from version 1 documents, which are then turned away by
+    // their version rather than failing to parse
+    #[serde(default)]
+    pub building_queue: Vec<serde_json::Value>,
+    #[serde(default)]
+    pub village_research: Vec<serde_json::Value>,
+    #[serde(default)]
+    pub research_queue: Vec<serde_json::Value>,
+    #[serde(default)]
+    pub wounded_troops: Vec<serde_json::Value>,
+    #[serde(default)]
+    pub healing_queue: Vec<serde_json::Value>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct CreateSnapshotRequest {
+    pub reason: Option<String>,
+}
+
+/// Restore from a stored snapshot or from an uploaded snapshot document
+#[derive(Debug, Deserialize)]
+pub struct RestoreSnapshotRequest {
+    pub snapshot_id: Option<Uuid>,
+    pub snapshot: Option<PlayerSnapshot>,
+    pub reason: Option<String>,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct SnapshotSummary {
+    pub id: Uuid,
+    pub user_id: Uuid,
+    pub taken_by: Option<Uuid>,
+    pub reason: Option<String>,
+    pub village_count: i32,
+    pub army_count: i32,
+    pub hero_count: i32,
+    pub restored_at: Option<DateTime<Utc>>,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct RestoreResult {
+    /// Snapshot of the state that was overwritten, for undoing the restore
+    pub backup_snapshot_id: Uuid,
+    pub villages_restored: usize,
+    pub buildings_restored: usize,
+    pub troops_restored: usize,
+    pub queue_entries_restored: usize,
+    pub armies_restored: usize,
+    pub heroes_restored: usize,
+    pub hero_items_restored: usize,
+    pub hero_adventures_restored: usize,
+    pub building_orders_restored: usize,
+    pub research_restored: usize,
+    pub research_queue_restored: usize,
+    pub wounded_troops_restored: usize,
+    pub healing_queue_restored: usize,
+    /// Villages the player owns now that aren't in the snapshot; left untouched
+    pub villages_not_in_snapshot: Vec<Uuid>,
+    /// References to other players' villages or item definitions that no longer exist
+    pub references_cleared: usize,
+    pub rows_skipped: usize,
+}
@@ -0,0 +1,66 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Limits ====================
+
+/// Friends (accepted) a player may have
+pub const MAX_FRIENDS: i64 = 100;
+
+/// Friend requests a player may have waiting on others at once
+pub const MAX_PENDING_REQUESTS: i64 = 20;
+
+/// Friend requests a player may send per day, so the list can't be used to spam
+pub const MAX_REQUESTS_PER_DAY: i64 = 30;
+
+/// Players a player may block
+pub const MAX_BLOCKS: i64 = 500;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "friendship_status", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum FriendshipStatus {
+    Pending,
+    Accepted,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct Friendship {
+    pub id: Uuid,
+    pub requester_id: Uuid,
+    pub addressee_id: Uuid,
+    pub status: FriendshipStatus,
+    pub created_at: DateTime<Utc>,
+    pub accepted_at: Option<DateTime<Utc>>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct SocialTargetRequest {
+    pub user_id: Uuid,
+}
+
+/// Another player as shown in the social panel
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct SocialEntry {
+    pub user_id: Uuid,
+    pub display_name: Option<String>,
+    /// When they became friends, the request was sent, or the block was made
+    pub since: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct SocialPanelResponse {
+    pub friends: Vec<SocialEntry>,
+    /// Requests waiting on this player
+    pub incoming: Vec<SocialEntry>,
+    /// Requests this player is waiting on
+    pub outgoing: Vec<SocialEntry>,
+    pub blocked: Vec<SocialEntry>,
+}
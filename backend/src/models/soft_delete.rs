@@ -0,0 +1,38 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Enums ====================
+
+/// Player-facing rows that are soft deleted
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum DeletedKind {
+    Message,
+    BattleReport,
+    ScoutReport,
+    Note,
+}
+
+// ==================== Response DTOs ====================
+
+/// A row a player deleted, as shown to support
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct DeletedItem {
+    pub id: Uuid,
+    /// Subject, mission or target, enough to tell rows apart
+    pub summary: String,
+    pub created_at: DateTime<Utc>,
+    /// Set once every side has deleted the row; purged after retention
+    pub deleted_at: Option<DateTime<Utc>>,
+}
+
+/// Everything a player has deleted that can still be restored
+#[derive(Debug, Clone, Serialize)]
+pub struct DeletedItems {
+    pub messages: Vec<DeletedItem>,
+    pub battle_reports: Vec<DeletedItem>,
+    pub scout_reports: Vec<DeletedItem>,
+    pub notes: Vec<DeletedItem>,
+}
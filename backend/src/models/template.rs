@@ -0,0 +1,249 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use serde_json::json;
+use sqlx::FromRow;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+// ==================== Constants ====================
+
+/// Languages templates can be written in, as in the frontend's locales
+pub const LOCALES: &[&str] = &["en", "th"];
+
+/// Used when a template has no text in the reader's language
+pub const DEFAULT_LOCALE: &str = "en";
+
+pub const MAX_SUBJECT_LEN: usize = 200;
+pub const MAX_BODY_LEN: usize = 20_000;
+
+/// Built-in texts, one file per channel
+pub const EMBEDDED_TEMPLATES: &[&str] = &[
+    include_str!("../../templates/email.yaml"),
+    include_str!("../../templates/discord.yaml"),
+    include_str!("../../templates/message.yaml"),
+];
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum TemplateChannel {
+    /// Subject line and plain-text body
+    Email,
+    /// Embed title and description
+    Discord,
+    /// In-game message subject and body
+    Message,
+}
+
+/// Text the server sends that isn't written by players. Each one is
+/// rendered from a context whose fields are listed by its sample.
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+pub enum TemplateKey {
+    WeeklyDigestEmail,
+    AttackWarningEmail,
+    EmailChangeEmail,
+    EmailChangedEmail,
+    RecoveryEmail,
+    WeeklyDigestDiscord,
+    AllianceAwardsMessage,
+}
+
+impl TemplateKey {
+    pub const ALL: [TemplateKey; 7] = [
+        TemplateKey::WeeklyDigestEmail,
+        TemplateKey::AttackWarningEmail,
+        TemplateKey::EmailChangeEmail,
+        TemplateKey::EmailChangedEmail,
+        TemplateKey::RecoveryEmail,
+        TemplateKey::WeeklyDigestDiscord,
+        TemplateKey::AllianceAwardsMessage,
+    ];
+
+    pub fn name(&self) -> &'static str {
+        match self {
+            TemplateKey::WeeklyDigestEmail => "email.weekly_digest",
+            TemplateKey::AttackWarningEmail => "email.attack_warning",
+            TemplateKey::EmailChangeEmail => "email.email_change",
+            TemplateKey::EmailChangedEmail => "email.email_changed",
+            TemplateKey::RecoveryEmail => "email.recovery",
+            TemplateKey::WeeklyDigestDiscord => "discord.weekly_digest",
+            TemplateKey::AllianceAwardsMessage => "message.alliance_awards",
+        }
+    }
+
+    pub fn from_name(name: &str) -> Option<Self> {
+        Self::ALL.into_iter().find(|k| k.name() == name)
+    }
+
+    pub fn channel(&self) -> TemplateChannel {
+        match self {
+            TemplateKey::WeeklyDigestEmail
+            | TemplateKey::AttackWarningEmail
+            | TemplateKey::EmailChangeEmail
+            | TemplateKey::EmailChangedEmail
+            | TemplateKey::RecoveryEmail => TemplateChannel::Email,
+            TemplateKey::WeeklyDigestDiscord => TemplateChannel::Discord,
+            TemplateKey::AllianceAwardsMessage => TemplateChannel::Message,
+        }
+    }
+
+    pub fn description(&self) -> &'static str {
+        match self {
+            TemplateKey::WeeklyDigestEmail => "Weekly world digest for players who opted in",
+            TemplateKey::AttackWarningEmail => "Attacks on the villages of an offline player",
+            TemplateKey::EmailChangeEmail => "Confirmation link sent to a new email address",
+            TemplateKey::EmailChangedEmail => "Notice to the old address after an email change",
+            TemplateKey::RecoveryEmail => "Account recovery link",
+            TemplateKey::WeeklyDigestDiscord => "Weekly world digest posted to Discord",
+            TemplateKey::AllianceAwardsMessage => "Weekly awards posted to alliance chat",
+        }
+    }
+
+    /// Example context with every field the sender passes. Edits are
+    /// checked against it and previews render it.
+    pub fn sample(&self) -> serde_json::Value {
+        let digest = json!({
+            "week_start": "2026-01-05",
+            "climbers": [
+                { "rank": 1, "display_name": "Aelric", "gained": 412, "population": 1830 },
+                { "rank": 2, "display_name": null, "gained": 260, "population": 940 }
+            ],
+            "battles": [
+                {
+                    "attacker_name": "Aelric",
+                    "defender_name": null,
+                    "troops_lost": 1250,
+                    "winner": "attacker"
+                }
+            ],
+            "alliances": [{ "tag": "NW", "name": "Northwind", "member_count": 12 }]
+        });
+
+        match self {
+            TemplateKey::WeeklyDigestEmail | TemplateKey::WeeklyDigestDiscord => digest,
+            TemplateKey::AttackWarningEmail => json!({
+                "display_name": "Aelric",
+                "count": 1,
+                "attacks": [{
+                    "mission": "raid",
+                    "attacker_name": "Brannoc",
+                    "from_x": 12,
+                    "from_y": -40,
+                    "village_name": "Aelric's village",
+                    "village_x": 15,
+                    "village_y": -38,
+                    "arrives_at": "2026-01-05 14:30"
+                }]
+            }),
+            TemplateKey::EmailChangeEmail | TemplateKey::RecoveryEmail => json!({
+                "email": "player@example.com",
+                "link": "https://travillian.example/account/confirm?token=example",
+                "expires_minutes": 60
+            }),
+            TemplateKey::EmailChangedEmail => json!({
+                "email": "player@example.com",
+                "link": "https://travillian.example/account/recovery?token=example",
+                "expires_days": 7
+            }),
+            TemplateKey::AllianceAwardsMessage => json!({
+                "week_start": "2026-01-05",
+                "awards": [
+                    {
+                        "category": "defender",
+                        "player_name": "Aelric",
+                        "score": 5400,
+                        "attacks": 2
+                    },
+                    {
+                        "category": "attacker",
+                        "player_name": "Brannoc",
+                        "score": 830,
+                        "attacks": 14
+                    }
+                ]
+            }),
+        }
+    }
+}
+
+// ==================== Database Models ====================
+
+/// An edited version of a template in one language
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct MessageTemplate {
+    pub id: Uuid,
+    pub name: String,
+    pub locale: String,
+    pub version: i32,
+    pub subject: String,
+    pub body: String,
+    pub created_by: Option<Uuid>,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Template Text ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct TemplateText {
+    pub subject: String,
+    pub body: String,
+}
+
+/// A built-in template file: texts by template name, then locale
+pub type TemplatesFile = HashMap<String, HashMap<String, TemplateText>>;
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct PublishTemplateRequest {
+    pub locale: String,
+    pub subject: String,
+    pub body: String,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct RevertTemplateRequest {
+    pub locale: String,
+    /// Version to publish again
+    pub version: i32,
+}
+
+/// Render a draft, or the text in use when none is given
+#[derive(Debug, Deserialize)]
+pub struct PreviewTemplateRequest {
+    pub locale: String,
+    pub subject: Option<String>,
+    pub body: Option<String>,
+    /// Context to render; the template's sample if omitted
+    pub context: Option<serde_json::Value>,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct TemplateInfo {
+    pub name: &'static str,
+    pub channel: TemplateChannel,
+    pub description: &'static str,
+    /// Version in use by locale; missing where the built-in text is used
+    pub versions: HashMap<String, i32>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct TemplateDetails {
+    pub name: &'static str,
+    pub channel: TemplateChannel,
+    pub description: &'static str,
+    pub sample: serde_json::Value,
+    /// Text shipped with the server, by locale
+    pub builtin: HashMap<String, TemplateText>,
+    /// Edited versions, newest first
+    pub versions: Vec<MessageTemplate>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct RenderedTemplate {
+    pub subject: String,
+    pub body: String,
+}
@@ -0,0 +1,75 @@
+use chrono::{DateTime, Duration, Utc};
+use serde::Serialize;
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use crate::models::oasis::REGROWTH_INTERVAL_SECS;
+
+// ==================== Tick Jobs ====================
+
+/// World-wide periodic mechanics run by the tick coordinator
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum TickJob {
+    LoyaltyRegeneration,
+    OasisRegrowth,
+}
+
+impl TickJob {
+    pub const ALL: &'static [TickJob] = &[TickJob::LoyaltyRegeneration, TickJob::OasisRegrowth];
+
+    pub fn name(&self) -> &'static str {
+        match self {
+            TickJob::LoyaltyRegeneration => "loyalty_regeneration",
+            TickJob::OasisRegrowth => "oasis_regrowth",
+        }
+    }
+
+    /// Game time covered by one tick
+    pub fn interval(&self) -> Duration {
+        match self {
+            TickJob::LoyaltyRegeneration => Duration::hours(1),
+            TickJob::OasisRegrowth => Duration::seconds(REGROWTH_INTERVAL_SECS),
+        }
+    }
+}
+
+/// Inclusive lower / exclusive upper bound of a shard's ids (villages or
+/// oases, depending on the job). Both are random v4 UUIDs, so equal ranges
+/// hold roughly equal numbers of rows.
+pub fn shard_range(shard: i32, shard_count: i32) -> (Uuid, Option<Uuid>) {
+    let width = u128::MAX / shard_count as u128;
+    let lower = Uuid::from_u128(width * shard as u128);
+    let upper = if shard + 1 >= shard_count {
+        None
+    } else {
+        Some(Uuid::from_u128(width * (shard as u128 + 1)))
+    };
+    (lower, upper)
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct TickShard {
+    pub job: String,
+    pub shard: i32,
+    pub shard_count: i32,
+    pub watermark: DateTime<Utc>,
+    pub locked_by: Option<Uuid>,
+    pub locked_until: Option<DateTime<Utc>>,
+    pub last_run_at: Option<DateTime<Utc>>,
+    pub ticks_applied: i64,
+    pub ticks_skipped: i64,
+    pub updated_at: DateTime<Utc>,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct TickRunResult {
+    pub shards_processed: usize,
+    pub ticks_applied: i64,
+    pub ticks_skipped: i64,
+    pub villages_updated: u64,
+    pub oases_regrown: u64,
+}
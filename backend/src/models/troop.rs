@@ -35,7 +35,7 @@ pub enum TroopType {
     ElderChief,
 }
 
-#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq)]
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq, Hash)]
 #[sqlx(type_name = "tribe_type", rename_all = "snake_case")]
 #[serde(rename_all = "snake_case")]
 pub enum TribeType {
@@ -45,7 +45,38 @@ pub enum TribeType {
     Special,
 }
 
+impl TribeType {
+    /// Tribes a player can belong to; Special units are shared by all
+    pub const PLAYABLE: [TribeType; 3] = [TribeType::Phasuttha, TribeType::Nava, TribeType::Kiri];
+
+    pub fn is_playable(&self) -> bool {
+        *self != TribeType::Special
+    }
+}
+
 impl TroopType {
+    pub const ALL: &'static [TroopType] = &[
+        TroopType::Infantry,
+        TroopType::Spearman,
+        TroopType::WarElephant,
+        TroopType::BuffaloWagon,
+        TroopType::KrisWarrior,
+        TroopType::SeaDiver,
+        TroopType::WarPrahu,
+        TroopType::MerchantShip,
+        TroopType::Crossbowman,
+        TroopType::MountainWarrior,
+        TroopType::HighlandPony,
+        TroopType::TrapMaker,
+        TroopType::SwampDragon,
+        TroopType::LocustSwarm,
+        TroopType::BattleDuck,
+        TroopType::PortugueseMusketeer,
+        TroopType::RoyalAdvisor,
+        TroopType::HarborMaster,
+        TroopType::ElderChief,
+    ];
+
     pub fn tribe(&self) -> TribeType {
         match self {
             TroopType::Infantry | TroopType::Spearman | TroopType::WarElephant | TroopType::BuffaloWagon | TroopType::RoyalAdvisor => TribeType::Phasuttha,
@@ -131,6 +162,7 @@ pub struct TroopQueue {
     pub started_at: DateTime<Utc>,
     pub ends_at: DateTime<Utc>,
     pub created_at: DateTime<Utc>,
+    pub version: i32,
 }
 
 // Request/Response DTOs
@@ -156,7 +188,7 @@ pub struct TroopCost {
     pub time_seconds: i32,
 }
 
-#[derive(Debug, Clone, Serialize)]
+#[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct TroopResponse {
     pub troop_type: TroopType,
     pub count: i32,
@@ -183,6 +215,7 @@ pub struct TroopQueueResponse {
     pub each_duration_seconds: i32,
     pub started_at: DateTime<Utc>,
     pub ends_at: DateTime<Utc>,
+    pub version: i32,
 }
 
 impl From<TroopQueue> for TroopQueueResponse {
@@ -194,6 +227,7 @@ impl From<TroopQueue> for TroopQueueResponse {
             each_duration_seconds: q.each_duration_seconds,
             started_at: q.started_at,
             ends_at: q.ends_at,
+            version: q.version,
         }
     }
 }
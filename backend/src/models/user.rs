@@ -3,6 +3,13 @@ use serde::{Deserialize, Serialize};
 use sqlx::FromRow;
 use uuid::Uuid;
 
+use super::template::DEFAULT_LOCALE;
+use super::troop::TribeType;
+
+/// The Natars, who take over abandoned villages. Never logs in.
+pub const NATAR_FIREBASE_UID: &str = "system:natar";
+pub const NATAR_NAME: &str = "Natarian";
+
 #[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
 pub struct User {
     pub id: Uuid,
@@ -11,6 +18,7 @@ pub struct User {
     pub display_name: Option<String>,
     pub photo_url: Option<String>,
     pub provider: String,
+    pub tribe: TribeType,
     pub created_at: DateTime<Utc>,
     pub updated_at: DateTime<Utc>,
     pub last_login_at: DateTime<Utc>,
@@ -24,6 +32,8 @@ pub struct CreateUser {
     pub display_name: Option<String>,
     pub photo_url: Option<String>,
     pub provider: String,
+    /// Only applied when the user is created
+    pub tribe: TribeType,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -41,6 +51,7 @@ pub struct UserResponse {
     pub display_name: Option<String>,
     pub photo_url: Option<String>,
     pub provider: String,
+    pub tribe: TribeType,
     pub created_at: DateTime<Utc>,
 }
 
@@ -53,7 +64,49 @@ impl From<User> for UserResponse {
             display_name: user.display_name,
             photo_url: user.photo_url,
             provider: user.provider,
+            tribe: user.tribe,
             created_at: user.created_at,
         }
     }
 }
+
+// ==================== Email Preferences ====================
+
+/// Default minimum time between two attack warning emails
+pub const DEFAULT_ATTACK_QUIET_MINUTES: i32 = 60;
+
+/// Bounds a player may set the quiet period to
+pub const MIN_ATTACK_QUIET_MINUTES: i32 = 15;
+pub const MAX_ATTACK_QUIET_MINUTES: i32 = 1440;
+
+/// Email the player has asked for; everything is off until they opt in
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct EmailPreferences {
+    pub weekly_digest: bool,
+    /// Warn about incoming attacks while the player is offline
+    pub attack_warning: bool,
+    /// Minimum time between two attack warnings; attacks detected
+    /// meanwhile go into the next one
+    pub attack_quiet_minutes: i32,
+    /// Language emails are written in
+    pub locale: String,
+}
+
+impl Default for EmailPreferences {
+    fn default() -> Self {
+        Self {
+            weekly_digest: false,
+            attack_warning: false,
+            attack_quiet_minutes: DEFAULT_ATTACK_QUIET_MINUTES,
+            locale: DEFAULT_LOCALE.to_string(),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct UpdateEmailPreferencesRequest {
+    pub weekly_digest: Option<bool>,
+    pub attack_warning: Option<bool>,
+    pub attack_quiet_minutes: Option<i32>,
+    pub locale: Option<String>,
+}
@@ -3,6 +3,209 @@ use serde::{Deserialize, Serialize};
 use sqlx::FromRow;
 use uuid::Uuid;
 
+use super::oasis::OasisBonus;
+
+/// Resource fields outside the capital stop at this level
+pub const NON_CAPITAL_FIELD_MAX_LEVEL: i32 = 10;
+
+/// Total culture points a player needs to own `n` villages
+pub fn culture_points_for_village(n: i64) -> i64 {
+    if n <= 1 {
+        return 0;
+    }
+    // Travian's curve, rounded to the hundred
+    let points = 1.6 / 3.0 * (n as f64).powf(2.3) * 1000.0;
+    (points / 100.0).round() as i64 * 100
+}
+
+/// How many villages a player's culture points allow
+pub fn villages_allowed(total_culture_points: i64) -> i64 {
+    let mut n = 1;
+    while culture_points_for_village(n + 1) <= total_culture_points {
+        n += 1;
+    }
+    n
+}
+
+// ==================== Spawn Placement ====================
+
+/// Coordinates run from -WORLD_RADIUS to WORLD_RADIUS on both axes
+pub const WORLD_RADIUS: i32 = 200;
+
+/// Radius of the spawn ring for the very first players
+pub const SPAWN_START_RADIUS: i32 = 10;
+
+/// How far the spawn ring has moved out after `n` players: it grows
+/// with the square root, so the settled area grows with the player count
+pub const SPAWN_GROWTH: f64 = 1.5;
+
+/// Width of the ring new players are placed in, inside its outer edge
+pub const SPAWN_RING_WIDTH: i32 = 12;
+
+/// Neighbourhood (in tiles, each axis) counted for newbie density
+pub const SPAWN_DENSITY_RADIUS: i32 = 3;
+
+/// A tile is good enough once it has at most this many villages nearby
+pub const SPAWN_MAX_NEIGHBOURS: usize = 2;
+
+/// Tiles kept between a new player and any Natar village
+pub const SPAWN_NATAR_DISTANCE: i32 = 7;
+
+/// Candidate tiles tried per ring before it is widened
+pub const SPAWN_CANDIDATES: usize = 64;
+
+/// Part of the map a new player asked to start in. North is +y.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize, sqlx::Type)]
+#[sqlx(type_name = "spawn_quadrant", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum Quadrant {
+    NorthEast,
+    NorthWest,
+    SouthEast,
+    SouthWest,
+}
+
+impl Quadrant {
+    pub const ALL: [Quadrant; 4] = [
+        Quadrant::NorthEast,
+        Quadrant::NorthWest,
+        Quadrant::SouthEast,
+        Quadrant::SouthWest,
+    ];
+
+    /// Sign of x and y in this quadrant
+    pub fn signs(&self) -> (i32, i32) {
+        match self {
+            Quadrant::NorthEast => (1, 1),
+            Quadrant::NorthWest => (-1, 1),
+            Quadrant::SouthEast => (1, -1),
+            Quadrant::SouthWest => (-1, -1),
+        }
+    }
+}
+
+/// Outer edge of the spawn ring once `players` have settled
+pub fn spawn_radius(players: i64) -> i32 {
+    let grown = SPAWN_START_RADIUS as f64 + (players.max(0) as f64).sqrt() * SPAWN_GROWTH;
+    (grown.round() as i32).min(WORLD_RADIUS)
+}
+
+// ==================== Resource Fields ====================
+
+/// Mixed into tile coordinates so the field layout isn't an obvious
+/// pattern on the map
+const FIELD_TYPE_SEED: u64 = 0x5452_4156_4941_4e00;
+
+/// Furthest (in tiles, each axis) a cropper search may look
+pub const CROPPER_SEARCH_MAX_RANGE: i32 = 25;
+
+/// Distribution of the 18 resource fields on a tile, named wood, clay,
+/// iron, crop. Every tile has one; a village founded there gets these
+/// fields.
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq, Hash)]
+#[sqlx(type_name = "field_type")]
+pub enum FieldType {
+    #[serde(rename = "4446")]
+    #[sqlx(rename = "4446")]
+    F4446,
+    #[serde(rename = "4437")]
+    #[sqlx(rename = "4437")]
+    F4437,
+    #[serde(rename = "4347")]
+    #[sqlx(rename = "4347")]
+    F4347,
+    #[serde(rename = "3447")]
+    #[sqlx(rename = "3447")]
+    F3447,
+    #[serde(rename = "3456")]
+    #[sqlx(rename = "3456")]
+    F3456,
+    #[serde(rename = "3546")]
+    #[sqlx(rename = "3546")]
+    F3546,
+    #[serde(rename = "4356")]
+    #[sqlx(rename = "4356")]
+    F4356,
+    #[serde(rename = "4536")]
+    #[sqlx(rename = "4536")]
+    F4536,
+    #[serde(rename = "5346")]
+    #[sqlx(rename = "5346")]
+    F5346,
+    #[serde(rename = "5436")]
+    #[sqlx(rename = "5436")]
+    F5436,
+    /// 9-cropper
+    #[serde(rename = "3339")]
+    #[sqlx(rename = "3339")]
+    F3339,
+    /// 15-cropper
+    #[serde(rename = "11115")]
+    #[sqlx(rename = "11115")]
+    F11115,
+}
+
+impl FieldType {
+    /// Every field type with how often it turns up, per thousand tiles
+    pub const WEIGHTS: [(FieldType, u64); 12] = [
+        (FieldType::F4446, 400),
+        (FieldType::F4437, 50),
+        (FieldType::F4347, 50),
+        (FieldType::F3447, 50),
+        (FieldType::F3456, 60),
+        (FieldType::F3546, 60),
+        (FieldType::F4356, 60),
+        (FieldType::F4536, 60),
+        (FieldType::F5346, 60),
+        (FieldType::F5436, 60),
+        (FieldType::F3339, 70),
+        (FieldType::F11115, 20),
+    ];
+
+    /// The field type of a tile. Fixed by its coordinates, so the whole
+    /// map is known without storing it.
+    pub fn at(x: i32, y: i32) -> FieldType {
+        let mut h = (((x as u32 as u64) << 32) | (y as u32 as u64)) ^ FIELD_TYPE_SEED;
+        // splitmix64 finaliser
+        h = (h ^ (h >> 30)).wrapping_mul(0xbf58_476d_1ce4_e5b9);
+        h = (h ^ (h >> 27)).wrapping_mul(0x94d0_49bb_1331_11eb);
+        h ^= h >> 31;
+
+        let total: u64 = Self::WEIGHTS.iter().map(|(_, w)| w).sum();
+        let mut roll = h % total;
+        for (field_type, weight) in Self::WEIGHTS {
+            if roll < weight {
+                return field_type;
+            }
+            roll -= weight;
+        }
+        FieldType::F4446
+    }
+
+    /// Number of woodcutters, clay pits, iron mines and crop fields
+    pub fn counts(&self) -> (i32, i32, i32, i32) {
+        match self {
+            FieldType::F4446 => (4, 4, 4, 6),
+            FieldType::F4437 => (4, 4, 3, 7),
+            FieldType::F4347 => (4, 3, 4, 7),
+            FieldType::F3447 => (3, 4, 4, 7),
+            FieldType::F3456 => (3, 4, 5, 6),
+            FieldType::F3546 => (3, 5, 4, 6),
+            FieldType::F4356 => (4, 3, 5, 6),
+            FieldType::F4536 => (4, 5, 3, 6),
+            FieldType::F5346 => (5, 3, 4, 6),
+            FieldType::F5436 => (5, 4, 3, 6),
+            FieldType::F3339 => (3, 3, 3, 9),
+            FieldType::F11115 => (1, 1, 1, 15),
+        }
+    }
+
+    /// Tiles with 9 or 15 crop fields, prized for capitals
+    pub fn is_cropper(&self) -> bool {
+        self.counts().3 >= 9
+    }
+}
+
 #[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
 pub struct Village {
     pub id: Uuid,
@@ -22,11 +225,16 @@ pub struct Village {
     // Stats
     pub population: i32,
     pub culture_points: i32,
+    /// Produced by the buildings; kept in step with them like population
+    pub culture_per_day: i32,
     pub loyalty: i32,
+    pub field_type: FieldType,
     // Timestamps
     pub resources_updated_at: DateTime<Utc>,
     pub created_at: DateTime<Utc>,
     pub updated_at: DateTime<Utc>,
+    // Optimistic concurrency, bumped on every update
+    pub version: i32,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -36,6 +244,7 @@ pub struct CreateVillage {
     pub x: i32,
     pub y: i32,
     pub is_capital: bool,
+    pub field_type: FieldType,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -51,6 +260,52 @@ pub struct ProductionRates {
     pub crop_per_hour: i32,
     pub crop_consumption: i32,
     pub net_crop_per_hour: i32,
+    pub breakdown: ProductionBreakdown,
+}
+
+/// Production per hour of each resource from one source
+#[derive(Debug, Clone, Copy, Default, Serialize, Deserialize)]
+pub struct ProductionShare {
+    pub wood: i32,
+    pub clay: i32,
+    pub iron: i32,
+    pub crop: i32,
+}
+
+impl ProductionShare {
+    /// Given percentages of this production
+    pub fn percent(&self, wood: i32, clay: i32, iron: i32, crop: i32) -> ProductionShare {
+        ProductionShare {
+            wood: self.wood * wood / 100,
+            clay: self.clay * clay / 100,
+            iron: self.iron * iron / 100,
+            crop: self.crop * crop / 100,
+        }
+    }
+
+    pub fn add(&mut self, other: ProductionShare) {
+        self.wood += other.wood;
+        self.clay += other.clay;
+        self.iron += other.iron;
+        self.crop += other.crop;
+    }
+}
+
+/// Where a village's production comes from. Percentage bonuses apply in
+/// the order listed, each on top of everything before it; the shares add
+/// up to the village's rates.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ProductionBreakdown {
+    /// Base production plus the resource fields
+    pub fields: ProductionShare,
+    /// Percent added by the oases the village holds
+    pub oasis_bonus: OasisBonus,
+    pub oases: ProductionShare,
+    pub tribe: ProductionShare,
+    /// Holding the village's region, on region control worlds
+    pub region: ProductionShare,
+    /// Resource points of heroes living in the village
+    pub hero: ProductionShare,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -68,14 +323,20 @@ pub struct VillageResponse {
     pub granary_capacity: i32,
     pub population: i32,
     pub culture_points: i32,
+    pub culture_per_day: i32,
     pub loyalty: i32,
+    pub field_type: FieldType,
     pub created_at: DateTime<Utc>,
+    pub version: i32,
+    /// Stores that are full; their production is paused
+    pub overflow: StorageOverflow,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub production: Option<ProductionRates>,
 }
 
 impl From<Village> for VillageResponse {
     fn from(v: Village) -> Self {
+        let overflow = StorageOverflow::of(&v);
         Self {
             id: v.id,
             name: v.name,
@@ -90,13 +351,60 @@ impl From<Village> for VillageResponse {
             granary_capacity: v.granary_capacity,
             population: v.population,
             culture_points: v.culture_points,
+            culture_per_day: v.culture_per_day,
             loyalty: v.loyalty,
+            field_type: v.field_type,
             created_at: v.created_at,
+            version: v.version,
+            overflow,
             production: None,
         }
     }
 }
 
+/// Which resources have reached their store's capacity. Production of a
+/// full resource is lost until some is spent or the store is upgraded.
+#[derive(Debug, Clone, Copy, Default, Serialize, Deserialize, PartialEq, Eq)]
+pub struct StorageOverflow {
+    pub wood: bool,
+    pub clay: bool,
+    pub iron: bool,
+    pub crop: bool,
+}
+
+impl StorageOverflow {
+    pub fn of(village: &Village) -> Self {
+        Self {
+            wood: village.wood >= village.warehouse_capacity,
+            clay: village.clay >= village.warehouse_capacity,
+            iron: village.iron >= village.warehouse_capacity,
+            crop: village.crop >= village.granary_capacity,
+        }
+    }
+
+    /// Resources full now that weren't in `before`
+    pub fn newly_full(&self, before: &StorageOverflow) -> Vec<String> {
+        [
+            ("wood", self.wood && !before.wood),
+            ("clay", self.clay && !before.clay),
+            ("iron", self.iron && !before.iron),
+            ("crop", self.crop && !before.crop),
+        ]
+        .into_iter()
+        .filter(|(_, full)| *full)
+        .map(|(name, _)| name.to_string())
+        .collect()
+    }
+}
+
+/// What a reconciliation pass found
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct StatsReconcileResult {
+    pub checked: i32,
+    pub population_fixed: i32,
+    pub culture_fixed: i32,
+}
+
 impl VillageResponse {
     pub fn with_production(mut self, production: ProductionRates) -> Self {
         self.production = Some(production);
@@ -113,5 +421,15 @@ pub struct VillageMapInfo {
     pub x: i32,
     pub y: i32,
     pub population: i32,
+    pub field_type: FieldType,
     pub player_name: Option<String>,
 }
+
+/// A free cropper tile found by a cropper search
+#[derive(Debug, Clone, Serialize)]
+pub struct CropperTile {
+    pub x: i32,
+    pub y: i32,
+    pub field_type: FieldType,
+    pub distance: f64,
+}
@@ -0,0 +1,120 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+use super::army::MissionType;
+use super::troop::TroopType;
+
+// ==================== Fairness Limits ====================
+
+/// Armies one wave may coordinate
+pub const MAX_WAVE_SENDS: usize = 20;
+
+/// Scheduled waves a player may have waiting at once
+pub const MAX_PLANNED_WAVES: i64 = 10;
+
+/// Earliest a scheduled send may leave, so the player can still review it
+pub const MIN_SCHEDULE_LEAD_SECS: i64 = 30;
+
+/// Furthest ahead a send may be scheduled
+pub const MAX_SCHEDULE_AHEAD_HOURS: i64 = 24;
+
+// ==================== Enums ====================
+
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, sqlx::Type, PartialEq, Eq)]
+#[sqlx(type_name = "wave_send_status", rename_all = "snake_case")]
+#[serde(rename_all = "snake_case")]
+pub enum WaveSendStatus {
+    Planned,
+    Sent,
+    Failed,
+    Cancelled,
+}
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct AttackWave {
+    pub id: Uuid,
+    pub player_id: Uuid,
+    pub to_x: i32,
+    pub to_y: i32,
+    pub arrive_at: DateTime<Utc>,
+    pub created_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct WaveSend {
+    pub id: Uuid,
+    pub wave_id: Uuid,
+    pub from_village_id: Uuid,
+    pub mission: MissionType,
+    pub troops: sqlx::types::Json<HashMap<TroopType, i32>>,
+    pub hero_id: Option<Uuid>,
+    pub send_at: DateTime<Utc>,
+    pub status: WaveSendStatus,
+    pub army_id: Option<Uuid>,
+    pub error: Option<String>,
+    pub sent_at: Option<DateTime<Utc>>,
+}
+
+/// A send that is due, with what the scheduler needs to send it
+#[derive(Debug, Clone, FromRow)]
+pub struct DueWaveSend {
+    pub id: Uuid,
+    pub player_id: Uuid,
+    pub from_village_id: Uuid,
+    pub to_x: i32,
+    pub to_y: i32,
+    pub mission: MissionType,
+    pub troops: sqlx::types::Json<HashMap<TroopType, i32>>,
+    pub hero_id: Option<Uuid>,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct WaveSendRequest {
+    pub from_village_id: Uuid,
+    pub mission: MissionType,
+    pub troops: HashMap<TroopType, i32>,
+    #[serde(default)]
+    pub hero_id: Option<Uuid>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct PlanWaveRequest {
+    pub to_x: i32,
+    pub to_y: i32,
+    /// When every army should land; the earliest possible time if omitted
+    pub arrive_at: Option<DateTime<Utc>>,
+    pub sends: Vec<WaveSendRequest>,
+    /// Have the server send each army at its send time
+    #[serde(default)]
+    pub schedule: bool,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct WaveSendPlan {
+    pub from_village_id: Uuid,
+    pub travel_seconds: i64,
+    pub send_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct WavePlanResponse {
+    pub arrive_at: DateTime<Utc>,
+    /// In the order given
+    pub sends: Vec<WaveSendPlan>,
+    /// The stored wave, when it was scheduled
+    pub wave: Option<WaveResponse>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct WaveResponse {
+    #[serde(flatten)]
+    pub wave: AttackWave,
+    pub sends: Vec<WaveSend>,
+}
@@ -0,0 +1,68 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+// ==================== Constants ====================
+
+/// Dumps of each format kept listed; older ones stay in storage
+pub const DUMPS_LISTED: i64 = 7;
+
+/// How long a download link stays valid
+pub const DUMP_LINK_TTL_SECS: i64 = 3600;
+
+// ==================== Database Models ====================
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct WorldDump {
+    pub id: Uuid,
+    /// `sql` or `csv`, both gzip compressed
+    pub format: String,
+    pub object_key: String,
+    pub village_count: i32,
+    pub size_bytes: i64,
+    pub created_at: DateTime<Utc>,
+}
+
+/// One line of a dump: only what the map and rankings already show
+#[derive(Debug, Clone, FromRow)]
+pub struct DumpVillage {
+    pub village_id: Uuid,
+    pub x: i32,
+    pub y: i32,
+    pub village_name: String,
+    pub population: i32,
+    pub player_id: Uuid,
+    pub player_name: Option<String>,
+    pub tribe: String,
+    pub alliance_id: Option<Uuid>,
+    pub alliance_tag: Option<String>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct DumpDownloadQuery {
+    pub expires: i64,
+    pub signature: String,
+}
+
+// ==================== Response DTOs ====================
+
+/// A dump with a signed download link
+#[derive(Debug, Clone, Serialize)]
+pub struct WorldDumpLink {
+    pub id: Uuid,
+    pub format: String,
+    pub village_count: i32,
+    pub size_bytes: i64,
+    pub created_at: DateTime<Utc>,
+    pub url: String,
+    pub expires_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct WorldDumpRunResult {
+    pub village_count: usize,
+    pub dumps: Vec<WorldDump>,
+}
@@ -0,0 +1,506 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+use super::village::Quadrant;
+use super::world_status::WorldMilestone;
+
+// ==================== Database Models ====================
+
+/// A setting of the world whose database it is read from. Every world is
+/// migrated into a database or schema of its own (see `ShardResolver`), so
+/// the table needs no world column: picking the pool picks the world.
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct WorldSetting {
+    pub key: String,
+    pub value: serde_json::Value,
+    pub updated_by: Option<Uuid>,
+    pub updated_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, FromRow)]
+pub struct ReportArchive {
+    pub id: Uuid,
+    pub object_key: String,
+    pub report_count: i32,
+    pub oldest_occurred_at: DateTime<Utc>,
+    pub newest_occurred_at: DateTime<Utc>,
+    pub created_at: DateTime<Utc>,
+}
+
+// ==================== Settings ====================
+
+/// Setting key for report retention
+pub const REPORT_RETENTION_KEY: &str = "report_retention";
+
+/// Report retention policy for this world (stored under `report_retention`)
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct ReportRetentionSettings {
+    /// Raid reports nobody has opened are deleted after this many days (0 = keep)
+    pub unread_raid_days: i32,
+    /// Scout reports are deleted after this many days (0 = keep)
+    pub scout_report_days: i32,
+    /// Battle reports older than this are moved to object storage
+    pub archive_after_days: i32,
+    pub archive_enabled: bool,
+}
+
+impl Default for ReportRetentionSettings {
+    fn default() -> Self {
+        Self {
+            unread_raid_days: 14,
+            scout_report_days: 30,
+            archive_after_days: 90,
+            archive_enabled: false,
+        }
+    }
+}
+
+/// Setting key for the gray zone
+pub const INACTIVITY_KEY: &str = "inactivity";
+
+/// What becomes of an abandoned player's villages
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum AbandonAction {
+    /// Handed to the Natars
+    Natar,
+    /// Removed from the map where nothing refers to them, Natars otherwise
+    Clear,
+}
+
+/// Gray-zone policy for players who stop logging in (stored under `inactivity`)
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct InactivitySettings {
+    /// Off by default; decay and abandonment can't be undone
+    pub enabled: bool,
+    /// Players are flagged inactive this long after their last login
+    pub inactive_after_days: i32,
+    /// Loyalty each of their villages loses per day while inactive
+    pub loyalty_decay_per_day: i32,
+    /// Building levels each of their villages loses per day while inactive
+    pub levels_lost_per_day: i32,
+    /// Their villages are given up this long after the last login
+    pub abandon_after_days: i32,
+    pub abandon_action: AbandonAction,
+}
+
+impl Default for InactivitySettings {
+    fn default() -> Self {
+        Self {
+            enabled: false,
+            inactive_after_days: 14,
+            loyalty_decay_per_day: 5,
+            levels_lost_per_day: 1,
+            abandon_after_days: 60,
+            abandon_action: AbandonAction::Natar,
+        }
+    }
+}
+
+/// Setting key for the anti-pushing limits
+pub const ANTI_PUSHING_KEY: &str = "anti_pushing";
+
+/// Limits on one-way resource flows between accounts (stored under
+/// `anti_pushing`). They only apply to pairs where the sender ranks far
+/// below the receiver, the usual shape of a farm account feeding a main.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct AntiPushingSettings {
+    pub enabled: bool,
+    /// Flows are summed over this many trailing hours
+    pub window_hours: i32,
+    /// Applies when the sender's rank is at least this many times the
+    /// receiver's (rank 300 sending to rank 100 is a ratio of 3)
+    pub rank_ratio: i32,
+    /// Most resources, net of what came back, a sender may ship to one
+    /// receiver in the window
+    pub max_net_transfer: i64,
+    /// Pairs at or above this share of the limit show in the admin report
+    pub near_limit_percent: i32,
+}
+
+impl Default for AntiPushingSettings {
+    fn default() -> Self {
+        Self {
+            enabled: true,
+            window_hours: 72,
+            rank_ratio: 3,
+            max_net_transfer: 20_000,
+            near_limit_percent: 80,
+        }
+    }
+}
+
+/// Setting key for runtime-tunable server settings
+pub const RUNTIME_CONFIG_KEY: &str = "runtime_config";
+
+/// Values ops can change on a running server (stored under `runtime_config`).
+/// Every instance polls them, so a change applies everywhere within seconds.
+/// Ports, database and other boot-time settings stay in `Config`.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct RuntimeSettings {
+    /// Log filter directives (`backend=info,tower_http=warn`); unset = RUST_LOG
+    pub log_filter: Option<String>,
+    /// Slow query threshold; unset = DB_SLOW_QUERY_MS
+    pub slow_query_ms: Option<u64>,
+    /// Authenticated API requests per player per minute, per instance (0 = unlimited)
+    pub player_requests_per_minute: u32,
+    /// Requests one player may have running at once, per instance (0 = unlimited)
+    pub player_max_in_flight: u32,
+    /// Of those, how many may change state (POST, PUT, DELETE...). Keeps
+    /// several tabs from racing each other's mutations; 1 serialises them.
+    pub player_max_mutations_in_flight: u32,
+    /// Requests in flight on an instance past which non-critical endpoints
+    /// (map, rankings, search...) answer 503 (0 = never shed)
+    pub shed_in_flight: u32,
+    /// Also shed non-critical endpoints while army movements run late
+    pub shed_on_movement_lag: bool,
+    pub features: FeatureToggles,
+}
+
+impl Default for RuntimeSettings {
+    fn default() -> Self {
+        Self {
+            log_filter: None,
+            slow_query_ms: None,
+            player_requests_per_minute: 0,
+            player_max_in_flight: 0,
+            player_max_mutations_in_flight: 0,
+            shed_in_flight: 0,
+            shed_on_movement_lag: false,
+            features: FeatureToggles::default(),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct FeatureToggles {
+    /// New players may sign up
+    pub registration: bool,
+    /// Gold purchases through Stripe
+    pub shop: bool,
+}
+
+impl Default for FeatureToggles {
+    fn default() -> Self {
+        Self {
+            registration: true,
+            shop: true,
+        }
+    }
+}
+
+/// Setting key for the game clock offset
+pub const TIME_WARP_KEY: &str = "time_warp";
+
+/// How far the game clock runs ahead of the wall clock (stored under
+/// `time_warp`). Only ever non-zero on worlds with TIME_WARP_ENABLED.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct TimeWarpSettings {
+    pub offset_seconds: i64,
+}
+
+/// Setting key for the world clock's high-water mark
+pub const WORLD_CLOCK_KEY: &str = "world_clock";
+
+/// Latest instant the world clock has handed out on any instance (stored
+/// under `world_clock`), so a restart on a host running behind doesn't turn
+/// time back
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct WorldClockSettings {
+    pub high_water: Option<DateTime<Utc>>,
+}
+
+/// Setting key for an emergency world pause
+pub const WORLD_PAUSE_KEY: &str = "world_pause";
+
+/// A world frozen for maintenance (stored under `world_pause`). While
+/// `paused_at` is set the game clock stands still at that instant; resuming
+/// pushes every running timer back by the time the world was down.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct WorldPauseSettings {
+    /// Game time the clock stopped at
+    pub paused_at: Option<DateTime<Utc>>,
+    pub reason: Option<String>,
+    pub paused_by: Option<Uuid>,
+}
+
+/// Setting key for the region control world type
+pub const REGION_CONTROL_KEY: &str = "region_control";
+
+/// Region control victory (stored under `region_control`). The map is cut
+/// into a grid of regions; an alliance holding a population majority in one
+/// long enough earns victory points and a production bonus there, and the
+/// first to the target wins the world.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct RegionControlSettings {
+    /// Off on ordinary worlds
+    pub enabled: bool,
+    /// Regions along each axis; the map has this many squared
+    pub regions_per_axis: i32,
+    /// Share of a region's population an alliance needs to control it
+    pub majority_percent: i32,
+    /// Control must be held this long before it scores
+    pub hold_hours: i32,
+    /// Victory points per hour for each region held past `hold_hours`
+    pub points_per_hour: i64,
+    /// Points that win the world
+    pub victory_points: i64,
+    /// Production bonus for the controlling alliance's villages in a scoring region
+    pub production_bonus_percent: i32,
+}
+
+impl Default for RegionControlSettings {
+    fn default() -> Self {
+        Self {
+            enabled: false,
+            regions_per_axis: 4,
+            majority_percent: 50,
+            hold_hours: 24,
+            points_per_hour: 10,
+            victory_points: 10_000,
+            production_bonus_percent: 10,
+        }
+    }
+}
+
+/// Setting key for the world's endgame timeline
+pub const WORLD_TIMELINE_KEY: &str = "world_timeline";
+
+/// When the endgame phases start (stored under `world_timeline`), counted
+/// in days from the world's start so clients need no hard-coded dates
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct WorldTimelineSettings {
+    /// Unset = when the first village was founded
+    pub started_at: Option<DateTime<Utc>>,
+    pub artifacts_release_day: i32,
+    pub wonder_plans_release_day: i32,
+}
+
+impl Default for WorldTimelineSettings {
+    fn default() -> Self {
+        Self {
+            started_at: None,
+            artifacts_release_day: 90,
+            wonder_plans_release_day: 180,
+        }
+    }
+}
+
+/// Setting key for controlled world launches
+pub const REGISTRATION_KEY: &str = "registration";
+
+/// How new players get into the world (stored under `registration`). A
+/// gated world only lets players found their first village once an invite
+/// wave has reached them in the pre-registration queue.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct RegistrationSettings {
+    /// Off on ordinary worlds: anyone may join straight away
+    pub gated: bool,
+    /// Most players a quadrant takes (0 closes it); quadrants left out
+    /// have no cap
+    pub quadrant_caps: HashMap<Quadrant, i64>,
+    /// How long an invite stays good before the place goes to someone else
+    pub invite_hours: i32,
+    /// Most places a group registering together may reserve
+    pub max_group_slots: i32,
+}
+
+impl Default for RegistrationSettings {
+    fn default() -> Self {
+        Self {
+            gated: false,
+            quadrant_caps: HashMap::new(),
+            invite_hours: 48,
+            max_group_slots: 30,
+        }
+    }
+}
+
+/// Setting key for soft-deleted rows
+pub const SOFT_DELETE_KEY: &str = "soft_delete";
+
+/// How long deleted messages, reports and notes stay restorable (stored
+/// under `soft_delete`)
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(default)]
+pub struct SoftDeleteSettings {
+    /// Deleted rows are purged after this many days (0 = keep)
+    pub retention_days: i32,
+}
+
+impl Default for SoftDeleteSettings {
+    fn default() -> Self {
+        Self { retention_days: 30 }
+    }
+}
+
+/// Setting key for the invariant checker
+pub const INVARIANT_CHECKS_KEY: &str = "invariant_checks";
+
+/// Which kinds of drift the invariant checker repairs on its own (stored
+/// under `invariant_checks`). Anything else is only reported.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+#[serde(default)]
+pub struct InvariantSettings {
+    pub auto_fix: Vec<String>,
+}
+
+/// Setting key for the milestones already announced to players
+pub const WORLD_MILESTONES_KEY: &str = "world_milestones";
+
+/// Milestones broadcast so far (stored under `world_milestones`), so each
+/// goes out once
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+#[serde(default)]
+pub struct AnnouncedMilestones {
+    pub milestones: Vec<WorldMilestone>,
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateReportRetentionRequest {
+    pub unread_raid_days: Option<i32>,
+    pub scout_report_days: Option<i32>,
+    pub archive_after_days: Option<i32>,
+    pub archive_enabled: Option<bool>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateSoftDeleteRequest {
+    pub retention_days: Option<i32>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateInvariantSettingsRequest {
+    pub auto_fix: Option<Vec<String>>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateInactivityRequest {
+    pub enabled: Option<bool>,
+    pub inactive_after_days: Option<i32>,
+    pub loyalty_decay_per_day: Option<i32>,
+    pub levels_lost_per_day: Option<i32>,
+    pub abandon_after_days: Option<i32>,
+    pub abandon_action: Option<AbandonAction>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateAntiPushingRequest {
+    pub enabled: Option<bool>,
+    pub window_hours: Option<i32>,
+    pub rank_ratio: Option<i32>,
+    pub max_net_transfer: Option<i64>,
+    pub near_limit_percent: Option<i32>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateRegionControlRequest {
+    pub enabled: Option<bool>,
+    pub regions_per_axis: Option<i32>,
+    pub majority_percent: Option<i32>,
+    pub hold_hours: Option<i32>,
+    pub points_per_hour: Option<i64>,
+    pub victory_points: Option<i64>,
+    pub production_bonus_percent: Option<i32>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateWorldTimelineRequest {
+    pub started_at: Option<DateTime<Utc>>,
+    pub artifacts_release_day: Option<i32>,
+    pub wonder_plans_release_day: Option<i32>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct UpdateRegistrationRequest {
+    pub gated: Option<bool>,
+    /// Replaces the caps; leave a quadrant out to lift its cap
+    pub quadrant_caps: Option<HashMap<Quadrant, i64>>,
+    pub invite_hours: Option<i32>,
+    pub max_group_slots: Option<i32>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct AdvanceClockRequest {
+    pub seconds: i64,
+}
+
+#[derive(Debug, Default, Deserialize)]
+#[serde(default)]
+pub struct PauseWorldRequest {
+    /// Shown to players while the world is down
+    pub reason: Option<String>,
+}
+
+// ==================== Response DTOs ====================
+
+#[derive(Debug, Clone, Serialize)]
+pub struct ClockStatus {
+    pub now: DateTime<Utc>,
+    pub offset_seconds: i64,
+    pub time_warp_enabled: bool,
+    /// Set while the world is paused; `now` stays here until it resumes
+    pub paused_at: Option<DateTime<Utc>>,
+    pub pause_reason: Option<String>,
+    /// How far this host's clock is behind the database's (negative when ahead)
+    pub skew_ms: i64,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct RetentionRunResult {
+    pub raids_deleted: u64,
+    pub scout_reports_deleted: u64,
+    pub reports_archived: u64,
+    pub partitions_ensured: Vec<String>,
+    pub partitions_dropped: Vec<String>,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct PurgeRunResult {
+    pub messages_purged: u64,
+    pub battle_reports_purged: u64,
+    pub scout_reports_purged: u64,
+    pub notes_purged: u64,
+}
+
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct InactivityRunResult {
+    pub players_flagged: u64,
+    pub villages_decayed: u64,
+    pub villages_to_natar: u64,
+    pub villages_cleared: u64,
+}
+
+/// A sender/receiver pair close to or over the anti-pushing limit
+#[derive(Debug, Clone, Serialize)]
+pub struct PushingPair {
+    pub sender_id: Uuid,
+    pub sender_name: Option<String>,
+    pub sender_rank: i64,
+    pub receiver_id: Uuid,
+    pub receiver_name: Option<String>,
+    pub receiver_rank: i64,
+    /// Shipped from sender to receiver in the window
+    pub sent: i64,
+    /// Shipped back the other way in the window
+    pub returned: i64,
+    pub net: i64,
+    pub limit: i64,
+    pub percent_of_limit: i64,
+}
@@ -0,0 +1,38 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+
+/// World that runs on the primary database unless the directory says otherwise
+pub const DEFAULT_WORLD: &str = "default";
+
+// ==================== World Shards ====================
+
+/// Where a world's data lives. Unset fields fall back to the primary's.
+#[derive(Debug, Clone, PartialEq, Eq, FromRow, Serialize)]
+pub struct WorldShard {
+    pub world_id: String,
+    pub host: Option<String>,
+    pub port: Option<i32>,
+    pub database_name: Option<String>,
+    pub schema_name: Option<String>,
+    pub created_at: DateTime<Utc>,
+    pub updated_at: DateTime<Utc>,
+}
+
+// ==================== DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct UpsertWorldShardRequest {
+    pub host: Option<String>,
+    pub port: Option<i32>,
+    pub database_name: Option<String>,
+    pub schema_name: Option<String>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct WorldShardResponse {
+    #[serde(flatten)]
+    pub shard: WorldShard,
+    /// Migrations applied on the shard, newest last
+    pub migrations_applied: usize,
+}
@@ -0,0 +1,68 @@
+use chrono::{DateTime, NaiveDate, Utc};
+use serde::{Deserialize, Serialize};
+use sqlx::FromRow;
+use uuid::Uuid;
+
+use super::troop::TribeType;
+
+/// Days of history in the statistics screen
+pub const STATS_HISTORY_DAYS: i64 = 30;
+
+/// Players listed as top attackers and defenders
+pub const TOP_COMBATANTS: i64 = 10;
+
+// ==================== Read Models ====================
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct DailyWorldStats {
+    pub day: NaiveDate,
+    pub total_players: i32,
+    /// Players who logged in that day
+    pub active_players: i32,
+    pub battles: i32,
+    /// Troops lost on both sides of every battle
+    pub troops_killed: i64,
+    pub updated_at: DateTime<Utc>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct TribeCount {
+    pub tribe: TribeType,
+    pub players: i64,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, FromRow)]
+pub struct TopCombatant {
+    pub user_id: Uuid,
+    pub display_name: Option<String>,
+    pub kills: i64,
+}
+
+// ==================== Request/Response DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct WorldStatsQuery {
+    #[serde(default = "default_days")]
+    pub days: i64,
+}
+
+fn default_days() -> i64 {
+    STATS_HISTORY_DAYS
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct WorldStatsResponse {
+    /// Oldest day first
+    pub daily: Vec<DailyWorldStats>,
+    pub tribes: Vec<TribeCount>,
+    /// Monday of the week the top lists cover
+    pub week_start: NaiveDate,
+    pub top_attackers: Vec<TopCombatant>,
+    pub top_defenders: Vec<TopCombatant>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct WorldStatsRunResult {
+    pub days_refreshed: usize,
+    pub combatants: u64,
+}
@@ -0,0 +1,91 @@
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+
+use super::region::RegionLeaderboard;
+
+// ==================== Enums ====================
+
+/// Points on the endgame timeline players are told about as they pass
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum WorldMilestone {
+    Artifacts,
+    WonderPlans,
+    Victory,
+}
+
+impl WorldMilestone {
+    pub const ALL: [WorldMilestone; 3] = [
+        WorldMilestone::Artifacts,
+        WorldMilestone::WonderPlans,
+        WorldMilestone::Victory,
+    ];
+
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            WorldMilestone::Artifacts => "artifacts",
+            WorldMilestone::WonderPlans => "wonder_plans",
+            WorldMilestone::Victory => "victory",
+        }
+    }
+
+    pub fn title(&self) -> &'static str {
+        match self {
+            WorldMilestone::Artifacts => "Artifacts released",
+            WorldMilestone::WonderPlans => "Wonder of the World plans released",
+            WorldMilestone::Victory => "The world has been won",
+        }
+    }
+}
+
+// ==================== Request DTOs ====================
+
+#[derive(Debug, Deserialize)]
+pub struct TimeSyncQuery {
+    /// Client clock when the request was sent, in ms since the epoch
+    pub client_time: Option<i64>,
+}
+
+// ==================== Response DTOs ====================
+
+/// Game time for client countdowns, answered NTP style. With `t0` the
+/// client's send time and `t3` when the answer arrived, the device clock is
+/// behind by `((received_ms - t0) + (server_time_ms - t3)) / 2`, and the
+/// network took `(t3 - t0) - (server_time_ms - received_ms)`.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct TimeSync {
+    pub server_time: DateTime<Utc>,
+    /// `server_time` in ms since the epoch
+    pub server_time_ms: i64,
+    /// When the request reached the server
+    pub received_ms: i64,
+    /// The client's send time, echoed
+    pub client_time: Option<i64>,
+    /// Countdowns stand still while the world is paused
+    pub paused: bool,
+}
+
+
+#[derive(Debug, Clone, Serialize)]
+pub struct MilestoneStatus {
+    pub milestone: WorldMilestone,
+    pub title: &'static str,
+    /// Unknown for milestones that are not on a schedule, until they happen
+    pub at: Option<DateTime<Utc>>,
+    pub reached: bool,
+    /// Countdown to `at`; None once reached or when unscheduled
+    pub seconds_remaining: Option<i64>,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct WorldStatusResponse {
+    pub now: DateTime<Utc>,
+    /// Frozen for maintenance; `now` stands still and changes are refused
+    pub paused: bool,
+    /// None until the first village is founded
+    pub started_at: Option<DateTime<Utc>>,
+    pub days_elapsed: i64,
+    pub milestones: Vec<MilestoneStatus>,
+    /// Victory point standings, on worlds with region control
+    pub victory: Option<RegionLeaderboard>,
+}
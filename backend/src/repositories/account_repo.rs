@@ -0,0 +1,132 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::account::{AccountToken, AccountTokenPurpose};
+
+pub struct AccountRepository;
+
+impl AccountRepository {
+    pub async fn create_token(
+        pool: &PgPool,
+        user_id: Uuid,
+        purpose: AccountTokenPurpose,
+        token_hash: &str,
+        email: &str,
+        previous_email: Option<&str>,
+        expires_at: DateTime<Utc>,
+    ) -> AppResult<AccountToken> {
+        let token = sqlx::query_as::<_, AccountToken>(
+            r#"
+            INSERT INTO account_tokens (user_id, purpose, token_hash, email, previous_email,
+                                        expires_at)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            RETURNING id, user_id, purpose, token_hash, email, previous_email, expires_at,
+                      used_at, created_at
+            "#,
+        )
+        .bind(user_id)
+        .bind(purpose)
+        .bind(token_hash)
+        .bind(email)
+        .bind(previous_email)
+        .bind(expires_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(token)
+    }
+
+    /// Claim an unused, unexpired token. None if it doesn't exist or was
+    /// already used, so each token works once even under concurrent use.
+    pub async fn use_token(
+        pool: &PgPool,
+        token_hash: &str,
+        purpose: AccountTokenPurpose,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<AccountToken>> {
+        let token = sqlx::query_as::<_, AccountToken>(
+            r#"
+            UPDATE account_tokens
+            SET used_at = $3
+            WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+            RETURNING id, user_id, purpose, token_hash, email, previous_email, expires_at,
+                      used_at, created_at
+            "#,
+        )
+        .bind(token_hash)
+        .bind(purpose)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(token)
+    }
+
+    /// When a token of this purpose was last mailed for the account
+    pub async fn last_created(
+        pool: &PgPool,
+        user_id: Uuid,
+        purpose: AccountTokenPurpose,
+    ) -> AppResult<Option<DateTime<Utc>>> {
+        let created_at = sqlx::query_scalar::<_, Option<DateTime<Utc>>>(
+            r#"
+            SELECT MAX(created_at)
+            FROM account_tokens
+            WHERE user_id = $1 AND purpose = $2
+            "#,
+        )
+        .bind(user_id)
+        .bind(purpose)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(created_at)
+    }
+
+    /// When the account's email was last changed
+    pub async fn last_email_change(
+        pool: &PgPool,
+        user_id: Uuid,
+    ) -> AppResult<Option<DateTime<Utc>>> {
+        let used_at = sqlx::query_scalar::<_, Option<DateTime<Utc>>>(
+            r#"
+            SELECT MAX(used_at)
+            FROM account_tokens
+            WHERE user_id = $1 AND purpose = 'email_change' AND used_at IS NOT NULL
+            "#,
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(used_at)
+    }
+
+    /// The account that most recently moved away from `email` since `since`
+    pub async fn find_user_by_previous_email(
+        pool: &PgPool,
+        email: &str,
+        since: DateTime<Utc>,
+    ) -> AppResult<Option<Uuid>> {
+        let user_id = sqlx::query_scalar::<_, Uuid>(
+            r#"
+            SELECT t.user_id
+            FROM account_tokens t
+            JOIN users u ON u.id = t.user_id AND u.deleted_at IS NULL
+            WHERE t.purpose = 'email_change'
+              AND LOWER(t.previous_email) = LOWER($1)
+              AND t.used_at >= $2
+            ORDER BY t.used_at DESC
+            LIMIT 1
+            "#,
+        )
+        .bind(email)
+        .bind(since)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(user_id)
+    }
+}
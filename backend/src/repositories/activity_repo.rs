@@ -0,0 +1,154 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::activity::{ActivityEntry, ActivityKind, ActivityQuery, NewActivity};
+
+pub struct ActivityRepository;
+
+impl ActivityRepository {
+    pub async fn insert(pool: &PgPool, activity: &NewActivity) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO account_activity (
+                user_id, actor_id, kind, client_ip, ip_category, device, details
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            "#,
+        )
+        .bind(activity.user_id)
+        .bind(activity.actor_id)
+        .bind(activity.kind)
+        .bind(&activity.origin.client_ip)
+        .bind(activity.origin.ip_category)
+        .bind(&activity.origin.device)
+        .bind(&activity.details)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// A player's activity, newest first
+    pub async fn list(
+        pool: &PgPool,
+        user_id: Uuid,
+        query: &ActivityQuery,
+    ) -> AppResult<Vec<ActivityEntry>> {
+        let entries = sqlx::query_as::<_, ActivityEntry>(
+            r#"
+            SELECT id, user_id, actor_id, kind, client_ip, ip_category, device, details,
+                   created_at
+            FROM account_activity
+            WHERE user_id = $1
+              AND ($2::activity_kind IS NULL OR kind = $2)
+            ORDER BY created_at DESC, id DESC
+            LIMIT $3 OFFSET $4
+            "#,
+        )
+        .bind(user_id)
+        .bind(query.kind)
+        .bind(query.limit.clamp(1, 200))
+        .bind(query.offset.max(0))
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+
+    /// Whether the two players ever logged in from the same address. VPN
+    /// and Tor exits are shared by strangers, so those logins don't count.
+    pub async fn shares_login_ip(pool: &PgPool, a: Uuid, b: Uuid) -> AppResult<bool> {
+        let shared: (bool,) = sqlx::query_as(
+            r#"
+            SELECT EXISTS (
+                SELECT 1
+                FROM account_activity x
+                JOIN account_activity y ON y.client_ip = x.client_ip
+                WHERE x.user_id = $1 AND x.kind = 'login'
+                  AND y.user_id = $2 AND y.kind = 'login'
+                  AND x.ip_category IS DISTINCT FROM 'vpn'
+                  AND x.ip_category IS DISTINCT FROM 'tor'
+            )
+            "#,
+        )
+        .bind(a)
+        .bind(b)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(shared.0)
+    }
+
+    /// Whether the player ever logged in from `client_ip`
+    pub async fn has_login_from(pool: &PgPool, user_id: Uuid, client_ip: &str) -> AppResult<bool> {
+        let found: (bool,) = sqlx::query_as(
+            r#"
+            SELECT EXISTS (
+                SELECT 1 FROM account_activity
+                WHERE user_id = $1 AND kind = 'login' AND client_ip = $2
+            )
+            "#,
+        )
+        .bind(user_id)
+        .bind(client_ip)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(found.0)
+    }
+
+    /// Activities of one kind on the account since `since`
+    pub async fn count_since(
+        pool: &PgPool,
+        user_id: Uuid,
+        kind: ActivityKind,
+        since: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*) FROM account_activity
+            WHERE user_id = $1 AND kind = $2 AND created_at >= $3
+            "#,
+        )
+        .bind(user_id)
+        .bind(kind)
+        .bind(since)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Accounts created since `since` that logged in from `client_ip`
+    pub async fn count_new_accounts_from(
+        pool: &PgPool,
+        client_ip: &str,
+        since: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(DISTINCT a.user_id)
+            FROM account_activity a
+            JOIN users u ON u.id = a.user_id
+            WHERE a.kind = 'login' AND a.client_ip = $1 AND u.created_at >= $2
+            "#,
+        )
+        .bind(client_ip)
+        .bind(since)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn delete_before(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM account_activity WHERE created_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+}
@@ -1,10 +1,12 @@
+use chrono::{DateTime, NaiveDate, Utc};
 use sqlx::PgPool;
 use uuid::Uuid;
 
 use crate::error::AppResult;
 use crate::models::alliance::{
-    Alliance, AllianceDiplomacy, AllianceInvitation, AllianceListItem, AllianceMember,
-    AllianceMemberResponse, AllianceRole, DiplomacyStatus, InvitationStatus,
+    Alliance, AllianceAward, AllianceDiplomacy, AllianceInvitation, AllianceListItem,
+    AllianceMember, AllianceMemberResponse, AllianceMerge, AllianceRole, AwardCategory,
+    DiplomacyStatus, InvitationStatus, MemberContribution, MergeStatus,
 };
 
 pub struct AllianceRepository;
@@ -106,12 +108,10 @@ impl AllianceRepository {
                 a.id,
                 a.name,
                 a.tag,
-                COUNT(am.id)::INT as member_count,
-                COALESCE(SUM(v.population), 0) as total_population
+                COALESCE(s.member_count, 0) as member_count,
+                COALESCE(s.total_population, 0) as total_population
             FROM alliances a
-            LEFT JOIN alliance_members am ON a.id = am.alliance_id
-            LEFT JOIN villages v ON am.user_id = v.user_id
-            GROUP BY a.id, a.name, a.tag
+            LEFT JOIN alliance_stats s ON s.alliance_id = a.id
             ORDER BY total_population DESC
             LIMIT $1 OFFSET $2
             "#,
@@ -273,7 +273,8 @@ impl AllianceRepository {
             r#"
             INSERT INTO alliance_invitations (alliance_id, inviter_id, invitee_id, message)
             VALUES ($1, $2, $3, $4)
-            RETURNING id, alliance_id, inviter_id, invitee_id, status, message, created_at, expires_at, responded_at
+            RETURNING id, alliance_id, inviter_id, invitee_id, status, message, created_at,
+                      expires_at, responded_at, merge_id
             "#,
         )
         .bind(alliance_id)
@@ -289,7 +290,8 @@ impl AllianceRepository {
     pub async fn get_invitation(pool: &PgPool, id: Uuid) -> AppResult<Option<AllianceInvitation>> {
         let invitation = sqlx::query_as::<_, AllianceInvitation>(
             r#"
-            SELECT id, alliance_id, inviter_id, invitee_id, status, message, created_at, expires_at, responded_at
+            SELECT id, alliance_id, inviter_id, invitee_id, status, message, created_at,
+                   expires_at, responded_at, merge_id
             FROM alliance_invitations
             WHERE id = $1
             "#,
@@ -304,7 +306,8 @@ impl AllianceRepository {
     pub async fn get_pending_invitations_for_user(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<AllianceInvitation>> {
         let invitations = sqlx::query_as::<_, AllianceInvitation>(
             r#"
-            SELECT id, alliance_id, inviter_id, invitee_id, status, message, created_at, expires_at, responded_at
+            SELECT id, alliance_id, inviter_id, invitee_id, status, message, created_at,
+                   expires_at, responded_at, merge_id
             FROM alliance_invitations
             WHERE invitee_id = $1 AND status = 'pending' AND expires_at > NOW()
             ORDER BY created_at DESC
@@ -431,4 +434,442 @@ impl AllianceRepository {
 
         Ok(())
     }
+
+    // ==================== Merges ====================
+
+    pub async fn create_merge(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        merging: &Alliance,
+        proposed_by: Uuid,
+        expires_at: DateTime<Utc>,
+    ) -> AppResult<AllianceMerge> {
+        let merge = sqlx::query_as::<_, AllianceMerge>(
+            r#"
+            INSERT INTO alliance_merges (
+                alliance_id, merging_alliance_id, merging_alliance_tag, proposed_by, expires_at
+            )
+            VALUES ($1, $2, $3, $4, $5)
+            RETURNING id, alliance_id, merging_alliance_id, merging_alliance_tag, proposed_by,
+                      status, created_at, expires_at, responded_at, completed_at
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(merging.id)
+        .bind(&merging.tag)
+        .bind(proposed_by)
+        .bind(expires_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(merge)
+    }
+
+    pub async fn find_merge(pool: &PgPool, id: Uuid) -> AppResult<Option<AllianceMerge>> {
+        let merge = sqlx::query_as::<_, AllianceMerge>(
+            r#"
+            SELECT id, alliance_id, merging_alliance_id, merging_alliance_tag, proposed_by,
+                   status, created_at, expires_at, responded_at, completed_at
+            FROM alliance_merges
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(merge)
+    }
+
+    /// Merges the alliance is on either side of, newest first
+    pub async fn find_merges_for(pool: &PgPool, alliance_id: Uuid) -> AppResult<Vec<AllianceMerge>> {
+        let merges = sqlx::query_as::<_, AllianceMerge>(
+            r#"
+            SELECT id, alliance_id, merging_alliance_id, merging_alliance_tag, proposed_by,
+                   status, created_at, expires_at, responded_at, completed_at
+            FROM alliance_merges
+            WHERE alliance_id = $1 OR merging_alliance_id = $1
+            ORDER BY created_at DESC
+            "#,
+        )
+        .bind(alliance_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(merges)
+    }
+
+    /// Record the merging leader's answer. Returns None if the proposal
+    /// was no longer pending.
+    pub async fn respond_merge(
+        pool: &PgPool,
+        id: Uuid,
+        status: MergeStatus,
+        expires_at: DateTime<Utc>,
+    ) -> AppResult<Option<AllianceMerge>> {
+        let merge = sqlx::query_as::<_, AllianceMerge>(
+            r#"
+            UPDATE alliance_merges
+            SET status = $2, expires_at = $3, responded_at = NOW()
+            WHERE id = $1 AND status = 'pending'
+            RETURNING id, alliance_id, merging_alliance_id, merging_alliance_tag, proposed_by,
+                      status, created_at, expires_at, responded_at, completed_at
+            "#,
+        )
+        .bind(id)
+        .bind(status)
+        .bind(expires_at)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(merge)
+    }
+
+    /// Cancel or complete an open merge. Returns false if it was already closed.
+    pub async fn close_merge(pool: &PgPool, id: Uuid, status: MergeStatus) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE alliance_merges
+            SET status = $2,
+                completed_at = CASE WHEN $2 = 'completed'::alliance_merge_status
+                                    THEN NOW() END
+            WHERE id = $1 AND status IN ('pending', 'accepted')
+            "#,
+        )
+        .bind(id)
+        .bind(status)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn create_merge_invitation(
+        pool: &PgPool,
+        merge: &AllianceMerge,
+        inviter_id: Uuid,
+        invitee_id: Uuid,
+    ) -> AppResult<AllianceInvitation> {
+        let invitation = sqlx::query_as::<_, AllianceInvitation>(
+            r#"
+            INSERT INTO alliance_invitations (
+                alliance_id, inviter_id, invitee_id, message, expires_at, merge_id
+            )
+            VALUES ($1, $2, $3, $4, $5, $6)
+            RETURNING id, alliance_id, inviter_id, invitee_id, status, message, created_at,
+                      expires_at, responded_at, merge_id
+            "#,
+        )
+        .bind(merge.alliance_id)
+        .bind(inviter_id)
+        .bind(invitee_id)
+        .bind(format!("[{}] is merging into this alliance", merge.merging_alliance_tag))
+        .bind(merge.expires_at)
+        .bind(merge.id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(invitation)
+    }
+
+    /// Withdraw the merge invitations nobody answered
+    pub async fn expire_merge_invitations(pool: &PgPool, merge_id: Uuid) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE alliance_invitations
+            SET status = 'expired', responded_at = NOW()
+            WHERE merge_id = $1 AND status = 'pending'
+            "#,
+        )
+        .bind(merge_id)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Members in order of seniority: leader, officers, then by join date
+    pub async fn find_members(pool: &PgPool, alliance_id: Uuid) -> AppResult<Vec<AllianceMember>> {
+        let members = sqlx::query_as::<_, AllianceMember>(
+            r#"
+            SELECT id, alliance_id, user_id, role, joined_at
+            FROM alliance_members
+            WHERE alliance_id = $1
+            ORDER BY role, joined_at
+            "#,
+        )
+        .bind(alliance_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(members)
+    }
+
+    /// Move a member from one alliance to another, taking their weekly
+    /// contributions along
+    pub async fn move_member(
+        pool: &PgPool,
+        from_alliance_id: Uuid,
+        to_alliance_id: Uuid,
+        user_id: Uuid,
+        role: AllianceRole,
+    ) -> AppResult<()> {
+        let mut tx = pool.begin().await?;
+
+        sqlx::query("DELETE FROM alliance_members WHERE alliance_id = $1 AND user_id = $2")
+            .bind(from_alliance_id)
+            .bind(user_id)
+            .execute(&mut *tx)
+            .await?;
+
+        sqlx::query(
+            "INSERT INTO alliance_members (alliance_id, user_id, role) VALUES ($1, $2, $3)",
+        )
+        .bind(to_alliance_id)
+        .bind(user_id)
+        .bind(role)
+        .execute(&mut *tx)
+        .await?;
+
+        sqlx::query(
+            r#"
+            WITH moved AS (
+                DELETE FROM alliance_contributions
+                WHERE alliance_id = $1 AND user_id = $3
+                RETURNING user_id, week_start, defense_points, resources_donated,
+                          war_attacks, war_points
+            )
+            INSERT INTO alliance_contributions (
+                alliance_id, user_id, week_start, defense_points, resources_donated,
+                war_attacks, war_points
+            )
+            SELECT $2, user_id, week_start, defense_points, resources_donated,
+                   war_attacks, war_points
+            FROM moved
+            ON CONFLICT (alliance_id, week_start, user_id) DO UPDATE
+            SET defense_points = alliance_contributions.defense_points + EXCLUDED.defense_points,
+                resources_donated =
+                    alliance_contributions.resources_donated + EXCLUDED.resources_donated,
+                war_attacks = alliance_contributions.war_attacks + EXCLUDED.war_attacks,
+                war_points = alliance_contributions.war_points + EXCLUDED.war_points,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(from_alliance_id)
+        .bind(to_alliance_id)
+        .bind(user_id)
+        .execute(&mut *tx)
+        .await?;
+
+        tx.commit().await?;
+        Ok(())
+    }
+
+    /// Fold an emptied alliance into the one it merged with, then delete
+    /// it. Its diplomacy carries over wherever the surviving alliance has
+    /// no stance of its own, its message board and past awards move
+    /// across, and relations others had with it now point at the
+    /// surviving alliance.
+    pub async fn absorb(pool: &PgPool, alliance_id: Uuid, merged_id: Uuid) -> AppResult<()> {
+        let mut tx = pool.begin().await?;
+
+        sqlx::query(
+            r#"
+            INSERT INTO alliance_diplomacy (alliance_id, target_alliance_id, status, proposed_by)
+            SELECT $1, target_alliance_id, status, proposed_by
+            FROM alliance_diplomacy
+            WHERE alliance_id = $2 AND target_alliance_id <> $1
+            ON CONFLICT (alliance_id, target_alliance_id) DO NOTHING
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(merged_id)
+        .execute(&mut *tx)
+        .await?;
+
+        sqlx::query(
+            r#"
+            INSERT INTO alliance_diplomacy (alliance_id, target_alliance_id, status, proposed_by)
+            SELECT alliance_id, $1, status, proposed_by
+            FROM alliance_diplomacy
+            WHERE target_alliance_id = $2 AND alliance_id <> $1
+            ON CONFLICT (alliance_id, target_alliance_id) DO NOTHING
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(merged_id)
+        .execute(&mut *tx)
+        .await?;
+
+        sqlx::query("UPDATE messages SET alliance_id = $1 WHERE alliance_id = $2")
+            .bind(alliance_id)
+            .bind(merged_id)
+            .execute(&mut *tx)
+            .await?;
+
+        sqlx::query(
+            r#"
+            UPDATE alliance_awards a
+            SET alliance_id = $1
+            WHERE a.alliance_id = $2
+              AND NOT EXISTS (
+                  SELECT 1 FROM alliance_awards b
+                  WHERE b.alliance_id = $1
+                    AND b.week_start = a.week_start
+                    AND b.category = a.category
+              )
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(merged_id)
+        .execute(&mut *tx)
+        .await?;
+
+        sqlx::query("DELETE FROM alliances WHERE id = $1")
+            .bind(merged_id)
+            .execute(&mut *tx)
+            .await?;
+
+        tx.commit().await?;
+        Ok(())
+    }
+
+    // ==================== Contributions ====================
+
+    /// Add to a member's tally for the week
+    pub async fn add_contribution(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        user_id: Uuid,
+        week_start: NaiveDate,
+        defense_points: i64,
+        resources_donated: i64,
+        war_attacks: i32,
+        war_points: i64,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO alliance_contributions (
+                alliance_id, user_id, week_start, defense_points, resources_donated,
+                war_attacks, war_points
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            ON CONFLICT (alliance_id, week_start, user_id) DO UPDATE
+            SET defense_points = alliance_contributions.defense_points + EXCLUDED.defense_points,
+                resources_donated =
+                    alliance_contributions.resources_donated + EXCLUDED.resources_donated,
+                war_attacks = alliance_contributions.war_attacks + EXCLUDED.war_attacks,
+                war_points = alliance_contributions.war_points + EXCLUDED.war_points,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(user_id)
+        .bind(week_start)
+        .bind(defense_points)
+        .bind(resources_donated)
+        .bind(war_attacks)
+        .bind(war_points)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn find_contributions(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        week_start: NaiveDate,
+    ) -> AppResult<Vec<MemberContribution>> {
+        let contributions = sqlx::query_as::<_, MemberContribution>(
+            r#"
+            SELECT c.user_id, u.display_name as player_name, c.defense_points,
+                   c.resources_donated, c.war_attacks, c.war_points
+            FROM alliance_contributions c
+            JOIN users u ON c.user_id = u.id
+            WHERE c.alliance_id = $1 AND c.week_start = $2
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(week_start)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(contributions)
+    }
+
+    /// Finished weeks with contributions but no awards yet
+    pub async fn find_unawarded_weeks(
+        pool: &PgPool,
+        before: NaiveDate,
+    ) -> AppResult<Vec<(Uuid, NaiveDate)>> {
+        let weeks = sqlx::query_as::<_, (Uuid, NaiveDate)>(
+            r#"
+            SELECT DISTINCT c.alliance_id, c.week_start
+            FROM alliance_contributions c
+            WHERE c.week_start < $1
+              AND NOT EXISTS (
+                  SELECT 1 FROM alliance_awards a
+                  WHERE a.alliance_id = c.alliance_id AND a.week_start = c.week_start
+              )
+            ORDER BY c.week_start
+            "#,
+        )
+        .bind(before)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(weeks)
+    }
+
+    /// Returns false if the award was already given
+    pub async fn create_award(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        week_start: NaiveDate,
+        category: AwardCategory,
+        user_id: Uuid,
+        score: i64,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO alliance_awards (alliance_id, week_start, category, user_id, score)
+            VALUES ($1, $2, $3, $4, $5)
+            ON CONFLICT (alliance_id, week_start, category) DO NOTHING
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(week_start)
+        .bind(category)
+        .bind(user_id)
+        .bind(score)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Awards for one week, or every week newest first
+    pub async fn find_awards(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        week_start: Option<NaiveDate>,
+    ) -> AppResult<Vec<AllianceAward>> {
+        let awards = sqlx::query_as::<_, AllianceAward>(
+            r#"
+            SELECT a.id, a.alliance_id, a.week_start, a.category, a.user_id,
+                   u.display_name as player_name, a.score, a.created_at
+            FROM alliance_awards a
+            JOIN users u ON a.user_id = u.id
+            WHERE a.alliance_id = $1 AND ($2::DATE IS NULL OR a.week_start = $2)
+            ORDER BY a.week_start DESC, a.category
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(week_start)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(awards)
+    }
 }
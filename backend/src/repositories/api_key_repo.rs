@@ -0,0 +1,85 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::api_key::ApiKey;
+
+pub struct ApiKeyRepository;
+
+impl ApiKeyRepository {
+    pub async fn create(
+        pool: &PgPool,
+        name: &str,
+        key_hash: &str,
+        key_prefix: &str,
+        created_by: Uuid,
+    ) -> AppResult<ApiKey> {
+        let key = sqlx::query_as::<_, ApiKey>(
+            r#"
+            INSERT INTO api_keys (name, key_hash, key_prefix, created_by)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id, name, key_prefix, created_by, created_at, last_used_at, revoked_at
+            "#,
+        )
+        .bind(name)
+        .bind(key_hash)
+        .bind(key_prefix)
+        .bind(created_by)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(key)
+    }
+
+    /// The key with this hash, unless it was revoked
+    pub async fn find_active_by_hash(pool: &PgPool, key_hash: &str) -> AppResult<Option<ApiKey>> {
+        let key = sqlx::query_as::<_, ApiKey>(
+            r#"
+            SELECT id, name, key_prefix, created_by, created_at, last_used_at, revoked_at
+            FROM api_keys
+            WHERE key_hash = $1 AND revoked_at IS NULL
+            "#,
+        )
+        .bind(key_hash)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(key)
+    }
+
+    pub async fn list(pool: &PgPool) -> AppResult<Vec<ApiKey>> {
+        let keys = sqlx::query_as::<_, ApiKey>(
+            r#"
+            SELECT id, name, key_prefix, created_by, created_at, last_used_at, revoked_at
+            FROM api_keys
+            ORDER BY created_at DESC
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(keys)
+    }
+
+    pub async fn touch(pool: &PgPool, id: Uuid, now: DateTime<Utc>) -> AppResult<()> {
+        sqlx::query("UPDATE api_keys SET last_used_at = $2 WHERE id = $1")
+            .bind(id)
+            .bind(now)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    pub async fn revoke(pool: &PgPool, id: Uuid, now: DateTime<Utc>) -> AppResult<bool> {
+        let result =
+            sqlx::query("UPDATE api_keys SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL")
+                .bind(id)
+                .bind(now)
+                .execute(pool)
+                .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+}
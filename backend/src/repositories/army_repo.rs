@@ -1,5 +1,5 @@
 use chrono::{DateTime, Utc};
-use sqlx::PgPool;
+use sqlx::{PgConnection, PgPool};
 use uuid::Uuid;
 
 use crate::error::AppResult;
@@ -15,7 +15,8 @@ impl ArmyRepository {
             r#"
             SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
                    mission, troops, resources, departed_at, arrives_at,
-                   returns_at, is_returning, is_stationed, battle_report_id, created_at
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
             FROM armies
             WHERE id = $1
             "#,
@@ -27,12 +28,31 @@ impl ArmyRepository {
         Ok(army)
     }
 
+    pub async fn find_by_ids(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<Army>> {
+        let armies = sqlx::query_as::<_, Army>(
+            r#"
+            SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
+                   mission, troops, resources, departed_at, arrives_at,
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
+            FROM armies
+            WHERE id = ANY($1)
+            "#,
+        )
+        .bind(ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(armies)
+    }
+
     pub async fn find_by_player(pool: &PgPool, player_id: Uuid) -> AppResult<Vec<Army>> {
         let armies = sqlx::query_as::<_, Army>(
             r#"
             SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
                    mission, troops, resources, departed_at, arrives_at,
-                   returns_at, is_returning, is_stationed, battle_report_id, created_at
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
             FROM armies
             WHERE player_id = $1
             ORDER BY arrives_at ASC
@@ -50,7 +70,8 @@ impl ArmyRepository {
             r#"
             SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
                    mission, troops, resources, departed_at, arrives_at,
-                   returns_at, is_returning, is_stationed, battle_report_id, created_at
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
             FROM armies
             WHERE from_village_id = $1 AND is_stationed = FALSE
             ORDER BY arrives_at ASC
@@ -68,7 +89,8 @@ impl ArmyRepository {
             r#"
             SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
                    mission, troops, resources, departed_at, arrives_at,
-                   returns_at, is_returning, is_stationed, battle_report_id, created_at
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
             FROM armies
             WHERE to_village_id = $1 AND is_returning = FALSE AND is_stationed = FALSE
             ORDER BY arrives_at ASC
@@ -81,6 +103,50 @@ impl ArmyRepository {
         Ok(armies)
     }
 
+    /// Other players' armies on their way to any of the player's villages
+    pub async fn find_incoming_to_player(pool: &PgPool, player_id: Uuid) -> AppResult<Vec<Army>> {
+        let armies = sqlx::query_as::<_, Army>(
+            r#"
+            SELECT a.id, a.player_id, a.from_village_id, a.to_x, a.to_y, a.to_village_id,
+                   a.mission, a.troops, a.resources, a.departed_at, a.arrives_at,
+                   a.returns_at, a.is_returning, a.is_stationed, a.battle_report_id, a.created_at,
+                   a.hero_id
+            FROM armies a
+            JOIN villages v ON v.id = a.to_village_id
+            WHERE v.user_id = $1
+                AND a.player_id <> $1
+                AND a.is_returning = FALSE
+                AND a.is_stationed = FALSE
+            ORDER BY a.arrives_at ASC
+            "#,
+        )
+        .bind(player_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(armies)
+    }
+
+    /// Every army sent from or to a village, stationed ones included
+    pub async fn find_involving_village(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<Army>> {
+        let armies = sqlx::query_as::<_, Army>(
+            r#"
+            SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
+                   mission, troops, resources, departed_at, arrives_at,
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
+            FROM armies
+            WHERE from_village_id = $1 OR to_village_id = $1
+            ORDER BY arrives_at ASC
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(armies)
+    }
+
     pub async fn create(
         pool: &PgPool,
         player_id: Uuid,
@@ -94,15 +160,18 @@ impl ArmyRepository {
         departed_at: DateTime<Utc>,
         arrives_at: DateTime<Utc>,
         returns_at: Option<DateTime<Utc>>,
+        hero_id: Option<Uuid>,
     ) -> AppResult<Army> {
         let army = sqlx::query_as::<_, Army>(
             r#"
             INSERT INTO armies (player_id, from_village_id, to_x, to_y, to_village_id,
-                               mission, troops, resources, departed_at, arrives_at, returns_at)
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+                               mission, troops, resources, departed_at, arrives_at, returns_at,
+                               hero_id)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
             RETURNING id, player_id, from_village_id, to_x, to_y, to_village_id,
                       mission, troops, resources, departed_at, arrives_at,
-                      returns_at, is_returning, is_stationed, battle_report_id, created_at
+                      returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                      hero_id
             "#,
         )
         .bind(player_id)
@@ -116,6 +185,7 @@ impl ArmyRepository {
         .bind(departed_at)
         .bind(arrives_at)
         .bind(returns_at)
+        .bind(hero_id)
         .fetch_one(pool)
         .await?;
 
@@ -141,7 +211,8 @@ impl ArmyRepository {
             WHERE id = $1
             RETURNING id, player_id, from_village_id, to_x, to_y, to_village_id,
                       mission, troops, resources, departed_at, arrives_at,
-                      returns_at, is_returning, is_stationed, battle_report_id, created_at
+                      returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                      hero_id
             "#,
         )
         .bind(id)
@@ -164,16 +235,43 @@ impl ArmyRepository {
         Ok(())
     }
 
-    pub async fn find_arrived(pool: &PgPool) -> AppResult<Vec<Army>> {
+    /// Hold `target` until the transaction ends, so movements landing at
+    /// the same place resolve one at a time across workers.
+    ///
+    /// The lock itself only serializes; it grants no order. Arrivals keep
+    /// their resolution order across workers because each worker walks the
+    /// same `find_arrived` list and blocks here on the earliest movement
+    /// still unresolved, so none can reach a later one first. The exception
+    /// is an arrival whose resolution fails: it is retried after a backoff,
+    /// by which time later arrivals at the same place have gone through.
+    pub async fn lock_target(conn: &mut PgConnection, target: &str) -> AppResult<()> {
+        sqlx::query("SELECT pg_advisory_xact_lock(hashtext('army_target:' || $1))")
+            .bind(target)
+            .execute(conn)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Armies due to land, in resolution order (see `Army::resolution_order`)
+    pub async fn find_arrived(pool: &PgPool, now: DateTime<Utc>) -> AppResult<Vec<Army>> {
         let armies = sqlx::query_as::<_, Army>(
             r#"
             SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
                    mission, troops, resources, departed_at, arrives_at,
-                   returns_at, is_returning, is_stationed, battle_report_id, created_at
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
             FROM armies
-            WHERE arrives_at <= NOW() AND is_stationed = FALSE
+            WHERE arrives_at <= $1 AND is_stationed = FALSE
+              AND NOT EXISTS (
+                  SELECT 1 FROM job_failures f
+                  WHERE f.job = 'army_arrival' AND f.item_id = armies.id
+                    AND (f.quarantined_at IS NOT NULL OR f.retry_at > $1)
+              )
+            ORDER BY arrives_at ASC, departed_at ASC, id ASC
             "#,
         )
+        .bind(now)
         .fetch_all(pool)
         .await?;
 
@@ -191,7 +289,8 @@ impl ArmyRepository {
             WHERE id = $1
             RETURNING id, player_id, from_village_id, to_x, to_y, to_village_id,
                       mission, troops, resources, departed_at, arrives_at,
-                      returns_at, is_returning, is_stationed, battle_report_id, created_at
+                      returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                      hero_id
             "#,
         )
         .bind(id)
@@ -207,7 +306,8 @@ impl ArmyRepository {
             r#"
             SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
                    mission, troops, resources, departed_at, arrives_at,
-                   returns_at, is_returning, is_stationed, battle_report_id, created_at
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
             FROM armies
             WHERE to_village_id = $1 AND is_stationed = TRUE
             ORDER BY arrives_at ASC
@@ -226,7 +326,8 @@ impl ArmyRepository {
             r#"
             SELECT id, player_id, from_village_id, to_x, to_y, to_village_id,
                    mission, troops, resources, departed_at, arrives_at,
-                   returns_at, is_returning, is_stationed, battle_report_id, created_at
+                   returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                   hero_id
             FROM armies
             WHERE player_id = $1 AND is_stationed = TRUE
             ORDER BY arrives_at ASC
@@ -254,7 +355,8 @@ impl ArmyRepository {
             WHERE id = $1
             RETURNING id, player_id, from_village_id, to_x, to_y, to_village_id,
                       mission, troops, resources, departed_at, arrives_at,
-                      returns_at, is_returning, is_stationed, battle_report_id, created_at
+                      returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                      hero_id
             "#,
         )
         .bind(id)
@@ -265,6 +367,36 @@ impl ArmyRepository {
         Ok(army)
     }
 
+    /// Turn an army around on its way out, unless it has arrived or turned
+    /// back meanwhile. None if it could not be cancelled.
+    pub async fn cancel_outgoing(
+        pool: &PgPool,
+        id: Uuid,
+        returns_at: DateTime<Utc>,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<Army>> {
+        let army = sqlx::query_as::<_, Army>(
+            r#"
+            UPDATE armies
+            SET is_returning = TRUE,
+                arrives_at = $2
+            WHERE id = $1 AND is_returning = FALSE AND is_stationed = FALSE
+                  AND arrives_at > $3
+            RETURNING id, player_id, from_village_id, to_x, to_y, to_village_id,
+                      mission, troops, resources, departed_at, arrives_at,
+                      returns_at, is_returning, is_stationed, battle_report_id, created_at,
+                      hero_id
+            "#,
+        )
+        .bind(id)
+        .bind(returns_at)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(army)
+    }
+
     /// Update stationed troops after battle (reduce troops)
     pub async fn update_stationed_troops(
         pool: &PgPool,
@@ -306,6 +438,7 @@ impl ArmyRepository {
         defender_troops: &ArmyTroops,
         attacker_losses: &ArmyTroops,
         defender_losses: &ArmyTroops,
+        defender_wounded: &ArmyTroops,
         resources_stolen: &CarriedResources,
         winner: &str,
         occurred_at: DateTime<Utc>,
@@ -315,12 +448,14 @@ impl ArmyRepository {
             INSERT INTO battle_reports (
                 attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
                 mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
-                resources_stolen, winner, occurred_at
+                defender_wounded, resources_stolen, winner, occurred_at
             )
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
             RETURNING id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
                       mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
-                      resources_stolen, winner, occurred_at, read_by_attacker, read_by_defender, created_at
+                      defender_wounded, resources_stolen, winner, occurred_at,
+                      read_by_attacker, read_by_defender, deleted_by_attacker, deleted_by_defender,
+                      created_at
             "#,
         )
         .bind(attacker_player_id)
@@ -332,6 +467,7 @@ impl ArmyRepository {
         .bind(sqlx::types::Json(defender_troops))
         .bind(sqlx::types::Json(attacker_losses))
         .bind(sqlx::types::Json(defender_losses))
+        .bind(sqlx::types::Json(defender_wounded))
         .bind(sqlx::types::Json(resources_stolen))
         .bind(winner)
         .bind(occurred_at)
@@ -346,9 +482,12 @@ impl ArmyRepository {
             r#"
             SELECT id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
                    mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
-                   resources_stolen, winner, occurred_at, read_by_attacker, read_by_defender, created_at
+                   defender_wounded, resources_stolen, winner, occurred_at,
+                   read_by_attacker, read_by_defender, deleted_by_attacker, deleted_by_defender,
+                   created_at
             FROM battle_reports
-            WHERE attacker_player_id = $1 OR defender_player_id = $1
+            WHERE (attacker_player_id = $1 AND deleted_by_attacker = FALSE)
+               OR (defender_player_id = $1 AND deleted_by_defender = FALSE)
             ORDER BY occurred_at DESC
             LIMIT 100
             "#,
@@ -365,9 +504,11 @@ impl ArmyRepository {
             r#"
             SELECT id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
                    mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
-                   resources_stolen, winner, occurred_at, read_by_attacker, read_by_defender, created_at
+                   defender_wounded, resources_stolen, winner, occurred_at,
+                   read_by_attacker, read_by_defender, deleted_by_attacker, deleted_by_defender,
+                   created_at
             FROM battle_reports
-            WHERE id = $1
+            WHERE id = $1 AND deleted_at IS NULL
             "#,
         )
         .bind(id)
@@ -389,13 +530,26 @@ impl ArmyRepository {
         Ok(())
     }
 
+    /// Hide a report from one side; it counts as deleted once no side
+    /// still sees it
+    pub async fn delete_report_for_player(
+        pool: &PgPool,
+        id: Uuid,
+        is_attacker: bool,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        soft_delete_report(pool, "battle_reports", id, is_attacker, now).await
+    }
+
     pub async fn count_unread_reports(pool: &PgPool, player_id: Uuid) -> AppResult<i64> {
         let count: (i64,) = sqlx::query_as(
             r#"
             SELECT COUNT(*)
             FROM battle_reports
-            WHERE (attacker_player_id = $1 AND read_by_attacker = FALSE)
-               OR (defender_player_id = $1 AND read_by_defender = FALSE)
+            WHERE (attacker_player_id = $1 AND read_by_attacker = FALSE
+                   AND deleted_by_attacker = FALSE)
+               OR (defender_player_id = $1 AND read_by_defender = FALSE
+                   AND deleted_by_defender = FALSE)
             "#,
         )
         .bind(player_id)
@@ -433,7 +587,8 @@ impl ArmyRepository {
             RETURNING id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
                       attacker_scouts, defender_scouts, attacker_scouts_lost, defender_scouts_lost,
                       success, scouted_resources, scouted_troops, occurred_at,
-                      read_by_attacker, read_by_defender, created_at
+                      read_by_attacker, read_by_defender, deleted_by_attacker, deleted_by_defender,
+                      created_at
             "#,
         )
         .bind(attacker_player_id)
@@ -460,9 +615,11 @@ impl ArmyRepository {
             SELECT id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
                    attacker_scouts, defender_scouts, attacker_scouts_lost, defender_scouts_lost,
                    success, scouted_resources, scouted_troops, occurred_at,
-                   read_by_attacker, read_by_defender, created_at
+                   read_by_attacker, read_by_defender, deleted_by_attacker, deleted_by_defender,
+                   created_at
             FROM scout_reports
-            WHERE attacker_player_id = $1 OR defender_player_id = $1
+            WHERE (attacker_player_id = $1 AND deleted_by_attacker = FALSE)
+               OR (defender_player_id = $1 AND deleted_by_defender = FALSE)
             ORDER BY occurred_at DESC
             LIMIT 100
             "#,
@@ -480,9 +637,10 @@ impl ArmyRepository {
             SELECT id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
                    attacker_scouts, defender_scouts, attacker_scouts_lost, defender_scouts_lost,
                    success, scouted_resources, scouted_troops, occurred_at,
-                   read_by_attacker, read_by_defender, created_at
+                   read_by_attacker, read_by_defender, deleted_by_attacker, deleted_by_defender,
+                   created_at
             FROM scout_reports
-            WHERE id = $1
+            WHERE id = $1 AND deleted_at IS NULL
             "#,
         )
         .bind(id)
@@ -504,13 +662,24 @@ impl ArmyRepository {
         Ok(())
     }
 
+    pub async fn delete_scout_report_for_player(
+        pool: &PgPool,
+        id: Uuid,
+        is_attacker: bool,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        soft_delete_report(pool, "scout_reports", id, is_attacker, now).await
+    }
+
     pub async fn count_unread_scout_reports(pool: &PgPool, player_id: Uuid) -> AppResult<i64> {
         let count: (i64,) = sqlx::query_as(
             r#"
             SELECT COUNT(*)
             FROM scout_reports
-            WHERE (attacker_player_id = $1 AND read_by_attacker = FALSE)
-               OR (defender_player_id = $1 AND read_by_defender = FALSE)
+            WHERE (attacker_player_id = $1 AND read_by_attacker = FALSE
+                   AND deleted_by_attacker = FALSE)
+               OR (defender_player_id = $1 AND read_by_defender = FALSE
+                   AND deleted_by_defender = FALSE)
             "#,
         )
         .bind(player_id)
@@ -520,3 +689,37 @@ impl ArmyRepository {
         Ok(count.0)
     }
 }
+
+/// Shared by battle and scout reports, which use the same delete columns.
+/// A report without a defending player is deleted once the attacker is done.
+async fn soft_delete_report(
+    pool: &PgPool,
+    table: &str,
+    id: Uuid,
+    is_attacker: bool,
+    now: DateTime<Utc>,
+) -> AppResult<()> {
+    // The side's flag after the update, so both are checked as they will be
+    let (attacker, defender) = if is_attacker {
+        ("TRUE", "deleted_by_defender")
+    } else {
+        ("deleted_by_attacker", "TRUE")
+    };
+    let query = format!(
+        r#"
+        UPDATE {table}
+        SET deleted_by_attacker = {attacker},
+            deleted_by_defender = {defender},
+            deleted_at = CASE
+                WHEN {attacker} AND ({defender} OR defender_player_id IS NULL)
+                THEN COALESCE(deleted_at, $2)
+                ELSE deleted_at
+            END
+        WHERE id = $1
+        "#
+    );
+
+    sqlx::query(&query).bind(id).bind(now).execute(pool).await?;
+
+    Ok(())
+}
@@ -0,0 +1,111 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::attack_warning::{AttackWarningRecipient, IncomingAttack};
+
+pub struct AttackWarningRepository;
+
+impl AttackWarningRepository {
+    /// Opted-in players offline since `offline_since` whose quiet period has
+    /// passed and who have attacks to be warned about
+    pub async fn recipients(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+        offline_since: DateTime<Utc>,
+    ) -> AppResult<Vec<AttackWarningRecipient>> {
+        let recipients = sqlx::query_as::<_, AttackWarningRecipient>(
+            r#"
+            SELECT u.id AS user_id, u.email, u.display_name, p.locale
+            FROM email_preferences p
+            JOIN users u ON u.id = p.user_id
+            WHERE p.attack_warning AND u.email IS NOT NULL AND u.deleted_at IS NULL
+              AND (p.attack_warned_at IS NULL
+                   OR p.attack_warned_at + make_interval(mins => p.attack_quiet_minutes) <= $1)
+              AND NOT EXISTS (
+                  SELECT 1 FROM user_sessions s
+                  WHERE s.user_id = u.id AND s.revoked_at IS NULL AND s.last_seen_at > $2
+              )
+              AND EXISTS (
+                  SELECT 1
+                  FROM armies a
+                  JOIN villages v ON v.id = a.to_village_id
+                  WHERE v.user_id = u.id AND a.player_id <> u.id
+                    AND a.mission IN ('raid', 'attack', 'conquer', 'scout')
+                    AND NOT a.is_returning AND a.arrives_at > $1
+                    AND NOT EXISTS (SELECT 1 FROM attack_warnings w WHERE w.army_id = a.id)
+              )
+            "#,
+        )
+        .bind(now)
+        .bind(offline_since)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(recipients)
+    }
+
+    /// Attacks the player hasn't been warned about, soonest first
+    pub async fn unwarned_attacks(
+        pool: &PgPool,
+        user_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<IncomingAttack>> {
+        let attacks = sqlx::query_as::<_, IncomingAttack>(
+            r#"
+            SELECT a.id AS army_id, a.mission, a.arrives_at, au.display_name AS attacker_name,
+                   fv.x AS from_x, fv.y AS from_y, v.name AS village_name,
+                   v.x AS village_x, v.y AS village_y
+            FROM armies a
+            JOIN villages v ON v.id = a.to_village_id
+            JOIN villages fv ON fv.id = a.from_village_id
+            LEFT JOIN users au ON au.id = a.player_id
+            WHERE v.user_id = $2 AND a.player_id <> $2
+              AND a.mission IN ('raid', 'attack', 'conquer', 'scout')
+              AND NOT a.is_returning AND a.arrives_at > $1
+              AND NOT EXISTS (SELECT 1 FROM attack_warnings w WHERE w.army_id = a.id)
+            ORDER BY a.arrives_at ASC
+            "#,
+        )
+        .bind(now)
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(attacks)
+    }
+
+    /// Record that a warning covering these armies went out
+    pub async fn mark_warned(
+        pool: &PgPool,
+        user_id: Uuid,
+        army_ids: &[Uuid],
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        let mut tx = pool.begin().await?;
+
+        sqlx::query(
+            r#"
+            INSERT INTO attack_warnings (army_id, user_id, warned_at)
+            SELECT army_id, $2, $3 FROM UNNEST($1::UUID[]) AS army_id
+            ON CONFLICT (army_id) DO NOTHING
+            "#,
+        )
+        .bind(army_ids)
+        .bind(user_id)
+        .bind(now)
+        .execute(&mut *tx)
+        .await?;
+
+        sqlx::query("UPDATE email_preferences SET attack_warned_at = $2 WHERE user_id = $1")
+            .bind(user_id)
+            .bind(now)
+            .execute(&mut *tx)
+            .await?;
+
+        tx.commit().await?;
+
+        Ok(())
+    }
+}
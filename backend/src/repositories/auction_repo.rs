@@ -0,0 +1,247 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::auction::{AuctionCurrency, AuctionQuery, AuctionStatus, HeroAuction};
+
+pub struct AuctionRepository;
+
+impl AuctionRepository {
+    #[allow(clippy::too_many_arguments)]
+    pub async fn create(
+        pool: &PgPool,
+        seller_id: Uuid,
+        seller_hero_id: Uuid,
+        item_definition_id: Uuid,
+        quantity: i32,
+        currency: AuctionCurrency,
+        starting_bid: i32,
+        ends_at: DateTime<Utc>,
+    ) -> AppResult<HeroAuction> {
+        let auction = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            INSERT INTO hero_auctions (
+                seller_id, seller_hero_id, item_definition_id, quantity,
+                currency, starting_bid, ends_at
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            RETURNING id, seller_id, seller_hero_id, item_definition_id, quantity, currency,
+                      starting_bid, current_bid, bidder_id, bidder_hero_id, bid_count,
+                      ends_at, status, closed_at, created_at, version
+            "#,
+        )
+        .bind(seller_id)
+        .bind(seller_hero_id)
+        .bind(item_definition_id)
+        .bind(quantity)
+        .bind(currency)
+        .bind(starting_bid)
+        .bind(ends_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(auction)
+    }
+
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<HeroAuction>> {
+        let auction = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            SELECT id, seller_id, seller_hero_id, item_definition_id, quantity, currency,
+                   starting_bid, current_bid, bidder_id, bidder_hero_id, bid_count,
+                   ends_at, status, closed_at, created_at, version
+            FROM hero_auctions
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(auction)
+    }
+
+    /// Open auctions, ending soonest first
+    pub async fn list_open(
+        pool: &PgPool,
+        query: &AuctionQuery,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<HeroAuction>> {
+        let auctions = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            SELECT a.id, a.seller_id, a.seller_hero_id, a.item_definition_id, a.quantity,
+                   a.currency, a.starting_bid, a.current_bid, a.bidder_id, a.bidder_hero_id,
+                   a.bid_count, a.ends_at, a.status, a.closed_at, a.created_at, a.version
+            FROM hero_auctions a
+            JOIN item_definitions d ON d.id = a.item_definition_id
+            WHERE a.status = 'open' AND a.ends_at > $1
+              AND ($2::item_slot IS NULL OR d.slot = $2)
+              AND ($3::item_rarity IS NULL OR d.rarity = $3)
+              AND ($4::auction_currency IS NULL OR a.currency = $4)
+            ORDER BY a.ends_at ASC
+            LIMIT $5
+            "#,
+        )
+        .bind(now)
+        .bind(query.slot)
+        .bind(query.rarity)
+        .bind(query.currency)
+        .bind(query.limit.clamp(1, 100))
+        .fetch_all(pool)
+        .await?;
+
+        Ok(auctions)
+    }
+
+    pub async fn find_by_seller(
+        pool: &PgPool,
+        seller_id: Uuid,
+        limit: i64,
+    ) -> AppResult<Vec<HeroAuction>> {
+        let auctions = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            SELECT id, seller_id, seller_hero_id, item_definition_id, quantity, currency,
+                   starting_bid, current_bid, bidder_id, bidder_hero_id, bid_count,
+                   ends_at, status, closed_at, created_at, version
+            FROM hero_auctions
+            WHERE seller_id = $1
+            ORDER BY created_at DESC
+            LIMIT $2
+            "#,
+        )
+        .bind(seller_id)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(auctions)
+    }
+
+    /// Open auctions the player holds the leading bid on
+    pub async fn find_leading(pool: &PgPool, bidder_id: Uuid) -> AppResult<Vec<HeroAuction>> {
+        let auctions = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            SELECT id, seller_id, seller_hero_id, item_definition_id, quantity, currency,
+                   starting_bid, current_bid, bidder_id, bidder_hero_id, bid_count,
+                   ends_at, status, closed_at, created_at, version
+            FROM hero_auctions
+            WHERE bidder_id = $1 AND status = 'open'
+            ORDER BY ends_at ASC
+            "#,
+        )
+        .bind(bidder_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(auctions)
+    }
+
+    /// Make a bid the leading one, unless the auction changed since it was
+    /// read. None if another bid or the close got there first.
+    pub async fn place_bid(
+        pool: &PgPool,
+        id: Uuid,
+        expected_version: i32,
+        bidder_id: Uuid,
+        bidder_hero_id: Uuid,
+        amount: i32,
+        ends_at: DateTime<Utc>,
+    ) -> AppResult<Option<HeroAuction>> {
+        let auction = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            UPDATE hero_auctions
+            SET current_bid = $5, bidder_id = $3, bidder_hero_id = $4,
+                bid_count = bid_count + 1, ends_at = $6, version = version + 1
+            WHERE id = $1 AND version = $2 AND status = 'open'
+            RETURNING id, seller_id, seller_hero_id, item_definition_id, quantity, currency,
+                      starting_bid, current_bid, bidder_id, bidder_hero_id, bid_count,
+                      ends_at, status, closed_at, created_at, version
+            "#,
+        )
+        .bind(id)
+        .bind(expected_version)
+        .bind(bidder_id)
+        .bind(bidder_hero_id)
+        .bind(amount)
+        .bind(ends_at)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(auction)
+    }
+
+    pub async fn record_bid(
+        pool: &PgPool,
+        auction_id: Uuid,
+        bidder_id: Uuid,
+        amount: i32,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO hero_auction_bids (auction_id, bidder_id, amount)
+            VALUES ($1, $2, $3)
+            "#,
+        )
+        .bind(auction_id)
+        .bind(bidder_id)
+        .bind(amount)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Open auctions whose time is up
+    pub async fn find_due(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<HeroAuction>> {
+        let auctions = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            SELECT id, seller_id, seller_hero_id, item_definition_id, quantity, currency,
+                   starting_bid, current_bid, bidder_id, bidder_hero_id, bid_count,
+                   ends_at, status, closed_at, created_at, version
+            FROM hero_auctions
+            WHERE status = 'open' AND ends_at <= $1
+            ORDER BY ends_at ASC
+            LIMIT $2
+            "#,
+        )
+        .bind(now)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(auctions)
+    }
+
+    /// Close an open auction, unless it changed since it was read. None if
+    /// a bid or another close got there first.
+    pub async fn close(
+        pool: &PgPool,
+        id: Uuid,
+        expected_version: i32,
+        status: AuctionStatus,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<HeroAuction>> {
+        let auction = sqlx::query_as::<_, HeroAuction>(
+            r#"
+            UPDATE hero_auctions
+            SET status = $3, closed_at = $4, version = version + 1
+            WHERE id = $1 AND version = $2 AND status = 'open'
+            RETURNING id, seller_id, seller_hero_id, item_definition_id, quantity, currency,
+                      starting_bid, current_bid, bidder_id, bidder_hero_id, bid_count,
+                      ends_at, status, closed_at, created_at, version
+            "#,
+        )
+        .bind(id)
+        .bind(expected_version)
+        .bind(status)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(auction)
+    }
+}
@@ -0,0 +1,79 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::audit::{AuditLogEntry, AuditLogQuery, NewAuditLogEntry};
+
+pub struct AuditRepository;
+
+impl AuditRepository {
+    /// Resolves the player from the Firebase UID at write time so entries
+    /// stay attributable after the account is deleted
+    pub async fn insert(pool: &PgPool, entry: &NewAuditLogEntry) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO api_audit_log (
+                user_id, firebase_uid, method, route, path, status, payload, duration_ms, client_ip,
+                impersonator_id
+            )
+            VALUES (
+                (SELECT id FROM users WHERE firebase_uid = $1), $1, $2, $3, $4, $5, $6, $7, $8, $9
+            )
+            "#,
+        )
+        .bind(&entry.firebase_uid)
+        .bind(&entry.method)
+        .bind(&entry.route)
+        .bind(&entry.path)
+        .bind(entry.status)
+        .bind(&entry.payload)
+        .bind(entry.duration_ms)
+        .bind(&entry.client_ip)
+        .bind(entry.impersonator_id)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn search(pool: &PgPool, query: &AuditLogQuery) -> AppResult<Vec<AuditLogEntry>> {
+        let entries = sqlx::query_as::<_, AuditLogEntry>(
+            r#"
+            SELECT id, user_id, firebase_uid, method, route, path, status,
+                   payload, duration_ms, client_ip, impersonator_id, created_at
+            FROM api_audit_log
+            WHERE ($1::uuid IS NULL OR user_id = $1)
+                AND ($2::text IS NULL OR route = $2)
+                AND ($3::text IS NULL OR method = UPPER($3))
+                AND (NOT $4 OR status >= 400)
+                AND ($5::timestamptz IS NULL OR created_at >= $5)
+                AND ($6::timestamptz IS NULL OR created_at < $6)
+                AND (NOT $7 OR impersonator_id IS NOT NULL)
+            ORDER BY created_at DESC, id DESC
+            LIMIT $8 OFFSET $9
+            "#,
+        )
+        .bind(query.user_id)
+        .bind(&query.route)
+        .bind(&query.method)
+        .bind(query.failed_only)
+        .bind(query.from)
+        .bind(query.to)
+        .bind(query.impersonated_only)
+        .bind(query.limit.clamp(1, 500))
+        .bind(query.offset.max(0))
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+
+    pub async fn delete_before(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM api_audit_log WHERE created_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+}
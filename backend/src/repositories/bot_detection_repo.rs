@@ -0,0 +1,190 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::bot_detection::{BotReviewStatus, BotSignals, BotSuspicion};
+
+pub struct BotDetectionRepository;
+
+impl BotDetectionRepository {
+    /// Players with at least `min_commands` commands since `since`
+    pub async fn active_players(
+        pool: &PgPool,
+        since: DateTime<Utc>,
+        min_commands: i64,
+    ) -> AppResult<Vec<Uuid>> {
+        let players: Vec<(Uuid,)> = sqlx::query_as(
+            r#"
+            SELECT user_id
+            FROM player_commands
+            WHERE created_at >= $1
+            GROUP BY user_id
+            HAVING COUNT(*) >= $2
+            "#,
+        )
+        .bind(since)
+        .bind(min_commands)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(players.into_iter().map(|(id,)| id).collect())
+    }
+
+    /// When the player submitted commands since `since`, oldest first.
+    /// Scheduled commands run on the server's timing, not the player's, so
+    /// they are left out.
+    pub async fn command_times(
+        pool: &PgPool,
+        user_id: Uuid,
+        since: DateTime<Utc>,
+    ) -> AppResult<Vec<DateTime<Utc>>> {
+        let times: Vec<(DateTime<Utc>,)> = sqlx::query_as(
+            r#"
+            SELECT pc.created_at
+            FROM player_commands pc
+            WHERE pc.user_id = $1 AND pc.created_at >= $2
+              AND NOT EXISTS (
+                  SELECT 1 FROM scheduled_commands sc WHERE sc.command_id = pc.command_id
+              )
+            ORDER BY pc.created_at ASC
+            "#,
+        )
+        .bind(user_id)
+        .bind(since)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(times.into_iter().map(|(t,)| t).collect())
+    }
+
+    /// Store the latest scores. A player an admin cleared stays cleared and
+    /// is not challenged again.
+    pub async fn upsert(
+        pool: &PgPool,
+        user_id: Uuid,
+        signals: &BotSignals,
+        score: i32,
+        challenge_required: bool,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO bot_suspicions (
+                user_id, score, timing_entropy, active_hours, peak_per_minute,
+                commands_analyzed, challenge_required
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            ON CONFLICT (user_id) DO UPDATE
+            SET score = EXCLUDED.score,
+                timing_entropy = EXCLUDED.timing_entropy,
+                active_hours = EXCLUDED.active_hours,
+                peak_per_minute = EXCLUDED.peak_per_minute,
+                commands_analyzed = EXCLUDED.commands_analyzed,
+                challenge_required = EXCLUDED.challenge_required
+                    AND bot_suspicions.status <> 'cleared',
+                updated_at = NOW()
+            "#,
+        )
+        .bind(user_id)
+        .bind(score)
+        .bind(signals.timing_entropy)
+        .bind(signals.active_hours)
+        .bind(signals.peak_per_minute)
+        .bind(signals.commands_analyzed)
+        .bind(challenge_required)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn find_by_user(pool: &PgPool, user_id: Uuid) -> AppResult<Option<BotSuspicion>> {
+        let suspicion = sqlx::query_as::<_, BotSuspicion>(
+            r#"
+            SELECT user_id, score, timing_entropy, active_hours, peak_per_minute,
+                   commands_analyzed, challenge_required, status, reviewed_by, reviewed_at,
+                   review_note, created_at, updated_at
+            FROM bot_suspicions
+            WHERE user_id = $1
+            "#,
+        )
+        .bind(user_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(suspicion)
+    }
+
+    /// Review queue, highest scores first
+    pub async fn list_by_status(
+        pool: &PgPool,
+        status: BotReviewStatus,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<BotSuspicion>> {
+        let suspicions = sqlx::query_as::<_, BotSuspicion>(
+            r#"
+            SELECT user_id, score, timing_entropy, active_hours, peak_per_minute,
+                   commands_analyzed, challenge_required, status, reviewed_by, reviewed_at,
+                   review_note, created_at, updated_at
+            FROM bot_suspicions
+            WHERE status = $1
+            ORDER BY score DESC, updated_at DESC
+            LIMIT $2 OFFSET $3
+            "#,
+        )
+        .bind(status)
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(suspicions)
+    }
+
+    /// Lift the challenge after the player solved a captcha. The next scan
+    /// raises it again if the behaviour continues.
+    pub async fn clear_challenge(pool: &PgPool, user_id: Uuid) -> AppResult<()> {
+        sqlx::query(
+            "UPDATE bot_suspicions SET challenge_required = FALSE, updated_at = NOW() \
+             WHERE user_id = $1",
+        )
+        .bind(user_id)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Record an admin's verdict. Clearing a player also lifts the challenge.
+    pub async fn review(
+        pool: &PgPool,
+        user_id: Uuid,
+        status: BotReviewStatus,
+        admin_id: Uuid,
+        note: Option<&str>,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<BotSuspicion>> {
+        let suspicion = sqlx::query_as::<_, BotSuspicion>(
+            r#"
+            UPDATE bot_suspicions
+            SET status = $2,
+                challenge_required = challenge_required AND $2 <> 'cleared'::bot_review_status,
+                reviewed_by = $3, reviewed_at = $5, review_note = $4, updated_at = NOW()
+            WHERE user_id = $1
+            RETURNING user_id, score, timing_entropy, active_hours, peak_per_minute,
+                      commands_analyzed, challenge_required, status, reviewed_by, reviewed_at,
+                      review_note, created_at, updated_at
+            "#,
+        )
+        .bind(user_id)
+        .bind(status)
+        .bind(admin_id)
+        .bind(note)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(suspicion)
+    }
+}
@@ -1,9 +1,9 @@
 use chrono::{DateTime, Utc};
-use sqlx::PgPool;
+use sqlx::{PgExecutor, PgPool};
 use uuid::Uuid;
 
-use crate::error::AppResult;
-use crate::models::building::{Building, BuildingType, CreateBuilding};
+use crate::error::{AppError, AppResult};
+use crate::models::building::{BuildOrder, Building, BuildingCost, BuildingType, CreateBuilding};
 
 pub struct BuildingRepository;
 
@@ -12,7 +12,7 @@ impl BuildingRepository {
         let building = sqlx::query_as::<_, Building>(
             r#"
             SELECT id, village_id, building_type, slot, level,
-                   is_upgrading, upgrade_ends_at, created_at, updated_at
+                   is_upgrading, upgrade_ends_at, created_at, updated_at, version
             FROM buildings
             WHERE id = $1
             "#,
@@ -24,11 +24,27 @@ impl BuildingRepository {
         Ok(building)
     }
 
+    pub async fn find_by_ids(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<Building>> {
+        let buildings = sqlx::query_as::<_, Building>(
+            r#"
+            SELECT id, village_id, building_type, slot, level,
+                   is_upgrading, upgrade_ends_at, created_at, updated_at, version
+            FROM buildings
+            WHERE id = ANY($1)
+            "#,
+        )
+        .bind(ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(buildings)
+    }
+
     pub async fn find_by_village_id(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<Building>> {
         let buildings = sqlx::query_as::<_, Building>(
             r#"
             SELECT id, village_id, building_type, slot, level,
-                   is_upgrading, upgrade_ends_at, created_at, updated_at
+                   is_upgrading, upgrade_ends_at, created_at, updated_at, version
             FROM buildings
             WHERE village_id = $1
             ORDER BY slot ASC
@@ -49,7 +65,7 @@ impl BuildingRepository {
         let building = sqlx::query_as::<_, Building>(
             r#"
             SELECT id, village_id, building_type, slot, level,
-                   is_upgrading, upgrade_ends_at, created_at, updated_at
+                   is_upgrading, upgrade_ends_at, created_at, updated_at, version
             FROM buildings
             WHERE village_id = $1 AND slot = $2
             "#,
@@ -69,7 +85,7 @@ impl BuildingRepository {
         let buildings = sqlx::query_as::<_, Building>(
             r#"
             SELECT id, village_id, building_type, slot, level,
-                   is_upgrading, upgrade_ends_at, created_at, updated_at
+                   is_upgrading, upgrade_ends_at, created_at, updated_at, version
             FROM buildings
             WHERE village_id = $1 AND is_upgrading = TRUE
             ORDER BY upgrade_ends_at ASC
@@ -82,49 +98,58 @@ impl BuildingRepository {
         Ok(buildings)
     }
 
-    pub async fn create(pool: &PgPool, input: CreateBuilding) -> AppResult<Building> {
+    pub async fn create<'e>(
+        executor: impl PgExecutor<'e>,
+        input: CreateBuilding,
+    ) -> AppResult<Building> {
         let building = sqlx::query_as::<_, Building>(
             r#"
             INSERT INTO buildings (village_id, building_type, slot, level)
             VALUES ($1, $2, $3, 1)
             RETURNING id, village_id, building_type, slot, level,
-                      is_upgrading, upgrade_ends_at, created_at, updated_at
+                      is_upgrading, upgrade_ends_at, created_at, updated_at, version
             "#,
         )
         .bind(&input.village_id)
         .bind(&input.building_type)
         .bind(input.slot)
-        .fetch_one(pool)
+        .fetch_one(executor)
         .await?;
 
         Ok(building)
     }
 
-    pub async fn start_upgrade(
-        pool: &PgPool,
+    /// Start an upgrade (compare-and-swap on version, and only if idle)
+    pub async fn start_upgrade<'e>(
+        executor: impl PgExecutor<'e>,
         id: Uuid,
+        expected_version: i32,
         upgrade_ends_at: DateTime<Utc>,
     ) -> AppResult<Building> {
         let building = sqlx::query_as::<_, Building>(
             r#"
             UPDATE buildings
             SET is_upgrading = TRUE,
-                upgrade_ends_at = $2,
+                upgrade_ends_at = $3,
                 updated_at = NOW()
-            WHERE id = $1
+            WHERE id = $1 AND version = $2 AND is_upgrading = FALSE
             RETURNING id, village_id, building_type, slot, level,
-                      is_upgrading, upgrade_ends_at, created_at, updated_at
+                      is_upgrading, upgrade_ends_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
+        .bind(expected_version)
         .bind(upgrade_ends_at)
-        .fetch_one(pool)
-        .await?;
+        .fetch_optional(executor)
+        .await?
+        .ok_or_else(|| AppError::VersionConflict("Building was modified, please retry".into()))?;
 
         Ok(building)
     }
 
-    pub async fn complete_upgrade(pool: &PgPool, id: Uuid) -> AppResult<Building> {
+    /// Finish an upgrade in progress. None if it isn't upgrading (any more),
+    /// so the job and "Finish Now" can't both raise the level.
+    pub async fn complete_upgrade(pool: &PgPool, id: Uuid) -> AppResult<Option<Building>> {
         let building = sqlx::query_as::<_, Building>(
             r#"
             UPDATE buildings
@@ -132,13 +157,13 @@ impl BuildingRepository {
                 is_upgrading = FALSE,
                 upgrade_ends_at = NULL,
                 updated_at = NOW()
-            WHERE id = $1
+            WHERE id = $1 AND is_upgrading = TRUE
             RETURNING id, village_id, building_type, slot, level,
-                      is_upgrading, upgrade_ends_at, created_at, updated_at
+                      is_upgrading, upgrade_ends_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
-        .fetch_one(pool)
+        .fetch_optional(pool)
         .await?;
 
         Ok(building)
@@ -153,7 +178,7 @@ impl BuildingRepository {
                 updated_at = NOW()
             WHERE id = $1
             RETURNING id, village_id, building_type, slot, level,
-                      is_upgrading, upgrade_ends_at, created_at, updated_at
+                      is_upgrading, upgrade_ends_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
@@ -176,15 +201,91 @@ impl BuildingRepository {
         Ok(())
     }
 
-    pub async fn find_completed_upgrades(pool: &PgPool) -> AppResult<Vec<Building>> {
+    /// Remove every building of a type from a village. Returns how many went.
+    pub async fn demolish_by_type(
+        pool: &PgPool,
+        village_id: Uuid,
+        building_type: BuildingType,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            DELETE FROM buildings WHERE village_id = $1 AND building_type = $2
+            "#,
+        )
+        .bind(village_id)
+        .bind(&building_type)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Take a level off the village's highest building that isn't being
+    /// upgraded. None when nothing is left to take.
+    pub async fn decay_highest(pool: &PgPool, village_id: Uuid) -> AppResult<Option<Building>> {
+        let building = sqlx::query_as::<_, Building>(
+            r#"
+            UPDATE buildings
+            SET level = level - 1,
+                updated_at = NOW()
+            WHERE id = (
+                SELECT id FROM buildings
+                WHERE village_id = $1 AND level > 0 AND is_upgrading = FALSE
+                ORDER BY level DESC, slot ASC
+                LIMIT 1
+            )
+            RETURNING id, village_id, building_type, slot, level,
+                      is_upgrading, upgrade_ends_at, created_at, updated_at, version
+            "#,
+        )
+        .bind(village_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(building)
+    }
+
+    /// Bring resource fields above `max_level` down to it, calling off
+    /// upgrades past it. Returns how many fields changed.
+    pub async fn cap_field_levels(
+        pool: &PgPool,
+        village_id: Uuid,
+        max_level: i32,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE buildings
+            SET level = LEAST(level, $2),
+                is_upgrading = is_upgrading AND level < $2,
+                upgrade_ends_at = CASE WHEN level < $2 THEN upgrade_ends_at END,
+                updated_at = NOW()
+            WHERE village_id = $1
+              AND building_type IN ('woodcutter', 'clay_pit', 'iron_mine', 'crop_field')
+              AND (level > $2 OR (level = $2 AND is_upgrading))
+            "#,
+        )
+        .bind(village_id)
+        .bind(max_level)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    pub async fn find_completed_upgrades(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<Building>> {
         let buildings = sqlx::query_as::<_, Building>(
             r#"
             SELECT id, village_id, building_type, slot, level,
-                   is_upgrading, upgrade_ends_at, created_at, updated_at
+                   is_upgrading, upgrade_ends_at, created_at, updated_at, version
             FROM buildings
-            WHERE is_upgrading = TRUE AND upgrade_ends_at <= NOW()
+            WHERE is_upgrading = TRUE AND upgrade_ends_at <= $1
+            ORDER BY upgrade_ends_at ASC
             "#,
         )
+        .bind(now)
         .fetch_all(pool)
         .await?;
 
@@ -213,7 +314,7 @@ impl BuildingRepository {
         let buildings = sqlx::query_as::<_, Building>(
             r#"
             SELECT id, village_id, building_type, slot, level,
-                   is_upgrading, upgrade_ends_at, created_at, updated_at
+                   is_upgrading, upgrade_ends_at, created_at, updated_at, version
             FROM buildings
             WHERE village_id = $1 AND building_type = $2
             ORDER BY level DESC
@@ -226,4 +327,100 @@ impl BuildingRepository {
 
         Ok(buildings)
     }
+
+    /// Highest level the building reaches in any of the player's villages
+    pub async fn max_level_for_user(
+        pool: &PgPool,
+        user_id: Uuid,
+        building_type: BuildingType,
+    ) -> AppResult<i32> {
+        let level: (Option<i32>,) = sqlx::query_as(
+            r#"
+            SELECT MAX(b.level)
+            FROM buildings b
+            JOIN villages v ON v.id = b.village_id
+            WHERE v.user_id = $1 AND b.building_type = $2
+            "#,
+        )
+        .bind(user_id)
+        .bind(&building_type)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(level.0.unwrap_or(0))
+    }
+
+    // ==================== Build Queue ====================
+
+    #[allow(clippy::too_many_arguments)]
+    pub async fn create_order(
+        pool: &PgPool,
+        village_id: Uuid,
+        building_id: Option<Uuid>,
+        slot: i32,
+        building_type: &BuildingType,
+        target_level: i32,
+        cost: &BuildingCost,
+    ) -> AppResult<BuildOrder> {
+        let order = sqlx::query_as::<_, BuildOrder>(
+            r#"
+            INSERT INTO building_queue (
+                village_id, building_id, slot, building_type, target_level,
+                wood, clay, iron, crop, time_seconds
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            RETURNING id, village_id, building_id, slot, building_type, target_level,
+                      wood, clay, iron, crop, time_seconds, created_at
+            "#,
+        )
+        .bind(village_id)
+        .bind(building_id)
+        .bind(slot)
+        .bind(building_type)
+        .bind(target_level)
+        .bind(cost.wood)
+        .bind(cost.clay)
+        .bind(cost.iron)
+        .bind(cost.crop)
+        .bind(cost.time_seconds)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(order)
+    }
+
+    /// Orders waiting in the village, oldest first
+    pub async fn find_orders(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<BuildOrder>> {
+        let orders = sqlx::query_as::<_, BuildOrder>(
+            r#"
+            SELECT id, village_id, building_id, slot, building_type, target_level,
+                   wood, clay, iron, crop, time_seconds, created_at
+            FROM building_queue
+            WHERE village_id = $1
+            ORDER BY created_at ASC
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(orders)
+    }
+
+    /// Take an order off the queue. None if it was already taken.
+    pub async fn take_order(pool: &PgPool, id: Uuid) -> AppResult<Option<BuildOrder>> {
+        let order = sqlx::query_as::<_, BuildOrder>(
+            r#"
+            DELETE FROM building_queue
+            WHERE id = $1
+            RETURNING id, village_id, building_id, slot, building_type, target_level,
+                      wood, clay, iron, crop, time_seconds, created_at
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(order)
+    }
 }
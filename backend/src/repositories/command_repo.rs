@@ -0,0 +1,308 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::command::{PlayerCommand, ScheduledCommand};
+
+pub struct CommandRepository;
+
+impl CommandRepository {
+    /// Record a new pending command. Returns `None` if the id was already used.
+    pub async fn try_insert(
+        pool: &PgPool,
+        command_id: Uuid,
+        user_id: Uuid,
+        command_type: &str,
+        payload: &serde_json::Value,
+    ) -> AppResult<Option<PlayerCommand>> {
+        let command = sqlx::query_as::<_, PlayerCommand>(
+            r#"
+            INSERT INTO player_commands (command_id, user_id, command_type, payload)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (command_id) DO NOTHING
+            RETURNING command_id, user_id, command_type, payload, status, result,
+                      error_status, error_message, error_code, created_at, completed_at
+            "#,
+        )
+        .bind(command_id)
+        .bind(user_id)
+        .bind(command_type)
+        .bind(payload)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(command)
+    }
+
+    pub async fn find_by_id(pool: &PgPool, command_id: Uuid) -> AppResult<Option<PlayerCommand>> {
+        let command = sqlx::query_as::<_, PlayerCommand>(
+            r#"
+            SELECT command_id, user_id, command_type, payload, status, result,
+                   error_status, error_message, error_code, created_at, completed_at
+            FROM player_commands
+            WHERE command_id = $1
+            "#,
+        )
+        .bind(command_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(command)
+    }
+
+    pub async fn mark_succeeded(
+        pool: &PgPool,
+        command_id: Uuid,
+        result: &serde_json::Value,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE player_commands
+            SET status = 'succeeded', result = $2, completed_at = NOW()
+            WHERE command_id = $1
+            "#,
+        )
+        .bind(command_id)
+        .bind(result)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn mark_rejected(
+        pool: &PgPool,
+        command_id: Uuid,
+        error_status: i32,
+        error_message: &str,
+        error_code: &str,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE player_commands
+            SET status = 'rejected', error_status = $2, error_message = $3, error_code = $4,
+                completed_at = NOW()
+            WHERE command_id = $1
+            "#,
+        )
+        .bind(command_id)
+        .bind(error_status)
+        .bind(error_message)
+        .bind(error_code)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Forget a command so the client can retry it with the same id
+    pub async fn delete(pool: &PgPool, command_id: Uuid) -> AppResult<()> {
+        sqlx::query("DELETE FROM player_commands WHERE command_id = $1")
+            .bind(command_id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Action log, newest first
+    pub async fn list_for_user(
+        pool: &PgPool,
+        user_id: Uuid,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<PlayerCommand>> {
+        let commands = sqlx::query_as::<_, PlayerCommand>(
+            r#"
+            SELECT command_id, user_id, command_type, payload, status, result,
+                   error_status, error_message, error_code, created_at, completed_at
+            FROM player_commands
+            WHERE user_id = $1
+            ORDER BY created_at DESC
+            LIMIT $2 OFFSET $3
+            "#,
+        )
+        .bind(user_id)
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(commands)
+    }
+
+    /// Successful commands in submission order, for replay
+    pub async fn list_succeeded_between(
+        pool: &PgPool,
+        user_id: Uuid,
+        since: Option<DateTime<Utc>>,
+        until: Option<DateTime<Utc>>,
+    ) -> AppResult<Vec<PlayerCommand>> {
+        let commands = sqlx::query_as::<_, PlayerCommand>(
+            r#"
+            SELECT command_id, user_id, command_type, payload, status, result,
+                   error_status, error_message, error_code, created_at, completed_at
+            FROM player_commands
+            WHERE user_id = $1
+                AND status = 'succeeded'
+                AND ($2::timestamptz IS NULL OR created_at >= $2)
+                AND ($3::timestamptz IS NULL OR created_at < $3)
+            ORDER BY created_at
+            LIMIT 1000
+            "#,
+        )
+        .bind(user_id)
+        .bind(since)
+        .bind(until)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(commands)
+    }
+
+    // ==================== Scheduled Commands ====================
+
+    /// Store a command to run at `execute_at`. `None` if the command id
+    /// was already scheduled.
+    pub async fn schedule(
+        pool: &PgPool,
+        user_id: Uuid,
+        command_id: Uuid,
+        command_type: &str,
+        payload: &serde_json::Value,
+        execute_at: DateTime<Utc>,
+    ) -> AppResult<Option<ScheduledCommand>> {
+        let scheduled = sqlx::query_as::<_, ScheduledCommand>(
+            r#"
+            INSERT INTO scheduled_commands (user_id, command_id, command_type, payload, execute_at)
+            VALUES ($1, $2, $3, $4, $5)
+            ON CONFLICT (command_id) DO NOTHING
+            RETURNING id, user_id, command_id, command_type, payload, execute_at, status,
+                      error, created_at, executed_at
+            "#,
+        )
+        .bind(user_id)
+        .bind(command_id)
+        .bind(command_type)
+        .bind(payload)
+        .bind(execute_at)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(scheduled)
+    }
+
+    pub async fn list_scheduled(
+        pool: &PgPool,
+        user_id: Uuid,
+        limit: i64,
+    ) -> AppResult<Vec<ScheduledCommand>> {
+        let scheduled = sqlx::query_as::<_, ScheduledCommand>(
+            r#"
+            SELECT id, user_id, command_id, command_type, payload, execute_at, status,
+                   error, created_at, executed_at
+            FROM scheduled_commands
+            WHERE user_id = $1
+            ORDER BY execute_at DESC
+            LIMIT $2
+            "#,
+        )
+        .bind(user_id)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(scheduled)
+    }
+
+    pub async fn count_pending_scheduled(pool: &PgPool, user_id: Uuid) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            "SELECT COUNT(*) FROM scheduled_commands WHERE user_id = $1 AND status = 'pending'",
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn count_scheduled_since(
+        pool: &PgPool,
+        user_id: Uuid,
+        since: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            "SELECT COUNT(*) FROM scheduled_commands WHERE user_id = $1 AND created_at >= $2",
+        )
+        .bind(user_id)
+        .bind(since)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Cancel a pending command of the player. `None` if there is none.
+    pub async fn cancel_scheduled(
+        pool: &PgPool,
+        id: Uuid,
+        user_id: Uuid,
+    ) -> AppResult<Option<ScheduledCommand>> {
+        let scheduled = sqlx::query_as::<_, ScheduledCommand>(
+            r#"
+            UPDATE scheduled_commands
+            SET status = 'cancelled'
+            WHERE id = $1 AND user_id = $2 AND status = 'pending'
+            RETURNING id, user_id, command_id, command_type, payload, execute_at, status,
+                      error, created_at, executed_at
+            "#,
+        )
+        .bind(id)
+        .bind(user_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(scheduled)
+    }
+
+    /// Take the pending commands due by `now`, marking them executed so no
+    /// other scheduler runs them too
+    pub async fn claim_due_scheduled(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<ScheduledCommand>> {
+        let scheduled = sqlx::query_as::<_, ScheduledCommand>(
+            r#"
+            UPDATE scheduled_commands
+            SET status = 'executed', executed_at = $1
+            WHERE id IN (
+                SELECT id FROM scheduled_commands
+                WHERE status = 'pending' AND execute_at <= $1
+                ORDER BY execute_at
+                LIMIT $2
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING id, user_id, command_id, command_type, payload, execute_at, status,
+                      error, created_at, executed_at
+            "#,
+        )
+        .bind(now)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(scheduled)
+    }
+
+    pub async fn mark_scheduled_failed(pool: &PgPool, id: Uuid, error: &str) -> AppResult<()> {
+        sqlx::query("UPDATE scheduled_commands SET status = 'failed', error = $2 WHERE id = $1")
+            .bind(id)
+            .bind(error)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+}
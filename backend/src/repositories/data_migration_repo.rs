@@ -0,0 +1,236 @@
+use sqlx::{PgConnection, PgPool};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::data_migration::{
+    DataMigration, DataMigrationChange, DataMigrationRun, DataMigrationStatus,
+};
+
+const RUN_COLUMNS: &str = "id, migration, dry_run, status, batch_size, cursor, processed, \
+    changed, error, started_by, started_at, finished_at, rolled_back_at";
+
+pub struct DataMigrationRepository;
+
+impl DataMigrationRepository {
+    // ==================== Runs ====================
+
+    pub async fn create_run(
+        pool: &PgPool,
+        migration: DataMigration,
+        dry_run: bool,
+        batch_size: i32,
+        started_by: Uuid,
+    ) -> AppResult<DataMigrationRun> {
+        let run = sqlx::query_as::<_, DataMigrationRun>(&format!(
+            r#"
+            INSERT INTO data_migration_runs (migration, dry_run, batch_size, started_by)
+            VALUES ($1, $2, $3, $4)
+            RETURNING {RUN_COLUMNS}
+            "#
+        ))
+        .bind(migration.name())
+        .bind(dry_run)
+        .bind(batch_size)
+        .bind(started_by)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(run)
+    }
+
+    pub async fn find_run(pool: &PgPool, id: Uuid) -> AppResult<Option<DataMigrationRun>> {
+        let run = sqlx::query_as::<_, DataMigrationRun>(&format!(
+            "SELECT {RUN_COLUMNS} FROM data_migration_runs WHERE id = $1"
+        ))
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(run)
+    }
+
+    pub async fn find_running(
+        pool: &PgPool,
+        migration: DataMigration,
+    ) -> AppResult<Option<DataMigrationRun>> {
+        let run = sqlx::query_as::<_, DataMigrationRun>(&format!(
+            "SELECT {RUN_COLUMNS} FROM data_migration_runs \
+             WHERE migration = $1 AND status = 'running'"
+        ))
+        .bind(migration.name())
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(run)
+    }
+
+    pub async fn list_runs(pool: &PgPool, limit: i64) -> AppResult<Vec<DataMigrationRun>> {
+        let runs = sqlx::query_as::<_, DataMigrationRun>(&format!(
+            "SELECT {RUN_COLUMNS} FROM data_migration_runs ORDER BY started_at DESC LIMIT $1"
+        ))
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(runs)
+    }
+
+    /// Move the run's cursor past a finished batch
+    pub async fn record_batch(
+        conn: &mut PgConnection,
+        id: Uuid,
+        cursor: Uuid,
+        processed: i64,
+        changed: i64,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE data_migration_runs
+            SET cursor = $2, processed = processed + $3, changed = changed + $4
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .bind(cursor)
+        .bind(processed)
+        .bind(changed)
+        .execute(conn)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn set_status(
+        pool: &PgPool,
+        id: Uuid,
+        status: DataMigrationStatus,
+        error: Option<&str>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE data_migration_runs
+            SET status = $2,
+                error = $3,
+                finished_at = CASE WHEN $2 = 'running' THEN NULL ELSE NOW() END,
+                rolled_back_at = CASE WHEN $2 = 'rolled_back' THEN NOW() ELSE rolled_back_at END
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .bind(status)
+        .bind(error)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    // ==================== Rows ====================
+
+    /// The next rows after `cursor` in id order, with the migration's
+    /// columns as a JSON object
+    pub async fn next_batch(
+        pool: &PgPool,
+        migration: DataMigration,
+        cursor: Option<Uuid>,
+        limit: i32,
+    ) -> AppResult<Vec<(Uuid, serde_json::Value)>> {
+        let fields = migration
+            .columns()
+            .iter()
+            .map(|c| format!("'{c}', {c}"))
+            .collect::<Vec<_>>()
+            .join(", ");
+        let rows = sqlx::query_as::<_, (Uuid, serde_json::Value)>(&format!(
+            "SELECT id, jsonb_build_object({fields}) FROM {table} \
+             WHERE $1::uuid IS NULL OR id > $1 ORDER BY id LIMIT $2",
+            table = migration.table()
+        ))
+        .bind(cursor)
+        .bind(limit as i64)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows)
+    }
+
+    /// Set the migration's columns of a row to `values`, provided they
+    /// still hold `expected`. Returns whether the row was written.
+    pub async fn write_row(
+        conn: &mut PgConnection,
+        migration: DataMigration,
+        row_id: Uuid,
+        expected: &serde_json::Value,
+        values: &serde_json::Value,
+    ) -> AppResult<bool> {
+        let table = migration.table();
+        let assignments = migration
+            .columns()
+            .iter()
+            .map(|c| format!("{c} = r.{c}"))
+            .collect::<Vec<_>>()
+            .join(", ");
+        let result = sqlx::query(&format!(
+            "UPDATE {table} t SET {assignments} \
+             FROM jsonb_populate_record(NULL::{table}, $2) r \
+             WHERE t.id = $1 AND to_jsonb(t) @> $3"
+        ))
+        .bind(row_id)
+        .bind(values)
+        .bind(expected)
+        .execute(conn)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    // ==================== Changes ====================
+
+    pub async fn insert_change(
+        conn: &mut PgConnection,
+        run_id: Uuid,
+        table_name: &str,
+        row_id: Uuid,
+        before: &serde_json::Value,
+        after: &serde_json::Value,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO data_migration_changes (run_id, table_name, row_id, before, after)
+            VALUES ($1, $2, $3, $4, $5)
+            ON CONFLICT (run_id, table_name, row_id) DO NOTHING
+            "#,
+        )
+        .bind(run_id)
+        .bind(table_name)
+        .bind(row_id)
+        .bind(before)
+        .bind(after)
+        .execute(conn)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn list_changes(
+        pool: &PgPool,
+        run_id: Uuid,
+        limit: Option<i64>,
+    ) -> AppResult<Vec<DataMigrationChange>> {
+        let changes = sqlx::query_as::<_, DataMigrationChange>(
+            r#"
+            SELECT table_name, row_id, before, after
+            FROM data_migration_changes
+            WHERE run_id = $1
+            ORDER BY table_name, row_id
+            LIMIT $2
+            "#,
+        )
+        .bind(run_id)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(changes)
+    }
+}
@@ -0,0 +1,289 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::army::ArmyTroops;
+use crate::models::defense_call::{DefenderTroops, DefenseCall, DefensePledge};
+
+const CALL_COLUMNS: &str = "c.id, c.alliance_id, c.player_id, u.display_name as player_name, \
+                            c.village_id, v.name as village_name, v.x, v.y, c.deadline, c.note, \
+                            c.status, c.notified, c.created_at";
+
+const PLEDGE_COLUMNS: &str = "p.id, p.call_id, p.player_id, u.display_name as player_name, \
+                              p.from_village_id, p.troops, p.army_id, p.lands_at, p.arrived_at, \
+                              p.created_at";
+
+pub struct DefenseCallRepository;
+
+impl DefenseCallRepository {
+    // ==================== Calls ====================
+
+    pub async fn create(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        player_id: Uuid,
+        village_id: Uuid,
+        deadline: DateTime<Utc>,
+        note: Option<&str>,
+    ) -> AppResult<Uuid> {
+        let id: (Uuid,) = sqlx::query_as(
+            r#"
+            INSERT INTO defense_calls (alliance_id, player_id, village_id, deadline, note)
+            VALUES ($1, $2, $3, $4, $5)
+            RETURNING id
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(player_id)
+        .bind(village_id)
+        .bind(deadline)
+        .bind(note)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(id.0)
+    }
+
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<DefenseCall>> {
+        let call = sqlx::query_as::<_, DefenseCall>(&format!(
+            r#"
+            SELECT {CALL_COLUMNS}
+            FROM defense_calls c
+            JOIN users u ON c.player_id = u.id
+            JOIN villages v ON c.village_id = v.id
+            WHERE c.id = $1
+            "#
+        ))
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(call)
+    }
+
+    /// Open calls from the alliance and from alliances that list it as an
+    /// ally, soonest deadline first
+    pub async fn find_open_for(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<DefenseCall>> {
+        let calls = sqlx::query_as::<_, DefenseCall>(&format!(
+            r#"
+            SELECT {CALL_COLUMNS}
+            FROM defense_calls c
+            JOIN users u ON c.player_id = u.id
+            JOIN villages v ON c.village_id = v.id
+            WHERE c.status = 'open' AND c.deadline > $2
+              AND (c.alliance_id = $1 OR c.alliance_id IN (
+                  SELECT alliance_id FROM alliance_diplomacy
+                  WHERE target_alliance_id = $1 AND status = 'ally'
+              ))
+            ORDER BY c.deadline
+            "#
+        ))
+        .bind(alliance_id)
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(calls)
+    }
+
+    /// The open call for a village, if any
+    pub async fn find_open_for_village(
+        pool: &PgPool,
+        village_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<Uuid>> {
+        let id: Option<(Uuid,)> = sqlx::query_as(
+            r#"
+            SELECT id FROM defense_calls
+            WHERE village_id = $1 AND status = 'open' AND deadline > $2
+            LIMIT 1
+            "#,
+        )
+        .bind(village_id)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(id.map(|r| r.0))
+    }
+
+    pub async fn count_open_by_player(
+        pool: &PgPool,
+        player_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*) FROM defense_calls
+            WHERE player_id = $1 AND status = 'open' AND deadline > $2
+            "#,
+        )
+        .bind(player_id)
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn set_notified(pool: &PgPool, id: Uuid, notified: i32) -> AppResult<()> {
+        sqlx::query("UPDATE defense_calls SET notified = $2 WHERE id = $1")
+            .bind(id)
+            .bind(notified)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Call off a call. False if it already was.
+    pub async fn cancel(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            "UPDATE defense_calls SET status = 'cancelled' WHERE id = $1 AND status = 'open'",
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Troops at home in the villages of the alliances' members, except
+    /// the village under attack
+    pub async fn find_defender_troops(
+        pool: &PgPool,
+        alliance_ids: &[Uuid],
+        exclude_village_id: Uuid,
+    ) -> AppResult<Vec<DefenderTroops>> {
+        let troops = sqlx::query_as::<_, DefenderTroops>(
+            r#"
+            SELECT v.id as village_id, v.user_id as player_id, u.display_name as player_name,
+                   v.name as village_name, v.x, v.y,
+                   COALESCE((
+                       SELECT MAX(b.level) FROM buildings b
+                       WHERE b.village_id = v.id AND b.building_type = 'tournament_square'
+                   ), 0) as tournament_square_level,
+                   t.troop_type, t.in_village
+            FROM alliance_members am
+            JOIN users u ON am.user_id = u.id
+            JOIN villages v ON v.user_id = am.user_id
+            JOIN troops t ON t.village_id = v.id
+            WHERE am.alliance_id = ANY($1) AND v.id <> $2 AND t.in_village > 0
+            "#,
+        )
+        .bind(alliance_ids)
+        .bind(exclude_village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(troops)
+    }
+
+    // ==================== Pledges ====================
+
+    pub async fn create_pledge(
+        pool: &PgPool,
+        call_id: Uuid,
+        player_id: Uuid,
+        from_village_id: Uuid,
+        troops: &ArmyTroops,
+    ) -> AppResult<Uuid> {
+        let id: (Uuid,) = sqlx::query_as(
+            r#"
+            INSERT INTO defense_pledges (call_id, player_id, from_village_id, troops)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id
+            "#,
+        )
+        .bind(call_id)
+        .bind(player_id)
+        .bind(from_village_id)
+        .bind(sqlx::types::Json(troops))
+        .fetch_one(pool)
+        .await?;
+
+        Ok(id.0)
+    }
+
+    pub async fn find_pledge(pool: &PgPool, id: Uuid) -> AppResult<Option<DefensePledge>> {
+        let pledge = sqlx::query_as::<_, DefensePledge>(&format!(
+            r#"
+            SELECT {PLEDGE_COLUMNS}
+            FROM defense_pledges p
+            JOIN users u ON p.player_id = u.id
+            WHERE p.id = $1
+            "#
+        ))
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(pledge)
+    }
+
+    /// A call's pledges, soonest landing first and unsent ones last
+    pub async fn find_pledges(pool: &PgPool, call_id: Uuid) -> AppResult<Vec<DefensePledge>> {
+        let pledges = sqlx::query_as::<_, DefensePledge>(&format!(
+            r#"
+            SELECT {PLEDGE_COLUMNS}
+            FROM defense_pledges p
+            JOIN users u ON p.player_id = u.id
+            WHERE p.call_id = $1
+            ORDER BY p.lands_at NULLS LAST, p.created_at
+            "#
+        ))
+        .bind(call_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(pledges)
+    }
+
+    /// Record the reinforcement a pledge became
+    pub async fn set_sent(
+        pool: &PgPool,
+        id: Uuid,
+        army_id: Uuid,
+        lands_at: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query("UPDATE defense_pledges SET army_id = $2, lands_at = $3 WHERE id = $1")
+            .bind(id)
+            .bind(army_id)
+            .bind(lands_at)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Mark the pledge sent as `army_id` as arrived, if there is one
+    pub async fn mark_arrived(pool: &PgPool, army_id: Uuid, now: DateTime<Utc>) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE defense_pledges
+            SET arrived_at = $2
+            WHERE army_id = $1 AND arrived_at IS NULL
+            "#,
+        )
+        .bind(army_id)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn delete_pledge(pool: &PgPool, id: Uuid) -> AppResult<()> {
+        sqlx::query("DELETE FROM defense_pledges WHERE id = $1")
+            .bind(id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+}
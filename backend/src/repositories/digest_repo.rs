@@ -0,0 +1,233 @@
+use chrono::{DateTime, NaiveDate, Utc};
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::digest::{
+    DigestAlliance, DigestBattle, DigestClimber, DigestContent, DigestRecipient, WeeklyDigest,
+};
+
+pub struct DigestRepository;
+
+impl DigestRepository {
+    // ==================== Sources ====================
+
+    /// Players who gained the most population since the previous week's
+    /// snapshot. Players without a snapshot count from zero.
+    pub async fn climbers(
+        pool: &PgPool,
+        previous_week: NaiveDate,
+        limit: i64,
+    ) -> AppResult<Vec<DigestClimber>> {
+        let climbers = sqlx::query_as::<_, DigestClimber>(
+            r#"
+            SELECT ps.user_id, ps.display_name, ps.population,
+                   ps.population - COALESCE(wp.population, 0) AS gained
+            FROM player_stats ps
+            JOIN users u ON u.id = ps.user_id
+            LEFT JOIN weekly_population wp
+                   ON wp.user_id = ps.user_id AND wp.week_start = $1
+            WHERE u.firebase_uid NOT LIKE 'system:%'
+              AND ps.population > COALESCE(wp.population, 0)
+            ORDER BY gained DESC, ps.user_id
+            LIMIT $2
+            "#,
+        )
+        .bind(previous_week)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(climbers)
+    }
+
+    /// Record every player's population as the end of `week_start`
+    pub async fn snapshot_population(pool: &PgPool, week_start: NaiveDate) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO weekly_population (week_start, user_id, population)
+            SELECT $1, user_id, population FROM player_stats
+            ON CONFLICT (week_start, user_id) DO UPDATE SET population = EXCLUDED.population
+            "#,
+        )
+        .bind(week_start)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Battles of the week with the most troops lost
+    pub async fn biggest_battles(
+        pool: &PgPool,
+        from: DateTime<Utc>,
+        to: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<DigestBattle>> {
+        let battles = sqlx::query_as::<_, DigestBattle>(
+            r#"
+            SELECT b.id AS report_id,
+                   b.attacker_player_id AS attacker_id, a.display_name AS attacker_name,
+                   b.defender_player_id AS defender_id, d.display_name AS defender_name,
+                   troop_total(b.attacker_losses) + troop_total(b.defender_losses)
+                       AS troops_lost,
+                   b.winner, b.occurred_at
+            FROM battle_reports b
+            JOIN users a ON a.id = b.attacker_player_id
+            LEFT JOIN users d ON d.id = b.defender_player_id
+            WHERE b.occurred_at >= $1 AND b.occurred_at < $2
+            ORDER BY troops_lost DESC, b.occurred_at
+            LIMIT $3
+            "#,
+        )
+        .bind(from)
+        .bind(to)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(battles)
+    }
+
+    /// Alliances founded during the week that still exist
+    pub async fn new_alliances(
+        pool: &PgPool,
+        from: DateTime<Utc>,
+        to: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<DigestAlliance>> {
+        let alliances = sqlx::query_as::<_, DigestAlliance>(
+            r#"
+            SELECT a.id AS alliance_id, a.name, a.tag,
+                   (SELECT COUNT(*) FROM alliance_members m WHERE m.alliance_id = a.id)
+                       AS member_count,
+                   a.created_at
+            FROM alliances a
+            WHERE a.created_at >= $1 AND a.created_at < $2
+            ORDER BY member_count DESC, a.created_at
+            LIMIT $3
+            "#,
+        )
+        .bind(from)
+        .bind(to)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(alliances)
+    }
+
+    // ==================== Digests ====================
+
+    pub async fn upsert(
+        pool: &PgPool,
+        week_start: NaiveDate,
+        content: &DigestContent,
+        now: DateTime<Utc>,
+    ) -> AppResult<WeeklyDigest> {
+        let digest = sqlx::query_as::<_, WeeklyDigest>(
+            r#"
+            INSERT INTO weekly_digests (week_start, content, generated_at)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (week_start) DO UPDATE SET
+                content = EXCLUDED.content,
+                generated_at = EXCLUDED.generated_at
+            RETURNING week_start, content, generated_at, emailed_at
+            "#,
+        )
+        .bind(week_start)
+        .bind(sqlx::types::Json(content))
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(digest)
+    }
+
+    pub async fn find(pool: &PgPool, week_start: NaiveDate) -> AppResult<Option<WeeklyDigest>> {
+        let digest = sqlx::query_as::<_, WeeklyDigest>(
+            r#"
+            SELECT week_start, content, generated_at, emailed_at
+            FROM weekly_digests
+            WHERE week_start = $1
+            "#,
+        )
+        .bind(week_start)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(digest)
+    }
+
+    pub async fn find_latest(pool: &PgPool) -> AppResult<Option<WeeklyDigest>> {
+        let digest = sqlx::query_as::<_, WeeklyDigest>(
+            r#"
+            SELECT week_start, content, generated_at, emailed_at
+            FROM weekly_digests
+            ORDER BY week_start DESC
+            LIMIT 1
+            "#,
+        )
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(digest)
+    }
+
+    /// Claim a digest for mailing. False if it was already mailed.
+    pub async fn mark_emailed(
+        pool: &PgPool,
+        week_start: NaiveDate,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE weekly_digests
+            SET emailed_at = $2
+            WHERE week_start = $1 AND emailed_at IS NULL
+            "#,
+        )
+        .bind(week_start)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Claim posting a digest to Discord; false when it already was
+    pub async fn mark_posted(
+        pool: &PgPool,
+        week_start: NaiveDate,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE weekly_digests
+            SET discord_posted_at = $2
+            WHERE week_start = $1 AND discord_posted_at IS NULL
+            "#,
+        )
+        .bind(week_start)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Players who opted in to the digest and have an address
+    pub async fn recipients(pool: &PgPool) -> AppResult<Vec<DigestRecipient>> {
+        let recipients = sqlx::query_as::<_, DigestRecipient>(
+            r#"
+            SELECT u.id AS user_id, u.email, u.display_name, p.locale
+            FROM email_preferences p
+            JOIN users u ON u.id = p.user_id
+            WHERE p.weekly_digest AND u.email IS NOT NULL AND u.deleted_at IS NULL
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(recipients)
+    }
+}
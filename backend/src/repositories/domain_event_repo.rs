@@ -0,0 +1,117 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::domain_event::DomainEvent;
+
+/// Added to the keys of the locks writers hold while their events are
+/// uncommitted, keeping them apart from other advisory locks
+const RESERVATION_KEY_OFFSET: i64 = 1 << 40;
+
+pub struct DomainEventRepository;
+
+impl DomainEventRepository {
+    /// Highest event id up to which every transaction has committed or
+    /// rolled back. Ids are assigned before commit, so a reader that
+    /// advanced past a still-running transaction's event would skip it for
+    /// good.
+    ///
+    /// A writer locks the last id handed out before drawing its first one
+    /// (migration 000082), so its ids are all above its key. Reading the
+    /// sequence before the locks means any id at or below the head was
+    /// drawn before the locks were read, and its transaction either shows
+    /// up among them or has finished.
+    pub async fn safe_head(pool: &PgPool) -> AppResult<i64> {
+        let (drawn,): (Option<i64>,) =
+            sqlx::query_as("SELECT pg_sequence_last_value('domain_events_id_seq')")
+                .fetch_one(pool)
+                .await?;
+
+        let (held,): (Option<i64>,) = sqlx::query_as(
+            r#"
+            SELECT MIN(((classid::bigint << 32) | objid::bigint) - $1)
+            FROM pg_locks
+            WHERE locktype = 'advisory'
+              AND objsubid = 1
+              AND database = (SELECT oid FROM pg_database WHERE datname = current_database())
+              AND ((classid::bigint << 32) | objid::bigint) >= $1
+            "#,
+        )
+        .bind(RESERVATION_KEY_OFFSET)
+        .fetch_one(pool)
+        .await?;
+
+        let drawn = drawn.unwrap_or(0);
+        Ok(held.map_or(drawn, |held| held.min(drawn)))
+    }
+
+    pub async fn oldest_id(pool: &PgPool) -> AppResult<Option<i64>> {
+        let oldest: (Option<i64>,) = sqlx::query_as("SELECT MIN(id) FROM domain_events")
+            .fetch_one(pool)
+            .await?;
+
+        Ok(oldest.0)
+    }
+
+    /// Events for one player in (after, up_to], oldest first
+    pub async fn find_for_user(
+        pool: &PgPool,
+        user_id: Uuid,
+        after: i64,
+        up_to: i64,
+        limit: i64,
+    ) -> AppResult<Vec<DomainEvent>> {
+        let events = sqlx::query_as::<_, DomainEvent>(
+            r#"
+            SELECT id, user_id, entity_type, entity_id, village_id, action, created_at
+            FROM domain_events
+            WHERE user_id = $1 AND id > $2 AND id <= $3
+            ORDER BY id
+            LIMIT $4
+            "#,
+        )
+        .bind(user_id)
+        .bind(after)
+        .bind(up_to)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(events)
+    }
+
+    /// Events for every player in (after, up_to], oldest first
+    pub async fn find_after(
+        pool: &PgPool,
+        after: i64,
+        up_to: i64,
+        limit: i64,
+    ) -> AppResult<Vec<DomainEvent>> {
+        let events = sqlx::query_as::<_, DomainEvent>(
+            r#"
+            SELECT id, user_id, entity_type, entity_id, village_id, action, created_at
+            FROM domain_events
+            WHERE id > $1 AND id <= $2
+            ORDER BY id
+            LIMIT $3
+            "#,
+        )
+        .bind(after)
+        .bind(up_to)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(events)
+    }
+
+    pub async fn delete_before(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM domain_events WHERE created_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+}
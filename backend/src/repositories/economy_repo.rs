@@ -0,0 +1,132 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::economy::{
+    EconomyFlow, LedgerDirection, LedgerEntry, LedgerKind, NewLedgerEntry, TradeHistoryQuery,
+};
+
+pub struct EconomyRepository;
+
+impl EconomyRepository {
+    pub async fn insert(pool: &PgPool, entry: &NewLedgerEntry) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO economy_ledger (
+                kind, from_user_id, to_user_id, from_village_id, to_village_id,
+                wood, clay, iron, crop, source_id
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            "#,
+        )
+        .bind(entry.kind)
+        .bind(entry.from_user_id)
+        .bind(entry.to_user_id)
+        .bind(entry.from_village_id)
+        .bind(entry.to_village_id)
+        .bind(entry.resources.wood)
+        .bind(entry.resources.clay)
+        .bind(entry.resources.iron)
+        .bind(entry.resources.crop)
+        .bind(entry.source_id)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Transfers in and out of a player's account, newest first
+    pub async fn history(
+        pool: &PgPool,
+        user_id: Uuid,
+        query: &TradeHistoryQuery,
+    ) -> AppResult<Vec<LedgerEntry>> {
+        let outgoing = query.direction != Some(LedgerDirection::Incoming);
+        let incoming = query.direction != Some(LedgerDirection::Outgoing);
+
+        let entries = sqlx::query_as::<_, LedgerEntry>(
+            r#"
+            SELECT l.id, l.kind, l.from_user_id, f.display_name AS from_name,
+                   l.to_user_id, t.display_name AS to_name,
+                   l.from_village_id, l.to_village_id, l.wood, l.clay, l.iron, l.crop,
+                   l.source_id, l.created_at
+            FROM economy_ledger l
+            LEFT JOIN users f ON f.id = l.from_user_id
+            LEFT JOIN users t ON t.id = l.to_user_id
+            WHERE ((l.from_user_id = $1 AND $2) OR (l.to_user_id = $1 AND $3))
+              AND ($4::ledger_kind IS NULL OR l.kind = $4)
+              AND ($5::UUID IS NULL OR l.from_user_id = $5 OR l.to_user_id = $5)
+            ORDER BY l.created_at DESC, l.id DESC
+            LIMIT $6 OFFSET $7
+            "#,
+        )
+        .bind(user_id)
+        .bind(outgoing)
+        .bind(incoming)
+        .bind(query.kind)
+        .bind(query.counterpart_id)
+        .bind(query.limit.clamp(1, 200))
+        .bind(query.offset.max(0))
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+
+    /// Totals per (from, to) pair of different accounts since `since`,
+    /// with what went back the other way, largest net flow first
+    pub async fn flows(
+        pool: &PgPool,
+        since: DateTime<Utc>,
+        kind: Option<LedgerKind>,
+        user_id: Option<Uuid>,
+        min_total: i64,
+        limit: i64,
+    ) -> AppResult<Vec<EconomyFlow>> {
+        let flows = sqlx::query_as::<_, EconomyFlow>(
+            r#"
+            WITH pairs AS (
+                SELECT from_user_id, to_user_id,
+                       COUNT(*) AS transfers,
+                       SUM(wood)::BIGINT AS wood,
+                       SUM(clay)::BIGINT AS clay,
+                       SUM(iron)::BIGINT AS iron,
+                       SUM(crop)::BIGINT AS crop,
+                       SUM(wood + clay + iron + crop)::BIGINT AS total,
+                       MIN(created_at) AS first_at,
+                       MAX(created_at) AS last_at
+                FROM economy_ledger
+                WHERE created_at >= $1
+                  AND ($2::ledger_kind IS NULL OR kind = $2)
+                  AND ($3::UUID IS NULL OR from_user_id = $3 OR to_user_id = $3)
+                  AND from_user_id IS NOT NULL AND to_user_id IS NOT NULL
+                  AND from_user_id <> to_user_id
+                GROUP BY from_user_id, to_user_id
+            )
+            SELECT p.from_user_id, f.display_name AS from_name,
+                   p.to_user_id, t.display_name AS to_name,
+                   p.transfers, p.wood, p.clay, p.iron, p.crop, p.total,
+                   COALESCE(r.total, 0) AS returned,
+                   p.total - COALESCE(r.total, 0) AS net,
+                   p.first_at, p.last_at
+            FROM pairs p
+            LEFT JOIN pairs r ON r.from_user_id = p.to_user_id AND r.to_user_id = p.from_user_id
+            LEFT JOIN users f ON f.id = p.from_user_id
+            LEFT JOIN users t ON t.id = p.to_user_id
+            WHERE p.total >= $4
+            ORDER BY net DESC, p.total DESC
+            LIMIT $5
+            "#,
+        )
+        .bind(since)
+        .bind(kind)
+        .bind(user_id)
+        .bind(min_total)
+        .bind(limit.clamp(1, 500))
+        .fetch_all(pool)
+        .await?;
+
+        Ok(flows)
+    }
+}
@@ -0,0 +1,46 @@
+use serde_json::Value;
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::gamedata::GameDataVersion;
+
+pub struct GameDataRepository;
+
+impl GameDataRepository {
+    /// Publish a catalog; a version that already exists is left as is
+    pub async fn publish(pool: &PgPool, version: &str, data: &Value) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO gamedata_catalogs (version, data)
+            VALUES ($1, $2)
+            ON CONFLICT (version) DO NOTHING
+            "#,
+        )
+        .bind(version)
+        .bind(data)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn find(pool: &PgPool, version: &str) -> AppResult<Option<Value>> {
+        let data: Option<(Value,)> =
+            sqlx::query_as("SELECT data FROM gamedata_catalogs WHERE version = $1")
+                .bind(version)
+                .fetch_optional(pool)
+                .await?;
+
+        Ok(data.map(|d| d.0))
+    }
+
+    pub async fn list_versions(pool: &PgPool) -> AppResult<Vec<GameDataVersion>> {
+        let versions = sqlx::query_as::<_, GameDataVersion>(
+            "SELECT version, created_at FROM gamedata_catalogs ORDER BY created_at DESC",
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(versions)
+    }
+}
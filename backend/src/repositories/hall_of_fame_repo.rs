@@ -0,0 +1,132 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::hall_of_fame::{FinalStanding, HallOfFameEntry, Medal};
+
+pub struct HallOfFameRepository;
+
+impl HallOfFameRepository {
+    /// Every real player's final standing, read from the world's own
+    /// database. Ranks follow the population ranking.
+    pub async fn final_standings(world_pool: &PgPool) -> AppResult<Vec<FinalStanding>> {
+        let standings = sqlx::query_as::<_, FinalStanding>(
+            r#"
+            SELECT ps.user_id, u.firebase_uid, ps.display_name, u.tribe,
+                   ROW_NUMBER() OVER (ORDER BY ps.population DESC, ps.user_id)::INT AS final_rank,
+                   ps.population, ps.village_count, ps.culture_points,
+                   ps.alliance_id, a.name AS alliance_name, ps.alliance_tag,
+                   a.rank AS alliance_rank
+            FROM player_stats ps
+            JOIN users u ON u.id = ps.user_id
+            LEFT JOIN (
+                SELECT alliance_id, name,
+                       ROW_NUMBER() OVER (ORDER BY total_population DESC, alliance_id)::INT AS rank
+                FROM alliance_stats
+            ) a ON a.alliance_id = ps.alliance_id
+            WHERE u.firebase_uid NOT LIKE 'system:%'
+            ORDER BY final_rank
+            "#,
+        )
+        .fetch_all(world_pool)
+        .await?;
+
+        Ok(standings)
+    }
+
+    /// Record a player's result; finishing a world again overwrites it
+    pub async fn upsert(
+        pool: &PgPool,
+        world_id: &str,
+        standing: &FinalStanding,
+        medals: &[Medal],
+        ended_at: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO hall_of_fame (
+                world_id, firebase_uid, display_name, tribe, final_rank, population,
+                village_count, culture_points, alliance_name, alliance_tag, alliance_rank,
+                medals, ended_at
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+            ON CONFLICT (world_id, firebase_uid) DO UPDATE SET
+                display_name = EXCLUDED.display_name,
+                tribe = EXCLUDED.tribe,
+                final_rank = EXCLUDED.final_rank,
+                population = EXCLUDED.population,
+                village_count = EXCLUDED.village_count,
+                culture_points = EXCLUDED.culture_points,
+                alliance_name = EXCLUDED.alliance_name,
+                alliance_tag = EXCLUDED.alliance_tag,
+                alliance_rank = EXCLUDED.alliance_rank,
+                medals = EXCLUDED.medals,
+                ended_at = EXCLUDED.ended_at
+            "#,
+        )
+        .bind(world_id)
+        .bind(&standing.firebase_uid)
+        .bind(&standing.display_name)
+        .bind(standing.tribe)
+        .bind(standing.final_rank)
+        .bind(standing.population)
+        .bind(standing.village_count)
+        .bind(standing.culture_points)
+        .bind(&standing.alliance_name)
+        .bind(&standing.alliance_tag)
+        .bind(standing.alliance_rank)
+        .bind(sqlx::types::Json(medals))
+        .bind(ended_at)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn find_by_account(
+        pool: &PgPool,
+        firebase_uid: &str,
+    ) -> AppResult<Vec<HallOfFameEntry>> {
+        let entries = sqlx::query_as::<_, HallOfFameEntry>(
+            r#"
+            SELECT world_id, firebase_uid, display_name, tribe, final_rank, population,
+                   village_count, culture_points, alliance_name, alliance_tag, alliance_rank,
+                   medals, ended_at
+            FROM hall_of_fame
+            WHERE firebase_uid = $1
+            ORDER BY ended_at DESC
+            "#,
+        )
+        .bind(firebase_uid)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+
+    pub async fn list_world(
+        pool: &PgPool,
+        world_id: &str,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<HallOfFameEntry>> {
+        let entries = sqlx::query_as::<_, HallOfFameEntry>(
+            r#"
+            SELECT world_id, firebase_uid, display_name, tribe, final_rank, population,
+                   village_count, culture_points, alliance_name, alliance_tag, alliance_rank,
+                   medals, ended_at
+            FROM hall_of_fame
+            WHERE world_id = $1
+            ORDER BY final_rank
+            LIMIT $2 OFFSET $3
+            "#,
+        )
+        .bind(world_id)
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+}
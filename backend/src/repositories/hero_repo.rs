@@ -2,10 +2,10 @@ use chrono::{DateTime, Utc};
 use sqlx::PgPool;
 use uuid::Uuid;
 
-use crate::error::AppResult;
+use crate::error::{AppError, AppResult};
 use crate::models::hero::{
     AvailableAdventure, Hero, HeroAdventure, HeroItem, HeroItemWithDefinition, HeroSlotPrice,
-    HeroStatus, ItemDefinition, ItemRarity, ItemSlot, AdventureDifficulty,
+    HeroStatus, ItemDefinition, ItemRarity, ItemSlot, AdventureDifficulty, ResourceFocus,
 };
 use crate::models::troop::TribeType;
 
@@ -22,7 +22,8 @@ impl HeroRepository {
                    status, level, experience, experience_to_next, health, health_regen_rate,
                    unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                    base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                   created_at, updated_at
+                   resource_focus, resource_focus_changed_at, attributes_reset_at,
+                   created_at, updated_at, version
             FROM heroes
             WHERE user_id = $1
             ORDER BY slot_number
@@ -43,7 +44,8 @@ impl HeroRepository {
                    status, level, experience, experience_to_next, health, health_regen_rate,
                    unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                    base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                   created_at, updated_at
+                   resource_focus, resource_focus_changed_at, attributes_reset_at,
+                   created_at, updated_at, version
             FROM heroes
             WHERE id = $1
             "#,
@@ -55,7 +57,48 @@ impl HeroRepository {
         Ok(hero)
     }
 
+    pub async fn find_by_ids(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<Hero>> {
+        let heroes = sqlx::query_as::<_, Hero>(
+            r#"
+            SELECT id, user_id, slot_number, name, tribe, home_village_id, current_village_id,
+                   status, level, experience, experience_to_next, health, health_regen_rate,
+                   unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
+                   base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
+                   resource_focus, resource_focus_changed_at, attributes_reset_at,
+                   created_at, updated_at, version
+            FROM heroes
+            WHERE id = ANY($1)
+            "#,
+        )
+        .bind(ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(heroes)
+    }
+
     /// Get hero by user and slot
+    /// Heroes whose home is the given village
+    pub async fn find_by_home_village(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<Hero>> {
+        let heroes = sqlx::query_as::<_, Hero>(
+            r#"
+            SELECT id, user_id, slot_number, name, tribe, home_village_id, current_village_id,
+                   status, level, experience, experience_to_next, health, health_regen_rate,
+                   unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
+                   base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
+                   resource_focus, resource_focus_changed_at, attributes_reset_at,
+                   created_at, updated_at, version
+            FROM heroes
+            WHERE home_village_id = $1
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(heroes)
+    }
+
     pub async fn find_by_slot(pool: &PgPool, user_id: Uuid, slot: i32) -> AppResult<Option<Hero>> {
         let hero = sqlx::query_as::<_, Hero>(
             r#"
@@ -63,7 +106,8 @@ impl HeroRepository {
                    status, level, experience, experience_to_next, health, health_regen_rate,
                    unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                    base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                   created_at, updated_at
+                   resource_focus, resource_focus_changed_at, attributes_reset_at,
+                   created_at, updated_at, version
             FROM heroes
             WHERE user_id = $1 AND slot_number = $2
             "#,
@@ -128,7 +172,8 @@ impl HeroRepository {
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(user_id)
@@ -145,28 +190,32 @@ impl HeroRepository {
         Ok(hero)
     }
 
-    /// Update hero home village
+    /// Update hero home village (compare-and-swap on version)
     pub async fn update_home_village(
         pool: &PgPool,
         hero_id: Uuid,
+        expected_version: i32,
         village_id: Uuid,
     ) -> AppResult<Hero> {
         let hero = sqlx::query_as::<_, Hero>(
             r#"
             UPDATE heroes
-            SET home_village_id = $2, updated_at = NOW()
-            WHERE id = $1
+            SET home_village_id = $3, updated_at = NOW()
+            WHERE id = $1 AND version = $2
             RETURNING id, user_id, slot_number, name, tribe, home_village_id, current_village_id,
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(hero_id)
+        .bind(expected_version)
         .bind(village_id)
-        .fetch_one(pool)
-        .await?;
+        .fetch_optional(pool)
+        .await?
+        .ok_or_else(|| AppError::VersionConflict("Hero was modified, please retry".into()))?;
 
         Ok(hero)
     }
@@ -186,7 +235,8 @@ impl HeroRepository {
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(hero_id)
@@ -197,10 +247,11 @@ impl HeroRepository {
         Ok(hero)
     }
 
-    /// Assign attribute points
+    /// Assign attribute points (compare-and-swap on version)
     pub async fn assign_attributes(
         pool: &PgPool,
         hero_id: Uuid,
+        expected_version: i32,
         fighting_strength: i32,
         off_bonus: i32,
         def_bonus: i32,
@@ -216,12 +267,13 @@ impl HeroRepository {
                 resources_bonus = resources_bonus + $5,
                 unassigned_points = unassigned_points - $6,
                 updated_at = NOW()
-            WHERE id = $1
+            WHERE id = $1 AND version = $7
             RETURNING id, user_id, slot_number, name, tribe, home_village_id, current_village_id,
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(hero_id)
@@ -230,8 +282,80 @@ impl HeroRepository {
         .bind(def_bonus)
         .bind(resources_bonus)
         .bind(points_spent)
-        .fetch_one(pool)
-        .await?;
+        .bind(expected_version)
+        .fetch_optional(pool)
+        .await?
+        .ok_or_else(|| AppError::VersionConflict("Hero was modified, please retry".into()))?;
+
+        Ok(hero)
+    }
+
+    /// Switch where resource points go (compare-and-swap on version)
+    pub async fn set_resource_focus(
+        pool: &PgPool,
+        hero_id: Uuid,
+        expected_version: i32,
+        focus: ResourceFocus,
+        changed_at: DateTime<Utc>,
+    ) -> AppResult<Hero> {
+        let hero = sqlx::query_as::<_, Hero>(
+            r#"
+            UPDATE heroes
+            SET resource_focus = $3, resource_focus_changed_at = $4, updated_at = NOW()
+            WHERE id = $1 AND version = $2
+            RETURNING id, user_id, slot_number, name, tribe, home_village_id, current_village_id,
+                      status, level, experience, experience_to_next, health, health_regen_rate,
+                      unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
+                      base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
+            "#,
+        )
+        .bind(hero_id)
+        .bind(expected_version)
+        .bind(focus)
+        .bind(changed_at)
+        .fetch_optional(pool)
+        .await?
+        .ok_or_else(|| AppError::VersionConflict("Hero was modified, please retry".into()))?;
+
+        Ok(hero)
+    }
+
+    /// Return every assigned attribute point to the unassigned pool
+    /// (compare-and-swap on version)
+    pub async fn reset_attributes(
+        pool: &PgPool,
+        hero_id: Uuid,
+        expected_version: i32,
+        reset_at: DateTime<Utc>,
+    ) -> AppResult<Hero> {
+        let hero = sqlx::query_as::<_, Hero>(
+            r#"
+            UPDATE heroes
+            SET unassigned_points = unassigned_points + fighting_strength + off_bonus
+                                    + def_bonus + resources_bonus,
+                fighting_strength = 0,
+                off_bonus = 0,
+                def_bonus = 0,
+                resources_bonus = 0,
+                attributes_reset_at = $3,
+                updated_at = NOW()
+            WHERE id = $1 AND version = $2
+            RETURNING id, user_id, slot_number, name, tribe, home_village_id, current_village_id,
+                      status, level, experience, experience_to_next, health, health_regen_rate,
+                      unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
+                      base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
+            "#,
+        )
+        .bind(hero_id)
+        .bind(expected_version)
+        .bind(reset_at)
+        .fetch_optional(pool)
+        .await?
+        .ok_or_else(|| AppError::VersionConflict("Hero was modified, please retry".into()))?;
 
         Ok(hero)
     }
@@ -269,7 +393,8 @@ impl HeroRepository {
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(hero_id)
@@ -284,10 +409,15 @@ impl HeroRepository {
     }
 
     /// Update hero health
-    pub async fn update_health(pool: &PgPool, hero_id: Uuid, health: i32) -> AppResult<Hero> {
+    pub async fn update_health(
+        pool: &PgPool,
+        hero_id: Uuid,
+        health: i32,
+        now: DateTime<Utc>,
+    ) -> AppResult<Hero> {
         let health = health.clamp(0, 100);
         let (status, died_at): (HeroStatus, Option<DateTime<Utc>>) = if health <= 0 {
-            (HeroStatus::Dead, Some(Utc::now()))
+            (HeroStatus::Dead, Some(now))
         } else {
             (HeroStatus::Idle, None)
         };
@@ -305,7 +435,8 @@ impl HeroRepository {
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(hero_id)
@@ -319,18 +450,23 @@ impl HeroRepository {
     }
 
     /// Damage hero (reduce health)
-    pub async fn damage_hero(pool: &PgPool, hero_id: Uuid, damage: i32) -> AppResult<Hero> {
+    pub async fn damage_hero(
+        pool: &PgPool,
+        hero_id: Uuid,
+        damage: i32,
+        now: DateTime<Utc>,
+    ) -> AppResult<Hero> {
         let hero = Self::find_by_id(pool, hero_id)
             .await?
             .ok_or_else(|| crate::error::AppError::NotFound("Hero not found".into()))?;
 
         let new_health = (hero.health - damage).max(0);
-        Self::update_health(pool, hero_id, new_health).await
+        Self::update_health(pool, hero_id, new_health, now).await
     }
 
     /// Kill hero
-    pub async fn kill_hero(pool: &PgPool, hero_id: Uuid) -> AppResult<Hero> {
-        let revive_at = Utc::now() + chrono::Duration::hours(24); // 24 hour revive time
+    pub async fn kill_hero(pool: &PgPool, hero_id: Uuid, now: DateTime<Utc>) -> AppResult<Hero> {
+        let revive_at = now + chrono::Duration::hours(24); // 24 hour revive time
 
         let hero = sqlx::query_as::<_, Hero>(
             r#"
@@ -345,7 +481,8 @@ impl HeroRepository {
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(hero_id)
@@ -372,7 +509,8 @@ impl HeroRepository {
                       status, level, experience, experience_to_next, health, health_regen_rate,
                       unassigned_points, fighting_strength, off_bonus, def_bonus, resources_bonus,
                       base_attack, base_defense, base_speed, last_health_update, died_at, revive_at,
-                      created_at, updated_at
+                      resource_focus, resource_focus_changed_at, attributes_reset_at,
+                      created_at, updated_at, version
             "#,
         )
         .bind(hero_id)
@@ -670,6 +808,29 @@ impl HeroRepository {
         Ok(())
     }
 
+    /// Take part or all of an unequipped stack out of the inventory.
+    /// False if the item is equipped or holds fewer than `quantity`.
+    pub async fn take_item(pool: &PgPool, item_id: Uuid, quantity: i32) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE hero_items
+            SET quantity = quantity - $2
+            WHERE id = $1 AND quantity >= $2 AND is_equipped = FALSE
+            "#,
+        )
+        .bind(item_id)
+        .bind(quantity)
+        .execute(pool)
+        .await?;
+
+        sqlx::query("DELETE FROM hero_items WHERE id = $1 AND quantity <= 0")
+            .bind(item_id)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
     /// Delete item
     pub async fn delete_item(pool: &PgPool, item_id: Uuid) -> AppResult<()> {
         sqlx::query("DELETE FROM hero_items WHERE id = $1")
@@ -686,17 +847,19 @@ impl HeroRepository {
     pub async fn get_available_adventures(
         pool: &PgPool,
         user_id: Uuid,
+        now: DateTime<Utc>,
     ) -> AppResult<Vec<AvailableAdventure>> {
         let adventures = sqlx::query_as::<_, AvailableAdventure>(
             r#"
             SELECT id, user_id, difficulty, min_duration_seconds, max_duration_seconds,
                    potential_reward_type, potential_item_rarity, expires_at, is_taken, created_at
             FROM available_adventures
-            WHERE user_id = $1 AND is_taken = FALSE AND expires_at > NOW()
+            WHERE user_id = $1 AND is_taken = FALSE AND expires_at > $2
             ORDER BY expires_at
             "#,
         )
         .bind(user_id)
+        .bind(now)
         .fetch_all(pool)
         .await?;
 
@@ -774,8 +937,9 @@ impl HeroRepository {
         hero_id: Uuid,
         difficulty: AdventureDifficulty,
         duration_seconds: i32,
+        now: DateTime<Utc>,
     ) -> AppResult<HeroAdventure> {
-        let ends_at = Utc::now() + chrono::Duration::seconds(duration_seconds as i64);
+        let ends_at = now + chrono::Duration::seconds(duration_seconds as i64);
 
         let adventure = sqlx::query_as::<_, HeroAdventure>(
             r#"
@@ -816,7 +980,7 @@ impl HeroRepository {
         Ok(adventure)
     }
 
-    /// Complete adventure with rewards
+    /// Complete adventure with rewards. None if it was already completed.
     pub async fn complete_adventure(
         pool: &PgPool,
         adventure_id: Uuid,
@@ -825,7 +989,7 @@ impl HeroRepository {
         resources: Option<serde_json::Value>,
         item_id: Option<Uuid>,
         health_lost: i32,
-    ) -> AppResult<HeroAdventure> {
+    ) -> AppResult<Option<HeroAdventure>> {
         let adventure = sqlx::query_as::<_, HeroAdventure>(
             r#"
             UPDATE hero_adventures
@@ -836,7 +1000,7 @@ impl HeroRepository {
                 reward_resources = $4,
                 reward_item_id = $5,
                 health_lost = $6
-            WHERE id = $1
+            WHERE id = $1 AND is_completed = FALSE
             RETURNING id, hero_id, difficulty, started_at, duration_seconds, ends_at,
                       is_completed, completed_at, reward_experience, reward_silver,
                       reward_resources, reward_item_id, health_lost, created_at
@@ -848,7 +1012,7 @@ impl HeroRepository {
         .bind(resources)
         .bind(item_id)
         .bind(health_lost)
-        .fetch_one(pool)
+        .fetch_optional(pool)
         .await?;
 
         Ok(adventure)
@@ -880,16 +1044,20 @@ impl HeroRepository {
     }
 
     /// Find completed adventures that need processing
-    pub async fn find_completed_adventures(pool: &PgPool) -> AppResult<Vec<HeroAdventure>> {
+    pub async fn find_completed_adventures(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<HeroAdventure>> {
         let adventures = sqlx::query_as::<_, HeroAdventure>(
             r#"
             SELECT id, hero_id, difficulty, started_at, duration_seconds, ends_at,
                    is_completed, completed_at, reward_experience, reward_silver,
                    reward_resources, reward_item_id, health_lost, created_at
             FROM hero_adventures
-            WHERE is_completed = FALSE AND ends_at <= NOW()
+            WHERE is_completed = FALSE AND ends_at <= $1
             "#,
         )
+        .bind(now)
         .fetch_all(pool)
         .await?;
 
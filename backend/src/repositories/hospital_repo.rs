@@ -0,0 +1,184 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::hospital::{HealingQueueEntry, WoundedTroop};
+use crate::models::troop::TroopType;
+
+pub struct HospitalRepository;
+
+impl HospitalRepository {
+    // ==================== Wounded ====================
+
+    pub async fn find_wounded(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<WoundedTroop>> {
+        let rows = sqlx::query_as::<_, WoundedTroop>(
+            r#"
+            SELECT village_id, troop_type, count, updated_at
+            FROM wounded_troops
+            WHERE village_id = $1 AND count > 0
+            ORDER BY troop_type
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows)
+    }
+
+    pub async fn add_wounded(
+        pool: &PgPool,
+        village_id: Uuid,
+        troop_type: TroopType,
+        count: i32,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO wounded_troops (village_id, troop_type, count)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (village_id, troop_type) DO UPDATE
+            SET count = wounded_troops.count + EXCLUDED.count,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(village_id)
+        .bind(troop_type)
+        .bind(count)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Take wounded out of their beds. False if there aren't that many.
+    pub async fn take_wounded(
+        pool: &PgPool,
+        village_id: Uuid,
+        troop_type: TroopType,
+        count: i32,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE wounded_troops
+            SET count = count - $3,
+                updated_at = NOW()
+            WHERE village_id = $1 AND troop_type = $2 AND count >= $3
+            "#,
+        )
+        .bind(village_id)
+        .bind(troop_type)
+        .bind(count)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    // ==================== Healing Queue ====================
+
+    pub async fn find_queue(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<HealingQueueEntry>> {
+        let entries = sqlx::query_as::<_, HealingQueueEntry>(
+            r#"
+            SELECT id, village_id, troop_type, count, started_at, ends_at, created_at
+            FROM healing_queue
+            WHERE village_id = $1
+            ORDER BY ends_at ASC
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+
+    /// When the village's last queued healing ends, if any
+    pub async fn queue_ends_at(
+        pool: &PgPool,
+        village_id: Uuid,
+    ) -> AppResult<Option<DateTime<Utc>>> {
+        let ends_at = sqlx::query_scalar::<_, Option<DateTime<Utc>>>(
+            "SELECT MAX(ends_at) FROM healing_queue WHERE village_id = $1",
+        )
+        .bind(village_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(ends_at)
+    }
+
+    pub async fn enqueue(
+        pool: &PgPool,
+        village_id: Uuid,
+        troop_type: TroopType,
+        count: i32,
+        started_at: DateTime<Utc>,
+        ends_at: DateTime<Utc>,
+    ) -> AppResult<HealingQueueEntry> {
+        let entry = sqlx::query_as::<_, HealingQueueEntry>(
+            r#"
+            INSERT INTO healing_queue (village_id, troop_type, count, started_at, ends_at)
+            VALUES ($1, $2, $3, $4, $5)
+            RETURNING id, village_id, troop_type, count, started_at, ends_at, created_at
+            "#,
+        )
+        .bind(village_id)
+        .bind(troop_type)
+        .bind(count)
+        .bind(started_at)
+        .bind(ends_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(entry)
+    }
+
+    pub async fn find_completed(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<HealingQueueEntry>> {
+        let entries = sqlx::query_as::<_, HealingQueueEntry>(
+            r#"
+            SELECT id, village_id, troop_type, count, started_at, ends_at, created_at
+            FROM healing_queue
+            WHERE ends_at <= $1
+            ORDER BY ends_at ASC
+            "#,
+        )
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+
+    /// Move healed troops from the queue back into the village in one
+    /// statement. None if they were already released.
+    pub async fn complete(pool: &PgPool, id: Uuid) -> AppResult<Option<HealingQueueEntry>> {
+        let entry = sqlx::query_as::<_, HealingQueueEntry>(
+            r#"
+            WITH done AS (
+                DELETE FROM healing_queue
+                WHERE id = $1
+                RETURNING id, village_id, troop_type, count, started_at, ends_at, created_at
+            ),
+            healed AS (
+                INSERT INTO troops (village_id, troop_type, count, in_village)
+                SELECT village_id, troop_type, count, count FROM done
+                ON CONFLICT (village_id, troop_type) DO UPDATE
+                SET count = troops.count + EXCLUDED.count,
+                    in_village = troops.in_village + EXCLUDED.in_village,
+                    updated_at = NOW()
+            )
+            SELECT id, village_id, troop_type, count, started_at, ends_at, created_at
+            FROM done
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(entry)
+    }
+}
@@ -0,0 +1,126 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::impersonation::{ImpersonationQuery, ImpersonationSession};
+
+pub struct ImpersonationRepository;
+
+impl ImpersonationRepository {
+    pub async fn create(
+        pool: &PgPool,
+        admin_id: Uuid,
+        player_id: Uuid,
+        token_hash: &str,
+        allow_write: bool,
+        reason: &str,
+        expires_at: DateTime<Utc>,
+    ) -> AppResult<ImpersonationSession> {
+        let session = sqlx::query_as::<_, ImpersonationSession>(
+            r#"
+            INSERT INTO impersonation_sessions (
+                admin_id, player_id, token_hash, allow_write, reason, expires_at
+            )
+            VALUES ($1, $2, $3, $4, $5, $6)
+            RETURNING id, admin_id, player_id, allow_write, reason, created_at, expires_at,
+                      ended_at
+            "#,
+        )
+        .bind(admin_id)
+        .bind(player_id)
+        .bind(token_hash)
+        .bind(allow_write)
+        .bind(reason)
+        .bind(expires_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(session)
+    }
+
+    /// The session with this token hash, unless it ended or expired
+    pub async fn find_active_by_hash(
+        pool: &PgPool,
+        token_hash: &str,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<ImpersonationSession>> {
+        let session = sqlx::query_as::<_, ImpersonationSession>(
+            r#"
+            SELECT id, admin_id, player_id, allow_write, reason, created_at, expires_at, ended_at
+            FROM impersonation_sessions
+            WHERE token_hash = $1 AND ended_at IS NULL AND expires_at > $2
+            "#,
+        )
+        .bind(token_hash)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(session)
+    }
+
+    pub async fn list(
+        pool: &PgPool,
+        query: &ImpersonationQuery,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<ImpersonationSession>> {
+        let sessions = sqlx::query_as::<_, ImpersonationSession>(
+            r#"
+            SELECT id, admin_id, player_id, allow_write, reason, created_at, expires_at, ended_at
+            FROM impersonation_sessions
+            WHERE ($1::uuid IS NULL OR player_id = $1)
+                AND (NOT $2 OR (ended_at IS NULL AND expires_at > $3))
+            ORDER BY created_at DESC
+            LIMIT 200
+            "#,
+        )
+        .bind(query.player_id)
+        .bind(query.active_only)
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(sessions)
+    }
+
+    /// End a session that is still open; None if there is none
+    pub async fn end(
+        pool: &PgPool,
+        id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<ImpersonationSession>> {
+        let session = sqlx::query_as::<_, ImpersonationSession>(
+            r#"
+            UPDATE impersonation_sessions
+            SET ended_at = $2
+            WHERE id = $1 AND ended_at IS NULL AND expires_at > $2
+            RETURNING id, admin_id, player_id, allow_write, reason, created_at, expires_at,
+                      ended_at
+            "#,
+        )
+        .bind(id)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(session)
+    }
+
+    /// End every open session an admin started; the number ended
+    pub async fn end_by_admin(pool: &PgPool, admin_id: Uuid, now: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE impersonation_sessions
+            SET ended_at = $2
+            WHERE admin_id = $1 AND ended_at IS NULL AND expires_at > $2
+            "#,
+        )
+        .bind(admin_id)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+}
@@ -0,0 +1,31 @@
+use sqlx::PgPool;
+
+use crate::db::invariants::{count_sql, Invariant};
+use crate::error::AppResult;
+
+pub struct InvariantRepository;
+
+impl InvariantRepository {
+    /// Number of rows breaking the invariant and up to `sample` of them
+    pub async fn count(
+        pool: &PgPool,
+        invariant: &Invariant,
+        sample: usize,
+    ) -> AppResult<(i64, Vec<String>)> {
+        let row = sqlx::query_as::<_, (i64, Vec<String>)>(&count_sql(invariant, sample))
+            .fetch_one(pool)
+            .await?;
+
+        Ok(row)
+    }
+
+    /// Apply the invariant's repair; returns the rows it touched
+    pub async fn fix(pool: &PgPool, invariant: &Invariant) -> AppResult<u64> {
+        let Some(sql) = invariant.fix else {
+            return Ok(0);
+        };
+        let result = sqlx::query(sql).execute(pool).await?;
+
+        Ok(result.rows_affected())
+    }
+}
@@ -0,0 +1,122 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::ip_reputation::{IpCategory, IpRange, IpRangeQuery};
+
+pub struct IpReputationRepository;
+
+impl IpReputationRepository {
+    /// Category of the narrowest local range containing `ip`
+    pub async fn match_range(pool: &PgPool, ip: &str) -> AppResult<Option<IpCategory>> {
+        let category: Option<(IpCategory,)> = sqlx::query_as(
+            r#"
+            SELECT category
+            FROM ip_ranges
+            WHERE cidr >>= $1::inet
+            ORDER BY masklen(cidr) DESC
+            LIMIT 1
+            "#,
+        )
+        .bind(ip)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(category.map(|(c,)| c))
+    }
+
+    /// Cached provider answer checked after `fresh_after`. `Some(None)` is
+    /// a fresh "nothing known".
+    pub async fn find_lookup(
+        pool: &PgPool,
+        ip: &str,
+        fresh_after: DateTime<Utc>,
+    ) -> AppResult<Option<Option<IpCategory>>> {
+        let lookup: Option<(Option<IpCategory>,)> = sqlx::query_as(
+            "SELECT category FROM ip_lookups WHERE ip = $1::inet AND checked_at >= $2",
+        )
+        .bind(ip)
+        .bind(fresh_after)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(lookup.map(|(c,)| c))
+    }
+
+    pub async fn save_lookup(
+        pool: &PgPool,
+        ip: &str,
+        category: Option<IpCategory>,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO ip_lookups (ip, category, checked_at)
+            VALUES ($1::inet, $2, $3)
+            ON CONFLICT (ip) DO UPDATE
+            SET category = EXCLUDED.category, checked_at = EXCLUDED.checked_at
+            "#,
+        )
+        .bind(ip)
+        .bind(category)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn list_ranges(pool: &PgPool, query: &IpRangeQuery) -> AppResult<Vec<IpRange>> {
+        let ranges = sqlx::query_as::<_, IpRange>(
+            r#"
+            SELECT id, cidr::text AS cidr, category, source, created_at
+            FROM ip_ranges
+            WHERE ($1::ip_category IS NULL OR category = $1)
+            ORDER BY id DESC
+            LIMIT $2 OFFSET $3
+            "#,
+        )
+        .bind(query.category)
+        .bind(query.limit.min(1000).max(1))
+        .bind(query.offset.max(0))
+        .fetch_all(pool)
+        .await?;
+
+        Ok(ranges)
+    }
+
+    /// Add ranges, updating the category of ones already listed. Host bits
+    /// are dropped, so `10.1.2.3/8` lists `10.0.0.0/8`.
+    pub async fn upsert_ranges(
+        pool: &PgPool,
+        cidrs: &[String],
+        category: IpCategory,
+        source: &str,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO ip_ranges (cidr, category, source)
+            SELECT DISTINCT network(c::inet), $2::ip_category, $3
+            FROM UNNEST($1::text[]) AS c
+            ON CONFLICT (cidr) DO UPDATE
+            SET category = EXCLUDED.category, source = EXCLUDED.source
+            "#,
+        )
+        .bind(cidrs)
+        .bind(category)
+        .bind(source)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    pub async fn delete_range(pool: &PgPool, id: i64) -> AppResult<bool> {
+        let result = sqlx::query("DELETE FROM ip_ranges WHERE id = $1")
+            .bind(id)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+}
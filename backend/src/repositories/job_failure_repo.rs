@@ -0,0 +1,116 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::job_failure::{JobFailure, JobFailureQuery};
+
+pub struct JobFailureRepository;
+
+impl JobFailureRepository {
+    /// Count a failed attempt, creating the record on the first one.
+    /// Returns the attempts so far.
+    pub async fn record(
+        pool: &PgPool,
+        job: &str,
+        item_id: Uuid,
+        payload: Option<&serde_json::Value>,
+        error: &str,
+        panicked: bool,
+        now: DateTime<Utc>,
+    ) -> AppResult<JobFailure> {
+        let failure = sqlx::query_as::<_, JobFailure>(
+            r#"
+            INSERT INTO job_failures (job, item_id, payload, last_error, panicked, retry_at,
+                                      first_failed_at, last_failed_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $6, $6)
+            ON CONFLICT (job, item_id) DO UPDATE SET
+                attempts = job_failures.attempts + 1,
+                payload = EXCLUDED.payload,
+                last_error = EXCLUDED.last_error,
+                panicked = EXCLUDED.panicked,
+                last_failed_at = EXCLUDED.last_failed_at
+            RETURNING id, job, item_id, attempts, payload, last_error, panicked, retry_at,
+                      quarantined_at, first_failed_at, last_failed_at
+            "#,
+        )
+        .bind(job)
+        .bind(item_id)
+        .bind(payload)
+        .bind(error)
+        .bind(panicked)
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(failure)
+    }
+
+    /// When to try the item again, or quarantine it
+    pub async fn schedule(
+        pool: &PgPool,
+        id: i64,
+        retry_at: DateTime<Utc>,
+        quarantined_at: Option<DateTime<Utc>>,
+    ) -> AppResult<()> {
+        sqlx::query("UPDATE job_failures SET retry_at = $2, quarantined_at = $3 WHERE id = $1")
+            .bind(id)
+            .bind(retry_at)
+            .bind(quarantined_at)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Forget an item's failures after it succeeded
+    pub async fn clear(pool: &PgPool, job: &str, item_id: Uuid) -> AppResult<()> {
+        sqlx::query("DELETE FROM job_failures WHERE job = $1 AND item_id = $2")
+            .bind(job)
+            .bind(item_id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    pub async fn list(pool: &PgPool, query: &JobFailureQuery) -> AppResult<Vec<JobFailure>> {
+        let failures = sqlx::query_as::<_, JobFailure>(
+            r#"
+            SELECT id, job, item_id, attempts, payload, last_error, panicked, retry_at,
+                   quarantined_at, first_failed_at, last_failed_at
+            FROM job_failures
+            WHERE ($1::VARCHAR IS NULL OR job = $1)
+              AND ($2::BOOLEAN IS NULL OR (quarantined_at IS NOT NULL) = $2)
+            ORDER BY last_failed_at DESC
+            LIMIT $3 OFFSET $4
+            "#,
+        )
+        .bind(&query.job)
+        .bind(query.quarantined)
+        .bind(query.limit)
+        .bind(query.offset)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(failures)
+    }
+
+    /// Drop a failure record so its item is picked up again on the next
+    /// run. None if there was no such record.
+    pub async fn release(pool: &PgPool, id: i64) -> AppResult<Option<JobFailure>> {
+        let failure = sqlx::query_as::<_, JobFailure>(
+            r#"
+            DELETE FROM job_failures
+            WHERE id = $1
+            RETURNING id, job, item_id, attempts, payload, last_error, panicked, retry_at,
+                      quarantined_at, first_failed_at, last_failed_at
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(failure)
+    }
+}
@@ -0,0 +1,216 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::market::{ResourceShipment, SendResourcesRequest};
+
+pub struct MarketRepository;
+
+impl MarketRepository {
+    #[allow(clippy::too_many_arguments)]
+    pub async fn create(
+        pool: &PgPool,
+        sender_id: Uuid,
+        receiver_id: Uuid,
+        from_village_id: Uuid,
+        request: &SendResourcesRequest,
+        merchants: i32,
+        sent_at: DateTime<Utc>,
+        arrives_at: DateTime<Utc>,
+        returns_at: DateTime<Utc>,
+    ) -> AppResult<ResourceShipment> {
+        let shipment = sqlx::query_as::<_, ResourceShipment>(
+            r#"
+            INSERT INTO resource_shipments
+                (sender_id, receiver_id, from_village_id, to_village_id,
+                 wood, clay, iron, crop, merchants, sent_at, arrives_at, returns_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+            RETURNING id, sender_id, receiver_id, from_village_id, to_village_id,
+                      wood, clay, iron, crop, merchants,
+                      sent_at, arrives_at, returns_at, delivered, created_at
+            "#,
+        )
+        .bind(sender_id)
+        .bind(receiver_id)
+        .bind(from_village_id)
+        .bind(request.to_village_id)
+        .bind(request.wood)
+        .bind(request.clay)
+        .bind(request.iron)
+        .bind(request.crop)
+        .bind(merchants)
+        .bind(sent_at)
+        .bind(arrives_at)
+        .bind(returns_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(shipment)
+    }
+
+    /// Shipments from the village whose merchants aren't home yet
+    pub async fn find_outgoing(
+        pool: &PgPool,
+        village_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<ResourceShipment>> {
+        let shipments = sqlx::query_as::<_, ResourceShipment>(
+            r#"
+            SELECT id, sender_id, receiver_id, from_village_id, to_village_id,
+                   wood, clay, iron, crop, merchants,
+                   sent_at, arrives_at, returns_at, delivered, created_at
+            FROM resource_shipments
+            WHERE from_village_id = $1 AND returns_at > $2
+            ORDER BY arrives_at ASC
+            "#,
+        )
+        .bind(village_id)
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(shipments)
+    }
+
+    /// Shipments on their way to the village
+    pub async fn find_incoming(
+        pool: &PgPool,
+        village_id: Uuid,
+    ) -> AppResult<Vec<ResourceShipment>> {
+        let shipments = sqlx::query_as::<_, ResourceShipment>(
+            r#"
+            SELECT id, sender_id, receiver_id, from_village_id, to_village_id,
+                   wood, clay, iron, crop, merchants,
+                   sent_at, arrives_at, returns_at, delivered, created_at
+            FROM resource_shipments
+            WHERE to_village_id = $1 AND NOT delivered
+            ORDER BY arrives_at ASC
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(shipments)
+    }
+
+    pub async fn find_arrived(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<ResourceShipment>> {
+        let shipments = sqlx::query_as::<_, ResourceShipment>(
+            r#"
+            SELECT id, sender_id, receiver_id, from_village_id, to_village_id,
+                   wood, clay, iron, crop, merchants,
+                   sent_at, arrives_at, returns_at, delivered, created_at
+            FROM resource_shipments
+            WHERE NOT delivered AND arrives_at <= $1
+            ORDER BY arrives_at ASC
+            "#,
+        )
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(shipments)
+    }
+
+    /// Claim a shipment for delivery. False if it was already delivered.
+    pub async fn mark_delivered(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE resource_shipments
+            SET delivered = true
+            WHERE id = $1 AND NOT delivered
+            "#,
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Merchants of the village that aren't home
+    pub async fn busy_merchants(
+        pool: &PgPool,
+        village_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<i32> {
+        let busy: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COALESCE(SUM(merchants), 0)
+            FROM resource_shipments
+            WHERE from_village_id = $1 AND returns_at > $2
+            "#,
+        )
+        .bind(village_id)
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(busy.0 as i32)
+    }
+
+    // ==================== Flows ====================
+
+    /// Resources `sender_id` sent `receiver_id` since `since`, minus what
+    /// came back the other way
+    pub async fn net_flow(
+        pool: &PgPool,
+        sender_id: Uuid,
+        receiver_id: Uuid,
+        since: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let net: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COALESCE(SUM(
+                CASE WHEN sender_id = $1 THEN 1 ELSE -1 END
+                * (wood + clay + iron + crop)::BIGINT
+            ), 0)::BIGINT
+            FROM resource_shipments
+            WHERE ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))
+              AND sent_at >= $3
+            "#,
+        )
+        .bind(sender_id)
+        .bind(receiver_id)
+        .bind(since)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(net.0)
+    }
+
+    /// Pairs of different players whose one-way flow since `since` is at
+    /// least `min_net`: (sender, receiver, sent, returned)
+    pub async fn list_flows(
+        pool: &PgPool,
+        since: DateTime<Utc>,
+        min_net: i64,
+    ) -> AppResult<Vec<(Uuid, Uuid, i64, i64)>> {
+        let rows = sqlx::query_as::<_, (Uuid, Uuid, i64, i64)>(
+            r#"
+            WITH sent AS (
+                SELECT sender_id, receiver_id,
+                       SUM(wood + clay + iron + crop)::BIGINT AS amount
+                FROM resource_shipments
+                WHERE sent_at >= $1 AND sender_id <> receiver_id
+                GROUP BY sender_id, receiver_id
+            )
+            SELECT s.sender_id, s.receiver_id, s.amount, COALESCE(r.amount, 0)
+            FROM sent s
+            LEFT JOIN sent r ON r.sender_id = s.receiver_id AND r.receiver_id = s.sender_id
+            WHERE s.amount - COALESCE(r.amount, 0) >= $2
+            ORDER BY s.amount - COALESCE(r.amount, 0) DESC
+            "#,
+        )
+        .bind(since)
+        .bind(min_net)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows)
+    }
+}
@@ -1,3 +1,4 @@
+use chrono::{DateTime, Utc};
 use sqlx::PgPool;
 use uuid::Uuid;
 
@@ -6,6 +7,7 @@ use crate::models::message::{
     AllianceMessageListItem, Conversation, ConversationResponse, Message, MessageListItem,
     MessageResponse, MessageType,
 };
+use crate::models::soft_delete::DeletedItem;
 
 pub struct MessageRepository;
 
@@ -85,7 +87,7 @@ impl MessageRepository {
             JOIN users sender ON sender.id = m.sender_id
             LEFT JOIN users recipient ON recipient.id = m.recipient_id
             LEFT JOIN alliances a ON a.id = m.alliance_id
-            WHERE m.id = $1
+            WHERE m.id = $1 AND m.deleted_at IS NULL
             "#,
         )
         .bind(message_id)
@@ -116,6 +118,9 @@ impl MessageRepository {
             WHERE m.message_type = 'private'
                 AND m.recipient_id = $1
                 AND m.recipient_deleted = FALSE
+                AND NOT EXISTS (
+                    SELECT 1 FROM user_blocks b WHERE b.user_id = $1 AND b.blocked_id = m.sender_id
+                )
             ORDER BY m.created_at DESC
             LIMIT $2 OFFSET $3
             "#,
@@ -185,6 +190,9 @@ impl MessageRepository {
             LEFT JOIN message_reads mr ON mr.message_id = m.id AND mr.user_id = $2
             WHERE m.message_type = 'alliance'
                 AND m.alliance_id = $1
+                AND NOT EXISTS (
+                    SELECT 1 FROM user_blocks b WHERE b.user_id = $2 AND b.blocked_id = m.sender_id
+                )
             ORDER BY m.created_at DESC
             LIMIT $3 OFFSET $4
             "#,
@@ -237,11 +245,13 @@ impl MessageRepository {
         Ok(())
     }
 
-    /// Delete message for user (soft delete)
+    /// Delete message for user (soft delete). A private message counts as
+    /// deleted once both sides have deleted it.
     pub async fn delete_for_user(
         pool: &PgPool,
         message_id: Uuid,
         user_id: Uuid,
+        now: DateTime<Utc>,
     ) -> AppResult<bool> {
         // Check if user is sender or recipient
         let result = sqlx::query(
@@ -249,12 +259,20 @@ impl MessageRepository {
             UPDATE messages
             SET
                 sender_deleted = CASE WHEN sender_id = $2 THEN TRUE ELSE sender_deleted END,
-                recipient_deleted = CASE WHEN recipient_id = $2 THEN TRUE ELSE recipient_deleted END
+                recipient_deleted = CASE WHEN recipient_id = $2 THEN TRUE ELSE recipient_deleted END,
+                deleted_at = CASE
+                    WHEN message_type = 'private'
+                        AND (sender_id = $2 OR sender_deleted)
+                        AND (recipient_id = $2 OR recipient_deleted)
+                    THEN COALESCE(deleted_at, $3)
+                    ELSE deleted_at
+                END
             WHERE id = $1 AND (sender_id = $2 OR recipient_id = $2)
             "#,
         )
         .bind(message_id)
         .bind(user_id)
+        .bind(now)
         .execute(pool)
         .await?;
 
@@ -271,6 +289,9 @@ impl MessageRepository {
                 AND recipient_id = $1
                 AND recipient_deleted = FALSE
                 AND is_read = FALSE
+                AND NOT EXISTS (
+                    SELECT 1 FROM user_blocks b WHERE b.user_id = $1 AND b.blocked_id = sender_id
+                )
             "#,
         )
         .bind(user_id)
@@ -294,6 +315,9 @@ impl MessageRepository {
             WHERE m.message_type = 'alliance'
                 AND m.alliance_id = $1
                 AND mr.id IS NULL
+                AND NOT EXISTS (
+                    SELECT 1 FROM user_blocks b WHERE b.user_id = $2 AND b.blocked_id = m.sender_id
+                )
             "#,
         )
         .bind(alliance_id)
@@ -468,24 +492,26 @@ impl MessageRepository {
         Ok(result.rows_affected() > 0)
     }
 
-    /// Check if user owns the message (sender or recipient)
+    /// Check if user owns the message (sender or recipient) and hasn't deleted it
     pub async fn user_can_access(pool: &PgPool, message_id: Uuid, user_id: Uuid) -> AppResult<bool> {
-        let result: Option<(Uuid, MessageType, Option<Uuid>, Option<Uuid>)> = sqlx::query_as(
-            r#"
-            SELECT id, message_type, sender_id, recipient_id
-            FROM messages
-            WHERE id = $1
-            "#,
-        )
-        .bind(message_id)
-        .fetch_optional(pool)
-        .await?;
-
-        if let Some((_id, msg_type, sender_id, recipient_id)) = result {
+        let result: Option<(Uuid, MessageType, Option<Uuid>, Option<Uuid>, bool, bool)> =
+            sqlx::query_as(
+                r#"
+                SELECT id, message_type, sender_id, recipient_id, sender_deleted, recipient_deleted
+                FROM messages
+                WHERE id = $1
+                "#,
+            )
+            .bind(message_id)
+            .fetch_optional(pool)
+            .await?;
+
+        if let Some((_id, msg_type, sender_id, recipient_id, sender_deleted, recipient_deleted)) =
+            result
+        {
             match msg_type {
-                MessageType::Private => {
-                    Ok(sender_id == Some(user_id) || recipient_id == Some(user_id))
-                }
+                MessageType::Private => Ok((sender_id == Some(user_id) && !sender_deleted)
+                    || (recipient_id == Some(user_id) && !recipient_deleted)),
                 MessageType::Alliance => {
                     // For alliance messages, check membership via service
                     Ok(true) // Will be validated in service
@@ -495,4 +521,66 @@ impl MessageRepository {
             Ok(false)
         }
     }
+
+    // ==================== Soft Delete ====================
+
+    /// Private messages the user deleted on their side
+    pub async fn find_deleted_for_user(
+        pool: &PgPool,
+        user_id: Uuid,
+    ) -> AppResult<Vec<DeletedItem>> {
+        let items = sqlx::query_as::<_, DeletedItem>(
+            r#"
+            SELECT id, subject AS summary, created_at, deleted_at
+            FROM messages
+            WHERE message_type = 'private'
+                AND (
+                    (sender_id = $1 AND sender_deleted = TRUE)
+                    OR (recipient_id = $1 AND recipient_deleted = TRUE)
+                )
+            ORDER BY created_at DESC
+            LIMIT 100
+            "#,
+        )
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(items)
+    }
+
+    /// Show a deleted private message to both sides again
+    pub async fn restore(pool: &PgPool, message_id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE messages
+            SET sender_deleted = FALSE, recipient_deleted = FALSE, deleted_at = NULL
+            WHERE id = $1
+                AND message_type = 'private'
+                AND (sender_deleted = TRUE OR recipient_deleted = TRUE)
+            "#,
+        )
+        .bind(message_id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Remove messages both sides deleted before the cutoff. A message still
+    /// shown as a conversation's latest waits until a newer one replaces it.
+    pub async fn purge_deleted(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            DELETE FROM messages m
+            WHERE m.deleted_at < $1
+                AND NOT EXISTS (SELECT 1 FROM conversations c WHERE c.last_message_id = m.id)
+            "#,
+        )
+        .bind(before)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
 }
@@ -1,9 +1,53 @@
+pub mod account_repo;
+pub mod activity_repo;
 pub mod alliance_repo;
+pub mod api_key_repo;
 pub mod army_repo;
+pub mod attack_warning_repo;
+pub mod auction_repo;
+pub mod audit_repo;
+pub mod bot_detection_repo;
 pub mod building_repo;
+pub mod command_repo;
+pub mod data_migration_repo;
+pub mod defense_call_repo;
+pub mod digest_repo;
+pub mod domain_event_repo;
+pub mod economy_repo;
+pub mod gamedata_repo;
+pub mod hall_of_fame_repo;
 pub mod hero_repo;
+pub mod hospital_repo;
+pub mod impersonation_repo;
+pub mod invariant_repo;
+pub mod ip_reputation_repo;
+pub mod job_failure_repo;
+pub mod market_repo;
 pub mod message_repo;
+pub mod note_repo;
+pub mod oasis_repo;
+pub mod operation_repo;
+pub mod ops_metrics_repo;
+pub mod projection_repo;
+pub mod referral_repo;
+pub mod region_repo;
+pub mod registration_repo;
+pub mod report_repo;
+pub mod research_repo;
+pub mod search_repo;
+pub mod session_repo;
 pub mod shop_repo;
+pub mod snapshot_repo;
+pub mod social_repo;
+pub mod template_repo;
+pub mod tick_repo;
 pub mod troop_repo;
 pub mod user_repo;
 pub mod village_repo;
+pub mod wave_repo;
+pub mod world_clock_repo;
+pub mod world_dump_repo;
+pub mod world_pause_repo;
+pub mod world_setting_repo;
+pub mod world_shard_repo;
+pub mod world_stats_repo;
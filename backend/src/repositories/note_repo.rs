@@ -0,0 +1,242 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::alliance::AllianceRole;
+use crate::models::note::{Note, NoteResponse, NoteTarget};
+use crate::models::soft_delete::DeletedItem;
+
+pub struct NoteRepository;
+
+impl NoteRepository {
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<Note>> {
+        let note = sqlx::query_as::<_, Note>(
+            r#"
+            SELECT id, author_id, target_type, target_id, body, alliance_id, min_role,
+                   created_at, updated_at
+            FROM notes
+            WHERE id = $1 AND deleted_at IS NULL
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(note)
+    }
+
+    /// A note with its author's name
+    pub async fn find_response(pool: &PgPool, id: Uuid) -> AppResult<Option<NoteResponse>> {
+        let note = sqlx::query_as::<_, NoteResponse>(
+            r#"
+            SELECT n.id, n.author_id, u.display_name AS author_name, n.target_type,
+                   n.target_id, n.body, n.min_role, n.created_at, n.updated_at
+            FROM notes n
+            JOIN users u ON u.id = n.author_id
+            WHERE n.id = $1 AND n.deleted_at IS NULL
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(note)
+    }
+
+    #[allow(clippy::too_many_arguments)]
+    pub async fn create(
+        pool: &PgPool,
+        author_id: Uuid,
+        target_type: NoteTarget,
+        target_id: Uuid,
+        body: &str,
+        alliance_id: Option<Uuid>,
+        min_role: Option<AllianceRole>,
+        now: DateTime<Utc>,
+    ) -> AppResult<Note> {
+        let note = sqlx::query_as::<_, Note>(
+            r#"
+            INSERT INTO notes
+                (author_id, target_type, target_id, body, alliance_id, min_role,
+                 created_at, updated_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+            RETURNING id, author_id, target_type, target_id, body, alliance_id, min_role,
+                      created_at, updated_at
+            "#,
+        )
+        .bind(author_id)
+        .bind(target_type)
+        .bind(target_id)
+        .bind(body)
+        .bind(alliance_id)
+        .bind(min_role)
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(note)
+    }
+
+    pub async fn update(
+        pool: &PgPool,
+        id: Uuid,
+        body: &str,
+        alliance_id: Option<Uuid>,
+        min_role: Option<AllianceRole>,
+        now: DateTime<Utc>,
+    ) -> AppResult<Note> {
+        let note = sqlx::query_as::<_, Note>(
+            r#"
+            UPDATE notes
+            SET body = $2, alliance_id = $3, min_role = $4, updated_at = $5
+            WHERE id = $1 AND deleted_at IS NULL
+            RETURNING id, author_id, target_type, target_id, body, alliance_id, min_role,
+                      created_at, updated_at
+            "#,
+        )
+        .bind(id)
+        .bind(body)
+        .bind(alliance_id)
+        .bind(min_role)
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(note)
+    }
+
+    /// Hide the note; support can restore it until it is purged
+    pub async fn delete(pool: &PgPool, id: Uuid, now: DateTime<Utc>) -> AppResult<()> {
+        sqlx::query("UPDATE notes SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL")
+            .bind(id)
+            .bind(now)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    pub async fn count_by_author(pool: &PgPool, author_id: Uuid) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*) FROM notes WHERE author_id = $1 AND deleted_at IS NULL
+            "#,
+        )
+        .bind(author_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Notes on the targets the viewer may read: their own, plus notes
+    /// shared with their alliance at one of `levels`
+    pub async fn find_visible(
+        pool: &PgPool,
+        viewer_id: Uuid,
+        alliance_id: Option<Uuid>,
+        levels: &[String],
+        target_type: NoteTarget,
+        target_ids: &[Uuid],
+    ) -> AppResult<Vec<NoteResponse>> {
+        let notes = sqlx::query_as::<_, NoteResponse>(
+            r#"
+            SELECT n.id, n.author_id, u.display_name AS author_name, n.target_type,
+                   n.target_id, n.body, n.min_role, n.created_at, n.updated_at
+            FROM notes n
+            JOIN users u ON u.id = n.author_id
+            WHERE n.deleted_at IS NULL
+              AND n.target_type = $4
+              AND n.target_id = ANY($5)
+              AND (n.author_id = $1 OR (n.alliance_id = $2 AND n.min_role::text = ANY($3)))
+            ORDER BY n.updated_at DESC
+            "#,
+        )
+        .bind(viewer_id)
+        .bind(alliance_id)
+        .bind(levels)
+        .bind(target_type)
+        .bind(target_ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(notes)
+    }
+
+    /// Every note the viewer may read, newest first
+    pub async fn list_visible(
+        pool: &PgPool,
+        viewer_id: Uuid,
+        alliance_id: Option<Uuid>,
+        levels: &[String],
+        limit: i64,
+    ) -> AppResult<Vec<NoteResponse>> {
+        let notes = sqlx::query_as::<_, NoteResponse>(
+            r#"
+            SELECT n.id, n.author_id, u.display_name AS author_name, n.target_type,
+                   n.target_id, n.body, n.min_role, n.created_at, n.updated_at
+            FROM notes n
+            JOIN users u ON u.id = n.author_id
+            WHERE n.deleted_at IS NULL
+              AND (n.author_id = $1 OR (n.alliance_id = $2 AND n.min_role::text = ANY($3)))
+            ORDER BY n.updated_at DESC
+            LIMIT $4
+            "#,
+        )
+        .bind(viewer_id)
+        .bind(alliance_id)
+        .bind(levels)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(notes)
+    }
+
+    // ==================== Soft Delete ====================
+
+    /// Notes the user wrote that were deleted, by them or their alliance leader
+    pub async fn find_deleted_by_author(
+        pool: &PgPool,
+        author_id: Uuid,
+    ) -> AppResult<Vec<DeletedItem>> {
+        let items = sqlx::query_as::<_, DeletedItem>(
+            r#"
+            SELECT id, target_type::text || ' note: ' || LEFT(body, 60) AS summary,
+                   created_at, deleted_at
+            FROM notes
+            WHERE author_id = $1 AND deleted_at IS NOT NULL
+            ORDER BY deleted_at DESC
+            LIMIT 100
+            "#,
+        )
+        .bind(author_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(items)
+    }
+
+    pub async fn restore(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE notes SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL
+            "#,
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn purge_deleted(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM notes WHERE deleted_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+}
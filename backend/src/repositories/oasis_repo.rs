@@ -0,0 +1,233 @@
+use chrono::{DateTime, Utc};
+use sqlx::{PgConnection, PgPool};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::oasis::{NatureTroops, Oasis, OasisType};
+
+pub struct OasisRepository;
+
+impl OasisRepository {
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<Oasis>> {
+        let oasis = sqlx::query_as::<_, Oasis>(
+            r#"
+            SELECT id, x, y, oasis_type, owner_village_id, conquered_at, animals,
+                   last_regrowth_at, created_at, updated_at
+            FROM oases
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(oasis)
+    }
+
+    pub async fn find_by_coordinates(pool: &PgPool, x: i32, y: i32) -> AppResult<Option<Oasis>> {
+        let oasis = sqlx::query_as::<_, Oasis>(
+            r#"
+            SELECT id, x, y, oasis_type, owner_village_id, conquered_at, animals,
+                   last_regrowth_at, created_at, updated_at
+            FROM oases
+            WHERE x = $1 AND y = $2
+            "#,
+        )
+        .bind(x)
+        .bind(y)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(oasis)
+    }
+
+    pub async fn find_by_owner(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<Oasis>> {
+        let oases = sqlx::query_as::<_, Oasis>(
+            r#"
+            SELECT id, x, y, oasis_type, owner_village_id, conquered_at, animals,
+                   last_regrowth_at, created_at, updated_at
+            FROM oases
+            WHERE owner_village_id = $1
+            ORDER BY conquered_at ASC
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(oases)
+    }
+
+    pub async fn find_in_range(
+        pool: &PgPool,
+        center_x: i32,
+        center_y: i32,
+        range: i32,
+    ) -> AppResult<Vec<Oasis>> {
+        let oases = sqlx::query_as::<_, Oasis>(
+            r#"
+            SELECT id, x, y, oasis_type, owner_village_id, conquered_at, animals,
+                   last_regrowth_at, created_at, updated_at
+            FROM oases
+            WHERE x BETWEEN $1 AND $2
+              AND y BETWEEN $3 AND $4
+            "#,
+        )
+        .bind(center_x - range)
+        .bind(center_x + range)
+        .bind(center_y - range)
+        .bind(center_y + range)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(oases)
+    }
+
+    pub async fn update_animals(pool: &PgPool, id: Uuid, animals: &NatureTroops) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE oases
+            SET animals = $2, updated_at = NOW()
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .bind(sqlx::types::Json(animals))
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Hand the oasis to a village, provided the village holds fewer than
+    /// `slots` oases. None when it has no free slot.
+    pub async fn occupy(
+        pool: &PgPool,
+        id: Uuid,
+        village_id: Uuid,
+        slots: i32,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<Oasis>> {
+        let oasis = sqlx::query_as::<_, Oasis>(
+            r#"
+            UPDATE oases
+            SET owner_village_id = $2, conquered_at = $4, animals = '{}', updated_at = NOW()
+            WHERE id = $1
+              AND (SELECT COUNT(*) FROM oases WHERE owner_village_id = $2) < $3
+            RETURNING id, x, y, oasis_type, owner_village_id, conquered_at, animals,
+                      last_regrowth_at, created_at, updated_at
+            "#,
+        )
+        .bind(id)
+        .bind(village_id)
+        .bind(slots as i64)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(oasis)
+    }
+
+    /// Give up an oasis held by the village. None if it doesn't hold it.
+    pub async fn release(
+        pool: &PgPool,
+        id: Uuid,
+        village_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<Oasis>> {
+        let oasis = sqlx::query_as::<_, Oasis>(
+            r#"
+            UPDATE oases
+            SET owner_village_id = NULL, conquered_at = NULL,
+                last_regrowth_at = $3, updated_at = NOW()
+            WHERE id = $1 AND owner_village_id = $2
+            RETURNING id, x, y, oasis_type, owner_village_id, conquered_at, animals,
+                      last_regrowth_at, created_at, updated_at
+            "#,
+        )
+        .bind(id)
+        .bind(village_id)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(oasis)
+    }
+
+    /// Unoccupied oases with ids in `[lower, upper)`, locked until the
+    /// caller's transaction ends
+    pub async fn find_unoccupied_in_range(
+        conn: &mut PgConnection,
+        lower: Uuid,
+        upper: Option<Uuid>,
+    ) -> AppResult<Vec<Oasis>> {
+        let oases = sqlx::query_as::<_, Oasis>(
+            r#"
+            SELECT id, x, y, oasis_type, owner_village_id, conquered_at, animals,
+                   last_regrowth_at, created_at, updated_at
+            FROM oases
+            WHERE owner_village_id IS NULL
+                AND id >= $1
+                AND ($2::uuid IS NULL OR id < $2)
+            FOR UPDATE
+            "#,
+        )
+        .bind(lower)
+        .bind(upper)
+        .fetch_all(conn)
+        .await?;
+
+        Ok(oases)
+    }
+
+    /// Store regrown animals, unless the oasis was occupied meanwhile
+    pub async fn set_regrown(
+        conn: &mut PgConnection,
+        id: Uuid,
+        animals: &NatureTroops,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE oases
+            SET animals = $2, last_regrowth_at = $3, updated_at = NOW()
+            WHERE id = $1 AND owner_village_id IS NULL
+            "#,
+        )
+        .bind(id)
+        .bind(sqlx::types::Json(animals))
+        .bind(now)
+        .execute(conn)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Place an oasis on a free tile. False if the tile is taken.
+    pub async fn create(
+        pool: &PgPool,
+        x: i32,
+        y: i32,
+        oasis_type: OasisType,
+        animals: &NatureTroops,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO oases (x, y, oasis_type, animals, last_regrowth_at)
+            SELECT $1, $2, $3, $4, $5
+            WHERE NOT EXISTS (SELECT 1 FROM villages WHERE x = $1 AND y = $2)
+            ON CONFLICT (x, y) DO NOTHING
+            "#,
+        )
+        .bind(x)
+        .bind(y)
+        .bind(&oasis_type)
+        .bind(sqlx::types::Json(animals))
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+}
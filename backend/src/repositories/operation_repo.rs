@@ -0,0 +1,273 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::operation::{
+    AllianceOperation, CreateOperationRequest, OperationSignup, OperationTarget,
+};
+use crate::models::troop::TroopType;
+
+const OPERATION_COLUMNS: &str = "id, alliance_id, created_by, name, kind, notes, landing_from, \
+                                 landing_until, status, created_at";
+
+const SIGNUP_COLUMNS: &str = "s.id, s.operation_id, s.target_id, s.player_id, \
+                              u.display_name as player_name, s.wave_id, s.troops, s.armies, \
+                              s.lands_at, s.created_at";
+
+pub struct OperationRepository;
+
+impl OperationRepository {
+    /// Store an operation with its targets
+    pub async fn create(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        created_by: Uuid,
+        request: &CreateOperationRequest,
+    ) -> AppResult<AllianceOperation> {
+        let mut tx = pool.begin().await?;
+
+        let operation = sqlx::query_as::<_, AllianceOperation>(&format!(
+            r#"
+            INSERT INTO alliance_operations (alliance_id, created_by, name, kind, notes,
+                                             landing_from, landing_until)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            RETURNING {OPERATION_COLUMNS}
+            "#
+        ))
+        .bind(alliance_id)
+        .bind(created_by)
+        .bind(&request.name)
+        .bind(request.kind)
+        .bind(&request.notes)
+        .bind(request.landing_from)
+        .bind(request.landing_until)
+        .fetch_one(&mut *tx)
+        .await?;
+
+        for target in &request.targets {
+            sqlx::query(
+                r#"
+                INSERT INTO alliance_operation_targets (operation_id, x, y, note)
+                VALUES ($1, $2, $3, $4)
+                "#,
+            )
+            .bind(operation.id)
+            .bind(target.x)
+            .bind(target.y)
+            .bind(&target.note)
+            .execute(&mut *tx)
+            .await?;
+        }
+
+        tx.commit().await?;
+
+        Ok(operation)
+    }
+
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<AllianceOperation>> {
+        let operation = sqlx::query_as::<_, AllianceOperation>(&format!(
+            "SELECT {OPERATION_COLUMNS} FROM alliance_operations WHERE id = $1"
+        ))
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(operation)
+    }
+
+    /// The alliance's operations, latest window first. Unless `all`, only
+    /// those still open at `now`.
+    pub async fn find_by_alliance(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        all: bool,
+        now: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<AllianceOperation>> {
+        let operations = sqlx::query_as::<_, AllianceOperation>(&format!(
+            r#"
+            SELECT {OPERATION_COLUMNS}
+            FROM alliance_operations
+            WHERE alliance_id = $1
+              AND ($2 OR (status = 'open' AND landing_until > $3))
+            ORDER BY landing_from DESC
+            LIMIT $4
+            "#
+        ))
+        .bind(alliance_id)
+        .bind(all)
+        .bind(now)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(operations)
+    }
+
+    pub async fn count_open(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*)
+            FROM alliance_operations
+            WHERE alliance_id = $1 AND status = 'open' AND landing_until > $2
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Call an operation off. False if it already was.
+    pub async fn cancel(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            "UPDATE alliance_operations SET status = 'cancelled' WHERE id = $1 AND status = 'open'",
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn find_targets(
+        pool: &PgPool,
+        operation_id: Uuid,
+    ) -> AppResult<Vec<OperationTarget>> {
+        let targets = sqlx::query_as::<_, OperationTarget>(
+            r#"
+            SELECT id, operation_id, x, y, note
+            FROM alliance_operation_targets
+            WHERE operation_id = $1
+            ORDER BY y DESC, x
+            "#,
+        )
+        .bind(operation_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(targets)
+    }
+
+    pub async fn find_target(pool: &PgPool, id: Uuid) -> AppResult<Option<OperationTarget>> {
+        let target = sqlx::query_as::<_, OperationTarget>(
+            "SELECT id, operation_id, x, y, note FROM alliance_operation_targets WHERE id = $1",
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(target)
+    }
+
+    #[allow(clippy::too_many_arguments)]
+    pub async fn create_signup(
+        pool: &PgPool,
+        operation_id: Uuid,
+        target_id: Uuid,
+        player_id: Uuid,
+        wave_id: Option<Uuid>,
+        troops: &HashMap<TroopType, i32>,
+        armies: i32,
+        lands_at: DateTime<Utc>,
+    ) -> AppResult<OperationSignup> {
+        let signup = sqlx::query_as::<_, OperationSignup>(&format!(
+            r#"
+            WITH s AS (
+                INSERT INTO alliance_operation_signups (operation_id, target_id, player_id,
+                                                        wave_id, troops, armies, lands_at)
+                VALUES ($1, $2, $3, $4, $5, $6, $7)
+                RETURNING *
+            )
+            SELECT {SIGNUP_COLUMNS}
+            FROM s
+            JOIN users u ON s.player_id = u.id
+            "#
+        ))
+        .bind(operation_id)
+        .bind(target_id)
+        .bind(player_id)
+        .bind(wave_id)
+        .bind(sqlx::types::Json(troops))
+        .bind(armies)
+        .bind(lands_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(signup)
+    }
+
+    pub async fn find_signup(pool: &PgPool, id: Uuid) -> AppResult<Option<OperationSignup>> {
+        let signup = sqlx::query_as::<_, OperationSignup>(&format!(
+            r#"
+            SELECT {SIGNUP_COLUMNS}
+            FROM alliance_operation_signups s
+            JOIN users u ON s.player_id = u.id
+            WHERE s.id = $1
+            "#
+        ))
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(signup)
+    }
+
+    /// Every sign-up to an operation, earliest landing first
+    pub async fn find_signups(
+        pool: &PgPool,
+        operation_id: Uuid,
+    ) -> AppResult<Vec<OperationSignup>> {
+        let signups = sqlx::query_as::<_, OperationSignup>(&format!(
+            r#"
+            SELECT {SIGNUP_COLUMNS}
+            FROM alliance_operation_signups s
+            JOIN users u ON s.player_id = u.id
+            WHERE s.operation_id = $1
+            ORDER BY s.lands_at
+            "#
+        ))
+        .bind(operation_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(signups)
+    }
+
+    pub async fn count_signups(
+        pool: &PgPool,
+        operation_id: Uuid,
+        player_id: Uuid,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*)
+            FROM alliance_operation_signups
+            WHERE operation_id = $1 AND player_id = $2
+            "#,
+        )
+        .bind(operation_id)
+        .bind(player_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn delete_signup(pool: &PgPool, id: Uuid) -> AppResult<()> {
+        sqlx::query("DELETE FROM alliance_operation_signups WHERE id = $1")
+            .bind(id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+}
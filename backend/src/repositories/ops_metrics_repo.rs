@@ -0,0 +1,102 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::ops_metrics::{JobFailureSummary, QueueBacklog};
+
+pub struct OpsMetricsRepository;
+
+impl OpsMetricsRepository {
+    /// Pending and due items of every scheduled queue, using the same
+    /// conditions as the jobs that process them
+    pub async fn queue_backlogs(pool: &PgPool, now: DateTime<Utc>) -> AppResult<Vec<QueueBacklog>> {
+        let backlogs = sqlx::query_as::<_, QueueBacklog>(
+            r#"
+            SELECT 'army_movements' AS queue, COUNT(*) AS pending,
+                   COUNT(*) FILTER (WHERE arrives_at <= $1) AS due,
+                   EXTRACT(EPOCH FROM $1 - MIN(arrives_at) FILTER (WHERE arrives_at <= $1))::bigint
+                       AS lag_secs
+            FROM armies
+            WHERE is_stationed = FALSE
+            UNION ALL
+            SELECT 'building_upgrades', COUNT(*),
+                   COUNT(*) FILTER (WHERE upgrade_ends_at <= $1),
+                   EXTRACT(EPOCH FROM $1 - MIN(upgrade_ends_at) FILTER (WHERE upgrade_ends_at <= $1))::bigint
+            FROM buildings
+            WHERE is_upgrading = TRUE
+            UNION ALL
+            SELECT 'troop_training', COUNT(*),
+                   COUNT(*) FILTER (WHERE ends_at <= $1),
+                   EXTRACT(EPOCH FROM $1 - MIN(ends_at) FILTER (WHERE ends_at <= $1))::bigint
+            FROM troop_queue
+            UNION ALL
+            SELECT 'research', COUNT(*),
+                   COUNT(*) FILTER (WHERE ends_at <= $1),
+                   EXTRACT(EPOCH FROM $1 - MIN(ends_at) FILTER (WHERE ends_at <= $1))::bigint
+            FROM research_queue
+            UNION ALL
+            SELECT 'healing', COUNT(*),
+                   COUNT(*) FILTER (WHERE ends_at <= $1),
+                   EXTRACT(EPOCH FROM $1 - MIN(ends_at) FILTER (WHERE ends_at <= $1))::bigint
+            FROM healing_queue
+            UNION ALL
+            SELECT 'market_deliveries', COUNT(*),
+                   COUNT(*) FILTER (WHERE arrives_at <= $1),
+                   EXTRACT(EPOCH FROM $1 - MIN(arrives_at) FILTER (WHERE arrives_at <= $1))::bigint
+            FROM resource_shipments
+            WHERE NOT delivered
+            UNION ALL
+            SELECT 'wave_sends', COUNT(*),
+                   COUNT(*) FILTER (WHERE send_at <= $1),
+                   EXTRACT(EPOCH FROM $1 - MIN(send_at) FILTER (WHERE send_at <= $1))::bigint
+            FROM attack_wave_sends
+            WHERE status = 'planned'
+            UNION ALL
+            SELECT 'auction_close', COUNT(*),
+                   COUNT(*) FILTER (WHERE ends_at <= $1),
+                   EXTRACT(EPOCH FROM $1 - MIN(ends_at) FILTER (WHERE ends_at <= $1))::bigint
+            FROM hero_auctions
+            WHERE status = 'open'
+            "#,
+        )
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(backlogs)
+    }
+
+    pub async fn job_failures(
+        pool: &PgPool,
+        since: DateTime<Utc>,
+    ) -> AppResult<Vec<JobFailureSummary>> {
+        let summaries = sqlx::query_as::<_, JobFailureSummary>(
+            r#"
+            SELECT job,
+                   COUNT(*) FILTER (WHERE quarantined_at IS NULL) AS retrying,
+                   COUNT(*) FILTER (WHERE quarantined_at IS NOT NULL) AS quarantined,
+                   COUNT(*) FILTER (WHERE last_failed_at > $1) AS failed_last_hour
+            FROM job_failures
+            GROUP BY job
+            ORDER BY job
+            "#,
+        )
+        .bind(since)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(summaries)
+    }
+
+    /// Seconds the slowest tick shard trails `now`; None without shards
+    pub async fn tick_lag_secs(pool: &PgPool, now: DateTime<Utc>) -> AppResult<Option<i64>> {
+        let lag: Option<i64> = sqlx::query_scalar(
+            "SELECT EXTRACT(EPOCH FROM $1 - MIN(watermark))::bigint FROM tick_shards",
+        )
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(lag)
+    }
+}
@@ -0,0 +1,360 @@
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::projection::{AllianceStats, PlayerStats, WorldRanking};
+
+pub struct ProjectionRepository;
+
+impl ProjectionRepository {
+    // ==================== Checkpoints ====================
+
+    pub async fn get_checkpoint(pool: &PgPool, name: &str) -> AppResult<i64> {
+        let checkpoint: Option<(i64,)> =
+            sqlx::query_as("SELECT last_event_id FROM projection_checkpoints WHERE name = $1")
+                .bind(name)
+                .fetch_optional(pool)
+                .await?;
+
+        Ok(checkpoint.map(|c| c.0).unwrap_or(0))
+    }
+
+    pub async fn set_checkpoint(pool: &PgPool, name: &str, last_event_id: i64) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO projection_checkpoints (name, last_event_id, updated_at)
+            VALUES ($1, $2, NOW())
+            ON CONFLICT (name) DO UPDATE SET
+                last_event_id = EXCLUDED.last_event_id,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(name)
+        .bind(last_event_id)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    // ==================== Projection Writes ====================
+
+    /// Alliances the given players currently count towards
+    pub async fn alliances_of_players(pool: &PgPool, user_ids: &[Uuid]) -> AppResult<Vec<Uuid>> {
+        let rows: Vec<(Uuid,)> = sqlx::query_as(
+            r#"
+            SELECT DISTINCT alliance_id FROM player_stats
+            WHERE user_id = ANY($1) AND alliance_id IS NOT NULL
+            "#,
+        )
+        .bind(user_ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows.into_iter().map(|(id,)| id).collect())
+    }
+
+    /// Recompute stats for the given players (`None` = everyone). Each
+    /// player's aggregate only touches their own villages.
+    pub async fn refresh_player_stats(pool: &PgPool, user_ids: Option<&[Uuid]>) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO player_stats (
+                user_id, display_name, alliance_id, alliance_tag,
+                village_count, population, culture_points, troop_count, updated_at
+            )
+            SELECT u.id, u.display_name, am.alliance_id, a.tag,
+                   v.village_count, v.population, v.culture_points, t.troop_count, NOW()
+            FROM users u
+            LEFT JOIN alliance_members am ON am.user_id = u.id
+            LEFT JOIN alliances a ON a.id = am.alliance_id
+            CROSS JOIN LATERAL (
+                SELECT COUNT(*)::INT AS village_count,
+                       COALESCE(SUM(population), 0)::INT AS population,
+                       COALESCE(SUM(culture_points), 0)::INT AS culture_points
+                FROM villages
+                WHERE user_id = u.id
+            ) v
+            CROSS JOIN LATERAL (
+                SELECT COALESCE(SUM(tr.count), 0)::BIGINT AS troop_count
+                FROM troops tr
+                JOIN villages tv ON tv.id = tr.village_id
+                WHERE tv.user_id = u.id
+            ) t
+            WHERE u.deleted_at IS NULL
+                AND ($1::uuid[] IS NULL OR u.id = ANY($1))
+            ON CONFLICT (user_id) DO UPDATE SET
+                display_name = EXCLUDED.display_name,
+                alliance_id = EXCLUDED.alliance_id,
+                alliance_tag = EXCLUDED.alliance_tag,
+                village_count = EXCLUDED.village_count,
+                population = EXCLUDED.population,
+                culture_points = EXCLUDED.culture_points,
+                troop_count = EXCLUDED.troop_count,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(user_ids)
+        .execute(pool)
+        .await?;
+
+        sqlx::query(
+            r#"
+            DELETE FROM player_stats ps
+            USING users u
+            WHERE u.id = ps.user_id
+                AND u.deleted_at IS NOT NULL
+                AND ($1::uuid[] IS NULL OR ps.user_id = ANY($1))
+            "#,
+        )
+        .bind(user_ids)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Recompute alliance totals from player_stats (`None` = every alliance)
+    pub async fn refresh_alliance_stats(
+        pool: &PgPool,
+        alliance_ids: Option<&[Uuid]>,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO alliance_stats (
+                alliance_id, name, tag, member_count, village_count, total_population, updated_at
+            )
+            SELECT a.id, a.name, a.tag,
+                   COUNT(ps.user_id)::INT,
+                   COALESCE(SUM(ps.village_count), 0)::INT,
+                   COALESCE(SUM(ps.population), 0)::BIGINT,
+                   NOW()
+            FROM alliances a
+            LEFT JOIN player_stats ps ON ps.alliance_id = a.id
+            WHERE ($1::uuid[] IS NULL OR a.id = ANY($1))
+            GROUP BY a.id, a.name, a.tag
+            ON CONFLICT (alliance_id) DO UPDATE SET
+                name = EXCLUDED.name,
+                tag = EXCLUDED.tag,
+                member_count = EXCLUDED.member_count,
+                village_count = EXCLUDED.village_count,
+                total_population = EXCLUDED.total_population,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(alliance_ids)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Rewrite the world top-10s from the stats tables
+    pub async fn rebuild_rankings(pool: &PgPool) -> AppResult<()> {
+        // (category, table, id column, name column, value column)
+        const SOURCES: &[(&str, &str, &str, &str, &str)] = &[
+            (
+                "top_population",
+                "player_stats",
+                "user_id",
+                "display_name",
+                "population",
+            ),
+            (
+                "top_villages",
+                "player_stats",
+                "user_id",
+                "display_name",
+                "village_count",
+            ),
+            (
+                "top_culture",
+                "player_stats",
+                "user_id",
+                "display_name",
+                "culture_points",
+            ),
+            (
+                "top_troops",
+                "player_stats",
+                "user_id",
+                "display_name",
+                "troop_count",
+            ),
+            (
+                "top_alliances",
+                "alliance_stats",
+                "alliance_id",
+                "name",
+                "total_population",
+            ),
+            (
+                "top_alliance_members",
+                "alliance_stats",
+                "alliance_id",
+                "name",
+                "member_count",
+            ),
+        ];
+
+        let mut tx = pool.begin().await?;
+
+        sqlx::query("DELETE FROM world_rankings")
+            .execute(&mut *tx)
+            .await?;
+
+        for (category, table, id, name, value) in SOURCES {
+            sqlx::query(&format!(
+                r#"
+                INSERT INTO world_rankings (category, rank, entity_id, name, value)
+                SELECT $1, ROW_NUMBER() OVER (ORDER BY value DESC, entity_id), entity_id, name, value
+                FROM (
+                    SELECT {id} AS entity_id, {name} AS name, {value}::BIGINT AS value
+                    FROM {table}
+                    ORDER BY {value} DESC, {id}
+                    LIMIT 10
+                ) top
+                "#
+            ))
+            .bind(category)
+            .execute(&mut *tx)
+            .await?;
+        }
+
+        tx.commit().await?;
+
+        Ok(())
+    }
+
+    // ==================== Reads ====================
+
+    pub async fn find_player_stats(pool: &PgPool, user_id: Uuid) -> AppResult<Option<PlayerStats>> {
+        let stats = sqlx::query_as::<_, PlayerStats>(
+            r#"
+            SELECT user_id, display_name, alliance_id, alliance_tag,
+                   village_count, population, culture_points, troop_count, updated_at
+            FROM player_stats
+            WHERE user_id = $1
+            "#,
+        )
+        .bind(user_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(stats)
+    }
+
+    /// Members of an alliance, most populous first
+    pub async fn find_alliance_member_stats(
+        pool: &PgPool,
+        alliance_id: Uuid,
+    ) -> AppResult<Vec<PlayerStats>> {
+        let players = sqlx::query_as::<_, PlayerStats>(
+            r#"
+            SELECT user_id, display_name, alliance_id, alliance_tag,
+                   village_count, population, culture_points, troop_count, updated_at
+            FROM player_stats
+            WHERE alliance_id = $1
+            ORDER BY population DESC, user_id
+            "#,
+        )
+        .bind(alliance_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(players)
+    }
+
+    pub async fn find_alliance_stats(
+        pool: &PgPool,
+        alliance_id: Uuid,
+    ) -> AppResult<Option<AllianceStats>> {
+        let stats = sqlx::query_as::<_, AllianceStats>(
+            r#"
+            SELECT alliance_id, name, tag, member_count, village_count, total_population, updated_at
+            FROM alliance_stats
+            WHERE alliance_id = $1
+            "#,
+        )
+        .bind(alliance_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(stats)
+    }
+
+    /// Population rank of a player; players without stats rank last
+    pub async fn player_rank(pool: &PgPool, user_id: Uuid) -> AppResult<i64> {
+        let rank: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*) + 1
+            FROM player_stats
+            WHERE population > COALESCE(
+                (SELECT population FROM player_stats WHERE user_id = $1), -1
+            )
+            "#,
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(rank.0)
+    }
+
+    pub async fn list_player_rankings(
+        pool: &PgPool,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<PlayerStats>> {
+        let players = sqlx::query_as::<_, PlayerStats>(
+            r#"
+            SELECT user_id, display_name, alliance_id, alliance_tag,
+                   village_count, population, culture_points, troop_count, updated_at
+            FROM player_stats
+            ORDER BY population DESC, user_id
+            LIMIT $1 OFFSET $2
+            "#,
+        )
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(players)
+    }
+
+    pub async fn list_alliance_rankings(
+        pool: &PgPool,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<AllianceStats>> {
+        let alliances = sqlx::query_as::<_, AllianceStats>(
+            r#"
+            SELECT alliance_id, name, tag, member_count, village_count, total_population, updated_at
+            FROM alliance_stats
+            ORDER BY total_population DESC, alliance_id
+            LIMIT $1 OFFSET $2
+            "#,
+        )
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(alliances)
+    }
+
+    pub async fn list_world_rankings(pool: &PgPool) -> AppResult<Vec<WorldRanking>> {
+        let rankings = sqlx::query_as::<_, WorldRanking>(
+            r#"
+            SELECT category, rank, entity_id, name, value, updated_at
+            FROM world_rankings
+            ORDER BY category, rank
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rankings)
+    }
+}
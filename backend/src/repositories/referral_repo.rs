@@ -0,0 +1,205 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::referral::{Referral, ReferralEntry, ReferralProgress, ReferralStatus};
+
+pub struct ReferralRepository;
+
+impl ReferralRepository {
+    // ==================== Codes ====================
+
+    pub async fn find_code(pool: &PgPool, user_id: Uuid) -> AppResult<Option<String>> {
+        let code: Option<(String,)> =
+            sqlx::query_as("SELECT code FROM referral_codes WHERE user_id = $1")
+                .bind(user_id)
+                .fetch_optional(pool)
+                .await?;
+
+        Ok(code.map(|c| c.0))
+    }
+
+    /// Claim a code for the player. False if the code is taken or the
+    /// player already has one.
+    pub async fn create_code(pool: &PgPool, user_id: Uuid, code: &str) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO referral_codes (user_id, code)
+            VALUES ($1, $2)
+            ON CONFLICT DO NOTHING
+            "#,
+        )
+        .bind(user_id)
+        .bind(code)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn find_code_owner(pool: &PgPool, code: &str) -> AppResult<Option<Uuid>> {
+        let owner: Option<(Uuid,)> =
+            sqlx::query_as("SELECT user_id FROM referral_codes WHERE code = $1")
+                .bind(code)
+                .fetch_optional(pool)
+                .await?;
+
+        Ok(owner.map(|o| o.0))
+    }
+
+    // ==================== Referrals ====================
+
+    pub async fn create(
+        pool: &PgPool,
+        referrer_id: Uuid,
+        referee_id: Uuid,
+        status: ReferralStatus,
+        rejected_reason: Option<&str>,
+    ) -> AppResult<Option<Referral>> {
+        let referral = sqlx::query_as::<_, Referral>(
+            r#"
+            INSERT INTO referrals (referrer_id, referee_id, status, rejected_reason)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (referee_id) DO NOTHING
+            RETURNING id, referrer_id, referee_id, status, milestones_reached, gold_earned,
+                      rejected_reason, created_at, updated_at
+            "#,
+        )
+        .bind(referrer_id)
+        .bind(referee_id)
+        .bind(status)
+        .bind(rejected_reason)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(referral)
+    }
+
+    /// Players the referrer brought in since `since`
+    pub async fn count_since(
+        pool: &PgPool,
+        referrer_id: Uuid,
+        since: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            "SELECT COUNT(*) FROM referrals WHERE referrer_id = $1 AND created_at >= $2",
+        )
+        .bind(referrer_id)
+        .bind(since)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Active referrals with the referee's current population
+    pub async fn find_active(pool: &PgPool, limit: i64) -> AppResult<Vec<ReferralProgress>> {
+        let referrals = sqlx::query_as::<_, ReferralProgress>(
+            r#"
+            SELECT r.id, r.referrer_id, r.referee_id, r.milestones_reached,
+                   COALESCE((SELECT SUM(v.population) FROM villages v
+                             WHERE v.user_id = r.referee_id), 0)::INT AS population
+            FROM referrals r
+            WHERE r.status = 'active'
+            ORDER BY r.updated_at ASC
+            LIMIT $1
+            "#,
+        )
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(referrals)
+    }
+
+    /// Record paid milestones. Only applies while the referral is still at
+    /// `from_milestones`, so a milestone can't be paid twice.
+    pub async fn advance(
+        pool: &PgPool,
+        id: Uuid,
+        from_milestones: i32,
+        to_milestones: i32,
+        gold: i32,
+        completed: bool,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE referrals
+            SET milestones_reached = $3, gold_earned = gold_earned + $4,
+                status = CASE WHEN $5 THEN 'completed'::referral_status ELSE status END,
+                updated_at = $6
+            WHERE id = $1 AND status = 'active' AND milestones_reached = $2
+            "#,
+        )
+        .bind(id)
+        .bind(from_milestones)
+        .bind(to_milestones)
+        .bind(gold)
+        .bind(completed)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn reject(
+        pool: &PgPool,
+        id: Uuid,
+        reason: &str,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE referrals
+            SET status = 'rejected', rejected_reason = $2, updated_at = $3
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .bind(reason)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Touch a referral that was checked but paid nothing, so the job
+    /// moves on to others
+    pub async fn touch(pool: &PgPool, id: Uuid, now: DateTime<Utc>) -> AppResult<()> {
+        sqlx::query("UPDATE referrals SET updated_at = $2 WHERE id = $1")
+            .bind(id)
+            .bind(now)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    pub async fn list_for_referrer(
+        pool: &PgPool,
+        referrer_id: Uuid,
+    ) -> AppResult<Vec<ReferralEntry>> {
+        let entries = sqlx::query_as::<_, ReferralEntry>(
+            r#"
+            SELECT r.referee_id, u.display_name, r.status, r.milestones_reached,
+                   r.gold_earned,
+                   COALESCE((SELECT SUM(v.population) FROM villages v
+                             WHERE v.user_id = r.referee_id), 0)::INT AS population,
+                   r.created_at
+            FROM referrals r
+            JOIN users u ON u.id = r.referee_id
+            WHERE r.referrer_id = $1
+            ORDER BY r.created_at DESC
+            "#,
+        )
+        .bind(referrer_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+}
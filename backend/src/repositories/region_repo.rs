@@ -0,0 +1,190 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::region::{RegionControl, RegionPopulation, RegionWinner, VictoryStanding};
+use crate::models::village::WORLD_RADIUS;
+
+pub struct RegionRepository;
+
+impl RegionRepository {
+    // ==================== Population ====================
+
+    /// Population per region and alliance. Villages of players outside any
+    /// alliance are grouped under None so they still count against a
+    /// majority.
+    pub async fn population_by_region(
+        pool: &PgPool,
+        per_axis: i32,
+    ) -> AppResult<Vec<RegionPopulation>> {
+        let rows = sqlx::query_as::<_, RegionPopulation>(
+            r#"
+            SELECT ((v.y + $1) * $2 / ($1 * 2 + 1)) * $2
+                       + ((v.x + $1) * $2 / ($1 * 2 + 1)) AS region_id,
+                   am.alliance_id,
+                   SUM(v.population)::BIGINT AS population
+            FROM villages v
+            LEFT JOIN alliance_members am ON am.user_id = v.user_id
+            WHERE v.population > 0
+            GROUP BY 1, 2
+            "#,
+        )
+        .bind(WORLD_RADIUS)
+        .bind(per_axis)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows)
+    }
+
+    // ==================== Control ====================
+
+    pub async fn find_all_control(pool: &PgPool) -> AppResult<Vec<RegionControl>> {
+        let rows = sqlx::query_as::<_, RegionControl>(
+            r#"
+            SELECT region_id, alliance_id, held_since, scoring, evaluated_at
+            FROM region_control
+            ORDER BY region_id
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows)
+    }
+
+    /// Whether the alliance has a scoring hold on the region
+    pub async fn is_scoring(pool: &PgPool, region_id: i32, alliance_id: Uuid) -> AppResult<bool> {
+        let scoring = sqlx::query_scalar::<_, bool>(
+            r#"
+            SELECT EXISTS (
+                SELECT 1 FROM region_control
+                WHERE region_id = $1 AND alliance_id = $2 AND scoring
+            )
+            "#,
+        )
+        .bind(region_id)
+        .bind(alliance_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(scoring)
+    }
+
+    pub async fn upsert_control(pool: &PgPool, control: &RegionControl) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO region_control (region_id, alliance_id, held_since, scoring, evaluated_at)
+            VALUES ($1, $2, $3, $4, $5)
+            ON CONFLICT (region_id) DO UPDATE
+            SET alliance_id = EXCLUDED.alliance_id,
+                held_since = EXCLUDED.held_since,
+                scoring = EXCLUDED.scoring,
+                evaluated_at = EXCLUDED.evaluated_at,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(control.region_id)
+        .bind(control.alliance_id)
+        .bind(control.held_since)
+        .bind(control.scoring)
+        .bind(control.evaluated_at)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Forget who holds what, e.g. after the grid changes. Points already
+    /// earned are kept.
+    pub async fn reset_control(pool: &PgPool) -> AppResult<()> {
+        sqlx::query("DELETE FROM region_control")
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    // ==================== Victory Points ====================
+
+    /// Add points and return the alliance's new total
+    pub async fn add_points(pool: &PgPool, alliance_id: Uuid, points: i64) -> AppResult<i64> {
+        let total = sqlx::query_scalar::<_, i64>(
+            r#"
+            INSERT INTO alliance_victory_points (alliance_id, points)
+            VALUES ($1, $2)
+            ON CONFLICT (alliance_id) DO UPDATE
+            SET points = alliance_victory_points.points + EXCLUDED.points,
+                updated_at = NOW()
+            RETURNING points
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(points)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(total)
+    }
+
+    pub async fn leaderboard(pool: &PgPool, limit: i64) -> AppResult<Vec<VictoryStanding>> {
+        let rows = sqlx::query_as::<_, VictoryStanding>(
+            r#"
+            SELECT a.id AS alliance_id, a.name AS alliance_name, a.tag AS alliance_tag,
+                   vp.points,
+                   (SELECT COUNT(*) FROM region_control rc
+                    WHERE rc.alliance_id = a.id AND rc.scoring) AS regions_held
+            FROM alliance_victory_points vp
+            JOIN alliances a ON a.id = vp.alliance_id
+            ORDER BY vp.points DESC, vp.updated_at ASC
+            LIMIT $1
+            "#,
+        )
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows)
+    }
+
+    // ==================== Victory ====================
+
+    pub async fn winner(pool: &PgPool) -> AppResult<Option<RegionWinner>> {
+        let winner = sqlx::query_as::<_, RegionWinner>(
+            r#"
+            SELECT alliance_id, alliance_name, alliance_tag, points, won_at
+            FROM region_victory
+            "#,
+        )
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(winner)
+    }
+
+    /// Record the winner. Returns false if the world was already won.
+    pub async fn record_winner(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        points: i64,
+        won_at: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            INSERT INTO region_victory (alliance_id, alliance_name, alliance_tag, points, won_at)
+            SELECT id, name, tag, $2, $3
+            FROM alliances
+            WHERE id = $1
+            ON CONFLICT (id) DO NOTHING
+            "#,
+        )
+        .bind(alliance_id)
+        .bind(points)
+        .bind(won_at)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+}
@@ -0,0 +1,449 @@
+use chrono::{DateTime, Utc};
+use sqlx::{PgConnection, PgExecutor, PgPool};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::registration::{
+    GroupReservation, PreRegistration, PreRegistrationStatus, RegistrationGroup, RegistrationWave,
+};
+use crate::models::village::Quadrant;
+
+const GROUP_COLUMNS: &str = "g.id, g.name, g.tag, g.code, g.leader_id, g.quadrant, g.slots, \
+                             (SELECT COUNT(*) FROM pre_registrations p WHERE p.group_id = g.id) \
+                             as members, g.created_at";
+
+pub struct RegistrationRepository;
+
+impl RegistrationRepository {
+    /// Hold the registration lock until the transaction ends. Whatever
+    /// counts a quadrant's room and then takes a place in it (founding a
+    /// first village, sending a wave's invites, reserving a group's places)
+    /// goes through this, so two of them never both take the last place.
+    pub async fn lock(conn: &mut PgConnection) -> AppResult<()> {
+        sqlx::query("SELECT pg_advisory_xact_lock(hashtext('registration'))")
+            .execute(conn)
+            .await?;
+
+        Ok(())
+    }
+
+    // ==================== Pre-registrations ====================
+
+    pub async fn find_by_user<'e>(
+        executor: impl PgExecutor<'e>,
+        user_id: Uuid,
+    ) -> AppResult<Option<PreRegistration>> {
+        let registration = sqlx::query_as::<_, PreRegistration>(
+            "SELECT * FROM pre_registrations WHERE user_id = $1",
+        )
+        .bind(user_id)
+        .fetch_optional(executor)
+        .await?;
+
+        Ok(registration)
+    }
+
+    /// Put the player at the back of the queue, replacing an earlier
+    /// pre-registration
+    pub async fn enqueue<'e>(
+        executor: impl PgExecutor<'e>,
+        user_id: Uuid,
+        quadrant: Option<Quadrant>,
+        group_id: Option<Uuid>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO pre_registrations (user_id, quadrant, group_id)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (user_id) DO UPDATE
+            SET quadrant = EXCLUDED.quadrant, group_id = EXCLUDED.group_id,
+                status = 'queued', wave_id = NULL, invited_at = NULL,
+                expires_at = NULL, joined_at = NULL, created_at = NOW()
+            "#,
+        )
+        .bind(user_id)
+        .bind(quadrant)
+        .bind(group_id)
+        .execute(executor)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Change where a queued player starts, keeping their place
+    pub async fn set_choice<'e>(
+        executor: impl PgExecutor<'e>,
+        id: Uuid,
+        quadrant: Option<Quadrant>,
+        group_id: Option<Uuid>,
+    ) -> AppResult<()> {
+        sqlx::query("UPDATE pre_registrations SET quadrant = $2, group_id = $3 WHERE id = $1")
+            .bind(id)
+            .bind(quadrant)
+            .bind(group_id)
+            .execute(executor)
+            .await?;
+
+        Ok(())
+    }
+
+    pub async fn delete(pool: &PgPool, id: Uuid) -> AppResult<()> {
+        sqlx::query("DELETE FROM pre_registrations WHERE id = $1")
+            .bind(id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Players queued no later than `created_at`, i.e. a queued player's
+    /// place in line
+    pub async fn queue_position(pool: &PgPool, created_at: DateTime<Utc>) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*) FROM pre_registrations
+            WHERE status = 'queued' AND created_at <= $1
+            "#,
+        )
+        .bind(created_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn count_by_status(pool: &PgPool) -> AppResult<Vec<(PreRegistrationStatus, i64)>> {
+        let counts: Vec<(PreRegistrationStatus, i64)> =
+            sqlx::query_as("SELECT status, COUNT(*) FROM pre_registrations GROUP BY status")
+                .fetch_all(pool)
+                .await?;
+
+        Ok(counts)
+    }
+
+    /// The whole queue, first in line first
+    pub async fn find_queued<'e>(executor: impl PgExecutor<'e>) -> AppResult<Vec<PreRegistration>> {
+        let queue = sqlx::query_as::<_, PreRegistration>(
+            r#"
+            SELECT * FROM pre_registrations
+            WHERE status = 'queued'
+            ORDER BY created_at, id
+            "#,
+        )
+        .fetch_all(executor)
+        .await?;
+
+        Ok(queue)
+    }
+
+    /// Invites still good, by the quadrant they start in
+    pub async fn count_invited_by_quadrant<'e>(
+        executor: impl PgExecutor<'e>,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<(Quadrant, i64)>> {
+        let counts: Vec<(Quadrant, i64)> = sqlx::query_as(
+            r#"
+            SELECT quadrant, COUNT(*) FROM pre_registrations
+            WHERE status = 'invited' AND expires_at > $1 AND quadrant IS NOT NULL
+            GROUP BY quadrant
+            "#,
+        )
+        .bind(now)
+        .fetch_all(executor)
+        .await?;
+
+        Ok(counts)
+    }
+
+    /// Invite queued players. `quadrant` pins where they start, if set.
+    pub async fn invite<'e>(
+        executor: impl PgExecutor<'e>,
+        ids: &[Uuid],
+        quadrant: Option<Quadrant>,
+        wave_id: Uuid,
+        now: DateTime<Utc>,
+        expires_at: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE pre_registrations
+            SET status = 'invited', quadrant = COALESCE($2, quadrant), wave_id = $3,
+                invited_at = $4, expires_at = $5
+            WHERE id = ANY($1) AND status = 'queued'
+            "#,
+        )
+        .bind(ids)
+        .bind(quadrant)
+        .bind(wave_id)
+        .bind(now)
+        .bind(expires_at)
+        .execute(executor)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Record that the player founded their first village
+    pub async fn mark_joined<'e>(
+        executor: impl PgExecutor<'e>,
+        user_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE pre_registrations
+            SET status = 'joined', joined_at = $2
+            WHERE user_id = $1 AND status <> 'joined'
+            "#,
+        )
+        .bind(user_id)
+        .bind(now)
+        .execute(executor)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn expire_invites(pool: &PgPool, now: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE pre_registrations
+            SET status = 'expired'
+            WHERE status = 'invited' AND expires_at <= $1
+            "#,
+        )
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    // ==================== Groups ====================
+
+    pub async fn create_group<'e>(
+        executor: impl PgExecutor<'e>,
+        name: &str,
+        tag: &str,
+        code: &str,
+        leader_id: Uuid,
+        quadrant: Quadrant,
+        slots: i32,
+    ) -> AppResult<Uuid> {
+        let id: (Uuid,) = sqlx::query_as(
+            r#"
+            INSERT INTO registration_groups (name, tag, code, leader_id, quadrant, slots)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            RETURNING id
+            "#,
+        )
+        .bind(name)
+        .bind(tag)
+        .bind(code)
+        .bind(leader_id)
+        .bind(quadrant)
+        .bind(slots)
+        .fetch_one(executor)
+        .await?;
+
+        Ok(id.0)
+    }
+
+    pub async fn find_group(pool: &PgPool, id: Uuid) -> AppResult<Option<RegistrationGroup>> {
+        let group = sqlx::query_as::<_, RegistrationGroup>(&format!(
+            "SELECT {GROUP_COLUMNS} FROM registration_groups g WHERE g.id = $1"
+        ))
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(group)
+    }
+
+    pub async fn find_group_by_code(
+        pool: &PgPool,
+        code: &str,
+    ) -> AppResult<Option<RegistrationGroup>> {
+        let group = sqlx::query_as::<_, RegistrationGroup>(&format!(
+            "SELECT {GROUP_COLUMNS} FROM registration_groups g WHERE g.code = $1"
+        ))
+        .bind(code)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(group)
+    }
+
+    pub async fn find_groups<'e>(
+        executor: impl PgExecutor<'e>,
+    ) -> AppResult<Vec<RegistrationGroup>> {
+        let groups = sqlx::query_as::<_, RegistrationGroup>(&format!(
+            "SELECT {GROUP_COLUMNS} FROM registration_groups g ORDER BY g.created_at"
+        ))
+        .fetch_all(executor)
+        .await?;
+
+        Ok(groups)
+    }
+
+    /// Places each group still holds, leaving out groups holding none
+    pub async fn find_reservations<'e>(
+        executor: impl PgExecutor<'e>,
+    ) -> AppResult<Vec<GroupReservation>> {
+        let reservations = sqlx::query_as::<_, GroupReservation>(
+            r#"
+            SELECT * FROM (
+                SELECT g.id as group_id, g.quadrant,
+                       g.slots - (
+                           SELECT COUNT(*) FROM pre_registrations p
+                           WHERE p.group_id = g.id AND p.status IN ('invited', 'joined')
+                       ) as held
+                FROM registration_groups g
+            ) r
+            WHERE held > 0
+            "#,
+        )
+        .fetch_all(executor)
+        .await?;
+
+        Ok(reservations)
+    }
+
+    /// Disband a group; its members stay queued on their own
+    pub async fn delete_group(pool: &PgPool, id: Uuid) -> AppResult<()> {
+        sqlx::query("DELETE FROM registration_groups WHERE id = $1")
+            .bind(id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    // ==================== Waves ====================
+
+    pub async fn create_wave(
+        pool: &PgPool,
+        scheduled_at: DateTime<Utc>,
+        size: i32,
+        created_by: Uuid,
+    ) -> AppResult<RegistrationWave> {
+        let wave = sqlx::query_as::<_, RegistrationWave>(
+            r#"
+            INSERT INTO registration_waves (scheduled_at, size, created_by)
+            VALUES ($1, $2, $3)
+            RETURNING *
+            "#,
+        )
+        .bind(scheduled_at)
+        .bind(size)
+        .bind(created_by)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(wave)
+    }
+
+    pub async fn find_wave(pool: &PgPool, id: Uuid) -> AppResult<Option<RegistrationWave>> {
+        let wave =
+            sqlx::query_as::<_, RegistrationWave>("SELECT * FROM registration_waves WHERE id = $1")
+                .bind(id)
+                .fetch_optional(pool)
+                .await?;
+
+        Ok(wave)
+    }
+
+    pub async fn find_waves(pool: &PgPool, limit: i64) -> AppResult<Vec<RegistrationWave>> {
+        let waves = sqlx::query_as::<_, RegistrationWave>(
+            "SELECT * FROM registration_waves ORDER BY scheduled_at DESC LIMIT $1",
+        )
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(waves)
+    }
+
+    pub async fn find_due_waves(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<RegistrationWave>> {
+        let waves = sqlx::query_as::<_, RegistrationWave>(
+            r#"
+            SELECT * FROM registration_waves
+            WHERE status = 'scheduled' AND scheduled_at <= $1
+            ORDER BY scheduled_at
+            "#,
+        )
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(waves)
+    }
+
+    pub async fn next_wave_at(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<DateTime<Utc>>> {
+        let next: (Option<DateTime<Utc>>,) = sqlx::query_as(
+            r#"
+            SELECT MIN(scheduled_at) FROM registration_waves
+            WHERE status = 'scheduled' AND scheduled_at > $1
+            "#,
+        )
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(next.0)
+    }
+
+    /// Take a scheduled wave for release. False if it was released or
+    /// cancelled already, so two releases never both send invites.
+    pub async fn claim_wave<'e>(
+        executor: impl PgExecutor<'e>,
+        id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE registration_waves
+            SET status = 'released', released_at = $2
+            WHERE id = $1 AND status = 'scheduled'
+            "#,
+        )
+        .bind(id)
+        .bind(now)
+        .execute(executor)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn set_invited<'e>(
+        executor: impl PgExecutor<'e>,
+        id: Uuid,
+        invited: i32,
+    ) -> AppResult<()> {
+        sqlx::query("UPDATE registration_waves SET invited = $2 WHERE id = $1")
+            .bind(id)
+            .bind(invited)
+            .execute(executor)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Call off a scheduled wave. False if it isn't scheduled.
+    pub async fn cancel_wave(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            "UPDATE registration_waves SET status = 'cancelled' WHERE id = $1 AND status = 'scheduled'",
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+}
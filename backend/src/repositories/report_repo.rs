@@ -0,0 +1,289 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::army::BattleReport;
+use crate::models::soft_delete::DeletedItem;
+use crate::models::world_setting::ReportArchive;
+
+pub struct ReportRepository;
+
+impl ReportRepository {
+    // ==================== Retention ====================
+
+    /// Delete raid reports older than the cutoff that no participant has opened
+    pub async fn delete_unread_raids(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            DELETE FROM battle_reports
+            WHERE mission = 'raid'
+                AND occurred_at < $1
+                AND read_by_attacker = FALSE
+                AND (defender_player_id IS NULL OR read_by_defender = FALSE)
+            "#,
+        )
+        .bind(before)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    pub async fn delete_scout_reports(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM scout_reports WHERE occurred_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    // ==================== Archiving ====================
+
+    /// Oldest battle reports before the cutoff, for archiving in batches
+    pub async fn find_reports_before(
+        pool: &PgPool,
+        before: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<BattleReport>> {
+        let reports = sqlx::query_as::<_, BattleReport>(
+            r#"
+            SELECT id, attacker_player_id, defender_player_id, attacker_village_id, defender_village_id,
+                   mission, attacker_troops, defender_troops, attacker_losses, defender_losses,
+                   defender_wounded, resources_stolen, winner, occurred_at,
+                   read_by_attacker, read_by_defender, deleted_by_attacker, deleted_by_defender,
+                   created_at
+            FROM battle_reports
+            WHERE occurred_at < $1
+            ORDER BY occurred_at
+            LIMIT $2
+            "#,
+        )
+        .bind(before)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(reports)
+    }
+
+    pub async fn delete_reports(
+        pool: &PgPool,
+        ids: &[Uuid],
+        before: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        // occurred_at bound lets the planner skip partitions that can't match
+        let result =
+            sqlx::query("DELETE FROM battle_reports WHERE id = ANY($1) AND occurred_at < $2")
+                .bind(ids)
+                .bind(before)
+                .execute(pool)
+                .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    pub async fn create_archive(
+        pool: &PgPool,
+        object_key: &str,
+        report_count: i32,
+        oldest_occurred_at: DateTime<Utc>,
+        newest_occurred_at: DateTime<Utc>,
+    ) -> AppResult<ReportArchive> {
+        let archive = sqlx::query_as::<_, ReportArchive>(
+            r#"
+            INSERT INTO report_archives (object_key, report_count, oldest_occurred_at, newest_occurred_at)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id, object_key, report_count, oldest_occurred_at, newest_occurred_at, created_at
+            "#,
+        )
+        .bind(object_key)
+        .bind(report_count)
+        .bind(oldest_occurred_at)
+        .bind(newest_occurred_at)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(archive)
+    }
+
+    pub async fn list_archives(
+        pool: &PgPool,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<ReportArchive>> {
+        let archives = sqlx::query_as::<_, ReportArchive>(
+            r#"
+            SELECT id, object_key, report_count, oldest_occurred_at, newest_occurred_at, created_at
+            FROM report_archives
+            ORDER BY created_at DESC
+            LIMIT $1 OFFSET $2
+            "#,
+        )
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(archives)
+    }
+
+    // ==================== Soft Delete ====================
+
+    /// Battle reports the player has deleted on their side
+    pub async fn find_deleted_reports(
+        pool: &PgPool,
+        player_id: Uuid,
+    ) -> AppResult<Vec<DeletedItem>> {
+        let items = sqlx::query_as::<_, DeletedItem>(
+            r#"
+            SELECT id, mission::text || ', ' || winner || ' won' AS summary,
+                   occurred_at AS created_at, deleted_at
+            FROM battle_reports
+            WHERE (attacker_player_id = $1 AND deleted_by_attacker = TRUE)
+               OR (defender_player_id = $1 AND deleted_by_defender = TRUE)
+            ORDER BY occurred_at DESC
+            LIMIT 100
+            "#,
+        )
+        .bind(player_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(items)
+    }
+
+    pub async fn find_deleted_scout_reports(
+        pool: &PgPool,
+        player_id: Uuid,
+    ) -> AppResult<Vec<DeletedItem>> {
+        let items = sqlx::query_as::<_, DeletedItem>(
+            r#"
+            SELECT id,
+                   CASE WHEN success THEN 'scouting succeeded' ELSE 'scouting failed' END
+                       AS summary,
+                   occurred_at AS created_at, deleted_at
+            FROM scout_reports
+            WHERE (attacker_player_id = $1 AND deleted_by_attacker = TRUE)
+               OR (defender_player_id = $1 AND deleted_by_defender = TRUE)
+            ORDER BY occurred_at DESC
+            LIMIT 100
+            "#,
+        )
+        .bind(player_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(items)
+    }
+
+    /// Show a deleted report to both sides again
+    pub async fn restore_report(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE battle_reports
+            SET deleted_by_attacker = FALSE, deleted_by_defender = FALSE, deleted_at = NULL
+            WHERE id = $1 AND (deleted_by_attacker = TRUE OR deleted_by_defender = TRUE)
+            "#,
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn restore_scout_report(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE scout_reports
+            SET deleted_by_attacker = FALSE, deleted_by_defender = FALSE, deleted_at = NULL
+            WHERE id = $1 AND (deleted_by_attacker = TRUE OR deleted_by_defender = TRUE)
+            "#,
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Remove reports every side deleted before the cutoff
+    pub async fn purge_deleted_reports(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM battle_reports WHERE deleted_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    pub async fn purge_deleted_scout_reports(
+        pool: &PgPool,
+        before: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM scout_reports WHERE deleted_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    // ==================== Partitions ====================
+
+    /// Create the monthly partition containing `at` if it doesn't exist yet
+    pub async fn ensure_partition(pool: &PgPool, at: DateTime<Utc>) -> AppResult<String> {
+        let name: (String,) = sqlx::query_as("SELECT create_battle_reports_partition($1)")
+            .bind(at)
+            .fetch_one(pool)
+            .await?;
+
+        Ok(name.0)
+    }
+
+    /// Names of the monthly partitions (battle_reports_YYYY_MM), oldest first
+    pub async fn list_partitions(pool: &PgPool) -> AppResult<Vec<String>> {
+        let names: Vec<(String,)> = sqlx::query_as(
+            r#"
+            SELECT c.relname::text
+            FROM pg_inherits i
+            JOIN pg_class c ON c.oid = i.inhrelid
+            JOIN pg_class p ON p.oid = i.inhparent
+            WHERE p.relname = 'battle_reports'
+                AND c.relname <> 'battle_reports_default'
+            ORDER BY c.relname
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(names.into_iter().map(|(n,)| n).collect())
+    }
+
+    /// Drop a monthly partition, but only if every row in it has been archived or deleted.
+    /// `partition` must come from `list_partitions`.
+    pub async fn drop_partition_if_empty(pool: &PgPool, partition: &str) -> AppResult<bool> {
+        // Identifiers can't be bound, so Postgres quotes the name itself
+        let table: (String,) = sqlx::query_as("SELECT quote_ident($1)")
+            .bind(partition)
+            .fetch_one(pool)
+            .await?;
+
+        let has_rows: (bool,) =
+            sqlx::query_as(&format!("SELECT EXISTS (SELECT 1 FROM {})", table.0))
+                .fetch_one(pool)
+                .await?;
+
+        if has_rows.0 {
+            return Ok(false);
+        }
+
+        sqlx::query(&format!("DROP TABLE {}", table.0))
+            .execute(pool)
+            .await?;
+
+        Ok(true)
+    }
+}
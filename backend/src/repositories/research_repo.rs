@@ -0,0 +1,156 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::research::ResearchQueueEntry;
+use crate::models::troop::TroopType;
+
+pub struct ResearchRepository;
+
+impl ResearchRepository {
+    // ==================== Researched Units ====================
+
+    pub async fn find_researched(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<TroopType>> {
+        let rows: Vec<(TroopType,)> = sqlx::query_as(
+            r#"
+            SELECT troop_type
+            FROM village_research
+            WHERE village_id = $1
+            ORDER BY researched_at ASC
+            "#,
+        )
+        .bind(village_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows.into_iter().map(|(t,)| t).collect())
+    }
+
+    pub async fn is_researched(
+        pool: &PgPool,
+        village_id: Uuid,
+        troop_type: TroopType,
+    ) -> AppResult<bool> {
+        let row: (bool,) = sqlx::query_as(
+            r#"
+            SELECT EXISTS (
+                SELECT 1 FROM village_research
+                WHERE village_id = $1 AND troop_type = $2
+            )
+            "#,
+        )
+        .bind(village_id)
+        .bind(troop_type)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(row.0)
+    }
+
+    // ==================== Research Queue ====================
+
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<ResearchQueueEntry>> {
+        let entry = sqlx::query_as::<_, ResearchQueueEntry>(
+            r#"
+            SELECT id, village_id, troop_type, started_at, ends_at, created_at
+            FROM research_queue
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(entry)
+    }
+
+    pub async fn find_in_progress(
+        pool: &PgPool,
+        village_id: Uuid,
+    ) -> AppResult<Option<ResearchQueueEntry>> {
+        let entry = sqlx::query_as::<_, ResearchQueueEntry>(
+            r#"
+            SELECT id, village_id, troop_type, started_at, ends_at, created_at
+            FROM research_queue
+            WHERE village_id = $1
+            "#,
+        )
+        .bind(village_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(entry)
+    }
+
+    /// Start a research. None if the academy is already busy.
+    pub async fn start(
+        pool: &PgPool,
+        village_id: Uuid,
+        troop_type: TroopType,
+        started_at: DateTime<Utc>,
+        ends_at: DateTime<Utc>,
+    ) -> AppResult<Option<ResearchQueueEntry>> {
+        let entry = sqlx::query_as::<_, ResearchQueueEntry>(
+            r#"
+            INSERT INTO research_queue (village_id, troop_type, started_at, ends_at)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (village_id) DO NOTHING
+            RETURNING id, village_id, troop_type, started_at, ends_at, created_at
+            "#,
+        )
+        .bind(village_id)
+        .bind(troop_type)
+        .bind(started_at)
+        .bind(ends_at)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(entry)
+    }
+
+    pub async fn find_completed(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<ResearchQueueEntry>> {
+        let entries = sqlx::query_as::<_, ResearchQueueEntry>(
+            r#"
+            SELECT id, village_id, troop_type, started_at, ends_at, created_at
+            FROM research_queue
+            WHERE ends_at <= $1
+            ORDER BY ends_at ASC
+            "#,
+        )
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(entries)
+    }
+
+    /// Move a research from the queue to the village's researched units in
+    /// one statement. None if it was already completed.
+    pub async fn complete(pool: &PgPool, id: Uuid) -> AppResult<Option<ResearchQueueEntry>> {
+        let entry = sqlx::query_as::<_, ResearchQueueEntry>(
+            r#"
+            WITH done AS (
+                DELETE FROM research_queue
+                WHERE id = $1
+                RETURNING id, village_id, troop_type, started_at, ends_at, created_at
+            ),
+            learned AS (
+                INSERT INTO village_research (village_id, troop_type)
+                SELECT village_id, troop_type FROM done
+                ON CONFLICT DO NOTHING
+            )
+            SELECT id, village_id, troop_type, started_at, ends_at, created_at
+            FROM done
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(entry)
+    }
+}
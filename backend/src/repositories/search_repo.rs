@@ -0,0 +1,172 @@
+use chrono::{DateTime, Utc};
+use sqlx::{PgConnection, PgPool};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::search::{MessageSearchResult, ReportSearchResult};
+
+// Queries and highlights are parsed with the configured text search
+// language, the one the search_vector columns are built with (see
+// `set_language`).
+
+/// Headlines are HTML; the text is escaped (html_escape) before the matches
+/// are marked
+const HEADLINE_OPTIONS: &str =
+    "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5";
+
+pub struct SearchRepository;
+
+impl SearchRepository {
+    // ==================== Messages ====================
+
+    /// Search private messages the user can still see, plus messages of their current alliance
+    #[allow(clippy::too_many_arguments)]
+    pub async fn search_messages(
+        pool: &PgPool,
+        language: &str,
+        user_id: Uuid,
+        alliance_id: Option<Uuid>,
+        query: &str,
+        sender_id: Option<Uuid>,
+        from: Option<DateTime<Utc>>,
+        to: Option<DateTime<Utc>>,
+        limit: i32,
+        offset: i32,
+    ) -> AppResult<Vec<MessageSearchResult>> {
+        let results = sqlx::query_as::<_, MessageSearchResult>(
+            r#"
+            SELECT
+                m.id,
+                m.message_type,
+                m.sender_id,
+                sender.display_name as sender_name,
+                m.subject,
+                ts_headline($1::regconfig, html_escape(m.body), q.query, $10) as headline,
+                ts_rank(m.search_vector, q.query) as rank,
+                m.created_at
+            FROM messages m
+            CROSS JOIN websearch_to_tsquery($1::regconfig, $2) q(query)
+            JOIN users sender ON sender.id = m.sender_id
+            WHERE m.search_vector @@ q.query
+                AND (
+                    (m.message_type = 'private' AND m.recipient_id = $3 AND m.recipient_deleted = FALSE)
+                    OR (m.message_type = 'private' AND m.sender_id = $3 AND m.sender_deleted = FALSE)
+                    OR (m.message_type = 'alliance' AND m.alliance_id = $4)
+                )
+                AND ($5::uuid IS NULL OR m.sender_id = $5)
+                AND ($6::timestamptz IS NULL OR m.created_at >= $6)
+                AND ($7::timestamptz IS NULL OR m.created_at < $7)
+            ORDER BY rank DESC, m.created_at DESC
+            LIMIT $8 OFFSET $9
+            "#,
+        )
+        .bind(language)
+        .bind(query)
+        .bind(user_id)
+        .bind(alliance_id)
+        .bind(sender_id)
+        .bind(from)
+        .bind(to)
+        .bind(limit)
+        .bind(offset)
+        .bind(HEADLINE_OPTIONS)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(results)
+    }
+
+    // ==================== Battle Reports ====================
+
+    /// Search battle reports where the user is attacker or defender
+    #[allow(clippy::too_many_arguments)]
+    pub async fn search_reports(
+        pool: &PgPool,
+        language: &str,
+        user_id: Uuid,
+        query: &str,
+        from: Option<DateTime<Utc>>,
+        to: Option<DateTime<Utc>>,
+        limit: i32,
+        offset: i32,
+    ) -> AppResult<Vec<ReportSearchResult>> {
+        let results = sqlx::query_as::<_, ReportSearchResult>(
+            r#"
+            SELECT
+                br.id,
+                br.attacker_player_id,
+                br.defender_player_id,
+                br.mission,
+                br.winner,
+                ts_headline($1::regconfig, html_escape(br.search_text), q.query, $8) as headline,
+                ts_rank(br.search_vector, q.query) as rank,
+                br.occurred_at,
+                CASE WHEN br.attacker_player_id = $3 THEN br.read_by_attacker
+                     ELSE br.read_by_defender END as is_read
+            FROM battle_reports br
+            CROSS JOIN websearch_to_tsquery($1::regconfig, $2) q(query)
+            WHERE br.search_vector @@ q.query
+                AND (
+                    (br.attacker_player_id = $3 AND br.deleted_by_attacker = FALSE)
+                    OR (br.defender_player_id = $3 AND br.deleted_by_defender = FALSE)
+                )
+                AND ($4::timestamptz IS NULL OR br.occurred_at >= $4)
+                AND ($5::timestamptz IS NULL OR br.occurred_at < $5)
+            ORDER BY rank DESC, br.occurred_at DESC
+            LIMIT $6 OFFSET $7
+            "#,
+        )
+        .bind(language)
+        .bind(query)
+        .bind(user_id)
+        .bind(from)
+        .bind(to)
+        .bind(limit)
+        .bind(offset)
+        .bind(HEADLINE_OPTIONS)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(results)
+    }
+
+    // ==================== Language ====================
+
+    /// The text search configuration the vectors are built with, locked
+    /// until the transaction ends
+    pub async fn language_for_update(conn: &mut PgConnection) -> AppResult<String> {
+        let language: String =
+            sqlx::query_scalar("SELECT language::text FROM search_settings FOR UPDATE")
+                .fetch_one(conn)
+                .await?;
+
+        Ok(language)
+    }
+
+    /// Build the vectors with `language` from now on and rebuild the
+    /// stored ones. Returns how many rows were rebuilt.
+    pub async fn set_language(conn: &mut PgConnection, language: &str) -> AppResult<u64> {
+        sqlx::query("UPDATE search_settings SET language = $1::regconfig, updated_at = NOW()")
+            .bind(language)
+            .execute(&mut *conn)
+            .await?;
+
+        let messages = sqlx::query(
+            r#"
+            UPDATE messages
+            SET search_vector =
+                setweight(to_tsvector(search_language(), coalesce(subject, '')), 'A') ||
+                setweight(to_tsvector(search_language(), coalesce(body, '')), 'B')
+            "#,
+        )
+        .execute(&mut *conn)
+        .await?;
+        let reports = sqlx::query(
+            "UPDATE battle_reports SET search_vector = to_tsvector(search_language(), search_text)",
+        )
+        .execute(&mut *conn)
+        .await?;
+
+        Ok(messages.rows_affected() + reports.rows_affected())
+    }
+}
@@ -0,0 +1,166 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::activity::RequestOrigin;
+use crate::models::session::UserSession;
+
+pub struct SessionRepository;
+
+impl SessionRepository {
+    pub async fn find_by_key(pool: &PgPool, session_key: &str) -> AppResult<Option<UserSession>> {
+        let session = sqlx::query_as::<_, UserSession>(
+            r#"
+            SELECT id, user_id, session_key, device, client_ip, created_at, last_seen_at,
+                   revoked_at
+            FROM user_sessions
+            WHERE session_key = $1
+            "#,
+        )
+        .bind(session_key)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(session)
+    }
+
+    /// Record use of a session, creating it on first sight. Revoked sessions
+    /// are left alone. Keeps the last known device when the request has none
+    /// (WebSocket connections).
+    pub async fn touch(
+        pool: &PgPool,
+        user_id: Uuid,
+        session_key: &str,
+        origin: &RequestOrigin,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO user_sessions (user_id, session_key, device, client_ip, created_at,
+                                       last_seen_at)
+            VALUES ($1, $2, $3, $4, $5, $5)
+            ON CONFLICT (session_key) DO UPDATE
+            SET last_seen_at = EXCLUDED.last_seen_at,
+                device = COALESCE(EXCLUDED.device, user_sessions.device),
+                client_ip = COALESCE(EXCLUDED.client_ip, user_sessions.client_ip)
+            WHERE user_sessions.revoked_at IS NULL
+            "#,
+        )
+        .bind(user_id)
+        .bind(session_key)
+        .bind(&origin.device)
+        .bind(&origin.client_ip)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Sessions of a player, most recently used first
+    pub async fn list_for_user(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<UserSession>> {
+        let sessions = sqlx::query_as::<_, UserSession>(
+            r#"
+            SELECT id, user_id, session_key, device, client_ip, created_at, last_seen_at,
+                   revoked_at
+            FROM user_sessions
+            WHERE user_id = $1
+            ORDER BY revoked_at IS NOT NULL, last_seen_at DESC
+            "#,
+        )
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(sessions)
+    }
+
+    /// Revoke one of the player's active sessions. `None` if there is none.
+    pub async fn revoke(
+        pool: &PgPool,
+        id: Uuid,
+        user_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<UserSession>> {
+        let session = sqlx::query_as::<_, UserSession>(
+            r#"
+            UPDATE user_sessions
+            SET revoked_at = $3
+            WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+            RETURNING id, user_id, session_key, device, client_ip, created_at, last_seen_at,
+                      revoked_at
+            "#,
+        )
+        .bind(id)
+        .bind(user_id)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(session)
+    }
+
+    pub async fn revoke_by_key(
+        pool: &PgPool,
+        session_key: &str,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            "UPDATE user_sessions SET revoked_at = $2 WHERE session_key = $1 AND revoked_at IS NULL",
+        )
+        .bind(session_key)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Log every device of the account out
+    pub async fn revoke_all_for_user(
+        pool: &PgPool,
+        user_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            "UPDATE user_sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL",
+        )
+        .bind(user_id)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Revoke sessions unused since `idle_before`
+    pub async fn expire_idle(
+        pool: &PgPool,
+        idle_before: DateTime<Utc>,
+        now: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE user_sessions
+            SET revoked_at = $2
+            WHERE revoked_at IS NULL AND last_seen_at < $1
+            "#,
+        )
+        .bind(idle_before)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    pub async fn delete_revoked_before(pool: &PgPool, before: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query("DELETE FROM user_sessions WHERE revoked_at < $1")
+            .bind(before)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected())
+    }
+}
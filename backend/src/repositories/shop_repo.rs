@@ -2,7 +2,8 @@ use chrono::{DateTime, Duration, Utc};
 use sqlx::PgPool;
 use uuid::Uuid;
 
-use crate::error::AppResult;
+use crate::error::{AppError, AppResult};
+use crate::models::impersonation::Impersonation;
 use crate::models::shop::{
     GoldFeature, GoldFeatureCost, GoldPackage, GoldUsage, SubscriptionPrice, SubscriptionType,
     Transaction, TransactionStatus, TransactionType, UserSubscription,
@@ -74,6 +75,14 @@ impl ShopRepository {
 
     /// Deduct gold from user's balance (returns new balance or error if insufficient)
     pub async fn deduct_gold(pool: &PgPool, user_id: Uuid, amount: i32) -> AppResult<i32> {
+        // Staff acting as a player never spend the player's gold, whichever
+        // route the spending comes through
+        if Impersonation::current().is_some() {
+            return Err(AppError::Forbidden(
+                "Gold can't be spent while impersonating".into(),
+            ));
+        }
+
         let result: (i32,) = sqlx::query_as(
             r#"
             UPDATE users
@@ -90,6 +99,56 @@ impl ShopRepository {
         Ok(result.0)
     }
 
+    // ==================== User Silver Balance ====================
+
+    /// Get user's silver balance
+    pub async fn get_silver_balance(pool: &PgPool, user_id: Uuid) -> AppResult<i32> {
+        let result: (i32,) = sqlx::query_as(
+            r#"SELECT silver_balance FROM users WHERE id = $1"#,
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(result.0)
+    }
+
+    /// Add silver to user's balance
+    pub async fn add_silver(pool: &PgPool, user_id: Uuid, amount: i32) -> AppResult<i32> {
+        let result: (i32,) = sqlx::query_as(
+            r#"
+            UPDATE users
+            SET silver_balance = silver_balance + $2
+            WHERE id = $1
+            RETURNING silver_balance
+            "#,
+        )
+        .bind(user_id)
+        .bind(amount)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(result.0)
+    }
+
+    /// Deduct silver from user's balance (returns new balance or error if insufficient)
+    pub async fn deduct_silver(pool: &PgPool, user_id: Uuid, amount: i32) -> AppResult<i32> {
+        let result: (i32,) = sqlx::query_as(
+            r#"
+            UPDATE users
+            SET silver_balance = silver_balance - $2
+            WHERE id = $1 AND silver_balance >= $2
+            RETURNING silver_balance
+            "#,
+        )
+        .bind(user_id)
+        .bind(amount)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(result.0)
+    }
+
     // ==================== Transactions ====================
 
     /// Create a new transaction
@@ -0,0 +1,389 @@
+use chrono::Utc;
+use serde_json::Value;
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::snapshot::{
+    PlayerSnapshot, PlayerSnapshotRecord, SnapshotSummary, SNAPSHOT_FORMAT_VERSION,
+};
+
+pub struct SnapshotRepository;
+
+impl SnapshotRepository {
+    // ==================== Capture ====================
+
+    /// Read the player's current state as raw rows
+    pub async fn capture(pool: &PgPool, user_id: Uuid) -> AppResult<PlayerSnapshot> {
+        let villages = Self::rows(
+            pool,
+            "SELECT to_jsonb(v) FROM villages v WHERE v.user_id = $1 ORDER BY v.created_at",
+            user_id,
+        )
+        .await?;
+        let buildings = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(b) FROM buildings b
+            JOIN villages v ON v.id = b.village_id
+            WHERE v.user_id = $1
+            ORDER BY b.village_id, b.slot
+            "#,
+            user_id,
+        )
+        .await?;
+        let troops = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(t) FROM troops t
+            JOIN villages v ON v.id = t.village_id
+            WHERE v.user_id = $1
+            "#,
+            user_id,
+        )
+        .await?;
+        let troop_queue = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(q) FROM troop_queue q
+            JOIN villages v ON v.id = q.village_id
+            WHERE v.user_id = $1
+            ORDER BY q.ends_at
+            "#,
+            user_id,
+        )
+        .await?;
+        let armies = Self::rows(
+            pool,
+            "SELECT to_jsonb(a) FROM armies a WHERE a.player_id = $1 ORDER BY a.departed_at",
+            user_id,
+        )
+        .await?;
+        let heroes = Self::rows(
+            pool,
+            "SELECT to_jsonb(h) FROM heroes h WHERE h.user_id = $1 ORDER BY h.slot_number",
+            user_id,
+        )
+        .await?;
+        let hero_items = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(i) FROM hero_items i
+            JOIN heroes h ON h.id = i.hero_id
+            WHERE h.user_id = $1
+            "#,
+            user_id,
+        )
+        .await?;
+        let hero_adventures = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(a) FROM hero_adventures a
+            JOIN heroes h ON h.id = a.hero_id
+            WHERE h.user_id = $1
+            "#,
+            user_id,
+        )
+        .await?;
+        let building_queue = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(o) FROM building_queue o
+            JOIN villages v ON v.id = o.village_id
+            WHERE v.user_id = $1
+            ORDER BY o.village_id, o.created_at
+            "#,
+            user_id,
+        )
+        .await?;
+        let village_research = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(r) FROM village_research r
+            JOIN villages v ON v.id = r.village_id
+            WHERE v.user_id = $1
+            "#,
+            user_id,
+        )
+        .await?;
+        let research_queue = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(q) FROM research_queue q
+            JOIN villages v ON v.id = q.village_id
+            WHERE v.user_id = $1
+            "#,
+            user_id,
+        )
+        .await?;
+        let wounded_troops = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(w) FROM wounded_troops w
+            JOIN villages v ON v.id = w.village_id
+            WHERE v.user_id = $1
+            "#,
+            user_id,
+        )
+        .await?;
+        let healing_queue = Self::rows(
+            pool,
+            r#"
+            SELECT to_jsonb(q) FROM healing_queue q
+            JOIN villages v ON v.id = q.village_id
+            WHERE v.user_id = $1
+            ORDER BY q.ends_at
+            "#,
+            user_id,
+        )
+        .await?;
+
+        Ok(PlayerSnapshot {
+            format_version: SNAPSHOT_FORMAT_VERSION,
+            user_id,
+            taken_at: Utc::now(),
+            villages,
+            buildings,
+            troops,
+            troop_queue,
+            armies,
+            heroes,
+            hero_items,
+            hero_adventures,
+            building_queue,
+            village_research,
+            research_queue,
+            wounded_troops,
+            healing_queue,
+        })
+    }
+
+    async fn rows(pool: &PgPool, query: &str, user_id: Uuid) -> AppResult<Vec<Value>> {
+        let rows: Vec<(Value,)> = sqlx::query_as(query).bind(user_id).fetch_all(pool).await?;
+        Ok(rows.into_iter().map(|(v,)| v).collect())
+    }
+
+    // ==================== Storage ====================
+
+    pub async fn save(
+        pool: &PgPool,
+        snapshot: &PlayerSnapshot,
+        taken_by: Option<Uuid>,
+        reason: Option<&str>,
+    ) -> AppResult<SnapshotSummary> {
+        let summary = sqlx::query_as::<_, SnapshotSummary>(
+            r#"
+            INSERT INTO player_snapshots (user_id, taken_by, reason, data)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id, user_id, taken_by, reason,
+                      jsonb_array_length(data->'villages') as village_count,
+                      jsonb_array_length(data->'armies') as army_count,
+                      jsonb_array_length(data->'heroes') as hero_count,
+                      restored_at, created_at
+            "#,
+        )
+        .bind(snapshot.user_id)
+        .bind(taken_by)
+        .bind(reason)
+        .bind(sqlx::types::Json(snapshot))
+        .fetch_one(pool)
+        .await?;
+
+        Ok(summary)
+    }
+
+    pub async fn list_for_user(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<SnapshotSummary>> {
+        let snapshots = sqlx::query_as::<_, SnapshotSummary>(
+            r#"
+            SELECT id, user_id, taken_by, reason,
+                   jsonb_array_length(data->'villages') as village_count,
+                   jsonb_array_length(data->'armies') as army_count,
+                   jsonb_array_length(data->'heroes') as hero_count,
+                   restored_at, created_at
+            FROM player_snapshots
+            WHERE user_id = $1
+            ORDER BY created_at DESC
+            LIMIT 100
+            "#,
+        )
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(snapshots)
+    }
+
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<PlayerSnapshotRecord>> {
+        let snapshot = sqlx::query_as::<_, PlayerSnapshotRecord>(
+            r#"
+            SELECT id, user_id, taken_by, reason, data, restored_at, created_at
+            FROM player_snapshots
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(snapshot)
+    }
+
+    pub async fn mark_restored(pool: &PgPool, id: Uuid) -> AppResult<()> {
+        sqlx::query("UPDATE player_snapshots SET restored_at = NOW() WHERE id = $1")
+            .bind(id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    // ==================== Integrity Checks ====================
+
+    /// Of the given village ids, those that exist, with their current owner
+    pub async fn find_village_owners(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<(Uuid, Uuid)>> {
+        let owners: Vec<(Uuid, Uuid)> =
+            sqlx::query_as("SELECT id, user_id FROM villages WHERE id = ANY($1)")
+                .bind(ids)
+                .fetch_all(pool)
+                .await?;
+
+        Ok(owners)
+    }
+
+    /// Villages (other than the given ids) occupying any of the given coordinates
+    pub async fn find_coordinate_conflicts(
+        pool: &PgPool,
+        ids: &[Uuid],
+        xs: &[i32],
+        ys: &[i32],
+    ) -> AppResult<Vec<(i32, i32)>> {
+        let conflicts: Vec<(i32, i32)> = sqlx::query_as(
+            r#"
+            SELECT v.x, v.y
+            FROM villages v
+            JOIN unnest($1::uuid[], $2::int[], $3::int[]) AS s(id, x, y)
+                ON v.x = s.x AND v.y = s.y
+            WHERE v.id <> s.id
+            "#,
+        )
+        .bind(ids)
+        .bind(xs)
+        .bind(ys)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(conflicts)
+    }
+
+    pub async fn existing_item_definitions(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<Uuid>> {
+        let rows: Vec<(Uuid,)> =
+            sqlx::query_as("SELECT id FROM item_definitions WHERE id = ANY($1)")
+                .bind(ids)
+                .fetch_all(pool)
+                .await?;
+
+        Ok(rows.into_iter().map(|(id,)| id).collect())
+    }
+
+    // ==================== Restore ====================
+
+    /// Replace the player's state with the snapshot in one transaction.
+    /// Villages are upserted (never deleted) so reports and other players'
+    /// armies that point at them stay valid; everything hanging off the
+    /// snapshot's villages and heroes is replaced wholesale.
+    pub async fn restore(pool: &PgPool, snapshot: &PlayerSnapshot) -> AppResult<()> {
+        let village_ids: Vec<Uuid> = snapshot
+            .villages
+            .iter()
+            .filter_map(|v| v.get("id").and_then(|id| id.as_str()))
+            .filter_map(|id| id.parse().ok())
+            .collect();
+
+        let mut tx = pool.begin().await?;
+
+        sqlx::query(
+            r#"
+            INSERT INTO villages
+            SELECT * FROM jsonb_populate_recordset(NULL::villages, $1)
+            ON CONFLICT (id) DO UPDATE SET
+                name = EXCLUDED.name,
+                x = EXCLUDED.x,
+                y = EXCLUDED.y,
+                is_capital = EXCLUDED.is_capital,
+                field_type = EXCLUDED.field_type,
+                wood = EXCLUDED.wood,
+                clay = EXCLUDED.clay,
+                iron = EXCLUDED.iron,
+                crop = EXCLUDED.crop,
+                warehouse_capacity = EXCLUDED.warehouse_capacity,
+                granary_capacity = EXCLUDED.granary_capacity,
+                population = EXCLUDED.population,
+                culture_points = EXCLUDED.culture_points,
+                culture_per_day = EXCLUDED.culture_per_day,
+                culture_updated_at = EXCLUDED.culture_updated_at,
+                loyalty = EXCLUDED.loyalty,
+                resources_updated_at = EXCLUDED.resources_updated_at,
+                updated_at = NOW()
+            "#,
+        )
+        .bind(sqlx::types::Json(&snapshot.villages))
+        .execute(&mut *tx)
+        .await?;
+
+        for table in [
+            "building_queue",
+            "buildings",
+            "troops",
+            "troop_queue",
+            "village_research",
+            "research_queue",
+            "wounded_troops",
+            "healing_queue",
+        ] {
+            sqlx::query(&format!("DELETE FROM {} WHERE village_id = ANY($1)", table))
+                .bind(&village_ids)
+                .execute(&mut *tx)
+                .await?;
+        }
+
+        // Heroes cascade to hero_items and hero_adventures
+        sqlx::query("DELETE FROM armies WHERE player_id = $1")
+            .bind(snapshot.user_id)
+            .execute(&mut *tx)
+            .await?;
+        sqlx::query("DELETE FROM heroes WHERE user_id = $1")
+            .bind(snapshot.user_id)
+            .execute(&mut *tx)
+            .await?;
+
+        // Parents before children
+        for (table, rows) in [
+            ("buildings", &snapshot.buildings),
+            ("building_queue", &snapshot.building_queue),
+            ("troops", &snapshot.troops),
+            ("troop_queue", &snapshot.troop_queue),
+            ("village_research", &snapshot.village_research),
+            ("research_queue", &snapshot.research_queue),
+            ("wounded_troops", &snapshot.wounded_troops),
+            ("healing_queue", &snapshot.healing_queue),
+            ("heroes", &snapshot.heroes),
+            ("armies", &snapshot.armies),
+            ("hero_items", &snapshot.hero_items),
+            ("hero_adventures", &snapshot.hero_adventures),
+        ] {
+            if rows.is_empty() {
+                continue;
+            }
+            sqlx::query(&format!(
+                "INSERT INTO {table} SELECT * FROM jsonb_populate_recordset(NULL::{table}, $1)"
+            ))
+            .bind(sqlx::types::Json(rows))
+            .execute(&mut *tx)
+            .await?;
+        }
+
+        tx.commit().await?;
+
+        Ok(())
+    }
+}
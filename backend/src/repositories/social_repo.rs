@@ -0,0 +1,288 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::social::{Friendship, SocialEntry};
+
+pub struct SocialRepository;
+
+impl SocialRepository {
+    // ==================== Friendships ====================
+
+    /// The friendship or request between two players, either way round
+    pub async fn find_between(
+        pool: &PgPool,
+        user_a: Uuid,
+        user_b: Uuid,
+    ) -> AppResult<Option<Friendship>> {
+        let friendship = sqlx::query_as::<_, Friendship>(
+            r#"
+            SELECT id, requester_id, addressee_id, status, created_at, accepted_at
+            FROM friendships
+            WHERE (requester_id = $1 AND addressee_id = $2)
+               OR (requester_id = $2 AND addressee_id = $1)
+            "#,
+        )
+        .bind(user_a)
+        .bind(user_b)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(friendship)
+    }
+
+    pub async fn create_request(
+        pool: &PgPool,
+        requester_id: Uuid,
+        addressee_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Friendship> {
+        let friendship = sqlx::query_as::<_, Friendship>(
+            r#"
+            INSERT INTO friendships (requester_id, addressee_id, created_at)
+            VALUES ($1, $2, $3)
+            RETURNING id, requester_id, addressee_id, status, created_at, accepted_at
+            "#,
+        )
+        .bind(requester_id)
+        .bind(addressee_id)
+        .bind(now)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(friendship)
+    }
+
+    /// Accept a request sent to `addressee_id`. None if there is none pending.
+    pub async fn accept(
+        pool: &PgPool,
+        requester_id: Uuid,
+        addressee_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<Friendship>> {
+        let friendship = sqlx::query_as::<_, Friendship>(
+            r#"
+            UPDATE friendships
+            SET status = 'accepted', accepted_at = $3
+            WHERE requester_id = $1 AND addressee_id = $2 AND status = 'pending'
+            RETURNING id, requester_id, addressee_id, status, created_at, accepted_at
+            "#,
+        )
+        .bind(requester_id)
+        .bind(addressee_id)
+        .bind(now)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(friendship)
+    }
+
+    /// Remove a friendship or request between two players, either way round
+    pub async fn delete_between(pool: &PgPool, user_a: Uuid, user_b: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            DELETE FROM friendships
+            WHERE (requester_id = $1 AND addressee_id = $2)
+               OR (requester_id = $2 AND addressee_id = $1)
+            "#,
+        )
+        .bind(user_a)
+        .bind(user_b)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn count_friends(pool: &PgPool, user_id: Uuid) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*)
+            FROM friendships
+            WHERE (requester_id = $1 OR addressee_id = $1) AND status = 'accepted'
+            "#,
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn count_pending_sent(pool: &PgPool, user_id: Uuid) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*)
+            FROM friendships
+            WHERE requester_id = $1 AND status = 'pending'
+            "#,
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Requests the player sent since `since`, whatever became of them
+    pub async fn count_sent_since(
+        pool: &PgPool,
+        user_id: Uuid,
+        since: DateTime<Utc>,
+    ) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*)
+            FROM friendships
+            WHERE requester_id = $1 AND created_at >= $2
+            "#,
+        )
+        .bind(user_id)
+        .bind(since)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn list_friends(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<SocialEntry>> {
+        let friends = sqlx::query_as::<_, SocialEntry>(
+            r#"
+            SELECT u.id AS user_id, u.display_name, COALESCE(f.accepted_at, f.created_at) AS since
+            FROM friendships f
+            JOIN users u
+              ON u.id = CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END
+            WHERE (f.requester_id = $1 OR f.addressee_id = $1) AND f.status = 'accepted'
+            ORDER BY u.display_name ASC
+            "#,
+        )
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(friends)
+    }
+
+    /// Pending requests sent to the player
+    pub async fn list_incoming(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<SocialEntry>> {
+        let requests = sqlx::query_as::<_, SocialEntry>(
+            r#"
+            SELECT u.id AS user_id, u.display_name, f.created_at AS since
+            FROM friendships f
+            JOIN users u ON u.id = f.requester_id
+            WHERE f.addressee_id = $1 AND f.status = 'pending'
+            ORDER BY f.created_at DESC
+            "#,
+        )
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(requests)
+    }
+
+    /// Pending requests the player sent
+    pub async fn list_outgoing(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<SocialEntry>> {
+        let requests = sqlx::query_as::<_, SocialEntry>(
+            r#"
+            SELECT u.id AS user_id, u.display_name, f.created_at AS since
+            FROM friendships f
+            JOIN users u ON u.id = f.addressee_id
+            WHERE f.requester_id = $1 AND f.status = 'pending'
+            ORDER BY f.created_at DESC
+            "#,
+        )
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(requests)
+    }
+
+    // ==================== Blocks ====================
+
+    pub async fn block(
+        pool: &PgPool,
+        user_id: Uuid,
+        blocked_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO user_blocks (user_id, blocked_id, created_at)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (user_id, blocked_id) DO NOTHING
+            "#,
+        )
+        .bind(user_id)
+        .bind(blocked_id)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn unblock(pool: &PgPool, user_id: Uuid, blocked_id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            DELETE FROM user_blocks
+            WHERE user_id = $1 AND blocked_id = $2
+            "#,
+        )
+        .bind(user_id)
+        .bind(blocked_id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Whether `user_id` has blocked `other_id`
+    pub async fn is_blocked(pool: &PgPool, user_id: Uuid, other_id: Uuid) -> AppResult<bool> {
+        let exists: (bool,) = sqlx::query_as(
+            r#"
+            SELECT EXISTS(
+                SELECT 1 FROM user_blocks WHERE user_id = $1 AND blocked_id = $2
+            )
+            "#,
+        )
+        .bind(user_id)
+        .bind(other_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(exists.0)
+    }
+
+    pub async fn count_blocks(pool: &PgPool, user_id: Uuid) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*) FROM user_blocks WHERE user_id = $1
+            "#,
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    pub async fn list_blocked(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<SocialEntry>> {
+        let blocked = sqlx::query_as::<_, SocialEntry>(
+            r#"
+            SELECT u.id AS user_id, u.display_name, b.created_at AS since
+            FROM user_blocks b
+            JOIN users u ON u.id = b.blocked_id
+            WHERE b.user_id = $1
+            ORDER BY b.created_at DESC
+            "#,
+        )
+        .bind(user_id)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(blocked)
+    }
+}
@@ -0,0 +1,106 @@
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::template::MessageTemplate;
+
+const TEMPLATE_COLUMNS: &str = "id, name, locale, version, subject, body, created_by, created_at";
+
+pub struct TemplateRepository;
+
+impl TemplateRepository {
+    /// The newest version of a template in one locale
+    pub async fn find_current(
+        pool: &PgPool,
+        name: &str,
+        locale: &str,
+    ) -> AppResult<Option<MessageTemplate>> {
+        let template = sqlx::query_as::<_, MessageTemplate>(&format!(
+            "SELECT {TEMPLATE_COLUMNS} FROM message_templates \
+             WHERE name = $1 AND locale = $2 ORDER BY version DESC LIMIT 1"
+        ))
+        .bind(name)
+        .bind(locale)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(template)
+    }
+
+    pub async fn find_version(
+        pool: &PgPool,
+        name: &str,
+        locale: &str,
+        version: i32,
+    ) -> AppResult<Option<MessageTemplate>> {
+        let template = sqlx::query_as::<_, MessageTemplate>(&format!(
+            "SELECT {TEMPLATE_COLUMNS} FROM message_templates \
+             WHERE name = $1 AND locale = $2 AND version = $3"
+        ))
+        .bind(name)
+        .bind(locale)
+        .bind(version)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(template)
+    }
+
+    /// Every version of a template, newest first
+    pub async fn list_versions(pool: &PgPool, name: &str) -> AppResult<Vec<MessageTemplate>> {
+        let templates = sqlx::query_as::<_, MessageTemplate>(&format!(
+            "SELECT {TEMPLATE_COLUMNS} FROM message_templates \
+             WHERE name = $1 ORDER BY locale, version DESC"
+        ))
+        .bind(name)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(templates)
+    }
+
+    /// Version in use of every edited template, as (name, locale, version)
+    pub async fn current_versions(pool: &PgPool) -> AppResult<Vec<(String, String, i32)>> {
+        let versions = sqlx::query_as::<_, (String, String, i32)>(
+            r#"
+            SELECT name, locale, MAX(version)
+            FROM message_templates
+            GROUP BY name, locale
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(versions)
+    }
+
+    /// Add a version after the newest one. Two admins publishing at once
+    /// collide on the unique version and one of them gets an error.
+    pub async fn create_version(
+        pool: &PgPool,
+        name: &str,
+        locale: &str,
+        subject: &str,
+        body: &str,
+        created_by: Uuid,
+    ) -> AppResult<MessageTemplate> {
+        let template = sqlx::query_as::<_, MessageTemplate>(&format!(
+            r#"
+            INSERT INTO message_templates (name, locale, version, subject, body, created_by)
+            SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5
+            FROM message_templates
+            WHERE name = $1 AND locale = $2
+            RETURNING {TEMPLATE_COLUMNS}
+            "#
+        ))
+        .bind(name)
+        .bind(locale)
+        .bind(subject)
+        .bind(body)
+        .bind(created_by)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(template)
+    }
+}
@@ -0,0 +1,202 @@
+use chrono::{DateTime, Utc};
+use sqlx::{PgConnection, PgPool};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::tick::TickShard;
+
+pub struct TickRepository;
+
+impl TickRepository {
+    // ==================== Shards ====================
+
+    /// Create the job's shard rows, or re-split them when the shard count
+    /// changed. Re-split shards restart from the oldest old watermark, so a
+    /// few ticks may be applied twice; tick effects are capped, never additive
+    /// beyond their limits.
+    pub async fn ensure_shards(pool: &PgPool, job: &str, shard_count: i32) -> AppResult<()> {
+        let mut tx = pool.begin().await?;
+
+        // Serialize concurrent workers starting up
+        sqlx::query("SELECT pg_advisory_xact_lock(hashtext('tick_shards:' || $1))")
+            .bind(job)
+            .execute(&mut *tx)
+            .await?;
+
+        let existing: (Option<i32>, Option<DateTime<Utc>>) = sqlx::query_as(
+            "SELECT MAX(shard_count), MIN(watermark) FROM tick_shards WHERE job = $1",
+        )
+        .bind(job)
+        .fetch_one(&mut *tx)
+        .await?;
+
+        if existing.0 == Some(shard_count) {
+            return Ok(());
+        }
+
+        let watermark = existing.1.unwrap_or_else(Utc::now);
+
+        sqlx::query("DELETE FROM tick_shards WHERE job = $1")
+            .bind(job)
+            .execute(&mut *tx)
+            .await?;
+
+        sqlx::query(
+            r#"
+            INSERT INTO tick_shards (job, shard, shard_count, watermark)
+            SELECT $1, s, $2, $3 FROM generate_series(0, $2 - 1) s
+            "#,
+        )
+        .bind(job)
+        .bind(shard_count)
+        .bind(watermark)
+        .execute(&mut *tx)
+        .await?;
+
+        tx.commit().await?;
+
+        Ok(())
+    }
+
+    /// Lease shards whose next tick is due by `now` (game time) and that no
+    /// live worker holds
+    pub async fn claim_due(
+        pool: &PgPool,
+        job: &str,
+        interval_secs: i64,
+        worker_id: Uuid,
+        lease_secs: i64,
+        limit: i64,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<TickShard>> {
+        let shards = sqlx::query_as::<_, TickShard>(
+            r#"
+            UPDATE tick_shards SET
+                locked_by = $3,
+                locked_until = NOW() + make_interval(secs => $4),
+                updated_at = NOW()
+            WHERE (job, shard) IN (
+                SELECT job, shard FROM tick_shards
+                WHERE job = $1
+                    AND watermark + make_interval(secs => $2) <= $6
+                    AND (locked_until IS NULL OR locked_until < NOW())
+                ORDER BY watermark
+                LIMIT $5
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING job, shard, shard_count, watermark, locked_by, locked_until,
+                      last_run_at, ticks_applied, ticks_skipped, updated_at
+            "#,
+        )
+        .bind(job)
+        .bind(interval_secs as f64)
+        .bind(worker_id)
+        .bind(lease_secs as f64)
+        .bind(limit)
+        .bind(now)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(shards)
+    }
+
+    /// Move the watermark forward and drop the lease. Run in the same
+    /// transaction as the tick's effects so neither happens without the other.
+    pub async fn advance(
+        conn: &mut PgConnection,
+        job: &str,
+        shard: i32,
+        worker_id: Uuid,
+        watermark: DateTime<Utc>,
+        ticks_applied: i64,
+        ticks_skipped: i64,
+    ) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE tick_shards SET
+                watermark = $4,
+                ticks_applied = ticks_applied + $5,
+                ticks_skipped = ticks_skipped + $6,
+                locked_by = NULL,
+                locked_until = NULL,
+                last_run_at = NOW(),
+                updated_at = NOW()
+            WHERE job = $1 AND shard = $2 AND locked_by = $3
+            "#,
+        )
+        .bind(job)
+        .bind(shard)
+        .bind(worker_id)
+        .bind(watermark)
+        .bind(ticks_applied)
+        .bind(ticks_skipped)
+        .execute(conn)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    pub async fn release(pool: &PgPool, job: &str, shard: i32, worker_id: Uuid) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE tick_shards SET locked_by = NULL, locked_until = NULL, updated_at = NOW()
+            WHERE job = $1 AND shard = $2 AND locked_by = $3
+            "#,
+        )
+        .bind(job)
+        .bind(shard)
+        .bind(worker_id)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    pub async fn list(pool: &PgPool) -> AppResult<Vec<TickShard>> {
+        let shards = sqlx::query_as::<_, TickShard>(
+            r#"
+            SELECT job, shard, shard_count, watermark, locked_by, locked_until,
+                   last_run_at, ticks_applied, ticks_skipped, updated_at
+            FROM tick_shards
+            ORDER BY job, shard
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(shards)
+    }
+
+    // ==================== Tick Effects ====================
+
+    /// Regenerate loyalty in the shard's villages: 1 point per tick plus the
+    /// level of the residence or palace, up to 100
+    pub async fn regenerate_loyalty(
+        conn: &mut PgConnection,
+        lower: Uuid,
+        upper: Option<Uuid>,
+        ticks: i64,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE villages v SET
+                loyalty = LEAST(100, v.loyalty + $3 * (1 + COALESCE((
+                    SELECT MAX(b.level) FROM buildings b
+                    WHERE b.village_id = v.id
+                        AND b.building_type IN ('residence', 'palace')
+                ), 0)))::INT,
+                updated_at = NOW()
+            WHERE v.loyalty < 100
+                AND v.id >= $1
+                AND ($2::uuid IS NULL OR v.id < $2)
+            "#,
+        )
+        .bind(lower)
+        .bind(upper)
+        .bind(ticks)
+        .execute(conn)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+}
@@ -1,8 +1,10 @@
+use async_trait::async_trait;
 use chrono::{DateTime, Utc};
 use sqlx::PgPool;
 use uuid::Uuid;
 
 use crate::error::AppResult;
+use crate::models::gamedata::UnitDefinition;
 use crate::models::troop::{Troop, TroopDefinition, TroopQueue, TroopType};
 
 pub struct TroopRepository;
@@ -47,6 +49,67 @@ impl TroopRepository {
         Ok(definition)
     }
 
+    /// Make troop_definitions match the loaded unit definitions
+    pub async fn upsert_definitions(pool: &PgPool, units: &[UnitDefinition]) -> AppResult<()> {
+        let mut tx = pool.begin().await?;
+
+        for unit in units {
+            sqlx::query(
+                r#"
+                INSERT INTO troop_definitions (
+                    troop_type, tribe, name, description,
+                    attack, defense_infantry, defense_cavalry, speed, carry_capacity, crop_consumption,
+                    training_time_seconds, wood_cost, clay_cost, iron_cost, crop_cost,
+                    required_building, required_building_level, loyalty_reduction
+                )
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+                ON CONFLICT (troop_type) DO UPDATE SET
+                    tribe = EXCLUDED.tribe,
+                    name = EXCLUDED.name,
+                    description = EXCLUDED.description,
+                    attack = EXCLUDED.attack,
+                    defense_infantry = EXCLUDED.defense_infantry,
+                    defense_cavalry = EXCLUDED.defense_cavalry,
+                    speed = EXCLUDED.speed,
+                    carry_capacity = EXCLUDED.carry_capacity,
+                    crop_consumption = EXCLUDED.crop_consumption,
+                    training_time_seconds = EXCLUDED.training_time_seconds,
+                    wood_cost = EXCLUDED.wood_cost,
+                    clay_cost = EXCLUDED.clay_cost,
+                    iron_cost = EXCLUDED.iron_cost,
+                    crop_cost = EXCLUDED.crop_cost,
+                    required_building = EXCLUDED.required_building,
+                    required_building_level = EXCLUDED.required_building_level,
+                    loyalty_reduction = EXCLUDED.loyalty_reduction
+                "#,
+            )
+            .bind(&unit.troop_type)
+            .bind(unit.tribe)
+            .bind(&unit.name)
+            .bind(&unit.description)
+            .bind(unit.attack)
+            .bind(unit.defense_infantry)
+            .bind(unit.defense_cavalry)
+            .bind(unit.speed)
+            .bind(unit.carry_capacity)
+            .bind(unit.crop_consumption)
+            .bind(unit.training_time_seconds)
+            .bind(unit.cost.wood)
+            .bind(unit.cost.clay)
+            .bind(unit.cost.iron)
+            .bind(unit.cost.crop)
+            .bind(&unit.requires.building_type)
+            .bind(unit.requires.min_level)
+            .bind(unit.loyalty_reduction)
+            .execute(&mut *tx)
+            .await?;
+        }
+
+        tx.commit().await?;
+
+        Ok(())
+    }
+
     // ==================== Troops ====================
 
     pub async fn find_by_village(pool: &PgPool, village_id: Uuid) -> AppResult<Vec<Troop>> {
@@ -65,6 +128,21 @@ impl TroopRepository {
         Ok(troops)
     }
 
+    pub async fn find_by_ids(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<Troop>> {
+        let troops = sqlx::query_as::<_, Troop>(
+            r#"
+            SELECT id, village_id, troop_type, count, in_village, created_at, updated_at
+            FROM troops
+            WHERE id = ANY($1)
+            "#,
+        )
+        .bind(ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(troops)
+    }
+
     pub async fn find_by_village_and_type(
         pool: &PgPool,
         village_id: Uuid,
@@ -163,6 +241,31 @@ impl TroopRepository {
         Ok(troop)
     }
 
+    /// Take troops that are away from a village off its roster, because they
+    /// died out there or joined another village. Troops at home are untouched.
+    pub async fn remove_away_troops(
+        pool: &PgPool,
+        village_id: Uuid,
+        troop_type: TroopType,
+        count: i32,
+    ) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE troops
+            SET count = GREATEST(in_village, count - $3),
+                updated_at = NOW()
+            WHERE village_id = $1 AND troop_type = $2
+            "#,
+        )
+        .bind(village_id)
+        .bind(&troop_type)
+        .bind(count)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
     pub async fn kill_troops(
         pool: &PgPool,
         village_id: Uuid,
@@ -194,7 +297,7 @@ impl TroopRepository {
         let queue = sqlx::query_as::<_, TroopQueue>(
             r#"
             SELECT id, village_id, troop_type, count, each_duration_seconds,
-                   started_at, ends_at, created_at
+                   started_at, ends_at, created_at, version
             FROM troop_queue
             WHERE village_id = $1
             ORDER BY ends_at ASC
@@ -220,7 +323,7 @@ impl TroopRepository {
             r#"
             INSERT INTO troop_queue (village_id, troop_type, count, each_duration_seconds, started_at, ends_at)
             VALUES ($1, $2, $3, $4, $5, $6)
-            RETURNING id, village_id, troop_type, count, each_duration_seconds, started_at, ends_at, created_at
+            RETURNING id, village_id, troop_type, count, each_duration_seconds, started_at, ends_at, created_at, version
             "#,
         )
         .bind(village_id)
@@ -244,12 +347,28 @@ impl TroopRepository {
         Ok(())
     }
 
+    /// Remove a queue entry only if it hasn't changed since it was read.
+    /// Returns false if another request already changed or removed it.
+    pub async fn remove_from_queue_versioned(
+        pool: &PgPool,
+        id: Uuid,
+        expected_version: i32,
+    ) -> AppResult<bool> {
+        let result = sqlx::query("DELETE FROM troop_queue WHERE id = $1 AND version = $2")
+            .bind(id)
+            .bind(expected_version)
+            .execute(pool)
+            .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
     /// Find queue entry by ID
     pub async fn find_queue_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<TroopQueue>> {
         let queue = sqlx::query_as::<_, TroopQueue>(
             r#"
             SELECT id, village_id, troop_type, count, each_duration_seconds,
-                   started_at, ends_at, created_at
+                   started_at, ends_at, created_at, version
             FROM troop_queue
             WHERE id = $1
             "#,
@@ -261,31 +380,68 @@ impl TroopRepository {
         Ok(queue)
     }
 
-    /// Complete training instantly (for Finish Now feature)
-    pub async fn complete_training(pool: &PgPool, queue_id: Uuid) -> AppResult<()> {
-        // Get queue entry
-        let queue = Self::find_queue_by_id(pool, queue_id)
-            .await?
-            .ok_or_else(|| crate::error::AppError::NotFound("Queue entry not found".into()))?;
+    pub async fn find_queue_by_ids(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<TroopQueue>> {
+        let queue = sqlx::query_as::<_, TroopQueue>(
+            r#"
+            SELECT id, village_id, troop_type, count, each_duration_seconds,
+                   started_at, ends_at, created_at, version
+            FROM troop_queue
+            WHERE id = ANY($1)
+            "#,
+        )
+        .bind(ids)
+        .fetch_all(pool)
+        .await?;
 
-        // Add troops to village
-        Self::add_troops(pool, queue.village_id, queue.troop_type.clone(), queue.count).await?;
+        Ok(queue)
+    }
 
-        // Remove from queue
-        Self::remove_from_queue(pool, queue_id).await?;
+    /// Move a finished (or Finish Now) queue entry into the village's
+    /// troops. Claiming the entry and adding the troops is one statement,
+    /// so they are added exactly once, whichever job or instance gets
+    /// there first; false if it was already completed or changed since it
+    /// was read.
+    pub async fn complete_training(pool: &PgPool, queue: &TroopQueue) -> AppResult<bool> {
+        let (completed,): (i64,) = sqlx::query_as(
+            r#"
+            WITH done AS (
+                DELETE FROM troop_queue
+                WHERE id = $1 AND version = $2
+                RETURNING village_id, troop_type, count
+            ),
+            trained AS (
+                INSERT INTO troops (village_id, troop_type, count, in_village)
+                SELECT village_id, troop_type, count, count FROM done
+                ON CONFLICT (village_id, troop_type) DO UPDATE
+                SET count = troops.count + EXCLUDED.count,
+                    in_village = troops.in_village + EXCLUDED.in_village,
+                    updated_at = NOW()
+            )
+            SELECT COUNT(*) FROM done
+            "#,
+        )
+        .bind(queue.id)
+        .bind(queue.version)
+        .fetch_one(pool)
+        .await?;
 
-        Ok(())
+        Ok(completed > 0)
     }
 
-    pub async fn find_completed_training(pool: &PgPool) -> AppResult<Vec<TroopQueue>> {
+    pub async fn find_completed_training(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<TroopQueue>> {
         let completed = sqlx::query_as::<_, TroopQueue>(
             r#"
             SELECT id, village_id, troop_type, count, each_duration_seconds,
-                   started_at, ends_at, created_at
+                   started_at, ends_at, created_at, version
             FROM troop_queue
-            WHERE ends_at <= NOW()
+            WHERE ends_at <= $1
+            ORDER BY ends_at ASC
             "#,
         )
+        .bind(now)
         .fetch_all(pool)
         .await?;
 
@@ -323,3 +479,26 @@ impl TroopRepository {
         Ok(result.0 as i32)
     }
 }
+
+/// The training queue as `TroopService` completes it: Postgres in the
+/// server, memory in unit tests (see `testing::InMemoryTrainingQueue`)
+#[async_trait]
+pub trait TrainingQueue: Send + Sync {
+    /// Entries finished by `now`, oldest first
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<TroopQueue>>;
+
+    /// Move an entry's troops into its village; false if it was already
+    /// completed or changed since it was read
+    async fn complete(&self, entry: &TroopQueue) -> AppResult<bool>;
+}
+
+#[async_trait]
+impl TrainingQueue for PgPool {
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<TroopQueue>> {
+        TroopRepository::find_completed_training(self, now).await
+    }
+
+    async fn complete(&self, entry: &TroopQueue) -> AppResult<bool> {
+        TroopRepository::complete_training(self, entry).await
+    }
+}
@@ -1,8 +1,14 @@
+use chrono::{DateTime, Utc};
 use sqlx::PgPool;
 use uuid::Uuid;
 
 use crate::error::AppResult;
-use crate::models::user::{CreateUser, UpdateUser, User};
+use crate::models::template::DEFAULT_LOCALE;
+use crate::models::troop::TribeType;
+use crate::models::user::{
+    CreateUser, EmailPreferences, UpdateEmailPreferencesRequest, UpdateUser, User,
+    DEFAULT_ATTACK_QUIET_MINUTES,
+};
 
 pub struct UserRepository;
 
@@ -10,7 +16,7 @@ impl UserRepository {
     pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<User>> {
         let user = sqlx::query_as::<_, User>(
             r#"
-            SELECT id, firebase_uid, email, display_name, photo_url, provider,
+            SELECT id, firebase_uid, email, display_name, photo_url, provider, tribe,
                    created_at, updated_at, last_login_at, deleted_at
             FROM users
             WHERE id = $1 AND deleted_at IS NULL
@@ -26,7 +32,7 @@ impl UserRepository {
     pub async fn find_by_firebase_uid(pool: &PgPool, firebase_uid: &str) -> AppResult<Option<User>> {
         let user = sqlx::query_as::<_, User>(
             r#"
-            SELECT id, firebase_uid, email, display_name, photo_url, provider,
+            SELECT id, firebase_uid, email, display_name, photo_url, provider, tribe,
                    created_at, updated_at, last_login_at, deleted_at
             FROM users
             WHERE firebase_uid = $1 AND deleted_at IS NULL
@@ -39,12 +45,29 @@ impl UserRepository {
         Ok(user)
     }
 
+    /// Case-insensitive, since providers don't agree on email case
+    pub async fn find_by_email(pool: &PgPool, email: &str) -> AppResult<Option<User>> {
+        let user = sqlx::query_as::<_, User>(
+            r#"
+            SELECT id, firebase_uid, email, display_name, photo_url, provider, tribe,
+                   created_at, updated_at, last_login_at, deleted_at
+            FROM users
+            WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL
+            "#,
+        )
+        .bind(email)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(user)
+    }
+
     pub async fn create(pool: &PgPool, input: CreateUser) -> AppResult<User> {
         let user = sqlx::query_as::<_, User>(
             r#"
-            INSERT INTO users (firebase_uid, email, display_name, photo_url, provider)
-            VALUES ($1, $2, $3, $4, $5)
-            RETURNING id, firebase_uid, email, display_name, photo_url, provider,
+            INSERT INTO users (firebase_uid, email, display_name, photo_url, provider, tribe)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            RETURNING id, firebase_uid, email, display_name, photo_url, provider, tribe,
                       created_at, updated_at, last_login_at, deleted_at
             "#,
         )
@@ -53,6 +76,7 @@ impl UserRepository {
         .bind(&input.display_name)
         .bind(&input.photo_url)
         .bind(&input.provider)
+        .bind(&input.tribe)
         .fetch_one(pool)
         .await?;
 
@@ -68,7 +92,7 @@ impl UserRepository {
                 photo_url = COALESCE($4, photo_url),
                 updated_at = NOW()
             WHERE firebase_uid = $1 AND deleted_at IS NULL
-            RETURNING id, firebase_uid, email, display_name, photo_url, provider,
+            RETURNING id, firebase_uid, email, display_name, photo_url, provider, tribe,
                       created_at, updated_at, last_login_at, deleted_at
             "#,
         )
@@ -86,7 +110,7 @@ impl UserRepository {
         sqlx::query(
             r#"
             UPDATE users
-            SET last_login_at = NOW()
+            SET last_login_at = NOW(), inactive_since = NULL, decayed_at = NULL
             WHERE firebase_uid = $1 AND deleted_at IS NULL
             "#,
         )
@@ -100,16 +124,18 @@ impl UserRepository {
     pub async fn upsert(pool: &PgPool, input: CreateUser) -> AppResult<User> {
         let user = sqlx::query_as::<_, User>(
             r#"
-            INSERT INTO users (firebase_uid, email, display_name, photo_url, provider)
-            VALUES ($1, $2, $3, $4, $5)
+            INSERT INTO users (firebase_uid, email, display_name, photo_url, provider, tribe)
+            VALUES ($1, $2, $3, $4, $5, $6)
             ON CONFLICT (firebase_uid) DO UPDATE SET
                 email = COALESCE(EXCLUDED.email, users.email),
                 display_name = COALESCE(EXCLUDED.display_name, users.display_name),
                 photo_url = COALESCE(EXCLUDED.photo_url, users.photo_url),
                 last_login_at = NOW(),
+                inactive_since = NULL,
+                decayed_at = NULL,
                 updated_at = NOW(),
                 deleted_at = NULL
-            RETURNING id, firebase_uid, email, display_name, photo_url, provider,
+            RETURNING id, firebase_uid, email, display_name, photo_url, provider, tribe,
                       created_at, updated_at, last_login_at, deleted_at
             "#,
         )
@@ -118,12 +144,38 @@ impl UserRepository {
         .bind(&input.display_name)
         .bind(&input.photo_url)
         .bind(&input.provider)
+        .bind(&input.tribe)
         .fetch_one(pool)
         .await?;
 
         Ok(user)
     }
 
+    /// Change tribe; only allowed before the player founds a village, so
+    /// the check is part of the update. None if they already have one.
+    pub async fn set_tribe_before_settling(
+        pool: &PgPool,
+        id: Uuid,
+        tribe: TribeType,
+    ) -> AppResult<Option<User>> {
+        let user = sqlx::query_as::<_, User>(
+            r#"
+            UPDATE users
+            SET tribe = $2, updated_at = NOW()
+            WHERE id = $1 AND deleted_at IS NULL
+              AND NOT EXISTS (SELECT 1 FROM villages WHERE user_id = $1)
+            RETURNING id, firebase_uid, email, display_name, photo_url, provider, tribe,
+                      created_at, updated_at, last_login_at, deleted_at
+            "#,
+        )
+        .bind(id)
+        .bind(&tribe)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(user)
+    }
+
     pub async fn soft_delete(pool: &PgPool, firebase_uid: &str) -> AppResult<()> {
         sqlx::query(
             r#"
@@ -138,4 +190,163 @@ impl UserRepository {
 
         Ok(())
     }
+
+    /// Role column from users ('user' or 'admin')
+    pub async fn get_role(pool: &PgPool, id: Uuid) -> AppResult<Option<String>> {
+        let role: Option<(String,)> = sqlx::query_as(
+            r#"
+            SELECT role FROM users
+            WHERE id = $1 AND deleted_at IS NULL
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(role.map(|r| r.0))
+    }
+
+    // ==================== Inactivity ====================
+
+    /// Flag players who last logged in before `before`. Returns how many.
+    pub async fn flag_inactive(
+        pool: &PgPool,
+        before: DateTime<Utc>,
+        now: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE users
+            SET inactive_since = $2
+            WHERE last_login_at < $1
+              AND inactive_since IS NULL
+              AND deleted_at IS NULL
+              AND provider <> 'system'
+            "#,
+        )
+        .bind(before)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Inactive players not decayed since `before`
+    pub async fn find_due_decay(
+        pool: &PgPool,
+        before: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<Uuid>> {
+        let ids: Vec<(Uuid,)> = sqlx::query_as(
+            r#"
+            SELECT id FROM users
+            WHERE inactive_since < $1
+              AND (decayed_at IS NULL OR decayed_at < $1)
+              AND deleted_at IS NULL
+            ORDER BY decayed_at ASC NULLS FIRST
+            LIMIT $2
+            "#,
+        )
+        .bind(before)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(ids.into_iter().map(|(id,)| id).collect())
+    }
+
+    pub async fn set_decayed(pool: &PgPool, id: Uuid, now: DateTime<Utc>) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            UPDATE users SET decayed_at = $2 WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Inactive players who last logged in before `before` and still own villages
+    pub async fn find_abandoned(
+        pool: &PgPool,
+        before: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<Uuid>> {
+        let ids: Vec<(Uuid,)> = sqlx::query_as(
+            r#"
+            SELECT u.id FROM users u
+            WHERE u.inactive_since IS NOT NULL
+              AND u.last_login_at < $1
+              AND u.provider <> 'system'
+              AND EXISTS (SELECT 1 FROM villages v WHERE v.user_id = u.id)
+            ORDER BY u.last_login_at ASC
+            LIMIT $2
+            "#,
+        )
+        .bind(before)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(ids.into_iter().map(|(id,)| id).collect())
+    }
+
+    // ==================== Email Preferences ====================
+
+    /// The player's email preferences; all off if never set
+    pub async fn get_email_preferences(
+        pool: &PgPool,
+        user_id: Uuid,
+    ) -> AppResult<EmailPreferences> {
+        let preferences = sqlx::query_as::<_, EmailPreferences>(
+            r#"
+            SELECT weekly_digest, attack_warning, attack_quiet_minutes, locale
+            FROM email_preferences
+            WHERE user_id = $1
+            "#,
+        )
+        .bind(user_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(preferences.unwrap_or_default())
+    }
+
+    /// Change the given preferences, leaving the others as they were
+    pub async fn update_email_preferences(
+        pool: &PgPool,
+        user_id: Uuid,
+        update: &UpdateEmailPreferencesRequest,
+    ) -> AppResult<EmailPreferences> {
+        let preferences = sqlx::query_as::<_, EmailPreferences>(
+            r#"
+            INSERT INTO email_preferences (user_id, weekly_digest, attack_warning,
+                                           attack_quiet_minutes, locale)
+            VALUES ($1, COALESCE($2, FALSE), COALESCE($3, FALSE), COALESCE($4, $5),
+                    COALESCE($6, $7))
+            ON CONFLICT (user_id) DO UPDATE SET
+                weekly_digest = COALESCE($2, email_preferences.weekly_digest),
+                attack_warning = COALESCE($3, email_preferences.attack_warning),
+                attack_quiet_minutes = COALESCE($4, email_preferences.attack_quiet_minutes),
+                locale = COALESCE($6, email_preferences.locale),
+                updated_at = NOW()
+            RETURNING weekly_digest, attack_warning, attack_quiet_minutes, locale
+            "#,
+        )
+        .bind(user_id)
+        .bind(update.weekly_digest)
+        .bind(update.attack_warning)
+        .bind(update.attack_quiet_minutes)
+        .bind(DEFAULT_ATTACK_QUIET_MINUTES)
+        .bind(update.locale.as_deref())
+        .bind(DEFAULT_LOCALE)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(preferences)
+    }
 }
@@ -1,8 +1,9 @@
-use sqlx::PgPool;
+use chrono::{DateTime, Utc};
+use sqlx::{PgExecutor, PgPool};
 use uuid::Uuid;
 
-use crate::error::AppResult;
-use crate::models::village::{CreateVillage, UpdateVillage, Village, VillageMapInfo};
+use crate::error::{AppError, AppResult};
+use crate::models::village::{CreateVillage, Quadrant, UpdateVillage, Village, VillageMapInfo};
 
 pub struct VillageRepository;
 
@@ -13,8 +14,8 @@ impl VillageRepository {
             SELECT id, user_id, name, x, y, is_capital,
                    wood, clay, iron, crop,
                    warehouse_capacity, granary_capacity,
-                   population, culture_points, loyalty,
-                   resources_updated_at, created_at, updated_at
+                   population, culture_points, culture_per_day, loyalty, field_type,
+                   resources_updated_at, created_at, updated_at, version
             FROM villages
             WHERE id = $1
             "#,
@@ -26,14 +27,33 @@ impl VillageRepository {
         Ok(village)
     }
 
+    pub async fn find_by_ids(pool: &PgPool, ids: &[Uuid]) -> AppResult<Vec<Village>> {
+        let villages = sqlx::query_as::<_, Village>(
+            r#"
+            SELECT id, user_id, name, x, y, is_capital,
+                   wood, clay, iron, crop,
+                   warehouse_capacity, granary_capacity,
+                   population, culture_points, culture_per_day, loyalty, field_type,
+                   resources_updated_at, created_at, updated_at, version
+            FROM villages
+            WHERE id = ANY($1)
+            "#,
+        )
+        .bind(ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(villages)
+    }
+
     pub async fn find_by_user_id(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<Village>> {
         let villages = sqlx::query_as::<_, Village>(
             r#"
             SELECT id, user_id, name, x, y, is_capital,
                    wood, clay, iron, crop,
                    warehouse_capacity, granary_capacity,
-                   population, culture_points, loyalty,
-                   resources_updated_at, created_at, updated_at
+                   population, culture_points, culture_per_day, loyalty, field_type,
+                   resources_updated_at, created_at, updated_at, version
             FROM villages
             WHERE user_id = $1
             ORDER BY is_capital DESC, created_at ASC
@@ -52,8 +72,8 @@ impl VillageRepository {
             SELECT id, user_id, name, x, y, is_capital,
                    wood, clay, iron, crop,
                    warehouse_capacity, granary_capacity,
-                   population, culture_points, loyalty,
-                   resources_updated_at, created_at, updated_at
+                   population, culture_points, culture_per_day, loyalty, field_type,
+                   resources_updated_at, created_at, updated_at, version
             FROM villages
             WHERE x = $1 AND y = $2
             "#,
@@ -74,7 +94,7 @@ impl VillageRepository {
     ) -> AppResult<Vec<VillageMapInfo>> {
         let villages = sqlx::query_as::<_, VillageMapInfo>(
             r#"
-            SELECT v.id, v.user_id, v.name, v.x, v.y, v.population,
+            SELECT v.id, v.user_id, v.name, v.x, v.y, v.population, v.field_type,
                    u.display_name as player_name
             FROM villages v
             LEFT JOIN users u ON v.user_id = u.id
@@ -92,16 +112,19 @@ impl VillageRepository {
         Ok(villages)
     }
 
-    pub async fn create(pool: &PgPool, input: CreateVillage) -> AppResult<Village> {
+    pub async fn create<'e>(
+        executor: impl PgExecutor<'e>,
+        input: CreateVillage,
+    ) -> AppResult<Village> {
         let village = sqlx::query_as::<_, Village>(
             r#"
-            INSERT INTO villages (user_id, name, x, y, is_capital)
-            VALUES ($1, $2, $3, $4, $5)
+            INSERT INTO villages (user_id, name, x, y, is_capital, field_type)
+            VALUES ($1, $2, $3, $4, $5, $6)
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(&input.user_id)
@@ -109,30 +132,39 @@ impl VillageRepository {
         .bind(input.x)
         .bind(input.y)
         .bind(input.is_capital)
-        .fetch_one(pool)
+        .bind(input.field_type)
+        .fetch_one(executor)
         .await?;
 
         Ok(village)
     }
 
-    pub async fn update(pool: &PgPool, id: Uuid, input: UpdateVillage) -> AppResult<Village> {
+    /// Update village details (compare-and-swap on version)
+    pub async fn update(
+        pool: &PgPool,
+        id: Uuid,
+        expected_version: i32,
+        input: UpdateVillage,
+    ) -> AppResult<Village> {
         let village = sqlx::query_as::<_, Village>(
             r#"
             UPDATE villages
-            SET name = COALESCE($2, name),
+            SET name = COALESCE($3, name),
                 updated_at = NOW()
-            WHERE id = $1
+            WHERE id = $1 AND version = $2
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
+        .bind(expected_version)
         .bind(&input.name)
-        .fetch_one(pool)
-        .await?;
+        .fetch_optional(pool)
+        .await?
+        .ok_or_else(|| AppError::VersionConflict("Village was modified, please retry".into()))?;
 
         Ok(village)
     }
@@ -144,19 +176,20 @@ impl VillageRepository {
         clay: i32,
         iron: i32,
         crop: i32,
+        updated_at: DateTime<Utc>,
     ) -> AppResult<Village> {
         let village = sqlx::query_as::<_, Village>(
             r#"
             UPDATE villages
             SET wood = $2, clay = $3, iron = $4, crop = $5,
-                resources_updated_at = NOW(),
+                resources_updated_at = $6,
                 updated_at = NOW()
             WHERE id = $1
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
@@ -164,6 +197,7 @@ impl VillageRepository {
         .bind(clay)
         .bind(iron)
         .bind(crop)
+        .bind(updated_at)
         .fetch_one(pool)
         .await?;
 
@@ -194,8 +228,8 @@ impl VillageRepository {
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
@@ -209,6 +243,52 @@ impl VillageRepository {
         Ok(village)
     }
 
+    /// Deduct resources only if the village hasn't changed since it was read.
+    /// Used by player commands that checked affordability on that read.
+    pub async fn deduct_resources_versioned<'e>(
+        executor: impl PgExecutor<'e>,
+        id: Uuid,
+        expected_version: i32,
+        wood: i32,
+        clay: i32,
+        iron: i32,
+        crop: i32,
+    ) -> AppResult<Village> {
+        let village = sqlx::query_as::<_, Village>(
+            r#"
+            UPDATE villages
+            SET wood = wood - $3,
+                clay = clay - $4,
+                iron = iron - $5,
+                crop = crop - $6,
+                updated_at = NOW()
+            WHERE id = $1
+              AND version = $2
+              AND wood >= $3
+              AND clay >= $4
+              AND iron >= $5
+              AND crop >= $6
+            RETURNING id, user_id, name, x, y, is_capital,
+                      wood, clay, iron, crop,
+                      warehouse_capacity, granary_capacity,
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
+            "#,
+        )
+        .bind(id)
+        .bind(expected_version)
+        .bind(wood)
+        .bind(clay)
+        .bind(iron)
+        .bind(crop)
+        .fetch_optional(executor)
+        .await?
+        .ok_or_else(|| AppError::VersionConflict("Village was modified, please retry".into()))?;
+
+        Ok(village)
+    }
+
+    /// Set new capacities; stock above a smaller store is lost
     pub async fn update_storage_capacity(
         pool: &PgPool,
         id: Uuid,
@@ -220,13 +300,17 @@ impl VillageRepository {
             UPDATE villages
             SET warehouse_capacity = $2,
                 granary_capacity = $3,
+                wood = LEAST(wood, $2),
+                clay = LEAST(clay, $2),
+                iron = LEAST(iron, $2),
+                crop = LEAST(crop, $3),
                 updated_at = NOW()
             WHERE id = $1
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
@@ -238,28 +322,147 @@ impl VillageRepository {
         Ok(village)
     }
 
-    pub async fn update_population(pool: &PgPool, id: Uuid, population: i32) -> AppResult<Village> {
+    /// Store population and culture production. Culture earned at the old
+    /// rate is paid out first so the new rate only counts from `now`.
+    pub async fn update_stats<'e>(
+        executor: impl PgExecutor<'e>,
+        id: Uuid,
+        population: i32,
+        culture_per_day: i32,
+        now: DateTime<Utc>,
+    ) -> AppResult<Village> {
         let village = sqlx::query_as::<_, Village>(
             r#"
             UPDATE villages
             SET population = $2,
+                culture_points = culture_points + FLOOR(
+                    culture_per_day * EXTRACT(EPOCH FROM ($4 - culture_updated_at)) / 86400
+                )::INT,
+                culture_per_day = $3,
+                culture_updated_at = $4,
                 updated_at = NOW()
             WHERE id = $1
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
         .bind(population)
-        .fetch_one(pool)
+        .bind(culture_per_day)
+        .bind(now)
+        .fetch_one(executor)
         .await?;
 
         Ok(village)
     }
 
+    /// Lower the loyalty of every village a player owns. Returns how many.
+    pub async fn decay_loyalty(pool: &PgPool, user_id: Uuid, amount: i32) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE villages
+            SET loyalty = GREATEST(loyalty - $2, 0),
+                updated_at = NOW()
+            WHERE user_id = $1
+            "#,
+        )
+        .bind(user_id)
+        .bind(amount)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Remove a village from the map, unless armies, reports or heroes still
+    /// refer to it. Returns whether it went.
+    pub async fn delete_if_unreferenced(pool: &PgPool, id: Uuid) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            DELETE FROM villages
+            WHERE id = $1
+              AND NOT EXISTS (
+                  SELECT 1 FROM armies WHERE from_village_id = $1 OR to_village_id = $1
+              )
+              AND NOT EXISTS (
+                  SELECT 1 FROM battle_reports
+                  WHERE attacker_village_id = $1 OR defender_village_id = $1
+              )
+              AND NOT EXISTS (
+                  SELECT 1 FROM scout_reports
+                  WHERE attacker_village_id = $1 OR defender_village_id = $1
+              )
+              AND NOT EXISTS (
+                  SELECT 1 FROM heroes WHERE home_village_id = $1 OR current_village_id = $1
+              )
+            "#,
+        )
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Pay out whole culture points earned since the last payout. The
+    /// payout time only moves forward by what was paid, so fractions carry
+    /// over. Returns how many villages gained points.
+    pub async fn accrue_culture(pool: &PgPool, now: DateTime<Utc>) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE villages v
+            SET culture_points = v.culture_points + g.gained,
+                culture_updated_at = v.culture_updated_at
+                    + make_interval(secs => g.gained * 86400.0 / v.culture_per_day)
+            FROM (
+                SELECT id,
+                       FLOOR(
+                           culture_per_day * EXTRACT(EPOCH FROM ($1 - culture_updated_at)) / 86400
+                       )::INT AS gained
+                FROM villages
+                WHERE culture_per_day > 0
+            ) g
+            WHERE v.id = g.id AND g.gained > 0
+            "#,
+        )
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Stored (id, population, culture_per_day) of every village, for
+    /// checking them against the buildings
+    pub async fn list_stats(pool: &PgPool) -> AppResult<Vec<(Uuid, i32, i32)>> {
+        let rows = sqlx::query_as::<_, (Uuid, i32, i32)>(
+            r#"
+            SELECT id, population, culture_per_day FROM villages ORDER BY id
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(rows)
+    }
+
+    /// Culture points across all of a player's villages
+    pub async fn total_culture_points(pool: &PgPool, user_id: Uuid) -> AppResult<i64> {
+        let total: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COALESCE(SUM(culture_points), 0)::BIGINT FROM villages WHERE user_id = $1
+            "#,
+        )
+        .bind(user_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(total.0)
+    }
+
     pub async fn count_by_user_id(pool: &PgPool, user_id: Uuid) -> AppResult<i64> {
         let count: (i64,) = sqlx::query_as(
             r#"
@@ -273,10 +476,62 @@ impl VillageRepository {
         Ok(count.0)
     }
 
+    /// Players who have settled, i.e. villages that are a capital
+    pub async fn count_capitals(pool: &PgPool) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(*) FROM villages WHERE is_capital = true
+            "#,
+        )
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Settled players by the quadrant their capital is in. Tiles on an
+    /// axis count toward the north and east.
+    pub async fn count_capitals_by_quadrant<'e>(
+        executor: impl PgExecutor<'e>,
+    ) -> AppResult<Vec<(Quadrant, i64)>> {
+        let counts: Vec<(Quadrant, i64)> = sqlx::query_as(
+            r#"
+            SELECT (CASE
+                        WHEN x >= 0 AND y >= 0 THEN 'north_east'
+                        WHEN y >= 0 THEN 'north_west'
+                        WHEN x >= 0 THEN 'south_east'
+                        ELSE 'south_west'
+                    END)::spawn_quadrant as quadrant,
+                   COUNT(*)
+            FROM villages
+            WHERE is_capital = true
+            GROUP BY 1
+            "#,
+        )
+        .fetch_all(executor)
+        .await?;
+
+        Ok(counts)
+    }
+
+    /// When the first village was founded, i.e. when the world started
+    pub async fn first_founded_at(pool: &PgPool) -> AppResult<Option<DateTime<Utc>>> {
+        let first: (Option<DateTime<Utc>>,) = sqlx::query_as(
+            r#"
+            SELECT MIN(created_at) FROM villages
+            "#,
+        )
+        .fetch_one(pool)
+        .await?;
+
+        Ok(first.0)
+    }
+
     pub async fn is_coordinate_available(pool: &PgPool, x: i32, y: i32) -> AppResult<bool> {
         let exists: (bool,) = sqlx::query_as(
             r#"
             SELECT EXISTS(SELECT 1 FROM villages WHERE x = $1 AND y = $2)
+                OR EXISTS(SELECT 1 FROM oases WHERE x = $1 AND y = $2)
             "#,
         )
         .bind(x)
@@ -307,8 +562,8 @@ impl VillageRepository {
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
@@ -334,8 +589,8 @@ impl VillageRepository {
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
@@ -346,6 +601,26 @@ impl VillageRepository {
         Ok(village)
     }
 
+    /// Make `id` the player's only capital
+    pub async fn set_capital(pool: &PgPool, user_id: Uuid, id: Uuid) -> AppResult<Village> {
+        sqlx::query(
+            r#"
+            UPDATE villages
+            SET is_capital = (id = $2),
+                updated_at = NOW()
+            WHERE user_id = $1 AND (is_capital OR id = $2)
+            "#,
+        )
+        .bind(user_id)
+        .bind(id)
+        .execute(pool)
+        .await?;
+
+        Self::find_by_id(pool, id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".into()))
+    }
+
     pub async fn transfer_ownership(pool: &PgPool, id: Uuid, new_owner_id: Uuid) -> AppResult<Village> {
         let village = sqlx::query_as::<_, Village>(
             r#"
@@ -357,8 +632,8 @@ impl VillageRepository {
             RETURNING id, user_id, name, x, y, is_capital,
                       wood, clay, iron, crop,
                       warehouse_capacity, granary_capacity,
-                      population, culture_points, loyalty,
-                      resources_updated_at, created_at, updated_at
+                      population, culture_points, culture_per_day, loyalty, field_type,
+                      resources_updated_at, created_at, updated_at, version
             "#,
         )
         .bind(id)
@@ -0,0 +1,212 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::wave::{AttackWave, DueWaveSend, WaveSend, WaveSendRequest};
+
+pub struct WaveRepository;
+
+impl WaveRepository {
+    /// Store a wave and its sends; `send_times` pairs with `sends`
+    pub async fn create(
+        pool: &PgPool,
+        player_id: Uuid,
+        to_x: i32,
+        to_y: i32,
+        arrive_at: DateTime<Utc>,
+        sends: &[WaveSendRequest],
+        send_times: &[DateTime<Utc>],
+    ) -> AppResult<AttackWave> {
+        let mut tx = pool.begin().await?;
+
+        let wave = sqlx::query_as::<_, AttackWave>(
+            r#"
+            INSERT INTO attack_waves (player_id, to_x, to_y, arrive_at)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id, player_id, to_x, to_y, arrive_at, created_at
+            "#,
+        )
+        .bind(player_id)
+        .bind(to_x)
+        .bind(to_y)
+        .bind(arrive_at)
+        .fetch_one(&mut *tx)
+        .await?;
+
+        for (send, send_at) in sends.iter().zip(send_times) {
+            sqlx::query(
+                r#"
+                INSERT INTO attack_wave_sends (wave_id, from_village_id, mission, troops,
+                                               hero_id, send_at)
+                VALUES ($1, $2, $3, $4, $5, $6)
+                "#,
+            )
+            .bind(wave.id)
+            .bind(send.from_village_id)
+            .bind(send.mission)
+            .bind(sqlx::types::Json(&send.troops))
+            .bind(send.hero_id)
+            .bind(send_at)
+            .execute(&mut *tx)
+            .await?;
+        }
+
+        tx.commit().await?;
+
+        Ok(wave)
+    }
+
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<AttackWave>> {
+        let wave = sqlx::query_as::<_, AttackWave>(
+            r#"
+            SELECT id, player_id, to_x, to_y, arrive_at, created_at
+            FROM attack_waves
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(wave)
+    }
+
+    /// The player's waves, newest arrival first
+    pub async fn find_by_player(
+        pool: &PgPool,
+        player_id: Uuid,
+        limit: i64,
+    ) -> AppResult<Vec<AttackWave>> {
+        let waves = sqlx::query_as::<_, AttackWave>(
+            r#"
+            SELECT id, player_id, to_x, to_y, arrive_at, created_at
+            FROM attack_waves
+            WHERE player_id = $1
+            ORDER BY arrive_at DESC
+            LIMIT $2
+            "#,
+        )
+        .bind(player_id)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(waves)
+    }
+
+    pub async fn find_sends(pool: &PgPool, wave_ids: &[Uuid]) -> AppResult<Vec<WaveSend>> {
+        let sends = sqlx::query_as::<_, WaveSend>(
+            r#"
+            SELECT id, wave_id, from_village_id, mission, troops, hero_id, send_at, status,
+                   army_id, error, sent_at
+            FROM attack_wave_sends
+            WHERE wave_id = ANY($1)
+            ORDER BY send_at
+            "#,
+        )
+        .bind(wave_ids)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(sends)
+    }
+
+    /// Waves of the player with sends still waiting
+    pub async fn count_planned(pool: &PgPool, player_id: Uuid) -> AppResult<i64> {
+        let count: (i64,) = sqlx::query_as(
+            r#"
+            SELECT COUNT(DISTINCT w.id)
+            FROM attack_waves w
+            JOIN attack_wave_sends s ON s.wave_id = w.id
+            WHERE w.player_id = $1 AND s.status = 'planned'
+            "#,
+        )
+        .bind(player_id)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(count.0)
+    }
+
+    /// Cancel the sends of a wave that haven't left yet
+    pub async fn cancel(pool: &PgPool, wave_id: Uuid) -> AppResult<u64> {
+        let result = sqlx::query(
+            r#"
+            UPDATE attack_wave_sends
+            SET status = 'cancelled'
+            WHERE wave_id = $1 AND status = 'planned'
+            "#,
+        )
+        .bind(wave_id)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected())
+    }
+
+    /// Planned sends due by `now`, earliest first
+    pub async fn find_due(
+        pool: &PgPool,
+        now: DateTime<Utc>,
+        limit: i64,
+    ) -> AppResult<Vec<DueWaveSend>> {
+        let sends = sqlx::query_as::<_, DueWaveSend>(
+            r#"
+            SELECT s.id, w.player_id, s.from_village_id, w.to_x, w.to_y, s.mission,
+                   s.troops, s.hero_id
+            FROM attack_wave_sends s
+            JOIN attack_waves w ON w.id = s.wave_id
+            WHERE s.status = 'planned' AND s.send_at <= $1
+            ORDER BY s.send_at
+            LIMIT $2
+            "#,
+        )
+        .bind(now)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(sends)
+    }
+
+    /// Take a due send, marking it sent. False if it was cancelled or
+    /// another scheduler took it first.
+    pub async fn claim_send(pool: &PgPool, id: Uuid, now: DateTime<Utc>) -> AppResult<bool> {
+        let result = sqlx::query(
+            r#"
+            UPDATE attack_wave_sends
+            SET status = 'sent', sent_at = $2
+            WHERE id = $1 AND status = 'planned'
+            "#,
+        )
+        .bind(id)
+        .bind(now)
+        .execute(pool)
+        .await?;
+
+        Ok(result.rows_affected() > 0)
+    }
+
+    /// Record the army a claimed send became
+    pub async fn set_army(pool: &PgPool, id: Uuid, army_id: Uuid) -> AppResult<()> {
+        sqlx::query("UPDATE attack_wave_sends SET army_id = $2 WHERE id = $1")
+            .bind(id)
+            .bind(army_id)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+
+    /// Mark a claimed send as failed
+    pub async fn set_failed(pool: &PgPool, id: Uuid, error: &str) -> AppResult<()> {
+        sqlx::query("UPDATE attack_wave_sends SET status = 'failed', error = $2 WHERE id = $1")
+            .bind(id)
+            .bind(error)
+            .execute(pool)
+            .await?;
+
+        Ok(())
+    }
+}
@@ -0,0 +1,41 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::world_setting::WORLD_CLOCK_KEY;
+
+pub struct WorldClockRepository;
+
+impl WorldClockRepository {
+    /// The database server's clock, the one every instance shares
+    pub async fn database_now(pool: &PgPool) -> AppResult<DateTime<Utc>> {
+        let (now,): (DateTime<Utc>,) = sqlx::query_as("SELECT clock_timestamp()")
+            .fetch_one(pool)
+            .await?;
+
+        Ok(now)
+    }
+
+    /// Record that the world clock has reached `at`. Only ever moves the
+    /// stored mark forward, whichever instance writes last.
+    pub async fn raise_high_water(pool: &PgPool, at: DateTime<Utc>) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO world_settings (key, value, updated_at)
+            VALUES ($1, jsonb_build_object('high_water', $2::timestamptz), NOW())
+            ON CONFLICT (key) DO UPDATE
+            SET value = jsonb_build_object(
+                    'high_water',
+                    GREATEST((world_settings.value->>'high_water')::timestamptz, $2)
+                ),
+                updated_at = NOW()
+            "#,
+        )
+        .bind(WORLD_CLOCK_KEY)
+        .bind(at)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+}
@@ -0,0 +1,88 @@
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::world_dump::{DumpVillage, WorldDump};
+
+pub struct WorldDumpRepository;
+
+impl WorldDumpRepository {
+    /// Every village with its public owner and alliance details
+    pub async fn export_villages(pool: &PgPool) -> AppResult<Vec<DumpVillage>> {
+        let villages = sqlx::query_as::<_, DumpVillage>(
+            r#"
+            SELECT v.id AS village_id, v.x, v.y, v.name AS village_name, v.population,
+                   u.id AS player_id, u.display_name AS player_name, u.tribe::text AS tribe,
+                   a.id AS alliance_id, a.tag AS alliance_tag
+            FROM villages v
+            JOIN users u ON u.id = v.user_id
+            LEFT JOIN alliance_members am ON am.user_id = u.id
+            LEFT JOIN alliances a ON a.id = am.alliance_id
+            ORDER BY v.y DESC, v.x
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(villages)
+    }
+
+    pub async fn create(
+        pool: &PgPool,
+        format: &str,
+        object_key: &str,
+        village_count: i32,
+        size_bytes: i64,
+    ) -> AppResult<WorldDump> {
+        let dump = sqlx::query_as::<_, WorldDump>(
+            r#"
+            INSERT INTO world_dumps (format, object_key, village_count, size_bytes)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id, format, object_key, village_count, size_bytes, created_at
+            "#,
+        )
+        .bind(format)
+        .bind(object_key)
+        .bind(village_count)
+        .bind(size_bytes)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(dump)
+    }
+
+    pub async fn find_by_id(pool: &PgPool, id: Uuid) -> AppResult<Option<WorldDump>> {
+        let dump = sqlx::query_as::<_, WorldDump>(
+            r#"
+            SELECT id, format, object_key, village_count, size_bytes, created_at
+            FROM world_dumps
+            WHERE id = $1
+            "#,
+        )
+        .bind(id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(dump)
+    }
+
+    /// The newest `per_format` dumps of each format, newest first
+    pub async fn list_recent(pool: &PgPool, per_format: i64) -> AppResult<Vec<WorldDump>> {
+        let dumps = sqlx::query_as::<_, WorldDump>(
+            r#"
+            SELECT id, format, object_key, village_count, size_bytes, created_at
+            FROM (
+                SELECT *, ROW_NUMBER() OVER (PARTITION BY format ORDER BY created_at DESC) AS n
+                FROM world_dumps
+            ) d
+            WHERE n <= $1
+            ORDER BY created_at DESC, format
+            "#,
+        )
+        .bind(per_format)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(dumps)
+    }
+}
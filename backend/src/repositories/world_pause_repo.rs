@@ -0,0 +1,85 @@
+use chrono::{DateTime, Duration, Utc};
+use sqlx::PgConnection;
+
+use crate::error::AppResult;
+use crate::models::world_setting::WORLD_PAUSE_KEY;
+
+/// Timers pushed back when a paused world resumes, with the condition
+/// that marks them as still running ($2 is the instant the world paused)
+const TIMERS: &[(&str, &str, &str)] = &[
+    ("villages", "resources_updated_at", "TRUE"),
+    ("buildings", "upgrade_ends_at", "is_upgrading = TRUE"),
+    ("troop_queue", "started_at", "TRUE"),
+    ("troop_queue", "ends_at", "TRUE"),
+    ("research_queue", "started_at", "TRUE"),
+    ("research_queue", "ends_at", "TRUE"),
+    ("healing_queue", "started_at", "TRUE"),
+    ("healing_queue", "ends_at", "TRUE"),
+    ("armies", "departed_at", "is_stationed = FALSE"),
+    ("armies", "arrives_at", "is_stationed = FALSE"),
+    (
+        "armies",
+        "returns_at",
+        "is_stationed = FALSE AND returns_at IS NOT NULL",
+    ),
+    ("resource_shipments", "arrives_at", "NOT delivered"),
+    ("resource_shipments", "returns_at", "returns_at > $2"),
+    (
+        "attack_waves",
+        "arrive_at",
+        "id IN (SELECT wave_id FROM attack_wave_sends WHERE status = 'planned')",
+    ),
+    ("attack_wave_sends", "send_at", "status = 'planned'"),
+    ("scheduled_commands", "execute_at", "status = 'pending'"),
+    ("hero_adventures", "ends_at", "is_completed = FALSE"),
+    ("heroes", "revive_at", "revive_at IS NOT NULL"),
+    ("hero_auctions", "ends_at", "status = 'open'"),
+    ("oases", "last_regrowth_at", "TRUE"),
+];
+
+pub struct WorldPauseRepository;
+
+impl WorldPauseRepository {
+    /// When the world was paused, locking the setting so two resumes can't
+    /// both shift the timers
+    pub async fn paused_at_for_update(conn: &mut PgConnection) -> AppResult<Option<DateTime<Utc>>> {
+        let paused_at = sqlx::query_scalar::<_, Option<DateTime<Utc>>>(
+            r#"
+            SELECT (value->>'paused_at')::timestamptz
+            FROM world_settings
+            WHERE key = $1
+            FOR UPDATE
+            "#,
+        )
+        .bind(WORLD_PAUSE_KEY)
+        .fetch_optional(conn)
+        .await?;
+
+        Ok(paused_at.flatten())
+    }
+
+    /// Push every timer still running at `paused_at` back by `by`. Returns
+    /// the rows changed.
+    pub async fn shift_timers(
+        conn: &mut PgConnection,
+        paused_at: DateTime<Utc>,
+        by: Duration,
+    ) -> AppResult<u64> {
+        let seconds = by.num_milliseconds() as f64 / 1000.0;
+        let mut shifted = 0;
+        for (table, column, condition) in TIMERS {
+            let sql = format!(
+                "UPDATE {table} SET {column} = {column} + make_interval(secs => $1) \
+                 WHERE {condition}"
+            );
+            let mut query = sqlx::query(&sql).bind(seconds);
+            if condition.contains("$2") {
+                query = query.bind(paused_at);
+            }
+            let result = query.execute(&mut *conn).await?;
+            shifted += result.rows_affected();
+        }
+
+        Ok(shifted)
+    }
+}
@@ -0,0 +1,66 @@
+use sqlx::{PgExecutor, PgPool};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::world_setting::WorldSetting;
+
+pub struct WorldSettingRepository;
+
+impl WorldSettingRepository {
+    pub async fn get(pool: &PgPool, key: &str) -> AppResult<Option<WorldSetting>> {
+        let setting = sqlx::query_as::<_, WorldSetting>(
+            r#"
+            SELECT key, value, updated_by, updated_at
+            FROM world_settings
+            WHERE key = $1
+            "#,
+        )
+        .bind(key)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(setting)
+    }
+
+    pub async fn list(pool: &PgPool) -> AppResult<Vec<WorldSetting>> {
+        let settings = sqlx::query_as::<_, WorldSetting>(
+            r#"
+            SELECT key, value, updated_by, updated_at
+            FROM world_settings
+            ORDER BY key
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(settings)
+    }
+
+    /// Takes a pool or a transaction, so a setting can change together with
+    /// the rows it governs
+    pub async fn upsert<'e>(
+        executor: impl PgExecutor<'e>,
+        key: &str,
+        value: &serde_json::Value,
+        updated_by: Option<Uuid>,
+    ) -> AppResult<WorldSetting> {
+        let setting = sqlx::query_as::<_, WorldSetting>(
+            r#"
+            INSERT INTO world_settings (key, value, updated_by, updated_at)
+            VALUES ($1, $2, $3, NOW())
+            ON CONFLICT (key) DO UPDATE
+            SET value = EXCLUDED.value,
+                updated_by = EXCLUDED.updated_by,
+                updated_at = NOW()
+            RETURNING key, value, updated_by, updated_at
+            "#,
+        )
+        .bind(key)
+        .bind(value)
+        .bind(updated_by)
+        .fetch_one(executor)
+        .await?;
+
+        Ok(setting)
+    }
+}
@@ -0,0 +1,66 @@
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::world_shard::{UpsertWorldShardRequest, WorldShard};
+
+pub struct WorldShardRepository;
+
+impl WorldShardRepository {
+    pub async fn list(pool: &PgPool) -> AppResult<Vec<WorldShard>> {
+        let shards = sqlx::query_as::<_, WorldShard>(
+            r#"
+            SELECT world_id, host, port, database_name, schema_name, created_at, updated_at
+            FROM world_shards
+            ORDER BY world_id
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(shards)
+    }
+
+    pub async fn find(pool: &PgPool, world_id: &str) -> AppResult<Option<WorldShard>> {
+        let shard = sqlx::query_as::<_, WorldShard>(
+            r#"
+            SELECT world_id, host, port, database_name, schema_name, created_at, updated_at
+            FROM world_shards
+            WHERE world_id = $1
+            "#,
+        )
+        .bind(world_id)
+        .fetch_optional(pool)
+        .await?;
+
+        Ok(shard)
+    }
+
+    pub async fn upsert(
+        pool: &PgPool,
+        world_id: &str,
+        request: &UpsertWorldShardRequest,
+    ) -> AppResult<WorldShard> {
+        let shard = sqlx::query_as::<_, WorldShard>(
+            r#"
+            INSERT INTO world_shards (world_id, host, port, database_name, schema_name)
+            VALUES ($1, $2, $3, $4, $5)
+            ON CONFLICT (world_id) DO UPDATE
+            SET host = EXCLUDED.host,
+                port = EXCLUDED.port,
+                database_name = EXCLUDED.database_name,
+                schema_name = EXCLUDED.schema_name,
+                updated_at = NOW()
+            RETURNING world_id, host, port, database_name, schema_name, created_at, updated_at
+            "#,
+        )
+        .bind(world_id)
+        .bind(&request.host)
+        .bind(request.port)
+        .bind(&request.database_name)
+        .bind(&request.schema_name)
+        .fetch_one(pool)
+        .await?;
+
+        Ok(shard)
+    }
+}
@@ -0,0 +1,165 @@
+use chrono::NaiveDate;
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::world_stats::{DailyWorldStats, TopCombatant, TribeCount};
+
+pub struct WorldStatsRepository;
+
+impl WorldStatsRepository {
+    // ==================== Projection ====================
+
+    /// Recompute one day's row from users, logins and battle reports
+    pub async fn refresh_day(pool: &PgPool, day: NaiveDate) -> AppResult<()> {
+        sqlx::query(
+            r#"
+            INSERT INTO world_daily_stats (day, total_players, active_players, battles,
+                                           troops_killed, updated_at)
+            SELECT $1,
+                   (SELECT COUNT(*) FROM users
+                    WHERE deleted_at IS NULL AND created_at < $1 + 1
+                      AND firebase_uid NOT LIKE 'system:%'),
+                   (SELECT COUNT(*) FROM (
+                        SELECT user_id FROM account_activity
+                        WHERE kind = 'login' AND created_at >= $1 AND created_at < $1 + 1
+                        UNION
+                        SELECT id FROM users
+                        WHERE last_login_at >= $1 AND last_login_at < $1 + 1
+                    ) active),
+                   COUNT(b.id),
+                   COALESCE(SUM(troop_total(b.attacker_losses)
+                                + troop_total(b.defender_losses)), 0),
+                   NOW()
+            FROM battle_reports b
+            WHERE b.occurred_at >= $1 AND b.occurred_at < $1 + 1
+            ON CONFLICT (day) DO UPDATE SET
+                total_players = EXCLUDED.total_players,
+                active_players = EXCLUDED.active_players,
+                battles = EXCLUDED.battles,
+                troops_killed = EXCLUDED.troops_killed,
+                updated_at = EXCLUDED.updated_at
+            "#,
+        )
+        .bind(day)
+        .execute(pool)
+        .await?;
+
+        Ok(())
+    }
+
+    /// Rewrite the kills per player for the week starting `week_start`
+    pub async fn refresh_week(pool: &PgPool, week_start: NaiveDate) -> AppResult<u64> {
+        let mut tx = pool.begin().await?;
+
+        sqlx::query("DELETE FROM world_weekly_combat WHERE week_start = $1")
+            .bind(week_start)
+            .execute(&mut *tx)
+            .await?;
+
+        let result = sqlx::query(
+            r#"
+            INSERT INTO world_weekly_combat (week_start, user_id, attack_kills, defense_kills)
+            SELECT $1, user_id, SUM(attack_kills), SUM(defense_kills)
+            FROM (
+                SELECT attacker_player_id AS user_id,
+                       troop_total(defender_losses) AS attack_kills,
+                       0::BIGINT AS defense_kills
+                FROM battle_reports
+                WHERE occurred_at >= $1 AND occurred_at < $1 + 7
+                UNION ALL
+                SELECT defender_player_id,
+                       0::BIGINT,
+                       troop_total(attacker_losses)
+                FROM battle_reports
+                WHERE occurred_at >= $1 AND occurred_at < $1 + 7
+                  AND defender_player_id IS NOT NULL
+            ) kills
+            GROUP BY user_id
+            "#,
+        )
+        .bind(week_start)
+        .execute(&mut *tx)
+        .await?;
+
+        tx.commit().await?;
+
+        Ok(result.rows_affected())
+    }
+
+    // ==================== Reads ====================
+
+    pub async fn daily(pool: &PgPool, since: NaiveDate) -> AppResult<Vec<DailyWorldStats>> {
+        let days = sqlx::query_as::<_, DailyWorldStats>(
+            r#"
+            SELECT day, total_players, active_players, battles, troops_killed, updated_at
+            FROM world_daily_stats
+            WHERE day >= $1
+            ORDER BY day ASC
+            "#,
+        )
+        .bind(since)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(days)
+    }
+
+    /// Players with at least one village, by tribe
+    pub async fn tribe_distribution(pool: &PgPool) -> AppResult<Vec<TribeCount>> {
+        let tribes = sqlx::query_as::<_, TribeCount>(
+            r#"
+            SELECT u.tribe, COUNT(*) AS players
+            FROM users u
+            WHERE u.deleted_at IS NULL
+              AND u.firebase_uid NOT LIKE 'system:%'
+              AND EXISTS (SELECT 1 FROM villages v WHERE v.user_id = u.id)
+            GROUP BY u.tribe
+            ORDER BY players DESC
+            "#,
+        )
+        .fetch_all(pool)
+        .await?;
+
+        Ok(tribes)
+    }
+
+    pub async fn top_attackers(
+        pool: &PgPool,
+        week_start: NaiveDate,
+        limit: i64,
+    ) -> AppResult<Vec<TopCombatant>> {
+        Self::top(pool, week_start, "attack_kills", limit).await
+    }
+
+    pub async fn top_defenders(
+        pool: &PgPool,
+        week_start: NaiveDate,
+        limit: i64,
+    ) -> AppResult<Vec<TopCombatant>> {
+        Self::top(pool, week_start, "defense_kills", limit).await
+    }
+
+    async fn top(
+        pool: &PgPool,
+        week_start: NaiveDate,
+        column: &str,
+        limit: i64,
+    ) -> AppResult<Vec<TopCombatant>> {
+        let top = sqlx::query_as::<_, TopCombatant>(&format!(
+            r#"
+            SELECT c.user_id, u.display_name, c.{column} AS kills
+            FROM world_weekly_combat c
+            JOIN users u ON u.id = c.user_id
+            WHERE c.week_start = $1 AND c.{column} > 0
+            ORDER BY c.{column} DESC, c.user_id
+            LIMIT $2
+            "#
+        ))
+        .bind(week_start)
+        .bind(limit)
+        .fetch_all(pool)
+        .await?;
+
+        Ok(top)
+    }
+}
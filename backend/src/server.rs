@@ -0,0 +1,138 @@
+use anyhow::{Context, Result};
+use axum::{
+    extract::Host,
+    http::{uri::Authority, StatusCode, Uri},
+    response::{IntoResponse, Redirect, Response},
+    Router,
+};
+use axum_server::tls_rustls::RustlsConfig;
+use axum_server::Server;
+use futures_util::StreamExt;
+use hyper_util::rt::TokioTimer;
+use rustls_acme::{caches::DirCache, AcmeConfig};
+use std::net::SocketAddr;
+use std::time::Duration;
+use tracing::{error, info, warn};
+
+use crate::config::{LimitsConfig, ServerConfig, TlsConfig};
+
+/// Serve the app over plain HTTP, or over HTTPS with a certificate pair or
+/// Let's Encrypt certificates when TLS is configured
+pub async fn serve(
+    app: Router,
+    server: &ServerConfig,
+    tls: &TlsConfig,
+    limits: &LimitsConfig,
+) -> Result<()> {
+    let http_addr = SocketAddr::from(([0, 0, 0, 0], server.port));
+
+    if !tls.enabled() {
+        info!("Server listening on {}", http_addr);
+        limit_headers(axum_server::bind(http_addr), limits)
+            .serve(app.into_make_service())
+            .await?;
+        return Ok(());
+    }
+
+    let https_addr = SocketAddr::from(([0, 0, 0, 0], tls.https_port));
+    if tls.redirect_http {
+        let https_port = tls.https_port;
+        let limits = limits.clone();
+        tokio::spawn(async move {
+            if let Err(e) = redirect_http(http_addr, https_port, &limits).await {
+                error!("HTTP redirect listener failed: {:#}", e);
+            }
+        });
+    }
+
+    if tls.acme_domains.is_empty() {
+        let (cert_path, key_path) = tls
+            .cert_path
+            .as_deref()
+            .zip(tls.key_path.as_deref())
+            .context("TLS_CERT_PATH and TLS_KEY_PATH must be set together")?;
+        let rustls = RustlsConfig::from_pem_file(cert_path, key_path)
+            .await
+            .context("Failed to load TLS certificate")?;
+
+        info!("Server listening on {} (TLS)", https_addr);
+        limit_headers(axum_server::bind_rustls(https_addr, rustls), limits)
+            .serve(app.into_make_service())
+            .await?;
+    } else {
+        let mut acme = AcmeConfig::new(tls.acme_domains.clone())
+            .contact(tls.acme_email.iter().map(|e| format!("mailto:{}", e)))
+            .cache_option(tls.acme_cache_dir.clone().map(DirCache::new))
+            .directory_lets_encrypt(tls.acme_production)
+            .state();
+        let acceptor = acme.axum_acceptor(acme.default_rustls_config());
+
+        // Drives certificate issuance and renewal
+        tokio::spawn(async move {
+            while let Some(event) = acme.next().await {
+                match event {
+                    Ok(event) => info!("ACME: {:?}", event),
+                    Err(e) => warn!("ACME error: {:?}", e),
+                }
+            }
+        });
+
+        info!(
+            "Server listening on {} (TLS, Let's Encrypt for {})",
+            https_addr,
+            tls.acme_domains.join(", ")
+        );
+        limit_headers(axum_server::bind(https_addr).acceptor(acceptor), limits)
+            .serve(app.into_make_service())
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Bound how long a client may take to send request headers, and how
+/// large and numerous they may be, so slow or bloated requests can't hold
+/// connections open
+fn limit_headers<A>(mut server: Server<A>, limits: &LimitsConfig) -> Server<A> {
+    let builder = server.http_builder();
+    builder
+        .http1()
+        .timer(TokioTimer::new())
+        .header_read_timeout(Duration::from_secs(limits.header_read_timeout_secs))
+        .max_buf_size(limits.max_header_bytes)
+        .max_headers(limits.max_headers);
+    builder
+        .http2()
+        .timer(TokioTimer::new())
+        .max_header_list_size(limits.max_header_bytes as u32);
+    server
+}
+
+/// Answer every plain HTTP request with a permanent redirect to HTTPS
+async fn redirect_http(addr: SocketAddr, https_port: u16, limits: &LimitsConfig) -> Result<()> {
+    let app = Router::new().fallback(move |Host(host): Host, uri: Uri| async move {
+        redirect_to_https(&host, &uri, https_port)
+    });
+
+    info!("Redirecting HTTP on {} to HTTPS", addr);
+    limit_headers(axum_server::bind(addr), limits)
+        .serve(app.into_make_service())
+        .await?;
+
+    Ok(())
+}
+
+fn redirect_to_https(host: &str, uri: &Uri, https_port: u16) -> Response {
+    let Ok(host) = host.parse::<Authority>() else {
+        return StatusCode::BAD_REQUEST.into_response();
+    };
+    let hostname = host.host();
+    let authority = if https_port == 443 {
+        hostname.to_string()
+    } else {
+        format!("{}:{}", hostname, https_port)
+    };
+    let path = uri.path_and_query().map_or("/", |pq| pq.as_str());
+
+    Redirect::permanent(&format!("https://{}{}", authority, path)).into_response()
+}
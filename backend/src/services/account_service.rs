@@ -0,0 +1,377 @@
+use chrono::Duration;
+use rand::Rng;
+use serde_json::json;
+use sha2::{Digest, Sha256};
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::account::{
+    AccountTokenPurpose, EmailChangeResponse, EMAIL_CHANGE_COOLDOWN_DAYS, EMAIL_TOKEN_TTL_MINUTES,
+    MAIL_COOLDOWN_MINUTES, RECOVERY_LOOKBACK_DAYS, REVERT_TOKEN_TTL_DAYS,
+};
+use crate::models::template::TemplateKey;
+use crate::models::user::{UpdateUser, User};
+use crate::repositories::account_repo::AccountRepository;
+use crate::repositories::session_repo::SessionRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::clock;
+use crate::services::mailer::Mailer;
+use crate::services::template_service::TemplateService;
+use crate::AppState;
+
+/// Email changes and account recovery. Firebase owns sign-in, so every
+/// change is applied there through the admin API before the database,
+/// keeping both in agreement.
+pub struct AccountService;
+
+impl AccountService {
+    /// Mail a confirmation link to the new address. The email only changes
+    /// once the link is used.
+    pub async fn request_email_change(
+        state: &AppState,
+        user: &User,
+        new_email: &str,
+    ) -> AppResult<()> {
+        let mailer = mailer(state)?;
+        let new_email = normalize(new_email)?;
+
+        if user
+            .email
+            .as_deref()
+            .is_some_and(|e| e.eq_ignore_ascii_case(&new_email))
+        {
+            return Err(AppError::BadRequest("That is already your email".into()));
+        }
+        Self::check_available(state, user.id, &new_email).await?;
+
+        let now = clock::now();
+        if let Some(changed_at) = AccountRepository::last_email_change(&state.db, user.id).await? {
+            if changed_at > now - Duration::days(EMAIL_CHANGE_COOLDOWN_DAYS) {
+                return Err(AppError::TooManyRequests(format!(
+                    "The email can be changed once every {} days",
+                    EMAIL_CHANGE_COOLDOWN_DAYS
+                )));
+            }
+        }
+        Self::check_mail_cooldown(state, user.id, AccountTokenPurpose::EmailChange).await?;
+
+        let token = Self::issue(
+            state,
+            user.id,
+            AccountTokenPurpose::EmailChange,
+            &new_email,
+            user.email.as_deref(),
+            Duration::minutes(EMAIL_TOKEN_TTL_MINUTES),
+        )
+        .await?;
+
+        let email = TemplateService::render(
+            &state.db,
+            TemplateKey::EmailChangeEmail,
+            &locale_of(state, user.id).await?,
+            &json!({
+                "email": new_email,
+                "link": link(state, "email-change", &token),
+                "expires_minutes": EMAIL_TOKEN_TTL_MINUTES,
+            }),
+        )
+        .await?;
+        mailer.send(&new_email, &email.subject, &email.body).await?;
+
+        info!("User {} requested an email change", user.id);
+
+        Ok(())
+    }
+
+    /// Apply an email change confirmed from the new address, then tell the
+    /// old address, with a link to undo it
+    pub async fn confirm_email_change(
+        state: &AppState,
+        token: &str,
+    ) -> AppResult<EmailChangeResponse> {
+        let now = clock::now();
+        let token = AccountRepository::use_token(
+            &state.db,
+            &hash(token),
+            AccountTokenPurpose::EmailChange,
+            now,
+        )
+        .await?
+        .ok_or_else(|| AppError::BadRequest("Invalid or expired link".into()))?;
+
+        let user = UserRepository::find_by_id(&state.db, token.user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Account not found".into()))?;
+        Self::check_available(state, user.id, &token.email).await?;
+
+        Self::set_email(state, &user, &token.email).await?;
+        info!("User {} changed their email", user.id);
+
+        if let (Some(old_email), Some(mailer)) = (token.previous_email.as_deref(), &state.mailer) {
+            Self::notify_old_address(state, mailer, &user, old_email, &token.email).await;
+        }
+
+        Ok(EmailChangeResponse { email: token.email })
+    }
+
+    /// Mail a recovery link for the account using `email` now, or that used
+    /// it until a recent email change. Always succeeds, so the response
+    /// doesn't reveal which addresses have accounts.
+    pub async fn request_recovery(state: &AppState, email: &str) -> AppResult<()> {
+        let mailer = mailer(state)?;
+        let Ok(email) = normalize(email) else {
+            return Ok(());
+        };
+
+        let user = match UserRepository::find_by_email(&state.db, &email).await? {
+            Some(user) => Some(user),
+            None => {
+                let since = clock::now() - Duration::days(RECOVERY_LOOKBACK_DAYS);
+                match AccountRepository::find_user_by_previous_email(&state.db, &email, since)
+                    .await?
+                {
+                    Some(user_id) => UserRepository::find_by_id(&state.db, user_id).await?,
+                    None => None,
+                }
+            }
+        };
+        let Some(user) = user else {
+            return Ok(());
+        };
+
+        if Self::check_mail_cooldown(state, user.id, AccountTokenPurpose::Recovery)
+            .await
+            .is_err()
+        {
+            return Ok(());
+        }
+
+        let token = Self::issue(
+            state,
+            user.id,
+            AccountTokenPurpose::Recovery,
+            &email,
+            user.email.as_deref(),
+            Duration::minutes(EMAIL_TOKEN_TTL_MINUTES),
+        )
+        .await?;
+
+        let message = TemplateService::render(
+            &state.db,
+            TemplateKey::RecoveryEmail,
+            &locale_of(state, user.id).await?,
+            &json!({
+                "email": email,
+                "link": link(state, "recovery", &token),
+                "expires_minutes": EMAIL_TOKEN_TTL_MINUTES,
+            }),
+        )
+        .await?;
+        match mailer
+            .send(&email, &message.subject, &message.body)
+            .await
+        {
+            Ok(()) => info!("Recovery link mailed for user {}", user.id),
+            Err(e) => warn!("Recovery link for user {} failed: {:#}", user.id, e),
+        }
+
+        Ok(())
+    }
+
+    /// Give the account back to the address the link was mailed to: restore
+    /// that email and sign out every device, so whoever changed it loses
+    /// access. The player then resets their password through Firebase.
+    pub async fn confirm_recovery(state: &AppState, token: &str) -> AppResult<EmailChangeResponse> {
+        let now = clock::now();
+        let token = AccountRepository::use_token(
+            &state.db,
+            &hash(token),
+            AccountTokenPurpose::Recovery,
+            now,
+        )
+        .await?
+        .ok_or_else(|| AppError::BadRequest("Invalid or expired link".into()))?;
+
+        let user = UserRepository::find_by_id(&state.db, token.user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Account not found".into()))?;
+
+        if !user
+            .email
+            .as_deref()
+            .is_some_and(|e| e.eq_ignore_ascii_case(&token.email))
+        {
+            Self::check_available(state, user.id, &token.email).await?;
+            Self::set_email(state, &user, &token.email).await?;
+        }
+
+        let revoked = SessionRepository::revoke_all_for_user(&state.db, user.id, now).await?;
+        if let Some(user_admin) = &state.user_admin {
+            user_admin.revoke_refresh_tokens(&user.firebase_uid).await?;
+        }
+
+        info!(
+            "User {} recovered their account, {} sessions revoked",
+            user.id, revoked
+        );
+
+        Ok(EmailChangeResponse { email: token.email })
+    }
+
+    /// Change the sign-in email in Firebase first; if that fails the
+    /// database keeps the old address
+    async fn set_email(state: &AppState, user: &User, email: &str) -> AppResult<()> {
+        if let Some(user_admin) = &state.user_admin {
+            user_admin.update_email(&user.firebase_uid, email).await?;
+        }
+
+        UserRepository::update(
+            &state.db,
+            &user.firebase_uid,
+            UpdateUser {
+                email: Some(email.to_string()),
+                display_name: None,
+                photo_url: None,
+            },
+        )
+        .await?;
+
+        Ok(())
+    }
+
+    /// Tell the replaced address about the change, with a link to take the
+    /// account back. Failures are logged; the change itself stands.
+    async fn notify_old_address(
+        state: &AppState,
+        mailer: &Mailer,
+        user: &User,
+        old_email: &str,
+        new_email: &str,
+    ) {
+        let token = match Self::issue(
+            state,
+            user.id,
+            AccountTokenPurpose::Recovery,
+            old_email,
+            Some(new_email),
+            Duration::days(REVERT_TOKEN_TTL_DAYS),
+        )
+        .await
+        {
+            Ok(token) => token,
+            Err(e) => {
+                warn!("Recovery link for user {} failed: {}", user.id, e);
+                return;
+            }
+        };
+
+        let context = json!({
+            "email": new_email,
+            "link": link(state, "recovery", &token),
+            "expires_days": REVERT_TOKEN_TTL_DAYS,
+        });
+        let email = async {
+            let locale = locale_of(state, user.id).await?;
+            TemplateService::render(&state.db, TemplateKey::EmailChangedEmail, &locale, &context)
+                .await
+        };
+        let email = match email.await {
+            Ok(email) => email,
+            Err(e) => {
+                warn!("Email change notice to user {} failed: {}", user.id, e);
+                return;
+            }
+        };
+        if let Err(e) = mailer.send(old_email, &email.subject, &email.body).await {
+            warn!("Email change notice to user {} failed: {:#}", user.id, e);
+        }
+    }
+
+    async fn check_available(state: &AppState, user_id: Uuid, email: &str) -> AppResult<()> {
+        match UserRepository::find_by_email(&state.db, email).await? {
+            Some(other) if other.id != user_id => {
+                Err(AppError::Conflict("That email is already in use".into()))
+            }
+            _ => Ok(()),
+        }
+    }
+
+    async fn check_mail_cooldown(
+        state: &AppState,
+        user_id: Uuid,
+        purpose: AccountTokenPurpose,
+    ) -> AppResult<()> {
+        let last = AccountRepository::last_created(&state.db, user_id, purpose).await?;
+        if last.is_some_and(|at| at > clock::now() - Duration::minutes(MAIL_COOLDOWN_MINUTES)) {
+            return Err(AppError::TooManyRequests(format!(
+                "Please wait {} minutes before asking for another email",
+                MAIL_COOLDOWN_MINUTES
+            )));
+        }
+        Ok(())
+    }
+
+    /// Store a new single-use token and return it; only its hash is kept
+    async fn issue(
+        state: &AppState,
+        user_id: Uuid,
+        purpose: AccountTokenPurpose,
+        email: &str,
+        previous_email: Option<&str>,
+        ttl: Duration,
+    ) -> AppResult<String> {
+        let token = hex::encode(rand::thread_rng().gen::<[u8; 32]>());
+        AccountRepository::create_token(
+            &state.db,
+            user_id,
+            purpose,
+            &hash(&token),
+            email,
+            previous_email,
+            clock::now() + ttl,
+        )
+        .await?;
+        Ok(token)
+    }
+}
+
+fn mailer(state: &AppState) -> AppResult<&Mailer> {
+    state
+        .mailer
+        .as_ref()
+        .ok_or_else(|| AppError::ServiceUnavailable("Email is not configured".into()))
+}
+
+/// Language the player reads their email in
+async fn locale_of(state: &AppState, user_id: Uuid) -> AppResult<String> {
+    let preferences = UserRepository::get_email_preferences(&state.db, user_id).await?;
+    Ok(preferences.locale)
+}
+
+fn hash(token: &str) -> String {
+    hex::encode(Sha256::digest(token.as_bytes()))
+}
+
+fn link(state: &AppState, kind: &str, token: &str) -> String {
+    format!(
+        "{}/account/confirm?kind={}&token={}",
+        state.config.email.app_url.trim_end_matches('/'),
+        kind,
+        token
+    )
+}
+
+/// Trimmed address, if it looks like one
+fn normalize(email: &str) -> AppResult<String> {
+    let email = email.trim();
+    let valid = email.len() <= 255
+        && !email.chars().any(char::is_whitespace)
+        && email
+            .split_once('@')
+            .is_some_and(|(local, domain)| !local.is_empty() && domain.contains('.'));
+    if !valid {
+        return Err(AppError::ValidationError("Invalid email address".into()));
+    }
+    Ok(email.to_string())
+}
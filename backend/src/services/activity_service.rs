@@ -0,0 +1,101 @@
+use axum::http::HeaderMap;
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::error;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::activity::{
+    ActivityEntry, ActivityKind, ActivityQuery, NewActivity, RequestOrigin,
+    ACTIVITY_RETENTION_DAYS, MAX_DEVICE_LENGTH,
+};
+use crate::models::shop::GoldUsage;
+use crate::repositories::activity_repo::ActivityRepository;
+use crate::services::clock;
+
+/// Per-account log of logins, armies sent, gold spent and support access
+pub struct ActivityService;
+
+impl ActivityService {
+    /// Store the entry in the background; logging never fails the action
+    pub fn record(pool: &PgPool, activity: NewActivity) {
+        let pool = pool.clone();
+        tokio::spawn(async move {
+            if let Err(e) = ActivityRepository::insert(&pool, &activity).await {
+                error!(
+                    "Failed to record {:?} activity for {}: {:?}",
+                    activity.kind, activity.user_id, e
+                );
+            }
+        });
+    }
+
+    /// Record something the owner did themselves
+    pub fn record_own(
+        pool: &PgPool,
+        user_id: Uuid,
+        kind: ActivityKind,
+        origin: RequestOrigin,
+        details: serde_json::Value,
+    ) {
+        Self::record(
+            pool,
+            NewActivity {
+                user_id,
+                actor_id: None,
+                kind,
+                origin,
+                details,
+            },
+        );
+    }
+
+    /// Gold spends happen inside the shop, away from the request
+    pub fn record_gold_spent(pool: &PgPool, usage: &GoldUsage) {
+        Self::record_own(
+            pool,
+            usage.user_id,
+            ActivityKind::GoldSpent,
+            RequestOrigin::default(),
+            serde_json::json!({
+                "feature": usage.feature,
+                "gold_spent": usage.gold_spent,
+                "target_type": usage.target_type,
+                "target_id": usage.target_id,
+            }),
+        );
+    }
+
+    pub async fn list(
+        pool: &PgPool,
+        user_id: Uuid,
+        query: &ActivityQuery,
+    ) -> AppResult<Vec<ActivityEntry>> {
+        ActivityRepository::list(pool, user_id, query).await
+    }
+
+    pub async fn prune(pool: &PgPool) -> AppResult<u64> {
+        ActivityRepository::delete_before(
+            pool,
+            clock::now() - Duration::days(ACTIVITY_RETENTION_DAYS),
+        )
+        .await
+    }
+
+    /// Client IP (first proxy hop) and User-Agent of a request
+    pub fn origin(headers: &HeaderMap) -> RequestOrigin {
+        let header = |name: &str| headers.get(name).and_then(|h| h.to_str().ok());
+
+        let client_ip = header("x-forwarded-for")
+            .and_then(|h| h.split(',').next())
+            .or_else(|| header("x-real-ip"))
+            .map(|ip| ip.trim().to_string());
+        let device = header("user-agent").map(|ua| ua.chars().take(MAX_DEVICE_LENGTH).collect());
+
+        RequestOrigin {
+            client_ip,
+            ip_category: None,
+            device,
+        }
+    }
+}
@@ -1,12 +1,18 @@
+use chrono::Duration;
 use sqlx::PgPool;
+use tracing::info;
 use uuid::Uuid;
 
-use crate::error::{AppError, AppResult};
+use crate::error::{AppError, AppResult, ErrorCode};
 use crate::models::alliance::{
-    Alliance, AllianceDiplomacy, AllianceInvitation, AllianceListItem, AllianceMemberResponse,
-    AllianceResponse, AllianceRole, CreateAllianceRequest, DiplomacyStatus, InvitationStatus,
+    member_capacity, Alliance, AllianceDiplomacy, AllianceInvitation, AllianceListItem,
+    AllianceMemberResponse, AllianceMerge, AllianceResponse, AllianceRole, CreateAllianceRequest,
+    DiplomacyStatus, InvitationStatus, MergeStatus, EMBASSY_LEVEL_TO_FOUND, MERGE_EXPIRY_DAYS,
 };
+use crate::models::building::BuildingType;
 use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::services::clock;
 
 pub struct AllianceService;
 
@@ -21,22 +27,35 @@ impl AllianceService {
     ) -> AppResult<AllianceResponse> {
         // Validate tag length (2-4 characters)
         if request.tag.len() < 2 || request.tag.len() > 4 {
-            return Err(AppError::BadRequest("Tag must be 2-4 characters".into()));
+            return Err(AppError::ValidationError("Tag must be 2-4 characters".into()));
         }
 
         // Validate name length
         if request.name.len() < 3 || request.name.len() > 50 {
-            return Err(AppError::BadRequest("Name must be 3-50 characters".into()));
+            return Err(AppError::ValidationError("Name must be 3-50 characters".into()));
         }
 
         // Check if user is already in an alliance
         if let Some(_) = AllianceRepository::get_user_alliance(pool, user_id).await? {
-            return Err(AppError::BadRequest("You are already in an alliance".into()));
+            return Err(ErrorCode::AlreadyInAlliance.into());
+        }
+
+        // Founding takes an embassy
+        let embassy =
+            BuildingRepository::max_level_for_user(pool, user_id, BuildingType::Embassy).await?;
+        if embassy < EMBASSY_LEVEL_TO_FOUND {
+            return Err(AppError::Game(
+                ErrorCode::MissingPrerequisites,
+                format!(
+                    "An embassy at level {} is needed to found an alliance",
+                    EMBASSY_LEVEL_TO_FOUND
+                ),
+            ));
         }
 
         // Check if tag is already taken
         if let Some(_) = AllianceRepository::find_by_tag(pool, &request.tag.to_uppercase()).await? {
-            return Err(AppError::BadRequest("This tag is already taken".into()));
+            return Err(ErrorCode::TagTaken.into());
         }
 
         // Create the alliance
@@ -52,8 +71,10 @@ impl AllianceService {
         // Add founder as leader
         AllianceRepository::add_member(pool, alliance.id, user_id, AllianceRole::Leader).await?;
 
+        let max_members = Self::capacity(pool, &alliance).await?;
         let mut response: AllianceResponse = alliance.into();
         response.member_count = 1;
+        response.max_members = max_members;
 
         Ok(response)
     }
@@ -65,9 +86,11 @@ impl AllianceService {
             .ok_or_else(|| AppError::NotFound("Alliance not found".into()))?;
 
         let member_count = AllianceRepository::get_member_count(pool, alliance_id).await?;
+        let max_members = Self::capacity(pool, &alliance).await?;
 
         let mut response: AllianceResponse = alliance.into();
         response.member_count = member_count;
+        response.max_members = max_members;
 
         Ok(response)
     }
@@ -92,8 +115,10 @@ impl AllianceService {
         .await?;
 
         let member_count = AllianceRepository::get_member_count(pool, alliance_id).await?;
+        let max_members = Self::capacity(pool, &alliance).await?;
         let mut response: AllianceResponse = alliance.into();
         response.member_count = member_count;
+        response.max_members = max_members;
 
         Ok(response)
     }
@@ -143,12 +168,18 @@ impl AllianceService {
 
         // Check if invitee is already in an alliance
         if let Some(_) = AllianceRepository::get_user_alliance(pool, invitee_id).await? {
-            return Err(AppError::BadRequest("Player is already in an alliance".into()));
+            return Err(AppError::Game(
+                ErrorCode::AlreadyInAlliance,
+                "Player is already in an alliance".into(),
+            ));
         }
 
         // Check if there's already a pending invitation
         if AllianceRepository::has_pending_invitation(pool, alliance_id, invitee_id).await? {
-            return Err(AppError::BadRequest("Player already has a pending invitation".into()));
+            return Err(AppError::Game(
+                ErrorCode::InvitationPending,
+                "Player already has a pending invitation".into(),
+            ));
         }
 
         // Check member limit
@@ -156,10 +187,7 @@ impl AllianceService {
             .await?
             .ok_or_else(|| AppError::NotFound("Alliance not found".into()))?;
 
-        let member_count = AllianceRepository::get_member_count(pool, alliance_id).await?;
-        if member_count >= alliance.max_members {
-            return Err(AppError::BadRequest("Alliance is full".into()));
-        }
+        Self::check_room(pool, &alliance, 1).await?;
 
         AllianceRepository::create_invitation(pool, alliance_id, inviter_id, invitee_id, message.as_deref()).await
     }
@@ -182,21 +210,37 @@ impl AllianceService {
 
         // Check if invitation is still pending
         if invitation.status != InvitationStatus::Pending {
-            return Err(AppError::BadRequest("Invitation has already been responded to".into()));
+            return Err(AppError::Game(
+                ErrorCode::InvitationClosed,
+                "Invitation has already been responded to".into(),
+            ));
         }
 
         // Check if expired
         if invitation.expires_at < chrono::Utc::now() {
             AllianceRepository::update_invitation_status(pool, invitation_id, InvitationStatus::Expired).await?;
-            return Err(AppError::BadRequest("Invitation has expired".into()));
+            return Err(AppError::Game(
+                ErrorCode::InvitationClosed,
+                "Invitation has expired".into(),
+            ));
         }
 
         if accept {
+            if let Some(merge_id) = invitation.merge_id {
+                return Self::accept_merge_invitation(pool, user_id, &invitation, merge_id).await;
+            }
+
             // Check if user is already in an alliance
             if let Some(_) = AllianceRepository::get_user_alliance(pool, user_id).await? {
-                return Err(AppError::BadRequest("You are already in an alliance".into()));
+                return Err(ErrorCode::AlreadyInAlliance.into());
             }
 
+            // The leader's embassy may have shrunk since the invitation went out
+            let alliance = AllianceRepository::find_by_id(pool, invitation.alliance_id)
+                .await?
+                .ok_or_else(|| AppError::NotFound("Alliance not found".into()))?;
+            Self::check_room(pool, &alliance, 1).await?;
+
             // Add to alliance
             AllianceRepository::add_member(pool, invitation.alliance_id, user_id, AllianceRole::Member).await?;
             AllianceRepository::update_invitation_status(pool, invitation_id, InvitationStatus::Accepted).await?;
@@ -216,11 +260,12 @@ impl AllianceService {
     pub async fn leave_alliance(pool: &PgPool, user_id: Uuid) -> AppResult<()> {
         let member = AllianceRepository::get_user_alliance(pool, user_id)
             .await?
-            .ok_or_else(|| AppError::BadRequest("You are not in an alliance".into()))?;
+            .ok_or_else(|| AppError::from(ErrorCode::NotInAlliance))?;
 
         // Leader cannot leave, must transfer leadership first
         if member.role == AllianceRole::Leader {
-            return Err(AppError::BadRequest(
+            return Err(AppError::Game(
+                ErrorCode::LeaderCannotLeave,
                 "Leader cannot leave. Transfer leadership first or disband the alliance.".into(),
             ));
         }
@@ -234,7 +279,7 @@ impl AllianceService {
     pub async fn kick_member(pool: &PgPool, user_id: Uuid, target_user_id: Uuid) -> AppResult<()> {
         let kicker = AllianceRepository::get_user_alliance(pool, user_id)
             .await?
-            .ok_or_else(|| AppError::BadRequest("You are not in an alliance".into()))?;
+            .ok_or_else(|| AppError::from(ErrorCode::NotInAlliance))?;
 
         let target = AllianceRepository::get_member(pool, kicker.alliance_id, target_user_id)
             .await?
@@ -244,7 +289,10 @@ impl AllianceService {
         match kicker.role {
             AllianceRole::Leader => {
                 if target.role == AllianceRole::Leader {
-                    return Err(AppError::BadRequest("Cannot kick yourself".into()));
+                    return Err(AppError::Game(
+                        ErrorCode::SelfTarget,
+                        "Cannot kick yourself".into(),
+                    ));
                 }
             }
             AllianceRole::Officer => {
@@ -271,7 +319,7 @@ impl AllianceService {
     ) -> AppResult<()> {
         let actor = AllianceRepository::get_user_alliance(pool, user_id)
             .await?
-            .ok_or_else(|| AppError::BadRequest("You are not in an alliance".into()))?;
+            .ok_or_else(|| AppError::from(ErrorCode::NotInAlliance))?;
 
         // Only leader can change roles
         if actor.role != AllianceRole::Leader {
@@ -304,7 +352,7 @@ impl AllianceService {
     ) -> AppResult<AllianceDiplomacy> {
         let member = AllianceRepository::get_user_alliance(pool, user_id)
             .await?
-            .ok_or_else(|| AppError::BadRequest("You are not in an alliance".into()))?;
+            .ok_or_else(|| AppError::from(ErrorCode::NotInAlliance))?;
 
         // Only leader can set diplomacy
         if member.role != AllianceRole::Leader {
@@ -313,7 +361,10 @@ impl AllianceService {
 
         // Cannot set diplomacy with own alliance
         if member.alliance_id == target_alliance_id {
-            return Err(AppError::BadRequest("Cannot set diplomacy with your own alliance".into()));
+            return Err(AppError::Game(
+                ErrorCode::SelfTarget,
+                "Cannot set diplomacy with your own alliance".into(),
+            ));
         }
 
         // Check target alliance exists
@@ -329,8 +380,235 @@ impl AllianceService {
         AllianceRepository::list_diplomacy(pool, alliance_id).await
     }
 
+    // ==================== Merges ====================
+
+    /// Invite a whole alliance to merge into this one (leader only). The
+    /// other leader accepts, then each of their members confirms on their
+    /// own.
+    pub async fn propose_merge(
+        pool: &PgPool,
+        user_id: Uuid,
+        alliance_id: Uuid,
+        target_alliance_id: Uuid,
+    ) -> AppResult<AllianceMerge> {
+        Self::check_permission(pool, alliance_id, user_id, &[AllianceRole::Leader]).await?;
+
+        if alliance_id == target_alliance_id {
+            return Err(AppError::Game(
+                ErrorCode::SelfTarget,
+                "Cannot merge an alliance with itself".into(),
+            ));
+        }
+
+        let alliance = AllianceRepository::find_by_id(pool, alliance_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Alliance not found".into()))?;
+        let target = AllianceRepository::find_by_id(pool, target_alliance_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Target alliance not found".into()))?;
+
+        let now = clock::now();
+        let own = AllianceRepository::find_merges_for(pool, alliance_id).await?;
+        if own.iter().any(|m| m.is_open(now) && m.merging_alliance_id == Some(alliance_id)) {
+            return Err(AppError::Conflict("This alliance is merging into another".into()));
+        }
+        let theirs = AllianceRepository::find_merges_for(pool, target_alliance_id).await?;
+        if theirs.iter().any(|m| m.is_open(now)) {
+            return Err(AppError::Conflict("That alliance already has a merge open".into()));
+        }
+
+        let incoming = AllianceRepository::get_member_count(pool, target_alliance_id).await?;
+        Self::check_room(pool, &alliance, incoming).await?;
+
+        let merge = AllianceRepository::create_merge(
+            pool,
+            alliance_id,
+            &target,
+            user_id,
+            now + Duration::days(MERGE_EXPIRY_DAYS),
+        )
+        .await?;
+
+        info!("Alliance {} proposed absorbing alliance {}", alliance_id, target_alliance_id);
+        Ok(merge)
+    }
+
+    /// The merging alliance's leader accepts or turns down a proposal.
+    /// Accepting sends every member an invitation of their own.
+    pub async fn respond_merge(
+        pool: &PgPool,
+        user_id: Uuid,
+        merge_id: Uuid,
+        accept: bool,
+    ) -> AppResult<AllianceMerge> {
+        let merge = AllianceRepository::find_merge(pool, merge_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Merge not found".into()))?;
+        let merging_id = merge
+            .merging_alliance_id
+            .ok_or_else(|| {
+                AppError::Game(
+                    ErrorCode::MergeClosed,
+                    "The merging alliance no longer exists".into(),
+                )
+            })?;
+
+        Self::check_permission(pool, merging_id, user_id, &[AllianceRole::Leader]).await?;
+
+        let now = clock::now();
+        if merge.status != MergeStatus::Pending || !merge.is_open(now) {
+            return Err(ErrorCode::MergeClosed.into());
+        }
+
+        let (status, expires_at) = if accept {
+            (MergeStatus::Accepted, now + Duration::days(MERGE_EXPIRY_DAYS))
+        } else {
+            (MergeStatus::Rejected, merge.expires_at)
+        };
+        let merge = AllianceRepository::respond_merge(pool, merge_id, status, expires_at)
+            .await?
+            .ok_or_else(|| AppError::Conflict("This merge was answered already".into()))?;
+
+        if accept {
+            for member in AllianceRepository::find_members(pool, merging_id).await? {
+                AllianceRepository::create_merge_invitation(
+                    pool,
+                    &merge,
+                    merge.proposed_by,
+                    member.user_id,
+                )
+                .await?;
+            }
+        }
+
+        Ok(merge)
+    }
+
+    /// Call off an open merge (leader of the receiving alliance only).
+    /// Members who already moved stay where they are.
+    pub async fn cancel_merge(pool: &PgPool, user_id: Uuid, merge_id: Uuid) -> AppResult<()> {
+        let merge = AllianceRepository::find_merge(pool, merge_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Merge not found".into()))?;
+
+        Self::check_permission(pool, merge.alliance_id, user_id, &[AllianceRole::Leader]).await?;
+
+        if !AllianceRepository::close_merge(pool, merge_id, MergeStatus::Cancelled).await? {
+            return Err(ErrorCode::MergeClosed.into());
+        }
+        AllianceRepository::expire_merge_invitations(pool, merge_id).await?;
+
+        Ok(())
+    }
+
+    /// Merges the alliance is on either side of
+    pub async fn list_merges(pool: &PgPool, alliance_id: Uuid) -> AppResult<Vec<AllianceMerge>> {
+        AllianceRepository::find_merges_for(pool, alliance_id).await
+    }
+
+    /// Move a member of the merging alliance over. The old leader hands
+    /// leadership down if others remain, and the last member out folds
+    /// the old alliance into the new one.
+    async fn accept_merge_invitation(
+        pool: &PgPool,
+        user_id: Uuid,
+        invitation: &AllianceInvitation,
+        merge_id: Uuid,
+    ) -> AppResult<()> {
+        let merge = AllianceRepository::find_merge(pool, merge_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Merge not found".into()))?;
+
+        if merge.status != MergeStatus::Accepted || !merge.is_open(clock::now()) {
+            AllianceRepository::update_invitation_status(
+                pool,
+                invitation.id,
+                InvitationStatus::Expired,
+            )
+            .await?;
+            return Err(ErrorCode::MergeClosed.into());
+        }
+
+        let member = AllianceRepository::get_user_alliance(pool, user_id)
+            .await?
+            .filter(|m| Some(m.alliance_id) == merge.merging_alliance_id)
+            .ok_or_else(|| {
+                AppError::Game(
+                    ErrorCode::NotInAlliance,
+                    "You are no longer in the merging alliance".into(),
+                )
+            })?;
+        let old_alliance_id = member.alliance_id;
+
+        let alliance = AllianceRepository::find_by_id(pool, merge.alliance_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Alliance not found".into()))?;
+        Self::check_room(pool, &alliance, 1).await?;
+
+        // The former leader keeps some standing; everyone else starts as a member
+        let role = if member.role == AllianceRole::Leader {
+            let successor = AllianceRepository::find_members(pool, old_alliance_id)
+                .await?
+                .into_iter()
+                .find(|m| m.user_id != user_id);
+            if let Some(successor) = successor {
+                AllianceRepository::transfer_leadership(pool, old_alliance_id, successor.user_id)
+                    .await?;
+                AllianceRepository::update_member_role(
+                    pool,
+                    old_alliance_id,
+                    successor.user_id,
+                    AllianceRole::Leader,
+                )
+                .await?;
+            }
+            AllianceRole::Officer
+        } else {
+            AllianceRole::Member
+        };
+
+        AllianceRepository::move_member(pool, old_alliance_id, alliance.id, user_id, role).await?;
+        AllianceRepository::update_invitation_status(
+            pool,
+            invitation.id,
+            InvitationStatus::Accepted,
+        )
+        .await?;
+
+        if AllianceRepository::get_member_count(pool, old_alliance_id).await? == 0 {
+            AllianceRepository::absorb(pool, alliance.id, old_alliance_id).await?;
+            AllianceRepository::close_merge(pool, merge.id, MergeStatus::Completed).await?;
+            info!("Alliance {} merged into alliance {}", old_alliance_id, alliance.id);
+        }
+
+        Ok(())
+    }
+
     // ==================== Helpers ====================
 
+    /// Members the alliance can hold with its leader's embassy
+    async fn capacity(pool: &PgPool, alliance: &Alliance) -> AppResult<i32> {
+        let embassy =
+            BuildingRepository::max_level_for_user(pool, alliance.leader_id, BuildingType::Embassy)
+                .await?;
+        Ok(member_capacity(embassy, alliance.max_members))
+    }
+
+    async fn check_room(pool: &PgPool, alliance: &Alliance, joining: i32) -> AppResult<()> {
+        let capacity = Self::capacity(pool, alliance).await?;
+        let members = AllianceRepository::get_member_count(pool, alliance.id).await?;
+        if members + joining > capacity {
+            return Err(AppError::Game(
+                ErrorCode::AllianceFull,
+                format!(
+                    "Alliance is full ({} of {} members); the leader's embassy sets the limit",
+                    members, capacity
+                ),
+            ));
+        }
+        Ok(())
+    }
+
     async fn check_permission(
         pool: &PgPool,
         alliance_id: Uuid,
@@ -0,0 +1,323 @@
+use chrono::NaiveDate;
+use serde_json::json;
+use sqlx::PgPool;
+use tracing::{error, info};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::alliance::{
+    week_start, AllianceAward, AllianceStatsQuery, AllianceStatsResponse, AwardCategory,
+    DiplomacyStatus, MemberContribution,
+};
+use crate::models::army::ArmyTroops;
+use crate::models::template::{TemplateKey, DEFAULT_LOCALE};
+use crate::models::troop::TroopDefinition;
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::message_repo::MessageRepository;
+use crate::services::clock;
+use crate::services::template_service::TemplateService;
+
+/// Weekly tally of what members did for their alliance, and the awards
+/// handed out once each week is over
+pub struct AllianceStatsService;
+
+impl AllianceStatsService {
+    /// Upkeep of the troops lost, the measure of how much a fight was worth
+    pub fn points_for(losses: &ArmyTroops, definitions: &[TroopDefinition]) -> i64 {
+        losses
+            .iter()
+            .filter_map(|(troop_type, count)| {
+                definitions
+                    .iter()
+                    .find(|d| d.troop_type == *troop_type)
+                    .map(|d| d.crop_consumption as i64 * *count as i64)
+            })
+            .sum()
+    }
+
+    // ==================== Recording ====================
+    //
+    // Called once the fight or delivery has happened. A failed write is
+    // logged rather than failing it.
+
+    /// Troops stationed in a village of the same or an allied alliance
+    /// killed attackers worth `points`
+    pub async fn record_defense(pool: &PgPool, defender_id: Uuid, owner_id: Uuid, points: i64) {
+        if points <= 0 || defender_id == owner_id {
+            return;
+        }
+        let result = async {
+            let Some(alliance_id) = Self::alliance_of(pool, defender_id).await? else {
+                return Ok(());
+            };
+            let Some(owner_alliance_id) = Self::alliance_of(pool, owner_id).await? else {
+                return Ok(());
+            };
+            if !Self::allied(pool, alliance_id, owner_alliance_id).await? {
+                return Ok(());
+            }
+            Self::add(pool, alliance_id, defender_id, points, 0, 0, 0).await
+        }
+        .await;
+
+        if let Err(e) = result {
+            error!(
+                "Failed to record defense points for {}: {:?}",
+                defender_id, e
+            );
+        }
+    }
+
+    /// Resources shipped to another member of the same alliance
+    pub async fn record_donation(pool: &PgPool, sender_id: Uuid, receiver_id: Uuid, amount: i64) {
+        if amount <= 0 || sender_id == receiver_id {
+            return;
+        }
+        let result = async {
+            let Some(alliance_id) = Self::alliance_of(pool, sender_id).await? else {
+                return Ok(());
+            };
+            if Self::alliance_of(pool, receiver_id).await? != Some(alliance_id) {
+                return Ok(());
+            }
+            Self::add(pool, alliance_id, sender_id, 0, amount, 0, 0).await
+        }
+        .await;
+
+        if let Err(e) = result {
+            error!("Failed to record donation from {}: {:?}", sender_id, e);
+        }
+    }
+
+    /// An attack on a player whose alliance the attacker's alliance has
+    /// declared war on, killing defenders worth `points`
+    pub async fn record_war_attack(
+        pool: &PgPool,
+        attacker_id: Uuid,
+        defender_id: Uuid,
+        points: i64,
+    ) {
+        let result = async {
+            let Some(alliance_id) = Self::alliance_of(pool, attacker_id).await? else {
+                return Ok(());
+            };
+            let Some(enemy_id) = Self::alliance_of(pool, defender_id).await? else {
+                return Ok(());
+            };
+            let at_war = AllianceRepository::get_diplomacy(pool, alliance_id, enemy_id)
+                .await?
+                .is_some_and(|d| d.status == DiplomacyStatus::Enemy);
+            if !at_war {
+                return Ok(());
+            }
+            Self::add(pool, alliance_id, attacker_id, 0, 0, 1, points.max(0)).await
+        }
+        .await;
+
+        if let Err(e) = result {
+            error!("Failed to record war attack by {}: {:?}", attacker_id, e);
+        }
+    }
+
+    // ==================== Queries ====================
+
+    /// Contributions for a week, with its awards if it is over. Members only.
+    pub async fn stats(
+        pool: &PgPool,
+        user_id: Uuid,
+        alliance_id: Uuid,
+        query: AllianceStatsQuery,
+    ) -> AppResult<AllianceStatsResponse> {
+        Self::check_member(pool, alliance_id, user_id).await?;
+
+        let week = week_start(query.week.unwrap_or_else(|| clock::now().date_naive()));
+
+        let mut contributions =
+            AllianceRepository::find_contributions(pool, alliance_id, week).await?;
+        contributions.sort_by(|a, b| b.mvp_score().cmp(&a.mvp_score()));
+
+        let awards = AllianceRepository::find_awards(pool, alliance_id, Some(week)).await?;
+
+        Ok(AllianceStatsResponse {
+            alliance_id,
+            week_start: week,
+            contributions,
+            awards,
+        })
+    }
+
+    /// Every award the alliance has given, newest week first. Members only.
+    pub async fn awards(
+        pool: &PgPool,
+        user_id: Uuid,
+        alliance_id: Uuid,
+    ) -> AppResult<Vec<AllianceAward>> {
+        Self::check_member(pool, alliance_id, user_id).await?;
+        AllianceRepository::find_awards(pool, alliance_id, None).await
+    }
+
+    // ==================== Weekly Awards ====================
+
+    /// Give out awards for every finished week that has none yet and post
+    /// the winners to alliance chat. Returns how many weeks were awarded.
+    pub async fn award_finished_weeks(pool: &PgPool) -> AppResult<i32> {
+        let weeks =
+            AllianceRepository::find_unawarded_weeks(pool, week_start(clock::now().date_naive()))
+                .await?;
+        let mut awarded = 0;
+
+        for (alliance_id, week) in weeks {
+            match Self::award_week(pool, alliance_id, week).await {
+                Ok(true) => awarded += 1,
+                Ok(false) => {}
+                Err(e) => error!(
+                    "Failed to award week {} for alliance {}: {:?}",
+                    week, alliance_id, e
+                ),
+            }
+        }
+
+        Ok(awarded)
+    }
+
+    async fn award_week(pool: &PgPool, alliance_id: Uuid, week: NaiveDate) -> AppResult<bool> {
+        let contributions = AllianceRepository::find_contributions(pool, alliance_id, week).await?;
+
+        let mut winners = Vec::new();
+        for category in AwardCategory::ALL {
+            let Some(winner) = best(&contributions, category) else {
+                continue;
+            };
+            let score = winner.score(category);
+            if AllianceRepository::create_award(
+                pool,
+                alliance_id,
+                week,
+                category,
+                winner.user_id,
+                score,
+            )
+            .await?
+            {
+                winners.push((category, winner));
+            }
+        }
+
+        // Another run got here first
+        if winners.is_empty() {
+            return Ok(false);
+        }
+
+        Self::announce(pool, alliance_id, week, &winners).await?;
+        info!("Awarded week {} for alliance {}", week, alliance_id);
+        Ok(true)
+    }
+
+    /// Post the winners to alliance chat. Alliance messages need a sender,
+    /// so it goes out in the leader's name.
+    async fn announce(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        week: NaiveDate,
+        winners: &[(AwardCategory, &MemberContribution)],
+    ) -> AppResult<()> {
+        let Some(alliance) = AllianceRepository::find_by_id(pool, alliance_id).await? else {
+            return Ok(());
+        };
+
+        // Every member reads the same message, so it is in the default locale
+        let awards: Vec<_> = winners
+            .iter()
+            .map(|(category, winner)| {
+                json!({
+                    "category": category,
+                    "player_name": winner.player_name,
+                    "score": winner.score(*category),
+                    "attacks": winner.war_attacks,
+                })
+            })
+            .collect();
+        let message = TemplateService::render(
+            pool,
+            TemplateKey::AllianceAwardsMessage,
+            DEFAULT_LOCALE,
+            &json!({ "week_start": week, "awards": awards }),
+        )
+        .await?;
+
+        MessageRepository::create_alliance_message(
+            pool,
+            alliance.leader_id,
+            alliance_id,
+            &message.subject,
+            message.body.trim_end(),
+        )
+        .await?;
+        Ok(())
+    }
+
+    // ==================== Helpers ====================
+
+    async fn alliance_of(pool: &PgPool, user_id: Uuid) -> AppResult<Option<Uuid>> {
+        Ok(AllianceRepository::get_user_alliance(pool, user_id)
+            .await?
+            .map(|m| m.alliance_id))
+    }
+
+    /// Same alliance, or one this alliance lists as an ally
+    async fn allied(pool: &PgPool, alliance_id: Uuid, other_id: Uuid) -> AppResult<bool> {
+        if alliance_id == other_id {
+            return Ok(true);
+        }
+        Ok(
+            AllianceRepository::get_diplomacy(pool, alliance_id, other_id)
+                .await?
+                .is_some_and(|d| d.status == DiplomacyStatus::Ally),
+        )
+    }
+
+    async fn add(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        user_id: Uuid,
+        defense_points: i64,
+        resources_donated: i64,
+        war_attacks: i32,
+        war_points: i64,
+    ) -> AppResult<()> {
+        AllianceRepository::add_contribution(
+            pool,
+            alliance_id,
+            user_id,
+            week_start(clock::now().date_naive()),
+            defense_points,
+            resources_donated,
+            war_attacks,
+            war_points,
+        )
+        .await
+    }
+
+    async fn check_member(pool: &PgPool, alliance_id: Uuid, user_id: Uuid) -> AppResult<()> {
+        if AllianceRepository::get_member(pool, alliance_id, user_id)
+            .await?
+            .is_none()
+        {
+            return Err(AppError::Forbidden(
+                "You are not a member of this alliance".into(),
+            ));
+        }
+        Ok(())
+    }
+}
+
+/// Top scorer in the category, if anyone scored at all
+fn best(
+    contributions: &[MemberContribution],
+    category: AwardCategory,
+) -> Option<&MemberContribution> {
+    contributions
+        .iter()
+        .filter(|c| c.score(category) > 0)
+        .max_by_key(|c| c.score(category))
+}
@@ -0,0 +1,190 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::world_setting::{
+    AntiPushingSettings, PushingPair, UpdateAntiPushingRequest, ANTI_PUSHING_KEY,
+};
+use crate::repositories::market_repo::MarketRepository;
+use crate::repositories::projection_repo::ProjectionRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+
+/// Limits on resources flowing one way from a weak account to a strong one
+pub struct AntiPushingService;
+
+impl AntiPushingService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<AntiPushingSettings> {
+        let key = CacheKey::WorldSetting(ANTI_PUSHING_KEY.to_string());
+        let stored =
+            CacheService::get_or_load(key, || WorldSettingRepository::get(pool, ANTI_PUSHING_KEY))
+                .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid anti_pushing setting, using defaults: {}", e);
+                AntiPushingSettings::default()
+            }),
+            None => AntiPushingSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateAntiPushingRequest,
+    ) -> AppResult<AntiPushingSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(enabled) = request.enabled {
+            settings.enabled = enabled;
+        }
+        if let Some(hours) = request.window_hours {
+            settings.window_hours = hours;
+        }
+        if let Some(ratio) = request.rank_ratio {
+            settings.rank_ratio = ratio;
+        }
+        if let Some(max) = request.max_net_transfer {
+            settings.max_net_transfer = max;
+        }
+        if let Some(percent) = request.near_limit_percent {
+            settings.near_limit_percent = percent;
+        }
+
+        if settings.window_hours < 1 {
+            return Err(AppError::BadRequest(
+                "window_hours must be at least 1".into(),
+            ));
+        }
+        if settings.rank_ratio < 1 {
+            return Err(AppError::BadRequest("rank_ratio must be at least 1".into()));
+        }
+        if settings.max_net_transfer < 0 {
+            return Err(AppError::BadRequest(
+                "max_net_transfer cannot be negative".into(),
+            ));
+        }
+        if !(1..=100).contains(&settings.near_limit_percent) {
+            return Err(AppError::BadRequest(
+                "near_limit_percent must be between 1 and 100".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, ANTI_PUSHING_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(ANTI_PUSHING_KEY.to_string())]).await;
+
+        info!(
+            "Anti-pushing limits updated by {}: {:?}",
+            admin_id, settings
+        );
+
+        Ok(settings)
+    }
+
+    // ==================== Enforcement ====================
+
+    /// Refuse a shipment of `amount` resources that would take the pair's
+    /// one-way flow past the limit
+    pub async fn check_transfer(
+        pool: &PgPool,
+        sender_id: Uuid,
+        receiver_id: Uuid,
+        amount: i64,
+    ) -> AppResult<()> {
+        let settings = Self::get_settings(pool).await?;
+        if !settings.enabled || sender_id == receiver_id {
+            return Ok(());
+        }
+
+        let (sender_rank, receiver_rank) = Self::ranks(pool, sender_id, receiver_id).await?;
+        if !limited(&settings, sender_rank, receiver_rank) {
+            return Ok(());
+        }
+
+        let since = clock::now() - Duration::hours(settings.window_hours as i64);
+        let net = MarketRepository::net_flow(pool, sender_id, receiver_id, since).await?;
+        if net + amount > settings.max_net_transfer {
+            let remaining = (settings.max_net_transfer - net).max(0);
+            info!(
+                "Blocked shipment of {} from {} (rank {}) to {} (rank {}): {} of {} already sent",
+                amount,
+                sender_id,
+                sender_rank,
+                receiver_id,
+                receiver_rank,
+                net,
+                settings.max_net_transfer
+            );
+            return Err(AppError::BadRequest(format!(
+                "Transfer limit reached: this player can receive at most {} more resources \
+                 from you within {} hours ({} of {} already sent)",
+                remaining, settings.window_hours, net, settings.max_net_transfer
+            )));
+        }
+
+        Ok(())
+    }
+
+    // ==================== Report ====================
+
+    /// Limited pairs whose net flow in the window is near or over the limit
+    pub async fn report(pool: &PgPool) -> AppResult<Vec<PushingPair>> {
+        let settings = Self::get_settings(pool).await?;
+        let since = clock::now() - Duration::hours(settings.window_hours as i64);
+        let threshold = settings.max_net_transfer * settings.near_limit_percent as i64 / 100;
+
+        let flows = MarketRepository::list_flows(pool, since, threshold).await?;
+
+        let mut pairs = Vec::new();
+        for (sender_id, receiver_id, sent, returned) in flows {
+            let (sender_rank, receiver_rank) = Self::ranks(pool, sender_id, receiver_id).await?;
+            if !limited(&settings, sender_rank, receiver_rank) {
+                continue;
+            }
+
+            let net = sent - returned;
+            pairs.push(PushingPair {
+                sender_id,
+                sender_name: Self::name(pool, sender_id).await?,
+                sender_rank,
+                receiver_id,
+                receiver_name: Self::name(pool, receiver_id).await?,
+                receiver_rank,
+                sent,
+                returned,
+                net,
+                limit: settings.max_net_transfer,
+                percent_of_limit: net * 100 / settings.max_net_transfer.max(1),
+            });
+        }
+
+        Ok(pairs)
+    }
+
+    async fn ranks(pool: &PgPool, sender_id: Uuid, receiver_id: Uuid) -> AppResult<(i64, i64)> {
+        Ok((
+            ProjectionRepository::player_rank(pool, sender_id).await?,
+            ProjectionRepository::player_rank(pool, receiver_id).await?,
+        ))
+    }
+
+    async fn name(pool: &PgPool, user_id: Uuid) -> AppResult<Option<String>> {
+        Ok(UserRepository::find_by_id(pool, user_id)
+            .await?
+            .and_then(|u| u.display_name))
+    }
+}
+
+/// Whether the limit applies: the sender ranks far enough below the receiver
+fn limited(settings: &AntiPushingSettings, sender_rank: i64, receiver_rank: i64) -> bool {
+    sender_rank >= receiver_rank * settings.rank_ratio as i64
+}
@@ -0,0 +1,85 @@
+use chrono::Duration;
+use rand::RngCore;
+use sha2::{Digest, Sha256};
+use sqlx::PgPool;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::api_key::{ApiKey, CreateApiKeyRequest, CreatedApiKey};
+use crate::repositories::api_key_repo::ApiKeyRepository;
+use crate::services::clock;
+
+/// Marks the string as one of our keys, so leaked keys are easy to scan for
+const KEY_PREFIX: &str = "thk_";
+/// Characters of the key kept in clear to tell keys apart
+const SHOWN_PREFIX_LEN: usize = 10;
+/// last_used_at is only rewritten when older than this, not on every request
+const TOUCH_INTERVAL_SECS: i64 = 60;
+
+pub struct ApiKeyService;
+
+impl ApiKeyService {
+    pub async fn create(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: CreateApiKeyRequest,
+    ) -> AppResult<CreatedApiKey> {
+        let name = request.name.trim();
+        if name.is_empty() || name.chars().count() > 100 {
+            return Err(AppError::BadRequest(
+                "Name must be between 1 and 100 characters".into(),
+            ));
+        }
+
+        let mut bytes = [0u8; 24];
+        rand::thread_rng().fill_bytes(&mut bytes);
+        let key = format!("{}{}", KEY_PREFIX, hex::encode(bytes));
+
+        let api_key =
+            ApiKeyRepository::create(pool, name, &hash(&key), &key[..SHOWN_PREFIX_LEN], admin_id)
+                .await?;
+
+        info!(
+            "API key {} ({}) created by {}",
+            api_key.id, api_key.name, admin_id
+        );
+
+        Ok(CreatedApiKey { key, api_key })
+    }
+
+    /// The active key matching `key`, if any
+    pub async fn authenticate(pool: &PgPool, key: &str) -> AppResult<Option<ApiKey>> {
+        let Some(api_key) = ApiKeyRepository::find_active_by_hash(pool, &hash(key)).await? else {
+            return Ok(None);
+        };
+
+        let now = clock::now();
+        let stale = api_key
+            .last_used_at
+            .map_or(true, |at| now - at > Duration::seconds(TOUCH_INTERVAL_SECS));
+        if stale {
+            ApiKeyRepository::touch(pool, api_key.id, now).await?;
+        }
+
+        Ok(Some(api_key))
+    }
+
+    pub async fn list(pool: &PgPool) -> AppResult<Vec<ApiKey>> {
+        ApiKeyRepository::list(pool).await
+    }
+
+    pub async fn revoke(pool: &PgPool, admin_id: Uuid, id: Uuid) -> AppResult<()> {
+        if !ApiKeyRepository::revoke(pool, id, clock::now()).await? {
+            return Err(AppError::NotFound("API key not found".into()));
+        }
+
+        info!("API key {} revoked by {}", id, admin_id);
+
+        Ok(())
+    }
+}
+
+fn hash(key: &str) -> String {
+    hex::encode(Sha256::digest(key.as_bytes()))
+}
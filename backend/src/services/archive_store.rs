@@ -0,0 +1,115 @@
+use anyhow::{bail, Context, Result};
+use reqwest::Client;
+use std::path::PathBuf;
+
+use crate::config::ArchiveConfig;
+
+/// Destination for archived data: a local directory or an S3/GCS-compatible bucket
+#[derive(Clone)]
+pub enum ArchiveStore {
+    /// `file:///var/lib/travillian/archive`
+    Filesystem(PathBuf),
+    /// `https://storage.googleapis.com/my-bucket`, objects are PUT under this prefix
+    Http {
+        client: Client,
+        base_url: String,
+        token: Option<String>,
+    },
+}
+
+impl ArchiveStore {
+    /// Build the store from config, or `None` when archiving isn't configured
+    pub fn from_config(config: &ArchiveConfig) -> Result<Option<Self>> {
+        let Some(url) = config.storage_url.as_deref().filter(|u| !u.is_empty()) else {
+            return Ok(None);
+        };
+
+        if let Some(path) = url.strip_prefix("file://") {
+            return Ok(Some(Self::Filesystem(PathBuf::from(path))));
+        }
+
+        if url.starts_with("http://") || url.starts_with("https://") {
+            return Ok(Some(Self::Http {
+                client: Client::new(),
+                base_url: url.trim_end_matches('/').to_string(),
+                token: config.storage_token.clone(),
+            }));
+        }
+
+        bail!("Unsupported ARCHIVE_STORAGE_URL scheme: {}", url)
+    }
+
+    /// Write an object under `key` (e.g. `battle_reports/2025/01/<id>.jsonl`)
+    pub async fn put(&self, key: &str, body: Vec<u8>, content_type: &str) -> Result<()> {
+        match self {
+            Self::Filesystem(root) => {
+                let path = root.join(key);
+                if let Some(parent) = path.parent() {
+                    tokio::fs::create_dir_all(parent)
+                        .await
+                        .with_context(|| format!("Failed to create {}", parent.display()))?;
+                }
+                tokio::fs::write(&path, body)
+                    .await
+                    .with_context(|| format!("Failed to write {}", path.display()))?;
+            }
+            Self::Http {
+                client,
+                base_url,
+                token,
+            } => {
+                let mut request = client
+                    .put(format!("{}/{}", base_url, key))
+                    .header("Content-Type", content_type)
+                    .body(body);
+                if let Some(token) = token {
+                    request = request.bearer_auth(token);
+                }
+
+                let response = request.send().await.context("Archive upload failed")?;
+                if !response.status().is_success() {
+                    bail!(
+                        "Archive upload of {} failed with status {}",
+                        key,
+                        response.status()
+                    );
+                }
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Read back an object written with `put`
+    pub async fn get(&self, key: &str) -> Result<Vec<u8>> {
+        match self {
+            Self::Filesystem(root) => {
+                let path = root.join(key);
+                tokio::fs::read(&path)
+                    .await
+                    .with_context(|| format!("Failed to read {}", path.display()))
+            }
+            Self::Http {
+                client,
+                base_url,
+                token,
+            } => {
+                let mut request = client.get(format!("{}/{}", base_url, key));
+                if let Some(token) = token {
+                    request = request.bearer_auth(token);
+                }
+
+                let response = request.send().await.context("Archive download failed")?;
+                if !response.status().is_success() {
+                    bail!(
+                        "Archive download of {} failed with status {}",
+                        key,
+                        response.status()
+                    );
+                }
+                let body = response.bytes().await.context("Archive download failed")?;
+                Ok(body.to_vec())
+            }
+        }
+    }
+}
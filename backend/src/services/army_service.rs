@@ -1,29 +1,44 @@
-use chrono::{Duration, Utc};
-use sqlx::PgPool;
-use tracing::{error, info};
+use async_trait::async_trait;
+use chrono::{DateTime, Duration, Utc};
+use sqlx::{PgPool, Postgres, Transaction};
+use tracing::{error, info, warn};
 use uuid::Uuid;
 
-use crate::error::{AppError, AppResult};
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::models::alliance::DiplomacyStatus;
 use crate::models::army::{
-    Army, ArmyResponse, ArmyTroops, BattleReport, CarriedResources, MissionType, ScoutReport,
-    SendArmyRequest,
+    Army, ArmyPlanResponse, ArmyResponse, ArmyTroops, ArmyWarning, ArmyWarningResponse,
+    BattleReport, CarriedResources, MissionType, MovementDirection, PlanArmyRequest,
+    MergeStationedResponse, PrepareArmyResponse, PreparedTarget, RallyPointCounts,
+    RallyPointMovement, RallyPointQuery, RallyPointResponse, ScoutReport, SendArmyRequest,
+    TransferTroopsRequest, CANCEL_GRACE_SECS, TOURNAMENT_SQUARE_DISTANCE, TRANSFER_COST_PERCENT,
 };
+use crate::models::building::BuildingType;
+use crate::models::hero::HeroStatus;
+use crate::models::job_failure::ARMY_ARRIVAL_JOB;
 use crate::models::troop::TroopDefinition;
 use crate::models::village::Village;
+use crate::repositories::alliance_repo::AllianceRepository;
 use crate::repositories::army_repo::ArmyRepository;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::defense_call_repo::DefenseCallRepository;
+use crate::repositories::hero_repo::HeroRepository;
+use crate::repositories::oasis_repo::OasisRepository;
 use crate::repositories::troop_repo::TroopRepository;
+use crate::repositories::user_repo::UserRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::alliance_stats_service::AllianceStatsService;
+use crate::services::clock::{self, Clock};
+use crate::services::combat::{self, BattleResult};
+use crate::services::economy_service::EconomyService;
+use crate::services::hero_service::HeroService;
+use crate::services::hospital_service::HospitalService;
+use crate::services::job_failure_service::JobFailureService;
+use crate::services::oasis_service::OasisService;
+use crate::services::tribe_service::TribeService;
+use crate::services::village_service::VillageService;
 use crate::services::ws_service::{ArmyArrivedData, WsEvent, WsManager};
 
-/// Internal struct for battle calculation results
-struct BattleResult {
-    attacker_wins: bool,
-    attacker_survivors: ArmyTroops,
-    defender_survivors: ArmyTroops,
-    attacker_losses: ArmyTroops,
-    defender_losses: ArmyTroops,
-}
-
 pub struct ArmyService;
 
 impl ArmyService {
@@ -34,12 +49,86 @@ impl ArmyService {
         from_village_id: Uuid,
         request: SendArmyRequest,
     ) -> AppResult<ArmyResponse> {
+        let (from_village, target_village) =
+            Self::validate_send(pool, player_id, from_village_id, &request).await?;
+        let total_troops: i32 = request.troops.values().sum();
+
+        // Get troop definitions for travel time calculation
+        let definitions = TroopRepository::get_all_definitions(pool).await?;
+
+        // Calculate travel time
+        let distance = Self::calculate_distance(
+            from_village.x,
+            from_village.y,
+            request.to_x,
+            request.to_y,
+        );
+        let speed_bonus = Self::speed_bonus_percent(pool, from_village_id).await?;
+        let travel_duration =
+            Self::calculate_travel_time(distance, &request.troops, &definitions, speed_bonus);
+
+        // Calculate timestamps
+        let now = clock::now();
+        let arrives_at = now + travel_duration;
+        let returns_at = if request.mission.returns() {
+            Some(arrives_at + travel_duration)
+        } else {
+            None
+        };
+
+        // Remove troops from village
+        for (troop_type, count) in &request.troops {
+            if *count > 0 {
+                TroopRepository::remove_troops_from_village(pool, from_village_id, *troop_type, *count)
+                    .await?;
+            }
+        }
+
+        // Create army record
+        let army = ArmyRepository::create(
+            pool,
+            player_id,
+            from_village_id,
+            request.to_x,
+            request.to_y,
+            target_village.as_ref().map(|v| v.id),
+            request.mission,
+            &request.troops,
+            &request.resources,
+            now,
+            arrives_at,
+            returns_at,
+            request.hero_id,
+        )
+        .await?;
+
+        if let Some(hero_id) = request.hero_id {
+            HeroRepository::update_status(pool, hero_id, HeroStatus::Moving).await?;
+        }
+
+        info!(
+            "Army sent from village {} to ({}, {}) with {} troops, arrives at {}",
+            from_village_id, request.to_x, request.to_y, total_troops, arrives_at
+        );
+
+        Ok(army.into())
+    }
+
+    /// Everything that would stop a march from being sent. Returns the
+    /// source village and the village at the target, if any.
+    async fn validate_send(
+        pool: &PgPool,
+        player_id: Uuid,
+        from_village_id: Uuid,
+        request: &SendArmyRequest,
+    ) -> AppResult<(Village, Option<Village>)> {
         // Validate mission type
         if !matches!(
             request.mission,
             MissionType::Raid | MissionType::Attack | MissionType::Scout | MissionType::Support | MissionType::Conquer
         ) {
-            return Err(AppError::BadRequest(
+            return Err(AppError::Game(
+                ErrorCode::UnsupportedMission,
                 "Only Raid, Attack, Scout, Support, and Conquer missions are currently supported".into(),
             ));
         }
@@ -50,7 +139,8 @@ impl ArmyService {
                 *count > 0 && troop_type.is_chief()
             });
             if !has_chief {
-                return Err(AppError::BadRequest(
+                return Err(AppError::Game(
+                    ErrorCode::ChiefRequired,
                     "Conquer mission requires at least one Chief unit (Royal Advisor, Harbor Master, or Elder Chief)".into(),
                 ));
             }
@@ -66,6 +156,31 @@ impl ArmyService {
             return Err(AppError::Forbidden("Access denied".into()));
         }
 
+        // A hero can lead raids and attacks from the village it is in
+        if let Some(hero_id) = request.hero_id {
+            if !matches!(request.mission, MissionType::Raid | MissionType::Attack) {
+                return Err(AppError::Game(
+                    ErrorCode::UnsupportedMission,
+                    "Only raids and attacks can be led by a hero".into(),
+                ));
+            }
+            let hero = HeroRepository::find_by_id(pool, hero_id)
+                .await?
+                .ok_or_else(|| AppError::NotFound("Hero not found".into()))?;
+            if hero.user_id != player_id {
+                return Err(AppError::Forbidden("Access denied".into()));
+            }
+            if !hero.is_available() {
+                return Err(ErrorCode::HeroUnavailable.into());
+            }
+            if hero.current_village_id.unwrap_or(hero.home_village_id) != from_village_id {
+                return Err(AppError::Game(
+                    ErrorCode::HeroUnavailable,
+                    "Hero is not in this village".into(),
+                ));
+            }
+        }
+
         // Validate troops are available
         let village_troops = TroopRepository::find_by_village(pool, from_village_id).await?;
         for (troop_type, count) in &request.troops {
@@ -78,17 +193,18 @@ impl ArmyService {
                 .map(|t| t.in_village)
                 .unwrap_or(0);
             if available < *count {
-                return Err(AppError::BadRequest(format!(
-                    "Not enough {:?}: have {}, need {}",
-                    troop_type, available, count
-                )));
+                return Err(AppError::Game(
+                    ErrorCode::InsufficientTroops,
+                    format!(
+                        "Not enough {:?}: have {}, need {}",
+                        troop_type, available, count
+                    ),
+                ));
             }
         }
 
-        // Get total troops being sent
-        let total_troops: i32 = request.troops.values().sum();
-        if total_troops <= 0 {
-            return Err(AppError::BadRequest("Must send at least one troop".into()));
+        if request.troops.values().sum::<i32>() <= 0 {
+            return Err(ErrorCode::NoTroops.into());
         }
 
         // Get target village (if exists)
@@ -97,113 +213,425 @@ impl ArmyService {
         // Can't attack own village (but can support own village)
         if let Some(ref target) = target_village {
             if target.user_id == player_id && request.mission.is_hostile() {
-                return Err(AppError::BadRequest("Cannot attack your own village".into()));
+                return Err(ErrorCode::OwnVillage.into());
+            }
+            if target.is_capital && request.mission == MissionType::Conquer {
+                return Err(AppError::Game(
+                    ErrorCode::TargetProtected,
+                    "A capital can't be conquered".into(),
+                ));
             }
         }
 
         // Support mission requires a target village
         if request.mission == MissionType::Support && target_village.is_none() {
-            return Err(AppError::BadRequest("Support mission requires a target village".into()));
+            return Err(AppError::Game(
+                ErrorCode::TargetNotVillage,
+                "Support mission requires a target village".into(),
+            ));
         }
 
-        // Get troop definitions for travel time calculation
+        Ok((from_village, target_village))
+    }
+
+    /// Distance, travel time and arrival of a march, without sending it
+    pub async fn plan_army(
+        pool: &PgPool,
+        from_village_id: Uuid,
+        request: PlanArmyRequest,
+    ) -> AppResult<ArmyPlanResponse> {
+        if request.troops.values().all(|count| *count <= 0) {
+            return Err(ErrorCode::NoTroops.into());
+        }
+
+        let from_village = VillageRepository::find_by_id(pool, from_village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Source village not found".into()))?;
+
         let definitions = TroopRepository::get_all_definitions(pool).await?;
+        let distance = Self::calculate_distance(
+            from_village.x,
+            from_village.y,
+            request.to_x,
+            request.to_y,
+        );
+        let level = Self::tournament_square_level(pool, from_village_id).await?;
+        let speed_bonus = BuildingType::TournamentSquare.speed_bonus_percent(level);
+        let travel_duration =
+            Self::calculate_travel_time(distance, &request.troops, &definitions, speed_bonus);
 
-        // Calculate travel time
+        let arrives_at = clock::now() + travel_duration;
+        let returns_at = if request.mission.returns() {
+            Some(arrives_at + travel_duration)
+        } else {
+            None
+        };
+
+        Ok(ArmyPlanResponse {
+            distance,
+            slowest_speed: Self::slowest_speed(&request.troops, &definitions),
+            tournament_square_level: level,
+            speed_bonus_percent: speed_bonus,
+            boost_after_distance: TOURNAMENT_SQUARE_DISTANCE,
+            travel_seconds: travel_duration.num_seconds(),
+            arrives_at,
+            returns_at,
+        })
+    }
+
+    /// Everything the confirmation dialog shows, worked out by the same
+    /// rules `send_army` applies. Nothing is sent.
+    pub async fn prepare_army(
+        pool: &PgPool,
+        player_id: Uuid,
+        from_village_id: Uuid,
+        request: SendArmyRequest,
+    ) -> AppResult<PrepareArmyResponse> {
+        let (from_village, target_village) =
+            Self::validate_send(pool, player_id, from_village_id, &request).await?;
+
+        let definitions = TroopRepository::get_all_definitions(pool).await?;
         let distance = Self::calculate_distance(
             from_village.x,
             from_village.y,
             request.to_x,
             request.to_y,
         );
-        let travel_duration = Self::calculate_travel_time(distance, &request.troops, &definitions);
+        let speed_bonus = Self::speed_bonus_percent(pool, from_village_id).await?;
+        let travel_duration =
+            Self::calculate_travel_time(distance, &request.troops, &definitions, speed_bonus);
 
-        // Calculate timestamps
-        let now = Utc::now();
-        let arrives_at = now + travel_duration;
+        let arrives_at = clock::now() + travel_duration;
         let returns_at = if request.mission.returns() {
             Some(arrives_at + travel_duration)
         } else {
             None
         };
 
-        // Remove troops from village
-        for (troop_type, count) in &request.troops {
+        let mut target = None;
+        let mut warnings = Vec::new();
+        if let Some(village) = target_village {
+            let owner = UserRepository::find_by_id(pool, village.user_id).await?;
+            let target_alliance =
+                AllianceRepository::get_user_alliance(pool, village.user_id).await?;
+            let alliance_tag = match &target_alliance {
+                Some(member) => AllianceRepository::find_by_id(pool, member.alliance_id)
+                    .await?
+                    .map(|a| a.tag),
+                None => None,
+            };
+
+            if request.mission.is_hostile() && village.user_id != player_id {
+                if let Some(target_member) = target_alliance {
+                    let warning =
+                        Self::alliance_warning(pool, player_id, target_member.alliance_id).await?;
+                    warnings.extend(warning.map(|code| ArmyWarningResponse {
+                        code,
+                        message: code.message(),
+                    }));
+                }
+            }
+
+            target = Some(PreparedTarget {
+                village_id: village.id,
+                village_name: village.name,
+                player_id: village.user_id,
+                player_name: owner.and_then(|u| u.display_name),
+                alliance_tag,
+            });
+        }
+
+        Ok(PrepareArmyResponse {
+            mission: request.mission,
+            distance,
+            travel_seconds: travel_duration.num_seconds(),
+            arrives_at,
+            returns_at,
+            carry_capacity: Self::carry_capacity(&request.troops, &definitions),
+            target,
+            warnings,
+        })
+    }
+
+    /// Why attacking a member of `target_alliance_id` may be unintended
+    async fn alliance_warning(
+        pool: &PgPool,
+        player_id: Uuid,
+        target_alliance_id: Uuid,
+    ) -> AppResult<Option<ArmyWarning>> {
+        let Some(member) = AllianceRepository::get_user_alliance(pool, player_id).await? else {
+            return Ok(None);
+        };
+        if member.alliance_id == target_alliance_id {
+            return Ok(Some(ArmyWarning::OwnAlliance));
+        }
+
+        let diplomacy =
+            AllianceRepository::get_diplomacy(pool, member.alliance_id, target_alliance_id).await?;
+        Ok(match diplomacy.map(|d| d.status) {
+            Some(DiplomacyStatus::Nap) => Some(ArmyWarning::NonAggressionPact),
+            Some(DiplomacyStatus::Ally) => Some(ArmyWarning::Confederation),
+            _ => None,
+        })
+    }
+
+    // ==================== Troop Transfers ====================
+
+    /// Send troops for good to another of the player's villages. They march
+    /// like a reinforcement and the sending village pays part of their
+    /// training cost up front.
+    pub async fn transfer_troops(
+        pool: &PgPool,
+        player_id: Uuid,
+        from_village_id: Uuid,
+        request: TransferTroopsRequest,
+    ) -> AppResult<ArmyResponse> {
+        if request.to_village_id == from_village_id {
+            return Err(AppError::Game(
+                ErrorCode::SameVillage,
+                "The troops are already in this village".into(),
+            ));
+        }
+        let target = VillageRepository::find_by_id(pool, request.to_village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Target village not found".into()))?;
+        if target.user_id != player_id {
+            return Err(AppError::Game(
+                ErrorCode::NotOwnVillage,
+                "Troops can only be transferred to your own villages".into(),
+            ));
+        }
+        Self::check_transferable(&request.troops)?;
+
+        // The same checks as reinforcing the village
+        let send = SendArmyRequest {
+            to_x: target.x,
+            to_y: target.y,
+            mission: MissionType::Support,
+            troops: request.troops,
+            resources: CarriedResources::default(),
+            hero_id: None,
+        };
+        let (from_village, _) = Self::validate_send(pool, player_id, from_village_id, &send).await?;
+
+        let definitions = TroopRepository::get_all_definitions(pool).await?;
+        let cost = Self::transfer_cost(&send.troops, &definitions);
+        Self::pay_transfer(pool, &from_village, &cost).await?;
+
+        let distance = Self::calculate_distance(from_village.x, from_village.y, target.x, target.y);
+        let speed_bonus = Self::speed_bonus_percent(pool, from_village_id).await?;
+        let travel_duration =
+            Self::calculate_travel_time(distance, &send.troops, &definitions, speed_bonus);
+        let now = clock::now();
+        let arrives_at = now + travel_duration;
+
+        for (troop_type, count) in &send.troops {
             if *count > 0 {
-                TroopRepository::remove_troops_from_village(pool, from_village_id, *troop_type, *count)
-                    .await?;
+                TroopRepository::remove_troops_from_village(
+                    pool,
+                    from_village_id,
+                    *troop_type,
+                    *count,
+                )
+                .await?;
             }
         }
 
-        // Create army record
         let army = ArmyRepository::create(
             pool,
             player_id,
             from_village_id,
-            request.to_x,
-            request.to_y,
-            target_village.as_ref().map(|v| v.id),
-            request.mission,
-            &request.troops,
-            &request.resources,
+            target.x,
+            target.y,
+            Some(target.id),
+            MissionType::Transfer,
+            &send.troops,
+            &CarriedResources::default(),
             now,
             arrives_at,
-            returns_at,
+            None,
+            None,
         )
         .await?;
 
         info!(
-            "Army sent from village {} to ({}, {}) with {} troops, arrives at {}",
-            from_village_id, request.to_x, request.to_y, total_troops, arrives_at
+            "Transfer sent from village {} to village {}, arrives at {}",
+            from_village_id, target.id, arrives_at
         );
 
         Ok(army.into())
     }
 
-    /// Process all armies that have arrived at their destination
+    /// Make a reinforcement standing in one of the player's own villages
+    /// part of that village's own troops. The village pays the transfer cost.
+    pub async fn merge_stationed(
+        pool: &PgPool,
+        army_id: Uuid,
+        player_id: Uuid,
+    ) -> AppResult<MergeStationedResponse> {
+        let army = ArmyRepository::find_by_id(pool, army_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Army not found".into()))?;
+        if army.player_id != player_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        if !army.is_stationed {
+            return Err(AppError::Game(
+                ErrorCode::NotStationed,
+                "Only stationed troops can be merged".into(),
+            ));
+        }
+
+        let village = match army.to_village_id {
+            Some(village_id) => VillageRepository::find_by_id(pool, village_id).await?,
+            None => None,
+        }
+        .ok_or_else(|| AppError::NotFound("Village not found".into()))?;
+        if village.user_id != player_id {
+            return Err(AppError::Game(
+                ErrorCode::NotOwnVillage,
+                "Troops can only be merged into your own villages".into(),
+            ));
+        }
+        Self::check_transferable(&army.troops.0)?;
+
+        let definitions = TroopRepository::get_all_definitions(pool).await?;
+        let cost = Self::transfer_cost(&army.troops.0, &definitions);
+        Self::pay_transfer(pool, &village, &cost).await?;
+
+        Self::rehome_troops(pool, army.from_village_id, village.id, &army.troops.0).await?;
+        ArmyRepository::delete(pool, army.id).await?;
+
+        info!(
+            "Stationed army {} merged into village {}",
+            army.id, village.id
+        );
+
+        Ok(MergeStationedResponse {
+            village_id: village.id,
+            troops: army.troops.0,
+            cost,
+        })
+    }
+
+    /// Process all armies that have arrived at their destination, in
+    /// resolution order
     pub async fn process_arrived_armies(pool: &PgPool) -> AppResult<i32> {
-        let arrived = ArmyRepository::find_arrived(pool).await?;
-        let mut processed = 0;
+        Self::resolve_due_arrivals(pool, clock::clock()).await
+    }
 
-        for army in arrived {
-            let result = if army.is_returning {
-                Self::handle_returning_army(pool, &army).await
-            } else {
-                match army.mission {
-                    MissionType::Raid | MissionType::Attack => {
-                        Self::handle_hostile_arrival(pool, &army).await
-                    }
-                    MissionType::Scout => {
-                        Self::handle_scout_arrival(pool, &army).await
-                    }
-                    MissionType::Support => {
-                        Self::handle_support_arrival(pool, &army).await
-                    }
-                    MissionType::Conquer => {
-                        Self::handle_conquer_arrival(pool, &army).await
-                    }
-                    _ => {
-                        // Other mission types not implemented yet
-                        error!("Unhandled mission type: {:?}", army.mission);
-                        continue;
-                    }
-                }
-            };
+    /// Arrivals of `movements` due by `clock`'s time, in resolution order
+    pub async fn due_arrivals(
+        movements: &dyn ArmyMovements,
+        clock: &dyn Clock,
+    ) -> AppResult<Vec<Army>> {
+        let mut arrived = movements.find_arrived(clock.now()).await?;
+        arrived.sort_by_key(Army::resolution_order);
+        Ok(arrived)
+    }
 
-            match result {
-                Ok(_) => processed += 1,
-                Err(e) => {
-                    error!("Failed to process army {}: {:?}", army.id, e);
-                }
+    /// Resolve every arrival of `movements` due by `clock`'s time, in
+    /// resolution order. Returns how many went through.
+    pub async fn resolve_due_arrivals(
+        movements: &dyn ArmyMovements,
+        clock: &dyn Clock,
+    ) -> AppResult<i32> {
+        let mut resolved = 0;
+        for army in Self::due_arrivals(movements, clock).await? {
+            if movements.resolve(&army).await {
+                resolved += 1;
             }
         }
 
-        Ok(processed)
+        Ok(resolved)
+    }
+
+    /// Resolve one arrived army, recording a failure for retry if it
+    /// doesn't go through. Returns whether it was resolved.
+    ///
+    /// Movements landing at the same village are serialized: the target is
+    /// locked, then the army re-read, since a movement resolved just before
+    /// (here or on another worker) may have changed or removed it.
+    pub async fn process_arrival(pool: &PgPool, army: &Army) -> bool {
+        let mut lock = match Self::lock_target(pool, army).await {
+            Ok(lock) => lock,
+            Err(e) => {
+                error!("Failed to lock the target of army {}: {:?}", army.id, e);
+                return false;
+            }
+        };
+
+        let current = match ArmyRepository::find_by_id(pool, army.id).await {
+            Ok(Some(current)) if current.still_due(army) => current,
+            Ok(_) => return false,
+            Err(e) => {
+                error!("Failed to re-read army {}: {:?}", army.id, e);
+                return false;
+            }
+        };
+
+        let handled = JobFailureService::guard(
+            pool,
+            ARMY_ARRIVAL_JOB,
+            current.id,
+            &current,
+            Self::handle_arrival(pool, &current),
+        )
+        .await
+        .is_some();
+
+        if let Err(e) = lock.commit().await {
+            warn!("Failed to release the target lock of army {}: {:?}", army.id, e);
+        }
+        handled
+    }
+
+    /// Lock where the army lands (its home when returning) for the life of
+    /// the returned transaction
+    async fn lock_target(pool: &PgPool, army: &Army) -> AppResult<Transaction<'static, Postgres>> {
+        let target = if army.is_returning {
+            format!("village:{}", army.from_village_id)
+        } else if let Some(village_id) = army.to_village_id {
+            format!("village:{}", village_id)
+        } else {
+            match VillageRepository::find_by_coordinates(pool, army.to_x, army.to_y).await? {
+                Some(village) => format!("village:{}", village.id),
+                None => format!("tile:{}:{}", army.to_x, army.to_y),
+            }
+        };
+
+        let mut tx = pool.begin().await?;
+        ArmyRepository::lock_target(&mut tx, &target).await?;
+        Ok(tx)
     }
 
-    /// Process all armies that have arrived at their destination (with WebSocket notifications)
+    /// Resolve one arrival by mission
+    async fn handle_arrival(pool: &PgPool, army: &Army) -> AppResult<()> {
+        if army.is_returning {
+            return Self::handle_returning_army(pool, army).await;
+        }
+
+        match army.mission {
+            MissionType::Raid | MissionType::Attack => {
+                Self::handle_hostile_arrival(pool, army).await
+            }
+            MissionType::Scout => Self::handle_scout_arrival(pool, army).await,
+            MissionType::Support => Self::handle_support_arrival(pool, army).await,
+            MissionType::Conquer => Self::handle_conquer_arrival(pool, army).await,
+            MissionType::Transfer => Self::handle_transfer_arrival(pool, army).await,
+            // Other mission types not implemented yet; failing quarantines
+            // the army instead of retrying it every run
+            _ => Err(AppError::InternalError(anyhow::anyhow!(
+                "Unhandled mission type: {:?}",
+                army.mission
+            ))),
+        }
+    }
+
+    /// Process all armies that have arrived at their destination (with WebSocket notifications),
+    /// in resolution order
     pub async fn process_arrived_armies_with_ws(pool: &PgPool, ws_manager: &WsManager) -> AppResult<i32> {
-        let arrived = ArmyRepository::find_arrived(pool).await?;
+        let arrived = Self::due_arrivals(pool, clock::clock()).await?;
         let mut processed = 0;
 
         for army in arrived {
@@ -219,61 +647,34 @@ impl ArmyService {
             };
             let target_owner_id = target_village.as_ref().map(|v| v.user_id);
 
-            let result = if army.is_returning {
-                Self::handle_returning_army(pool, &army).await
-            } else {
-                match army.mission {
-                    MissionType::Raid | MissionType::Attack => {
-                        Self::handle_hostile_arrival(pool, &army).await
-                    }
-                    MissionType::Scout => {
-                        Self::handle_scout_arrival(pool, &army).await
-                    }
-                    MissionType::Support => {
-                        Self::handle_support_arrival(pool, &army).await
-                    }
-                    MissionType::Conquer => {
-                        Self::handle_conquer_arrival(pool, &army).await
-                    }
-                    _ => {
-                        error!("Unhandled mission type: {:?}", army.mission);
-                        continue;
-                    }
-                }
-            };
+            if !Self::process_arrival(pool, &army).await {
+                continue;
+            }
+            processed += 1;
 
-            match result {
-                Ok(_) => {
-                    processed += 1;
+            // Send WebSocket notifications
+            let event = WsEvent::ArmyArrived(ArmyArrivedData {
+                army_id: army.id,
+                village_id: if army.is_returning {
+                    army.from_village_id
+                } else {
+                    army.to_village_id.unwrap_or(army.from_village_id)
+                },
+                mission_type: format!("{:?}", army.mission),
+            });
 
-                    // Send WebSocket notifications
-                    let event = WsEvent::ArmyArrived(ArmyArrivedData {
-                        army_id: army.id,
-                        village_id: if army.is_returning {
-                            army.from_village_id
-                        } else {
-                            army.to_village_id.unwrap_or(army.from_village_id)
-                        },
-                        mission_type: format!("{:?}", army.mission),
-                    });
-
-                    // Notify army owner
-                    if let Some(owner_id) = home_owner_id {
-                        ws_manager.send_to_user(owner_id, &event).await;
-                    }
+            // Notify army owner
+            if let Some(owner_id) = home_owner_id {
+                ws_manager.send_to_user(owner_id, &event).await;
+            }
 
-                    // Notify target owner (if different and hostile mission)
-                    if !army.is_returning {
-                        if let Some(target_id) = target_owner_id {
-                            if home_owner_id != Some(target_id) {
-                                ws_manager.send_to_user(target_id, &event).await;
-                            }
-                        }
+            // Notify target owner (if different and hostile mission)
+            if !army.is_returning {
+                if let Some(target_id) = target_owner_id {
+                    if home_owner_id != Some(target_id) {
+                        ws_manager.send_to_user(target_id, &event).await;
                     }
                 }
-                Err(e) => {
-                    error!("Failed to process army {}: {:?}", army.id, e);
-                }
             }
         }
 
@@ -292,8 +693,13 @@ impl ArmyService {
             VillageRepository::find_by_coordinates(pool, army.to_x, army.to_y).await?
         };
 
-        // If no target village, army just returns
+        // No village: fight the animals if it's an oasis, otherwise just return
         let Some(target) = target_village else {
+            if let Some(oasis) =
+                OasisRepository::find_by_coordinates(pool, army.to_x, army.to_y).await?
+            {
+                return OasisService::handle_arrival(pool, army, oasis).await;
+            }
             info!("Army {} arrived at empty tile, returning home", army.id);
             return Self::initiate_return(
                 pool,
@@ -325,11 +731,20 @@ impl ArmyService {
         }
 
         // Calculate battle with combined defense
-        let battle = Self::calculate_battle(
+        let bonus = TribeService::battle_bonus(
+            pool,
+            army.player_id,
+            army.from_village_id,
+            target.user_id,
+            target.id,
+        )
+        .await?;
+        let battle = combat::calculate_battle(
             &army.troops.0,
             &total_defender_troops,
             &definitions,
             army.mission,
+            bonus,
         );
 
         // Apply losses to village's own troops
@@ -340,6 +755,7 @@ impl ArmyService {
             1.0
         };
 
+        let mut own_losses = ArmyTroops::new();
         for (troop_type, total_losses) in &battle.defender_losses {
             // Calculate village's share of losses
             let village_count = village_troops.get(troop_type).copied().unwrap_or(0);
@@ -351,10 +767,14 @@ impl ArmyService {
                 if actual_losses > 0 {
                     TroopRepository::kill_troops(pool, target.id, *troop_type, actual_losses)
                         .await?;
+                    own_losses.insert(*troop_type, actual_losses);
                 }
             }
         }
 
+        // Some of the village's own dead make it to the hospital
+        let defender_wounded = HospitalService::admit(pool, target.id, &own_losses).await?;
+
         // Apply losses to stationed support troops
         for stationed in &stationed_armies {
             let mut stationed_survivors = stationed.troops.0.clone();
@@ -383,6 +803,13 @@ impl ArmyService {
             if had_losses {
                 ArmyRepository::update_stationed_troops(pool, stationed.id, &stationed_survivors)
                     .await?;
+                Self::record_away_losses(
+                    pool,
+                    stationed.from_village_id,
+                    &stationed.troops.0,
+                    &stationed_survivors,
+                )
+                .await?;
             }
         }
 
@@ -426,12 +853,37 @@ impl ArmyService {
             &total_defender_troops,
             &battle.attacker_losses,
             &battle.defender_losses,
+            &defender_wounded,
             &stolen_resources,
             winner,
-            Utc::now(),
+            clock::now(),
         )
         .await?;
 
+        Self::record_alliance_stats(
+            pool,
+            army,
+            &target,
+            &stationed_armies,
+            &total_defender_troops,
+            &battle,
+            &definitions,
+        )
+        .await;
+
+        if stolen_resources.total() > 0 {
+            EconomyService::record_plunder(
+                pool,
+                target.user_id,
+                target.id,
+                army.player_id,
+                army.from_village_id,
+                &stolen_resources,
+                report.id,
+            )
+            .await;
+        }
+
         info!(
             "Battle at ({}, {}): {} wins! Attacker lost {:?}, Defender lost {:?} (including {} support armies)",
             army.to_x, army.to_y, winner,
@@ -453,7 +905,10 @@ impl ArmyService {
             .await?;
         } else {
             // All troops dead or non-returning mission
+            Self::record_away_losses(pool, army.from_village_id, &army.troops.0, &ArmyTroops::new())
+                .await?;
             ArmyRepository::delete(pool, army.id).await?;
+            Self::release_hero(pool, army, false).await?;
         }
 
         Ok(())
@@ -573,7 +1028,7 @@ impl ArmyService {
             success,
             scouted_resources.as_ref(),
             scouted_troops.as_ref(),
-            Utc::now(),
+            clock::now(),
         )
         .await?;
 
@@ -600,25 +1055,87 @@ impl ArmyService {
             .await?;
         } else {
             // All scouts dead
+            Self::record_away_losses(pool, army.from_village_id, &army.troops.0, &ArmyTroops::new())
+                .await?;
             ArmyRepository::delete(pool, army.id).await?;
         }
 
         Ok(())
     }
 
-    /// Handle support mission arrival at target village
-    async fn handle_support_arrival(pool: &PgPool, army: &Army) -> AppResult<()> {
-        // Get target village
-        let target_village = if let Some(village_id) = army.to_village_id {
-            VillageRepository::find_by_id(pool, village_id).await?
-        } else {
-            VillageRepository::find_by_coordinates(pool, army.to_x, army.to_y).await?
+    /// Handle support mission arrival at target village
+    async fn handle_support_arrival(pool: &PgPool, army: &Army) -> AppResult<()> {
+        // Get target village
+        let target_village = if let Some(village_id) = army.to_village_id {
+            VillageRepository::find_by_id(pool, village_id).await?
+        } else {
+            VillageRepository::find_by_coordinates(pool, army.to_x, army.to_y).await?
+        };
+
+        // If no target village exists, troops return home
+        let Some(target) = target_village else {
+            info!(
+                "Support army {} arrived at empty tile ({}, {}), returning home",
+                army.id, army.to_x, army.to_y
+            );
+            return Self::initiate_return(
+                pool,
+                army,
+                army.troops.0.clone(),
+                CarriedResources::default(),
+                None,
+            )
+            .await;
+        };
+
+        // Answers a defense call, if the reinforcement was pledged to one
+        DefenseCallRepository::mark_arrived(pool, army.id, clock::now()).await?;
+
+        // Join a reinforcement already standing there from the same village,
+        // so each home village has one stack per target
+        let existing = ArmyRepository::find_stationed_at_village(pool, target.id)
+            .await?
+            .into_iter()
+            .find(|s| s.from_village_id == army.from_village_id && s.player_id == army.player_id);
+        if let Some(existing) = existing {
+            let mut troops = existing.troops.0.clone();
+            for (troop_type, count) in army.troops.0.iter() {
+                *troops.entry(*troop_type).or_insert(0) += count;
+            }
+            ArmyRepository::update_stationed_troops(pool, existing.id, &troops).await?;
+            ArmyRepository::delete(pool, army.id).await?;
+
+            info!(
+                "Support army {} merged into army {} stationed at ({}, {})",
+                army.id, existing.id, army.to_x, army.to_y
+            );
+            return Ok(());
+        }
+
+        // Mark army as stationed at target village
+        ArmyRepository::set_stationed(pool, army.id).await?;
+
+        info!(
+            "Support army {} is now stationed at ({}, {}) with {} troops",
+            army.id,
+            army.to_x,
+            army.to_y,
+            army.troops.0.values().sum::<i32>()
+        );
+
+        Ok(())
+    }
+
+    /// Transferred troops join the target village's own troops. If the
+    /// village changed hands on the way, they go back.
+    async fn handle_transfer_arrival(pool: &PgPool, army: &Army) -> AppResult<()> {
+        let target = match army.to_village_id {
+            Some(village_id) => VillageRepository::find_by_id(pool, village_id).await?,
+            None => None,
         };
-
-        // If no target village exists, troops return home
-        let Some(_target) = target_village else {
+        let Some(target) = target.filter(|v| v.user_id == army.player_id) else {
             info!(
-                "Support army {} arrived at empty tile ({}, {}), returning home",
+                "Transfer {} arrived at ({}, {}) which is no longer the player's, returning home",
                 army.id, army.to_x, army.to_y
             );
             return Self::initiate_return(
@@ -631,14 +1148,13 @@ impl ArmyService {
             .await;
         };
 
-        // Mark army as stationed at target village
-        ArmyRepository::set_stationed(pool, army.id).await?;
+        Self::rehome_troops(pool, army.from_village_id, target.id, &army.troops.0).await?;
+        ArmyRepository::delete(pool, army.id).await?;
 
         info!(
-            "Support army {} is now stationed at ({}, {}) with {} troops",
+            "Transfer {} joined village {} with {} troops",
             army.id,
-            army.to_x,
-            army.to_y,
+            target.id,
             army.troops.0.values().sum::<i32>()
         );
 
@@ -713,14 +1229,24 @@ impl ArmyService {
         }
 
         // Calculate battle (similar to Attack mission)
-        let battle = Self::calculate_battle(
+        let bonus = TribeService::battle_bonus(
+            pool,
+            army.player_id,
+            army.from_village_id,
+            target.user_id,
+            target.id,
+        )
+        .await?;
+        let battle = combat::calculate_battle(
             &army.troops.0,
             &total_defender_troops,
             &definitions,
             MissionType::Attack, // Use Attack calculation for combat
+            bonus,
         );
 
         // Apply defender losses (same as handle_hostile_arrival)
+        let mut own_losses = ArmyTroops::new();
         for (troop_type, total_losses) in &battle.defender_losses {
             let village_count = village_troops.get(troop_type).copied().unwrap_or(0);
             let total_count = total_defender_troops.get(troop_type).copied().unwrap_or(0);
@@ -731,10 +1257,14 @@ impl ArmyService {
                 if actual_losses > 0 {
                     TroopRepository::kill_troops(pool, target.id, *troop_type, actual_losses)
                         .await?;
+                    own_losses.insert(*troop_type, actual_losses);
                 }
             }
         }
 
+        // Some of the village's own dead make it to the hospital
+        let defender_wounded = HospitalService::admit(pool, target.id, &own_losses).await?;
+
         // Apply losses to stationed support troops
         for stationed in &stationed_armies {
             let mut stationed_survivors = stationed.troops.0.clone();
@@ -762,6 +1292,13 @@ impl ArmyService {
             if had_losses {
                 ArmyRepository::update_stationed_troops(pool, stationed.id, &stationed_survivors)
                     .await?;
+                Self::record_away_losses(
+                    pool,
+                    stationed.from_village_id,
+                    &stationed.troops.0,
+                    &stationed_survivors,
+                )
+                .await?;
             }
         }
 
@@ -792,6 +1329,7 @@ impl ArmyService {
                 if new_loyalty <= 0 {
                     // Transfer village ownership
                     VillageRepository::transfer_ownership(pool, target.id, army.player_id).await?;
+                    VillageService::strip_on_conquest(pool, target.id, army.player_id).await?;
                     // Reset loyalty to 25% (so it can be defended)
                     VillageRepository::update_loyalty(pool, target.id, 25).await?;
                     village_conquered = true;
@@ -824,12 +1362,24 @@ impl ArmyService {
             &total_defender_troops,
             &battle.attacker_losses,
             &battle.defender_losses,
+            &defender_wounded,
             &CarriedResources::default(), // No resources stolen in conquer
             winner,
-            Utc::now(),
+            clock::now(),
         )
         .await?;
 
+        Self::record_alliance_stats(
+            pool,
+            army,
+            &target,
+            &stationed_armies,
+            &total_defender_troops,
+            &battle,
+            &definitions,
+        )
+        .await;
+
         info!(
             "Conquer battle at ({}, {}): {} wins! Loyalty: -{}, Conquered: {}",
             army.to_x, army.to_y, winner, loyalty_reduced, village_conquered
@@ -847,6 +1397,8 @@ impl ArmyService {
             )
             .await?;
         } else {
+            Self::record_away_losses(pool, army.from_village_id, &army.troops.0, &ArmyTroops::new())
+                .await?;
             ArmyRepository::delete(pool, army.id).await?;
         }
 
@@ -916,18 +1468,73 @@ impl ArmyService {
 
         // Delete army record
         ArmyRepository::delete(pool, army.id).await?;
+        Self::release_hero(pool, army, true).await?;
+
+        Ok(())
+    }
+
+    /// Credit a battle to the weekly alliance stats: support troops
+    /// defending an ally share the attackers they killed, and the attacker
+    /// scores if its alliance has declared war on the defender's
+    async fn record_alliance_stats(
+        pool: &PgPool,
+        army: &Army,
+        target: &Village,
+        stationed_armies: &[Army],
+        total_defender_troops: &ArmyTroops,
+        battle: &BattleResult,
+        definitions: &[TroopDefinition],
+    ) {
+        let killed = AllianceStatsService::points_for(&battle.attacker_losses, definitions);
+        let defenders = total_defender_troops.values().sum::<i32>() as i64;
+        if defenders > 0 {
+            for stationed in stationed_armies {
+                let share = stationed.troops.0.values().sum::<i32>() as i64;
+                AllianceStatsService::record_defense(
+                    pool,
+                    stationed.player_id,
+                    target.user_id,
+                    killed * share / defenders,
+                )
+                .await;
+            }
+        }
+
+        let lost = AllianceStatsService::points_for(&battle.defender_losses, definitions);
+        AllianceStatsService::record_war_attack(pool, army.player_id, target.user_id, lost).await;
+    }
+
+    /// Free the hero leading an army once the army is done: idle again if
+    /// it made it home, dead if the army was wiped out
+    pub(crate) async fn release_hero(pool: &PgPool, army: &Army, survived: bool) -> AppResult<()> {
+        let Some(hero_id) = army.hero_id else {
+            return Ok(());
+        };
+
+        if survived {
+            HeroRepository::update_status(pool, hero_id, HeroStatus::Idle).await?;
+        } else {
+            // Its resource points stop paying out once it falls
+            if let Some(hero) = HeroRepository::find_by_id(pool, hero_id).await? {
+                HeroService::settle_production(pool, &hero).await?;
+            }
+            HeroRepository::kill_hero(pool, hero_id, clock::now()).await?;
+            info!("Hero {} fell with army {}", hero_id, army.id);
+        }
 
         Ok(())
     }
 
     /// Initiate return journey for an army
-    async fn initiate_return(
+    pub(crate) async fn initiate_return(
         pool: &PgPool,
         army: &Army,
         survivors: ArmyTroops,
         resources: CarriedResources,
         battle_report_id: Option<Uuid>,
     ) -> AppResult<()> {
+        Self::record_away_losses(pool, army.from_village_id, &army.troops.0, &survivors).await?;
+
         // Calculate return travel time based on survivors
         let definitions = TroopRepository::get_all_definitions(pool).await?;
         let from_village = VillageRepository::find_by_id(pool, army.from_village_id).await?;
@@ -938,8 +1545,10 @@ impl ArmyService {
             Self::calculate_distance(army.to_x, army.to_y, 0, 0) // Fallback
         };
 
-        let travel_duration = Self::calculate_travel_time(distance, &survivors, &definitions);
-        let returns_at = Utc::now() + travel_duration;
+        let speed_bonus = Self::speed_bonus_percent(pool, army.from_village_id).await?;
+        let travel_duration =
+            Self::calculate_travel_time(distance, &survivors, &definitions, speed_bonus);
+        let returns_at = clock::now() + travel_duration;
 
         ArmyRepository::set_returning(
             pool,
@@ -954,21 +1563,108 @@ impl ArmyService {
         Ok(())
     }
 
+    /// Troops that died away from home come off their home village's
+    /// roster, so it stops paying their upkeep
+    pub(crate) async fn record_away_losses(
+        pool: &PgPool,
+        home_village_id: Uuid,
+        sent: &ArmyTroops,
+        survivors: &ArmyTroops,
+    ) -> AppResult<()> {
+        for (troop_type, count) in sent {
+            let lost = count - survivors.get(troop_type).copied().unwrap_or(0);
+            if lost > 0 {
+                TroopRepository::remove_away_troops(pool, home_village_id, *troop_type, lost)
+                    .await?;
+            }
+        }
+        Ok(())
+    }
+
+    /// Move troops that are away from one village onto another's roster
+    async fn rehome_troops(
+        pool: &PgPool,
+        from_village_id: Uuid,
+        to_village_id: Uuid,
+        troops: &ArmyTroops,
+    ) -> AppResult<()> {
+        for (troop_type, count) in troops {
+            if *count > 0 {
+                TroopRepository::remove_away_troops(pool, from_village_id, *troop_type, *count)
+                    .await?;
+                TroopRepository::add_troops(pool, to_village_id, *troop_type, *count).await?;
+            }
+        }
+        Ok(())
+    }
+
+    /// What moving troops to another village for good costs
+    fn transfer_cost(troops: &ArmyTroops, definitions: &[TroopDefinition]) -> CarriedResources {
+        let mut cost = CarriedResources::default();
+        for (troop_type, count) in troops {
+            if let Some(d) = definitions.iter().find(|d| d.troop_type == *troop_type) {
+                cost.wood += d.wood_cost * count;
+                cost.clay += d.clay_cost * count;
+                cost.iron += d.iron_cost * count;
+                cost.crop += d.crop_cost * count;
+            }
+        }
+        cost.wood = cost.wood * TRANSFER_COST_PERCENT / 100;
+        cost.clay = cost.clay * TRANSFER_COST_PERCENT / 100;
+        cost.iron = cost.iron * TRANSFER_COST_PERCENT / 100;
+        cost.crop = cost.crop * TRANSFER_COST_PERCENT / 100;
+        cost
+    }
+
+    /// Take the transfer cost from a village
+    async fn pay_transfer(
+        pool: &PgPool,
+        village: &Village,
+        cost: &CarriedResources,
+    ) -> AppResult<()> {
+        if village.wood < cost.wood
+            || village.clay < cost.clay
+            || village.iron < cost.iron
+            || village.crop < cost.crop
+        {
+            return Err(ErrorCode::InsufficientResources.into());
+        }
+
+        // Fails if the village changed since it was read
+        VillageRepository::deduct_resources_versioned(
+            pool,
+            village.id,
+            village.version,
+            cost.wood,
+            cost.clay,
+            cost.iron,
+            cost.crop,
+        )
+        .await?;
+        Ok(())
+    }
+
+    /// Chiefs stay with the village whose residence or palace trained them
+    fn check_transferable(troops: &ArmyTroops) -> AppResult<()> {
+        if troops.iter().any(|(troop_type, count)| *count > 0 && troop_type.is_chief()) {
+            return Err(AppError::Game(
+                ErrorCode::ChiefCannotLeave,
+                "Chiefs can't leave the village that trained them".into(),
+            ));
+        }
+        Ok(())
+    }
+
     /// Calculate Euclidean distance between two points
-    fn calculate_distance(from_x: i32, from_y: i32, to_x: i32, to_y: i32) -> f64 {
+    pub(crate) fn calculate_distance(from_x: i32, from_y: i32, to_x: i32, to_y: i32) -> f64 {
         let dx = (to_x - from_x) as f64;
         let dy = (to_y - from_y) as f64;
         (dx * dx + dy * dy).sqrt()
     }
 
-    /// Calculate travel time based on distance and slowest troop
-    fn calculate_travel_time(
-        distance: f64,
-        troops: &ArmyTroops,
-        definitions: &[TroopDefinition],
-    ) -> Duration {
-        // Find slowest troop speed
-        let slowest_speed = troops
+    /// Find slowest troop speed, in fields per hour
+    fn slowest_speed(troops: &ArmyTroops, definitions: &[TroopDefinition]) -> i32 {
+        troops
             .iter()
             .filter(|(_, count)| **count > 0)
             .filter_map(|(troop_type, _)| {
@@ -978,159 +1674,56 @@ impl ArmyService {
                     .map(|d| d.speed)
             })
             .min()
-            .unwrap_or(6); // Default speed if no troops
-
-        // Speed is fields per hour, calculate hours needed
-        let hours = distance / slowest_speed as f64;
-        let seconds = (hours * 3600.0) as i64;
-
-        // Minimum 1 minute travel time
-        Duration::seconds(seconds.max(60))
+            .unwrap_or(6) // Default speed if no troops
     }
 
-    /// Calculate battle using Travian-style formula
-    fn calculate_battle(
-        attacker_troops: &ArmyTroops,
-        defender_troops: &ArmyTroops,
-        definitions: &[TroopDefinition],
-        mission: MissionType,
-    ) -> BattleResult {
-        // Calculate attack power
-        let attack_power = Self::calculate_attack_power(attacker_troops, definitions);
-
-        // Calculate infantry/cavalry ratio for defense calculation
-        let (infantry_attack, cavalry_attack) =
-            Self::calculate_attack_by_type(attacker_troops, definitions);
-        let total_attack = infantry_attack + cavalry_attack;
-        let infantry_ratio = if total_attack > 0.0 {
-            infantry_attack / total_attack
-        } else {
-            0.5
-        };
-
-        // Calculate defense power
-        let defense_power =
-            Self::calculate_defense_power(defender_troops, definitions, infantry_ratio);
-
-        // Determine winner and calculate losses
-        let (attacker_wins, attacker_loss_ratio, defender_loss_ratio) =
-            if attack_power > defense_power && defense_power > 0.0 {
-                // Attacker wins
-                let ratio = defense_power / attack_power;
-                let attacker_losses = ratio.powf(1.5);
-                (true, attacker_losses, 1.0)
-            } else if defense_power > 0.0 {
-                // Defender wins
-                let ratio = attack_power / defense_power;
-                let defender_losses = ratio.powf(1.5);
-                // Raid: attackers can flee with reduced losses
-                let attacker_losses = if mission == MissionType::Raid {
-                    0.66_f64.max(1.0 - ratio * 0.5)
-                } else {
-                    1.0
-                };
-                (false, attacker_losses, defender_losses)
-            } else {
-                // No defenders - attacker wins with no losses
-                (true, 0.0, 0.0)
-            };
-
-        // Calculate actual losses
-        let attacker_losses = Self::apply_losses(attacker_troops, attacker_loss_ratio);
-        let defender_losses = Self::apply_losses(defender_troops, defender_loss_ratio);
-
-        // Calculate survivors
-        let attacker_survivors = Self::calculate_survivors(attacker_troops, &attacker_losses);
-        let defender_survivors = Self::calculate_survivors(defender_troops, &defender_losses);
-
-        BattleResult {
-            attacker_wins,
-            attacker_survivors,
-            defender_survivors,
-            attacker_losses,
-            defender_losses,
-        }
+    /// Tournament square level of a village
+    async fn tournament_square_level(pool: &PgPool, village_id: Uuid) -> AppResult<i32> {
+        let squares =
+            BuildingRepository::find_by_type(pool, village_id, BuildingType::TournamentSquare)
+                .await?;
+        Ok(squares.first().map(|b| b.level).unwrap_or(0))
     }
 
-    /// Calculate total attack power
-    fn calculate_attack_power(troops: &ArmyTroops, definitions: &[TroopDefinition]) -> f64 {
-        troops
-            .iter()
-            .filter_map(|(troop_type, count)| {
-                definitions
-                    .iter()
-                    .find(|d| d.troop_type == *troop_type)
-                    .map(|d| d.attack as f64 * *count as f64)
-            })
-            .sum()
+    /// Speed bonus for armies of a village, from its tournament square
+    async fn speed_bonus_percent(pool: &PgPool, village_id: Uuid) -> AppResult<i32> {
+        let level = Self::tournament_square_level(pool, village_id).await?;
+        Ok(BuildingType::TournamentSquare.speed_bonus_percent(level))
     }
 
-    /// Calculate attack power split by infantry/cavalry
-    fn calculate_attack_by_type(
+    /// Calculate travel time based on distance and slowest troop. The
+    /// speed bonus only applies beyond `TOURNAMENT_SQUARE_DISTANCE`.
+    pub(crate) fn calculate_travel_time(
+        distance: f64,
         troops: &ArmyTroops,
         definitions: &[TroopDefinition],
-    ) -> (f64, f64) {
-        let mut infantry = 0.0;
-        let mut cavalry = 0.0;
+        speed_bonus_percent: i32,
+    ) -> Duration {
+        let speed = Self::slowest_speed(troops, definitions) as f64;
+        let boosted_speed = speed * (100 + speed_bonus_percent) as f64 / 100.0;
 
-        for (troop_type, count) in troops {
-            if let Some(def) = definitions.iter().find(|d| d.troop_type == *troop_type) {
-                let attack = def.attack as f64 * *count as f64;
-                if troop_type.is_cavalry() {
-                    cavalry += attack;
-                } else {
-                    infantry += attack;
-                }
-            }
-        }
+        // Speed is fields per hour, calculate hours needed
+        let hours = distance.min(TOURNAMENT_SQUARE_DISTANCE) / speed
+            + (distance - TOURNAMENT_SQUARE_DISTANCE).max(0.0) / boosted_speed;
+        let seconds = (hours * 3600.0) as i64;
 
-        (infantry, cavalry)
+        // Minimum 1 minute travel time
+        Duration::seconds(seconds.max(60))
     }
 
-    /// Calculate total defense power based on attacker composition
-    fn calculate_defense_power(
-        troops: &ArmyTroops,
-        definitions: &[TroopDefinition],
-        infantry_ratio: f64,
-    ) -> f64 {
-        let cavalry_ratio = 1.0 - infantry_ratio;
-
+    /// Resources the troops can carry between them
+    fn carry_capacity(troops: &ArmyTroops, definitions: &[TroopDefinition]) -> i32 {
         troops
             .iter()
             .filter_map(|(troop_type, count)| {
-                definitions.iter().find(|d| d.troop_type == *troop_type).map(|d| {
-                    let effective_defense = (d.defense_infantry as f64 * infantry_ratio)
-                        + (d.defense_cavalry as f64 * cavalry_ratio);
-                    effective_defense * *count as f64
-                })
+                definitions
+                    .iter()
+                    .find(|d| d.troop_type == *troop_type)
+                    .map(|d| d.carry_capacity * count)
             })
             .sum()
     }
 
-    /// Apply loss ratio to troops
-    fn apply_losses(troops: &ArmyTroops, loss_ratio: f64) -> ArmyTroops {
-        troops
-            .iter()
-            .map(|(troop_type, count)| {
-                let losses = (*count as f64 * loss_ratio).floor() as i32;
-                (*troop_type, losses.min(*count))
-            })
-            .filter(|(_, losses)| *losses > 0)
-            .collect()
-    }
-
-    /// Calculate survivors after losses
-    fn calculate_survivors(troops: &ArmyTroops, losses: &ArmyTroops) -> ArmyTroops {
-        troops
-            .iter()
-            .map(|(troop_type, count)| {
-                let loss = losses.get(troop_type).copied().unwrap_or(0);
-                (*troop_type, (*count - loss).max(0))
-            })
-            .filter(|(_, count)| *count > 0)
-            .collect()
-    }
-
     /// Calculate resources that can be stolen
     fn calculate_stolen_resources(
         target: &Village,
@@ -1138,16 +1731,7 @@ impl ArmyService {
         definitions: &[TroopDefinition],
         mission: MissionType,
     ) -> CarriedResources {
-        // Calculate total carry capacity
-        let total_capacity: i32 = survivors
-            .iter()
-            .filter_map(|(troop_type, count)| {
-                definitions
-                    .iter()
-                    .find(|d| d.troop_type == *troop_type)
-                    .map(|d| d.carry_capacity * count)
-            })
-            .sum();
+        let total_capacity = Self::carry_capacity(survivors, definitions);
 
         if total_capacity <= 0 {
             return CarriedResources::default();
@@ -1230,6 +1814,23 @@ impl ArmyService {
         ArmyRepository::mark_report_read(pool, report_id, is_attacker).await
     }
 
+    /// Delete a report from the player's side; the other side keeps it
+    pub async fn delete_report(pool: &PgPool, report_id: Uuid, player_id: Uuid) -> AppResult<()> {
+        let report = ArmyRepository::find_report_by_id(pool, report_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Report not found".into()))?;
+
+        let is_attacker = report.attacker_player_id == player_id && !report.deleted_by_attacker;
+        let is_defender =
+            report.defender_player_id == Some(player_id) && !report.deleted_by_defender;
+
+        if !is_attacker && !is_defender {
+            return Err(AppError::NotFound("Report not found".into()));
+        }
+
+        ArmyRepository::delete_report_for_player(pool, report_id, is_attacker, clock::now()).await
+    }
+
     // ==================== Scout Reports ====================
 
     /// Get scout reports for a player
@@ -1265,6 +1866,28 @@ impl ArmyService {
         ArmyRepository::mark_scout_report_read(pool, report_id, is_attacker).await
     }
 
+    /// Delete a scout report from the player's side
+    pub async fn delete_scout_report(
+        pool: &PgPool,
+        report_id: Uuid,
+        player_id: Uuid,
+    ) -> AppResult<()> {
+        let report = ArmyRepository::find_scout_report_by_id(pool, report_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Scout report not found".into()))?;
+
+        let is_attacker = report.attacker_player_id == player_id && !report.deleted_by_attacker;
+        let is_defender =
+            report.defender_player_id == Some(player_id) && !report.deleted_by_defender;
+
+        if !is_attacker && !is_defender {
+            return Err(AppError::NotFound("Scout report not found".into()));
+        }
+
+        ArmyRepository::delete_scout_report_for_player(pool, report_id, is_attacker, clock::now())
+            .await
+    }
+
     /// Get total unread count (battle + scout reports)
     pub async fn get_total_unread_count(pool: &PgPool, player_id: Uuid) -> AppResult<i64> {
         let battle_count = ArmyRepository::count_unread_reports(pool, player_id).await?;
@@ -1292,7 +1915,8 @@ impl ArmyService {
         Ok(armies.into_iter().map(|a| a.into()).collect())
     }
 
-    /// Recall stationed support troops back to home village
+    /// Recall stationed support troops back to home village, by their owner
+    /// or by the village they are stationed in
     pub async fn recall_support(
         pool: &PgPool,
         army_id: Uuid,
@@ -1303,14 +1927,20 @@ impl ArmyService {
             .await?
             .ok_or_else(|| AppError::NotFound("Army not found".into()))?;
 
-        // Verify ownership
-        if army.player_id != player_id {
-            return Err(AppError::Forbidden("Access denied".into()));
-        }
-
         // Must be stationed
         if !army.is_stationed {
-            return Err(AppError::BadRequest("Army is not stationed".into()));
+            return Err(AppError::Game(ErrorCode::NotStationed, "Army is not stationed".into()));
+        }
+
+        // The sender may recall it; the host may send it home
+        if army.player_id != player_id {
+            let host = match army.to_village_id {
+                Some(village_id) => VillageRepository::find_by_id(pool, village_id).await?,
+                None => None,
+            };
+            if host.map(|v| v.user_id) != Some(player_id) {
+                return Err(AppError::Forbidden("Access denied".into()));
+            }
         }
 
         // Calculate return travel time
@@ -1321,8 +1951,10 @@ impl ArmyService {
 
         let distance =
             Self::calculate_distance(army.to_x, army.to_y, from_village.x, from_village.y);
-        let travel_duration = Self::calculate_travel_time(distance, &army.troops.0, &definitions);
-        let returns_at = Utc::now() + travel_duration;
+        let speed_bonus = Self::speed_bonus_percent(pool, from_village.id).await?;
+        let travel_duration =
+            Self::calculate_travel_time(distance, &army.troops.0, &definitions, speed_bonus);
+        let returns_at = clock::now() + travel_duration;
 
         // Start recall
         let updated = ArmyRepository::start_recall(pool, army_id, returns_at).await?;
@@ -1334,4 +1966,151 @@ impl ArmyService {
 
         Ok(updated.into())
     }
+
+    // ==================== Rally Point ====================
+
+    /// Everything moving to, from or standing in a village, with per-tab
+    /// counts. Troops and loot of other players' hostile armies are hidden,
+    /// as the defender only learns that an attack is coming and when.
+    pub async fn get_rally_point(
+        pool: &PgPool,
+        village_id: Uuid,
+        query: &RallyPointQuery,
+    ) -> AppResult<RallyPointResponse> {
+        let armies = ArmyRepository::find_involving_village(pool, village_id).await?;
+        let now = clock::now();
+        let mut counts = RallyPointCounts::default();
+        let mut movements = Vec::new();
+
+        for army in armies {
+            let direction = if army.from_village_id == village_id {
+                if army.is_stationed {
+                    MovementDirection::StationedElsewhere
+                } else if army.is_returning {
+                    MovementDirection::Returning
+                } else {
+                    MovementDirection::Outgoing
+                }
+            } else if army.is_stationed {
+                MovementDirection::StationedHere
+            } else if !army.is_returning {
+                MovementDirection::Incoming
+            } else {
+                // Someone else's army leaving here for home
+                continue;
+            };
+            let hostile = army.mission.is_hostile();
+
+            match direction {
+                MovementDirection::Incoming => {
+                    counts.incoming += 1;
+                    counts.incoming_hostile += hostile as i64;
+                }
+                MovementDirection::Outgoing => counts.outgoing += 1,
+                MovementDirection::Returning => counts.returning += 1,
+                MovementDirection::StationedHere => counts.stationed_here += 1,
+                MovementDirection::StationedElsewhere => counts.stationed_elsewhere += 1,
+            }
+
+            if query.direction.is_some_and(|d| d != direction)
+                || query.mission.is_some_and(|m| m != army.mission)
+                || query.hostile.is_some_and(|h| h != hostile)
+            {
+                continue;
+            }
+
+            let cancel_deadline = army.departed_at + Duration::seconds(CANCEL_GRACE_SECS);
+            let cancellable_until = Some(cancel_deadline)
+                .filter(|until| direction == MovementDirection::Outgoing && *until > now);
+            let conceal = direction == MovementDirection::Incoming && hostile;
+            let mut army: ArmyResponse = army.into();
+            if conceal {
+                army.troops = ArmyTroops::new();
+                army.resources = CarriedResources::default();
+            }
+
+            movements.push(RallyPointMovement {
+                direction,
+                army,
+                cancellable_until,
+            });
+        }
+
+        // In-flight movements by arrival, then the stationed ones
+        movements.sort_by_key(|m| (m.army.is_stationed, m.army.arrives_at));
+
+        Ok(RallyPointResponse {
+            village_id,
+            counts,
+            movements,
+        })
+    }
+
+    /// Call back an army shortly after sending it. It returns home taking as
+    /// long as it has been out.
+    pub async fn cancel_army(
+        pool: &PgPool,
+        army_id: Uuid,
+        player_id: Uuid,
+    ) -> AppResult<ArmyResponse> {
+        let army = ArmyRepository::find_by_id(pool, army_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Army not found".into()))?;
+
+        if army.player_id != player_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        if army.is_returning || army.is_stationed {
+            return Err(AppError::Game(
+                ErrorCode::CannotCancel,
+                "Army is not on its way out".into(),
+            ));
+        }
+
+        let now = clock::now();
+        let elapsed = now - army.departed_at;
+        if elapsed > Duration::seconds(CANCEL_GRACE_SECS) {
+            return Err(AppError::Game(
+                ErrorCode::CannotCancel,
+                format!(
+                    "Armies can only be cancelled within {} seconds of departure",
+                    CANCEL_GRACE_SECS
+                ),
+            ));
+        }
+
+        let updated = ArmyRepository::cancel_outgoing(pool, army_id, now + elapsed, now)
+            .await?
+            .ok_or_else(|| AppError::Conflict("Army has already arrived".into()))?;
+
+        info!(
+            "Army {} cancelled by player {}, back at village {} at {}",
+            army_id, player_id, army.from_village_id, updated.arrives_at
+        );
+
+        Ok(updated.into())
+    }
+}
+
+/// Armies on the move as `ArmyService` resolves their arrivals: Postgres in
+/// the server, memory in unit tests (see `testing::InMemoryArmies`)
+#[async_trait]
+pub trait ArmyMovements: Send + Sync {
+    /// Armies landed by `now` and not yet resolved
+    async fn find_arrived(&self, now: DateTime<Utc>) -> AppResult<Vec<Army>>;
+
+    /// Resolve one arrival; false if it failed or was resolved first
+    /// elsewhere
+    async fn resolve(&self, army: &Army) -> bool;
+}
+
+#[async_trait]
+impl ArmyMovements for PgPool {
+    async fn find_arrived(&self, now: DateTime<Utc>) -> AppResult<Vec<Army>> {
+        ArmyRepository::find_arrived(self, now).await
+    }
+
+    async fn resolve(&self, army: &Army) -> bool {
+        ArmyService::process_arrival(self, army).await
+    }
 }
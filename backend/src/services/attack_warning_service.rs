@@ -0,0 +1,85 @@
+use chrono::Duration;
+use serde_json::json;
+use sqlx::PgPool;
+use tracing::{info, warn};
+
+use crate::error::AppResult;
+use crate::models::attack_warning::{IncomingAttack, OFFLINE_MINUTES};
+use crate::models::template::TemplateKey;
+use crate::repositories::attack_warning_repo::AttackWarningRepository;
+use crate::services::clock;
+use crate::services::mailer::Mailer;
+use crate::services::template_service::TemplateService;
+
+/// Email warnings about attacks on offline players' villages. Attacks are
+/// batched: a player gets one email listing everything new since the last
+/// one, at most once per their quiet period.
+pub struct AttackWarningService;
+
+impl AttackWarningService {
+    /// Mail the warnings that are due. Returns how many emails went out.
+    pub async fn run(pool: &PgPool, mailer: &Mailer) -> AppResult<i32> {
+        let now = clock::now();
+        let recipients = AttackWarningRepository::recipients(
+            pool,
+            now,
+            now - Duration::minutes(OFFLINE_MINUTES),
+        )
+        .await?;
+
+        let mut sent = 0;
+        for recipient in recipients {
+            let attacks =
+                AttackWarningRepository::unwarned_attacks(pool, recipient.user_id, now).await?;
+            if attacks.is_empty() {
+                continue;
+            }
+
+            let email = TemplateService::render(
+                pool,
+                TemplateKey::AttackWarningEmail,
+                &recipient.locale,
+                &context(recipient.display_name.as_deref(), &attacks),
+            )
+            .await?;
+
+            if let Err(e) = mailer.send(&recipient.email, &email.subject, &email.body).await {
+                warn!("Attack warning to {} failed: {:#}", recipient.user_id, e);
+                continue;
+            }
+
+            let army_ids: Vec<_> = attacks.iter().map(|a| a.army_id).collect();
+            AttackWarningRepository::mark_warned(pool, recipient.user_id, &army_ids, now).await?;
+            sent += 1;
+
+            info!(
+                "Warned player {} about {} incoming attacks",
+                recipient.user_id,
+                attacks.len()
+            );
+        }
+
+        Ok(sent)
+    }
+}
+
+/// What the warning template renders
+fn context(name: Option<&str>, attacks: &[IncomingAttack]) -> serde_json::Value {
+    json!({
+        "display_name": name,
+        "count": attacks.len(),
+        "attacks": attacks
+            .iter()
+            .map(|attack| json!({
+                "mission": attack.mission,
+                "attacker_name": attack.attacker_name,
+                "from_x": attack.from_x,
+                "from_y": attack.from_y,
+                "village_name": attack.village_name,
+                "village_x": attack.village_x,
+                "village_y": attack.village_y,
+                "arrives_at": attack.arrives_at.format("%Y-%m-%d %H:%M").to_string(),
+            }))
+            .collect::<Vec<_>>(),
+    })
+}
@@ -0,0 +1,494 @@
+use std::collections::HashMap;
+
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::models::auction::{
+    min_next_bid, AuctionCurrency, AuctionQuery, AuctionResponse, AuctionStatus,
+    CreateAuctionRequest, HeroAuction, MyAuctionsResponse, PlaceBidRequest, CLOSE_BATCH,
+    MAX_AUCTION_HOURS, MIN_AUCTION_HOURS, SNIPE_WINDOW_SECS,
+};
+use crate::models::hero::{Hero, ItemDefinition};
+use crate::models::shop::TransactionType;
+use crate::repositories::auction_repo::AuctionRepository;
+use crate::repositories::hero_repo::HeroRepository;
+use crate::repositories::shop_repo::ShopRepository;
+use crate::services::clock;
+use crate::services::ws_service::{
+    AuctionBidData, AuctionClosedData, AuctionOutbidData, WsEvent, WsManager,
+};
+
+/// Hero items traded between players for silver or gold. Listed items and
+/// leading bids are held by the auction until it closes.
+pub struct AuctionService;
+
+impl AuctionService {
+    pub async fn list(
+        pool: &PgPool,
+        user_id: Uuid,
+        query: &AuctionQuery,
+    ) -> AppResult<Vec<AuctionResponse>> {
+        let auctions = AuctionRepository::list_open(pool, query, clock::now()).await?;
+        Self::responses(pool, user_id, auctions).await
+    }
+
+    pub async fn mine(pool: &PgPool, user_id: Uuid) -> AppResult<MyAuctionsResponse> {
+        let selling = AuctionRepository::find_by_seller(pool, user_id, 50).await?;
+        let leading = AuctionRepository::find_leading(pool, user_id).await?;
+
+        Ok(MyAuctionsResponse {
+            silver_balance: ShopRepository::get_silver_balance(pool, user_id).await?,
+            gold_balance: ShopRepository::get_gold_balance(pool, user_id).await?,
+            selling: Self::responses(pool, user_id, selling).await?,
+            leading: Self::responses(pool, user_id, leading).await?,
+        })
+    }
+
+    /// Put an item from a hero's inventory up for auction
+    pub async fn create(
+        pool: &PgPool,
+        user_id: Uuid,
+        request: CreateAuctionRequest,
+    ) -> AppResult<AuctionResponse> {
+        if !(MIN_AUCTION_HOURS..=MAX_AUCTION_HOURS).contains(&request.duration_hours) {
+            return Err(AppError::BadRequest(format!(
+                "Duration must be between {} and {} hours",
+                MIN_AUCTION_HOURS, MAX_AUCTION_HOURS
+            )));
+        }
+        if request.starting_bid < 1 {
+            return Err(AppError::BadRequest("Starting bid must be positive".into()));
+        }
+
+        Self::owned_hero(pool, user_id, request.hero_id).await?;
+
+        let (hero_item, item_def) = HeroRepository::get_hero_item(pool, request.item_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Item not found".into()))?;
+
+        if hero_item.hero_id != request.hero_id {
+            return Err(AppError::Forbidden(
+                "Item does not belong to this hero".into(),
+            ));
+        }
+        if !item_def.can_buy_auction {
+            return Err(AppError::BadRequest("This item can't be auctioned".into()));
+        }
+        if hero_item.is_equipped {
+            return Err(AppError::BadRequest("Cannot auction equipped items".into()));
+        }
+
+        let quantity = request.quantity.unwrap_or(hero_item.quantity);
+        if !(1..=hero_item.quantity).contains(&quantity) {
+            return Err(AppError::BadRequest(format!(
+                "Quantity must be between 1 and {}",
+                hero_item.quantity
+            )));
+        }
+
+        // The item stays with the auction until it closes
+        if !HeroRepository::take_item(pool, hero_item.id, quantity).await? {
+            return Err(AppError::Conflict("The item changed, try again".into()));
+        }
+
+        let ends_at = clock::now() + Duration::hours(request.duration_hours);
+        let auction = AuctionRepository::create(
+            pool,
+            user_id,
+            request.hero_id,
+            item_def.id,
+            quantity,
+            request.currency,
+            request.starting_bid,
+            ends_at,
+        )
+        .await?;
+
+        info!(
+            "User {} listed {} x {} for {} {:?}",
+            user_id, quantity, item_def.name, request.starting_bid, request.currency
+        );
+
+        Ok(Self::response(user_id, auction, item_def))
+    }
+
+    /// Bid on an auction. The bid is taken from the player's balance and
+    /// returned if someone outbids them.
+    pub async fn bid(
+        pool: &PgPool,
+        ws: &WsManager,
+        user_id: Uuid,
+        auction_id: Uuid,
+        request: PlaceBidRequest,
+    ) -> AppResult<AuctionResponse> {
+        let now = clock::now();
+        let auction = AuctionRepository::find_by_id(pool, auction_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Auction not found".into()))?;
+
+        if auction.status != AuctionStatus::Open || auction.ends_at <= now {
+            return Err(ErrorCode::AuctionEnded.into());
+        }
+        if auction.seller_id == user_id {
+            return Err(AppError::BadRequest(
+                "You can't bid on your own auction".into(),
+            ));
+        }
+        if auction.bidder_id == Some(user_id) {
+            return Err(AppError::BadRequest(
+                "You already hold the leading bid".into(),
+            ));
+        }
+
+        Self::owned_hero(pool, user_id, request.hero_id).await?;
+
+        let min_bid = min_next_bid(auction.starting_bid, auction.current_bid);
+        if request.amount < min_bid {
+            return Err(AppError::BadRequest(format!(
+                "Bid must be at least {}",
+                min_bid
+            )));
+        }
+
+        Self::debit(pool, user_id, auction.currency, request.amount).await?;
+
+        // Late bids keep the auction open a little longer
+        let ends_at = auction
+            .ends_at
+            .max(now + Duration::seconds(SNIPE_WINDOW_SECS));
+
+        let Some(updated) = AuctionRepository::place_bid(
+            pool,
+            auction.id,
+            auction.version,
+            user_id,
+            request.hero_id,
+            request.amount,
+            ends_at,
+        )
+        .await?
+        else {
+            Self::credit(pool, user_id, auction.currency, request.amount).await?;
+            return Err(AppError::VersionConflict(
+                "Someone else bid at the same time, try again".into(),
+            ));
+        };
+
+        AuctionRepository::record_bid(pool, auction.id, user_id, request.amount).await?;
+
+        // Hand the previous leader their bid back
+        if let (Some(previous), Some(amount)) = (auction.bidder_id, auction.current_bid) {
+            Self::credit(pool, previous, auction.currency, amount).await?;
+            let event = WsEvent::AuctionOutbid(AuctionOutbidData {
+                auction_id: auction.id,
+                currency: auction.currency.as_str().into(),
+                refunded: amount,
+                current_bid: request.amount,
+                ends_at,
+            });
+            ws.send_to_user(previous, &event).await;
+        }
+
+        let event = WsEvent::AuctionBid(AuctionBidData {
+            auction_id: auction.id,
+            currency: auction.currency.as_str().into(),
+            current_bid: request.amount,
+            bid_count: updated.bid_count,
+            ends_at,
+        });
+        ws.send_to_user(updated.seller_id, &event).await;
+
+        let item_def = Self::item_definition(pool, updated.item_definition_id).await?;
+        Ok(Self::response(user_id, updated, item_def))
+    }
+
+    /// Withdraw an auction nobody has bid on yet
+    pub async fn cancel(
+        pool: &PgPool,
+        user_id: Uuid,
+        auction_id: Uuid,
+    ) -> AppResult<AuctionResponse> {
+        let auction = AuctionRepository::find_by_id(pool, auction_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Auction not found".into()))?;
+
+        if auction.seller_id != user_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        if auction.status != AuctionStatus::Open {
+            return Err(ErrorCode::AuctionEnded.into());
+        }
+        if auction.bid_count > 0 {
+            return Err(AppError::BadRequest(
+                "Auctions with bids can't be cancelled".into(),
+            ));
+        }
+
+        let closed = AuctionRepository::close(
+            pool,
+            auction.id,
+            auction.version,
+            AuctionStatus::Cancelled,
+            clock::now(),
+        )
+        .await?
+        .ok_or_else(|| AppError::Conflict("Someone bid on the auction".into()))?;
+
+        Self::return_to_seller(pool, &closed).await?;
+
+        let item_def = Self::item_definition(pool, closed.item_definition_id).await?;
+        Ok(Self::response(user_id, closed, item_def))
+    }
+
+    /// Settle auctions whose time is up: the item goes to the winner and
+    /// the winning bid to the seller, or the item back to the seller if
+    /// nobody bid. Returns how many closed.
+    pub async fn close_due(pool: &PgPool, ws: &WsManager) -> AppResult<i32> {
+        let now = clock::now();
+        let due = AuctionRepository::find_due(pool, now, CLOSE_BATCH).await?;
+
+        let mut count = 0;
+        for auction in due {
+            let status = if auction.bidder_id.is_some() {
+                AuctionStatus::Sold
+            } else {
+                AuctionStatus::Expired
+            };
+            // A late bid may have moved the end; the next run picks it up
+            let Some(closed) =
+                AuctionRepository::close(pool, auction.id, auction.version, status, now).await?
+            else {
+                continue;
+            };
+
+            match (closed.bidder_id, closed.current_bid) {
+                (Some(winner), Some(amount)) => {
+                    Self::settle_sale(pool, &closed, winner, amount).await?;
+                    let event = WsEvent::AuctionClosed(AuctionClosedData {
+                        auction_id: closed.id,
+                        sold: true,
+                        currency: closed.currency.as_str().into(),
+                        amount: Some(amount),
+                    });
+                    ws.send_to_users(&[closed.seller_id, winner], &event).await;
+                }
+                _ => {
+                    Self::return_to_seller(pool, &closed).await?;
+                    let event = WsEvent::AuctionClosed(AuctionClosedData {
+                        auction_id: closed.id,
+                        sold: false,
+                        currency: closed.currency.as_str().into(),
+                        amount: None,
+                    });
+                    ws.send_to_user(closed.seller_id, &event).await;
+                }
+            }
+            count += 1;
+        }
+
+        Ok(count)
+    }
+
+    async fn settle_sale(
+        pool: &PgPool,
+        auction: &HeroAuction,
+        winner: Uuid,
+        amount: i32,
+    ) -> AppResult<()> {
+        let delivered = Self::deliver(
+            pool,
+            winner,
+            auction.bidder_hero_id,
+            auction.item_definition_id,
+            auction.quantity,
+        )
+        .await?;
+        if !delivered {
+            warn!(
+                "Auction {}: winner {} has no hero to receive the item",
+                auction.id, winner
+            );
+        }
+
+        // The winning bid was taken when it was placed
+        Self::credit(pool, auction.seller_id, auction.currency, amount).await?;
+
+        if auction.currency == AuctionCurrency::Gold {
+            let description = format!("Hero auction {}", auction.id);
+            ShopRepository::create_transaction(
+                pool,
+                winner,
+                TransactionType::GoldSpend,
+                -amount,
+                None,
+                None,
+                None,
+                None,
+                Some(&description),
+            )
+            .await?;
+            ShopRepository::create_transaction(
+                pool,
+                auction.seller_id,
+                TransactionType::GoldGift,
+                amount,
+                None,
+                None,
+                None,
+                None,
+                Some(&description),
+            )
+            .await?;
+        }
+
+        info!(
+            "Auction {} sold to {} for {} {:?}",
+            auction.id, winner, amount, auction.currency
+        );
+        Ok(())
+    }
+
+    async fn return_to_seller(pool: &PgPool, auction: &HeroAuction) -> AppResult<()> {
+        let returned = Self::deliver(
+            pool,
+            auction.seller_id,
+            auction.seller_hero_id,
+            auction.item_definition_id,
+            auction.quantity,
+        )
+        .await?;
+        if !returned {
+            warn!(
+                "Auction {}: seller {} has no hero to take the item back",
+                auction.id, auction.seller_id
+            );
+        }
+        Ok(())
+    }
+
+    /// Put an item in the inventory of the given hero, or the player's
+    /// first hero if that one is gone. False if the player has no hero.
+    async fn deliver(
+        pool: &PgPool,
+        user_id: Uuid,
+        hero_id: Option<Uuid>,
+        item_definition_id: Uuid,
+        quantity: i32,
+    ) -> AppResult<bool> {
+        let mut target = None;
+        if let Some(hero_id) = hero_id {
+            target = HeroRepository::find_by_id(pool, hero_id)
+                .await?
+                .filter(|h| h.user_id == user_id)
+                .map(|h| h.id);
+        }
+        if target.is_none() {
+            target = HeroRepository::get_user_heroes(pool, user_id)
+                .await?
+                .first()
+                .map(|h| h.id);
+        }
+        let Some(hero_id) = target else {
+            return Ok(false);
+        };
+
+        HeroRepository::add_item(pool, hero_id, item_definition_id, quantity).await?;
+        Ok(true)
+    }
+
+    async fn debit(
+        pool: &PgPool,
+        user_id: Uuid,
+        currency: AuctionCurrency,
+        amount: i32,
+    ) -> AppResult<()> {
+        match currency {
+            AuctionCurrency::Silver => {
+                if ShopRepository::get_silver_balance(pool, user_id).await? < amount {
+                    return Err(ErrorCode::InsufficientSilver.into());
+                }
+                ShopRepository::deduct_silver(pool, user_id, amount).await?;
+            }
+            AuctionCurrency::Gold => {
+                if ShopRepository::get_gold_balance(pool, user_id).await? < amount {
+                    return Err(ErrorCode::InsufficientGold.into());
+                }
+                ShopRepository::deduct_gold(pool, user_id, amount).await?;
+            }
+        }
+        Ok(())
+    }
+
+    async fn credit(
+        pool: &PgPool,
+        user_id: Uuid,
+        currency: AuctionCurrency,
+        amount: i32,
+    ) -> AppResult<()> {
+        match currency {
+            AuctionCurrency::Silver => ShopRepository::add_silver(pool, user_id, amount).await?,
+            AuctionCurrency::Gold => ShopRepository::add_gold(pool, user_id, amount).await?,
+        };
+        Ok(())
+    }
+
+    async fn owned_hero(pool: &PgPool, user_id: Uuid, hero_id: Uuid) -> AppResult<Hero> {
+        let hero = HeroRepository::find_by_id(pool, hero_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Hero not found".into()))?;
+
+        if hero.user_id != user_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        Ok(hero)
+    }
+
+    async fn item_definition(pool: &PgPool, id: Uuid) -> AppResult<ItemDefinition> {
+        HeroRepository::get_item_definition(pool, id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Item not found".into()))
+    }
+
+    async fn responses(
+        pool: &PgPool,
+        user_id: Uuid,
+        auctions: Vec<HeroAuction>,
+    ) -> AppResult<Vec<AuctionResponse>> {
+        if auctions.is_empty() {
+            return Ok(Vec::new());
+        }
+        let items: HashMap<Uuid, ItemDefinition> = HeroRepository::get_all_items(pool)
+            .await?
+            .into_iter()
+            .map(|d| (d.id, d))
+            .collect();
+
+        Ok(auctions
+            .into_iter()
+            .filter_map(|a| {
+                let item = items.get(&a.item_definition_id)?.clone();
+                Some(Self::response(user_id, a, item))
+            })
+            .collect())
+    }
+
+    fn response(user_id: Uuid, a: HeroAuction, item: ItemDefinition) -> AuctionResponse {
+        AuctionResponse {
+            id: a.id,
+            item: item.into(),
+            quantity: a.quantity,
+            currency: a.currency,
+            starting_bid: a.starting_bid,
+            current_bid: a.current_bid,
+            min_bid: min_next_bid(a.starting_bid, a.current_bid),
+            bid_count: a.bid_count,
+            ends_at: a.ends_at,
+            status: a.status,
+            is_seller: a.seller_id == user_id,
+            is_leading: a.bidder_id == Some(user_id),
+        }
+    }
+}
@@ -0,0 +1,88 @@
+use chrono::{Duration, Utc};
+use serde_json::Value;
+use sqlx::PgPool;
+use tracing::error;
+
+use crate::error::AppResult;
+use crate::models::audit::{
+    AuditLogEntry, AuditLogQuery, NewAuditLogEntry, REDACTED_KEYS, REDACTED_VALUE,
+};
+use crate::repositories::audit_repo::AuditRepository;
+
+pub struct AuditService;
+
+impl AuditService {
+    /// Store the entry in the background; audit failures never fail the request
+    pub fn record(pool: &PgPool, entry: NewAuditLogEntry) {
+        let pool = pool.clone();
+        tokio::spawn(async move {
+            if let Err(e) = AuditRepository::insert(&pool, &entry).await {
+                error!(
+                    "Failed to write audit log for {} {}: {:?}",
+                    entry.method, entry.path, e
+                );
+            }
+        });
+    }
+
+    pub async fn search(pool: &PgPool, query: &AuditLogQuery) -> AppResult<Vec<AuditLogEntry>> {
+        AuditRepository::search(pool, query).await
+    }
+
+    pub async fn prune(pool: &PgPool, retention_days: i64) -> AppResult<u64> {
+        AuditRepository::delete_before(pool, Utc::now() - Duration::days(retention_days)).await
+    }
+
+    /// Parse a request body for storage: JSON with sensitive fields
+    /// redacted, a marker for oversized or non-JSON bodies, `None` if empty
+    pub fn sanitize_payload(body: &[u8], max_bytes: usize) -> Option<Value> {
+        if body.is_empty() {
+            return None;
+        }
+        if body.len() > max_bytes {
+            return Some(serde_json::json!({ "_truncated": true, "_bytes": body.len() }));
+        }
+
+        match serde_json::from_slice::<Value>(body) {
+            Ok(mut value) => {
+                redact(&mut value);
+                Some(value)
+            }
+            Err(_) => Some(serde_json::json!({ "_non_json": true, "_bytes": body.len() })),
+        }
+    }
+
+    /// Collapse ids in a path so calls to the same endpoint group together,
+    /// e.g. /api/villages/{id}/buildings/{id}
+    pub fn normalize_route(path: &str) -> String {
+        path.split('/')
+            .map(|segment| {
+                let is_id = uuid::Uuid::parse_str(segment).is_ok()
+                    || (!segment.is_empty() && segment.chars().all(|c| c.is_ascii_digit()));
+                if is_id {
+                    "{id}"
+                } else {
+                    segment
+                }
+            })
+            .collect::<Vec<_>>()
+            .join("/")
+    }
+}
+
+fn redact(value: &mut Value) {
+    match value {
+        Value::Object(map) => {
+            for (key, v) in map.iter_mut() {
+                let key = key.to_lowercase();
+                if REDACTED_KEYS.iter().any(|k| key.contains(k)) {
+                    *v = Value::String(REDACTED_VALUE.to_string());
+                } else {
+                    redact(v);
+                }
+            }
+        }
+        Value::Array(items) => items.iter_mut().for_each(redact),
+        _ => {}
+    }
+}
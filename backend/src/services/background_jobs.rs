@@ -3,50 +3,394 @@ use std::time::Duration;
 use tokio::time::interval;
 use tracing::{error, info};
 
-use crate::repositories::building_repo::BuildingRepository;
+use crate::config::{Config, GameDataConfig, SecretStore, TickConfig};
+use crate::db::replica::ReadPool;
+use crate::db::shard::ShardResolver;
+use crate::error::reporting;
+use crate::models::attack_warning::ATTACK_WARNING_INTERVAL_SECS;
+use crate::repositories::hospital_repo::HospitalRepository;
+use crate::repositories::research_repo::ResearchRepository;
 use crate::repositories::troop_repo::TroopRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::activity_service::ActivityService;
+use crate::services::alliance_stats_service::AllianceStatsService;
+use crate::services::archive_store::ArchiveStore;
 use crate::services::army_service::ArmyService;
+use crate::services::attack_warning_service::AttackWarningService;
+use crate::services::auction_service::AuctionService;
+use crate::services::audit_service::AuditService;
+use crate::services::bot_detection_service::BotDetectionService;
 use crate::services::building_service::BuildingService;
+use crate::services::cache_service::CacheService;
+use crate::services::clock::{self, ClockService};
+use crate::services::command_service::CommandService;
+use crate::services::digest_service::DigestService;
+use crate::services::gamedata_loader::GameDataLoader;
+use crate::services::hospital_service::HospitalService;
+use crate::services::inactivity_service::InactivityService;
+use crate::services::invariant_service::InvariantService;
+use crate::services::lag_watchdog_service::LagWatchdogService;
+use crate::services::discord::DiscordWebhook;
+use crate::services::mailer::Mailer;
+use crate::services::market_service::MarketService;
+use crate::services::projection_service::ProjectionService;
+use crate::services::referral_service::ReferralService;
+use crate::services::region_service::RegionService;
+use crate::services::registration_service::RegistrationService;
+use crate::services::report_retention_service::ReportRetentionService;
+use crate::services::research_service::ResearchService;
 use crate::services::resource_service::ResourceService;
-use crate::services::ws_service::{BuildingCompleteData, TroopTrainingCompleteData, TroopsStarvedData, WsEvent, WsManager};
+use crate::services::runtime_config_service::RuntimeConfigService;
+use crate::services::session_service::SessionService;
+use crate::services::shard_service::ShardService;
+use crate::services::soft_delete_service::SoftDeleteService;
+use crate::services::sync_service::SyncService;
+use crate::services::tick_service::TickService;
+use crate::services::village_stats_service::VillageStatsService;
+use crate::services::wave_service::WaveService;
+use crate::services::world_dump_service::WorldDumpService;
+use crate::services::world_stats_service::WorldStatsService;
+use crate::services::world_status_service::WorldStatusService;
+use crate::services::ws_service::{
+    BuildingCompleteData, HealingCompleteData, ResearchCompleteData, TroopTrainingCompleteData,
+    TroopsStarvedData, WsEvent, WsManager,
+};
 
 /// Start all background jobs
-pub async fn start_background_jobs(pool: PgPool, ws_manager: WsManager) {
+pub async fn start_background_jobs(
+    pool: PgPool,
+    read_db: ReadPool,
+    shards: ShardResolver,
+    ws_manager: WsManager,
+    config: Config,
+    secrets: SecretStore,
+) {
+    // A world paused before a restart must come back frozen, before any
+    // queue job looks at the clock
+    if let Err(e) = ClockService::refresh(&pool).await {
+        error!("Error loading game clock settings: {:?}", e);
+    }
+    if let Err(e) = ClockService::sync(&pool).await {
+        error!("Error syncing the world clock: {:?}", e);
+    }
+
     // Spawn building completion job
     let pool_clone = pool.clone();
     let ws_clone = ws_manager.clone();
-    tokio::spawn(async move {
-        run_building_completion_job(pool_clone, ws_clone).await;
-    });
+    tokio::spawn(reporting::run_job(
+        "building_completion",
+        run_building_completion_job(pool_clone, ws_clone),
+    ));
 
     // Spawn resource production job
     let pool_clone = pool.clone();
     let ws_clone = ws_manager.clone();
-    tokio::spawn(async move {
-        run_resource_production_job(pool_clone, ws_clone).await;
-    });
+    tokio::spawn(reporting::run_job(
+        "resource_production",
+        run_resource_production_job(pool_clone, ws_clone),
+    ));
 
     // Spawn army processing job
     let pool_clone = pool.clone();
     let ws_clone = ws_manager.clone();
-    tokio::spawn(async move {
-        run_army_processing_job(pool_clone, ws_clone).await;
-    });
+    tokio::spawn(reporting::run_job(
+        "army_processing",
+        run_army_processing_job(pool_clone, ws_clone),
+    ));
 
     // Spawn troop training completion job
     let pool_clone = pool.clone();
     let ws_clone = ws_manager.clone();
-    tokio::spawn(async move {
-        run_troop_training_job(pool_clone, ws_clone).await;
-    });
+    tokio::spawn(reporting::run_job(
+        "troop_training",
+        run_troop_training_job(pool_clone, ws_clone),
+    ));
+
+    // Spawn hero auction close job
+    let pool_clone = pool.clone();
+    let ws_clone = ws_manager.clone();
+    tokio::spawn(reporting::run_job(
+        "auction_close",
+        run_auction_close_job(pool_clone, ws_clone),
+    ));
+
+    // Spawn academy research completion job
+    let pool_clone = pool.clone();
+    let ws_clone = ws_manager.clone();
+    tokio::spawn(reporting::run_job(
+        "research_completion",
+        run_research_completion_job(pool_clone, ws_clone),
+    ));
+
+    // Spawn hospital healing completion job
+    let pool_clone = pool.clone();
+    let ws_clone = ws_manager.clone();
+    tokio::spawn(reporting::run_job(
+        "healing_completion",
+        run_healing_completion_job(pool_clone, ws_clone),
+    ));
 
     // Spawn starvation job
     let pool_clone = pool.clone();
     let ws_clone = ws_manager.clone();
-    tokio::spawn(async move {
-        run_starvation_job(pool_clone, ws_clone).await;
-    });
+    tokio::spawn(reporting::run_job(
+        "starvation",
+        run_starvation_job(pool_clone, ws_clone),
+    ));
+
+    // Spawn culture production job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "culture_production",
+        run_culture_production_job(pool_clone),
+    ));
+
+    // Spawn village stats reconciliation job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "village_stats_reconciliation",
+        run_village_stats_reconciliation_job(pool_clone),
+    ));
+
+    // Spawn invariant check job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "invariant_check",
+        run_invariant_check_job(pool_clone),
+    ));
+
+    // Spawn market delivery job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "market_delivery",
+        run_market_delivery_job(pool_clone),
+    ));
+
+    // Spawn queue lag watchdog
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "lag_watchdog",
+        run_lag_watchdog_job(pool_clone),
+    ));
+
+    // Spawn scheduled wave send job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job("wave_sends", run_wave_send_job(pool_clone)));
+
+    // Spawn scheduled command job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "scheduled_commands",
+        run_scheduled_command_job(pool_clone),
+    ));
+
+    // Spawn inactivity (gray zone) job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "inactivity",
+        run_inactivity_job(pool_clone),
+    ));
+
+    // Spawn domain event pruning job
+    let pool_clone = pool.clone();
+    let retention_hours = config.sync.event_retention_hours;
+    tokio::spawn(reporting::run_job(
+        "domain_event_pruning",
+        run_domain_event_pruning_job(pool_clone, retention_hours),
+    ));
+
+    // Spawn cache invalidation and warming jobs
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "cache_invalidation",
+        run_cache_invalidation_job(pool_clone),
+    ));
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "cache_warming",
+        run_cache_warming_job(pool_clone),
+    ));
+
+    // Spawn read-model projection job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "projection",
+        run_projection_job(pool_clone),
+    ));
+
+    // Spawn world statistics projection
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "world_stats",
+        run_world_stats_job(pool_clone),
+    ));
+
+    // Spawn world tick coordinator
+    let pool_clone = pool.clone();
+    let tick_config = config.tick.clone();
+    tokio::spawn(reporting::run_job(
+        "tick_coordinator",
+        run_tick_coordinator(pool_clone, tick_config),
+    ));
+
+    // Spawn audit log pruning job
+    if config.audit.enabled {
+        let pool_clone = pool.clone();
+        let retention_days = config.audit.retention_days;
+        tokio::spawn(reporting::run_job(
+            "audit_log_pruning",
+            run_audit_log_pruning_job(pool_clone, retention_days),
+        ));
+    }
+
+    // Spawn referral milestone job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "referral_milestones",
+        run_referral_milestone_job(pool_clone),
+    ));
+
+    // Spawn weekly alliance awards job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "alliance_awards",
+        run_alliance_awards_job(pool_clone),
+    ));
+
+    // Spawn region control evaluation job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "region_control",
+        run_region_control_job(pool_clone),
+    ));
+
+    // Spawn world milestone announcement job
+    let pool_clone = pool.clone();
+    let ws_clone = ws_manager.clone();
+    tokio::spawn(reporting::run_job(
+        "world_milestones",
+        run_world_milestone_job(pool_clone, ws_clone),
+    ));
+
+    // Spawn registration invite wave job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "registration_waves",
+        run_registration_wave_job(pool_clone),
+    ));
+
+    // Spawn account activity pruning job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "activity_pruning",
+        run_activity_pruning_job(pool_clone),
+    ));
+
+    // Spawn game data hot reload (development)
+    if config.gamedata.hot_reload && config.gamedata.dir.is_some() {
+        let pool_clone = pool.clone();
+        let gamedata_config = config.gamedata.clone();
+        tokio::spawn(reporting::run_job(
+            "gamedata_reload",
+            run_gamedata_reload_job(pool_clone, gamedata_config),
+        ));
+    }
+
+    // Spawn runtime config watcher
+    let pool_clone = pool.clone();
+    let config_clone = config.clone();
+    tokio::spawn(reporting::run_job(
+        "runtime_config",
+        run_runtime_config_job(pool_clone, config_clone),
+    ));
+
+    // Spawn game clock watcher (time warp offset and world pauses)
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job("clock", run_clock_job(pool_clone)));
+
+    // Spawn world clock sync job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "world_clock_sync",
+        run_world_clock_sync_job(pool_clone),
+    ));
+
+    // Spawn secret rotation job
+    if !secrets.is_empty() {
+        let refresh_secs = config.secrets.refresh_secs;
+        tokio::spawn(reporting::run_job(
+            "secret_rotation",
+            run_secret_rotation_job(secrets, refresh_secs),
+        ));
+    }
+
+    // Spawn read replica lag monitor
+    if read_db.has_replicas() {
+        tokio::spawn(reporting::run_job(
+            "replica_lag",
+            run_replica_lag_job(read_db),
+        ));
+    }
+
+    // Spawn world shard directory watcher
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "shard_directory",
+        run_shard_directory_job(pool_clone, shards),
+    ));
+
+    // Spawn idle session expiry job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "session_expiry",
+        run_session_expiry_job(pool_clone),
+    ));
+
+    // Spawn bot detection job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "bot_detection",
+        run_bot_detection_job(pool_clone),
+    ));
+
+    // Spawn weekly digest job
+    let pool_clone = pool.clone();
+    let mailer = Mailer::from_config(&config.email);
+    let discord = DiscordWebhook::from_url(config.discord.digest_webhook_url.as_deref());
+    tokio::spawn(reporting::run_job(
+        "weekly_digest",
+        run_weekly_digest_job(pool_clone, mailer.clone(), discord),
+    ));
+
+    // Spawn attack warning job (only when email is configured)
+    if let Some(mailer) = mailer {
+        let pool_clone = pool.clone();
+        tokio::spawn(reporting::run_job(
+            "attack_warnings",
+            run_attack_warning_job(pool_clone, mailer),
+        ));
+    }
+
+    // Spawn report retention job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "report_retention",
+        run_report_retention_job(pool_clone, config.clone()),
+    ));
+
+    // Spawn world dump job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "world_dump",
+        run_world_dump_job(pool_clone, config),
+    ));
+
+    // Spawn soft delete purge job
+    let pool_clone = pool.clone();
+    tokio::spawn(reporting::run_job(
+        "soft_delete_purge",
+        run_soft_delete_purge_job(pool_clone),
+    ));
 
     info!("Background jobs started");
 }
@@ -57,6 +401,7 @@ async fn run_building_completion_job(pool: PgPool, ws_manager: WsManager) {
 
     loop {
         ticker.tick().await;
+        let _queue = LagWatchdogService::queue_guard().await;
 
         match complete_building_upgrades(&pool, &ws_manager).await {
             Ok(count) => {
@@ -73,48 +418,37 @@ async fn run_building_completion_job(pool: PgPool, ws_manager: WsManager) {
 
 /// Complete all buildings that have finished upgrading
 async fn complete_building_upgrades(pool: &PgPool, ws_manager: &WsManager) -> anyhow::Result<i32> {
-    let buildings = BuildingRepository::find_completed_upgrades(pool).await?;
-    let mut completed = 0;
-
-    for building in buildings {
-        // Use BuildingService to handle upgrade completion with side effects
-        match BuildingService::complete_upgrade(pool, building.id).await {
-            Ok(updated) => {
-                info!(
-                    "Building {:?} upgraded to level {} in village {}",
-                    updated.building_type, updated.level, updated.village_id
-                );
+    let completed = BuildingService::complete_due_upgrades(pool, clock::clock()).await?;
 
-                // Broadcast to village owner
-                if let Ok(Some(village)) = VillageRepository::find_by_id(pool, updated.village_id).await {
-                    let event = WsEvent::BuildingComplete(BuildingCompleteData {
-                        village_id: updated.village_id,
-                        building_type: format!("{:?}", updated.building_type),
-                        slot: updated.slot,
-                        level: updated.level,
-                    });
-                    ws_manager.send_to_user(village.user_id, &event).await;
-                }
+    for updated in &completed {
+        info!(
+            "Building {:?} upgraded to level {} in village {}",
+            updated.building_type, updated.level, updated.village_id
+        );
 
-                completed += 1;
-            }
-            Err(e) => {
-                error!("Error completing upgrade for building {}: {:?}", building.id, e);
-            }
+        // Broadcast to village owner
+        if let Ok(Some(village)) = VillageRepository::find_by_id(pool, updated.village_id).await {
+            let event = WsEvent::BuildingComplete(BuildingCompleteData {
+                village_id: updated.village_id,
+                building_type: format!("{:?}", updated.building_type),
+                slot: updated.slot,
+                level: updated.level,
+            });
+            ws_manager.send_to_user(village.user_id, &event).await;
         }
     }
 
-    Ok(completed)
+    Ok(completed.len() as i32)
 }
 
 /// Update resource production every 5 minutes
-async fn run_resource_production_job(pool: PgPool, _ws_manager: WsManager) {
+async fn run_resource_production_job(pool: PgPool, ws_manager: WsManager) {
     let mut ticker = interval(Duration::from_secs(300)); // 5 minutes
 
     loop {
         ticker.tick().await;
 
-        match ResourceService::update_all_village_resources(&pool).await {
+        match ResourceService::update_all_village_resources(&pool, &ws_manager).await {
             Ok(count) => {
                 if count > 0 {
                     info!("Updated resources for {} villages", count);
@@ -136,6 +470,7 @@ async fn run_army_processing_job(pool: PgPool, ws_manager: WsManager) {
 
     loop {
         ticker.tick().await;
+        let _queue = LagWatchdogService::queue_guard().await;
 
         match ArmyService::process_arrived_armies_with_ws(&pool, &ws_manager).await {
             Ok(count) => {
@@ -156,6 +491,7 @@ async fn run_troop_training_job(pool: PgPool, ws_manager: WsManager) {
 
     loop {
         ticker.tick().await;
+        let _queue = LagWatchdogService::queue_guard().await;
 
         match complete_troop_training(&pool, &ws_manager).await {
             Ok(count) => {
@@ -172,19 +508,15 @@ async fn run_troop_training_job(pool: PgPool, ws_manager: WsManager) {
 
 /// Complete all troop training that has finished
 async fn complete_troop_training(pool: &PgPool, ws_manager: &WsManager) -> anyhow::Result<i32> {
-    let completed = TroopRepository::find_completed_training(pool).await?;
+    let completed = TroopRepository::find_completed_training(pool, clock::now()).await?;
     let mut count = 0;
 
     for entry in completed {
-        // Add troops to village
-        match TroopRepository::add_troops(pool, entry.village_id, entry.troop_type, entry.count).await {
-            Ok(_) => {
-                // Remove from queue
-                if let Err(e) = TroopRepository::remove_from_queue(pool, entry.id).await {
-                    error!("Failed to remove training queue entry {}: {:?}", entry.id, e);
-                    continue;
-                }
-
+        // Claims the entry and adds its troops together; false when a
+        // catch-up pass or another instance completed it first
+        match TroopRepository::complete_training(pool, &entry).await {
+            Ok(false) => {}
+            Ok(true) => {
                 info!(
                     "Troop training complete: {} x {:?} in village {}",
                     entry.count, entry.troop_type, entry.village_id
@@ -203,7 +535,104 @@ async fn complete_troop_training(pool: &PgPool, ws_manager: &WsManager) -> anyho
                 count += 1;
             }
             Err(e) => {
-                error!("Failed to add troops for queue entry {}: {:?}", entry.id, e);
+                error!("Failed to complete training queue entry {}: {:?}", entry.id, e);
+            }
+        }
+    }
+
+    Ok(count)
+}
+
+/// Process academy research completion every 10 seconds
+async fn run_research_completion_job(pool: PgPool, ws_manager: WsManager) {
+    let mut ticker = interval(Duration::from_secs(10));
+
+    loop {
+        ticker.tick().await;
+        let _queue = LagWatchdogService::queue_guard().await;
+
+        match complete_research(&pool, &ws_manager).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Completed {} researches", count);
+                }
+            }
+            Err(e) => {
+                error!("Error completing research: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Complete all research that has finished
+async fn complete_research(pool: &PgPool, ws_manager: &WsManager) -> anyhow::Result<i32> {
+    let due = ResearchRepository::find_completed(pool, clock::now()).await?;
+    let mut count = 0;
+
+    for entry in due {
+        match ResearchService::complete(pool, entry.id).await {
+            Ok(Some(done)) => {
+                if let Ok(Some(village)) = VillageRepository::find_by_id(pool, done.village_id).await {
+                    let event = WsEvent::ResearchComplete(ResearchCompleteData {
+                        village_id: done.village_id,
+                        troop_type: format!("{:?}", done.troop_type),
+                    });
+                    ws_manager.send_to_user(village.user_id, &event).await;
+                }
+                count += 1;
+            }
+            Ok(None) => {}
+            Err(e) => {
+                error!("Failed to complete research {}: {:?}", entry.id, e);
+            }
+        }
+    }
+
+    Ok(count)
+}
+
+/// Release healed troops from hospitals every 10 seconds
+async fn run_healing_completion_job(pool: PgPool, ws_manager: WsManager) {
+    let mut ticker = interval(Duration::from_secs(10));
+
+    loop {
+        ticker.tick().await;
+        let _queue = LagWatchdogService::queue_guard().await;
+
+        match complete_healing(&pool, &ws_manager).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Completed {} healings", count);
+                }
+            }
+            Err(e) => {
+                error!("Error completing healing: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Return all troops whose healing has finished to their villages
+async fn complete_healing(pool: &PgPool, ws_manager: &WsManager) -> anyhow::Result<i32> {
+    let due = HospitalRepository::find_completed(pool, clock::now()).await?;
+    let mut count = 0;
+
+    for entry in due {
+        match HospitalService::complete(pool, entry.id).await {
+            Ok(Some(done)) => {
+                if let Ok(Some(village)) = VillageRepository::find_by_id(pool, done.village_id).await {
+                    let event = WsEvent::HealingComplete(HealingCompleteData {
+                        village_id: done.village_id,
+                        troop_type: format!("{:?}", done.troop_type),
+                        quantity: done.count,
+                    });
+                    ws_manager.send_to_user(village.user_id, &event).await;
+                }
+                count += 1;
+            }
+            Ok(None) => {}
+            Err(e) => {
+                error!("Failed to complete healing {}: {:?}", entry.id, e);
             }
         }
     }
@@ -211,6 +640,26 @@ async fn complete_troop_training(pool: &PgPool, ws_manager: &WsManager) -> anyho
     Ok(count)
 }
 
+/// Close hero auctions whose time is up every 10 seconds
+async fn run_auction_close_job(pool: PgPool, ws_manager: WsManager) {
+    let mut ticker = interval(Duration::from_secs(10));
+
+    loop {
+        ticker.tick().await;
+
+        match AuctionService::close_due(&pool, &ws_manager).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Closed {} hero auctions", count);
+                }
+            }
+            Err(e) => {
+                error!("Error closing hero auctions: {:?}", e);
+            }
+        }
+    }
+}
+
 /// Process starvation every 60 seconds
 async fn run_starvation_job(pool: PgPool, ws_manager: WsManager) {
     let mut ticker = interval(Duration::from_secs(60));
@@ -231,6 +680,755 @@ async fn run_starvation_job(pool: PgPool, ws_manager: WsManager) {
     }
 }
 
+/// Publish last week's digest once the week is over, checked every hour.
+/// Opted-in players are mailed when email is configured, and it is posted
+/// to Discord when a webhook is.
+async fn run_weekly_digest_job(
+    pool: PgPool,
+    mailer: Option<Mailer>,
+    discord: Option<DiscordWebhook>,
+) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        if let Err(e) = DigestService::run(&pool, mailer.as_ref(), discord.as_ref()).await {
+            error!("Error publishing weekly digest: {:?}", e);
+        }
+    }
+}
+
+/// Mail batched warnings about attacks on offline players every 5 minutes
+async fn run_attack_warning_job(pool: PgPool, mailer: Mailer) {
+    let mut ticker = interval(Duration::from_secs(ATTACK_WARNING_INTERVAL_SECS));
+
+    loop {
+        ticker.tick().await;
+
+        match AttackWarningService::run(&pool, &mailer).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Sent {} attack warnings", count);
+                }
+            }
+            Err(e) => {
+                error!("Error sending attack warnings: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Apply report retention and archiving every hour
+async fn run_report_retention_job(pool: PgPool, config: Config) {
+    let store = match ArchiveStore::from_config(&config.archive) {
+        Ok(store) => store,
+        Err(e) => {
+            error!("Invalid archive storage config, archiving disabled: {:?}", e);
+            None
+        }
+    };
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match ReportRetentionService::run(&pool, store.as_ref()).await {
+            Ok(result) => {
+                if result.raids_deleted > 0 || result.scout_reports_deleted > 0 || result.reports_archived > 0 {
+                    info!(
+                        "Report retention: {} raids deleted, {} scout reports deleted, {} archived",
+                        result.raids_deleted, result.scout_reports_deleted, result.reports_archived
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error running report retention: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Export the public world dumps once a day
+async fn run_world_dump_job(pool: PgPool, config: Config) {
+    let store = match ArchiveStore::from_config(&config.archive) {
+        Ok(Some(store)) => store,
+        Ok(None) => {
+            info!("Archive storage not configured, world dumps disabled");
+            return;
+        }
+        Err(e) => {
+            error!("Invalid archive storage config, world dumps disabled: {:?}", e);
+            return;
+        }
+    };
+    let mut ticker = interval(Duration::from_secs(86400));
+
+    loop {
+        ticker.tick().await;
+
+        match WorldDumpService::run(&pool, &store).await {
+            Ok(result) => {
+                info!(
+                    "World dump: {} villages in {} files",
+                    result.village_count,
+                    result.dumps.len()
+                );
+            }
+            Err(e) => {
+                error!("Error writing world dump: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Purge soft-deleted rows past their retention every hour
+async fn run_soft_delete_purge_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match SoftDeleteService::purge(&pool).await {
+            Ok(result) => {
+                let total = result.messages_purged
+                    + result.battle_reports_purged
+                    + result.scout_reports_purged
+                    + result.notes_purged;
+                if total > 0 {
+                    info!(
+                        "Purged deleted rows: {} messages, {} battle reports, {} scout reports, {} notes",
+                        result.messages_purged,
+                        result.battle_reports_purged,
+                        result.scout_reports_purged,
+                        result.notes_purged
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error purging deleted rows: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Pay out culture points every 10 minutes
+async fn run_culture_production_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(600));
+
+    loop {
+        ticker.tick().await;
+
+        if let Err(e) = VillageStatsService::accrue_culture(&pool).await {
+            error!("Error producing culture points: {:?}", e);
+        }
+    }
+}
+
+/// Fix population and culture production that drifted from the buildings,
+/// every hour
+async fn run_village_stats_reconciliation_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match VillageStatsService::reconcile(&pool).await {
+            Ok(result) => {
+                if result.population_fixed > 0 || result.culture_fixed > 0 {
+                    info!(
+                        "Reconciled {} villages: fixed population in {}, culture in {}",
+                        result.checked, result.population_fixed, result.culture_fixed
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error reconciling village stats: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Check game-state invariants every 30 minutes
+async fn run_invariant_check_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(1800));
+
+    loop {
+        ticker.tick().await;
+
+        match InvariantService::check(&pool).await {
+            Ok(report) => {
+                let fixed: u64 = report.results.iter().map(|r| r.fixed).sum();
+                if fixed > 0 {
+                    info!("Invariant check repaired {} rows", fixed);
+                }
+            }
+            Err(e) => {
+                error!("Error checking invariants: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Deliver arrived merchant shipments every 5 seconds
+async fn run_market_delivery_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(5));
+
+    loop {
+        ticker.tick().await;
+        let _queue = LagWatchdogService::queue_guard().await;
+
+        match MarketService::deliver_arrived(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Delivered {} merchant shipments", count);
+                }
+            }
+            Err(e) => {
+                error!("Error delivering merchant shipments: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Check the scheduled queues for late processing every 30 seconds,
+/// catching up when they fall behind
+async fn run_lag_watchdog_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(30));
+
+    loop {
+        ticker.tick().await;
+
+        match LagWatchdogService::check(&pool).await {
+            Ok(result) => {
+                if let Some(catch_up) = result.catch_up {
+                    info!(
+                        "Caught up {} lagging queues: {:?}",
+                        result.lagging.len(),
+                        catch_up
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error checking queue lag: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Send scheduled wave armies that are due, checked every second so
+/// armies land within a second of the planned time
+async fn run_wave_send_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(1));
+
+    loop {
+        ticker.tick().await;
+
+        match WaveService::process_due(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Sent {} scheduled wave armies", count);
+                }
+            }
+            Err(e) => {
+                error!("Error sending scheduled waves: {:?}", e);
+            }
+        }
+    }
+}
+
+async fn run_scheduled_command_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(1));
+
+    loop {
+        ticker.tick().await;
+
+        match CommandService::process_scheduled(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Ran {} scheduled commands", count);
+                }
+            }
+            Err(e) => {
+                error!("Error running scheduled commands: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Flag inactive players and decay or abandon their villages every hour
+async fn run_inactivity_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match InactivityService::run(&pool).await {
+            Ok(result) => {
+                if result.players_flagged > 0
+                    || result.villages_decayed > 0
+                    || result.villages_to_natar > 0
+                    || result.villages_cleared > 0
+                {
+                    info!(
+                        "Inactivity: {} players flagged, {} villages decayed, {} to Natars, {} cleared",
+                        result.players_flagged,
+                        result.villages_decayed,
+                        result.villages_to_natar,
+                        result.villages_cleared
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error running inactivity job: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Prune domain events past the sync retention window every hour
+async fn run_domain_event_pruning_job(pool: PgPool, retention_hours: i64) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match SyncService::prune_events(&pool, retention_hours).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Pruned {} domain events", count);
+                }
+            }
+            Err(e) => {
+                error!("Error pruning domain events: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Drop audit log entries past the retention window every hour
+async fn run_audit_log_pruning_job(pool: PgPool, retention_days: i64) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match AuditService::prune(&pool, retention_days).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Pruned {} audit log entries", count);
+                }
+            }
+            Err(e) => {
+                error!("Error pruning audit log: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Pay referral milestones the referees have reached, every 10 minutes
+async fn run_referral_milestone_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(600));
+
+    loop {
+        ticker.tick().await;
+
+        match ReferralService::process_milestones(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Paid {} referral milestones", count);
+                }
+            }
+            Err(e) => {
+                error!("Error processing referral milestones: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Give out alliance awards for finished weeks, checked every hour
+async fn run_alliance_awards_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match AllianceStatsService::award_finished_weeks(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Gave weekly awards to {} alliances", count);
+                }
+            }
+            Err(e) => {
+                error!("Error giving alliance awards: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Evaluate region control and pay out victory points every 10 minutes
+async fn run_region_control_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(600));
+
+    loop {
+        ticker.tick().await;
+
+        match RegionService::run(&pool).await {
+            Ok(result) => {
+                if result.control_changes > 0 || result.points_awarded > 0 {
+                    info!(
+                        "Region control: {} regions changed hands, {} victory points awarded",
+                        result.control_changes, result.points_awarded
+                    );
+                }
+                if let Some(alliance_id) = result.winner {
+                    info!("Region control victory for alliance {}", alliance_id);
+                }
+            }
+            Err(e) => {
+                error!("Error evaluating region control: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Broadcast endgame milestones as the world reaches them, checked every minute
+async fn run_world_milestone_job(pool: PgPool, ws_manager: WsManager) {
+    let mut ticker = interval(Duration::from_secs(60));
+
+    loop {
+        ticker.tick().await;
+
+        match WorldStatusService::announce_milestones(&pool, &ws_manager).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Announced {} world milestones", count);
+                }
+            }
+            Err(e) => {
+                error!("Error announcing world milestones: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Send out invite waves that are due and expire unused invites, checked
+/// every minute
+async fn run_registration_wave_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(60));
+
+    loop {
+        ticker.tick().await;
+
+        match RegistrationService::process_due(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Sent {} registration invites", count);
+                }
+            }
+            Err(e) => {
+                error!("Error releasing registration waves: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Drop account activity past its retention window once a day
+async fn run_activity_pruning_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(86400));
+
+    loop {
+        ticker.tick().await;
+
+        match ActivityService::prune(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Pruned {} account activity entries", count);
+                }
+            }
+            Err(e) => {
+                error!("Error pruning account activity: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Reload building/unit definitions when their files change, checked
+/// every 2 seconds. A change that fails validation is logged and ignored.
+async fn run_gamedata_reload_job(pool: PgPool, config: GameDataConfig) {
+    let mut fingerprint = GameDataLoader::fingerprint(&config);
+    let mut ticker = interval(Duration::from_secs(2));
+
+    loop {
+        ticker.tick().await;
+
+        let current = GameDataLoader::fingerprint(&config);
+        if current == fingerprint {
+            continue;
+        }
+        fingerprint = current;
+
+        match GameDataLoader::reload(&pool, &config).await {
+            Ok(()) => {
+                info!("Reloaded game data");
+            }
+            Err(e) => {
+                error!("Rejected game data change, keeping previous definitions: {:#}", e);
+            }
+        }
+    }
+}
+
+/// Apply runtime config changes made by an admin (on any instance) every 10 seconds
+async fn run_runtime_config_job(pool: PgPool, config: Config) {
+    let mut ticker = interval(Duration::from_secs(10));
+
+    loop {
+        ticker.tick().await;
+
+        match RuntimeConfigService::refresh(&pool, &config).await {
+            Ok(changed) => {
+                if changed {
+                    info!("Applied runtime config change");
+                }
+            }
+            Err(e) => {
+                error!("Error loading runtime config: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Follow game clock jumps made by an admin (on any instance) every 2 seconds
+async fn run_clock_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(2));
+
+    loop {
+        ticker.tick().await;
+
+        match ClockService::refresh(&pool).await {
+            Ok(changed) => {
+                if changed {
+                    info!("Game clock offset or pause changed");
+                }
+            }
+            Err(e) => {
+                error!("Error loading game clock settings: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Correct for host clock drift against the database every minute
+async fn run_world_clock_sync_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(60));
+    // The first tick fires immediately; startup just synced
+    ticker.tick().await;
+
+    loop {
+        ticker.tick().await;
+
+        if let Err(e) = ClockService::sync(&pool).await {
+            error!("Error syncing the world clock: {:?}", e);
+        }
+    }
+}
+
+/// Re-fetch secrets from their secret manager so rotations are picked up
+async fn run_secret_rotation_job(secrets: SecretStore, refresh_secs: u64) {
+    let mut ticker = interval(Duration::from_secs(refresh_secs));
+    // The first tick fires immediately; startup just fetched everything
+    ticker.tick().await;
+
+    loop {
+        ticker.tick().await;
+
+        match secrets.refresh().await {
+            Ok(rotated) => {
+                if !rotated.is_empty() {
+                    info!("Rotated secrets: {}", rotated.join(", "));
+                }
+            }
+            Err(e) => {
+                error!("Error refreshing secrets: {:#}", e);
+            }
+        }
+    }
+}
+
+/// Re-measure read replica lag every 5 seconds so lagging or unreachable
+/// replicas drop out of rotation
+async fn run_replica_lag_job(read_db: ReadPool) {
+    let mut ticker = interval(Duration::from_secs(5));
+
+    loop {
+        ticker.tick().await;
+        read_db.check_lag().await;
+    }
+}
+
+/// Pick up world shard assignments made on other instances every 30 seconds
+async fn run_shard_directory_job(pool: PgPool, shards: ShardResolver) {
+    let mut ticker = interval(Duration::from_secs(30));
+
+    loop {
+        ticker.tick().await;
+
+        match ShardService::refresh(&pool, &shards).await {
+            Ok(true) => {
+                info!("World shard directory updated: {:?}", shards.sharded_worlds());
+            }
+            Ok(false) => {}
+            Err(e) => {
+                error!("Error refreshing world shard directory: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Drop cache entries made stale by new domain events every 2 seconds
+async fn run_cache_invalidation_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(2));
+
+    loop {
+        ticker.tick().await;
+
+        if let Err(e) = CacheService::apply_events(&pool).await {
+            error!("Error applying cache invalidations: {:?}", e);
+        }
+    }
+}
+
+/// Preload hot cache keys at startup and every 5 minutes
+async fn run_cache_warming_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(300));
+
+    loop {
+        ticker.tick().await;
+
+        match CacheService::warm(&pool).await {
+            Ok(warmed) => {
+                if warmed > 0 {
+                    info!("Warmed {} cache entries", warmed);
+                }
+            }
+            Err(e) => {
+                error!("Error warming cache: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Fold new domain events into the stats read models every 5 seconds
+async fn run_projection_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(5));
+
+    loop {
+        ticker.tick().await;
+
+        match ProjectionService::run_once(&pool).await {
+            Ok(result) => {
+                if result.events_applied > 0 {
+                    info!(
+                        "Projected {} events ({} players, {} alliances refreshed)",
+                        result.events_applied, result.players_refreshed, result.alliances_refreshed
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error running projections: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Keep the world statistics current every 5 minutes
+async fn run_world_stats_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(300));
+
+    loop {
+        ticker.tick().await;
+
+        if let Err(e) = WorldStatsService::refresh(&pool).await {
+            error!("Error refreshing world statistics: {:?}", e);
+        }
+    }
+}
+
+/// Log out sessions that went unused too long, every hour
+async fn run_session_expiry_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match SessionService::expire_idle(&pool).await {
+            Ok(count) => {
+                if count > 0 {
+                    info!("Expired {} idle sessions", count);
+                }
+            }
+            Err(e) => {
+                error!("Error expiring idle sessions: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Score players' command timing for signs of automation every hour
+async fn run_bot_detection_job(pool: PgPool) {
+    let mut ticker = interval(Duration::from_secs(3600));
+
+    loop {
+        ticker.tick().await;
+
+        match BotDetectionService::scan(&pool).await {
+            Ok(result) => {
+                if result.flagged > 0 {
+                    info!(
+                        "Bot detection flagged {} of {} active players",
+                        result.flagged, result.players_scanned
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error scanning for bots: {:?}", e);
+            }
+        }
+    }
+}
+
+/// Apply due world ticks (loyalty regeneration, oasis regrowth) every 30 seconds.
+/// Each instance claims whichever shards are free, so the work spreads
+/// across instances and missed ticks are caught up after a restart.
+async fn run_tick_coordinator(pool: PgPool, config: TickConfig) {
+    let worker_id = uuid::Uuid::new_v4();
+
+    if let Err(e) = TickService::ensure_shards(&pool, &config).await {
+        error!("Error preparing tick shards: {:?}", e);
+    }
+
+    let mut ticker = interval(Duration::from_secs(30));
+
+    loop {
+        ticker.tick().await;
+
+        match TickService::run_due(&pool, worker_id, &config).await {
+            Ok(result) => {
+                if result.shards_processed > 0 {
+                    info!(
+                        "World ticks: {} shards, {} ticks applied, {} skipped, {} villages updated, {} oases regrown",
+                        result.shards_processed, result.ticks_applied, result.ticks_skipped, result.villages_updated, result.oases_regrown
+                    );
+                }
+            }
+            Err(e) => {
+                error!("Error processing world ticks: {:?}", e);
+            }
+        }
+    }
+}
+
 /// Troop with consumption info for starvation calculation
 #[derive(Debug, sqlx::FromRow)]
 struct TroopWithConsumption {
@@ -0,0 +1,60 @@
+use sqlx::PgPool;
+
+use crate::error::AppResult;
+use crate::models::bootstrap::{BootstrapResponse, UnreadCounts};
+use crate::models::user::User;
+use crate::repositories::army_repo::ArmyRepository;
+use crate::repositories::domain_event_repo::DomainEventRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::army_service::ArmyService;
+use crate::services::message_service::MessageService;
+use crate::services::runtime_config_service;
+use crate::services::world_status_service::WorldStatusService;
+
+pub struct BootstrapService;
+
+impl BootstrapService {
+    /// The client's startup state, loaded concurrently
+    pub async fn load(pool: &PgPool, user: User) -> AppResult<BootstrapResponse> {
+        // Taken first, so a change made while loading is sent again by the
+        // next sync rather than missed
+        let sync_cursor = DomainEventRepository::safe_head(pool).await?;
+
+        let (
+            email_preferences,
+            villages,
+            messages,
+            alliance_messages,
+            reports,
+            outgoing,
+            incoming,
+            world,
+        ) = tokio::try_join!(
+            UserRepository::get_email_preferences(pool, user.id),
+            VillageRepository::find_by_user_id(pool, user.id),
+            MessageService::get_unread_count(pool, user.id),
+            MessageService::get_unread_alliance_count(pool, user.id),
+            ArmyService::get_total_unread_count(pool, user.id),
+            ArmyRepository::find_by_player(pool, user.id),
+            ArmyRepository::find_incoming_to_player(pool, user.id),
+            WorldStatusService::status(pool),
+        )?;
+
+        Ok(BootstrapResponse {
+            user: user.into(),
+            email_preferences,
+            features: runtime_config_service::current().features.clone(),
+            villages: villages.into_iter().map(Into::into).collect(),
+            unread: UnreadCounts {
+                messages,
+                alliance_messages,
+                reports,
+            },
+            outgoing: outgoing.into_iter().map(Into::into).collect(),
+            incoming: incoming.into_iter().map(Into::into).collect(),
+            world,
+            sync_cursor,
+        })
+    }
+}
@@ -0,0 +1,163 @@
+use chrono::{DateTime, Duration, Timelike, Utc};
+use sqlx::PgPool;
+use std::collections::{HashMap, HashSet};
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::bot_detection::{
+    BotReviewQuery, BotScanResult, BotSignals, BotSuspicion, ReviewBotSuspicionRequest,
+    ANALYSIS_WINDOW_HOURS, CHALLENGE_SCORE, MAX_GAP_SECS, MIN_COMMANDS, REVIEW_SCORE,
+};
+use crate::repositories::bot_detection_repo::BotDetectionRepository;
+use crate::services::clock;
+
+/// Scores players on how scripted their command timing looks and keeps the
+/// admin review queue
+pub struct BotDetectionService;
+
+impl BotDetectionService {
+    /// Score everyone active in the analysis window. Players above the
+    /// review score are queued (or have their scores refreshed).
+    pub async fn scan(pool: &PgPool) -> AppResult<BotScanResult> {
+        let since = clock::now() - Duration::hours(ANALYSIS_WINDOW_HOURS);
+        let players =
+            BotDetectionRepository::active_players(pool, since, MIN_COMMANDS as i64).await?;
+
+        let mut flagged = 0;
+        for user_id in &players {
+            let times = BotDetectionRepository::command_times(pool, *user_id, since).await?;
+            let Some(signals) = analyze(&times) else {
+                continue;
+            };
+
+            let score = signals.score();
+            if score < REVIEW_SCORE {
+                continue;
+            }
+
+            BotDetectionRepository::upsert(
+                pool,
+                *user_id,
+                &signals,
+                score,
+                score >= CHALLENGE_SCORE,
+            )
+            .await?;
+            flagged += 1;
+
+            info!(
+                "Player {} looks scripted: score {}, entropy {:.2} bits, {} active hours, \
+                 {} commands at peak minute",
+                user_id,
+                score,
+                signals.timing_entropy,
+                signals.active_hours,
+                signals.peak_per_minute
+            );
+        }
+
+        Ok(BotScanResult {
+            players_scanned: players.len() as i32,
+            flagged,
+        })
+    }
+
+    /// Whether the player must pass a challenge before acting
+    pub async fn challenge_required(pool: &PgPool, user_id: Uuid) -> AppResult<bool> {
+        Ok(BotDetectionRepository::find_by_user(pool, user_id)
+            .await?
+            .is_some_and(|s| s.challenge_required))
+    }
+
+    pub async fn pass_challenge(pool: &PgPool, user_id: Uuid) -> AppResult<()> {
+        BotDetectionRepository::clear_challenge(pool, user_id).await
+    }
+
+    pub async fn review_queue(
+        pool: &PgPool,
+        query: BotReviewQuery,
+    ) -> AppResult<Vec<BotSuspicion>> {
+        BotDetectionRepository::list_by_status(
+            pool,
+            query.status,
+            query.limit.min(200).max(1),
+            query.offset.max(0),
+        )
+        .await
+    }
+
+    pub async fn review(
+        pool: &PgPool,
+        admin_id: Uuid,
+        user_id: Uuid,
+        request: ReviewBotSuspicionRequest,
+    ) -> AppResult<BotSuspicion> {
+        let suspicion = BotDetectionRepository::review(
+            pool,
+            user_id,
+            request.status,
+            admin_id,
+            request.note.as_deref(),
+            clock::now(),
+        )
+        .await?
+        .ok_or_else(|| AppError::NotFound("Player is not in the review queue".into()))?;
+
+        info!(
+            "Admin {} reviewed suspected bot {}: {:?}",
+            admin_id, user_id, suspicion.status
+        );
+
+        Ok(suspicion)
+    }
+}
+
+/// Signals from a player's command times, oldest first. None when there
+/// are too few commands to judge.
+fn analyze(times: &[DateTime<Utc>]) -> Option<BotSignals> {
+    if times.len() < MIN_COMMANDS {
+        return None;
+    }
+
+    let hours: HashSet<u32> = times.iter().map(|t| t.hour()).collect();
+
+    Some(BotSignals {
+        timing_entropy: gap_entropy(times),
+        active_hours: hours.len() as i32,
+        peak_per_minute: peak_per_minute(times),
+        commands_analyzed: times.len() as i32,
+    })
+}
+
+/// Shannon entropy, in bits, of the gaps between commands in whole
+/// seconds. People are irregular; a script firing every few seconds is not.
+fn gap_entropy(times: &[DateTime<Utc>]) -> f64 {
+    let mut buckets: HashMap<i64, usize> = HashMap::new();
+    for pair in times.windows(2) {
+        let gap = (pair[1] - pair[0]).num_seconds().min(MAX_GAP_SECS);
+        *buckets.entry(gap).or_default() += 1;
+    }
+
+    let total = (times.len() - 1) as f64;
+    buckets
+        .values()
+        .map(|&count| {
+            let p = count as f64 / total;
+            -p * p.log2()
+        })
+        .sum()
+}
+
+/// Most commands inside any sliding 60-second window
+fn peak_per_minute(times: &[DateTime<Utc>]) -> i32 {
+    let mut peak = 0;
+    let mut start = 0;
+    for end in 0..times.len() {
+        while times[end] - times[start] >= Duration::seconds(60) {
+            start += 1;
+        }
+        peak = peak.max(end - start + 1);
+    }
+    peak as i32
+}
@@ -1,10 +1,24 @@
+use async_trait::async_trait;
+use chrono::{DateTime, Utc};
 use sqlx::PgPool;
+use tracing::{error, info, warn};
 use uuid::Uuid;
 
-use crate::error::{AppError, AppResult};
-use crate::models::building::{Building, BuildingType};
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::models::building::{
+    BuildOrder, BuildResponse, BuildSlot, BuildSlotsResponse, Building, BuildingCost,
+    BuildingType, CreateBuilding, UpgradeResponse, PREMIUM_WAITING_SLOTS,
+};
+use crate::models::gamedata::definitions;
+use crate::models::shop::SubscriptionType;
+use crate::models::village::{Village, NON_CAPITAL_FIELD_MAX_LEVEL};
 use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::shop_repo::ShopRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock::{self, Clock};
+use crate::services::resource_service::ResourceService;
+use crate::services::tribe_service::TribeService;
+use crate::services::village_stats_service::VillageStatsService;
 
 pub struct BuildingService;
 
@@ -65,16 +79,285 @@ impl BuildingService {
                 .map(|m| format!("{:?} Lv.{}", m.building_type, m.required_level))
                 .collect::<Vec<_>>()
                 .join(", ");
-            return Err(AppError::BadRequest(format!("Missing prerequisites: {}", msg)));
+            return Err(AppError::Game(
+                ErrorCode::MissingPrerequisites,
+                format!("Missing prerequisites: {}", msg),
+            ));
         }
 
         Ok(())
     }
 
+    /// Place a new building in an empty slot and start its first level.
+    /// The caller has already checked the village belongs to the player.
+    pub async fn build(
+        pool: &PgPool,
+        village: &Village,
+        slot: i32,
+        building_type: BuildingType,
+    ) -> AppResult<BuildResponse> {
+        // Check if slot is empty
+        if BuildingRepository::find_by_village_and_slot(pool, village.id, slot)
+            .await?
+            .is_some()
+        {
+            return Err(ErrorCode::SlotOccupied.into());
+        }
+
+        let waiting = BuildingRepository::find_orders(pool, village.id).await?;
+        if waiting.iter().any(|o| o.building_id.is_none() && o.slot == slot) {
+            return Err(AppError::Conflict(
+                "A building is already waiting for this slot".to_string(),
+            ));
+        }
+
+        // Tribe buildings are reserved for their tribe
+        let tribe = TribeService::player_tribe(pool, village.user_id).await?;
+        TribeService::check_can_build(tribe, &building_type)?;
+
+        // Check prerequisites
+        Self::validate_can_build(pool, village.id, &building_type).await?;
+
+        // Get cost for level 1
+        let cost = building_type.cost_at_level(1);
+
+        // Check resources
+        if village.wood < cost.wood
+            || village.clay < cost.clay
+            || village.iron < cost.iron
+            || village.crop < cost.crop
+        {
+            return Err(ErrorCode::InsufficientResources.into());
+        }
+
+        let rules = SlotRules::for_player(pool, village.user_id).await?;
+        let active = BuildingRepository::find_upgrading_by_village(pool, village.id).await?;
+        if !rules.is_free(&building_type, &active, &waiting) {
+            let order = Self::enqueue(
+                pool,
+                village,
+                &rules,
+                &waiting,
+                None,
+                slot,
+                &building_type,
+                1,
+                &cost,
+            )
+            .await?;
+            return Ok(BuildResponse {
+                building: None,
+                cost,
+                waiting: Some(order),
+            });
+        }
+
+        // Pay, place the building and start its timer together, so a failure
+        // part way leaves neither spent resources nor a building stuck at
+        // level 1 without an upgrade
+        let mut tx = pool.begin().await?;
+
+        // Deduct resources, failing if the village changed since it was read
+        VillageRepository::deduct_resources_versioned(
+            &mut *tx,
+            village.id,
+            village.version,
+            cost.wood,
+            cost.clay,
+            cost.iron,
+            cost.crop,
+        )
+        .await?;
+
+        // Create building
+        let create = CreateBuilding {
+            village_id: village.id,
+            building_type: building_type.clone(),
+            slot,
+        };
+        let building = BuildingRepository::create(&mut *tx, create).await?;
+
+        // Start upgrade timer
+        let upgrade_ends_at = clock::now() + chrono::Duration::seconds(cost.time_seconds as i64);
+        let building = BuildingRepository::start_upgrade(
+            &mut *tx,
+            building.id,
+            building.version,
+            upgrade_ends_at,
+        )
+        .await?;
+        tx.commit().await?;
+
+        info!(
+            "Building {:?} started at slot {} in village {}",
+            building_type, slot, village.id
+        );
+
+        Ok(BuildResponse {
+            building: Some(building.into()),
+            cost,
+            waiting: None,
+        })
+    }
+
+    /// Start upgrading the building in `slot` to the next level, or queue
+    /// the upgrade if its build slot is busy. Upgrades already running or
+    /// waiting for the building count towards the level.
+    pub async fn upgrade(pool: &PgPool, village: &Village, slot: i32) -> AppResult<UpgradeResponse> {
+        let building = BuildingRepository::find_by_village_and_slot(pool, village.id, slot)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Building not found".to_string()))?;
+
+        let waiting = BuildingRepository::find_orders(pool, village.id).await?;
+        let queued = waiting
+            .iter()
+            .filter(|o| o.building_id == Some(building.id))
+            .count() as i32;
+
+        let next_level = building.level + 1 + building.is_upgrading as i32 + queued;
+        if next_level > building.building_type.max_level() {
+            return Err(ErrorCode::MaxLevel.into());
+        }
+
+        // Only the capital grows its fields past level 10
+        if building.building_type.is_resource_field()
+            && !village.is_capital
+            && next_level > NON_CAPITAL_FIELD_MAX_LEVEL
+        {
+            return Err(AppError::Game(
+                ErrorCode::CapitalOnly,
+                format!(
+                    "Resource fields above level {} are only possible in the capital",
+                    NON_CAPITAL_FIELD_MAX_LEVEL
+                ),
+            ));
+        }
+
+        let cost = building.building_type.cost_at_level(next_level);
+
+        // Check resources
+        if village.wood < cost.wood
+            || village.clay < cost.clay
+            || village.iron < cost.iron
+            || village.crop < cost.crop
+        {
+            return Err(ErrorCode::InsufficientResources.into());
+        }
+
+        let rules = SlotRules::for_player(pool, village.user_id).await?;
+        let active = BuildingRepository::find_upgrading_by_village(pool, village.id).await?;
+        if !rules.is_free(&building.building_type, &active, &waiting) {
+            let order = Self::enqueue(
+                pool,
+                village,
+                &rules,
+                &waiting,
+                Some(building.id),
+                slot,
+                &building.building_type,
+                next_level,
+                &cost,
+            )
+            .await?;
+            return Ok(UpgradeResponse {
+                building: building.into(),
+                cost,
+                waiting: Some(order),
+            });
+        }
+
+        // Claim the building and pay together; a concurrent upgrade of the
+        // same slot loses on the claim
+        let mut tx = pool.begin().await?;
+        let upgrade_ends_at = clock::now() + chrono::Duration::seconds(cost.time_seconds as i64);
+        let building = BuildingRepository::start_upgrade(
+            &mut *tx,
+            building.id,
+            building.version,
+            upgrade_ends_at,
+        )
+        .await?;
+
+        // Deduct resources, failing if the village changed since it was read
+        VillageRepository::deduct_resources_versioned(
+            &mut *tx,
+            village.id,
+            village.version,
+            cost.wood,
+            cost.clay,
+            cost.iron,
+            cost.crop,
+        )
+        .await?;
+        tx.commit().await?;
+
+        info!(
+            "Upgrading {:?} to level {} in village {}",
+            building.building_type, next_level, village.id
+        );
+
+        Ok(UpgradeResponse {
+            building: building.into(),
+            cost,
+            waiting: None,
+        })
+    }
+
+    /// Remove the building in `slot`
+    pub async fn demolish(pool: &PgPool, village_id: Uuid, slot: i32) -> AppResult<()> {
+        let building = BuildingRepository::find_by_village_and_slot(pool, village_id, slot)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Building not found".to_string()))?;
+
+        // Some buildings cannot be demolished
+        if building.building_type == BuildingType::MainBuilding && building.level > 0 {
+            return Err(AppError::Game(
+                ErrorCode::CannotDemolish,
+                "Cannot demolish Main Building".to_string(),
+            ));
+        }
+
+        // Upgrades waiting for the building are refunded, not lost with it.
+        // Cancelling the first cancels the ones after it.
+        let orders = BuildingRepository::find_orders(pool, village_id).await?;
+        if let Some(order) = orders.iter().find(|o| o.building_id == Some(building.id)) {
+            Self::cancel_order(pool, village_id, order.id).await?;
+        }
+
+        ResourceService::update_village_resources(pool, village_id).await?;
+        BuildingRepository::demolish(pool, building.id).await?;
+        if matches!(building.building_type, BuildingType::Warehouse | BuildingType::Granary) {
+            Self::update_village_storage(pool, village_id).await?;
+        }
+        Self::update_village_population(pool, village_id).await?;
+
+        if building.is_upgrading {
+            Self::start_waiting(pool, village_id, clock::now()).await?;
+        }
+
+        info!(
+            "Building {:?} demolished at slot {} in village {}",
+            building.building_type, slot, village_id
+        );
+
+        Ok(())
+    }
+
     /// Complete a building upgrade and handle side effects
     pub async fn complete_upgrade(pool: &PgPool, building_id: Uuid) -> AppResult<Building> {
+        // Production up to the moment the upgrade finished still counts
+        // under the old storage and rates, however late the job runs
+        let now = clock::now();
+        let mut finished_at = now;
+        if let Some(building) = BuildingRepository::find_by_id(pool, building_id).await? {
+            finished_at = building.upgrade_ends_at.map_or(now, |t| t.min(now));
+            ResourceService::settle(pool, building.village_id, finished_at).await?;
+        }
+
         // Complete the upgrade
-        let building = BuildingRepository::complete_upgrade(pool, building_id).await?;
+        let building = BuildingRepository::complete_upgrade(pool, building_id)
+            .await?
+            .ok_or_else(|| AppError::Conflict("Building is not upgrading".into()))?;
 
         // Handle side effects based on building type
         match building.building_type {
@@ -87,13 +370,266 @@ impl BuildingService {
         // Always update population after any building upgrade
         Self::update_village_population(pool, building.village_id).await?;
 
+        // The slot is free for whatever waited for it, from when it freed up
+        if let Err(e) = Self::start_waiting(pool, building.village_id, finished_at).await {
+            error!(
+                "Failed to start waiting builds in village {}: {:?}",
+                building.village_id, e
+            );
+        }
+
         Ok(building)
     }
 
-    /// Recalculate and update village storage capacity based on all Warehouse/Granary buildings
-    pub async fn update_village_storage(pool: &PgPool, village_id: Uuid) -> AppResult<()> {
-        let buildings = BuildingRepository::find_by_village_id(pool, village_id).await?;
+    /// Complete every upgrade of `queue` finished by `clock`'s time, oldest
+    /// first. One that fails is logged and left for the next run; one
+    /// completed elsewhere meanwhile is skipped.
+    pub async fn complete_due_upgrades(
+        queue: &dyn BuildingQueue,
+        clock: &dyn Clock,
+    ) -> AppResult<Vec<Building>> {
+        let due = queue.find_completed(clock.now()).await?;
+
+        let mut completed = Vec::new();
+        for building in due {
+            match queue.complete(&building).await {
+                Ok(Some(updated)) => completed.push(updated),
+                Ok(None) => {}
+                Err(e) => {
+                    error!("Error completing upgrade for building {}: {:?}", building.id, e);
+                }
+            }
+        }
+
+        Ok(completed)
+    }
+
+    // ==================== Build Queue ====================
+
+    pub async fn get_build_queue(
+        pool: &PgPool,
+        village: &Village,
+    ) -> AppResult<BuildSlotsResponse> {
+        let rules = SlotRules::for_player(pool, village.user_id).await?;
+        let active = BuildingRepository::find_upgrading_by_village(pool, village.id).await?;
+        let waiting = BuildingRepository::find_orders(pool, village.id).await?;
+
+        Ok(BuildSlotsResponse {
+            slots: rules.slots(),
+            waiting_slots: rules.waiting_slots,
+            active: active.into_iter().map(Into::into).collect(),
+            waiting,
+        })
+    }
+
+    /// Pay for an order and queue it until its slot frees up
+    #[allow(clippy::too_many_arguments)]
+    async fn enqueue(
+        pool: &PgPool,
+        village: &Village,
+        rules: &SlotRules,
+        waiting: &[BuildOrder],
+        building_id: Option<Uuid>,
+        slot: i32,
+        building_type: &BuildingType,
+        target_level: i32,
+        cost: &BuildingCost,
+    ) -> AppResult<BuildOrder> {
+        if waiting.len() as i64 >= rules.waiting_slots {
+            let message = if rules.waiting_slots == 0 {
+                "Another build is in progress; with a premium subscription the next order can wait"
+            } else {
+                "All build slots are busy"
+            };
+            return Err(AppError::Game(ErrorCode::QueueFull, message.to_string()));
+        }
 
+        VillageRepository::deduct_resources_versioned(
+            pool,
+            village.id,
+            village.version,
+            cost.wood,
+            cost.clay,
+            cost.iron,
+            cost.crop,
+        )
+        .await?;
+
+        let order = BuildingRepository::create_order(
+            pool,
+            village.id,
+            building_id,
+            slot,
+            building_type,
+            target_level,
+            cost,
+        )
+        .await?;
+
+        info!(
+            "Queued {:?} level {} at slot {} in village {}",
+            building_type, target_level, slot, village.id
+        );
+
+        Ok(order)
+    }
+
+    /// Start waiting orders whose slot is free, oldest first, as if they
+    /// started at `from`. An order that can no longer start (its building
+    /// is gone or changed) is dropped and refunded. Returns how many started.
+    pub async fn start_waiting(
+        pool: &PgPool,
+        village_id: Uuid,
+        from: DateTime<Utc>,
+    ) -> AppResult<i32> {
+        let orders = BuildingRepository::find_orders(pool, village_id).await?;
+        if orders.is_empty() {
+            return Ok(0);
+        }
+
+        let village = VillageRepository::find_by_id(pool, village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+        let rules = SlotRules::for_player(pool, village.user_id).await?;
+
+        let active = BuildingRepository::find_upgrading_by_village(pool, village_id).await?;
+        let mut busy: Vec<BuildSlot> = active
+            .iter()
+            .map(|b| rules.slot_for(&b.building_type))
+            .collect();
+
+        let mut started = 0;
+        for order in orders {
+            let slot = rules.slot_for(&order.building_type);
+            if busy.contains(&slot) {
+                continue;
+            }
+            let Some(order) = BuildingRepository::take_order(pool, order.id).await? else {
+                continue;
+            };
+
+            match Self::start_order(pool, &order, from).await {
+                Ok(building) => {
+                    info!(
+                        "Started waiting {:?} level {} at slot {} in village {}",
+                        building.building_type, order.target_level, building.slot, village_id
+                    );
+                    busy.push(slot);
+                    started += 1;
+                }
+                Err(e) => {
+                    warn!("Dropping build order {}: {:?}", order.id, e);
+                    Self::refund(pool, &order).await?;
+                }
+            }
+        }
+
+        Ok(started)
+    }
+
+    async fn start_order(
+        pool: &PgPool,
+        order: &BuildOrder,
+        from: DateTime<Utc>,
+    ) -> AppResult<Building> {
+        let building = match order.building_id {
+            Some(id) => {
+                let building = BuildingRepository::find_by_id(pool, id)
+                    .await?
+                    .ok_or_else(|| AppError::NotFound("Building not found".to_string()))?;
+                if building.is_upgrading || building.level + 1 != order.target_level {
+                    return Err(AppError::Conflict(
+                        "Building changed since the order was placed".to_string(),
+                    ));
+                }
+                building
+            }
+            None => {
+                if BuildingRepository::find_by_village_and_slot(pool, order.village_id, order.slot)
+                    .await?
+                    .is_some()
+                {
+                    return Err(ErrorCode::SlotOccupied.into());
+                }
+                // A new building only exists once its timer is running
+                let create = CreateBuilding {
+                    village_id: order.village_id,
+                    building_type: order.building_type.clone(),
+                    slot: order.slot,
+                };
+                let upgrade_ends_at = from + chrono::Duration::seconds(order.time_seconds as i64);
+                let mut tx = pool.begin().await?;
+                let building = BuildingRepository::create(&mut *tx, create).await?;
+                let building = BuildingRepository::start_upgrade(
+                    &mut *tx,
+                    building.id,
+                    building.version,
+                    upgrade_ends_at,
+                )
+                .await?;
+                tx.commit().await?;
+                return Ok(building);
+            }
+        };
+
+        let upgrade_ends_at = from + chrono::Duration::seconds(order.time_seconds as i64);
+        BuildingRepository::start_upgrade(pool, building.id, building.version, upgrade_ends_at)
+            .await
+    }
+
+    /// Cancel a waiting order and refund it. Later upgrades of the same
+    /// building depend on it, so they are cancelled too.
+    pub async fn cancel_order(
+        pool: &PgPool,
+        village_id: Uuid,
+        order_id: Uuid,
+    ) -> AppResult<Vec<BuildOrder>> {
+        let orders = BuildingRepository::find_orders(pool, village_id).await?;
+        let order = orders
+            .iter()
+            .find(|o| o.id == order_id)
+            .ok_or_else(|| AppError::NotFound("Build order not found".to_string()))?;
+
+        let mut cancelled = Vec::new();
+        for other in &orders {
+            let depends = other.id == order.id
+                || (order.building_id.is_some()
+                    && other.building_id == order.building_id
+                    && other.target_level > order.target_level);
+            if !depends {
+                continue;
+            }
+            if let Some(taken) = BuildingRepository::take_order(pool, other.id).await? {
+                Self::refund(pool, &taken).await?;
+                cancelled.push(taken);
+            }
+        }
+
+        info!(
+            "Cancelled {} build orders in village {}",
+            cancelled.len(),
+            village_id
+        );
+
+        Ok(cancelled)
+    }
+
+    /// Give back what an order paid; stock over capacity is lost as usual
+    async fn refund(pool: &PgPool, order: &BuildOrder) -> AppResult<()> {
+        VillageRepository::add_resources(
+            pool,
+            order.village_id,
+            order.wood,
+            order.clay,
+            order.iron,
+            order.crop,
+        )
+        .await?;
+        Ok(())
+    }
+
+    /// (warehouse, granary) capacity the village's buildings add up to
+    pub fn storage_capacity(buildings: &[Building]) -> (i32, i32) {
         let mut warehouse_capacity = 800; // Base capacity
         let mut granary_capacity = 800; // Base capacity
 
@@ -109,23 +645,101 @@ impl BuildingService {
             }
         }
 
+        (warehouse_capacity, granary_capacity)
+    }
+
+    /// Recalculate and update village storage capacity based on all Warehouse/Granary buildings
+    pub async fn update_village_storage(pool: &PgPool, village_id: Uuid) -> AppResult<()> {
+        let buildings = BuildingRepository::find_by_village_id(pool, village_id).await?;
+        let (warehouse_capacity, granary_capacity) = Self::storage_capacity(&buildings);
+
         VillageRepository::update_storage_capacity(pool, village_id, warehouse_capacity, granary_capacity)
             .await?;
 
         Ok(())
     }
 
-    /// Recalculate and update village population based on all buildings
+    /// Recalculate and update village population (and culture production)
+    /// based on all buildings
     pub async fn update_village_population(pool: &PgPool, village_id: Uuid) -> AppResult<()> {
-        let buildings = BuildingRepository::find_by_village_id(pool, village_id).await?;
+        VillageStatsService::recalculate(pool, village_id).await?;
+        Ok(())
+    }
+}
 
-        let population: i32 = buildings
-            .iter()
-            .map(|b| b.building_type.population_at_level(b.level))
-            .sum();
+/// The build slots a player has
+struct SlotRules {
+    /// Fields and village buildings have a slot each
+    split: bool,
+    waiting_slots: i64,
+}
 
-        VillageRepository::update_population(pool, village_id, population).await?;
+impl SlotRules {
+    async fn for_player(pool: &PgPool, user_id: Uuid) -> AppResult<Self> {
+        let tribe = TribeService::player_tribe(pool, user_id).await?;
+        let split = definitions()
+            .tribe(tribe)
+            .is_some_and(|t| t.split_build_queue);
+        let premium =
+            ShopRepository::get_active_subscription(pool, user_id, SubscriptionType::TravianPlus)
+                .await?
+                .is_some();
 
-        Ok(())
+        Ok(Self {
+            split,
+            waiting_slots: if premium { PREMIUM_WAITING_SLOTS } else { 0 },
+        })
+    }
+
+    fn slots(&self) -> Vec<BuildSlot> {
+        if self.split {
+            vec![BuildSlot::Fields, BuildSlot::Buildings]
+        } else {
+            vec![BuildSlot::Any]
+        }
+    }
+
+    fn slot_for(&self, building_type: &BuildingType) -> BuildSlot {
+        BuildSlot::for_building(self.split, building_type)
+    }
+
+    /// Whether an order can start now: nothing is building in its slot and
+    /// nothing is waiting for it
+    fn is_free(
+        &self,
+        building_type: &BuildingType,
+        active: &[Building],
+        waiting: &[BuildOrder],
+    ) -> bool {
+        let slot = self.slot_for(building_type);
+        !active.iter().any(|b| self.slot_for(&b.building_type) == slot)
+            && !waiting.iter().any(|o| self.slot_for(&o.building_type) == slot)
+    }
+}
+
+/// Finished upgrades as `BuildingService` completes them: Postgres in the
+/// server, memory in unit tests (see `testing::InMemoryBuildingQueue`)
+#[async_trait]
+pub trait BuildingQueue: Send + Sync {
+    /// Upgrades finished by `now`, oldest first
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<Building>>;
+
+    /// Raise the building a level, with everything that follows from it;
+    /// None if it was completed first ("Finish Now", another instance)
+    async fn complete(&self, building: &Building) -> AppResult<Option<Building>>;
+}
+
+#[async_trait]
+impl BuildingQueue for PgPool {
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<Building>> {
+        BuildingRepository::find_completed_upgrades(self, now).await
+    }
+
+    async fn complete(&self, building: &Building) -> AppResult<Option<Building>> {
+        match BuildingService::complete_upgrade(self, building.id).await {
+            Ok(updated) => Ok(Some(updated)),
+            Err(AppError::Conflict(_)) => Ok(None),
+            Err(e) => Err(e),
+        }
     }
 }
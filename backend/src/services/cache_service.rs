@@ -0,0 +1,284 @@
+use chrono::Utc;
+use redis::AsyncCommands;
+use serde::de::DeserializeOwned;
+use serde::Serialize;
+use sqlx::PgPool;
+use std::future::Future;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::OnceLock;
+use tracing::warn;
+use uuid::Uuid;
+
+use crate::db::redis::RedisConnection;
+use crate::error::AppResult;
+use crate::models::domain_event::{ACTION_DELETE, ENTITY_VILLAGE};
+use crate::models::ops_metrics::CacheStats;
+use crate::models::projection::CACHE_PROJECTION;
+use crate::repositories::domain_event_repo::DomainEventRepository;
+use crate::repositories::projection_repo::ProjectionRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::projection_service::ProjectionService;
+
+/// Cached map areas, scored by expiry, so invalidation can find the areas
+/// covering a village without scanning the keyspace
+const MAP_INDEX: &str = "cache:map:index";
+
+/// Events consumed per run
+const BATCH_SIZE: i64 = 5000;
+
+/// Map views preloaded around the world center
+const WARM_MAP_RANGES: &[i32] = &[7, 15];
+
+static REDIS: OnceLock<RedisConnection> = OnceLock::new();
+
+/// Reads of `get_or_load` since startup, for the ops metrics
+static HITS: AtomicU64 = AtomicU64::new(0);
+static MISSES: AtomicU64 = AtomicU64::new(0);
+static ERRORS: AtomicU64 = AtomicU64::new(0);
+
+/// Called once at startup; until then (and whenever Redis fails) every
+/// read goes straight to the database
+pub fn install(redis: RedisConnection) {
+    let _ = REDIS.set(redis);
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum CacheKey {
+    TopRankings,
+    WorldStats,
+    WorldSetting(String),
+    MapArea { x: i32, y: i32, range: i32 },
+    /// Edited version in use of a message template
+    Template { name: String, locale: String },
+}
+
+impl CacheKey {
+    fn name(&self) -> String {
+        match self {
+            CacheKey::TopRankings => "cache:rankings:top".to_string(),
+            CacheKey::WorldStats => "cache:world_stats".to_string(),
+            CacheKey::WorldSetting(key) => format!("cache:world_setting:{}", key),
+            CacheKey::MapArea { x, y, range } => format!("cache:map:{}:{}:{}", x, y, range),
+            CacheKey::Template { name, locale } => format!("cache:template:{}:{}", name, locale),
+        }
+    }
+
+    /// Upper bound on staleness should an invalidation be lost
+    fn ttl_secs(&self) -> u64 {
+        match self {
+            CacheKey::TopRankings => 300,
+            CacheKey::WorldStats => 300,
+            CacheKey::WorldSetting(_) => 300,
+            CacheKey::MapArea { .. } => 60,
+            CacheKey::Template { .. } => 300,
+        }
+    }
+}
+
+pub struct CacheService;
+
+impl CacheService {
+    /// The cached value, or `load`'s result which is then cached. The cache
+    /// is never required: Redis errors fall back to `load`.
+    pub async fn get_or_load<T, F, Fut>(key: CacheKey, load: F) -> AppResult<T>
+    where
+        T: Serialize + DeserializeOwned,
+        F: FnOnce() -> Fut,
+        Fut: Future<Output = AppResult<T>>,
+    {
+        let Some(mut redis) = REDIS.get().cloned() else {
+            return load().await;
+        };
+
+        let name = key.name();
+        match redis.get::<_, Option<String>>(&name).await {
+            Ok(Some(cached)) => match serde_json::from_str(&cached) {
+                Ok(value) => {
+                    HITS.fetch_add(1, Ordering::Relaxed);
+                    return Ok(value);
+                }
+                Err(e) => {
+                    warn!("Discarding unreadable cache entry {}: {}", name, e);
+                    MISSES.fetch_add(1, Ordering::Relaxed);
+                }
+            },
+            Ok(None) => {
+                MISSES.fetch_add(1, Ordering::Relaxed);
+            }
+            Err(e) => {
+                warn!("Cache read failed for {}: {}", name, e);
+                ERRORS.fetch_add(1, Ordering::Relaxed);
+                return load().await;
+            }
+        }
+
+        let value = load().await?;
+        Self::store(&mut redis, &key, &value).await;
+        Ok(value)
+    }
+
+    /// Hits and misses since startup. Reads without Redis configured
+    /// aren't counted.
+    pub fn stats() -> CacheStats {
+        let hits = HITS.load(Ordering::Relaxed);
+        let misses = MISSES.load(Ordering::Relaxed);
+        let errors = ERRORS.load(Ordering::Relaxed);
+        let reads = hits + misses + errors;
+
+        CacheStats {
+            hits,
+            misses,
+            errors,
+            hit_ratio: (reads > 0).then(|| hits as f64 / reads as f64),
+        }
+    }
+
+    /// Drop entries whose source data changed
+    pub async fn invalidate(keys: &[CacheKey]) {
+        let Some(mut redis) = REDIS.get().cloned() else {
+            return;
+        };
+
+        for key in keys {
+            if let Err(e) = redis.del::<_, ()>(key.name()).await {
+                warn!("Cache invalidation failed for {}: {}", key.name(), e);
+            }
+        }
+    }
+
+    /// Consume new domain events and drop the cached map areas showing a
+    /// changed village (renamed, conquered, grown, ...). Returns the number
+    /// of events consumed.
+    pub async fn apply_events(pool: &PgPool) -> AppResult<usize> {
+        let checkpoint = ProjectionRepository::get_checkpoint(pool, CACHE_PROJECTION).await?;
+        let head = DomainEventRepository::safe_head(pool).await?;
+        if head <= checkpoint {
+            return Ok(0);
+        }
+
+        // First run, or we missed pruned events: nothing cached can be trusted
+        let oldest = DomainEventRepository::oldest_id(pool).await?;
+        if checkpoint == 0 || oldest.is_some_and(|oldest| oldest > checkpoint + 1) {
+            Self::invalidate_map(None).await;
+            ProjectionRepository::set_checkpoint(pool, CACHE_PROJECTION, head).await?;
+            return Ok(0);
+        }
+
+        let events = DomainEventRepository::find_after(pool, checkpoint, head, BATCH_SIZE).await?;
+        let last_event_id = if events.len() as i64 == BATCH_SIZE {
+            events.last().map(|e| e.id).unwrap_or(head)
+        } else {
+            head
+        };
+
+        let village_events: Vec<_> = events
+            .iter()
+            .filter(|e| e.entity_type == ENTITY_VILLAGE)
+            .collect();
+        if village_events.iter().any(|e| e.action == ACTION_DELETE) {
+            // A deleted village's position is gone with it
+            Self::invalidate_map(None).await;
+        } else if !village_events.is_empty() {
+            let ids: Vec<Uuid> = village_events.iter().map(|e| e.entity_id).collect();
+            let points: Vec<(i32, i32)> = VillageRepository::find_by_ids(pool, &ids)
+                .await?
+                .into_iter()
+                .map(|v| (v.x, v.y))
+                .collect();
+            Self::invalidate_map(Some(&points)).await;
+        }
+
+        ProjectionRepository::set_checkpoint(pool, CACHE_PROJECTION, last_event_id).await?;
+        Ok(events.len())
+    }
+
+    /// Preload the hot keys: top rankings, world settings and the map
+    /// around the center. Returns the number of entries written.
+    pub async fn warm(pool: &PgPool) -> AppResult<usize> {
+        let Some(mut redis) = REDIS.get().cloned() else {
+            return Ok(0);
+        };
+        let mut warmed = 0;
+
+        let rankings = ProjectionService::world_rankings(pool).await?;
+        warmed += Self::store(&mut redis, &CacheKey::TopRankings, &rankings).await as usize;
+
+        for setting in WorldSettingRepository::list(pool).await? {
+            let key = CacheKey::WorldSetting(setting.key.clone());
+            warmed += Self::store(&mut redis, &key, &Some(setting)).await as usize;
+        }
+
+        for &range in WARM_MAP_RANGES {
+            let villages = VillageRepository::find_in_range(pool, 0, 0, range).await?;
+            let key = CacheKey::MapArea { x: 0, y: 0, range };
+            warmed += Self::store(&mut redis, &key, &villages).await as usize;
+        }
+
+        Ok(warmed)
+    }
+
+    async fn store<T: Serialize>(redis: &mut RedisConnection, key: &CacheKey, value: &T) -> bool {
+        let Ok(json) = serde_json::to_string(value) else {
+            return false;
+        };
+        let name = key.name();
+        let ttl = key.ttl_secs();
+
+        if let Err(e) = redis.set_ex::<_, _, ()>(&name, json, ttl).await {
+            warn!("Cache write failed for {}: {}", name, e);
+            return false;
+        }
+        if let CacheKey::MapArea { .. } = key {
+            let expires_at = Utc::now().timestamp() + ttl as i64;
+            if let Err(e) = redis
+                .zadd::<_, _, _, ()>(MAP_INDEX, &name, expires_at)
+                .await
+            {
+                warn!("Cache index write failed for {}: {}", name, e);
+            }
+        }
+
+        true
+    }
+
+    /// Drop cached map areas containing any of `points`, or all of them
+    async fn invalidate_map(points: Option<&[(i32, i32)]>) {
+        let Some(mut redis) = REDIS.get().cloned() else {
+            return;
+        };
+
+        let now = Utc::now().timestamp();
+        let _ = redis
+            .zrembyscore::<_, _, _, ()>(MAP_INDEX, "-inf", now)
+            .await;
+        let cached: Vec<String> = match redis.zrange(MAP_INDEX, 0, -1).await {
+            Ok(cached) => cached,
+            Err(e) => {
+                warn!("Cache index read failed: {}", e);
+                return;
+            }
+        };
+
+        for name in cached {
+            let affected = match (points, parse_map_key(&name)) {
+                (Some(points), Some((x, y, range))) => points
+                    .iter()
+                    .any(|(px, py)| (px - x).abs() <= range && (py - y).abs() <= range),
+                _ => true,
+            };
+            if affected {
+                let _ = redis.del::<_, ()>(&name).await;
+                let _ = redis.zrem::<_, _, ()>(MAP_INDEX, &name).await;
+            }
+        }
+    }
+}
+
+fn parse_map_key(name: &str) -> Option<(i32, i32, i32)> {
+    let mut parts = name.strip_prefix("cache:map:")?.split(':');
+    let x = parts.next()?.parse().ok()?;
+    let y = parts.next()?.parse().ok()?;
+    let range = parts.next()?.parse().ok()?;
+    Some((x, y, range))
+}
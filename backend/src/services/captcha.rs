@@ -0,0 +1,61 @@
+use anyhow::{Context, Result};
+use reqwest::Client;
+use serde::Deserialize;
+
+use crate::config::CaptchaConfig;
+
+const RECAPTCHA_VERIFY_URL: &str = "https://www.google.com/recaptcha/api/siteverify";
+const HCAPTCHA_VERIFY_URL: &str = "https://api.hcaptcha.com/siteverify";
+
+/// Checks captcha tokens solved in the client with reCAPTCHA or hCaptcha.
+/// Both providers share the same siteverify protocol.
+#[derive(Clone)]
+pub struct CaptchaVerifier {
+    client: Client,
+    verify_url: &'static str,
+    secret_key: String,
+}
+
+#[derive(Deserialize)]
+struct VerifyResponse {
+    success: bool,
+}
+
+impl CaptchaVerifier {
+    /// Build the verifier from config, or `None` when captchas are off
+    pub fn from_config(config: &CaptchaConfig) -> Option<Self> {
+        let verify_url = match config.provider.as_deref()? {
+            "hcaptcha" => HCAPTCHA_VERIFY_URL,
+            _ => RECAPTCHA_VERIFY_URL,
+        };
+
+        Some(Self {
+            client: Client::new(),
+            verify_url,
+            secret_key: config.secret_key.clone().unwrap_or_default(),
+        })
+    }
+
+    /// Whether the provider accepts the token
+    pub async fn verify(&self, token: &str, remote_ip: Option<&str>) -> Result<bool> {
+        let mut form = vec![("secret", self.secret_key.as_str()), ("response", token)];
+        if let Some(ip) = remote_ip {
+            form.push(("remoteip", ip));
+        }
+
+        let response: VerifyResponse = self
+            .client
+            .post(self.verify_url)
+            .form(&form)
+            .send()
+            .await
+            .context("Captcha provider unreachable")?
+            .error_for_status()
+            .context("Captcha provider rejected the request")?
+            .json()
+            .await
+            .context("Invalid captcha provider response")?;
+
+        Ok(response.success)
+    }
+}
@@ -0,0 +1,146 @@
+use serde::Serialize;
+use std::future::Future;
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, Instant};
+use tracing::{info, warn};
+
+use crate::error::{AppError, AppResult};
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum BreakerState {
+    /// Calls go through; consecutive failures are counted
+    Closed,
+    /// Calls are rejected until the cool-down ends
+    Open,
+    /// Cool-down over; one trial call decides whether to close again
+    HalfOpen,
+}
+
+#[derive(Debug)]
+struct Inner {
+    state: BreakerState,
+    consecutive_failures: u32,
+    opened_at: Option<Instant>,
+    trial_in_flight: bool,
+}
+
+/// Circuit breaker around a third-party dependency. After
+/// `failure_threshold` consecutive outage-type failures the breaker opens and
+/// calls fail fast with `ServiceUnavailable` for `open_duration`, so a slow
+/// or dead provider doesn't tie up request handlers.
+#[derive(Debug, Clone)]
+pub struct CircuitBreaker {
+    name: &'static str,
+    failure_threshold: u32,
+    open_duration: Duration,
+    inner: Arc<Mutex<Inner>>,
+}
+
+impl CircuitBreaker {
+    pub fn new(name: &'static str, failure_threshold: u32, open_duration: Duration) -> Self {
+        Self {
+            name,
+            failure_threshold,
+            open_duration,
+            inner: Arc::new(Mutex::new(Inner {
+                state: BreakerState::Closed,
+                consecutive_failures: 0,
+                opened_at: None,
+                trial_in_flight: false,
+            })),
+        }
+    }
+
+    pub fn name(&self) -> &'static str {
+        self.name
+    }
+
+    pub fn state(&self) -> BreakerState {
+        let mut inner = self.inner.lock().unwrap();
+        self.refresh(&mut inner);
+        inner.state
+    }
+
+    /// Run `f` through the breaker. Only provider outages (internal or
+    /// unavailable errors) count as failures; a rejected request is still a
+    /// healthy provider.
+    pub async fn call<T, F, Fut>(&self, f: F) -> AppResult<T>
+    where
+        F: FnOnce() -> Fut,
+        Fut: Future<Output = AppResult<T>>,
+    {
+        if !self.try_acquire() {
+            return Err(AppError::ServiceUnavailable(format!(
+                "{} is temporarily unavailable",
+                self.name
+            )));
+        }
+
+        let result = f().await;
+        match &result {
+            Err(AppError::InternalError(_)) | Err(AppError::ServiceUnavailable(_)) => {
+                self.record_failure()
+            }
+            _ => self.record_success(),
+        }
+        result
+    }
+
+    fn refresh(&self, inner: &mut Inner) {
+        if inner.state == BreakerState::Open
+            && inner
+                .opened_at
+                .is_some_and(|at| at.elapsed() >= self.open_duration)
+        {
+            inner.state = BreakerState::HalfOpen;
+            inner.trial_in_flight = false;
+        }
+    }
+
+    fn try_acquire(&self) -> bool {
+        let mut inner = self.inner.lock().unwrap();
+        self.refresh(&mut inner);
+
+        match inner.state {
+            BreakerState::Closed => true,
+            BreakerState::Open => false,
+            BreakerState::HalfOpen => {
+                if inner.trial_in_flight {
+                    false
+                } else {
+                    inner.trial_in_flight = true;
+                    true
+                }
+            }
+        }
+    }
+
+    fn record_success(&self) {
+        let mut inner = self.inner.lock().unwrap();
+        if inner.state != BreakerState::Closed {
+            info!("Circuit breaker {} closed", self.name);
+        }
+        inner.state = BreakerState::Closed;
+        inner.consecutive_failures = 0;
+        inner.opened_at = None;
+        inner.trial_in_flight = false;
+    }
+
+    fn record_failure(&self) {
+        let mut inner = self.inner.lock().unwrap();
+        inner.consecutive_failures += 1;
+        inner.trial_in_flight = false;
+
+        let trip = inner.state == BreakerState::HalfOpen
+            || inner.consecutive_failures >= self.failure_threshold;
+        if trip && inner.state != BreakerState::Open {
+            warn!(
+                "Circuit breaker {} opened after {} consecutive failures",
+                self.name, inner.consecutive_failures
+            );
+            inner.state = BreakerState::Open;
+            inner.opened_at = Some(Instant::now());
+        }
+    }
+}
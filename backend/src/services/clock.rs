@@ -0,0 +1,451 @@
+use chrono::{DateTime, Duration, Utc};
+use sqlx::PgPool;
+use std::sync::atomic::{AtomicI64, Ordering};
+use std::sync::{Arc, LazyLock, RwLock};
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::config::Config;
+use crate::error::{AppError, AppResult};
+use crate::models::world_setting::{
+    ClockStatus, TimeWarpSettings, WorldClockSettings, WorldPauseSettings, TIME_WARP_KEY,
+    WORLD_CLOCK_KEY, WORLD_PAUSE_KEY,
+};
+use crate::models::world_status::TimeSync;
+use crate::repositories::world_clock_repo::WorldClockRepository;
+use crate::repositories::world_pause_repo::WorldPauseRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+
+/// Longest single jump an admin may make
+const MAX_ADVANCE_SECONDS: i64 = 30 * 24 * 3600;
+
+/// Database round trips slower than this are too loose a reading to
+/// correct the host clock by
+const MAX_SYNC_RTT_MS: i64 = 500;
+
+/// Host clocks further off the database's than this are reported
+const SKEW_WARN_MS: i64 = 2000;
+
+/// A stored high-water mark this far ahead is taken to be bad data rather
+/// than waited out
+const MAX_HIGH_WATER_LEAD_SECS: i64 = 3600;
+
+/// Source of the current game time. Queues, movements and resource accrual
+/// ask this instead of the wall clock so test worlds can be fast-forwarded.
+pub trait Clock: Send + Sync {
+    fn now(&self) -> DateTime<Utc>;
+}
+
+/// The wall clock
+pub struct SystemClock;
+
+impl Clock for SystemClock {
+    fn now(&self) -> DateTime<Utc> {
+        Utc::now()
+    }
+}
+
+/// The wall clock corrected to the database's, never running backwards.
+///
+/// Each instance measures how far its host clock is off from Postgres, the
+/// one clock they all share, and applies the difference, so a timer set on
+/// one instance comes due at the same moment on another. When the host
+/// clock steps back (an NTP correction, a repeated leap second, a restart on
+/// a host running behind) time holds still until it catches up instead of
+/// reversing, so nothing completes twice or goes back to running. All of it
+/// is UTC milliseconds; local time zones and DST never come into play.
+pub struct WorldClock {
+    base: Arc<dyn Clock>,
+    skew_ms: AtomicI64,
+    floor_ms: AtomicI64,
+}
+
+impl WorldClock {
+    pub fn new(base: Arc<dyn Clock>) -> Self {
+        Self {
+            base,
+            skew_ms: AtomicI64::new(0),
+            floor_ms: AtomicI64::new(i64::MIN),
+        }
+    }
+
+    pub fn skew(&self) -> Duration {
+        Duration::milliseconds(self.skew_ms.load(Ordering::Relaxed))
+    }
+
+    pub fn set_skew(&self, skew: Duration) {
+        self.skew_ms
+            .store(skew.num_milliseconds(), Ordering::Relaxed);
+    }
+
+    /// The latest instant handed out; `now` never returns an earlier one
+    pub fn floor(&self) -> Option<DateTime<Utc>> {
+        match self.floor_ms.load(Ordering::Relaxed) {
+            i64::MIN => None,
+            ms => DateTime::from_timestamp_millis(ms),
+        }
+    }
+
+    /// Never hand out an instant before `at`
+    pub fn raise_floor(&self, at: DateTime<Utc>) {
+        self.floor_ms
+            .fetch_max(at.timestamp_millis(), Ordering::Relaxed);
+    }
+
+    /// The host clock with the skew applied, before the floor
+    pub fn corrected_now(&self) -> DateTime<Utc> {
+        self.base.now() + self.skew()
+    }
+
+    /// Take the skew from one reading of the database clock, `sent` and
+    /// `received` being the host's time either side of it. Readings with
+    /// too slow a round trip are dropped; returns the skew if applied.
+    pub fn apply_reading(
+        &self,
+        sent: DateTime<Utc>,
+        database_now: DateTime<Utc>,
+        received: DateTime<Utc>,
+    ) -> Option<Duration> {
+        let round_trip = received - sent;
+        if round_trip < Duration::zero() || round_trip > Duration::milliseconds(MAX_SYNC_RTT_MS) {
+            return None;
+        }
+
+        let skew = database_now - (sent + round_trip / 2);
+        self.set_skew(skew);
+        Some(skew)
+    }
+
+    /// Hold time at the high-water mark a previous run left behind, unless
+    /// it is so far ahead it must be bad data. Returns whether it was
+    /// applied.
+    pub fn restore_high_water(&self, high_water: DateTime<Utc>) -> bool {
+        let lead = high_water - self.corrected_now();
+        if lead > Duration::seconds(MAX_HIGH_WATER_LEAD_SECS) {
+            warn!(
+                "Ignoring world clock high-water mark {} ({}s ahead)",
+                high_water,
+                lead.num_seconds()
+            );
+            return false;
+        }
+
+        if lead > Duration::zero() {
+            warn!(
+                "Host clock is {}ms behind the last run, holding time until then",
+                lead.num_milliseconds()
+            );
+        }
+        self.raise_floor(high_water);
+        true
+    }
+}
+
+impl Clock for WorldClock {
+    fn now(&self) -> DateTime<Utc> {
+        let corrected = self.corrected_now().timestamp_millis();
+        let previous = self.floor_ms.fetch_max(corrected, Ordering::Relaxed);
+        DateTime::from_timestamp_millis(corrected.max(previous))
+            .unwrap_or_else(|| self.base.now())
+    }
+}
+
+/// Marks an `OffsetClock` that is running
+const NOT_FROZEN: i64 = i64::MIN;
+
+/// Another clock shifted forward by an adjustable offset, which can be
+/// stopped at a fixed instant
+pub struct OffsetClock {
+    base: Arc<dyn Clock>,
+    offset_ms: AtomicI64,
+    frozen_ms: AtomicI64,
+}
+
+impl OffsetClock {
+    pub fn new(base: Arc<dyn Clock>) -> Self {
+        Self {
+            base,
+            offset_ms: AtomicI64::new(0),
+            frozen_ms: AtomicI64::new(NOT_FROZEN),
+        }
+    }
+
+    pub fn offset(&self) -> Duration {
+        Duration::milliseconds(self.offset_ms.load(Ordering::Relaxed))
+    }
+
+    pub fn set_offset(&self, offset: Duration) {
+        self.offset_ms
+            .store(offset.num_milliseconds(), Ordering::Relaxed);
+    }
+
+    /// The instant the clock is stopped at, if it is
+    pub fn frozen_at(&self) -> Option<DateTime<Utc>> {
+        match self.frozen_ms.load(Ordering::Relaxed) {
+            NOT_FROZEN => None,
+            ms => DateTime::from_timestamp_millis(ms),
+        }
+    }
+
+    /// Stop the clock at `at`, or start it again with None
+    pub fn set_frozen(&self, at: Option<DateTime<Utc>>) {
+        self.frozen_ms.store(
+            at.map_or(NOT_FROZEN, |at| at.timestamp_millis()),
+            Ordering::Relaxed,
+        );
+    }
+
+    /// What the time would be had the clock never been stopped
+    pub fn running_now(&self) -> DateTime<Utc> {
+        self.base.now() + self.offset()
+    }
+}
+
+impl Clock for OffsetClock {
+    fn now(&self) -> DateTime<Utc> {
+        self.frozen_at().unwrap_or_else(|| self.running_now())
+    }
+}
+
+static WORLD_CLOCK: LazyLock<Arc<WorldClock>> =
+    LazyLock::new(|| Arc::new(WorldClock::new(Arc::new(SystemClock))));
+
+static CLOCK: LazyLock<OffsetClock> = LazyLock::new(|| OffsetClock::new(WORLD_CLOCK.clone()));
+
+/// The pause applied on this instance; the clock is frozen while it is set
+static PAUSE: LazyLock<RwLock<WorldPauseSettings>> =
+    LazyLock::new(|| RwLock::new(WorldPauseSettings::default()));
+
+/// The game clock in effect on this instance
+pub fn clock() -> &'static OffsetClock {
+    &CLOCK
+}
+
+/// The corrected, monotonic wall clock the game clock runs on
+pub fn world_clock() -> &'static WorldClock {
+    &WORLD_CLOCK
+}
+
+/// Current game time; use in place of `Utc::now()` (and pass it to SQL in
+/// place of `NOW()`) for anything a player waits on. Every scheduler sets
+/// and compares its timers with this one source.
+pub fn now() -> DateTime<Utc> {
+    clock().now()
+}
+
+/// Whether the world is paused for maintenance
+pub fn is_paused() -> bool {
+    clock().frozen_at().is_some()
+}
+
+pub struct ClockService;
+
+impl ClockService {
+    pub fn status(config: &Config) -> ClockStatus {
+        let pause = PAUSE.read().unwrap().clone();
+        ClockStatus {
+            now: now(),
+            offset_seconds: clock().offset().num_seconds(),
+            time_warp_enabled: config.server.time_warp,
+            paused_at: pause.paused_at,
+            pause_reason: pause.reason,
+            skew_ms: world_clock().skew().num_milliseconds(),
+        }
+    }
+
+    /// Game time for a client syncing its countdowns; `received` is when
+    /// its request arrived
+    pub fn time_sync(client_time: Option<i64>, received: DateTime<Utc>) -> TimeSync {
+        let server_time = now();
+        TimeSync {
+            server_time,
+            server_time_ms: server_time.timestamp_millis(),
+            received_ms: received.timestamp_millis(),
+            client_time,
+            paused: is_paused(),
+        }
+    }
+
+    /// Move the game clock forward on every instance. Timers already running
+    /// come due sooner; nothing is replayed.
+    pub async fn advance(
+        pool: &PgPool,
+        config: &Config,
+        admin_id: Uuid,
+        seconds: i64,
+    ) -> AppResult<ClockStatus> {
+        if !config.server.time_warp {
+            return Err(AppError::Forbidden(
+                "Time warp is disabled on this world".into(),
+            ));
+        }
+        if is_paused() {
+            return Err(AppError::Conflict(
+                "The world is paused; resume it first".into(),
+            ));
+        }
+        if !(1..=MAX_ADVANCE_SECONDS).contains(&seconds) {
+            return Err(AppError::BadRequest(format!(
+                "seconds must be between 1 and {}",
+                MAX_ADVANCE_SECONDS
+            )));
+        }
+
+        let mut settings = Self::get_settings(pool).await?;
+        settings.offset_seconds += seconds;
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, TIME_WARP_KEY, &value, Some(admin_id)).await?;
+
+        info!(
+            "Game clock advanced {}s by {} (offset now {}s)",
+            seconds, admin_id, settings.offset_seconds
+        );
+        clock().set_offset(Duration::seconds(settings.offset_seconds));
+
+        Ok(Self::status(config))
+    }
+
+    /// Stop the game clock on every instance for emergency maintenance.
+    /// Nothing accrues or comes due until the world resumes.
+    pub async fn pause(
+        pool: &PgPool,
+        config: &Config,
+        admin_id: Uuid,
+        reason: Option<String>,
+    ) -> AppResult<ClockStatus> {
+        if Self::get_pause(pool).await?.paused_at.is_some() {
+            return Err(AppError::Conflict("The world is already paused".into()));
+        }
+
+        let pause = WorldPauseSettings {
+            paused_at: Some(now()),
+            reason,
+            paused_by: Some(admin_id),
+        };
+        let value = serde_json::to_value(&pause).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, WORLD_PAUSE_KEY, &value, Some(admin_id)).await?;
+
+        warn!(
+            "World paused by {} at {:?}: {}",
+            admin_id,
+            pause.paused_at,
+            pause.reason.as_deref().unwrap_or("no reason given")
+        );
+        Self::apply_pause(pause);
+
+        Ok(Self::status(config))
+    }
+
+    /// Start the game clock again where it stopped. Every running timer is
+    /// pushed back by the downtime in the same transaction that lifts the
+    /// pause, so no arrival lands while nobody could react to it.
+    pub async fn resume(pool: &PgPool, config: &Config, admin_id: Uuid) -> AppResult<ClockStatus> {
+        let mut tx = pool.begin().await?;
+        let paused_at = WorldPauseRepository::paused_at_for_update(&mut tx)
+            .await?
+            .ok_or_else(|| AppError::Conflict("The world is not paused".into()))?;
+
+        let downtime = (clock().running_now() - paused_at).max(Duration::zero());
+        let shifted = WorldPauseRepository::shift_timers(&mut tx, paused_at, downtime).await?;
+
+        let value =
+            serde_json::to_value(WorldPauseSettings::default()).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(&mut *tx, WORLD_PAUSE_KEY, &value, Some(admin_id)).await?;
+        tx.commit().await?;
+
+        warn!(
+            "World resumed by {} after {}s; {} timers pushed back",
+            admin_id,
+            downtime.num_seconds(),
+            shifted
+        );
+        Self::apply_pause(WorldPauseSettings::default());
+
+        Ok(Self::status(config))
+    }
+
+    /// Load the stored offset and pause and apply them. Returns whether
+    /// either changed.
+    pub async fn refresh(pool: &PgPool) -> AppResult<bool> {
+        let offset = Duration::seconds(Self::get_settings(pool).await?.offset_seconds);
+        let pause = Self::get_pause(pool).await?;
+        let clock = clock();
+        if clock.offset() == offset && *PAUSE.read().unwrap() == pause {
+            return Ok(false);
+        }
+
+        clock.set_offset(offset);
+        Self::apply_pause(pause);
+        Ok(true)
+    }
+
+    /// Correct this host's clock against the database's and keep the
+    /// shared high-water mark up to date. On the first call after a start
+    /// the clock is also held at the mark the previous run left behind.
+    pub async fn sync(pool: &PgPool) -> AppResult<()> {
+        let world = world_clock();
+        if world.floor().is_none() {
+            let stored = Self::get_world_clock(pool).await?;
+            if let Some(high_water) = stored.high_water {
+                world.restore_high_water(high_water);
+            }
+        }
+
+        let sent = Utc::now();
+        let database_now = WorldClockRepository::database_now(pool).await?;
+        let received = Utc::now();
+        if let Some(skew) = world.apply_reading(sent, database_now, received) {
+            if skew.num_milliseconds().abs() >= SKEW_WARN_MS {
+                warn!(
+                    "Host clock is {}ms behind the database clock; correcting",
+                    skew.num_milliseconds()
+                );
+            }
+        }
+
+        WorldClockRepository::raise_high_water(pool, world.now()).await?;
+        Ok(())
+    }
+
+    fn apply_pause(pause: WorldPauseSettings) {
+        clock().set_frozen(pause.paused_at);
+        *PAUSE.write().unwrap() = pause;
+    }
+
+    async fn get_pause(pool: &PgPool) -> AppResult<WorldPauseSettings> {
+        let pause = match WorldSettingRepository::get(pool, WORLD_PAUSE_KEY).await? {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid world_pause setting, ignoring: {}", e);
+                WorldPauseSettings::default()
+            }),
+            None => WorldPauseSettings::default(),
+        };
+
+        Ok(pause)
+    }
+
+    async fn get_world_clock(pool: &PgPool) -> AppResult<WorldClockSettings> {
+        let settings = match WorldSettingRepository::get(pool, WORLD_CLOCK_KEY).await? {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid world_clock setting, ignoring: {}", e);
+                WorldClockSettings::default()
+            }),
+            None => WorldClockSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    async fn get_settings(pool: &PgPool) -> AppResult<TimeWarpSettings> {
+        let settings = match WorldSettingRepository::get(pool, TIME_WARP_KEY).await? {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid time_warp setting, ignoring: {}", e);
+                TimeWarpSettings::default()
+            }),
+            None => TimeWarpSettings::default(),
+        };
+
+        Ok(settings)
+    }
+}
@@ -0,0 +1,251 @@
+use std::collections::HashMap;
+use std::hash::Hash;
+
+use crate::models::army::{ArmyTroops, MissionType};
+use crate::models::gamedata::UnitDefinition;
+use crate::models::troop::{TroopDefinition, TroopType};
+
+/// Stats a battle needs from a unit, whether it comes from
+/// troop_definitions, straight from the game data files, or the nature
+/// troops guarding oases
+pub trait CombatUnit {
+    /// What troop counts are keyed by
+    type Key: Copy + Eq + Hash;
+
+    fn key(&self) -> Self::Key;
+    fn is_cavalry(&self) -> bool;
+    fn attack(&self) -> i32;
+    fn defense_infantry(&self) -> i32;
+    fn defense_cavalry(&self) -> i32;
+}
+
+impl CombatUnit for TroopDefinition {
+    type Key = TroopType;
+
+    fn key(&self) -> TroopType {
+        self.troop_type
+    }
+    fn is_cavalry(&self) -> bool {
+        self.troop_type.is_cavalry()
+    }
+    fn attack(&self) -> i32 {
+        self.attack
+    }
+    fn defense_infantry(&self) -> i32 {
+        self.defense_infantry
+    }
+    fn defense_cavalry(&self) -> i32 {
+        self.defense_cavalry
+    }
+}
+
+impl CombatUnit for UnitDefinition {
+    type Key = TroopType;
+
+    fn key(&self) -> TroopType {
+        self.troop_type
+    }
+    fn is_cavalry(&self) -> bool {
+        self.troop_type.is_cavalry()
+    }
+    fn attack(&self) -> i32 {
+        self.attack
+    }
+    fn defense_infantry(&self) -> i32 {
+        self.defense_infantry
+    }
+    fn defense_cavalry(&self) -> i32 {
+        self.defense_cavalry
+    }
+}
+
+/// Battle calculation results, with each side's troops keyed by its own
+/// unit type
+pub struct BattleOutcome<A, D> {
+    pub attacker_wins: bool,
+    pub attacker_survivors: HashMap<A, i32>,
+    pub defender_survivors: HashMap<D, i32>,
+    pub attacker_losses: HashMap<A, i32>,
+    pub defender_losses: HashMap<D, i32>,
+}
+
+/// A battle between players' armies
+pub type BattleResult = BattleOutcome<TroopType, TroopType>;
+
+/// Percentage bonuses from tribes and tribe buildings
+#[derive(Debug, Clone, Copy, Default)]
+pub struct BattleBonus {
+    pub attack_percent: i32,
+    pub defense_percent: i32,
+}
+
+/// Calculate battle using Travian-style formula. Pure, so the offline
+/// balance simulator (src/bin/simulate.rs) runs what live worlds run.
+pub fn calculate_battle<U: CombatUnit<Key = TroopType>>(
+    attacker_troops: &ArmyTroops,
+    defender_troops: &ArmyTroops,
+    definitions: &[U],
+    mission: MissionType,
+    bonus: BattleBonus,
+) -> BattleResult {
+    resolve(
+        attacker_troops,
+        definitions,
+        defender_troops,
+        definitions,
+        mission,
+        bonus,
+    )
+}
+
+/// Same formula for sides drawn from different unit tables, e.g. an army
+/// against an oasis's animals
+pub fn resolve<A: CombatUnit, D: CombatUnit>(
+    attacker_troops: &HashMap<A::Key, i32>,
+    attacker_units: &[A],
+    defender_troops: &HashMap<D::Key, i32>,
+    defender_units: &[D],
+    mission: MissionType,
+    bonus: BattleBonus,
+) -> BattleOutcome<A::Key, D::Key> {
+    // Calculate attack power
+    let attack_power = calculate_attack_power(attacker_troops, attacker_units)
+        * (100 + bonus.attack_percent) as f64
+        / 100.0;
+
+    // Calculate infantry/cavalry ratio for defense calculation
+    let (infantry_attack, cavalry_attack) =
+        calculate_attack_by_type(attacker_troops, attacker_units);
+    let total_attack = infantry_attack + cavalry_attack;
+    let infantry_ratio = if total_attack > 0.0 {
+        infantry_attack / total_attack
+    } else {
+        0.5
+    };
+
+    // Calculate defense power
+    let defense_power = calculate_defense_power(defender_troops, defender_units, infantry_ratio)
+        * (100 + bonus.defense_percent) as f64
+        / 100.0;
+
+    // Determine winner and calculate losses
+    let (attacker_wins, attacker_loss_ratio, defender_loss_ratio) =
+        if attack_power > defense_power && defense_power > 0.0 {
+            // Attacker wins
+            let ratio = defense_power / attack_power;
+            let attacker_losses = ratio.powf(1.5);
+            (true, attacker_losses, 1.0)
+        } else if defense_power > 0.0 {
+            // Defender wins
+            let ratio = attack_power / defense_power;
+            let defender_losses = ratio.powf(1.5);
+            // Raid: attackers can flee with reduced losses
+            let attacker_losses = if mission == MissionType::Raid {
+                0.66_f64.max(1.0 - ratio * 0.5)
+            } else {
+                1.0
+            };
+            (false, attacker_losses, defender_losses)
+        } else {
+            // No defenders - attacker wins with no losses
+            (true, 0.0, 0.0)
+        };
+
+    // Calculate actual losses
+    let attacker_losses = apply_losses(attacker_troops, attacker_loss_ratio);
+    let defender_losses = apply_losses(defender_troops, defender_loss_ratio);
+
+    // Calculate survivors
+    let attacker_survivors = calculate_survivors(attacker_troops, &attacker_losses);
+    let defender_survivors = calculate_survivors(defender_troops, &defender_losses);
+
+    BattleOutcome {
+        attacker_wins,
+        attacker_survivors,
+        defender_survivors,
+        attacker_losses,
+        defender_losses,
+    }
+}
+
+/// Calculate total attack power
+fn calculate_attack_power<U: CombatUnit>(troops: &HashMap<U::Key, i32>, definitions: &[U]) -> f64 {
+    troops
+        .iter()
+        .filter_map(|(key, count)| {
+            definitions
+                .iter()
+                .find(|d| d.key() == *key)
+                .map(|d| d.attack() as f64 * *count as f64)
+        })
+        .sum()
+}
+
+/// Calculate attack power split by infantry/cavalry
+fn calculate_attack_by_type<U: CombatUnit>(
+    troops: &HashMap<U::Key, i32>,
+    definitions: &[U],
+) -> (f64, f64) {
+    let mut infantry = 0.0;
+    let mut cavalry = 0.0;
+
+    for (key, count) in troops {
+        if let Some(def) = definitions.iter().find(|d| d.key() == *key) {
+            let attack = def.attack() as f64 * *count as f64;
+            if def.is_cavalry() {
+                cavalry += attack;
+            } else {
+                infantry += attack;
+            }
+        }
+    }
+
+    (infantry, cavalry)
+}
+
+/// Calculate total defense power based on attacker composition
+fn calculate_defense_power<U: CombatUnit>(
+    troops: &HashMap<U::Key, i32>,
+    definitions: &[U],
+    infantry_ratio: f64,
+) -> f64 {
+    let cavalry_ratio = 1.0 - infantry_ratio;
+
+    troops
+        .iter()
+        .filter_map(|(key, count)| {
+            definitions.iter().find(|d| d.key() == *key).map(|d| {
+                let effective_defense = (d.defense_infantry() as f64 * infantry_ratio)
+                    + (d.defense_cavalry() as f64 * cavalry_ratio);
+                effective_defense * *count as f64
+            })
+        })
+        .sum()
+}
+
+/// Apply loss ratio to troops
+fn apply_losses<K: Copy + Eq + Hash>(troops: &HashMap<K, i32>, loss_ratio: f64) -> HashMap<K, i32> {
+    troops
+        .iter()
+        .map(|(key, count)| {
+            let losses = (*count as f64 * loss_ratio).floor() as i32;
+            (*key, losses.min(*count))
+        })
+        .filter(|(_, losses)| *losses > 0)
+        .collect()
+}
+
+/// Calculate survivors after losses
+fn calculate_survivors<K: Copy + Eq + Hash>(
+    troops: &HashMap<K, i32>,
+    losses: &HashMap<K, i32>,
+) -> HashMap<K, i32> {
+    troops
+        .iter()
+        .map(|(key, count)| {
+            let loss = losses.get(key).copied().unwrap_or(0);
+            (*key, (*count - loss).max(0))
+        })
+        .filter(|(_, count)| *count > 0)
+        .collect()
+}
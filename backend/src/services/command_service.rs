@@ -0,0 +1,402 @@
+use chrono::Duration;
+use serde::Serialize;
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::models::command::{
+    CommandEnvelope, CommandResponse, GameCommand, PlayerCommand, ReplayActionsRequest,
+    ReplayedCommand, ScheduleCommandRequest, ScheduledCommand, MAX_SCHEDULED_COMMANDS,
+    MAX_SCHEDULED_PER_DAY, MAX_SCHEDULE_AHEAD_HOURS, STATUS_PENDING, STATUS_REJECTED,
+    STATUS_SUCCEEDED,
+};
+use crate::models::village::{UpdateVillage, Village, VillageResponse};
+use crate::repositories::command_repo::CommandRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::army_service::ArmyService;
+use crate::services::building_service::BuildingService;
+use crate::services::clock;
+use crate::services::hero_service::HeroService;
+use crate::services::troop_service::TroopService;
+
+pub struct CommandService;
+
+impl CommandService {
+    /// Run a gameplay command at most once per command id. A resubmitted id
+    /// gets the original outcome; commands that failed for a transient reason
+    /// are forgotten so the client can retry with the same id.
+    pub async fn execute(
+        pool: &PgPool,
+        user_id: Uuid,
+        envelope: CommandEnvelope,
+    ) -> AppResult<CommandResponse> {
+        let command = GameCommand::parse(&envelope)
+            .map_err(|e| AppError::BadRequest(format!("Invalid command: {}", e)))?;
+
+        let inserted = CommandRepository::try_insert(
+            pool,
+            envelope.command_id,
+            user_id,
+            &envelope.command_type,
+            &envelope.payload,
+        )
+        .await?;
+        if inserted.is_none() {
+            return Self::existing_outcome(pool, user_id, &envelope).await;
+        }
+
+        match Self::dispatch(pool, user_id, command).await {
+            Ok(result) => {
+                CommandRepository::mark_succeeded(pool, envelope.command_id, &result).await?;
+                Ok(CommandResponse {
+                    command_id: envelope.command_id,
+                    status: STATUS_SUCCEEDED.to_string(),
+                    result: Some(result),
+                    duplicate: false,
+                })
+            }
+            Err(e) if e.is_retryable() => {
+                CommandRepository::delete(pool, envelope.command_id).await?;
+                Err(e)
+            }
+            Err(e) => {
+                CommandRepository::mark_rejected(
+                    pool,
+                    envelope.command_id,
+                    e.status_code().as_u16() as i32,
+                    &e.to_string(),
+                    e.error_code().as_str(),
+                )
+                .await?;
+                Err(e)
+            }
+        }
+    }
+
+    /// Look up a command the player submitted earlier
+    pub async fn get_command(
+        pool: &PgPool,
+        user_id: Uuid,
+        command_id: Uuid,
+    ) -> AppResult<PlayerCommand> {
+        CommandRepository::find_by_id(pool, command_id)
+            .await?
+            .filter(|c| c.user_id == user_id)
+            .ok_or_else(|| AppError::NotFound("Command not found".into()))
+    }
+
+    /// Queue a command to run at a set time. Players get a few pending
+    /// commands at a time so the server, not an outside bot, does the timing.
+    pub async fn schedule(
+        pool: &PgPool,
+        user_id: Uuid,
+        request: ScheduleCommandRequest,
+    ) -> AppResult<ScheduledCommand> {
+        let envelope = request.command;
+        GameCommand::parse(&envelope)
+            .map_err(|e| AppError::BadRequest(format!("Invalid command: {}", e)))?;
+
+        let now = clock::now();
+        if request.execute_at <= now {
+            return Err(AppError::BadRequest(
+                "Scheduled time must be in the future".into(),
+            ));
+        }
+        if request.execute_at > now + Duration::hours(MAX_SCHEDULE_AHEAD_HOURS) {
+            return Err(AppError::BadRequest(format!(
+                "Commands can be scheduled at most {} hours ahead",
+                MAX_SCHEDULE_AHEAD_HOURS
+            )));
+        }
+
+        if CommandRepository::count_pending_scheduled(pool, user_id).await?
+            >= MAX_SCHEDULED_COMMANDS
+        {
+            return Err(AppError::Conflict(format!(
+                "At most {} commands can be scheduled at once",
+                MAX_SCHEDULED_COMMANDS
+            )));
+        }
+        if CommandRepository::count_scheduled_since(pool, user_id, now - Duration::days(1)).await?
+            >= MAX_SCHEDULED_PER_DAY
+        {
+            return Err(AppError::Conflict(format!(
+                "At most {} commands can be scheduled per day",
+                MAX_SCHEDULED_PER_DAY
+            )));
+        }
+
+        let scheduled = CommandRepository::schedule(
+            pool,
+            user_id,
+            envelope.command_id,
+            &envelope.command_type,
+            &envelope.payload,
+            request.execute_at,
+        )
+        .await?
+        .ok_or_else(|| AppError::Conflict("Command id was already scheduled".into()))?;
+
+        info!(
+            "Player {} scheduled {} command {} for {}",
+            user_id, scheduled.command_type, scheduled.command_id, scheduled.execute_at
+        );
+
+        Ok(scheduled)
+    }
+
+    pub async fn list_scheduled(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<ScheduledCommand>> {
+        CommandRepository::list_scheduled(pool, user_id, 100).await
+    }
+
+    pub async fn cancel_scheduled(
+        pool: &PgPool,
+        user_id: Uuid,
+        id: Uuid,
+    ) -> AppResult<ScheduledCommand> {
+        let scheduled = CommandRepository::cancel_scheduled(pool, id, user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("No pending scheduled command".into()))?;
+
+        info!("Player {} cancelled scheduled command {}", user_id, id);
+
+        Ok(scheduled)
+    }
+
+    /// Run the scheduled commands that are due, through the same path as a
+    /// submitted command. Returns how many were run.
+    pub async fn process_scheduled(pool: &PgPool) -> AppResult<i32> {
+        let due = CommandRepository::claim_due_scheduled(pool, clock::now(), 100).await?;
+
+        let mut count = 0;
+        for scheduled in due {
+            let envelope = CommandEnvelope {
+                command_id: scheduled.command_id,
+                command_type: scheduled.command_type.clone(),
+                payload: scheduled.payload.clone(),
+            };
+            if let Err(e) = Self::execute(pool, scheduled.user_id, envelope).await {
+                warn!(
+                    "Scheduled command {} of player {} failed: {}",
+                    scheduled.id, scheduled.user_id, e
+                );
+                CommandRepository::mark_scheduled_failed(pool, scheduled.id, &e.to_string())
+                    .await?;
+            }
+            count += 1;
+        }
+
+        Ok(count)
+    }
+
+    /// Per-player action log for support staff
+    pub async fn list_actions(
+        pool: &PgPool,
+        user_id: Uuid,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<PlayerCommand>> {
+        CommandRepository::list_for_user(pool, user_id, limit.min(200).max(1), offset.max(0)).await
+    }
+
+    /// Re-run a player's successful commands, in order, under fresh command
+    /// ids. Meant for reproducing bugs against a restored snapshot on a
+    /// non-production world.
+    pub async fn replay(
+        pool: &PgPool,
+        environment: &str,
+        admin_id: Uuid,
+        user_id: Uuid,
+        request: ReplayActionsRequest,
+    ) -> AppResult<Vec<ReplayedCommand>> {
+        if environment == "production" {
+            return Err(AppError::Forbidden(
+                "Action replay is disabled in production".into(),
+            ));
+        }
+
+        let target_user_id = request.target_user_id.unwrap_or(user_id);
+        UserRepository::find_by_id(pool, target_user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Player not found".into()))?;
+
+        let commands =
+            CommandRepository::list_succeeded_between(pool, user_id, request.since, request.until)
+                .await?;
+
+        let mut replayed = Vec::with_capacity(commands.len());
+        for original in commands {
+            let envelope = CommandEnvelope {
+                command_id: Uuid::new_v4(),
+                command_type: original.command_type.clone(),
+                payload: original.payload.clone(),
+            };
+            let command_id = envelope.command_id;
+            let outcome = Self::execute(pool, target_user_id, envelope).await;
+
+            if let Err(e) = &outcome {
+                warn!(
+                    "Replay of command {} ({}) failed: {}",
+                    original.command_id, original.command_type, e
+                );
+            }
+            replayed.push(ReplayedCommand {
+                original_command_id: original.command_id,
+                command_id,
+                command_type: original.command_type,
+                succeeded: outcome.is_ok(),
+                error: outcome.err().map(|e| e.to_string()),
+            });
+        }
+
+        info!(
+            "Admin {} replayed {} commands of player {} onto player {}",
+            admin_id,
+            replayed.len(),
+            user_id,
+            target_user_id
+        );
+
+        Ok(replayed)
+    }
+
+    async fn existing_outcome(
+        pool: &PgPool,
+        user_id: Uuid,
+        envelope: &CommandEnvelope,
+    ) -> AppResult<CommandResponse> {
+        let existing = CommandRepository::find_by_id(pool, envelope.command_id)
+            .await?
+            // Deleted by a concurrent retryable failure
+            .ok_or_else(|| {
+                AppError::VersionConflict("Command is being retried, please resubmit".into())
+            })?;
+
+        if existing.user_id != user_id
+            || existing.command_type != envelope.command_type
+            || existing.payload != envelope.payload
+        {
+            return Err(AppError::Conflict(
+                "Command id was already used for a different command".into(),
+            ));
+        }
+
+        match existing.status.as_str() {
+            STATUS_PENDING => Err(AppError::Conflict(
+                "Command is still being processed".into(),
+            )),
+            STATUS_REJECTED => Err(error_from_status(
+                existing.error_status.unwrap_or(400),
+                existing.error_code.as_deref(),
+                existing.error_message.unwrap_or_default(),
+            )),
+            _ => Ok(CommandResponse {
+                command_id: existing.command_id,
+                status: existing.status,
+                result: existing.result,
+                duplicate: true,
+            }),
+        }
+    }
+
+    async fn dispatch(
+        pool: &PgPool,
+        user_id: Uuid,
+        command: GameCommand,
+    ) -> AppResult<serde_json::Value> {
+        match command {
+            GameCommand::RenameVillage { village_id, name } => {
+                let village = Self::owned_village(pool, user_id, village_id).await?;
+                let update = UpdateVillage { name: Some(name) };
+                let village =
+                    VillageRepository::update(pool, village.id, village.version, update).await?;
+                to_json(VillageResponse::from(village))
+            }
+            GameCommand::Build {
+                village_id,
+                slot,
+                building_type,
+            } => {
+                let village = Self::owned_village(pool, user_id, village_id).await?;
+                to_json(BuildingService::build(pool, &village, slot, building_type).await?)
+            }
+            GameCommand::UpgradeBuilding { village_id, slot } => {
+                let village = Self::owned_village(pool, user_id, village_id).await?;
+                to_json(BuildingService::upgrade(pool, &village, slot).await?)
+            }
+            GameCommand::DemolishBuilding { village_id, slot } => {
+                Self::owned_village(pool, user_id, village_id).await?;
+                BuildingService::demolish(pool, village_id, slot).await?;
+                Ok(serde_json::json!({ "message": "Building demolished successfully" }))
+            }
+            GameCommand::TrainTroops {
+                village_id,
+                troop_type,
+                count,
+            } => {
+                Self::owned_village(pool, user_id, village_id).await?;
+                to_json(TroopService::train_troops(pool, village_id, troop_type, count).await?)
+            }
+            GameCommand::CancelTraining {
+                village_id,
+                queue_id,
+            } => {
+                Self::owned_village(pool, user_id, village_id).await?;
+                TroopService::cancel_training(pool, village_id, queue_id).await?;
+                Ok(serde_json::json!({ "message": "Training cancelled successfully" }))
+            }
+            GameCommand::SendArmy {
+                village_id,
+                request,
+            } => {
+                Self::owned_village(pool, user_id, village_id).await?;
+                to_json(ArmyService::send_army(pool, user_id, village_id, request).await?)
+            }
+            GameCommand::RecallSupport { army_id } => {
+                to_json(ArmyService::recall_support(pool, army_id, user_id).await?)
+            }
+            GameCommand::ChangeHeroHome {
+                hero_id,
+                village_id,
+            } => {
+                to_json(HeroService::change_home_village(pool, user_id, hero_id, village_id).await?)
+            }
+            GameCommand::AssignHeroAttributes { hero_id, request } => {
+                to_json(HeroService::assign_attributes(pool, user_id, hero_id, request).await?)
+            }
+        }
+    }
+
+    async fn owned_village(pool: &PgPool, user_id: Uuid, village_id: Uuid) -> AppResult<Village> {
+        let village = VillageRepository::find_by_id(pool, village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".to_string()))?;
+
+        if village.user_id != user_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+
+        Ok(village)
+    }
+}
+
+/// Rebuild the error a rejected command was answered with
+fn error_from_status(status: i32, code: Option<&str>, message: String) -> AppError {
+    if let Some(code) = code.and_then(ErrorCode::from_name).filter(ErrorCode::is_gameplay) {
+        return AppError::Game(code, message);
+    }
+    match status {
+        401 => AppError::Unauthorized,
+        403 => AppError::Forbidden(message),
+        404 => AppError::NotFound(message),
+        409 => AppError::Conflict(message),
+        422 => AppError::ValidationError(message),
+        _ => AppError::BadRequest(message),
+    }
+}
+
+fn to_json<T: Serialize>(value: T) -> AppResult<serde_json::Value> {
+    serde_json::to_value(value).map_err(|e| AppError::InternalError(e.into()))
+}
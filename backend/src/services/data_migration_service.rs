@@ -0,0 +1,288 @@
+use serde_json::json;
+use sqlx::PgPool;
+use tracing::{error, info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::data_migration::{
+    DataMigration, DataMigrationChange, DataMigrationInfo, DataMigrationRollbackResult,
+    DataMigrationRun, DataMigrationStatus, StartDataMigrationRequest, DEFAULT_BATCH_SIZE,
+    MAX_BATCH_SIZE,
+};
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::data_migration_repo::DataMigrationRepository;
+use crate::services::building_service::BuildingService;
+use crate::services::village_stats_service::VillageStatsService;
+
+/// Runs kept in the admin listing
+const RUNS_LISTED: i64 = 50;
+
+/// Runs balance retrofits over live state. A run walks its table in
+/// batches, one transaction each, recording the old and new values of
+/// every row it changes; a dry run only records them. The cursor is saved
+/// with each batch, so a failed run resumes where it stopped, and an
+/// applied run can be rolled back from the recorded values.
+pub struct DataMigrationService;
+
+impl DataMigrationService {
+    pub fn available() -> Vec<DataMigrationInfo> {
+        DataMigration::ALL.into_iter().map(Into::into).collect()
+    }
+
+    pub async fn list_runs(pool: &PgPool) -> AppResult<Vec<DataMigrationRun>> {
+        DataMigrationRepository::list_runs(pool, RUNS_LISTED).await
+    }
+
+    pub async fn get_run(pool: &PgPool, id: Uuid) -> AppResult<DataMigrationRun> {
+        DataMigrationRepository::find_run(pool, id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Data migration run not found".into()))
+    }
+
+    pub async fn changes(
+        pool: &PgPool,
+        id: Uuid,
+        limit: i64,
+    ) -> AppResult<Vec<DataMigrationChange>> {
+        Self::get_run(pool, id).await?;
+        DataMigrationRepository::list_changes(pool, id, Some(limit)).await
+    }
+
+    /// Start a run in the background; follow it with `get_run`
+    pub async fn start(
+        pool: &PgPool,
+        admin_id: Uuid,
+        name: &str,
+        request: StartDataMigrationRequest,
+    ) -> AppResult<DataMigrationRun> {
+        let migration = DataMigration::from_name(name)
+            .ok_or_else(|| AppError::NotFound(format!("Unknown data migration {}", name)))?;
+        let batch_size = request.batch_size.unwrap_or(DEFAULT_BATCH_SIZE);
+        if !(1..=MAX_BATCH_SIZE).contains(&batch_size) {
+            return Err(AppError::BadRequest(format!(
+                "batch_size must be between 1 and {}",
+                MAX_BATCH_SIZE
+            )));
+        }
+        if DataMigrationRepository::find_running(pool, migration)
+            .await?
+            .is_some()
+        {
+            return Err(AppError::Conflict(format!(
+                "{} is already running",
+                migration.name()
+            )));
+        }
+
+        let run = DataMigrationRepository::create_run(
+            pool,
+            migration,
+            request.dry_run,
+            batch_size,
+            admin_id,
+        )
+        .await?;
+        info!(
+            "Data migration {} started by {} (run {}, dry run: {})",
+            migration.name(),
+            admin_id,
+            run.id,
+            run.dry_run
+        );
+
+        Self::spawn(pool, migration, run.clone());
+        Ok(run)
+    }
+
+    /// Continue a failed run after its last finished batch
+    pub async fn resume(pool: &PgPool, admin_id: Uuid, id: Uuid) -> AppResult<DataMigrationRun> {
+        let run = Self::get_run(pool, id).await?;
+        if run.status != DataMigrationStatus::Failed {
+            return Err(AppError::Conflict(
+                "Only a failed run can be resumed".into(),
+            ));
+        }
+        let migration = Self::migration_of(&run)?;
+        if DataMigrationRepository::find_running(pool, migration)
+            .await?
+            .is_some()
+        {
+            return Err(AppError::Conflict(format!(
+                "{} is already running",
+                migration.name()
+            )));
+        }
+
+        DataMigrationRepository::set_status(pool, id, DataMigrationStatus::Running, None).await?;
+        info!(
+            "Data migration run {} resumed by {} after {:?}",
+            id, admin_id, run.cursor
+        );
+
+        let run = Self::get_run(pool, id).await?;
+        Self::spawn(pool, migration, run.clone());
+        Ok(run)
+    }
+
+    /// Put back the values an applied run replaced. Rows changed again
+    /// since the run are left alone.
+    pub async fn rollback(
+        pool: &PgPool,
+        admin_id: Uuid,
+        id: Uuid,
+    ) -> AppResult<DataMigrationRollbackResult> {
+        let run = Self::get_run(pool, id).await?;
+        if run.dry_run {
+            return Err(AppError::BadRequest("A dry run changed nothing".into()));
+        }
+        if !matches!(
+            run.status,
+            DataMigrationStatus::Completed | DataMigrationStatus::Failed
+        ) {
+            return Err(AppError::Conflict(
+                "Only a completed or failed run can be rolled back".into(),
+            ));
+        }
+        let migration = Self::migration_of(&run)?;
+
+        let changes = DataMigrationRepository::list_changes(pool, id, None).await?;
+        let mut result = DataMigrationRollbackResult::default();
+        let mut tx = pool.begin().await?;
+        for change in &changes {
+            let restored = DataMigrationRepository::write_row(
+                &mut tx,
+                migration,
+                change.row_id,
+                &change.after,
+                &change.before,
+            )
+            .await?;
+            if restored {
+                result.restored += 1;
+            } else {
+                result.skipped += 1;
+            }
+        }
+        tx.commit().await?;
+
+        DataMigrationRepository::set_status(pool, id, DataMigrationStatus::RolledBack, None)
+            .await?;
+        info!(
+            "Data migration run {} rolled back by {}: {} restored, {} skipped",
+            id, admin_id, result.restored, result.skipped
+        );
+
+        Ok(result)
+    }
+
+    fn migration_of(run: &DataMigrationRun) -> AppResult<DataMigration> {
+        DataMigration::from_name(&run.migration).ok_or_else(|| {
+            AppError::BadRequest(format!("Data migration {} no longer exists", run.migration))
+        })
+    }
+
+    fn spawn(pool: &PgPool, migration: DataMigration, run: DataMigrationRun) {
+        let pool = pool.clone();
+        tokio::spawn(async move {
+            let (status, message) = match Self::process(&pool, migration, &run).await {
+                Ok(()) => (DataMigrationStatus::Completed, None),
+                Err(e) => {
+                    error!("Data migration run {} failed: {:?}", run.id, e);
+                    (DataMigrationStatus::Failed, Some(format!("{:?}", e)))
+                }
+            };
+            if let Err(e) =
+                DataMigrationRepository::set_status(&pool, run.id, status, message.as_deref()).await
+            {
+                warn!("Failed to finish data migration run {}: {:?}", run.id, e);
+            }
+        });
+    }
+
+    async fn process(
+        pool: &PgPool,
+        migration: DataMigration,
+        run: &DataMigrationRun,
+    ) -> AppResult<()> {
+        let mut cursor = run.cursor;
+        loop {
+            let rows = DataMigrationRepository::next_batch(pool, migration, cursor, run.batch_size)
+                .await?;
+            let Some(last) = rows.last().map(|(id, _)| *id) else {
+                break;
+            };
+
+            let mut planned = Vec::new();
+            for (row_id, before) in &rows {
+                let after = Self::recompute(pool, migration, *row_id).await?;
+                if after != *before {
+                    planned.push((*row_id, before, after));
+                }
+            }
+
+            let mut changed = 0;
+            let mut tx = pool.begin().await?;
+            for (row_id, before, after) in &planned {
+                // A row the game changed since it was read is left for a rerun
+                if !run.dry_run
+                    && !DataMigrationRepository::write_row(
+                        &mut tx, migration, *row_id, before, after,
+                    )
+                    .await?
+                {
+                    continue;
+                }
+                DataMigrationRepository::insert_change(
+                    &mut tx,
+                    run.id,
+                    migration.table(),
+                    *row_id,
+                    before,
+                    after,
+                )
+                .await?;
+                changed += 1;
+            }
+            DataMigrationRepository::record_batch(
+                &mut tx,
+                run.id,
+                last,
+                rows.len() as i64,
+                changed,
+            )
+            .await?;
+            tx.commit().await?;
+
+            cursor = Some(last);
+        }
+
+        info!(
+            "Data migration run {} ({}) finished",
+            run.id,
+            migration.name()
+        );
+        Ok(())
+    }
+
+    /// The migration's columns of a row under the current formulas
+    async fn recompute(
+        pool: &PgPool,
+        migration: DataMigration,
+        row_id: Uuid,
+    ) -> AppResult<serde_json::Value> {
+        let values = match migration {
+            DataMigration::StorageCapacity => {
+                let buildings = BuildingRepository::find_by_village_id(pool, row_id).await?;
+                let (warehouse, granary) = BuildingService::storage_capacity(&buildings);
+                json!({ "warehouse_capacity": warehouse, "granary_capacity": granary })
+            }
+            DataMigration::CultureProduction => {
+                let buildings = BuildingRepository::find_by_village_id(pool, row_id).await?;
+                let (population, culture_per_day) = VillageStatsService::expected(&buildings);
+                json!({ "population": population, "culture_per_day": culture_per_day })
+            }
+        };
+
+        Ok(values)
+    }
+}
@@ -0,0 +1,541 @@
+use chrono::{DateTime, Duration, Utc};
+use sqlx::PgPool;
+use std::collections::HashMap;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::activity::{ActivityKind, RequestOrigin};
+use crate::models::alliance::{AllianceRole, DiplomacyStatus};
+use crate::models::army::{ArmyTroops, MissionType, PlanArmyRequest, SendArmyRequest};
+use crate::models::building::BuildingType;
+use crate::models::defense_call::{
+    CreateDefenseCallRequest, DefenderMatch, DefenseCall, DefenseCallResponse,
+    PledgeDefenseRequest, MAX_CALL_AHEAD_HOURS, MAX_CALL_NOTE_LEN, MAX_DEFENDER_MATCHES,
+    MAX_OPEN_CALLS_PER_PLAYER,
+};
+use crate::models::troop::TroopType;
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::defense_call_repo::DefenseCallRepository;
+use crate::repositories::troop_repo::TroopRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::activity_service::ActivityService;
+use crate::services::army_service::ArmyService;
+use crate::services::clock;
+use crate::services::ws_service::{DefenseCallData, WsEvent, WsManager};
+
+/// Calls for defense. A member under attack posts one for a village; the
+/// server works out which villages of the alliance and its allies can land
+/// troops before the deadline, tells their owners, and tracks what was
+/// pledged against what arrived.
+pub struct DefenseCallService;
+
+impl DefenseCallService {
+    // ==================== Calls ====================
+
+    pub async fn create(
+        pool: &PgPool,
+        ws: &WsManager,
+        user_id: Uuid,
+        request: CreateDefenseCallRequest,
+    ) -> AppResult<DefenseCallResponse> {
+        let village = VillageRepository::find_by_id(pool, request.village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".into()))?;
+        if village.user_id != user_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        let member = AllianceRepository::get_user_alliance(pool, user_id)
+            .await?
+            .ok_or_else(|| {
+                AppError::BadRequest("You need an alliance to call for defense".into())
+            })?;
+
+        let note = request
+            .note
+            .as_deref()
+            .map(str::trim)
+            .filter(|n| !n.is_empty());
+        if note.is_some_and(|n| n.chars().count() > MAX_CALL_NOTE_LEN) {
+            return Err(AppError::ValidationError(format!(
+                "Notes can be at most {} characters",
+                MAX_CALL_NOTE_LEN
+            )));
+        }
+
+        let now = clock::now();
+        let deadline = match request.deadline {
+            Some(deadline) => deadline,
+            None => Self::first_attack(pool, village.id, now)
+                .await?
+                .ok_or_else(|| {
+                    AppError::BadRequest("No attack is on its way; give a deadline".into())
+                })?,
+        };
+        if deadline <= now || deadline > now + Duration::hours(MAX_CALL_AHEAD_HOURS) {
+            return Err(AppError::ValidationError(format!(
+                "The deadline must be within the next {} hours",
+                MAX_CALL_AHEAD_HOURS
+            )));
+        }
+
+        if DefenseCallRepository::find_open_for_village(pool, village.id, now)
+            .await?
+            .is_some()
+        {
+            return Err(AppError::Conflict(
+                "This village already has an open call".into(),
+            ));
+        }
+        if DefenseCallRepository::count_open_by_player(pool, user_id, now).await?
+            >= MAX_OPEN_CALLS_PER_PLAYER
+        {
+            return Err(AppError::BadRequest(format!(
+                "At most {} calls can be open at once",
+                MAX_OPEN_CALLS_PER_PLAYER
+            )));
+        }
+
+        let call_id = DefenseCallRepository::create(
+            pool,
+            member.alliance_id,
+            user_id,
+            village.id,
+            deadline,
+            note,
+        )
+        .await?;
+        let mut call = Self::find(pool, call_id).await?;
+
+        let matches = Self::matches(pool, &call, now).await?;
+        let mut villages: HashMap<Uuid, i32> = HashMap::new();
+        for m in matches.iter().filter(|m| m.player_id != user_id) {
+            *villages.entry(m.player_id).or_default() += 1;
+        }
+        for (player_id, count) in &villages {
+            let event = WsEvent::DefenseCall(DefenseCallData {
+                call_id,
+                player_name: call.player_name.clone(),
+                village_id: call.village_id,
+                x: call.x,
+                y: call.y,
+                deadline,
+                villages: *count,
+            });
+            ws.send_to_user(*player_id, &event).await;
+        }
+        call.notified = villages.len() as i32;
+        DefenseCallRepository::set_notified(pool, call_id, call.notified).await?;
+
+        info!(
+            "Player {} called for defense of village {} by {}, {} defenders notified",
+            user_id, village.id, deadline, call.notified
+        );
+
+        Self::response(pool, call, Some(matches)).await
+    }
+
+    /// Open calls the player can answer, soonest deadline first
+    pub async fn list(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<DefenseCall>> {
+        let Some(member) = AllianceRepository::get_user_alliance(pool, user_id).await? else {
+            return Ok(Vec::new());
+        };
+        DefenseCallRepository::find_open_for(pool, member.alliance_id, clock::now()).await
+    }
+
+    /// A call with its pledges, and while it is open, who could still help
+    pub async fn get(
+        pool: &PgPool,
+        user_id: Uuid,
+        call_id: Uuid,
+    ) -> AppResult<DefenseCallResponse> {
+        let call = Self::find(pool, call_id).await?;
+        Self::check_access(pool, &call, user_id).await?;
+
+        let now = clock::now();
+        let matches = if call.is_open(now) {
+            Some(Self::matches(pool, &call, now).await?)
+        } else {
+            None
+        };
+        Self::response(pool, call, matches).await
+    }
+
+    /// Call off a call. Its caller, the leader or an officer may; troops
+    /// already sent keep going.
+    pub async fn cancel(
+        pool: &PgPool,
+        user_id: Uuid,
+        call_id: Uuid,
+    ) -> AppResult<DefenseCallResponse> {
+        let call = Self::find(pool, call_id).await?;
+        if call.player_id != user_id {
+            let member = AllianceRepository::get_member(pool, call.alliance_id, user_id)
+                .await?
+                .filter(|m| m.role != AllianceRole::Member);
+            if member.is_none() {
+                return Err(AppError::Forbidden(
+                    "Only the caller, the leader and officers can cancel a call".into(),
+                ));
+            }
+        }
+
+        if !DefenseCallRepository::cancel(pool, call_id).await? {
+            return Err(AppError::BadRequest("Call is already cancelled".into()));
+        }
+        info!("Defense call {} cancelled by {}", call_id, user_id);
+
+        Self::response(pool, Self::find(pool, call_id).await?, None).await
+    }
+
+    // ==================== Pledges ====================
+
+    /// Promise troops to a call, sending them at once unless asked not to
+    pub async fn pledge(
+        pool: &PgPool,
+        user_id: Uuid,
+        call_id: Uuid,
+        request: PledgeDefenseRequest,
+        origin: RequestOrigin,
+    ) -> AppResult<DefenseCallResponse> {
+        let call = Self::find(pool, call_id).await?;
+        Self::check_access(pool, &call, user_id).await?;
+        Self::check_open(&call)?;
+
+        let village = VillageRepository::find_by_id(pool, request.from_village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".into()))?;
+        if village.user_id != user_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        if village.id == call.village_id {
+            return Err(AppError::BadRequest(
+                "Troops can't reinforce their own village".into(),
+            ));
+        }
+        Self::check_in_time(pool, &call, village.id, &request.troops).await?;
+        Self::check_at_home(pool, village.id, &request.troops).await?;
+
+        if request.send_later {
+            DefenseCallRepository::create_pledge(
+                pool,
+                call_id,
+                user_id,
+                village.id,
+                &request.troops,
+            )
+            .await?;
+        } else {
+            let (army_id, lands_at) =
+                Self::send(pool, user_id, &call, village.id, &request.troops, origin).await?;
+            let pledge_id = DefenseCallRepository::create_pledge(
+                pool,
+                call_id,
+                user_id,
+                village.id,
+                &request.troops,
+            )
+            .await?;
+            DefenseCallRepository::set_sent(pool, pledge_id, army_id, lands_at).await?;
+        }
+
+        info!(
+            "Player {} pledged {} troops from village {} to defense call {}",
+            user_id,
+            request.troops.values().sum::<i32>(),
+            village.id,
+            call_id
+        );
+
+        Self::get(pool, user_id, call_id).await
+    }
+
+    /// Send the troops of a pledge made to send later
+    pub async fn send_pledge(
+        pool: &PgPool,
+        user_id: Uuid,
+        pledge_id: Uuid,
+        origin: RequestOrigin,
+    ) -> AppResult<DefenseCallResponse> {
+        let pledge = DefenseCallRepository::find_pledge(pool, pledge_id)
+            .await?
+            .filter(|p| p.player_id == user_id)
+            .ok_or_else(|| AppError::NotFound("Pledge not found".into()))?;
+        if pledge.army_id.is_some() {
+            return Err(AppError::BadRequest(
+                "These troops are already on their way".into(),
+            ));
+        }
+
+        let call = Self::find(pool, pledge.call_id).await?;
+        Self::check_open(&call)?;
+        Self::check_in_time(pool, &call, pledge.from_village_id, &pledge.troops).await?;
+
+        let (army_id, lands_at) = Self::send(
+            pool,
+            user_id,
+            &call,
+            pledge.from_village_id,
+            &pledge.troops,
+            origin,
+        )
+        .await?;
+        DefenseCallRepository::set_sent(pool, pledge_id, army_id, lands_at).await?;
+
+        Self::get(pool, user_id, call.id).await
+    }
+
+    /// Take back a pledge that hasn't been sent. Sent troops are recalled
+    /// from the rally point instead.
+    pub async fn withdraw(pool: &PgPool, user_id: Uuid, pledge_id: Uuid) -> AppResult<()> {
+        let pledge = DefenseCallRepository::find_pledge(pool, pledge_id)
+            .await?
+            .filter(|p| p.player_id == user_id)
+            .ok_or_else(|| AppError::NotFound("Pledge not found".into()))?;
+        if pledge.army_id.is_some() {
+            return Err(AppError::BadRequest(
+                "These troops are already on their way; recall them instead".into(),
+            ));
+        }
+
+        DefenseCallRepository::delete_pledge(pool, pledge_id).await
+    }
+
+    // ==================== Helpers ====================
+
+    async fn send(
+        pool: &PgPool,
+        user_id: Uuid,
+        call: &DefenseCall,
+        from_village_id: Uuid,
+        troops: &ArmyTroops,
+        origin: RequestOrigin,
+    ) -> AppResult<(Uuid, DateTime<Utc>)> {
+        let army = ArmyService::send_army(
+            pool,
+            user_id,
+            from_village_id,
+            SendArmyRequest {
+                to_x: call.x,
+                to_y: call.y,
+                mission: MissionType::Support,
+                troops: troops.clone(),
+                resources: Default::default(),
+                hero_id: None,
+            },
+        )
+        .await?;
+
+        ActivityService::record_own(
+            pool,
+            user_id,
+            ActivityKind::ArmySent,
+            origin,
+            serde_json::json!({
+                "army_id": army.id,
+                "from_village_id": from_village_id,
+                "mission": army.mission,
+                "to_x": army.to_x,
+                "to_y": army.to_y,
+                "troops": army.troops,
+                "defense_call_id": call.id,
+            }),
+        );
+
+        Ok((army.id, army.arrives_at))
+    }
+
+    /// Villages that can land troops before the deadline if they leave now,
+    /// most defense first
+    async fn matches(
+        pool: &PgPool,
+        call: &DefenseCall,
+        now: DateTime<Utc>,
+    ) -> AppResult<Vec<DefenderMatch>> {
+        let mut alliances = vec![call.alliance_id];
+        alliances.extend(
+            AllianceRepository::list_diplomacy(pool, call.alliance_id)
+                .await?
+                .into_iter()
+                .filter(|d| d.status == DiplomacyStatus::Ally)
+                .map(|d| d.target_alliance_id),
+        );
+
+        let definitions = TroopRepository::get_all_definitions(pool).await?;
+        let rows =
+            DefenseCallRepository::find_defender_troops(pool, &alliances, call.village_id).await?;
+
+        let mut by_village: HashMap<Uuid, DefenderMatch> = HashMap::new();
+        for row in rows {
+            // Chiefs are for taking villages, not holding them
+            if row.troop_type.is_chief() {
+                continue;
+            }
+            let Some(definition) = definitions.iter().find(|d| d.troop_type == row.troop_type)
+            else {
+                continue;
+            };
+            if definition.defense_infantry + definition.defense_cavalry <= 0 {
+                continue;
+            }
+
+            let distance = ArmyService::calculate_distance(row.x, row.y, call.x, call.y);
+            let speed_bonus =
+                BuildingType::TournamentSquare.speed_bonus_percent(row.tournament_square_level);
+            let travel = ArmyService::calculate_travel_time(
+                distance,
+                &HashMap::from([(row.troop_type, 1)]),
+                &definitions,
+                speed_bonus,
+            );
+            let arrives_at = now + travel;
+            if arrives_at > call.deadline {
+                continue;
+            }
+
+            let village = by_village
+                .entry(row.village_id)
+                .or_insert_with(|| DefenderMatch {
+                    player_id: row.player_id,
+                    player_name: row.player_name.clone(),
+                    village_id: row.village_id,
+                    village_name: row.village_name.clone(),
+                    x: row.x,
+                    y: row.y,
+                    distance,
+                    troops: ArmyTroops::new(),
+                    defense_infantry: 0,
+                    defense_cavalry: 0,
+                    arrives_at,
+                });
+            village.troops.insert(row.troop_type, row.in_village);
+            village.defense_infantry += definition.defense_infantry as i64 * row.in_village as i64;
+            village.defense_cavalry += definition.defense_cavalry as i64 * row.in_village as i64;
+            village.arrives_at = village.arrives_at.max(arrives_at);
+        }
+
+        let mut matches: Vec<DefenderMatch> = by_village.into_values().collect();
+        matches.sort_by_key(|m| std::cmp::Reverse(m.defense_infantry + m.defense_cavalry));
+        matches.truncate(MAX_DEFENDER_MATCHES);
+
+        Ok(matches)
+    }
+
+    async fn response(
+        pool: &PgPool,
+        call: DefenseCall,
+        matches: Option<Vec<DefenderMatch>>,
+    ) -> AppResult<DefenseCallResponse> {
+        let pledges = DefenseCallRepository::find_pledges(pool, call.id).await?;
+
+        let mut pledged: HashMap<TroopType, i64> = HashMap::new();
+        let mut arrived: HashMap<TroopType, i64> = HashMap::new();
+        for pledge in &pledges {
+            for (troop, count) in pledge.troops.0.iter() {
+                *pledged.entry(*troop).or_default() += *count as i64;
+                if pledge.arrived_at.is_some() {
+                    *arrived.entry(*troop).or_default() += *count as i64;
+                }
+            }
+        }
+
+        Ok(DefenseCallResponse {
+            call,
+            pledged,
+            arrived,
+            pledges,
+            matches: matches.unwrap_or_default(),
+        })
+    }
+
+    /// Landing time of the earliest hostile army on its way to the village
+    async fn first_attack(
+        pool: &PgPool,
+        village_id: Uuid,
+        now: DateTime<Utc>,
+    ) -> AppResult<Option<DateTime<Utc>>> {
+        Ok(ArmyService::get_incoming_armies(pool, village_id)
+            .await?
+            .into_iter()
+            .filter(|a| a.mission.is_hostile() && !a.is_returning && a.arrives_at > now)
+            .map(|a| a.arrives_at)
+            .min())
+    }
+
+    async fn find(pool: &PgPool, call_id: Uuid) -> AppResult<DefenseCall> {
+        DefenseCallRepository::find_by_id(pool, call_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Defense call not found".into()))
+    }
+
+    /// Members of the caller's alliance, and of alliances it lists as
+    /// allies, may see and answer a call
+    async fn check_access(pool: &PgPool, call: &DefenseCall, user_id: Uuid) -> AppResult<()> {
+        let Some(member) = AllianceRepository::get_user_alliance(pool, user_id).await? else {
+            return Err(AppError::Forbidden("Access denied".into()));
+        };
+        if member.alliance_id == call.alliance_id {
+            return Ok(());
+        }
+
+        let allied = AllianceRepository::get_diplomacy(pool, call.alliance_id, member.alliance_id)
+            .await?
+            .is_some_and(|d| d.status == DiplomacyStatus::Ally);
+        if !allied {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        Ok(())
+    }
+
+    fn check_open(call: &DefenseCall) -> AppResult<()> {
+        if !call.is_open(clock::now()) {
+            return Err(AppError::BadRequest("This call is no longer open".into()));
+        }
+        Ok(())
+    }
+
+    /// Troops sent now land before the deadline
+    async fn check_in_time(
+        pool: &PgPool,
+        call: &DefenseCall,
+        from_village_id: Uuid,
+        troops: &ArmyTroops,
+    ) -> AppResult<()> {
+        let plan = ArmyService::plan_army(
+            pool,
+            from_village_id,
+            PlanArmyRequest {
+                to_x: call.x,
+                to_y: call.y,
+                mission: MissionType::Support,
+                troops: troops.clone(),
+            },
+        )
+        .await?;
+        if plan.arrives_at > call.deadline {
+            return Err(AppError::BadRequest(format!(
+                "These troops would land at {}, after the deadline",
+                plan.arrives_at
+            )));
+        }
+        Ok(())
+    }
+
+    async fn check_at_home(pool: &PgPool, village_id: Uuid, troops: &ArmyTroops) -> AppResult<()> {
+        let home = TroopRepository::find_by_village(pool, village_id).await?;
+        for (troop_type, count) in troops {
+            let available = home
+                .iter()
+                .find(|t| t.troop_type == *troop_type)
+                .map(|t| t.in_village)
+                .unwrap_or(0);
+            if *count < 0 || *count > available {
+                return Err(AppError::BadRequest(format!(
+                    "Only {} {:?} are home",
+                    available, troop_type
+                )));
+            }
+        }
+        Ok(())
+    }
+}
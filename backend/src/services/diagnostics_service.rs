@@ -0,0 +1,117 @@
+use chrono::{DateTime, TimeZone, Utc};
+use std::sync::LazyLock;
+use tracing::info;
+
+use crate::error::AppResult;
+use crate::models::diagnostics::{
+    BreakerStatus, BuildInfo, DbActivity, DiagnosticsDump, MemoryStats, PoolStats, RuntimeStats,
+    RuntimeVars, WebSocketStats,
+};
+use crate::AppState;
+
+/// Process start, forced in main so uptime counts from boot
+pub static STARTED_AT: LazyLock<DateTime<Utc>> = LazyLock::new(Utc::now);
+
+pub struct DiagnosticsService;
+
+impl DiagnosticsService {
+    pub fn build_info(state: &AppState) -> BuildInfo {
+        let built_at = env!("BUILD_TIMESTAMP")
+            .parse::<i64>()
+            .ok()
+            .and_then(|ts| Utc.timestamp_opt(ts, 0).single());
+
+        BuildInfo {
+            version: env!("CARGO_PKG_VERSION"),
+            git_sha: env!("BUILD_GIT_SHA"),
+            built_at,
+            environment: state.config.server.environment.clone(),
+            started_at: *STARTED_AT,
+            uptime_secs: (Utc::now() - *STARTED_AT).num_seconds(),
+        }
+    }
+
+    pub async fn runtime_vars(state: &AppState) -> RuntimeVars {
+        let metrics = tokio::runtime::Handle::current().metrics();
+
+        RuntimeVars {
+            uptime_secs: (Utc::now() - *STARTED_AT).num_seconds(),
+            runtime: RuntimeStats {
+                workers: metrics.num_workers(),
+                alive_tasks: metrics.num_alive_tasks(),
+                global_queue_depth: metrics.global_queue_depth(),
+            },
+            memory: read_memory_stats().await,
+            db_pool: PoolStats {
+                size: state.db.size(),
+                idle: state.db.num_idle(),
+                max_connections: state.config.database.max_connections,
+            },
+            websocket: WebSocketStats {
+                connected_users: state.ws.connected_users_count().await,
+                connections: state.ws.total_connections_count().await,
+            },
+            breakers: state
+                .auth
+                .breaker()
+                .into_iter()
+                .chain([&state.stripe_breaker])
+                .map(|b| BreakerStatus {
+                    name: b.name(),
+                    state: b.state(),
+                })
+                .collect(),
+        }
+    }
+
+    /// Full snapshot for incident debugging; also written to the log so it
+    /// survives in log storage after the response is gone
+    pub async fn dump(state: &AppState) -> AppResult<DiagnosticsDump> {
+        let db_activity = sqlx::query_as::<_, DbActivity>(
+            r#"
+            SELECT pid, state, wait_event_type, wait_event, query_start, query
+            FROM pg_stat_activity
+            WHERE datname = current_database() AND pid <> pg_backend_pid()
+            ORDER BY query_start NULLS LAST
+            "#,
+        )
+        .fetch_all(&state.db)
+        .await?;
+
+        let dump = DiagnosticsDump {
+            taken_at: Utc::now(),
+            build: Self::build_info(state),
+            vars: Self::runtime_vars(state).await,
+            db_activity,
+        };
+
+        info!(
+            "Diagnostics dump: {}",
+            serde_json::to_string(&dump).unwrap_or_default()
+        );
+
+        Ok(dump)
+    }
+}
+
+async fn read_memory_stats() -> MemoryStats {
+    let Ok(status) = tokio::fs::read_to_string("/proc/self/status").await else {
+        return MemoryStats::default();
+    };
+
+    // Lines look like "VmRSS:     123456 kB"
+    let field = |name: &str| {
+        status
+            .lines()
+            .find_map(|line| line.strip_prefix(name))
+            .and_then(|rest| rest.trim_start_matches(':').split_whitespace().next())
+            .and_then(|v| v.parse::<u64>().ok())
+    };
+
+    MemoryStats {
+        rss_bytes: field("VmRSS").map(|kb| kb * 1024),
+        peak_rss_bytes: field("VmHWM").map(|kb| kb * 1024),
+        virtual_bytes: field("VmSize").map(|kb| kb * 1024),
+        threads: field("Threads"),
+    }
+}
@@ -0,0 +1,198 @@
+use chrono::{DateTime, Datelike, Duration, NaiveDate, Utc};
+use serde_json::json;
+use sqlx::PgPool;
+use std::collections::HashMap;
+use tracing::{info, warn};
+
+use crate::error::{AppError, AppResult};
+use crate::models::digest::{DigestContent, WeeklyDigest, DIGEST_SECTION_SIZE};
+use crate::models::template::{RenderedTemplate, TemplateKey, DEFAULT_LOCALE};
+use crate::repositories::digest_repo::DigestRepository;
+use crate::services::clock;
+use crate::services::discord::DiscordWebhook;
+use crate::services::mailer::Mailer;
+use crate::services::projection_service::ProjectionService;
+use crate::services::template_service::TemplateService;
+
+/// The weekly world newspaper
+pub struct DigestService;
+
+impl DigestService {
+    /// Generate the last full week's digest if it doesn't exist yet, and
+    /// mail and post it where configured. Returns the new digest, if any.
+    pub async fn run(
+        pool: &PgPool,
+        mailer: Option<&Mailer>,
+        discord: Option<&DiscordWebhook>,
+    ) -> AppResult<Option<WeeklyDigest>> {
+        let week_start = Self::last_full_week();
+
+        let digest = match DigestRepository::find(pool, week_start).await? {
+            Some(_) => None,
+            None => Some(Self::generate(pool, week_start).await?),
+        };
+
+        if let Some(mailer) = mailer {
+            Self::send(pool, mailer, week_start).await?;
+        }
+        if let Some(discord) = discord {
+            Self::post(pool, discord, week_start).await?;
+        }
+
+        Ok(digest)
+    }
+
+    /// Build the digest for the week starting `week_start` (a Monday).
+    /// Regenerating a week overwrites it; climbers are measured against the
+    /// previous week's population snapshot.
+    pub async fn generate(pool: &PgPool, week_start: NaiveDate) -> AppResult<WeeklyDigest> {
+        if week_start.weekday().num_days_from_monday() != 0 {
+            return Err(AppError::BadRequest("week_start must be a Monday".into()));
+        }
+        if week_start + Duration::days(7) > clock::now().date_naive() {
+            return Err(AppError::BadRequest("That week hasn't ended yet".into()));
+        }
+
+        let (from, to) = (
+            start_of(week_start),
+            start_of(week_start + Duration::days(7)),
+        );
+
+        // Current populations, so the climbers and the snapshot are exact
+        ProjectionService::rebuild(pool).await?;
+
+        let content = DigestContent {
+            climbers: DigestRepository::climbers(
+                pool,
+                week_start - Duration::days(7),
+                DIGEST_SECTION_SIZE,
+            )
+            .await?,
+            battles: DigestRepository::biggest_battles(pool, from, to, DIGEST_SECTION_SIZE).await?,
+            alliances: DigestRepository::new_alliances(pool, from, to, DIGEST_SECTION_SIZE).await?,
+        };
+        DigestRepository::snapshot_population(pool, week_start).await?;
+
+        let digest = DigestRepository::upsert(pool, week_start, &content, clock::now()).await?;
+
+        info!(
+            "Weekly digest for {}: {} climbers, {} battles, {} new alliances",
+            week_start,
+            content.climbers.len(),
+            content.battles.len(),
+            content.alliances.len()
+        );
+
+        Ok(digest)
+    }
+
+    /// Monday of the most recent week that has fully ended
+    pub fn last_full_week() -> NaiveDate {
+        let today = clock::now().date_naive();
+        today - Duration::days(today.weekday().num_days_from_monday() as i64 + 7)
+    }
+
+    pub async fn latest(pool: &PgPool) -> AppResult<WeeklyDigest> {
+        DigestRepository::find_latest(pool)
+            .await?
+            .ok_or_else(|| AppError::NotFound("No digest has been published yet".into()))
+    }
+
+    pub async fn get(pool: &PgPool, week_start: NaiveDate) -> AppResult<WeeklyDigest> {
+        DigestRepository::find(pool, week_start)
+            .await?
+            .ok_or_else(|| AppError::NotFound("No digest for that week".into()))
+    }
+
+    /// Mail a digest to the players who opted in, once
+    async fn send(pool: &PgPool, mailer: &Mailer, week_start: NaiveDate) -> AppResult<()> {
+        let Some(digest) = DigestRepository::find(pool, week_start).await? else {
+            return Ok(());
+        };
+        if digest.emailed_at.is_some()
+            || !DigestRepository::mark_emailed(pool, week_start, clock::now()).await?
+        {
+            return Ok(());
+        }
+
+        let context = context(week_start, &digest.content);
+        let mut rendered: HashMap<String, RenderedTemplate> = HashMap::new();
+
+        let recipients = DigestRepository::recipients(pool).await?;
+        let mut sent = 0;
+        for recipient in &recipients {
+            if !rendered.contains_key(&recipient.locale) {
+                let email = TemplateService::render(
+                    pool,
+                    TemplateKey::WeeklyDigestEmail,
+                    &recipient.locale,
+                    &context,
+                )
+                .await?;
+                rendered.insert(recipient.locale.clone(), email);
+            }
+            let email = &rendered[&recipient.locale];
+            match mailer.send(&recipient.email, &email.subject, &email.body).await {
+                Ok(()) => sent += 1,
+                Err(e) => warn!("Weekly digest to {} failed: {:#}", recipient.user_id, e),
+            }
+        }
+
+        info!(
+            "Weekly digest for {} mailed to {}/{} players",
+            week_start,
+            sent,
+            recipients.len()
+        );
+
+        Ok(())
+    }
+
+    /// Post a digest to the Discord channel, once
+    async fn post(pool: &PgPool, discord: &DiscordWebhook, week_start: NaiveDate) -> AppResult<()> {
+        let Some(digest) = DigestRepository::find(pool, week_start).await? else {
+            return Ok(());
+        };
+        if !DigestRepository::mark_posted(pool, week_start, clock::now()).await? {
+            return Ok(());
+        }
+
+        let embed = TemplateService::render(
+            pool,
+            TemplateKey::WeeklyDigestDiscord,
+            DEFAULT_LOCALE,
+            &context(week_start, &digest.content),
+        )
+        .await?;
+        match discord.post_embed(&embed.subject, &embed.body).await {
+            Ok(()) => info!("Weekly digest for {} posted to Discord", week_start),
+            Err(e) => warn!("Weekly digest post to Discord failed: {:#}", e),
+        }
+
+        Ok(())
+    }
+}
+
+fn start_of(day: NaiveDate) -> DateTime<Utc> {
+    day.and_hms_opt(0, 0, 0).unwrap_or_default().and_utc()
+}
+
+/// What the digest templates render
+fn context(week_start: NaiveDate, content: &DigestContent) -> serde_json::Value {
+    json!({
+        "week_start": week_start,
+        "climbers": content
+            .climbers
+            .iter()
+            .enumerate()
+            .map(|(i, c)| json!({
+                "rank": i + 1,
+                "display_name": c.display_name,
+                "gained": c.gained,
+                "population": c.population,
+            }))
+            .collect::<Vec<_>>(),
+        "battles": content.battles,
+        "alliances": content.alliances,
+    })
+}
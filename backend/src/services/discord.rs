@@ -0,0 +1,73 @@
+use anyhow::{bail, Context, Result};
+use reqwest::Client;
+use serde::Serialize;
+
+/// Discord's limits on an embed
+const MAX_TITLE_CHARS: usize = 256;
+const MAX_DESCRIPTION_CHARS: usize = 4096;
+
+/// Embed accent, Travillian gold
+const EMBED_COLOR: u32 = 0xC9A227;
+
+/// Posts embeds to a Discord channel through a webhook
+#[derive(Clone)]
+pub struct DiscordWebhook {
+    client: Client,
+    url: String,
+}
+
+#[derive(Serialize)]
+struct WebhookMessage<'a> {
+    embeds: [Embed<'a>; 1],
+}
+
+#[derive(Serialize)]
+struct Embed<'a> {
+    title: &'a str,
+    description: &'a str,
+    color: u32,
+}
+
+impl DiscordWebhook {
+    /// The webhook at `url`, or `None` when it isn't configured
+    pub fn from_url(url: Option<&str>) -> Option<Self> {
+        let url = url.filter(|u| !u.is_empty())?;
+
+        Some(Self {
+            client: Client::new(),
+            url: url.to_string(),
+        })
+    }
+
+    /// Post one embed. Text over Discord's limits is cut short.
+    pub async fn post_embed(&self, title: &str, description: &str) -> Result<()> {
+        let title = truncate(title, MAX_TITLE_CHARS);
+        let description = truncate(description, MAX_DESCRIPTION_CHARS);
+
+        let response = self
+            .client
+            .post(&self.url)
+            .json(&WebhookMessage {
+                embeds: [Embed {
+                    title,
+                    description,
+                    color: EMBED_COLOR,
+                }],
+            })
+            .send()
+            .await
+            .context("Discord webhook request failed")?;
+        if !response.status().is_success() {
+            bail!("Discord webhook failed with status {}", response.status());
+        }
+
+        Ok(())
+    }
+}
+
+fn truncate(text: &str, max_chars: usize) -> &str {
+    match text.char_indices().nth(max_chars) {
+        Some((end, _)) => &text[..end],
+        None => text,
+    }
+}
@@ -0,0 +1,112 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::error;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::army::CarriedResources;
+use crate::models::economy::{
+    EconomyFlow, EconomyFlowQuery, LedgerEntry, LedgerKind, NewLedgerEntry, TradeHistoryQuery,
+    MAX_FLOW_HOURS,
+};
+use crate::models::market::ResourceShipment;
+use crate::repositories::economy_repo::EconomyRepository;
+use crate::services::clock;
+
+/// Ledger of resources moving between players, for the trade history and
+/// anti-pushing investigations
+pub struct EconomyService;
+
+impl EconomyService {
+    /// Store the entry. A failed write is logged rather than failing the
+    /// transfer, which has already happened by now.
+    pub async fn record(pool: &PgPool, entry: NewLedgerEntry) {
+        if entry.resources.total() <= 0 {
+            return;
+        }
+        if let Err(e) = EconomyRepository::insert(pool, &entry).await {
+            error!(
+                "Failed to record {:?} of {} from {} to {}: {:?}",
+                entry.kind,
+                entry.resources.total(),
+                entry.from_user_id,
+                entry.to_user_id,
+                e
+            );
+        }
+    }
+
+    pub async fn record_shipment(pool: &PgPool, shipment: &ResourceShipment) {
+        Self::record(
+            pool,
+            NewLedgerEntry {
+                kind: LedgerKind::Shipment,
+                from_user_id: shipment.sender_id,
+                to_user_id: shipment.receiver_id,
+                from_village_id: shipment.from_village_id,
+                to_village_id: shipment.to_village_id,
+                resources: CarriedResources {
+                    wood: shipment.wood,
+                    clay: shipment.clay,
+                    iron: shipment.iron,
+                    crop: shipment.crop,
+                },
+                source_id: shipment.id,
+            },
+        )
+        .await;
+    }
+
+    /// Resources an attack took from the defender, recorded when taken
+    /// rather than when the army gets home
+    pub async fn record_plunder(
+        pool: &PgPool,
+        defender_id: Uuid,
+        target_village_id: Uuid,
+        attacker_id: Uuid,
+        home_village_id: Uuid,
+        stolen: &CarriedResources,
+        report_id: Uuid,
+    ) {
+        Self::record(
+            pool,
+            NewLedgerEntry {
+                kind: LedgerKind::Plunder,
+                from_user_id: defender_id,
+                to_user_id: attacker_id,
+                from_village_id: target_village_id,
+                to_village_id: home_village_id,
+                resources: stolen.clone(),
+                source_id: report_id,
+            },
+        )
+        .await;
+    }
+
+    pub async fn history(
+        pool: &PgPool,
+        user_id: Uuid,
+        query: &TradeHistoryQuery,
+    ) -> AppResult<Vec<LedgerEntry>> {
+        EconomyRepository::history(pool, user_id, query).await
+    }
+
+    pub async fn flows(pool: &PgPool, query: &EconomyFlowQuery) -> AppResult<Vec<EconomyFlow>> {
+        if !(1..=MAX_FLOW_HOURS).contains(&query.hours) {
+            return Err(AppError::BadRequest(format!(
+                "hours must be between 1 and {}",
+                MAX_FLOW_HOURS
+            )));
+        }
+
+        EconomyRepository::flows(
+            pool,
+            clock::now() - Duration::hours(query.hours),
+            query.kind,
+            query.user_id,
+            query.min_total.max(0),
+            query.limit,
+        )
+        .await
+    }
+}
@@ -0,0 +1,204 @@
+use anyhow::{anyhow, Context, Result};
+use async_trait::async_trait;
+use chrono::{DateTime, Utc};
+use reqwest::Client;
+use serde::Deserialize;
+use serde_json::{json, Map, Value};
+
+use crate::config::{gcp_access_token, Config};
+use crate::models::account::{AuthUserRecord, NewAuthUser};
+
+const IDENTITY_TOOLKIT_URL: &str = "https://identitytoolkit.googleapis.com/v1";
+
+/// UIDs the lookup endpoint takes per call
+const LOOKUP_BATCH: usize = 100;
+
+/// Server-side management of sign-in accounts, so the admin API and
+/// anti-cheat never talk to the identity provider directly
+#[async_trait]
+pub trait UserAdmin: Send + Sync {
+    /// Create a sign-in account with a password; returns its UID
+    async fn create_user(&self, user: &NewAuthUser) -> Result<String>;
+
+    /// Block or allow sign-in. Disabling also stops token refreshes.
+    async fn set_disabled(&self, uid: &str, disabled: bool) -> Result<()>;
+
+    /// Replace the account's custom claims, which show up in its ID tokens
+    async fn set_custom_claims(&self, uid: &str, claims: &Map<String, Value>) -> Result<()>;
+
+    /// Accounts for the UIDs that exist, in no particular order
+    async fn lookup(&self, uids: &[String]) -> Result<Vec<AuthUserRecord>>;
+
+    /// Set the sign-in email, marked verified since the player proved they
+    /// own it
+    async fn update_email(&self, uid: &str, email: &str) -> Result<()>;
+
+    /// Invalidate every refresh token of the account, signing it out on
+    /// all devices once their current ID tokens expire
+    async fn revoke_refresh_tokens(&self, uid: &str) -> Result<()>;
+}
+
+/// `UserAdmin` over Firebase Auth's Identity Toolkit API, authenticated as
+/// the instance's service account (or with GCP_ACCESS_TOKEN)
+#[derive(Clone)]
+pub struct FirebaseAdmin {
+    client: Client,
+    project_id: String,
+    access_token: Option<String>,
+}
+
+#[derive(Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct CreatedAccount {
+    local_id: String,
+}
+
+#[derive(Deserialize)]
+struct LookupResponse {
+    #[serde(default)]
+    users: Vec<AccountInfo>,
+}
+
+#[derive(Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct AccountInfo {
+    local_id: String,
+    email: Option<String>,
+    display_name: Option<String>,
+    #[serde(default)]
+    disabled: bool,
+    /// Claims as a JSON string
+    custom_attributes: Option<String>,
+    /// Milliseconds since the epoch, as strings
+    created_at: Option<String>,
+    last_login_at: Option<String>,
+}
+
+impl From<AccountInfo> for AuthUserRecord {
+    fn from(a: AccountInfo) -> Self {
+        Self {
+            uid: a.local_id,
+            email: a.email,
+            display_name: a.display_name,
+            disabled: a.disabled,
+            custom_claims: a
+                .custom_attributes
+                .and_then(|c| serde_json::from_str(&c).ok())
+                .unwrap_or_default(),
+            created_at: a.created_at.as_deref().and_then(from_millis),
+            last_login_at: a.last_login_at.as_deref().and_then(from_millis),
+        }
+    }
+}
+
+fn from_millis(ms: &str) -> Option<DateTime<Utc>> {
+    DateTime::from_timestamp_millis(ms.parse().ok()?)
+}
+
+impl FirebaseAdmin {
+    /// Build the client, or `None` when players don't sign in with Firebase
+    pub fn from_config(config: &Config) -> Option<Self> {
+        if config.firebase.auth_provider != "firebase" {
+            return None;
+        }
+
+        Some(Self {
+            client: Client::new(),
+            project_id: config.firebase.project_id.clone(),
+            access_token: config.secrets.gcp_access_token.clone(),
+        })
+    }
+
+    async fn call(&self, method: &str, body: Value) -> Result<Value> {
+        let token = gcp_access_token(&self.client, self.access_token.as_deref()).await?;
+
+        let response = self
+            .client
+            .post(format!(
+                "{}/projects/{}/{}",
+                IDENTITY_TOOLKIT_URL, self.project_id, method
+            ))
+            .bearer_auth(token)
+            .json(&body)
+            .send()
+            .await
+            .context("Firebase Auth unreachable")?;
+
+        let status = response.status();
+        let body: Value = response.json().await.unwrap_or_default();
+        if !status.is_success() {
+            let message = body["error"]["message"].as_str().unwrap_or("no details");
+            return Err(anyhow!(
+                "Firebase Auth {} failed ({}): {}",
+                method,
+                status,
+                message
+            ));
+        }
+
+        Ok(body)
+    }
+
+    async fn update_account(&self, uid: &str, mut changes: Value) -> Result<()> {
+        changes["localId"] = json!(uid);
+        self.call("accounts:update", changes)
+            .await
+            .with_context(|| format!("Failed to update account {}", uid))?;
+        Ok(())
+    }
+}
+
+#[async_trait]
+impl UserAdmin for FirebaseAdmin {
+    async fn create_user(&self, user: &NewAuthUser) -> Result<String> {
+        let created = self
+            .call(
+                "accounts",
+                json!({
+                    "email": user.email,
+                    "password": user.password,
+                    "displayName": user.display_name,
+                    "emailVerified": true,
+                }),
+            )
+            .await?;
+
+        let created: CreatedAccount =
+            serde_json::from_value(created).context("Unexpected create response")?;
+        Ok(created.local_id)
+    }
+
+    async fn set_disabled(&self, uid: &str, disabled: bool) -> Result<()> {
+        self.update_account(uid, json!({ "disableUser": disabled }))
+            .await
+    }
+
+    async fn set_custom_claims(&self, uid: &str, claims: &Map<String, Value>) -> Result<()> {
+        let claims = serde_json::to_string(claims)?;
+        self.update_account(uid, json!({ "customAttributes": claims }))
+            .await
+    }
+
+    async fn lookup(&self, uids: &[String]) -> Result<Vec<AuthUserRecord>> {
+        let mut records = Vec::with_capacity(uids.len());
+        for batch in uids.chunks(LOOKUP_BATCH) {
+            let found = self
+                .call("accounts:lookup", json!({ "localId": batch }))
+                .await?;
+            let found: LookupResponse =
+                serde_json::from_value(found).context("Unexpected lookup response")?;
+            records.extend(found.users.into_iter().map(AuthUserRecord::from));
+        }
+        Ok(records)
+    }
+
+    async fn update_email(&self, uid: &str, email: &str) -> Result<()> {
+        self.update_account(uid, json!({ "email": email, "emailVerified": true }))
+            .await
+    }
+
+    async fn revoke_refresh_tokens(&self, uid: &str) -> Result<()> {
+        let now = Utc::now().timestamp().to_string();
+        self.update_account(uid, json!({ "validSince": now })).await
+    }
+}
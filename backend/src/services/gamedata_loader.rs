@@ -0,0 +1,428 @@
+use anyhow::{bail, Context, Result};
+use serde::de::DeserializeOwned;
+use serde::Serialize;
+use sqlx::PgPool;
+use std::collections::{HashMap, HashSet};
+use std::path::{Path, PathBuf};
+use std::time::SystemTime;
+
+use crate::config::GameDataConfig;
+use crate::models::building::BuildingType;
+use crate::models::gamedata::{
+    self, BuildingDefinition, BuildingsFile, GameDefinitions, TribeDefinition, TribesFile,
+    UnitDefinition, UnitsFile, EMBEDDED_BUILDINGS, EMBEDDED_TRIBES, EMBEDDED_UNITS,
+};
+use crate::models::troop::{TribeType, TroopType};
+use crate::repositories::troop_repo::TroopRepository;
+use crate::services::gamedata_service::GameDataService;
+
+/// Highest max_level a building definition may declare
+const MAX_BUILDING_LEVEL: i32 = 100;
+
+/// Tribe bonuses must stay within this many percent either way
+const MAX_TRIBE_BONUS: i32 = 50;
+
+pub struct GameDataLoader;
+
+impl GameDataLoader {
+    /// Read and validate the definitions and make them current. Invalid data
+    /// is rejected as a whole, listing every problem found.
+    pub fn load(config: &GameDataConfig) -> Result<()> {
+        let definitions = Self::read(config)?;
+        gamedata::install(definitions);
+        Ok(())
+    }
+
+    /// Reload after an edit in development. On error the previous
+    /// definitions stay in effect.
+    pub async fn reload(pool: &PgPool, config: &GameDataConfig) -> Result<()> {
+        Self::load(config)?;
+        Self::sync_units(pool).await?;
+        Ok(())
+    }
+
+    /// Write the current unit definitions to troop_definitions, which the
+    /// training and combat code read
+    pub async fn sync_units(pool: &PgPool) -> Result<()> {
+        TroopRepository::upsert_definitions(pool, &gamedata::definitions().units).await?;
+        GameDataService::invalidate();
+        Ok(())
+    }
+
+    /// Modification times of the override files, to notice edits
+    pub fn fingerprint(config: &GameDataConfig) -> Vec<Option<SystemTime>> {
+        let Some(dir) = config.dir.as_deref() else {
+            return Vec::new();
+        };
+
+        ["buildings", "units", "tribes"]
+            .iter()
+            .map(|name| {
+                find_file(Path::new(dir), name)
+                    .and_then(|path| std::fs::metadata(path).ok())
+                    .and_then(|meta| meta.modified().ok())
+            })
+            .collect()
+    }
+
+    fn read(config: &GameDataConfig) -> Result<GameDefinitions> {
+        let dir = config.dir.as_deref().map(Path::new);
+
+        let buildings: BuildingsFile = match dir.and_then(|d| find_file(d, "buildings")) {
+            Some(path) => read_file(&path)?,
+            None => parse(EMBEDDED_BUILDINGS, "buildings.yaml", false)?,
+        };
+        let units: UnitsFile = match dir.and_then(|d| find_file(d, "units")) {
+            Some(path) => read_file(&path)?,
+            None => parse(EMBEDDED_UNITS, "units.yaml", false)?,
+        };
+        let tribes: TribesFile = match dir.and_then(|d| find_file(d, "tribes")) {
+            Some(path) => read_file(&path)?,
+            None => parse(EMBEDDED_TRIBES, "tribes.yaml", false)?,
+        };
+
+        let mut errors = validate(&buildings.buildings, &units.units);
+        errors.extend(validate_tribes(&tribes.tribes));
+        if !errors.is_empty() {
+            bail!("Invalid game data:\n  {}", errors.join("\n  "));
+        }
+
+        Ok(GameDefinitions {
+            buildings: buildings
+                .buildings
+                .into_iter()
+                .map(|b| (b.building_type.clone(), b))
+                .collect(),
+            units: units.units,
+            tribes: tribes.tribes,
+        })
+    }
+}
+
+// ==================== Files ====================
+
+fn find_file(dir: &Path, name: &str) -> Option<PathBuf> {
+    ["yaml", "yml", "json"]
+        .iter()
+        .map(|ext| dir.join(format!("{}.{}", name, ext)))
+        .find(|path| path.is_file())
+}
+
+fn read_file<T: DeserializeOwned>(path: &Path) -> Result<T> {
+    let content = std::fs::read_to_string(path)
+        .with_context(|| format!("Failed to read {}", path.display()))?;
+    let is_json = path.extension().is_some_and(|ext| ext == "json");
+    parse(&content, &path.display().to_string(), is_json)
+}
+
+fn parse<T: DeserializeOwned>(content: &str, source: &str, is_json: bool) -> Result<T> {
+    if is_json {
+        serde_json::from_str(content).with_context(|| format!("Failed to parse {}", source))
+    } else {
+        serde_yaml::from_str(content).with_context(|| format!("Failed to parse {}", source))
+    }
+}
+
+// ==================== Validation ====================
+
+fn validate(buildings: &[BuildingDefinition], units: &[UnitDefinition]) -> Vec<String> {
+    let mut errors = Vec::new();
+
+    let mut by_type: HashMap<&BuildingType, &BuildingDefinition> = HashMap::new();
+    for def in buildings {
+        let name = label(&def.building_type);
+        if by_type.insert(&def.building_type, def).is_some() {
+            errors.push(format!("building {}: defined more than once", name));
+        }
+        if !(1..=MAX_BUILDING_LEVEL).contains(&def.max_level) {
+            errors.push(format!(
+                "building {}: max_level must be between 1 and {}",
+                name, MAX_BUILDING_LEVEL
+            ));
+        }
+        if def.population < 0 {
+            errors.push(format!(
+                "building {}: population must not be negative",
+                name
+            ));
+        }
+        if def.culture_points < 0 {
+            errors.push(format!(
+                "building {}: culture_points must not be negative",
+                name
+            ));
+        }
+        let cost = &def.cost;
+        if [
+            cost.wood,
+            cost.clay,
+            cost.iron,
+            cost.crop,
+            cost.time_seconds,
+        ]
+        .iter()
+        .any(|v| *v <= 0)
+        {
+            errors.push(format!("building {}: cost values must be positive", name));
+        }
+    }
+
+    for building_type in BuildingType::ALL {
+        if !by_type.contains_key(building_type) {
+            errors.push(format!(
+                "building {}: missing definition",
+                label(building_type)
+            ));
+        }
+    }
+
+    for def in buildings {
+        for prereq in &def.prerequisites {
+            match by_type.get(&prereq.building_type) {
+                None => errors.push(format!(
+                    "building {}: prerequisite {} is not defined",
+                    label(&def.building_type),
+                    label(&prereq.building_type)
+                )),
+                Some(required) if !(1..=required.max_level).contains(&prereq.min_level) => errors
+                    .push(format!(
+                        "building {}: prerequisite {} level {} is outside 1..={}",
+                        label(&def.building_type),
+                        label(&prereq.building_type),
+                        prereq.min_level,
+                        required.max_level
+                    )),
+                Some(_) => {}
+            }
+        }
+    }
+
+    if let Some(cycle) = find_cycle(&by_type) {
+        errors.push(format!("prerequisite cycle: {}", cycle.join(" -> ")));
+    }
+
+    let mut seen = HashSet::new();
+    for unit in units {
+        let name = label(&unit.troop_type);
+        if !seen.insert(unit.troop_type) {
+            errors.push(format!("unit {}: defined more than once", name));
+        }
+        if unit.tribe != unit.troop_type.tribe() {
+            errors.push(format!(
+                "unit {}: tribe must be {}",
+                name,
+                label(&unit.troop_type.tribe())
+            ));
+        }
+        if unit.name.trim().is_empty() {
+            errors.push(format!("unit {}: name is required", name));
+        }
+        if [
+            unit.attack,
+            unit.defense_infantry,
+            unit.defense_cavalry,
+            unit.carry_capacity,
+            unit.crop_consumption,
+        ]
+        .iter()
+        .any(|v| *v < 0)
+        {
+            errors.push(format!("unit {}: stats must not be negative", name));
+        }
+        if unit.speed <= 0 || unit.training_time_seconds <= 0 {
+            errors.push(format!(
+                "unit {}: speed and training_time_seconds must be positive",
+                name
+            ));
+        }
+        let cost = &unit.cost;
+        if [cost.wood, cost.clay, cost.iron, cost.crop]
+            .iter()
+            .any(|v| *v <= 0)
+        {
+            errors.push(format!("unit {}: cost values must be positive", name));
+        }
+        match by_type.get(&unit.requires.building_type) {
+            None => errors.push(format!(
+                "unit {}: required building {} is not defined",
+                name,
+                label(&unit.requires.building_type)
+            )),
+            Some(required) if !(1..=required.max_level).contains(&unit.requires.min_level) => {
+                errors.push(format!(
+                    "unit {}: required {} level {} is outside 1..={}",
+                    name,
+                    label(&unit.requires.building_type),
+                    unit.requires.min_level,
+                    required.max_level
+                ))
+            }
+            Some(_) => {}
+        }
+        if let Some(research) = &unit.research {
+            let cost = &research.cost;
+            if [cost.wood, cost.clay, cost.iron, cost.crop, research.time_seconds]
+                .iter()
+                .any(|v| *v <= 0)
+            {
+                errors.push(format!(
+                    "unit {}: research cost and time_seconds must be positive",
+                    name
+                ));
+            }
+            if !research
+                .requires
+                .iter()
+                .any(|r| r.building_type == BuildingType::Academy)
+            {
+                errors.push(format!("unit {}: research must require the academy", name));
+            }
+            for prereq in &research.requires {
+                match by_type.get(&prereq.building_type) {
+                    None => errors.push(format!(
+                        "unit {}: research building {} is not defined",
+                        name,
+                        label(&prereq.building_type)
+                    )),
+                    Some(required) if !(1..=required.max_level).contains(&prereq.min_level) => {
+                        errors.push(format!(
+                            "unit {}: research {} level {} is outside 1..={}",
+                            name,
+                            label(&prereq.building_type),
+                            prereq.min_level,
+                            required.max_level
+                        ))
+                    }
+                    Some(_) => {}
+                }
+            }
+        }
+        if unit.troop_type.is_chief() {
+            if !(1..=100).contains(&unit.loyalty_reduction) {
+                errors.push(format!(
+                    "unit {}: loyalty_reduction must be between 1 and 100",
+                    name
+                ));
+            }
+        } else if unit.loyalty_reduction != 0 {
+            errors.push(format!("unit {}: only chiefs reduce loyalty", name));
+        }
+    }
+
+    for troop_type in TroopType::ALL {
+        if !seen.contains(troop_type) {
+            errors.push(format!("unit {}: missing definition", label(troop_type)));
+        }
+    }
+
+    errors
+}
+
+fn validate_tribes(tribes: &[TribeDefinition]) -> Vec<String> {
+    let mut errors = Vec::new();
+
+    let mut seen = HashSet::new();
+    let mut reserved: HashMap<&BuildingType, TribeType> = HashMap::new();
+    for def in tribes {
+        let name = label(&def.tribe);
+        if !def.tribe.is_playable() {
+            errors.push(format!("tribe {}: not a playable tribe", name));
+        }
+        if !seen.insert(def.tribe) {
+            errors.push(format!("tribe {}: defined more than once", name));
+        }
+        if def.name.trim().is_empty() {
+            errors.push(format!("tribe {}: name is required", name));
+        }
+        if def.merchant_capacity <= 0 {
+            errors.push(format!("tribe {}: merchant_capacity must be positive", name));
+        }
+        let bonus = &def.bonus;
+        if [
+            bonus.wood,
+            bonus.clay,
+            bonus.iron,
+            bonus.crop,
+            bonus.attack,
+            bonus.defense,
+        ]
+        .iter()
+        .any(|v| v.abs() > MAX_TRIBE_BONUS)
+        {
+            errors.push(format!(
+                "tribe {}: bonuses must be between -{} and {}",
+                name, MAX_TRIBE_BONUS, MAX_TRIBE_BONUS
+            ));
+        }
+        for building_type in &def.buildings {
+            if building_type.is_resource_field() {
+                errors.push(format!(
+                    "tribe {}: resource field {} cannot be tribe-only",
+                    name,
+                    label(building_type)
+                ));
+            }
+            if let Some(other) = reserved.insert(building_type, def.tribe) {
+                errors.push(format!(
+                    "tribe {}: building {} is already reserved for {}",
+                    name,
+                    label(building_type),
+                    label(&other)
+                ));
+            }
+        }
+    }
+
+    for tribe in TribeType::PLAYABLE {
+        if !seen.contains(&tribe) {
+            errors.push(format!("tribe {}: missing definition", label(&tribe)));
+        }
+    }
+
+    errors
+}
+
+/// First prerequisite cycle found, as the chain of building names
+fn find_cycle(by_type: &HashMap<&BuildingType, &BuildingDefinition>) -> Option<Vec<String>> {
+    fn visit<'a>(
+        building_type: &'a BuildingType,
+        by_type: &HashMap<&'a BuildingType, &'a BuildingDefinition>,
+        path: &mut Vec<&'a BuildingType>,
+        done: &mut HashSet<&'a BuildingType>,
+    ) -> Option<Vec<String>> {
+        if done.contains(building_type) {
+            return None;
+        }
+        if let Some(start) = path.iter().position(|t| *t == building_type) {
+            let mut cycle: Vec<String> = path[start..].iter().map(|t| label(*t)).collect();
+            cycle.push(label(building_type));
+            return Some(cycle);
+        }
+
+        path.push(building_type);
+        if let Some(def) = by_type.get(building_type) {
+            for prereq in &def.prerequisites {
+                if let Some(cycle) = visit(&prereq.building_type, by_type, path, done) {
+                    return Some(cycle);
+                }
+            }
+        }
+        path.pop();
+        done.insert(building_type);
+
+        None
+    }
+
+    let mut done = HashSet::new();
+    BuildingType::ALL
+        .iter()
+        .find_map(|t| visit(t, by_type, &mut Vec::new(), &mut done))
+}
+
+/// The snake_case name used in the data files
+fn label<T: Serialize>(value: &T) -> String {
+    serde_json::to_value(value)
+        .ok()
+        .and_then(|v| v.as_str().map(str::to_string))
+        .unwrap_or_default()
+}
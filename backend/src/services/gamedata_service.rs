@@ -0,0 +1,157 @@
+use serde_json::Value;
+use sha2::{Digest, Sha256};
+use sqlx::PgPool;
+use std::sync::{LazyLock, RwLock};
+use std::time::{Duration, Instant};
+
+use crate::error::{AppError, AppResult};
+use crate::models::building::BuildingType;
+use crate::models::gamedata::{
+    self, BuildingCatalogEntry, BuildingLevelData, GameDataCatalog, GameDataVersion,
+    TribeCatalogEntry,
+};
+use crate::models::hero::ItemDefinitionResponse;
+use crate::models::troop::{TribeType, TroopDefinitionResponse};
+use crate::repositories::gamedata_repo::GameDataRepository;
+use crate::repositories::hero_repo::HeroRepository;
+use crate::repositories::troop_repo::TroopRepository;
+
+/// How long the generated catalog is reused before checking for changes
+const CATALOG_TTL: Duration = Duration::from_secs(60);
+
+/// A published catalog: version plus its serialized body
+#[derive(Debug, Clone)]
+pub struct PublishedCatalog {
+    pub version: String,
+    pub data: Value,
+}
+
+static CURRENT: LazyLock<RwLock<Option<(PublishedCatalog, Instant)>>> =
+    LazyLock::new(|| RwLock::new(None));
+
+pub struct GameDataService;
+
+impl GameDataService {
+    /// The catalog generated from the running server's definitions,
+    /// published under its content hash the first time it's seen
+    pub async fn current(pool: &PgPool) -> AppResult<PublishedCatalog> {
+        if let Some((catalog, built_at)) = CURRENT.read().unwrap().as_ref() {
+            if built_at.elapsed() < CATALOG_TTL {
+                return Ok(catalog.clone());
+            }
+        }
+
+        let catalog = Self::build(pool).await?;
+        let data = serde_json::to_value(&catalog).map_err(|e| AppError::InternalError(e.into()))?;
+        GameDataRepository::publish(pool, &catalog.version, &data).await?;
+
+        let published = PublishedCatalog {
+            version: catalog.version,
+            data,
+        };
+        *CURRENT.write().unwrap() = Some((published.clone(), Instant::now()));
+
+        Ok(published)
+    }
+
+    /// A specific published version, or the current one
+    pub async fn get(pool: &PgPool, version: Option<&str>) -> AppResult<PublishedCatalog> {
+        let current = Self::current(pool).await?;
+        let Some(version) = version.filter(|v| *v != current.version) else {
+            return Ok(current);
+        };
+
+        let data = GameDataRepository::find(pool, version)
+            .await?
+            .ok_or_else(|| {
+                AppError::NotFound(format!("Game data version {} not found", version))
+            })?;
+
+        Ok(PublishedCatalog {
+            version: version.to_string(),
+            data,
+        })
+    }
+
+    /// Drop the cached catalog so the next request regenerates it
+    pub fn invalidate() {
+        *CURRENT.write().unwrap() = None;
+    }
+
+    pub async fn list_versions(pool: &PgPool) -> AppResult<Vec<GameDataVersion>> {
+        GameDataRepository::list_versions(pool).await
+    }
+
+    async fn build(pool: &PgPool) -> AppResult<GameDataCatalog> {
+        let game = gamedata::definitions();
+        let buildings = BuildingType::ALL
+            .iter()
+            .map(|building_type| BuildingCatalogEntry {
+                building_type: building_type.clone(),
+                max_level: building_type.max_level(),
+                is_resource_field: building_type.is_resource_field(),
+                tribe: game.building_tribe(building_type),
+                prerequisites: building_type.prerequisites(),
+                levels: (1..=building_type.max_level())
+                    .map(|level| BuildingLevelData {
+                        level,
+                        cost: building_type.cost_at_level(level),
+                        population: building_type.population_at_level(level),
+                        culture_points: building_type.culture_points_at_level(level),
+                        production_per_hour: building_type.production_per_hour(level),
+                        storage_capacity: building_type.storage_capacity(level),
+                    })
+                    .collect(),
+            })
+            .collect();
+
+        let definitions = TroopRepository::get_all_definitions(pool).await?;
+
+        let mut tribes: Vec<TribeCatalogEntry> = Vec::new();
+        for tribe in [
+            TribeType::Phasuttha,
+            TribeType::Nava,
+            TribeType::Kiri,
+            TribeType::Special,
+        ] {
+            let def = game.tribe(tribe);
+            tribes.push(TribeCatalogEntry {
+                tribe,
+                name: def.map(|d| d.name.clone()),
+                description: def.and_then(|d| d.description.clone()),
+                playable: tribe.is_playable(),
+                units: definitions
+                    .iter()
+                    .filter(|d| d.tribe == tribe)
+                    .map(|d| d.troop_type)
+                    .collect(),
+                buildings: def.map(|d| d.buildings.clone()).unwrap_or_default(),
+                merchant_capacity: def.map(|d| d.merchant_capacity),
+                split_build_queue: def.is_some_and(|d| d.split_build_queue),
+                bonus: def.map(|d| d.bonus).unwrap_or_default(),
+            });
+        }
+
+        let units: Vec<TroopDefinitionResponse> =
+            definitions.into_iter().map(|d| d.into()).collect();
+        let items: Vec<ItemDefinitionResponse> = HeroRepository::get_all_items(pool)
+            .await?
+            .into_iter()
+            .map(|i| i.into())
+            .collect();
+
+        let mut catalog = GameDataCatalog {
+            version: String::new(),
+            buildings,
+            units,
+            tribes,
+            items,
+        };
+
+        let content =
+            serde_json::to_vec(&catalog).map_err(|e| AppError::InternalError(e.into()))?;
+        catalog.version = hex::encode(Sha256::digest(&content))[..16].to_string();
+
+        Ok(catalog)
+    }
+}
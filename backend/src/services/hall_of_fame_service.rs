@@ -0,0 +1,95 @@
+use sqlx::PgPool;
+use std::collections::HashMap;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::db::shard::ShardResolver;
+use crate::error::AppResult;
+use crate::models::hall_of_fame::{
+    CareerResponse, FinishWorldResult, HallOfFameEntry, Medal, ALLIANCE_MEDAL_CATEGORIES,
+    MEDAL_PLACES,
+};
+use crate::repositories::hall_of_fame_repo::HallOfFameRepository;
+use crate::repositories::projection_repo::ProjectionRepository;
+use crate::services::clock;
+use crate::services::projection_service::ProjectionService;
+
+/// End-of-world results kept on the primary database, across worlds
+pub struct HallOfFameService;
+
+impl HallOfFameService {
+    /// Record the final standings of a world in the hall of fame. The
+    /// world's read models are rebuilt first so the results are exact.
+    pub async fn finish_world(
+        pool: &PgPool,
+        shards: &ShardResolver,
+        world_id: &str,
+    ) -> AppResult<FinishWorldResult> {
+        let world_pool = shards.pool_for(world_id)?;
+        ProjectionService::rebuild(&world_pool).await?;
+
+        let standings = HallOfFameRepository::final_standings(&world_pool).await?;
+        let rankings = ProjectionRepository::list_world_rankings(&world_pool).await?;
+
+        // Medals by player, and by alliance for alliance categories
+        let mut player_medals: HashMap<Uuid, Vec<Medal>> = HashMap::new();
+        let mut alliance_medals: HashMap<Uuid, Vec<Medal>> = HashMap::new();
+        for ranking in rankings.into_iter().filter(|r| r.rank <= MEDAL_PLACES) {
+            let medals = if ALLIANCE_MEDAL_CATEGORIES.contains(&ranking.category.as_str()) {
+                &mut alliance_medals
+            } else {
+                &mut player_medals
+            };
+            medals.entry(ranking.entity_id).or_default().push(Medal {
+                category: ranking.category,
+                rank: ranking.rank,
+            });
+        }
+
+        let ended_at = clock::now();
+        let mut medals_awarded = 0;
+        for standing in &standings {
+            let mut medals = player_medals.remove(&standing.user_id).unwrap_or_default();
+            if let Some(alliance) = standing.alliance_id.and_then(|id| alliance_medals.get(&id)) {
+                medals.extend(alliance.iter().cloned());
+            }
+            medals_awarded += medals.len();
+
+            HallOfFameRepository::upsert(pool, world_id, standing, &medals, ended_at).await?;
+        }
+
+        info!(
+            "World {} recorded in the hall of fame: {} players, {} medals",
+            world_id,
+            standings.len(),
+            medals_awarded
+        );
+
+        Ok(FinishWorldResult {
+            world_id: world_id.to_string(),
+            players_recorded: standings.len(),
+            medals_awarded,
+        })
+    }
+
+    /// A player's history across worlds, by Firebase account
+    pub async fn career(pool: &PgPool, firebase_uid: &str) -> AppResult<CareerResponse> {
+        let worlds = HallOfFameRepository::find_by_account(pool, firebase_uid).await?;
+
+        Ok(CareerResponse {
+            worlds_played: worlds.len(),
+            best_rank: worlds.iter().map(|w| w.final_rank).min(),
+            medal_count: worlds.iter().map(|w| w.medals.0.len()).sum(),
+            worlds,
+        })
+    }
+
+    pub async fn world(
+        pool: &PgPool,
+        world_id: &str,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<HallOfFameEntry>> {
+        HallOfFameRepository::list_world(pool, world_id, limit.clamp(1, 500), offset.max(0)).await
+    }
+}
@@ -1,18 +1,24 @@
-use chrono::{Duration, Utc};
-use rand::Rng;
+use async_trait::async_trait;
+use chrono::{DateTime, Duration, Utc};
+use rand::rngs::StdRng;
+use rand::{Rng, RngCore, SeedableRng};
 use sqlx::PgPool;
 use uuid::Uuid;
 
-use crate::error::{AppError, AppResult};
+use crate::error::{AppError, AppResult, ErrorCode};
 use crate::models::hero::{
-    AdventureDifficulty, AssignAttributesRequest, AvailableAdventureResponse, CreateHeroRequest,
-    EquippedItemsResponse, Hero, HeroAdventureResponse, HeroItemResponse, HeroListResponse,
-    HeroResponse, HeroSlotPurchaseResponse, HeroStatus, InventoryResponse, ItemDefinitionResponse,
-    ItemRarity, ItemSlot, ReviveInfoResponse, ReviveResourceCost,
+    AdventureDifficulty, AdventureRewards, AssignAttributesRequest, AvailableAdventureResponse,
+    CreateHeroRequest, EquippedItemsResponse, Hero, HeroAdventure, HeroAdventureResponse,
+    HeroItemResponse, HeroListResponse, HeroProduction, HeroResponse, HeroSlotPurchaseResponse,
+    HeroStatus, InventoryResponse, ItemDefinition, ItemDefinitionResponse, ItemRarity, ItemSlot,
+    ReviveInfoResponse, ReviveResourceCost, SetResourceFocusRequest,
 };
 use crate::repositories::hero_repo::HeroRepository;
 use crate::repositories::shop_repo::ShopRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock::{self, Clock};
+use crate::services::resource_service::ResourceService;
+use crate::services::tribe_service::TribeService;
 
 pub struct HeroService;
 
@@ -67,7 +73,7 @@ impl HeroService {
         let used_slots = HeroRepository::count_user_heroes(pool, user_id).await?;
 
         if used_slots >= total_slots {
-            return Err(AppError::BadRequest("No hero slots available".into()));
+            return Err(ErrorCode::NoHeroSlots.into());
         }
 
         // Verify village ownership
@@ -79,6 +85,18 @@ impl HeroService {
             return Err(AppError::Forbidden("Village does not belong to you".into()));
         }
 
+        // Heroes come from the player's own tribe
+        let tribe = TribeService::player_tribe(pool, user_id).await?;
+        if request.tribe != tribe {
+            return Err(AppError::Game(
+                ErrorCode::WrongTribe,
+                format!(
+                    "Heroes must be of your tribe ({:?})",
+                    tribe
+                ),
+            ));
+        }
+
         // Find next available slot
         let slot_number = used_slots + 1;
 
@@ -123,7 +141,13 @@ impl HeroService {
             return Err(AppError::Forbidden("Village does not belong to you".into()));
         }
 
-        let hero = HeroRepository::update_home_village(pool, hero_id, village_id).await?;
+        // The resource points stop paying the old home and start on the new one
+        if hero.resources_bonus > 0 {
+            ResourceService::update_village_resources(pool, hero.home_village_id).await?;
+            ResourceService::update_village_resources(pool, village_id).await?;
+        }
+
+        let hero = HeroRepository::update_home_village(pool, hero_id, hero.version, village_id).await?;
         Ok(hero.into())
     }
 
@@ -147,11 +171,14 @@ impl HeroService {
             request.fighting_strength + request.off_bonus + request.def_bonus + request.resources_bonus;
 
         if total_points <= 0 {
-            return Err(AppError::BadRequest("Must assign at least 1 point".into()));
+            return Err(AppError::ValidationError("Must assign at least 1 point".into()));
         }
 
         if total_points > hero.unassigned_points {
-            return Err(AppError::BadRequest("Not enough unassigned points".into()));
+            return Err(AppError::Game(
+                ErrorCode::InsufficientPoints,
+                "Not enough unassigned points".into(),
+            ));
         }
 
         // Validate no negative values
@@ -160,12 +187,17 @@ impl HeroService {
             || request.def_bonus < 0
             || request.resources_bonus < 0
         {
-            return Err(AppError::BadRequest("Cannot assign negative points".into()));
+            return Err(AppError::ValidationError("Cannot assign negative points".into()));
+        }
+
+        if request.resources_bonus > 0 {
+            Self::settle_production(pool, &hero).await?;
         }
 
         let hero = HeroRepository::assign_attributes(
             pool,
             hero_id,
+            hero.version,
             request.fighting_strength,
             request.off_bonus,
             request.def_bonus,
@@ -177,6 +209,99 @@ impl HeroService {
         Ok(hero.into())
     }
 
+    /// Choose whether resource points pay out all four resources or one
+    pub async fn set_resource_focus(
+        pool: &PgPool,
+        user_id: Uuid,
+        hero_id: Uuid,
+        request: SetResourceFocusRequest,
+    ) -> AppResult<HeroResponse> {
+        let hero = Self::owned_hero(pool, user_id, hero_id).await?;
+
+        if hero.resource_focus == request.focus {
+            return Err(AppError::Game(ErrorCode::NoChange, "Hero already has that focus".into()));
+        }
+
+        let now = clock::now();
+        if let Some(at) = hero.focus_available_at().filter(|at| *at > now) {
+            return Err(AppError::TooManyRequests(format!(
+                "Resource focus can be changed again at {}",
+                at.to_rfc3339()
+            )));
+        }
+
+        // Production so far is paid at the old focus
+        Self::settle_production(pool, &hero).await?;
+
+        let hero =
+            HeroRepository::set_resource_focus(pool, hero_id, hero.version, request.focus, now)
+                .await?;
+        Ok(hero.into())
+    }
+
+    /// Take back every assigned attribute point so it can be spent again
+    pub async fn reset_attributes(
+        pool: &PgPool,
+        user_id: Uuid,
+        hero_id: Uuid,
+    ) -> AppResult<HeroResponse> {
+        let hero = Self::owned_hero(pool, user_id, hero_id).await?;
+
+        let assigned =
+            hero.fighting_strength + hero.off_bonus + hero.def_bonus + hero.resources_bonus;
+        if assigned == 0 {
+            return Err(AppError::Game(
+                ErrorCode::InsufficientPoints,
+                "No points are assigned".into(),
+            ));
+        }
+
+        let now = clock::now();
+        if let Some(at) = hero.reset_available_at().filter(|at| *at > now) {
+            return Err(AppError::TooManyRequests(format!(
+                "Attributes can be reset again at {}",
+                at.to_rfc3339()
+            )));
+        }
+
+        Self::settle_production(pool, &hero).await?;
+
+        let hero = HeroRepository::reset_attributes(pool, hero_id, hero.version, now).await?;
+        Ok(hero.into())
+    }
+
+    /// Flat hourly resources a village gets from the heroes living there
+    pub async fn production_bonus(pool: &PgPool, village_id: Uuid) -> AppResult<HeroProduction> {
+        let heroes = HeroRepository::find_by_home_village(pool, village_id).await?;
+
+        let mut total = HeroProduction::default();
+        for hero in heroes {
+            total.add(hero.resource_production());
+        }
+        Ok(total)
+    }
+
+    /// Pay the home village what the hero's resource points have made so
+    /// far. Call it before anything that changes that output.
+    pub(crate) async fn settle_production(pool: &PgPool, hero: &Hero) -> AppResult<()> {
+        if hero.resources_bonus > 0 {
+            ResourceService::update_village_resources(pool, hero.home_village_id).await?;
+        }
+        Ok(())
+    }
+
+    async fn owned_hero(pool: &PgPool, user_id: Uuid, hero_id: Uuid) -> AppResult<Hero> {
+        let hero = HeroRepository::find_by_id(pool, hero_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Hero not found".into()))?;
+
+        if hero.user_id != user_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+
+        Ok(hero)
+    }
+
     // ==================== Hero Slots ====================
 
     /// Buy additional hero slot with gold
@@ -185,18 +310,18 @@ impl HeroService {
         let next_slot = current_slots + 1;
 
         if next_slot > 5 {
-            return Err(AppError::BadRequest("Maximum hero slots reached".into()));
+            return Err(AppError::Game(ErrorCode::NoHeroSlots, "Maximum hero slots reached".into()));
         }
 
         // Get price
         let price = HeroRepository::get_slot_price(pool, next_slot)
             .await?
-            .ok_or_else(|| AppError::BadRequest("Invalid slot".into()))?;
+            .ok_or_else(|| AppError::ValidationError("Invalid slot".into()))?;
 
         // Check gold balance
         let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
         if balance < price.gold_cost {
-            return Err(AppError::BadRequest("Insufficient gold".into()));
+            return Err(ErrorCode::InsufficientGold.into());
         }
 
         // Deduct gold
@@ -343,20 +468,26 @@ impl HeroService {
         }
 
         if hero_item.is_equipped {
-            return Err(AppError::BadRequest("Item is already equipped".into()));
+            return Err(AppError::Game(ErrorCode::NoChange, "Item is already equipped".into()));
         }
 
         // Check level requirement
         if hero.level < item_def.required_level {
-            return Err(AppError::BadRequest(format!(
-                "Requires level {}",
-                item_def.required_level
-            )));
+            return Err(AppError::Game(
+                ErrorCode::LevelTooLow,
+                format!(
+                    "Requires level {}",
+                    item_def.required_level
+                ),
+            ));
         }
 
         // Consumables cannot be equipped
         if item_def.is_consumable {
-            return Err(AppError::BadRequest("Consumables cannot be equipped".into()));
+            return Err(AppError::Game(
+                ErrorCode::WrongItemType,
+                "Consumables cannot be equipped".into(),
+            ));
         }
 
         // Unequip existing item in same slot
@@ -419,14 +550,15 @@ impl HeroService {
         }
 
         if !item_def.is_consumable {
-            return Err(AppError::BadRequest("Item is not consumable".into()));
+            return Err(AppError::Game(ErrorCode::WrongItemType, "Item is not consumable".into()));
         }
 
         // Apply item effect
         let mut updated_hero = hero.clone();
         if item_def.health_restore > 0 {
             let new_health = (hero.health + item_def.health_restore).min(100);
-            updated_hero = HeroRepository::update_health(pool, hero_id, new_health).await?;
+            updated_hero =
+                HeroRepository::update_health(pool, hero_id, new_health, clock::now()).await?;
         }
 
         // Use (consume) the item
@@ -460,7 +592,10 @@ impl HeroService {
         }
 
         if hero_item.is_equipped {
-            return Err(AppError::BadRequest("Cannot sell equipped items".into()));
+            return Err(AppError::Game(
+                ErrorCode::ItemEquipped,
+                "Cannot sell equipped items".into(),
+            ));
         }
 
         let sell_value = item_def.sell_value * hero_item.quantity;
@@ -468,7 +603,7 @@ impl HeroService {
         // Delete item
         HeroRepository::delete_item(pool, item_id).await?;
 
-        // TODO: Add silver to user's balance
+        ShopRepository::add_silver(pool, user_id, sell_value).await?;
 
         Ok(sell_value)
     }
@@ -480,13 +615,14 @@ impl HeroService {
         pool: &PgPool,
         user_id: Uuid,
     ) -> AppResult<Vec<AvailableAdventureResponse>> {
-        let adventures = HeroRepository::get_available_adventures(pool, user_id).await?;
+        let adventures =
+            HeroRepository::get_available_adventures(pool, user_id, clock::now()).await?;
         Ok(adventures.into_iter().map(|a| a.into()).collect())
     }
 
     /// Generate new adventures for user
     pub async fn generate_adventures(pool: &PgPool, user_id: Uuid) -> AppResult<()> {
-        let now = Utc::now();
+        let now = clock::now();
 
         // Pre-generate all random values (scope RNG so it's dropped before await)
         struct AdventureParams {
@@ -597,12 +733,15 @@ impl HeroService {
         }
 
         if !hero.is_available() {
-            return Err(AppError::BadRequest("Hero is not available".into()));
+            return Err(ErrorCode::HeroUnavailable.into());
         }
 
         // Check if hero already has active adventure
         if let Some(_) = HeroRepository::get_active_adventure(pool, hero_id).await? {
-            return Err(AppError::BadRequest("Hero already has an active adventure".into()));
+            return Err(AppError::Game(
+                ErrorCode::HeroUnavailable,
+                "Hero already has an active adventure".into(),
+            ));
         }
 
         // Get available adventure
@@ -615,11 +754,17 @@ impl HeroService {
         }
 
         if adventure.is_taken {
-            return Err(AppError::BadRequest("Adventure already taken".into()));
+            return Err(AppError::Game(
+                ErrorCode::AdventureUnavailable,
+                "Adventure already taken".into(),
+            ));
         }
 
-        if adventure.expires_at < Utc::now() {
-            return Err(AppError::BadRequest("Adventure has expired".into()));
+        if adventure.expires_at < clock::now() {
+            return Err(AppError::Game(
+                ErrorCode::AdventureUnavailable,
+                "Adventure has expired".into(),
+            ));
         }
 
         // Calculate random duration within range (scope RNG so it's dropped before await)
@@ -637,6 +782,7 @@ impl HeroService {
             hero_id,
             adventure.difficulty,
             duration,
+            clock::now(),
         )
         .await?;
 
@@ -690,14 +836,27 @@ impl HeroService {
 
     /// Process completed adventures (called by background job)
     pub async fn process_completed_adventures(pool: &PgPool) -> AppResult<i32> {
-        let completed = HeroRepository::find_completed_adventures(pool).await?;
+        Self::complete_due_adventures(pool, clock::clock(), &mut StdRng::from_entropy()).await
+    }
+
+    /// Complete every adventure of `log` over by `clock`'s time, rolling
+    /// the rewards with `rng`. One that fails is logged and retried on the
+    /// next run; one completed elsewhere meanwhile is skipped.
+    pub async fn complete_due_adventures(
+        log: &dyn AdventureLog,
+        clock: &dyn Clock,
+        rng: &mut (dyn RngCore + Send),
+    ) -> AppResult<i32> {
+        let now = clock.now();
         let mut count = 0;
 
-        for adventure in completed {
-            if let Err(e) = Self::complete_adventure(pool, adventure.id).await {
-                tracing::error!("Failed to complete adventure {}: {}", adventure.id, e);
-            } else {
-                count += 1;
+        for adventure in log.find_completed(now).await? {
+            match Self::complete_adventure(log, &adventure, now, &mut *rng).await {
+                Ok(true) => count += 1,
+                Ok(false) => {}
+                Err(e) => {
+                    tracing::error!("Failed to complete adventure {}: {}", adventure.id, e);
+                }
             }
         }
 
@@ -705,127 +864,23 @@ impl HeroService {
     }
 
     /// Complete a single adventure
-    async fn complete_adventure(pool: &PgPool, adventure_id: Uuid) -> AppResult<()> {
-        let adventure = HeroRepository::get_active_adventure(pool, adventure_id)
-            .await?
-            .ok_or_else(|| AppError::NotFound("Adventure not found".into()))?;
-
-        // Pre-generate all random values (scope RNG so it's dropped before await)
-        struct RewardParams {
-            base_exp: i32,
-            base_silver: i32,
-            health_damage: i32,
-            resources: serde_json::Value,
-            should_drop_item: bool,
-            item_rarity: Option<ItemRarity>,
-            item_index_seed: usize,
-        }
-
-        let params: RewardParams = {
-            let mut rng = rand::thread_rng();
-
-            let (base_exp, base_silver, health_damage) = match adventure.difficulty {
-                AdventureDifficulty::Short => (
-                    rng.gen_range(50..150),
-                    rng.gen_range(10..50),
-                    rng.gen_range(5..20),
-                ),
-                AdventureDifficulty::Long => (
-                    rng.gen_range(200..500),
-                    rng.gen_range(50..200),
-                    rng.gen_range(15..40),
-                ),
-            };
-
-            let resources = serde_json::json!({
-                "wood": rng.gen_range(50..200),
-                "clay": rng.gen_range(50..200),
-                "iron": rng.gen_range(50..200),
-                "crop": rng.gen_range(50..200),
-            });
-
-            let drop_chance = match adventure.difficulty {
-                AdventureDifficulty::Short => 30,
-                AdventureDifficulty::Long => 60,
-            };
-
-            let should_drop_item = rng.gen_range(0..100) < drop_chance;
-
-            let item_rarity = if should_drop_item {
-                Some(match adventure.difficulty {
-                    AdventureDifficulty::Short => match rng.gen_range(0..100) {
-                        0..=60 => ItemRarity::Common,
-                        61..=85 => ItemRarity::Uncommon,
-                        86..=95 => ItemRarity::Rare,
-                        _ => ItemRarity::Epic,
-                    },
-                    AdventureDifficulty::Long => match rng.gen_range(0..100) {
-                        0..=20 => ItemRarity::Uncommon,
-                        21..=50 => ItemRarity::Rare,
-                        51..=80 => ItemRarity::Epic,
-                        _ => ItemRarity::Legendary,
-                    },
-                })
-            } else {
-                None
-            };
-
-            RewardParams {
-                base_exp,
-                base_silver,
-                health_damage,
-                resources,
-                should_drop_item,
-                item_rarity,
-                item_index_seed: rng.gen_range(0..1000),
-            }
-        };
-
-        // Now do async operations (RNG is dropped)
-        let item_id = if params.should_drop_item {
-            if let Some(rarity) = params.item_rarity {
-                let items = HeroRepository::get_items_by_rarity(pool, rarity).await?;
-                if !items.is_empty() {
-                    let item = &items[params.item_index_seed % items.len()];
-                    HeroRepository::add_item(pool, adventure.hero_id, item.id, 1).await?;
-                    Some(item.id)
-                } else {
-                    None
-                }
-            } else {
-                None
+    async fn complete_adventure(
+        log: &dyn AdventureLog,
+        adventure: &HeroAdventure,
+        now: DateTime<Utc>,
+        mut rng: &mut (dyn RngCore + Send),
+    ) -> AppResult<bool> {
+        let rewards = roll_adventure_rewards(adventure.difficulty, &mut rng);
+
+        let item_id = match rewards.item_rarity {
+            Some(rarity) => {
+                let items = log.items_of_rarity(rarity).await?;
+                (!items.is_empty()).then(|| items[rewards.item_index_seed % items.len()].id)
             }
-        } else {
-            None
+            None => None,
         };
 
-        // Complete adventure
-        HeroRepository::complete_adventure(
-            pool,
-            adventure_id,
-            params.base_exp,
-            params.base_silver,
-            Some(params.resources),
-            item_id,
-            params.health_damage,
-        )
-        .await?;
-
-        // Add experience to hero
-        HeroRepository::add_experience(pool, adventure.hero_id, params.base_exp).await?;
-
-        // Damage hero
-        HeroRepository::damage_hero(pool, adventure.hero_id, params.health_damage).await?;
-
-        // Update hero status back to idle (if not dead)
-        let hero = HeroRepository::find_by_id(pool, adventure.hero_id).await?;
-        if let Some(hero) = hero {
-            if hero.health > 0 {
-                HeroRepository::update_status(pool, adventure.hero_id, HeroStatus::Idle).await?;
-            }
-        }
-
-        Ok(())
+        log.complete(adventure, &rewards, item_id, now).await
     }
 
     // ==================== Revive ====================
@@ -845,11 +900,11 @@ impl HeroService {
         }
 
         if !hero.is_dead() {
-            return Err(AppError::BadRequest("Hero is not dead".into()));
+            return Err(ErrorCode::HeroNotDead.into());
         }
 
-        let revive_at = hero.revive_at.unwrap_or(Utc::now());
-        let remaining = (revive_at - Utc::now()).num_seconds().max(0);
+        let revive_at = hero.revive_at.unwrap_or(clock::now());
+        let remaining = (revive_at - clock::now()).num_seconds().max(0);
 
         // Calculate gold cost for instant revive (1 gold per 30 minutes remaining)
         let gold_cost = ((remaining as f64 / 1800.0).ceil() as i32).max(1);
@@ -888,16 +943,19 @@ impl HeroService {
         }
 
         if !hero.is_dead() {
-            return Err(AppError::BadRequest("Hero is not dead".into()));
+            return Err(ErrorCode::HeroNotDead.into());
         }
 
+        // Nothing was produced while dead; production resumes from here
+        Self::settle_production(pool, &hero).await?;
+
         if use_gold {
             let revive_info = Self::get_revive_info(pool, user_id, hero_id).await?;
 
             // Check gold balance
             let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
             if balance < revive_info.gold_cost_instant {
-                return Err(AppError::BadRequest("Insufficient gold".into()));
+                return Err(ErrorCode::InsufficientGold.into());
             }
 
             // Deduct gold
@@ -908,9 +966,9 @@ impl HeroService {
             Ok(hero.into())
         } else {
             // Natural revive - check if time has passed
-            let revive_at = hero.revive_at.unwrap_or(Utc::now());
-            if Utc::now() < revive_at {
-                return Err(AppError::BadRequest("Hero cannot be revived yet".into()));
+            let revive_at = hero.revive_at.unwrap_or(clock::now());
+            if clock::now() < revive_at {
+                return Err(ErrorCode::ReviveNotReady.into());
             }
 
             // Revive with 25% health
@@ -928,16 +986,146 @@ impl HeroService {
             r#"
             UPDATE heroes
             SET health = LEAST(100, health + (
-                EXTRACT(EPOCH FROM (NOW() - last_health_update)) / 3600.0 * health_regen_rate
+                EXTRACT(EPOCH FROM ($1 - last_health_update)) / 3600.0 * health_regen_rate
             )::INTEGER),
-            last_health_update = NOW(),
+            last_health_update = $1,
             updated_at = NOW()
             WHERE health < 100 AND health > 0 AND status != 'dead'
             "#,
         )
+        .bind(clock::now())
         .execute(pool)
         .await?;
 
         Ok(result.rows_affected() as i32)
     }
 }
+
+/// Roll what a finished adventure of `difficulty` pays out
+fn roll_adventure_rewards(difficulty: AdventureDifficulty, rng: &mut impl Rng) -> AdventureRewards {
+    let (base_exp, base_silver, health_damage) = match difficulty {
+        AdventureDifficulty::Short => (
+            rng.gen_range(50..150),
+            rng.gen_range(10..50),
+            rng.gen_range(5..20),
+        ),
+        AdventureDifficulty::Long => (
+            rng.gen_range(200..500),
+            rng.gen_range(50..200),
+            rng.gen_range(15..40),
+        ),
+    };
+
+    let resources = serde_json::json!({
+        "wood": rng.gen_range(50..200),
+        "clay": rng.gen_range(50..200),
+        "iron": rng.gen_range(50..200),
+        "crop": rng.gen_range(50..200),
+    });
+
+    let drop_chance = match difficulty {
+        AdventureDifficulty::Short => 30,
+        AdventureDifficulty::Long => 60,
+    };
+
+    let should_drop_item = rng.gen_range(0..100) < drop_chance;
+
+    let item_rarity = if should_drop_item {
+        Some(match difficulty {
+            AdventureDifficulty::Short => match rng.gen_range(0..100) {
+                0..=60 => ItemRarity::Common,
+                61..=85 => ItemRarity::Uncommon,
+                86..=95 => ItemRarity::Rare,
+                _ => ItemRarity::Epic,
+            },
+            AdventureDifficulty::Long => match rng.gen_range(0..100) {
+                0..=20 => ItemRarity::Uncommon,
+                21..=50 => ItemRarity::Rare,
+                51..=80 => ItemRarity::Epic,
+                _ => ItemRarity::Legendary,
+            },
+        })
+    } else {
+        None
+    };
+
+    AdventureRewards {
+        experience: base_exp,
+        silver: base_silver,
+        health_damage,
+        resources,
+        item_rarity,
+        item_index_seed: rng.gen_range(0..1000),
+    }
+}
+
+/// Hero adventures as `HeroService` completes them: Postgres in the server,
+/// memory in unit tests (see `testing::InMemoryAdventures`)
+#[async_trait]
+pub trait AdventureLog: Send + Sync {
+    /// Adventures over by `now` and not yet completed
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<HeroAdventure>>;
+
+    /// Items an adventure can turn up at `rarity`
+    async fn items_of_rarity(&self, rarity: ItemRarity) -> AppResult<Vec<ItemDefinition>>;
+
+    /// Mark the adventure completed and pay `rewards` (and the item found,
+    /// if any) to its hero; false if it was already completed
+    async fn complete(
+        &self,
+        adventure: &HeroAdventure,
+        rewards: &AdventureRewards,
+        item_id: Option<Uuid>,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool>;
+}
+
+#[async_trait]
+impl AdventureLog for PgPool {
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<HeroAdventure>> {
+        HeroRepository::find_completed_adventures(self, now).await
+    }
+
+    async fn items_of_rarity(&self, rarity: ItemRarity) -> AppResult<Vec<ItemDefinition>> {
+        HeroRepository::get_items_by_rarity(self, rarity).await
+    }
+
+    async fn complete(
+        &self,
+        adventure: &HeroAdventure,
+        rewards: &AdventureRewards,
+        item_id: Option<Uuid>,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        // Claim the adventure first so two runs can't both pay it out
+        let completed = HeroRepository::complete_adventure(
+            self,
+            adventure.id,
+            rewards.experience,
+            rewards.silver,
+            Some(rewards.resources.clone()),
+            item_id,
+            rewards.health_damage,
+        )
+        .await?;
+        if completed.is_none() {
+            return Ok(false);
+        }
+
+        if let Some(item_id) = item_id {
+            HeroRepository::add_item(self, adventure.hero_id, item_id, 1).await?;
+        }
+        HeroRepository::add_experience(self, adventure.hero_id, rewards.experience).await?;
+
+        // Back home, unless the damage killed it
+        let hero =
+            HeroRepository::damage_hero(self, adventure.hero_id, rewards.health_damage, now).await?;
+
+        // Silver found on the adventure
+        if rewards.silver > 0 {
+            ShopRepository::add_silver(self, hero.user_id, rewards.silver).await?;
+        }
+
+        Ok(true)
+    }
+}
@@ -0,0 +1,188 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::models::army::ArmyTroops;
+use crate::models::building::BuildingType;
+use crate::models::gamedata::{definitions, UnitCost};
+use crate::models::hospital::{
+    HealingQueueEntry, HospitalResponse, WoundedResponse, HEAL_COST_PERCENT, HEAL_TIME_PERCENT,
+};
+use crate::models::troop::TroopType;
+use crate::models::village::Village;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::hospital_repo::HospitalRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock;
+
+/// The hospital: part of a village's own defensive losses survive as
+/// wounded and can be healed back for less than training new troops
+pub struct HospitalService;
+
+impl HospitalService {
+    /// Take in the wounded share of troops the village lost defending.
+    /// Returns who was admitted, for the battle report; the troops have
+    /// already been removed from the village as dead.
+    pub async fn admit(
+        pool: &PgPool,
+        village_id: Uuid,
+        losses: &ArmyTroops,
+    ) -> AppResult<ArmyTroops> {
+        let mut wounded = ArmyTroops::new();
+        if losses.values().all(|count| *count <= 0) {
+            return Ok(wounded);
+        }
+        let percent = BuildingType::Hospital.wounded_percent(Self::level(pool, village_id).await?);
+        if percent == 0 {
+            return Ok(wounded);
+        }
+
+        for (troop_type, lost) in losses {
+            let count = lost * percent / 100;
+            if count > 0 {
+                HospitalRepository::add_wounded(pool, village_id, *troop_type, count).await?;
+                wounded.insert(*troop_type, count);
+            }
+        }
+
+        if !wounded.is_empty() {
+            info!("Village {} admitted wounded {:?}", village_id, wounded);
+        }
+
+        Ok(wounded)
+    }
+
+    /// Wounded troops with what healing them costs, and healing under way
+    pub async fn get_hospital(pool: &PgPool, village: &Village) -> AppResult<HospitalResponse> {
+        let level = Self::level(pool, village.id).await?;
+        let definitions = definitions();
+
+        let wounded = HospitalRepository::find_wounded(pool, village.id)
+            .await?
+            .into_iter()
+            .filter_map(|w| {
+                let unit = definitions.unit(w.troop_type)?;
+                Some(WoundedResponse {
+                    troop_type: w.troop_type,
+                    count: w.count,
+                    heal_cost: heal_cost(&unit.cost, 1),
+                    heal_time_seconds: heal_time_seconds(unit.training_time_seconds, 1),
+                })
+            })
+            .collect();
+
+        Ok(HospitalResponse {
+            level,
+            wounded_percent: BuildingType::Hospital.wounded_percent(level),
+            wounded,
+            queue: HospitalRepository::find_queue(pool, village.id).await?,
+        })
+    }
+
+    /// Pay for healing wounded troops and queue them. Healing orders run
+    /// one after another.
+    pub async fn heal(
+        pool: &PgPool,
+        village: &Village,
+        troop_type: TroopType,
+        count: i32,
+    ) -> AppResult<HealingQueueEntry> {
+        if count <= 0 {
+            return Err(AppError::BadRequest("Count must be positive".into()));
+        }
+        if Self::level(pool, village.id).await? == 0 {
+            return Err(AppError::BadRequest("The village has no hospital".into()));
+        }
+
+        let definitions = definitions();
+        let unit = definitions
+            .unit(troop_type)
+            .ok_or_else(|| AppError::NotFound("Troop type not found".into()))?;
+
+        let cost = heal_cost(&unit.cost, count);
+        if village.wood < cost.wood
+            || village.clay < cost.clay
+            || village.iron < cost.iron
+            || village.crop < cost.crop
+        {
+            return Err(ErrorCode::InsufficientResources.into());
+        }
+
+        // Deduct resources, failing if the village changed since it was read
+        VillageRepository::deduct_resources_versioned(
+            pool,
+            village.id,
+            village.version,
+            cost.wood,
+            cost.clay,
+            cost.iron,
+            cost.crop,
+        )
+        .await?;
+
+        if !HospitalRepository::take_wounded(pool, village.id, troop_type, count).await? {
+            VillageRepository::add_resources(
+                pool, village.id, cost.wood, cost.clay, cost.iron, cost.crop,
+            )
+            .await?;
+            return Err(AppError::BadRequest(format!(
+                "Not enough wounded {:?}",
+                troop_type
+            )));
+        }
+
+        let now = clock::now();
+        let started_at = HospitalRepository::queue_ends_at(pool, village.id)
+            .await?
+            .map_or(now, |ends_at| ends_at.max(now));
+        let ends_at = started_at
+            + Duration::seconds(heal_time_seconds(unit.training_time_seconds, count) as i64);
+        let entry =
+            HospitalRepository::enqueue(pool, village.id, troop_type, count, started_at, ends_at)
+                .await?;
+
+        info!(
+            "Village {} healing {} {:?}, done at {}",
+            village.id, count, troop_type, ends_at
+        );
+
+        Ok(entry)
+    }
+
+    /// Release healed troops; None if they were already released
+    pub async fn complete(pool: &PgPool, id: Uuid) -> AppResult<Option<HealingQueueEntry>> {
+        let entry = HospitalRepository::complete(pool, id).await?;
+        if let Some(entry) = &entry {
+            info!(
+                "Village {} healed {} {:?}",
+                entry.village_id, entry.count, entry.troop_type
+            );
+        }
+        Ok(entry)
+    }
+
+    /// Hospital level of a village
+    async fn level(pool: &PgPool, village_id: Uuid) -> AppResult<i32> {
+        let hospitals =
+            BuildingRepository::find_by_type(pool, village_id, BuildingType::Hospital).await?;
+        Ok(hospitals.first().map(|b| b.level).unwrap_or(0))
+    }
+}
+
+/// Resources to heal `count` units of a type trained for `cost`
+fn heal_cost(cost: &UnitCost, count: i32) -> UnitCost {
+    let part = |amount: i32| amount * count * HEAL_COST_PERCENT / 100;
+    UnitCost {
+        wood: part(cost.wood),
+        clay: part(cost.clay),
+        iron: part(cost.iron),
+        crop: part(cost.crop),
+    }
+}
+
+/// Seconds to heal `count` units of a type that trains in `training_seconds`
+fn heal_time_seconds(training_seconds: i32, count: i32) -> i32 {
+    training_seconds * count * HEAL_TIME_PERCENT / 100
+}
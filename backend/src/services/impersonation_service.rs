@@ -0,0 +1,222 @@
+use chrono::{Duration, Utc};
+use rand::RngCore;
+use sha2::{Digest, Sha256};
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::activity::{ActivityKind, NewActivity, RequestOrigin};
+use crate::models::impersonation::{
+    Impersonation, ImpersonationQuery, ImpersonationSession, StartImpersonationRequest,
+    StartedImpersonation, DEFAULT_IMPERSONATION_MINUTES, IMPERSONATION_BLOCKED_PATHS,
+    MAX_IMPERSONATION_MINUTES,
+};
+use crate::models::user::User;
+use crate::repositories::impersonation_repo::ImpersonationRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::activity_service::ActivityService;
+
+/// Marks the string as an impersonation token, so leaked ones are easy to scan for
+const TOKEN_PREFIX: &str = "imp_";
+
+/// Support staff acting as a player through a short-lived token. Read-only
+/// unless the session allows writes; the player sees every session, and
+/// every write made in it, in their activity log.
+pub struct ImpersonationService;
+
+impl ImpersonationService {
+    pub async fn start(
+        pool: &PgPool,
+        admin_id: Uuid,
+        player_id: Uuid,
+        request: StartImpersonationRequest,
+    ) -> AppResult<StartedImpersonation> {
+        let reason = request.reason.trim();
+        if reason.is_empty() || reason.chars().count() > 500 {
+            return Err(AppError::BadRequest(
+                "Reason must be between 1 and 500 characters".into(),
+            ));
+        }
+        let minutes = request.minutes.unwrap_or(DEFAULT_IMPERSONATION_MINUTES);
+        if !(1..=MAX_IMPERSONATION_MINUTES).contains(&minutes) {
+            return Err(AppError::BadRequest(format!(
+                "Minutes must be between 1 and {}",
+                MAX_IMPERSONATION_MINUTES
+            )));
+        }
+        if admin_id == player_id {
+            return Err(AppError::BadRequest(
+                "You can't impersonate yourself".into(),
+            ));
+        }
+        UserRepository::find_by_id(pool, player_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Player not found".into()))?;
+
+        let mut bytes = [0u8; 24];
+        rand::thread_rng().fill_bytes(&mut bytes);
+        let token = format!("{}{}", TOKEN_PREFIX, hex::encode(bytes));
+
+        let session = ImpersonationRepository::create(
+            pool,
+            admin_id,
+            player_id,
+            &hash(&token),
+            request.allow_write,
+            reason,
+            Utc::now() + Duration::minutes(minutes),
+        )
+        .await?;
+
+        info!(
+            "Impersonation {} of player {} started by {} ({}): {}",
+            session.id,
+            player_id,
+            admin_id,
+            if session.allow_write {
+                "read-write"
+            } else {
+                "read-only"
+            },
+            reason
+        );
+        record(
+            pool,
+            player_id,
+            admin_id,
+            serde_json::json!({
+                "event": "started",
+                "session_id": session.id,
+                "reason": session.reason,
+                "allow_write": session.allow_write,
+                "expires_at": session.expires_at,
+            }),
+        );
+
+        Ok(StartedImpersonation { token, session })
+    }
+
+    /// The player and session behind a token, if the session is still open
+    pub async fn authenticate(
+        pool: &PgPool,
+        token: &str,
+    ) -> AppResult<Option<(User, Impersonation)>> {
+        let Some(session) =
+            ImpersonationRepository::find_active_by_hash(pool, &hash(token), Utc::now()).await?
+        else {
+            return Ok(None);
+        };
+        // A session outlives neither its staff member nor its player, nor
+        // the staff member's admin role
+        let Some(admin_id) = session.admin_id else {
+            return Ok(None);
+        };
+        if UserRepository::get_role(pool, admin_id).await?.as_deref() != Some("admin") {
+            let ended = ImpersonationRepository::end_by_admin(pool, admin_id, Utc::now()).await?;
+            warn!(
+                "Ended {} impersonation sessions of {}, who is no longer an admin",
+                ended, admin_id
+            );
+            return Ok(None);
+        }
+        let Some(player) = UserRepository::find_by_id(pool, session.player_id).await? else {
+            return Ok(None);
+        };
+
+        Ok(Some((
+            player,
+            Impersonation {
+                session_id: session.id,
+                admin_id,
+                player_id: session.player_id,
+                allow_write: session.allow_write,
+            },
+        )))
+    }
+
+    /// Refuse what the session may not do: blocked areas always, anything
+    /// that changes state unless it allows writes
+    pub fn check_allowed(
+        impersonation: &Impersonation,
+        path: &str,
+        mutating: bool,
+    ) -> AppResult<()> {
+        if IMPERSONATION_BLOCKED_PATHS
+            .iter()
+            .any(|prefix| path.starts_with(prefix))
+        {
+            return Err(AppError::Forbidden(
+                "Not available while impersonating".into(),
+            ));
+        }
+        if mutating && !impersonation.allow_write {
+            return Err(AppError::Forbidden(
+                "This impersonation session is read-only".into(),
+            ));
+        }
+        Ok(())
+    }
+
+    /// Put a write made while impersonating in the player's activity log
+    pub fn record_write(
+        pool: &PgPool,
+        impersonation: &Impersonation,
+        method: &str,
+        path: &str,
+        status: u16,
+    ) {
+        record(
+            pool,
+            impersonation.player_id,
+            impersonation.admin_id,
+            serde_json::json!({
+                "event": "request",
+                "session_id": impersonation.session_id,
+                "method": method,
+                "path": path,
+                "status": status,
+            }),
+        );
+    }
+
+    pub async fn list(
+        pool: &PgPool,
+        query: &ImpersonationQuery,
+    ) -> AppResult<Vec<ImpersonationSession>> {
+        ImpersonationRepository::list(pool, query, Utc::now()).await
+    }
+
+    pub async fn end(pool: &PgPool, admin_id: Uuid, id: Uuid) -> AppResult<ImpersonationSession> {
+        let session = ImpersonationRepository::end(pool, id, Utc::now())
+            .await?
+            .ok_or_else(|| AppError::NotFound("No open impersonation session".into()))?;
+
+        info!("Impersonation {} ended by {}", id, admin_id);
+        record(
+            pool,
+            session.player_id,
+            admin_id,
+            serde_json::json!({ "event": "ended", "session_id": session.id }),
+        );
+
+        Ok(session)
+    }
+}
+
+fn record(pool: &PgPool, player_id: Uuid, admin_id: Uuid, details: serde_json::Value) {
+    ActivityService::record(
+        pool,
+        NewActivity {
+            user_id: player_id,
+            actor_id: Some(admin_id),
+            kind: ActivityKind::Impersonated,
+            origin: RequestOrigin::default(),
+            details,
+        },
+    );
+}
+
+fn hash(token: &str) -> String {
+    hex::encode(Sha256::digest(token.as_bytes()))
+}
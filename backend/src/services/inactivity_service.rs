@@ -0,0 +1,219 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::troop::TribeType;
+use crate::models::user::{CreateUser, NATAR_FIREBASE_UID, NATAR_NAME};
+use crate::models::world_setting::{
+    AbandonAction, InactivityRunResult, InactivitySettings, UpdateInactivityRequest, INACTIVITY_KEY,
+};
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::building_service::BuildingService;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+use crate::services::village_stats_service::VillageStatsService;
+
+/// Players handled per stage per run
+const BATCH_SIZE: i64 = 200;
+
+pub struct InactivityService;
+
+impl InactivityService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<InactivitySettings> {
+        let key = CacheKey::WorldSetting(INACTIVITY_KEY.to_string());
+        let stored =
+            CacheService::get_or_load(key, || WorldSettingRepository::get(pool, INACTIVITY_KEY))
+                .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid inactivity setting, using defaults: {}", e);
+                InactivitySettings::default()
+            }),
+            None => InactivitySettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateInactivityRequest,
+    ) -> AppResult<InactivitySettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(enabled) = request.enabled {
+            settings.enabled = enabled;
+        }
+        if let Some(days) = request.inactive_after_days {
+            settings.inactive_after_days = days;
+        }
+        if let Some(amount) = request.loyalty_decay_per_day {
+            settings.loyalty_decay_per_day = amount;
+        }
+        if let Some(levels) = request.levels_lost_per_day {
+            settings.levels_lost_per_day = levels;
+        }
+        if let Some(days) = request.abandon_after_days {
+            settings.abandon_after_days = days;
+        }
+        if let Some(action) = request.abandon_action {
+            settings.abandon_action = action;
+        }
+
+        if settings.inactive_after_days < 1 {
+            return Err(AppError::BadRequest(
+                "Players must be gone at least a day to count as inactive".into(),
+            ));
+        }
+        if settings.loyalty_decay_per_day < 0 || settings.levels_lost_per_day < 0 {
+            return Err(AppError::BadRequest("Decay cannot be negative".into()));
+        }
+        if settings.abandon_after_days <= settings.inactive_after_days {
+            return Err(AppError::BadRequest(
+                "abandon_after_days must be greater than inactive_after_days".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, INACTIVITY_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(INACTIVITY_KEY.to_string())]).await;
+
+        info!("Inactivity policy updated by {}: {:?}", admin_id, settings);
+
+        Ok(settings)
+    }
+
+    // ==================== Gray Zone Run ====================
+
+    /// Flag players who stopped logging in, decay the villages of those
+    /// already flagged (at most once a day), and give up the villages of
+    /// those gone past the abandonment threshold
+    pub async fn run(pool: &PgPool) -> AppResult<InactivityRunResult> {
+        let settings = Self::get_settings(pool).await?;
+        let mut result = InactivityRunResult::default();
+        if !settings.enabled {
+            return Ok(result);
+        }
+
+        let now = clock::now();
+
+        result.players_flagged = UserRepository::flag_inactive(
+            pool,
+            now - Duration::days(settings.inactive_after_days as i64),
+            now,
+        )
+        .await?;
+
+        let due = UserRepository::find_due_decay(pool, now - Duration::days(1), BATCH_SIZE).await?;
+        for user_id in due {
+            result.villages_decayed += Self::decay_player(pool, user_id, &settings).await?;
+            UserRepository::set_decayed(pool, user_id, now).await?;
+        }
+
+        let abandoned = UserRepository::find_abandoned(
+            pool,
+            now - Duration::days(settings.abandon_after_days as i64),
+            BATCH_SIZE,
+        )
+        .await?;
+        if !abandoned.is_empty() {
+            let natar = Self::natar(pool).await?;
+            for user_id in abandoned {
+                let (to_natar, cleared) =
+                    Self::abandon_player(pool, user_id, natar, settings.abandon_action).await?;
+                result.villages_to_natar += to_natar;
+                result.villages_cleared += cleared;
+            }
+        }
+
+        Ok(result)
+    }
+
+    /// One day of decay for all of a player's villages. Returns how many
+    /// villages were touched.
+    async fn decay_player(
+        pool: &PgPool,
+        user_id: Uuid,
+        settings: &InactivitySettings,
+    ) -> AppResult<u64> {
+        let decayed =
+            VillageRepository::decay_loyalty(pool, user_id, settings.loyalty_decay_per_day).await?;
+
+        for village in VillageRepository::find_by_user_id(pool, user_id).await? {
+            let mut lost = 0;
+            for _ in 0..settings.levels_lost_per_day {
+                if BuildingRepository::decay_highest(pool, village.id)
+                    .await?
+                    .is_none()
+                {
+                    break;
+                }
+                lost += 1;
+            }
+            if lost > 0 {
+                BuildingService::update_village_storage(pool, village.id).await?;
+                VillageStatsService::recalculate(pool, village.id).await?;
+            }
+        }
+
+        Ok(decayed)
+    }
+
+    /// Give up a player's villages. Returns (handed to the Natars, cleared).
+    async fn abandon_player(
+        pool: &PgPool,
+        user_id: Uuid,
+        natar_id: Uuid,
+        action: AbandonAction,
+    ) -> AppResult<(u64, u64)> {
+        let (mut to_natar, mut cleared) = (0, 0);
+
+        for village in VillageRepository::find_by_user_id(pool, user_id).await? {
+            if action == AbandonAction::Clear
+                && VillageRepository::delete_if_unreferenced(pool, village.id).await?
+            {
+                cleared += 1;
+                continue;
+            }
+            VillageRepository::transfer_ownership(pool, village.id, natar_id).await?;
+            to_natar += 1;
+        }
+
+        info!(
+            "Player {} abandoned: {} villages to the Natars, {} cleared",
+            user_id, to_natar, cleared
+        );
+
+        Ok((to_natar, cleared))
+    }
+
+    /// The Natar account, created on first use
+    async fn natar(pool: &PgPool) -> AppResult<Uuid> {
+        if let Some(user) = UserRepository::find_by_firebase_uid(pool, NATAR_FIREBASE_UID).await? {
+            return Ok(user.id);
+        }
+
+        let user = UserRepository::upsert(
+            pool,
+            CreateUser {
+                firebase_uid: NATAR_FIREBASE_UID.to_string(),
+                email: None,
+                display_name: Some(NATAR_NAME.to_string()),
+                photo_url: None,
+                provider: "system".to_string(),
+                tribe: TribeType::Phasuttha,
+            },
+        )
+        .await?;
+
+        Ok(user.id)
+    }
+}
@@ -0,0 +1,223 @@
+use std::collections::HashMap;
+use std::fmt::Write;
+use std::sync::{LazyLock, Mutex};
+use std::time::Instant;
+
+use chrono::Utc;
+use sqlx::PgPool;
+use tracing::{error, info, warn};
+use uuid::Uuid;
+
+use crate::db::invariants::INVARIANTS;
+use crate::error::{AppError, AppResult};
+use crate::models::invariant::{
+    InvariantReport, InvariantResult, POPULATION_MISMATCH, SAMPLE_SIZE,
+};
+use crate::models::world_setting::{
+    InvariantSettings, UpdateInvariantSettingsRequest, INVARIANT_CHECKS_KEY,
+};
+use crate::repositories::invariant_repo::InvariantRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::village_stats_service::VillageStatsService;
+
+/// Result of the most recent check on this instance
+static LAST_REPORT: LazyLock<Mutex<Option<InvariantReport>>> = LazyLock::new(|| Mutex::new(None));
+
+/// Rows repaired per invariant since start
+static FIXED_TOTAL: LazyLock<Mutex<HashMap<&'static str, u64>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Periodic consistency check of the game state. Every invariant is
+/// counted, broken ones raise an alert, and those whitelisted in the
+/// `invariant_checks` setting are repaired on the spot.
+pub struct InvariantService;
+
+impl InvariantService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<InvariantSettings> {
+        let key = CacheKey::WorldSetting(INVARIANT_CHECKS_KEY.to_string());
+        let stored = CacheService::get_or_load(key, || {
+            WorldSettingRepository::get(pool, INVARIANT_CHECKS_KEY)
+        })
+        .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid invariant_checks setting, using defaults: {}", e);
+                InvariantSettings::default()
+            }),
+            None => InvariantSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateInvariantSettingsRequest,
+    ) -> AppResult<InvariantSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(mut auto_fix) = request.auto_fix {
+            let fixable = Self::fixable();
+            if let Some(name) = auto_fix.iter().find(|n| !fixable.contains(&n.as_str())) {
+                return Err(AppError::BadRequest(format!(
+                    "{} cannot be fixed automatically; fixable: {}",
+                    name,
+                    fixable.join(", ")
+                )));
+            }
+            auto_fix.sort();
+            auto_fix.dedup();
+            settings.auto_fix = auto_fix;
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, INVARIANT_CHECKS_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(INVARIANT_CHECKS_KEY.to_string())]).await;
+
+        info!(
+            "Invariant auto-fix updated by {}: {:?}",
+            admin_id, settings.auto_fix
+        );
+
+        Ok(settings)
+    }
+
+    /// Invariants with a known safe repair
+    pub fn fixable() -> Vec<&'static str> {
+        INVARIANTS
+            .iter()
+            .filter(|i| i.fix.is_some())
+            .map(|i| i.name)
+            .chain([POPULATION_MISMATCH])
+            .collect()
+    }
+
+    // ==================== Checks ====================
+
+    pub fn last_report() -> Option<InvariantReport> {
+        LAST_REPORT.lock().unwrap().clone()
+    }
+
+    /// Check every invariant, repairing whitelisted drift
+    pub async fn check(pool: &PgPool) -> AppResult<InvariantReport> {
+        let started = Instant::now();
+        let settings = Self::get_settings(pool).await?;
+        let auto_fix = |name: &str| settings.auto_fix.iter().any(|n| n == name);
+
+        let mut results = Vec::with_capacity(INVARIANTS.len() + 1);
+        for invariant in INVARIANTS {
+            let (violations, sample) =
+                InvariantRepository::count(pool, invariant, SAMPLE_SIZE).await?;
+            let mut fixed = 0;
+            if violations > 0 && auto_fix(invariant.name) {
+                fixed = InvariantRepository::fix(pool, invariant).await?;
+                warn!("Repaired {} rows breaking {}", fixed, invariant.name);
+            }
+            results.push(InvariantResult {
+                name: invariant.name,
+                description: invariant.description,
+                violations,
+                sample,
+                fixable: invariant.fix.is_some(),
+                fixed,
+            });
+        }
+        results.push(Self::check_population(pool, auto_fix(POPULATION_MISMATCH)).await?);
+
+        let report = InvariantReport {
+            checked_at: Utc::now(),
+            duration_ms: started.elapsed().as_millis() as u64,
+            results,
+        };
+
+        let broken: Vec<String> = report
+            .broken()
+            .map(|r| format!("{} ({})", r.name, r.violations))
+            .collect();
+        if !broken.is_empty() {
+            error!("Game-state invariants broken: {}", broken.join(", "));
+        }
+
+        {
+            let mut fixed_total = FIXED_TOTAL.lock().unwrap();
+            for result in report.results.iter().filter(|r| r.fixed > 0) {
+                *fixed_total.entry(result.name).or_default() += result.fixed;
+            }
+        }
+        *LAST_REPORT.lock().unwrap() = Some(report.clone());
+
+        Ok(report)
+    }
+
+    async fn check_population(pool: &PgPool, fix: bool) -> AppResult<InvariantResult> {
+        let drifted = VillageStatsService::population_drift(pool).await?;
+
+        let mut fixed = 0;
+        if fix {
+            for village_id in &drifted {
+                VillageStatsService::recalculate(pool, *village_id).await?;
+                fixed += 1;
+            }
+            if fixed > 0 {
+                warn!("Recalculated population of {} villages", fixed);
+            }
+        }
+
+        Ok(InvariantResult {
+            name: POPULATION_MISMATCH,
+            description: "Villages whose population disagrees with their buildings",
+            violations: drifted.len() as i64,
+            sample: drifted
+                .iter()
+                .take(SAMPLE_SIZE)
+                .map(ToString::to_string)
+                .collect(),
+            fixable: true,
+            fixed,
+        })
+    }
+
+    // ==================== Metrics ====================
+
+    pub fn render_prometheus() -> String {
+        let mut out = String::new();
+        if let Some(report) = LAST_REPORT.lock().unwrap().as_ref() {
+            out.push_str(
+                "# HELP game_invariant_violations Rows breaking each invariant at last check.\n",
+            );
+            out.push_str("# TYPE game_invariant_violations gauge\n");
+            for result in &report.results {
+                let _ = writeln!(
+                    out,
+                    "game_invariant_violations{{invariant=\"{}\"}} {}",
+                    result.name, result.violations
+                );
+            }
+            out.push_str(
+                "# HELP game_invariant_check_timestamp_seconds When the last check finished.\n",
+            );
+            out.push_str("# TYPE game_invariant_check_timestamp_seconds gauge\n");
+            let _ = writeln!(
+                out,
+                "game_invariant_check_timestamp_seconds {}",
+                report.checked_at.timestamp()
+            );
+        }
+
+        out.push_str("# HELP game_invariant_fixed_total Rows repaired by the invariant checker.\n");
+        out.push_str("# TYPE game_invariant_fixed_total counter\n");
+        for (name, fixed) in FIXED_TOTAL.lock().unwrap().iter() {
+            let _ = writeln!(
+                out,
+                "game_invariant_fixed_total{{invariant=\"{}\"}} {}",
+                name, fixed
+            );
+        }
+
+        out
+    }
+}
@@ -0,0 +1,63 @@
+use anyhow::{Context, Result};
+use reqwest::Client;
+use serde::Deserialize;
+use std::time::Duration;
+
+use crate::config::IpIntelConfig;
+use crate::models::ip_reputation::IpCategory;
+
+/// Asks an external IP intelligence API what kind of network an address
+/// belongs to. The API is called as `GET {api_url}/{ip}` and answers
+/// `{"category": "vpn"}`; anything it doesn't flag counts as clean.
+#[derive(Clone)]
+pub struct IpIntelClient {
+    client: Client,
+    api_url: String,
+    api_key: Option<String>,
+}
+
+#[derive(Deserialize)]
+struct LookupResponse {
+    category: Option<String>,
+}
+
+impl IpIntelClient {
+    /// Build the client from config, or `None` when no provider is set
+    pub fn from_config(config: &IpIntelConfig) -> Option<Self> {
+        let api_url = config.api_url.as_deref().filter(|u| !u.is_empty())?;
+
+        Some(Self {
+            client: Client::builder()
+                .timeout(Duration::from_secs(3))
+                .build()
+                .unwrap_or_default(),
+            api_url: api_url.trim_end_matches('/').to_string(),
+            api_key: config.api_key.clone(),
+        })
+    }
+
+    pub async fn lookup(&self, ip: &str) -> Result<Option<IpCategory>> {
+        let mut request = self.client.get(format!("{}/{}", self.api_url, ip));
+        if let Some(key) = &self.api_key {
+            request = request.bearer_auth(key);
+        }
+
+        let response: LookupResponse = request
+            .send()
+            .await
+            .context("IP intelligence provider unreachable")?
+            .error_for_status()
+            .context("IP intelligence provider rejected the request")?
+            .json()
+            .await
+            .context("Invalid IP intelligence response")?;
+
+        Ok(match response.category.as_deref() {
+            Some("datacenter" | "hosting") => Some(IpCategory::Datacenter),
+            Some("vpn") => Some(IpCategory::Vpn),
+            Some("proxy") => Some(IpCategory::Proxy),
+            Some("tor") => Some(IpCategory::Tor),
+            _ => None,
+        })
+    }
+}
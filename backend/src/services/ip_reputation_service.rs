@@ -0,0 +1,199 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use std::net::IpAddr;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::ip_reputation::{
+    ImportIpRangesRequest, ImportIpRangesResult, IpCategory, IpCheckResult, IpRange, IpRangeQuery,
+    IpReputationSettings, UpdateIpReputationRequest, IP_REPUTATION_KEY, LOOKUP_TTL_DAYS,
+    MAX_IMPORT_RANGES,
+};
+use crate::repositories::ip_reputation_repo::IpReputationRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+use crate::services::ip_intel::IpIntelClient;
+
+/// Tags addresses as datacenter, VPN, proxy or Tor from the local lists,
+/// falling back to the external provider when one is configured
+pub struct IpReputationService;
+
+impl IpReputationService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<IpReputationSettings> {
+        let key = CacheKey::WorldSetting(IP_REPUTATION_KEY.to_string());
+        let stored =
+            CacheService::get_or_load(key, || WorldSettingRepository::get(pool, IP_REPUTATION_KEY))
+                .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid ip_reputation setting, using defaults: {}", e);
+                IpReputationSettings::default()
+            }),
+            None => IpReputationSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateIpReputationRequest,
+    ) -> AppResult<IpReputationSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(categories) = request.step_up_categories {
+            settings.step_up_categories = categories;
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, IP_REPUTATION_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(IP_REPUTATION_KEY.to_string())]).await;
+
+        info!(
+            "IP reputation policy updated by {}: {:?}",
+            admin_id, settings
+        );
+
+        Ok(settings)
+    }
+
+    // ==================== Classification ====================
+
+    /// Category of the address, or None for ordinary (or unparseable)
+    /// addresses. Provider failures are logged and treated as unknown.
+    pub async fn classify(
+        pool: &PgPool,
+        provider: Option<&IpIntelClient>,
+        ip: &str,
+    ) -> AppResult<Option<IpCategory>> {
+        let Ok(addr) = ip.parse::<IpAddr>() else {
+            return Ok(None);
+        };
+        let ip = addr.to_string();
+
+        if let Some(category) = IpReputationRepository::match_range(pool, &ip).await? {
+            return Ok(Some(category));
+        }
+
+        let Some(provider) = provider else {
+            return Ok(None);
+        };
+
+        let now = clock::now();
+        let fresh_after = now - Duration::days(LOOKUP_TTL_DAYS);
+        if let Some(cached) = IpReputationRepository::find_lookup(pool, &ip, fresh_after).await? {
+            return Ok(cached);
+        }
+
+        match provider.lookup(&ip).await {
+            Ok(category) => {
+                IpReputationRepository::save_lookup(pool, &ip, category, now).await?;
+                Ok(category)
+            }
+            Err(e) => {
+                warn!("IP lookup for {} failed: {:?}", ip, e);
+                Ok(None)
+            }
+        }
+    }
+
+    /// Whether a login from this category must pass a captcha
+    pub async fn needs_step_up(pool: &PgPool, category: Option<IpCategory>) -> AppResult<bool> {
+        let Some(category) = category else {
+            return Ok(false);
+        };
+        let settings = Self::get_settings(pool).await?;
+        Ok(settings.step_up_categories.contains(&category))
+    }
+
+    pub async fn check(
+        pool: &PgPool,
+        provider: Option<&IpIntelClient>,
+        ip: &str,
+    ) -> AppResult<IpCheckResult> {
+        if ip.parse::<IpAddr>().is_err() {
+            return Err(AppError::BadRequest("Not an IP address".into()));
+        }
+        let category = Self::classify(pool, provider, ip).await?;
+
+        Ok(IpCheckResult {
+            ip: ip.to_string(),
+            category,
+            step_up: Self::needs_step_up(pool, category).await?,
+        })
+    }
+
+    // ==================== Local Lists ====================
+
+    pub async fn list_ranges(pool: &PgPool, query: IpRangeQuery) -> AppResult<Vec<IpRange>> {
+        IpReputationRepository::list_ranges(pool, &query).await
+    }
+
+    pub async fn import_ranges(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: ImportIpRangesRequest,
+    ) -> AppResult<ImportIpRangesResult> {
+        if request.ranges.len() > MAX_IMPORT_RANGES {
+            return Err(AppError::BadRequest(format!(
+                "At most {} ranges can be imported at once",
+                MAX_IMPORT_RANGES
+            )));
+        }
+        let source = request.source.trim();
+        if source.is_empty() || source.len() > 100 {
+            return Err(AppError::BadRequest(
+                "Source must be between 1 and 100 characters".into(),
+            ));
+        }
+
+        let (valid, invalid): (Vec<String>, Vec<String>) = request
+            .ranges
+            .into_iter()
+            .map(|r| r.trim().to_string())
+            .filter(|r| !r.is_empty())
+            .partition(|r| is_cidr(r));
+
+        let imported = if valid.is_empty() {
+            0
+        } else {
+            IpReputationRepository::upsert_ranges(pool, &valid, request.category, source).await?
+        };
+
+        info!(
+            "Admin {} imported {} {:?} ranges from {} ({} invalid)",
+            admin_id,
+            imported,
+            request.category,
+            source,
+            invalid.len()
+        );
+
+        Ok(ImportIpRangesResult { imported, invalid })
+    }
+
+    pub async fn delete_range(pool: &PgPool, id: i64) -> AppResult<()> {
+        if !IpReputationRepository::delete_range(pool, id).await? {
+            return Err(AppError::NotFound("IP range not found".into()));
+        }
+        Ok(())
+    }
+}
+
+/// An address, or an address with a prefix length that fits its family
+fn is_cidr(range: &str) -> bool {
+    let (addr, prefix) = match range.split_once('/') {
+        Some((addr, prefix)) => (addr, Some(prefix)),
+        None => (range, None),
+    };
+    let Ok(addr) = addr.parse::<IpAddr>() else {
+        return false;
+    };
+    let max = if addr.is_ipv4() { 32 } else { 128 };
+    prefix.map_or(true, |p| p.parse::<u8>().is_ok_and(|p| p <= max))
+}
@@ -0,0 +1,137 @@
+use chrono::Duration;
+use futures_util::FutureExt;
+use rand::Rng;
+use serde::Serialize;
+use sqlx::PgPool;
+use std::any::Any;
+use std::future::Future;
+use std::panic::AssertUnwindSafe;
+use tracing::{error, info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::job_failure::{
+    JobFailure, JobFailureQuery, MAX_ATTEMPTS, RETRY_BASE_SECS, RETRY_MAX_SECS,
+};
+use crate::repositories::job_failure_repo::JobFailureRepository;
+use crate::services::clock;
+use crate::services::ops_metrics_service;
+
+/// Failure handling for queue items processed by background jobs
+pub struct JobFailureService;
+
+impl JobFailureService {
+    /// Process one item of `job`, containing errors and panics so the rest
+    /// of the batch still runs. A failure is recorded and the item retried
+    /// after a jittered backoff, until it is quarantined after
+    /// `MAX_ATTEMPTS`. Jobs must skip items with a pending failure (see
+    /// the `job_failures` filter in their queries). None if the item failed.
+    pub async fn guard<T, F>(
+        pool: &PgPool,
+        job: &str,
+        item_id: Uuid,
+        item: &impl Serialize,
+        work: F,
+    ) -> Option<T>
+    where
+        F: Future<Output = AppResult<T>>,
+    {
+        let (message, panicked) = match AssertUnwindSafe(work).catch_unwind().await {
+            Ok(Ok(value)) => {
+                ops_metrics_service::record_job_item(job, true);
+                if let Err(e) = JobFailureRepository::clear(pool, job, item_id).await {
+                    warn!("Failed to clear failures of {} {}: {:?}", job, item_id, e);
+                }
+                return Some(value);
+            }
+            Ok(Err(e)) => (format!("{:?}", e), false),
+            Err(panic) => (panic_message(panic), true),
+        };
+
+        ops_metrics_service::record_job_item(job, false);
+        error!(
+            "{} {} failed{}: {}",
+            job,
+            item_id,
+            if panicked { " with a panic" } else { "" },
+            message
+        );
+        if let Err(e) = Self::record(pool, job, item_id, item, &message, panicked).await {
+            error!("Failed to record failure of {} {}: {:?}", job, item_id, e);
+        }
+
+        None
+    }
+
+    async fn record(
+        pool: &PgPool,
+        job: &str,
+        item_id: Uuid,
+        item: &impl Serialize,
+        message: &str,
+        panicked: bool,
+    ) -> AppResult<()> {
+        let now = clock::now();
+        let payload = serde_json::to_value(item).ok();
+        let failure = JobFailureRepository::record(
+            pool,
+            job,
+            item_id,
+            payload.as_ref(),
+            message,
+            panicked,
+            now,
+        )
+        .await?;
+
+        if failure.attempts >= MAX_ATTEMPTS {
+            warn!(
+                "{} {} quarantined after {} attempts",
+                job, item_id, failure.attempts
+            );
+            JobFailureRepository::schedule(pool, failure.id, now, Some(now)).await
+        } else {
+            let retry_at = now + retry_delay(failure.attempts);
+            JobFailureRepository::schedule(pool, failure.id, retry_at, None).await
+        }
+    }
+
+    pub async fn list(pool: &PgPool, mut query: JobFailureQuery) -> AppResult<Vec<JobFailure>> {
+        query.limit = query.limit.clamp(1, 200);
+        query.offset = query.offset.max(0);
+        JobFailureRepository::list(pool, &query).await
+    }
+
+    /// Give a failed or quarantined item a fresh start on the job's next run
+    pub async fn retry(pool: &PgPool, id: i64) -> AppResult<JobFailure> {
+        let failure = JobFailureRepository::release(pool, id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Job failure not found".into()))?;
+
+        info!(
+            "Released {} {} for retry after {} attempts",
+            failure.job, failure.item_id, failure.attempts
+        );
+
+        Ok(failure)
+    }
+}
+
+/// Exponential backoff with ±50% jitter, so items that failed together
+/// don't all retry in the same run
+fn retry_delay(attempts: i32) -> Duration {
+    let exponent = (attempts - 1).clamp(0, 16) as u32;
+    let base = (RETRY_BASE_SECS * 2_i64.pow(exponent)).min(RETRY_MAX_SECS);
+    let jittered = base as f64 * rand::thread_rng().gen_range(0.5..1.5);
+    Duration::seconds(jittered as i64)
+}
+
+fn panic_message(panic: Box<dyn Any + Send>) -> String {
+    match panic.downcast::<String>() {
+        Ok(message) => format!("panic: {}", message),
+        Err(panic) => match panic.downcast::<&'static str>() {
+            Ok(message) => format!("panic: {}", message),
+            Err(_) => "panic".to_string(),
+        },
+    }
+}
@@ -0,0 +1,270 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use std::collections::HashMap;
+use std::fmt::Write;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::{LazyLock, Mutex};
+use tokio::sync::{RwLock, RwLockReadGuard};
+use tracing::{error, info};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::army::Army;
+use crate::models::building::Building;
+use crate::models::hospital::HealingQueueEntry;
+use crate::models::market::ResourceShipment;
+use crate::models::ops_metrics::{
+    CatchUpResult, LagCheckResult, CATCH_UP_QUEUES, LAG_THRESHOLD_SECS,
+};
+use crate::models::research::ResearchQueueEntry;
+use crate::models::troop::TroopQueue;
+use crate::repositories::army_repo::ArmyRepository;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::hospital_repo::HospitalRepository;
+use crate::repositories::market_repo::MarketRepository;
+use crate::repositories::ops_metrics_repo::OpsMetricsRepository;
+use crate::repositories::research_repo::ResearchRepository;
+use crate::repositories::troop_repo::TroopRepository;
+use crate::services::army_service::ArmyService;
+use crate::services::building_service::BuildingService;
+use crate::services::clock;
+use crate::services::hospital_service::HospitalService;
+use crate::services::market_service::MarketService;
+use crate::services::research_service::ResearchService;
+
+/// Shared by the regular queue jobs, taken exclusively by a catch-up pass
+/// so the two never resolve the same item at once
+static QUEUE_LOCK: LazyLock<RwLock<()>> = LazyLock::new(|| RwLock::new(()));
+
+/// Lag of each queue at the last check, for /metrics
+static QUEUE_LAG: LazyLock<Mutex<HashMap<String, i64>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+static CATCH_UP_RUNS: AtomicU64 = AtomicU64::new(0);
+static CATCH_UP_ITEMS: AtomicU64 = AtomicU64::new(0);
+
+/// An overdue item of one of the catch-up queues
+enum Overdue {
+    Shipment(ResourceShipment),
+    Building(Building),
+    Training(TroopQueue),
+    Healing(HealingQueueEntry),
+    Research(ResearchQueueEntry),
+    Army(Army),
+}
+
+impl Overdue {
+    /// Order among items due at the same instant: what changes a village
+    /// goes before the armies arriving there
+    fn rank(&self) -> u8 {
+        match self {
+            Overdue::Shipment(_) => 0,
+            Overdue::Building(_) => 1,
+            Overdue::Training(_) => 2,
+            Overdue::Healing(_) => 3,
+            Overdue::Research(_) => 4,
+            Overdue::Army(_) => 5,
+        }
+    }
+
+    /// Order among armies landing at the same instant, the same as the
+    /// regular job's (see `Army::resolution_order`)
+    fn launch_order(&self) -> Option<(DateTime<Utc>, Uuid)> {
+        match self {
+            Overdue::Army(a) => Some((a.departed_at, a.id)),
+            _ => None,
+        }
+    }
+}
+
+/// Watches the scheduled queues for late processing. When a queue falls
+/// behind, it alerts and resolves everything overdue in the order it was
+/// due, so an incident doesn't let one player's arrival jump another's.
+pub struct LagWatchdogService;
+
+impl LagWatchdogService {
+    /// Held by a regular queue job while it runs
+    pub async fn queue_guard() -> RwLockReadGuard<'static, ()> {
+        QUEUE_LOCK.read().await
+    }
+
+    /// Whether army movements were running late at the last check
+    pub fn movement_lagging() -> bool {
+        QUEUE_LAG
+            .lock()
+            .unwrap()
+            .get("army_movements")
+            .is_some_and(|lag| *lag > LAG_THRESHOLD_SECS)
+    }
+
+    pub async fn check(pool: &PgPool) -> AppResult<LagCheckResult> {
+        let backlogs = OpsMetricsRepository::queue_backlogs(pool, clock::now()).await?;
+
+        {
+            let mut lags = QUEUE_LAG.lock().unwrap();
+            for backlog in &backlogs {
+                lags.insert(backlog.queue.clone(), backlog.lag_secs.unwrap_or(0));
+            }
+        }
+
+        let lagging: Vec<_> = backlogs
+            .into_iter()
+            .filter(|b| b.lag_secs.is_some_and(|lag| lag > LAG_THRESHOLD_SECS))
+            .collect();
+        if lagging.is_empty() {
+            return Ok(LagCheckResult::default());
+        }
+
+        // Logged at error level, so it reaches the error tracker as an alert
+        error!(
+            "Queues processing late: {}",
+            lagging
+                .iter()
+                .map(|b| format!(
+                    "{} ({} due, {}s behind)",
+                    b.queue,
+                    b.due,
+                    b.lag_secs.unwrap_or(0)
+                ))
+                .collect::<Vec<_>>()
+                .join(", ")
+        );
+
+        let catch_up = if lagging
+            .iter()
+            .any(|b| CATCH_UP_QUEUES.contains(&b.queue.as_str()))
+        {
+            Some(Self::catch_up(pool).await?)
+        } else {
+            None
+        };
+
+        Ok(LagCheckResult { lagging, catch_up })
+    }
+
+    /// Resolve every overdue item across the queues in the order they fell
+    /// due. Players aren't notified over the websocket; their clients pick
+    /// up the results on the next refresh. Items created by the pass, like
+    /// returning armies, are left to the regular jobs.
+    pub async fn catch_up(pool: &PgPool) -> AppResult<CatchUpResult> {
+        let _exclusive = QUEUE_LOCK.write().await;
+        let now = clock::now();
+
+        let mut overdue: Vec<(DateTime<Utc>, Overdue)> = Vec::new();
+        for s in MarketRepository::find_arrived(pool, now).await? {
+            overdue.push((s.arrives_at, Overdue::Shipment(s)));
+        }
+        for b in BuildingRepository::find_completed_upgrades(pool, now).await? {
+            overdue.push((b.upgrade_ends_at.unwrap_or(now), Overdue::Building(b)));
+        }
+        for t in TroopRepository::find_completed_training(pool, now).await? {
+            overdue.push((t.ends_at, Overdue::Training(t)));
+        }
+        for h in HospitalRepository::find_completed(pool, now).await? {
+            overdue.push((h.ends_at, Overdue::Healing(h)));
+        }
+        for r in ResearchRepository::find_completed(pool, now).await? {
+            overdue.push((r.ends_at, Overdue::Research(r)));
+        }
+        for a in ArmyRepository::find_arrived(pool, now).await? {
+            overdue.push((a.arrives_at, Overdue::Army(a)));
+        }
+        overdue.sort_by_key(|(due, item)| (*due, item.rank(), item.launch_order()));
+
+        let mut result = CatchUpResult::default();
+        for (_, item) in overdue {
+            if Self::resolve(pool, &item).await {
+                match item {
+                    Overdue::Shipment(_) => result.market_deliveries += 1,
+                    Overdue::Building(_) => result.building_upgrades += 1,
+                    Overdue::Training(_) => result.troop_training += 1,
+                    Overdue::Healing(_) => result.healing += 1,
+                    Overdue::Research(_) => result.research += 1,
+                    Overdue::Army(_) => result.army_movements += 1,
+                }
+            } else {
+                result.failed += 1;
+            }
+        }
+
+        let resolved = result.market_deliveries
+            + result.building_upgrades
+            + result.troop_training
+            + result.healing
+            + result.research
+            + result.army_movements;
+        CATCH_UP_RUNS.fetch_add(1, Ordering::Relaxed);
+        CATCH_UP_ITEMS.fetch_add(resolved as u64, Ordering::Relaxed);
+        info!(
+            "Catch-up pass resolved {} overdue items ({} failed)",
+            resolved, result.failed
+        );
+
+        Ok(result)
+    }
+
+    /// Resolve one item the way its regular job would
+    async fn resolve(pool: &PgPool, item: &Overdue) -> bool {
+        let result = match item {
+            Overdue::Shipment(s) => MarketService::deliver(pool, s).await,
+            Overdue::Building(b) => BuildingService::complete_upgrade(pool, b.id)
+                .await
+                .map(|_| true),
+            Overdue::Training(t) => TroopRepository::complete_training(pool, t).await,
+            Overdue::Healing(h) => HospitalService::complete(pool, h.id)
+                .await
+                .map(|e| e.is_some()),
+            Overdue::Research(r) => ResearchService::complete(pool, r.id)
+                .await
+                .map(|e| e.is_some()),
+            Overdue::Army(a) => return ArmyService::process_arrival(pool, a).await,
+        };
+
+        match result {
+            Ok(resolved) => resolved,
+            Err(e) => {
+                error!("Catch-up failed to resolve an overdue item: {:?}", e);
+                false
+            }
+        }
+    }
+
+    /// Prometheus text exposition of the queue lag and catch-up counters
+    pub fn render_prometheus() -> String {
+        let lags = QUEUE_LAG.lock().unwrap().clone();
+        let mut queues: Vec<&String> = lags.keys().collect();
+        queues.sort();
+
+        let mut out = String::new();
+        out.push_str(
+            "# HELP game_queue_lag_seconds How long the oldest due item of each queue has waited.\n",
+        );
+        out.push_str("# TYPE game_queue_lag_seconds gauge\n");
+        for queue in queues {
+            let _ = writeln!(
+                out,
+                "game_queue_lag_seconds{{queue=\"{}\"}} {}",
+                queue, lags[queue]
+            );
+        }
+        out.push_str(
+            "# HELP game_catch_up_runs_total Catch-up passes run after queues fell behind.\n",
+        );
+        out.push_str("# TYPE game_catch_up_runs_total counter\n");
+        let _ = writeln!(
+            out,
+            "game_catch_up_runs_total {}",
+            CATCH_UP_RUNS.load(Ordering::Relaxed)
+        );
+        out.push_str(
+            "# HELP game_catch_up_items_total Overdue items resolved by catch-up passes.\n",
+        );
+        out.push_str("# TYPE game_catch_up_items_total counter\n");
+        let _ = writeln!(
+            out,
+            "game_catch_up_items_total {}",
+            CATCH_UP_ITEMS.load(Ordering::Relaxed)
+        );
+
+        out
+    }
+}
@@ -0,0 +1,55 @@
+use anyhow::{bail, Context, Result};
+use reqwest::Client;
+use serde::Serialize;
+
+use crate::config::EmailConfig;
+
+/// Sends plain-text email through an HTTP email API
+#[derive(Clone)]
+pub struct Mailer {
+    client: Client,
+    api_url: String,
+    api_key: Option<String>,
+    from: String,
+}
+
+#[derive(Serialize)]
+struct OutgoingEmail<'a> {
+    from: &'a str,
+    to: &'a str,
+    subject: &'a str,
+    text: &'a str,
+}
+
+impl Mailer {
+    /// Build the mailer from config, or `None` when email isn't configured
+    pub fn from_config(config: &EmailConfig) -> Option<Self> {
+        let api_url = config.api_url.as_deref().filter(|u| !u.is_empty())?;
+
+        Some(Self {
+            client: Client::new(),
+            api_url: api_url.to_string(),
+            api_key: config.api_key.clone(),
+            from: config.from.clone(),
+        })
+    }
+
+    pub async fn send(&self, to: &str, subject: &str, text: &str) -> Result<()> {
+        let mut request = self.client.post(&self.api_url).json(&OutgoingEmail {
+            from: &self.from,
+            to,
+            subject,
+            text,
+        });
+        if let Some(key) = &self.api_key {
+            request = request.bearer_auth(key);
+        }
+
+        let response = request.send().await.context("Email request failed")?;
+        if !response.status().is_success() {
+            bail!("Email to {} failed with status {}", to, response.status());
+        }
+
+        Ok(())
+    }
+}
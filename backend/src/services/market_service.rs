@@ -0,0 +1,208 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::{error, info};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::models::building::BuildingType;
+use crate::models::gamedata::definitions;
+use crate::models::market::{
+    merchants_for_level, MarketResponse, ResourceShipment, SendResourcesRequest,
+    DEFAULT_MERCHANT_CAPACITY, MERCHANT_SPEED,
+};
+use crate::models::village::Village;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::market_repo::MarketRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::alliance_stats_service::AllianceStatsService;
+use crate::services::anti_pushing_service::AntiPushingService;
+use crate::services::clock;
+use crate::services::economy_service::EconomyService;
+use crate::services::resource_service::ResourceService;
+use crate::services::tribe_service::TribeService;
+
+/// Merchants carrying resources between villages
+pub struct MarketService;
+
+impl MarketService {
+    pub async fn get_market(pool: &PgPool, village: &Village) -> AppResult<MarketResponse> {
+        let now = clock::now();
+
+        Ok(MarketResponse {
+            merchants: Self::merchants(pool, village.id).await?,
+            merchants_busy: MarketRepository::busy_merchants(pool, village.id, now).await?,
+            merchant_capacity: Self::merchant_capacity(pool, village.user_id).await?,
+            outgoing: MarketRepository::find_outgoing(pool, village.id, now).await?,
+            incoming: MarketRepository::find_incoming(pool, village.id).await?,
+        })
+    }
+
+    /// Load resources onto merchants bound for another village. Shipments
+    /// to other players count against the anti-pushing limits.
+    pub async fn send(
+        pool: &PgPool,
+        village: &Village,
+        request: SendResourcesRequest,
+    ) -> AppResult<ResourceShipment> {
+        if request.wood < 0 || request.clay < 0 || request.iron < 0 || request.crop < 0 {
+            return Err(AppError::ValidationError("Amounts cannot be negative".into()));
+        }
+        let total = request.total();
+        if total <= 0 {
+            return Err(AppError::ValidationError("Nothing to send".into()));
+        }
+        if request.to_village_id == village.id {
+            return Err(AppError::Game(
+                ErrorCode::SameVillage,
+                "Cannot send resources to the same village".into(),
+            ));
+        }
+
+        let target = VillageRepository::find_by_id(pool, request.to_village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Target village not found".into()))?;
+
+        let merchants = Self::merchants(pool, village.id).await?;
+        if merchants == 0 {
+            return Err(AppError::Game(
+                ErrorCode::MissingPrerequisites,
+                "A market is needed to send resources".into(),
+            ));
+        }
+
+        let now = clock::now();
+        let capacity = Self::merchant_capacity(pool, village.user_id).await?;
+        let needed = (total + capacity - 1) / capacity;
+        let free = merchants - MarketRepository::busy_merchants(pool, village.id, now).await?;
+        if needed > free {
+            return Err(AppError::Game(
+                ErrorCode::InsufficientMerchants,
+                format!(
+                    "Not enough merchants ({} needed, {} available)",
+                    needed, free
+                ),
+            ));
+        }
+
+        AntiPushingService::check_transfer(pool, village.user_id, target.user_id, total as i64)
+            .await?;
+
+        // Bring stock up to date before checking it
+        let current = ResourceService::update_village_resources(pool, village.id).await?;
+        if current.wood < request.wood
+            || current.clay < request.clay
+            || current.iron < request.iron
+            || current.crop < request.crop
+        {
+            return Err(ErrorCode::InsufficientResources.into());
+        }
+
+        VillageRepository::deduct_resources_versioned(
+            pool,
+            village.id,
+            current.version,
+            request.wood,
+            request.clay,
+            request.iron,
+            request.crop,
+        )
+        .await?;
+
+        let dx = (target.x - village.x) as f64;
+        let dy = (target.y - village.y) as f64;
+        let distance = (dx * dx + dy * dy).sqrt();
+        let seconds = ((distance / MERCHANT_SPEED) * 3600.0).ceil().max(1.0) as i64;
+        let arrives_at = now + Duration::seconds(seconds);
+        let returns_at = arrives_at + Duration::seconds(seconds);
+
+        let shipment = MarketRepository::create(
+            pool,
+            village.user_id,
+            target.user_id,
+            village.id,
+            &request,
+            needed,
+            now,
+            arrives_at,
+            returns_at,
+        )
+        .await?;
+
+        EconomyService::record_shipment(pool, &shipment).await;
+
+        info!(
+            "Village {} sent {} resources to village {} with {} merchants",
+            village.id, total, target.id, needed
+        );
+
+        Ok(shipment)
+    }
+
+    /// Unload shipments that have reached their village. Returns how many
+    /// were delivered.
+    pub async fn deliver_arrived(pool: &PgPool) -> AppResult<i32> {
+        let arrived = MarketRepository::find_arrived(pool, clock::now()).await?;
+        let mut delivered = 0;
+
+        for shipment in arrived {
+            if Self::deliver(pool, &shipment).await? {
+                delivered += 1;
+            }
+        }
+
+        Ok(delivered)
+    }
+
+    /// Unload one shipment. False if it was already delivered or its
+    /// resources couldn't be added.
+    pub async fn deliver(pool: &PgPool, shipment: &ResourceShipment) -> AppResult<bool> {
+        if !MarketRepository::mark_delivered(pool, shipment.id).await? {
+            return Ok(false);
+        }
+
+        // Resources arriving at a full store are lost, as with loot
+        let result = VillageRepository::add_resources(
+            pool,
+            shipment.to_village_id,
+            shipment.wood,
+            shipment.clay,
+            shipment.iron,
+            shipment.crop,
+        )
+        .await;
+
+        match result {
+            Ok(_) => {
+                AllianceStatsService::record_donation(
+                    pool,
+                    shipment.sender_id,
+                    shipment.receiver_id,
+                    shipment.total() as i64,
+                )
+                .await;
+                Ok(true)
+            }
+            Err(e) => {
+                error!("Failed to deliver shipment {}: {:?}", shipment.id, e);
+                Ok(false)
+            }
+        }
+    }
+
+    /// Merchants from the village's market level
+    async fn merchants(pool: &PgPool, village_id: Uuid) -> AppResult<i32> {
+        let markets =
+            BuildingRepository::find_by_type(pool, village_id, BuildingType::Market).await?;
+        let level = markets.iter().map(|b| b.level).max().unwrap_or(0);
+        Ok(merchants_for_level(level))
+    }
+
+    /// What one of the player's merchants carries, from their tribe
+    async fn merchant_capacity(pool: &PgPool, user_id: Uuid) -> AppResult<i32> {
+        let tribe = TribeService::player_tribe(pool, user_id).await?;
+        Ok(definitions()
+            .tribe(tribe)
+            .map(|t| t.merchant_capacity)
+            .unwrap_or(DEFAULT_MERCHANT_CAPACITY))
+    }
+}
@@ -1,12 +1,14 @@
 use sqlx::PgPool;
 use uuid::Uuid;
 
-use crate::error::{AppError, AppResult};
+use crate::error::{AppError, AppResult, ErrorCode};
 use crate::models::message::{
     AllianceMessageListItem, ConversationResponse, MessageListItem, MessageResponse,
 };
 use crate::repositories::alliance_repo::AllianceRepository;
 use crate::repositories::message_repo::MessageRepository;
+use crate::services::clock;
+use crate::services::social_service::SocialService;
 
 pub struct MessageService;
 
@@ -41,6 +43,9 @@ impl MessageService {
             ));
         }
 
+        // Blocked in either direction
+        SocialService::check_can_message(pool, sender_id, recipient_id).await?;
+
         // Get or create conversation
         let conversation =
             MessageRepository::get_or_create_conversation(pool, sender_id, recipient_id).await?;
@@ -115,7 +120,7 @@ impl MessageService {
 
     /// Delete a message for the current user
     pub async fn delete_message(pool: &PgPool, user_id: Uuid, message_id: Uuid) -> AppResult<()> {
-        if !MessageRepository::delete_for_user(pool, message_id, user_id).await? {
+        if !MessageRepository::delete_for_user(pool, message_id, user_id, clock::now()).await? {
             return Err(AppError::NotFound("Message not found".into()));
         }
         Ok(())
@@ -189,7 +194,7 @@ impl MessageService {
         // Check if user is in an alliance
         let member = AllianceRepository::get_user_alliance(pool, sender_id)
             .await?
-            .ok_or_else(|| AppError::BadRequest("You are not in an alliance".into()))?;
+            .ok_or_else(|| AppError::from(ErrorCode::NotInAlliance))?;
 
         // Create the message
         let message = MessageRepository::create_alliance_message(
@@ -219,7 +224,7 @@ impl MessageService {
         // Check if user is in an alliance
         let member = AllianceRepository::get_user_alliance(pool, user_id)
             .await?
-            .ok_or_else(|| AppError::BadRequest("You are not in an alliance".into()))?;
+            .ok_or_else(|| AppError::from(ErrorCode::NotInAlliance))?;
 
         let limit = limit.min(50).max(1);
         MessageRepository::get_alliance_messages(pool, member.alliance_id, user_id, limit, offset)
@@ -235,7 +240,7 @@ impl MessageService {
         // Check if user is in an alliance
         let member = AllianceRepository::get_user_alliance(pool, user_id)
             .await?
-            .ok_or_else(|| AppError::Forbidden("You are not in an alliance".into()))?;
+            .ok_or_else(|| AppError::from(ErrorCode::NotInAlliance))?;
 
         let message = MessageRepository::get_message(pool, message_id)
             .await?
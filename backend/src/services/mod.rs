@@ -1,11 +1,79 @@
+pub mod account_service;
+pub mod activity_service;
 pub mod alliance_service;
+pub mod alliance_stats_service;
+pub mod anti_pushing_service;
+pub mod api_key_service;
+pub mod archive_store;
 pub mod army_service;
+pub mod attack_warning_service;
+pub mod auction_service;
+pub mod audit_service;
+pub mod bot_detection_service;
 pub mod background_jobs;
+pub mod bootstrap_service;
 pub mod building_service;
+pub mod cache_service;
+pub mod captcha;
+pub mod circuit_breaker;
+pub mod clock;
+pub mod combat;
+pub mod command_service;
+pub mod data_migration_service;
+pub mod defense_call_service;
+pub mod diagnostics_service;
+pub mod digest_service;
+pub mod discord;
+pub mod economy_service;
+pub mod firebase_admin;
+pub mod gamedata_loader;
+pub mod gamedata_service;
+pub mod hall_of_fame_service;
 pub mod hero_service;
+pub mod hospital_service;
+pub mod impersonation_service;
+pub mod invariant_service;
+pub mod inactivity_service;
+pub mod ip_intel;
+pub mod ip_reputation_service;
+pub mod job_failure_service;
+pub mod lag_watchdog_service;
+pub mod mailer;
+pub mod market_service;
 pub mod message_service;
+pub mod note_service;
+pub mod oasis_service;
+pub mod operation_service;
+pub mod ops_metrics_service;
+pub mod placement_service;
+pub mod projection_service;
+pub mod referral_service;
+pub mod region_service;
+pub mod registration_service;
+pub mod report_retention_service;
+pub mod research_service;
 pub mod resource_service;
+pub mod runtime_config_service;
+pub mod search_service;
+pub mod session_service;
+pub mod shard_service;
 pub mod shop_service;
+pub mod snapshot_service;
+pub mod social_service;
+pub mod soft_delete_service;
+pub mod sync_service;
+pub mod template_engine;
+pub mod template_service;
+pub mod tick_service;
+pub mod tribe_service;
 pub mod troop_service;
+pub mod user_admin_service;
 pub mod village_service;
+pub mod village_stats_service;
+pub mod wave_service;
+pub mod world_dump_service;
+pub mod world_stats_service;
+pub mod world_status_service;
+pub mod ws_protocol;
+pub mod ws_replay;
 pub mod ws_service;
@@ -0,0 +1,217 @@
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::alliance::AllianceRole;
+use crate::models::note::{
+    visible_levels, CreateNoteRequest, NoteQuery, NoteResponse, NoteTarget, UpdateNoteRequest,
+    MAX_NOTES_PER_PLAYER, MAX_NOTE_LENGTH,
+};
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::note_repo::NoteRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock;
+
+/// Notes listed when no target is given
+const LIST_LIMIT: i64 = 200;
+
+/// Who is reading notes, and which alliance notes they may see
+pub struct NoteViewer {
+    pub user_id: Uuid,
+    pub alliance_id: Option<Uuid>,
+    pub role: Option<AllianceRole>,
+    pub levels: Vec<String>,
+}
+
+/// Private and alliance-shared notes on villages and players
+pub struct NoteService;
+
+impl NoteService {
+    pub async fn viewer(pool: &PgPool, user_id: Uuid) -> AppResult<NoteViewer> {
+        let member = AllianceRepository::get_user_alliance(pool, user_id).await?;
+        Ok(NoteViewer {
+            user_id,
+            alliance_id: member.as_ref().map(|m| m.alliance_id),
+            role: member.as_ref().map(|m| m.role),
+            levels: member.map(|m| visible_levels(m.role)).unwrap_or_default(),
+        })
+    }
+
+    /// Notes on one target, or every readable note when no target is given
+    pub async fn list(
+        pool: &PgPool,
+        user_id: Uuid,
+        query: NoteQuery,
+    ) -> AppResult<Vec<NoteResponse>> {
+        let viewer = Self::viewer(pool, user_id).await?;
+        match (query.target_type, query.target_id) {
+            (Some(target_type), Some(target_id)) => {
+                Self::for_targets(pool, &viewer, target_type, &[target_id]).await
+            }
+            (None, None) => {
+                NoteRepository::list_visible(
+                    pool,
+                    viewer.user_id,
+                    viewer.alliance_id,
+                    &viewer.levels,
+                    LIST_LIMIT,
+                )
+                .await
+            }
+            _ => Err(AppError::BadRequest(
+                "target_type and target_id go together".into(),
+            )),
+        }
+    }
+
+    /// Readable notes on several targets of one kind, e.g. for a map area
+    pub async fn for_targets(
+        pool: &PgPool,
+        viewer: &NoteViewer,
+        target_type: NoteTarget,
+        target_ids: &[Uuid],
+    ) -> AppResult<Vec<NoteResponse>> {
+        if target_ids.is_empty() {
+            return Ok(Vec::new());
+        }
+        NoteRepository::find_visible(
+            pool,
+            viewer.user_id,
+            viewer.alliance_id,
+            &viewer.levels,
+            target_type,
+            target_ids,
+        )
+        .await
+    }
+
+    pub async fn create(
+        pool: &PgPool,
+        user_id: Uuid,
+        request: CreateNoteRequest,
+    ) -> AppResult<NoteResponse> {
+        let body = Self::check_body(&request.body)?;
+        Self::check_target(pool, request.target_type, request.target_id).await?;
+
+        if NoteRepository::count_by_author(pool, user_id).await? >= MAX_NOTES_PER_PLAYER {
+            return Err(AppError::BadRequest(format!(
+                "At most {} notes can be kept",
+                MAX_NOTES_PER_PLAYER
+            )));
+        }
+
+        let alliance_id = match request.share_with {
+            Some(_) => Some(Self::alliance_of(pool, user_id).await?),
+            None => None,
+        };
+
+        let note = NoteRepository::create(
+            pool,
+            user_id,
+            request.target_type,
+            request.target_id,
+            body,
+            alliance_id,
+            request.share_with,
+            clock::now(),
+        )
+        .await?;
+
+        Self::response(pool, note.id).await
+    }
+
+    /// Edit a note; only its author can
+    pub async fn update(
+        pool: &PgPool,
+        user_id: Uuid,
+        note_id: Uuid,
+        request: UpdateNoteRequest,
+    ) -> AppResult<NoteResponse> {
+        let note = NoteRepository::find_by_id(pool, note_id)
+            .await?
+            .filter(|n| n.author_id == user_id)
+            .ok_or_else(|| AppError::NotFound("Note not found".into()))?;
+
+        let body = match &request.body {
+            Some(body) => Self::check_body(body)?.to_string(),
+            None => note.body,
+        };
+
+        let (alliance_id, min_role) = if request.unshare {
+            (None, None)
+        } else if let Some(role) = request.share_with {
+            (Some(Self::alliance_of(pool, user_id).await?), Some(role))
+        } else {
+            (note.alliance_id, note.min_role)
+        };
+
+        NoteRepository::update(pool, note.id, &body, alliance_id, min_role, clock::now()).await?;
+
+        Self::response(pool, note.id).await
+    }
+
+    /// Delete a note. Its author can, and so can the alliance leader for
+    /// notes shared with the alliance.
+    pub async fn delete(pool: &PgPool, user_id: Uuid, note_id: Uuid) -> AppResult<()> {
+        let note = NoteRepository::find_by_id(pool, note_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Note not found".into()))?;
+
+        if note.author_id != user_id {
+            let viewer = Self::viewer(pool, user_id).await?;
+            let leads_alliance = note.alliance_id.is_some()
+                && viewer.alliance_id == note.alliance_id
+                && viewer.role == Some(AllianceRole::Leader);
+            if !leads_alliance {
+                return Err(AppError::NotFound("Note not found".into()));
+            }
+        }
+
+        NoteRepository::delete(pool, note.id, clock::now()).await
+    }
+
+    fn check_body(body: &str) -> AppResult<&str> {
+        let body = body.trim();
+        if body.is_empty() {
+            return Err(AppError::BadRequest("Note cannot be empty".into()));
+        }
+        if body.chars().count() > MAX_NOTE_LENGTH {
+            return Err(AppError::BadRequest(format!(
+                "Note cannot exceed {} characters",
+                MAX_NOTE_LENGTH
+            )));
+        }
+        Ok(body)
+    }
+
+    async fn check_target(
+        pool: &PgPool,
+        target_type: NoteTarget,
+        target_id: Uuid,
+    ) -> AppResult<()> {
+        let exists = match target_type {
+            NoteTarget::Village => VillageRepository::find_by_id(pool, target_id)
+                .await?
+                .is_some(),
+            NoteTarget::Player => UserRepository::find_by_id(pool, target_id).await?.is_some(),
+        };
+        if !exists {
+            return Err(AppError::NotFound(format!("{:?} not found", target_type)));
+        }
+        Ok(())
+    }
+
+    async fn alliance_of(pool: &PgPool, user_id: Uuid) -> AppResult<Uuid> {
+        AllianceRepository::get_user_alliance(pool, user_id)
+            .await?
+            .map(|m| m.alliance_id)
+            .ok_or_else(|| AppError::BadRequest("Join an alliance to share notes with it".into()))
+    }
+
+    async fn response(pool: &PgPool, note_id: Uuid) -> AppResult<NoteResponse> {
+        NoteRepository::find_response(pool, note_id)
+            .await?
+            .ok_or_else(|| AppError::InternalError(anyhow::anyhow!("Failed to fetch note")))
+    }
+}
@@ -0,0 +1,324 @@
+use chrono::{DateTime, Utc};
+use rand::Rng;
+use sqlx::{PgConnection, PgPool};
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::army::{Army, ArmyTroops, CarriedResources, MissionType};
+use crate::models::building::BuildingType;
+use crate::models::oasis::{
+    oasis_slots, NatureTroop, NatureTroops, Oasis, OasisBonus, OasisResponse, OasisType,
+    SeedOasesRequest, SeedOasesResult, VillageOasesResponse, OCCUPY_RANGE, REGROWTH_PERCENT,
+};
+use crate::repositories::army_repo::ArmyRepository;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::oasis_repo::OasisRepository;
+use crate::repositories::troop_repo::TroopRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::army_service::ArmyService;
+use crate::services::clock;
+use crate::services::combat::{self, BattleBonus, CombatUnit};
+use crate::services::resource_service::ResourceService;
+use crate::services::tribe_service::TribeService;
+
+impl CombatUnit for NatureTroop {
+    type Key = NatureTroop;
+
+    fn key(&self) -> NatureTroop {
+        *self
+    }
+    fn is_cavalry(&self) -> bool {
+        false
+    }
+    fn attack(&self) -> i32 {
+        self.stats().0
+    }
+    fn defense_infantry(&self) -> i32 {
+        self.stats().1
+    }
+    fn defense_cavalry(&self) -> i32 {
+        self.stats().2
+    }
+}
+
+pub struct OasisService;
+
+impl OasisService {
+    /// A raid or attack reaching an oasis. The animals of an unoccupied
+    /// oasis fight back; an attack led by a hero that wins takes the oasis
+    /// for its home village if the village has a free slot in range.
+    pub async fn handle_arrival(pool: &PgPool, army: &Army, oasis: Oasis) -> AppResult<()> {
+        let definitions = TroopRepository::get_all_definitions(pool).await?;
+
+        // Animals have no tribe, so only the attacker's bonus applies
+        let attack_percent =
+            TribeService::attack_percent(pool, army.player_id, army.from_village_id).await?;
+        let bonus = BattleBonus {
+            attack_percent,
+            defense_percent: 0,
+        };
+        let battle = combat::resolve(
+            &army.troops.0,
+            &definitions,
+            &oasis.animals.0,
+            &NatureTroop::ALL,
+            army.mission,
+            bonus,
+        );
+
+        if battle.defender_losses.values().sum::<i32>() > 0 {
+            OasisRepository::update_animals(pool, oasis.id, &battle.defender_survivors).await?;
+        }
+
+        let winner = if battle.attacker_wins {
+            "attacker"
+        } else {
+            "defender"
+        };
+
+        // Animals aren't troops, so the report only records the attacker's side
+        let report = ArmyRepository::create_battle_report(
+            pool,
+            army.player_id,
+            None,
+            army.from_village_id,
+            None,
+            army.mission,
+            &army.troops.0,
+            &ArmyTroops::new(),
+            &battle.attacker_losses,
+            &ArmyTroops::new(),
+            &ArmyTroops::new(),
+            &CarriedResources::default(),
+            winner,
+            clock::now(),
+        )
+        .await?;
+
+        info!(
+            "Oasis battle at ({}, {}): {} wins, attacker lost {}, animals lost {}",
+            oasis.x,
+            oasis.y,
+            winner,
+            battle.attacker_losses.values().sum::<i32>(),
+            battle.defender_losses.values().sum::<i32>()
+        );
+
+        let total_survivors: i32 = battle.attacker_survivors.values().sum();
+        if total_survivors == 0 {
+            ArmyService::record_away_losses(
+                pool,
+                army.from_village_id,
+                &army.troops.0,
+                &ArmyTroops::new(),
+            )
+            .await?;
+            ArmyRepository::delete(pool, army.id).await?;
+            return ArmyService::release_hero(pool, army, false).await;
+        }
+
+        if battle.attacker_wins && army.mission == MissionType::Attack && army.hero_id.is_some() {
+            Self::try_occupy(pool, army, &oasis).await?;
+        }
+
+        ArmyService::initiate_return(
+            pool,
+            army,
+            battle.attacker_survivors,
+            CarriedResources::default(),
+            Some(report.id),
+        )
+        .await
+    }
+
+    /// Take the oasis for the army's home village, if it is close enough
+    /// and the village has a free slot
+    async fn try_occupy(pool: &PgPool, army: &Army, oasis: &Oasis) -> AppResult<bool> {
+        if oasis.owner_village_id == Some(army.from_village_id) {
+            return Ok(false);
+        }
+
+        let Some(village) = VillageRepository::find_by_id(pool, army.from_village_id).await? else {
+            return Ok(false);
+        };
+        if (oasis.x - village.x).abs() > OCCUPY_RANGE || (oasis.y - village.y).abs() > OCCUPY_RANGE
+        {
+            info!(
+                "Oasis ({}, {}) is out of range of village {}",
+                oasis.x, oasis.y, village.id
+            );
+            return Ok(false);
+        }
+
+        // Pay out production at the old rates before the bonus changes hands
+        let now = clock::now();
+        ResourceService::settle(pool, village.id, now).await?;
+        if let Some(previous) = oasis.owner_village_id {
+            ResourceService::settle(pool, previous, now).await?;
+        }
+
+        let slots = Self::slots(pool, village.id).await?;
+        let occupied = OasisRepository::occupy(pool, oasis.id, village.id, slots, now)
+            .await?
+            .is_some();
+
+        if occupied {
+            info!(
+                "Village {} occupied oasis ({}, {}){}",
+                village.id,
+                oasis.x,
+                oasis.y,
+                match oasis.owner_village_id {
+                    Some(previous) => format!(", taking it from village {}", previous),
+                    None => String::new(),
+                }
+            );
+        } else {
+            info!("Village {} has no free oasis slot", village.id);
+        }
+
+        Ok(occupied)
+    }
+
+    /// Oasis slots from the village's hero mansion
+    async fn slots(pool: &PgPool, village_id: Uuid) -> AppResult<i32> {
+        let mansions =
+            BuildingRepository::find_by_type(pool, village_id, BuildingType::HeroMansion).await?;
+        let level = mansions.first().map(|b| b.level).unwrap_or(0);
+        Ok(oasis_slots(level))
+    }
+
+    /// Combined production bonus of the oases a village holds
+    pub async fn production_bonus(pool: &PgPool, village_id: Uuid) -> AppResult<OasisBonus> {
+        let oases = OasisRepository::find_by_owner(pool, village_id).await?;
+        let mut bonus = OasisBonus::default();
+        for oasis in &oases {
+            bonus.add(oasis.oasis_type.bonus());
+        }
+        Ok(bonus)
+    }
+
+    pub async fn get_oasis(pool: &PgPool, id: Uuid) -> AppResult<OasisResponse> {
+        let oasis = OasisRepository::find_by_id(pool, id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Oasis not found".into()))?;
+        Ok(oasis.into())
+    }
+
+    pub async fn get_village_oases(
+        pool: &PgPool,
+        village_id: Uuid,
+    ) -> AppResult<VillageOasesResponse> {
+        let oases = OasisRepository::find_by_owner(pool, village_id).await?;
+        let slots = Self::slots(pool, village_id).await?;
+
+        let mut bonus = OasisBonus::default();
+        for oasis in &oases {
+            bonus.add(oasis.oasis_type.bonus());
+        }
+
+        Ok(VillageOasesResponse {
+            slots,
+            oases: oases.into_iter().map(Into::into).collect(),
+            bonus,
+        })
+    }
+
+    /// Give up an oasis; the animals move back in over time
+    pub async fn abandon(
+        pool: &PgPool,
+        village_id: Uuid,
+        oasis_id: Uuid,
+    ) -> AppResult<OasisResponse> {
+        // Production up to now still gets the oasis bonus
+        let now = clock::now();
+        ResourceService::settle(pool, village_id, now).await?;
+
+        let oasis = OasisRepository::release(pool, oasis_id, village_id, now)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Oasis not held by this village".into()))?;
+
+        info!("Village {} abandoned oasis {}", village_id, oasis_id);
+
+        Ok(oasis.into())
+    }
+
+    /// Regrow animals in the unoccupied oases of one tick shard, a share of
+    /// the full garrison per tick. Run by the tick coordinator inside its
+    /// transaction. Returns how many oases were topped up.
+    pub async fn regrow(
+        conn: &mut PgConnection,
+        lower: Uuid,
+        upper: Option<Uuid>,
+        ticks: i64,
+        now: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        let oases = OasisRepository::find_unoccupied_in_range(&mut *conn, lower, upper).await?;
+
+        let mut count = 0;
+        for oasis in oases {
+            let full = oasis.oasis_type.full_garrison();
+            let animals = regrown(&oasis.animals.0, &full, ticks);
+            if animals == oasis.animals.0 {
+                continue;
+            }
+            OasisRepository::set_regrown(&mut *conn, oasis.id, &animals, now).await?;
+            count += 1;
+        }
+
+        Ok(count)
+    }
+
+    /// Scatter fully grown oases over free tiles within `radius` of the origin
+    pub async fn seed(pool: &PgPool, request: SeedOasesRequest) -> AppResult<SeedOasesResult> {
+        if !(1..=400).contains(&request.radius) {
+            return Err(AppError::BadRequest(
+                "Radius must be between 1 and 400".into(),
+            ));
+        }
+        if !(1..=50).contains(&request.density) {
+            return Err(AppError::BadRequest(
+                "Density must be between 1 and 50".into(),
+            ));
+        }
+
+        let tiles: Vec<(i32, i32, OasisType)> = {
+            let mut rng = rand::thread_rng();
+            let mut tiles = Vec::new();
+            for y in -request.radius..=request.radius {
+                for x in -request.radius..=request.radius {
+                    if rng.gen_range(0..100) < request.density {
+                        let oasis_type = OasisType::ALL[rng.gen_range(0..OasisType::ALL.len())];
+                        tiles.push((x, y, oasis_type));
+                    }
+                }
+            }
+            tiles
+        };
+
+        let now = clock::now();
+        let mut created = 0;
+        for (x, y, oasis_type) in tiles {
+            let animals = oasis_type.full_garrison();
+            if OasisRepository::create(pool, x, y, oasis_type, &animals, now).await? {
+                created += 1;
+            }
+        }
+
+        info!("Seeded {} oases within radius {}", created, request.radius);
+
+        Ok(SeedOasesResult { created })
+    }
+}
+
+/// Animals after `ticks` regrowth steps, capped at the full garrison
+fn regrown(current: &NatureTroops, full: &NatureTroops, ticks: i64) -> NatureTroops {
+    full.iter()
+        .map(|(troop, max)| {
+            let have = current.get(troop).copied().unwrap_or(0) as i64;
+            let step = (max * REGROWTH_PERCENT / 100).max(1) as i64;
+            (*troop, (have + step * ticks).min(*max as i64) as i32)
+        })
+        .collect()
+}
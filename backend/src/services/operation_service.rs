@@ -0,0 +1,451 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use std::collections::HashMap;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::alliance::{AllianceMember, AllianceRole};
+use crate::models::army::MissionType;
+use crate::models::operation::{
+    AllianceOperation, CreateOperationRequest, ListOperationsQuery, OperationBoard, OperationKind,
+    OperationSignup, OperationSignupRequest, OperationSignupResponse, OperationSignupResult,
+    OperationTargetBoard, MAX_LANDING_WINDOW_HOURS, MAX_OPEN_OPERATIONS, MAX_OPERATION_AHEAD_DAYS,
+    MAX_OPERATION_NAME_LEN, MAX_OPERATION_NOTES_LEN, MAX_OPERATION_TARGETS, MAX_SIGNUPS_PER_MEMBER,
+    MAX_TARGET_NOTE_LEN,
+};
+use crate::models::troop::TroopType;
+use crate::models::village::WORLD_RADIUS;
+use crate::models::wave::{PlanWaveRequest, WaveSend, WaveSendStatus};
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::operation_repo::OperationRepository;
+use crate::repositories::wave_repo::WaveRepository;
+use crate::services::clock;
+use crate::services::wave_service::WaveService;
+
+/// Operations listed per alliance
+const OPERATION_LIST_LIMIT: i64 = 50;
+
+/// The alliance's coordination board. Leadership posts operations, members
+/// sign their waves up against the targets, and everyone in the alliance
+/// sees what is committed and when it lands.
+pub struct OperationService;
+
+impl OperationService {
+    // ==================== Leadership ====================
+
+    /// Post an operation. Leader and officers only.
+    pub async fn create(
+        pool: &PgPool,
+        user_id: Uuid,
+        alliance_id: Uuid,
+        request: CreateOperationRequest,
+    ) -> AppResult<OperationBoard> {
+        Self::check_leadership(pool, alliance_id, user_id).await?;
+        Self::validate(&request)?;
+
+        let now = clock::now();
+        if OperationRepository::count_open(pool, alliance_id, now).await? >= MAX_OPEN_OPERATIONS {
+            return Err(AppError::BadRequest(format!(
+                "At most {} operations can be open at once",
+                MAX_OPEN_OPERATIONS
+            )));
+        }
+
+        let operation = OperationRepository::create(pool, alliance_id, user_id, &request).await?;
+        info!(
+            "Alliance {} posted {:?} operation {} on {} targets",
+            alliance_id,
+            operation.kind,
+            operation.id,
+            request.targets.len()
+        );
+
+        Self::board_of(pool, operation).await
+    }
+
+    /// Call an operation off, with the scheduled sends signed up to it.
+    /// Leader and officers only.
+    pub async fn cancel(
+        pool: &PgPool,
+        user_id: Uuid,
+        operation_id: Uuid,
+    ) -> AppResult<OperationBoard> {
+        let operation = Self::find(pool, operation_id).await?;
+        Self::check_leadership(pool, operation.alliance_id, user_id).await?;
+
+        if !OperationRepository::cancel(pool, operation_id).await? {
+            return Err(AppError::BadRequest(
+                "Operation is already cancelled".into(),
+            ));
+        }
+
+        let mut cancelled = 0;
+        for signup in OperationRepository::find_signups(pool, operation_id).await? {
+            if let Some(wave_id) = signup.wave_id {
+                cancelled += WaveRepository::cancel(pool, wave_id).await?;
+            }
+        }
+        info!(
+            "Operation {} cancelled by {}, {} scheduled sends called off",
+            operation_id, user_id, cancelled
+        );
+
+        Self::board_of(pool, Self::find(pool, operation_id).await?).await
+    }
+
+    // ==================== Members ====================
+
+    /// The alliance's operations, latest window first. Members only.
+    pub async fn list(
+        pool: &PgPool,
+        user_id: Uuid,
+        alliance_id: Uuid,
+        query: ListOperationsQuery,
+    ) -> AppResult<Vec<AllianceOperation>> {
+        Self::check_member(pool, alliance_id, user_id).await?;
+        OperationRepository::find_by_alliance(
+            pool,
+            alliance_id,
+            query.all,
+            clock::now(),
+            OPERATION_LIST_LIMIT,
+        )
+        .await
+    }
+
+    /// Targets, sign-ups and committed troops. Members only.
+    pub async fn board(
+        pool: &PgPool,
+        user_id: Uuid,
+        operation_id: Uuid,
+    ) -> AppResult<OperationBoard> {
+        let operation = Self::find(pool, operation_id).await?;
+        Self::check_member(pool, operation.alliance_id, user_id).await?;
+
+        Self::board_of(pool, operation).await
+    }
+
+    /// Plan a wave against one of the targets with the movement planner
+    /// and put it on the board
+    pub async fn sign_up(
+        pool: &PgPool,
+        user_id: Uuid,
+        operation_id: Uuid,
+        request: OperationSignupRequest,
+    ) -> AppResult<OperationSignupResult> {
+        let operation = Self::find(pool, operation_id).await?;
+        Self::check_member(pool, operation.alliance_id, user_id).await?;
+        if !operation.is_open(clock::now()) {
+            return Err(AppError::BadRequest("Operation is no longer open".into()));
+        }
+
+        let target = OperationRepository::find_target(pool, request.target_id)
+            .await?
+            .filter(|t| t.operation_id == operation_id)
+            .ok_or_else(|| AppError::NotFound("Target not found".into()))?;
+
+        for send in &request.sends {
+            if !mission_fits(operation.kind, send.mission) {
+                return Err(AppError::BadRequest(format!(
+                    "A {:?} mission doesn't fit a {:?} operation",
+                    send.mission, operation.kind
+                )));
+            }
+        }
+
+        let arrive_at = request.arrive_at.unwrap_or(operation.landing_from);
+        if arrive_at < operation.landing_from || arrive_at > operation.landing_until {
+            return Err(AppError::BadRequest(format!(
+                "Waves must land between {} and {}",
+                operation.landing_from, operation.landing_until
+            )));
+        }
+
+        if OperationRepository::count_signups(pool, operation_id, user_id).await?
+            >= MAX_SIGNUPS_PER_MEMBER
+        {
+            return Err(AppError::BadRequest(format!(
+                "At most {} waves can be signed up per operation",
+                MAX_SIGNUPS_PER_MEMBER
+            )));
+        }
+
+        let mut troops: HashMap<TroopType, i32> = HashMap::new();
+        for send in &request.sends {
+            for (troop, count) in &send.troops {
+                *troops.entry(*troop).or_default() += count;
+            }
+        }
+        let armies = request.sends.len() as i32;
+
+        let plan = WaveService::plan(
+            pool,
+            user_id,
+            PlanWaveRequest {
+                to_x: target.x,
+                to_y: target.y,
+                arrive_at: Some(arrive_at),
+                sends: request.sends,
+                schedule: request.schedule,
+            },
+        )
+        .await?;
+
+        let signup = OperationRepository::create_signup(
+            pool,
+            operation_id,
+            target.id,
+            user_id,
+            plan.wave.as_ref().map(|w| w.wave.id),
+            &troops,
+            armies,
+            plan.arrive_at,
+        )
+        .await?;
+
+        info!(
+            "Player {} signed up {} armies to operation {} landing at {}",
+            user_id, armies, operation_id, plan.arrive_at
+        );
+
+        let wave_status = plan.wave.as_ref().map(|w| wave_status(&w.sends));
+        Ok(OperationSignupResult {
+            signup: OperationSignupResponse {
+                signup,
+                wave_status,
+            },
+            plan,
+        })
+    }
+
+    /// Take a wave off the board, calling off its sends that haven't left.
+    /// Its owner, the leader or an officer may.
+    pub async fn withdraw(
+        pool: &PgPool,
+        user_id: Uuid,
+        operation_id: Uuid,
+        signup_id: Uuid,
+    ) -> AppResult<()> {
+        let operation = Self::find(pool, operation_id).await?;
+        let member = Self::check_member(pool, operation.alliance_id, user_id).await?;
+
+        let signup = OperationRepository::find_signup(pool, signup_id)
+            .await?
+            .filter(|s| s.operation_id == operation_id)
+            .ok_or_else(|| AppError::NotFound("Sign-up not found".into()))?;
+        if signup.player_id != user_id && member.role == AllianceRole::Member {
+            return Err(AppError::Forbidden(
+                "You can only withdraw your own waves".into(),
+            ));
+        }
+
+        if let Some(wave_id) = signup.wave_id {
+            WaveRepository::cancel(pool, wave_id).await?;
+        }
+        OperationRepository::delete_signup(pool, signup_id).await?;
+
+        info!(
+            "Sign-up {} to operation {} withdrawn by {}",
+            signup_id, operation_id, user_id
+        );
+
+        Ok(())
+    }
+
+    // ==================== Helpers ====================
+
+    async fn board_of(pool: &PgPool, operation: AllianceOperation) -> AppResult<OperationBoard> {
+        let targets = OperationRepository::find_targets(pool, operation.id).await?;
+        let signups = OperationRepository::find_signups(pool, operation.id).await?;
+
+        let wave_ids: Vec<Uuid> = signups.iter().filter_map(|s| s.wave_id).collect();
+        let mut sends_by_wave: HashMap<Uuid, Vec<WaveSend>> = HashMap::new();
+        for send in WaveRepository::find_sends(pool, &wave_ids).await? {
+            sends_by_wave.entry(send.wave_id).or_default().push(send);
+        }
+
+        let mut signups_by_target: HashMap<Uuid, Vec<OperationSignup>> = HashMap::new();
+        for signup in signups {
+            signups_by_target
+                .entry(signup.target_id)
+                .or_default()
+                .push(signup);
+        }
+
+        let targets = targets
+            .into_iter()
+            .map(|target| {
+                let mut committed: HashMap<TroopType, i64> = HashMap::new();
+                let mut armies = 0;
+                let mut responses = Vec::new();
+
+                for signup in signups_by_target.remove(&target.id).unwrap_or_default() {
+                    let sends = signup.wave_id.and_then(|id| sends_by_wave.get(&id));
+                    match sends {
+                        // Only the sends still on their way, or yet to leave
+                        Some(sends) => {
+                            for send in sends.iter().filter(|s| counts(s.status)) {
+                                armies += 1;
+                                for (troop, count) in send.troops.0.iter() {
+                                    *committed.entry(*troop).or_default() += *count as i64;
+                                }
+                            }
+                        }
+                        None => {
+                            armies += signup.armies;
+                            for (troop, count) in signup.troops.0.iter() {
+                                *committed.entry(*troop).or_default() += *count as i64;
+                            }
+                        }
+                    }
+
+                    let wave_status = sends.map(|s| wave_status(s));
+                    responses.push(OperationSignupResponse {
+                        signup,
+                        wave_status,
+                    });
+                }
+
+                OperationTargetBoard {
+                    target,
+                    committed,
+                    armies,
+                    signups: responses,
+                }
+            })
+            .collect();
+
+        Ok(OperationBoard { operation, targets })
+    }
+
+    fn validate(request: &CreateOperationRequest) -> AppResult<()> {
+        let name = request.name.trim();
+        if name.is_empty() || name.chars().count() > MAX_OPERATION_NAME_LEN {
+            return Err(AppError::ValidationError(format!(
+                "Name must be 1 to {} characters",
+                MAX_OPERATION_NAME_LEN
+            )));
+        }
+        if request
+            .notes
+            .as_ref()
+            .is_some_and(|n| n.chars().count() > MAX_OPERATION_NOTES_LEN)
+        {
+            return Err(AppError::ValidationError(format!(
+                "Notes can be at most {} characters",
+                MAX_OPERATION_NOTES_LEN
+            )));
+        }
+
+        let now = clock::now();
+        if request.landing_from <= now {
+            return Err(AppError::ValidationError(
+                "The landing window must start in the future".into(),
+            ));
+        }
+        if request.landing_from > now + Duration::days(MAX_OPERATION_AHEAD_DAYS) {
+            return Err(AppError::ValidationError(format!(
+                "The landing window can start at most {} days ahead",
+                MAX_OPERATION_AHEAD_DAYS
+            )));
+        }
+        if request.landing_until <= request.landing_from
+            || request.landing_until - request.landing_from
+                > Duration::hours(MAX_LANDING_WINDOW_HOURS)
+        {
+            return Err(AppError::ValidationError(format!(
+                "The landing window must end after it starts and last at most {} hours",
+                MAX_LANDING_WINDOW_HOURS
+            )));
+        }
+
+        if request.targets.is_empty() || request.targets.len() > MAX_OPERATION_TARGETS {
+            return Err(AppError::ValidationError(format!(
+                "An operation needs 1 to {} targets",
+                MAX_OPERATION_TARGETS
+            )));
+        }
+        for (i, target) in request.targets.iter().enumerate() {
+            if target.x.abs() > WORLD_RADIUS || target.y.abs() > WORLD_RADIUS {
+                return Err(AppError::ValidationError(format!(
+                    "Target ({}, {}) is off the map",
+                    target.x, target.y
+                )));
+            }
+            if target
+                .note
+                .as_ref()
+                .is_some_and(|n| n.chars().count() > MAX_TARGET_NOTE_LEN)
+            {
+                return Err(AppError::ValidationError(format!(
+                    "Target notes can be at most {} characters",
+                    MAX_TARGET_NOTE_LEN
+                )));
+            }
+            if request.targets[..i]
+                .iter()
+                .any(|t| t.x == target.x && t.y == target.y)
+            {
+                return Err(AppError::ValidationError(format!(
+                    "Target ({}, {}) is listed twice",
+                    target.x, target.y
+                )));
+            }
+        }
+
+        Ok(())
+    }
+
+    async fn find(pool: &PgPool, operation_id: Uuid) -> AppResult<AllianceOperation> {
+        OperationRepository::find_by_id(pool, operation_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Operation not found".into()))
+    }
+
+    async fn check_member(
+        pool: &PgPool,
+        alliance_id: Uuid,
+        user_id: Uuid,
+    ) -> AppResult<AllianceMember> {
+        AllianceRepository::get_member(pool, alliance_id, user_id)
+            .await?
+            .ok_or_else(|| AppError::Forbidden("You are not a member of this alliance".into()))
+    }
+
+    async fn check_leadership(pool: &PgPool, alliance_id: Uuid, user_id: Uuid) -> AppResult<()> {
+        let member = Self::check_member(pool, alliance_id, user_id).await?;
+        if member.role == AllianceRole::Member {
+            return Err(AppError::Forbidden(
+                "Only the leader and officers can manage operations".into(),
+            ));
+        }
+        Ok(())
+    }
+}
+
+/// Attacks take hostile missions; defenses take support
+fn mission_fits(kind: OperationKind, mission: MissionType) -> bool {
+    match kind {
+        OperationKind::Attack => mission.is_hostile(),
+        OperationKind::Defense => mission == MissionType::Support,
+    }
+}
+
+/// Sends that still put troops on the target
+fn counts(status: WaveSendStatus) -> bool {
+    matches!(status, WaveSendStatus::Planned | WaveSendStatus::Sent)
+}
+
+/// One status for a whole wave: planned while any send is waiting, then
+/// failed if any send failed, then sent if any left
+fn wave_status(sends: &[WaveSend]) -> WaveSendStatus {
+    [
+        WaveSendStatus::Planned,
+        WaveSendStatus::Failed,
+        WaveSendStatus::Sent,
+    ]
+    .into_iter()
+    .find(|status| sends.iter().any(|s| s.status == *status))
+    .unwrap_or(WaveSendStatus::Cancelled)
+}
@@ -0,0 +1,118 @@
+use chrono::{Duration, Utc};
+use std::collections::HashMap;
+use std::sync::{LazyLock, Mutex};
+
+use crate::error::{AppError, AppResult};
+use crate::models::diagnostics::WebSocketStats;
+use crate::models::ops_metrics::{JobThroughput, OpsMetrics, WorldOpsMetrics};
+use crate::models::world_shard::DEFAULT_WORLD;
+use crate::repositories::ops_metrics_repo::OpsMetricsRepository;
+use crate::services::cache_service::CacheService;
+use crate::services::clock;
+use crate::AppState;
+
+/// Items processed and failed per job, counted by `JobFailureService::guard`
+static JOB_COUNTS: LazyLock<Mutex<HashMap<String, (u64, u64)>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Count one item of `job`
+pub fn record_job_item(job: &str, ok: bool) {
+    let mut counts = JOB_COUNTS.lock().unwrap();
+    let (processed, failed) = counts.entry(job.to_string()).or_default();
+    if ok {
+        *processed += 1;
+    } else {
+        *failed += 1;
+    }
+}
+
+/// Operational health for live-ops: queue backlogs and their lag, job
+/// failures, connections and cache effectiveness
+pub struct OpsMetricsService;
+
+impl OpsMetricsService {
+    /// Every world: the default one and each sharded world
+    pub async fn all(state: &AppState) -> AppResult<OpsMetrics> {
+        let mut world_ids = vec![DEFAULT_WORLD.to_string()];
+        world_ids.extend(state.shards.sharded_worlds());
+
+        let mut worlds = Vec::with_capacity(world_ids.len());
+        for world_id in world_ids {
+            worlds.push(Self::world_or_error(state, &world_id).await);
+        }
+
+        Ok(Self::metrics(state, worlds).await)
+    }
+
+    pub async fn for_world(state: &AppState, world_id: &str) -> AppResult<OpsMetrics> {
+        if world_id != DEFAULT_WORLD && !state.shards.sharded_worlds().iter().any(|w| w == world_id)
+        {
+            return Err(AppError::NotFound(format!("Unknown world {}", world_id)));
+        }
+
+        let world = Self::world(state, world_id).await?;
+        Ok(Self::metrics(state, vec![world]).await)
+    }
+
+    async fn metrics(state: &AppState, worlds: Vec<WorldOpsMetrics>) -> OpsMetrics {
+        OpsMetrics {
+            taken_at: Utc::now(),
+            worlds,
+            jobs: job_throughput(),
+            websocket: WebSocketStats {
+                connected_users: state.ws.connected_users_count().await,
+                connections: state.ws.total_connections_count().await,
+            },
+            cache: CacheService::stats(),
+        }
+    }
+
+    /// A world that can't be read shows up with its error, so one bad
+    /// shard doesn't hide the others
+    async fn world_or_error(state: &AppState, world_id: &str) -> WorldOpsMetrics {
+        match Self::world(state, world_id).await {
+            Ok(metrics) => metrics,
+            Err(e) => WorldOpsMetrics {
+                world_id: world_id.to_string(),
+                queues: Vec::new(),
+                job_failures: Vec::new(),
+                tick_lag_secs: None,
+                error: Some(e.to_string()),
+            },
+        }
+    }
+
+    async fn world(state: &AppState, world_id: &str) -> AppResult<WorldOpsMetrics> {
+        let pool = state.shards.pool_for(world_id)?;
+        let now = clock::now();
+
+        let (queues, job_failures, tick_lag_secs) = tokio::try_join!(
+            OpsMetricsRepository::queue_backlogs(&pool, now),
+            OpsMetricsRepository::job_failures(&pool, now - Duration::hours(1)),
+            OpsMetricsRepository::tick_lag_secs(&pool, now),
+        )?;
+
+        Ok(WorldOpsMetrics {
+            world_id: world_id.to_string(),
+            queues,
+            job_failures,
+            tick_lag_secs,
+            error: None,
+        })
+    }
+}
+
+fn job_throughput() -> Vec<JobThroughput> {
+    let counts = JOB_COUNTS.lock().unwrap();
+    let mut jobs: Vec<JobThroughput> = counts
+        .iter()
+        .map(|(job, &(processed, failed))| JobThroughput {
+            job: job.clone(),
+            processed,
+            failed,
+            failure_rate: failed as f64 / (processed + failed).max(1) as f64,
+        })
+        .collect();
+    jobs.sort_by(|a, b| a.job.cmp(&b.job));
+    jobs
+}
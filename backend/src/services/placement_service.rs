@@ -0,0 +1,134 @@
+use std::collections::HashSet;
+
+use rand::rngs::StdRng;
+use rand::{Rng, SeedableRng};
+use sqlx::PgPool;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::user::NATAR_FIREBASE_UID;
+use crate::models::village::{
+    spawn_radius, Quadrant, SPAWN_CANDIDATES, SPAWN_DENSITY_RADIUS, SPAWN_MAX_NEIGHBOURS,
+    SPAWN_NATAR_DISTANCE, SPAWN_RING_WIDTH, WORLD_RADIUS,
+};
+use crate::repositories::oasis_repo::OasisRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::repositories::village_repo::VillageRepository;
+
+/// What placement needs to know about the tiles around the spawn ring
+#[derive(Debug, Default)]
+pub struct SpawnMap {
+    /// Tiles holding a village or an oasis
+    pub taken: HashSet<(i32, i32)>,
+    pub villages: Vec<(i32, i32)>,
+    pub natars: Vec<(i32, i32)>,
+}
+
+/// Picks the tile for a new player's first village
+pub struct PlacementService;
+
+impl PlacementService {
+    /// Find a free tile in the spawn ring, in the chosen quadrant if any.
+    /// The ring moves outward as players settle and is widened when full.
+    /// The same player on the same map always gets the same tile.
+    pub async fn place(
+        pool: &PgPool,
+        user_id: Uuid,
+        quadrant: Option<Quadrant>,
+    ) -> AppResult<(i32, i32)> {
+        let players = VillageRepository::count_capitals(pool).await?;
+        let natar_id = UserRepository::find_by_firebase_uid(pool, NATAR_FIREBASE_UID)
+            .await?
+            .map(|u| u.id);
+
+        let mut outer = spawn_radius(players);
+        let mut inner = (outer - SPAWN_RING_WIDTH).max(0);
+        let mut rng = StdRng::seed_from_u64(user_id.as_u128() as u64);
+
+        loop {
+            let map = Self::load_map(pool, outer, natar_id).await?;
+            if let Some((x, y)) = pick_tile(&map, quadrant, inner, outer, &mut rng) {
+                info!(
+                    "Placed player {} at ({}, {}), spawn ring {}..{}",
+                    user_id, x, y, inner, outer
+                );
+                return Ok((x, y));
+            }
+
+            if outer >= WORLD_RADIUS {
+                return Err(AppError::Conflict("No free tile left to start on".into()));
+            }
+            inner = outer;
+            outer = (outer + SPAWN_RING_WIDTH).min(WORLD_RADIUS);
+        }
+    }
+
+    /// Villages and oases out to `radius`, plus the margin the density and
+    /// Natar checks look past the ring's edge
+    async fn load_map(pool: &PgPool, radius: i32, natar_id: Option<Uuid>) -> AppResult<SpawnMap> {
+        let range = radius + SPAWN_NATAR_DISTANCE.max(SPAWN_DENSITY_RADIUS);
+        let villages = VillageRepository::find_in_range(pool, 0, 0, range).await?;
+        let oases = OasisRepository::find_in_range(pool, 0, 0, range).await?;
+
+        let mut map = SpawnMap::default();
+        for village in villages {
+            map.taken.insert((village.x, village.y));
+            if Some(village.user_id) == natar_id {
+                map.natars.push((village.x, village.y));
+            } else {
+                map.villages.push((village.x, village.y));
+            }
+        }
+        for oasis in oases {
+            map.taken.insert((oasis.x, oasis.y));
+        }
+
+        Ok(map)
+    }
+}
+
+/// Try random tiles between `inner` and `outer` (Chebyshev distance from
+/// the centre). Returns the first tile with few enough neighbours, or else
+/// the least crowded one seen; None if every candidate was unusable.
+pub fn pick_tile(
+    map: &SpawnMap,
+    quadrant: Option<Quadrant>,
+    inner: i32,
+    outer: i32,
+    rng: &mut StdRng,
+) -> Option<(i32, i32)> {
+    let mut best: Option<((i32, i32), usize)> = None;
+
+    for _ in 0..SPAWN_CANDIDATES {
+        let quadrant = quadrant.unwrap_or_else(|| Quadrant::ALL[rng.gen_range(0..4)]);
+        let (sx, sy) = quadrant.signs();
+        let (ax, ay) = (rng.gen_range(0..=outer), rng.gen_range(0..=outer));
+        if ax.max(ay) < inner {
+            continue;
+        }
+        let tile = (ax * sx, ay * sy);
+
+        if map.taken.contains(&tile) || near(&map.natars, tile, SPAWN_NATAR_DISTANCE) > 0 {
+            continue;
+        }
+
+        let neighbours = near(&map.villages, tile, SPAWN_DENSITY_RADIUS);
+        if neighbours <= SPAWN_MAX_NEIGHBOURS {
+            return Some(tile);
+        }
+        if best.map_or(true, |(_, n)| neighbours < n) {
+            best = Some((tile, neighbours));
+        }
+    }
+
+    best.map(|(tile, _)| tile)
+}
+
+/// Tiles in `tiles` within `distance` of `tile` on both axes
+fn near(tiles: &[(i32, i32)], tile: (i32, i32), distance: i32) -> usize {
+    tiles
+        .iter()
+        .filter(|(x, y)| (x - tile.0).abs() <= distance && (y - tile.1).abs() <= distance)
+        .count()
+}
@@ -0,0 +1,166 @@
+use sqlx::PgPool;
+use std::collections::{BTreeMap, HashSet};
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::domain_event::{ENTITY_ALLIANCE, ENTITY_ALLIANCE_MEMBER};
+use crate::models::projection::{
+    PlayerStats, ProjectionRunResult, RankedAlliance, RankedPlayer, WorldRanking,
+    RANKING_CATEGORIES, STATS_PROJECTION,
+};
+use crate::repositories::domain_event_repo::DomainEventRepository;
+use crate::repositories::projection_repo::ProjectionRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+
+/// Events applied per run; a backlog is worked off over successive runs
+const BATCH_SIZE: i64 = 5000;
+
+pub struct ProjectionService;
+
+impl ProjectionService {
+    /// Fold new domain events into the stats read models. Only players and
+    /// alliances touched since the checkpoint are recomputed.
+    pub async fn run_once(pool: &PgPool) -> AppResult<ProjectionRunResult> {
+        let checkpoint = ProjectionRepository::get_checkpoint(pool, STATS_PROJECTION).await?;
+        let head = DomainEventRepository::safe_head(pool).await?;
+
+        if head <= checkpoint {
+            return Ok(ProjectionRunResult {
+                last_event_id: checkpoint,
+                ..Default::default()
+            });
+        }
+
+        // First run, or events we never saw were pruned: start from scratch
+        let oldest = DomainEventRepository::oldest_id(pool).await?;
+        if checkpoint == 0 || oldest.is_some_and(|oldest| oldest > checkpoint + 1) {
+            return Self::rebuild(pool).await;
+        }
+
+        let events = DomainEventRepository::find_after(pool, checkpoint, head, BATCH_SIZE).await?;
+        let last_event_id = if events.len() as i64 == BATCH_SIZE {
+            events.last().map(|e| e.id).unwrap_or(head)
+        } else {
+            head
+        };
+
+        let user_ids: Vec<Uuid> = events
+            .iter()
+            .map(|e| e.user_id)
+            .collect::<HashSet<_>>()
+            .into_iter()
+            .collect();
+
+        // Players who left count towards their old alliance until refreshed
+        let mut alliance_ids: HashSet<Uuid> = events
+            .iter()
+            .filter(|e| e.entity_type == ENTITY_ALLIANCE || e.entity_type == ENTITY_ALLIANCE_MEMBER)
+            .map(|e| e.entity_id)
+            .collect();
+        alliance_ids.extend(ProjectionRepository::alliances_of_players(pool, &user_ids).await?);
+
+        let players_refreshed =
+            ProjectionRepository::refresh_player_stats(pool, Some(&user_ids)).await?;
+
+        alliance_ids.extend(ProjectionRepository::alliances_of_players(pool, &user_ids).await?);
+        let alliance_ids: Vec<Uuid> = alliance_ids.into_iter().collect();
+        let alliances_refreshed =
+            ProjectionRepository::refresh_alliance_stats(pool, Some(&alliance_ids)).await?;
+
+        if !events.is_empty() {
+            ProjectionRepository::rebuild_rankings(pool).await?;
+            CacheService::invalidate(&[CacheKey::TopRankings]).await;
+        }
+
+        ProjectionRepository::set_checkpoint(pool, STATS_PROJECTION, last_event_id).await?;
+
+        Ok(ProjectionRunResult {
+            events_applied: events.len(),
+            players_refreshed,
+            alliances_refreshed,
+            last_event_id,
+        })
+    }
+
+    /// Recompute every read model from the source tables
+    pub async fn rebuild(pool: &PgPool) -> AppResult<ProjectionRunResult> {
+        // Taken first: anything committed later is replayed on the next run
+        let head = DomainEventRepository::safe_head(pool).await?;
+
+        let players_refreshed = ProjectionRepository::refresh_player_stats(pool, None).await?;
+        let alliances_refreshed = ProjectionRepository::refresh_alliance_stats(pool, None).await?;
+        ProjectionRepository::rebuild_rankings(pool).await?;
+        CacheService::invalidate(&[CacheKey::TopRankings]).await;
+
+        ProjectionRepository::set_checkpoint(pool, STATS_PROJECTION, head).await?;
+
+        Ok(ProjectionRunResult {
+            events_applied: 0,
+            players_refreshed,
+            alliances_refreshed,
+            last_event_id: head,
+        })
+    }
+
+    // ==================== Queries ====================
+
+    pub async fn player_rankings(
+        pool: &PgPool,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<RankedPlayer>> {
+        let limit = limit.clamp(1, 100);
+        let offset = offset.max(0);
+
+        let players = ProjectionRepository::list_player_rankings(pool, limit, offset).await?;
+
+        Ok(players
+            .into_iter()
+            .enumerate()
+            .map(|(i, stats)| RankedPlayer {
+                rank: offset + i as i64 + 1,
+                stats,
+            })
+            .collect())
+    }
+
+    pub async fn alliance_rankings(
+        pool: &PgPool,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<RankedAlliance>> {
+        let limit = limit.clamp(1, 100);
+        let offset = offset.max(0);
+
+        let alliances = ProjectionRepository::list_alliance_rankings(pool, limit, offset).await?;
+
+        Ok(alliances
+            .into_iter()
+            .enumerate()
+            .map(|(i, stats)| RankedAlliance {
+                rank: offset + i as i64 + 1,
+                stats,
+            })
+            .collect())
+    }
+
+    /// World top-10s keyed by category
+    pub async fn world_rankings(pool: &PgPool) -> AppResult<BTreeMap<String, Vec<WorldRanking>>> {
+        let mut by_category: BTreeMap<String, Vec<WorldRanking>> = RANKING_CATEGORIES
+            .iter()
+            .map(|c| (c.to_string(), Vec::new()))
+            .collect();
+        for ranking in ProjectionRepository::list_world_rankings(pool).await? {
+            by_category
+                .entry(ranking.category.clone())
+                .or_default()
+                .push(ranking);
+        }
+
+        Ok(by_category)
+    }
+
+    pub async fn player_stats(pool: &PgPool, user_id: Uuid) -> AppResult<Option<PlayerStats>> {
+        ProjectionRepository::find_player_stats(pool, user_id).await
+    }
+}
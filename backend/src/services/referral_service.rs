@@ -0,0 +1,223 @@
+use chrono::Duration;
+use rand::Rng;
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::referral::{
+    ReferralProgress, ReferralStatsResponse, ReferralStatus, MAX_REFERRALS_PER_DAY,
+    REFERRAL_CODE_LENGTH, REFERRAL_MILESTONES,
+};
+use crate::models::shop::{TransactionStatus, TransactionType};
+use crate::repositories::activity_repo::ActivityRepository;
+use crate::repositories::referral_repo::ReferralRepository;
+use crate::repositories::shop_repo::ShopRepository;
+use crate::services::clock;
+
+/// Referrals checked for milestones per job run
+const MILESTONE_BATCH: i64 = 500;
+
+/// Codes avoid 0/O and 1/I so they can be read out loud
+const CODE_ALPHABET: &[u8] = b"ABCDEFGHJKLMNPQRSTUVWXYZ23456789";
+
+/// Why a referral was rejected
+const REJECT_SHARED_IP: &str = "shared_ip";
+const REJECT_DAILY_LIMIT: &str = "daily_limit";
+
+/// Referral codes, attribution on registration and milestone rewards
+pub struct ReferralService;
+
+impl ReferralService {
+    /// The player's code, created the first time it is asked for
+    pub async fn code(pool: &PgPool, user_id: Uuid) -> AppResult<String> {
+        if let Some(code) = ReferralRepository::find_code(pool, user_id).await? {
+            return Ok(code);
+        }
+
+        for _ in 0..5 {
+            let code = generate_code();
+            if ReferralRepository::create_code(pool, user_id, &code).await? {
+                return Ok(code);
+            }
+            // Lost a race with another request for the same player
+            if let Some(code) = ReferralRepository::find_code(pool, user_id).await? {
+                return Ok(code);
+            }
+        }
+
+        Err(AppError::InternalError(anyhow::anyhow!(
+            "Could not generate a unique referral code"
+        )))
+    }
+
+    pub async fn stats(pool: &PgPool, user_id: Uuid) -> AppResult<ReferralStatsResponse> {
+        let code = Self::code(pool, user_id).await?;
+        let referrals = ReferralRepository::list_for_referrer(pool, user_id).await?;
+
+        let count = |status| referrals.iter().filter(|r| r.status == status).count() as i64;
+
+        Ok(ReferralStatsResponse {
+            link: format!("/?ref={}", code),
+            code,
+            invited: referrals.len() as i64,
+            active: count(ReferralStatus::Active),
+            completed: count(ReferralStatus::Completed),
+            rejected: count(ReferralStatus::Rejected),
+            gold_earned: referrals.iter().map(|r| r.gold_earned as i64).sum(),
+            milestones: REFERRAL_MILESTONES.to_vec(),
+            referrals,
+        })
+    }
+
+    /// Credit a newly registered player to the owner of `code`. Unknown
+    /// codes are ignored so a bad link never blocks registration. Referrals
+    /// that look like one person with two accounts are kept, but rejected.
+    pub async fn attribute(
+        pool: &PgPool,
+        referee_id: Uuid,
+        code: &str,
+        client_ip: Option<&str>,
+    ) -> AppResult<()> {
+        let code = code.trim().to_uppercase();
+        let Some(referrer_id) = ReferralRepository::find_code_owner(pool, &code).await? else {
+            return Ok(());
+        };
+        if referrer_id == referee_id {
+            return Ok(());
+        }
+
+        let since = clock::now() - Duration::days(1);
+        let reason = if ReferralRepository::count_since(pool, referrer_id, since).await?
+            >= MAX_REFERRALS_PER_DAY
+        {
+            Some(REJECT_DAILY_LIMIT)
+        } else if let Some(ip) = client_ip {
+            ActivityRepository::has_login_from(pool, referrer_id, ip)
+                .await?
+                .then_some(REJECT_SHARED_IP)
+        } else {
+            None
+        };
+
+        let status = match reason {
+            Some(_) => ReferralStatus::Rejected,
+            None => ReferralStatus::Active,
+        };
+        ReferralRepository::create(pool, referrer_id, referee_id, status, reason).await?;
+
+        match reason {
+            Some(reason) => warn!(
+                "Referral of {} by {} rejected: {}",
+                referee_id, referrer_id, reason
+            ),
+            None => info!("Player {} was referred by {}", referee_id, referrer_id),
+        }
+
+        Ok(())
+    }
+
+    /// Pay out milestones the referees have reached. Returns how many
+    /// milestones were paid.
+    pub async fn process_milestones(pool: &PgPool) -> AppResult<i32> {
+        let referrals = ReferralRepository::find_active(pool, MILESTONE_BATCH).await?;
+
+        let mut paid = 0;
+        for referral in referrals {
+            paid += Self::process(pool, &referral).await?;
+        }
+
+        Ok(paid)
+    }
+
+    async fn process(pool: &PgPool, referral: &ReferralProgress) -> AppResult<i32> {
+        let now = clock::now();
+        let from = referral.milestones_reached;
+        let reached = REFERRAL_MILESTONES
+            .iter()
+            .take_while(|m| referral.population >= m.population)
+            .count() as i32;
+
+        if reached <= from {
+            ReferralRepository::touch(pool, referral.id, now).await?;
+            return Ok(0);
+        }
+
+        // Both accounts may have started sharing a machine since registration
+        if ActivityRepository::shares_login_ip(pool, referral.referrer_id, referral.referee_id)
+            .await?
+        {
+            ReferralRepository::reject(pool, referral.id, REJECT_SHARED_IP, now).await?;
+            warn!(
+                "Referral of {} by {} rejected before payout: {}",
+                referral.referee_id, referral.referrer_id, REJECT_SHARED_IP
+            );
+            return Ok(0);
+        }
+
+        let milestones = &REFERRAL_MILESTONES[from as usize..reached as usize];
+        let referrer_gold: i32 = milestones.iter().map(|m| m.referrer_gold).sum();
+        let referee_gold: i32 = milestones.iter().map(|m| m.referee_gold).sum();
+        let completed = reached as usize == REFERRAL_MILESTONES.len();
+
+        // Claim the milestones first so a concurrent run can't pay them again
+        if !ReferralRepository::advance(
+            pool,
+            referral.id,
+            from,
+            reached,
+            referrer_gold,
+            completed,
+            now,
+        )
+        .await?
+        {
+            return Ok(0);
+        }
+
+        Self::grant(pool, referral.referrer_id, referrer_gold, "Referral reward").await?;
+        Self::grant(
+            pool,
+            referral.referee_id,
+            referee_gold,
+            "Referral welcome reward",
+        )
+        .await?;
+
+        info!(
+            "Referral {} reached milestone {}: {} gold to referrer, {} to referee",
+            referral.id, reached, referrer_gold, referee_gold
+        );
+
+        Ok(reached - from)
+    }
+
+    async fn grant(pool: &PgPool, user_id: Uuid, gold: i32, description: &str) -> AppResult<()> {
+        if gold <= 0 {
+            return Ok(());
+        }
+        ShopRepository::add_gold(pool, user_id, gold).await?;
+        let tx = ShopRepository::create_transaction(
+            pool,
+            user_id,
+            TransactionType::GoldGift,
+            gold,
+            None,
+            None,
+            None,
+            None,
+            Some(description),
+        )
+        .await?;
+        ShopRepository::update_transaction_status(pool, tx.id, TransactionStatus::Completed, None)
+            .await?;
+        Ok(())
+    }
+}
+
+fn generate_code() -> String {
+    let mut rng = rand::thread_rng();
+    (0..REFERRAL_CODE_LENGTH)
+        .map(|_| CODE_ALPHABET[rng.gen_range(0..CODE_ALPHABET.len())] as char)
+        .collect()
+}
@@ -0,0 +1,319 @@
+use std::collections::HashMap;
+
+use chrono::{DateTime, Duration, Utc};
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::region::{
+    region_bounds, region_of, RegionControl, RegionLeaderboard, RegionOverview, RegionResponse,
+    RegionRunResult,
+};
+use crate::models::village::Village;
+use crate::models::world_setting::{
+    RegionControlSettings, UpdateRegionControlRequest, REGION_CONTROL_KEY,
+};
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::region_repo::RegionRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+
+/// Alliances shown on the victory point leaderboard
+const LEADERBOARD_SIZE: i64 = 50;
+
+/// Most regions along an axis; beyond this they get too small to hold
+const MAX_REGIONS_PER_AXIS: i32 = 20;
+
+pub struct RegionService;
+
+impl RegionService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<RegionControlSettings> {
+        let key = CacheKey::WorldSetting(REGION_CONTROL_KEY.to_string());
+        let stored = CacheService::get_or_load(key, || {
+            WorldSettingRepository::get(pool, REGION_CONTROL_KEY)
+        })
+        .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid region control setting, using defaults: {}", e);
+                RegionControlSettings::default()
+            }),
+            None => RegionControlSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateRegionControlRequest,
+    ) -> AppResult<RegionControlSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+        let previous_grid = settings.regions_per_axis;
+
+        if let Some(enabled) = request.enabled {
+            settings.enabled = enabled;
+        }
+        if let Some(regions) = request.regions_per_axis {
+            settings.regions_per_axis = regions;
+        }
+        if let Some(percent) = request.majority_percent {
+            settings.majority_percent = percent;
+        }
+        if let Some(hours) = request.hold_hours {
+            settings.hold_hours = hours;
+        }
+        if let Some(points) = request.points_per_hour {
+            settings.points_per_hour = points;
+        }
+        if let Some(points) = request.victory_points {
+            settings.victory_points = points;
+        }
+        if let Some(percent) = request.production_bonus_percent {
+            settings.production_bonus_percent = percent;
+        }
+
+        if !(1..=MAX_REGIONS_PER_AXIS).contains(&settings.regions_per_axis) {
+            return Err(AppError::BadRequest(format!(
+                "regions_per_axis must be between 1 and {}",
+                MAX_REGIONS_PER_AXIS
+            )));
+        }
+        if !(1..=100).contains(&settings.majority_percent) {
+            return Err(AppError::BadRequest(
+                "majority_percent must be between 1 and 100".into(),
+            ));
+        }
+        if settings.hold_hours < 0 || settings.points_per_hour < 0 {
+            return Err(AppError::BadRequest(
+                "hold_hours and points_per_hour cannot be negative".into(),
+            ));
+        }
+        if settings.victory_points < 1 {
+            return Err(AppError::BadRequest(
+                "victory_points must be at least 1".into(),
+            ));
+        }
+        if !(0..=100).contains(&settings.production_bonus_percent) {
+            return Err(AppError::BadRequest(
+                "production_bonus_percent must be between 0 and 100".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, REGION_CONTROL_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(REGION_CONTROL_KEY.to_string())]).await;
+
+        // Region ids mean something else on a new grid
+        if settings.regions_per_axis != previous_grid {
+            RegionRepository::reset_control(pool).await?;
+        }
+
+        info!("Region control updated by {}: {:?}", admin_id, settings);
+
+        Ok(settings)
+    }
+
+    // ==================== Control Evaluation ====================
+
+    /// Work out who holds each region, pay out points for the time held
+    /// since the last run, and declare a winner once an alliance reaches
+    /// the target. Does nothing once the world is won.
+    pub async fn run(pool: &PgPool) -> AppResult<RegionRunResult> {
+        let settings = Self::get_settings(pool).await?;
+        let mut result = RegionRunResult::default();
+        if !settings.enabled || RegionRepository::winner(pool).await?.is_some() {
+            return Ok(result);
+        }
+
+        let now = clock::now();
+        let per_axis = settings.regions_per_axis;
+        let hold = Duration::hours(settings.hold_hours as i64);
+
+        // region -> (total population, population per alliance)
+        let mut populations: HashMap<i32, (i64, HashMap<Uuid, i64>)> = HashMap::new();
+        for row in RegionRepository::population_by_region(pool, per_axis).await? {
+            let entry = populations.entry(row.region_id).or_default();
+            entry.0 += row.population;
+            if let Some(alliance_id) = row.alliance_id {
+                *entry.1.entry(alliance_id).or_default() += row.population;
+            }
+        }
+
+        let mut controls: HashMap<i32, RegionControl> = RegionRepository::find_all_control(pool)
+            .await?
+            .into_iter()
+            .map(|c| (c.region_id, c))
+            .collect();
+
+        let mut earned: HashMap<Uuid, i64> = HashMap::new();
+
+        for region_id in 0..per_axis * per_axis {
+            let controller = populations.get(&region_id).and_then(|(total, alliances)| {
+                alliances
+                    .iter()
+                    .max_by_key(|(_, population)| **population)
+                    .filter(|(_, population)| {
+                        **population * 100 > *total * settings.majority_percent as i64
+                    })
+                    .map(|(alliance_id, _)| *alliance_id)
+            });
+
+            let mut control = controls.remove(&region_id).unwrap_or(RegionControl {
+                region_id,
+                alliance_id: None,
+                held_since: None,
+                scoring: false,
+                evaluated_at: now,
+            });
+
+            if control.alliance_id != controller {
+                // The old holder is paid up to the moment it lost the region
+                if let (Some(alliance_id), true) = (control.alliance_id, control.scoring) {
+                    let (points, _) = accrue(control.evaluated_at, now, settings.points_per_hour);
+                    *earned.entry(alliance_id).or_default() += points;
+                }
+                control.alliance_id = controller;
+                control.held_since = controller.map(|_| now);
+                control.scoring = false;
+                control.evaluated_at = now;
+                result.control_changes += 1;
+            } else if let (Some(alliance_id), Some(held_since)) =
+                (control.alliance_id, control.held_since)
+            {
+                let scoring_from = held_since + hold;
+                if now >= scoring_from {
+                    let from = if control.scoring {
+                        control.evaluated_at
+                    } else {
+                        scoring_from
+                    };
+                    let (points, paid_until) = accrue(from, now, settings.points_per_hour);
+                    *earned.entry(alliance_id).or_default() += points;
+                    control.scoring = true;
+                    control.evaluated_at = paid_until;
+                } else {
+                    control.evaluated_at = now;
+                }
+            } else {
+                control.evaluated_at = now;
+            }
+
+            RegionRepository::upsert_control(pool, &control).await?;
+            result.regions_evaluated += 1;
+        }
+
+        let mut leader: Option<(Uuid, i64)> = None;
+        for (alliance_id, points) in earned {
+            if points <= 0 {
+                continue;
+            }
+            let total = RegionRepository::add_points(pool, alliance_id, points).await?;
+            result.points_awarded += points;
+            if total >= settings.victory_points && leader.map_or(true, |(_, best)| total > best) {
+                leader = Some((alliance_id, total));
+            }
+        }
+
+        if let Some((alliance_id, points)) = leader {
+            if RegionRepository::record_winner(pool, alliance_id, points, now).await? {
+                info!(
+                    "Alliance {} won the world with {} victory points",
+                    alliance_id, points
+                );
+                result.winner = Some(alliance_id);
+            }
+        }
+
+        Ok(result)
+    }
+
+    // ==================== Bonus ====================
+
+    /// Production bonus percent for a village: the configured bonus if its
+    /// owner's alliance has a scoring hold on the village's region
+    pub async fn production_bonus(pool: &PgPool, village: &Village) -> AppResult<i32> {
+        let settings = Self::get_settings(pool).await?;
+        if !settings.enabled || settings.production_bonus_percent == 0 {
+            return Ok(0);
+        }
+        let Some(member) = AllianceRepository::get_user_alliance(pool, village.user_id).await?
+        else {
+            return Ok(0);
+        };
+
+        let region_id = region_of(village.x, village.y, settings.regions_per_axis);
+        if RegionRepository::is_scoring(pool, region_id, member.alliance_id).await? {
+            Ok(settings.production_bonus_percent)
+        } else {
+            Ok(0)
+        }
+    }
+
+    // ==================== Queries ====================
+
+    /// Every region with its bounds and holder
+    pub async fn overview(pool: &PgPool) -> AppResult<RegionOverview> {
+        let settings = Self::get_settings(pool).await?;
+        let per_axis = settings.regions_per_axis;
+
+        let controls: HashMap<i32, RegionControl> = RegionRepository::find_all_control(pool)
+            .await?
+            .into_iter()
+            .map(|c| (c.region_id, c))
+            .collect();
+
+        let regions = (0..per_axis * per_axis)
+            .map(|region_id| {
+                let (min_x, max_x, min_y, max_y) = region_bounds(region_id, per_axis);
+                let control = controls.get(&region_id);
+                RegionResponse {
+                    region_id,
+                    min_x,
+                    max_x,
+                    min_y,
+                    max_y,
+                    alliance_id: control.and_then(|c| c.alliance_id),
+                    held_since: control.and_then(|c| c.held_since),
+                    scoring: control.is_some_and(|c| c.scoring),
+                }
+            })
+            .collect();
+
+        Ok(RegionOverview {
+            enabled: settings.enabled,
+            regions_per_axis: per_axis,
+            hold_hours: settings.hold_hours,
+            victory_points: settings.victory_points,
+            production_bonus_percent: settings.production_bonus_percent,
+            regions,
+            winner: RegionRepository::winner(pool).await?,
+        })
+    }
+
+    pub async fn leaderboard(pool: &PgPool) -> AppResult<RegionLeaderboard> {
+        let settings = Self::get_settings(pool).await?;
+
+        Ok(RegionLeaderboard {
+            victory_points: settings.victory_points,
+            standings: RegionRepository::leaderboard(pool, LEADERBOARD_SIZE).await?,
+            winner: RegionRepository::winner(pool).await?,
+        })
+    }
+}
+
+/// Whole points earned between `from` and `now`, and the moment they are
+/// paid up to. The remainder carries over to the next run rather than
+/// being rounded away.
+fn accrue(from: DateTime<Utc>, now: DateTime<Utc>, per_hour: i64) -> (i64, DateTime<Utc>) {
+    if per_hour <= 0 || now <= from {
+        return (0, now.max(from));
+    }
+    let points = (now - from).num_seconds() * per_hour / 3600;
+    (points, from + Duration::seconds(points * 3600 / per_hour))
+}
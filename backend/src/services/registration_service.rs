@@ -0,0 +1,739 @@
+use std::collections::{HashMap, HashSet};
+
+use chrono::Duration;
+use rand::Rng;
+use sqlx::{PgConnection, PgPool};
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::building::Building;
+use crate::models::registration::{
+    CreateRegistrationGroupRequest, CreateRegistrationWaveRequest, GroupReservation,
+    PreRegisterRequest, PreRegistrationResponse, PreRegistrationStatus, QuadrantAvailability,
+    RegistrationOverview, RegistrationStatus, RegistrationWave, GROUP_CODE_LENGTH,
+    MAX_GROUP_NAME_LEN, MAX_GROUP_TAG_LEN, MAX_INVITE_HOURS, MAX_WAVE_SIZE,
+};
+use crate::models::village::{CreateVillage, FieldType, Quadrant, Village};
+use crate::models::world_setting::{
+    RegistrationSettings, UpdateRegistrationRequest, REGISTRATION_KEY,
+};
+use crate::repositories::registration_repo::RegistrationRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+use crate::services::placement_service::PlacementService;
+use crate::services::village_service::VillageService;
+
+/// Waves shown on the admin overview
+const OVERVIEW_WAVES: i64 = 50;
+
+/// No 0/O or 1/I, so codes survive being read out over voice chat
+const CODE_ALPHABET: &[u8] = b"ABCDEFGHJKLMNPQRSTUVWXYZ23456789";
+
+pub struct RegistrationService;
+
+impl RegistrationService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<RegistrationSettings> {
+        let key = CacheKey::WorldSetting(REGISTRATION_KEY.to_string());
+        let stored =
+            CacheService::get_or_load(key, || WorldSettingRepository::get(pool, REGISTRATION_KEY))
+                .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid registration setting, using defaults: {}", e);
+                RegistrationSettings::default()
+            }),
+            None => RegistrationSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateRegistrationRequest,
+    ) -> AppResult<RegistrationSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(gated) = request.gated {
+            settings.gated = gated;
+        }
+        if let Some(caps) = request.quadrant_caps {
+            settings.quadrant_caps = caps;
+        }
+        if let Some(hours) = request.invite_hours {
+            settings.invite_hours = hours;
+        }
+        if let Some(slots) = request.max_group_slots {
+            settings.max_group_slots = slots;
+        }
+
+        if settings.quadrant_caps.values().any(|&cap| cap < 0) {
+            return Err(AppError::BadRequest(
+                "Quadrant caps cannot be negative".into(),
+            ));
+        }
+        if !(1..=MAX_INVITE_HOURS).contains(&settings.invite_hours) {
+            return Err(AppError::BadRequest(format!(
+                "invite_hours must be between 1 and {}",
+                MAX_INVITE_HOURS
+            )));
+        }
+        if settings.max_group_slots < 1 {
+            return Err(AppError::BadRequest(
+                "max_group_slots must be at least 1".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, REGISTRATION_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(REGISTRATION_KEY.to_string())]).await;
+
+        info!(
+            "Registration settings updated by {}: {:?}",
+            admin_id, settings
+        );
+
+        Ok(settings)
+    }
+
+    // ==================== Lobby ====================
+
+    /// The queue, quadrant room and the player's own place in line
+    pub async fn status(pool: &PgPool, user_id: Uuid) -> AppResult<RegistrationStatus> {
+        let settings = Self::get_settings(pool).await?;
+        let now = clock::now();
+
+        let registration = match RegistrationRepository::find_by_user(pool, user_id).await? {
+            Some(registration) => {
+                let position = if registration.status == PreRegistrationStatus::Queued {
+                    Some(
+                        RegistrationRepository::queue_position(pool, registration.created_at)
+                            .await?,
+                    )
+                } else {
+                    None
+                };
+                let group = match registration.group_id {
+                    Some(id) => RegistrationRepository::find_group(pool, id).await?,
+                    None => None,
+                };
+                Some(PreRegistrationResponse {
+                    registration,
+                    position,
+                    group,
+                })
+            }
+            None => None,
+        };
+
+        let queued = Self::count(pool, PreRegistrationStatus::Queued).await?;
+        let reservations = RegistrationRepository::find_reservations(pool).await?;
+
+        Ok(RegistrationStatus {
+            gated: settings.gated,
+            queued,
+            next_wave_at: RegistrationRepository::next_wave_at(pool, now).await?,
+            quadrants: Self::quadrants(&mut *pool.acquire().await?, &settings, &reservations)
+                .await?,
+            registration,
+        })
+    }
+
+    /// Join the queue, or change where a queued player starts. Players
+    /// whose invite ran out go to the back of the line.
+    pub async fn pre_register(
+        pool: &PgPool,
+        user_id: Uuid,
+        request: PreRegisterRequest,
+    ) -> AppResult<RegistrationStatus> {
+        let settings = Self::get_settings(pool).await?;
+        let now = clock::now();
+        Self::check_not_playing(pool, user_id).await?;
+
+        let existing = RegistrationRepository::find_by_user(pool, user_id).await?;
+        if let Some(registration) = &existing {
+            if registration.is_invited(now) {
+                return Err(AppError::BadRequest(
+                    "You already have an invite; found your village to join".into(),
+                ));
+            }
+            // A leader stays with their group until they disband it
+            if let Some(group_id) = registration.group_id {
+                if let Some(group) = RegistrationRepository::find_group(pool, group_id).await? {
+                    let code = request.group_code.as_deref().map(normalize_code);
+                    if group.leader_id == user_id && code.as_deref() != Some(group.code.as_str()) {
+                        return Err(AppError::BadRequest(
+                            "You lead a registration group; leave the queue to disband it".into(),
+                        ));
+                    }
+                }
+            }
+        }
+
+        let group = match request.group_code.as_deref().map(normalize_code) {
+            Some(code) => {
+                let group = RegistrationRepository::find_group_by_code(pool, &code)
+                    .await?
+                    .ok_or_else(|| {
+                        AppError::NotFound("No registration group with that code".into())
+                    })?;
+                let already_in = existing
+                    .as_ref()
+                    .is_some_and(|registration| registration.group_id == Some(group.id));
+                if !already_in && group.members >= group.slots as i64 {
+                    return Err(AppError::Conflict("That group has no places left".into()));
+                }
+                Some(group)
+            }
+            None => None,
+        };
+
+        // Members of a group start where the group does
+        let quadrant = group
+            .as_ref()
+            .map(|group| group.quadrant)
+            .or(request.quadrant);
+        if let Some(quadrant) = quadrant {
+            if settings.quadrant_caps.get(&quadrant) == Some(&0) {
+                return Err(AppError::BadRequest("That quadrant is closed".into()));
+            }
+        }
+        let group_id = group.as_ref().map(|group| group.id);
+
+        match existing {
+            Some(registration) if registration.status == PreRegistrationStatus::Queued => {
+                RegistrationRepository::set_choice(pool, registration.id, quadrant, group_id)
+                    .await?;
+            }
+            _ => RegistrationRepository::enqueue(pool, user_id, quadrant, group_id).await?,
+        }
+
+        Self::status(pool, user_id).await
+    }
+
+    /// Start a group with places held for it in one quadrant. The leader
+    /// registers with it, keeping their place if already queued.
+    pub async fn create_group(
+        pool: &PgPool,
+        user_id: Uuid,
+        request: CreateRegistrationGroupRequest,
+    ) -> AppResult<RegistrationStatus> {
+        let settings = Self::get_settings(pool).await?;
+        let now = clock::now();
+        Self::check_not_playing(pool, user_id).await?;
+
+        let name = request.name.trim();
+        let tag = request.tag.trim();
+        if name.is_empty() || name.chars().count() > MAX_GROUP_NAME_LEN {
+            return Err(AppError::ValidationError(format!(
+                "Group name must be 1 to {} characters",
+                MAX_GROUP_NAME_LEN
+            )));
+        }
+        if tag.is_empty() || tag.chars().count() > MAX_GROUP_TAG_LEN {
+            return Err(AppError::ValidationError(format!(
+                "Group tag must be 1 to {} characters",
+                MAX_GROUP_TAG_LEN
+            )));
+        }
+        if !(1..=settings.max_group_slots).contains(&request.slots) {
+            return Err(AppError::BadRequest(format!(
+                "A group may reserve 1 to {} places",
+                settings.max_group_slots
+            )));
+        }
+
+        // Counting the quadrant's room and holding places in it go
+        // through together
+        let mut tx = pool.begin().await?;
+        RegistrationRepository::lock(&mut tx).await?;
+
+        let existing = RegistrationRepository::find_by_user(&mut *tx, user_id).await?;
+        if let Some(registration) = &existing {
+            if registration.is_invited(now) {
+                return Err(AppError::BadRequest(
+                    "You already have an invite; found your village to join".into(),
+                ));
+            }
+            if registration.group_id.is_some() {
+                return Err(AppError::BadRequest(
+                    "You already registered with a group".into(),
+                ));
+            }
+        }
+
+        let reservations = RegistrationRepository::find_reservations(&mut *tx).await?;
+        let quadrants = Self::quadrants(&mut tx, &settings, &reservations).await?;
+        let free = quadrants
+            .iter()
+            .find(|availability| availability.quadrant == request.quadrant)
+            .and_then(|availability| availability.free);
+        if let Some(free) = free {
+            if (request.slots as i64) > free {
+                return Err(AppError::Conflict(format!(
+                    "Only {} places are left in that quadrant",
+                    free
+                )));
+            }
+        }
+
+        let group_id = RegistrationRepository::create_group(
+            &mut *tx,
+            name,
+            tag,
+            &generate_code(),
+            user_id,
+            request.quadrant,
+            request.slots,
+        )
+        .await?;
+
+        match existing {
+            Some(registration) if registration.status == PreRegistrationStatus::Queued => {
+                RegistrationRepository::set_choice(
+                    &mut *tx,
+                    registration.id,
+                    Some(request.quadrant),
+                    Some(group_id),
+                )
+                .await?;
+            }
+            _ => {
+                RegistrationRepository::enqueue(
+                    &mut *tx,
+                    user_id,
+                    Some(request.quadrant),
+                    Some(group_id),
+                )
+                .await?
+            }
+        }
+        tx.commit().await?;
+
+        info!(
+            "Registration group {} [{}] created by {} with {} places",
+            name, tag, user_id, request.slots
+        );
+
+        Self::status(pool, user_id).await
+    }
+
+    /// Leave the queue or give up an invite. A leader leaving disbands
+    /// their group; its members stay queued on their own.
+    pub async fn leave(pool: &PgPool, user_id: Uuid) -> AppResult<()> {
+        let registration = RegistrationRepository::find_by_user(pool, user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("You are not pre-registered".into()))?;
+        if registration.status == PreRegistrationStatus::Joined {
+            return Err(AppError::BadRequest(
+                "You have already joined the world".into(),
+            ));
+        }
+
+        if let Some(group_id) = registration.group_id {
+            if let Some(group) = RegistrationRepository::find_group(pool, group_id).await? {
+                if group.leader_id == user_id {
+                    RegistrationRepository::delete_group(pool, group.id).await?;
+                    info!("Registration group {} disbanded by its leader", group.id);
+                }
+            }
+        }
+
+        RegistrationRepository::delete(pool, registration.id).await
+    }
+
+    // ==================== Joining ====================
+
+    /// Found the player's first village where the placement service puts
+    /// it. Admission, the village and the move to joined commit together
+    /// under the registration lock, so a quadrant's last place goes to one
+    /// player only.
+    pub async fn found_capital(
+        pool: &PgPool,
+        user_id: Uuid,
+        name: String,
+        requested: Option<Quadrant>,
+    ) -> AppResult<(Village, Vec<Building>)> {
+        let settings = Self::get_settings(pool).await?;
+
+        let mut tx = pool.begin().await?;
+        RegistrationRepository::lock(&mut tx).await?;
+
+        let quadrant = Self::admit(&mut tx, &settings, user_id, requested).await?;
+        // Founders before us have committed, so the map shows their villages
+        let (x, y) = PlacementService::place(pool, user_id, quadrant).await?;
+        let created = VillageService::create_village_in(
+            &mut tx,
+            CreateVillage {
+                user_id,
+                name,
+                x,
+                y,
+                is_capital: true,
+                field_type: FieldType::at(x, y),
+            },
+        )
+        .await?;
+        RegistrationRepository::mark_joined(&mut *tx, user_id, clock::now()).await?;
+
+        tx.commit().await?;
+
+        Ok(created)
+    }
+
+    /// Whether the player may found their first village, and the quadrant
+    /// it goes in. An invite pinned to a quadrant settles both. Otherwise
+    /// the world has to be open, or the player invited, and the quadrant
+    /// under its cap. Call under the registration lock.
+    async fn admit(
+        conn: &mut PgConnection,
+        settings: &RegistrationSettings,
+        user_id: Uuid,
+        requested: Option<Quadrant>,
+    ) -> AppResult<Option<Quadrant>> {
+        let now = clock::now();
+
+        let registration = RegistrationRepository::find_by_user(&mut *conn, user_id).await?;
+        let invite = registration.as_ref().filter(|r| r.is_invited(now));
+        if let Some(invite) = invite {
+            // A pinned invite's place was counted when it went out. One
+            // sent while the world had no caps holds no place, so it is
+            // checked against any caps set since like everyone else.
+            if let Some(quadrant) = invite.quadrant {
+                return Ok(Some(quadrant));
+            }
+        } else if settings.gated {
+            let message = match registration.as_ref().map(|r| r.status) {
+                Some(PreRegistrationStatus::Queued) => {
+                    "You are still in the queue; you can found your village once an invite \
+                     wave reaches you"
+                }
+                Some(PreRegistrationStatus::Invited) | Some(PreRegistrationStatus::Expired) => {
+                    "Your invite has expired; pre-register again to rejoin the queue"
+                }
+                _ => "This world opens in invite waves; pre-register to join the queue",
+            };
+            return Err(AppError::Forbidden(message.into()));
+        }
+
+        if settings.quadrant_caps.is_empty() {
+            return Ok(requested);
+        }
+
+        let reservations = RegistrationRepository::find_reservations(&mut *conn).await?;
+        let quadrants = Self::quadrants(conn, settings, &reservations).await?;
+        match requested {
+            Some(quadrant) => {
+                let full = quadrants
+                    .iter()
+                    .any(|q| q.quadrant == quadrant && q.free == Some(0));
+                if full {
+                    return Err(AppError::Conflict(
+                        "That quadrant is full; pick another".into(),
+                    ));
+                }
+                Ok(Some(quadrant))
+            }
+            None => roomiest(&quadrants)
+                .map(Some)
+                .ok_or_else(|| AppError::Conflict("Every quadrant is full".into())),
+        }
+    }
+
+    // ==================== Waves ====================
+
+    pub async fn overview(pool: &PgPool) -> AppResult<RegistrationOverview> {
+        let settings = Self::get_settings(pool).await?;
+        let reservations = RegistrationRepository::find_reservations(pool).await?;
+        let counts: HashMap<PreRegistrationStatus, i64> =
+            RegistrationRepository::count_by_status(pool)
+                .await?
+                .into_iter()
+                .collect();
+        let count = |status| counts.get(&status).copied().unwrap_or(0);
+
+        Ok(RegistrationOverview {
+            quadrants: Self::quadrants(&mut *pool.acquire().await?, &settings, &reservations)
+                .await?,
+            queued: count(PreRegistrationStatus::Queued),
+            invited: count(PreRegistrationStatus::Invited),
+            joined: count(PreRegistrationStatus::Joined),
+            expired: count(PreRegistrationStatus::Expired),
+            waves: RegistrationRepository::find_waves(pool, OVERVIEW_WAVES).await?,
+            groups: RegistrationRepository::find_groups(pool).await?,
+            settings,
+        })
+    }
+
+    pub async fn schedule_wave(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: CreateRegistrationWaveRequest,
+    ) -> AppResult<RegistrationWave> {
+        if !(1..=MAX_WAVE_SIZE).contains(&request.size) {
+            return Err(AppError::BadRequest(format!(
+                "A wave may invite 1 to {} players",
+                MAX_WAVE_SIZE
+            )));
+        }
+        let scheduled_at = request.scheduled_at.unwrap_or_else(clock::now);
+
+        let wave =
+            RegistrationRepository::create_wave(pool, scheduled_at, request.size, admin_id).await?;
+
+        info!(
+            "Registration wave {} of {} scheduled for {} by {}",
+            wave.id, wave.size, wave.scheduled_at, admin_id
+        );
+
+        Ok(wave)
+    }
+
+    pub async fn cancel_wave(pool: &PgPool, id: Uuid) -> AppResult<RegistrationWave> {
+        if !RegistrationRepository::cancel_wave(pool, id).await? {
+            Self::find_wave(pool, id).await?;
+            return Err(AppError::BadRequest(
+                "Only a scheduled wave can be cancelled".into(),
+            ));
+        }
+
+        Self::find_wave(pool, id).await
+    }
+
+    /// Send a scheduled wave's invites now instead of at its time
+    pub async fn release_wave(pool: &PgPool, id: Uuid) -> AppResult<RegistrationWave> {
+        let wave = Self::find_wave(pool, id).await?;
+        if !Self::release(pool, &wave).await? {
+            return Err(AppError::BadRequest(
+                "Only a scheduled wave can be released".into(),
+            ));
+        }
+
+        Self::find_wave(pool, id).await
+    }
+
+    /// Release waves that are due and expire unused invites. Returns the
+    /// invites sent.
+    pub async fn process_due(pool: &PgPool) -> AppResult<u64> {
+        let now = clock::now();
+
+        let expired = RegistrationRepository::expire_invites(pool, now).await?;
+        if expired > 0 {
+            info!("Expired {} unused registration invites", expired);
+        }
+
+        let mut invited = 0;
+        for wave in RegistrationRepository::find_due_waves(pool, now).await? {
+            if Self::release(pool, &wave).await? {
+                if let Some(wave) = RegistrationRepository::find_wave(pool, wave.id).await? {
+                    invited += wave.invited as u64;
+                }
+            }
+        }
+
+        Ok(invited)
+    }
+
+    // ==================== Helpers ====================
+
+    /// Invite the front of the queue, up to the wave's size. Groups go in
+    /// whole and into places held for them; everyone else only where a
+    /// quadrant has room. False if the wave was not scheduled.
+    async fn release(pool: &PgPool, wave: &RegistrationWave) -> AppResult<bool> {
+        let settings = Self::get_settings(pool).await?;
+        let now = clock::now();
+
+        // Invites take places as founding does, so they count the room
+        // under the same lock
+        let mut tx = pool.begin().await?;
+        RegistrationRepository::lock(&mut tx).await?;
+        if !RegistrationRepository::claim_wave(&mut *tx, wave.id, now).await? {
+            return Ok(false);
+        }
+
+        let expires_at = now + Duration::hours(settings.invite_hours as i64);
+        let reservations = RegistrationRepository::find_reservations(&mut *tx).await?;
+        let mut quadrants: Vec<QuadrantAvailability> =
+            Self::quadrants(&mut tx, &settings, &reservations).await?;
+        let mut held: HashMap<Uuid, i64> =
+            reservations.iter().map(|r| (r.group_id, r.held)).collect();
+        let groups: HashMap<Uuid, Quadrant> = RegistrationRepository::find_groups(&mut *tx)
+            .await?
+            .into_iter()
+            .map(|group| (group.id, group.quadrant))
+            .collect();
+
+        let queue = RegistrationRepository::find_queued(&mut *tx).await?;
+        let mut seen_groups = HashSet::new();
+        let mut remaining = wave.size as i64;
+        let mut invited = 0i64;
+
+        for entry in &queue {
+            if remaining <= 0 {
+                break;
+            }
+
+            let group = entry
+                .group_id
+                .and_then(|id| groups.get(&id).map(|&quadrant| (id, quadrant)));
+            let (ids, quadrant, group_id) = match group {
+                Some((group_id, quadrant)) => {
+                    if !seen_groups.insert(group_id) {
+                        continue;
+                    }
+                    let ids: Vec<Uuid> = queue
+                        .iter()
+                        .filter(|e| e.group_id == Some(group_id))
+                        .map(|e| e.id)
+                        .collect();
+                    (ids, Some(quadrant), Some(group_id))
+                }
+                None => {
+                    let quadrant = match entry.quadrant {
+                        Some(quadrant) => Some(quadrant),
+                        None if settings.quadrant_caps.is_empty() => None,
+                        None => match roomiest(&quadrants) {
+                            Some(quadrant) => Some(quadrant),
+                            None => continue,
+                        },
+                    };
+                    (vec![entry.id], quadrant, None)
+                }
+            };
+
+            let count = ids.len() as i64;
+            // A group too big for what is left of the wave waits for the
+            // next one, unless nobody is in yet: it would never fit otherwise
+            if count > remaining && invited > 0 {
+                continue;
+            }
+            let from_reserved = group_id
+                .and_then(|id| held.get(&id).copied())
+                .unwrap_or(0)
+                .min(count);
+            let availability = match quadrant {
+                Some(quadrant) => quadrants.iter_mut().find(|q| q.quadrant == quadrant),
+                None => None,
+            };
+            if let Some(availability) = availability {
+                if availability
+                    .free
+                    .is_some_and(|free| free + from_reserved < count)
+                {
+                    continue;
+                }
+                availability.admit(count, from_reserved);
+            }
+
+            let sent =
+                RegistrationRepository::invite(&mut *tx, &ids, quadrant, wave.id, now, expires_at)
+                    .await? as i64;
+            if let Some(group_id) = group_id {
+                held.entry(group_id).and_modify(|h| *h -= from_reserved);
+            }
+            remaining -= sent;
+            invited += sent;
+        }
+
+        RegistrationRepository::set_invited(&mut *tx, wave.id, invited as i32).await?;
+        tx.commit().await?;
+
+        info!(
+            "Registration wave {} released: {} of {} invited, {} still queued",
+            wave.id,
+            invited,
+            wave.size,
+            queue.len() as i64 - invited
+        );
+
+        Ok(true)
+    }
+
+    /// Room in each quadrant, counting settled players, invites still out
+    /// and places groups hold
+    async fn quadrants(
+        conn: &mut PgConnection,
+        settings: &RegistrationSettings,
+        reservations: &[GroupReservation],
+    ) -> AppResult<Vec<QuadrantAvailability>> {
+        let now = clock::now();
+        let joined: HashMap<Quadrant, i64> =
+            VillageRepository::count_capitals_by_quadrant(&mut *conn)
+                .await?
+                .into_iter()
+                .collect();
+        let invited: HashMap<Quadrant, i64> =
+            RegistrationRepository::count_invited_by_quadrant(conn, now)
+                .await?
+                .into_iter()
+                .collect();
+        let mut reserved: HashMap<Quadrant, i64> = HashMap::new();
+        for reservation in reservations {
+            *reserved.entry(reservation.quadrant).or_default() += reservation.held;
+        }
+
+        Ok(Quadrant::ALL
+            .iter()
+            .map(|&quadrant| {
+                QuadrantAvailability::new(
+                    quadrant,
+                    settings.quadrant_caps.get(&quadrant).copied(),
+                    joined.get(&quadrant).copied().unwrap_or(0),
+                    invited.get(&quadrant).copied().unwrap_or(0),
+                    reserved.get(&quadrant).copied().unwrap_or(0),
+                )
+            })
+            .collect())
+    }
+
+    async fn count(pool: &PgPool, status: PreRegistrationStatus) -> AppResult<i64> {
+        let counts = RegistrationRepository::count_by_status(pool).await?;
+        Ok(counts
+            .into_iter()
+            .find(|(s, _)| *s == status)
+            .map_or(0, |(_, count)| count))
+    }
+
+    async fn check_not_playing(pool: &PgPool, user_id: Uuid) -> AppResult<()> {
+        if VillageRepository::count_by_user_id(pool, user_id).await? > 0 {
+            return Err(AppError::BadRequest(
+                "You are already playing in this world".into(),
+            ));
+        }
+        Ok(())
+    }
+
+    async fn find_wave(pool: &PgPool, id: Uuid) -> AppResult<RegistrationWave> {
+        RegistrationRepository::find_wave(pool, id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Registration wave not found".into()))
+    }
+}
+
+/// The quadrant with the most room, uncapped ones first. `None` when
+/// every quadrant is full.
+fn roomiest(quadrants: &[QuadrantAvailability]) -> Option<Quadrant> {
+    quadrants
+        .iter()
+        .filter(|q| q.free.map_or(true, |free| free > 0))
+        .max_by_key(|q| q.free.unwrap_or(i64::MAX))
+        .map(|q| q.quadrant)
+}
+
+/// Codes are shown upper case but typed any old way
+fn normalize_code(code: &str) -> String {
+    code.trim().to_uppercase()
+}
+
+fn generate_code() -> String {
+    let mut rng = rand::thread_rng();
+    (0..GROUP_CODE_LENGTH)
+        .map(|_| CODE_ALPHABET[rng.gen_range(0..CODE_ALPHABET.len())] as char)
+        .collect()
+}
@@ -0,0 +1,211 @@
+use chrono::{DateTime, Duration, Utc};
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::world_setting::{
+    ReportArchive, ReportRetentionSettings, RetentionRunResult, UpdateReportRetentionRequest,
+    REPORT_RETENTION_KEY,
+};
+use crate::repositories::report_repo::ReportRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::archive_store::ArchiveStore;
+
+/// Reports written to a single archive object
+const ARCHIVE_BATCH_SIZE: i64 = 5000;
+/// Upper bound on batches per run so one run can't hold the job forever
+const MAX_ARCHIVE_BATCHES: usize = 20;
+
+pub struct ReportRetentionService;
+
+impl ReportRetentionService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<ReportRetentionSettings> {
+        let key = CacheKey::WorldSetting(REPORT_RETENTION_KEY.to_string());
+        let stored =
+            CacheService::get_or_load(key, || WorldSettingRepository::get(pool, REPORT_RETENTION_KEY)).await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid report_retention setting, using defaults: {}", e);
+                ReportRetentionSettings::default()
+            }),
+            None => ReportRetentionSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateReportRetentionRequest,
+    ) -> AppResult<ReportRetentionSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(days) = request.unread_raid_days {
+            settings.unread_raid_days = days;
+        }
+        if let Some(days) = request.scout_report_days {
+            settings.scout_report_days = days;
+        }
+        if let Some(days) = request.archive_after_days {
+            settings.archive_after_days = days;
+        }
+        if let Some(enabled) = request.archive_enabled {
+            settings.archive_enabled = enabled;
+        }
+
+        if settings.unread_raid_days < 0 || settings.scout_report_days < 0 {
+            return Err(AppError::BadRequest(
+                "Retention days cannot be negative".into(),
+            ));
+        }
+        if settings.archive_after_days < 7 {
+            return Err(AppError::BadRequest(
+                "Reports must be kept at least 7 days before archiving".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, REPORT_RETENTION_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(REPORT_RETENTION_KEY.to_string())]).await;
+
+        info!("Report retention updated by {}: {:?}", admin_id, settings);
+
+        Ok(settings)
+    }
+
+    pub async fn list_archives(
+        pool: &PgPool,
+        limit: i64,
+        offset: i64,
+    ) -> AppResult<Vec<ReportArchive>> {
+        let limit = limit.min(100).max(1);
+        ReportRepository::list_archives(pool, limit, offset.max(0)).await
+    }
+
+    // ==================== Retention Run ====================
+
+    /// Apply the retention policy: prune reports, archive old battle reports,
+    /// and keep monthly partitions created ahead of time / dropped once empty
+    pub async fn run(pool: &PgPool, store: Option<&ArchiveStore>) -> AppResult<RetentionRunResult> {
+        let settings = Self::get_settings(pool).await?;
+        let now = Utc::now();
+        let mut result = RetentionRunResult::default();
+
+        // Partitions for this month and next, so inserts never land in the default partition
+        for at in [now, now + Duration::days(32)] {
+            let name = ReportRepository::ensure_partition(pool, at).await?;
+            result.partitions_ensured.push(name);
+        }
+
+        if settings.unread_raid_days > 0 {
+            let cutoff = now - Duration::days(settings.unread_raid_days as i64);
+            result.raids_deleted = ReportRepository::delete_unread_raids(pool, cutoff).await?;
+        }
+
+        if settings.scout_report_days > 0 {
+            let cutoff = now - Duration::days(settings.scout_report_days as i64);
+            result.scout_reports_deleted =
+                ReportRepository::delete_scout_reports(pool, cutoff).await?;
+        }
+
+        if settings.archive_enabled {
+            match store {
+                Some(store) => {
+                    let cutoff = now - Duration::days(settings.archive_after_days as i64);
+                    result.reports_archived = Self::archive_reports(pool, store, cutoff).await?;
+                    result.partitions_dropped =
+                        Self::drop_archived_partitions(pool, cutoff).await?;
+                }
+                None => warn!("Report archiving is enabled but ARCHIVE_STORAGE_URL is not set"),
+            }
+        }
+
+        Ok(result)
+    }
+
+    /// Move battle reports older than the cutoff to object storage as JSON lines
+    async fn archive_reports(
+        pool: &PgPool,
+        store: &ArchiveStore,
+        before: DateTime<Utc>,
+    ) -> AppResult<u64> {
+        let mut archived = 0u64;
+
+        for _ in 0..MAX_ARCHIVE_BATCHES {
+            let reports =
+                ReportRepository::find_reports_before(pool, before, ARCHIVE_BATCH_SIZE).await?;
+            let (Some(oldest), Some(newest)) = (reports.first(), reports.last()) else {
+                break;
+            };
+
+            let mut body = Vec::new();
+            for report in &reports {
+                serde_json::to_writer(&mut body, report).map_err(anyhow::Error::from)?;
+                body.push(b'\n');
+            }
+
+            let object_key = format!(
+                "battle_reports/{}/{}.jsonl",
+                oldest.occurred_at.format("%Y/%m/%d"),
+                Uuid::new_v4()
+            );
+            store.put(&object_key, body, "application/x-ndjson").await?;
+
+            // Record the object before deleting so rows are never lost without a pointer
+            ReportRepository::create_archive(
+                pool,
+                &object_key,
+                reports.len() as i32,
+                oldest.occurred_at,
+                newest.occurred_at,
+            )
+            .await?;
+
+            let ids: Vec<Uuid> = reports.iter().map(|r| r.id).collect();
+            archived += ReportRepository::delete_reports(pool, &ids, before).await?;
+
+            info!(
+                "Archived {} battle reports to {}",
+                reports.len(),
+                object_key
+            );
+
+            if (reports.len() as i64) < ARCHIVE_BATCH_SIZE {
+                break;
+            }
+        }
+
+        Ok(archived)
+    }
+
+    /// Drop monthly partitions that end before the cutoff and have been emptied
+    async fn drop_archived_partitions(
+        pool: &PgPool,
+        before: DateTime<Utc>,
+    ) -> AppResult<Vec<String>> {
+        let mut dropped = Vec::new();
+        let cutoff_month = before.format("%Y_%m").to_string();
+
+        for partition in ReportRepository::list_partitions(pool).await? {
+            // battle_reports_YYYY_MM sorts chronologically; keep the month the cutoff falls in
+            let Some(month) = partition.strip_prefix("battle_reports_") else {
+                continue;
+            };
+            if month >= cutoff_month.as_str() {
+                break;
+            }
+
+            if ReportRepository::drop_partition_if_empty(pool, &partition).await? {
+                info!("Dropped archived partition {}", partition);
+                dropped.push(partition);
+            }
+        }
+
+        Ok(dropped)
+    }
+}
@@ -0,0 +1,220 @@
+use std::collections::HashMap;
+
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult, ErrorCode};
+use crate::models::building::{BuildingPrerequisite, BuildingType};
+use crate::models::gamedata::definitions;
+use crate::models::research::{AcademyResponse, ResearchOption, ResearchQueueEntry};
+use crate::models::troop::TroopType;
+use crate::models::village::Village;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::research_repo::ResearchRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock;
+use crate::services::tribe_service::TribeService;
+
+/// The academy: units a village has to research before training them
+pub struct ResearchService;
+
+impl ResearchService {
+    /// What the village can train, what it is researching and what is
+    /// left to research for the player's tribe
+    pub async fn get_academy(pool: &PgPool, village: &Village) -> AppResult<AcademyResponse> {
+        let tribe = TribeService::player_tribe(pool, village.user_id).await?;
+        let done = ResearchRepository::find_researched(pool, village.id).await?;
+        let in_progress = ResearchRepository::find_in_progress(pool, village.id).await?;
+        let levels = Self::building_levels(pool, village.id).await?;
+
+        let mut researched = Vec::new();
+        let mut available = Vec::new();
+        for unit in &definitions().units {
+            if TribeService::check_can_train(tribe, unit.tribe).is_err() {
+                continue;
+            }
+            let Some(research) = &unit.research else {
+                researched.push(unit.troop_type);
+                continue;
+            };
+            if done.contains(&unit.troop_type) {
+                researched.push(unit.troop_type);
+                continue;
+            }
+            if in_progress
+                .as_ref()
+                .is_some_and(|r| r.troop_type == unit.troop_type)
+            {
+                continue;
+            }
+            available.push(ResearchOption {
+                troop_type: unit.troop_type,
+                cost: research.cost.clone(),
+                time_seconds: research.time_seconds,
+                requires: research.requires.clone(),
+                missing: missing(&research.requires, &levels),
+            });
+        }
+
+        Ok(AcademyResponse {
+            researched,
+            in_progress,
+            available,
+        })
+    }
+
+    /// Pay for a research and start it; the academy researches one unit
+    /// at a time
+    pub async fn start(
+        pool: &PgPool,
+        village: &Village,
+        troop_type: TroopType,
+    ) -> AppResult<ResearchQueueEntry> {
+        let definitions = definitions();
+        let unit = definitions
+            .unit(troop_type)
+            .ok_or_else(|| AppError::NotFound("Troop type not found".into()))?;
+
+        let tribe = TribeService::player_tribe(pool, village.user_id).await?;
+        TribeService::check_can_train(tribe, unit.tribe)?;
+
+        let Some(research) = &unit.research else {
+            return Err(AppError::BadRequest(format!(
+                "{:?} needs no research",
+                troop_type
+            )));
+        };
+        if ResearchRepository::is_researched(pool, village.id, troop_type).await? {
+            return Err(AppError::Conflict(format!(
+                "{:?} is already researched",
+                troop_type
+            )));
+        }
+        if ResearchRepository::find_in_progress(pool, village.id)
+            .await?
+            .is_some()
+        {
+            return Err(AppError::Game(
+                ErrorCode::QueueFull,
+                "The academy is already researching".into(),
+            ));
+        }
+
+        let levels = Self::building_levels(pool, village.id).await?;
+        let missing = missing(&research.requires, &levels);
+        if !missing.is_empty() {
+            let msg = missing
+                .iter()
+                .map(|m| format!("{:?} Lv.{}", m.building_type, m.min_level))
+                .collect::<Vec<_>>()
+                .join(", ");
+            return Err(AppError::BadRequest(format!(
+                "Missing prerequisites: {}",
+                msg
+            )));
+        }
+
+        let cost = &research.cost;
+        if village.wood < cost.wood
+            || village.clay < cost.clay
+            || village.iron < cost.iron
+            || village.crop < cost.crop
+        {
+            return Err(ErrorCode::InsufficientResources.into());
+        }
+
+        // Deduct resources, failing if the village changed since it was read
+        VillageRepository::deduct_resources_versioned(
+            pool,
+            village.id,
+            village.version,
+            cost.wood,
+            cost.clay,
+            cost.iron,
+            cost.crop,
+        )
+        .await?;
+
+        let now = clock::now();
+        let ends_at = now + Duration::seconds(research.time_seconds as i64);
+        let Some(entry) =
+            ResearchRepository::start(pool, village.id, troop_type, now, ends_at).await?
+        else {
+            // Another request started a research in between
+            VillageRepository::add_resources(
+                pool, village.id, cost.wood, cost.clay, cost.iron, cost.crop,
+            )
+            .await?;
+            return Err(AppError::Game(
+                ErrorCode::QueueFull,
+                "The academy is already researching".into(),
+            ));
+        };
+
+        info!(
+            "Village {} started researching {:?}, done at {}",
+            village.id, troop_type, ends_at
+        );
+
+        Ok(entry)
+    }
+
+    /// Refuse to train units the village hasn't researched
+    pub async fn check_researched(
+        pool: &PgPool,
+        village_id: Uuid,
+        troop_type: TroopType,
+    ) -> AppResult<()> {
+        let needs_research = definitions()
+            .unit(troop_type)
+            .is_some_and(|u| u.research.is_some());
+        if needs_research
+            && !ResearchRepository::is_researched(pool, village_id, troop_type).await?
+        {
+            return Err(AppError::BadRequest(format!(
+                "{:?} must be researched in the academy first",
+                troop_type
+            )));
+        }
+        Ok(())
+    }
+
+    /// Finish a research; None if it was already finished
+    pub async fn complete(pool: &PgPool, id: Uuid) -> AppResult<Option<ResearchQueueEntry>> {
+        let entry = ResearchRepository::complete(pool, id).await?;
+        if let Some(entry) = &entry {
+            info!(
+                "Village {} researched {:?}",
+                entry.village_id, entry.troop_type
+            );
+        }
+        Ok(entry)
+    }
+
+    /// Highest level of each building type in the village
+    async fn building_levels(
+        pool: &PgPool,
+        village_id: Uuid,
+    ) -> AppResult<HashMap<BuildingType, i32>> {
+        let mut levels = HashMap::new();
+        for building in BuildingRepository::find_by_village_id(pool, village_id).await? {
+            let level = levels.entry(building.building_type).or_insert(0);
+            *level = building.level.max(*level);
+        }
+        Ok(levels)
+    }
+}
+
+/// Requirements above the village's building levels
+fn missing(
+    requires: &[BuildingPrerequisite],
+    levels: &HashMap<BuildingType, i32>,
+) -> Vec<BuildingPrerequisite> {
+    requires
+        .iter()
+        .filter(|r| levels.get(&r.building_type).copied().unwrap_or(0) < r.min_level)
+        .cloned()
+        .collect()
+}
@@ -1,12 +1,19 @@
-use chrono::Utc;
+use async_trait::async_trait;
+use chrono::{DateTime, Utc};
 use sqlx::PgPool;
 use uuid::Uuid;
 
 use crate::error::AppResult;
 use crate::models::building::BuildingType;
-use crate::models::village::Village;
+use crate::models::village::{ProductionBreakdown, ProductionShare, StorageOverflow, Village};
 use crate::repositories::building_repo::BuildingRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock;
+use crate::services::hero_service::HeroService;
+use crate::services::oasis_service::OasisService;
+use crate::services::region_service::RegionService;
+use crate::services::tribe_service::TribeService;
+use crate::services::ws_service::{StorageFullData, WsEvent, WsManager};
 
 pub struct ResourceService;
 
@@ -18,6 +25,7 @@ pub struct ProductionRates {
     pub crop_per_hour: i32,
     pub crop_consumption: i32,  // Population eats crop
     pub net_crop_per_hour: i32, // crop_per_hour - crop_consumption
+    pub breakdown: ProductionBreakdown,
 }
 
 impl ResourceService {
@@ -32,10 +40,14 @@ impl ResourceService {
 
         let buildings = BuildingRepository::find_by_village_id(pool, village_id).await?;
 
-        let mut wood_per_hour = 3; // Base production
-        let mut clay_per_hour = 3;
-        let mut iron_per_hour = 3;
-        let mut crop_per_hour = 3;
+        // Base production
+        let mut total = ProductionShare {
+            wood: 3,
+            clay: 3,
+            iron: 3,
+            crop: 3,
+        };
+        let mut upkeep_saving = 0;
 
         for building in buildings {
             if building.level == 0 {
@@ -45,42 +57,111 @@ impl ResourceService {
             let production = building.building_type.production_per_hour(building.level);
 
             match building.building_type {
-                BuildingType::Woodcutter => wood_per_hour += production,
-                BuildingType::ClayPit => clay_per_hour += production,
-                BuildingType::IronMine => iron_per_hour += production,
-                BuildingType::CropField => crop_per_hour += production,
+                BuildingType::Woodcutter => total.wood += production,
+                BuildingType::ClayPit => total.clay += production,
+                BuildingType::IronMine => total.iron += production,
+                BuildingType::CropField => total.crop += production,
+                BuildingType::ElephantTrough => {
+                    upkeep_saving = building.building_type.tribe_bonus_percent(building.level)
+                }
                 _ => {}
             }
         }
 
-        // Population consumes crop (1 crop per population per hour)
-        let crop_consumption = village.population;
-        let net_crop_per_hour = crop_per_hour - crop_consumption;
+        let fields = total;
+
+        // Occupied oases add a percentage on top
+        let oasis_bonus = OasisService::production_bonus(pool, village_id).await?;
+        let oases = total.percent(
+            oasis_bonus.wood,
+            oasis_bonus.clay,
+            oasis_bonus.iron,
+            oasis_bonus.crop,
+        );
+        total.add(oases);
+
+        // So does the owner's tribe
+        let tribe_bonus = TribeService::bonus(pool, village.user_id).await?;
+        let tribe = total.percent(
+            tribe_bonus.wood,
+            tribe_bonus.clay,
+            tribe_bonus.iron,
+            tribe_bonus.crop,
+        );
+        total.add(tribe);
+
+        // And holding the region, on region control worlds
+        let region_bonus = RegionService::production_bonus(pool, &village).await?;
+        let region = total.percent(region_bonus, region_bonus, region_bonus, region_bonus);
+        total.add(region);
+
+        // Heroes living here add a flat amount from their resource points
+        let hero_bonus = HeroService::production_bonus(pool, village_id).await?;
+        let hero = ProductionShare {
+            wood: hero_bonus.wood,
+            clay: hero_bonus.clay,
+            iron: hero_bonus.iron,
+            crop: hero_bonus.crop,
+        };
+        total.add(hero);
+
+        // Population consumes crop (1 crop per population per hour), less
+        // whatever an elephant trough saves
+        let crop_consumption = village.population - village.population * upkeep_saving / 100;
+        let net_crop_per_hour = total.crop - crop_consumption;
 
         Ok(ProductionRates {
-            wood_per_hour,
-            clay_per_hour,
-            iron_per_hour,
-            crop_per_hour,
+            wood_per_hour: total.wood,
+            clay_per_hour: total.clay,
+            iron_per_hour: total.iron,
+            crop_per_hour: total.crop,
             crop_consumption,
             net_crop_per_hour,
+            breakdown: ProductionBreakdown {
+                fields,
+                oasis_bonus,
+                oases,
+                tribe,
+                region,
+                hero,
+            },
         })
     }
 
     /// Update resources for a village based on time elapsed
     pub async fn update_village_resources(pool: &PgPool, village_id: Uuid) -> AppResult<Village> {
-        let village = VillageRepository::find_by_id(pool, village_id)
+        Self::settle(pool, village_id, clock::now()).await
+    }
+
+    /// Pay out production up to `until` at the village's current rates and
+    /// storage. Call it before changing either, so time before the change
+    /// is counted under the old capacity and the new one only applies after.
+    pub async fn settle(
+        ledger: &dyn VillageLedger,
+        village_id: Uuid,
+        until: DateTime<Utc>,
+    ) -> AppResult<Village> {
+        let village = ledger
+            .find(village_id)
             .await?
             .ok_or_else(|| crate::error::AppError::NotFound("Village not found".to_string()))?;
 
-        let now = Utc::now();
-        let elapsed_seconds = (now - village.resources_updated_at).num_seconds();
+        Self::accrue(ledger, village, until).await
+    }
+
+    async fn accrue(
+        ledger: &dyn VillageLedger,
+        village: Village,
+        until: DateTime<Utc>,
+    ) -> AppResult<Village> {
+        let village_id = village.id;
+        let elapsed_seconds = (until - village.resources_updated_at).num_seconds();
 
         if elapsed_seconds <= 0 {
             return Ok(village);
         }
 
-        let production = Self::calculate_production(pool, village_id).await?;
+        let production = ledger.production(&village).await?;
 
         // Calculate resources produced
         let hours_elapsed = elapsed_seconds as f64 / 3600.0;
@@ -98,33 +179,97 @@ impl ResourceService {
         let new_crop = (village.crop + crop_change).min(village.granary_capacity).max(0);
 
         // Update village resources
-        let updated =
-            VillageRepository::update_resources(pool, village_id, new_wood, new_clay, new_iron, new_crop)
-                .await?;
+        let updated = ledger
+            .store_resources(village_id, new_wood, new_clay, new_iron, new_crop, until)
+            .await?;
 
         Ok(updated)
     }
 
-    /// Update resources for all villages (for background job)
-    pub async fn update_all_village_resources(pool: &PgPool) -> AppResult<i32> {
+    /// Update resources for all villages (for background job). Owners are
+    /// told when one of their stores fills up.
+    pub async fn update_all_village_resources(
+        pool: &PgPool,
+        ws_manager: &WsManager,
+    ) -> AppResult<i32> {
         // Get all villages that need updating (not updated in last minute)
         let villages: Vec<(Uuid,)> = sqlx::query_as(
             r#"
             SELECT id FROM villages
-            WHERE resources_updated_at < NOW() - INTERVAL '1 minute'
+            WHERE resources_updated_at < $1 - INTERVAL '1 minute'
             "#,
         )
+        .bind(clock::now())
         .fetch_all(pool)
         .await?;
 
         let mut updated_count = 0;
 
         for (village_id,) in villages {
-            if let Ok(_) = Self::update_village_resources(pool, village_id).await {
+            let Ok(Some(village)) = VillageRepository::find_by_id(pool, village_id).await else {
+                continue;
+            };
+            let before = StorageOverflow::of(&village);
+
+            if let Ok(updated) = Self::accrue(pool, village, clock::now()).await {
                 updated_count += 1;
+
+                let resources = StorageOverflow::of(&updated).newly_full(&before);
+                if !resources.is_empty() {
+                    let event = WsEvent::StorageFull(StorageFullData {
+                        village_id,
+                        resources,
+                    });
+                    ws_manager.send_to_user(updated.user_id, &event).await;
+                }
             }
         }
 
         Ok(updated_count)
     }
 }
+
+/// Villages' stores as `ResourceService` pays production into them:
+/// Postgres in the server, memory in unit tests (see
+/// `testing::InMemoryVillages`)
+#[async_trait]
+pub trait VillageLedger: Send + Sync {
+    async fn find(&self, village_id: Uuid) -> AppResult<Option<Village>>;
+
+    /// The village's production rates as they stand
+    async fn production(&self, village: &Village) -> AppResult<ProductionRates>;
+
+    /// Store the village's resources as of `at`
+    async fn store_resources(
+        &self,
+        village_id: Uuid,
+        wood: i32,
+        clay: i32,
+        iron: i32,
+        crop: i32,
+        at: DateTime<Utc>,
+    ) -> AppResult<Village>;
+}
+
+#[async_trait]
+impl VillageLedger for PgPool {
+    async fn find(&self, village_id: Uuid) -> AppResult<Option<Village>> {
+        VillageRepository::find_by_id(self, village_id).await
+    }
+
+    async fn production(&self, village: &Village) -> AppResult<ProductionRates> {
+        ResourceService::calculate_production(self, village.id).await
+    }
+
+    async fn store_resources(
+        &self,
+        village_id: Uuid,
+        wood: i32,
+        clay: i32,
+        iron: i32,
+        crop: i32,
+        at: DateTime<Utc>,
+    ) -> AppResult<Village> {
+        VillageRepository::update_resources(self, village_id, wood, clay, iron, crop, at).await
+    }
+}
@@ -0,0 +1,115 @@
+use sqlx::PgPool;
+use std::sync::{Arc, LazyLock, OnceLock, RwLock};
+use tracing::{info, warn};
+use tracing_subscriber::EnvFilter;
+use uuid::Uuid;
+
+use crate::config::Config;
+use crate::db::query_metrics;
+use crate::error::{AppError, AppResult};
+use crate::models::world_setting::{RuntimeSettings, RUNTIME_CONFIG_KEY};
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+
+static CURRENT: LazyLock<RwLock<Arc<RuntimeSettings>>> =
+    LazyLock::new(|| RwLock::new(Arc::new(RuntimeSettings::default())));
+
+type LogReloader = Box<dyn Fn(&str) -> anyhow::Result<()> + Send + Sync>;
+
+/// Boot-time log filter and the hook that swaps the active one
+static LOG_RELOADER: OnceLock<(String, LogReloader)> = OnceLock::new();
+
+/// The runtime settings in effect on this instance
+pub fn current() -> Arc<RuntimeSettings> {
+    CURRENT.read().unwrap().clone()
+}
+
+/// Called once at startup with the log filter from RUST_LOG and a way to
+/// replace it
+pub fn set_log_reloader(
+    default_filter: String,
+    reload: impl Fn(&str) -> anyhow::Result<()> + Send + Sync + 'static,
+) {
+    let _ = LOG_RELOADER.set((default_filter, Box::new(reload)));
+}
+
+pub struct RuntimeConfigService;
+
+impl RuntimeConfigService {
+    pub async fn get_settings(pool: &PgPool) -> AppResult<RuntimeSettings> {
+        let key = CacheKey::WorldSetting(RUNTIME_CONFIG_KEY.to_string());
+        let stored =
+            CacheService::get_or_load(key, || WorldSettingRepository::get(pool, RUNTIME_CONFIG_KEY)).await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid runtime_config setting, using defaults: {}", e);
+                RuntimeSettings::default()
+            }),
+            None => RuntimeSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    /// Store new settings and apply them here; other instances pick them up
+    /// on their next poll
+    pub async fn update_settings(
+        pool: &PgPool,
+        config: &Config,
+        admin_id: Uuid,
+        settings: RuntimeSettings,
+    ) -> AppResult<RuntimeSettings> {
+        if let Some(filter) = &settings.log_filter {
+            EnvFilter::try_new(filter)
+                .map_err(|e| AppError::BadRequest(format!("Invalid log_filter: {}", e)))?;
+        }
+        if settings.slow_query_ms == Some(0) {
+            return Err(AppError::BadRequest(
+                "slow_query_ms must be positive".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, RUNTIME_CONFIG_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(RUNTIME_CONFIG_KEY.to_string())]).await;
+
+        info!("Runtime config updated by {}: {:?}", admin_id, settings);
+        Self::apply(settings.clone(), config);
+
+        Ok(settings)
+    }
+
+    /// Load the stored settings and apply them if they changed. Returns
+    /// whether anything changed.
+    pub async fn refresh(pool: &PgPool, config: &Config) -> AppResult<bool> {
+        let settings = Self::get_settings(pool).await?;
+        if *current() == settings {
+            return Ok(false);
+        }
+
+        Self::apply(settings, config);
+        Ok(true)
+    }
+
+    fn apply(settings: RuntimeSettings, config: &Config) {
+        let previous = current();
+
+        if settings.log_filter != previous.log_filter {
+            if let Some((default_filter, reload)) = LOG_RELOADER.get() {
+                let filter = settings.log_filter.as_deref().unwrap_or(default_filter);
+                match reload(filter) {
+                    Ok(()) => info!("Log filter set to {}", filter),
+                    Err(e) => warn!("Could not apply log filter {}: {:#}", filter, e),
+                }
+            }
+        }
+
+        query_metrics::set_slow_query_threshold_ms(
+            settings
+                .slow_query_ms
+                .unwrap_or(config.database.slow_query_ms),
+        );
+
+        *CURRENT.write().unwrap() = Arc::new(settings);
+    }
+}
@@ -0,0 +1,107 @@
+use chrono::{DateTime, Utc};
+use sqlx::PgPool;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::search::{
+    MessageSearchQuery, MessageSearchResult, ReportSearchQuery, ReportSearchResult,
+};
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::search_repo::SearchRepository;
+
+pub struct SearchService;
+
+impl SearchService {
+    /// Full-text search over the user's messages (private and current alliance)
+    pub async fn search_messages(
+        pool: &PgPool,
+        language: &str,
+        user_id: Uuid,
+        query: MessageSearchQuery,
+    ) -> AppResult<Vec<MessageSearchResult>> {
+        let q = Self::validate_query(&query.q)?;
+        Self::validate_range(query.from, query.to)?;
+
+        let alliance_id = AllianceRepository::get_user_alliance(pool, user_id)
+            .await?
+            .map(|m| m.alliance_id);
+
+        let limit = query.limit.min(50).max(1);
+        let offset = query.offset.max(0);
+
+        SearchRepository::search_messages(
+            pool,
+            language,
+            user_id,
+            alliance_id,
+            q,
+            query.sender_id,
+            query.from,
+            query.to,
+            limit,
+            offset,
+        )
+        .await
+    }
+
+    /// Full-text search over battle reports the user took part in
+    pub async fn search_reports(
+        pool: &PgPool,
+        language: &str,
+        user_id: Uuid,
+        query: ReportSearchQuery,
+    ) -> AppResult<Vec<ReportSearchResult>> {
+        let q = Self::validate_query(&query.q)?;
+        Self::validate_range(query.from, query.to)?;
+
+        let limit = query.limit.min(50).max(1);
+        let offset = query.offset.max(0);
+
+        SearchRepository::search_reports(
+            pool, language, user_id, q, query.from, query.to, limit, offset,
+        )
+        .await
+    }
+
+    /// Make `language` the text search configuration the vectors are built
+    /// with, rebuilding the stored ones if it changed. Run at startup.
+    pub async fn apply_language(pool: &PgPool, language: &str) -> AppResult<()> {
+        let mut tx = pool.begin().await?;
+        let current = SearchRepository::language_for_update(&mut tx).await?;
+        if current == language {
+            return Ok(());
+        }
+
+        let rebuilt = SearchRepository::set_language(&mut tx, language).await?;
+        tx.commit().await?;
+
+        info!(
+            "Search language changed from {} to {}; {} search vectors rebuilt",
+            current, language, rebuilt
+        );
+        Ok(())
+    }
+
+    fn validate_query(q: &str) -> AppResult<&str> {
+        let q = q.trim();
+        if q.is_empty() {
+            return Err(AppError::BadRequest("Search query cannot be empty".into()));
+        }
+        if q.len() > 200 {
+            return Err(AppError::BadRequest(
+                "Search query cannot exceed 200 characters".into(),
+            ));
+        }
+        Ok(q)
+    }
+
+    fn validate_range(from: Option<DateTime<Utc>>, to: Option<DateTime<Utc>>) -> AppResult<()> {
+        if let (Some(from), Some(to)) = (from, to) {
+            if from >= to {
+                return Err(AppError::BadRequest("'from' must be before 'to'".into()));
+            }
+        }
+        Ok(())
+    }
+}
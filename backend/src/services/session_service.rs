@@ -0,0 +1,140 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use std::collections::HashMap;
+use std::sync::{LazyLock, Mutex};
+use std::time::Instant;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::middleware::auth::AuthenticatedUser;
+use crate::models::activity::RequestOrigin;
+use crate::models::session::{
+    SessionResponse, REVOKED_RETENTION_DAYS, SESSION_CHECK_SECS, SESSION_IDLE_DAYS,
+};
+use crate::repositories::session_repo::SessionRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::clock;
+
+/// When each session was last checked against the database on this instance
+static CHECKED: LazyLock<Mutex<HashMap<String, Instant>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Sessions remembered before stale ones are swept
+const MAX_TRACKED_SESSIONS: usize = 100_000;
+
+/// Signed-in devices per account, with remote logout and idle expiry
+pub struct SessionService;
+
+impl SessionService {
+    /// Refuse requests from revoked or idle sessions and record use of the
+    /// rest. Checks the database at most once a minute per session; tokens
+    /// without a session (dev header identities) and players who haven't
+    /// registered yet pass untracked.
+    pub async fn track(
+        pool: &PgPool,
+        user: &AuthenticatedUser,
+        origin: &RequestOrigin,
+    ) -> AppResult<()> {
+        let Some(session_key) = &user.session_id else {
+            return Ok(());
+        };
+        if recently_checked(session_key) {
+            return Ok(());
+        }
+
+        let now = clock::now();
+        if let Some(session) = SessionRepository::find_by_key(pool, session_key).await? {
+            if session.revoked_at.is_some() {
+                return Err(AppError::Unauthorized);
+            }
+            if session.last_seen_at < now - Duration::days(SESSION_IDLE_DAYS) {
+                SessionRepository::revoke_by_key(pool, session_key, now).await?;
+                return Err(AppError::Unauthorized);
+            }
+        }
+
+        let Some(db_user) = UserRepository::find_by_firebase_uid(pool, &user.firebase_uid).await?
+        else {
+            return Ok(());
+        };
+        SessionRepository::touch(pool, db_user.id, session_key, origin, now).await?;
+        mark_checked(session_key);
+
+        Ok(())
+    }
+
+    /// The player's devices, the requesting one marked as current
+    pub async fn list(
+        pool: &PgPool,
+        user_id: Uuid,
+        current_key: Option<&str>,
+    ) -> AppResult<Vec<SessionResponse>> {
+        let sessions = SessionRepository::list_for_user(pool, user_id).await?;
+        Ok(sessions
+            .into_iter()
+            .map(|s| SessionResponse::new(s, current_key))
+            .collect())
+    }
+
+    /// Log one of the player's devices out
+    pub async fn revoke(
+        pool: &PgPool,
+        user_id: Uuid,
+        session_id: Uuid,
+        current_key: Option<&str>,
+    ) -> AppResult<SessionResponse> {
+        let session = SessionRepository::revoke(pool, session_id, user_id, clock::now())
+            .await?
+            .ok_or_else(|| AppError::NotFound("No active session with this id".into()))?;
+        forget(&session.session_key);
+
+        info!("Player {} logged out session {}", user_id, session_id);
+
+        Ok(SessionResponse::new(session, current_key))
+    }
+
+    /// Log the requesting session out
+    pub async fn logout(pool: &PgPool, user: &AuthenticatedUser) -> AppResult<()> {
+        if let Some(session_key) = &user.session_id {
+            SessionRepository::revoke_by_key(pool, session_key, clock::now()).await?;
+            forget(session_key);
+        }
+        Ok(())
+    }
+
+    /// Log out idle sessions and drop long-revoked ones. Returns how many
+    /// were logged out.
+    pub async fn expire_idle(pool: &PgPool) -> AppResult<u64> {
+        let now = clock::now();
+        let expired =
+            SessionRepository::expire_idle(pool, now - Duration::days(SESSION_IDLE_DAYS), now)
+                .await?;
+        SessionRepository::delete_revoked_before(
+            pool,
+            now - Duration::days(REVOKED_RETENTION_DAYS),
+        )
+        .await?;
+        Ok(expired)
+    }
+}
+
+fn recently_checked(session_key: &str) -> bool {
+    CHECKED
+        .lock()
+        .unwrap()
+        .get(session_key)
+        .is_some_and(|at| at.elapsed().as_secs() < SESSION_CHECK_SECS)
+}
+
+fn mark_checked(session_key: &str) {
+    let mut checked = CHECKED.lock().unwrap();
+    if checked.len() >= MAX_TRACKED_SESSIONS {
+        checked.retain(|_, at| at.elapsed().as_secs() < SESSION_CHECK_SECS);
+    }
+    checked.insert(session_key.to_string(), Instant::now());
+}
+
+fn forget(session_key: &str) {
+    CHECKED.lock().unwrap().remove(session_key);
+}
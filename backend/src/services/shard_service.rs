@@ -0,0 +1,129 @@
+use sqlx::PgPool;
+use tracing::{error, info};
+
+use crate::db::shard::{self, ShardResolver};
+use crate::error::{AppError, AppResult};
+use crate::models::world_shard::{
+    UpsertWorldShardRequest, WorldShard, WorldShardResponse, DEFAULT_WORLD,
+};
+use crate::repositories::world_shard_repo::WorldShardRepository;
+
+pub struct ShardService;
+
+impl ShardService {
+    /// Reload the world directory into the resolver. Returns whether it
+    /// changed.
+    pub async fn refresh(pool: &PgPool, shards: &ShardResolver) -> AppResult<bool> {
+        let directory = WorldShardRepository::list(pool).await?;
+        Ok(shards.set_directory(directory))
+    }
+
+    pub async fn list(pool: &PgPool, shards: &ShardResolver) -> AppResult<Vec<WorldShardResponse>> {
+        let directory = WorldShardRepository::list(pool).await?;
+
+        let mut responses = Vec::with_capacity(directory.len());
+        for shard in directory {
+            responses.push(Self::response(shards, shard).await);
+        }
+
+        Ok(responses)
+    }
+
+    /// Point a world at a shard and migrate it. Moving a world's existing
+    /// data is an operator task; this only changes where it is looked up.
+    pub async fn register(
+        pool: &PgPool,
+        shards: &ShardResolver,
+        world_id: &str,
+        request: UpsertWorldShardRequest,
+    ) -> AppResult<WorldShardResponse> {
+        validate(world_id, &request)?;
+
+        let shard = WorldShardRepository::upsert(pool, world_id, &request).await?;
+        Self::refresh(pool, shards).await?;
+        info!("World {} assigned to shard {:?}", world_id, request);
+
+        let migrations_applied = shards.migrate(world_id).await?;
+        Ok(WorldShardResponse {
+            shard,
+            migrations_applied,
+        })
+    }
+
+    pub async fn migrate(
+        pool: &PgPool,
+        shards: &ShardResolver,
+        world_id: &str,
+    ) -> AppResult<WorldShardResponse> {
+        let shard = WorldShardRepository::find(pool, world_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound(format!("World {} is not sharded", world_id)))?;
+        Self::refresh(pool, shards).await?;
+
+        let migrations_applied = shards.migrate(world_id).await?;
+        Ok(WorldShardResponse {
+            shard,
+            migrations_applied,
+        })
+    }
+
+    /// Migrate every shard, continuing past failures so one unreachable
+    /// shard doesn't block the rest
+    pub async fn migrate_all(shards: &ShardResolver) -> usize {
+        let mut failed = 0;
+        for world_id in shards.sharded_worlds() {
+            if let Err(e) = shards.migrate(&world_id).await {
+                error!("Shard migration failed for world {}: {:#}", world_id, e);
+                failed += 1;
+            }
+        }
+        failed
+    }
+
+    async fn response(shards: &ShardResolver, shard: WorldShard) -> WorldShardResponse {
+        let migrations_applied = shards.migration_count(&shard.world_id).await.unwrap_or(0);
+        WorldShardResponse {
+            shard,
+            migrations_applied,
+        }
+    }
+}
+
+fn validate(world_id: &str, request: &UpsertWorldShardRequest) -> AppResult<()> {
+    if world_id == DEFAULT_WORLD {
+        return Err(AppError::BadRequest(
+            "The default world always lives on the primary".into(),
+        ));
+    }
+    if world_id.is_empty()
+        || world_id.len() > 50
+        || !world_id
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+    {
+        return Err(AppError::BadRequest(
+            "world_id must be 1-50 letters, digits, '-' or '_'".into(),
+        ));
+    }
+    if let Some(schema) = &request.schema_name {
+        if !shard::is_identifier(schema) {
+            return Err(AppError::BadRequest(
+                "schema_name must be a lowercase identifier".into(),
+            ));
+        }
+    }
+    if let Some(port) = request.port {
+        if !(1..=65535).contains(&port) {
+            return Err(AppError::BadRequest(
+                "port must be between 1 and 65535".into(),
+            ));
+        }
+    }
+    if request.host.is_none() && request.database_name.is_none() && request.schema_name.is_none() {
+        return Err(AppError::BadRequest(
+            "A shard needs a host, database_name or schema_name".into(),
+        ));
+    }
+
+    Ok(())
+}
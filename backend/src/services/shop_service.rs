@@ -9,15 +9,22 @@ use stripe_rust::{
 };
 use uuid::Uuid;
 
-use crate::error::{AppError, AppResult};
+use crate::error::{AppError, AppResult, ErrorCode};
 use crate::models::shop::{
-    CheckoutResponse, GoldBalanceResponse, GoldFeature, GoldPackage, SubscriptionPrice,
-    SubscriptionType, TransactionResponse, TransactionStatus, TransactionType, UseFeatureResponse,
+    finish_now_cost, CheckoutResponse, FinishNowQuote, FinishTarget, GoldBalanceResponse,
+    GoldFeature, GoldPackage, SubscriptionPrice, SubscriptionType, TransactionResponse,
+    TransactionStatus, TransactionType, UseFeatureResponse,
 };
+use crate::models::troop::TroopQueue;
 use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::research_repo::ResearchRepository;
 use crate::repositories::shop_repo::ShopRepository;
 use crate::repositories::troop_repo::TroopRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::activity_service::ActivityService;
+use crate::services::building_service::BuildingService;
+use crate::services::clock;
+use crate::services::research_service::ResearchService;
 
 pub struct ShopService;
 
@@ -298,7 +305,7 @@ impl ShopService {
         // Check gold balance
         let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
         if balance < price.gold_cost {
-            return Err(AppError::BadRequest("Insufficient gold".into()));
+            return Err(ErrorCode::InsufficientGold.into());
         }
 
         // Deduct gold
@@ -331,7 +338,7 @@ impl ShopService {
         .await?;
 
         // Record gold usage
-        ShopRepository::record_gold_usage(
+        let usage = ShopRepository::record_gold_usage(
             pool,
             user_id,
             GoldFeature::PlusSubscription,
@@ -345,6 +352,7 @@ impl ShopService {
             Some(subscription.expires_at),
         )
         .await?;
+        ActivityService::record_gold_spent(pool, &usage);
 
         Ok(UseFeatureResponse {
             success: true,
@@ -359,110 +367,172 @@ impl ShopService {
 
     // ==================== Gold Features ====================
 
-    /// Use "Finish Now" to instantly complete a building or training
+    /// Price of finishing a building, training or research now
+    pub async fn finish_now_quote(
+        pool: &PgPool,
+        user_id: Uuid,
+        target_type: FinishTarget,
+        target_id: Uuid,
+    ) -> AppResult<FinishNowQuote> {
+        let (quote, _) = Self::finish_now_target(pool, user_id, target_type, target_id).await?;
+        Ok(quote)
+    }
+
+    /// Use "Finish Now" to instantly complete a building, training or research.
+    /// Jobs nearly done finish for free.
     pub async fn use_finish_now(
         pool: &PgPool,
         user_id: Uuid,
-        target_type: &str,
+        target_type: FinishTarget,
         target_id: Uuid,
     ) -> AppResult<UseFeatureResponse> {
-        // Calculate cost based on remaining time
-        let (remaining_seconds, village_id) = match target_type {
-            "building" => {
-                let building = BuildingRepository::find_by_id(pool, target_id)
-                    .await?
-                    .ok_or_else(|| AppError::NotFound("Building not found".into()))?;
-
-                if !building.is_upgrading {
-                    return Err(AppError::BadRequest("Building is not upgrading".into()));
-                }
-
-                let remaining = building
-                    .upgrade_ends_at
-                    .map(|ends| (ends - Utc::now()).num_seconds().max(0) as i32)
-                    .unwrap_or(0);
-
-                (remaining, building.village_id)
+        let (quote, troop_queue) =
+            Self::finish_now_target(pool, user_id, target_type, target_id).await?;
+        let gold_cost = quote.gold_cost;
+
+        let new_balance = if gold_cost > 0 {
+            // Check gold balance
+            let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
+            if balance < gold_cost {
+                return Err(ErrorCode::InsufficientGold.into());
             }
-            "troop_queue" => {
-                let queue = TroopRepository::find_queue_by_id(pool, target_id)
-                    .await?
-                    .ok_or_else(|| AppError::NotFound("Training queue not found".into()))?;
-
-                let remaining = (queue.ends_at - Utc::now()).num_seconds().max(0) as i32;
 
-                (remaining, queue.village_id)
-            }
-            _ => return Err(AppError::BadRequest("Invalid target type".into())),
+            // Deduct gold
+            ShopRepository::deduct_gold(pool, user_id, gold_cost).await?
+        } else {
+            ShopRepository::get_gold_balance(pool, user_id).await?
         };
 
-        // Verify ownership
-        let village = VillageRepository::find_by_id(pool, village_id)
-            .await?
-            .ok_or_else(|| AppError::NotFound("Village not found".into()))?;
-
-        if village.user_id != user_id {
-            return Err(AppError::Forbidden("Access denied".into()));
-        }
-
-        // Calculate gold cost: 1 gold per 5 minutes (300 seconds), minimum 1 gold
-        let gold_cost = ((remaining_seconds as f64 / 300.0).ceil() as i32).max(1);
-
-        // Check gold balance
-        let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
-        if balance < gold_cost {
-            return Err(AppError::BadRequest("Insufficient gold".into()));
-        }
-
-        // Deduct gold
-        let new_balance = ShopRepository::deduct_gold(pool, user_id, gold_cost).await?;
-
-        // Complete the target instantly
-        match target_type {
-            "building" => {
-                BuildingRepository::complete_upgrade(pool, target_id).await?;
+        // Complete the target instantly; gold comes back if it finished
+        // some other way in the meantime
+        let completed = match (target_type, troop_queue) {
+            (FinishTarget::TroopQueue, Some(queue)) => {
+                match TroopRepository::complete_training(pool, &queue).await {
+                    Ok(true) => Ok(()),
+                    Ok(false) => Err(AppError::Conflict("Training already completed".into())),
+                    Err(e) => Err(e),
+                }
             }
-            "troop_queue" => {
-                TroopRepository::complete_training(pool, target_id).await?;
+            (FinishTarget::Research, _) => match ResearchService::complete(pool, target_id).await {
+                Ok(Some(_)) => Ok(()),
+                Ok(None) => Err(AppError::Conflict("Research already completed".into())),
+                Err(e) => Err(e),
+            },
+            _ => BuildingService::complete_upgrade(pool, target_id).await.map(|_| ()),
+        };
+        if let Err(e) = completed {
+            if gold_cost > 0 {
+                ShopRepository::add_gold(pool, user_id, gold_cost).await?;
             }
-            _ => {}
+            return Err(e);
         }
 
         // Record transaction
-        ShopRepository::create_transaction(
-            pool,
-            user_id,
-            TransactionType::GoldSpend,
-            -gold_cost,
-            None,
-            None,
-            None,
-            None,
-            Some(&format!("Finish Now - {}", target_type)),
-        )
-        .await?;
+        if gold_cost > 0 {
+            ShopRepository::create_transaction(
+                pool,
+                user_id,
+                TransactionType::GoldSpend,
+                -gold_cost,
+                None,
+                None,
+                None,
+                None,
+                Some(&format!("Finish Now - {}", target_type.as_str())),
+            )
+            .await?;
+        }
 
-        // Record usage
-        ShopRepository::record_gold_usage(
+        // Record usage, free finishes included
+        let usage = ShopRepository::record_gold_usage(
             pool,
             user_id,
             GoldFeature::FinishNow,
             gold_cost,
-            Some(target_type),
+            Some(target_type.as_str()),
             Some(target_id),
-            Some(serde_json::json!({ "saved_seconds": remaining_seconds })),
+            Some(serde_json::json!({
+                "saved_seconds": quote.remaining_seconds,
+                "free": quote.free,
+            })),
             None,
         )
         .await?;
+        if gold_cost > 0 {
+            ActivityService::record_gold_spent(pool, &usage);
+        }
 
         Ok(UseFeatureResponse {
             success: true,
             gold_spent: gold_cost,
             new_balance,
-            message: format!("{} completed instantly!", target_type),
+            message: format!("{} completed instantly!", target_type.as_str()),
         })
     }
 
+    /// Load a job the player owns and price it from the time left on the
+    /// server's clock. Training queues are returned so they can be claimed
+    /// at the version that was priced.
+    async fn finish_now_target(
+        pool: &PgPool,
+        user_id: Uuid,
+        target_type: FinishTarget,
+        target_id: Uuid,
+    ) -> AppResult<(FinishNowQuote, Option<TroopQueue>)> {
+        let now = clock::now();
+        let (ends_at, village_id, troop_queue) = match target_type {
+            FinishTarget::Building => {
+                let building = BuildingRepository::find_by_id(pool, target_id)
+                    .await?
+                    .ok_or_else(|| AppError::NotFound("Building not found".into()))?;
+
+                let ends_at = building
+                    .upgrade_ends_at
+                    .filter(|_| building.is_upgrading)
+                    .ok_or_else(|| AppError::BadRequest("Building is not upgrading".into()))?;
+
+                (ends_at, building.village_id, None)
+            }
+            FinishTarget::TroopQueue => {
+                let queue = TroopRepository::find_queue_by_id(pool, target_id)
+                    .await?
+                    .ok_or_else(|| AppError::NotFound("Training queue not found".into()))?;
+
+                (queue.ends_at, queue.village_id, Some(queue))
+            }
+            FinishTarget::Research => {
+                let research = ResearchRepository::find_by_id(pool, target_id)
+                    .await?
+                    .ok_or_else(|| AppError::NotFound("Research not found".into()))?;
+
+                (research.ends_at, research.village_id, None)
+            }
+        };
+
+        // Verify ownership
+        let village = VillageRepository::find_by_id(pool, village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".into()))?;
+
+        if village.user_id != user_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+
+        let remaining_seconds = (ends_at - now).num_seconds().max(0);
+        let gold_cost = finish_now_cost(remaining_seconds);
+
+        Ok((
+            FinishNowQuote {
+                target_type,
+                target_id,
+                remaining_seconds,
+                gold_cost,
+                free: gold_cost == 0,
+            },
+            troop_queue,
+        ))
+    }
+
     /// Use NPC Merchant to exchange resources
     pub async fn use_npc_merchant(
         pool: &PgPool,
@@ -520,7 +590,7 @@ impl ShopService {
         // Check gold balance
         let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
         if balance < gold_cost {
-            return Err(AppError::BadRequest("Insufficient gold".into()));
+            return Err(ErrorCode::InsufficientGold.into());
         }
 
         // Deduct gold
@@ -557,7 +627,7 @@ impl ShopService {
         .await?;
 
         // Record usage
-        ShopRepository::record_gold_usage(
+        let usage = ShopRepository::record_gold_usage(
             pool,
             user_id,
             GoldFeature::NpcMerchant,
@@ -581,6 +651,7 @@ impl ShopService {
             None,
         )
         .await?;
+        ActivityService::record_gold_spent(pool, &usage);
 
         Ok(UseFeatureResponse {
             success: true,
@@ -626,7 +697,7 @@ impl ShopService {
         // Check gold balance
         let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
         if balance < gold_cost {
-            return Err(AppError::BadRequest("Insufficient gold".into()));
+            return Err(ErrorCode::InsufficientGold.into());
         }
 
         // Deduct gold
@@ -649,7 +720,7 @@ impl ShopService {
         .await?;
 
         // Record usage
-        ShopRepository::record_gold_usage(
+        let usage = ShopRepository::record_gold_usage(
             pool,
             user_id,
             GoldFeature::ProductionBonus,
@@ -660,6 +731,7 @@ impl ShopService {
             Some(expires_at),
         )
         .await?;
+        ActivityService::record_gold_spent(pool, &usage);
 
         Ok(UseFeatureResponse {
             success: true,
@@ -700,7 +772,7 @@ impl ShopService {
         // Check gold balance
         let balance = ShopRepository::get_gold_balance(pool, user_id).await?;
         if balance < gold_cost {
-            return Err(AppError::BadRequest("Insufficient gold".into()));
+            return Err(ErrorCode::InsufficientGold.into());
         }
 
         // Deduct gold
@@ -723,7 +795,7 @@ impl ShopService {
         .await?;
 
         // Record usage
-        ShopRepository::record_gold_usage(
+        let usage = ShopRepository::record_gold_usage(
             pool,
             user_id,
             GoldFeature::BookOfWisdom,
@@ -734,6 +806,7 @@ impl ShopService {
             Some(expires_at),
         )
         .await?;
+        ActivityService::record_gold_spent(pool, &usage);
 
         Ok(UseFeatureResponse {
             success: true,
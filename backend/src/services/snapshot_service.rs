@@ -0,0 +1,357 @@
+use serde_json::Value;
+use sqlx::PgPool;
+use std::collections::{HashMap, HashSet};
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::snapshot::{
+    PlayerSnapshot, RestoreResult, RestoreSnapshotRequest, SnapshotSummary, SNAPSHOT_FORMAT_VERSION,
+};
+use crate::repositories::snapshot_repo::SnapshotRepository;
+use crate::repositories::user_repo::UserRepository;
+
+pub struct SnapshotService;
+
+impl SnapshotService {
+    /// Capture and store the player's current state
+    pub async fn create_snapshot(
+        pool: &PgPool,
+        admin_id: Uuid,
+        user_id: Uuid,
+        reason: Option<String>,
+    ) -> AppResult<SnapshotSummary> {
+        UserRepository::find_by_id(pool, user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Player not found".into()))?;
+
+        let snapshot = SnapshotRepository::capture(pool, user_id).await?;
+        let summary =
+            SnapshotRepository::save(pool, &snapshot, Some(admin_id), reason.as_deref()).await?;
+
+        info!(
+            "Admin {} took snapshot {} of player {}",
+            admin_id, summary.id, user_id
+        );
+
+        Ok(summary)
+    }
+
+    pub async fn list_snapshots(pool: &PgPool, user_id: Uuid) -> AppResult<Vec<SnapshotSummary>> {
+        SnapshotRepository::list_for_user(pool, user_id).await
+    }
+
+    pub async fn get_snapshot(pool: &PgPool, snapshot_id: Uuid) -> AppResult<PlayerSnapshot> {
+        let record = SnapshotRepository::find_by_id(pool, snapshot_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Snapshot not found".into()))?;
+
+        Ok(record.data.0)
+    }
+
+    /// Restore a player from a stored or uploaded snapshot. The current state
+    /// is snapshotted first so the restore itself can be undone.
+    pub async fn restore(
+        pool: &PgPool,
+        admin_id: Uuid,
+        user_id: Uuid,
+        request: RestoreSnapshotRequest,
+    ) -> AppResult<RestoreResult> {
+        UserRepository::find_by_id(pool, user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Player not found".into()))?;
+
+        let (mut snapshot, stored_id) = match (request.snapshot_id, request.snapshot) {
+            (Some(id), None) => {
+                let record = SnapshotRepository::find_by_id(pool, id)
+                    .await?
+                    .ok_or_else(|| AppError::NotFound("Snapshot not found".into()))?;
+                (record.data.0, Some(id))
+            }
+            (None, Some(snapshot)) => (snapshot, None),
+            _ => {
+                return Err(AppError::BadRequest(
+                    "Provide exactly one of snapshot_id or snapshot".into(),
+                ))
+            }
+        };
+
+        // Older documents lack tables and NOT NULL columns added since
+        if snapshot.format_version != SNAPSHOT_FORMAT_VERSION {
+            return Err(AppError::BadRequest(format!(
+                "Unsupported snapshot format version {} (this server restores version {})",
+                snapshot.format_version, SNAPSHOT_FORMAT_VERSION
+            )));
+        }
+        if snapshot.user_id != user_id {
+            return Err(AppError::BadRequest(
+                "Snapshot belongs to a different player".into(),
+            ));
+        }
+
+        let mut result = Self::prepare(pool, &mut snapshot).await?;
+
+        let backup = SnapshotRepository::capture(pool, user_id).await?;
+        let backup_reason = format!(
+            "Automatic backup before restore{}",
+            request
+                .reason
+                .map(|r| format!(": {}", r))
+                .unwrap_or_default()
+        );
+        let backup =
+            SnapshotRepository::save(pool, &backup, Some(admin_id), Some(&backup_reason)).await?;
+        result.backup_snapshot_id = backup.id;
+
+        SnapshotRepository::restore(pool, &snapshot).await?;
+
+        if let Some(id) = stored_id {
+            SnapshotRepository::mark_restored(pool, id).await?;
+        }
+
+        info!(
+            "Admin {} restored player {} ({} villages, {} armies, {} heroes); backup {}",
+            admin_id,
+            user_id,
+            result.villages_restored,
+            result.armies_restored,
+            result.heroes_restored,
+            backup.id
+        );
+
+        Ok(result)
+    }
+
+    /// Validate the snapshot against the current world and drop or clear
+    /// anything that would break a foreign key on import
+    async fn prepare(pool: &PgPool, snapshot: &mut PlayerSnapshot) -> AppResult<RestoreResult> {
+        let user_id = snapshot.user_id;
+        let mut result = RestoreResult::default();
+
+        // Villages must belong to this player and not collide with anyone else's
+        let mut village_ids = Vec::new();
+        let mut xs = Vec::new();
+        let mut ys = Vec::new();
+        for village in &snapshot.villages {
+            if uuid_field(village, "user_id") != Some(user_id) {
+                return Err(AppError::BadRequest(
+                    "Snapshot contains a village owned by another player".into(),
+                ));
+            }
+            let id = uuid_field(village, "id")
+                .ok_or_else(|| AppError::BadRequest("Snapshot village without id".into()))?;
+            village_ids.push(id);
+            xs.push(int_field(village, "x").unwrap_or_default());
+            ys.push(int_field(village, "y").unwrap_or_default());
+        }
+
+        for (id, owner) in SnapshotRepository::find_village_owners(pool, &village_ids).await? {
+            if owner != user_id {
+                return Err(AppError::Conflict(format!(
+                    "Village {} is now owned by another player",
+                    id
+                )));
+            }
+        }
+
+        let conflicts =
+            SnapshotRepository::find_coordinate_conflicts(pool, &village_ids, &xs, &ys).await?;
+        if let Some((x, y)) = conflicts.first() {
+            return Err(AppError::Conflict(format!(
+                "Tile ({}, {}) is occupied by another village",
+                x, y
+            )));
+        }
+
+        let current = SnapshotRepository::capture(pool, user_id).await?;
+        result.villages_not_in_snapshot = current
+            .villages
+            .iter()
+            .filter_map(|v| uuid_field(v, "id"))
+            .filter(|id| !village_ids.contains(id))
+            .collect();
+
+        let own_villages: HashSet<Uuid> = village_ids.iter().copied().collect();
+
+        // Village children must hang off the snapshot's villages
+        for rows in [
+            &mut snapshot.buildings,
+            &mut snapshot.building_queue,
+            &mut snapshot.troops,
+            &mut snapshot.troop_queue,
+            &mut snapshot.village_research,
+            &mut snapshot.research_queue,
+            &mut snapshot.wounded_troops,
+            &mut snapshot.healing_queue,
+        ] {
+            let before = rows.len();
+            rows.retain(|r| {
+                uuid_field(r, "village_id").is_some_and(|id| own_villages.contains(&id))
+            });
+            result.rows_skipped += before - rows.len();
+        }
+
+        // Upgrade orders must point at a restored building
+        let building_ids: HashSet<Uuid> = snapshot
+            .buildings
+            .iter()
+            .filter_map(|b| uuid_field(b, "id"))
+            .collect();
+        let before = snapshot.building_queue.len();
+        snapshot
+            .building_queue
+            .retain(|o| uuid_field(o, "building_id").map_or(true, |id| building_ids.contains(&id)));
+        result.rows_skipped += before - snapshot.building_queue.len();
+
+        // Armies: origin must be restored; targets may have vanished since
+        let before = snapshot.armies.len();
+        snapshot.armies.retain(|a| {
+            uuid_field(a, "player_id") == Some(user_id)
+                && uuid_field(a, "from_village_id").is_some_and(|id| own_villages.contains(&id))
+        });
+        result.rows_skipped += before - snapshot.armies.len();
+
+        let foreign_villages: Vec<Uuid> = snapshot
+            .armies
+            .iter()
+            .filter_map(|a| uuid_field(a, "to_village_id"))
+            .chain(
+                snapshot
+                    .heroes
+                    .iter()
+                    .filter_map(|h| uuid_field(h, "current_village_id")),
+            )
+            .filter(|id| !own_villages.contains(id))
+            .collect();
+        let existing: HashSet<Uuid> =
+            SnapshotRepository::find_village_owners(pool, &foreign_villages)
+                .await?
+                .into_iter()
+                .map(|(id, _)| id)
+                .collect();
+        let is_known = |id: Uuid| own_villages.contains(&id) || existing.contains(&id);
+
+        for army in &mut snapshot.armies {
+            if uuid_field(army, "to_village_id").is_some_and(|id| !is_known(id)) {
+                army["to_village_id"] = Value::Null;
+                result.references_cleared += 1;
+            }
+        }
+
+        // Heroes: home village must be restored
+        let before = snapshot.heroes.len();
+        snapshot.heroes.retain(|h| {
+            uuid_field(h, "user_id") == Some(user_id)
+                && uuid_field(h, "home_village_id").is_some_and(|id| own_villages.contains(&id))
+        });
+        result.rows_skipped += before - snapshot.heroes.len();
+
+        for hero in &mut snapshot.heroes {
+            if uuid_field(hero, "current_village_id").is_some_and(|id| !is_known(id)) {
+                hero["current_village_id"] = hero["home_village_id"].clone();
+                result.references_cleared += 1;
+            }
+        }
+
+        let hero_ids: HashSet<Uuid> = snapshot
+            .heroes
+            .iter()
+            .filter_map(|h| uuid_field(h, "id"))
+            .collect();
+
+        for army in &mut snapshot.armies {
+            if uuid_field(army, "hero_id").is_some_and(|id| !hero_ids.contains(&id)) {
+                army["hero_id"] = Value::Null;
+                result.references_cleared += 1;
+            }
+        }
+
+        let definition_ids: Vec<Uuid> = snapshot
+            .hero_items
+            .iter()
+            .filter_map(|i| uuid_field(i, "item_definition_id"))
+            .chain(
+                snapshot
+                    .hero_adventures
+                    .iter()
+                    .filter_map(|a| uuid_field(a, "reward_item_id")),
+            )
+            .collect();
+        let definitions: HashSet<Uuid> =
+            SnapshotRepository::existing_item_definitions(pool, &definition_ids)
+                .await?
+                .into_iter()
+                .collect();
+
+        let before = snapshot.hero_items.len();
+        snapshot.hero_items.retain(|i| {
+            uuid_field(i, "hero_id").is_some_and(|id| hero_ids.contains(&id))
+                && uuid_field(i, "item_definition_id").is_some_and(|id| definitions.contains(&id))
+        });
+        result.rows_skipped += before - snapshot.hero_items.len();
+
+        let before = snapshot.hero_adventures.len();
+        snapshot
+            .hero_adventures
+            .retain(|a| uuid_field(a, "hero_id").is_some_and(|id| hero_ids.contains(&id)));
+        result.rows_skipped += before - snapshot.hero_adventures.len();
+
+        for adventure in &mut snapshot.hero_adventures {
+            if uuid_field(adventure, "reward_item_id").is_some_and(|id| !definitions.contains(&id))
+            {
+                adventure["reward_item_id"] = Value::Null;
+                result.references_cleared += 1;
+            }
+        }
+
+        // Duplicate ids in an uploaded document would abort the import halfway
+        let mut seen: HashMap<&str, HashSet<Uuid>> = HashMap::new();
+        for (table, rows) in [
+            ("villages", &snapshot.villages),
+            ("buildings", &snapshot.buildings),
+            ("building_queue", &snapshot.building_queue),
+            ("troops", &snapshot.troops),
+            ("troop_queue", &snapshot.troop_queue),
+            ("research_queue", &snapshot.research_queue),
+            ("healing_queue", &snapshot.healing_queue),
+            ("armies", &snapshot.armies),
+            ("heroes", &snapshot.heroes),
+            ("hero_items", &snapshot.hero_items),
+            ("hero_adventures", &snapshot.hero_adventures),
+        ] {
+            let ids = seen.entry(table).or_default();
+            for id in rows.iter().filter_map(|r| uuid_field(r, "id")) {
+                if !ids.insert(id) {
+                    return Err(AppError::BadRequest(format!(
+                        "Duplicate {} id {} in snapshot",
+                        table, id
+                    )));
+                }
+            }
+        }
+
+        result.villages_restored = snapshot.villages.len();
+        result.buildings_restored = snapshot.buildings.len();
+        result.troops_restored = snapshot.troops.len();
+        result.queue_entries_restored = snapshot.troop_queue.len();
+        result.armies_restored = snapshot.armies.len();
+        result.heroes_restored = snapshot.heroes.len();
+        result.hero_items_restored = snapshot.hero_items.len();
+        result.hero_adventures_restored = snapshot.hero_adventures.len();
+        result.building_orders_restored = snapshot.building_queue.len();
+        result.research_restored = snapshot.village_research.len();
+        result.research_queue_restored = snapshot.research_queue.len();
+        result.wounded_troops_restored = snapshot.wounded_troops.len();
+        result.healing_queue_restored = snapshot.healing_queue.len();
+
+        Ok(result)
+    }
+}
+
+fn uuid_field(row: &Value, field: &str) -> Option<Uuid> {
+    row.get(field)?.as_str()?.parse().ok()
+}
+
+fn int_field(row: &Value, field: &str) -> Option<i32> {
+    row.get(field)?.as_i64().map(|v| v as i32)
+}
@@ -0,0 +1,176 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::social::{
+    Friendship, FriendshipStatus, SocialPanelResponse, MAX_BLOCKS, MAX_FRIENDS,
+    MAX_PENDING_REQUESTS, MAX_REQUESTS_PER_DAY,
+};
+use crate::repositories::social_repo::SocialRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::clock;
+
+/// Friend and block lists
+pub struct SocialService;
+
+impl SocialService {
+    pub async fn get_panel(pool: &PgPool, user_id: Uuid) -> AppResult<SocialPanelResponse> {
+        Ok(SocialPanelResponse {
+            friends: SocialRepository::list_friends(pool, user_id).await?,
+            incoming: SocialRepository::list_incoming(pool, user_id).await?,
+            outgoing: SocialRepository::list_outgoing(pool, user_id).await?,
+            blocked: SocialRepository::list_blocked(pool, user_id).await?,
+        })
+    }
+
+    // ==================== Friends ====================
+
+    /// Ask another player to be friends. If they already asked, this
+    /// accepts their request instead.
+    pub async fn request_friend(
+        pool: &PgPool,
+        user_id: Uuid,
+        target_id: Uuid,
+    ) -> AppResult<Friendship> {
+        if user_id == target_id {
+            return Err(AppError::BadRequest("Cannot befriend yourself".into()));
+        }
+        Self::check_player(pool, target_id).await?;
+
+        if SocialRepository::is_blocked(pool, user_id, target_id).await? {
+            return Err(AppError::BadRequest("Unblock this player first".into()));
+        }
+        // Don't tell a blocked player they are blocked
+        if SocialRepository::is_blocked(pool, target_id, user_id).await? {
+            return Err(AppError::BadRequest(
+                "Cannot send a friend request to this player".into(),
+            ));
+        }
+
+        if let Some(existing) = SocialRepository::find_between(pool, user_id, target_id).await? {
+            return match existing.status {
+                FriendshipStatus::Accepted => Err(AppError::Conflict("Already friends".into())),
+                FriendshipStatus::Pending if existing.requester_id == user_id => {
+                    Err(AppError::Conflict("Friend request already sent".into()))
+                }
+                FriendshipStatus::Pending => Self::accept_friend(pool, user_id, target_id).await,
+            };
+        }
+
+        if SocialRepository::count_friends(pool, user_id).await? >= MAX_FRIENDS {
+            return Err(AppError::BadRequest(format!(
+                "Friend list is full ({} friends)",
+                MAX_FRIENDS
+            )));
+        }
+        if SocialRepository::count_pending_sent(pool, user_id).await? >= MAX_PENDING_REQUESTS {
+            return Err(AppError::BadRequest(format!(
+                "Too many unanswered friend requests (at most {})",
+                MAX_PENDING_REQUESTS
+            )));
+        }
+        let now = clock::now();
+        let sent_today =
+            SocialRepository::count_sent_since(pool, user_id, now - Duration::days(1)).await?;
+        if sent_today >= MAX_REQUESTS_PER_DAY {
+            return Err(AppError::BadRequest(format!(
+                "At most {} friend requests can be sent per day",
+                MAX_REQUESTS_PER_DAY
+            )));
+        }
+
+        SocialRepository::create_request(pool, user_id, target_id, now).await
+    }
+
+    /// Accept the friend request `requester_id` sent to the player
+    pub async fn accept_friend(
+        pool: &PgPool,
+        user_id: Uuid,
+        requester_id: Uuid,
+    ) -> AppResult<Friendship> {
+        if SocialRepository::count_friends(pool, user_id).await? >= MAX_FRIENDS {
+            return Err(AppError::BadRequest(format!(
+                "Friend list is full ({} friends)",
+                MAX_FRIENDS
+            )));
+        }
+
+        let friendship = SocialRepository::accept(pool, requester_id, user_id, clock::now())
+            .await?
+            .ok_or_else(|| AppError::NotFound("Friend request not found".into()))?;
+
+        info!("Players {} and {} are now friends", requester_id, user_id);
+
+        Ok(friendship)
+    }
+
+    /// Remove a friend, or cancel or decline a pending request
+    pub async fn remove_friend(pool: &PgPool, user_id: Uuid, other_id: Uuid) -> AppResult<()> {
+        if !SocialRepository::delete_between(pool, user_id, other_id).await? {
+            return Err(AppError::NotFound("Not a friend or pending request".into()));
+        }
+        Ok(())
+    }
+
+    // ==================== Blocks ====================
+
+    /// Block a player: they can no longer message or befriend the player,
+    /// and any friendship or request between them is dropped
+    pub async fn block(pool: &PgPool, user_id: Uuid, target_id: Uuid) -> AppResult<()> {
+        if user_id == target_id {
+            return Err(AppError::BadRequest("Cannot block yourself".into()));
+        }
+        Self::check_player(pool, target_id).await?;
+
+        if SocialRepository::is_blocked(pool, user_id, target_id).await? {
+            return Ok(());
+        }
+        if SocialRepository::count_blocks(pool, user_id).await? >= MAX_BLOCKS {
+            return Err(AppError::BadRequest(format!(
+                "Block list is full ({} players)",
+                MAX_BLOCKS
+            )));
+        }
+
+        SocialRepository::block(pool, user_id, target_id, clock::now()).await?;
+        SocialRepository::delete_between(pool, user_id, target_id).await?;
+
+        Ok(())
+    }
+
+    pub async fn unblock(pool: &PgPool, user_id: Uuid, target_id: Uuid) -> AppResult<()> {
+        if !SocialRepository::unblock(pool, user_id, target_id).await? {
+            return Err(AppError::NotFound("Player is not blocked".into()));
+        }
+        Ok(())
+    }
+
+    /// Refuse a message from `sender_id` that `recipient_id` has blocked, or
+    /// to a player the sender has blocked
+    pub async fn check_can_message(
+        pool: &PgPool,
+        sender_id: Uuid,
+        recipient_id: Uuid,
+    ) -> AppResult<()> {
+        if SocialRepository::is_blocked(pool, sender_id, recipient_id).await? {
+            return Err(AppError::BadRequest(
+                "Unblock this player to message them".into(),
+            ));
+        }
+        if SocialRepository::is_blocked(pool, recipient_id, sender_id).await? {
+            return Err(AppError::Forbidden(
+                "This player is not accepting messages from you".into(),
+            ));
+        }
+        Ok(())
+    }
+
+    async fn check_player(pool: &PgPool, user_id: Uuid) -> AppResult<()> {
+        UserRepository::find_by_id(pool, user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Player not found".into()))?;
+        Ok(())
+    }
+}
@@ -0,0 +1,127 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::soft_delete::{DeletedItems, DeletedKind};
+use crate::models::world_setting::{
+    PurgeRunResult, SoftDeleteSettings, UpdateSoftDeleteRequest, SOFT_DELETE_KEY,
+};
+use crate::repositories::message_repo::MessageRepository;
+use crate::repositories::note_repo::NoteRepository;
+use crate::repositories::report_repo::ReportRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+
+/// Deleted messages, reports and notes: restoring them for support cases
+/// and purging them once the retention period has passed
+pub struct SoftDeleteService;
+
+impl SoftDeleteService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<SoftDeleteSettings> {
+        let key = CacheKey::WorldSetting(SOFT_DELETE_KEY.to_string());
+        let stored =
+            CacheService::get_or_load(key, || WorldSettingRepository::get(pool, SOFT_DELETE_KEY))
+                .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid soft_delete setting, using defaults: {}", e);
+                SoftDeleteSettings::default()
+            }),
+            None => SoftDeleteSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateSoftDeleteRequest,
+    ) -> AppResult<SoftDeleteSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(days) = request.retention_days {
+            settings.retention_days = days;
+        }
+
+        if settings.retention_days < 0 {
+            return Err(AppError::BadRequest(
+                "Retention days cannot be negative".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, SOFT_DELETE_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(SOFT_DELETE_KEY.to_string())]).await;
+
+        info!(
+            "Soft delete retention updated by {}: {:?}",
+            admin_id, settings
+        );
+
+        Ok(settings)
+    }
+
+    // ==================== Support ====================
+
+    /// What a player has deleted, newest first per kind
+    pub async fn list_deleted(pool: &PgPool, user_id: Uuid) -> AppResult<DeletedItems> {
+        Ok(DeletedItems {
+            messages: MessageRepository::find_deleted_for_user(pool, user_id).await?,
+            battle_reports: ReportRepository::find_deleted_reports(pool, user_id).await?,
+            scout_reports: ReportRepository::find_deleted_scout_reports(pool, user_id).await?,
+            notes: NoteRepository::find_deleted_by_author(pool, user_id).await?,
+        })
+    }
+
+    /// Bring back a deleted row for every side that deleted it
+    pub async fn restore(
+        pool: &PgPool,
+        admin_id: Uuid,
+        kind: DeletedKind,
+        id: Uuid,
+    ) -> AppResult<()> {
+        let restored = match kind {
+            DeletedKind::Message => MessageRepository::restore(pool, id).await?,
+            DeletedKind::BattleReport => ReportRepository::restore_report(pool, id).await?,
+            DeletedKind::ScoutReport => ReportRepository::restore_scout_report(pool, id).await?,
+            DeletedKind::Note => NoteRepository::restore(pool, id).await?,
+        };
+
+        if !restored {
+            return Err(AppError::NotFound(
+                "No deleted item with this id; it may have been purged".into(),
+            ));
+        }
+
+        info!("{:?} {} restored by {}", kind, id, admin_id);
+
+        Ok(())
+    }
+
+    // ==================== Purge ====================
+
+    /// Remove rows deleted longer ago than the retention period
+    pub async fn purge(pool: &PgPool) -> AppResult<PurgeRunResult> {
+        let settings = Self::get_settings(pool).await?;
+        let mut result = PurgeRunResult::default();
+        if settings.retention_days == 0 {
+            return Ok(result);
+        }
+
+        let cutoff = clock::now() - Duration::days(settings.retention_days as i64);
+        result.messages_purged = MessageRepository::purge_deleted(pool, cutoff).await?;
+        result.battle_reports_purged =
+            ReportRepository::purge_deleted_reports(pool, cutoff).await?;
+        result.scout_reports_purged =
+            ReportRepository::purge_deleted_scout_reports(pool, cutoff).await?;
+        result.notes_purged = NoteRepository::purge_deleted(pool, cutoff).await?;
+
+        Ok(result)
+    }
+}
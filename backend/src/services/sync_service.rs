@@ -0,0 +1,214 @@
+use chrono::{Duration, Utc};
+use serde::Serialize;
+use sqlx::PgPool;
+use std::collections::{HashMap, HashSet};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::army::ArmyResponse;
+use crate::models::building::BuildingResponse;
+use crate::models::domain_event::{
+    DomainEvent, SyncChange, SyncQuery, SyncResponse, ACTION_DELETE, ACTION_UPSERT, ENTITY_ARMY,
+    ENTITY_BUILDING, ENTITY_HERO, ENTITY_MESSAGE, ENTITY_TROOP, ENTITY_TROOP_QUEUE, ENTITY_VILLAGE,
+    SYNC_ENTITY_TYPES,
+};
+use crate::models::hero::HeroResponse;
+use crate::models::message::MessageType;
+use crate::models::troop::{TroopQueueResponse, TroopResponse};
+use crate::models::village::VillageResponse;
+use crate::repositories::alliance_repo::AllianceRepository;
+use crate::repositories::army_repo::ArmyRepository;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::domain_event_repo::DomainEventRepository;
+use crate::repositories::hero_repo::HeroRepository;
+use crate::repositories::message_repo::MessageRepository;
+use crate::repositories::troop_repo::TroopRepository;
+use crate::repositories::village_repo::VillageRepository;
+
+pub struct SyncService;
+
+impl SyncService {
+    /// Changes to the player's entities since `query.since`, collapsed to the
+    /// latest state of each entity
+    pub async fn sync(pool: &PgPool, user_id: Uuid, query: SyncQuery) -> AppResult<SyncResponse> {
+        let limit = query.limit.min(1000).max(1);
+        let head = DomainEventRepository::safe_head(pool).await?;
+
+        let Some(since) = query.since else {
+            return Ok(Self::reset(head));
+        };
+        if since < 0 {
+            return Err(AppError::BadRequest("Invalid sync cursor".into()));
+        }
+        if since >= head {
+            return Ok(SyncResponse {
+                cursor: since,
+                changes: Vec::new(),
+                has_more: false,
+                reset_required: false,
+            });
+        }
+
+        // Events after the cursor have been pruned
+        if let Some(oldest) = DomainEventRepository::oldest_id(pool).await? {
+            if since < oldest - 1 {
+                return Ok(Self::reset(head));
+            }
+        }
+
+        let mut events =
+            DomainEventRepository::find_for_user(pool, user_id, since, head, limit + 1).await?;
+        let has_more = events.len() as i64 > limit;
+        events.truncate(limit as usize);
+
+        let cursor = match events.last() {
+            Some(last) if has_more => last.id,
+            _ => head,
+        };
+
+        events.retain(|e| SYNC_ENTITY_TYPES.contains(&e.entity_type.as_str()));
+        let changes = Self::load_changes(pool, user_id, Self::latest_per_entity(events)).await?;
+
+        Ok(SyncResponse {
+            cursor,
+            changes,
+            has_more,
+            reset_required: false,
+        })
+    }
+
+    /// Delete domain events older than the retention window
+    pub async fn prune_events(pool: &PgPool, retention_hours: i64) -> AppResult<u64> {
+        DomainEventRepository::delete_before(pool, Utc::now() - Duration::hours(retention_hours))
+            .await
+    }
+
+    fn reset(head: i64) -> SyncResponse {
+        SyncResponse {
+            cursor: head,
+            changes: Vec::new(),
+            has_more: false,
+            reset_required: true,
+        }
+    }
+
+    /// Keep only the last event per entity, in event order
+    fn latest_per_entity(events: Vec<DomainEvent>) -> Vec<DomainEvent> {
+        let mut latest: HashMap<(String, Uuid), DomainEvent> = HashMap::new();
+        for event in events {
+            latest.insert((event.entity_type.clone(), event.entity_id), event);
+        }
+
+        let mut events: Vec<DomainEvent> = latest.into_values().collect();
+        events.sort_by_key(|e| e.id);
+        events
+    }
+
+    /// Attach current state to upserts. Entities that are gone or no longer
+    /// visible to the player are reported as deletes.
+    async fn load_changes(
+        pool: &PgPool,
+        user_id: Uuid,
+        events: Vec<DomainEvent>,
+    ) -> AppResult<Vec<SyncChange>> {
+        let ids = |entity_type: &str| -> Vec<Uuid> {
+            events
+                .iter()
+                .filter(|e| e.entity_type == entity_type && e.action == ACTION_UPSERT)
+                .map(|e| e.entity_id)
+                .collect()
+        };
+
+        let owned_villages: HashSet<Uuid> = VillageRepository::find_by_user_id(pool, user_id)
+            .await?
+            .into_iter()
+            .map(|v| v.id)
+            .collect();
+
+        let mut data: HashMap<Uuid, serde_json::Value> = HashMap::new();
+
+        for village in VillageRepository::find_by_ids(pool, &ids(ENTITY_VILLAGE)).await? {
+            if village.user_id == user_id {
+                data.insert(village.id, to_json(VillageResponse::from(village))?);
+            }
+        }
+        for building in BuildingRepository::find_by_ids(pool, &ids(ENTITY_BUILDING)).await? {
+            if owned_villages.contains(&building.village_id) {
+                data.insert(building.id, to_json(BuildingResponse::from(building))?);
+            }
+        }
+        for troop in TroopRepository::find_by_ids(pool, &ids(ENTITY_TROOP)).await? {
+            if owned_villages.contains(&troop.village_id) {
+                data.insert(troop.id, to_json(TroopResponse::from(troop))?);
+            }
+        }
+        for entry in TroopRepository::find_queue_by_ids(pool, &ids(ENTITY_TROOP_QUEUE)).await? {
+            if owned_villages.contains(&entry.village_id) {
+                data.insert(entry.id, to_json(TroopQueueResponse::from(entry))?);
+            }
+        }
+        for army in ArmyRepository::find_by_ids(pool, &ids(ENTITY_ARMY)).await? {
+            let visible = army.player_id == user_id
+                || army
+                    .to_village_id
+                    .is_some_and(|id| owned_villages.contains(&id));
+            if visible {
+                data.insert(army.id, to_json(ArmyResponse::from(army))?);
+            }
+        }
+        for hero in HeroRepository::find_by_ids(pool, &ids(ENTITY_HERO)).await? {
+            if hero.user_id == user_id {
+                data.insert(hero.id, to_json(HeroResponse::from(hero))?);
+            }
+        }
+
+        let message_ids = ids(ENTITY_MESSAGE);
+        if !message_ids.is_empty() {
+            let alliance_id = AllianceRepository::get_user_alliance(pool, user_id)
+                .await?
+                .map(|m| m.alliance_id);
+            for id in message_ids {
+                let Some(message) = MessageRepository::get_message(pool, id).await? else {
+                    continue;
+                };
+                let visible = match message.message_type {
+                    MessageType::Private => {
+                        message.sender_id == user_id || message.recipient_id == Some(user_id)
+                    }
+                    MessageType::Alliance => {
+                        alliance_id.is_some() && message.alliance_id == alliance_id
+                    }
+                };
+                if visible {
+                    data.insert(message.id, to_json(message)?);
+                }
+            }
+        }
+
+        Ok(events
+            .into_iter()
+            .map(|event| {
+                let data = if event.action == ACTION_UPSERT {
+                    data.remove(&event.entity_id)
+                } else {
+                    None
+                };
+                SyncChange {
+                    action: if data.is_some() {
+                        ACTION_UPSERT.to_string()
+                    } else {
+                        ACTION_DELETE.to_string()
+                    },
+                    entity_type: event.entity_type,
+                    entity_id: event.entity_id,
+                    village_id: event.village_id,
+                    data,
+                }
+            })
+            .collect())
+    }
+}
+
+fn to_json<T: Serialize>(value: T) -> AppResult<serde_json::Value> {
+    serde_json::to_value(value).map_err(|e| AppError::InternalError(e.into()))
+}
@@ -0,0 +1,492 @@
+//! The subset of Go's text/template that message templates are written in:
+//! `{{.field}}`, `{{.a.b}}`, `{{$.field}}` (from the top of the context),
+//! `{{if}}`/`{{else if}}`/`{{else}}`/`{{end}}`, `{{range}}`, the `eq`, `ne`,
+//! `not` and `or` functions, `{{/* comments */}}` and `{{-`/`-}}` trimming.
+//! Values come from a JSON context, so templates can be stored as data.
+
+use anyhow::{anyhow, bail, Context, Result};
+use serde_json::Value;
+
+#[derive(Debug, Clone)]
+pub struct Template {
+    nodes: Vec<Node>,
+}
+
+#[derive(Debug, Clone)]
+enum Node {
+    Text(String),
+    Print(Pipeline),
+    If {
+        cond: Pipeline,
+        then: Vec<Node>,
+        otherwise: Vec<Node>,
+    },
+    /// Runs the body once per array element, with `.` set to it; `otherwise`
+    /// when the array is empty
+    Range {
+        over: Pipeline,
+        body: Vec<Node>,
+        otherwise: Vec<Node>,
+    },
+}
+
+#[derive(Debug, Clone)]
+enum Pipeline {
+    Arg(Arg),
+    Call(Func, Vec<Arg>),
+}
+
+#[derive(Debug, Clone, Copy)]
+enum Func {
+    Eq,
+    Ne,
+    Not,
+    /// The first truthy argument, else the last one
+    Or,
+}
+
+#[derive(Debug, Clone)]
+enum Arg {
+    /// `.a.b` from the current value, `$.a.b` from the top of the context
+    Field {
+        root: bool,
+        path: Vec<String>,
+    },
+    Literal(Value),
+}
+
+enum Token {
+    Text(String),
+    Action(String),
+}
+
+/// How a block of nodes ended
+enum Close {
+    Else,
+    ElseIf(Pipeline),
+    End,
+}
+
+impl Template {
+    pub fn parse(source: &str) -> Result<Self> {
+        let mut tokens = lex(source)?.into_iter();
+        let (nodes, close) = parse_nodes(&mut tokens)?;
+        if close.is_some() {
+            bail!("{{{{else}}}} or {{{{end}}}} without an {{{{if}}}} or {{{{range}}}}");
+        }
+        Ok(Self { nodes })
+    }
+
+    /// Fields missing from the context render as nothing
+    pub fn render(&self, context: &Value) -> String {
+        let mut out = String::new();
+        render_nodes(&self.nodes, context, context, &mut out);
+        out
+    }
+
+    /// Walk every branch against `sample`, failing on fields it doesn't
+    /// have, so an edit can't refer to data the sender never passes. A
+    /// range body is checked against the first element of the array.
+    pub fn check(&self, sample: &Value) -> Result<()> {
+        check_nodes(&self.nodes, sample, sample)
+    }
+}
+
+// ==================== Parsing ====================
+
+fn lex(source: &str) -> Result<Vec<Token>> {
+    let mut tokens = Vec::new();
+    let mut rest = source;
+    let mut trim_next = false;
+
+    while let Some(start) = rest.find("{{") {
+        let mut text = &rest[..start];
+        if trim_next {
+            text = text.trim_start();
+        }
+        let after = &rest[start + 2..];
+        let end = after
+            .find("}}")
+            .ok_or_else(|| anyhow!("Unclosed action: {}", snippet(&rest[start..])))?;
+
+        let mut action = &after[..end];
+        if let Some(trimmed) = action.strip_prefix('-') {
+            if trimmed.starts_with(char::is_whitespace) {
+                text = text.trim_end();
+                action = trimmed;
+            }
+        }
+        trim_next = false;
+        if let Some(trimmed) = action.strip_suffix('-') {
+            if trimmed.ends_with(char::is_whitespace) {
+                trim_next = true;
+                action = trimmed;
+            }
+        }
+
+        if !text.is_empty() {
+            tokens.push(Token::Text(text.to_string()));
+        }
+        tokens.push(Token::Action(action.trim().to_string()));
+        rest = &after[end + 2..];
+    }
+
+    let text = if trim_next { rest.trim_start() } else { rest };
+    if !text.is_empty() {
+        tokens.push(Token::Text(text.to_string()));
+    }
+    Ok(tokens)
+}
+
+/// Nodes up to the `else` or `end` closing the current block, if any
+fn parse_nodes(tokens: &mut std::vec::IntoIter<Token>) -> Result<(Vec<Node>, Option<Close>)> {
+    let mut nodes = Vec::new();
+
+    while let Some(token) = tokens.next() {
+        let action = match token {
+            Token::Text(text) => {
+                nodes.push(Node::Text(text));
+                continue;
+            }
+            Token::Action(action) => action,
+        };
+        if action.starts_with("/*") {
+            if !action.ends_with("*/") {
+                bail!("Unclosed comment: {}", snippet(&action));
+            }
+            continue;
+        }
+
+        let words = split_words(&action)?;
+        match words.first().map(String::as_str) {
+            None => bail!("Empty action {{{{}}}}"),
+            Some("end") if words.len() == 1 => return Ok((nodes, Some(Close::End))),
+            Some("else") if words.len() == 1 => return Ok((nodes, Some(Close::Else))),
+            Some("else") if words[1] == "if" => {
+                let cond = parse_pipeline(&words[2..])?;
+                return Ok((nodes, Some(Close::ElseIf(cond))));
+            }
+            Some(keyword @ ("if" | "range")) => {
+                let pipeline = parse_pipeline(&words[1..])
+                    .with_context(|| format!("In {{{{{}}}}}", action))?;
+                nodes.push(parse_block(tokens, keyword == "if", pipeline)?);
+            }
+            Some(_) => nodes.push(Node::Print(
+                parse_pipeline(&words).with_context(|| format!("In {{{{{}}}}}", action))?,
+            )),
+        }
+    }
+
+    Ok((nodes, None))
+}
+
+/// The rest of an `if` or `range` after its opening action
+fn parse_block(
+    tokens: &mut std::vec::IntoIter<Token>,
+    is_if: bool,
+    pipeline: Pipeline,
+) -> Result<Node> {
+    let keyword = if is_if { "if" } else { "range" };
+    let (body, close) = parse_nodes(tokens)?;
+
+    let otherwise = match close {
+        None => bail!("{{{{{}}}}} is never closed with {{{{end}}}}", keyword),
+        Some(Close::End) => Vec::new(),
+        Some(Close::Else) => match parse_nodes(tokens)? {
+            (nodes, Some(Close::End)) => nodes,
+            _ => bail!(
+                "{{{{else}}}} of {{{{{}}}}} must be followed by {{{{end}}}}",
+                keyword
+            ),
+        },
+        Some(Close::ElseIf(cond)) if is_if => vec![parse_block(tokens, true, cond)?],
+        Some(Close::ElseIf(_)) => bail!("{{{{else if}}}} only follows {{{{if}}}}"),
+    };
+
+    Ok(if is_if {
+        Node::If {
+            cond: pipeline,
+            then: body,
+            otherwise,
+        }
+    } else {
+        Node::Range {
+            over: pipeline,
+            body,
+            otherwise,
+        }
+    })
+}
+
+/// Split an action on whitespace, keeping quoted strings whole
+fn split_words(action: &str) -> Result<Vec<String>> {
+    let mut words = Vec::new();
+    let mut chars = action.chars().peekable();
+
+    while let Some(&c) = chars.peek() {
+        if c.is_whitespace() {
+            chars.next();
+            continue;
+        }
+
+        let mut word = String::new();
+        if c == '"' {
+            word.push(c);
+            chars.next();
+            let mut escaped = false;
+            loop {
+                let c = chars
+                    .next()
+                    .ok_or_else(|| anyhow!("Unterminated string: {}", word))?;
+                word.push(c);
+                match c {
+                    '\\' if !escaped => escaped = true,
+                    '"' if !escaped => break,
+                    _ => escaped = false,
+                }
+            }
+        } else {
+            while let Some(&c) = chars.peek() {
+                if c.is_whitespace() {
+                    break;
+                }
+                word.push(c);
+                chars.next();
+            }
+        }
+        words.push(word);
+    }
+
+    Ok(words)
+}
+
+fn parse_pipeline(words: &[String]) -> Result<Pipeline> {
+    let Some((first, rest)) = words.split_first() else {
+        bail!("Missing a value");
+    };
+
+    let func = match first.as_str() {
+        "eq" => Func::Eq,
+        "ne" => Func::Ne,
+        "not" => Func::Not,
+        "or" => Func::Or,
+        _ if rest.is_empty() => return Ok(Pipeline::Arg(parse_arg(first)?)),
+        _ => bail!("Unknown function {}", first),
+    };
+
+    let args = rest
+        .iter()
+        .map(|w| parse_arg(w))
+        .collect::<Result<Vec<_>>>()?;
+    let arity_ok = match func {
+        Func::Eq | Func::Ne => args.len() == 2,
+        Func::Not => args.len() == 1,
+        Func::Or => !args.is_empty(),
+    };
+    if !arity_ok {
+        bail!("Wrong number of arguments to {}", first);
+    }
+
+    Ok(Pipeline::Call(func, args))
+}
+
+fn parse_arg(word: &str) -> Result<Arg> {
+    if word.starts_with('"') {
+        let text: String =
+            serde_json::from_str(word).with_context(|| format!("Invalid string {}", word))?;
+        return Ok(Arg::Literal(Value::String(text)));
+    }
+    match word {
+        "true" => return Ok(Arg::Literal(Value::Bool(true))),
+        "false" => return Ok(Arg::Literal(Value::Bool(false))),
+        "." => {
+            return Ok(Arg::Field {
+                root: false,
+                path: Vec::new(),
+            })
+        }
+        "$" => {
+            return Ok(Arg::Field {
+                root: true,
+                path: Vec::new(),
+            })
+        }
+        _ => {}
+    }
+    if let Ok(number) = word.parse::<i64>() {
+        return Ok(Arg::Literal(Value::from(number)));
+    }
+
+    let (root, path) = match (word.strip_prefix("$."), word.strip_prefix('.')) {
+        (Some(path), _) => (true, path),
+        (None, Some(path)) => (false, path),
+        (None, None) => bail!("Unknown word {}", word),
+    };
+    let path: Vec<String> = path.split('.').map(str::to_string).collect();
+    if path
+        .iter()
+        .any(|p| p.is_empty() || !p.chars().all(|c| c.is_ascii_alphanumeric() || c == '_'))
+    {
+        bail!("Invalid field {}", word);
+    }
+
+    Ok(Arg::Field { root, path })
+}
+
+fn snippet(text: &str) -> String {
+    text.chars().take(30).collect()
+}
+
+// ==================== Rendering ====================
+
+/// The argument's value; `None` when the context lacks the field
+fn resolve(arg: &Arg, root: &Value, dot: &Value) -> Option<Value> {
+    match arg {
+        Arg::Literal(value) => Some(value.clone()),
+        Arg::Field {
+            root: from_root,
+            path,
+        } => {
+            let mut value = if *from_root { root } else { dot };
+            for name in path {
+                value = value.get(name)?;
+            }
+            Some(value.clone())
+        }
+    }
+}
+
+fn evaluate(pipeline: &Pipeline, root: &Value, dot: &Value) -> Value {
+    let value = |arg: &Arg| resolve(arg, root, dot).unwrap_or(Value::Null);
+
+    match pipeline {
+        Pipeline::Arg(arg) => value(arg),
+        Pipeline::Call(func, args) => match func {
+            Func::Eq => Value::Bool(equal(&value(&args[0]), &value(&args[1]))),
+            Func::Ne => Value::Bool(!equal(&value(&args[0]), &value(&args[1]))),
+            Func::Not => Value::Bool(!truthy(&value(&args[0]))),
+            Func::Or => {
+                let values: Vec<Value> = args.iter().map(value).collect();
+                let last = values.last().cloned().unwrap_or(Value::Null);
+                values.into_iter().find(truthy).unwrap_or(last)
+            }
+        },
+    }
+}
+
+/// Numbers compare by value, so 1 and 1.0 are equal
+fn equal(a: &Value, b: &Value) -> bool {
+    match (a.as_f64(), b.as_f64()) {
+        (Some(a), Some(b)) => a == b,
+        _ => a == b,
+    }
+}
+
+/// Go's notion of truth: false, 0, null and empty values are false
+fn truthy(value: &Value) -> bool {
+    match value {
+        Value::Null => false,
+        Value::Bool(b) => *b,
+        Value::Number(n) => n.as_f64().is_some_and(|n| n != 0.0),
+        Value::String(s) => !s.is_empty(),
+        Value::Array(items) => !items.is_empty(),
+        Value::Object(fields) => !fields.is_empty(),
+    }
+}
+
+fn write_value(out: &mut String, value: &Value) {
+    match value {
+        Value::Null => {}
+        Value::String(s) => out.push_str(s),
+        other => out.push_str(&other.to_string()),
+    }
+}
+
+fn render_nodes(nodes: &[Node], root: &Value, dot: &Value, out: &mut String) {
+    for node in nodes {
+        match node {
+            Node::Text(text) => out.push_str(text),
+            Node::Print(pipeline) => write_value(out, &evaluate(pipeline, root, dot)),
+            Node::If {
+                cond,
+                then,
+                otherwise,
+            } => {
+                let branch = if truthy(&evaluate(cond, root, dot)) {
+                    then
+                } else {
+                    otherwise
+                };
+                render_nodes(branch, root, dot, out);
+            }
+            Node::Range {
+                over,
+                body,
+                otherwise,
+            } => match evaluate(over, root, dot) {
+                Value::Array(items) if !items.is_empty() => {
+                    for item in &items {
+                        render_nodes(body, root, item, out);
+                    }
+                }
+                _ => render_nodes(otherwise, root, dot, out),
+            },
+        }
+    }
+}
+
+// ==================== Checking ====================
+
+fn check_pipeline(pipeline: &Pipeline, root: &Value, dot: &Value) -> Result<()> {
+    let args = match pipeline {
+        Pipeline::Arg(arg) => std::slice::from_ref(arg),
+        Pipeline::Call(_, args) => args.as_slice(),
+    };
+    for arg in args {
+        if resolve(arg, root, dot).is_none() {
+            if let Arg::Field { root, path } = arg {
+                bail!(
+                    "Unknown field {}.{}",
+                    if *root { "$" } else { "" },
+                    path.join(".")
+                );
+            }
+        }
+    }
+    Ok(())
+}
+
+fn check_nodes(nodes: &[Node], root: &Value, dot: &Value) -> Result<()> {
+    for node in nodes {
+        match node {
+            Node::Text(_) => {}
+            Node::Print(pipeline) => check_pipeline(pipeline, root, dot)?,
+            Node::If {
+                cond,
+                then,
+                otherwise,
+            } => {
+                check_pipeline(cond, root, dot)?;
+                check_nodes(then, root, dot)?;
+                check_nodes(otherwise, root, dot)?;
+            }
+            Node::Range {
+                over,
+                body,
+                otherwise,
+            } => {
+                check_pipeline(over, root, dot)?;
+                match evaluate(over, root, dot) {
+                    Value::Array(items) => {
+                        if let Some(first) = items.first() {
+                            check_nodes(body, root, first)?;
+                        }
+                    }
+                    other => bail!("{{{{range}}}} over {}, which is not a list", other),
+                }
+                check_nodes(otherwise, root, dot)?;
+            }
+        }
+    }
+    Ok(())
+}
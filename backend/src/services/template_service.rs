@@ -0,0 +1,321 @@
+use anyhow::anyhow;
+use serde_json::Value;
+use sqlx::PgPool;
+use std::collections::HashMap;
+use std::sync::OnceLock;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::template::{
+    MessageTemplate, PreviewTemplateRequest, PublishTemplateRequest, RenderedTemplate,
+    RevertTemplateRequest, TemplateDetails, TemplateInfo, TemplateKey, TemplateText, TemplatesFile,
+    DEFAULT_LOCALE, EMBEDDED_TEMPLATES, LOCALES, MAX_BODY_LEN, MAX_SUBJECT_LEN,
+};
+use crate::repositories::template_repo::TemplateRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::template_engine::Template;
+
+static BUILTIN: OnceLock<TemplatesFile> = OnceLock::new();
+
+/// Built-in texts from every embedded file
+fn builtin() -> &'static TemplatesFile {
+    BUILTIN.get_or_init(|| {
+        let mut templates = TemplatesFile::new();
+        for file in EMBEDDED_TEMPLATES {
+            let parsed: TemplatesFile =
+                serde_yaml::from_str(file).expect("embedded templates are valid YAML");
+            templates.extend(parsed);
+        }
+        templates
+    })
+}
+
+/// Emails, Discord posts and system messages are rendered from templates
+/// rather than built in code. Each has a built-in text per locale; admins
+/// publish edited versions, and the newest one is used until another is
+/// published. A reader whose locale a template lacks gets the default one.
+pub struct TemplateService;
+
+impl TemplateService {
+    /// Check every built-in text against its template's sample. Called at
+    /// startup, so a broken text fails the deploy instead of a send.
+    pub fn verify_builtin() -> anyhow::Result<()> {
+        let templates = builtin();
+        let mut problems = Vec::new();
+
+        for name in templates.keys() {
+            if TemplateKey::from_name(name).is_none() {
+                problems.push(format!("{}: not a known template", name));
+            }
+        }
+        for key in TemplateKey::ALL {
+            let Some(texts) = templates.get(key.name()) else {
+                problems.push(format!("{}: missing", key.name()));
+                continue;
+            };
+            if !texts.contains_key(DEFAULT_LOCALE) {
+                problems.push(format!("{}: no {} text", key.name(), DEFAULT_LOCALE));
+            }
+            for (locale, text) in texts {
+                if !LOCALES.contains(&locale.as_str()) {
+                    problems.push(format!("{} {}: unknown locale", key.name(), locale));
+                }
+                if let Err(e) = Self::check(key, text) {
+                    problems.push(format!("{} {}: {}", key.name(), locale, e));
+                }
+            }
+        }
+
+        if !problems.is_empty() {
+            anyhow::bail!("Invalid built-in templates:\n  {}", problems.join("\n  "));
+        }
+        Ok(())
+    }
+
+    /// Render `key` for a reader of `locale`
+    pub async fn render(
+        pool: &PgPool,
+        key: TemplateKey,
+        locale: &str,
+        context: &Value,
+    ) -> AppResult<RenderedTemplate> {
+        let text = Self::current(pool, key, locale).await?;
+        match render_text(&text, context) {
+            Ok(rendered) => Ok(rendered),
+            Err(e) => {
+                // Edits are checked when published; only an engine change
+                // can break one, and the built-in text still works
+                warn!(
+                    "Template {} ({}) failed to render, using the built-in text: {:#}",
+                    key.name(),
+                    locale,
+                    e
+                );
+                let text = builtin_text(key, locale)?;
+                render_text(text, context).map_err(AppError::InternalError)
+            }
+        }
+    }
+
+    pub async fn list(pool: &PgPool) -> AppResult<Vec<TemplateInfo>> {
+        let mut versions: HashMap<String, HashMap<String, i32>> = HashMap::new();
+        for (name, locale, version) in TemplateRepository::current_versions(pool).await? {
+            versions.entry(name).or_default().insert(locale, version);
+        }
+
+        Ok(TemplateKey::ALL
+            .into_iter()
+            .map(|key| TemplateInfo {
+                name: key.name(),
+                channel: key.channel(),
+                description: key.description(),
+                versions: versions.remove(key.name()).unwrap_or_default(),
+            })
+            .collect())
+    }
+
+    pub async fn get(pool: &PgPool, name: &str) -> AppResult<TemplateDetails> {
+        let key = key_of(name)?;
+        Ok(TemplateDetails {
+            name: key.name(),
+            channel: key.channel(),
+            description: key.description(),
+            sample: key.sample(),
+            builtin: builtin().get(key.name()).cloned().unwrap_or_default(),
+            versions: TemplateRepository::list_versions(pool, key.name()).await?,
+        })
+    }
+
+    /// Publish an edited text as the next version in its locale
+    pub async fn publish(
+        pool: &PgPool,
+        admin_id: Uuid,
+        name: &str,
+        request: PublishTemplateRequest,
+    ) -> AppResult<MessageTemplate> {
+        let key = key_of(name)?;
+        check_locale(&request.locale)?;
+        let text = TemplateText {
+            subject: request.subject,
+            body: request.body,
+        };
+        Self::check(key, &text).map_err(AppError::ValidationError)?;
+
+        Self::create_version(pool, admin_id, key, &request.locale, &text).await
+    }
+
+    /// Publish an earlier version again, as the newest one
+    pub async fn revert(
+        pool: &PgPool,
+        admin_id: Uuid,
+        name: &str,
+        request: RevertTemplateRequest,
+    ) -> AppResult<MessageTemplate> {
+        let key = key_of(name)?;
+        let old =
+            TemplateRepository::find_version(pool, key.name(), &request.locale, request.version)
+                .await?
+                .ok_or_else(|| AppError::NotFound("Template version not found".into()))?;
+        let text = TemplateText {
+            subject: old.subject,
+            body: old.body,
+        };
+        Self::check(key, &text).map_err(AppError::ValidationError)?;
+
+        Self::create_version(pool, admin_id, key, &request.locale, &text).await
+    }
+
+    /// Render a draft, or the text in use, against the sample or a given
+    /// context. Meant for writing templates, so not offered in production.
+    pub async fn preview(
+        pool: &PgPool,
+        environment: &str,
+        name: &str,
+        request: PreviewTemplateRequest,
+    ) -> AppResult<RenderedTemplate> {
+        if environment == "production" {
+            return Err(AppError::Forbidden(
+                "Template previews are disabled in production".into(),
+            ));
+        }
+        let key = key_of(name)?;
+        check_locale(&request.locale)?;
+
+        let current = Self::current(pool, key, &request.locale).await?;
+        let text = TemplateText {
+            subject: request.subject.unwrap_or(current.subject),
+            body: request.body.unwrap_or(current.body),
+        };
+        let context = request.context.unwrap_or_else(|| key.sample());
+
+        render_text(&text, &context).map_err(|e| AppError::ValidationError(format!("{:#}", e)))
+    }
+
+    /// The text in use for `locale`: the newest edit, else the built-in
+    /// text, else the same for the default locale
+    async fn current(pool: &PgPool, key: TemplateKey, locale: &str) -> AppResult<TemplateText> {
+        let locale = if LOCALES.contains(&locale) {
+            locale
+        } else {
+            DEFAULT_LOCALE
+        };
+
+        for locale in [locale, DEFAULT_LOCALE] {
+            let edited = CacheService::get_or_load(
+                CacheKey::Template {
+                    name: key.name().to_string(),
+                    locale: locale.to_string(),
+                },
+                || TemplateRepository::find_current(pool, key.name(), locale),
+            )
+            .await?;
+            if let Some(edited) = edited {
+                return Ok(TemplateText {
+                    subject: edited.subject,
+                    body: edited.body,
+                });
+            }
+            if let Some(text) = builtin().get(key.name()).and_then(|t| t.get(locale)) {
+                return Ok(text.clone());
+            }
+        }
+
+        Err(AppError::InternalError(anyhow!(
+            "Template {} has no text",
+            key.name()
+        )))
+    }
+
+    /// Both parts parse and refer only to fields the sender passes
+    fn check(key: TemplateKey, text: &TemplateText) -> Result<(), String> {
+        if text.subject.trim().is_empty() || text.subject.len() > MAX_SUBJECT_LEN {
+            return Err(format!(
+                "Subject must be 1 to {} characters",
+                MAX_SUBJECT_LEN
+            ));
+        }
+        if text.body.trim().is_empty() || text.body.len() > MAX_BODY_LEN {
+            return Err(format!("Body must be 1 to {} characters", MAX_BODY_LEN));
+        }
+
+        let sample = key.sample();
+        for (part, source) in [("Subject", &text.subject), ("Body", &text.body)] {
+            Template::parse(source)
+                .and_then(|template| template.check(&sample))
+                .map_err(|e| format!("{}: {:#}", part, e))?;
+        }
+        Ok(())
+    }
+
+    async fn create_version(
+        pool: &PgPool,
+        admin_id: Uuid,
+        key: TemplateKey,
+        locale: &str,
+        text: &TemplateText,
+    ) -> AppResult<MessageTemplate> {
+        let template = TemplateRepository::create_version(
+            pool,
+            key.name(),
+            locale,
+            &text.subject,
+            &text.body,
+            admin_id,
+        )
+        .await?;
+        CacheService::invalidate(&[CacheKey::Template {
+            name: key.name().to_string(),
+            locale: locale.to_string(),
+        }])
+        .await;
+
+        info!(
+            "Template {} ({}) version {} published by {}",
+            key.name(),
+            locale,
+            template.version,
+            admin_id
+        );
+
+        Ok(template)
+    }
+}
+
+fn key_of(name: &str) -> AppResult<TemplateKey> {
+    TemplateKey::from_name(name)
+        .ok_or_else(|| AppError::NotFound(format!("Unknown template {}", name)))
+}
+
+fn check_locale(locale: &str) -> AppResult<()> {
+    if !LOCALES.contains(&locale) {
+        return Err(AppError::ValidationError(format!(
+            "locale must be one of {}",
+            LOCALES.join(", ")
+        )));
+    }
+    Ok(())
+}
+
+fn builtin_text(key: TemplateKey, locale: &str) -> AppResult<&'static TemplateText> {
+    let texts = builtin().get(key.name());
+    texts
+        .and_then(|t| t.get(locale).or_else(|| t.get(DEFAULT_LOCALE)))
+        .ok_or_else(|| AppError::InternalError(anyhow!("Template {} has no text", key.name())))
+}
+
+/// Subjects are a single line; anything after the first is dropped
+fn render_text(text: &TemplateText, context: &Value) -> anyhow::Result<RenderedTemplate> {
+    let subject = Template::parse(&text.subject)?.render(context);
+    let body = Template::parse(&text.body)?.render(context);
+
+    Ok(RenderedTemplate {
+        subject: subject
+            .lines()
+            .next()
+            .unwrap_or_default()
+            .trim()
+            .to_string(),
+        body,
+    })
+}
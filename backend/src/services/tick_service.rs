@@ -0,0 +1,135 @@
+use sqlx::PgPool;
+use tracing::warn;
+use uuid::Uuid;
+
+use crate::config::TickConfig;
+use crate::error::AppResult;
+use crate::models::tick::{shard_range, TickJob, TickRunResult, TickShard};
+use crate::repositories::tick_repo::TickRepository;
+use crate::services::clock;
+use crate::services::oasis_service::OasisService;
+
+/// How long a worker may hold a shard before another may take it over
+const SHARD_LEASE_SECS: i64 = 300;
+
+pub struct TickService;
+
+impl TickService {
+    /// Create or re-split the shard rows of every tick job
+    pub async fn ensure_shards(pool: &PgPool, config: &TickConfig) -> AppResult<()> {
+        for job in TickJob::ALL {
+            TickRepository::ensure_shards(pool, job.name(), config.shard_count).await?;
+        }
+        Ok(())
+    }
+
+    /// Process every due shard this worker can claim. Shards behind by more
+    /// than one tick catch up in a single pass; beyond `max_catchup_ticks`
+    /// the excess ticks are dropped so a long outage can't flood the world.
+    pub async fn run_due(
+        pool: &PgPool,
+        worker_id: Uuid,
+        config: &TickConfig,
+    ) -> AppResult<TickRunResult> {
+        let mut result = TickRunResult::default();
+
+        for job in TickJob::ALL {
+            let shards = TickRepository::claim_due(
+                pool,
+                job.name(),
+                job.interval().num_seconds(),
+                worker_id,
+                SHARD_LEASE_SECS,
+                config.shard_count as i64,
+                clock::now(),
+            )
+            .await?;
+
+            for shard in shards {
+                match Self::process_shard(pool, *job, &shard, worker_id, config).await {
+                    Ok((applied, skipped, updated)) => {
+                        result.shards_processed += 1;
+                        result.ticks_applied += applied;
+                        result.ticks_skipped += skipped;
+                        match job {
+                            TickJob::LoyaltyRegeneration => result.villages_updated += updated,
+                            TickJob::OasisRegrowth => result.oases_regrown += updated,
+                        }
+                    }
+                    Err(e) => {
+                        TickRepository::release(pool, job.name(), shard.shard, worker_id).await?;
+                        return Err(e);
+                    }
+                }
+            }
+        }
+
+        Ok(result)
+    }
+
+    async fn process_shard(
+        pool: &PgPool,
+        job: TickJob,
+        shard: &TickShard,
+        worker_id: Uuid,
+        config: &TickConfig,
+    ) -> AppResult<(i64, i64, u64)> {
+        let interval = job.interval();
+        let now = clock::now();
+
+        let due = (now - shard.watermark).num_seconds() / interval.num_seconds();
+        let ticks = due.min(config.max_catchup_ticks);
+        let skipped = due - ticks;
+
+        // Skipped ticks still move the watermark; the remainder of the
+        // current interval carries over to the next run
+        let watermark = shard.watermark + interval * due as i32;
+
+        if skipped > 0 {
+            warn!(
+                "Tick job {} shard {} was {} ticks behind; dropping {}",
+                job.name(),
+                shard.shard,
+                due,
+                skipped
+            );
+        }
+
+        let (lower, upper) = shard_range(shard.shard, shard.shard_count);
+
+        let mut tx = pool.begin().await?;
+
+        let updated = match job {
+            TickJob::LoyaltyRegeneration => {
+                TickRepository::regenerate_loyalty(&mut tx, lower, upper, ticks).await?
+            }
+            TickJob::OasisRegrowth => {
+                OasisService::regrow(&mut tx, lower, upper, ticks, now).await?
+            }
+        };
+
+        // Lease expired and another worker took the shard: leave it to them
+        if !TickRepository::advance(
+            &mut tx,
+            job.name(),
+            shard.shard,
+            worker_id,
+            watermark,
+            ticks,
+            skipped,
+        )
+        .await?
+        {
+            tx.rollback().await?;
+            return Ok((0, 0, 0));
+        }
+
+        tx.commit().await?;
+
+        Ok((ticks, skipped, updated))
+    }
+
+    pub async fn list_shards(pool: &PgPool) -> AppResult<Vec<TickShard>> {
+        TickRepository::list(pool).await
+    }
+}
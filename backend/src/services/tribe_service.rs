@@ -0,0 +1,96 @@
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::building::BuildingType;
+use crate::models::gamedata::{definitions, TribeBonus};
+use crate::models::troop::TribeType;
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::combat::BattleBonus;
+
+/// Where the economy and combat code look up what a player's tribe changes
+pub struct TribeService;
+
+impl TribeService {
+    pub async fn player_tribe(pool: &PgPool, user_id: Uuid) -> AppResult<TribeType> {
+        let user = UserRepository::find_by_id(pool, user_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Player not found".into()))?;
+        Ok(user.tribe)
+    }
+
+    /// Tribe-wide bonus; none for players whose account is gone
+    pub async fn bonus(pool: &PgPool, user_id: Uuid) -> AppResult<TribeBonus> {
+        let Some(user) = UserRepository::find_by_id(pool, user_id).await? else {
+            return Ok(TribeBonus::default());
+        };
+        Ok(definitions()
+            .tribe(user.tribe)
+            .map(|t| t.bonus)
+            .unwrap_or_default())
+    }
+
+    /// Attack bonus, in percent, for an army a player sends from a village
+    pub async fn attack_percent(pool: &PgPool, user_id: Uuid, village_id: Uuid) -> AppResult<i32> {
+        let tribe = Self::bonus(pool, user_id).await?.attack;
+        let building = Self::building_percent(pool, village_id, BuildingType::Brewery).await?;
+        Ok(tribe + building)
+    }
+
+    /// Defense bonus, in percent, for a player's village
+    pub async fn defense_percent(pool: &PgPool, user_id: Uuid, village_id: Uuid) -> AppResult<i32> {
+        let tribe = Self::bonus(pool, user_id).await?.defense;
+        let building = Self::building_percent(pool, village_id, BuildingType::Trapper).await?;
+        Ok(tribe + building)
+    }
+
+    /// Bonuses for an army from `from_village_id` attacking a player's village
+    pub async fn battle_bonus(
+        pool: &PgPool,
+        attacker_id: Uuid,
+        from_village_id: Uuid,
+        defender_id: Uuid,
+        target_village_id: Uuid,
+    ) -> AppResult<BattleBonus> {
+        Ok(BattleBonus {
+            attack_percent: Self::attack_percent(pool, attacker_id, from_village_id).await?,
+            defense_percent: Self::defense_percent(pool, defender_id, target_village_id).await?,
+        })
+    }
+
+    /// Refuse buildings reserved for another tribe
+    pub fn check_can_build(tribe: TribeType, building_type: &BuildingType) -> AppResult<()> {
+        match definitions().building_tribe(building_type) {
+            Some(owner) if owner != tribe => Err(AppError::BadRequest(format!(
+                "{:?} can only be built by the {:?}",
+                building_type, owner
+            ))),
+            _ => Ok(()),
+        }
+    }
+
+    /// Refuse units of another tribe; Special units are open to everyone
+    pub fn check_can_train(tribe: TribeType, unit_tribe: TribeType) -> AppResult<()> {
+        if unit_tribe != tribe && unit_tribe.is_playable() {
+            return Err(AppError::BadRequest(format!(
+                "Only the {:?} can train this unit",
+                unit_tribe
+            )));
+        }
+        Ok(())
+    }
+
+    /// Effect of a tribe building in the village. Buildings only exist where
+    /// the owner's tribe could build them, so no tribe check is needed.
+    async fn building_percent(
+        pool: &PgPool,
+        village_id: Uuid,
+        building_type: BuildingType,
+    ) -> AppResult<i32> {
+        let buildings =
+            BuildingRepository::find_by_type(pool, village_id, building_type.clone()).await?;
+        let level = buildings.first().map(|b| b.level).unwrap_or(0);
+        Ok(building_type.tribe_bonus_percent(level))
+    }
+}
@@ -1,12 +1,15 @@
-use chrono::{Duration, Utc};
+use chrono::Duration;
 use sqlx::PgPool;
 use uuid::Uuid;
 
-use crate::error::{AppError, AppResult};
+use crate::error::{AppError, AppResult, ErrorCode};
 use crate::models::troop::{Troop, TroopCost, TroopDefinition, TroopQueue, TroopType, TrainTroopsResponse};
 use crate::repositories::building_repo::BuildingRepository;
-use crate::repositories::troop_repo::TroopRepository;
+use crate::repositories::troop_repo::{TrainingQueue, TroopRepository};
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock::{self, Clock};
+use crate::services::research_service::ResearchService;
+use crate::services::tribe_service::TribeService;
 
 pub struct TroopService;
 
@@ -37,16 +40,29 @@ impl TroopService {
             .await?
             .ok_or_else(|| AppError::NotFound("Troop type not found".into()))?;
 
+        // Each tribe trains its own roster
+        let village = VillageRepository::find_by_id(pool, village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".into()))?;
+        let tribe = TribeService::player_tribe(pool, village.user_id).await?;
+        TribeService::check_can_train(tribe, definition.tribe)?;
+
+        // Units other than the basic ones are researched in the academy first
+        ResearchService::check_researched(pool, village_id, troop_type).await?;
+
         // Check if required building exists at required level
         let buildings = BuildingRepository::find_by_type(pool, village_id, definition.required_building.clone()).await?;
 
         let max_level = buildings.iter().map(|b| b.level).max().unwrap_or(0);
 
         if max_level < definition.required_building_level {
-            return Err(AppError::BadRequest(format!(
-                "{:?} level {} required (current: {})",
-                definition.required_building, definition.required_building_level, max_level
-            )));
+            return Err(AppError::Game(
+                ErrorCode::MissingPrerequisites,
+                format!(
+                    "{:?} level {} required (current: {})",
+                    definition.required_building, definition.required_building_level, max_level
+                ),
+            ));
         }
 
         Ok(definition)
@@ -60,7 +76,7 @@ impl TroopService {
         count: i32,
     ) -> AppResult<TrainTroopsResponse> {
         if count <= 0 {
-            return Err(AppError::BadRequest("Count must be positive".into()));
+            return Err(AppError::Game(ErrorCode::NoTroops, "Count must be positive".into()));
         }
 
         // Check requirements
@@ -85,13 +101,14 @@ impl TroopService {
             || village.iron < total_cost.iron
             || village.crop < total_cost.crop
         {
-            return Err(AppError::BadRequest("Not enough resources".into()));
+            return Err(ErrorCode::InsufficientResources.into());
         }
 
-        // Deduct resources
-        VillageRepository::deduct_resources(
+        // Deduct resources, failing if the village changed since it was read
+        VillageRepository::deduct_resources_versioned(
             pool,
             village_id,
+            village.version,
             total_cost.wood,
             total_cost.clay,
             total_cost.iron,
@@ -101,7 +118,7 @@ impl TroopService {
 
         // Calculate start and end time
         // If there's already a queue, start after the last item
-        let now = Utc::now();
+        let now = clock::now();
         let started_at = TroopRepository::get_last_queue_end_time(pool, village_id)
             .await?
             .unwrap_or(now);
@@ -127,16 +144,8 @@ impl TroopService {
 
     /// Complete training from queue (called by background job)
     pub async fn complete_training(pool: &PgPool, queue_id: Uuid) -> AppResult<()> {
-        // Get queue entry
-        let queue = TroopRepository::get_queue_by_village(pool, Uuid::nil()).await?;
-        let entry = queue.iter().find(|q| q.id == queue_id);
-
-        if let Some(entry) = entry {
-            // Add troops to village
-            TroopRepository::add_troops(pool, entry.village_id, entry.troop_type, entry.count).await?;
-
-            // Remove from queue
-            TroopRepository::remove_from_queue(pool, queue_id).await?;
+        if let Some(entry) = TroopRepository::find_queue_by_id(pool, queue_id).await? {
+            TroopRepository::complete_training(pool, &entry).await?;
         }
 
         Ok(())
@@ -144,15 +153,23 @@ impl TroopService {
 
     /// Process all completed training (called by background job)
     pub async fn process_completed_training(pool: &PgPool) -> AppResult<i32> {
-        let completed = TroopRepository::find_completed_training(pool).await?;
-        let count = completed.len() as i32;
+        Self::complete_due_training(pool, clock::clock()).await
+    }
 
-        for entry in completed {
-            // Add troops to village
-            TroopRepository::add_troops(pool, entry.village_id, entry.troop_type, entry.count).await?;
+    /// Complete every entry of `queue` finished by `clock`'s time
+    pub async fn complete_due_training(
+        queue: &dyn TrainingQueue,
+        clock: &dyn Clock,
+    ) -> AppResult<i32> {
+        let completed = queue.find_completed(clock.now()).await?;
 
-            // Remove from queue
-            TroopRepository::remove_from_queue(pool, entry.id).await?;
+        // Entries a catch-up pass or another instance completed first are
+        // skipped rather than trained twice
+        let mut count = 0;
+        for entry in completed {
+            if queue.complete(&entry).await? {
+                count += 1;
+            }
         }
 
         Ok(count)
@@ -171,9 +188,12 @@ impl TroopService {
             .ok_or_else(|| AppError::NotFound("Queue entry not found".into()))?;
 
         // Only allow canceling if not yet started
-        let now = Utc::now();
+        let now = clock::now();
         if entry.started_at <= now {
-            return Err(AppError::BadRequest("Cannot cancel training in progress".into()));
+            return Err(AppError::Game(
+                ErrorCode::CannotCancel,
+                "Cannot cancel training in progress".into(),
+            ));
         }
 
         // Get troop definition for refund calculation
@@ -187,12 +207,16 @@ impl TroopService {
         let iron_refund = (definition.iron_cost * entry.count * 3) / 4;
         let crop_refund = (definition.crop_cost * entry.count * 3) / 4;
 
+        // Remove from queue first; only the request that removes it gets the refund
+        if !TroopRepository::remove_from_queue_versioned(pool, queue_id, entry.version).await? {
+            return Err(AppError::VersionConflict(
+                "Queue entry was modified, please retry".into(),
+            ));
+        }
+
         VillageRepository::add_resources(pool, village_id, wood_refund, clay_refund, iron_refund, crop_refund)
             .await?;
 
-        // Remove from queue
-        TroopRepository::remove_from_queue(pool, queue_id).await?;
-
         Ok(())
     }
 
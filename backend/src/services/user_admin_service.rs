@@ -0,0 +1,154 @@
+use serde_json::{Map, Value};
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::account::{
+    AuthUserRecord, CreateTestUserRequest, NewAuthUser, MAX_CLAIMS_BYTES, MAX_LOOKUP_UIDS,
+    RESERVED_CLAIMS,
+};
+use crate::models::troop::TribeType;
+use crate::models::user::{CreateUser, User};
+use crate::repositories::session_repo::SessionRepository;
+use crate::repositories::user_repo::UserRepository;
+use crate::services::clock;
+use crate::services::firebase_admin::UserAdmin;
+use crate::AppState;
+
+/// Admin and anti-cheat actions on players' sign-in accounts
+pub struct UserAdminService;
+
+impl UserAdminService {
+    /// Create a sign-in account and its player, for seeding test worlds
+    pub async fn create_test_user(
+        state: &AppState,
+        request: CreateTestUserRequest,
+    ) -> AppResult<User> {
+        let user_admin = user_admin(state)?;
+
+        let tribe = request.tribe.unwrap_or(TribeType::Phasuttha);
+        if !tribe.is_playable() {
+            return Err(AppError::BadRequest("Not a playable tribe".into()));
+        }
+        if request.password.len() < 6 {
+            return Err(AppError::ValidationError(
+                "Password must be at least 6 characters".into(),
+            ));
+        }
+        if UserRepository::find_by_email(&state.db, &request.email)
+            .await?
+            .is_some()
+        {
+            return Err(AppError::Conflict("That email is already in use".into()));
+        }
+
+        let uid = user_admin
+            .create_user(&NewAuthUser {
+                email: request.email.clone(),
+                password: request.password,
+                display_name: request.display_name.clone(),
+            })
+            .await?;
+
+        let user = UserRepository::create(
+            &state.db,
+            CreateUser {
+                firebase_uid: uid,
+                email: Some(request.email),
+                display_name: request.display_name,
+                photo_url: None,
+                provider: "password".to_string(),
+                tribe,
+            },
+        )
+        .await?;
+
+        info!("Created test user {} ({})", user.id, user.firebase_uid);
+
+        Ok(user)
+    }
+
+    /// Ban or unban a player. A ban blocks sign-in and also logs out every
+    /// device right away, instead of when their ID tokens expire.
+    pub async fn set_disabled(state: &AppState, user_id: Uuid, disabled: bool) -> AppResult<()> {
+        let user_admin = user_admin(state)?;
+        let user = find_player(state, user_id).await?;
+
+        user_admin
+            .set_disabled(&user.firebase_uid, disabled)
+            .await?;
+        if disabled {
+            user_admin.revoke_refresh_tokens(&user.firebase_uid).await?;
+            SessionRepository::revoke_all_for_user(&state.db, user.id, clock::now()).await?;
+        }
+
+        info!(
+            "Player {} {}",
+            user.id,
+            if disabled { "disabled" } else { "enabled" }
+        );
+
+        Ok(())
+    }
+
+    /// Replace a player's custom claims; they reach the client with its
+    /// next ID token
+    pub async fn set_claims(
+        state: &AppState,
+        user_id: Uuid,
+        claims: Map<String, Value>,
+    ) -> AppResult<()> {
+        let user_admin = user_admin(state)?;
+
+        if let Some(reserved) = claims
+            .keys()
+            .find(|k| RESERVED_CLAIMS.contains(&k.as_str()))
+        {
+            return Err(AppError::ValidationError(format!(
+                "\"{}\" is a reserved claim",
+                reserved
+            )));
+        }
+        if serde_json::to_string(&claims).map_or(0, |c| c.len()) > MAX_CLAIMS_BYTES {
+            return Err(AppError::ValidationError(format!(
+                "Claims must serialize to at most {} bytes",
+                MAX_CLAIMS_BYTES
+            )));
+        }
+
+        let user = find_player(state, user_id).await?;
+        user_admin
+            .set_custom_claims(&user.firebase_uid, &claims)
+            .await?;
+
+        info!("Custom claims of player {} set", user.id);
+
+        Ok(())
+    }
+
+    /// Sign-in accounts by Firebase UID; unknown UIDs are left out
+    pub async fn lookup(state: &AppState, uids: &[String]) -> AppResult<Vec<AuthUserRecord>> {
+        let user_admin = user_admin(state)?;
+
+        if uids.len() > MAX_LOOKUP_UIDS {
+            return Err(AppError::ValidationError(format!(
+                "At most {} UIDs per lookup",
+                MAX_LOOKUP_UIDS
+            )));
+        }
+
+        Ok(user_admin.lookup(uids).await?)
+    }
+}
+
+fn user_admin(state: &AppState) -> AppResult<&dyn UserAdmin> {
+    state.user_admin.as_deref().ok_or_else(|| {
+        AppError::ServiceUnavailable("User administration needs Firebase auth".into())
+    })
+}
+
+async fn find_player(state: &AppState, user_id: Uuid) -> AppResult<User> {
+    UserRepository::find_by_id(&state.db, user_id)
+        .await?
+        .ok_or_else(|| AppError::NotFound("Player not found".into()))
+}
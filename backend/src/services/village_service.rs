@@ -1,11 +1,24 @@
-use sqlx::PgPool;
+use std::collections::HashSet;
+
+use sqlx::{PgConnection, PgPool};
 use uuid::Uuid;
 
-use crate::error::AppResult;
+use tracing::info;
+
+use crate::error::{AppError, AppResult};
 use crate::models::building::{Building, BuildingType, CreateBuilding};
-use crate::models::village::{CreateVillage, Village};
+use crate::models::gamedata::definitions;
+use crate::models::village::{
+    CreateVillage, CropperTile, FieldType, Village, CROPPER_SEARCH_MAX_RANGE,
+    NON_CAPITAL_FIELD_MAX_LEVEL, WORLD_RADIUS,
+};
 use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::oasis_repo::OasisRepository;
+use crate::repositories::user_repo::UserRepository;
 use crate::repositories::village_repo::VillageRepository;
+use crate::services::building_service::BuildingService;
+use crate::services::clock;
+use crate::services::village_stats_service::VillageStatsService;
 
 pub struct VillageService;
 
@@ -14,21 +27,122 @@ impl VillageService {
     pub async fn create_village_with_buildings(
         pool: &PgPool,
         input: CreateVillage,
+    ) -> AppResult<(Village, Vec<Building>)> {
+        let mut tx = pool.begin().await?;
+        let created = Self::create_village_in(&mut tx, input).await?;
+        tx.commit().await?;
+
+        Ok(created)
+    }
+
+    /// Create a new village with initial buildings on a transaction the
+    /// caller commits, for checks that must hold until the village exists
+    pub async fn create_village_in(
+        conn: &mut PgConnection,
+        input: CreateVillage,
     ) -> AppResult<(Village, Vec<Building>)> {
         // Create village
-        let village = VillageRepository::create(pool, input).await?;
+        let village = VillageRepository::create(&mut *conn, input).await?;
 
-        // Create initial buildings
-        let buildings = Self::create_initial_buildings(pool, village.id).await?;
+        // Create initial buildings, and count them towards the village's stats
+        let buildings =
+            Self::create_initial_buildings(conn, village.id, village.field_type).await?;
+        let (population, culture_per_day) = VillageStatsService::expected(&buildings);
+        let village = VillageRepository::update_stats(
+            &mut *conn,
+            village.id,
+            population,
+            culture_per_day,
+            clock::now(),
+        )
+        .await?;
 
         Ok((village, buildings))
     }
 
+    /// Move the player's capital to a village with a palace. The old
+    /// capital's resource fields drop back to the non-capital cap.
+    pub async fn set_capital(pool: &PgPool, village: &Village) -> AppResult<Village> {
+        if village.is_capital {
+            return Err(AppError::Conflict("Village is already the capital".into()));
+        }
+
+        let palaces =
+            BuildingRepository::find_by_type(pool, village.id, BuildingType::Palace).await?;
+        if palaces.iter().all(|b| b.level == 0) {
+            return Err(AppError::BadRequest(
+                "A palace is needed to make a village the capital".into(),
+            ));
+        }
+
+        let previous = VillageRepository::find_by_user_id(pool, village.user_id)
+            .await?
+            .into_iter()
+            .find(|v| v.is_capital);
+
+        let updated = VillageRepository::set_capital(pool, village.user_id, village.id).await?;
+
+        if let Some(previous) = previous {
+            let capped =
+                BuildingRepository::cap_field_levels(pool, previous.id, NON_CAPITAL_FIELD_MAX_LEVEL)
+                    .await?;
+            if capped > 0 {
+                BuildingService::update_village_population(pool, previous.id).await?;
+            }
+            info!(
+                "Capital moved from village {} to {}, {} fields capped",
+                previous.id, village.id, capped
+            );
+        }
+
+        Ok(updated)
+    }
+
+    /// Tear down what a conquered village can't keep under its new owner:
+    /// the palace, tribe buildings of another tribe, and fields above the
+    /// non-capital cap
+    pub async fn strip_on_conquest(
+        pool: &PgPool,
+        village_id: Uuid,
+        new_owner_id: Uuid,
+    ) -> AppResult<()> {
+        let new_tribe = UserRepository::find_by_id(pool, new_owner_id)
+            .await?
+            .map(|u| u.tribe);
+
+        let mut demolish = vec![BuildingType::Palace];
+        for building_type in BuildingType::ALL {
+            let owner = definitions().building_tribe(building_type);
+            if owner.is_some() && owner != new_tribe {
+                demolish.push(building_type.clone());
+            }
+        }
+
+        let mut removed = 0;
+        for building_type in demolish {
+            removed += BuildingRepository::demolish_by_type(pool, village_id, building_type).await?;
+        }
+        let capped =
+            BuildingRepository::cap_field_levels(pool, village_id, NON_CAPITAL_FIELD_MAX_LEVEL)
+                .await?;
+
+        BuildingService::update_village_storage(pool, village_id).await?;
+        BuildingService::update_village_population(pool, village_id).await?;
+
+        info!(
+            "Conquered village {}: {} buildings demolished, {} fields capped",
+            village_id, removed, capped
+        );
+
+        Ok(())
+    }
+
     /// Create initial buildings for a new village
     /// Based on Travian's starting layout
     async fn create_initial_buildings(
-        pool: &PgPool,
+        conn: &mut PgConnection,
         village_id: Uuid,
+        field_type: FieldType,
     ) -> AppResult<Vec<Building>> {
         let mut buildings = Vec::new();
 
@@ -40,45 +154,70 @@ impl VillageService {
         ];
 
         for (slot, building_type, level) in village_buildings {
-            let building = create_building_with_level(pool, village_id, slot, building_type, level).await?;
+            let building = create_building_with_level(conn, village_id, slot, building_type, level).await?;
             buildings.push(building);
         }
 
-        // Resource fields (slots 101-118)
-        // 4 Woodcutter, 4 Clay Pit, 4 Iron Mine, 6 Crop Field
-        let resource_fields = vec![
-            // Woodcutters (slots 101-104)
-            (101, BuildingType::Woodcutter),
-            (102, BuildingType::Woodcutter),
-            (103, BuildingType::Woodcutter),
-            (104, BuildingType::Woodcutter),
-            // Clay Pits (slots 105-108)
-            (105, BuildingType::ClayPit),
-            (106, BuildingType::ClayPit),
-            (107, BuildingType::ClayPit),
-            (108, BuildingType::ClayPit),
-            // Iron Mines (slots 109-112)
-            (109, BuildingType::IronMine),
-            (110, BuildingType::IronMine),
-            (111, BuildingType::IronMine),
-            (112, BuildingType::IronMine),
-            // Crop Fields (slots 113-118)
-            (113, BuildingType::CropField),
-            (114, BuildingType::CropField),
-            (115, BuildingType::CropField),
-            (116, BuildingType::CropField),
-            (117, BuildingType::CropField),
-            (118, BuildingType::CropField),
-        ];
+        // Resource fields (slots 101-118), as many of each as the tile's
+        // field type has: woodcutters first, then clay pits, iron mines
+        // and crop fields
+        let (wood, clay, iron, crop) = field_type.counts();
+        let resource_fields = [
+            (BuildingType::Woodcutter, wood),
+            (BuildingType::ClayPit, clay),
+            (BuildingType::IronMine, iron),
+            (BuildingType::CropField, crop),
+        ]
+        .into_iter()
+        .flat_map(|(building_type, count)| std::iter::repeat(building_type).take(count as usize))
+        .zip(101..);
 
-        for (slot, building_type) in resource_fields {
-            let building = create_building_with_level(pool, village_id, slot, building_type, 0).await?;
+        for (building_type, slot) in resource_fields {
+            let building = create_building_with_level(conn, village_id, slot, building_type, 0).await?;
             buildings.push(building);
         }
 
         Ok(buildings)
     }
 
+    /// Free 9- and 15-cropper tiles within `range` of a point, nearest
+    /// first. Tiles with a village or an oasis aren't free.
+    pub async fn find_croppers(
+        pool: &PgPool,
+        x: i32,
+        y: i32,
+        range: i32,
+    ) -> AppResult<Vec<CropperTile>> {
+        let range = range.clamp(1, CROPPER_SEARCH_MAX_RANGE);
+        let villages = VillageRepository::find_in_range(pool, x, y, range).await?;
+        let oases = OasisRepository::find_in_range(pool, x, y, range).await?;
+        let taken: HashSet<(i32, i32)> = villages
+            .iter()
+            .map(|v| (v.x, v.y))
+            .chain(oases.iter().map(|o| (o.x, o.y)))
+            .collect();
+
+        let mut croppers = Vec::new();
+        for ty in (y - range).max(-WORLD_RADIUS)..=(y + range).min(WORLD_RADIUS) {
+            for tx in (x - range).max(-WORLD_RADIUS)..=(x + range).min(WORLD_RADIUS) {
+                let field_type = FieldType::at(tx, ty);
+                if !field_type.is_cropper() || taken.contains(&(tx, ty)) {
+                    continue;
+                }
+                let (dx, dy) = ((tx - x) as f64, (ty - y) as f64);
+                croppers.push(CropperTile {
+                    x: tx,
+                    y: ty,
+                    field_type,
+                    distance: (dx * dx + dy * dy).sqrt(),
+                });
+            }
+        }
+        croppers.sort_by(|a, b| a.distance.total_cmp(&b.distance));
+
+        Ok(croppers)
+    }
+
     /// Find a random available coordinate for new village
     pub async fn find_available_coordinates(
         pool: &PgPool,
@@ -108,7 +247,7 @@ impl VillageService {
 }
 
 async fn create_building_with_level(
-    pool: &PgPool,
+    conn: &mut PgConnection,
     village_id: Uuid,
     slot: i32,
     building_type: BuildingType,
@@ -121,7 +260,7 @@ async fn create_building_with_level(
     };
 
     // Create building (starts at level 1 by default)
-    let building = BuildingRepository::create(pool, create).await?;
+    let building = BuildingRepository::create(&mut *conn, create).await?;
 
     // If level is different, update it
     if level != 1 {
@@ -132,12 +271,12 @@ async fn create_building_with_level(
             SET level = $2, updated_at = NOW()
             WHERE id = $1
             RETURNING id, village_id, building_type, slot, level,
-                      is_upgrading, upgrade_ends_at, created_at, updated_at
+                      is_upgrading, upgrade_ends_at, created_at, updated_at, version
             "#,
         )
         .bind(building.id)
         .bind(level)
-        .fetch_one(pool)
+        .fetch_one(conn)
         .await?;
 
         return Ok(updated);
@@ -0,0 +1,98 @@
+use sqlx::PgPool;
+use tracing::warn;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::building::Building;
+use crate::models::village::{villages_allowed, StatsReconcileResult, Village};
+use crate::repositories::building_repo::BuildingRepository;
+use crate::repositories::village_repo::VillageRepository;
+use crate::services::clock;
+
+/// Population and culture production are derived from buildings but
+/// stored on the village, as rankings and expansion slots read them
+pub struct VillageStatsService;
+
+impl VillageStatsService {
+    /// (population, culture per day) the buildings add up to
+    pub fn expected(buildings: &[Building]) -> (i32, i32) {
+        buildings.iter().fold((0, 0), |(population, culture), b| {
+            (
+                population + b.building_type.population_at_level(b.level),
+                culture + b.building_type.culture_points_at_level(b.level),
+            )
+        })
+    }
+
+    /// Recalculate a village's stats from its buildings
+    pub async fn recalculate(pool: &PgPool, village_id: Uuid) -> AppResult<Village> {
+        let buildings = BuildingRepository::find_by_village_id(pool, village_id).await?;
+        let (population, culture_per_day) = Self::expected(&buildings);
+
+        VillageRepository::update_stats(pool, village_id, population, culture_per_day, clock::now())
+            .await
+    }
+
+    /// Pay out culture points produced since the last run
+    pub async fn accrue_culture(pool: &PgPool) -> AppResult<u64> {
+        VillageRepository::accrue_culture(pool, clock::now()).await
+    }
+
+    /// Check every village's stored stats against its buildings and fix
+    /// any that drifted
+    pub async fn reconcile(pool: &PgPool) -> AppResult<StatsReconcileResult> {
+        let mut result = StatsReconcileResult::default();
+
+        for (village_id, population, culture_per_day) in VillageRepository::list_stats(pool).await?
+        {
+            result.checked += 1;
+
+            let buildings = BuildingRepository::find_by_village_id(pool, village_id).await?;
+            let (expected_population, expected_culture) = Self::expected(&buildings);
+            if expected_population == population && expected_culture == culture_per_day {
+                continue;
+            }
+
+            if expected_population != population {
+                result.population_fixed += 1;
+            }
+            if expected_culture != culture_per_day {
+                result.culture_fixed += 1;
+            }
+            warn!(
+                "Village {} drifted: population {} (expected {}), culture {}/day (expected {})",
+                village_id, population, expected_population, culture_per_day, expected_culture
+            );
+
+            VillageRepository::update_stats(
+                pool,
+                village_id,
+                expected_population,
+                expected_culture,
+                clock::now(),
+            )
+            .await?;
+        }
+
+        Ok(result)
+    }
+
+    /// Villages whose stored population disagrees with their buildings
+    pub async fn population_drift(pool: &PgPool) -> AppResult<Vec<Uuid>> {
+        let mut drifted = Vec::new();
+        for (village_id, population, _) in VillageRepository::list_stats(pool).await? {
+            let buildings = BuildingRepository::find_by_village_id(pool, village_id).await?;
+            if Self::expected(&buildings).0 != population {
+                drifted.push(village_id);
+            }
+        }
+
+        Ok(drifted)
+    }
+
+    /// (villages allowed, total culture points) for a player
+    pub async fn expansion_slots(pool: &PgPool, user_id: Uuid) -> AppResult<(i64, i64)> {
+        let total = VillageRepository::total_culture_points(pool, user_id).await?;
+        Ok((villages_allowed(total), total))
+    }
+}
@@ -0,0 +1,257 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use std::collections::HashMap;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::activity::{ActivityKind, RequestOrigin};
+use crate::models::army::{PlanArmyRequest, SendArmyRequest};
+use crate::models::wave::{
+    DueWaveSend, PlanWaveRequest, WavePlanResponse, WaveResponse, WaveSendPlan, MAX_PLANNED_WAVES,
+    MAX_SCHEDULE_AHEAD_HOURS, MAX_WAVE_SENDS, MIN_SCHEDULE_LEAD_SECS,
+};
+use crate::repositories::village_repo::VillageRepository;
+use crate::repositories::wave_repo::WaveRepository;
+use crate::services::activity_service::ActivityService;
+use crate::services::army_service::ArmyService;
+use crate::services::clock;
+
+/// Waves listed per player
+const WAVE_LIST_LIMIT: i64 = 50;
+
+/// Sends handled per scheduler run
+const SEND_BATCH: i64 = 200;
+
+/// Armies from several villages timed to land together
+pub struct WaveService;
+
+impl WaveService {
+    /// Work out when each army must leave to land at the same moment, and
+    /// optionally store the wave for the server to send
+    pub async fn plan(
+        pool: &PgPool,
+        player_id: Uuid,
+        request: PlanWaveRequest,
+    ) -> AppResult<WavePlanResponse> {
+        if request.sends.is_empty() {
+            return Err(AppError::BadRequest(
+                "A wave needs at least one army".into(),
+            ));
+        }
+        if request.sends.len() > MAX_WAVE_SENDS {
+            return Err(AppError::BadRequest(format!(
+                "A wave can coordinate at most {} armies",
+                MAX_WAVE_SENDS
+            )));
+        }
+
+        let mut travel = Vec::with_capacity(request.sends.len());
+        for send in &request.sends {
+            Self::check_village(pool, player_id, send.from_village_id).await?;
+            let plan = ArmyService::plan_army(
+                pool,
+                send.from_village_id,
+                PlanArmyRequest {
+                    to_x: request.to_x,
+                    to_y: request.to_y,
+                    mission: send.mission,
+                    troops: send.troops.clone(),
+                },
+            )
+            .await?;
+            travel.push(Duration::seconds(plan.travel_seconds));
+        }
+
+        let now = clock::now();
+        let lead = if request.schedule {
+            Duration::seconds(MIN_SCHEDULE_LEAD_SECS)
+        } else {
+            Duration::zero()
+        };
+        let slowest = travel.iter().copied().max().unwrap_or_else(Duration::zero);
+        let earliest = now + lead + slowest;
+
+        let arrive_at = request.arrive_at.unwrap_or(earliest);
+        if arrive_at < earliest {
+            return Err(AppError::BadRequest(format!(
+                "The slowest army can't land before {}",
+                earliest
+            )));
+        }
+
+        let send_times: Vec<_> = travel.iter().map(|t| arrive_at - *t).collect();
+        let sends = request
+            .sends
+            .iter()
+            .zip(&travel)
+            .zip(&send_times)
+            .map(|((send, travel), send_at)| WaveSendPlan {
+                from_village_id: send.from_village_id,
+                travel_seconds: travel.num_seconds(),
+                send_at: *send_at,
+            })
+            .collect();
+
+        if !request.schedule {
+            return Ok(WavePlanResponse {
+                arrive_at,
+                sends,
+                wave: None,
+            });
+        }
+
+        let last_send = send_times.iter().max().copied().unwrap_or(now);
+        if last_send > now + Duration::hours(MAX_SCHEDULE_AHEAD_HOURS) {
+            return Err(AppError::BadRequest(format!(
+                "Sends can be scheduled at most {} hours ahead",
+                MAX_SCHEDULE_AHEAD_HOURS
+            )));
+        }
+        if WaveRepository::count_planned(pool, player_id).await? >= MAX_PLANNED_WAVES {
+            return Err(AppError::BadRequest(format!(
+                "At most {} waves can be scheduled at once",
+                MAX_PLANNED_WAVES
+            )));
+        }
+
+        let wave = WaveRepository::create(
+            pool,
+            player_id,
+            request.to_x,
+            request.to_y,
+            arrive_at,
+            &request.sends,
+            &send_times,
+        )
+        .await?;
+
+        info!(
+            "Player {} scheduled a wave of {} armies on ({}, {}) landing at {}",
+            player_id,
+            request.sends.len(),
+            request.to_x,
+            request.to_y,
+            arrive_at
+        );
+
+        let sends_stored = WaveRepository::find_sends(pool, &[wave.id]).await?;
+        Ok(WavePlanResponse {
+            arrive_at,
+            sends,
+            wave: Some(WaveResponse {
+                wave,
+                sends: sends_stored,
+            }),
+        })
+    }
+
+    pub async fn list(pool: &PgPool, player_id: Uuid) -> AppResult<Vec<WaveResponse>> {
+        let waves = WaveRepository::find_by_player(pool, player_id, WAVE_LIST_LIMIT).await?;
+        let ids: Vec<Uuid> = waves.iter().map(|w| w.id).collect();
+
+        let mut sends_by_wave: HashMap<Uuid, Vec<_>> = HashMap::new();
+        for send in WaveRepository::find_sends(pool, &ids).await? {
+            sends_by_wave.entry(send.wave_id).or_default().push(send);
+        }
+
+        Ok(waves
+            .into_iter()
+            .map(|wave| WaveResponse {
+                sends: sends_by_wave.remove(&wave.id).unwrap_or_default(),
+                wave,
+            })
+            .collect())
+    }
+
+    /// Cancel the sends of a wave that haven't left yet
+    pub async fn cancel(pool: &PgPool, player_id: Uuid, wave_id: Uuid) -> AppResult<WaveResponse> {
+        let wave = WaveRepository::find_by_id(pool, wave_id)
+            .await?
+            .filter(|w| w.player_id == player_id)
+            .ok_or_else(|| AppError::NotFound("Wave not found".into()))?;
+
+        let cancelled = WaveRepository::cancel(pool, wave_id).await?;
+        info!(
+            "Player {} cancelled {} sends of wave {}",
+            player_id, cancelled, wave_id
+        );
+
+        Ok(WaveResponse {
+            sends: WaveRepository::find_sends(pool, &[wave_id]).await?,
+            wave,
+        })
+    }
+
+    /// Send the scheduled armies that are due. Returns how many left.
+    pub async fn process_due(pool: &PgPool) -> AppResult<i32> {
+        let due = WaveRepository::find_due(pool, clock::now(), SEND_BATCH).await?;
+
+        let mut sent = 0;
+        for send in due {
+            if !WaveRepository::claim_send(pool, send.id, clock::now()).await? {
+                continue;
+            }
+            match Self::send(pool, &send).await {
+                Ok(army_id) => {
+                    WaveRepository::set_army(pool, send.id, army_id).await?;
+                    sent += 1;
+                }
+                Err(e) => {
+                    warn!("Scheduled send {} failed: {:?}", send.id, e);
+                    WaveRepository::set_failed(pool, send.id, &e.to_string()).await?;
+                }
+            }
+        }
+
+        Ok(sent)
+    }
+
+    async fn send(pool: &PgPool, send: &DueWaveSend) -> AppResult<Uuid> {
+        // The village may have been lost since the wave was planned
+        Self::check_village(pool, send.player_id, send.from_village_id).await?;
+
+        let army = ArmyService::send_army(
+            pool,
+            send.player_id,
+            send.from_village_id,
+            SendArmyRequest {
+                to_x: send.to_x,
+                to_y: send.to_y,
+                mission: send.mission,
+                troops: send.troops.0.clone(),
+                resources: Default::default(),
+                hero_id: send.hero_id,
+            },
+        )
+        .await?;
+
+        ActivityService::record_own(
+            pool,
+            send.player_id,
+            ActivityKind::ArmySent,
+            RequestOrigin::default(),
+            serde_json::json!({
+                "army_id": army.id,
+                "from_village_id": send.from_village_id,
+                "mission": army.mission,
+                "to_x": army.to_x,
+                "to_y": army.to_y,
+                "troops": army.troops,
+                "scheduled": true,
+            }),
+        );
+
+        Ok(army.id)
+    }
+
+    async fn check_village(pool: &PgPool, player_id: Uuid, village_id: Uuid) -> AppResult<()> {
+        let village = VillageRepository::find_by_id(pool, village_id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("Village not found".into()))?;
+        if village.user_id != player_id {
+            return Err(AppError::Forbidden("Access denied".into()));
+        }
+        Ok(())
+    }
+}
@@ -0,0 +1,190 @@
+use std::io::Write;
+
+use chrono::{Duration, Utc};
+use flate2::write::GzEncoder;
+use flate2::Compression;
+use hmac::{Hmac, Mac};
+use sha2::Sha256;
+use sqlx::PgPool;
+use tracing::info;
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::world_dump::{
+    DumpDownloadQuery, DumpVillage, WorldDump, WorldDumpLink, WorldDumpRunResult, DUMPS_LISTED,
+    DUMP_LINK_TTL_SECS,
+};
+use crate::repositories::world_dump_repo::WorldDumpRepository;
+use crate::services::archive_store::ArchiveStore;
+
+type HmacSha256 = Hmac<Sha256>;
+
+/// Public world data exports, in the map.sql tradition: one row per village
+/// with coordinates, population, owner and alliance. Nothing goes in that
+/// the map and rankings don't already show.
+pub struct WorldDumpService;
+
+impl WorldDumpService {
+    /// Export the world as gzipped SQL and CSV
+    pub async fn run(pool: &PgPool, store: &ArchiveStore) -> AppResult<WorldDumpRunResult> {
+        let villages = WorldDumpRepository::export_villages(pool).await?;
+        let stamp = Utc::now().format("%Y-%m-%d/%H%M%S");
+
+        let mut result = WorldDumpRunResult {
+            village_count: villages.len(),
+            dumps: Vec::new(),
+        };
+        for (format, body) in [("sql", to_sql(&villages)), ("csv", to_csv(&villages))] {
+            let compressed = gzip(body.as_bytes())?;
+            let size = compressed.len() as i64;
+            let key = format!("world_dumps/{}/map.{}.gz", stamp, format);
+            store.put(&key, compressed, "application/gzip").await?;
+
+            let dump = WorldDumpRepository::create(pool, format, &key, villages.len() as i32, size)
+                .await?;
+            result.dumps.push(dump);
+        }
+
+        info!("World dump written: {} villages", villages.len());
+
+        Ok(result)
+    }
+
+    /// Recent dumps with download links valid for an hour
+    pub async fn links(pool: &PgPool, secret: &str) -> AppResult<Vec<WorldDumpLink>> {
+        let expires_at = Utc::now() + Duration::seconds(DUMP_LINK_TTL_SECS);
+        let expires = expires_at.timestamp();
+
+        let dumps = WorldDumpRepository::list_recent(pool, DUMPS_LISTED).await?;
+        dumps
+            .into_iter()
+            .map(|d| {
+                let signature = sign(secret, d.id, expires)?;
+                Ok(WorldDumpLink {
+                    url: format!(
+                        "/api/world/dumps/{}/download?expires={}&signature={}",
+                        d.id, expires, signature
+                    ),
+                    id: d.id,
+                    format: d.format,
+                    village_count: d.village_count,
+                    size_bytes: d.size_bytes,
+                    created_at: d.created_at,
+                    expires_at,
+                })
+            })
+            .collect()
+    }
+
+    /// The dump's file, if the link is genuine and hasn't expired
+    pub async fn download(
+        pool: &PgPool,
+        store: &ArchiveStore,
+        secret: &str,
+        id: Uuid,
+        query: &DumpDownloadQuery,
+    ) -> AppResult<(WorldDump, Vec<u8>)> {
+        if query.expires < Utc::now().timestamp() {
+            return Err(AppError::Forbidden("Download link has expired".into()));
+        }
+        verify(secret, id, query.expires, &query.signature)?;
+
+        let dump = WorldDumpRepository::find_by_id(pool, id)
+            .await?
+            .ok_or_else(|| AppError::NotFound("World dump not found".into()))?;
+        let body = store.get(&dump.object_key).await?;
+
+        Ok((dump, body))
+    }
+}
+
+fn mac(secret: &str, id: Uuid, expires: i64) -> AppResult<HmacSha256> {
+    let mut mac = HmacSha256::new_from_slice(secret.as_bytes())
+        .map_err(|_| AppError::InternalError(anyhow::anyhow!("Invalid secret key")))?;
+    mac.update(format!("{}:{}", id, expires).as_bytes());
+    Ok(mac)
+}
+
+fn sign(secret: &str, id: Uuid, expires: i64) -> AppResult<String> {
+    Ok(hex::encode(
+        mac(secret, id, expires)?.finalize().into_bytes(),
+    ))
+}
+
+fn verify(secret: &str, id: Uuid, expires: i64, signature: &str) -> AppResult<()> {
+    let signature =
+        hex::decode(signature).map_err(|_| AppError::Forbidden("Invalid download link".into()))?;
+    mac(secret, id, expires)?
+        .verify_slice(&signature)
+        .map_err(|_| AppError::Forbidden("Invalid download link".into()))
+}
+
+fn gzip(data: &[u8]) -> AppResult<Vec<u8>> {
+    let mut encoder = GzEncoder::new(Vec::new(), Compression::default());
+    encoder.write_all(data).map_err(anyhow::Error::from)?;
+    Ok(encoder.finish().map_err(anyhow::Error::from)?)
+}
+
+/// `INSERT INTO x_world` statements, one per village
+fn to_sql(villages: &[DumpVillage]) -> String {
+    let mut out = String::from(
+        "CREATE TABLE IF NOT EXISTS x_world (village_id UUID, x INTEGER, y INTEGER, \
+         village_name TEXT, population INTEGER, player_id UUID, player_name TEXT, tribe TEXT, \
+         alliance_id UUID, alliance_tag TEXT);\n",
+    );
+    for v in villages {
+        out.push_str(&format!(
+            "INSERT INTO x_world VALUES ('{}',{},{},{},{},'{}',{},{},{},{});\n",
+            v.village_id,
+            v.x,
+            v.y,
+            sql_text(Some(&v.village_name)),
+            v.population,
+            v.player_id,
+            sql_text(v.player_name.as_deref()),
+            sql_text(Some(&v.tribe)),
+            v.alliance_id
+                .map_or("NULL".to_string(), |id| format!("'{}'", id)),
+            sql_text(v.alliance_tag.as_deref()),
+        ));
+    }
+    out
+}
+
+fn sql_text(value: Option<&str>) -> String {
+    match value {
+        Some(s) => format!("'{}'", s.replace('\'', "''")),
+        None => "NULL".to_string(),
+    }
+}
+
+/// The same columns as the SQL dump, with a header row
+fn to_csv(villages: &[DumpVillage]) -> String {
+    let mut out = String::from(
+        "village_id,x,y,village_name,population,player_id,player_name,tribe,alliance_id,alliance_tag\n",
+    );
+    for v in villages {
+        out.push_str(&format!(
+            "{},{},{},{},{},{},{},{},{},{}\n",
+            v.village_id,
+            v.x,
+            v.y,
+            csv_field(&v.village_name),
+            v.population,
+            v.player_id,
+            csv_field(v.player_name.as_deref().unwrap_or("")),
+            v.tribe,
+            v.alliance_id.map(|id| id.to_string()).unwrap_or_default(),
+            csv_field(v.alliance_tag.as_deref().unwrap_or("")),
+        ));
+    }
+    out
+}
+
+fn csv_field(value: &str) -> String {
+    if value.contains([',', '"', '\n', '\r']) {
+        format!("\"{}\"", value.replace('"', "\"\""))
+    } else {
+        value.to_string()
+    }
+}
@@ -0,0 +1,73 @@
+use chrono::{Datelike, Duration, NaiveDate};
+use sqlx::PgPool;
+
+use crate::error::{AppError, AppResult};
+use crate::models::world_stats::{
+    WorldStatsResponse, WorldStatsRunResult, STATS_HISTORY_DAYS, TOP_COMBATANTS,
+};
+use crate::repositories::world_stats_repo::WorldStatsRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+
+/// Aggregate world statistics for the statistics screen and live-ops
+pub struct WorldStatsService;
+
+impl WorldStatsService {
+    /// Bring today's and yesterday's rows and this week's combat totals up
+    /// to date. Yesterday is redone so late battles land in the final row.
+    pub async fn refresh(pool: &PgPool) -> AppResult<WorldStatsRunResult> {
+        let today = clock::now().date_naive();
+        let days = [today - Duration::days(1), today];
+        for day in days {
+            WorldStatsRepository::refresh_day(pool, day).await?;
+        }
+
+        let mut combatants = WorldStatsRepository::refresh_week(pool, week_start(today)).await?;
+        // Finish last week's totals on the first day of a new one
+        if today.weekday().num_days_from_monday() == 0 {
+            combatants +=
+                WorldStatsRepository::refresh_week(pool, week_start(today) - Duration::days(7))
+                    .await?;
+        }
+
+        CacheService::invalidate(&[CacheKey::WorldStats]).await;
+
+        Ok(WorldStatsRunResult {
+            days_refreshed: days.len(),
+            combatants,
+        })
+    }
+
+    /// The statistics screen. The default range is cached; other ranges
+    /// (live-ops looking further back) are read directly.
+    pub async fn overview(pool: &PgPool, days: i64) -> AppResult<WorldStatsResponse> {
+        if !(1..=365).contains(&days) {
+            return Err(AppError::BadRequest(
+                "days must be between 1 and 365".into(),
+            ));
+        }
+        if days == STATS_HISTORY_DAYS {
+            return CacheService::get_or_load(CacheKey::WorldStats, || Self::load(pool, days))
+                .await;
+        }
+        Self::load(pool, days).await
+    }
+
+    async fn load(pool: &PgPool, days: i64) -> AppResult<WorldStatsResponse> {
+        let today = clock::now().date_naive();
+        let week = week_start(today);
+
+        Ok(WorldStatsResponse {
+            daily: WorldStatsRepository::daily(pool, today - Duration::days(days - 1)).await?,
+            tribes: WorldStatsRepository::tribe_distribution(pool).await?,
+            week_start: week,
+            top_attackers: WorldStatsRepository::top_attackers(pool, week, TOP_COMBATANTS).await?,
+            top_defenders: WorldStatsRepository::top_defenders(pool, week, TOP_COMBATANTS).await?,
+        })
+    }
+}
+
+/// Monday of the week containing `day`
+fn week_start(day: NaiveDate) -> NaiveDate {
+    day - Duration::days(day.weekday().num_days_from_monday() as i64)
+}
@@ -0,0 +1,168 @@
+use chrono::Duration;
+use sqlx::PgPool;
+use tracing::{info, warn};
+use uuid::Uuid;
+
+use crate::error::{AppError, AppResult};
+use crate::models::world_setting::{
+    AnnouncedMilestones, UpdateWorldTimelineRequest, WorldTimelineSettings, WORLD_MILESTONES_KEY,
+    WORLD_TIMELINE_KEY,
+};
+use crate::models::world_status::{MilestoneStatus, WorldMilestone, WorldStatusResponse};
+use crate::repositories::village_repo::VillageRepository;
+use crate::repositories::world_setting_repo::WorldSettingRepository;
+use crate::services::cache_service::{CacheKey, CacheService};
+use crate::services::clock;
+use crate::services::region_service::RegionService;
+use crate::services::ws_service::{WorldMilestoneData, WsEvent, WsManager};
+
+/// The world's progress towards its end: how long it has run, when the
+/// endgame phases open, and who is winning
+pub struct WorldStatusService;
+
+impl WorldStatusService {
+    // ==================== Settings ====================
+
+    pub async fn get_settings(pool: &PgPool) -> AppResult<WorldTimelineSettings> {
+        let key = CacheKey::WorldSetting(WORLD_TIMELINE_KEY.to_string());
+        let stored = CacheService::get_or_load(key, || {
+            WorldSettingRepository::get(pool, WORLD_TIMELINE_KEY)
+        })
+        .await?;
+        let settings = match stored {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid world timeline setting, using defaults: {}", e);
+                WorldTimelineSettings::default()
+            }),
+            None => WorldTimelineSettings::default(),
+        };
+
+        Ok(settings)
+    }
+
+    pub async fn update_settings(
+        pool: &PgPool,
+        admin_id: Uuid,
+        request: UpdateWorldTimelineRequest,
+    ) -> AppResult<WorldTimelineSettings> {
+        let mut settings = Self::get_settings(pool).await?;
+
+        if let Some(started_at) = request.started_at {
+            settings.started_at = Some(started_at);
+        }
+        if let Some(day) = request.artifacts_release_day {
+            settings.artifacts_release_day = day;
+        }
+        if let Some(day) = request.wonder_plans_release_day {
+            settings.wonder_plans_release_day = day;
+        }
+
+        if settings.artifacts_release_day < 0 || settings.wonder_plans_release_day < 0 {
+            return Err(AppError::BadRequest(
+                "Release days cannot be negative".into(),
+            ));
+        }
+
+        let value = serde_json::to_value(&settings).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, WORLD_TIMELINE_KEY, &value, Some(admin_id)).await?;
+        CacheService::invalidate(&[CacheKey::WorldSetting(WORLD_TIMELINE_KEY.to_string())]).await;
+
+        info!("World timeline updated by {}: {:?}", admin_id, settings);
+
+        Ok(settings)
+    }
+
+    // ==================== Status ====================
+
+    pub async fn status(pool: &PgPool) -> AppResult<WorldStatusResponse> {
+        let settings = Self::get_settings(pool).await?;
+        let now = clock::now();
+
+        let started_at = match settings.started_at {
+            Some(started_at) => Some(started_at),
+            None => VillageRepository::first_founded_at(pool).await?,
+        };
+
+        let victory = if RegionService::get_settings(pool).await?.enabled {
+            Some(RegionService::leaderboard(pool).await?)
+        } else {
+            None
+        };
+        let won_at = victory
+            .as_ref()
+            .and_then(|v| v.winner.as_ref())
+            .map(|w| w.won_at);
+
+        let milestones = WorldMilestone::ALL
+            .iter()
+            .map(|milestone| {
+                let at = match milestone {
+                    WorldMilestone::Artifacts => started_at
+                        .map(|s| s + Duration::days(settings.artifacts_release_day as i64)),
+                    WorldMilestone::WonderPlans => started_at
+                        .map(|s| s + Duration::days(settings.wonder_plans_release_day as i64)),
+                    WorldMilestone::Victory => won_at,
+                };
+                let reached = at.is_some_and(|at| at <= now);
+                MilestoneStatus {
+                    milestone: *milestone,
+                    title: milestone.title(),
+                    at,
+                    reached,
+                    seconds_remaining: at.filter(|_| !reached).map(|at| (at - now).num_seconds()),
+                }
+            })
+            .collect();
+
+        Ok(WorldStatusResponse {
+            now,
+            paused: clock::is_paused(),
+            started_at,
+            days_elapsed: started_at.map_or(0, |s| (now - s).num_days().max(0)),
+            milestones,
+            victory,
+        })
+    }
+
+    // ==================== Milestone Events ====================
+
+    /// Broadcast every milestone reached since the last run. Returns how
+    /// many went out.
+    pub async fn announce_milestones(pool: &PgPool, ws_manager: &WsManager) -> AppResult<usize> {
+        let status = Self::status(pool).await?;
+
+        let mut announced = match WorldSettingRepository::get(pool, WORLD_MILESTONES_KEY).await? {
+            Some(setting) => serde_json::from_value(setting.value).unwrap_or_else(|e| {
+                warn!("Invalid announced milestones, starting over: {}", e);
+                AnnouncedMilestones::default()
+            }),
+            None => AnnouncedMilestones::default(),
+        };
+
+        let due: Vec<&MilestoneStatus> = status
+            .milestones
+            .iter()
+            .filter(|m| m.reached && !announced.milestones.contains(&m.milestone))
+            .collect();
+        if due.is_empty() {
+            return Ok(0);
+        }
+
+        // Recorded first so a milestone is never announced twice
+        announced.milestones.extend(due.iter().map(|m| m.milestone));
+        let value = serde_json::to_value(&announced).map_err(anyhow::Error::from)?;
+        WorldSettingRepository::upsert(pool, WORLD_MILESTONES_KEY, &value, None).await?;
+
+        for milestone in &due {
+            let event = WsEvent::WorldMilestone(WorldMilestoneData {
+                milestone: milestone.milestone.as_str().to_string(),
+                title: milestone.title.to_string(),
+                at: milestone.at.unwrap_or(status.now),
+            });
+            ws_manager.broadcast(&event).await;
+            info!("World milestone reached: {}", milestone.title);
+        }
+
+        Ok(due.len())
+    }
+}
@@ -0,0 +1,129 @@
+//! WebSocket wire protocol. The contract lives in schemas/ws-protocol.json;
+//! TypeScript types for the frontend are generated from it by the wsgen bin.
+//!
+//! Versions:
+//! - v1: `{"type": ..., "data": ...}`, what clients spoke before versioning
+//! - v2: `{"v": 2, "type": ..., "seq": N, "payload": ...}`, where `seq`
+//!   counts server messages on the connection starting at 1. Events buffered
+//!   for resume also carry `id`, which the client sends back as `?resume=`
+//!   when it reconnects (see ws_replay).
+//!
+//! The SSE fallback (handlers::sse) sends the same messages as `event: type`,
+//! `id:` and `data: payload`.
+//!
+//! Clients ask for a version with `?v=N` on connect. The server answers with
+//! the highest version it speaks that is not above N, and says which one in
+//! the `connected` message. Clients that send nothing get v1.
+
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+
+use crate::services::ws_service::{QueuedEvent, WsEvent};
+
+/// Oldest version still served
+pub const MIN_VERSION: u32 = 1;
+/// Newest version this server speaks
+pub const CURRENT_VERSION: u32 = 2;
+
+/// v2+ message frame
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Envelope {
+    pub v: u32,
+    #[serde(rename = "type")]
+    pub message_type: String,
+    pub seq: u64,
+    /// Resume cursor
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub id: Option<String>,
+    #[serde(default)]
+    pub payload: Value,
+}
+
+/// Messages a client may send
+#[derive(Debug, Deserialize)]
+#[serde(tag = "type", content = "payload", rename_all = "snake_case")]
+pub enum ClientMessage {
+    /// Answered with a `pong` carrying the game time; `client_time` (ms
+    /// since the epoch) is echoed so the client can measure the round trip
+    Ping {
+        #[serde(default)]
+        client_time: Option<i64>,
+    },
+    Subscribe { event_type: String },
+}
+
+/// v1 client messages carried their fields at the top level
+#[derive(Debug, Deserialize)]
+#[serde(tag = "type", rename_all = "snake_case")]
+enum LegacyClientMessage {
+    Ping {
+        #[serde(default)]
+        client_time: Option<i64>,
+    },
+    Subscribe { event_type: String },
+}
+
+impl From<LegacyClientMessage> for ClientMessage {
+    fn from(msg: LegacyClientMessage) -> Self {
+        match msg {
+            LegacyClientMessage::Ping { client_time } => ClientMessage::Ping { client_time },
+            LegacyClientMessage::Subscribe { event_type } => {
+                ClientMessage::Subscribe { event_type }
+            }
+        }
+    }
+}
+
+/// Pick the version to speak given what the client asked for
+pub fn negotiate(requested: Option<u32>) -> Result<u32, String> {
+    match requested {
+        None => Ok(MIN_VERSION),
+        Some(v) if v < MIN_VERSION => Err(format!(
+            "Protocol version {} is no longer supported (minimum {})",
+            v, MIN_VERSION
+        )),
+        Some(v) => Ok(v.min(CURRENT_VERSION)),
+    }
+}
+
+/// Serialize a server event for a connection speaking `version`
+pub fn encode(queued: &QueuedEvent, version: u32, seq: u64) -> serde_json::Result<String> {
+    let event: &WsEvent = &queued.event;
+    if version < 2 {
+        return serde_json::to_string(event);
+    }
+
+    let (message_type, payload) = split(event)?;
+    serde_json::to_string(&Envelope {
+        v: version,
+        message_type,
+        seq,
+        id: queued.id.clone(),
+        payload,
+    })
+}
+
+/// An event's message type and payload. WsEvent is adjacently tagged as
+/// {type, data}, which is the v1 frame; later frames and SSE reframe it.
+pub fn split(event: &WsEvent) -> serde_json::Result<(String, Value)> {
+    let mut value = serde_json::to_value(event)?;
+    let message_type = match value.get_mut("type").map(Value::take) {
+        Some(Value::String(s)) => s,
+        _ => String::new(),
+    };
+    let payload = value
+        .get_mut("data")
+        .map(Value::take)
+        .unwrap_or(Value::Null);
+
+    Ok((message_type, payload))
+}
+
+/// Parse a client message sent by a connection speaking `version`
+pub fn decode(text: &str, version: u32) -> serde_json::Result<ClientMessage> {
+    if version < 2 {
+        return serde_json::from_str::<LegacyClientMessage>(text).map(Into::into);
+    }
+
+    serde_json::from_str(text)
+}
@@ -0,0 +1,140 @@
+use tracing::warn;
+use uuid::Uuid;
+
+use crate::config::SyncConfig;
+use crate::db::redis::RedisConnection;
+use crate::services::ws_service::WsEvent;
+
+/// Recent events per player in a Redis stream, so a client that reconnects
+/// within the window can pick up where it left off instead of refetching
+/// everything. Stream entry ids double as resume cursors.
+#[derive(Clone)]
+pub struct ReplayBuffer {
+    redis: RedisConnection,
+    window_secs: u64,
+    limit: usize,
+}
+
+impl ReplayBuffer {
+    /// None when resume is switched off
+    pub fn new(redis: RedisConnection, config: &SyncConfig) -> Option<Self> {
+        if config.ws_resume_window_secs == 0 {
+            return None;
+        }
+
+        Some(Self {
+            redis,
+            window_secs: config.ws_resume_window_secs,
+            limit: config.ws_replay_limit,
+        })
+    }
+
+    fn key(user_id: Uuid) -> String {
+        format!("ws:replay:{}", user_id)
+    }
+
+    /// Buffer an event for the player. Returns its cursor, or None if Redis
+    /// is unavailable (the event is still delivered live, just not resumable).
+    pub async fn append(&self, user_id: Uuid, event: &WsEvent) -> Option<String> {
+        let json = match serde_json::to_string(event) {
+            Ok(json) => json,
+            Err(e) => {
+                warn!("Failed to serialize WsEvent for replay: {}", e);
+                return None;
+            }
+        };
+        let key = Self::key(user_id);
+        let mut redis = self.redis.clone();
+
+        let id: String = match redis::cmd("XADD")
+            .arg(&key)
+            .arg("MAXLEN")
+            .arg("~")
+            .arg(self.limit)
+            .arg("*")
+            .arg("event")
+            .arg(json)
+            .query_async(&mut redis)
+            .await
+        {
+            Ok(id) => id,
+            Err(e) => {
+                warn!("Replay buffer write failed for {}: {}", user_id, e);
+                return None;
+            }
+        };
+
+        // Sliding window: the stream goes once the player has been quiet
+        // for that long
+        if let Err(e) = redis::cmd("EXPIRE")
+            .arg(&key)
+            .arg(self.window_secs)
+            .query_async::<_, ()>(&mut redis)
+            .await
+        {
+            warn!("Replay buffer expiry failed for {}: {}", user_id, e);
+        }
+
+        Some(id)
+    }
+
+    /// Events buffered after `cursor`, oldest first. None when the cursor
+    /// has aged out (or was never ours), meaning events may have been lost
+    /// and the client must refetch.
+    pub async fn since(&self, user_id: Uuid, cursor: &str) -> Option<Vec<(String, WsEvent)>> {
+        parse_id(cursor)?;
+        let mut redis = self.redis.clone();
+
+        // Inclusive of the cursor: if its entry is still there, nothing
+        // after it can have been trimmed
+        let entries: Vec<(String, Vec<String>)> = match redis::cmd("XRANGE")
+            .arg(Self::key(user_id))
+            .arg(cursor)
+            .arg("+")
+            .arg("COUNT")
+            .arg(self.limit + 1)
+            .query_async(&mut redis)
+            .await
+        {
+            Ok(entries) => entries,
+            Err(e) => {
+                warn!("Replay buffer read failed for {}: {}", user_id, e);
+                return None;
+            }
+        };
+
+        let mut entries = entries.into_iter();
+        match entries.next() {
+            Some((id, _)) if id == cursor => {}
+            _ => return None,
+        }
+
+        let events = entries
+            .filter_map(|(id, fields)| {
+                let json = fields.chunks(2).find(|f| f[0] == "event")?.get(1)?;
+                match serde_json::from_str(json) {
+                    Ok(event) => Some((id, event)),
+                    Err(e) => {
+                        warn!("Skipping unreadable replay entry {}: {}", id, e);
+                        None
+                    }
+                }
+            })
+            .collect();
+        Some(events)
+    }
+}
+
+/// Stream ids are `<ms>-<seq>`
+fn parse_id(id: &str) -> Option<(u64, u64)> {
+    let (ms, seq) = id.split_once('-')?;
+    Some((ms.parse().ok()?, seq.parse().ok()?))
+}
+
+/// Whether stream id `id` comes after `cursor`
+pub fn is_after(id: &str, cursor: &str) -> bool {
+    match (parse_id(id), parse_id(cursor)) {
+        (Some(id), Some(cursor)) => id > cursor,
+        _ => true,
+    }
+}
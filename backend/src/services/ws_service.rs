@@ -1,12 +1,16 @@
-use axum::extract::ws::Message;
-use std::collections::HashMap;
+use std::collections::{HashMap, VecDeque};
 use std::sync::Arc;
 use tokio::sync::{mpsc, RwLock};
-use tracing::{debug, error, info};
+use tracing::{debug, info};
 use uuid::Uuid;
 
-/// Message types for WebSocket events
-#[derive(Debug, Clone, serde::Serialize)]
+use crate::models::world_status::TimeSync;
+use crate::services::ws_replay::{self, ReplayBuffer};
+
+/// Message types for realtime events, delivered over WebSocket or SSE. Wire
+/// framing is done per connection (ws_protocol, handlers::sse); keep
+/// schemas/ws-protocol.json in step with these.
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 #[serde(tag = "type", content = "data")]
 #[serde(rename_all = "snake_case")]
 pub enum WsEvent {
@@ -17,15 +21,30 @@ pub enum WsEvent {
     AttackIncoming(AttackIncomingData),
     TroopTrainingComplete(TroopTrainingCompleteData),
     TroopsStarved(TroopsStarvedData),
-    Connected { user_id: Uuid },
+    StorageFull(StorageFullData),
+    ResearchComplete(ResearchCompleteData),
+    HealingComplete(HealingCompleteData),
+    AuctionBid(AuctionBidData),
+    AuctionOutbid(AuctionOutbidData),
+    AuctionClosed(AuctionClosedData),
+    WorldMilestone(WorldMilestoneData),
+    DefenseCall(DefenseCallData),
+    /// Answer to a client ping, sent on that connection only
+    Pong(TimeSync),
+    Connected {
+        user_id: Uuid,
+        protocol_version: u32,
+        /// False when the client asked to resume but has to refetch instead
+        resumed: bool,
+    },
 }
 
-#[derive(Debug, Clone, serde::Serialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 pub struct VillageUpdateData {
     pub village_id: Uuid,
 }
 
-#[derive(Debug, Clone, serde::Serialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 pub struct ResourcesUpdateData {
     pub village_id: Uuid,
     pub wood: i64,
@@ -34,7 +53,7 @@ pub struct ResourcesUpdateData {
     pub wheat: i64,
 }
 
-#[derive(Debug, Clone, serde::Serialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 pub struct BuildingCompleteData {
     pub village_id: Uuid,
     pub building_type: String,
@@ -42,36 +61,148 @@ pub struct BuildingCompleteData {
     pub level: i32,
 }
 
-#[derive(Debug, Clone, serde::Serialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 pub struct ArmyArrivedData {
     pub army_id: Uuid,
     pub village_id: Uuid,
     pub mission_type: String,
 }
 
-#[derive(Debug, Clone, serde::Serialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 pub struct AttackIncomingData {
     pub target_village_id: Uuid,
     pub arrival_time: chrono::DateTime<chrono::Utc>,
 }
 
-#[derive(Debug, Clone, serde::Serialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 pub struct TroopTrainingCompleteData {
     pub village_id: Uuid,
     pub troop_type: String,
     pub quantity: i32,
 }
 
-#[derive(Debug, Clone, serde::Serialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
 pub struct TroopsStarvedData {
     pub village_id: Uuid,
     pub troop_type: String,
     pub quantity: i32,
 }
 
-/// Connection info for a single WebSocket connection
+/// A village's store filled up; production of these resources is paused
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct StorageFullData {
+    pub village_id: Uuid,
+    /// "wood", "clay", "iron" or "crop"
+    pub resources: Vec<String>,
+}
+
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct ResearchCompleteData {
+    pub village_id: Uuid,
+    pub troop_type: String,
+}
+
+/// Wounded troops left the hospital and are back in the village
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct HealingCompleteData {
+    pub village_id: Uuid,
+    pub troop_type: String,
+    pub quantity: i32,
+}
+
+/// A new leading bid on the player's auction
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct AuctionBidData {
+    pub auction_id: Uuid,
+    /// "silver" or "gold"
+    pub currency: String,
+    pub current_bid: i32,
+    pub bid_count: i32,
+    pub ends_at: chrono::DateTime<chrono::Utc>,
+}
+
+/// The player's bid was beaten and returned to their balance
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct AuctionOutbidData {
+    pub auction_id: Uuid,
+    pub currency: String,
+    pub refunded: i32,
+    pub current_bid: i32,
+    pub ends_at: chrono::DateTime<chrono::Utc>,
+}
+
+/// Sent to the seller, and to the winner if the item sold
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct AuctionClosedData {
+    pub auction_id: Uuid,
+    pub sold: bool,
+    pub currency: String,
+    /// Winning bid; left out when nothing sold
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub amount: Option<i32>,
+}
+
+/// The world passed a point on its endgame timeline. Broadcast to everyone.
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct WorldMilestoneData {
+    /// "artifacts", "wonder_plans" or "victory"
+    pub milestone: String,
+    pub title: String,
+    pub at: chrono::DateTime<chrono::Utc>,
+}
+
+/// An alliance or allied player asked for reinforcements the recipient can
+/// land in time
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct DefenseCallData {
+    pub call_id: Uuid,
+    pub player_name: String,
+    pub village_id: Uuid,
+    pub x: i32,
+    pub y: i32,
+    pub deadline: chrono::DateTime<chrono::Utc>,
+    /// Villages of the recipient that can make it
+    pub villages: i32,
+}
+
+/// An event on its way to a connection, with its replay cursor if it was
+/// buffered for resume
+#[derive(Debug, Clone)]
+pub struct QueuedEvent {
+    pub id: Option<String>,
+    pub event: WsEvent,
+}
+
+/// One connection's feed: the connected event, anything replayed on resume,
+/// then live events
+pub struct Subscription {
+    backlog: VecDeque<QueuedEvent>,
+    rx: mpsc::UnboundedReceiver<QueuedEvent>,
+    /// Live events at or before this were already replayed
+    replayed_up_to: Option<String>,
+}
+
+impl Subscription {
+    /// Next event to deliver; None once the manager drops the connection
+    pub async fn next(&mut self) -> Option<QueuedEvent> {
+        loop {
+            let queued = match self.backlog.pop_front() {
+                Some(queued) => queued,
+                None => self.rx.recv().await?,
+            };
+            if let (Some(id), Some(cursor)) = (&queued.id, &self.replayed_up_to) {
+                if !ws_replay::is_after(id, cursor) {
+                    continue;
+                }
+            }
+            return Some(queued);
+        }
+    }
+}
+
+/// Connection info for a single WebSocket or SSE connection
 struct Connection {
-    sender: mpsc::UnboundedSender<Message>,
+    sender: mpsc::UnboundedSender<QueuedEvent>,
 }
 
 /// WebSocket connection manager
@@ -80,21 +211,32 @@ struct Connection {
 pub struct WsManager {
     /// Map of user_id -> list of connections (user can have multiple tabs)
     connections: Arc<RwLock<HashMap<Uuid, Vec<Connection>>>>,
+    /// Per-user event buffer for reconnect resume; None when disabled
+    replay: Option<ReplayBuffer>,
 }
 
 impl WsManager {
     pub fn new() -> Self {
         Self {
             connections: Arc::new(RwLock::new(HashMap::new())),
+            replay: None,
         }
     }
 
+    /// Buffer events sent to users so reconnecting clients can resume
+    pub fn with_replay(mut self, replay: Option<ReplayBuffer>) -> Self {
+        self.replay = replay;
+        self
+    }
+
     /// Register a new connection for a user
-    pub async fn register(&self, user_id: Uuid) -> mpsc::UnboundedReceiver<Message> {
+    pub async fn register(&self, user_id: Uuid) -> mpsc::UnboundedReceiver<QueuedEvent> {
         let (tx, rx) = mpsc::unbounded_channel();
 
         let mut connections = self.connections.write().await;
         let user_connections = connections.entry(user_id).or_insert_with(Vec::new);
+        // Drop connections whose receiver has gone away
+        user_connections.retain(|conn| !conn.sender.is_closed());
         user_connections.push(Connection { sender: tx });
 
         info!("WebSocket connected: user_id={}, total_connections={}", user_id, user_connections.len());
@@ -118,21 +260,77 @@ impl WsManager {
         }
     }
 
-    /// Send event to a specific user (all their connections)
+    /// Register a connection and build its feed, resuming after `resume`
+    /// when given and still possible
+    pub async fn subscribe(
+        &self,
+        user_id: Uuid,
+        protocol_version: u32,
+        resume: Option<String>,
+    ) -> Subscription {
+        // Register before reading the replay buffer, so an event sent in
+        // between is queued live rather than lost
+        let rx = self.register(user_id).await;
+
+        let replayed = match &resume {
+            Some(cursor) => self.replay_since(user_id, cursor).await,
+            None => None,
+        };
+        let resumed = replayed.is_some();
+        if let Some(cursor) = &resume {
+            debug!("Resume from {} for user {}: resumed={}", cursor, user_id, resumed);
+        }
+
+        let mut backlog: VecDeque<QueuedEvent> = replayed.unwrap_or_default().into();
+        let replayed_up_to = backlog
+            .back()
+            .and_then(|q| q.id.clone())
+            .or_else(|| resume.filter(|_| resumed));
+        backlog.push_front(QueuedEvent {
+            id: None,
+            event: WsEvent::Connected {
+                user_id,
+                protocol_version,
+                resumed,
+            },
+        });
+
+        Subscription {
+            backlog,
+            rx,
+            replayed_up_to,
+        }
+    }
+
+    /// Events buffered for a user after `cursor`; None if the client has
+    /// to refetch instead (resume disabled or cursor too old)
+    pub async fn replay_since(&self, user_id: Uuid, cursor: &str) -> Option<Vec<QueuedEvent>> {
+        let events = self.replay.as_ref()?.since(user_id, cursor).await?;
+        Some(
+            events
+                .into_iter()
+                .map(|(id, event)| QueuedEvent { id: Some(id), event })
+                .collect(),
+        )
+    }
+
+    /// Send event to a specific user (all their connections), buffering it
+    /// for resume first
     pub async fn send_to_user(&self, user_id: Uuid, event: &WsEvent) {
-        let message = match serde_json::to_string(event) {
-            Ok(json) => Message::Text(json),
-            Err(e) => {
-                error!("Failed to serialize WsEvent: {}", e);
-                return;
-            }
+        let id = match &self.replay {
+            Some(replay) => replay.append(user_id, event).await,
+            None => None,
+        };
+        let queued = QueuedEvent {
+            id,
+            event: event.clone(),
         };
 
         let connections = self.connections.read().await;
 
         if let Some(user_connections) = connections.get(&user_id) {
             for conn in user_connections {
-                if let Err(e) = conn.sender.send(message.clone()) {
+                if let Err(e) = conn.sender.send(queued.clone()) {
                     debug!("Failed to send message to user {}: {}", user_id, e);
                 }
             }
@@ -146,21 +344,18 @@ impl WsManager {
         }
     }
 
-    /// Broadcast event to all connected users
+    /// Broadcast event to all connected users. Broadcasts are not buffered,
+    /// so a resuming client does not get them replayed.
     pub async fn broadcast(&self, event: &WsEvent) {
-        let message = match serde_json::to_string(event) {
-            Ok(json) => Message::Text(json),
-            Err(e) => {
-                error!("Failed to serialize WsEvent: {}", e);
-                return;
-            }
+        let queued = QueuedEvent {
+            id: None,
+            event: event.clone(),
         };
-
         let connections = self.connections.read().await;
 
         for (user_id, user_connections) in connections.iter() {
             for conn in user_connections {
-                if let Err(e) = conn.sender.send(message.clone()) {
+                if let Err(e) = conn.sender.send(queued.clone()) {
                     debug!("Failed to broadcast to user {}: {}", user_id, e);
                 }
             }
@@ -0,0 +1,124 @@
+//! OpenTelemetry trace export. Spans from `tracing` (requests, background
+//! jobs) are exported over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set, and
+//! database statements are added as child spans of whatever ran them.
+
+use std::sync::OnceLock;
+use std::time::{Duration, SystemTime};
+
+use anyhow::Context as _;
+use opentelemetry::trace::{Span as _, SpanKind, Tracer as _, TracerProvider as _};
+use opentelemetry::KeyValue;
+use opentelemetry_otlp::WithExportConfig;
+use opentelemetry_sdk::trace::{Sampler, Tracer, TracerProvider};
+use opentelemetry_sdk::{runtime, Resource};
+use tracing::Subscriber;
+use tracing_opentelemetry::{OpenTelemetryLayer, OtelData, PreSampledTracer};
+use tracing_subscriber::layer::Context;
+use tracing_subscriber::registry::LookupSpan;
+
+use crate::config::Config;
+
+/// Set once export is on; query spans are only built when it is
+static TRACER: OnceLock<Tracer> = OnceLock::new();
+
+/// Flushes batched spans when dropped; keep it alive for the life of the
+/// process
+pub struct TelemetryGuard {
+    provider: TracerProvider,
+}
+
+impl Drop for TelemetryGuard {
+    fn drop(&mut self) {
+        if let Err(e) = self.provider.shutdown() {
+            eprintln!("Failed to flush traces: {}", e);
+        }
+    }
+}
+
+/// Build the OTLP exporter and the `tracing` layer that feeds it. None when
+/// no endpoint is configured.
+pub fn init<S>(
+    config: &Config,
+) -> anyhow::Result<Option<(OpenTelemetryLayer<S, Tracer>, TelemetryGuard)>>
+where
+    S: Subscriber + for<'a> LookupSpan<'a>,
+{
+    let Some(endpoint) = config.telemetry.otlp_endpoint.as_deref() else {
+        return Ok(None);
+    };
+
+    let exporter = opentelemetry_otlp::SpanExporter::builder()
+        .with_tonic()
+        .with_endpoint(endpoint)
+        .build()
+        .context("Failed to build the OTLP span exporter")?;
+
+    let provider = TracerProvider::builder()
+        .with_batch_exporter(exporter, runtime::Tokio)
+        .with_sampler(Sampler::ParentBased(Box::new(Sampler::TraceIdRatioBased(
+            config.telemetry.sample_ratio,
+        ))))
+        .with_resource(Resource::new(vec![
+            KeyValue::new("service.name", config.telemetry.service_name.clone()),
+            KeyValue::new("service.version", env!("CARGO_PKG_VERSION")),
+            KeyValue::new("deployment.environment", config.server.environment.clone()),
+        ]))
+        .build();
+
+    let tracer = provider.tracer(env!("CARGO_PKG_NAME"));
+    let _ = TRACER.set(tracer.clone());
+
+    let layer = tracing_opentelemetry::layer().with_tracer(tracer);
+    Ok(Some((layer, TelemetryGuard { provider })))
+}
+
+/// A finished database statement, as reported by sqlx
+pub struct QuerySpan<'a> {
+    pub name: &'a str,
+    pub statement: &'a str,
+    pub elapsed: Duration,
+    pub rows_returned: u64,
+    pub rows_affected: u64,
+    pub slow: bool,
+}
+
+/// Export `query` as a client span under the span it ran in. sqlx only
+/// reports a statement once it has finished, so the span is back-dated by
+/// its elapsed time. Statements run outside any span start their own trace.
+pub fn record_query<S>(ctx: &Context<'_, S>, query: QuerySpan<'_>)
+where
+    S: Subscriber + for<'a> LookupSpan<'a>,
+{
+    let Some(tracer) = TRACER.get() else {
+        return;
+    };
+
+    let parent = ctx
+        .lookup_current()
+        .and_then(|span| {
+            let mut extensions = span.extensions_mut();
+            extensions
+                .get_mut::<OtelData>()
+                .map(|data| tracer.sampled_context(data))
+        })
+        .unwrap_or_default();
+
+    let end = SystemTime::now();
+    let mut span = tracer
+        .span_builder(query.name.to_string())
+        .with_kind(SpanKind::Client)
+        .with_start_time(end - query.elapsed)
+        .with_attributes(vec![
+            KeyValue::new("db.system", "postgresql"),
+            KeyValue::new("db.statement", query.statement.to_string()),
+            KeyValue::new("db.rows_returned", query.rows_returned as i64),
+            KeyValue::new("db.rows_affected", query.rows_affected as i64),
+            KeyValue::new("db.slow", query.slow),
+        ])
+        .start_with_context(tracer, &parent);
+
+    if query.slow {
+        span.add_event("Slow query", Vec::new());
+    }
+    span.end_with_timestamp(end);
+}
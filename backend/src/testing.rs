@@ -0,0 +1,509 @@
+//! Fakes for tests: a clock that only moves when told to, RNGs with known
+//! rolls and in-memory stand-ins for the repository traits, so game rules
+//! (queues, arrivals, adventures, production) run in milliseconds without
+//! Postgres. Compiled into the library so tests under tests/ can use them.
+
+use async_trait::async_trait;
+use chrono::{DateTime, Duration, Utc};
+use rand::rngs::mock::StepRng;
+use rand::rngs::StdRng;
+use rand::SeedableRng;
+use rust_decimal::Decimal;
+use std::collections::HashMap;
+use std::sync::Mutex;
+use uuid::Uuid;
+
+use crate::error::AppResult;
+use crate::models::army::{Army, ArmyTroops, CarriedResources, MissionType};
+use crate::models::building::{Building, BuildingType};
+use crate::models::hero::{
+    AdventureDifficulty, AdventureRewards, HeroAdventure, ItemDefinition, ItemRarity, ItemSlot,
+};
+use crate::models::troop::{TroopQueue, TroopType};
+use crate::models::village::{FieldType, ProductionBreakdown, ProductionShare, Village};
+use crate::repositories::troop_repo::TrainingQueue;
+use crate::services::army_service::ArmyMovements;
+use crate::services::building_service::BuildingQueue;
+use crate::services::clock::Clock;
+use crate::services::hero_service::AdventureLog;
+use crate::services::resource_service::{ProductionRates, VillageLedger};
+
+/// A clock standing still at a set instant
+pub struct FakeClock {
+    now: Mutex<DateTime<Utc>>,
+}
+
+impl FakeClock {
+    pub fn new(at: DateTime<Utc>) -> Self {
+        Self {
+            now: Mutex::new(at),
+        }
+    }
+
+    /// Move to `at`, which may be in the past (an NTP step, a leap second)
+    pub fn set(&self, at: DateTime<Utc>) {
+        *self.now.lock().unwrap() = at;
+    }
+
+    pub fn advance(&self, by: Duration) {
+        *self.now.lock().unwrap() += by;
+    }
+}
+
+impl Clock for FakeClock {
+    fn now(&self) -> DateTime<Utc> {
+        *self.now.lock().unwrap()
+    }
+}
+
+/// An RNG whose rolls are the same on every run
+pub fn seeded_rng(seed: u64) -> StdRng {
+    StdRng::seed_from_u64(seed)
+}
+
+/// An RNG whose every roll lands on the bottom of its range
+pub fn lowest_rng() -> StepRng {
+    StepRng::new(0, 0)
+}
+
+/// Training queue entries and village troops held in memory
+#[derive(Default)]
+pub struct InMemoryTrainingQueue {
+    entries: Mutex<Vec<TroopQueue>>,
+    troops: Mutex<HashMap<(Uuid, TroopType), i32>>,
+}
+
+impl InMemoryTrainingQueue {
+    /// Queue `count` units finishing at `ends_at`
+    pub fn push(
+        &self,
+        village_id: Uuid,
+        troop_type: TroopType,
+        count: i32,
+        ends_at: DateTime<Utc>,
+    ) -> TroopQueue {
+        let entry = TroopQueue {
+            id: Uuid::new_v4(),
+            village_id,
+            troop_type,
+            count,
+            each_duration_seconds: 60,
+            started_at: ends_at - Duration::seconds(60 * count as i64),
+            ends_at,
+            created_at: ends_at - Duration::seconds(60 * count as i64),
+            version: 1,
+        };
+        self.entries.lock().unwrap().push(entry.clone());
+        entry
+    }
+
+    /// Troops of a type in a village
+    pub fn troops(&self, village_id: Uuid, troop_type: TroopType) -> i32 {
+        let troops = self.troops.lock().unwrap();
+        troops.get(&(village_id, troop_type)).copied().unwrap_or(0)
+    }
+
+    /// Entries still queued
+    pub fn queued(&self) -> usize {
+        self.entries.lock().unwrap().len()
+    }
+}
+
+#[async_trait]
+impl TrainingQueue for InMemoryTrainingQueue {
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<TroopQueue>> {
+        let mut completed: Vec<TroopQueue> = self
+            .entries
+            .lock()
+            .unwrap()
+            .iter()
+            .filter(|e| e.ends_at <= now)
+            .cloned()
+            .collect();
+        completed.sort_by_key(|e| e.ends_at);
+        Ok(completed)
+    }
+
+    async fn complete(&self, entry: &TroopQueue) -> AppResult<bool> {
+        let mut entries = self.entries.lock().unwrap();
+        let Some(index) = entries
+            .iter()
+            .position(|e| e.id == entry.id && e.version == entry.version)
+        else {
+            return Ok(false);
+        };
+        let done = entries.remove(index);
+
+        *self
+            .troops
+            .lock()
+            .unwrap()
+            .entry((done.village_id, done.troop_type))
+            .or_default() += done.count;
+        Ok(true)
+    }
+}
+
+/// Buildings held in memory, some of them upgrading
+#[derive(Default)]
+pub struct InMemoryBuildingQueue {
+    buildings: Mutex<Vec<Building>>,
+}
+
+impl InMemoryBuildingQueue {
+    /// Add a building at `level`, upgrading until `ends_at` if given
+    pub fn push(
+        &self,
+        village_id: Uuid,
+        building_type: BuildingType,
+        level: i32,
+        ends_at: Option<DateTime<Utc>>,
+    ) -> Building {
+        let created_at = ends_at.unwrap_or_else(Utc::now) - Duration::hours(1);
+        let building = Building {
+            id: Uuid::new_v4(),
+            village_id,
+            building_type,
+            slot: self.buildings.lock().unwrap().len() as i32 + 1,
+            level,
+            is_upgrading: ends_at.is_some(),
+            upgrade_ends_at: ends_at,
+            created_at,
+            updated_at: created_at,
+            version: 1,
+        };
+        self.buildings.lock().unwrap().push(building.clone());
+        building
+    }
+
+    pub fn get(&self, id: Uuid) -> Option<Building> {
+        let buildings = self.buildings.lock().unwrap();
+        buildings.iter().find(|b| b.id == id).cloned()
+    }
+}
+
+#[async_trait]
+impl BuildingQueue for InMemoryBuildingQueue {
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<Building>> {
+        let mut completed: Vec<Building> = self
+            .buildings
+            .lock()
+            .unwrap()
+            .iter()
+            .filter(|b| b.is_upgrading && b.upgrade_ends_at.is_some_and(|t| t <= now))
+            .cloned()
+            .collect();
+        completed.sort_by_key(|b| b.upgrade_ends_at);
+        Ok(completed)
+    }
+
+    async fn complete(&self, building: &Building) -> AppResult<Option<Building>> {
+        let mut buildings = self.buildings.lock().unwrap();
+        let Some(stored) = buildings
+            .iter_mut()
+            .find(|b| b.id == building.id && b.is_upgrading)
+        else {
+            return Ok(None);
+        };
+
+        stored.level += 1;
+        stored.is_upgrading = false;
+        stored.upgrade_ends_at = None;
+        stored.version += 1;
+        Ok(Some(stored.clone()))
+    }
+}
+
+/// Armies on the move held in memory; resolving one just records it
+#[derive(Default)]
+pub struct InMemoryArmies {
+    armies: Mutex<Vec<Army>>,
+    resolved: Mutex<Vec<Uuid>>,
+}
+
+impl InMemoryArmies {
+    /// An army sent at `departed_at` to land on `to_village_id` at
+    /// `arrives_at`
+    pub fn send(
+        &self,
+        to_village_id: Uuid,
+        mission: MissionType,
+        departed_at: DateTime<Utc>,
+        arrives_at: DateTime<Utc>,
+    ) -> Army {
+        let army = Army {
+            id: Uuid::new_v4(),
+            player_id: Uuid::new_v4(),
+            from_village_id: Uuid::new_v4(),
+            to_x: 0,
+            to_y: 0,
+            to_village_id: Some(to_village_id),
+            mission,
+            troops: sqlx::types::Json(ArmyTroops::from([(TroopType::Infantry, 10)])),
+            resources: sqlx::types::Json(CarriedResources::default()),
+            departed_at,
+            arrives_at,
+            returns_at: None,
+            is_returning: false,
+            is_stationed: false,
+            battle_report_id: None,
+            created_at: departed_at,
+            hero_id: None,
+        };
+        self.armies.lock().unwrap().push(army.clone());
+        army
+    }
+
+    /// Ids of the armies resolved so far, in the order they were
+    pub fn resolved(&self) -> Vec<Uuid> {
+        self.resolved.lock().unwrap().clone()
+    }
+}
+
+#[async_trait]
+impl ArmyMovements for InMemoryArmies {
+    async fn find_arrived(&self, now: DateTime<Utc>) -> AppResult<Vec<Army>> {
+        let resolved = self.resolved.lock().unwrap();
+        let arrived = self
+            .armies
+            .lock()
+            .unwrap()
+            .iter()
+            .filter(|a| a.arrives_at <= now && !resolved.contains(&a.id))
+            .cloned()
+            .collect();
+        Ok(arrived)
+    }
+
+    async fn resolve(&self, army: &Army) -> bool {
+        let mut resolved = self.resolved.lock().unwrap();
+        if resolved.contains(&army.id) {
+            return false;
+        }
+        resolved.push(army.id);
+        true
+    }
+}
+
+/// Hero adventures and the items they can turn up, held in memory. Paying
+/// out just records what was paid.
+#[derive(Default)]
+pub struct InMemoryAdventures {
+    adventures: Mutex<Vec<HeroAdventure>>,
+    items: Mutex<Vec<ItemDefinition>>,
+    paid: Mutex<HashMap<Uuid, (AdventureRewards, Option<Uuid>)>>,
+}
+
+impl InMemoryAdventures {
+    /// Send `hero_id` on an adventure ending at `ends_at`
+    pub fn start(
+        &self,
+        hero_id: Uuid,
+        difficulty: AdventureDifficulty,
+        ends_at: DateTime<Utc>,
+    ) -> HeroAdventure {
+        let duration_seconds = 3600;
+        let started_at = ends_at - Duration::seconds(duration_seconds as i64);
+        let adventure = HeroAdventure {
+            id: Uuid::new_v4(),
+            hero_id,
+            difficulty,
+            started_at,
+            duration_seconds,
+            ends_at,
+            is_completed: false,
+            completed_at: None,
+            reward_experience: None,
+            reward_silver: None,
+            reward_resources: None,
+            reward_item_id: None,
+            health_lost: None,
+            created_at: started_at,
+        };
+        self.adventures.lock().unwrap().push(adventure.clone());
+        adventure
+    }
+
+    /// An item adventures can turn up at `rarity`
+    pub fn add_item(&self, rarity: ItemRarity) -> Uuid {
+        let item = ItemDefinition {
+            id: Uuid::new_v4(),
+            name: format!("{:?} helmet", rarity),
+            description: None,
+            slot: ItemSlot::Helmet,
+            rarity,
+            required_level: 0,
+            attack_bonus: 0,
+            defense_bonus: 0,
+            speed_bonus: Decimal::ZERO,
+            health_regen_bonus: Decimal::ZERO,
+            experience_bonus: 0,
+            resource_bonus: 0,
+            carry_bonus: 0,
+            health_restore: 0,
+            is_consumable: false,
+            extra_inventory_slots: 0,
+            sell_value: 0,
+            can_drop_adventure: true,
+            can_buy_auction: true,
+            created_at: Utc::now(),
+        };
+        let id = item.id;
+        self.items.lock().unwrap().push(item);
+        id
+    }
+
+    /// What the adventure paid out, and the item found, once completed
+    pub fn paid(&self, adventure_id: Uuid) -> Option<(AdventureRewards, Option<Uuid>)> {
+        self.paid.lock().unwrap().get(&adventure_id).cloned()
+    }
+}
+
+#[async_trait]
+impl AdventureLog for InMemoryAdventures {
+    async fn find_completed(&self, now: DateTime<Utc>) -> AppResult<Vec<HeroAdventure>> {
+        let completed = self
+            .adventures
+            .lock()
+            .unwrap()
+            .iter()
+            .filter(|a| !a.is_completed && a.ends_at <= now)
+            .cloned()
+            .collect();
+        Ok(completed)
+    }
+
+    async fn items_of_rarity(&self, rarity: ItemRarity) -> AppResult<Vec<ItemDefinition>> {
+        let items = self.items.lock().unwrap();
+        Ok(items
+            .iter()
+            .filter(|i| i.rarity == rarity)
+            .cloned()
+            .collect())
+    }
+
+    async fn complete(
+        &self,
+        adventure: &HeroAdventure,
+        rewards: &AdventureRewards,
+        item_id: Option<Uuid>,
+        now: DateTime<Utc>,
+    ) -> AppResult<bool> {
+        let mut adventures = self.adventures.lock().unwrap();
+        let Some(stored) = adventures
+            .iter_mut()
+            .find(|a| a.id == adventure.id && !a.is_completed)
+        else {
+            return Ok(false);
+        };
+
+        stored.is_completed = true;
+        stored.completed_at = Some(now);
+        self.paid
+            .lock()
+            .unwrap()
+            .insert(adventure.id, (rewards.clone(), item_id));
+        Ok(true)
+    }
+}
+
+/// Villages and their production rates held in memory
+#[derive(Default)]
+pub struct InMemoryVillages {
+    villages: Mutex<HashMap<Uuid, (Village, ProductionShare)>>,
+}
+
+impl InMemoryVillages {
+    /// A village holding `stock` of each resource, settled at `at`, storing
+    /// up to `capacity` and producing `rates` per hour with no population
+    pub fn found(
+        &self,
+        stock: i32,
+        capacity: i32,
+        rates: ProductionShare,
+        at: DateTime<Utc>,
+    ) -> Village {
+        let village = Village {
+            id: Uuid::new_v4(),
+            user_id: Uuid::new_v4(),
+            name: "Village".to_string(),
+            x: 0,
+            y: 0,
+            is_capital: true,
+            wood: stock,
+            clay: stock,
+            iron: stock,
+            crop: stock,
+            warehouse_capacity: capacity,
+            granary_capacity: capacity,
+            population: 0,
+            culture_points: 0,
+            culture_per_day: 0,
+            loyalty: 100,
+            field_type: FieldType::F4446,
+            resources_updated_at: at,
+            created_at: at,
+            updated_at: at,
+            version: 1,
+        };
+        self.villages
+            .lock()
+            .unwrap()
+            .insert(village.id, (village.clone(), rates));
+        village
+    }
+
+    pub fn get(&self, village_id: Uuid) -> Option<Village> {
+        let villages = self.villages.lock().unwrap();
+        villages.get(&village_id).map(|(v, _)| v.clone())
+    }
+}
+
+#[async_trait]
+impl VillageLedger for InMemoryVillages {
+    async fn find(&self, village_id: Uuid) -> AppResult<Option<Village>> {
+        Ok(self.get(village_id))
+    }
+
+    async fn production(&self, village: &Village) -> AppResult<ProductionRates> {
+        let villages = self.villages.lock().unwrap();
+        let rates = villages
+            .get(&village.id)
+            .map(|(_, r)| *r)
+            .unwrap_or_default();
+        Ok(ProductionRates {
+            wood_per_hour: rates.wood,
+            clay_per_hour: rates.clay,
+            iron_per_hour: rates.iron,
+            crop_per_hour: rates.crop,
+            crop_consumption: village.population,
+            net_crop_per_hour: rates.crop - village.population,
+            breakdown: ProductionBreakdown {
+                fields: rates,
+                ..Default::default()
+            },
+        })
+    }
+
+    async fn store_resources(
+        &self,
+        village_id: Uuid,
+        wood: i32,
+        clay: i32,
+        iron: i32,
+        crop: i32,
+        at: DateTime<Utc>,
+    ) -> AppResult<Village> {
+        let mut villages = self.villages.lock().unwrap();
+        let (village, _) = villages
+            .get_mut(&village_id)
+            .ok_or_else(|| crate::error::AppError::NotFound("Village not found".to_string()))?;
+        village.wood = wood;
+        village.clay = clay;
+        village.iron = iron;
+        village.crop = crop;
+        village.resources_updated_at = at;
+        village.version += 1;
+        Ok(village.clone())
+    }
+}
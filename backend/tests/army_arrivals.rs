@@ -0,0 +1,436 @@
+mod common;
+
+use chrono::{DateTime, Duration, TimeZone, Utc};
+
+use backend::models::army::{Army, ArmyTroops, BattleReport, CarriedResources, MissionType};
+use backend::models::troop::{TribeType, TroopType};
+use backend::models::village::Village;
+use backend::repositories::army_repo::ArmyRepository;
+use backend::repositories::troop_repo::TroopRepository;
+use backend::repositories::village_repo::VillageRepository;
+use backend::services::army_service::ArmyService;
+use backend::services::clock;
+use backend::services::lag_watchdog_service::LagWatchdogService;
+use backend::testing::{FakeClock, InMemoryArmies};
+use common::TestWorld;
+use uuid::Uuid;
+
+/// An army from `from` that landed at `to` a minute ago
+async fn landed(
+    world: &TestWorld,
+    from: &Village,
+    to: &Village,
+    mission: MissionType,
+    troops: &[(TroopType, i32)],
+) -> Army {
+    let now = clock::now();
+    landing(
+        world,
+        from,
+        to,
+        mission,
+        troops,
+        now - Duration::minutes(10),
+        now - Duration::minutes(1),
+    )
+    .await
+}
+
+/// An army from `from` launched at `departed_at` landing at `to` at
+/// `arrives_at`
+async fn landing(
+    world: &TestWorld,
+    from: &Village,
+    to: &Village,
+    mission: MissionType,
+    troops: &[(TroopType, i32)],
+    departed_at: DateTime<Utc>,
+    arrives_at: DateTime<Utc>,
+) -> Army {
+    let troops: ArmyTroops = troops.iter().copied().collect();
+    ArmyRepository::create(
+        &world.db,
+        from.user_id,
+        from.id,
+        to.x,
+        to.y,
+        Some(to.id),
+        mission,
+        &troops,
+        &CarriedResources::default(),
+        departed_at,
+        arrives_at,
+        None,
+        None,
+    )
+    .await
+    .unwrap()
+}
+
+async fn battle_reports(world: &TestWorld, attacker_id: Uuid) -> i64 {
+    let count: (i64,) =
+        sqlx::query_as("SELECT COUNT(*) FROM battle_reports WHERE attacker_player_id = $1")
+            .bind(attacker_id)
+            .fetch_one(&world.db)
+            .await
+            .unwrap();
+    count.0
+}
+
+/// Two workers that both picked the army up before either resolved it
+async fn resolve_twice(world: &TestWorld, army: &Army) -> (bool, bool) {
+    tokio::join!(
+        ArmyService::process_arrival(&world.db, army),
+        ArmyService::process_arrival(&world.db, army),
+    )
+}
+
+#[tokio::test]
+async fn a_reinforcement_resolved_twice_is_stationed_once() {
+    let world = TestWorld::new().await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    let friend = world.create_player(TribeType::Phasuttha).await;
+    let home = world.create_village(&player, 20, 20, true).await;
+    let target = world.create_village(&friend, 22, 20, true).await;
+    let army = landed(
+        &world,
+        &home,
+        &target,
+        MissionType::Support,
+        &[(TroopType::Infantry, 10)],
+    )
+    .await;
+
+    let (first, second) = resolve_twice(&world, &army).await;
+
+    assert!(first ^ second);
+    let stationed = ArmyRepository::find_stationed_at_village(&world.db, target.id)
+        .await
+        .unwrap();
+    assert_eq!(stationed.len(), 1);
+    assert_eq!(stationed[0].id, army.id);
+    assert_eq!(stationed[0].troops.0.get(&TroopType::Infantry), Some(&10));
+}
+
+#[tokio::test]
+async fn a_conquest_resolved_twice_lowers_loyalty_once() {
+    let world = TestWorld::new().await;
+    let attacker = world.create_player(TribeType::Phasuttha).await;
+    let defender = world.create_player(TribeType::Phasuttha).await;
+    let home = world.create_village(&attacker, -20, 20, true).await;
+    world.create_village(&defender, -25, 25, true).await;
+    let target = world.create_village(&defender, -22, 20, false).await;
+    let army = landed(
+        &world,
+        &home,
+        &target,
+        MissionType::Conquer,
+        &[(TroopType::Infantry, 50), (TroopType::RoyalAdvisor, 1)],
+    )
+    .await;
+
+    let (first, second) = resolve_twice(&world, &army).await;
+
+    assert!(first ^ second);
+    assert_eq!(battle_reports(&world, attacker.id).await, 1);
+    let advisor = TroopRepository::get_all_definitions(&world.db)
+        .await
+        .unwrap()
+        .into_iter()
+        .find(|d| d.troop_type == TroopType::RoyalAdvisor)
+        .unwrap();
+    let once = target.loyalty - advisor.loyalty_reduction;
+    assert!(once > 0);
+    let after = VillageRepository::find_by_id(&world.db, target.id)
+        .await
+        .unwrap()
+        .unwrap();
+    assert_eq!(after.loyalty, once);
+    let returning = ArmyRepository::find_by_id(&world.db, army.id)
+        .await
+        .unwrap()
+        .unwrap();
+    assert!(returning.is_returning);
+}
+
+#[tokio::test]
+async fn a_raid_resolved_twice_is_fought_once() {
+    let world = TestWorld::new().await;
+    let attacker = world.create_player(TribeType::Phasuttha).await;
+    let defender = world.create_player(TribeType::Phasuttha).await;
+    let home = world.create_village(&attacker, 20, -20, true).await;
+    let target = world.create_village(&defender, 22, -20, true).await;
+    let army = landed(
+        &world,
+        &home,
+        &target,
+        MissionType::Raid,
+        &[(TroopType::Infantry, 20)],
+    )
+    .await;
+
+    let (first, second) = resolve_twice(&world, &army).await;
+
+    assert!(first ^ second);
+    assert_eq!(battle_reports(&world, attacker.id).await, 1);
+    let returning = ArmyRepository::find_by_id(&world.db, army.id)
+        .await
+        .unwrap()
+        .unwrap();
+    assert!(returning.is_returning);
+}
+
+#[tokio::test]
+async fn only_landed_armies_are_resolved_and_each_once() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let armies = InMemoryArmies::default();
+    let target = Uuid::new_v4();
+    let later = armies.send(
+        target,
+        MissionType::Raid,
+        now - Duration::minutes(10),
+        now - Duration::seconds(5),
+    );
+    let earlier = armies.send(
+        target,
+        MissionType::Attack,
+        now - Duration::minutes(20),
+        now - Duration::seconds(30),
+    );
+    let underway = armies.send(
+        target,
+        MissionType::Support,
+        now - Duration::minutes(1),
+        now + Duration::minutes(1),
+    );
+
+    let resolved = ArmyService::resolve_due_arrivals(&armies, &clock)
+        .await
+        .unwrap();
+
+    assert_eq!(resolved, 2);
+    assert_eq!(armies.resolved(), vec![earlier.id, later.id]);
+
+    clock.advance(Duration::minutes(1));
+    let resolved = ArmyService::resolve_due_arrivals(&armies, &clock)
+        .await
+        .unwrap();
+
+    assert_eq!(resolved, 1);
+    assert_eq!(armies.resolved(), vec![earlier.id, later.id, underway.id]);
+}
+
+#[tokio::test]
+async fn same_second_arrivals_are_resolved_by_launch_time_then_id() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let armies = InMemoryArmies::default();
+    let target = Uuid::new_v4();
+    let landed_at = now - Duration::seconds(1);
+    let raid = armies.send(
+        target,
+        MissionType::Raid,
+        now - Duration::minutes(10),
+        landed_at,
+    );
+    let conquest = armies.send(
+        target,
+        MissionType::Conquer,
+        now - Duration::minutes(5),
+        landed_at,
+    );
+    let reinforcement = armies.send(
+        target,
+        MissionType::Support,
+        now - Duration::minutes(20),
+        landed_at,
+    );
+    // Launched together too, so only the id tells these apart
+    let twins = [
+        armies.send(
+            target,
+            MissionType::Attack,
+            now - Duration::minutes(30),
+            landed_at,
+        ),
+        armies.send(
+            target,
+            MissionType::Attack,
+            now - Duration::minutes(30),
+            landed_at,
+        ),
+    ];
+    let (first_twin, second_twin) = if twins[0].id < twins[1].id {
+        (twins[0].id, twins[1].id)
+    } else {
+        (twins[1].id, twins[0].id)
+    };
+
+    ArmyService::resolve_due_arrivals(&armies, &clock)
+        .await
+        .unwrap();
+
+    assert_eq!(
+        armies.resolved(),
+        vec![
+            first_twin,
+            second_twin,
+            reinforcement.id,
+            raid.id,
+            conquest.id
+        ]
+    );
+}
+
+/// A reinforcement, a raid and a conquest from three players landing on
+/// one village in the same second, launched in that order
+struct SameSecond {
+    reinforcement: Army,
+    raid: Army,
+    conquest: Army,
+    raider_id: Uuid,
+    conqueror_id: Uuid,
+    target_id: Uuid,
+}
+
+async fn same_second(world: &TestWorld) -> SameSecond {
+    let defender = world.create_player(TribeType::Phasuttha).await;
+    let friend = world.create_player(TribeType::Phasuttha).await;
+    let raider = world.create_player(TribeType::Phasuttha).await;
+    let conqueror = world.create_player(TribeType::Phasuttha).await;
+    world.create_village(&defender, 40, 45, true).await;
+    let target = world.create_village(&defender, 40, 40, false).await;
+    let friend_home = world.create_village(&friend, 43, 40, true).await;
+    let raider_home = world.create_village(&raider, 37, 40, true).await;
+    let conqueror_home = world.create_village(&conqueror, 40, 37, true).await;
+
+    let now = clock::now();
+    let landed_at = now - Duration::seconds(1);
+    // Created out of launch order so the insert order can't be what sorts them
+    let conquest = landing(
+        world,
+        &conqueror_home,
+        &target,
+        MissionType::Conquer,
+        &[(TroopType::Infantry, 80), (TroopType::RoyalAdvisor, 1)],
+        now - Duration::minutes(5),
+        landed_at,
+    )
+    .await;
+    let raid = landing(
+        world,
+        &raider_home,
+        &target,
+        MissionType::Raid,
+        &[(TroopType::Infantry, 40)],
+        now - Duration::minutes(10),
+        landed_at,
+    )
+    .await;
+    let reinforcement = landing(
+        world,
+        &friend_home,
+        &target,
+        MissionType::Support,
+        &[(TroopType::Infantry, 30)],
+        now - Duration::minutes(20),
+        landed_at,
+    )
+    .await;
+
+    SameSecond {
+        reinforcement,
+        raid,
+        conquest,
+        raider_id: raider.id,
+        conqueror_id: conqueror.id,
+        target_id: target.id,
+    }
+}
+
+async fn report_of(world: &TestWorld, attacker_id: Uuid) -> BattleReport {
+    let mut reports = ArmyRepository::find_reports_by_player(&world.db, attacker_id)
+        .await
+        .unwrap();
+    assert_eq!(reports.len(), 1);
+    reports.remove(0)
+}
+
+fn infantry(troops: &ArmyTroops) -> i32 {
+    troops.get(&TroopType::Infantry).copied().unwrap_or(0)
+}
+
+/// What resolving `landing` left behind: the raid and conquest reports
+/// and the target's loyalty
+async fn outcome(world: &TestWorld, landing: &SameSecond) -> (BattleReport, BattleReport, i32) {
+    let raid = report_of(world, landing.raider_id).await;
+    let conquest = report_of(world, landing.conqueror_id).await;
+
+    // The reinforcement was stationed before the raid was fought, and the
+    // raid fought before the conquest
+    let reinforced = landing.reinforcement.troops.0[&TroopType::Infantry];
+    assert!(infantry(&raid.defender_troops.0) >= reinforced);
+    assert_eq!(
+        infantry(&conquest.defender_troops.0),
+        infantry(&raid.defender_troops.0) - infantry(&raid.defender_losses.0)
+    );
+
+    let loyalty = VillageRepository::find_by_id(&world.db, landing.target_id)
+        .await
+        .unwrap()
+        .unwrap()
+        .loyalty;
+    (raid, conquest, loyalty)
+}
+
+fn same_battle(a: &BattleReport, b: &BattleReport) -> bool {
+    a.winner == b.winner
+        && a.attacker_losses.0 == b.attacker_losses.0
+        && a.defender_troops.0 == b.defender_troops.0
+        && a.defender_losses.0 == b.defender_losses.0
+}
+
+#[tokio::test]
+async fn same_second_arrivals_are_listed_in_resolution_order() {
+    let world = TestWorld::new().await;
+    let landing = same_second(&world).await;
+
+    let arrived: Vec<Army> = ArmyRepository::find_arrived(&world.db, clock::now())
+        .await
+        .unwrap();
+    let ids: Vec<Uuid> = arrived.iter().map(|a| a.id).collect();
+
+    assert_eq!(
+        ids,
+        vec![
+            landing.reinforcement.id,
+            landing.raid.id,
+            landing.conquest.id
+        ]
+    );
+    let mut sorted = arrived.clone();
+    sorted.sort_by_key(Army::resolution_order);
+    assert_eq!(sorted.iter().map(|a| a.id).collect::<Vec<_>>(), ids);
+}
+
+#[tokio::test]
+async fn the_regular_job_and_a_catch_up_pass_resolve_a_same_second_landing_alike() {
+    let regular = TestWorld::new().await;
+    let by_job = same_second(&regular).await;
+    let resolved = ArmyService::process_arrived_armies(&regular.db)
+        .await
+        .unwrap();
+    assert_eq!(resolved, 3);
+
+    let lagging = TestWorld::new().await;
+    let by_catch_up = same_second(&lagging).await;
+    let result = LagWatchdogService::catch_up(&lagging.db).await.unwrap();
+    assert_eq!(result.army_movements, 3);
+
+    let (job_raid, job_conquest, job_loyalty) = outcome(&regular, &by_job).await;
+    let (late_raid, late_conquest, late_loyalty) = outcome(&lagging, &by_catch_up).await;
+    assert!(same_battle(&job_raid, &late_raid));
+    assert!(same_battle(&job_conquest, &late_conquest));
+    assert_eq!(job_loyalty, late_loyalty);
+}
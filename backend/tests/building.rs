@@ -0,0 +1,121 @@
+mod common;
+
+use chrono::{Duration, TimeZone, Utc};
+use uuid::Uuid;
+
+use backend::error::{AppError, ErrorCode};
+use backend::models::building::BuildingType;
+use backend::models::troop::TribeType;
+use backend::repositories::building_repo::BuildingRepository;
+use backend::repositories::village_repo::VillageRepository;
+use backend::services::building_service::{BuildingQueue, BuildingService};
+use backend::testing::{FakeClock, InMemoryBuildingQueue};
+use common::TestWorld;
+
+#[tokio::test]
+async fn build_pays_places_and_starts_the_building_together() {
+    let world = TestWorld::new().await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    let village = world.create_village(&player, 0, 5, true).await;
+
+    let response = BuildingService::build(&world.db, &village, 5, BuildingType::Warehouse)
+        .await
+        .unwrap();
+
+    let building = BuildingRepository::find_by_village_and_slot(&world.db, village.id, 5)
+        .await
+        .unwrap()
+        .expect("building placed");
+    assert!(building.is_upgrading);
+    let after = VillageRepository::find_by_id(&world.db, village.id)
+        .await
+        .unwrap()
+        .unwrap();
+    assert_eq!(after.wood, village.wood - response.cost.wood);
+    assert_eq!(after.crop, village.crop - response.cost.crop);
+}
+
+#[tokio::test]
+async fn a_failed_build_leaves_no_building_and_spends_nothing() {
+    let world = TestWorld::new().await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    let village = world.create_village(&player, 0, 6, true).await;
+    // Resources arrive after `village` was read
+    VillageRepository::add_resources(&world.db, village.id, 10, 10, 10, 10)
+        .await
+        .unwrap();
+    let before = VillageRepository::find_by_id(&world.db, village.id)
+        .await
+        .unwrap()
+        .unwrap();
+
+    let stale = BuildingService::build(&world.db, &village, 5, BuildingType::Warehouse).await;
+
+    assert!(matches!(stale, Err(AppError::VersionConflict(_))));
+    assert!(
+        BuildingRepository::find_by_village_and_slot(&world.db, village.id, 5)
+            .await
+            .unwrap()
+            .is_none()
+    );
+    let after = VillageRepository::find_by_id(&world.db, village.id)
+        .await
+        .unwrap()
+        .unwrap();
+    assert_eq!((after.wood, after.crop), (before.wood, before.crop));
+}
+
+#[tokio::test]
+async fn only_finished_upgrades_are_completed_and_each_once() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let queue = InMemoryBuildingQueue::default();
+    let village = Uuid::new_v4();
+    let finished = queue.push(village, BuildingType::Warehouse, 3, Some(now));
+    let running = queue.push(
+        village,
+        BuildingType::Granary,
+        1,
+        Some(now + Duration::minutes(5)),
+    );
+    let idle = queue.push(village, BuildingType::MainBuilding, 2, None);
+
+    let completed = BuildingService::complete_due_upgrades(&queue, &clock)
+        .await
+        .unwrap();
+
+    assert_eq!(completed.len(), 1);
+    assert_eq!(completed[0].id, finished.id);
+    assert_eq!(queue.get(finished.id).unwrap().level, 4);
+    assert!(queue.get(running.id).unwrap().is_upgrading);
+    assert_eq!(queue.get(idle.id).unwrap().level, 2);
+
+    // "Finish Now" got there first; the job must not raise it again
+    assert!(queue.complete(&running).await.unwrap().is_some());
+    clock.advance(Duration::minutes(5));
+    let completed = BuildingService::complete_due_upgrades(&queue, &clock)
+        .await
+        .unwrap();
+
+    assert!(completed.is_empty());
+    assert_eq!(queue.get(running.id).unwrap().level, 2);
+}
+
+#[tokio::test]
+async fn demolishing_the_main_building_is_refused_with_its_own_code() {
+    let world = TestWorld::new().await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    let village = world.create_village(&player, 0, 7, true).await;
+    let main = BuildingRepository::find_by_village_id(&world.db, village.id)
+        .await
+        .unwrap()
+        .into_iter()
+        .find(|b| b.building_type == BuildingType::MainBuilding)
+        .expect("main building");
+
+    let result = BuildingService::demolish(&world.db, village.id, main.slot).await;
+
+    let error = result.unwrap_err();
+    assert_eq!(error.error_code(), ErrorCode::CannotDemolish);
+    assert_eq!(error.status_code().as_u16(), 400);
+}
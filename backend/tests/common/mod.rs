@@ -0,0 +1,192 @@
+//! Harness for the integration tests: one Postgres and one Redis container
+//! per test binary, a freshly migrated database per test.
+//!
+//! Needs a Docker daemon. The containers are started on first use and
+//! removed by the testcontainers reaper when the binary exits.
+
+#![allow(dead_code)]
+
+use chrono::Duration;
+use sqlx::migrate::Migrator;
+use sqlx::postgres::{PgConnectOptions, PgPoolOptions};
+use sqlx::{Executor, PgPool};
+use std::path::Path;
+use std::sync::OnceLock;
+use testcontainers::runners::SyncRunner;
+use testcontainers::{Container, ImageExt};
+use testcontainers_modules::postgres::Postgres;
+use testcontainers_modules::redis::Redis;
+use uuid::Uuid;
+
+use backend::config::{GameDataConfig, RedisConfig};
+use backend::db::redis::RedisConnection;
+use backend::models::troop::TribeType;
+use backend::models::user::{CreateUser, User};
+use backend::models::village::{CreateVillage, FieldType, Village};
+use backend::repositories::user_repo::UserRepository;
+use backend::services::clock;
+use backend::services::gamedata_loader::GameDataLoader;
+use backend::services::village_service::VillageService;
+
+struct Containers {
+    postgres: Container<Postgres>,
+    redis: Container<Redis>,
+    postgres_port: u16,
+    redis_port: u16,
+}
+
+static CONTAINERS: OnceLock<Containers> = OnceLock::new();
+
+impl Containers {
+    fn start() -> Self {
+        let postgres = Postgres::default()
+            .with_tag("16-alpine")
+            .start()
+            .expect("Failed to start Postgres");
+        let redis = Redis::default().start().expect("Failed to start Redis");
+        let postgres_port = postgres
+            .get_host_port_ipv4(5432)
+            .expect("Postgres port not mapped");
+        let redis_port = redis
+            .get_host_port_ipv4(6379)
+            .expect("Redis port not mapped");
+
+        Self {
+            postgres,
+            redis,
+            postgres_port,
+            redis_port,
+        }
+    }
+}
+
+/// The shared containers. The sync runner brings up a runtime of its own,
+/// so it runs on a plain thread rather than inside the test's.
+fn containers() -> &'static Containers {
+    CONTAINERS.get_or_init(|| {
+        std::thread::spawn(Containers::start)
+            .join()
+            .expect("Failed to start test containers")
+    })
+}
+
+fn connect_options(database: &str) -> PgConnectOptions {
+    PgConnectOptions::new()
+        .host("127.0.0.1")
+        .port(containers().postgres_port)
+        .username("postgres")
+        .password("postgres")
+        .database(database)
+}
+
+/// A migrated database of its own plus a connection to the shared Redis
+pub struct TestWorld {
+    pub db: PgPool,
+    pub redis: RedisConnection,
+    pub database: String,
+}
+
+impl TestWorld {
+    /// Create and migrate a new database, then seed the game data a world
+    /// needs before anyone can play (unit definitions)
+    pub async fn new() -> Self {
+        let database = format!("test_{}", Uuid::new_v4().simple());
+
+        let admin = PgPoolOptions::new()
+            .max_connections(1)
+            .connect_with(connect_options("postgres"))
+            .await
+            .expect("Failed to connect to Postgres");
+        // The name is generated above; identifiers can't be bound
+        admin
+            .execute(format!("CREATE DATABASE \"{}\"", database).as_str())
+            .await
+            .expect("Failed to create test database");
+        admin.close().await;
+
+        let db = PgPoolOptions::new()
+            .max_connections(10)
+            .connect_with(connect_options(&database))
+            .await
+            .expect("Failed to connect to test database");
+
+        let migrations = Path::new(env!("CARGO_MANIFEST_DIR")).join("migrations");
+        Migrator::new(migrations.as_path())
+            .await
+            .expect("Failed to read migrations")
+            .run(&db)
+            .await
+            .expect("Failed to migrate test database");
+
+        GameDataLoader::load(&GameDataConfig {
+            dir: None,
+            hot_reload: false,
+        })
+        .expect("Failed to load game data");
+        GameDataLoader::sync_units(&db)
+            .await
+            .expect("Failed to seed unit definitions");
+
+        let redis = backend::db::redis::create_pool(&RedisConfig {
+            mode: "single".to_string(),
+            url: format!("redis://127.0.0.1:{}", containers().redis_port),
+            sentinels: Vec::new(),
+            sentinel_master: None,
+            password: None,
+            cluster_nodes: Vec::new(),
+        })
+        .await
+        .expect("Failed to connect to Redis");
+
+        Self {
+            db,
+            redis,
+            database,
+        }
+    }
+
+    /// A player of the given tribe with no villages yet
+    pub async fn create_player(&self, tribe: TribeType) -> User {
+        let uid = format!("test-{}", Uuid::new_v4().simple());
+        UserRepository::create(
+            &self.db,
+            CreateUser {
+                firebase_uid: uid.clone(),
+                email: Some(format!("{}@example.test", uid)),
+                display_name: Some(uid),
+                photo_url: None,
+                provider: "password".to_string(),
+                tribe,
+            },
+        )
+        .await
+        .expect("Failed to create player")
+    }
+
+    /// Found a village with its starting buildings at (x, y)
+    pub async fn create_village(&self, user: &User, x: i32, y: i32, is_capital: bool) -> Village {
+        let (village, _) = VillageService::create_village_with_buildings(
+            &self.db,
+            CreateVillage {
+                user_id: user.id,
+                name: format!("Village {}|{}", x, y),
+                x,
+                y,
+                is_capital,
+                field_type: FieldType::F4446,
+            },
+        )
+        .await
+        .expect("Failed to create village");
+
+        village
+    }
+}
+
+/// Move the game clock forward. The clock is process-wide, so every test in
+/// the same binary sees the jump; tests that depend on exact times belong
+/// in a binary of their own.
+pub fn advance_time(by: Duration) {
+    let clock = clock::clock();
+    clock.set_offset(clock.offset() + by);
+}
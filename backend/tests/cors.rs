@@ -0,0 +1,68 @@
+use axum::body::Body;
+use axum::http::{header, Method, Request, StatusCode};
+use axum::routing::post;
+use axum::Router;
+use tower::ServiceExt;
+
+use backend::config::SecurityConfig;
+use backend::middleware::cors_layer;
+
+const ORIGIN: &str = "http://localhost:5173";
+
+/// Preflight a POST from the browser client asking to send `requested`
+async fn preflight(environment: &str, requested: &str) -> (StatusCode, String) {
+    let config = SecurityConfig {
+        allowed_origins: vec![ORIGIN.to_string()],
+        cors_max_age_secs: 600,
+        hsts_max_age_secs: 0,
+    };
+    let app = Router::new()
+        .route("/api/armies", post(|| async { "OK" }))
+        .layer(cors_layer(&config, environment));
+
+    let response = app
+        .oneshot(
+            Request::builder()
+                .method(Method::OPTIONS)
+                .uri("/api/armies")
+                .header(header::ORIGIN, ORIGIN)
+                .header(header::ACCESS_CONTROL_REQUEST_METHOD, "POST")
+                .header(header::ACCESS_CONTROL_REQUEST_HEADERS, requested)
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+
+    let allowed = response
+        .headers()
+        .get(header::ACCESS_CONTROL_ALLOW_HEADERS)
+        .and_then(|h| h.to_str().ok())
+        .unwrap_or_default()
+        .to_ascii_lowercase();
+    (response.status(), allowed)
+}
+
+#[tokio::test]
+async fn a_cross_origin_client_may_send_a_captcha_token() {
+    let (status, allowed) = preflight("production", "x-captcha-token").await;
+
+    assert!(status.is_success());
+    assert!(allowed.contains("x-captcha-token"));
+}
+
+#[tokio::test]
+async fn the_dev_identity_headers_pass_preflight_in_development() {
+    let (status, allowed) = preflight("development", "x-dev-user,x-dev-email").await;
+
+    assert!(status.is_success());
+    assert!(allowed.contains("x-dev-user"));
+    assert!(allowed.contains("x-dev-email"));
+}
+
+#[tokio::test]
+async fn the_dev_identity_headers_are_not_allowed_outside_development() {
+    let (_, allowed) = preflight("production", "x-dev-user").await;
+
+    assert!(!allowed.contains("x-dev-user"));
+}
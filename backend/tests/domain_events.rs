@@ -0,0 +1,69 @@
+mod common;
+
+use sqlx::{PgConnection, Postgres, Transaction};
+use uuid::Uuid;
+
+use backend::repositories::domain_event_repo::DomainEventRepository;
+use common::TestWorld;
+
+async fn emit(conn: &mut PgConnection) -> i64 {
+    let (id,): (i64,) = sqlx::query_as(
+        r#"
+        INSERT INTO domain_events (user_id, entity_type, entity_id, action)
+        VALUES ($1, 'village', $2, 'upsert')
+        RETURNING id
+        "#,
+    )
+    .bind(Uuid::new_v4())
+    .bind(Uuid::new_v4())
+    .fetch_one(conn)
+    .await
+    .unwrap();
+
+    id
+}
+
+async fn begin_with_xid(world: &TestWorld) -> Transaction<'static, Postgres> {
+    let mut tx = world.db.begin().await.unwrap();
+    sqlx::query("SELECT pg_current_xact_id()")
+        .execute(&mut *tx)
+        .await
+        .unwrap();
+    tx
+}
+
+#[tokio::test]
+async fn head_stops_below_an_event_still_being_written() {
+    let world = TestWorld::new().await;
+
+    // The older transaction writes its event last and commits first, the
+    // younger one holds a lower id and is still running
+    let mut older = begin_with_xid(&world).await;
+    let mut younger = begin_with_xid(&world).await;
+    let low = emit(&mut younger).await;
+    let high = emit(&mut older).await;
+    older.commit().await.unwrap();
+    assert!(low < high);
+
+    let head = DomainEventRepository::safe_head(&world.db).await.unwrap();
+    assert!(head < low, "head {} passed uncommitted event {}", head, low);
+
+    younger.commit().await.unwrap();
+    let head = DomainEventRepository::safe_head(&world.db).await.unwrap();
+    assert!(head >= high);
+}
+
+#[tokio::test]
+async fn head_moves_past_rolled_back_events() {
+    let world = TestWorld::new().await;
+
+    let mut tx = world.db.begin().await.unwrap();
+    let rolled_back = emit(&mut tx).await;
+    tx.rollback().await.unwrap();
+    let mut conn = world.db.acquire().await.unwrap();
+    let committed = emit(&mut conn).await;
+
+    let head = DomainEventRepository::safe_head(&world.db).await.unwrap();
+    assert!(rolled_back < committed);
+    assert_eq!(head, committed);
+}
@@ -0,0 +1,32 @@
+mod common;
+
+use chrono::Duration;
+
+use backend::models::troop::TribeType;
+use backend::repositories::village_repo::VillageRepository;
+use backend::services::clock;
+use common::{advance_time, TestWorld};
+
+#[tokio::test]
+async fn new_player_founds_a_village_with_buildings() {
+    let world = TestWorld::new().await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+
+    let village = world.create_village(&player, 10, -10, true).await;
+
+    let villages = VillageRepository::find_by_user_id(&world.db, player.id)
+        .await
+        .unwrap();
+    assert_eq!(villages.len(), 1);
+    assert_eq!(villages[0].id, village.id);
+    assert!(villages[0].is_capital);
+}
+
+#[tokio::test]
+async fn advance_time_moves_the_game_clock() {
+    let before = clock::now();
+
+    advance_time(Duration::hours(2));
+
+    assert!(clock::now() - before >= Duration::hours(2));
+}
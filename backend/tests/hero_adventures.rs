@@ -0,0 +1,105 @@
+use chrono::{Duration, TimeZone, Utc};
+use uuid::Uuid;
+
+use backend::models::hero::{AdventureDifficulty, ItemRarity};
+use backend::services::hero_service::HeroService;
+use backend::testing::{lowest_rng, seeded_rng, FakeClock, InMemoryAdventures};
+
+#[tokio::test]
+async fn lowest_rolls_pay_the_minimum_and_find_the_commonest_item() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let log = InMemoryAdventures::default();
+    let common = log.add_item(ItemRarity::Common);
+    let uncommon = log.add_item(ItemRarity::Uncommon);
+    let short = log.start(Uuid::new_v4(), AdventureDifficulty::Short, now);
+    let long = log.start(Uuid::new_v4(), AdventureDifficulty::Long, now);
+
+    let completed = HeroService::complete_due_adventures(&log, &clock, &mut lowest_rng())
+        .await
+        .unwrap();
+
+    assert_eq!(completed, 2);
+    let (rewards, item) = log.paid(short.id).unwrap();
+    assert_eq!(
+        (rewards.experience, rewards.silver, rewards.health_damage),
+        (50, 10, 5)
+    );
+    assert_eq!(rewards.resources["wood"], 50);
+    assert_eq!(rewards.item_rarity, Some(ItemRarity::Common));
+    assert_eq!(item, Some(common));
+
+    let (rewards, item) = log.paid(long.id).unwrap();
+    assert_eq!(
+        (rewards.experience, rewards.silver, rewards.health_damage),
+        (200, 50, 15)
+    );
+    assert_eq!(item, Some(uncommon));
+}
+
+#[tokio::test]
+async fn rolls_stay_in_range_for_their_difficulty() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+
+    for seed in 0..200 {
+        let log = InMemoryAdventures::default();
+        let short = log.start(Uuid::new_v4(), AdventureDifficulty::Short, now);
+        let long = log.start(Uuid::new_v4(), AdventureDifficulty::Long, now);
+        HeroService::complete_due_adventures(&log, &clock, &mut seeded_rng(seed))
+            .await
+            .unwrap();
+
+        let (short, _) = log.paid(short.id).unwrap();
+        assert!((50..150).contains(&short.experience));
+        assert!((5..20).contains(&short.health_damage));
+        assert_ne!(short.item_rarity, Some(ItemRarity::Legendary));
+
+        let (long, _) = log.paid(long.id).unwrap();
+        assert!((200..500).contains(&long.experience));
+        assert!((15..40).contains(&long.health_damage));
+        assert_ne!(long.item_rarity, Some(ItemRarity::Common));
+    }
+}
+
+#[tokio::test]
+async fn the_same_seed_rolls_the_same_rewards() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let mut paid = Vec::new();
+
+    for _ in 0..2 {
+        let log = InMemoryAdventures::default();
+        let adventure = log.start(Uuid::new_v4(), AdventureDifficulty::Long, now);
+        HeroService::complete_due_adventures(&log, &clock, &mut seeded_rng(7))
+            .await
+            .unwrap();
+        paid.push(log.paid(adventure.id).unwrap().0);
+    }
+
+    assert_eq!(paid[0], paid[1]);
+}
+
+#[tokio::test]
+async fn an_adventure_still_underway_or_already_paid_is_left_alone() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let log = InMemoryAdventures::default();
+    let underway = log.start(
+        Uuid::new_v4(),
+        AdventureDifficulty::Short,
+        now + Duration::minutes(1),
+    );
+    let done = log.start(Uuid::new_v4(), AdventureDifficulty::Short, now);
+
+    let first = HeroService::complete_due_adventures(&log, &clock, &mut seeded_rng(1))
+        .await
+        .unwrap();
+    let again = HeroService::complete_due_adventures(&log, &clock, &mut seeded_rng(2))
+        .await
+        .unwrap();
+
+    assert_eq!((first, again), (1, 0));
+    assert!(log.paid(done.id).is_some());
+    assert!(log.paid(underway.id).is_none());
+}
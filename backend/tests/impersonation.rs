@@ -0,0 +1,84 @@
+mod common;
+
+use backend::error::AppError;
+use backend::models::impersonation::{StartImpersonationRequest, CURRENT_IMPERSONATION};
+use backend::models::troop::TribeType;
+use backend::repositories::shop_repo::ShopRepository;
+use backend::services::impersonation_service::ImpersonationService;
+use common::TestWorld;
+
+async fn make_admin(world: &TestWorld, user_id: uuid::Uuid, role: &str) {
+    sqlx::query("UPDATE users SET role = $2 WHERE id = $1")
+        .bind(user_id)
+        .bind(role)
+        .execute(&world.db)
+        .await
+        .unwrap();
+}
+
+fn request(allow_write: bool) -> StartImpersonationRequest {
+    StartImpersonationRequest {
+        reason: "Ticket 42".to_string(),
+        allow_write,
+        minutes: None,
+    }
+}
+
+#[tokio::test]
+async fn gold_is_never_spent_while_impersonating() {
+    let world = TestWorld::new().await;
+    let admin = world.create_player(TribeType::Nava).await;
+    let player = world.create_player(TribeType::Kiri).await;
+    make_admin(&world, admin.id, "admin").await;
+    ShopRepository::add_gold(&world.db, player.id, 100)
+        .await
+        .unwrap();
+
+    let started = ImpersonationService::start(&world.db, admin.id, player.id, request(true))
+        .await
+        .unwrap();
+    let (_, impersonation) = ImpersonationService::authenticate(&world.db, &started.token)
+        .await
+        .unwrap()
+        .expect("session is open");
+
+    let spent = CURRENT_IMPERSONATION
+        .scope(
+            impersonation,
+            ShopRepository::deduct_gold(&world.db, player.id, 40),
+        )
+        .await;
+
+    assert!(matches!(spent, Err(AppError::Forbidden(_))));
+    assert_eq!(
+        ShopRepository::get_gold_balance(&world.db, player.id)
+            .await
+            .unwrap(),
+        100
+    );
+}
+
+#[tokio::test]
+async fn sessions_end_when_the_admin_loses_the_role() {
+    let world = TestWorld::new().await;
+    let admin = world.create_player(TribeType::Nava).await;
+    let player = world.create_player(TribeType::Kiri).await;
+    make_admin(&world, admin.id, "admin").await;
+
+    let started = ImpersonationService::start(&world.db, admin.id, player.id, request(false))
+        .await
+        .unwrap();
+    make_admin(&world, admin.id, "user").await;
+
+    let authenticated = ImpersonationService::authenticate(&world.db, &started.token)
+        .await
+        .unwrap();
+    assert!(authenticated.is_none());
+
+    // Ended for good, not just refused while the role is missing
+    make_admin(&world, admin.id, "admin").await;
+    let authenticated = ImpersonationService::authenticate(&world.db, &started.token)
+        .await
+        .unwrap();
+    assert!(authenticated.is_none());
+}
@@ -0,0 +1,65 @@
+mod common;
+
+use chrono::Duration;
+use std::collections::HashMap;
+use uuid::Uuid;
+
+use backend::config::TickConfig;
+use backend::models::oasis::{NatureTroop, OasisType};
+use backend::repositories::oasis_repo::OasisRepository;
+use backend::services::clock;
+use backend::services::tick_service::TickService;
+use common::{advance_time, TestWorld};
+
+async fn cleared_oasis(world: &TestWorld, x: i32, y: i32) -> Uuid {
+    OasisRepository::create(
+        &world.db,
+        x,
+        y,
+        OasisType::Wood,
+        &HashMap::new(),
+        clock::now(),
+    )
+    .await
+    .unwrap();
+    OasisRepository::find_by_coordinates(&world.db, x, y)
+        .await
+        .unwrap()
+        .unwrap()
+        .id
+}
+
+#[tokio::test]
+async fn missed_regrowth_ticks_are_caught_up_up_to_the_limit() {
+    let world = TestWorld::new().await;
+    let oasis_id = cleared_oasis(&world, 40, 40).await;
+    let config = TickConfig {
+        shard_count: 2,
+        max_catchup_ticks: 3,
+    };
+    TickService::ensure_shards(&world.db, &config)
+        .await
+        .unwrap();
+
+    // Five hourly ticks missed; only three are applied
+    advance_time(Duration::hours(5));
+    let result = TickService::run_due(&world.db, Uuid::new_v4(), &config)
+        .await
+        .unwrap();
+
+    assert!(result.oases_regrown >= 1);
+    let oasis = OasisRepository::find_by_id(&world.db, oasis_id)
+        .await
+        .unwrap()
+        .unwrap();
+    // 10% of 20 boars, 15 wolves and 6 bears per tick
+    assert_eq!(oasis.animals.0.get(&NatureTroop::WildBoar), Some(&6));
+    assert_eq!(oasis.animals.0.get(&NatureTroop::Wolf), Some(&3));
+    assert_eq!(oasis.animals.0.get(&NatureTroop::Bear), Some(&3));
+
+    // Nothing is due again until the next interval
+    let again = TickService::run_due(&world.db, Uuid::new_v4(), &config)
+        .await
+        .unwrap();
+    assert_eq!(again.oases_regrown, 0);
+}
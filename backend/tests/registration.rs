@@ -0,0 +1,156 @@
+mod common;
+
+use std::collections::HashMap;
+
+use backend::error::AppError;
+use backend::models::registration::{
+    CreateRegistrationWaveRequest, PreRegisterRequest, PreRegistrationStatus,
+};
+use backend::models::troop::TribeType;
+use backend::models::village::Quadrant;
+use backend::models::world_setting::UpdateRegistrationRequest;
+use backend::repositories::registration_repo::RegistrationRepository;
+use backend::repositories::village_repo::VillageRepository;
+use backend::services::registration_service::RegistrationService;
+use common::TestWorld;
+use uuid::Uuid;
+
+async fn configure(world: &TestWorld, admin_id: Uuid, gated: bool, caps: &[(Quadrant, i64)]) {
+    RegistrationService::update_settings(
+        &world.db,
+        admin_id,
+        UpdateRegistrationRequest {
+            gated: Some(gated),
+            quadrant_caps: Some(caps.iter().copied().collect::<HashMap<_, _>>()),
+            invite_hours: None,
+            max_group_slots: None,
+        },
+    )
+    .await
+    .unwrap();
+}
+
+#[tokio::test]
+async fn two_players_racing_for_the_last_place_do_not_both_get_it() {
+    let world = TestWorld::new().await;
+    let admin = world.create_player(TribeType::Phasuttha).await;
+    configure(&world, admin.id, false, &[(Quadrant::NorthEast, 1)]).await;
+    let first = world.create_player(TribeType::Phasuttha).await;
+    let second = world.create_player(TribeType::Phasuttha).await;
+
+    let (a, b) = tokio::join!(
+        RegistrationService::found_capital(
+            &world.db,
+            first.id,
+            "First".into(),
+            Some(Quadrant::NorthEast)
+        ),
+        RegistrationService::found_capital(
+            &world.db,
+            second.id,
+            "Second".into(),
+            Some(Quadrant::NorthEast)
+        ),
+    );
+
+    assert_eq!(a.is_ok() as u8 + b.is_ok() as u8, 1);
+    assert!(matches!(a.err().or(b.err()), Some(AppError::Conflict(_))));
+    let capitals: HashMap<Quadrant, i64> = VillageRepository::count_capitals_by_quadrant(&world.db)
+        .await
+        .unwrap()
+        .into_iter()
+        .collect();
+    assert_eq!(capitals.get(&Quadrant::NorthEast), Some(&1));
+}
+
+#[tokio::test]
+async fn an_invite_without_a_quadrant_is_held_to_caps_set_since() {
+    let world = TestWorld::new().await;
+    let admin = world.create_player(TribeType::Phasuttha).await;
+    configure(&world, admin.id, true, &[]).await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    RegistrationService::pre_register(
+        &world.db,
+        player.id,
+        PreRegisterRequest {
+            quadrant: None,
+            group_code: None,
+        },
+    )
+    .await
+    .unwrap();
+    let wave = RegistrationService::schedule_wave(
+        &world.db,
+        admin.id,
+        CreateRegistrationWaveRequest {
+            scheduled_at: None,
+            size: 1,
+        },
+    )
+    .await
+    .unwrap();
+    RegistrationService::release_wave(&world.db, wave.id)
+        .await
+        .unwrap();
+    // Invited while the world had no caps, so no quadrant is pinned
+    let invited = RegistrationRepository::find_by_user(&world.db, player.id)
+        .await
+        .unwrap()
+        .unwrap();
+    assert_eq!(invited.status, PreRegistrationStatus::Invited);
+    assert_eq!(invited.quadrant, None);
+
+    configure(&world, admin.id, true, &[(Quadrant::NorthEast, 0)]).await;
+    let closed = RegistrationService::found_capital(
+        &world.db,
+        player.id,
+        "Closed".into(),
+        Some(Quadrant::NorthEast),
+    )
+    .await;
+
+    assert!(matches!(closed, Err(AppError::Conflict(_))));
+    assert_eq!(
+        VillageRepository::count_by_user_id(&world.db, player.id)
+            .await
+            .unwrap(),
+        0
+    );
+}
+
+#[tokio::test]
+async fn founding_the_first_village_marks_the_player_joined() {
+    let world = TestWorld::new().await;
+    let admin = world.create_player(TribeType::Phasuttha).await;
+    configure(&world, admin.id, false, &[(Quadrant::SouthWest, 5)]).await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    RegistrationService::pre_register(
+        &world.db,
+        player.id,
+        PreRegisterRequest {
+            quadrant: Some(Quadrant::SouthWest),
+            group_code: None,
+        },
+    )
+    .await
+    .unwrap();
+
+    let (village, buildings) = RegistrationService::found_capital(
+        &world.db,
+        player.id,
+        "Capital".into(),
+        Some(Quadrant::SouthWest),
+    )
+    .await
+    .unwrap();
+
+    assert!(village.is_capital);
+    assert!(village.x < 0 && village.y < 0);
+    assert!(!buildings.is_empty());
+    let registration = RegistrationRepository::find_by_user(&world.db, player.id)
+        .await
+        .unwrap()
+        .unwrap();
+    assert_eq!(registration.status, PreRegistrationStatus::Joined);
+    assert!(registration.joined_at.is_some());
+}
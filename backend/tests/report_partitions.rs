@@ -0,0 +1,47 @@
+mod common;
+
+use chrono::{TimeZone, Utc};
+
+use backend::repositories::report_repo::ReportRepository;
+use common::TestWorld;
+
+#[tokio::test]
+async fn an_empty_partition_is_dropped() {
+    let world = TestWorld::new().await;
+    let at = Utc.with_ymd_and_hms(2001, 2, 3, 0, 0, 0).unwrap();
+    let partition = ReportRepository::ensure_partition(&world.db, at)
+        .await
+        .unwrap();
+
+    let dropped = ReportRepository::drop_partition_if_empty(&world.db, &partition)
+        .await
+        .unwrap();
+
+    assert!(dropped);
+    let partitions = ReportRepository::list_partitions(&world.db).await.unwrap();
+    assert!(!partitions.contains(&partition));
+}
+
+#[tokio::test]
+async fn a_partition_name_is_quoted_not_spliced_in() {
+    let world = TestWorld::new().await;
+    let at = Utc.with_ymd_and_hms(2001, 3, 4, 0, 0, 0).unwrap();
+    let partition = ReportRepository::ensure_partition(&world.db, at)
+        .await
+        .unwrap();
+    sqlx::query("CREATE TABLE keep_me (id INT)")
+        .execute(&world.db)
+        .await
+        .unwrap();
+
+    // Spliced into the SQL between double quotes, this names two tables
+    let name = format!("{}\", \"keep_me", partition);
+    let result = ReportRepository::drop_partition_if_empty(&world.db, &name).await;
+
+    assert!(result.is_err());
+    let kept: (bool,) = sqlx::query_as("SELECT to_regclass('keep_me') IS NOT NULL")
+        .fetch_one(&world.db)
+        .await
+        .unwrap();
+    assert!(kept.0);
+}
@@ -0,0 +1,49 @@
+use chrono::{Duration, TimeZone, Utc};
+
+use backend::models::village::ProductionShare;
+use backend::services::resource_service::ResourceService;
+use backend::testing::InMemoryVillages;
+
+#[tokio::test]
+async fn production_is_paid_for_the_time_elapsed_up_to_storage() {
+    let at = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let villages = InMemoryVillages::default();
+    let rates = ProductionShare {
+        wood: 100,
+        clay: 60,
+        iron: 30,
+        crop: 400,
+    };
+    let village = villages.found(500, 1000, rates, at);
+
+    let settled = ResourceService::settle(&villages, village.id, at + Duration::minutes(90))
+        .await
+        .unwrap();
+
+    assert_eq!(settled.wood, 650);
+    assert_eq!(settled.clay, 590);
+    assert_eq!(settled.iron, 545);
+    // 600 crop produced, but the granary holds 1000
+    assert_eq!(settled.crop, 1000);
+    assert_eq!(settled.resources_updated_at, at + Duration::minutes(90));
+}
+
+#[tokio::test]
+async fn settling_at_or_before_the_last_settlement_changes_nothing() {
+    let at = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let villages = InMemoryVillages::default();
+    let rates = ProductionShare {
+        wood: 100,
+        clay: 100,
+        iron: 100,
+        crop: 100,
+    };
+    let village = villages.found(500, 1000, rates, at);
+
+    let settled = ResourceService::settle(&villages, village.id, at - Duration::minutes(5))
+        .await
+        .unwrap();
+
+    assert_eq!(settled.wood, 500);
+    assert_eq!(villages.get(village.id).unwrap().version, village.version);
+}
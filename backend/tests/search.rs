@@ -0,0 +1,101 @@
+mod common;
+
+use backend::models::search::MessageSearchQuery;
+use backend::models::troop::TribeType;
+use backend::repositories::message_repo::MessageRepository;
+use backend::services::search_service::SearchService;
+use common::TestWorld;
+
+fn message_query(q: &str) -> MessageSearchQuery {
+    MessageSearchQuery {
+        q: q.to_string(),
+        sender_id: None,
+        from: None,
+        to: None,
+        limit: 10,
+        offset: 0,
+    }
+}
+
+#[tokio::test]
+async fn message_headlines_escape_the_body() {
+    let world = TestWorld::new().await;
+    let sender = world.create_player(TribeType::Phasuttha).await;
+    let recipient = world.create_player(TribeType::Nava).await;
+    let conversation =
+        MessageRepository::get_or_create_conversation(&world.db, sender.id, recipient.id)
+            .await
+            .unwrap();
+    MessageRepository::create_private_message(
+        &world.db,
+        sender.id,
+        recipient.id,
+        conversation.id,
+        "Raid plan",
+        "Catapults <img src=x onerror=alert(1)> at dawn & \"quietly\"",
+    )
+    .await
+    .unwrap();
+
+    let results = SearchService::search_messages(
+        &world.db,
+        "simple",
+        recipient.id,
+        message_query("catapults"),
+    )
+    .await
+    .unwrap();
+
+    assert_eq!(results.len(), 1);
+    let headline = &results[0].headline;
+    assert!(headline.contains("<mark>Catapults</mark>"), "{}", headline);
+    assert!(headline.contains("&lt;img"), "{}", headline);
+    assert!(!headline.contains("<img"), "{}", headline);
+}
+
+#[tokio::test]
+async fn changing_the_language_rebuilds_the_stored_vectors() {
+    let world = TestWorld::new().await;
+    let sender = world.create_player(TribeType::Phasuttha).await;
+    let recipient = world.create_player(TribeType::Nava).await;
+    let conversation =
+        MessageRepository::get_or_create_conversation(&world.db, sender.id, recipient.id)
+            .await
+            .unwrap();
+    MessageRepository::create_private_message(
+        &world.db,
+        sender.id,
+        recipient.id,
+        conversation.id,
+        "Orders",
+        "Stop the raids on the northern villages",
+    )
+    .await
+    .unwrap();
+
+    // 'simple' doesn't stem, so "raiding" and "raids" don't meet
+    let unstemmed =
+        SearchService::search_messages(&world.db, "simple", recipient.id, message_query("raiding"))
+            .await
+            .unwrap();
+    assert!(unstemmed.is_empty());
+
+    SearchService::apply_language(&world.db, "english")
+        .await
+        .unwrap();
+    let stemmed = SearchService::search_messages(
+        &world.db,
+        "english",
+        recipient.id,
+        message_query("raiding"),
+    )
+    .await
+    .unwrap();
+
+    assert_eq!(stemmed.len(), 1);
+    assert!(
+        stemmed[0].headline.contains("<mark>raids</mark>"),
+        "{}",
+        stemmed[0].headline
+    );
+}
@@ -0,0 +1,104 @@
+mod common;
+
+use backend::error::AppError;
+use backend::models::snapshot::{PlayerSnapshot, RestoreSnapshotRequest};
+use backend::models::troop::TribeType;
+use backend::services::snapshot_service::SnapshotService;
+use common::TestWorld;
+use uuid::Uuid;
+
+async fn research_count(world: &TestWorld, village_id: Uuid) -> i64 {
+    let count: (i64,) = sqlx::query_as(
+        "SELECT COUNT(*) FROM village_research WHERE village_id = $1 AND troop_type = 'spearman'",
+    )
+    .bind(village_id)
+    .fetch_one(&world.db)
+    .await
+    .unwrap();
+    count.0
+}
+
+#[tokio::test]
+async fn restore_brings_back_state_from_later_tables() {
+    let world = TestWorld::new().await;
+    let admin = world.create_player(TribeType::Phasuttha).await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    let village = world.create_village(&player, 3, 3, true).await;
+    sqlx::query(
+        "INSERT INTO village_research (village_id, troop_type) VALUES ($1, 'spearman') \
+         ON CONFLICT DO NOTHING",
+    )
+    .bind(village.id)
+    .execute(&world.db)
+    .await
+    .unwrap();
+    let summary = SnapshotService::create_snapshot(&world.db, admin.id, player.id, None)
+        .await
+        .unwrap();
+    sqlx::query("DELETE FROM village_research WHERE village_id = $1")
+        .bind(village.id)
+        .execute(&world.db)
+        .await
+        .unwrap();
+
+    let result = SnapshotService::restore(
+        &world.db,
+        admin.id,
+        player.id,
+        RestoreSnapshotRequest {
+            snapshot_id: Some(summary.id),
+            snapshot: None,
+            reason: None,
+        },
+    )
+    .await
+    .unwrap();
+
+    assert_eq!(research_count(&world, village.id).await, 1);
+    assert!(result.research_restored >= 1);
+    assert_eq!(result.villages_restored, 1);
+    assert!(result.buildings_restored > 0);
+}
+
+#[tokio::test]
+async fn a_snapshot_of_an_older_format_is_refused() {
+    let world = TestWorld::new().await;
+    let admin = world.create_player(TribeType::Phasuttha).await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    world.create_village(&player, 4, 4, true).await;
+    let summary = SnapshotService::create_snapshot(&world.db, admin.id, player.id, None)
+        .await
+        .unwrap();
+    let current = SnapshotService::get_snapshot(&world.db, summary.id)
+        .await
+        .unwrap();
+
+    // A version 1 document: no tables added since
+    let mut document = serde_json::to_value(&current).unwrap();
+    let fields = document.as_object_mut().unwrap();
+    for table in [
+        "building_queue",
+        "village_research",
+        "research_queue",
+        "wounded_troops",
+        "healing_queue",
+    ] {
+        fields.remove(table);
+    }
+    fields.insert("format_version".into(), 1.into());
+    let older: PlayerSnapshot = serde_json::from_value(document).unwrap();
+
+    let result = SnapshotService::restore(
+        &world.db,
+        admin.id,
+        player.id,
+        RestoreSnapshotRequest {
+            snapshot_id: None,
+            snapshot: Some(older),
+            reason: None,
+        },
+    )
+    .await;
+
+    assert!(matches!(result, Err(AppError::BadRequest(_))));
+}
@@ -0,0 +1,101 @@
+mod common;
+
+use chrono::{Duration, TimeZone, Utc};
+use uuid::Uuid;
+
+use backend::models::troop::{TribeType, TroopType};
+use backend::repositories::troop_repo::{TrainingQueue, TroopRepository};
+use backend::services::clock;
+use backend::services::troop_service::TroopService;
+use backend::testing::{FakeClock, InMemoryTrainingQueue};
+use common::TestWorld;
+
+#[tokio::test]
+async fn finished_training_is_added_once_when_two_jobs_race() {
+    let world = TestWorld::new().await;
+    let player = world.create_player(TribeType::Phasuttha).await;
+    let village = world.create_village(&player, 3, 4, true).await;
+
+    let now = clock::now();
+    let entry = TroopRepository::add_to_queue(
+        &world.db,
+        village.id,
+        TroopType::Infantry,
+        25,
+        60,
+        now - Duration::minutes(30),
+        now - Duration::minutes(5),
+    )
+    .await
+    .unwrap();
+
+    // The regular job and a catch-up pass find the same overdue entry
+    let (job, catch_up) = tokio::join!(
+        TroopService::process_completed_training(&world.db),
+        TroopRepository::complete_training(&world.db, &entry),
+    );
+    let completions = job.unwrap() + i32::from(catch_up.unwrap());
+    assert_eq!(completions, 1);
+
+    let troops =
+        TroopRepository::find_by_village_and_type(&world.db, village.id, TroopType::Infantry)
+            .await
+            .unwrap()
+            .expect("troops were added");
+    assert_eq!(troops.count, 25);
+    assert_eq!(troops.in_village, 25);
+    assert!(TroopRepository::find_queue_by_id(&world.db, entry.id)
+        .await
+        .unwrap()
+        .is_none());
+}
+
+#[tokio::test]
+async fn completes_only_entries_that_are_due() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let queue = InMemoryTrainingQueue::default();
+    let village = Uuid::new_v4();
+    queue.push(village, TroopType::Infantry, 10, now - Duration::seconds(60));
+    queue.push(village, TroopType::Infantry, 5, now);
+    queue.push(village, TroopType::Spearman, 3, now + Duration::seconds(60));
+
+    let completed = TroopService::complete_due_training(&queue, &clock)
+        .await
+        .unwrap();
+
+    assert_eq!(completed, 2);
+    assert_eq!(queue.troops(village, TroopType::Infantry), 15);
+    assert_eq!(queue.troops(village, TroopType::Spearman), 0);
+    assert_eq!(queue.queued(), 1);
+
+    clock.advance(Duration::minutes(1));
+    let completed = TroopService::complete_due_training(&queue, &clock)
+        .await
+        .unwrap();
+
+    assert_eq!(completed, 1);
+    assert_eq!(queue.troops(village, TroopType::Spearman), 3);
+    assert_eq!(queue.queued(), 0);
+}
+
+#[tokio::test]
+async fn an_entry_completed_elsewhere_is_not_trained_twice() {
+    let now = Utc.with_ymd_and_hms(2025, 3, 1, 12, 0, 0).unwrap();
+    let clock = FakeClock::new(now);
+    let queue = InMemoryTrainingQueue::default();
+    let village = Uuid::new_v4();
+    let entry = queue.push(village, TroopType::Infantry, 10, now - Duration::seconds(30));
+
+    // A catch-up pass gets there between the job's read and its write
+    let due = queue.find_completed(now).await.unwrap();
+    assert!(queue.complete(&entry).await.unwrap());
+    assert!(!queue.complete(&due[0]).await.unwrap());
+
+    let completed = TroopService::complete_due_training(&queue, &clock)
+        .await
+        .unwrap();
+
+    assert_eq!(completed, 0);
+    assert_eq!(queue.troops(village, TroopType::Infantry), 10);
+}
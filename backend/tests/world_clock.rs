@@ -0,0 +1,191 @@
+use chrono::{DateTime, Duration, FixedOffset, NaiveTime, TimeZone, Utc};
+use std::sync::Arc;
+use uuid::Uuid;
+
+use backend::models::building::BuildingType;
+use backend::services::building_service::BuildingService;
+use backend::services::clock::{Clock, OffsetClock, WorldClock};
+use backend::testing::{FakeClock, InMemoryBuildingQueue};
+
+fn at(h: u32, m: u32, s: u32) -> DateTime<Utc> {
+    Utc.with_ymd_and_hms(2025, 6, 30, h, m, s).unwrap()
+}
+
+fn world_on(host: &Arc<FakeClock>) -> WorldClock {
+    WorldClock::new(host.clone())
+}
+
+/// The game clock stacked on `host` as it is in the server
+fn game_on(host: &Arc<FakeClock>) -> OffsetClock {
+    OffsetClock::new(Arc::new(world_on(host)))
+}
+
+/// Wall-clock time in New York for `at` in 2025: EDT from 2am on 9 March
+/// to 2am on 2 November, EST either side
+fn new_york(at: DateTime<Utc>) -> NaiveTime {
+    let daylight = Utc.with_ymd_and_hms(2025, 3, 9, 7, 0, 0).unwrap()
+        ..Utc.with_ymd_and_hms(2025, 11, 2, 6, 0, 0).unwrap();
+    let hours = if daylight.contains(&at) { -4 } else { -5 };
+    at.with_timezone(&FixedOffset::east_opt(hours * 3600).unwrap())
+        .time()
+}
+
+#[test]
+fn applies_the_database_offset() {
+    let host = Arc::new(FakeClock::new(at(12, 0, 0)));
+    let world = world_on(&host);
+
+    // The database reads 2s ahead of the host, with a 40ms round trip
+    let sent = at(12, 0, 0);
+    let received = sent + Duration::milliseconds(40);
+    let skew = world.apply_reading(sent, at(12, 0, 2) + Duration::milliseconds(20), received);
+
+    assert_eq!(skew, Some(Duration::seconds(2)));
+    assert_eq!(world.now(), at(12, 0, 2));
+}
+
+#[test]
+fn ignores_readings_with_a_slow_or_negative_round_trip() {
+    let host = Arc::new(FakeClock::new(at(12, 0, 0)));
+    let world = world_on(&host);
+
+    let slow = world.apply_reading(at(12, 0, 0), at(12, 0, 5), at(12, 0, 1));
+    let stepped = world.apply_reading(at(12, 0, 1), at(12, 0, 5), at(12, 0, 0));
+
+    assert_eq!((slow, stepped), (None, None));
+    assert_eq!(world.skew(), Duration::zero());
+}
+
+#[test]
+fn holds_still_through_a_backwards_ntp_step() {
+    let host = Arc::new(FakeClock::new(at(12, 0, 10)));
+    let world = world_on(&host);
+    let before = world.now();
+
+    host.set(at(12, 0, 4));
+    assert_eq!(world.now(), before);
+
+    host.set(at(12, 0, 9));
+    assert_eq!(world.now(), before);
+
+    host.set(at(12, 0, 11));
+    assert_eq!(world.now(), at(12, 0, 11));
+}
+
+#[test]
+fn holds_still_through_a_repeated_leap_second() {
+    let host = Arc::new(FakeClock::new(at(23, 59, 59)));
+    let world = world_on(&host);
+    let mut last = world.now();
+
+    // 23:59:59.000 .. .900, then the same second again, then midnight
+    let mut readings: Vec<DateTime<Utc>> = (0..10)
+        .map(|tenth| at(23, 59, 59) + Duration::milliseconds(tenth * 100))
+        .collect();
+    readings.extend(readings.clone());
+    readings.push(at(23, 59, 59) + Duration::seconds(1));
+
+    for reading in readings {
+        host.set(reading);
+        let now = world.now();
+        assert!(now >= last, "{} ran back to {}", last, now);
+        last = now;
+    }
+    assert_eq!(last, at(23, 59, 59) + Duration::seconds(1));
+}
+
+#[test]
+fn a_smaller_database_offset_never_runs_time_backwards() {
+    let host = Arc::new(FakeClock::new(at(12, 0, 0)));
+    let world = world_on(&host);
+    world.set_skew(Duration::seconds(3));
+    let before = world.now();
+
+    // The next sync finds the host only 1s behind
+    world.set_skew(Duration::seconds(1));
+    host.advance(Duration::seconds(1));
+
+    assert_eq!(world.now(), before);
+    host.advance(Duration::seconds(2));
+    assert_eq!(world.now(), at(12, 0, 4));
+}
+
+#[test]
+fn the_high_water_mark_survives_a_restart() {
+    let host = Arc::new(FakeClock::new(at(12, 0, 30)));
+    let previous_run = world_on(&host);
+    let high_water = previous_run.now();
+
+    // Restarted on a host running 20s behind
+    let host = Arc::new(FakeClock::new(at(12, 0, 10)));
+    let world = world_on(&host);
+
+    assert!(world.restore_high_water(high_water));
+    assert_eq!(world.now(), high_water);
+    host.advance(Duration::seconds(25));
+    assert_eq!(world.now(), at(12, 0, 35));
+}
+
+#[test]
+fn a_high_water_mark_far_ahead_is_ignored() {
+    let host = Arc::new(FakeClock::new(at(12, 0, 0)));
+    let world = world_on(&host);
+
+    assert!(!world.restore_high_water(at(14, 0, 0)));
+    assert_eq!(world.floor(), None);
+    assert_eq!(world.now(), at(12, 0, 0));
+}
+
+/// Schedule a one-hour upgrade at `start` and check it takes exactly an
+/// hour of host time however the New York wall clock moves meanwhile.
+/// Returns the wall-clock times it started and ended at.
+async fn one_hour_upgrade_from(start: DateTime<Utc>) -> (NaiveTime, NaiveTime) {
+    let host = Arc::new(FakeClock::new(start));
+    let game = game_on(&host);
+    let queue = InMemoryBuildingQueue::default();
+
+    let scheduled = game.now();
+    let ends_at = scheduled + Duration::hours(1);
+    let building = queue.push(Uuid::new_v4(), BuildingType::MainBuilding, 1, Some(ends_at));
+    assert_eq!(ends_at - scheduled, Duration::seconds(3600));
+
+    host.advance(Duration::hours(1) - Duration::seconds(1));
+    let early = BuildingService::complete_due_upgrades(&queue, &game)
+        .await
+        .unwrap();
+    assert!(early.is_empty());
+
+    host.advance(Duration::seconds(1));
+    let done = BuildingService::complete_due_upgrades(&queue, &game)
+        .await
+        .unwrap();
+    assert_eq!(done.len(), 1);
+    assert_eq!(done[0].id, building.id);
+    assert_eq!(game.now() - scheduled, Duration::hours(1));
+
+    (new_york(scheduled), new_york(ends_at))
+}
+
+#[tokio::test]
+async fn an_upgrade_across_the_spring_forward_takes_one_real_hour() {
+    // 01:30 EST, half an hour before clocks go forward to 03:00 EDT
+    let start = Utc.with_ymd_and_hms(2025, 3, 9, 6, 30, 0).unwrap();
+
+    let (started, ended) = one_hour_upgrade_from(start).await;
+
+    // Two hours pass on the wall clock, one in the game
+    assert_eq!(started, NaiveTime::from_hms_opt(1, 30, 0).unwrap());
+    assert_eq!(ended, NaiveTime::from_hms_opt(3, 30, 0).unwrap());
+}
+
+#[tokio::test]
+async fn an_upgrade_across_the_fall_back_takes_one_real_hour() {
+    // 01:30 EDT, half an hour before clocks go back to 01:00 EST
+    let start = Utc.with_ymd_and_hms(2025, 11, 2, 5, 30, 0).unwrap();
+
+    let (started, ended) = one_hour_upgrade_from(start).await;
+
+    // No time passes on the wall clock, one hour in the game
+    assert_eq!(started, NaiveTime::from_hms_opt(1, 30, 0).unwrap());
+    assert_eq!(ended, NaiveTime::from_hms_opt(1, 30, 0).unwrap());
+}
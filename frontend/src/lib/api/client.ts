@@ -1,4 +1,5 @@
 import { auth } from "../firebase/config";
+import type { ErrorCode } from "./error-codes.gen";
 
 const BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080';
 
@@ -10,6 +11,14 @@ interface RequestOptions {
     auth?: boolean; // Default true
 }
 
+/** A failed API call; branch on `code` rather than the message */
+export class ApiError extends Error {
+    constructor(message: string, public status: number, public code?: ErrorCode) {
+        super(message);
+        this.name = 'ApiError';
+    }
+}
+
 async function request<T>(method: RequestMethod, endpoint: string, options: RequestOptions = {}): Promise<T> {
     const { headers = {}, body, auth: useAuth = true } = options;
 
@@ -34,13 +43,15 @@ async function request<T>(method: RequestMethod, endpoint: string, options: Requ
 
     if (!response.ok) {
         let errorMessage = 'An error occurred';
+        let errorCode: ErrorCode | undefined;
         try {
             const errorData = await response.json();
-            errorMessage = errorData.message || errorMessage;
+            errorMessage = errorData.error?.message || errorData.message || errorMessage;
+            errorCode = errorData.error?.error_code;
         } catch (e) {
             // Ignore JSON parse error
         }
-        throw new Error(errorMessage);
+        throw new ApiError(errorMessage, response.status, errorCode);
     }
 
     // Handle 204 No Content
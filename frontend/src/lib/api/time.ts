@@ -0,0 +1,49 @@
+import { writable, type Writable } from 'svelte/store';
+import { api } from './client';
+import type { PongPayload } from './ws-protocol.gen';
+import { wsClient } from './ws';
+
+interface ServerClock {
+    // Add to Date.now() to get game time
+    offsetMs: number;
+    // Round trip of the sample the offset came from
+    rttMs: number | null;
+    paused: boolean;
+}
+
+export const serverClock: Writable<ServerClock> = writable({ offsetMs: 0, rttMs: null, paused: false });
+
+// Samples with a longer round trip are too noisy to trust
+const MAX_RTT_MS = 2000;
+
+let best: number | null = null;
+
+/** Fold in one exchange; t0 is when it was sent, t3 when it came back */
+function record(sync: PongPayload, t0: number, t3: number) {
+    const rtt = (t3 - t0) - (sync.server_time_ms - sync.received_ms);
+    if (rtt < 0 || rtt > MAX_RTT_MS) return;
+    const offset = ((sync.received_ms - t0) + (sync.server_time_ms - t3)) / 2;
+    // Keep the offset from the quickest exchange seen; it is the least skewed
+    if (best === null || rtt <= best) {
+        best = rtt;
+        serverClock.set({ offsetMs: offset, rttMs: rtt, paused: sync.paused });
+    } else {
+        serverClock.update(s => ({ ...s, paused: sync.paused }));
+    }
+}
+
+/** Measure the offset over HTTP */
+export async function syncServerClock() {
+    const t0 = Date.now();
+    const sync = await api.get<PongPayload>(`/api/v1/time?client_time=${t0}`, { auth: false });
+    record(sync, sync.client_time ?? t0, Date.now());
+}
+
+/** Measure the offset from WebSocket pings */
+export function trackServerClock(): () => void {
+    const unsubscribe = wsClient.subscribe('pong', sync => {
+        if (sync.client_time !== undefined) record(sync, sync.client_time, Date.now());
+    });
+    wsClient.send('ping', { client_time: Date.now() });
+    return unsubscribe;
+}
@@ -1,35 +1,52 @@
 import { writable, type Writable } from 'svelte/store';
 import { auth } from '../firebase/config';
+import {
+    WS_PROTOCOL_VERSION,
+    type ClientMessages,
+    type ClientMessageType,
+    type ServerMessages,
+    type ServerMessageType
+} from './ws-protocol.gen';
 
 interface WebSocketState {
     connected: boolean;
     error: Event | null;
+    protocolVersion: number | null;
 }
 
 export const wsState: Writable<WebSocketState> = writable({
     connected: false,
-    error: null
+    error: null,
+    protocolVersion: null
 });
 
-type WebSocketHandler = (data: any) => void;
+type WebSocketHandler<T extends ServerMessageType = ServerMessageType> = (data: ServerMessages[T]) => void;
 
 class WebSocketClient {
     private ws: WebSocket | null = null;
+    // Server-Sent Events fallback for networks that block WebSockets
+    private sse: EventSource | null = null;
     private url: string;
+    private sseUrl: string;
     private reconnectAttempts = 0;
     private maxReconnectAttempts = 5;
     private reconnectDelay = 1000;
-    private handlers: Map<string, WebSocketHandler[]> = new Map();
+    private handlers: Map<string, WebSocketHandler<any>[]> = new Map();
     private shouldReconnect = true;
+    private protocolVersion = 1;
+    private seq = 0;
+    // Cursor of the last buffered event seen, to resume from on reconnect
+    private lastEventId: string | null = null;
 
     constructor() {
         const apiUrl = import.meta.env.VITE_API_URL || 'http://localhost:8080';
         // Convert http(s) to ws(s)
         this.url = apiUrl.replace(/^http/, 'ws') + '/ws';
+        this.sseUrl = apiUrl + '/sse';
     }
 
     async connect() {
-        if (this.ws?.readyState === WebSocket.OPEN) return;
+        if (this.ws?.readyState === WebSocket.OPEN || this.sse) return;
 
         this.shouldReconnect = true;
         let token = '';
@@ -38,15 +55,19 @@ class WebSocketClient {
             token = await auth.currentUser.getIdToken();
         }
 
-        const wsUrl = token ? `${this.url}?token=${token}` : this.url;
+        const params = new URLSearchParams({ v: String(WS_PROTOCOL_VERSION) });
+        if (token) params.set('token', token);
+        if (this.lastEventId) params.set('resume', this.lastEventId);
+        const wsUrl = `${this.url}?${params}`;
 
         try {
             this.ws = new WebSocket(wsUrl);
 
             this.ws.onopen = () => {
                 console.log('WebSocket connected');
-                wsState.set({ connected: true, error: null });
+                wsState.set({ connected: true, error: null, protocolVersion: null });
                 this.reconnectAttempts = 0;
+                this.seq = 0;
             };
 
             this.ws.onclose = () => {
@@ -65,7 +86,9 @@ class WebSocketClient {
             this.ws.onmessage = (event) => {
                 try {
                     const message = JSON.parse(event.data);
-                    this.dispatch(message.type, message.data);
+                    // v2+ frames carry a payload; a v1 server sends data
+                    const payload = 'v' in message ? message.payload : message.data;
+                    this.handleMessage(message.type, payload, message.id);
                 } catch (e) {
                     console.error('Failed to parse WebSocket message:', event.data);
                 }
@@ -79,23 +102,81 @@ class WebSocketClient {
 
     disconnect() {
         this.shouldReconnect = false;
+        this.lastEventId = null;
         if (this.ws) {
             this.ws.close();
             this.ws = null;
         }
+        if (this.sse) {
+            this.sse.close();
+            this.sse = null;
+        }
+    }
+
+    // Receive-only; EventSource reconnects (and resumes) by itself
+    private async connectSse() {
+        const params = new URLSearchParams();
+        if (auth?.currentUser) {
+            params.set('token', await auth.currentUser.getIdToken());
+        }
+        if (this.lastEventId) params.set('resume', this.lastEventId);
+
+        this.sse = new EventSource(`${this.sseUrl}?${params}`);
+        this.sse.onopen = () => {
+            console.log('Event stream connected');
+            wsState.set({ connected: true, error: null, protocolVersion: null });
+        };
+        this.sse.onerror = (error) => {
+            wsState.update(s => ({ ...s, connected: this.sse?.readyState === EventSource.OPEN, error }));
+        };
+
+        // connected is always handled, whether or not anyone subscribed
+        this.listenSse('connected');
+        for (const type of this.handlers.keys()) {
+            if (type !== 'connected') this.listenSse(type);
+        }
+    }
+
+    private listenSse(type: string) {
+        this.sse?.addEventListener(type, (event) => {
+            const message = event as MessageEvent;
+            try {
+                this.handleMessage(type, JSON.parse(message.data), message.lastEventId || undefined);
+            } catch (e) {
+                console.error('Failed to parse event stream message:', message.data);
+            }
+        });
+    }
+
+    private handleMessage(type: string, payload: any, id?: string) {
+        if (id) this.lastEventId = id;
+        if (type === 'connected') {
+            this.protocolVersion = payload.protocol_version ?? 1;
+            // Missed events are gone; listeners refetch instead
+            if (!payload.resumed) this.lastEventId = null;
+            wsState.update(s => ({ ...s, protocolVersion: this.protocolVersion }));
+        }
+        this.dispatch(type, payload);
     }
 
-    send(type: string, data: any) {
+    send<T extends ClientMessageType>(type: T, payload: ClientMessages[T]) {
         if (this.ws?.readyState === WebSocket.OPEN) {
-            this.ws.send(JSON.stringify({ type, data }));
+            const message =
+                this.protocolVersion >= 2
+                    ? { v: this.protocolVersion, type, seq: ++this.seq, payload }
+                    : { type, ...payload };
+            this.ws.send(JSON.stringify(message));
+        } else if (this.sse) {
+            console.warn('Event stream is receive-only, cannot send message:', type);
         } else {
             console.warn('WebSocket not connected, cannot send message:', type);
         }
     }
 
-    subscribe(type: string, handler: WebSocketHandler) {
+    subscribe<T extends ServerMessageType>(type: T, handler: WebSocketHandler<T>) {
         if (!this.handlers.has(type)) {
             this.handlers.set(type, []);
+            if (type !== 'connected') this.listenSse(type);
         }
         this.handlers.get(type)?.push(handler);
 
@@ -106,7 +187,7 @@ class WebSocketClient {
         };
     }
 
-    private dispatch(type: string, data: any) {
+    private dispatch(type: string, data: unknown) {
         const handlers = this.handlers.get(type);
         if (handlers) {
             handlers.forEach(h => h(data));
@@ -123,7 +204,8 @@ class WebSocketClient {
                 this.connect();
             }, delay);
         } else {
-            console.error('Max reconnection attempts reached');
+            console.error('Max reconnection attempts reached, falling back to event stream');
+            this.connectSse();
         }
     }
 }
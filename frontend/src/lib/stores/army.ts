@@ -4,7 +4,7 @@ import { api } from "../api/client";
 import type { TroopType } from "./troop";
 
 // Mission types matching backend
-export type MissionType = 'raid' | 'attack' | 'conquer' | 'support' | 'scout' | 'settle';
+export type MissionType = 'raid' | 'attack' | 'conquer' | 'support' | 'scout' | 'settle' | 'transfer';
 
 export interface CarriedResources {
     wood: number;
@@ -30,6 +30,7 @@ export interface Army {
     returns_at: string | null;
     is_returning: boolean;
     is_stationed: boolean;
+    hero_id: string | null;
 }
 
 export interface BattleReport {
@@ -43,6 +44,8 @@ export interface BattleReport {
     defender_troops: TroopCounts;
     attacker_losses: TroopCounts;
     defender_losses: TroopCounts;
+    /** Part of the defender's losses taken to their hospital */
+    defender_wounded: TroopCounts;
     resources_stolen: CarriedResources;
     winner: 'attacker' | 'defender' | 'draw';
     occurred_at: string;
@@ -72,6 +75,25 @@ export interface SendArmyRequest {
     mission: MissionType;
     troops: TroopCounts;
     resources?: CarriedResources;
+    hero_id?: string;
+}
+
+export interface PlanArmyRequest {
+    to_x: number;
+    to_y: number;
+    mission: MissionType;
+    troops: TroopCounts;
+}
+
+export interface ArmyPlan {
+    distance: number;
+    slowest_speed: number;
+    tournament_square_level: number;
+    speed_bonus_percent: number;
+    boost_after_distance: number;
+    travel_seconds: number;
+    arrives_at: string;
+    returns_at: string | null;
 }
 
 interface ArmyState {
@@ -135,6 +157,11 @@ function createArmyStore() {
             }
         },
 
+        // Travel time and arrival of a march, without sending it
+        planArmy: async (villageId: string, request: PlanArmyRequest) => {
+            return api.post<ArmyPlan>(`/api/villages/${villageId}/armies/plan`, request);
+        },
+
         // Load outgoing armies from village
         loadOutgoing: async (villageId: string) => {
             update(state => ({ ...state, loading: true, error: null }));
@@ -231,6 +258,21 @@ function createArmyStore() {
             }
         },
 
+        // Delete report from own list; the other side keeps it
+        deleteReport: async (reportId: string) => {
+            await api.delete(`/api/reports/${reportId}`);
+            update(state => {
+                const report = state.reports.find(r => r.id === reportId);
+                return {
+                    ...state,
+                    reports: state.reports.filter(r => r.id !== reportId),
+                    unreadCount: report && !report.is_read
+                        ? Math.max(0, state.unreadCount - 1)
+                        : state.unreadCount,
+                };
+            });
+        },
+
         // Load unread count
         loadUnreadCount: async () => {
             try {
@@ -298,6 +340,21 @@ function createArmyStore() {
             }
         },
 
+        // Delete scout report from own list
+        deleteScoutReport: async (reportId: string) => {
+            await api.delete(`/api/scout-reports/${reportId}`);
+            update(state => {
+                const report = state.scoutReports.find(r => r.id === reportId);
+                return {
+                    ...state,
+                    scoutReports: state.scoutReports.filter(r => r.id !== reportId),
+                    unreadCount: report && !report.is_read
+                        ? Math.max(0, state.unreadCount - 1)
+                        : state.unreadCount,
+                };
+            });
+        },
+
         // ==================== Stationed/Support Troops ====================
 
         // Load troops stationed at a village (support from allies)
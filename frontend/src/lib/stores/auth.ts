@@ -2,6 +2,7 @@ import { writable, get } from "svelte/store";
 import { type User, onAuthStateChanged, GoogleAuthProvider, signInWithPopup, signOut } from "firebase/auth";
 import { auth, isFirebaseConfigured } from "../firebase/config";
 import { api } from "../api/client";
+import type { TribeType } from "./troop";
 
 interface BackendUser {
     id: string;
@@ -10,6 +11,7 @@ interface BackendUser {
     display_name: string | null;
     photo_url: string | null;
     provider: string;
+    tribe: TribeType;
     created_at: string;
     updated_at: string;
 }
@@ -40,6 +42,14 @@ interface AuthState {
     syncError: string | null;
 }
 
+// Referral code from a `?ref=` link, kept for the session so it survives sign-in
+function referralCode(): string | undefined {
+    if (typeof window === 'undefined') return undefined;
+    const fromUrl = new URLSearchParams(window.location.search).get('ref');
+    if (fromUrl) sessionStorage.setItem('referral_code', fromUrl);
+    return sessionStorage.getItem('referral_code') ?? undefined;
+}
+
 function createAuthStore() {
     const { subscribe, set, update } = writable<AuthState>({
         user: null,
@@ -54,12 +64,16 @@ function createAuthStore() {
         syncError: null,
     });
 
-    const syncWithBackend = async (): Promise<{ isNew: boolean; hasVillage: boolean }> => {
+    // The tribe is only taken when the account is first created
+    const syncWithBackend = async (tribe?: TribeType): Promise<{ isNew: boolean; hasVillage: boolean }> => {
         update(state => ({ ...state, syncing: true, syncError: null }));
 
         try {
             // Sync user with backend
-            const syncResponse = await api.post<SyncResponse>('/api/auth/sync', {});
+            const syncResponse = await api.post<SyncResponse>('/api/auth/sync', {
+                tribe,
+                referral_code: referralCode(),
+            });
 
             // Check if user has villages
             const villages = await api.get<Village[]>('/api/villages');
@@ -113,6 +127,12 @@ function createAuthStore() {
             if (!auth) {
                 throw new Error('Firebase is not configured.');
             }
+            // Revoke this device's session; sign out locally even if it fails
+            try {
+                await api.delete('/api/auth/logout');
+            } catch (error) {
+                console.error('Failed to end session:', error);
+            }
             await signOut(auth);
             update(state => ({
                 ...state,
@@ -2,18 +2,74 @@ import { writable } from "svelte/store";
 import { toast } from "svelte-sonner";
 import { api } from "../api/client";
 
+export interface Note {
+    id: string;
+    author_id: string;
+    author_name: string | null;
+    target_type: 'village' | 'player';
+    target_id: string;
+    body: string;
+    // Set when shared with the alliance: the lowest role that can see it
+    min_role: 'leader' | 'officer' | 'member' | null;
+    created_at: string;
+    updated_at: string;
+}
+
 export interface MapVillageInfo {
     id: string;
     name: string;
     player_name: string | null;
     population: number;
     is_own: boolean;
+    // Readable notes on the village and its owner; absent when there are none
+    notes?: Note[];
+}
+
+export type OasisType =
+    | 'wood'
+    | 'wood_crop'
+    | 'clay'
+    | 'clay_crop'
+    | 'iron'
+    | 'iron_crop'
+    | 'crop'
+    | 'crop_high';
+
+export interface MapOasisInfo {
+    id: string;
+    oasis_type: OasisType;
+    occupied: boolean;
+}
+
+// Resource fields of a tile: wood, clay, iron and crop fields
+export type FieldType =
+    | '4446'
+    | '4437'
+    | '4347'
+    | '3447'
+    | '3456'
+    | '3546'
+    | '4356'
+    | '4536'
+    | '5346'
+    | '5436'
+    | '3339'
+    | '11115';
+
+export interface CropperTile {
+    x: number;
+    y: number;
+    field_type: FieldType;
+    distance: number;
 }
 
 export interface MapTile {
     x: number;
     y: number;
+    // None on an oasis
+    field_type: FieldType | null;
     village: MapVillageInfo | null;
+    oasis: MapOasisInfo | null;
 }
 
 interface MapState {
@@ -66,6 +122,11 @@ function createMapStore() {
             }
         },
 
+        // Free 9- and 15-cropper tiles around coordinates, nearest first
+        findCroppers: async (x: number, y: number, range: number = 15) => {
+            return api.get<CropperTile[]>(`/api/map/croppers?x=${x}&y=${y}&range=${range}`);
+        },
+
         // Set center coordinates
         setCenter: (x: number, y: number) => {
             update(state => ({ ...state, centerX: x, centerY: y }));
@@ -98,6 +159,11 @@ export function getVillageAt(tiles: MapTile[], x: number, y: number): MapVillage
     return tile?.village || null;
 }
 
+// Field counts of a field type, e.g. '3339' -> [3, 3, 3, 9]
+export function fieldCounts(fieldType: FieldType): number[] {
+    return fieldType === '11115' ? [1, 1, 1, 15] : fieldType.split('').map(Number);
+}
+
 // Helper to determine owner type from API response
 export function getOwnerType(village: MapVillageInfo | null): 'self' | 'ally' | 'enemy' | 'neutral' | 'npc' | null {
     if (!village) return null;
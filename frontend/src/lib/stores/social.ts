@@ -0,0 +1,83 @@
+import { writable } from "svelte/store";
+import { toast } from "svelte-sonner";
+import { api } from "../api/client";
+
+// Another player as shown in the social panel
+export interface SocialEntry {
+    user_id: string;
+    display_name: string | null;
+    // When they became friends, the request was sent, or the block was made
+    since: string;
+}
+
+export interface SocialPanel {
+    friends: SocialEntry[];
+    incoming: SocialEntry[];
+    outgoing: SocialEntry[];
+    blocked: SocialEntry[];
+}
+
+interface SocialState extends SocialPanel {
+    loading: boolean;
+    error: string | null;
+}
+
+function createSocialStore() {
+    const { subscribe, update } = writable<SocialState>({
+        friends: [],
+        incoming: [],
+        outgoing: [],
+        blocked: [],
+        loading: false,
+        error: null,
+    });
+
+    const load = async () => {
+        update(state => ({ ...state, loading: true, error: null }));
+        try {
+            const panel = await api.get<SocialPanel>('/api/social');
+            update(state => ({ ...state, ...panel, loading: false }));
+        } catch (error: any) {
+            update(state => ({
+                ...state,
+                loading: false,
+                error: error.message || 'Failed to load friends',
+            }));
+        }
+    };
+
+    // Run an action, then reload the panel
+    const act = async (action: () => Promise<unknown>, success: string, failure: string) => {
+        try {
+            await action();
+            toast.success(success);
+            await load();
+        } catch (error: any) {
+            toast.error(failure, { description: error.message });
+            throw error;
+        }
+    };
+
+    return {
+        subscribe,
+        load,
+
+        requestFriend: (userId: string) =>
+            act(() => api.post('/api/social/friends', { user_id: userId }), 'Friend Request Sent', 'Request Failed'),
+
+        acceptFriend: (userId: string) =>
+            act(() => api.post(`/api/social/friends/${userId}/accept`, {}), 'Friend Added', 'Accept Failed'),
+
+        // Also cancels or declines a pending request
+        removeFriend: (userId: string) =>
+            act(() => api.delete(`/api/social/friends/${userId}`), 'Friend Removed', 'Remove Failed'),
+
+        block: (userId: string) =>
+            act(() => api.post('/api/social/blocks', { user_id: userId }), 'Player Blocked', 'Block Failed'),
+
+        unblock: (userId: string) =>
+            act(() => api.delete(`/api/social/blocks/${userId}`), 'Player Unblocked', 'Unblock Failed'),
+    };
+}
+
+export const socialStore = createSocialStore();
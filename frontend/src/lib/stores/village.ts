@@ -1,6 +1,7 @@
 import { writable, get } from "svelte/store";
 import { toast } from "svelte-sonner";
 import { api } from "../api/client";
+import type { FieldType } from "./map";
 
 // Building types matching backend enum + frontend-only types
 export type BuildingType =
@@ -24,7 +25,12 @@ export type BuildingType =
     | 'wall'
     | 'cranny'
     | 'hero_mansion'
+    | 'tournament_square'
+    | 'hospital'
     | 'tavern'
+    | 'elephant_trough'
+    | 'brewery'
+    | 'trapper'
     | 'woodcutter'
     | 'clay_pit'
     | 'iron_mine'
@@ -54,6 +60,29 @@ export interface ProductionRates {
     crop_per_hour: number;
     crop_consumption: number;
     net_crop_per_hour: number;
+    breakdown: ProductionBreakdown;
+}
+
+/** Production per hour of each resource from one source */
+export interface ProductionShare {
+    wood: number;
+    clay: number;
+    iron: number;
+    crop: number;
+}
+
+/** Where production comes from; the shares add up to the rates */
+export interface ProductionBreakdown {
+    /** Base production plus the resource fields */
+    fields: ProductionShare;
+    /** Percent added by the oases the village holds */
+    oasis_bonus: ProductionShare;
+    oases: ProductionShare;
+    tribe: ProductionShare;
+    /** Holding the village's region, on region control worlds */
+    region: ProductionShare;
+    /** Resource points of heroes living in the village */
+    hero: ProductionShare;
 }
 
 export interface Village {
@@ -70,19 +99,83 @@ export interface Village {
     granary_capacity: number;
     population: number;
     culture_points: number;
+    culture_per_day: number;
     loyalty: number;
+    /** Resource fields of the village's tile, e.g. '4446' */
+    field_type: FieldType;
     created_at: string;
+    /** Stores that are full; their production is paused */
+    overflow: StorageOverflow;
     production?: ProductionRates;
 }
 
+export interface StorageOverflow {
+    wood: boolean;
+    clay: boolean;
+    iron: boolean;
+    crop: boolean;
+}
+
+export interface ResourceShipment {
+    id: string;
+    sender_id: string;
+    receiver_id: string;
+    from_village_id: string;
+    to_village_id: string;
+    wood: number;
+    clay: number;
+    iron: number;
+    crop: number;
+    merchants: number;
+    sent_at: string;
+    arrives_at: string;
+    returns_at: string;
+    delivered: boolean;
+}
+
+export interface Market {
+    merchants: number;
+    merchants_busy: number;
+    merchant_capacity: number;
+    outgoing: ResourceShipment[];
+    incoming: ResourceShipment[];
+}
+
+export interface SendResourcesRequest {
+    to_village_id: string;
+    wood?: number;
+    clay?: number;
+    iron?: number;
+    crop?: number;
+}
+
+/** A paid order waiting for its build slot to free up */
+export interface BuildOrder {
+    id: string;
+    village_id: string;
+    building_id: string | null;
+    slot: number;
+    building_type: BuildingType;
+    target_level: number;
+    wood: number;
+    clay: number;
+    iron: number;
+    crop: number;
+    time_seconds: number;
+    created_at: string;
+}
+
+/** `building` is missing when the order had to wait (see `waiting`) */
 interface BuildResponse {
-    building: Building;
+    building?: Building;
     cost: BuildingCost;
+    waiting?: BuildOrder;
 }
 
 interface UpgradeResponse {
     building: Building;
     cost: BuildingCost;
+    waiting?: BuildOrder;
 }
 
 interface VillageState {
@@ -162,6 +255,45 @@ function createVillageStore() {
             update(state => ({ ...state, currentVillage: village }));
         },
 
+        // Make a village with a palace the capital
+        setCapital: async (villageId: string) => {
+            try {
+                const village = await api.post<Village>(`/api/villages/${villageId}/capital`, {});
+                update(state => ({
+                    ...state,
+                    villages: state.villages.map(v => ({ ...v, is_capital: v.id === village.id })),
+                    currentVillage: state.currentVillage?.id === village.id
+                        ? village
+                        : state.currentVillage && { ...state.currentVillage, is_capital: false },
+                }));
+                toast.success('Capital Moved', { description: `${village.name} is now your capital` });
+                return village;
+            } catch (error: any) {
+                toast.error('Capital Change Failed', { description: error.message || 'Failed to move capital' });
+                throw error;
+            }
+        },
+
+        // Merchants and shipments of a village's market
+        getMarket: async (villageId: string) => {
+            return api.get<Market>(`/api/villages/${villageId}/market`);
+        },
+
+        // Send resources with merchants; refused past the transfer limits
+        sendResources: async (villageId: string, request: SendResourcesRequest) => {
+            try {
+                const shipment = await api.post<ResourceShipment>(
+                    `/api/villages/${villageId}/market/send`,
+                    request
+                );
+                toast.success('Merchants Sent', { description: 'Resources are on their way' });
+                return shipment;
+            } catch (error: any) {
+                toast.error('Sending Failed', { description: error.message || 'Failed to send resources' });
+                throw error;
+            }
+        },
+
         // Build new building
         build: async (villageId: string, slot: number, buildingType: BuildingType) => {
             update(state => ({ ...state, loading: true, error: null }));
@@ -172,10 +304,11 @@ function createVillageStore() {
                 );
 
                 // Update buildings and build queue
+                const building = response.building;
                 update(state => ({
                     ...state,
-                    buildings: [...state.buildings, response.building],
-                    buildQueue: [...state.buildQueue, response.building],
+                    buildings: building ? [...state.buildings, building] : state.buildings,
+                    buildQueue: building ? [...state.buildQueue, building] : state.buildQueue,
                     loading: false,
                 }));
 
@@ -183,9 +316,15 @@ function createVillageStore() {
                 const village = await api.get<Village>(`/api/villages/${villageId}`);
                 update(state => ({ ...state, currentVillage: village }));
 
-                toast.success('Construction Started', {
-                    description: `${formatBuildingType(buildingType)} is now being built`
-                });
+                if (response.waiting) {
+                    toast.success('Construction Queued', {
+                        description: `${formatBuildingType(buildingType)} starts when the build slot frees up`
+                    });
+                } else {
+                    toast.success('Construction Started', {
+                        description: `${formatBuildingType(buildingType)} is now being built`
+                    });
+                }
 
                 return response;
             } catch (error: any) {
@@ -210,12 +349,13 @@ function createVillageStore() {
                 );
 
                 // Update buildings list
+                const waiting = response.waiting;
                 update(state => ({
                     ...state,
                     buildings: state.buildings.map(b =>
                         b.slot === slot ? response.building : b
                     ),
-                    buildQueue: [...state.buildQueue, response.building],
+                    buildQueue: waiting ? state.buildQueue : [...state.buildQueue, response.building],
                     loading: false,
                 }));
 
@@ -223,9 +363,15 @@ function createVillageStore() {
                 const village = await api.get<Village>(`/api/villages/${villageId}`);
                 update(state => ({ ...state, currentVillage: village }));
 
-                toast.success('Upgrade Started', {
-                    description: `${formatBuildingType(response.building.building_type)} upgrading to level ${response.building.level + 1}`
-                });
+                if (waiting) {
+                    toast.success('Upgrade Queued', {
+                        description: `${formatBuildingType(waiting.building_type)} to level ${waiting.target_level} starts when the build slot frees up`
+                    });
+                } else {
+                    toast.success('Upgrade Started', {
+                        description: `${formatBuildingType(response.building.building_type)} upgrading to level ${response.building.level + 1}`
+                    });
+                }
 
                 return response;
             } catch (error: any) {